@@ -0,0 +1,85 @@
+/*
+ * Copyright (c) 2019 OysterPack, Inc.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ * http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package main
+
+import (
+	"flag"
+	"fmt"
+	"log"
+	"path/filepath"
+)
+
+var name = flag.String("name", "", "app name - must be a valid DNS label, i.e., lowercase alphanumeric characters or '-'")
+var module = flag.String("module", "", "Go module path, e.g., github.com/oysterpack/foo")
+var dir = flag.String("dir", "", "output directory - defaults to ./${name}")
+var force = flag.Bool("f", false, "overwrite existing files")
+var help = flag.Bool("h", false, "prints help")
+
+// used to scaffold a new fxapp based service
+//
+// Command Line Flags
+//
+//	-name app name
+//	-module Go module path
+//	-dir output directory
+//	-f overwrite existing files
+func main() {
+	flag.Parse()
+	if *help {
+		fmt.Println(`andiamo is a tool used to scaffold a new fxapp based service
+
+Usage:
+
+   andiamo -name NAME -module MODULE [-dir DIR] [-f]
+
+   The following files are generated:
+     - main.go - builds and runs the app, where the app descriptor is loaded from env vars. The "validate" subcommand
+       validates the app wiring without running the app, e.g., in CI: go run . validate
+       The "helm-values" subcommand prints the env vars that the app understands as Helm values.yaml
+     - component.go - component skeleton with events, errors, and a health check
+     - app.env - app descriptor env vars, e.g., for local runs: docker run --env-file app.env
+     - Dockerfile
+     - k8s/deployment.yaml - k8s Deployment and Service, wired to the readiness, liveness, and metrics endpoints
+
+   The app ID, release ID, and component IDs are generated ULIDs.
+
+Flags:`)
+		flag.PrintDefaults()
+		return
+	}
+
+	s, err := newScaffold(*name, *module)
+	if err != nil {
+		log.Fatal(err)
+	}
+	if *dir == "" {
+		*dir = s.Name
+	}
+	files, err := s.generate(*dir, *force)
+	if err != nil {
+		log.Fatal(err)
+	}
+	for _, f := range files {
+		fmt.Println(filepath.Join(*dir, f))
+	}
+	fmt.Printf(`
+next steps:
+  cd %s
+  go mod init %s
+  go mod tidy
+`, *dir, s.Module)
+}
@@ -0,0 +1,157 @@
+/*
+ * Copyright (c) 2019 OysterPack, Inc.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ * http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package main
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"github.com/oysterpack/andiamo/pkg/appdesc"
+	"github.com/oysterpack/andiamo/pkg/fxapp"
+	"github.com/oysterpack/andiamo/pkg/ulids"
+	"go.uber.org/multierr"
+	"go/format"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+	"text/template"
+)
+
+// scaffold validation errors
+var (
+	ErrInvalidName = errors.New("`name` must be a valid DNS label, i.e., lowercase alphanumeric characters or '-', and must start and end with an alphanumeric character")
+	ErrBlankModule = errors.New("`module` is required")
+	ErrFileExists  = errors.New("file already exists - use the -f flag to overwrite")
+)
+
+// DNS-1123 label, which is required for k8s resource names
+var nameRegexp = regexp.MustCompile(`^[a-z0-9]([-a-z0-9]{0,61}[a-z0-9])?$`)
+
+// scaffold is the template data
+type scaffold struct {
+	Name   string
+	Module string
+
+	EnvPrefix string
+	AppID     string
+	ReleaseID string
+
+	ComponentID   string
+	StartedEvent  string
+	HealthCheckID string
+
+	HTTPPort          int
+	ReadinessEndpoint string
+	LivenessEndpoint  string
+	MetricsEndpoint   string
+}
+
+func newScaffold(name, module string) (*scaffold, error) {
+	name = strings.TrimSpace(name)
+	module = strings.TrimSpace(module)
+	var err error
+	if !nameRegexp.MatchString(name) {
+		err = multierr.Append(err, fmt.Errorf("%s : %q", ErrInvalidName, name))
+	}
+	if module == "" {
+		err = multierr.Append(err, ErrBlankModule)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	ids := ulids.NewBatchGenerator(ulids.GeneratorOpts{Monotonic: true})(5)
+	return &scaffold{
+		Name:   name,
+		Module: module,
+
+		EnvPrefix: appdesc.EnvPrefix,
+		AppID:     ids[0].String(),
+		ReleaseID: ids[1].String(),
+
+		ComponentID:   ids[2].String(),
+		StartedEvent:  ids[3].String(),
+		HealthCheckID: ids[4].String(),
+
+		HTTPPort:          8008,
+		ReadinessEndpoint: "/" + fxapp.ReadyEvent,
+		LivenessEndpoint:  "/" + fxapp.LivenessProbeEvent,
+		MetricsEndpoint:   fxapp.DefaultPrometheusHTTPHandlerOpts().Endpoint,
+	}, nil
+}
+
+// generate renders the templates into the directory and returns the generated file paths, relative to the directory.
+// Go source files are formatted via gofmt.
+//
+// If any of the files already exist and force is false, then no files are generated.
+func (s *scaffold) generate(dir string, force bool) ([]string, error) {
+	rendered := make(map[string][]byte, len(templates))
+	for _, f := range templates {
+		buf := new(bytes.Buffer)
+		if err := f.template.Execute(buf, s); err != nil {
+			return nil, fmt.Errorf("%s : %v", f.path, err)
+		}
+		content := buf.Bytes()
+		if filepath.Ext(f.path) == ".go" {
+			formatted, err := format.Source(content)
+			if err != nil {
+				return nil, fmt.Errorf("%s : %v", f.path, err)
+			}
+			content = formatted
+		}
+		rendered[f.path] = content
+
+		if !force {
+			if _, err := os.Stat(filepath.Join(dir, f.path)); err == nil {
+				return nil, fmt.Errorf("%s : %s", ErrFileExists, filepath.Join(dir, f.path))
+			}
+		}
+	}
+
+	files := make([]string, 0, len(templates))
+	for _, f := range templates {
+		path := filepath.Join(dir, f.path)
+		if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+			return files, err
+		}
+		if err := ioutil.WriteFile(path, rendered[f.path], 0644); err != nil {
+			return files, err
+		}
+		files = append(files, f.path)
+	}
+	return files, nil
+}
+
+type fileTemplate struct {
+	path     string
+	template *template.Template
+}
+
+func newFileTemplate(path, text string) fileTemplate {
+	return fileTemplate{path, template.Must(template.New(path).Parse(text))}
+}
+
+// templates are rendered in the order listed
+var templates = []fileTemplate{
+	newFileTemplate("main.go", mainTemplate),
+	newFileTemplate("component.go", componentTemplate),
+	newFileTemplate("app.env", envTemplate),
+	newFileTemplate("Dockerfile", dockerfileTemplate),
+	newFileTemplate(filepath.Join("k8s", "deployment.yaml"), k8sTemplate),
+}
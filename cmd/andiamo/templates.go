@@ -0,0 +1,231 @@
+/*
+ * Copyright (c) 2019 OysterPack, Inc.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ * http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package main
+
+const mainTemplate = `package main
+
+import (
+	"fmt"
+	"github.com/oysterpack/andiamo/pkg/appdesc"
+	"github.com/oysterpack/andiamo/pkg/fxapp"
+	"log"
+	"os"
+)
+
+// The app descriptor is loaded from env vars - see app.env
+//
+// Subcommands:
+//	validate - validates the app wiring without running the app, e.g., in CI
+//	helm-values - prints the env vars that the app understands as Helm values.yaml
+func main() {
+	desc, err := appdesc.Load(appdesc.EnvPrefix)
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	builder := fxapp.NewBuilderFromDesc(desc).
+		EnableInstanceMetadata().
+		RegisterComponents(Component)
+	if len(os.Args) > 1 {
+		switch os.Args[1] {
+		case "validate":
+			if err := builder.Validate(); err != nil {
+				log.Fatal(err)
+			}
+			fmt.Println("app is valid")
+			return
+		case "helm-values":
+			os.Stdout.Write(fxapp.HelmValues(desc, builder.EnvCatalog()))
+			return
+		}
+	}
+
+	app, err := builder.Build()
+	if err != nil {
+		log.Fatal(err)
+	}
+	if err := app.Run(); err != nil {
+		log.Fatal(err)
+	}
+	// the exit code reports why the instance exited, e.g., health critical
+	if reason, ok := app.ShutdownReason(); ok {
+		os.Exit(reason.ExitCode())
+	}
+}
+`
+
+const componentTemplate = `package main
+
+import (
+	"context"
+	"errors"
+	"github.com/oysterpack/andiamo/pkg/eventlog"
+	"github.com/oysterpack/andiamo/pkg/fx/health"
+	"github.com/oysterpack/andiamo/pkg/fxapp"
+	"github.com/rs/zerolog"
+)
+
+// component events
+const (
+	// StartedEvent is logged when the component is started
+	StartedEvent = "{{.StartedEvent}}"
+)
+
+// component errors
+var (
+	ErrNotImplemented = errors.New("not implemented")
+)
+
+// component health checks
+const (
+	ServiceHealthCheckID = "{{.HealthCheckID}}"
+)
+
+// Component is the {{.Name}} app component
+var Component = fxapp.Component{
+	ID:      "{{.ComponentID}}",
+	Name:    "{{.Name}}",
+	Version: "0.1.0",
+	Provide: []interface{}{
+		NewService,
+	},
+	Invoke: []interface{}{
+		func(service *Service, logger *zerolog.Logger) {
+			logStarted := eventlog.NewLogger(StartedEvent, logger, zerolog.InfoLevel)
+			logStarted(nil, "started")
+		},
+	},
+	Events: []string{StartedEvent},
+	Errors: []error{ErrNotImplemented},
+	HealthChecks: []fxapp.ComponentHealthCheck{
+		{
+			Check: health.Check{
+				ID:          ServiceHealthCheckID,
+				Description: "checks that the {{.Name}} service is healthy",
+				RedImpact:   "the {{.Name}} service is unavailable",
+			},
+			Checker: func(service *Service) func(ctx context.Context) (health.Status, error) {
+				return service.Check
+			},
+		},
+	},
+}
+
+// Service implements the {{.Name}} service
+type Service struct{}
+
+// NewService constructs a new Service
+func NewService() *Service {
+	return &Service{}
+}
+
+// Check is the service health checker
+func (s *Service) Check(ctx context.Context) (health.Status, error) {
+	return health.Green, nil
+}
+`
+
+const envTemplate = `{{.EnvPrefix}}_ID={{.AppID}}
+{{.EnvPrefix}}_NAME={{.Name}}
+{{.EnvPrefix}}_VERSION=0.1.0
+{{.EnvPrefix}}_RELEASE_ID={{.ReleaseID}}
+`
+
+const dockerfileTemplate = `FROM golang:1.20 AS build
+WORKDIR /src
+COPY go.mod go.sum ./
+RUN go mod download
+COPY . .
+RUN CGO_ENABLED=0 go build -o /{{.Name}} .
+
+FROM gcr.io/distroless/static
+COPY --from=build /{{.Name}} /{{.Name}}
+EXPOSE {{.HTTPPort}}
+ENTRYPOINT ["/{{.Name}}"]
+`
+
+const k8sTemplate = `apiVersion: apps/v1
+kind: Deployment
+metadata:
+  name: {{.Name}}
+  labels:
+    app: {{.Name}}
+spec:
+  replicas: 1
+  selector:
+    matchLabels:
+      app: {{.Name}}
+  template:
+    metadata:
+      labels:
+        app: {{.Name}}
+      annotations:
+        prometheus.io/scrape: "true"
+        prometheus.io/path: "{{.MetricsEndpoint}}"
+        prometheus.io/port: "{{.HTTPPort}}"
+    spec:
+      containers:
+      - name: {{.Name}}
+        image: {{.Name}}:0.1.0
+        ports:
+        - name: http
+          containerPort: {{.HTTPPort}}
+        env:
+        - name: {{.EnvPrefix}}_ID
+          value: "{{.AppID}}"
+        - name: {{.EnvPrefix}}_NAME
+          value: "{{.Name}}"
+        - name: {{.EnvPrefix}}_VERSION
+          value: "0.1.0"
+        - name: {{.EnvPrefix}}_RELEASE_ID
+          value: "{{.ReleaseID}}"
+        # instance metadata - see appdesc.LoadInstanceMetadata()
+        - name: POD_NAME
+          valueFrom:
+            fieldRef:
+              fieldPath: metadata.name
+        - name: POD_NAMESPACE
+          valueFrom:
+            fieldRef:
+              fieldPath: metadata.namespace
+        - name: NODE_NAME
+          valueFrom:
+            fieldRef:
+              fieldPath: spec.nodeName
+        readinessProbe:
+          httpGet:
+            path: {{.ReadinessEndpoint}}
+            port: http
+        livenessProbe:
+          httpGet:
+            path: {{.LivenessEndpoint}}
+            port: http
+---
+apiVersion: v1
+kind: Service
+metadata:
+  name: {{.Name}}
+  labels:
+    app: {{.Name}}
+spec:
+  selector:
+    app: {{.Name}}
+  ports:
+  - name: http
+    port: {{.HTTPPort}}
+    targetPort: http
+`
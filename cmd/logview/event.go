@@ -0,0 +1,190 @@
+/*
+ * Copyright (c) 2019 OysterPack, Inc.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ * http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// standard log event field names - see eventlog and fxapp packages
+const (
+	timestampField = "t"
+	levelField     = "l"
+	messageField   = "m"
+	errorField     = "e"
+	eventField     = "n"
+	xidField       = "x"
+	dataField      = "d"
+	tagsField      = "g"
+
+	componentIDField      = "c"
+	componentNameField    = "cn"
+	componentVersionField = "cv"
+)
+
+// logEvent is a decoded log event
+type logEvent struct {
+	Time      time.Time
+	Level     string
+	Message   string
+	Error     string
+	Event     string
+	Component string
+	Data      json.RawMessage
+	Tags      []string
+
+	// the remaining fields, e.g., app IDs, instance metadata, component name and version
+	Fields map[string]json.RawMessage
+}
+
+// parseLogEvent decodes the JSON log event
+func parseLogEvent(line []byte) (*logEvent, error) {
+	var fields map[string]json.RawMessage
+	if err := json.Unmarshal(line, &fields); err != nil {
+		return nil, err
+	}
+
+	str := func(name string) string {
+		raw, ok := fields[name]
+		if !ok {
+			return ""
+		}
+		delete(fields, name)
+		var s string
+		if err := json.Unmarshal(raw, &s); err != nil {
+			return string(raw)
+		}
+		return s
+	}
+
+	e := &logEvent{
+		Level:     str(levelField),
+		Message:   str(messageField),
+		Error:     str(errorField),
+		Event:     str(eventField),
+		Component: str(componentIDField),
+	}
+	if raw, ok := fields[timestampField]; ok {
+		delete(fields, timestampField)
+		e.Time = parseTimestamp(raw)
+	}
+	if raw, ok := fields[dataField]; ok {
+		delete(fields, dataField)
+		e.Data = raw
+	}
+	if raw, ok := fields[tagsField]; ok {
+		delete(fields, tagsField)
+		json.Unmarshal(raw, &e.Tags)
+	}
+	e.Fields = fields
+	return e, nil
+}
+
+// the timestamp is logged in Unix time format, but RFC 3339 formatted timestamps are also supported
+func parseTimestamp(raw json.RawMessage) time.Time {
+	if secs, err := strconv.ParseFloat(string(raw), 64); err == nil {
+		return time.Unix(0, int64(secs*float64(time.Second)))
+	}
+	var s string
+	if err := json.Unmarshal(raw, &s); err == nil {
+		if t, err := time.Parse(time.RFC3339Nano, s); err == nil {
+			return t
+		}
+	}
+	return time.Time{}
+}
+
+// component returns the component ID, qualified by the component name if it is logged, e.g., "01DH8XG3VRM0M3V5T3RFP2A6WN/foo"
+func (e *logEvent) component() string {
+	raw, ok := e.Fields[componentNameField]
+	if !ok {
+		return e.Component
+	}
+	var name string
+	json.Unmarshal(raw, &name)
+	return e.Component + "/" + name
+}
+
+// levels are abbreviated to a fixed width, which makes the output easier to scan
+var levelAbbreviations = map[string]string{
+	"debug": "DBG",
+	"info":  "INF",
+	"warn":  "WRN",
+	"error": "ERR",
+	"fatal": "FTL",
+	"panic": "PNC",
+}
+
+// pretty formats the log event as a single line:
+//
+//	<time> <level> <event> [<component>] <message> d=<data> e=<error> g=<tags> <fields>
+//
+// The app and instance fields are only included when verbose is true.
+func (e *logEvent) pretty(location *time.Location, verbose bool) string {
+	buf := new(bytes.Buffer)
+	if e.Time.IsZero() {
+		buf.WriteString("-")
+	} else {
+		buf.WriteString(e.Time.In(location).Format(time.RFC3339))
+	}
+
+	level, ok := levelAbbreviations[e.Level]
+	switch {
+	case ok:
+	case e.Level == "":
+		level = "---"
+	default:
+		level = strings.ToUpper(e.Level)
+	}
+	fmt.Fprintf(buf, " %s", level)
+
+	if e.Event != "" {
+		fmt.Fprintf(buf, " %s", e.Event)
+	}
+	if e.Component != "" {
+		fmt.Fprintf(buf, " [%s]", e.component())
+	}
+	fmt.Fprintf(buf, " %s", e.Message)
+	if len(e.Data) > 0 {
+		fmt.Fprintf(buf, " d=%s", e.Data)
+	}
+	if e.Error != "" {
+		fmt.Fprintf(buf, " e=%q", e.Error)
+	}
+	if len(e.Tags) > 0 {
+		fmt.Fprintf(buf, " g=%s", strings.Join(e.Tags, ","))
+	}
+	if verbose {
+		names := make([]string, 0, len(e.Fields))
+		for name := range e.Fields {
+			if name != componentNameField {
+				names = append(names, name)
+			}
+		}
+		sort.Strings(names)
+		for _, name := range names {
+			fmt.Fprintf(buf, " %s=%s", name, e.Fields[name])
+		}
+	}
+	return buf.String()
+}
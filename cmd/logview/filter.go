@@ -0,0 +1,134 @@
+/*
+ * Copyright (c) 2019 OysterPack, Inc.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ * http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package main
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+)
+
+// filter validation errors
+var (
+	ErrInvalidLevel = errors.New("level must be one of: debug, info, warn, error, fatal, panic")
+	ErrInvalidTime  = errors.New("time must be RFC 3339 formatted, e.g., 2019-08-10T11:23:59Z, or a duration relative to now, e.g., 15m")
+)
+
+// zerolog levels, ordered by severity
+var levels = map[string]int{
+	"debug": 0,
+	"info":  1,
+	"warn":  2,
+	"error": 3,
+	"fatal": 4,
+	"panic": 5,
+}
+
+// filter is used to select log events. Zero value fields are not applied.
+type filter struct {
+	events     map[string]bool
+	components []string
+	// min level - events that were logged with no level are excluded if set
+	level        string
+	since, until time.Time
+}
+
+func newFilter(events, components, level, since, until string, now time.Time) (*filter, error) {
+	f := &filter{
+		components: splitList(components),
+		level:      strings.ToLower(strings.TrimSpace(level)),
+	}
+	if ids := splitList(events); len(ids) > 0 {
+		f.events = make(map[string]bool, len(ids))
+		for _, id := range ids {
+			f.events[id] = true
+		}
+	}
+	if _, ok := levels[f.level]; f.level != "" && !ok {
+		return nil, fmt.Errorf("%s : %q", ErrInvalidLevel, level)
+	}
+	var err error
+	if f.since, err = parseTime(since, now); err != nil {
+		return nil, fmt.Errorf("-since : %s", err)
+	}
+	if f.until, err = parseTime(until, now); err != nil {
+		return nil, fmt.Errorf("-until : %s", err)
+	}
+	return f, nil
+}
+
+func splitList(s string) []string {
+	var values []string
+	for _, v := range strings.Split(s, ",") {
+		if v = strings.TrimSpace(v); v != "" {
+			values = append(values, v)
+		}
+	}
+	return values
+}
+
+// parseTime parses either an RFC 3339 timestamp or a duration, which is relative to now, i.e., now - duration
+func parseTime(s string, now time.Time) (time.Time, error) {
+	s = strings.TrimSpace(s)
+	if s == "" {
+		return time.Time{}, nil
+	}
+	if t, err := time.Parse(time.RFC3339Nano, s); err == nil {
+		return t, nil
+	}
+	if d, err := time.ParseDuration(s); err == nil {
+		return now.Add(-d), nil
+	}
+	return time.Time{}, fmt.Errorf("%s : %q", ErrInvalidTime, s)
+}
+
+// matches returns true if the event matches all of the filter criteria.
+// Components are matched on either the component ID or name.
+func (f *filter) matches(e *logEvent) bool {
+	if f.events != nil && !f.events[e.Event] {
+		return false
+	}
+	if len(f.components) > 0 && !f.matchesComponent(e) {
+		return false
+	}
+	if f.level != "" {
+		level, ok := levels[e.Level]
+		if !ok || level < levels[f.level] {
+			return false
+		}
+	}
+	if !f.since.IsZero() && e.Time.Before(f.since) {
+		return false
+	}
+	if !f.until.IsZero() && e.Time.After(f.until) {
+		return false
+	}
+	return true
+}
+
+func (f *filter) matchesComponent(e *logEvent) bool {
+	if e.Component == "" {
+		return false
+	}
+	for _, c := range f.components {
+		if c == e.Component || c == strings.TrimPrefix(e.component(), e.Component+"/") {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,171 @@
+/*
+ * Copyright (c) 2019 OysterPack, Inc.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ * http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package main
+
+import (
+	"bufio"
+	"flag"
+	"fmt"
+	"io"
+	"log"
+	"os"
+	"time"
+)
+
+var events = flag.String("event", "", "comma separated list of event IDs (n) to select")
+var components = flag.String("component", "", "comma separated list of component IDs (c) or names (cn) to select")
+var level = flag.String("level", "", "min level to select, i.e., debug, info, warn, error, fatal, panic - events logged with no level are excluded")
+var since = flag.String("since", "", "select events logged at or after the specified time - RFC 3339 timestamp, or duration relative to now, e.g., 15m")
+var until = flag.String("until", "", "select events logged at or before the specified time - RFC 3339 timestamp, or duration relative to now, e.g., 5m")
+var follow = flag.Bool("f", false, "follow the log file, i.e., wait for new log events to be appended")
+var rawJSON = flag.Bool("json", false, "output the selected events as the original JSON, i.e., logview is used as a filter")
+var verbose = flag.Bool("v", false, "include all fields, e.g., app ID (a), release ID (r), instance ID (i), and event XID (x)")
+var utc = flag.Bool("utc", false, "display times in UTC instead of local time")
+var help = flag.Bool("h", false, "prints help")
+
+// used to view andiamo JSON logs
+//
+// Command Line Flags
+//
+//	-event selects events by ID
+//	-component selects events by component ID or name
+//	-level selects events by min level
+//	-since, -until select events by time range
+//	-f follows the log file
+//	-json outputs the selected events as JSON
+//	-v includes all fields
+//	-utc displays times in UTC
+func main() {
+	flag.Parse()
+	if *help {
+		fmt.Println(`logview is a tool used to view andiamo JSON logs, i.e., it understands the standard short field names:
+
+   t -> timestamp (Unix time)
+   l -> level
+   m -> message
+   e -> error
+   n -> event ID
+   x -> event XID
+   d -> event data
+   g -> event tags
+   c -> component ID, cn -> component name, cv -> component version
+   a -> app ID, r -> app release ID, i -> app instance ID
+
+Each selected event is pretty printed on a single line:
+
+   <time> <level> <event> [<component>] <message> d=<data> e=<error> g=<tags>
+
+Lines that are not JSON are printed as is, unless filters are specified.
+
+Usage:
+
+   logview [flags] [FILE]
+
+   if FILE is not specified, then the log is read from stdin, e.g., kubectl logs -f POD | logview -level warn
+
+Flags:`)
+		flag.PrintDefaults()
+		return
+	}
+
+	f, err := newFilter(*events, *components, *level, *since, *until, time.Now())
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	var r io.Reader = os.Stdin
+	switch flag.NArg() {
+	case 0:
+		if *follow {
+			log.Fatal("-f requires a FILE - stdin is read until it is closed")
+		}
+	case 1:
+		file, err := os.Open(flag.Arg(0))
+		if err != nil {
+			log.Fatal(err)
+		}
+		defer file.Close()
+		r = file
+	default:
+		log.Fatal("at most 1 FILE may be specified")
+	}
+
+	location := time.Local
+	if *utc {
+		location = time.UTC
+	}
+	filtered := *events != "" || *components != "" || *level != "" || *since != "" || *until != ""
+	out := bufio.NewWriter(os.Stdout)
+	defer out.Flush()
+	err = readLines(r, *follow, func(line []byte) {
+		e, err := parseLogEvent(line)
+		switch {
+		case err != nil:
+			if filtered {
+				return
+			}
+			out.Write(line)
+		case !f.matches(e):
+			return
+		case *rawJSON:
+			out.Write(line)
+		default:
+			out.WriteString(e.pretty(location, *verbose))
+		}
+		out.WriteByte('\n')
+		// when following, events are displayed as they are logged
+		if *follow {
+			out.Flush()
+		}
+	})
+	if err != nil {
+		out.Flush()
+		log.Fatal(err)
+	}
+}
+
+// the interval used to poll the file for new log events when following
+const followPollInterval = 250 * time.Millisecond
+
+// readLines reads the lines until EOF, without the trailing newline. Blank lines are skipped.
+//
+// If follow is true, then EOF is not treated as the end, i.e., the reader is polled for new lines. Partial lines are
+// buffered until the line is terminated.
+func readLines(r io.Reader, follow bool, handle func(line []byte)) error {
+	reader := bufio.NewReader(r)
+	var partial []byte
+	for {
+		line, err := reader.ReadBytes('\n')
+		partial = append(partial, line...)
+		switch {
+		case err == io.EOF && follow:
+			time.Sleep(followPollInterval)
+			continue
+		case err == io.EOF:
+			if len(partial) > 0 {
+				handle(partial)
+			}
+			return nil
+		case err != nil:
+			return err
+		}
+		if line := partial[:len(partial)-1]; len(line) > 0 {
+			handle(line)
+		}
+		partial = partial[:0]
+	}
+}
@@ -0,0 +1,149 @@
+/*
+ * Copyright (c) 2019 OysterPack, Inc.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ * http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package main
+
+import (
+	"archive/tar"
+	"compress/gzip"
+	"flag"
+	"fmt"
+	"github.com/oysterpack/andiamo/pkg/fxapp"
+	"io"
+	"log"
+	"mime"
+	"net/http"
+	"os"
+	"strings"
+	"time"
+)
+
+var baseURL = flag.String("url", "http://localhost:8008", "app HTTP server base URL")
+var token = flag.String("token", "", "admin bearer token - defaults to the "+fxapp.AdminBearerTokenEnvVar+" env var")
+var output = flag.String("o", "", "output file - defaults to the file name that is provided by the app, i.e., support-bundle-${INSTANCE_ID}-${UNIX_TIME}.tar.gz")
+var list = flag.String("l", "", "lists the files in the specified support bundle, instead of downloading a support bundle")
+var timeout = flag.Duration("timeout", time.Minute, "HTTP request timeout")
+var help = flag.Bool("h", false, "prints help")
+
+// used to download an app support bundle, i.e., a tar.gz archive of the app state that is designed to be attached to
+// incident tickets
+//
+// Command Line Flags
+//
+//	-url app HTTP server base URL
+//	-token admin bearer token
+//	-o output file
+//	-l lists the files in a support bundle
+//	-timeout HTTP request timeout
+func main() {
+	flag.Parse()
+	if *help {
+		fmt.Println(`supportbundle is a tool used to download an app support bundle via the app's support bundle endpoint, i.e.,
+/` + fxapp.SupportBundleEndpoint + `
+
+The support bundle is a tar.gz archive that contains the app info, effective config (redacted), dependency graph,
+health check results, metrics, recent events (if the replay buffer is enabled), and goroutine stacks.
+
+Usage:
+
+   supportbundle [-url URL] [-token TOKEN] [-o FILE]
+   supportbundle -l FILE
+
+   e.g., to download the support bundle from a k8s pod:
+
+   kubectl port-forward POD 8008 &
+   supportbundle
+
+Flags:`)
+		flag.PrintDefaults()
+		return
+	}
+
+	if *list != "" {
+		if err := listFiles(*list, os.Stdout); err != nil {
+			log.Fatal(err)
+		}
+		return
+	}
+
+	if *token == "" {
+		*token = os.Getenv(fxapp.AdminBearerTokenEnvVar)
+	}
+	file, err := download(strings.TrimSuffix(*baseURL, "/"), *token, *output)
+	if err != nil {
+		log.Fatal(err)
+	}
+	fmt.Println(file)
+}
+
+// download writes the support bundle to the output file, and returns the output file name
+func download(baseURL, token, output string) (string, error) {
+	request, err := http.NewRequest(http.MethodGet, fmt.Sprintf("%s/%s", baseURL, fxapp.SupportBundleEndpoint), nil)
+	if err != nil {
+		return "", err
+	}
+	if token != "" {
+		request.Header.Set("Authorization", "Bearer "+token)
+	}
+	client := &http.Client{Timeout: *timeout}
+	response, err := client.Do(request)
+	if err != nil {
+		return "", err
+	}
+	defer response.Body.Close()
+	if response.StatusCode != http.StatusOK {
+		return "", fmt.Errorf("support bundle request failed: %s", response.Status)
+	}
+
+	if output == "" {
+		output = fmt.Sprintf("support-bundle-%d.tar.gz", time.Now().Unix())
+		if _, params, err := mime.ParseMediaType(response.Header.Get("Content-Disposition")); err == nil && params["filename"] != "" {
+			output = params["filename"]
+		}
+	}
+	f, err := os.Create(output)
+	if err != nil {
+		return "", err
+	}
+	if _, err := io.Copy(f, response.Body); err != nil {
+		f.Close()
+		return "", err
+	}
+	return output, f.Close()
+}
+
+func listFiles(name string, w io.Writer) error {
+	f, err := os.Open(name)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	gz, err := gzip.NewReader(f)
+	if err != nil {
+		return err
+	}
+	archive := tar.NewReader(gz)
+	for {
+		header, err := archive.Next()
+		if err == io.EOF {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+		fmt.Fprintf(w, "%8d %s\n", header.Size, header.Name)
+	}
+}
@@ -0,0 +1,113 @@
+/*
+ * Copyright (c) 2019 OysterPack, Inc.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ * http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package main
+
+import (
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"github.com/oklog/ulid"
+	"github.com/oysterpack/andiamo/pkg/ulids"
+	"github.com/rs/xid"
+	"time"
+)
+
+// supported ID types
+const (
+	XIDType  = "xid"
+	ULIDType = "ulid"
+)
+
+// encoded ID lengths, which are used to detect the ID type
+const (
+	xidEncodedSize = 20
+)
+
+// ErrUnknownIDType is returned when the ID is neither an XID nor a ULID
+var ErrUnknownIDType = errors.New("ID is neither an XID nor a ULID")
+
+// idInfo describes an ID and its components
+type idInfo struct {
+	ID   string    `json:"id"`
+	Type string    `json:"type"`
+	Time time.Time `json:"time"`
+
+	// XID components
+	Machine string `json:"machine,omitempty"`
+	PID     uint16 `json:"pid,omitempty"`
+	Counter int32  `json:"counter,omitempty"`
+
+	// ULID components
+	Entropy string `json:"entropy,omitempty"`
+}
+
+func xidInfo(id xid.ID) idInfo {
+	return idInfo{
+		ID:      id.String(),
+		Type:    XIDType,
+		Time:    id.Time().UTC(),
+		Machine: hex.EncodeToString(id.Machine()),
+		PID:     id.Pid(),
+		Counter: id.Counter(),
+	}
+}
+
+func ulidInfo(id ulid.ULID) idInfo {
+	return idInfo{
+		ID:      id.String(),
+		Type:    ULIDType,
+		Time:    ulid.Time(id.Time()).UTC(),
+		Entropy: hex.EncodeToString(id.Entropy()),
+	}
+}
+
+// parseID detects the ID type via the encoded length
+func parseID(id string) (idInfo, error) {
+	switch len(id) {
+	case xidEncodedSize:
+		parsedID, err := xid.FromString(id)
+		if err != nil {
+			return idInfo{}, fmt.Errorf("invalid XID : %v", err)
+		}
+		return xidInfo(parsedID), nil
+	case ulid.EncodedSize:
+		parsedID, err := ulids.Parse(id)
+		if err != nil {
+			return idInfo{}, fmt.Errorf("invalid ULID : %v", err)
+		}
+		return ulidInfo(parsedID), nil
+	default:
+		return idInfo{}, ErrUnknownIDType
+	}
+}
+
+// newIDs generates n IDs of the specified type
+func newIDs(idType string, n int) []idInfo {
+	ids := make([]idInfo, 0, n)
+	switch idType {
+	case ULIDType:
+		// monotonic ULIDs are generated, i.e., the ULIDs are sorted
+		for _, id := range ulids.NewBatchGenerator(ulids.GeneratorOpts{Monotonic: true})(n) {
+			ids = append(ids, ulidInfo(id))
+		}
+	default:
+		for i := 0; i < n; i++ {
+			ids = append(ids, xidInfo(xid.New()))
+		}
+	}
+	return ids
+}
@@ -17,57 +17,103 @@
 package main
 
 import (
+	"encoding/json"
 	"flag"
 	"fmt"
-	"github.com/rs/xid"
 	"log"
+	"os"
+	"time"
 )
 
-var id = flag.String("p", "", "parse XID")
-var verbose = flag.Bool("v", false, "shows XID components (PID, Time, Counter)")
+var id = flag.String("p", "", "parse ID - the ID type (XID or ULID) is detected")
+var generateULID = flag.Bool("u", false, "generate ULID(s) instead of XID(s)")
+var count = flag.Int("n", 1, "number of IDs to generate")
+var timestamp = flag.Bool("t", false, "shows the ID timestamp only")
+var verbose = flag.Bool("v", false, "shows ID components (XID: Machine, PID, Time, Counter - ULID: Time, Entropy)")
+var jsonOutput = flag.Bool("json", false, "output IDs as JSON, one object per line")
+var stream = flag.Bool("s", false, "validates IDs read from stdin, one per line - exits with status 1 if any IDs are invalid")
 var help = flag.Bool("h", false, "prints help")
 
-// used to generate and parse XID
+// used to generate and parse XID and ULID
 //
 // Command Line Flags
-//  -p is used to specify an XID to parse
-//  -v shows XID components (PID, Time, Counter)
+//  -p is used to specify an ID to parse
+//  -u generates ULID(s) instead of XID(s)
+//  -n number of IDs to generate
+//  -t shows the ID timestamp only
+//  -v shows ID components
+//  -json outputs IDs as JSON
+//  -s validates IDs read from stdin
 func main() {
 	flag.Parse()
 	if *help {
-		fmt.Println(`xid of a tool used to generate or parse an XID (https://github.com/rs/xid)
+		fmt.Println(`xid of a tool used to generate or parse an XID (https://github.com/rs/xid) or a ULID (https://github.com/ulid/spec)
 
 Usage:
 
-   xid [-p XID] [-v]
+   xid [-p ID] [-u] [-n count] [-t | -v | -json]
+   xid -s [-json] < ids.txt
 
-   when the -p flag is not specified, then it will generate a new XID
+   when the -p flag is not specified, then it will generate new ID(s) - XID(s) by default
+
+   when the -s flag is specified, then IDs are read from stdin, one per line, and each ID is validated and annotated
+   with its type and components. If any IDs are invalid, then the exit status is 1.
 
 Flags:`)
 		flag.PrintDefaults()
 		return
 	}
 
+	if *stream {
+		invalid, err := validateIDs(os.Stdin, os.Stdout)
+		if err != nil {
+			log.Fatal(err)
+		}
+		if invalid > 0 {
+			os.Exit(1)
+		}
+		return
+	}
+
 	if *id != "" {
-		parseXID(*id)
+		info, err := parseID(*id)
+		if err != nil {
+			log.Fatal(err)
+		}
+		print(info)
 		return
 	}
-	// generate a new XID
-	print(xid.New())
+
+	if *count < 1 {
+		log.Fatalf("-n must be at least 1: %d", *count)
+	}
+	idType := XIDType
+	if *generateULID {
+		idType = ULIDType
+	}
+	for _, info := range newIDs(idType, *count) {
+		print(info)
+	}
 }
 
-func parseXID(id string) {
-	id2, err := xid.FromString(id)
-	if err != nil {
-		log.Fatal(err)
+func print(id idInfo) {
+	switch {
+	case *jsonOutput:
+		if err := json.NewEncoder(os.Stdout).Encode(id); err != nil {
+			log.Fatal(err)
+		}
+	case *timestamp:
+		fmt.Println(id.Time.Format(time.RFC3339Nano))
+	case *verbose:
+		fmt.Println(verboseString(id))
+	default:
+		fmt.Println(id.ID)
 	}
-	print(id2)
 }
 
-func print(id xid.ID) {
-	if *verbose {
-		fmt.Printf("%v -> PID(%v) Time(%s) Counter(%d)\n", id, id.Pid(), id.Time(), id.Counter())
-		return
+func verboseString(id idInfo) string {
+	if id.Type == ULIDType {
+		return fmt.Sprintf("%v -> Type(%s) Time(%s) Entropy(%s)", id.ID, id.Type, id.Time, id.Entropy)
 	}
-	fmt.Println(id)
+	return fmt.Sprintf("%v -> Type(%s) Machine(%s) PID(%v) Time(%s) Counter(%d)", id.ID, id.Type, id.Machine, id.PID, id.Time, id.Counter)
 }
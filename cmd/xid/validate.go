@@ -0,0 +1,70 @@
+/*
+ * Copyright (c) 2019 OysterPack, Inc.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ * http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package main
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"io"
+	"strings"
+)
+
+// validateIDs reads IDs from the reader, one per line, and writes each ID annotated with its type and components.
+// Blank lines are skipped, and leading and trailing whitespace is trimmed.
+//
+// The number of invalid IDs is returned.
+func validateIDs(r io.Reader, w io.Writer) (invalid int, err error) {
+	scanner := bufio.NewScanner(r)
+	for scanner.Scan() {
+		id := strings.TrimSpace(scanner.Text())
+		if id == "" {
+			continue
+		}
+		info, e := parseID(id)
+		if e != nil {
+			invalid++
+			err = writeInvalidID(w, id, e)
+		} else {
+			err = writeID(w, info)
+		}
+		if err != nil {
+			return invalid, err
+		}
+	}
+	return invalid, scanner.Err()
+}
+
+func writeInvalidID(w io.Writer, id string, err error) error {
+	if *jsonOutput {
+		return json.NewEncoder(w).Encode(struct {
+			ID    string `json:"id"`
+			Error string `json:"error"`
+		}{id, err.Error()})
+	}
+	_, err = fmt.Fprintf(w, "%v -> INVALID(%v)\n", id, err)
+	return err
+}
+
+// the ID is always annotated, i.e., the verbose format is used unless JSON output is enabled
+func writeID(w io.Writer, id idInfo) error {
+	if *jsonOutput {
+		return json.NewEncoder(w).Encode(id)
+	}
+	_, err := fmt.Fprintln(w, verboseString(id))
+	return err
+}
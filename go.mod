@@ -1,21 +1,36 @@
 module github.com/oysterpack/andiamo
 
-go 1.12
+go 1.20
 
 require (
+	github.com/blang/semver v3.5.1+incompatible
+	github.com/fsnotify/fsnotify v1.4.7
 	github.com/hashicorp/go-retryablehttp v0.5.4
 	github.com/kelseyhightower/envconfig v1.4.0
 	github.com/oklog/ulid v1.3.1
 	github.com/pkg/errors v0.8.1
 	github.com/prometheus/client_golang v0.9.4
 	github.com/prometheus/client_model v0.0.0-20190129233127-fd36f4220a90
+	github.com/prometheus/common v0.4.1
 	github.com/rs/xid v1.2.1
 	github.com/rs/zerolog v1.14.3
 	github.com/stretchr/testify v1.3.0
-	go.uber.org/atomic v1.4.0 // indirect
-	go.uber.org/dig v1.7.0 // indirect
+	go.etcd.io/bbolt v1.3.5
 	go.uber.org/fx v1.9.0
-	go.uber.org/goleak v0.10.0 // indirect
 	go.uber.org/multierr v1.1.0
 	golang.org/x/crypto v0.0.0-20190510104115-cbcb75029529
 )
+
+require (
+	github.com/beorn7/perks v1.0.0 // indirect
+	github.com/davecgh/go-spew v1.1.1 // indirect
+	github.com/golang/protobuf v1.3.1 // indirect
+	github.com/hashicorp/go-cleanhttp v0.5.0 // indirect
+	github.com/matttproud/golang_protobuf_extensions v1.0.1 // indirect
+	github.com/pmezard/go-difflib v1.0.0 // indirect
+	github.com/prometheus/procfs v0.0.2 // indirect
+	go.uber.org/atomic v1.4.0 // indirect
+	go.uber.org/dig v1.7.0 // indirect
+	go.uber.org/goleak v0.10.0 // indirect
+	golang.org/x/sys v0.0.0-20200202164722-d101bd2416d5 // indirect
+)
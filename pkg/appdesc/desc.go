@@ -0,0 +1,161 @@
+/*
+ * Copyright (c) 2019 OysterPack, Inc.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ * http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+// Package appdesc provides the canonical application descriptor, which is shared by the app packages, i.e., `fxapp` and
+// `fx/app`. This ensures the app metadata is consistent across log event fields and metric labels.
+package appdesc
+
+import (
+	"errors"
+	"fmt"
+	"github.com/blang/semver"
+	"github.com/kelseyhightower/envconfig"
+	"github.com/oklog/ulid"
+	"github.com/oysterpack/andiamo/pkg/ulids"
+	"github.com/rs/zerolog"
+	"go.uber.org/multierr"
+	"strings"
+)
+
+// EnvPrefix is the standard env var name prefix.
+// "APP12X" was chosen to represent 12-factor apps.
+const EnvPrefix = "APP12X"
+
+// standard application descriptor labels used for log event fields and metric labels
+const (
+	IDLabel        = "a"
+	NameLabel      = "an"
+	VersionLabel   = "av"
+	ReleaseIDLabel = "r"
+)
+
+// Desc is the application descriptor
+type Desc struct {
+	ID        ulid.ULID
+	Name      string
+	Version   semver.Version
+	ReleaseID ulid.ULID
+}
+
+// descriptor validation errors
+var (
+	ErrZeroID        = errors.New("app `ID` is required")
+	ErrBlankName     = errors.New("app `Name` must not be blank")
+	ErrZeroReleaseID = errors.New("app `ReleaseID` is required")
+)
+
+// Load tries to load the app descriptor from env vars:
+//
+//   - ${envPrefix}_ID - ULID
+//   - ${envPrefix}_NAME
+//   - ${envPrefix}_VERSION - semver, e.g., 1.2.3
+//   - ${envPrefix}_RELEASE_ID - ULID
+//
+// If the envPrefix is blank, then `EnvPrefix` is used. All env var errors are reported.
+func Load(envPrefix string) (Desc, error) {
+	envPrefix = strings.TrimSpace(envPrefix)
+	if envPrefix == "" {
+		envPrefix = EnvPrefix
+	}
+
+	type desc struct {
+		ID        string `required:"true"`
+		Name      string `required:"true"`
+		Version   string `required:"true"`
+		ReleaseID string `required:"true" split_words:"true"`
+	}
+	var cfg desc
+	if err := envconfig.Process(envPrefix, &cfg); err != nil {
+		return Desc{}, err
+	}
+
+	var d Desc
+	var err error
+	if id, e := ulids.Parse(cfg.ID); e != nil {
+		err = multierr.Append(err, fmt.Errorf("%s_ID : %v", envPrefix, e))
+	} else {
+		d.ID = id
+	}
+	d.Name = cfg.Name
+	if version, e := semver.Parse(cfg.Version); e != nil {
+		err = multierr.Append(err, fmt.Errorf("%s_VERSION : %v", envPrefix, e))
+	} else {
+		d.Version = version
+	}
+	if releaseID, e := ulids.Parse(cfg.ReleaseID); e != nil {
+		err = multierr.Append(err, fmt.Errorf("%s_RELEASE_ID : %v", envPrefix, e))
+	} else {
+		d.ReleaseID = releaseID
+	}
+	if err != nil {
+		return Desc{}, err
+	}
+	return d, d.Validate()
+}
+
+// Validate checks that the ID and ReleaseID are set, and the Name is not blank
+func (d Desc) Validate() error {
+	var err error
+	if d.ID == (ulid.ULID{}) {
+		err = multierr.Append(err, ErrZeroID)
+	}
+	if strings.TrimSpace(d.Name) == "" {
+		err = multierr.Append(err, ErrBlankName)
+	}
+	if d.ReleaseID == (ulid.ULID{}) {
+		err = multierr.Append(err, ErrZeroReleaseID)
+	}
+	return err
+}
+
+// Labels returns the descriptor fields keyed by the standard descriptor labels.
+//
+// NOTE: the Name and Version labels are only included if the Name is set, i.e., descriptors that only specify the IDs
+// are supported.
+func (d Desc) Labels() map[string]string {
+	labels := map[string]string{
+		IDLabel:        d.ID.String(),
+		ReleaseIDLabel: d.ReleaseID.String(),
+	}
+	if d.Name != "" {
+		labels[NameLabel] = d.Name
+		labels[VersionLabel] = d.Version.String()
+	}
+	return labels
+}
+
+// WithLabels adds the descriptor labels as fields to the logger context
+func (d Desc) WithLabels(ctx zerolog.Context) zerolog.Context {
+	labels := d.Labels()
+	for _, label := range []string{IDLabel, NameLabel, VersionLabel, ReleaseIDLabel} {
+		if value, ok := labels[label]; ok {
+			ctx = ctx.Str(label, value)
+		}
+	}
+	return ctx
+}
+
+// MarshalZerologObject implements zerolog.LogObjectMarshaler interface
+func (d Desc) MarshalZerologObject(e *zerolog.Event) {
+	e.Str("id", d.ID.String())
+	e.Str("name", d.Name)
+	e.Str("version", d.Version.String())
+	e.Str("release_id", d.ReleaseID.String())
+}
+
+func (d Desc) String() string {
+	return fmt.Sprintf("%s : %s : %s : %s", d.ID, d.Name, d.Version, d.ReleaseID)
+}
@@ -0,0 +1,130 @@
+/*
+ * Copyright (c) 2019 OysterPack, Inc.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ * http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package appdesc_test
+
+import (
+	"github.com/blang/semver"
+	"github.com/oysterpack/andiamo/pkg/appdesc"
+	"github.com/oysterpack/andiamo/pkg/ulids"
+	"github.com/rs/zerolog"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"os"
+	"strings"
+	"testing"
+)
+
+func TestLoad(t *testing.T) {
+	t.Parallel()
+
+	setenv := func(prefix string, env map[string]string) func() {
+		for k, v := range env {
+			os.Setenv(prefix+"_"+k, v)
+		}
+		return func() {
+			for k := range env {
+				os.Unsetenv(prefix + "_" + k)
+			}
+		}
+	}
+
+	t.Run("load from env", func(t *testing.T) {
+		prefix := ulids.MustNew().String()
+		id, releaseID := ulids.MustNew(), ulids.MustNew()
+		defer setenv(prefix, map[string]string{
+			"ID":         id.String(),
+			"NAME":       "foo",
+			"VERSION":    "1.2.3",
+			"RELEASE_ID": releaseID.String(),
+		})()
+
+		desc, err := appdesc.Load(prefix)
+		require.NoError(t, err)
+		t.Log(desc)
+		assert.Equal(t, id, desc.ID)
+		assert.Equal(t, "foo", desc.Name)
+		assert.Equal(t, semver.MustParse("1.2.3"), desc.Version)
+		assert.Equal(t, releaseID, desc.ReleaseID)
+	})
+
+	t.Run("env vars are not set", func(t *testing.T) {
+		_, err := appdesc.Load(ulids.MustNew().String())
+		require.Error(t, err)
+		t.Log(err)
+	})
+
+	t.Run("invalid env vars are all reported", func(t *testing.T) {
+		prefix := ulids.MustNew().String()
+		defer setenv(prefix, map[string]string{
+			"ID":         "INVALID",
+			"NAME":       "foo",
+			"VERSION":    "1.2",
+			"RELEASE_ID": "INVALID",
+		})()
+
+		_, err := appdesc.Load(prefix)
+		require.Error(t, err)
+		t.Log(err)
+		for _, name := range []string{"_ID", "_VERSION", "_RELEASE_ID"} {
+			assert.Contains(t, err.Error(), prefix+name)
+		}
+	})
+}
+
+func TestDesc_Validate(t *testing.T) {
+	t.Parallel()
+
+	err := appdesc.Desc{}.Validate()
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), appdesc.ErrZeroID.Error())
+	assert.Contains(t, err.Error(), appdesc.ErrBlankName.Error())
+	assert.Contains(t, err.Error(), appdesc.ErrZeroReleaseID.Error())
+
+	assert.NoError(t, appdesc.Desc{ID: ulids.MustNew(), Name: "foo", ReleaseID: ulids.MustNew()}.Validate())
+}
+
+func TestDesc_Labels(t *testing.T) {
+	t.Parallel()
+
+	desc := appdesc.Desc{
+		ID:        ulids.MustNew(),
+		Name:      "foo",
+		Version:   semver.MustParse("1.2.3"),
+		ReleaseID: ulids.MustNew(),
+	}
+	assert.Equal(t, map[string]string{
+		appdesc.IDLabel:        desc.ID.String(),
+		appdesc.NameLabel:      "foo",
+		appdesc.VersionLabel:   "1.2.3",
+		appdesc.ReleaseIDLabel: desc.ReleaseID.String(),
+	}, desc.Labels())
+
+	// descriptors that only specify the IDs are supported
+	idsOnly := appdesc.Desc{ID: desc.ID, ReleaseID: desc.ReleaseID}
+	assert.Equal(t, map[string]string{
+		appdesc.IDLabel:        desc.ID.String(),
+		appdesc.ReleaseIDLabel: desc.ReleaseID.String(),
+	}, idsOnly.Labels())
+
+	buf := new(strings.Builder)
+	logger := desc.WithLabels(zerolog.New(buf).With()).Logger()
+	logger.Log().Msg("")
+	t.Log(buf.String())
+	for _, value := range desc.Labels() {
+		assert.Contains(t, buf.String(), value)
+	}
+}
@@ -0,0 +1,121 @@
+/*
+ * Copyright (c) 2019 OysterPack, Inc.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ * http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package appdesc
+
+import (
+	"github.com/rs/zerolog"
+	"os"
+	"strings"
+)
+
+// InstanceMetadata describes the runtime environment that the app instance is running in.
+//
+// All fields are optional, i.e., blank fields are omitted from log event fields and metric labels.
+type InstanceMetadata struct {
+	Hostname string
+
+	// Kubernetes metadata, which is exposed via the Downward API as env vars
+	Pod       string
+	Namespace string
+	Node      string
+
+	// Cloud metadata
+	Region string
+	Zone   string
+}
+
+// Kubernetes Downward API env vars, e.g.,
+//
+//	env:
+//	- name: POD_NAME
+//	  valueFrom:
+//	    fieldRef:
+//	      fieldPath: metadata.name
+const (
+	PodNameEnvVar      = "POD_NAME"
+	PodNamespaceEnvVar = "POD_NAMESPACE"
+	NodeNameEnvVar     = "NODE_NAME"
+)
+
+// instance metadata labels used for log event fields and metric labels
+const (
+	HostnameLabel  = "host"
+	PodLabel       = "pod"
+	NamespaceLabel = "ns"
+	NodeLabel      = "node"
+	RegionLabel    = "region"
+	ZoneLabel      = "zone"
+)
+
+// LoadInstanceMetadata loads the instance metadata from the runtime environment:
+//
+//   - Hostname - os.Hostname()
+//   - Pod - POD_NAME
+//   - Namespace - POD_NAMESPACE
+//   - Node - NODE_NAME
+//   - Region - ${envPrefix}_REGION
+//   - Zone - ${envPrefix}_ZONE
+//
+// If the envPrefix is blank, then `EnvPrefix` is used.
+func LoadInstanceMetadata(envPrefix string) InstanceMetadata {
+	envPrefix = strings.TrimSpace(envPrefix)
+	if envPrefix == "" {
+		envPrefix = EnvPrefix
+	}
+	env := func(name string) string {
+		return strings.TrimSpace(os.Getenv(name))
+	}
+
+	hostname, _ := os.Hostname()
+	return InstanceMetadata{
+		Hostname:  hostname,
+		Pod:       env(PodNameEnvVar),
+		Namespace: env(PodNamespaceEnvVar),
+		Node:      env(NodeNameEnvVar),
+		Region:    env(strings.ToUpper(envPrefix + "_REGION")),
+		Zone:      env(strings.ToUpper(envPrefix + "_ZONE")),
+	}
+}
+
+// Labels returns the instance metadata keyed by the standard instance metadata labels. Blank fields are omitted.
+func (m InstanceMetadata) Labels() map[string]string {
+	labels := make(map[string]string)
+	for label, value := range map[string]string{
+		HostnameLabel:  m.Hostname,
+		PodLabel:       m.Pod,
+		NamespaceLabel: m.Namespace,
+		NodeLabel:      m.Node,
+		RegionLabel:    m.Region,
+		ZoneLabel:      m.Zone,
+	} {
+		if value != "" {
+			labels[label] = value
+		}
+	}
+	return labels
+}
+
+// WithLabels adds the instance metadata labels as fields to the logger context
+func (m InstanceMetadata) WithLabels(ctx zerolog.Context) zerolog.Context {
+	labels := m.Labels()
+	for _, label := range []string{HostnameLabel, PodLabel, NamespaceLabel, NodeLabel, RegionLabel, ZoneLabel} {
+		if value, ok := labels[label]; ok {
+			ctx = ctx.Str(label, value)
+		}
+	}
+	return ctx
+}
@@ -0,0 +1,68 @@
+/*
+ * Copyright (c) 2019 OysterPack, Inc.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ * http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package appdesc_test
+
+import (
+	"github.com/oysterpack/andiamo/pkg/appdesc"
+	"github.com/oysterpack/andiamo/pkg/ulids"
+	"github.com/stretchr/testify/assert"
+	"os"
+	"testing"
+)
+
+func TestLoadInstanceMetadata(t *testing.T) {
+	prefix := ulids.MustNew().String()
+	env := map[string]string{
+		appdesc.PodNameEnvVar:      "foo-1234",
+		appdesc.PodNamespaceEnvVar: "foo",
+		appdesc.NodeNameEnvVar:     "node-1",
+		prefix + "_REGION":         "us-east-1",
+		prefix + "_ZONE":           "us-east-1a",
+	}
+	for k, v := range env {
+		os.Setenv(k, v)
+	}
+	defer func() {
+		for k := range env {
+			os.Unsetenv(k)
+		}
+	}()
+
+	metadata := appdesc.LoadInstanceMetadata(prefix)
+	t.Log(metadata)
+	hostname, _ := os.Hostname()
+	assert.Equal(t, appdesc.InstanceMetadata{
+		Hostname:  hostname,
+		Pod:       "foo-1234",
+		Namespace: "foo",
+		Node:      "node-1",
+		Region:    "us-east-1",
+		Zone:      "us-east-1a",
+	}, metadata)
+	assert.Len(t, metadata.Labels(), 6)
+}
+
+func TestInstanceMetadata_Labels(t *testing.T) {
+	t.Parallel()
+
+	// blank fields are omitted
+	assert.Empty(t, appdesc.InstanceMetadata{}.Labels())
+	assert.Equal(t,
+		map[string]string{appdesc.HostnameLabel: "foo", appdesc.RegionLabel: "us-east-1"},
+		appdesc.InstanceMetadata{Hostname: "foo", Region: "us-east-1"}.Labels(),
+	)
+}
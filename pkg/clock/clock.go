@@ -0,0 +1,75 @@
+/*
+ * Copyright (c) 2019 OysterPack, Inc.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ * http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+// Package clock provides a Clock abstraction, which enables time to be controlled in tests, i.e., tests can advance
+// time deterministically instead of sleeping.
+package clock
+
+import (
+	"context"
+	"time"
+)
+
+// Clock provides the time related functions that are used to schedule work, enforce timeouts, and measure durations.
+type Clock interface {
+	Now() time.Time
+	Since(t time.Time) time.Duration
+	Until(t time.Time) time.Duration
+
+	// NewTimer creates a new Timer that will send the current time on its channel after at least duration d
+	NewTimer(d time.Duration) Timer
+
+	// WithTimeout returns a copy of the parent context that is canceled when the timeout expires, as measured by the clock.
+	// When the timeout expires, the context error is context.DeadlineExceeded.
+	WithTimeout(parent context.Context, timeout time.Duration) (context.Context, context.CancelFunc)
+}
+
+// Timer represents a single event - see time.Timer
+type Timer interface {
+	// C is the channel on which the time is delivered
+	C() <-chan time.Time
+	// Stop prevents the Timer from firing. It returns true if the call stops the timer, false if the timer has already
+	// expired or been stopped.
+	Stop() bool
+	// Reset changes the timer to expire after duration d. It returns true if the timer had been active, false if the
+	// timer had expired or been stopped.
+	Reset(d time.Duration) bool
+}
+
+// Real returns the Clock that is backed by the time package
+func Real() Clock {
+	return realClock{}
+}
+
+type realClock struct{}
+
+func (realClock) Now() time.Time { return time.Now() }
+
+func (realClock) Since(t time.Time) time.Duration { return time.Since(t) }
+
+func (realClock) Until(t time.Time) time.Duration { return time.Until(t) }
+
+func (realClock) NewTimer(d time.Duration) Timer { return realTimer{time.NewTimer(d)} }
+
+func (realClock) WithTimeout(parent context.Context, timeout time.Duration) (context.Context, context.CancelFunc) {
+	return context.WithTimeout(parent, timeout)
+}
+
+type realTimer struct {
+	*time.Timer
+}
+
+func (t realTimer) C() <-chan time.Time { return t.Timer.C }
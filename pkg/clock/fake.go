@@ -0,0 +1,239 @@
+/*
+ * Copyright (c) 2019 OysterPack, Inc.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ * http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package clock
+
+import (
+	"context"
+	"sync"
+	"time"
+)
+
+// Fake is a Clock that is controlled by the test, i.e., time only moves when the test advances it. Timers fire, and
+// timeout contexts expire, when the fake time reaches their deadline.
+//
+// It is safe for concurrent use.
+type Fake struct {
+	m      sync.Mutex
+	now    time.Time
+	timers map[*fakeTimer]struct{}
+	// closed when the number of active timers changes, i.e., used to notify BlockUntil waiters
+	timersChanged chan struct{}
+}
+
+// NewFake constructs a new Fake clock set to the specified time
+func NewFake(now time.Time) *Fake {
+	return &Fake{
+		now:           now,
+		timers:        make(map[*fakeTimer]struct{}),
+		timersChanged: make(chan struct{}),
+	}
+}
+
+// Now returns the fake time
+func (f *Fake) Now() time.Time {
+	f.m.Lock()
+	defer f.m.Unlock()
+	return f.now
+}
+
+// Since returns the fake time elapsed since t
+func (f *Fake) Since(t time.Time) time.Duration {
+	return f.Now().Sub(t)
+}
+
+// Until returns the fake duration until t
+func (f *Fake) Until(t time.Time) time.Duration {
+	return t.Sub(f.Now())
+}
+
+// Advance moves the fake time forward by d, and fires the timers that are due in deadline order
+func (f *Fake) Advance(d time.Duration) {
+	f.Set(f.Now().Add(d))
+}
+
+// Set sets the fake time, and fires the timers that are due in deadline order.
+// If the time is before the current fake time, then no timers are fired.
+func (f *Fake) Set(now time.Time) {
+	f.m.Lock()
+	defer f.m.Unlock()
+	f.now = now
+	for {
+		var next *fakeTimer
+		for t := range f.timers {
+			if !t.deadline.After(now) && (next == nil || t.deadline.Before(next.deadline)) {
+				next = t
+			}
+		}
+		if next == nil {
+			return
+		}
+		f.fire(next)
+	}
+}
+
+// BlockUntil blocks until the number of active timers is at least n, e.g., it is used to wait for a goroutine to be
+// waiting on a timer before advancing the time.
+func (f *Fake) BlockUntil(n int) {
+	for {
+		f.m.Lock()
+		count, changed := len(f.timers), f.timersChanged
+		f.m.Unlock()
+		if count >= n {
+			return
+		}
+		<-changed
+	}
+}
+
+// Timers returns the number of active timers
+func (f *Fake) Timers() int {
+	f.m.Lock()
+	defer f.m.Unlock()
+	return len(f.timers)
+}
+
+// NewTimer creates a new fake timer, which fires when the fake time reaches the timer deadline
+func (f *Fake) NewTimer(d time.Duration) Timer {
+	t := &fakeTimer{fake: f, c: make(chan time.Time, 1)}
+	t.Reset(d)
+	return t
+}
+
+// WithTimeout returns a copy of the parent context that is canceled when the fake time reaches the deadline
+func (f *Fake) WithTimeout(parent context.Context, timeout time.Duration) (context.Context, context.CancelFunc) {
+	ctx := &fakeTimeoutCtx{
+		parent:   parent,
+		deadline: f.Now().Add(timeout),
+		done:     make(chan struct{}),
+	}
+	timer := f.NewTimer(timeout)
+	go func() {
+		select {
+		case <-timer.C():
+			ctx.cancel(context.DeadlineExceeded)
+		case <-parent.Done():
+			timer.Stop()
+			ctx.cancel(parent.Err())
+		case <-ctx.done:
+			timer.Stop()
+		}
+	}()
+	return ctx, func() {
+		// the timer is stopped synchronously, i.e., when cancel returns, the timer is no longer active
+		timer.Stop()
+		ctx.cancel(context.Canceled)
+	}
+}
+
+// must be called while holding the lock
+func (f *Fake) fire(t *fakeTimer) {
+	f.remove(t)
+	// the channel is buffered, i.e., if the previous time was not received, then the time is dropped - same as time.Timer
+	select {
+	case t.c <- f.now:
+	default:
+	}
+}
+
+// must be called while holding the lock
+func (f *Fake) remove(t *fakeTimer) bool {
+	if _, ok := f.timers[t]; !ok {
+		return false
+	}
+	delete(f.timers, t)
+	f.notifyTimersChanged()
+	return true
+}
+
+// must be called while holding the lock
+func (f *Fake) notifyTimersChanged() {
+	close(f.timersChanged)
+	f.timersChanged = make(chan struct{})
+}
+
+type fakeTimer struct {
+	fake     *Fake
+	c        chan time.Time
+	deadline time.Time
+}
+
+func (t *fakeTimer) C() <-chan time.Time { return t.c }
+
+func (t *fakeTimer) Stop() bool {
+	t.fake.m.Lock()
+	defer t.fake.m.Unlock()
+	return t.fake.remove(t)
+}
+
+func (t *fakeTimer) Reset(d time.Duration) bool {
+	f := t.fake
+	f.m.Lock()
+	defer f.m.Unlock()
+	active := f.remove(t)
+	t.deadline = f.now.Add(d)
+	if d <= 0 {
+		f.fire(t)
+		return active
+	}
+	f.timers[t] = struct{}{}
+	f.notifyTimersChanged()
+	return active
+}
+
+// fakeTimeoutCtx reports context.DeadlineExceeded when the fake time reaches the deadline.
+//
+// NOTE: it does not embed a context created by the context package, which would enable child contexts to bind directly
+// to the embedded context, i.e., child contexts would not observe the deadline exceeded error.
+type fakeTimeoutCtx struct {
+	parent   context.Context
+	deadline time.Time
+	done     chan struct{}
+
+	m   sync.Mutex
+	err error
+}
+
+func (c *fakeTimeoutCtx) Deadline() (time.Time, bool) {
+	if deadline, ok := c.parent.Deadline(); ok && deadline.Before(c.deadline) {
+		return deadline, true
+	}
+	return c.deadline, true
+}
+
+func (c *fakeTimeoutCtx) Done() <-chan struct{} {
+	return c.done
+}
+
+func (c *fakeTimeoutCtx) Err() error {
+	c.m.Lock()
+	defer c.m.Unlock()
+	return c.err
+}
+
+func (c *fakeTimeoutCtx) Value(key interface{}) interface{} {
+	return c.parent.Value(key)
+}
+
+func (c *fakeTimeoutCtx) cancel(err error) {
+	c.m.Lock()
+	defer c.m.Unlock()
+	if c.err != nil {
+		return
+	}
+	c.err = err
+	close(c.done)
+}
@@ -0,0 +1,165 @@
+/*
+ * Copyright (c) 2019 OysterPack, Inc.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ * http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package clock_test
+
+import (
+	"context"
+	"github.com/oysterpack/andiamo/pkg/clock"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"testing"
+	"time"
+)
+
+var epoch = time.Date(2019, time.August, 1, 0, 0, 0, 0, time.UTC)
+
+func TestFake_Timer(t *testing.T) {
+	t.Parallel()
+
+	t.Run("timer fires when the time reaches the deadline", func(t *testing.T) {
+		t.Parallel()
+		c := clock.NewFake(epoch)
+		timer := c.NewTimer(time.Second)
+		assert.Equal(t, 1, c.Timers())
+
+		c.Advance(999 * time.Millisecond)
+		select {
+		case <-timer.C():
+			t.Fatal("*** timer should not have fired")
+		default:
+		}
+
+		c.Advance(time.Millisecond)
+		select {
+		case now := <-timer.C():
+			assert.Equal(t, epoch.Add(time.Second), now)
+		default:
+			t.Fatal("*** timer should have fired")
+		}
+		assert.Zero(t, c.Timers())
+		assert.False(t, timer.Stop())
+	})
+
+	t.Run("stop and reset", func(t *testing.T) {
+		t.Parallel()
+		c := clock.NewFake(epoch)
+		timer := c.NewTimer(time.Second)
+		assert.True(t, timer.Stop())
+		c.Advance(time.Hour)
+		select {
+		case <-timer.C():
+			t.Fatal("*** stopped timer should not have fired")
+		default:
+		}
+
+		assert.False(t, timer.Reset(time.Minute))
+		assert.True(t, timer.Reset(time.Second))
+		c.Advance(time.Second)
+		select {
+		case <-timer.C():
+		default:
+			t.Fatal("*** timer should have fired")
+		}
+	})
+
+	t.Run("timers fire in deadline order", func(t *testing.T) {
+		t.Parallel()
+		c := clock.NewFake(epoch)
+		timer2, timer1 := c.NewTimer(2*time.Second), c.NewTimer(time.Second)
+		c.Advance(time.Minute)
+		// each timer receives the time that it fired at, which is the time the clock was advanced to
+		assert.Equal(t, epoch.Add(time.Minute), <-timer1.C())
+		assert.Equal(t, epoch.Add(time.Minute), <-timer2.C())
+	})
+
+	t.Run("block until timers are active", func(t *testing.T) {
+		t.Parallel()
+		c := clock.NewFake(epoch)
+		fired := make(chan time.Time)
+		go func() {
+			fired <- <-c.NewTimer(time.Second).C()
+		}()
+		c.BlockUntil(1)
+		c.Advance(time.Second)
+		assert.Equal(t, epoch.Add(time.Second), <-fired)
+	})
+}
+
+func TestFake_WithTimeout(t *testing.T) {
+	t.Parallel()
+
+	t.Run("timeout expires", func(t *testing.T) {
+		t.Parallel()
+		c := clock.NewFake(epoch)
+		ctx, cancel := c.WithTimeout(context.Background(), time.Second)
+		defer cancel()
+		deadline, ok := ctx.Deadline()
+		require.True(t, ok)
+		assert.Equal(t, epoch.Add(time.Second), deadline)
+		assert.NoError(t, ctx.Err())
+
+		// child contexts are canceled with the parent error
+		child, cancelChild := context.WithCancel(ctx)
+		defer cancelChild()
+
+		c.Advance(time.Second)
+		<-ctx.Done()
+		assert.Equal(t, context.DeadlineExceeded, ctx.Err())
+		<-child.Done()
+		assert.Equal(t, context.DeadlineExceeded, child.Err())
+	})
+
+	t.Run("canceled", func(t *testing.T) {
+		t.Parallel()
+		c := clock.NewFake(epoch)
+		ctx, cancel := c.WithTimeout(context.Background(), time.Second)
+		cancel()
+		<-ctx.Done()
+		assert.Equal(t, context.Canceled, ctx.Err())
+		// the timeout timer is stopped
+		for c.Timers() > 0 {
+			time.Sleep(time.Millisecond)
+		}
+	})
+
+	t.Run("parent canceled", func(t *testing.T) {
+		t.Parallel()
+		c := clock.NewFake(epoch)
+		parent, cancelParent := context.WithCancel(context.Background())
+		ctx, cancel := c.WithTimeout(parent, time.Second)
+		defer cancel()
+		cancelParent()
+		<-ctx.Done()
+		assert.Equal(t, context.Canceled, ctx.Err())
+	})
+}
+
+func TestReal(t *testing.T) {
+	t.Parallel()
+
+	c := clock.Real()
+	start := c.Now()
+	timer := c.NewTimer(time.Millisecond)
+	<-timer.C()
+	assert.True(t, c.Since(start) >= time.Millisecond)
+	assert.True(t, c.Until(start) < 0)
+
+	ctx, cancel := c.WithTimeout(context.Background(), time.Millisecond)
+	defer cancel()
+	<-ctx.Done()
+	assert.Equal(t, context.DeadlineExceeded, ctx.Err())
+}
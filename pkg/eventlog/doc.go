@@ -26,4 +26,10 @@
 //  - an error stack marshaller is configured
 //  - time.Duration fields are rendered as int instead float because it's more efficient
 //  - each log event is tagged with an XID via a field named "x"
+//
+// Hooks can be registered to integrate with the app logger without replacing the writer, e.g., per-event counters,
+// trace ID injection, and external forwarding. Hooks are scoped to a logger - see `Hooks` and `WithHooks()`.
+//
+// Events can be shipped to a log collector over the network via a `Sink`, which batches and retries, e.g., as
+// newline delimited JSON, or mapped to Loki labels and Elasticsearch ECS fields - see `SinkOpts`.
 package eventlog
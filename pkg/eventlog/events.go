@@ -17,6 +17,8 @@
 package eventlog
 
 import (
+	"context"
+	"github.com/oysterpack/andiamo/pkg/reqctx"
 	"github.com/rs/zerolog"
 )
 
@@ -50,12 +52,38 @@ type Logger func(data zerolog.LogObjectMarshaler, msg string, tags ...string)
 //	}
 func NewLogger(event string, logger *zerolog.Logger, level zerolog.Level) Logger {
 	eventLogger := ForEvent(logger, event)
+	hooks := hooksFor(logger)
 	return func(eventData zerolog.LogObjectMarshaler, msg string, tags ...string) {
-		log(eventLogger.WithLevel(level), eventData, msg, tags...)
+		log(eventLogger.WithLevel(level), hooks, level, event, eventData, msg, tags...)
 	}
 }
 
-func log(zerologEvent *zerolog.Event, eventData zerolog.LogObjectMarshaler, msg string, tags ...string) {
+// ContextLogger is used to log events that are related to a request, i.e., the event is enriched with the request context
+// fields, if the context carries a `reqctx.RequestContext`. The request context fields are logged as a dictionary using
+// "rc" as the key, e.g.,
+//
+//	{
+//	  "l": "info",
+//	  "n": "01DE2Z4E07E4T0GJJXCG8NN6A0",
+//	  "rc": {"cid": "01DJ1PS0X5DP31TRPNCRS5QCP5", "p": "alice", "t": "acme"},
+//	  "m": "order placed"
+//	}
+type ContextLogger func(ctx context.Context, data zerolog.LogObjectMarshaler, msg string, tags ...string)
+
+// NewContextLogger creates a new function used to log request related events - see `NewLogger()`.
+func NewContextLogger(event string, logger *zerolog.Logger, level zerolog.Level) ContextLogger {
+	eventLogger := ForEvent(logger, event)
+	hooks := hooksFor(logger)
+	return func(ctx context.Context, eventData zerolog.LogObjectMarshaler, msg string, tags ...string) {
+		zerologEvent := eventLogger.WithLevel(level)
+		if rc, ok := reqctx.FromContext(ctx); ok {
+			zerologEvent.Object(RequestContext, rc)
+		}
+		log(zerologEvent, hooks, level, event, eventData, msg, tags...)
+	}
+}
+
+func log(zerologEvent *zerolog.Event, hooks *Hooks, level zerolog.Level, event string, eventData zerolog.LogObjectMarshaler, msg string, tags ...string) {
 	if len(tags) > 0 {
 		zerologEvent.Strs("g", tags)
 	}
@@ -66,6 +94,7 @@ func log(zerologEvent *zerolog.Event, eventData zerolog.LogObjectMarshaler, msg
 		zerologEvent.Dict("d", data)
 	}
 
+	hooks.runEventHooks(zerologEvent, level, event, msg)
 	zerologEvent.Msg(msg)
 }
 
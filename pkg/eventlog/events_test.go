@@ -18,8 +18,10 @@ package eventlog_test
 
 import (
 	"bytes"
+	"context"
 	"encoding/json"
 	"github.com/oysterpack/andiamo/pkg/eventlog"
+	"github.com/oysterpack/andiamo/pkg/reqctx"
 	"github.com/pkg/errors"
 	"github.com/rs/zerolog"
 	"strings"
@@ -153,3 +155,50 @@ func TestNewError(t *testing.T) {
 		t.Error("*** event was not logged")
 	}
 }
+
+func TestNewContextLogger(t *testing.T) {
+	t.Parallel()
+
+	buf := new(bytes.Buffer)
+	logger := zerolog.New(buf)
+	logFoo := eventlog.NewContextLogger(Foo, &logger, zerolog.InfoLevel)
+	ctx := reqctx.NewContext(context.Background(), reqctx.RequestContext{
+		CorrelationID: "01DJ1PS0X5DP31TRPNCRS5QCP5",
+		Tenant:        "acme",
+	})
+	logFoo(ctx, FooID("01DF6P4G2WZ7HKDBES9YPXRHQ0"), "foo")
+	logFoo(context.Background(), FooID("01DF6P4G2WZ7HKDBES9YPXRHQ0"), "foo")
+
+	type RequestContext struct {
+		CorrelationID string `json:"cid"`
+		Principal     string `json:"p"`
+		Tenant        string `json:"t"`
+	}
+
+	type LogEvent struct {
+		Name           string          `json:"n"`
+		RequestContext *RequestContext `json:"rc"`
+	}
+	lines := strings.Split(strings.TrimSpace(buf.String()), "\n")
+	if len(lines) != 2 {
+		t.Fatalf("*** expected 2 log events: %v", lines)
+	}
+	var logEvents []LogEvent
+	for _, line := range lines {
+		var logEvent LogEvent
+		if err := json.Unmarshal([]byte(line), &logEvent); err != nil {
+			t.Fatalf("*** failed to parse log event: %v", err)
+		}
+		logEvents = append(logEvents, logEvent)
+	}
+
+	switch rc := logEvents[0].RequestContext; {
+	case rc == nil:
+		t.Error("*** request context was not logged")
+	case rc.CorrelationID != "01DJ1PS0X5DP31TRPNCRS5QCP5" || rc.Tenant != "acme" || rc.Principal != "":
+		t.Errorf("*** request context did not match: %v", rc)
+	}
+	if logEvents[1].RequestContext != nil {
+		t.Errorf("*** request context should not be logged if not present: %v", logEvents[1].RequestContext)
+	}
+}
@@ -0,0 +1,227 @@
+/*
+ * Copyright (c) 2019 OysterPack, Inc.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ * http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package eventlog
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"github.com/rs/zerolog"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// LokiLabels maps the standard event field names to the Loki stream labels. The labels are low cardinality, i.e.,
+// the event XID, message, and data are only included in the log line, which is the event JSON as is.
+//
+// Events without a level are labeled with level "none".
+var LokiLabels = map[string]string{
+	"a":    "app_id",
+	"an":   "app",
+	"av":   "app_version",
+	"r":    "release_id",
+	"i":    "instance_id",
+	"l":    "level",
+	"n":    "event",
+	"c":    "component",
+	"host": "host",
+	"pod":  "pod",
+}
+
+// ECSFields maps the standard event field names to Elastic Common Schema (ECS) fields. Fields that are not mapped are
+// nested under the "andiamo" object, e.g., the event data is indexed as "andiamo.d".
+//
+// The event XID is used as the document ID, i.e., retried batches do not index duplicate events.
+var ECSFields = map[string]string{
+	"t":    "@timestamp",
+	"l":    "log.level",
+	"m":    "message",
+	"e":    "error.message",
+	"n":    "event.code",
+	"x":    "event.id",
+	"g":    "tags",
+	"a":    "service.id",
+	"an":   "service.name",
+	"av":   "service.version",
+	"i":    "service.node.name",
+	"r":    "labels.release_id",
+	"c":    "labels.component",
+	"host": "host.name",
+}
+
+// ECSCustomFieldsNamespace is the ECS object that the unmapped event fields are nested under
+const ECSCustomFieldsNamespace = "andiamo"
+
+// eventTime returns the event timestamp, which is logged in Unix time format. If the event has no timestamp, then the
+// current time is returned.
+func eventTime(fields map[string]interface{}) time.Time {
+	if t, ok := fields[zerolog.TimestampFieldName].(json.Number); ok {
+		if secs, err := t.Int64(); err == nil {
+			return time.Unix(secs, 0)
+		}
+	}
+	return time.Now()
+}
+
+func decodeEvent(event []byte) (map[string]interface{}, error) {
+	decoder := json.NewDecoder(bytes.NewReader(event))
+	decoder.UseNumber()
+	var fields map[string]interface{}
+	err := decoder.Decode(&fields)
+	return fields, err
+}
+
+type lokiPush struct {
+	Streams []*lokiStream `json:"streams"`
+}
+
+type lokiStream struct {
+	Stream map[string]string `json:"stream"`
+	Values [][2]string       `json:"values"`
+}
+
+// encodeLokiPush groups the events into streams by their labels
+func encodeLokiPush(events [][]byte) (string, []byte, error) {
+	var push lokiPush
+	streams := make(map[string]*lokiStream)
+	for _, event := range events {
+		labels := map[string]string{"level": "none"}
+		timestamp := time.Now()
+		// events that cannot be decoded are pushed as is
+		if fields, err := decodeEvent(event); err == nil {
+			for field, label := range LokiLabels {
+				if value, ok := fields[field].(string); ok && value != "" {
+					labels[label] = value
+				}
+			}
+			timestamp = eventTime(fields)
+		}
+
+		keys := make([]string, 0, len(labels))
+		for label, value := range labels {
+			keys = append(keys, label+"="+strconv.Quote(value))
+		}
+		sort.Strings(keys)
+		key := strings.Join(keys, ",")
+		stream, ok := streams[key]
+		if !ok {
+			stream = &lokiStream{Stream: labels}
+			streams[key] = stream
+			push.Streams = append(push.Streams, stream)
+		}
+		stream.Values = append(stream.Values, [2]string{strconv.FormatInt(timestamp.UnixNano(), 10), string(event)})
+	}
+	body, err := json.Marshal(push)
+	return "application/json", body, err
+}
+
+// newElasticsearchBulkEncoder encodes the events as bulk API create actions, i.e., events are mapped to ECS documents
+func newElasticsearchBulkEncoder(index string) func(events [][]byte) (string, []byte, error) {
+	return func(events [][]byte) (string, []byte, error) {
+		var buf bytes.Buffer
+		for _, event := range events {
+			doc := map[string]interface{}{}
+			action := map[string]interface{}{"_index": index}
+			fields, err := decodeEvent(event)
+			if err != nil {
+				// events that cannot be decoded are indexed as the message
+				doc["@timestamp"] = time.Now().UTC().Format(time.RFC3339Nano)
+				doc["message"] = string(event)
+			} else {
+				for field, value := range fields {
+					ecsField, ok := ECSFields[field]
+					if !ok {
+						ecsField = ECSCustomFieldsNamespace + "." + field
+					}
+					setECSField(doc, ecsField, value)
+				}
+				doc["@timestamp"] = eventTime(fields).UTC().Format(time.RFC3339Nano)
+				if id, ok := fields[XID].(string); ok && id != "" {
+					action["_id"] = id
+				}
+			}
+			actionJSON, err := json.Marshal(map[string]interface{}{"create": action})
+			if err != nil {
+				return "", nil, err
+			}
+			docJSON, err := json.Marshal(doc)
+			if err != nil {
+				return "", nil, err
+			}
+			buf.Write(actionJSON)
+			buf.WriteByte('\n')
+			buf.Write(docJSON)
+			buf.WriteByte('\n')
+		}
+		return NDJSONMediaType, buf.Bytes(), nil
+	}
+}
+
+// setECSField sets the dotted field as nested objects, e.g., "log.level" -> {"log":{"level":value}}
+func setECSField(doc map[string]interface{}, field string, value interface{}) {
+	path := strings.Split(field, ".")
+	for _, name := range path[:len(path)-1] {
+		obj, ok := doc[name].(map[string]interface{})
+		if !ok {
+			obj = map[string]interface{}{}
+			doc[name] = obj
+		}
+		doc = obj
+	}
+	doc[path[len(path)-1]] = value
+}
+
+type elasticsearchBulkResponse struct {
+	Errors bool `json:"errors"`
+	Items  []map[string]struct {
+		Status int `json:"status"`
+		Error  struct {
+			Type   string `json:"type"`
+			Reason string `json:"reason"`
+		} `json:"error"`
+	} `json:"items"`
+}
+
+// checkElasticsearchBulkResponse fails if any events failed to be indexed. Conflicts are ignored because they mean the
+// event was already indexed, i.e., by a previous attempt.
+func checkElasticsearchBulkResponse(body []byte) error {
+	var response elasticsearchBulkResponse
+	if err := json.Unmarshal(body, &response); err != nil {
+		return fmt.Errorf("invalid Elasticsearch bulk response : %s", err)
+	}
+	if !response.Errors {
+		return nil
+	}
+	var failed int
+	var reason string
+	for _, item := range response.Items {
+		for _, result := range item {
+			if result.Status >= 300 && result.Status != 409 {
+				failed++
+				if reason == "" {
+					reason = fmt.Sprintf("%s: %s", result.Error.Type, result.Error.Reason)
+				}
+			}
+		}
+	}
+	if failed == 0 {
+		return nil
+	}
+	return fmt.Errorf("%d events failed to be indexed : %s", failed, reason)
+}
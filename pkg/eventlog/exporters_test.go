@@ -0,0 +1,171 @@
+/*
+ * Copyright (c) 2019 OysterPack, Inc.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ * http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package eventlog_test
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"fmt"
+	"github.com/oysterpack/andiamo/pkg/eventlog"
+	"github.com/rs/zerolog"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestSink_Loki(t *testing.T) {
+	t.Parallel()
+
+	type push struct {
+		Streams []struct {
+			Stream map[string]string `json:"stream"`
+			Values [][2]string       `json:"values"`
+		} `json:"streams"`
+	}
+	pushes := make(chan push, 1)
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		assert.Equal(t, "/loki/api/v1/push", r.URL.Path)
+		assert.Equal(t, "application/json", r.Header.Get("Content-Type"))
+		var p push
+		assert.NoError(t, json.NewDecoder(r.Body).Decode(&p))
+		pushes <- p
+		w.WriteHeader(http.StatusNoContent)
+	}))
+	defer server.Close()
+
+	sink, err := eventlog.NewSink(eventlog.SinkOpts{URL: server.URL + "/loki/api/v1/push", Format: eventlog.LokiFormat})
+	require.NoError(t, err)
+	logger := eventlog.NewZeroLogger(sink).With().Str("a", "01DJ2VB6C4G5CPKPBVDF0K4EG3").Logger()
+	logEvent := eventlog.NewLogger("01DJ2VB6GD7N9MRJ1TT7GM9J6K", &logger, zerolog.WarnLevel)
+	logEvent(nil, "first")
+	logEvent(nil, "second")
+	logger.Info().Msg("third")
+	require.NoError(t, sink.Close(context.Background()))
+
+	p := <-pushes
+	require.Len(t, p.Streams, 2, "events are grouped into streams by labels")
+	assert.Equal(t, map[string]string{
+		"app_id": "01DJ2VB6C4G5CPKPBVDF0K4EG3",
+		"event":  "01DJ2VB6GD7N9MRJ1TT7GM9J6K",
+		"level":  "warn",
+	}, p.Streams[0].Stream)
+	require.Len(t, p.Streams[0].Values, 2)
+	assert.Contains(t, p.Streams[0].Values[0][1], "first", "the log line is the event JSON")
+	assert.Contains(t, p.Streams[0].Values[1][1], "second")
+	assert.Equal(t, map[string]string{"app_id": "01DJ2VB6C4G5CPKPBVDF0K4EG3", "level": "info"}, p.Streams[1].Stream)
+	// timestamps are in nanos
+	assert.Len(t, p.Streams[1].Values[0][0], len(fmt.Sprint(time.Now().UnixNano())))
+	assert.Equal(t, uint64(3), sink.Stats().Sent)
+}
+
+func TestSink_Elasticsearch(t *testing.T) {
+	t.Parallel()
+
+	var mutex sync.Mutex
+	var requests int
+	actions := make(map[string]map[string]interface{})
+	docs := make(map[string]map[string]interface{})
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		mutex.Lock()
+		defer mutex.Unlock()
+		requests++
+		assert.Equal(t, eventlog.NDJSONMediaType, r.Header.Get("Content-Type"))
+		scanner := bufio.NewScanner(r.Body)
+		var items []string
+		for scanner.Scan() {
+			var action map[string]map[string]interface{}
+			require.NoError(t, json.Unmarshal(scanner.Bytes(), &action))
+			require.True(t, scanner.Scan())
+			var doc map[string]interface{}
+			require.NoError(t, json.Unmarshal(scanner.Bytes(), &doc))
+			id := action["create"]["_id"].(string)
+			status := 201
+			if _, exists := docs[id]; exists {
+				status = 409
+			}
+			// the first request partially fails, i.e., the batch is retried
+			if requests == 1 && len(items) == 1 {
+				status = 429
+			}
+			if status == 201 {
+				actions[id] = action["create"]
+				docs[id] = doc
+			}
+			items = append(items, fmt.Sprintf(`{"create":{"_id":%q,"status":%d,"error":{"type":"es_rejected_execution_exception","reason":"rejected"}}}`, id, status))
+		}
+		fmt.Fprintf(w, `{"errors":%v,"items":[%s]}`, requests == 1, strings.Join(items, ","))
+	}))
+	defer server.Close()
+
+	sink, err := eventlog.NewSink(eventlog.SinkOpts{
+		URL:          server.URL + "/_bulk",
+		Format:       eventlog.ElasticsearchFormat,
+		Index:        "logs-app-default",
+		RetryBackoff: time.Millisecond,
+	})
+	require.NoError(t, err)
+	logger := eventlog.NewZeroLogger(sink).With().Str("an", "app").Logger()
+	logEvent := eventlog.NewLogger("01DJ2VB6GD7N9MRJ1TT7GM9J6K", &logger, zerolog.ErrorLevel)
+	logEvent(nil, "first", "tag-a")
+	logger.Info().Int("count", 2).Msg("second")
+	require.NoError(t, sink.Close(context.Background()))
+
+	mutex.Lock()
+	defer mutex.Unlock()
+	assert.Equal(t, 2, requests)
+	require.Len(t, docs, 2, "retried events are not indexed twice")
+	stats := sink.Stats()
+	assert.Equal(t, uint64(2), stats.Sent)
+	assert.Equal(t, uint64(1), stats.Retries)
+
+	for id, doc := range docs {
+		assert.Equal(t, "logs-app-default", actions[id]["_index"])
+		assert.Equal(t, id, doc["event"].(map[string]interface{})["id"], "the event XID is the document ID")
+		assert.Equal(t, "app", doc["service"].(map[string]interface{})["name"])
+		_, err := time.Parse(time.RFC3339Nano, doc["@timestamp"].(string))
+		assert.NoError(t, err)
+		switch doc["message"] {
+		case "first":
+			assert.Equal(t, "error", doc["log"].(map[string]interface{})["level"])
+			assert.Equal(t, "01DJ2VB6GD7N9MRJ1TT7GM9J6K", doc["event"].(map[string]interface{})["code"])
+			assert.Equal(t, []interface{}{"tag-a"}, doc["tags"])
+		case "second":
+			assert.Equal(t, float64(2), doc[eventlog.ECSCustomFieldsNamespace].(map[string]interface{})["count"], "unmapped fields are namespaced")
+		default:
+			t.Errorf("*** unexpected doc: %v", doc)
+		}
+	}
+}
+
+func TestSinkOpts_Format(t *testing.T) {
+	t.Parallel()
+
+	for _, opts := range []eventlog.SinkOpts{
+		{URL: "tcp://loki:3100", Format: eventlog.LokiFormat},
+		{URL: "http://collector", Format: "gelf"},
+	} {
+		_, err := eventlog.NewSink(opts)
+		require.Error(t, err, opts.Format)
+		assert.Contains(t, err.Error(), eventlog.ErrInvalidSinkOpts.Error())
+	}
+}
@@ -0,0 +1,163 @@
+/*
+ * Copyright (c) 2019 OysterPack, Inc.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ * http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package eventlog
+
+import (
+	"github.com/rs/zerolog"
+	"io/ioutil"
+	"sync"
+	"sync/atomic"
+)
+
+// EventHook is run for events that are logged via `NewLogger()` and `NewContextLogger()`, i.e., hooks have access to the
+// event name, e.g., to count events by name.
+//
+// The hook is run after the event data is added, and before the event is written.
+type EventHook func(e *zerolog.Event, level zerolog.Level, event, msg string)
+
+type registeredHook struct {
+	id    uint64
+	hook  zerolog.Hook
+	event EventHook
+}
+
+// Hooks is a hook registry that is scoped to a logger, e.g., the app logger - see `WithHooks()`. Hooks enable
+// integrations, e.g., per-event counters, trace ID injection, and external forwarding, without replacing the log writer.
+//
+// Hooks can be added and removed while the logger is in use. Each change swaps in a new snapshot of the registered hooks,
+// i.e., logging an event does not lock.
+type Hooks struct {
+	mutex      sync.Mutex // serializes changes to the registered hooks
+	nextID     uint64
+	registered atomic.Value // []registeredHook
+}
+
+// NewHooks constructs a new empty hook registry.
+func NewHooks() *Hooks {
+	hooks := &Hooks{}
+	hooks.registered.Store([]registeredHook(nil))
+	return hooks
+}
+
+// WithHooks returns a logger that runs the registered hooks for each event. Event hooks are run for the event loggers
+// that are created from the returned logger, or from loggers that are derived from it - see `AddEventHook()`.
+func WithHooks(logger zerolog.Logger, hooks *Hooks) zerolog.Logger {
+	return logger.Hook(hooks)
+}
+
+// AddHook registers zerolog hooks, which are run for all events that are logged via the loggers that the registry was
+// applied to. Hooks are run in the order that they were registered.
+//
+// The returned function is used to remove the hooks, e.g., when the app is stopped.
+func (h *Hooks) AddHook(hooks ...zerolog.Hook) (remove func()) {
+	registered := make([]registeredHook, 0, len(hooks))
+	for _, hook := range hooks {
+		if hook != nil {
+			registered = append(registered, registeredHook{hook: hook})
+		}
+	}
+	return h.add(registered)
+}
+
+// AddEventHook registers event hooks - see `EventHook`.
+//
+// The returned function is used to remove the hooks, e.g., when the app is stopped.
+func (h *Hooks) AddEventHook(hooks ...EventHook) (remove func()) {
+	registered := make([]registeredHook, 0, len(hooks))
+	for _, hook := range hooks {
+		if hook != nil {
+			registered = append(registered, registeredHook{event: hook})
+		}
+	}
+	return h.add(registered)
+}
+
+func (h *Hooks) add(registered []registeredHook) func() {
+	h.mutex.Lock()
+	defer h.mutex.Unlock()
+	ids := make(map[uint64]bool, len(registered))
+	all := append([]registeredHook(nil), h.snapshot()...)
+	for _, hook := range registered {
+		h.nextID++
+		hook.id = h.nextID
+		ids[hook.id] = true
+		all = append(all, hook)
+	}
+	h.registered.Store(all)
+	return func() {
+		h.mutex.Lock()
+		defer h.mutex.Unlock()
+		registered := h.snapshot()
+		remaining := make([]registeredHook, 0, len(registered))
+		for _, hook := range registered {
+			if !ids[hook.id] {
+				remaining = append(remaining, hook)
+			}
+		}
+		h.registered.Store(remaining)
+	}
+}
+
+func (h *Hooks) snapshot() []registeredHook {
+	return h.registered.Load().([]registeredHook)
+}
+
+// Run implements the zerolog.Hook interface, i.e., it runs the registered zerolog hooks.
+func (h *Hooks) Run(e *zerolog.Event, level zerolog.Level, msg string) {
+	if level == zerolog.NoLevel && msg == probeMsg {
+		probe.hooks = h
+		return
+	}
+	for _, hook := range h.snapshot() {
+		if hook.hook != nil {
+			hook.hook.Run(e, level, msg)
+		}
+	}
+}
+
+// runs the registered event hooks, in the order that they were registered
+func (h *Hooks) runEventHooks(e *zerolog.Event, level zerolog.Level, event, msg string) {
+	if h == nil || !e.Enabled() {
+		return
+	}
+	for _, hook := range h.snapshot() {
+		if hook.event != nil {
+			hook.event(e, level, event, msg)
+		}
+	}
+}
+
+const probeMsg = "eventlog.Hooks probe"
+
+// probe is used to look up the hook registry that a logger runs - see `hooksFor()`
+var probe struct {
+	sync.Mutex
+	hooks *Hooks
+}
+
+// hooksFor returns the hook registry that the logger runs, or nil if the logger has none.
+//
+// zerolog does not expose a logger's hooks. Thus, a probe event is logged to a discarding writer, which the registry
+// answers. The lookup is done when the event logger is created, i.e., it is not on the logging path.
+func hooksFor(logger *zerolog.Logger) *Hooks {
+	probe.Lock()
+	defer probe.Unlock()
+	probe.hooks = nil
+	l := logger.Output(ioutil.Discard).Level(zerolog.NoLevel).Sample(nil)
+	l.Log().Msg(probeMsg)
+	return probe.hooks
+}
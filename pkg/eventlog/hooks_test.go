@@ -0,0 +1,111 @@
+/*
+ * Copyright (c) 2019 OysterPack, Inc.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ * http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package eventlog_test
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"github.com/oysterpack/andiamo/pkg/eventlog"
+	"github.com/rs/zerolog"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"strings"
+	"testing"
+)
+
+func TestHooks_AddHook(t *testing.T) {
+	t.Parallel()
+
+	buf := new(bytes.Buffer)
+	hooks := eventlog.NewHooks()
+	logger := eventlog.WithHooks(eventlog.NewZeroLogger(buf), hooks)
+	// hooks are scoped to the logger that the registry is applied to
+	otherBuf := new(bytes.Buffer)
+	otherLogger := eventlog.NewZeroLogger(otherBuf)
+
+	// hooks that are added after the logger is created are applied
+	remove := hooks.AddHook(
+		zerolog.HookFunc(func(e *zerolog.Event, level zerolog.Level, msg string) {
+			e.Str("trace_id", "4bf92f3577b34da6")
+		}),
+		nil,
+		zerolog.HookFunc(func(e *zerolog.Event, level zerolog.Level, msg string) {
+			e.Str("lvl", level.String())
+		}),
+	)
+	logger.Info().Msg("foo")
+	otherLogger.Info().Msg("foo")
+	remove()
+	logger.Info().Msg("bar")
+
+	lines := strings.Split(strings.TrimSpace(buf.String()), "\n")
+	require.Len(t, lines, 2)
+	var event map[string]interface{}
+	require.NoError(t, json.Unmarshal([]byte(lines[0]), &event))
+	assert.Equal(t, "4bf92f3577b34da6", event["trace_id"])
+	assert.Equal(t, "info", event["lvl"])
+
+	event = nil
+	require.NoError(t, json.Unmarshal([]byte(lines[1]), &event))
+	assert.NotContains(t, event, "trace_id", "the hook was removed")
+	assert.NotContains(t, event, "lvl", "the hook was removed")
+
+	event = nil
+	require.NoError(t, json.Unmarshal(otherBuf.Bytes(), &event))
+	assert.NotContains(t, event, "trace_id", "the hook is not applied to other loggers")
+}
+
+func TestHooks_AddEventHook(t *testing.T) {
+	t.Parallel()
+
+	buf := new(bytes.Buffer)
+	hooks := eventlog.NewHooks()
+	logger := eventlog.WithHooks(eventlog.NewZeroLogger(buf), hooks)
+	logger = logger.Level(zerolog.InfoLevel)
+	otherLogger := eventlog.NewZeroLogger(new(bytes.Buffer))
+
+	counts := make(map[string]int)
+	remove := hooks.AddEventHook(func(e *zerolog.Event, level zerolog.Level, event, msg string) {
+		counts[event]++
+		e.Bool("counted", true)
+	})
+	defer remove()
+
+	logFoo := eventlog.NewLogger("foo", &logger, zerolog.InfoLevel)
+	logBar := eventlog.NewContextLogger("bar", &logger, zerolog.WarnLevel)
+	logDebug := eventlog.NewLogger("debug", &logger, zerolog.DebugLevel)
+	// event hooks are applied to loggers that are derived from the logger
+	logComponent := eventlog.NewLogger("component", eventlog.ForComponent(&logger, "comp"), zerolog.InfoLevel)
+	// event hooks are not applied to other loggers
+	logOther := eventlog.NewLogger("other", &otherLogger, zerolog.InfoLevel)
+	logFoo(nil, "foo")
+	logFoo(nil, "foo")
+	logBar(context.Background(), nil, "bar")
+	logDebug(nil, "debug events are not logged")
+	logComponent(nil, "component")
+	logOther(nil, "other")
+	// events that are not logged via event loggers are not passed to event hooks
+	logger.Info().Msg("baz")
+
+	assert.Equal(t, map[string]int{"foo": 2, "bar": 1, "component": 1}, counts)
+	lines := strings.Split(strings.TrimSpace(buf.String()), "\n")
+	require.Len(t, lines, 5)
+	var event map[string]interface{}
+	require.NoError(t, json.Unmarshal([]byte(lines[0]), &event))
+	assert.Equal(t, true, event["counted"])
+}
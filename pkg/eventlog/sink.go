@@ -0,0 +1,485 @@
+/*
+ * Copyright (c) 2019 OysterPack, Inc.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ * http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package eventlog
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net"
+	"net/http"
+	"net/url"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// ErrInvalidSinkOpts indicates the sink options are invalid
+var ErrInvalidSinkOpts = errors.New("log sink options are invalid")
+
+// NDJSONMediaType is the HTTP sink request content type, i.e., newline delimited JSON
+const NDJSONMediaType = "application/x-ndjson"
+
+// HTTP sink formats
+const (
+	// NDJSONFormat posts each batch as newline delimited JSON, e.g., to a Vector or Fluentd HTTP source
+	NDJSONFormat = "ndjson"
+	// LokiFormat pushes each batch to the Loki push API, i.e., the URL is the push endpoint, e.g.,
+	// "http://loki:3100/loki/api/v1/push" - see `LokiLabels`
+	LokiFormat = "loki"
+	// ElasticsearchFormat indexes each batch via the Elasticsearch bulk API, i.e., the URL is the bulk endpoint, e.g.,
+	// "http://elasticsearch:9200/_bulk". Events are mapped to Elastic Common Schema (ECS) fields - see `ECSFields`.
+	ElasticsearchFormat = "elasticsearch"
+)
+
+// SinkOpts is used to configure a network log `Sink`
+type SinkOpts struct {
+	// URL is the log collector URL, which determines the transport:
+	//   - "tcp://host:port" - events are written as newline delimited JSON over a persistent connection, e.g., to a
+	//     Vector or Fluentd socket source
+	//   - "udp://host:port" - each event is sent as a datagram
+	//   - "http://host/path" or "https://host/path" - each batch is posted in the configured format
+	URL string
+	// Format is the HTTP sink format, i.e., one of NDJSONFormat, LokiFormat, ElasticsearchFormat - defaults to
+	// NDJSONFormat. The TCP and UDP transports only support NDJSONFormat.
+	Format string
+	// Index is the Elasticsearch index or data stream that events are indexed into - defaults to "logs-andiamo-default"
+	Index string
+	// BatchSize is the max number of events that are sent per batch - defaults to 100
+	BatchSize int `split_words:"true"`
+	// FlushInterval is the max time that events are buffered before they are sent - defaults to 1 sec
+	FlushInterval time.Duration `split_words:"true"`
+	// BufferSize is the max number of events that are buffered. When the buffer is full, events are dropped, i.e.,
+	// logging never blocks on the network - defaults to 10000
+	BufferSize int `split_words:"true"`
+	// MaxRetries is the max number of times a failed batch is retried, after which the batch is dropped - defaults to 3
+	MaxRetries int `split_words:"true"`
+	// RetryBackoff is the initial retry backoff, which is doubled on each retry - defaults to 500 ms
+	RetryBackoff time.Duration `split_words:"true"`
+	// Timeout is the connect and send timeout - defaults to 5 secs
+	Timeout time.Duration
+	// AuthToken is sent as a bearer token by the HTTP transport, if specified
+	AuthToken string `split_words:"true"`
+}
+
+func (opts SinkOpts) withDefaults() SinkOpts {
+	if opts.Format == "" {
+		opts.Format = NDJSONFormat
+	}
+	if opts.Index == "" {
+		opts.Index = "logs-andiamo-default"
+	}
+	if opts.BatchSize == 0 {
+		opts.BatchSize = 100
+	}
+	if opts.FlushInterval == 0 {
+		opts.FlushInterval = time.Second
+	}
+	if opts.BufferSize == 0 {
+		opts.BufferSize = 10000
+	}
+	if opts.MaxRetries == 0 {
+		opts.MaxRetries = 3
+	}
+	if opts.RetryBackoff == 0 {
+		opts.RetryBackoff = 500 * time.Millisecond
+	}
+	if opts.Timeout == 0 {
+		opts.Timeout = 5 * time.Second
+	}
+	return opts
+}
+
+// Validate checks that the URL is a supported log collector URL, and that the numeric options are not negative
+func (opts SinkOpts) Validate() error {
+	u, err := url.Parse(opts.URL)
+	if err != nil {
+		return fmt.Errorf("%s : invalid URL : %s", ErrInvalidSinkOpts, err)
+	}
+	switch u.Scheme {
+	case "tcp", "udp", "http", "https":
+	default:
+		return fmt.Errorf("%s : URL scheme must be one of tcp, udp, http, https : %q", ErrInvalidSinkOpts, opts.URL)
+	}
+	if u.Host == "" {
+		return fmt.Errorf("%s : URL host is required : %q", ErrInvalidSinkOpts, opts.URL)
+	}
+	switch opts.Format {
+	case "", NDJSONFormat:
+	case LokiFormat, ElasticsearchFormat:
+		if u.Scheme != "http" && u.Scheme != "https" {
+			return fmt.Errorf("%s : %s format requires an HTTP URL : %q", ErrInvalidSinkOpts, opts.Format, opts.URL)
+		}
+	default:
+		return fmt.Errorf("%s : format must be one of %s, %s, %s : %q", ErrInvalidSinkOpts, NDJSONFormat, LokiFormat, ElasticsearchFormat, opts.Format)
+	}
+	if opts.BatchSize < 0 || opts.BufferSize < 0 || opts.MaxRetries < 0 {
+		return fmt.Errorf("%s : batch size, buffer size, and max retries must not be negative", ErrInvalidSinkOpts)
+	}
+	if opts.FlushInterval < 0 || opts.RetryBackoff < 0 || opts.Timeout < 0 {
+		return fmt.Errorf("%s : flush interval, retry backoff, and timeout must not be negative", ErrInvalidSinkOpts)
+	}
+	return nil
+}
+
+// SinkStats are the sink's backpressure stats, which are used to monitor the log shipping
+type SinkStats struct {
+	// events that were sent
+	Sent uint64
+	// events that were dropped because the buffer was full
+	Dropped uint64
+	// events that were dropped because the batch failed to send after all retries
+	Failed uint64
+	// batch retries
+	Retries uint64
+	// events that are buffered
+	Queued int
+	// Lag is how long the oldest event in the last sent batch was buffered, i.e., the export lag
+	Lag time.Duration
+}
+
+// Sink is an io.Writer that ships events to a log collector over the network, for environments where the stderr logs
+// are not scraped. Events are buffered, and sent in batches in the background. Failed batches are retried with
+// exponential backoff.
+//
+// Writes never block, i.e., events are dropped when the buffer is full - see `SinkStats`.
+type Sink struct {
+	opts      SinkOpts
+	transport sinkTransport
+
+	// the lock guards the queue from being written to after it is closed
+	mutex  sync.RWMutex
+	closed bool
+	queue  chan queuedEvent
+
+	ctx    context.Context
+	cancel context.CancelFunc
+	done   chan struct{}
+
+	sent, dropped, failed, retries uint64
+	// nanos
+	lag int64
+}
+
+type queuedEvent struct {
+	event  []byte
+	queued time.Time
+}
+
+// sinkTransport sends a batch of events
+type sinkTransport interface {
+	send(ctx context.Context, events [][]byte) error
+	close() error
+}
+
+// NewSink creates a new sink and starts sending events in the background. The sink must be closed to flush the
+// buffered events.
+func NewSink(opts SinkOpts) (*Sink, error) {
+	if err := opts.Validate(); err != nil {
+		return nil, err
+	}
+	opts = opts.withDefaults()
+	transport, err := newSinkTransport(opts)
+	if err != nil {
+		return nil, err
+	}
+	return newSink(opts, transport), nil
+}
+
+func newSink(opts SinkOpts, transport sinkTransport) *Sink {
+	ctx, cancel := context.WithCancel(context.Background())
+	s := &Sink{
+		opts:      opts,
+		transport: transport,
+		queue:     make(chan queuedEvent, opts.BufferSize),
+		ctx:       ctx,
+		cancel:    cancel,
+		done:      make(chan struct{}),
+	}
+	go s.run()
+	return s
+}
+
+func newSinkTransport(opts SinkOpts) (sinkTransport, error) {
+	u, err := url.Parse(opts.URL)
+	if err != nil {
+		return nil, err
+	}
+	switch u.Scheme {
+	case "tcp":
+		return &tcpTransport{addr: u.Host, timeout: opts.Timeout}, nil
+	case "udp":
+		return &udpTransport{addr: u.Host, timeout: opts.Timeout}, nil
+	default:
+		t := &httpTransport{
+			url:       opts.URL,
+			authToken: opts.AuthToken,
+			client:    &http.Client{Timeout: opts.Timeout},
+			encode:    encodeNDJSON,
+		}
+		switch opts.Format {
+		case LokiFormat:
+			t.encode = encodeLokiPush
+		case ElasticsearchFormat:
+			t.encode = newElasticsearchBulkEncoder(opts.Index)
+			t.checkResponse = checkElasticsearchBulkResponse
+		}
+		return t, nil
+	}
+}
+
+// Write buffers a copy of the event. If the buffer is full, or the sink is closed, then the event is dropped.
+func (s *Sink) Write(p []byte) (int, error) {
+	s.mutex.RLock()
+	defer s.mutex.RUnlock()
+	if s.closed {
+		atomic.AddUint64(&s.dropped, 1)
+		return len(p), nil
+	}
+	event := append([]byte(nil), bytes.TrimRight(p, "\n")...)
+	select {
+	case s.queue <- queuedEvent{event: event, queued: time.Now()}:
+	default:
+		atomic.AddUint64(&s.dropped, 1)
+	}
+	return len(p), nil
+}
+
+// Stats returns the sink stats
+func (s *Sink) Stats() SinkStats {
+	return SinkStats{
+		Sent:    atomic.LoadUint64(&s.sent),
+		Dropped: atomic.LoadUint64(&s.dropped),
+		Failed:  atomic.LoadUint64(&s.failed),
+		Retries: atomic.LoadUint64(&s.retries),
+		Queued:  len(s.queue),
+		Lag:     time.Duration(atomic.LoadInt64(&s.lag)),
+	}
+}
+
+// Close flushes the buffered events and closes the sink. If the context is done before the events are flushed, then
+// the sending is aborted, i.e., the remaining events are dropped.
+func (s *Sink) Close(ctx context.Context) error {
+	s.mutex.Lock()
+	if !s.closed {
+		s.closed = true
+		close(s.queue)
+	}
+	s.mutex.Unlock()
+
+	select {
+	case <-s.done:
+		return s.transport.close()
+	case <-ctx.Done():
+		s.cancel()
+		<-s.done
+		s.transport.close()
+		return ctx.Err()
+	}
+}
+
+func (s *Sink) run() {
+	defer close(s.done)
+	defer s.cancel()
+	timer := time.NewTimer(s.opts.FlushInterval)
+	defer timer.Stop()
+	batch := make([][]byte, 0, s.opts.BatchSize)
+	// when the oldest event in the batch was buffered
+	var oldest time.Time
+	flush := func() {
+		if len(batch) > 0 {
+			s.send(batch, oldest)
+			batch = make([][]byte, 0, s.opts.BatchSize)
+		}
+	}
+	for {
+		select {
+		case event, ok := <-s.queue:
+			if !ok {
+				flush()
+				return
+			}
+			if len(batch) == 0 {
+				oldest = event.queued
+			}
+			batch = append(batch, event.event)
+			if len(batch) >= s.opts.BatchSize {
+				flush()
+			}
+		case <-timer.C:
+			flush()
+			timer.Reset(s.opts.FlushInterval)
+		}
+	}
+}
+
+// send sends the batch, and retries with exponential backoff on failure
+func (s *Sink) send(batch [][]byte, oldest time.Time) {
+	backoff := s.opts.RetryBackoff
+	for i := 0; ; i++ {
+		if s.ctx.Err() != nil {
+			break
+		}
+		if err := s.transport.send(s.ctx, batch); err == nil {
+			atomic.AddUint64(&s.sent, uint64(len(batch)))
+			atomic.StoreInt64(&s.lag, int64(time.Since(oldest)))
+			return
+		}
+		if i == s.opts.MaxRetries {
+			break
+		}
+		atomic.AddUint64(&s.retries, 1)
+		timer := time.NewTimer(backoff)
+		select {
+		case <-timer.C:
+		case <-s.ctx.Done():
+			timer.Stop()
+		}
+		backoff *= 2
+	}
+	atomic.AddUint64(&s.failed, uint64(len(batch)))
+}
+
+type tcpTransport struct {
+	addr    string
+	timeout time.Duration
+	conn    net.Conn
+}
+
+func (t *tcpTransport) send(ctx context.Context, events [][]byte) error {
+	if t.conn == nil {
+		dialer := net.Dialer{Timeout: t.timeout}
+		conn, err := dialer.DialContext(ctx, "tcp", t.addr)
+		if err != nil {
+			return err
+		}
+		t.conn = conn
+	}
+	var buf bytes.Buffer
+	for _, event := range events {
+		buf.Write(event)
+		buf.WriteByte('\n')
+	}
+	t.conn.SetWriteDeadline(time.Now().Add(t.timeout))
+	if _, err := t.conn.Write(buf.Bytes()); err != nil {
+		// the connection is reestablished on retry
+		t.close()
+		return err
+	}
+	return nil
+}
+
+func (t *tcpTransport) close() error {
+	if t.conn == nil {
+		return nil
+	}
+	err := t.conn.Close()
+	t.conn = nil
+	return err
+}
+
+type udpTransport struct {
+	addr    string
+	timeout time.Duration
+	conn    net.Conn
+}
+
+func (t *udpTransport) send(ctx context.Context, events [][]byte) error {
+	if t.conn == nil {
+		dialer := net.Dialer{Timeout: t.timeout}
+		conn, err := dialer.DialContext(ctx, "udp", t.addr)
+		if err != nil {
+			return err
+		}
+		t.conn = conn
+	}
+	t.conn.SetWriteDeadline(time.Now().Add(t.timeout))
+	for _, event := range events {
+		if _, err := t.conn.Write(event); err != nil {
+			t.close()
+			return err
+		}
+	}
+	return nil
+}
+
+func (t *udpTransport) close() error {
+	if t.conn == nil {
+		return nil
+	}
+	err := t.conn.Close()
+	t.conn = nil
+	return err
+}
+
+type httpTransport struct {
+	url       string
+	authToken string
+	client    *http.Client
+
+	// encodes the batch as the request body
+	encode func(events [][]byte) (contentType string, body []byte, err error)
+	// optional - checks the response body of successful requests, e.g., for partial failures
+	checkResponse func(body []byte) error
+}
+
+func encodeNDJSON(events [][]byte) (string, []byte, error) {
+	body := bytes.Join(events, []byte("\n"))
+	return NDJSONMediaType, append(body, '\n'), nil
+}
+
+func (t *httpTransport) send(ctx context.Context, events [][]byte) error {
+	contentType, body, err := t.encode(events)
+	if err != nil {
+		return err
+	}
+	request, err := http.NewRequest(http.MethodPost, t.url, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	request = request.WithContext(ctx)
+	request.Header.Set("Content-Type", contentType)
+	if t.authToken != "" {
+		request.Header.Set("Authorization", "Bearer "+t.authToken)
+	}
+	response, err := t.client.Do(request)
+	if err != nil {
+		return err
+	}
+	defer response.Body.Close()
+	if response.StatusCode < 200 || response.StatusCode >= 300 {
+		io.Copy(ioutil.Discard, response.Body)
+		return fmt.Errorf("log collector responded with HTTP status : %s", response.Status)
+	}
+	if t.checkResponse == nil {
+		io.Copy(ioutil.Discard, response.Body)
+		return nil
+	}
+	responseBody, err := ioutil.ReadAll(response.Body)
+	if err != nil {
+		return err
+	}
+	return t.checkResponse(responseBody)
+}
+
+func (t *httpTransport) close() error {
+	t.client.CloseIdleConnections()
+	return nil
+}
@@ -0,0 +1,194 @@
+/*
+ * Copyright (c) 2019 OysterPack, Inc.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ * http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package eventlog_test
+
+import (
+	"bufio"
+	"context"
+	"github.com/oysterpack/andiamo/pkg/eventlog"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"io/ioutil"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestSink_TCP(t *testing.T) {
+	t.Parallel()
+
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	require.NoError(t, err)
+	defer listener.Close()
+	lines := make(chan string, 10)
+	go func() {
+		conn, err := listener.Accept()
+		if err != nil {
+			return
+		}
+		defer conn.Close()
+		scanner := bufio.NewScanner(conn)
+		for scanner.Scan() {
+			lines <- scanner.Text()
+		}
+	}()
+
+	sink, err := eventlog.NewSink(eventlog.SinkOpts{URL: "tcp://" + listener.Addr().String(), BatchSize: 2})
+	require.NoError(t, err)
+	logger := eventlog.NewZeroLogger(sink)
+	logger.Info().Msg("first")
+	logger.Info().Msg("second")
+	logger.Info().Msg("third")
+	// the remaining events are flushed when the sink is closed
+	require.NoError(t, sink.Close(context.Background()))
+
+	for _, msg := range []string{"first", "second", "third"} {
+		select {
+		case line := <-lines:
+			assert.Contains(t, line, msg)
+		case <-time.After(5 * time.Second):
+			t.Fatal("*** timed out waiting for event")
+		}
+	}
+	stats := sink.Stats()
+	assert.Equal(t, uint64(3), stats.Sent)
+	assert.Equal(t, 0, stats.Queued)
+
+	// events that are logged after the sink is closed are dropped
+	logger.Info().Msg("closed")
+	assert.Equal(t, uint64(1), sink.Stats().Dropped)
+}
+
+func TestSink_UDP(t *testing.T) {
+	t.Parallel()
+
+	conn, err := net.ListenPacket("udp", "127.0.0.1:0")
+	require.NoError(t, err)
+	defer conn.Close()
+
+	sink, err := eventlog.NewSink(eventlog.SinkOpts{URL: "udp://" + conn.LocalAddr().String(), FlushInterval: 10 * time.Millisecond})
+	require.NoError(t, err)
+	defer sink.Close(context.Background())
+	logger := eventlog.NewZeroLogger(sink)
+	logger.Info().Msg("datagram")
+
+	conn.SetReadDeadline(time.Now().Add(5 * time.Second))
+	buf := make([]byte, 1024)
+	n, _, err := conn.ReadFrom(buf)
+	require.NoError(t, err)
+	assert.Contains(t, string(buf[:n]), "datagram")
+	assert.False(t, strings.HasSuffix(string(buf[:n]), "\n"), "datagrams are not newline delimited")
+}
+
+func TestSink_HTTP(t *testing.T) {
+	t.Parallel()
+
+	var mutex sync.Mutex
+	var requests int
+	var bodies []string
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		mutex.Lock()
+		defer mutex.Unlock()
+		requests++
+		// the first request fails, i.e., the batch is retried
+		if requests == 1 {
+			w.WriteHeader(http.StatusServiceUnavailable)
+			return
+		}
+		assert.Equal(t, eventlog.NDJSONMediaType, r.Header.Get("Content-Type"))
+		assert.Equal(t, "Bearer secret", r.Header.Get("Authorization"))
+		body, _ := ioutil.ReadAll(r.Body)
+		bodies = append(bodies, string(body))
+	}))
+	defer server.Close()
+
+	sink, err := eventlog.NewSink(eventlog.SinkOpts{
+		URL:          server.URL + "/ingest",
+		AuthToken:    "secret",
+		RetryBackoff: time.Millisecond,
+	})
+	require.NoError(t, err)
+	logger := eventlog.NewZeroLogger(sink)
+	logger.Info().Msg("first")
+	logger.Info().Msg("second")
+	require.NoError(t, sink.Close(context.Background()))
+
+	mutex.Lock()
+	defer mutex.Unlock()
+	require.Len(t, bodies, 1, "events are sent in batches")
+	lines := strings.Split(strings.TrimSpace(bodies[0]), "\n")
+	require.Len(t, lines, 2)
+	assert.Contains(t, lines[0], "first")
+	assert.Contains(t, lines[1], "second")
+	stats := sink.Stats()
+	assert.Equal(t, uint64(2), stats.Sent)
+	assert.Equal(t, uint64(1), stats.Retries)
+}
+
+func TestSink_Backpressure(t *testing.T) {
+	t.Parallel()
+
+	// the collector is unavailable
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusServiceUnavailable)
+	}))
+	defer server.Close()
+
+	sink, err := eventlog.NewSink(eventlog.SinkOpts{
+		URL:          server.URL,
+		BatchSize:    1,
+		BufferSize:   2,
+		MaxRetries:   1,
+		RetryBackoff: time.Hour,
+	})
+	require.NoError(t, err)
+	logger := eventlog.NewZeroLogger(sink)
+	for i := 0; i < 10; i++ {
+		logger.Info().Msg("event")
+	}
+	stats := sink.Stats()
+	assert.True(t, stats.Dropped >= 7, "events are dropped when the buffer is full: %d", stats.Dropped)
+	assert.True(t, stats.Queued <= 2)
+
+	// the retry backoff is aborted when the close times out, i.e., the buffered events fail
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+	defer cancel()
+	assert.Equal(t, context.DeadlineExceeded, sink.Close(ctx))
+	stats = sink.Stats()
+	assert.Equal(t, uint64(10), stats.Dropped+stats.Failed)
+	assert.Equal(t, uint64(0), stats.Sent)
+}
+
+func TestSinkOpts_Validate(t *testing.T) {
+	t.Parallel()
+
+	for _, opts := range []eventlog.SinkOpts{
+		{},
+		{URL: "ftp://collector:21"},
+		{URL: "tcp://"},
+		{URL: "tcp://collector:24224", BatchSize: -1},
+		{URL: "http://collector/ingest", Timeout: -time.Second},
+	} {
+		_, err := eventlog.NewSink(opts)
+		require.Error(t, err, opts.URL)
+		assert.Contains(t, err.Error(), eventlog.ErrInvalidSinkOpts.Error())
+	}
+}
@@ -47,6 +47,8 @@ const (
 	Name      = "n" // event name - should be a XID
 	Component = "c" // component name - should be a XID
 	XID       = "x" // event instance XID
+	// request context - see `reqctx.RequestContext`
+	RequestContext = "rc"
 )
 
 // ForEvent returns a new logger with the event type ID field 'n' set to the specified value.
@@ -32,6 +32,9 @@ import (
 //	  - StartedEvent
 //	  - StoppingEvent
 //	  - StoppedEvent
+//	- DeprecatedEvent is logged when the app is initialized
+//
+// Deprecated: use `fxapp.NewBuilder()` - see `fxapp.NewBuilderFromLegacyOpts()`
 func New(opts Opts, options ...fx.Option) *fx.App {
 	appOptions := make([]fx.Option, 0, len(options)+3)
 
@@ -77,6 +80,7 @@ func New(opts Opts, options ...fx.Option) *fx.App {
 			},
 			func(dotgraph fx.DotGraph, log Logger) {
 				log(InitializedEvent, zerolog.NoLevel)(appInfo{dotgraph}, "app is initialized")
+				log(DeprecatedEvent, zerolog.WarnLevel)(deprecation{"github.com/oysterpack/andiamo/pkg/fxapp"}, "app package is deprecated")
 			},
 		),
 	)
@@ -94,6 +98,8 @@ func New(opts Opts, options ...fx.Option) *fx.App {
 // 	- InitFailedEvent
 // 	- StartFailedEvent
 // 	- StopFailedEvent
+//
+// Deprecated: use `fxapp.App.Run()` - see `fxapp.NewBuilderFromLegacyOpts()`
 func Go(opts Opts, options ...fx.Option) (shutdowner fx.Shutdowner, done chan error, err error) {
 	done = make(chan error, 1)
 
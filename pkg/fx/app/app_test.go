@@ -71,6 +71,7 @@ func TestNewApp(t *testing.T) {
 
 	expectedEvents := map[string]struct{}{
 		app.InitializedEvent: struct{}{},
+		app.DeprecatedEvent:  struct{}{},
 		app.StartingEvent:    struct{}{},
 		app.StartedEvent:     struct{}{},
 		app.StoppingEvent:    struct{}{},
@@ -20,5 +20,14 @@
 //  - app ID
 //  - app ReleaseID
 //  - app InstanceID
-//  - eventlog.Logger using a zerolog.Logger with the above app IDs
+//  - app Name and Version - optional
+//  - appdesc.Desc
+//  - appdesc.InstanceMetadata - runtime environment metadata, which is only loaded if enabled via Opts
+//  - Labels - the standard app labels that should be applied to metrics
+//  - eventlog.Logger using a zerolog.Logger with the above app IDs, name, and version
+//
+// Deprecated: the package is superseded by the fxapp package. In order to migrate incrementally, an fxapp.Builder can be
+// constructed from the module Opts, and the types provided by this module can be provided by the fxapp app - see
+// `fxapp.NewBuilderFromLegacyOpts()` and `fxapp.Builder.EnableLegacyShims()`. The `DeprecatedEvent` is logged when the
+// app is initialized.
 package app
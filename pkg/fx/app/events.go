@@ -57,6 +57,23 @@ const (
 	StoppedEvent = "01DE4T1V9N50BB67V424S6MG5C"
 )
 
+// DeprecatedEvent is logged at warn level when the app is initialized because the package is deprecated - see the
+// package doc for how to migrate to fxapp.
+//
+// 	type Data struct {
+//		Replacement string `json:"replacement"`
+//	}
+const DeprecatedEvent = "01DJ42AHKZCZDT6JPEC18GCARY"
+
+type deprecation struct {
+	replacement string
+}
+
+// MarshalZerologObject implements zerolog.LogObjectMarshaler interface
+func (event deprecation) MarshalZerologObject(e *zerolog.Event) {
+	e.Str("replacement", event.replacement)
+}
+
 type appInfo struct {
 	fx.DotGraph
 }
@@ -17,6 +17,7 @@
 package app
 
 import (
+	"github.com/blang/semver"
 	"github.com/oklog/ulid"
 	"github.com/oysterpack/andiamo/pkg/eventlog"
 	"github.com/rs/zerolog"
@@ -28,6 +29,16 @@ type ID func() ulid.ULID
 // ReleaseID returns the application release ID, i.e., it corresponds to an applicaiton release mapped to a specific version
 type ReleaseID func() ulid.ULID
 
+// Name returns the application name
+type Name func() string
+
+// Version returns the application version
+type Version func() semver.Version
+
+// Labels returns the standard application labels, i.e., the app descriptor and instance ID labels.
+// The labels should be applied to the app metrics, e.g., via `prometheus.WrapRegistererWith()`.
+type Labels func() map[string]string
+
 // InstanceID returns the application instance ID, i.e., it corresponds to an application instance
 type InstanceID func() ulid.ULID
 
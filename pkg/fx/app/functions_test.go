@@ -21,11 +21,15 @@ import (
 	"bytes"
 	"context"
 	"encoding/json"
+	"fmt"
+	"github.com/blang/semver"
 	"github.com/oklog/ulid"
+	"github.com/oysterpack/andiamo/pkg/appdesc"
 	"github.com/oysterpack/andiamo/pkg/fx/app"
 	"github.com/oysterpack/andiamo/pkg/ulids"
 	"github.com/rs/zerolog"
 	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
 	"go.uber.org/fx"
 	"os"
 	"testing"
@@ -52,6 +56,22 @@ func TestAppIDs(t *testing.T) {
 		assert.NoError(t, a.Err(), "app failed to initialize")
 	})
 
+	t.Run("IDs are set from the app descriptor", func(t *testing.T) {
+		t.Parallel()
+		desc := appdesc.Desc{ID: ulids.MustNew(), Name: "foo", ReleaseID: ulids.MustNew()}
+		a := fx.New(
+			app.Module(app.NewOpts(desc)),
+			fx.Invoke(
+				func(id app.ID, releaseID app.ReleaseID) {
+					assert.Equal(t, desc.ID, id())
+					assert.Equal(t, desc.ReleaseID, releaseID())
+				},
+			),
+		)
+
+		assert.NoError(t, a.Err(), "app failed to initialize")
+	})
+
 	t.Run("load from env", func(t *testing.T) {
 		prefix := ulids.MustNew().String()
 		appID := ulids.MustNew()
@@ -178,6 +198,129 @@ func TestAppIDs(t *testing.T) {
 	})
 }
 
+func TestAppNameAndVersion(t *testing.T) {
+	t.Parallel()
+
+	t.Run("name and version are explicitly set", func(t *testing.T) {
+		t.Parallel()
+		buf := new(bytes.Buffer)
+		opts := app.Opts{ID: ulids.MustNew(), ReleaseID: ulids.MustNew(), Name: "foo", Version: "1.2.3", LogWriter: buf}
+		var labels app.Labels
+		a := fx.New(
+			app.Module(opts),
+			fx.Invoke(
+				func(name app.Name, version app.Version, desc appdesc.Desc, logger app.Logger) {
+					assert.Equal(t, "foo", name())
+					assert.Equal(t, semver.MustParse("1.2.3"), version())
+					assert.Equal(t, appdesc.Desc{ID: opts.ID, Name: "foo", Version: version(), ReleaseID: opts.ReleaseID}, desc)
+					logger("foo", zerolog.NoLevel)(nil, "bar")
+				},
+			),
+			fx.Populate(&labels),
+		)
+		require.NoError(t, a.Err(), "app failed to initialize")
+
+		// Then the name and version are stamped onto log events
+		type LogEvent struct {
+			Name    string `json:"an"`
+			Version string `json:"av"`
+		}
+		var logEvent LogEvent
+		line, err := bufio.NewReader(buf).ReadString('\n')
+		require.NoError(t, err)
+		require.NoError(t, json.Unmarshal([]byte(line), &logEvent))
+		assert.Equal(t, LogEvent{"foo", "1.2.3"}, logEvent)
+		// And are included in the standard app labels
+		assert.Equal(t, "foo", labels()[app.NameLabel])
+		assert.Equal(t, "1.2.3", labels()[app.VersionLabel])
+		assert.NotEmpty(t, labels()[app.InstanceIDLabel])
+	})
+
+	t.Run("load from env", func(t *testing.T) {
+		prefix := ulids.MustNew().String()
+		os.Setenv(prefix+"_NAME", "foo")
+		os.Setenv(prefix+"_VERSION", "1.2.3")
+		defer func() {
+			os.Unsetenv(prefix + "_NAME")
+			os.Unsetenv(prefix + "_VERSION")
+		}()
+
+		a := fx.New(
+			app.Module(app.Opts{EnvPrefix: prefix, ID: ulids.MustNew(), ReleaseID: ulids.MustNew()}),
+			fx.Invoke(
+				func(name app.Name, version app.Version) {
+					assert.Equal(t, "foo", name())
+					assert.Equal(t, semver.MustParse("1.2.3"), version())
+				},
+			),
+		)
+		assert.NoError(t, a.Err(), "app failed to initialize")
+	})
+
+	t.Run("name and version are optional", func(t *testing.T) {
+		t.Parallel()
+		var labels app.Labels
+		a := fx.New(
+			app.Module(app.Opts{ID: ulids.MustNew(), ReleaseID: ulids.MustNew()}),
+			fx.Invoke(
+				func(name app.Name, version app.Version) {
+					assert.Empty(t, name())
+					assert.Equal(t, semver.Version{}, version())
+				},
+			),
+			fx.Populate(&labels),
+		)
+		assert.NoError(t, a.Err(), "app failed to initialize")
+		assert.NotContains(t, labels(), app.NameLabel)
+	})
+
+	t.Run("invalid version", func(t *testing.T) {
+		t.Parallel()
+		a := fx.New(
+			app.Module(app.Opts{ID: ulids.MustNew(), ReleaseID: ulids.MustNew(), Name: "foo", Version: "1.2"}),
+			fx.Invoke(func(version app.Version) {}),
+		)
+		require.Error(t, a.Err(), "app should have failed to initialize because the version is invalid")
+		t.Log(a.Err())
+	})
+}
+
+func TestInstanceMetadata(t *testing.T) {
+	t.Parallel()
+
+	hostname, err := os.Hostname()
+	require.NoError(t, err)
+
+	t.Run("enabled", func(t *testing.T) {
+		t.Parallel()
+		buf := new(bytes.Buffer)
+		var labels app.Labels
+		a := fx.New(
+			app.Module(app.Opts{ID: ulids.MustNew(), ReleaseID: ulids.MustNew(), LogWriter: buf, InstanceMetadata: true}),
+			fx.Invoke(func(logger app.Logger) {
+				logger("foo", zerolog.NoLevel)(nil, "bar")
+			}),
+			fx.Populate(&labels),
+		)
+		require.NoError(t, a.Err(), "app failed to initialize")
+		assert.Equal(t, hostname, labels()[appdesc.HostnameLabel])
+		assert.Contains(t, buf.String(), fmt.Sprintf("%q:%q", appdesc.HostnameLabel, hostname))
+	})
+
+	t.Run("disabled by default", func(t *testing.T) {
+		t.Parallel()
+		var labels app.Labels
+		var metadata appdesc.InstanceMetadata
+		a := fx.New(
+			app.Module(app.Opts{ID: ulids.MustNew(), ReleaseID: ulids.MustNew()}),
+			fx.Populate(&labels, &metadata),
+		)
+		require.NoError(t, a.Err(), "app failed to initialize")
+		assert.Equal(t, appdesc.InstanceMetadata{}, metadata)
+		assert.NotContains(t, labels(), appdesc.HostnameLabel)
+	})
+}
+
 func TestLogger(t *testing.T) {
 	t.Run("using defaults", func(t *testing.T) {
 		a := fx.New(
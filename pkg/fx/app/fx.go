@@ -18,7 +18,9 @@ package app
 
 import (
 	"fmt"
+	"github.com/blang/semver"
 	"github.com/oklog/ulid"
+	"github.com/oysterpack/andiamo/pkg/appdesc"
 	"github.com/oysterpack/andiamo/pkg/eventlog"
 	"github.com/rs/zerolog"
 	"go.uber.org/fx"
@@ -29,13 +31,14 @@ import (
 const (
 	// EnvPrefix is the standard env var name prefix.
 	// "APP12X" was chosen to represent 12-factor apps.
-	EnvPrefix = "APP12X"
+	EnvPrefix = appdesc.EnvPrefix
 )
 
 // Module returns the module's fx options
 func Module(opts Opts) fx.Option {
 	options := make([]fx.Option, 0, 2)
 	instanceID := opts.appInstanceID()
+	instanceMetadata := opts.instanceMetadata()
 	options = append(options, fx.Provide(
 		func() (ID, error) {
 			return opts.id()
@@ -46,6 +49,25 @@ func Module(opts Opts) fx.Option {
 		func() InstanceID {
 			return func() ulid.ULID { return instanceID }
 		},
+		func() (appdesc.Desc, error) {
+			return opts.desc()
+		},
+		func(desc appdesc.Desc) (Name, Version) {
+			return func() string { return desc.Name }, func() semver.Version { return desc.Version }
+		},
+		func() appdesc.InstanceMetadata {
+			return instanceMetadata
+		},
+		func(desc appdesc.Desc, instanceID InstanceID, instanceMetadata appdesc.InstanceMetadata) Labels {
+			return func() map[string]string {
+				labels := desc.Labels()
+				labels[InstanceIDLabel] = instanceID().String()
+				for label, value := range instanceMetadata.Labels() {
+					labels[label] = value
+				}
+				return labels
+			}
+		},
 		provideEventLogger(opts),
 	))
 	options = append(options, fx.Logger(fxPrinter(eventlog.NewLogger("fx", zeroLogger(opts), zerolog.NoLevel))))
@@ -58,12 +80,14 @@ func Module(opts Opts) fx.Option {
 //
 // 	 {"a":"01DG138TTVDX5JH5F4GMNC3V67","r":"01DG138TTVK4MVW3B5TJGDSKHR","x":"01DG138TTVYGSN7QWBFT9660SS","n":"foo","z":"01DG138TTVBHCXQW29QTQAWPNM","t":1563405085,"m":"bar"}
 const (
-	IDLabel         = "a"
-	ReleaseIDLabel  = "r"
+	IDLabel         = appdesc.IDLabel
+	NameLabel       = appdesc.NameLabel
+	VersionLabel    = appdesc.VersionLabel
+	ReleaseIDLabel  = appdesc.ReleaseIDLabel
 	InstanceIDLabel = "i"
 )
 
-func provideEventLogger(opts Opts) func(id ID, releaseID ReleaseID, instanceID InstanceID) (Logger, error) {
+func provideEventLogger(opts Opts) func(desc appdesc.Desc, instanceID InstanceID, instanceMetadata appdesc.InstanceMetadata) (Logger, error) {
 	setGlobalLogLevel := func(opts Opts) error {
 		level, err := opts.globalLogLevel()
 		if err != nil {
@@ -73,17 +97,14 @@ func provideEventLogger(opts Opts) func(id ID, releaseID ReleaseID, instanceID I
 		return nil
 	}
 
-	return func(id ID, releaseID ReleaseID, instanceID InstanceID) (Logger, error) {
+	return func(desc appdesc.Desc, instanceID InstanceID, instanceMetadata appdesc.InstanceMetadata) (Logger, error) {
 		if err := setGlobalLogLevel(opts); err != nil {
 			return nil, err
 		}
 
-		logger := eventlog.NewZeroLogger(opts.logWriter()).
-			With().
-			Str(IDLabel, ulid.ULID(id()).String()).
-			Str(ReleaseIDLabel, ulid.ULID(releaseID()).String()).
-			Str(InstanceIDLabel, ulid.ULID(instanceID()).String()).
-			Logger()
+		loggerContext := desc.WithLabels(eventlog.NewZeroLogger(opts.logWriter()).With()).
+			Str(InstanceIDLabel, ulid.ULID(instanceID()).String())
+		logger := instanceMetadata.WithLabels(loggerContext).Logger()
 
 		// use the logger as the go standard log output
 		log.SetFlags(0)
@@ -108,6 +129,13 @@ func zeroLogger(opts Opts) *zerolog.Logger {
 		loggerContext = loggerContext.Str(ReleaseIDLabel, releaseID().String())
 	}
 
+	if name := opts.name(); name != "" {
+		loggerContext = loggerContext.Str(NameLabel, name)
+		if version, err := opts.version(); err == nil {
+			loggerContext = loggerContext.Str(VersionLabel, version.String())
+		}
+	}
+
 	logger := loggerContext.Logger()
 	return &logger
 }
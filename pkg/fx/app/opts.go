@@ -18,7 +18,9 @@ package app
 
 import (
 	"fmt"
+	"github.com/blang/semver"
 	"github.com/oklog/ulid"
+	"github.com/oysterpack/andiamo/pkg/appdesc"
 	"github.com/oysterpack/andiamo/pkg/ulids"
 	"github.com/rs/zerolog"
 	"go.uber.org/multierr"
@@ -29,16 +31,20 @@ import (
 
 // Opts is used to configure the fx module
 type Opts struct {
-	// EnvPrefix is used to load the app ID and ReleaseID from env vars, using the following naming:
+	// EnvPrefix is used to load the app descriptor from env vars, using the following naming:
 	//
 	//	${EnvPrefix}_ID
 	//  ${EnvPrefix}_RELEASE_ID
+	//  ${EnvPrefix}_NAME - optional
+	//  ${EnvPrefix}_VERSION - optional, semver
 	//
 	// If blank, then the default value of "APP12X" will be used - defined by the `EnvPrefix` const
 	EnvPrefix string
 
 	ID        ulid.ULID // if set, then it will not be loaded from the env
 	ReleaseID ulid.ULID // if set, then it will not be loaded from the env
+	Name      string    // if set, then it will not be loaded from the env
+	Version   string    // semver, e.g., 1.2.3 - if set, then it will not be loaded from the env
 
 	LogWriter io.Writer // defaults to os.stderr
 	// GlobalLogLevel is used to get the global log level.
@@ -47,9 +53,25 @@ type Opts struct {
 	// If the env var is not set, then `zerolog.InfoLevel` is returned.
 	GlobalLogLevel *zerolog.Level // defaults to zerolog.Info
 
+	// InstanceMetadata enables enriching log events and the app Labels with the runtime environment metadata, i.e.,
+	// hostname, k8s pod/namespace/node, and cloud region/zone - see `appdesc.LoadInstanceMetadata()`.
+	//
+	// It is disabled by default in order to not pollute local runs.
+	InstanceMetadata bool
+
 	instanceID *ulid.ULID
 }
 
+// NewOpts constructs the module Opts from the app descriptor
+func NewOpts(desc appdesc.Desc) Opts {
+	return Opts{
+		ID:        desc.ID,
+		ReleaseID: desc.ReleaseID,
+		Name:      desc.Name,
+		Version:   desc.Version.String(),
+	}
+}
+
 func (o *Opts) id() (func() ulid.ULID, error) {
 	zero := ulid.ULID{}
 	if o.ID == zero {
@@ -74,6 +96,67 @@ func (o *Opts) releaseID() (func() ulid.ULID, error) {
 	return func() ulid.ULID { return o.ReleaseID }, nil
 }
 
+func (o *Opts) name() string {
+	if o.Name == "" {
+		return strings.TrimSpace(os.Getenv(key(o.EnvPrefix, "NAME")))
+	}
+	return o.Name
+}
+
+// If the version is not set, then the zero version is returned, i.e., 0.0.0
+func (o *Opts) version() (semver.Version, error) {
+	version := o.Version
+	if version == "" {
+		version = strings.TrimSpace(os.Getenv(key(o.EnvPrefix, "VERSION")))
+		if version == "" {
+			return semver.Version{}, nil
+		}
+	}
+	v, err := semver.Parse(version)
+	if err != nil {
+		return semver.Version{}, multierr.Append(fmt.Errorf("app version is not a valid semver: %q", version), err)
+	}
+	return v, nil
+}
+
+func (o *Opts) desc() (appdesc.Desc, error) {
+	id, err := o.id()
+	if err != nil {
+		return appdesc.Desc{}, err
+	}
+	releaseID, err := o.releaseID()
+	if err != nil {
+		return appdesc.Desc{}, err
+	}
+	version, err := o.version()
+	if err != nil {
+		return appdesc.Desc{}, err
+	}
+	return appdesc.Desc{
+		ID:        id(),
+		Name:      o.name(),
+		Version:   version,
+		ReleaseID: releaseID(),
+	}, nil
+}
+
+// Desc returns the app descriptor. The app ID, release ID, name, and version are loaded from the env if not set.
+func (o *Opts) Desc() (appdesc.Desc, error) {
+	return o.desc()
+}
+
+// LogLevel returns the global log level, which is loaded from the env if not set - see `GlobalLogLevel`
+func (o *Opts) LogLevel() (zerolog.Level, error) {
+	return o.globalLogLevel()
+}
+
+func (o *Opts) instanceMetadata() appdesc.InstanceMetadata {
+	if !o.InstanceMetadata {
+		return appdesc.InstanceMetadata{}
+	}
+	return appdesc.LoadInstanceMetadata(o.EnvPrefix)
+}
+
 func (o *Opts) globalLogLevel() (zerolog.Level, error) {
 	if o.GlobalLogLevel == nil {
 		levelStr, ok := os.LookupEnv(key(o.EnvPrefix, "LOG_LEVEL"))
@@ -0,0 +1,207 @@
+/*
+ * Copyright (c) 2019 OysterPack, Inc.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ * http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package consumer
+
+import (
+	"context"
+	"github.com/oysterpack/andiamo/pkg/fx/retry"
+	"sync"
+	"time"
+)
+
+// ChannelSource redelivery backoff defaults
+const (
+	DefaultRedeliveryDelay    = time.Second
+	DefaultMaxRedeliveryDelay = time.Minute
+)
+
+// ChannelSource is an in-process Source that receives messages from a channel, e.g., for in-process pipelines and tests.
+//
+// Requeued messages are redelivered after the redelivery backoff, which is doubled per delivery, i.e., messages that
+// keep failing are not redelivered in a hot loop - see `WithRedeliveryBackoff()`. Requeued messages that are due are
+// redelivered before new messages are received from the channel.
+//
+// The source is closed when the channel is closed and all delivered messages have been acked or rejected, i.e., messages
+// that are requeued while the in-flight messages are being drained are still redelivered. Rejected messages are sent to
+// the dead letter channel, if one is specified.
+type ChannelSource struct {
+	c           <-chan Message
+	deadLetters chan<- Message
+
+	redeliveryDelay, maxRedeliveryDelay time.Duration
+
+	mutex    sync.Mutex
+	closed   bool
+	requeued []requeuedMessage
+	// the number of messages that were delivered, but not yet acked or nacked
+	inFlight int
+	// signaled when a message is acked or nacked
+	signal chan struct{}
+}
+
+type requeuedMessage struct {
+	Message
+	due time.Time
+}
+
+// NewChannelSource constructs a new ChannelSource. The dead letter channel is optional.
+func NewChannelSource(c <-chan Message, deadLetters chan<- Message) *ChannelSource {
+	return &ChannelSource{
+		c:                  c,
+		deadLetters:        deadLetters,
+		redeliveryDelay:    DefaultRedeliveryDelay,
+		maxRedeliveryDelay: DefaultMaxRedeliveryDelay,
+		signal:             make(chan struct{}, 1),
+	}
+}
+
+// WithRedeliveryBackoff configures the delay before a requeued message is redelivered, which is doubled per delivery
+// up to the max delay. It must be configured before the source is used.
+func (s *ChannelSource) WithRedeliveryBackoff(delay, max time.Duration) *ChannelSource {
+	if max < delay {
+		max = delay
+	}
+	s.redeliveryDelay, s.maxRedeliveryDelay = delay, max
+	return s
+}
+
+// Receive implements the Source interface
+func (s *ChannelSource) Receive(ctx context.Context) (Message, error) {
+	for {
+		msg, ok, wait, closed := s.next()
+		if ok {
+			return msg, nil
+		}
+		if closed {
+			return Message{}, ErrSourceClosed
+		}
+
+		msg, ok, err := s.wait(ctx, wait)
+		if ok || err != nil {
+			return msg, err
+		}
+	}
+}
+
+// wait waits for a message to be received from the channel, a message to be acked or nacked, or the next requeued
+// message to be due
+func (s *ChannelSource) wait(ctx context.Context, requeuedDue time.Duration) (Message, bool, error) {
+	var timer <-chan time.Time
+	if requeuedDue > 0 {
+		t := time.NewTimer(requeuedDue)
+		defer t.Stop()
+		timer = t.C
+	}
+	c := s.c
+	if s.isClosed() {
+		c = nil
+	}
+	select {
+	case <-ctx.Done():
+		return Message{}, false, ctx.Err()
+	case <-s.signal:
+	case <-timer:
+	case msg, ok := <-c:
+		if ok {
+			return s.delivered(msg), true, nil
+		}
+		s.mutex.Lock()
+		s.closed = true
+		s.mutex.Unlock()
+	}
+	return Message{}, false, nil
+}
+
+func (s *ChannelSource) isClosed() bool {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	return s.closed
+}
+
+// next returns the next requeued message that is due. Otherwise, it returns how long to wait until the next requeued
+// message is due (0 means there are no requeued messages), and whether the source is closed.
+func (s *ChannelSource) next() (msg Message, ok bool, wait time.Duration, closed bool) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	now := time.Now()
+	for i, requeued := range s.requeued {
+		if !requeued.due.After(now) {
+			s.requeued = append(s.requeued[:i], s.requeued[i+1:]...)
+			requeued.Deliveries++
+			s.inFlight++
+			return requeued.Message, true, 0, false
+		}
+		if until := requeued.due.Sub(now); wait == 0 || until < wait {
+			wait = until
+		}
+	}
+	return Message{}, false, wait, s.closed && len(s.requeued) == 0 && s.inFlight == 0
+}
+
+func (s *ChannelSource) delivered(msg Message) Message {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	msg.Deliveries++
+	s.inFlight++
+	return msg
+}
+
+// completed is called when a message is acked or nacked
+func (s *ChannelSource) completed(requeued *requeuedMessage) {
+	s.mutex.Lock()
+	s.inFlight--
+	if requeued != nil {
+		s.requeued = append(s.requeued, *requeued)
+	}
+	s.mutex.Unlock()
+	select {
+	case s.signal <- struct{}{}:
+	default:
+	}
+}
+
+func (s *ChannelSource) backoff(deliveries int) time.Duration {
+	// a zero delay redelivers immediately, i.e., the retry backoff defaults do not apply
+	if s.redeliveryDelay == 0 {
+		return 0
+	}
+	return retry.Opts{InitialBackoff: s.redeliveryDelay, MaxBackoff: s.maxRedeliveryDelay, Multiplier: 2}.Backoff(deliveries)
+}
+
+// Ack implements the Source interface
+func (s *ChannelSource) Ack(ctx context.Context, msg Message) error {
+	s.completed(nil)
+	return nil
+}
+
+// Nack implements the Source interface
+func (s *ChannelSource) Nack(ctx context.Context, msg Message, requeue bool) error {
+	if requeue {
+		s.completed(&requeuedMessage{Message: msg, due: time.Now().Add(s.backoff(msg.Deliveries))})
+		return nil
+	}
+	defer s.completed(nil)
+	if s.deadLetters == nil {
+		return nil
+	}
+	select {
+	case s.deadLetters <- msg:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
@@ -0,0 +1,155 @@
+/*
+ * Copyright (c) 2019 OysterPack, Inc.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ * http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package consumer
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"github.com/oysterpack/andiamo/pkg/ulids"
+	"go.uber.org/fx"
+	"strings"
+)
+
+// ErrSourceClosed is returned by `Source.Receive()` when the source is closed, i.e., no more messages will be received.
+// The consumer stops when its source is closed.
+var ErrSourceClosed = errors.New("consumer source is closed")
+
+// ErrInvalidConsumer indicates the consumer is invalid
+var ErrInvalidConsumer = errors.New("consumer is invalid")
+
+// Message is a message that is received from a `Source`
+type Message struct {
+	// ID is the source message ID, e.g., the SQS message ID or the Kafka topic/partition/offset
+	ID string
+	// Partition is the source partition that the message was received from, e.g., the Kafka topic partition - blank if
+	// the source is not partitioned. It is used to drain the in-flight messages when partitions are revoked.
+	Partition string
+	// Key is optional, e.g., the Kafka message key
+	Key     string
+	Payload []byte
+	Headers map[string]string
+	// Deliveries is the number of times the message was delivered, if the source tracks it, e.g., SQS ApproximateReceiveCount
+	Deliveries int
+	// Raw is the source specific message, which the source uses to ack or nack the message
+	Raw interface{}
+}
+
+// Source is used to receive messages, e.g., a Kafka, NATS, or SQS client adapter. Ack and Nack may be called concurrently.
+type Source interface {
+	// Receive blocks until the next message is received or the context is canceled. `ErrSourceClosed` is returned when
+	// the source is closed.
+	Receive(ctx context.Context) (Message, error)
+	// Ack acknowledges that the message was handled, e.g., the Kafka offset is committed or the SQS message is deleted
+	Ack(ctx context.Context, msg Message) error
+	// Nack negatively acknowledges the message. If requeue is true, then the message is redelivered, e.g., the SQS
+	// visibility timeout is reset. Otherwise, the message is not redelivered, e.g., it is dead-lettered.
+	Nack(ctx context.Context, msg Message, requeue bool) error
+}
+
+// Rebalancer is optionally implemented by partitioned sources whose partition assignments change at runtime, e.g.,
+// Kafka consumer groups. When partitions are revoked, the consumer waits for the in-flight messages for the revoked
+// partitions to be handled, and then calls `Revocation.Done()`, i.e., the source can then commit and hand over the
+// partitions. The source must not deliver messages for the revoked partitions after they are revoked.
+type Rebalancer interface {
+	Revocations() <-chan Revocation
+}
+
+// Revocation is sent by a `Rebalancer` when partitions are revoked
+type Revocation struct {
+	Partitions []string
+	// Done is called after the in-flight messages for the revoked partitions are drained, or the drain timed out
+	Done func()
+}
+
+// Handler handles messages. If the handler returns nil, then the message is acked. If the handler returns an error, then
+// the message is nacked and redelivered, unless the error is wrapped via `Reject()`. Handler panics are recovered, and
+// the message is rejected, i.e., poison messages are not redelivered.
+type Handler interface {
+	Handle(ctx context.Context, msg Message) error
+}
+
+// HandlerFunc is a function that implements the Handler interface
+type HandlerFunc func(ctx context.Context, msg Message) error
+
+// Handle implements the Handler interface
+func (f HandlerFunc) Handle(ctx context.Context, msg Message) error {
+	return f(ctx, msg)
+}
+
+// Reject wraps the error to signal that the message must not be redelivered, e.g., the message is malformed
+func Reject(err error) error {
+	if err == nil {
+		return nil
+	}
+	return rejected{err}
+}
+
+type rejected struct {
+	error
+}
+
+func isRejected(err error) bool {
+	_, ok := err.(rejected)
+	return ok
+}
+
+// Consumer consumes messages from its source
+type Consumer struct {
+	// Name is used to label the consumer metrics and events, and must be unique per app, e.g., "orders"
+	Name    string
+	Source  Source
+	Handler Handler
+	// Concurrency is the max number of messages that are handled concurrently - defaults to `Opts.Concurrency`
+	Concurrency int
+	// HealthCheckID is optional. If specified, then a health check is registered for the consumer, which is Red if the
+	// source is failing, and Yellow if the last message failed to be handled. The format is ULID.
+	HealthCheckID string
+}
+
+func (c Consumer) validate() error {
+	if strings.TrimSpace(c.Name) == "" {
+		return fmt.Errorf("%s : `Name` must not be blank", ErrInvalidConsumer)
+	}
+	if c.Source == nil {
+		return fmt.Errorf("%s : %s : `Source` must not be nil", ErrInvalidConsumer, c.Name)
+	}
+	if c.Handler == nil {
+		return fmt.Errorf("%s : %s : `Handler` must not be nil", ErrInvalidConsumer, c.Name)
+	}
+	if c.Concurrency < 0 {
+		return fmt.Errorf("%s : %s : `Concurrency` must not be negative", ErrInvalidConsumer, c.Name)
+	}
+	if c.HealthCheckID != "" {
+		if _, err := ulids.Parse(c.HealthCheckID); err != nil {
+			return fmt.Errorf("%s : %s : `HealthCheckID` must be a ULID : %s", ErrInvalidConsumer, c.Name, err)
+		}
+	}
+	return nil
+}
+
+// Registration is used to provide consumers via dependency injection
+type Registration struct {
+	fx.Out
+
+	Consumer `group:"consumer.Consumer"`
+}
+
+// NewRegistration constructs a new Registration for the consumer
+func NewRegistration(consumer Consumer) Registration {
+	return Registration{Consumer: consumer}
+}
@@ -0,0 +1,330 @@
+/*
+ * Copyright (c) 2019 OysterPack, Inc.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ * http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package consumer
+
+import (
+	"context"
+	"fmt"
+	"github.com/oysterpack/andiamo/pkg/eventlog"
+	"github.com/oysterpack/andiamo/pkg/fx/health"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/rs/zerolog"
+	"go.uber.org/multierr"
+	"sync"
+	"time"
+)
+
+// metric IDs, which are used as the prometheus metric names
+const (
+	// counter - the number of handled messages, labeled by consumer and outcome
+	MessagesMetricID = "U01DJX9TCWJX09VYF8PZGRXYYHH"
+	// histogram - the message handling duration in seconds, labeled by consumer
+	HandleDurationMetricID = "U01DK15DFCJSKGCXH8V78A26BR7"
+	// gauge - the number of in-flight messages, labeled by consumer
+	InFlightMetricID = "U01DK510HWJDCH3XHXG8315RJKM"
+	// counter - the number of source failures, labeled by consumer and stage
+	SourceFailuresMetricID = "U01DJSE7ACJ1SP9CDV1H3A2NNAW"
+
+	ConsumerLabel = "consumer"
+	OutcomeLabel  = "outcome"
+	StageLabel    = "stage"
+)
+
+// HealthCheckTag is used to tag the consumer health checks
+const HealthCheckTag = "01DJX9TCWJ2WJNYP1XD097SFRW"
+
+// DetailInFlight is the health check result detail key for the number of in-flight messages
+const DetailInFlight = "in_flight"
+
+type metrics struct {
+	messages       *prometheus.CounterVec
+	duration       *prometheus.HistogramVec
+	inFlight       *prometheus.GaugeVec
+	sourceFailures *prometheus.CounterVec
+}
+
+func newMetrics() *metrics {
+	return &metrics{
+		messages: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Name: MessagesMetricID,
+			Help: "number of messages that were handled by the consumer",
+		}, []string{ConsumerLabel, OutcomeLabel}),
+		duration: prometheus.NewHistogramVec(prometheus.HistogramOpts{
+			Name: HandleDurationMetricID,
+			Help: "consumer message handling duration in seconds",
+		}, []string{ConsumerLabel}),
+		inFlight: prometheus.NewGaugeVec(prometheus.GaugeOpts{
+			Name: InFlightMetricID,
+			Help: "number of messages that are being handled by the consumer",
+		}, []string{ConsumerLabel}),
+		sourceFailures: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Name: SourceFailuresMetricID,
+			Help: "number of consumer source failures",
+		}, []string{ConsumerLabel, StageLabel}),
+	}
+}
+
+func (m *metrics) register(registerer prometheus.Registerer) error {
+	return multierr.Combine(
+		registerer.Register(m.messages),
+		registerer.Register(m.duration),
+		registerer.Register(m.inFlight),
+		registerer.Register(m.sourceFailures),
+	)
+}
+
+type consumer struct {
+	Consumer
+	opts    Opts
+	metrics *metrics
+
+	logHandleFailed     eventlog.Logger
+	logSourceFailed     eventlog.Logger
+	logRebalanced       eventlog.Logger
+	logRebalanceTimeout eventlog.Logger
+
+	mutex sync.Mutex
+	// signaled when in-flight messages are completed
+	completedCond *sync.Cond
+	// the number of in-flight messages per partition
+	inFlight   map[string]int
+	receiveErr error
+	handleErr  error
+}
+
+func newConsumer(c Consumer, opts Opts, m *metrics, logger *zerolog.Logger) *consumer {
+	if c.Concurrency == 0 {
+		c.Concurrency = opts.Concurrency
+	}
+	consumer := &consumer{
+		Consumer:            c,
+		opts:                opts,
+		metrics:             m,
+		logHandleFailed:     eventlog.NewLogger(HandleFailedEvent, logger, zerolog.WarnLevel),
+		logSourceFailed:     eventlog.NewLogger(SourceFailedEvent, logger, zerolog.WarnLevel),
+		logRebalanced:       eventlog.NewLogger(RebalanceEvent, logger, zerolog.InfoLevel),
+		logRebalanceTimeout: eventlog.NewLogger(RebalanceEvent, logger, zerolog.WarnLevel),
+		inFlight:            make(map[string]int),
+	}
+	consumer.completedCond = sync.NewCond(&consumer.mutex)
+	return consumer
+}
+
+func (c *consumer) registerHealthCheck(register health.Register) error {
+	if c.HealthCheckID == "" {
+		return nil
+	}
+	return register(health.Check{
+		ID:           c.HealthCheckID,
+		Description:  fmt.Sprintf("%s consumer", c.Name),
+		YellowImpact: "messages are failing to be handled, i.e., they are being redelivered or rejected",
+		RedImpact:    "messages are not being received",
+		Tags:         []string{HealthCheckTag},
+	}, health.CheckerOpts{}, func(ctx context.Context) (health.Status, error) {
+		c.mutex.Lock()
+		defer c.mutex.Unlock()
+		health.SetDetail(ctx, DetailInFlight, c.inFlightCount(nil))
+		switch {
+		case c.receiveErr != nil:
+			return health.Red, c.receiveErr
+		case c.handleErr != nil:
+			return health.Yellow, c.handleErr
+		default:
+			return health.Green, nil
+		}
+	})
+}
+
+// inFlightCount returns the number of in-flight messages for the partitions - nil means all partitions.
+//
+// NOTE: the mutex must be held by the caller
+func (c *consumer) inFlightCount(partitions []string) int {
+	var count int
+	if partitions == nil {
+		for _, n := range c.inFlight {
+			count += n
+		}
+		return count
+	}
+	for _, partition := range partitions {
+		count += c.inFlight[partition]
+	}
+	return count
+}
+
+func (c *consumer) sourceFailed(ctx context.Context, stage, msg string, err error) {
+	if ctx.Err() != nil {
+		// the consumer is stopping
+		return
+	}
+	c.metrics.sourceFailures.WithLabelValues(c.Name, stage).Inc()
+	c.logSourceFailed(sourceFailed{consumer: c.Name, stage: stage, msg: msg, err: err}, "consumer source failed")
+}
+
+func (c *consumer) setReceiveErr(err error) {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	c.receiveErr = err
+}
+
+func (c *consumer) dispatched(msg Message) {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	c.inFlight[msg.Partition]++
+	c.metrics.inFlight.WithLabelValues(c.Name).Inc()
+}
+
+func (c *consumer) completed(msg Message, err error) {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	if c.inFlight[msg.Partition]--; c.inFlight[msg.Partition] == 0 {
+		delete(c.inFlight, msg.Partition)
+	}
+	c.handleErr = err
+	c.metrics.inFlight.WithLabelValues(c.Name).Dec()
+	c.completedCond.Broadcast()
+}
+
+// run receives messages until the receive context is canceled or the source is closed, and then waits for the in-flight
+// messages to be handled. Messages are handled using the handle context, which is canceled when the drain times out.
+func (c *consumer) run(ctx, handleCtx context.Context) {
+	var wg sync.WaitGroup
+	defer wg.Wait()
+
+	if rebalancer, ok := c.Source.(Rebalancer); ok {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for {
+				select {
+				case <-ctx.Done():
+					return
+				case revocation, ok := <-rebalancer.Revocations():
+					if !ok {
+						return
+					}
+					c.rebalance(revocation)
+				}
+			}
+		}()
+	}
+
+	// a slot is acquired before receiving a message, i.e., messages are not received until they can be handled
+	slots := make(chan struct{}, c.Concurrency)
+	for {
+		select {
+		case slots <- struct{}{}:
+		case <-ctx.Done():
+			return
+		}
+		msg, err := c.Source.Receive(ctx)
+		if err != nil {
+			<-slots
+			if ctx.Err() != nil || err == ErrSourceClosed {
+				return
+			}
+			c.setReceiveErr(err)
+			c.sourceFailed(ctx, ReceiveStage, "", err)
+			timer := time.NewTimer(c.opts.ReceiveBackoff)
+			select {
+			case <-ctx.Done():
+				timer.Stop()
+				return
+			case <-timer.C:
+			}
+			continue
+		}
+		c.setReceiveErr(nil)
+		c.dispatched(msg)
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			defer func() { <-slots }()
+			c.handle(handleCtx, msg)
+		}()
+	}
+}
+
+// handle handles the message, and then acks or nacks the message based on the outcome
+func (c *consumer) handle(ctx context.Context, msg Message) {
+	start := time.Now()
+	outcome, err := c.invokeHandler(ctx, msg)
+	c.metrics.duration.WithLabelValues(c.Name).Observe(time.Since(start).Seconds())
+
+	if outcome == AckOutcome {
+		if ackErr := c.Source.Ack(ctx, msg); ackErr != nil {
+			c.sourceFailed(ctx, AckStage, msg.ID, ackErr)
+		}
+	} else {
+		c.logHandleFailed(handleFailed{consumer: c.Name, msg: msg, outcome: outcome, err: err}, "consumer failed to handle message")
+		if nackErr := c.Source.Nack(ctx, msg, outcome == NackOutcome); nackErr != nil {
+			c.sourceFailed(ctx, NackStage, msg.ID, nackErr)
+		}
+	}
+	c.metrics.messages.WithLabelValues(c.Name, outcome).Inc()
+	c.completed(msg, err)
+}
+
+// invokeHandler recovers handler panics
+func (c *consumer) invokeHandler(ctx context.Context, msg Message) (outcome string, err error) {
+	defer func() {
+		if p := recover(); p != nil {
+			outcome, err = PanicOutcome, fmt.Errorf("consumer handler panicked : %v", p)
+		}
+	}()
+	switch err = c.Handler.Handle(ctx, msg); {
+	case err == nil:
+		return AckOutcome, nil
+	case isRejected(err):
+		return RejectOutcome, err
+	default:
+		return NackOutcome, err
+	}
+}
+
+// rebalance waits for the in-flight messages for the revoked partitions to be handled, and then hands over the partitions
+func (c *consumer) rebalance(revocation Revocation) {
+	start := time.Now()
+	drained := make(chan struct{})
+	go func() {
+		// if the drain times out, then this goroutine exits once the in-flight messages are handled
+		c.mutex.Lock()
+		for c.inFlightCount(revocation.Partitions) > 0 {
+			c.completedCond.Wait()
+		}
+		c.mutex.Unlock()
+		close(drained)
+	}()
+
+	event := rebalanced{consumer: c.Name, partitions: revocation.Partitions, outcome: drainedOutcome}
+	timer := time.NewTimer(c.opts.RebalanceTimeout)
+	select {
+	case <-drained:
+		timer.Stop()
+	case <-timer.C:
+		event.outcome = timeoutOutcome
+	}
+	if revocation.Done != nil {
+		revocation.Done()
+	}
+	event.duration = time.Since(start)
+	if event.outcome == timeoutOutcome {
+		c.logRebalanceTimeout(event, "consumer rebalance timed out")
+		return
+	}
+	c.logRebalanced(event, "consumer rebalanced")
+}
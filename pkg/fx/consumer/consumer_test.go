@@ -0,0 +1,360 @@
+/*
+ * Copyright (c) 2019 OysterPack, Inc.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ * http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package consumer_test
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"github.com/oysterpack/andiamo/pkg/fx/consumer"
+	"github.com/oysterpack/andiamo/pkg/fx/health"
+	"github.com/oysterpack/andiamo/pkg/fxapp"
+	"github.com/oysterpack/andiamo/pkg/fxapptest"
+	"github.com/oysterpack/andiamo/pkg/ulids"
+	"github.com/prometheus/client_golang/prometheus"
+	dto "github.com/prometheus/client_model/go"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"sync"
+	"testing"
+	"time"
+)
+
+const healthCheckID = "01DJNJM7WJCK23KQY6HFSF27JM"
+
+// newBuilder returns an app builder with the queue consumers enabled
+func newBuilder(opts consumer.Opts, logs *fxapptest.LogCapture, consumers ...consumer.Consumer) fxapp.Builder {
+	builder := fxapp.NewBuilder(fxapp.ID(ulids.MustNew()), fxapp.ReleaseID(ulids.MustNew())).
+		Invoke(func() {}).
+		EnableQueueConsumers(opts).
+		LogWriter(logs)
+	for _, c := range consumers {
+		c := c
+		builder = builder.Provide(func() consumer.Registration { return consumer.NewRegistration(c) })
+	}
+	return builder
+}
+
+// counter returns the counter value for the outcome, summed across all other label values
+func counter(t *testing.T, gatherer prometheus.Gatherer, metricID, outcome string) float64 {
+	mfs, err := gatherer.Gather()
+	require.NoError(t, err)
+	var total float64
+	for _, mf := range fxapp.FindMetricFamilies(mfs, func(mf *dto.MetricFamily) bool { return mf.GetName() == metricID }) {
+		for _, m := range mf.Metric {
+			for _, label := range m.Label {
+				if label.GetName() == consumer.OutcomeLabel && label.GetValue() == outcome {
+					total += m.GetCounter().GetValue()
+				}
+			}
+		}
+	}
+	return total
+}
+
+func waitFor(t *testing.T, condition func() bool) {
+	t.Helper()
+	timeout := time.After(5 * time.Second)
+	for !condition() {
+		select {
+		case <-timeout:
+			t.Fatal("*** timed out")
+		case <-time.After(5 * time.Millisecond):
+		}
+	}
+}
+
+type recordingHandler struct {
+	mutex sync.Mutex
+	msgs  []string
+	// messages with these IDs fail to be handled the first time
+	failOnce map[string]bool
+}
+
+func (h *recordingHandler) Handle(ctx context.Context, msg consumer.Message) error {
+	h.mutex.Lock()
+	defer h.mutex.Unlock()
+	switch msg.ID {
+	case "poison":
+		panic("poison message")
+	case "malformed":
+		return consumer.Reject(errors.New("malformed message"))
+	}
+	if h.failOnce[msg.ID] {
+		delete(h.failOnce, msg.ID)
+		return errors.New("database is unavailable")
+	}
+	h.msgs = append(h.msgs, fmt.Sprintf("%s:%d", msg.ID, msg.Deliveries))
+	return nil
+}
+
+func (h *recordingHandler) handled() []string {
+	h.mutex.Lock()
+	defer h.mutex.Unlock()
+	return append([]string(nil), h.msgs...)
+}
+
+func TestModule(t *testing.T) {
+	t.Parallel()
+
+	msgs := make(chan consumer.Message, 10)
+	deadLetters := make(chan consumer.Message, 10)
+	handler := &recordingHandler{failOnce: map[string]bool{"2": true}}
+	logs := fxapptest.NewLogCapture()
+	var gatherer prometheus.Gatherer
+	var runCheckNow health.RunCheckNow
+	builder := newBuilder(consumer.Opts{}, logs, consumer.Consumer{
+		Name:          "orders",
+		Source:        consumer.NewChannelSource(msgs, deadLetters).WithRedeliveryBackoff(time.Millisecond, time.Millisecond),
+		Handler:       handler,
+		HealthCheckID: healthCheckID,
+	}).Populate(&gatherer, &runCheckNow)
+	fxapptest.RunApp(t, builder, func(fxapp.App, *fxapptest.HTTPClient) {
+		for _, id := range []string{"1", "2", "malformed", "poison", "3"} {
+			msgs <- consumer.Message{ID: id}
+		}
+		waitFor(t, func() bool { return len(handler.handled()) == 3 })
+		// the failed message is redelivered
+		assert.ElementsMatch(t, []string{"1:1", "2:2", "3:1"}, handler.handled())
+		// rejected and panicking messages are dead-lettered
+		assert.Equal(t, "malformed", (<-deadLetters).ID)
+		assert.Equal(t, "poison", (<-deadLetters).ID)
+
+		assert.Equal(t, float64(3), counter(t, gatherer, consumer.MessagesMetricID, consumer.AckOutcome))
+		assert.Equal(t, float64(1), counter(t, gatherer, consumer.MessagesMetricID, consumer.NackOutcome))
+		assert.Equal(t, float64(1), counter(t, gatherer, consumer.MessagesMetricID, consumer.RejectOutcome))
+		assert.Equal(t, float64(1), counter(t, gatherer, consumer.MessagesMetricID, consumer.PanicOutcome))
+		for msg, outcome := range map[string]string{"2": consumer.NackOutcome, "malformed": consumer.RejectOutcome, "poison": consumer.PanicOutcome} {
+			fxapptest.AssertEventLogged(t, logs, consumer.HandleFailedEvent, fxapptest.Field("d.msg", msg), fxapptest.Field("d.outcome", outcome))
+		}
+
+		result, err := runCheckNow(healthCheckID)
+		require.NoError(t, err)
+		assert.NoError(t, result.Err)
+		assert.Equal(t, health.Green, result.Status)
+	})
+}
+
+func TestModule_RequeuedMessagesAreRedeliveredAfterSourceIsClosed(t *testing.T) {
+	t.Parallel()
+
+	msgs := make(chan consumer.Message, 10)
+	handler := &recordingHandler{failOnce: map[string]bool{"1": true}}
+	builder := newBuilder(consumer.Opts{}, fxapptest.NewLogCapture(), consumer.Consumer{
+		Name:    "orders",
+		Source:  consumer.NewChannelSource(msgs, nil).WithRedeliveryBackoff(10*time.Millisecond, time.Second),
+		Handler: handler,
+	})
+	fxapptest.RunApp(t, builder, func(fxapp.App, *fxapptest.HTTPClient) {
+		msgs <- consumer.Message{ID: "1"}
+		close(msgs)
+		waitFor(t, func() bool { return len(handler.handled()) == 1 })
+		assert.Equal(t, []string{"1:2"}, handler.handled())
+	})
+}
+
+func TestChannelSource(t *testing.T) {
+	t.Parallel()
+
+	msgs := make(chan consumer.Message, 1)
+	source := consumer.NewChannelSource(msgs, nil).WithRedeliveryBackoff(20*time.Millisecond, 40*time.Millisecond)
+	ctx := context.Background()
+
+	msgs <- consumer.Message{ID: "1"}
+	close(msgs)
+	msg, err := source.Receive(ctx)
+	require.NoError(t, err)
+	assert.Equal(t, 1, msg.Deliveries)
+
+	t.Run("requeued messages are redelivered after the redelivery backoff", func(t *testing.T) {
+		for _, delay := range []time.Duration{20 * time.Millisecond, 40 * time.Millisecond, 40 * time.Millisecond} {
+			require.NoError(t, source.Nack(ctx, msg, true))
+			start := time.Now()
+			deliveries := msg.Deliveries
+			msg, err = source.Receive(ctx)
+			require.NoError(t, err)
+			assert.Equal(t, deliveries+1, msg.Deliveries)
+			assert.True(t, time.Since(start) >= delay, "delivery %d was redelivered after %s", msg.Deliveries, time.Since(start))
+		}
+	})
+
+	t.Run("source is closed after the in-flight messages are acked", func(t *testing.T) {
+		received := make(chan error, 1)
+		go func() {
+			_, err := source.Receive(ctx)
+			received <- err
+		}()
+		select {
+		case err := <-received:
+			t.Fatalf("*** the source should not be closed while messages are in flight: %v", err)
+		case <-time.After(50 * time.Millisecond):
+		}
+		require.NoError(t, source.Ack(ctx, msg))
+		select {
+		case err := <-received:
+			assert.Equal(t, consumer.ErrSourceClosed, err)
+		case <-time.After(5 * time.Second):
+			t.Fatal("*** timed out waiting for the source to be closed")
+		}
+	})
+}
+
+func TestModule_InvalidConsumers(t *testing.T) {
+	t.Parallel()
+
+	source := consumer.NewChannelSource(make(chan consumer.Message), nil)
+	handler := &recordingHandler{}
+	_, err := newBuilder(consumer.Opts{}, fxapptest.NewLogCapture(),
+		consumer.Consumer{Name: "orders", Source: source, Handler: handler},
+		consumer.Consumer{Name: "orders", Source: source, Handler: handler},
+		consumer.Consumer{Name: "payments", Handler: handler},
+	).Build()
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), consumer.ErrInvalidConsumer.Error())
+	assert.Contains(t, err.Error(), "orders")
+	assert.Contains(t, err.Error(), "payments")
+}
+
+// blockingHandler blocks until it is released
+type blockingHandler struct {
+	started chan consumer.Message
+	release chan struct{}
+}
+
+func newBlockingHandler() *blockingHandler {
+	return &blockingHandler{started: make(chan consumer.Message, 10), release: make(chan struct{})}
+}
+
+func (h *blockingHandler) Handle(ctx context.Context, msg consumer.Message) error {
+	h.started <- msg
+	select {
+	case <-h.release:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+func TestModule_ShutdownDrainsInFlightMessages(t *testing.T) {
+	t.Parallel()
+
+	msgs := make(chan consumer.Message, 10)
+	handler := newBlockingHandler()
+	var gatherer prometheus.Gatherer
+	builder := newBuilder(consumer.Opts{Concurrency: 2}, fxapptest.NewLogCapture(), consumer.Consumer{
+		Name:    "orders",
+		Source:  consumer.NewChannelSource(msgs, nil),
+		Handler: handler,
+	}).Populate(&gatherer)
+	fxapptest.RunApp(t, builder, func(app fxapp.App, _ *fxapptest.HTTPClient) {
+		msgs <- consumer.Message{ID: "1"}
+		msgs <- consumer.Message{ID: "2"}
+		<-handler.started
+		<-handler.started
+
+		require.NoError(t, app.Shutdown())
+		select {
+		case <-app.Done():
+			t.Fatal("*** the app stopped before the in-flight messages were drained")
+		case <-time.After(50 * time.Millisecond):
+		}
+		close(handler.release)
+		<-app.Done()
+		assert.Equal(t, float64(2), counter(t, gatherer, consumer.MessagesMetricID, consumer.AckOutcome))
+	})
+}
+
+func TestModule_ShutdownDrainTimeout(t *testing.T) {
+	t.Parallel()
+
+	msgs := make(chan consumer.Message, 10)
+	handler := newBlockingHandler()
+	var gatherer prometheus.Gatherer
+	// the app is run directly, instead of via fxapptest.RunApp, because the app fails to stop cleanly
+	app, err := newBuilder(consumer.Opts{}, fxapptest.NewLogCapture(), consumer.Consumer{
+		Name:    "orders",
+		Source:  consumer.NewChannelSource(msgs, nil),
+		Handler: handler,
+	}).
+		SetStopTimeout(50 * time.Millisecond).
+		DisableHTTPServer().
+		Populate(&gatherer).
+		Build()
+	require.NoError(t, err)
+	runErr := make(chan error, 1)
+	go func() { runErr <- app.Run() }()
+	<-app.Ready()
+
+	msgs <- consumer.Message{ID: "1"}
+	<-handler.started
+	require.NoError(t, app.Shutdown())
+	assert.Error(t, <-runErr)
+	// the handler context is canceled, and the message is nacked
+	waitFor(t, func() bool { return counter(t, gatherer, consumer.MessagesMetricID, consumer.NackOutcome) == 1 })
+}
+
+type rebalancingSource struct {
+	*consumer.ChannelSource
+	revocations chan consumer.Revocation
+}
+
+func (s *rebalancingSource) Revocations() <-chan consumer.Revocation {
+	return s.revocations
+}
+
+func TestModule_Rebalance(t *testing.T) {
+	t.Parallel()
+
+	msgs := make(chan consumer.Message, 10)
+	source := &rebalancingSource{
+		ChannelSource: consumer.NewChannelSource(msgs, nil),
+		revocations:   make(chan consumer.Revocation),
+	}
+	handler := newBlockingHandler()
+	logs := fxapptest.NewLogCapture()
+	builder := newBuilder(consumer.Opts{Concurrency: 2, RebalanceTimeout: 50 * time.Millisecond}, logs, consumer.Consumer{
+		Name:    "orders",
+		Source:  source,
+		Handler: handler,
+	})
+	fxapptest.RunApp(t, builder, func(fxapp.App, *fxapptest.HTTPClient) {
+		defer close(handler.release)
+
+		msgs <- consumer.Message{ID: "1", Partition: "orders-0"}
+		msgs <- consumer.Message{ID: "2", Partition: "orders-1"}
+		<-handler.started
+		<-handler.started
+
+		// partitions without in-flight messages are handed over immediately
+		done := make(chan struct{})
+		source.revocations <- consumer.Revocation{Partitions: []string{"orders-2"}, Done: func() { close(done) }}
+		select {
+		case <-done:
+		case <-time.After(40 * time.Millisecond):
+			t.Fatal("*** the partition should have been handed over immediately")
+		}
+
+		// partitions with in-flight messages are handed over after the rebalance timeout
+		start := time.Now()
+		done = make(chan struct{})
+		source.revocations <- consumer.Revocation{Partitions: []string{"orders-0"}, Done: func() { close(done) }}
+		<-done
+		assert.True(t, time.Since(start) >= 50*time.Millisecond)
+		_, err := logs.WaitForEvent(consumer.RebalanceEvent, 5*time.Second, fxapptest.Field("d.partitions", []string{"orders-0"}), fxapptest.Field("d.outcome", "timeout"))
+		assert.NoError(t, err)
+	})
+}
@@ -0,0 +1,33 @@
+/*
+ * Copyright (c) 2019 OysterPack, Inc.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ * http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+// Package consumer provides an optional fx module that runs queue consumers, i.e., the consumer loop is implemented once
+// and business code only implements a `Handler`.
+//
+// Messages are received from a pluggable `Source`, e.g., a Kafka, NATS, or SQS client adapter, or an in-process
+// `ChannelSource`. The consumer loop provides:
+//   - concurrency, i.e., up to N messages are handled concurrently per consumer
+//   - per message panic recovery, i.e., a panicking handler does not take the app down
+//   - ack/nack semantics, i.e., handled messages are acked, failed messages are nacked and redelivered, and rejected
+//     messages are nacked without being redelivered, e.g., they are dead-lettered - see `Reject()`
+//   - shutdown draining, i.e., when the app is stopped, the consumer stops receiving messages, and waits for the in-flight
+//     messages to be handled within the app stop timeout
+//   - graceful rebalancing, i.e., when the source revokes partitions, the in-flight messages for the revoked partitions
+//     are drained before the partitions are handed over - see `Rebalancer`
+//
+// Consumers are provided via dependency injection - see `NewRegistration()`. Each consumer records metrics labeled with
+// the consumer name, and optionally registers a health check - see `Consumer.HealthCheckID`.
+package consumer
@@ -0,0 +1,128 @@
+/*
+ * Copyright (c) 2019 OysterPack, Inc.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ * http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package consumer
+
+import (
+	"github.com/rs/zerolog"
+	"time"
+)
+
+// consumer module events
+const (
+	// HandleFailedEvent is logged when a message fails to be handled, i.e., the handler returned an error or panicked
+	//
+	//	type Data struct {
+	//		Consumer  string `json:"consumer"`
+	//		Msg       string `json:"msg"`
+	//		Partition string `json:"partition"`
+	//		// one of: nack, reject, panic
+	//		Outcome   string `json:"outcome"`
+	//		Err       string `json:"e"`
+	//	}
+	HandleFailedEvent = "01DJX9TCWJFTA306MCXENQEZD1"
+
+	// SourceFailedEvent is logged when the source fails to receive, ack, or nack a message. Receive failures are retried
+	// after the receive backoff - see `Opts.ReceiveBackoff`.
+	//
+	//	type Data struct {
+	//		Consumer string `json:"consumer"`
+	//		// one of: receive, ack, nack
+	//		Stage    string `json:"stage"`
+	//		// the ID of the message that failed to be acked or nacked
+	//		Msg      string `json:"msg"`
+	//		Err      string `json:"e"`
+	//	}
+	SourceFailedEvent = "01DK15DFCJ9V6Y7DF1DZ2Q5V00"
+
+	// RebalanceEvent is logged after the in-flight messages for revoked partitions are drained. If the drain timed out,
+	// then the event is logged at warn level.
+	//
+	//	type Data struct {
+	//		Consumer   string   `json:"consumer"`
+	//		Partitions []string `json:"partitions"`
+	//		// one of: drained, timeout
+	//		Outcome    string   `json:"outcome"`
+	//		Duration   uint     `json:"duration"`
+	//	}
+	RebalanceEvent = "01DK510HWJQN3S55W3NMZBZG6V"
+)
+
+// message outcomes
+const (
+	AckOutcome    = "ack"
+	NackOutcome   = "nack"
+	RejectOutcome = "reject"
+	PanicOutcome  = "panic"
+)
+
+// source stages
+const (
+	ReceiveStage = "receive"
+	AckStage     = "ack"
+	NackStage    = "nack"
+)
+
+// rebalance outcomes
+const (
+	drainedOutcome = "drained"
+	timeoutOutcome = "timeout"
+)
+
+type handleFailed struct {
+	consumer string
+	msg      Message
+	outcome  string
+	err      error
+}
+
+func (e handleFailed) MarshalZerologObject(event *zerolog.Event) {
+	event.Str("consumer", e.consumer).Str("msg", e.msg.ID)
+	if e.msg.Partition != "" {
+		event.Str("partition", e.msg.Partition)
+	}
+	event.Str("outcome", e.outcome).Err(e.err)
+}
+
+type sourceFailed struct {
+	consumer string
+	stage    string
+	msg      string
+	err      error
+}
+
+func (e sourceFailed) MarshalZerologObject(event *zerolog.Event) {
+	event.Str("consumer", e.consumer).Str("stage", e.stage)
+	if e.msg != "" {
+		event.Str("msg", e.msg)
+	}
+	event.Err(e.err)
+}
+
+type rebalanced struct {
+	consumer   string
+	partitions []string
+	outcome    string
+	duration   time.Duration
+}
+
+func (e rebalanced) MarshalZerologObject(event *zerolog.Event) {
+	event.
+		Str("consumer", e.consumer).
+		Strs("partitions", e.partitions).
+		Str("outcome", e.outcome).
+		Dur("duration", e.duration)
+}
@@ -0,0 +1,117 @@
+/*
+ * Copyright (c) 2019 OysterPack, Inc.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ * http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package consumer
+
+import (
+	"context"
+	"fmt"
+	"github.com/oysterpack/andiamo/pkg/fx/health"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/rs/zerolog"
+	"go.uber.org/fx"
+	"go.uber.org/multierr"
+	"sync"
+)
+
+type moduleParams struct {
+	fx.In
+
+	Lifecycle  fx.Lifecycle
+	Consumers  []Consumer `group:"consumer.Consumer"`
+	Logger     *zerolog.Logger
+	Registerer prometheus.Registerer
+	Register   health.Register
+}
+
+// Module provides the fx Module for the consumer module, which runs the registered consumers while the app is running -
+// see `NewRegistration()`.
+//
+// When the app is stopped, the consumers stop receiving messages, and the in-flight messages are drained within the app
+// stop timeout. If the drain times out, then the handler contexts are canceled.
+//
+// The *zerolog.Logger, prometheus.Registerer, and health.Register must be provided by the app.
+func Module(opts Opts) fx.Option {
+	opts = opts.withDefaults()
+	return fx.Invoke(func(params moduleParams) error {
+		if len(params.Consumers) == 0 {
+			return nil
+		}
+		if err := validateConsumers(params.Consumers); err != nil {
+			return err
+		}
+		m := newMetrics()
+		if err := m.register(params.Registerer); err != nil {
+			return err
+		}
+		consumers := make([]*consumer, 0, len(params.Consumers))
+		for _, c := range params.Consumers {
+			consumer := newConsumer(c, opts, m, params.Logger)
+			if err := consumer.registerHealthCheck(params.Register); err != nil {
+				return err
+			}
+			consumers = append(consumers, consumer)
+		}
+
+		receiveCtx, stopReceiving := context.WithCancel(context.Background())
+		handleCtx, cancelHandlers := context.WithCancel(context.Background())
+		var wg sync.WaitGroup
+		params.Lifecycle.Append(fx.Hook{
+			OnStart: func(context.Context) error {
+				for _, c := range consumers {
+					wg.Add(1)
+					go func(c *consumer) {
+						defer wg.Done()
+						c.run(receiveCtx, handleCtx)
+					}(c)
+				}
+				return nil
+			},
+			OnStop: func(stopCtx context.Context) error {
+				stopReceiving()
+				defer cancelHandlers()
+				drained := make(chan struct{})
+				go func() {
+					defer close(drained)
+					wg.Wait()
+				}()
+				select {
+				case <-drained:
+					return nil
+				case <-stopCtx.Done():
+					return stopCtx.Err()
+				}
+			},
+		})
+		return nil
+	})
+}
+
+func validateConsumers(consumers []Consumer) error {
+	var err error
+	names := make(map[string]bool, len(consumers))
+	for _, c := range consumers {
+		if e := c.validate(); e != nil {
+			err = multierr.Append(err, e)
+			continue
+		}
+		if names[c.Name] {
+			err = multierr.Append(err, fmt.Errorf("%s : consumer name must be unique : %s", ErrInvalidConsumer, c.Name))
+		}
+		names[c.Name] = true
+	}
+	return err
+}
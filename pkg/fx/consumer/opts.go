@@ -0,0 +1,55 @@
+/*
+ * Copyright (c) 2019 OysterPack, Inc.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ * http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package consumer
+
+import (
+	"time"
+)
+
+// Opts is used to configure the module
+type Opts struct {
+	// Concurrency is the default max number of messages that are handled concurrently per consumer - defaults to 1
+	Concurrency int
+	// ReceiveBackoff is how long the consumer waits before receiving again after the source failed - defaults to 1 sec
+	ReceiveBackoff time.Duration
+	// RebalanceTimeout is the max amount of time to wait for the in-flight messages for revoked partitions to be drained -
+	// defaults to 30 secs
+	RebalanceTimeout time.Duration
+}
+
+// DefaultOpts returns the default module options
+func DefaultOpts() Opts {
+	return Opts{
+		Concurrency:      1,
+		ReceiveBackoff:   time.Second,
+		RebalanceTimeout: 30 * time.Second,
+	}
+}
+
+func (opts Opts) withDefaults() Opts {
+	defaults := DefaultOpts()
+	if opts.Concurrency <= 0 {
+		opts.Concurrency = defaults.Concurrency
+	}
+	if opts.ReceiveBackoff <= 0 {
+		opts.ReceiveBackoff = defaults.ReceiveBackoff
+	}
+	if opts.RebalanceTimeout <= 0 {
+		opts.RebalanceTimeout = defaults.RebalanceTimeout
+	}
+	return opts
+}
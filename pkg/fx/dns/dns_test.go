@@ -0,0 +1,365 @@
+/*
+ * Copyright (c) 2019 OysterPack, Inc.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ * http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package dns_test
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"github.com/oysterpack/andiamo/pkg/clock"
+	"github.com/oysterpack/andiamo/pkg/fx/dns"
+	"github.com/oysterpack/andiamo/pkg/fx/health"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/rs/zerolog"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.uber.org/fx"
+	"io/ioutil"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+	"time"
+)
+
+// fakeDNS resolves all hosts to the configured addresses, and counts the lookups
+type fakeDNS struct {
+	mutex   sync.Mutex
+	addrs   []string
+	err     error
+	lookups map[string]int
+	// if set, then lookups block until it is closed
+	blocked chan struct{}
+}
+
+func (d *fakeDNS) lookupHost(ctx context.Context, host string) ([]string, error) {
+	d.mutex.Lock()
+	if d.lookups == nil {
+		d.lookups = make(map[string]int)
+	}
+	d.lookups[host]++
+	addrs, err, blocked := d.addrs, d.err, d.blocked
+	d.mutex.Unlock()
+	if blocked != nil {
+		<-blocked
+	}
+	return addrs, err
+}
+
+func (d *fakeDNS) set(addrs []string, err error) {
+	d.mutex.Lock()
+	defer d.mutex.Unlock()
+	d.addrs, d.err = addrs, err
+}
+
+func (d *fakeDNS) count(host string) int {
+	d.mutex.Lock()
+	defer d.mutex.Unlock()
+	return d.lookups[host]
+}
+
+type testApp struct {
+	*fx.App
+	resolver dns.Resolver
+	clock    *clock.Fake
+	dns      *fakeDNS
+	registry *prometheus.Registry
+	checker  func(ctx context.Context) (health.Status, error)
+}
+
+func newTestApp(t *testing.T, opts dns.Opts) *testApp {
+	app := &testApp{
+		clock:    clock.NewFake(time.Now()),
+		dns:      &fakeDNS{addrs: []string{"127.0.0.1"}},
+		registry: prometheus.NewRegistry(),
+	}
+	opts.LookupHost = app.dns.lookupHost
+	logger := zerolog.Nop()
+	app.App = fx.New(
+		fx.Provide(
+			func() *zerolog.Logger { return &logger },
+			func() clock.Clock { return app.clock },
+			func() prometheus.Registerer { return app.registry },
+			func() health.Register {
+				return func(check health.Check, opts health.CheckerOpts, checker func(ctx context.Context) (health.Status, error)) error {
+					app.checker = checker
+					return nil
+				}
+			},
+		),
+		dns.Module(opts),
+		fx.Populate(&app.resolver),
+	)
+	require.NoError(t, app.Err())
+	return app
+}
+
+func (app *testApp) metric(t *testing.T, metricID string) float64 {
+	mfs, err := app.registry.Gather()
+	require.NoError(t, err)
+	for _, mf := range mfs {
+		if mf.GetName() == metricID {
+			m := mf.Metric[0]
+			if m.Counter != nil {
+				return m.GetCounter().GetValue()
+			}
+			return float64(m.GetHistogram().GetSampleCount())
+		}
+	}
+	return 0
+}
+
+func (app *testApp) health(t *testing.T) (health.Status, error) {
+	require.NotNil(t, app.checker)
+	return app.checker(context.Background())
+}
+
+func TestResolver_Cache(t *testing.T) {
+	t.Parallel()
+
+	const Host = "app.test"
+	app := newTestApp(t, dns.Opts{TTL: time.Minute, MaxStale: time.Minute, FailureThreshold: 2})
+	ctx := context.Background()
+
+	addrs, err := app.resolver.LookupHost(ctx, Host)
+	require.NoError(t, err)
+	assert.Equal(t, []string{"127.0.0.1"}, addrs)
+	_, err = app.resolver.LookupHost(ctx, Host)
+	require.NoError(t, err)
+	assert.Equal(t, 1, app.dns.count(Host), "addresses are cached")
+
+	addrs, err = app.resolver.LookupHost(ctx, "10.0.0.1")
+	require.NoError(t, err)
+	assert.Equal(t, []string{"10.0.0.1"}, addrs)
+	assert.Equal(t, 0, app.dns.count("10.0.0.1"), "IP addresses are not resolved")
+
+	t.Run("expired", func(t *testing.T) {
+		app.clock.Advance(time.Minute)
+		app.dns.set([]string{"127.0.0.2"}, nil)
+		addrs, err := app.resolver.LookupHost(ctx, Host)
+		require.NoError(t, err)
+		assert.Equal(t, []string{"127.0.0.2"}, addrs)
+		assert.Equal(t, 2, app.dns.count(Host))
+	})
+
+	t.Run("stale on error", func(t *testing.T) {
+		app.clock.Advance(time.Minute)
+		app.dns.set(nil, errors.New("SERVFAIL"))
+		for i := 0; i < 2; i++ {
+			addrs, err := app.resolver.LookupHost(ctx, Host)
+			require.NoError(t, err)
+			assert.Equal(t, []string{"127.0.0.2"}, addrs)
+		}
+		assert.Equal(t, float64(2), app.metric(t, dns.LookupFailuresMetricID))
+		status, err := app.health(t)
+		assert.Equal(t, health.Yellow, status)
+		assert.Contains(t, err.Error(), Host)
+	})
+
+	t.Run("max stale exceeded", func(t *testing.T) {
+		app.clock.Advance(time.Minute)
+		_, err := app.resolver.LookupHost(ctx, Host)
+		assert.Error(t, err)
+		status, _ := app.health(t)
+		assert.Equal(t, health.Red, status)
+	})
+
+	t.Run("recovered", func(t *testing.T) {
+		app.dns.set([]string{"127.0.0.3"}, nil)
+		addrs, err := app.resolver.LookupHost(ctx, Host)
+		require.NoError(t, err)
+		assert.Equal(t, []string{"127.0.0.3"}, addrs)
+		status, err := app.health(t)
+		assert.NoError(t, err)
+		assert.Equal(t, health.Green, status)
+	})
+
+	assert.Equal(t, float64(app.dns.count(Host)), app.metric(t, dns.LookupLatencyMetricID))
+}
+
+func TestResolver_Refresh(t *testing.T) {
+	t.Parallel()
+
+	const Host = "app.test"
+	app := newTestApp(t, dns.Opts{TTL: 30 * time.Second, RefreshInterval: 10 * time.Second, IdleTimeout: time.Minute})
+	require.NoError(t, app.Start(context.Background()))
+	defer app.Stop(context.Background())
+
+	_, err := app.resolver.LookupHost(context.Background(), Host)
+	require.NoError(t, err)
+
+	refresh := func() {
+		app.clock.BlockUntil(1)
+		app.clock.Advance(10 * time.Second)
+	}
+	waitForLookups := func(count int) {
+		timeout := time.After(5 * time.Second)
+		for app.dns.count(Host) < count {
+			select {
+			case <-timeout:
+				t.Fatalf("*** timed out waiting for %d lookups", count)
+			case <-time.After(time.Millisecond):
+			}
+		}
+	}
+
+	// the host is refreshed when it would expire before the next refresh
+	refresh()
+	refresh()
+	waitForLookups(2)
+	// the refreshed addresses are served from the cache
+	app.dns.set([]string{"127.0.0.2"}, nil)
+	refresh()
+	refresh()
+	waitForLookups(3)
+	addrs, err := app.resolver.LookupHost(context.Background(), Host)
+	require.NoError(t, err)
+	assert.Equal(t, []string{"127.0.0.2"}, addrs)
+	assert.Equal(t, 3, app.dns.count(Host))
+}
+
+func TestResolver_ConcurrentLookups(t *testing.T) {
+	t.Parallel()
+
+	const Host = "app.test"
+	app := newTestApp(t, dns.Opts{})
+	app.dns.blocked = make(chan struct{})
+	ctx := context.Background()
+
+	// When the host is looked up concurrently
+	var wg sync.WaitGroup
+	results := make(chan []string, 10)
+	for i := 0; i < cap(results); i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			addrs, err := app.resolver.LookupHost(ctx, Host)
+			assert.NoError(t, err)
+			results <- addrs
+		}()
+	}
+	for app.dns.count(Host) == 0 {
+		time.Sleep(time.Millisecond)
+	}
+	close(app.dns.blocked)
+	wg.Wait()
+	close(results)
+	// Then the lookups are collapsed into a single lookup
+	for addrs := range results {
+		assert.Equal(t, []string{"127.0.0.1"}, addrs)
+	}
+	assert.Equal(t, 1, app.dns.count(Host))
+}
+
+func TestResolver_MaxHosts(t *testing.T) {
+	t.Parallel()
+
+	app := newTestApp(t, dns.Opts{MaxHosts: 2})
+	ctx := context.Background()
+	lookup := func(host string) {
+		_, err := app.resolver.LookupHost(ctx, host)
+		require.NoError(t, err)
+		app.clock.Advance(time.Second)
+	}
+
+	lookup("a.test")
+	lookup("b.test")
+	lookup("a.test")
+	// When the cache is full
+	lookup("c.test")
+	// Then the least recently used host is evicted
+	lookup("b.test")
+	assert.Equal(t, 2, app.dns.count("b.test"))
+	// And the cached hosts are served from the cache
+	lookup("c.test")
+	assert.Equal(t, 1, app.dns.count("c.test"))
+	// a.test was evicted when b.test was cached again
+	lookup("a.test")
+	assert.Equal(t, 2, app.dns.count("a.test"))
+}
+
+func TestResolver_DialContext(t *testing.T) {
+	t.Parallel()
+
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprint(w, "pong")
+	}))
+	defer server.Close()
+	_, port, err := net.SplitHostPort(server.Listener.Addr().String())
+	require.NoError(t, err)
+
+	app := newTestApp(t, dns.Opts{})
+	// the addresses are tried in order
+	app.dns.set([]string{"127.0.0.1", "127.0.0.1"}, nil)
+	client := &http.Client{Transport: dns.NewTransport(app.resolver), Timeout: 5 * time.Second}
+	response, err := client.Get(fmt.Sprintf("http://app.test:%s/ping", port))
+	require.NoError(t, err)
+	defer response.Body.Close()
+	body, err := ioutil.ReadAll(response.Body)
+	require.NoError(t, err)
+	assert.Equal(t, "pong", string(body))
+	assert.Equal(t, 1, app.dns.count("app.test"))
+
+	app.dns.set(nil, errors.New("NXDOMAIN"))
+	_, err = client.Get(fmt.Sprintf("http://unknown.test:%s/ping", port))
+	assert.Error(t, err)
+}
+
+func TestNewTransport(t *testing.T) {
+	t.Parallel()
+
+	app := newTestApp(t, dns.Opts{})
+	transport := dns.NewTransport(app.resolver)
+	defaultTransport := http.DefaultTransport.(*http.Transport)
+	assert.NotNil(t, transport.Proxy)
+	assert.NotNil(t, transport.DialContext)
+	assert.Equal(t, defaultTransport.MaxIdleConnsPerHost, transport.MaxIdleConnsPerHost)
+	assert.Equal(t, defaultTransport.ForceAttemptHTTP2, transport.ForceAttemptHTTP2)
+	assert.Equal(t, defaultTransport.MaxIdleConns, transport.MaxIdleConns)
+	assert.Equal(t, defaultTransport.IdleConnTimeout, transport.IdleConnTimeout)
+	assert.Equal(t, defaultTransport.TLSHandshakeTimeout, transport.TLSHandshakeTimeout)
+	assert.Equal(t, defaultTransport.ExpectContinueTimeout, transport.ExpectContinueTimeout)
+}
+
+func TestModule_InvalidOpts(t *testing.T) {
+	t.Parallel()
+
+	for _, opts := range []dns.Opts{
+		{TTL: -time.Second},
+		{MaxStale: -time.Second},
+		{FailureThreshold: -1},
+		{MaxHosts: -1},
+	} {
+		logger := zerolog.Nop()
+		app := fx.New(
+			fx.Provide(
+				func() *zerolog.Logger { return &logger },
+				func() prometheus.Registerer { return prometheus.NewRegistry() },
+				func() health.Register {
+					return func(health.Check, health.CheckerOpts, func(ctx context.Context) (health.Status, error)) error {
+						return nil
+					}
+				},
+			),
+			dns.Module(opts),
+			fx.Invoke(func(dns.Resolver) {}),
+		)
+		require.Error(t, app.Err())
+		assert.Contains(t, app.Err().Error(), dns.ErrInvalidOpts.Error())
+	}
+}
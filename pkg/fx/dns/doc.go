@@ -0,0 +1,32 @@
+/*
+ * Copyright (c) 2019 OysterPack, Inc.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ * http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+// Package dns provides an optional fx module that provides a caching DNS `Resolver`, i.e., outbound calls do not pay
+// the DNS lookup latency on every new connection, and keep working through transient DNS outages.
+//
+// The module:
+//   - caches the resolved host addresses for the configured TTL - the cache is bounded, i.e., the least recently used
+//     host is evicted when the cache is full
+//   - collapses concurrent lookups for the same host into a single lookup
+//   - refreshes the cached hosts in the background before they expire, i.e., lookups are served from the cache
+//   - serves the stale addresses when a lookup fails, up to the configured max staleness
+//   - records metrics for the lookup latencies and failures
+//   - registers a health check that degrades when hosts persistently fail to resolve
+//
+// HTTP clients use the resolver via the transport that is created by `NewTransport`, e.g.,
+//
+//	client := &http.Client{Transport: dns.NewTransport(resolver), Timeout: 5 * time.Second}
+package dns
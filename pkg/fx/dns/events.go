@@ -0,0 +1,51 @@
+/*
+ * Copyright (c) 2019 OysterPack, Inc.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ * http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package dns
+
+import (
+	"github.com/rs/zerolog"
+)
+
+// dns module events
+const (
+	// LookupFailedEvent is logged when a host fails to resolve
+	//
+	//	type Data struct {
+	//		Host     string `json:"host"`
+	//		// consecutive failures
+	//		Failures int    `json:"failures"`
+	//		// true if the stale addresses are served
+	//		Stale    bool   `json:"stale"`
+	//		Err      string `json:"e"`
+	//	}
+	LookupFailedEvent = "01DJ2S46CHF19KHMSXP090RF22"
+)
+
+type lookupFailed struct {
+	host     string
+	failures int
+	stale    bool
+	err      error
+}
+
+func (e lookupFailed) MarshalZerologObject(event *zerolog.Event) {
+	event.
+		Str("host", e.host).
+		Int("failures", e.failures).
+		Bool("stale", e.stale).
+		Err(e.err)
+}
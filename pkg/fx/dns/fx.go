@@ -0,0 +1,83 @@
+/*
+ * Copyright (c) 2019 OysterPack, Inc.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ * http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package dns
+
+import (
+	"context"
+	"github.com/oysterpack/andiamo/pkg/clock"
+	"github.com/oysterpack/andiamo/pkg/fx/health"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/rs/zerolog"
+	"go.uber.org/fx"
+)
+
+type resolverParams struct {
+	fx.In
+
+	Lifecycle  fx.Lifecycle
+	Clock      clock.Clock `optional:"true"`
+	Logger     *zerolog.Logger
+	Registerer prometheus.Registerer
+	Register   health.Register
+}
+
+// Module provides the fx Module for the dns module, which provides the `Resolver`. The cached hosts are refreshed in
+// the background while the app is running.
+//
+// The *zerolog.Logger, prometheus.Registerer, and health.Register must be provided by the app. The clock.Clock is
+// optional - if not provided, then the real clock is used.
+func Module(opts Opts) fx.Option {
+	opts = opts.withDefaults()
+	return fx.Provide(func(params resolverParams) (Resolver, error) {
+		if err := opts.validate(); err != nil {
+			return nil, err
+		}
+		clk := params.Clock
+		if clk == nil {
+			clk = clock.Real()
+		}
+		r := newResolver(opts, clk, params.Logger)
+		if err := r.registerMetrics(params.Registerer); err != nil {
+			return nil, err
+		}
+		if err := r.registerHealthCheck(params.Register); err != nil {
+			return nil, err
+		}
+
+		ctx, cancel := context.WithCancel(context.Background())
+		done := make(chan struct{})
+		params.Lifecycle.Append(fx.Hook{
+			OnStart: func(context.Context) error {
+				go func() {
+					defer close(done)
+					r.run(ctx)
+				}()
+				return nil
+			},
+			OnStop: func(stopCtx context.Context) error {
+				cancel()
+				select {
+				case <-done:
+					return nil
+				case <-stopCtx.Done():
+					return stopCtx.Err()
+				}
+			},
+		})
+		return r, nil
+	})
+}
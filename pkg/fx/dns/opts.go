@@ -0,0 +1,116 @@
+/*
+ * Copyright (c) 2019 OysterPack, Inc.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ * http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package dns
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"time"
+)
+
+// Opts is used to configure the module
+type Opts struct {
+	// TTL is how long resolved addresses are cached - defaults to 30 secs
+	TTL time.Duration
+	// RefreshInterval is how often the cached hosts are refreshed in the background. Hosts that would expire before the
+	// next refresh are refreshed - defaults to 10 secs
+	RefreshInterval time.Duration
+	// MaxStale is how long the addresses are served after they have expired, when the host fails to resolve - defaults
+	// to 5 mins
+	MaxStale time.Duration
+	// IdleTimeout is how long a host is cached after it was last looked up, i.e., idle hosts are no longer refreshed -
+	// defaults to 10 mins
+	IdleTimeout time.Duration
+	// LookupTimeout is the lookup timeout - defaults to 5 secs
+	LookupTimeout time.Duration
+	// FailureThreshold is the number of consecutive lookup failures at which the health check degrades - defaults to 3
+	FailureThreshold int
+	// MaxHosts is the max number of cached hosts. When the cache is full, the least recently used host is evicted -
+	// defaults to 1000
+	MaxHosts int
+
+	// LookupHost is used to resolve hosts - defaults to net.DefaultResolver.LookupHost
+	LookupHost func(ctx context.Context, host string) ([]string, error)
+}
+
+// DefaultOpts returns the default module options
+func DefaultOpts() Opts {
+	return Opts{
+		TTL:              30 * time.Second,
+		RefreshInterval:  10 * time.Second,
+		MaxStale:         5 * time.Minute,
+		IdleTimeout:      10 * time.Minute,
+		LookupTimeout:    5 * time.Second,
+		FailureThreshold: 3,
+		MaxHosts:         1000,
+		LookupHost:       net.DefaultResolver.LookupHost,
+	}
+}
+
+func (opts Opts) withDefaults() Opts {
+	defaults := DefaultOpts()
+	if opts.TTL == 0 {
+		opts.TTL = defaults.TTL
+	}
+	if opts.RefreshInterval == 0 {
+		opts.RefreshInterval = defaults.RefreshInterval
+	}
+	if opts.MaxStale == 0 {
+		opts.MaxStale = defaults.MaxStale
+	}
+	if opts.IdleTimeout == 0 {
+		opts.IdleTimeout = defaults.IdleTimeout
+	}
+	if opts.LookupTimeout == 0 {
+		opts.LookupTimeout = defaults.LookupTimeout
+	}
+	if opts.FailureThreshold == 0 {
+		opts.FailureThreshold = defaults.FailureThreshold
+	}
+	if opts.MaxHosts == 0 {
+		opts.MaxHosts = defaults.MaxHosts
+	}
+	if opts.LookupHost == nil {
+		opts.LookupHost = defaults.LookupHost
+	}
+	return opts
+}
+
+func (opts Opts) validate() error {
+	for _, d := range []struct {
+		name  string
+		value time.Duration
+	}{
+		{"TTL", opts.TTL},
+		{"refresh interval", opts.RefreshInterval},
+		{"max stale", opts.MaxStale},
+		{"idle timeout", opts.IdleTimeout},
+		{"lookup timeout", opts.LookupTimeout},
+	} {
+		if d.value < 0 {
+			return fmt.Errorf("%s : %s must not be negative : %s", ErrInvalidOpts, d.name, d.value)
+		}
+	}
+	if opts.FailureThreshold < 0 {
+		return fmt.Errorf("%s : failure threshold must not be negative : %d", ErrInvalidOpts, opts.FailureThreshold)
+	}
+	if opts.MaxHosts < 0 {
+		return fmt.Errorf("%s : max hosts must not be negative : %d", ErrInvalidOpts, opts.MaxHosts)
+	}
+	return nil
+}
@@ -0,0 +1,330 @@
+/*
+ * Copyright (c) 2019 OysterPack, Inc.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ * http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package dns
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"github.com/oysterpack/andiamo/pkg/clock"
+	"github.com/oysterpack/andiamo/pkg/eventlog"
+	"github.com/oysterpack/andiamo/pkg/fx/health"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/rs/zerolog"
+	"go.uber.org/multierr"
+	"net"
+	"net/http"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+// metric IDs, which are used as the prometheus metric names
+const (
+	// histogram - lookup latency in seconds
+	LookupLatencyMetricID = "U01DJ2S463ZWGFY63ENSFXY6C8E"
+	// counter - lookup failures
+	LookupFailuresMetricID = "U01DJ2S4688KDWQEE7DHEJ9SZZP"
+)
+
+// HealthCheckID checks for hosts that persistently fail to resolve. The health check is Yellow while the stale addresses
+// are served, and Red if there are no addresses to serve.
+const HealthCheckID = "01DJ2S46GT2RZRE1JDMS2WFQV6"
+
+// errors
+var (
+	ErrInvalidOpts  = errors.New("dns options are invalid")
+	ErrLookupFailed = errors.New("hosts failed to resolve")
+)
+
+// Resolver is a caching DNS resolver
+type Resolver interface {
+	// LookupHost returns the host's addresses. If the host is an IP address, then it is returned as is.
+	LookupHost(ctx context.Context, host string) ([]string, error)
+	// DialContext connects to the address using the resolved host addresses, which are tried in order until a connection
+	// is established, i.e., it is designed to be used as the http.Transport DialContext.
+	DialContext(ctx context.Context, network, address string) (net.Conn, error)
+}
+
+// NewTransport returns a new HTTP transport that resolves hosts using the resolver. The transport is a clone of the
+// http.DefaultTransport, i.e., only the DialContext is replaced.
+func NewTransport(resolver Resolver) *http.Transport {
+	transport := http.DefaultTransport.(*http.Transport).Clone()
+	transport.DialContext = resolver.DialContext
+	return transport
+}
+
+type entry struct {
+	addrs []string
+	// when the addresses were last resolved
+	resolved time.Time
+	// when the host was last looked up
+	lastUsed time.Time
+	// consecutive lookup failures
+	failures int
+	err      error
+}
+
+// inFlightLookup is a host lookup that is in flight, which concurrent lookups for the same host wait on
+type inFlightLookup struct {
+	done  chan struct{}
+	addrs []string
+	err   error
+}
+
+type resolver struct {
+	opts   Opts
+	clock  clock.Clock
+	dialer net.Dialer
+
+	mutex   sync.Mutex
+	entries map[string]*entry
+	lookups map[string]*inFlightLookup
+
+	latency  prometheus.Histogram
+	failures prometheus.Counter
+
+	logLookupFailed eventlog.Logger
+}
+
+func newResolver(opts Opts, clk clock.Clock, logger *zerolog.Logger) *resolver {
+	return &resolver{
+		opts:    opts,
+		clock:   clk,
+		dialer:  net.Dialer{Timeout: 30 * time.Second, KeepAlive: 30 * time.Second},
+		entries: make(map[string]*entry),
+		lookups: make(map[string]*inFlightLookup),
+		latency: prometheus.NewHistogram(prometheus.HistogramOpts{
+			Name:    LookupLatencyMetricID,
+			Help:    "DNS lookup latency in seconds",
+			Buckets: []float64{0.001, 0.005, 0.01, 0.05, 0.1, 0.5, 1, 5},
+		}),
+		failures:        prometheus.NewCounter(prometheus.CounterOpts{Name: LookupFailuresMetricID, Help: "DNS lookup failures"}),
+		logLookupFailed: eventlog.NewLogger(LookupFailedEvent, logger, zerolog.WarnLevel),
+	}
+}
+
+func (r *resolver) LookupHost(ctx context.Context, host string) ([]string, error) {
+	if net.ParseIP(host) != nil {
+		return []string{host}, nil
+	}
+
+	r.mutex.Lock()
+	now := r.clock.Now()
+	if e, ok := r.entries[host]; ok {
+		e.lastUsed = now
+		if len(e.addrs) > 0 && now.Sub(e.resolved) < r.opts.TTL {
+			addrs := append([]string(nil), e.addrs...)
+			r.mutex.Unlock()
+			return addrs, nil
+		}
+	} else {
+		r.add(host, now)
+	}
+	r.mutex.Unlock()
+
+	return r.resolve(ctx, host)
+}
+
+// add caches the host. If the cache is full, then the least recently used host is evicted.
+//
+// NOTE: the mutex must be held
+func (r *resolver) add(host string, now time.Time) *entry {
+	if len(r.entries) >= r.opts.MaxHosts {
+		var lru string
+		var lastUsed time.Time
+		for h, e := range r.entries {
+			if lru == "" || e.lastUsed.Before(lastUsed) {
+				lru, lastUsed = h, e.lastUsed
+			}
+		}
+		delete(r.entries, lru)
+	}
+	e := &entry{lastUsed: now}
+	r.entries[host] = e
+	return e
+}
+
+// resolve resolves the host, i.e., concurrent lookups for the same host are collapsed into a single lookup. Callers
+// that join an in-flight lookup stop waiting when their context is done.
+func (r *resolver) resolve(ctx context.Context, host string) ([]string, error) {
+	r.mutex.Lock()
+	if l, ok := r.lookups[host]; ok {
+		r.mutex.Unlock()
+		select {
+		case <-l.done:
+			return append([]string(nil), l.addrs...), l.err
+		case <-ctx.Done():
+			return nil, ctx.Err()
+		}
+	}
+	l := &inFlightLookup{done: make(chan struct{})}
+	r.lookups[host] = l
+	r.mutex.Unlock()
+
+	l.addrs, l.err = r.lookup(ctx, host)
+	r.mutex.Lock()
+	delete(r.lookups, host)
+	r.mutex.Unlock()
+	close(l.done)
+	return append([]string(nil), l.addrs...), l.err
+}
+
+// lookup looks up the host and updates the cache. If the lookup fails, then the stale addresses are returned, if
+// available.
+func (r *resolver) lookup(ctx context.Context, host string) ([]string, error) {
+	ctx, cancel := r.clock.WithTimeout(ctx, r.opts.LookupTimeout)
+	defer cancel()
+	start := r.clock.Now()
+	addrs, err := r.opts.LookupHost(ctx, host)
+	r.latency.Observe(r.clock.Since(start).Seconds())
+	if err == nil && len(addrs) == 0 {
+		err = fmt.Errorf("no addresses were found for host : %s", host)
+	}
+
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+	e, ok := r.entries[host]
+	if !ok {
+		// the host was evicted while it was being resolved
+		e = r.add(host, r.clock.Now())
+	}
+	if err == nil {
+		e.addrs = addrs
+		e.resolved = r.clock.Now()
+		e.failures = 0
+		e.err = nil
+		return append([]string(nil), addrs...), nil
+	}
+
+	r.failures.Inc()
+	e.failures++
+	e.err = err
+	stale := r.servesStale(e)
+	r.logLookupFailed(lookupFailed{host: host, failures: e.failures, stale: stale, err: err}, "DNS lookup failed")
+	if stale {
+		return append([]string(nil), e.addrs...), nil
+	}
+	return nil, err
+}
+
+func (r *resolver) servesStale(e *entry) bool {
+	return len(e.addrs) > 0 && r.clock.Since(e.resolved) < r.opts.TTL+r.opts.MaxStale
+}
+
+func (r *resolver) DialContext(ctx context.Context, network, address string) (net.Conn, error) {
+	host, port, err := net.SplitHostPort(address)
+	if err != nil {
+		return nil, err
+	}
+	addrs, err := r.LookupHost(ctx, host)
+	if err != nil {
+		return nil, err
+	}
+	var errs error
+	for _, addr := range addrs {
+		conn, err := r.dialer.DialContext(ctx, network, net.JoinHostPort(addr, port))
+		if err == nil {
+			return conn, nil
+		}
+		errs = multierr.Append(errs, err)
+		if ctx.Err() != nil {
+			break
+		}
+	}
+	return nil, errs
+}
+
+// refresh resolves the hosts that would expire before the next refresh, and evicts the idle hosts
+func (r *resolver) refresh(ctx context.Context) {
+	var hosts []string
+	r.mutex.Lock()
+	now := r.clock.Now()
+	for host, e := range r.entries {
+		if now.Sub(e.lastUsed) >= r.opts.IdleTimeout {
+			delete(r.entries, host)
+			continue
+		}
+		if e.failures > 0 || now.Sub(e.resolved) >= r.opts.TTL-r.opts.RefreshInterval {
+			hosts = append(hosts, host)
+		}
+	}
+	r.mutex.Unlock()
+
+	for _, host := range hosts {
+		if ctx.Err() != nil {
+			return
+		}
+		r.resolve(ctx, host)
+	}
+}
+
+func (r *resolver) run(ctx context.Context) {
+	timer := r.clock.NewTimer(r.opts.RefreshInterval)
+	defer timer.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-timer.C():
+			timer.Reset(r.opts.RefreshInterval)
+			r.refresh(ctx)
+		}
+	}
+}
+
+func (r *resolver) checkHealth(ctx context.Context) (health.Status, error) {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+	status := health.Green
+	var failing []string
+	for host, e := range r.entries {
+		if e.failures < r.opts.FailureThreshold {
+			continue
+		}
+		failing = append(failing, fmt.Sprintf("%s (%s)", host, e.err))
+		if r.servesStale(e) {
+			if status == health.Green {
+				status = health.Yellow
+			}
+		} else {
+			status = health.Red
+		}
+	}
+	if len(failing) == 0 {
+		return health.Green, nil
+	}
+	sort.Strings(failing)
+	return status, fmt.Errorf("%s : %s", ErrLookupFailed, strings.Join(failing, ", "))
+}
+
+func (r *resolver) registerMetrics(registerer prometheus.Registerer) error {
+	return multierr.Combine(
+		registerer.Register(r.latency),
+		registerer.Register(r.failures),
+	)
+}
+
+func (r *resolver) registerHealthCheck(register health.Register) error {
+	return register(health.Check{
+		ID:           HealthCheckID,
+		Description:  "DNS resolution",
+		YellowImpact: "stale host addresses are being used, which may no longer be valid",
+		RedImpact:    "outbound calls fail because hosts cannot be resolved",
+	}, health.CheckerOpts{}, r.checkHealth)
+}
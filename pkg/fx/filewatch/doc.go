@@ -0,0 +1,27 @@
+/*
+ * Copyright (c) 2019 OysterPack, Inc.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ * http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+// Package filewatch provides an optional fx module that provides a lifecycle-managed file and directory `Watcher`, which
+// is backed by fsnotify. Change events are debounced, i.e., the burst of events that is produced by a single logical
+// change, e.g., an editor save or an atomic write, is delivered as a single batch of typed events.
+//
+// Files are watched via their parent directory, i.e., changes are detected when files are replaced via rename. Changes to
+// k8s ConfigMap and Secret volume files, which are updated atomically by swapping the "..data" symlink, are detected as
+// well.
+//
+// The watcher is used by app features that react to file changes, e.g., config hot reload and secrets rotation, and is
+// available to app components via dependency injection.
+package filewatch
@@ -0,0 +1,54 @@
+/*
+ * Copyright (c) 2019 OysterPack, Inc.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ * http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package filewatch
+
+import (
+	"github.com/rs/zerolog"
+)
+
+// filewatch module events
+const (
+	// ChangedEvent is logged at debug level when a batch of change events is delivered to a watch handler
+	//
+	//	type Data struct {
+	//		// the watched path
+	//		Path    string   `json:"path"`
+	//		// the changed paths
+	//		Changed []string `json:"changed"`
+	//	}
+	ChangedEvent = "01DJ2GWGM0FR4N5AKAXVNDNXK3"
+
+	// WatchErrorEvent is logged when the underlying watcher reports an error, e.g., the event queue overflowed
+	//
+	//	type Data struct {
+	//		Err string `json:"e"`
+	//	}
+	WatchErrorEvent = "01DJ2GWGR9N7SE6DP1DC9VWQFW"
+)
+
+type changed struct {
+	path   string
+	events []Event
+}
+
+func (e changed) MarshalZerologObject(event *zerolog.Event) {
+	paths := make([]string, len(e.events))
+	for i, change := range e.events {
+		paths[i] = change.Path
+	}
+	event.Str("path", e.path).Strs("changed", paths)
+}
@@ -0,0 +1,205 @@
+/*
+ * Copyright (c) 2019 OysterPack, Inc.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ * http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package filewatch_test
+
+import (
+	"context"
+	"github.com/oysterpack/andiamo/pkg/fx/filewatch"
+	"github.com/rs/zerolog"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.uber.org/fx"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+const debounce = 50 * time.Millisecond
+
+func newTestApp(t *testing.T) (*fx.App, filewatch.Watcher) {
+	var watcher filewatch.Watcher
+	logger := zerolog.Nop()
+	app := fx.New(
+		fx.Provide(func() *zerolog.Logger { return &logger }),
+		filewatch.Module(filewatch.Opts{Debounce: debounce}),
+		fx.Populate(&watcher),
+	)
+	require.NoError(t, app.Err())
+	require.NoError(t, app.Start(context.Background()))
+	return app, watcher
+}
+
+func tempDir(t *testing.T) (string, func()) {
+	dir, err := ioutil.TempDir("", "filewatch")
+	require.NoError(t, err)
+	return dir, func() { os.RemoveAll(dir) }
+}
+
+func watch(t *testing.T, watcher filewatch.Watcher, path string) (<-chan []filewatch.Event, func()) {
+	batches := make(chan []filewatch.Event, 16)
+	stop, err := watcher.Watch(path, func(events []filewatch.Event) {
+		batches <- events
+	})
+	require.NoError(t, err)
+	return batches, stop
+}
+
+func nextBatch(t *testing.T, batches <-chan []filewatch.Event) []filewatch.Event {
+	select {
+	case events := <-batches:
+		return events
+	case <-time.After(5 * time.Second):
+		t.Fatal("*** timed out waiting for change events")
+		return nil
+	}
+}
+
+func assertNoBatch(t *testing.T, batches <-chan []filewatch.Event) {
+	select {
+	case events := <-batches:
+		t.Errorf("*** no change events were expected: %v", events)
+	case <-time.After(5 * debounce):
+	}
+}
+
+func TestWatcher_File(t *testing.T) {
+	t.Parallel()
+
+	dir, cleanup := tempDir(t)
+	defer cleanup()
+	app, watcher := newTestApp(t)
+	defer app.Stop(context.Background())
+
+	path := filepath.Join(dir, "config.json")
+	require.NoError(t, ioutil.WriteFile(path, []byte("{}"), 0644))
+	batches, stop := watch(t, watcher, path)
+
+	t.Run("writes are debounced", func(t *testing.T) {
+		for i := 0; i < 5; i++ {
+			require.NoError(t, ioutil.WriteFile(path, []byte(`{"a":1}`), 0644))
+		}
+		events := nextBatch(t, batches)
+		require.Len(t, events, 1)
+		assert.Equal(t, path, events[0].Path)
+		assert.True(t, events[0].Op.Has(filewatch.Write))
+	})
+
+	t.Run("other files in the directory are ignored", func(t *testing.T) {
+		require.NoError(t, ioutil.WriteFile(filepath.Join(dir, "other.json"), []byte("{}"), 0644))
+		assertNoBatch(t, batches)
+	})
+
+	t.Run("atomic replace", func(t *testing.T) {
+		tmp := filepath.Join(dir, "config.json.tmp")
+		require.NoError(t, ioutil.WriteFile(tmp, []byte(`{"a":2}`), 0644))
+		require.NoError(t, os.Rename(tmp, path))
+		events := nextBatch(t, batches)
+		require.Len(t, events, 1)
+		assert.Equal(t, path, events[0].Path)
+		assert.True(t, events[0].Op.Has(filewatch.Create))
+	})
+
+	t.Run("stopped", func(t *testing.T) {
+		stop()
+		require.NoError(t, ioutil.WriteFile(path, []byte(`{"a":3}`), 0644))
+		assertNoBatch(t, batches)
+	})
+}
+
+func TestWatcher_Directory(t *testing.T) {
+	t.Parallel()
+
+	dir, cleanup := tempDir(t)
+	defer cleanup()
+	app, watcher := newTestApp(t)
+
+	batches, _ := watch(t, watcher, dir)
+	a, b := filepath.Join(dir, "a"), filepath.Join(dir, "b")
+	require.NoError(t, ioutil.WriteFile(a, []byte("a"), 0644))
+	require.NoError(t, ioutil.WriteFile(b, []byte("b"), 0644))
+	// under load the changes may be split across batches
+	ops := make(map[string]filewatch.Op)
+	for !ops[a].Has(filewatch.Create) || !ops[b].Has(filewatch.Create) {
+		for _, event := range nextBatch(t, batches) {
+			ops[event.Path] |= event.Op
+		}
+	}
+	assert.Len(t, ops, 2)
+
+	require.NoError(t, os.Remove(a))
+	events := nextBatch(t, batches)
+	require.Len(t, events, 1)
+	assert.Equal(t, a, events[0].Path)
+	assert.True(t, events[0].Op.Has(filewatch.Remove), events[0].Op.String())
+
+	// watches are stopped when the app is stopped
+	require.NoError(t, app.Stop(context.Background()))
+	require.NoError(t, ioutil.WriteFile(b, []byte("bb"), 0644))
+	assertNoBatch(t, batches)
+	_, err := watcher.Watch(dir, func([]filewatch.Event) {})
+	assert.Equal(t, filewatch.ErrStopped, err)
+}
+
+func TestWatcher_KubernetesVolume(t *testing.T) {
+	t.Parallel()
+
+	dir, cleanup := tempDir(t)
+	defer cleanup()
+	app, watcher := newTestApp(t)
+	defer app.Stop(context.Background())
+
+	// simulates how the kubelet projects ConfigMap keys, i.e., key -> ..data/key, ..data -> ..<timestamp>
+	update := func(version, value string) {
+		versionDir := filepath.Join(dir, version)
+		require.NoError(t, os.Mkdir(versionDir, 0755))
+		require.NoError(t, ioutil.WriteFile(filepath.Join(versionDir, "token"), []byte(value), 0644))
+		tmpLink := filepath.Join(dir, "..data_tmp")
+		require.NoError(t, os.Symlink(version, tmpLink))
+		require.NoError(t, os.Rename(tmpLink, filepath.Join(dir, "..data")))
+	}
+	update("..v1", "1")
+	path := filepath.Join(dir, "token")
+	require.NoError(t, os.Symlink(filepath.Join("..data", "token"), path))
+
+	batches, _ := watch(t, watcher, path)
+	update("..v2", "2")
+	nextBatch(t, batches)
+	value, err := ioutil.ReadFile(path)
+	require.NoError(t, err)
+	assert.Equal(t, "2", string(value))
+}
+
+func TestWatcher_Errors(t *testing.T) {
+	t.Parallel()
+
+	app, watcher := newTestApp(t)
+	defer app.Stop(context.Background())
+
+	_, err := watcher.Watch(os.TempDir(), nil)
+	assert.Equal(t, filewatch.ErrNilHandler, err)
+	_, err = watcher.Watch(filepath.Join(os.TempDir(), "does-not-exist", "config.json"), func([]filewatch.Event) {})
+	assert.Error(t, err, "the directory must exist")
+}
+
+func TestOp_String(t *testing.T) {
+	t.Parallel()
+
+	assert.Equal(t, "CREATE|WRITE", (filewatch.Create | filewatch.Write).String())
+	assert.Equal(t, "", filewatch.Op(0).String())
+}
@@ -0,0 +1,45 @@
+/*
+ * Copyright (c) 2019 OysterPack, Inc.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ * http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package filewatch
+
+import (
+	"context"
+	"github.com/rs/zerolog"
+	"go.uber.org/fx"
+)
+
+// Module provides the fx Module for the filewatch module, which provides the `Watcher`.
+//
+// The watcher runs as soon as it is constructed, i.e., app functions can register watches, and is stopped when the app
+// is stopped.
+//
+// The *zerolog.Logger must be provided by the app.
+func Module(opts Opts) fx.Option {
+	opts = opts.withDefaults()
+	return fx.Provide(func(lc fx.Lifecycle, logger *zerolog.Logger) (Watcher, error) {
+		w, err := newWatcher(opts, logger)
+		if err != nil {
+			return nil, err
+		}
+		lc.Append(fx.Hook{
+			OnStop: func(context.Context) error {
+				return w.close()
+			},
+		})
+		return w, nil
+	})
+}
@@ -0,0 +1,38 @@
+/*
+ * Copyright (c) 2019 OysterPack, Inc.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ * http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package filewatch
+
+import (
+	"time"
+)
+
+// DefaultDebounce is the default debounce duration
+const DefaultDebounce = 100 * time.Millisecond
+
+// Opts is used to configure the module
+type Opts struct {
+	// Debounce is how long to wait after the last change event before the batched events are delivered - defaults to
+	// DefaultDebounce
+	Debounce time.Duration
+}
+
+func (opts Opts) withDefaults() Opts {
+	if opts.Debounce <= 0 {
+		opts.Debounce = DefaultDebounce
+	}
+	return opts
+}
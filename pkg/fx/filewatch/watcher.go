@@ -0,0 +1,291 @@
+/*
+ * Copyright (c) 2019 OysterPack, Inc.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ * http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package filewatch
+
+import (
+	"errors"
+	"fmt"
+	"github.com/fsnotify/fsnotify"
+	"github.com/oysterpack/andiamo/pkg/eventlog"
+	"github.com/rs/zerolog"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+)
+
+// errors
+var (
+	ErrNilHandler = errors.New("watch handler must not be nil")
+	ErrStopped    = errors.New("file watcher has been stopped")
+)
+
+// Op describes the file change operations, which are combined into a bit mask
+type Op uint32
+
+// Ops
+const (
+	Create Op = 1 << iota
+	Write
+	Remove
+	Rename
+	Chmod
+)
+
+// Has returns true if the op includes the specified op
+func (op Op) Has(o Op) bool {
+	return op&o == o
+}
+
+func (op Op) String() string {
+	var ops []string
+	for _, o := range []struct {
+		op   Op
+		name string
+	}{{Create, "CREATE"}, {Write, "WRITE"}, {Remove, "REMOVE"}, {Rename, "RENAME"}, {Chmod, "CHMOD"}} {
+		if op.Has(o.op) {
+			ops = append(ops, o.name)
+		}
+	}
+	return strings.Join(ops, "|")
+}
+
+// Event is a file change event. Within a debounced batch, the ops for the same path are combined.
+type Event struct {
+	Path string
+	Op   Op
+}
+
+// Handler handles a debounced batch of change events, in the order that the paths were first changed. Handlers for
+// the same watch are not run concurrently.
+type Handler func(events []Event)
+
+// Watcher is used to watch files and directories for changes
+type Watcher interface {
+	// Watch watches the file or directory, i.e., the handler is notified when the file, or the directory's files, are
+	// created, written, removed, renamed, or their permissions change. The path's directory must exist, but the file
+	// does not need to exist yet.
+	//
+	// The returned function is used to stop watching.
+	Watch(path string, handler Handler) (stop func(), err error)
+}
+
+type watcher struct {
+	opts      Opts
+	fsWatcher *fsnotify.Watcher
+
+	logChanged, logError eventlog.Logger
+
+	mutex   sync.Mutex
+	watches map[*watch]bool
+	// watched directory reference counts
+	dirs    map[string]int
+	stopped bool
+	done    chan struct{}
+}
+
+func newWatcher(opts Opts, logger *zerolog.Logger) (*watcher, error) {
+	fsWatcher, err := fsnotify.NewWatcher()
+	if err != nil {
+		return nil, err
+	}
+	w := &watcher{
+		opts:       opts,
+		fsWatcher:  fsWatcher,
+		logChanged: eventlog.NewLogger(ChangedEvent, logger, zerolog.DebugLevel),
+		logError:   eventlog.NewLogger(WatchErrorEvent, logger, zerolog.ErrorLevel),
+		watches:    make(map[*watch]bool),
+		dirs:       make(map[string]int),
+		done:       make(chan struct{}),
+	}
+	go w.run()
+	return w, nil
+}
+
+func (w *watcher) Watch(path string, handler Handler) (func(), error) {
+	if handler == nil {
+		return nil, ErrNilHandler
+	}
+	path, err := filepath.Abs(path)
+	if err != nil {
+		return nil, err
+	}
+	wa := &watch{watcher: w, path: path, dir: path, handler: handler}
+	// files are watched via their directory, i.e., changes are detected when the file is replaced
+	if info, err := os.Stat(path); err != nil || !info.IsDir() {
+		wa.dir = filepath.Dir(path)
+		wa.file = true
+	}
+
+	w.mutex.Lock()
+	defer w.mutex.Unlock()
+	if w.stopped {
+		return nil, ErrStopped
+	}
+	if w.dirs[wa.dir] == 0 {
+		if err := w.fsWatcher.Add(wa.dir); err != nil {
+			return nil, fmt.Errorf("failed to watch : %s : %s", path, err)
+		}
+	}
+	w.dirs[wa.dir]++
+	w.watches[wa] = true
+	return wa.stop, nil
+}
+
+// run dispatches the fsnotify events until the fsnotify watcher is closed
+func (w *watcher) run() {
+	defer close(w.done)
+	for {
+		select {
+		case event, ok := <-w.fsWatcher.Events:
+			if !ok {
+				return
+			}
+			w.dispatch(Event{Path: event.Name, Op: Op(event.Op)})
+		case err, ok := <-w.fsWatcher.Errors:
+			if !ok {
+				return
+			}
+			w.logError(eventlog.NewError(err), "file watcher error")
+		}
+	}
+}
+
+func (w *watcher) dispatch(event Event) {
+	w.mutex.Lock()
+	defer w.mutex.Unlock()
+	for wa := range w.watches {
+		if wa.matches(event.Path) {
+			wa.add(event)
+		}
+	}
+}
+
+// unregister stops watching the directory when it is no longer referenced
+func (w *watcher) unregister(wa *watch) {
+	w.mutex.Lock()
+	defer w.mutex.Unlock()
+	if !w.watches[wa] {
+		return
+	}
+	delete(w.watches, wa)
+	w.dirs[wa.dir]--
+	if w.dirs[wa.dir] == 0 {
+		delete(w.dirs, wa.dir)
+		if !w.stopped {
+			w.fsWatcher.Remove(wa.dir)
+		}
+	}
+}
+
+// close stops all watches, and closes the fsnotify watcher
+func (w *watcher) close() error {
+	w.mutex.Lock()
+	if w.stopped {
+		w.mutex.Unlock()
+		return nil
+	}
+	w.stopped = true
+	watches := make([]*watch, 0, len(w.watches))
+	for wa := range w.watches {
+		watches = append(watches, wa)
+	}
+	w.mutex.Unlock()
+
+	for _, wa := range watches {
+		wa.stop()
+	}
+	err := w.fsWatcher.Close()
+	<-w.done
+	return err
+}
+
+type watch struct {
+	*watcher
+	path, dir string
+	file      bool
+	handler   Handler
+
+	mutex   sync.Mutex
+	pending []Event
+	timer   *time.Timer
+	stopped bool
+
+	// serializes the handler calls
+	handlerMutex sync.Mutex
+}
+
+func (wa *watch) matches(path string) bool {
+	if !wa.file {
+		return true
+	}
+	// k8s ConfigMap and Secret volumes are updated atomically by swapping the "..data" symlink
+	return path == wa.path || strings.HasPrefix(filepath.Base(path), "..")
+}
+
+// add adds the event to the pending batch, and resets the debounce timer
+func (wa *watch) add(event Event) {
+	wa.mutex.Lock()
+	defer wa.mutex.Unlock()
+	if wa.stopped {
+		return
+	}
+	merged := false
+	for i := range wa.pending {
+		if wa.pending[i].Path == event.Path {
+			wa.pending[i].Op |= event.Op
+			merged = true
+			break
+		}
+	}
+	if !merged {
+		wa.pending = append(wa.pending, event)
+	}
+	if wa.timer != nil {
+		wa.timer.Stop()
+	}
+	wa.timer = time.AfterFunc(wa.opts.Debounce, wa.flush)
+}
+
+// flush delivers the pending batch of events to the handler
+func (wa *watch) flush() {
+	wa.handlerMutex.Lock()
+	defer wa.handlerMutex.Unlock()
+
+	wa.mutex.Lock()
+	events := wa.pending
+	wa.pending = nil
+	stopped := wa.stopped
+	wa.mutex.Unlock()
+	if stopped || len(events) == 0 {
+		return
+	}
+	wa.logChanged(changed{path: wa.path, events: events}, "files changed")
+	wa.handler(events)
+}
+
+func (wa *watch) stop() {
+	wa.mutex.Lock()
+	wa.stopped = true
+	if wa.timer != nil {
+		wa.timer.Stop()
+	}
+	wa.pending = nil
+	wa.mutex.Unlock()
+	wa.unregister(wa)
+}
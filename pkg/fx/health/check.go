@@ -17,6 +17,7 @@
 package health
 
 import (
+	"context"
 	"time"
 )
 
@@ -55,6 +56,9 @@ const (
 const (
 	DefaultTimeout     = 5 * time.Second
 	DefaultRunInterval = 15 * time.Second
+
+	// DefaultShutdownTimeout is the default max amount of time to wait for in-flight health checks to complete on shutdown
+	DefaultShutdownTimeout = DefaultTimeout
 )
 
 // CheckerOpts is used to configure Checker run Module.
@@ -70,10 +74,25 @@ type CheckerOpts struct {
 //
 // NOTE: when a health check is registered the following augmentations are applied:
 //  - Check fields are trimmed during registration
-//  - Checker function is wrapped when registered to enforce the run timeout policy.
+//  - Checker function is wrapped when registered to enforce the run timeout policy, i.e., the checker context is
+//    canceled when the health check times out.
 //	- defaults are applied to CheckerOpts zero value fields
 type RegisteredCheck struct {
 	Check
 	CheckerOpts
 	Checker
 }
+
+// IgnoreContext adapts a checker that does not support context cancellation, and is meant to ease the migration of
+// existing checkers. When the context is done, the adapted checker's goroutine is orphaned until the checker returns -
+// see OrphanedCheckers.
+//
+// Deprecated: checkers should honor context cancellation
+func IgnoreContext(checker func() (Status, error)) func(ctx context.Context) (Status, error) {
+	if checker == nil {
+		return nil
+	}
+	return func(ctx context.Context) (Status, error) {
+		return checker()
+	}
+}
@@ -0,0 +1,225 @@
+/*
+ * Copyright (c) 2019 OysterPack, Inc.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ * http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package checkers_test
+
+import (
+	"context"
+	"crypto/tls"
+	"database/sql"
+	"database/sql/driver"
+	"errors"
+	"github.com/oysterpack/andiamo/pkg/fx/health"
+	"github.com/oysterpack/andiamo/pkg/fx/health/checkers"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"io/ioutil"
+	"math"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestTCPDial(t *testing.T) {
+	t.Parallel()
+
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	require.NoError(t, err)
+	address := l.Addr().String()
+
+	status, err := checkers.TCPDial(address)(context.Background())
+	assert.Equal(t, health.Green, status)
+	assert.NoError(t, err)
+
+	l.Close()
+	status, err = checkers.TCPDial(address)(context.Background())
+	assert.Equal(t, health.Red, status)
+	assert.Error(t, err)
+}
+
+func TestHTTPGet(t *testing.T) {
+	t.Parallel()
+
+	server := httptest.NewServer(http.HandlerFunc(func(writer http.ResponseWriter, request *http.Request) {
+		writer.WriteHeader(http.StatusNoContent)
+	}))
+	defer server.Close()
+
+	status, err := checkers.HTTPGet(nil, server.URL, http.StatusNoContent)(context.Background())
+	assert.Equal(t, health.Green, status)
+	assert.NoError(t, err)
+
+	status, err = checkers.HTTPGet(nil, server.URL, http.StatusOK)(context.Background())
+	assert.Equal(t, health.Red, status)
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), checkers.ErrUnexpectedHTTPStatus.Error())
+
+	t.Run("checker is canceled via context", func(t *testing.T) {
+		ctx, cancel := context.WithCancel(context.Background())
+		cancel()
+		status, err := checkers.HTTPGet(nil, server.URL, http.StatusNoContent)(ctx)
+		assert.Equal(t, health.Red, status)
+		assert.Error(t, err)
+	})
+}
+
+func TestDNSResolve(t *testing.T) {
+	t.Parallel()
+
+	status, err := checkers.DNSResolve(nil, "localhost")(context.Background())
+	assert.Equal(t, health.Green, status)
+	assert.NoError(t, err)
+
+	status, err = checkers.DNSResolve(nil, "host.invalid")(context.Background())
+	assert.Equal(t, health.Red, status)
+	assert.Error(t, err)
+}
+
+func TestFileExists(t *testing.T) {
+	t.Parallel()
+
+	dir, err := ioutil.TempDir("", "checkers")
+	require.NoError(t, err)
+	defer os.RemoveAll(dir)
+	file := filepath.Join(dir, "foo")
+	require.NoError(t, ioutil.WriteFile(file, []byte("foo"), 0644))
+
+	status, err := checkers.FileExists(file)(context.Background())
+	assert.Equal(t, health.Green, status)
+	assert.NoError(t, err)
+
+	status, err = checkers.FileExists(filepath.Join(dir, "bar"))(context.Background())
+	assert.Equal(t, health.Red, status)
+	assert.Error(t, err)
+
+	status, err = checkers.FileExists(dir)(context.Background())
+	assert.Equal(t, health.Red, status)
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), checkers.ErrNotRegularFile.Error())
+}
+
+func TestDiskFree(t *testing.T) {
+	t.Parallel()
+
+	dir := os.TempDir()
+	status, err := checkers.DiskFree(dir, 1, 0)(context.Background())
+	if err != nil && err == checkers.ErrDiskFreeUnsupported {
+		t.Skip(err)
+	}
+	assert.Equal(t, health.Green, status)
+	assert.NoError(t, err)
+
+	status, err = checkers.DiskFree(dir, math.MaxUint64, 0)(context.Background())
+	assert.Equal(t, health.Yellow, status)
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), checkers.ErrLowDiskSpace.Error())
+
+	status, err = checkers.DiskFree(dir, math.MaxUint64, math.MaxUint64)(context.Background())
+	assert.Equal(t, health.Red, status)
+	assert.Error(t, err)
+}
+
+func TestTLSCertExpiry(t *testing.T) {
+	t.Parallel()
+
+	server := httptest.NewTLSServer(http.HandlerFunc(func(writer http.ResponseWriter, request *http.Request) {}))
+	defer server.Close()
+	serverURL, err := url.Parse(server.URL)
+	require.NoError(t, err)
+	config := &tls.Config{RootCAs: server.Client().Transport.(*http.Transport).TLSClientConfig.RootCAs, ServerName: "example.com"}
+	expiresIn := time.Until(server.Certificate().NotAfter)
+
+	status, err := checkers.TLSCertExpiry(serverURL.Host, config, time.Hour, time.Minute)(context.Background())
+	assert.Equal(t, health.Green, status)
+	assert.NoError(t, err)
+
+	status, err = checkers.TLSCertExpiry(serverURL.Host, config, expiresIn+time.Hour, time.Minute)(context.Background())
+	assert.Equal(t, health.Yellow, status)
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), checkers.ErrCertExpiring.Error())
+
+	status, err = checkers.TLSCertExpiry(serverURL.Host, config, expiresIn+time.Hour, expiresIn+time.Hour)(context.Background())
+	assert.Equal(t, health.Red, status)
+	assert.Error(t, err)
+
+	t.Run("certificate is not trusted", func(t *testing.T) {
+		status, err := checkers.TLSCertExpiry(serverURL.Host, nil, time.Hour, time.Minute)(context.Background())
+		assert.Equal(t, health.Red, status)
+		assert.Error(t, err)
+	})
+}
+
+type pingDriver struct{}
+
+func (pingDriver) Open(name string) (driver.Conn, error) {
+	if name == "down" {
+		return nil, errors.New("database is down")
+	}
+	return pingConn{}, nil
+}
+
+type pingConn struct{}
+
+func (pingConn) Prepare(query string) (driver.Stmt, error) { return nil, errors.New("not supported") }
+func (pingConn) Close() error                              { return nil }
+func (pingConn) Begin() (driver.Tx, error)                 { return nil, errors.New("not supported") }
+func (pingConn) Ping(ctx context.Context) error            { return nil }
+
+func init() {
+	sql.Register("checkers_test", pingDriver{})
+}
+
+func TestSQLPing(t *testing.T) {
+	t.Parallel()
+
+	db, err := sql.Open("checkers_test", "up")
+	require.NoError(t, err)
+	defer db.Close()
+	status, err := checkers.SQLPing(db, "up")(context.Background())
+	assert.Equal(t, health.Green, status)
+	assert.NoError(t, err)
+
+	db, err = sql.Open("checkers_test", "down")
+	require.NoError(t, err)
+	defer db.Close()
+	status, err = checkers.SQLPing(db, "down")(context.Background())
+	assert.Equal(t, health.Red, status)
+	assert.Error(t, err)
+}
+
+func TestRegisterMetrics(t *testing.T) {
+	t.Parallel()
+
+	registry := prometheus.NewRegistry()
+	require.NoError(t, checkers.RegisterMetrics(registry))
+	checkers.FileExists(os.TempDir())(context.Background())
+
+	mfs, err := registry.Gather()
+	require.NoError(t, err)
+	var found bool
+	for _, mf := range mfs {
+		if mf.GetName() == checkers.CheckerDurationMetricID {
+			found = len(mf.Metric) > 0
+		}
+	}
+	assert.True(t, found, "checker durations should have been recorded")
+}
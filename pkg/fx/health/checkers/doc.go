@@ -0,0 +1,31 @@
+/*
+ * Copyright (c) 2019 OysterPack, Inc.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ * http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+// Package checkers provides reusable, parameterized health checkers, i.e., checker functions that can be registered
+// via health.Register:
+//   - TCPDial - verifies that a TCP connection can be established
+//   - HTTPGet - verifies that an HTTP GET request returns the expected status code
+//   - DNSResolve - verifies that a host name resolves
+//   - DiskFree - verifies that the file system has enough free space
+//   - FileExists - verifies that a file exists
+//   - TLSCertExpiry - verifies that the server's TLS certificate is not about to expire
+//   - SQLPing - verifies that the database is reachable
+//
+// The checkers honor context cancellation, i.e., they abort when the health check times out.
+//
+// The checkers are pre-instrumented: checker run durations are recorded in a histogram, which is labeled by checker
+// kind, target, and status. Use RegisterMetrics to register the checker metrics.
+package checkers
@@ -0,0 +1,30 @@
+/*
+ * Copyright (c) 2019 OysterPack, Inc.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ * http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package checkers
+
+import "github.com/pkg/errors"
+
+// package errors
+var (
+	ErrUnexpectedHTTPStatus = errors.New("unexpected HTTP status code")
+	ErrNoAddressesResolved  = errors.New("no addresses were resolved")
+	ErrLowDiskSpace         = errors.New("free disk space is below threshold")
+	ErrNotRegularFile       = errors.New("file is not a regular file")
+	ErrNoPeerCertificates   = errors.New("no TLS peer certificates")
+	ErrCertExpiring         = errors.New("TLS certificate is about to expire")
+	ErrDiskFreeUnsupported  = errors.New("disk free checker is not supported on this platform")
+)
@@ -0,0 +1,61 @@
+/*
+ * Copyright (c) 2019 OysterPack, Inc.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ * http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package checkers
+
+import (
+	"context"
+	"fmt"
+	"github.com/oysterpack/andiamo/pkg/fx/health"
+	"go.uber.org/multierr"
+	"os"
+)
+
+// FileExists returns a checker that verifies that the specified regular file exists.
+// The status is `Red` if the file does not exist or if it is not a regular file, e.g., a directory.
+func FileExists(path string) func(ctx context.Context) (health.Status, error) {
+	return instrument(FileExistsKind, path, func(ctx context.Context) (health.Status, error) {
+		info, err := os.Stat(path)
+		if err != nil {
+			return health.Red, err
+		}
+		if !info.Mode().IsRegular() {
+			return health.Red, multierr.Append(ErrNotRegularFile, fmt.Errorf("%s : %s", path, info.Mode()))
+		}
+		return health.Green, nil
+	})
+}
+
+// DiskFree returns a checker that verifies that the file system that contains the specified path has enough free
+// space available:
+//   - `Yellow` if the available bytes are below the yellow threshold
+//   - `Red` if the available bytes are below the red threshold
+func DiskFree(path string, yellowThreshold, redThreshold uint64) func(ctx context.Context) (health.Status, error) {
+	return instrument(DiskFreeKind, path, func(ctx context.Context) (health.Status, error) {
+		available, err := availableDiskSpace(path)
+		if err != nil {
+			return health.Red, err
+		}
+		switch {
+		case available < redThreshold:
+			return health.Red, multierr.Append(ErrLowDiskSpace, fmt.Errorf("%s : %d bytes available < %d", path, available, redThreshold))
+		case available < yellowThreshold:
+			return health.Yellow, multierr.Append(ErrLowDiskSpace, fmt.Errorf("%s : %d bytes available < %d", path, available, yellowThreshold))
+		default:
+			return health.Green, nil
+		}
+	})
+}
@@ -0,0 +1,53 @@
+/*
+ * Copyright (c) 2019 OysterPack, Inc.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ * http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package checkers
+
+import (
+	"context"
+	"fmt"
+	"github.com/oysterpack/andiamo/pkg/fx/health"
+	"go.uber.org/multierr"
+	"io"
+	"io/ioutil"
+	"net/http"
+)
+
+// HTTPGet returns a checker that sends an HTTP GET request to the specified URL and verifies that the response has the
+// expected status code. If the client is nil, then the default HTTP client is used.
+// The status is `Red` if the request fails or if the response status code is unexpected.
+func HTTPGet(client *http.Client, url string, expectedStatusCode int) func(ctx context.Context) (health.Status, error) {
+	if client == nil {
+		client = http.DefaultClient
+	}
+	return instrument(HTTPGetKind, url, func(ctx context.Context) (health.Status, error) {
+		request, err := http.NewRequest(http.MethodGet, url, nil)
+		if err != nil {
+			return health.Red, err
+		}
+		response, err := client.Do(request.WithContext(ctx))
+		if err != nil {
+			return health.Red, err
+		}
+		// drain the response body to enable the connection to be reused
+		io.Copy(ioutil.Discard, response.Body)
+		response.Body.Close()
+		if response.StatusCode != expectedStatusCode {
+			return health.Red, multierr.Append(ErrUnexpectedHTTPStatus, fmt.Errorf("%d != %d", response.StatusCode, expectedStatusCode))
+		}
+		return health.Green, nil
+	})
+}
@@ -0,0 +1,72 @@
+/*
+ * Copyright (c) 2019 OysterPack, Inc.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ * http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package checkers
+
+import (
+	"context"
+	"github.com/oysterpack/andiamo/pkg/fx/health"
+	"github.com/prometheus/client_golang/prometheus"
+	"time"
+)
+
+// checker metric IDs, which are used as the prometheus metric names
+const (
+	// histogram - seconds
+	CheckerDurationMetricID = "U01DHW2WQ402ARYNB5MA36EQZN3"
+)
+
+// checker metric labels
+const (
+	KindLabel   = "kind"
+	TargetLabel = "target"
+	StatusLabel = "status"
+)
+
+// checker kinds, which are used as the KindLabel value
+const (
+	TCPDialKind       = "tcp_dial"
+	HTTPGetKind       = "http_get"
+	DNSResolveKind    = "dns_resolve"
+	DiskFreeKind      = "disk_free"
+	FileExistsKind    = "file_exists"
+	TLSCertExpiryKind = "tls_cert_expiry"
+	SQLPingKind       = "sql_ping"
+)
+
+var checkerDurations = prometheus.NewHistogramVec(
+	prometheus.HistogramOpts{
+		Name:    CheckerDurationMetricID,
+		Help:    "health checker run duration in seconds",
+		Buckets: []float64{.001, .005, .01, .05, .1, .5, 1, 5, 10},
+	},
+	[]string{KindLabel, TargetLabel, StatusLabel},
+)
+
+// RegisterMetrics registers the checker metrics.
+func RegisterMetrics(registerer prometheus.Registerer) error {
+	return registerer.Register(checkerDurations)
+}
+
+// instrument records the checker run durations
+func instrument(kind, target string, checker func(ctx context.Context) (health.Status, error)) func(ctx context.Context) (health.Status, error) {
+	return func(ctx context.Context) (health.Status, error) {
+		start := time.Now()
+		status, err := checker(ctx)
+		checkerDurations.WithLabelValues(kind, target, status.String()).Observe(time.Since(start).Seconds())
+		return status, err
+	}
+}
@@ -0,0 +1,108 @@
+/*
+ * Copyright (c) 2019 OysterPack, Inc.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ * http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package checkers
+
+import (
+	"context"
+	"crypto/tls"
+	"fmt"
+	"github.com/oysterpack/andiamo/pkg/fx/health"
+	"go.uber.org/multierr"
+	"net"
+	"time"
+)
+
+// TCPDial returns a checker that verifies that a TCP connection can be established to the specified address.
+// The status is `Red` if the connection fails.
+func TCPDial(address string) func(ctx context.Context) (health.Status, error) {
+	return instrument(TCPDialKind, address, func(ctx context.Context) (health.Status, error) {
+		var dialer net.Dialer
+		conn, err := dialer.DialContext(ctx, "tcp", address)
+		if err != nil {
+			return health.Red, err
+		}
+		return health.Green, conn.Close()
+	})
+}
+
+// DNSResolve returns a checker that verifies that the specified host name resolves to at least 1 address.
+// If the resolver is nil, then the default resolver is used. The status is `Red` if the host name does not resolve.
+func DNSResolve(resolver *net.Resolver, host string) func(ctx context.Context) (health.Status, error) {
+	if resolver == nil {
+		resolver = net.DefaultResolver
+	}
+	return instrument(DNSResolveKind, host, func(ctx context.Context) (health.Status, error) {
+		addrs, err := resolver.LookupHost(ctx, host)
+		if err != nil {
+			return health.Red, err
+		}
+		if len(addrs) == 0 {
+			return health.Red, multierr.Append(ErrNoAddressesResolved, fmt.Errorf("host: %s", host))
+		}
+		return health.Green, nil
+	})
+}
+
+// TLSCertExpiry returns a checker that connects to the specified TLS address and verifies that the server's leaf
+// certificate does not expire soon:
+//   - `Yellow` if the certificate expires within the yellow threshold
+//   - `Red` if the certificate expires within the red threshold, or if the TLS handshake fails
+//
+// If the config is nil, then the default TLS config is used, i.e., the server's certificate chain is verified.
+func TLSCertExpiry(address string, config *tls.Config, yellowThreshold, redThreshold time.Duration) func(ctx context.Context) (health.Status, error) {
+	return instrument(TLSCertExpiryKind, address, func(ctx context.Context) (health.Status, error) {
+		var dialer net.Dialer
+		rawConn, err := dialer.DialContext(ctx, "tcp", address)
+		if err != nil {
+			return health.Red, err
+		}
+		defer rawConn.Close()
+		if deadline, ok := ctx.Deadline(); ok {
+			rawConn.SetDeadline(deadline)
+		}
+
+		tlsConfig := &tls.Config{}
+		if config != nil {
+			tlsConfig = config.Clone()
+		}
+		if tlsConfig.ServerName == "" {
+			host, _, err := net.SplitHostPort(address)
+			if err != nil {
+				return health.Red, err
+			}
+			tlsConfig.ServerName = host
+		}
+		conn := tls.Client(rawConn, tlsConfig)
+		if err := conn.Handshake(); err != nil {
+			return health.Red, err
+		}
+		certs := conn.ConnectionState().PeerCertificates
+		if len(certs) == 0 {
+			return health.Red, ErrNoPeerCertificates
+		}
+
+		expiresIn := time.Until(certs[0].NotAfter)
+		switch {
+		case expiresIn <= redThreshold:
+			return health.Red, multierr.Append(ErrCertExpiring, fmt.Errorf("certificate expires at: %s", certs[0].NotAfter))
+		case expiresIn <= yellowThreshold:
+			return health.Yellow, multierr.Append(ErrCertExpiring, fmt.Errorf("certificate expires at: %s", certs[0].NotAfter))
+		default:
+			return health.Green, nil
+		}
+	})
+}
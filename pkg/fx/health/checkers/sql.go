@@ -0,0 +1,35 @@
+/*
+ * Copyright (c) 2019 OysterPack, Inc.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ * http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package checkers
+
+import (
+	"context"
+	"database/sql"
+	"github.com/oysterpack/andiamo/pkg/fx/health"
+)
+
+// SQLPing returns a checker that pings the database. The target is used to label the checker metrics, e.g., the
+// database name - it must not contain any credentials.
+// The status is `Red` if the ping fails.
+func SQLPing(db *sql.DB, target string) func(ctx context.Context) (health.Status, error) {
+	return instrument(SQLPingKind, target, func(ctx context.Context) (health.Status, error) {
+		if err := db.PingContext(ctx); err != nil {
+			return health.Red, err
+		}
+		return health.Green, nil
+	})
+}
@@ -0,0 +1,195 @@
+/*
+ * Copyright (c) 2019 OysterPack, Inc.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ * http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package health
+
+import (
+	"context"
+	"fmt"
+	"github.com/oysterpack/andiamo/pkg/clock"
+	"go.uber.org/multierr"
+	"runtime/debug"
+	"sync"
+	"time"
+)
+
+// SubCheck is a named checker that is composed into a composite health check - see Composite
+type SubCheck struct {
+	// Name identifies the sub-check within the composite health check, e.g., the endpoint that is being checked
+	Name    string
+	Checker func(ctx context.Context) (Status, error)
+}
+
+// SubResult is a composite health check's sub-check result
+type SubResult struct {
+	Name   string
+	Status Status
+	// error should be nil if the status is `Green`
+	Err error
+	// Duration is how long it took for the sub-check to run
+	time.Duration
+}
+
+// Composite composes multiple sub-checks into a single checker. The sub-checks are run concurrently, and the composite
+// status is derived from the sub-check statuses:
+//   - `Green` if all sub-checks are `Green`
+//   - `Red` if any sub-check is `Red`
+//   - otherwise `Yellow`
+//
+// When the composite checker is registered, the sub-check results are reported via Result.SubResults.
+// If no sub-checks are specified, then nil is returned, i.e., the health check registration will fail.
+//
+// Use Cases:
+//   - check a dependency across several endpoints using a single health check
+func Composite(checks ...SubCheck) func(ctx context.Context) (Status, error) {
+	if len(checks) == 0 {
+		return nil
+	}
+	checks = append([]SubCheck(nil), checks...)
+	return func(ctx context.Context) (Status, error) {
+		results := make([]SubResult, len(checks))
+		var wg sync.WaitGroup
+		wg.Add(len(checks))
+		for i := range checks {
+			go func(i int) {
+				defer wg.Done()
+				results[i] = runSubCheck(ctx, subResultsClock(ctx), checks[i])
+			}(i)
+		}
+		wg.Wait()
+
+		recordSubResults(ctx, results)
+
+		status := Green
+		var err error
+		for _, result := range results {
+			if result.Status > status {
+				status = result.Status
+			}
+			err = multierr.Append(err, result.Err)
+		}
+		return status, err
+	}
+}
+
+func runSubCheck(ctx context.Context, clock clock.Clock, check SubCheck) SubResult {
+	if check.Checker == nil {
+		return SubResult{
+			Name:   check.Name,
+			Status: Red,
+			Err:    fmt.Errorf("sub-check failed: %s : %s", check.Name, ErrNilChecker),
+		}
+	}
+	start := clock.Now()
+	status, err := runSubChecker(ctx, check.Checker)
+	result := SubResult{
+		Name:     check.Name,
+		Status:   status,
+		Duration: clock.Since(start),
+	}
+	if status != Green {
+		result.Err = multierr.Append(fmt.Errorf("sub-check failed: %s : %s", check.Name, status), err)
+	}
+	return result
+}
+
+// sub-check panics are recovered because they run in their own goroutines, i.e., the health service cannot recover them
+func runSubChecker(ctx context.Context, checker func(ctx context.Context) (Status, error)) (status Status, err error) {
+	defer func() {
+		if p := recover(); p != nil {
+			status = Red
+			if recorder, ok := ctx.Value(resultRecorderContextKey{}).(*resultRecorder); ok {
+				err = recorder.recordPanic(p)
+				return
+			}
+			err = fmt.Errorf("%s : %v", ErrCheckerPanic, p)
+		}
+	}()
+	return checker(ctx)
+}
+
+type resultRecorderContextKey struct{}
+
+// resultRecorder is used by checkers to report result data to the health service via the checker context, i.e., composite
+// checkers report their sub-check results, and checkers report result details - see SetDetail
+type resultRecorder struct {
+	// used to measure the sub-check durations
+	clock   clock.Clock
+	results []SubResult
+
+	mutex   sync.Mutex
+	details map[string]interface{}
+	panics  uint64
+}
+
+func withResultRecorder(ctx context.Context, recorder *resultRecorder) context.Context {
+	return context.WithValue(ctx, resultRecorderContextKey{}, recorder)
+}
+
+func (r *resultRecorder) setDetail(key string, value interface{}) {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+	if r.details == nil {
+		r.details = make(map[string]interface{})
+	}
+	r.details[key] = value
+}
+
+// recordPanic records the recovered panic, i.e., the panic is counted and the stack trace is reported via the result
+// details. The returned error wraps ErrCheckerPanic.
+//
+// NOTE: it must be called from the deferred function that recovered the panic in order to capture the panic stack trace
+func (r *resultRecorder) recordPanic(p interface{}) error {
+	r.setDetail(DetailPanicStack, string(debug.Stack()))
+	r.mutex.Lock()
+	r.panics++
+	r.mutex.Unlock()
+	return fmt.Errorf("%s : %v", ErrCheckerPanic, p)
+}
+
+func (r *resultRecorder) panicCount() uint64 {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+	return r.panics
+}
+
+// returns a copy of the details, i.e., checkers may still be running, e.g., orphaned checkers
+func (r *resultRecorder) detailsSnapshot() map[string]interface{} {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+	if len(r.details) == 0 {
+		return nil
+	}
+	details := make(map[string]interface{}, len(r.details))
+	for k, v := range r.details {
+		details[k] = v
+	}
+	return details
+}
+
+// subResultsClock returns the health service clock, if the composite checker is being run by the health service
+func subResultsClock(ctx context.Context) clock.Clock {
+	if recorder, ok := ctx.Value(resultRecorderContextKey{}).(*resultRecorder); ok && recorder.clock != nil {
+		return recorder.clock
+	}
+	return clock.Real()
+}
+
+func recordSubResults(ctx context.Context, results []SubResult) {
+	if recorder, ok := ctx.Value(resultRecorderContextKey{}).(*resultRecorder); ok {
+		recorder.results = results
+	}
+}
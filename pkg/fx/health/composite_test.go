@@ -0,0 +1,95 @@
+/*
+ * Copyright (c) 2019 OysterPack, Inc.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ * http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package health_test
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"github.com/oysterpack/andiamo/pkg/fx/health"
+	"github.com/oysterpack/andiamo/pkg/ulids"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.uber.org/fx"
+	"testing"
+	"time"
+)
+
+func TestComposite(t *testing.T) {
+	t.Parallel()
+
+	checker := func(status health.Status) func(ctx context.Context) (health.Status, error) {
+		return func(ctx context.Context) (health.Status, error) {
+			if status == health.Green {
+				return status, nil
+			}
+			return status, errors.New(status.String())
+		}
+	}
+
+	var shutdowner fx.Shutdowner
+	var register health.Register
+	var runCheckNow health.RunCheckNow
+	app := fx.New(
+		health.Module(health.DefaultOpts()),
+		fx.Populate(&shutdowner, &register, &runCheckNow),
+	)
+	require.Nil(t, app.Err(), "app initialization failed : %v", app.Err())
+
+	runApp(t, app, shutdowner, func() {
+		testCases := []struct {
+			name     string
+			statuses []health.Status
+			expected health.Status
+		}{
+			{"all sub-checks are Green", []health.Status{health.Green, health.Green}, health.Green},
+			{"1 sub-check is Yellow", []health.Status{health.Green, health.Yellow}, health.Yellow},
+			{"1 sub-check is Red", []health.Status{health.Yellow, health.Red, health.Green}, health.Red},
+		}
+		for _, testCase := range testCases {
+			var subChecks []health.SubCheck
+			for i, status := range testCase.statuses {
+				subChecks = append(subChecks, health.SubCheck{Name: fmt.Sprintf("endpoint-%d", i), Checker: checker(status)})
+			}
+			check := health.Check{ID: ulids.MustNew().String(), Description: "Foo", RedImpact: "App is unusable"}
+			require.NoError(t, register(check, health.CheckerOpts{RunInterval: time.Hour}, health.Composite(subChecks...)))
+
+			result, err := runCheckNow(check.ID)
+			require.NoError(t, err)
+			assert.Equal(t, testCase.expected, result.Status, testCase.name)
+			if testCase.expected == health.Green {
+				assert.NoError(t, result.Err, testCase.name)
+			} else {
+				assert.Error(t, result.Err, testCase.name)
+			}
+			// Then the sub-check results are reported in the order the sub-checks were specified
+			require.Len(t, result.SubResults, len(testCase.statuses), testCase.name)
+			for i, subResult := range result.SubResults {
+				assert.Equal(t, subChecks[i].Name, subResult.Name)
+				assert.Equal(t, testCase.statuses[i], subResult.Status)
+				assert.Equal(t, subResult.Status != health.Green, subResult.Err != nil)
+			}
+		}
+
+		t.Run("composite with no sub-checks cannot be registered", func(t *testing.T) {
+			check := health.Check{ID: ulids.MustNew().String(), Description: "Foo", RedImpact: "App is unusable"}
+			err := register(check, health.CheckerOpts{}, health.Composite())
+			require.Error(t, err)
+			assert.Contains(t, err.Error(), health.ErrNilChecker.Error())
+		})
+	})
+}
@@ -19,11 +19,30 @@
 // Health check status can be `Green`, `Yellow`, or `Red`. A yellow status indicates that health check aspect is still
 // functional but may be under stress, experiencing degraded performance, close to resource constraints, etc.
 //
-// When health checks are registered, they are scheduled to run on a periodic basis. The max number of health checks that
-// can be run concurrently is configurable as a module option.
+// When health checks are registered, they are scheduled to run on a periodic basis. The run interval is measured from the
+// scheduled run time, i.e., the health check execution time does not cause the schedule to drift. Scheduled and on demand
+// health check runs share a run queue, which limits the max number of health checks that can be run concurrently, which
+// is configurable as a module option. When max parallelism is saturated, health check runs are queued and dispatched
+// round-robin across health check families, where the family is the health check's first tag - see `RunQueueStats`.
 //
 // The health check is configured with a timeout. If the health check times out, then it is considered a `Red` failure.
-// Health checks should be designed to run as fast as possible.
+// Health checks should be designed to run as fast as possible. The checker context is canceled when the health check
+// times out or when the health service is shutdown. Checkers must honor the context - checkers that ignore the context
+// are orphaned until they return, which is tracked via OrphanedCheckers.
+//
+// Checker panics, including composite sub-check panics, are recovered, i.e., a buggy checker cannot crash the app. The
+// panic is reported as a Red result, the panic stack trace is reported via the result details, and panics are counted
+// per health check - see CheckerPanics.
+//
+// Health check scheduling, timeouts, and durations are measured using the `clock.Clock` that is provided via dependency
+// injection. If no clock is provided, then the real clock is used. Tests can provide a fake clock to advance time
+// deterministically instead of sleeping - see `clock.NewFake()`.
+//
+// Multiple checkers can be composed into a single health check via Composite, e.g., to check a dependency across several
+// endpoints. The sub-check results are reported via Result.SubResults.
+//
+// Checkers can report structured failure metadata, e.g., latency, endpoint, attempted host, or error class, via SetDetail.
+// The details are reported via Result.Details.
 //
 // The latest health check results are cached.
 // Interested parties can subscribe for the following health check events:
@@ -31,6 +50,14 @@
 //  - health check results
 //  - overall health status changes
 //
+// Messages are buffered per subscription, i.e., slow subscribers do not block the health service or other subscribers.
+// When a subscription buffer is full, the oldest message is dropped and the subscription overflow counter is incremented.
+// Subscriptions should be closed when they are no longer needed.
+//
+// When the module is stopped, the health service waits for in-flight health checks to complete (up to the configured
+// shutdown timeout) and publishes their results. Subscriptions are then drained and closed, i.e., subscribers should
+// receive messages until the subscription channel is closed.
+//
 // TODO:
 // 1. health check http API
 // 2. health check grpc API
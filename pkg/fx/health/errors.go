@@ -29,6 +29,18 @@ var (
 	ErrTimeout = errors.New("health check timed out")
 
 	ErrContextTimout = errors.New("context timed out")
+
+	// ErrInFlightChecksAbandoned is returned on shutdown when in-flight health checks did not complete before the
+	// shutdown timeout
+	ErrInFlightChecksAbandoned = errors.New("in-flight health checks did not complete before the shutdown timeout")
+
+	// ErrCheckNotRegistered indicates the health check is not registered, e.g., when trying to unregister or run a health
+	// check that is not registered. The error is reported via CheckNotRegisteredError, i.e., use `errors.Is()` to check
+	// for it.
+	ErrCheckNotRegistered = errors.New("health check is not registered")
+
+	// ErrCheckerPanic indicates the health checker panicked - the panic is recovered and reported as a Red result
+	ErrCheckerPanic = errors.New("health checker panicked")
 )
 
 // health check registration errors validation errors
@@ -42,3 +54,18 @@ var (
 	ErrRunTimeoutTooHigh      = fmt.Errorf("health check run timeout is too high - max allowed timeout is %s", MaxTimeout)
 	ErrRunIntervalTooFrequent = fmt.Errorf("health check run interval is too frequent - min allowed run interval is %s", MinRunInterval)
 )
+
+// CheckNotRegisteredError is returned when the health check is not registered. It matches ErrCheckNotRegistered via
+// `errors.Is()`, i.e., even if the error is wrapped.
+type CheckNotRegisteredError struct {
+	ID string
+}
+
+func (e CheckNotRegisteredError) Error() string {
+	return fmt.Sprintf("%s : %s", ErrCheckNotRegistered, e.ID)
+}
+
+// Is returns true if the target is ErrCheckNotRegistered
+func (e CheckNotRegisteredError) Is(target error) bool {
+	return target == ErrCheckNotRegistered
+}
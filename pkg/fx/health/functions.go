@@ -16,11 +16,52 @@
 
 package health
 
+import "context"
+
 // Register is used to register health checks.
-type Register func(check Check, opts CheckerOpts, checker func() (Status, error)) error
+//
+// The checker's context is canceled when the health check times out or when the health service is shutdown. Checkers
+// must honor the context, i.e., they should abort and return as soon as possible when the context is done. Otherwise,
+// the checker goroutine is orphaned until the checker returns - see OrphanedCheckers.
+type Register func(check Check, opts CheckerOpts, checker func(ctx context.Context) (Status, error)) error
+
+// Unregister is used to unregister health checks, e.g., when the component that registered the health check is stopped.
+// When the health check is unregistered, it is no longer run and its latest result is removed. If the health check is not
+// registered, then a CheckNotRegisteredError is returned.
+type Unregister func(id string) error
+
+// RunCheckNow runs the specified health check immediately, outside of its schedule, and returns the result.
+// The result is cached and published to subscribers, just like the results of scheduled runs. If the health check is not
+// registered, then a CheckNotRegisteredError is returned.
+//
+// Use Cases:
+//  - verify that a health check has recovered after fixing a dependency without waiting for the next scheduled run
+type RunCheckNow func(id string) (Result, error)
+
+// RunQueueStats returns the health check run queue stats.
+//
+// Use Cases:
+//  - metrics - to monitor whether health checks are being delayed because the max check parallelism is saturated
+type RunQueueStats func() QueueStats
+
+// OrphanedCheckers returns the number of checker goroutines that are still running after their context was done, i.e.,
+// checkers that do not honor context cancellation.
+//
+// Use Cases:
+//  - metrics - to track checkers that need to be migrated to honor context cancellation, e.g., checkers that are
+//    adapted via IgnoreContext
+type OrphanedCheckers func() int
+
+// CheckerPanics returns the number of recovered checker panics per health check ID. Checker panics, including composite
+// sub-check panics, are reported as Red results - see ErrCheckerPanic.
+//
+// Use Cases:
+//  - metrics - to alert on buggy checkers
+type CheckerPanics func() map[string]uint64
 
-// RegisteredChecks returns all registered Checks
-type RegisteredChecks func() <-chan []RegisteredCheck
+// RegisteredChecks returns the registered Checks that match the query in registration order, unless the query sorts by
+// ID. The zero value query returns all registered Checks.
+type RegisteredChecks func(query Query) <-chan []RegisteredCheck
 
 // SubscribeForRegisteredChecks is used to subscribe for health check registrations
 //
@@ -28,8 +69,10 @@ type RegisteredChecks func() <-chan []RegisteredCheck
 //  - logging - log the registered health checks
 type SubscribeForRegisteredChecks func() RegisteredCheckSubscription
 
-// CheckResults returns all current health check results that match the specified filter
-type CheckResults func(filter func(result Result) bool) <-chan []Result
+// CheckResults returns the current health check results that match the specified filter and query in registration order,
+// unless the query sorts by ID. The filter is optional, i.e., nil matches all results. The zero value query applies no
+// additional filters and no pagination.
+type CheckResults func(filter func(result Result) bool, query Query) <-chan []Result
 
 // SubscribeForCheckResults is used to subscribe to health check results that match the specified filter
 type SubscribeForCheckResults func(filter func(result Result) bool) CheckResultsSubscription
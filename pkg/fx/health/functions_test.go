@@ -18,6 +18,7 @@ package health_test
 
 import (
 	"context"
+	stderrors "errors"
 	"fmt"
 	"github.com/oklog/ulid"
 	"github.com/oysterpack/andiamo/pkg/fx/health"
@@ -26,7 +27,9 @@ import (
 	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/require"
 	"go.uber.org/fx"
+	"math"
 	"runtime"
+	"sort"
 	"strings"
 	"sync/atomic"
 	"testing"
@@ -55,7 +58,7 @@ func TestRegister(t *testing.T) {
 			health.Module(health.DefaultOpts()),
 			fx.Invoke(
 				func(register health.Register) error {
-					return register(Foo, health.CheckerOpts{}, func() (health.Status, error) {
+					return register(Foo, health.CheckerOpts{}, func(ctx context.Context) (health.Status, error) {
 						return health.Green, nil
 					})
 				},
@@ -74,7 +77,7 @@ func TestRegister(t *testing.T) {
 			fx.Invoke(
 				func(register health.Register) error {
 					InvalidHealthCheck := health.Check{}
-					return register(InvalidHealthCheck, health.CheckerOpts{}, func() (health.Status, error) {
+					return register(InvalidHealthCheck, health.CheckerOpts{}, func(ctx context.Context) (health.Status, error) {
 						return health.Green, nil
 					})
 				},
@@ -99,7 +102,7 @@ func TestRegister(t *testing.T) {
 						YellowImpact: "App performance degradation",
 						Tags:         []string{Database, "INVALID"},
 					}
-					return register(InvalidHealthCheck, health.CheckerOpts{}, func() (health.Status, error) {
+					return register(InvalidHealthCheck, health.CheckerOpts{}, func(ctx context.Context) (health.Status, error) {
 						return health.Green, nil
 					})
 				},
@@ -133,7 +136,7 @@ func TestRegister(t *testing.T) {
 			health.Module(health.DefaultOpts()),
 			fx.Invoke(
 				func(register health.Register) error {
-					return register(Foo, health.CheckerOpts{Timeout: time.Minute, RunInterval: time.Millisecond}, func() (health.Status, error) {
+					return register(Foo, health.CheckerOpts{Timeout: time.Minute, RunInterval: time.Millisecond}, func(ctx context.Context) (health.Status, error) {
 						return health.Green, nil
 					})
 				},
@@ -151,12 +154,12 @@ func TestRegister(t *testing.T) {
 			health.Module(health.DefaultOpts()),
 			fx.Invoke(
 				func(register health.Register) error {
-					return register(Foo, health.CheckerOpts{}, func() (health.Status, error) {
+					return register(Foo, health.CheckerOpts{}, func(ctx context.Context) (health.Status, error) {
 						return health.Green, nil
 					})
 				},
 				func(register health.Register) error {
-					return register(Foo, health.CheckerOpts{}, func() (health.Status, error) {
+					return register(Foo, health.CheckerOpts{}, func(ctx context.Context) (health.Status, error) {
 						return health.Green, nil
 					})
 				},
@@ -189,12 +192,12 @@ func TestRegister(t *testing.T) {
 			fx.Invoke(
 				func(register health.Register) error {
 					// And CheckerOpts were not specified
-					return register(Foo, health.CheckerOpts{}, func() (health.Status, error) {
+					return register(Foo, health.CheckerOpts{}, func(ctx context.Context) (health.Status, error) {
 						return health.Green, nil
 					})
 				},
 				func(getRegisteredChecks health.RegisteredChecks) error {
-					checks := <-getRegisteredChecks()
+					checks := <-getRegisteredChecks(health.Query{})
 					switch len(checks) {
 					case 0:
 						return errors.New("*** no registered health checks were returned")
@@ -264,7 +267,7 @@ func TestRegisteredChecks(t *testing.T) {
 							YellowImpact: fmt.Sprintf("Yellow %d", i),
 							Tags:         []string{Database, MongoDB},
 						}
-						if err := register(check, health.CheckerOpts{}, func() (health.Status, error) {
+						if err := register(check, health.CheckerOpts{}, func(ctx context.Context) (health.Status, error) {
 							return health.Green, nil
 						}); err != nil {
 							return err
@@ -274,7 +277,7 @@ func TestRegisteredChecks(t *testing.T) {
 					return nil
 				},
 				func(getRegisteredChecks health.RegisteredChecks) error {
-					checks := <-getRegisteredChecks()
+					checks := <-getRegisteredChecks(health.Query{})
 					switch len(checks) {
 					case 0:
 						return errors.New("*** no registered health checks were returned")
@@ -297,6 +300,151 @@ func TestRegisteredChecks(t *testing.T) {
 
 }
 
+func TestUnregister(t *testing.T) {
+	t.Parallel()
+
+	var Foo = health.Check{
+		ID:          "01DHA2X3YZG0P5C0R2F4M8BK5T",
+		Description: "Foo",
+		RedImpact:   "App is unusable",
+	}
+
+	// Bar is scheduled to run on the same schedule as Foo, i.e., when Bar runs, Foo would have run if it were registered
+	var Bar = health.Check{
+		ID:          "01DHA2X3YZG0P5C0R2F4M8BK5V",
+		Description: "Bar",
+		RedImpact:   "App is unusable",
+	}
+
+	fakeClock := newFakeClock()
+	var shutdowner fx.Shutdowner
+	var register health.Register
+	var unregister health.Unregister
+	var registeredChecks health.RegisteredChecks
+	var checkResults health.CheckResults
+	var overallHealth health.OverallHealth
+	var subscribe health.SubscribeForCheckResults
+	app := fx.New(
+		health.Module(health.DefaultOpts()),
+		provideClock(fakeClock),
+		fx.Populate(&shutdowner, &register, &unregister, &registeredChecks, &checkResults, &overallHealth, &subscribe),
+	)
+	require.Nil(t, app.Err(), "app initialization failed : %v", app.Err())
+
+	runApp(t, app, shutdowner, func() {
+		fooResults := subscribe(func(result health.Result) bool { return result.ID == Foo.ID })
+		defer fooResults.Close()
+		barResults := subscribe(func(result health.Result) bool { return result.ID == Bar.ID })
+		defer barResults.Close()
+
+		var runCount int32
+		err := register(Foo, health.CheckerOpts{RunInterval: health.MinRunInterval}, func(ctx context.Context) (health.Status, error) {
+			atomic.AddInt32(&runCount, 1)
+			return health.Red, errors.New("BOOM")
+		})
+		require.NoError(t, err)
+		// wait for the health check to run
+		<-fooResults.Chan()
+		require.Equal(t, health.Red, overallHealth())
+		require.NoError(t, register(Bar, health.CheckerOpts{RunInterval: health.MinRunInterval}, func(ctx context.Context) (health.Status, error) {
+			return health.Green, nil
+		}))
+		<-barResults.Chan()
+
+		// When the health check is unregistered
+		require.NoError(t, unregister(Foo.ID))
+		// Then it is no longer registered
+		checks := <-registeredChecks(health.Query{})
+		require.Len(t, checks, 1)
+		assert.Equal(t, Bar.ID, checks[0].ID)
+		// And its result is removed
+		assert.Empty(t, <-checkResults(func(result health.Result) bool { return result.ID == Foo.ID }, health.Query{}))
+		// And the overall health is updated
+		assert.Equal(t, health.Green, overallHealth())
+		// And the health check is no longer scheduled to run
+		count := atomic.LoadInt32(&runCount)
+		fakeClock.Advance(health.MinRunInterval)
+		<-barResults.Chan()
+		assert.Equal(t, count, atomic.LoadInt32(&runCount))
+
+		t.Run("unregister health check that is not registered", func(t *testing.T) {
+			err := unregister(Foo.ID)
+			require.Error(t, err)
+			assert.True(t, stderrors.Is(err, health.ErrCheckNotRegistered))
+			assert.True(t, stderrors.Is(fmt.Errorf("wrapped : %w", err), health.ErrCheckNotRegistered))
+			assert.Equal(t, health.CheckNotRegisteredError{ID: Foo.ID}, err)
+		})
+
+		t.Run("health check can be registered again", func(t *testing.T) {
+			assert.NoError(t, register(Foo, health.CheckerOpts{}, func(ctx context.Context) (health.Status, error) {
+				return health.Green, nil
+			}))
+		})
+	})
+}
+
+func TestRunCheckNow(t *testing.T) {
+	t.Parallel()
+
+	var Foo = health.Check{
+		ID:          "01DHQ1V7ZB4N8T3GJ5X0R2KM6W",
+		Description: "Foo",
+		RedImpact:   "App is unusable",
+	}
+
+	var shutdowner fx.Shutdowner
+	var register health.Register
+	var runCheckNow health.RunCheckNow
+	var checkResults health.CheckResults
+	var overallHealth health.OverallHealth
+	var subscribe health.SubscribeForCheckResults
+	app := fx.New(
+		health.Module(health.DefaultOpts()),
+		provideClock(newFakeClock()),
+		fx.Populate(&shutdowner, &register, &runCheckNow, &checkResults, &overallHealth, &subscribe),
+	)
+	require.Nil(t, app.Err(), "app initialization failed : %v", app.Err())
+
+	runApp(t, app, shutdowner, func() {
+		results := subscribe(nil)
+		defer results.Close()
+		var fixed int32
+		// the health check is scheduled to run hourly
+		err := register(Foo, health.CheckerOpts{RunInterval: time.Hour}, func(ctx context.Context) (health.Status, error) {
+			if atomic.LoadInt32(&fixed) == 1 {
+				return health.Green, nil
+			}
+			return health.Red, errors.New("BOOM")
+		})
+		require.NoError(t, err)
+		// wait for the health check to run
+		<-results.Chan()
+		require.Equal(t, health.Red, overallHealth())
+
+		// When the dependency is fixed
+		atomic.StoreInt32(&fixed, 1)
+		// And the health check is run on demand
+		result, err := runCheckNow(Foo.ID)
+		// Then the health check result is returned
+		require.NoError(t, err)
+		assert.Equal(t, Foo.ID, result.ID)
+		assert.Equal(t, health.Green, result.Status)
+		assert.NoError(t, result.Err)
+		// And the result is published, and cached, which updates the overall health
+		assert.Equal(t, health.Green, (<-results.Chan()).Status)
+		assert.Equal(t, health.Green, overallHealth())
+		cached := <-checkResults(nil, health.Query{})
+		require.Len(t, cached, 1)
+		assert.Equal(t, health.Green, cached[0].Status)
+
+		t.Run("run health check that is not registered", func(t *testing.T) {
+			_, err := runCheckNow(ulids.MustNew().String())
+			require.Error(t, err)
+			assert.True(t, stderrors.Is(err, health.ErrCheckNotRegistered))
+		})
+	})
+}
+
 func TestSubscribeForRegisteredChecks(t *testing.T) {
 	t.Parallel()
 
@@ -322,7 +470,7 @@ func TestSubscribeForRegisteredChecks(t *testing.T) {
 						YellowImpact: fmt.Sprintf("Yellow %d", i),
 						Tags:         []string{Database, MongoDB},
 					}
-					if err := register(check, health.CheckerOpts{}, func() (health.Status, error) {
+					if err := register(check, health.CheckerOpts{}, func(ctx context.Context) (health.Status, error) {
 						return health.Green, nil
 					}); err != nil {
 						return err
@@ -351,9 +499,13 @@ func TestSubscribeForRegisteredChecks(t *testing.T) {
 
 func TestCheckResults(t *testing.T) {
 	var shutdowner fx.Shutdowner
+	var resultsSubscription health.CheckResultsSubscription
 	app := fx.New(
 		health.Module(health.DefaultOpts()),
 		fx.Invoke(
+			func(subscribe health.SubscribeForCheckResults) {
+				resultsSubscription = subscribe(nil)
+			},
 			func(register health.Register) error {
 				for i := 0; i < 10; i++ {
 					check := health.Check{
@@ -362,7 +514,7 @@ func TestCheckResults(t *testing.T) {
 						RedImpact:    fmt.Sprintf("Red %d", i),
 						YellowImpact: fmt.Sprintf("Yellow %d", i),
 					}
-					if err := register(check, health.CheckerOpts{}, func() (health.Status, error) {
+					if err := register(check, health.CheckerOpts{}, func(ctx context.Context) (health.Status, error) {
 						return health.Green, nil
 					}); err != nil {
 						return err
@@ -371,16 +523,12 @@ func TestCheckResults(t *testing.T) {
 				return nil
 			},
 			func(registeredChecks health.RegisteredChecks, checkResults health.CheckResults) error {
-				for {
-					results := <-checkResults(nil)
-					if len(results) == 10 {
-						break
-					}
-					t.Logf("waiting for results: count = %v", len(results))
-					runtime.Gosched()
-					time.Sleep(time.Millisecond)
+				// wait for the health checks to run
+				for i := 0; i < 10; i++ {
+					<-resultsSubscription.Chan()
 				}
-				checks := <-registeredChecks()
+				resultsSubscription.Close()
+				checks := <-registeredChecks(health.Query{})
 				if len(checks) != 10 {
 					return fmt.Errorf("failed to retrieve all registered health checks: %v", len(checks))
 				}
@@ -389,7 +537,7 @@ func TestCheckResults(t *testing.T) {
 				for _, check := range checks {
 					results := <-checkResults(func(result health.Result) bool {
 						return result.ID == check.ID
-					})
+					}, health.Query{})
 					for _, result := range results {
 						if result.ID == check.ID {
 							continue CHECK_LOOP
@@ -407,6 +555,124 @@ func TestCheckResults(t *testing.T) {
 	runApp(t, app, shutdowner)
 }
 
+func TestQuery(t *testing.T) {
+	t.Parallel()
+
+	const (
+		Database = "01DFGP2MJB9B8BMWA6Q2H4JD9Z"
+		MongoDB  = "01DFGP3TS31D016DHS9415JFBB"
+	)
+	statuses := []health.Status{health.Green, health.Yellow, health.Red, health.Green, health.Red}
+	var ids []string
+	var shutdowner fx.Shutdowner
+	var registeredChecks health.RegisteredChecks
+	var checkResults health.CheckResults
+	var resultsSubscription health.CheckResultsSubscription
+	app := fx.New(
+		health.Module(health.DefaultOpts()),
+		fx.Invoke(
+			func(subscribe health.SubscribeForCheckResults) {
+				resultsSubscription = subscribe(nil)
+			},
+			func(register health.Register) error {
+				for i, status := range statuses {
+					status := status
+					check := health.Check{
+						ID:          ulids.MustNew().String(),
+						Description: fmt.Sprintf("Desc %d", i),
+						RedImpact:   fmt.Sprintf("Red %d", i),
+						Tags:        []string{Database},
+					}
+					if i%2 == 0 {
+						check.Tags = append(check.Tags, MongoDB)
+					}
+					ids = append(ids, check.ID)
+					if err := register(check, health.CheckerOpts{}, func(ctx context.Context) (health.Status, error) {
+						return status, nil
+					}); err != nil {
+						return err
+					}
+				}
+				return nil
+			},
+		),
+		fx.Populate(&shutdowner, &registeredChecks, &checkResults),
+	)
+	require.Nil(t, app.Err(), "app initialization failed : %v", app.Err())
+
+	checkIDs := func(checks []health.RegisteredCheck) []string {
+		result := make([]string, 0, len(checks))
+		for _, check := range checks {
+			result = append(result, check.ID)
+		}
+		return result
+	}
+	resultIDs := func(results []health.Result) []string {
+		result := make([]string, 0, len(results))
+		for _, r := range results {
+			result = append(result, r.ID)
+		}
+		return result
+	}
+
+	runApp(t, app, shutdowner, func() {
+		// wait for the health checks to run
+		for range statuses {
+			<-resultsSubscription.Chan()
+		}
+		resultsSubscription.Close()
+
+		// the zero value query matches all health checks in registration order
+		assert.Equal(t, ids, checkIDs(<-registeredChecks(health.Query{})))
+		assert.Equal(t, ids, resultIDs(<-checkResults(nil, health.Query{})))
+
+		sortedIDs := append([]string(nil), ids...)
+		sort.Strings(sortedIDs)
+		tests := []struct {
+			name  string
+			query health.Query
+			ids   []string
+		}{
+			{"status", health.Query{Statuses: []health.Status{health.Red}}, []string{ids[2], ids[4]}},
+			{"statuses", health.Query{Statuses: []health.Status{health.Yellow, health.Red}}, []string{ids[1], ids[2], ids[4]}},
+			{"tags", health.Query{Tags: []string{Database, MongoDB}}, []string{ids[0], ids[2], ids[4]}},
+			{"status and tag", health.Query{Statuses: []health.Status{health.Green}, Tags: []string{MongoDB}}, []string{ids[0]}},
+			{"ids", health.Query{IDs: []string{ids[3], ids[1]}}, []string{ids[1], ids[3]}},
+			{"id prefix", health.Query{IDPrefix: ids[3]}, []string{ids[3]}},
+			{"offset", health.Query{Offset: 3}, []string{ids[3], ids[4]}},
+			{"limit", health.Query{Limit: 2}, []string{ids[0], ids[1]}},
+			{"page", health.Query{Tags: []string{MongoDB}, Offset: 1, Limit: 1}, []string{ids[2]}},
+			{"offset past the end", health.Query{Offset: 10}, []string{}},
+			{"negative offset and limit", health.Query{Offset: -1, Limit: -1}, ids},
+			{"max limit", health.Query{Offset: 1, Limit: math.MaxInt}, ids[1:]},
+			{"sort by id", health.Query{SortByID: true}, sortedIDs},
+			{"sorted page", health.Query{SortByID: true, Offset: 1, Limit: 2}, sortedIDs[1:3]},
+		}
+		for _, test := range tests {
+			assert.Equal(t, test.ids, checkIDs(<-registeredChecks(test.query)), test.name)
+			assert.Equal(t, test.ids, resultIDs(<-checkResults(nil, test.query)), test.name)
+		}
+
+		// the filter and query must both match
+		results := <-checkResults(func(result health.Result) bool { return result.ID != ids[2] }, health.Query{Statuses: []health.Status{health.Red}})
+		assert.Equal(t, []string{ids[4]}, resultIDs(results))
+	})
+}
+
+func TestParseStatus(t *testing.T) {
+	t.Parallel()
+
+	for _, status := range []health.Status{health.Green, health.Yellow, health.Red} {
+		for _, s := range []string{status.String(), strings.ToLower(status.String()), strings.ToUpper(status.String())} {
+			parsed, err := health.ParseStatus(s)
+			require.NoError(t, err)
+			assert.Equal(t, status, parsed)
+		}
+	}
+	_, err := health.ParseStatus("Blue")
+	assert.Error(t, err)
+}
+
 func TestSubscribeForCheckResults(t *testing.T) {
 	var shutdowner fx.Shutdowner
 	var subscription health.CheckResultsSubscription
@@ -427,7 +693,7 @@ func TestSubscribeForCheckResults(t *testing.T) {
 						RedImpact:   "FATAL",
 					},
 					health.CheckerOpts{},
-					func() (status health.Status, e error) {
+					func(ctx context.Context) (status health.Status, e error) {
 						return health.Red, errors.New("BOOM #1")
 					},
 				)
@@ -441,7 +707,7 @@ func TestSubscribeForCheckResults(t *testing.T) {
 						RedImpact:   "FATAL",
 					},
 					health.CheckerOpts{},
-					func() (status health.Status, e error) {
+					func(ctx context.Context) (status health.Status, e error) {
 						return health.Green, nil
 					},
 				)
@@ -455,7 +721,7 @@ func TestSubscribeForCheckResults(t *testing.T) {
 						RedImpact:   "FATAL",
 					},
 					health.CheckerOpts{},
-					func() (status health.Status, e error) {
+					func(ctx context.Context) (status health.Status, e error) {
 						return health.Yellow, errors.New("BOOM #2")
 					},
 				)
@@ -521,7 +787,7 @@ func TestRunningScheduledHealthChecks(t *testing.T) {
 						Timeout:     time.Millisecond,
 						RunInterval: time.Microsecond,
 					}
-					return register(Foo(), checkerOpts, func() (health.Status, error) {
+					return register(Foo(), checkerOpts, func(ctx context.Context) (health.Status, error) {
 						return health.Yellow, errors.New("error")
 					})
 				},
@@ -539,6 +805,8 @@ func TestRunningScheduledHealthChecks(t *testing.T) {
 				t.Logf("[%d] %s", count, result)
 				if count == 5 {
 					// after we have received at least 5 results, then we are confident that the health checks are being run and reported properly
+					// - unsubscribe, otherwise the health service would wait for the buffered results to be received on shutdown
+					resultsSubscription.Close()
 					return
 				}
 				count++
@@ -552,10 +820,15 @@ func TestRunningScheduledHealthChecks(t *testing.T) {
 		opts := health.DefaultOpts()
 		opts.MinRunInterval = time.Nanosecond
 
+		fakeClock := newFakeClock()
+		// the checker ignores the context, i.e., it runs until it is released
+		release := make(chan struct{})
+		defer close(release)
 		var shutdowner fx.Shutdowner
 		var resultsSubscription health.CheckResultsSubscription
 		app := fx.New(
 			health.Module(opts),
+			provideClock(fakeClock),
 			fx.Invoke(
 				func(subscribe health.SubscribeForCheckResults) {
 					resultsSubscription = subscribe(nil)
@@ -564,14 +837,14 @@ func TestRunningScheduledHealthChecks(t *testing.T) {
 					checkerOpts := health.CheckerOpts{
 						Timeout: time.Nanosecond,
 					}
-					return register(Foo(), checkerOpts, func() (health.Status, error) {
-						time.Sleep(time.Microsecond)
+					return register(Foo(), checkerOpts, func(ctx context.Context) (health.Status, error) {
+						<-release
 						return health.Green, nil
 					})
 				},
 				// verify that the health check timeout is 1 ns
 				func(registeredChecks health.RegisteredChecks) {
-					registeredCheck := <-registeredChecks()
+					registeredCheck := <-registeredChecks(health.Query{})
 					t.Log(registeredCheck)
 					if registeredCheck[0].Timeout != time.Nanosecond {
 						t.Errorf("*** timeout should be 1 ns: %v", registeredCheck)
@@ -584,10 +857,67 @@ func TestRunningScheduledHealthChecks(t *testing.T) {
 		require.Nil(t, app.Err(), "%v", app.Err())
 
 		runApp(t, app, shutdowner, func() {
+			// wait for the health check to run, and then advance the time to trigger the timeout
+			fakeClock.BlockUntil(1)
+			fakeClock.Advance(time.Nanosecond)
 			result := <-resultsSubscription.Chan()
 			t.Log(result)
 			assert.Equal(t, health.Red, result.Status, "health check should have timed out, which is considered a Red failure")
 			assert.Contains(t, result.Err.Error(), health.ErrTimeout.Error(), "error should have been timeout : %v", result.Err)
+			assert.True(t, result.TimedOut())
+			assert.Equal(t, time.Nanosecond, result.Duration)
+			resultsSubscription.Close()
+		})
+	})
+
+	t.Run("health checker context is canceled when the health check times out", func(t *testing.T) {
+		t.Parallel()
+
+		fakeClock := newFakeClock()
+		var shutdowner fx.Shutdowner
+		var resultsSubscription health.CheckResultsSubscription
+		var orphanedCheckers health.OrphanedCheckers
+		checkerCtxErr := make(chan error, 1)
+		app := fx.New(
+			health.Module(health.DefaultOpts()),
+			provideClock(fakeClock),
+			fx.Invoke(
+				func(subscribe health.SubscribeForCheckResults) {
+					resultsSubscription = subscribe(nil)
+				},
+				func(register health.Register) error {
+					checkerOpts := health.CheckerOpts{
+						Timeout: time.Millisecond,
+					}
+					return register(Foo(), checkerOpts, func(ctx context.Context) (health.Status, error) {
+						<-ctx.Done()
+						select {
+						case checkerCtxErr <- ctx.Err():
+						default:
+						}
+						return health.Red, ctx.Err()
+					})
+				},
+			),
+			fx.Populate(&shutdowner, &orphanedCheckers),
+		)
+
+		require.Nil(t, app.Err(), "%v", app.Err())
+
+		runApp(t, app, shutdowner, func() {
+			// wait for the health check to run, and then advance the time to trigger the timeout
+			fakeClock.BlockUntil(1)
+			fakeClock.Advance(time.Millisecond)
+			result := <-resultsSubscription.Chan()
+			t.Log(result)
+			assert.Equal(t, health.Red, result.Status, "health check should have timed out, which is considered a Red failure")
+			assert.Contains(t, result.Err.Error(), health.ErrTimeout.Error(), "error should have been timeout : %v", result.Err)
+			assert.Equal(t, context.DeadlineExceeded, <-checkerCtxErr)
+			// the checker honors the context, thus its goroutine should not remain orphaned
+			for orphanedCheckers() != 0 {
+				runtime.Gosched()
+			}
+			resultsSubscription.Close()
 		})
 	})
 }
@@ -605,11 +935,12 @@ func TestInvokingFunctionsAfterServiceIsShutDown(t *testing.T) {
 	var checkResults health.CheckResults
 	var subscribeForRegisteredChecks health.SubscribeForRegisteredChecks
 	var subscribeForCheckResults health.SubscribeForCheckResults
+	var runCheckNow health.RunCheckNow
 	app := fx.New(
 		health.Module(health.DefaultOpts()),
 		fx.Invoke(
 			func(register health.Register) error {
-				return register(Foo, health.CheckerOpts{}, func() (health.Status, error) {
+				return register(Foo, health.CheckerOpts{}, func(ctx context.Context) (health.Status, error) {
 					return health.Green, nil
 				})
 			},
@@ -621,6 +952,7 @@ func TestInvokingFunctionsAfterServiceIsShutDown(t *testing.T) {
 			&checkResults,
 			&subscribeForRegisteredChecks,
 			&subscribeForCheckResults,
+			&runCheckNow,
 		),
 	)
 
@@ -634,15 +966,15 @@ func TestInvokingFunctionsAfterServiceIsShutDown(t *testing.T) {
 			RedImpact:   "App is unusable",
 		},
 		health.CheckerOpts{},
-		func() (health.Status, error) {
+		func(ctx context.Context) (health.Status, error) {
 			return health.Green, nil
 		},
 	))
 
-	_, ok := <-registeredChecks()
+	_, ok := <-registeredChecks(health.Query{})
 	assert.False(t, ok, "channel should be closed")
 
-	_, ok = <-checkResults(nil)
+	_, ok = <-checkResults(nil, health.Query{})
 	assert.False(t, ok, "channel should be closed")
 
 	_, ok = <-subscribeForRegisteredChecks().Chan()
@@ -650,6 +982,9 @@ func TestInvokingFunctionsAfterServiceIsShutDown(t *testing.T) {
 
 	_, ok = <-subscribeForCheckResults(nil).Chan()
 	assert.False(t, ok, "channel should be closed")
+
+	_, err := runCheckNow(Foo.ID)
+	assert.Equal(t, health.ErrServiceNotRunning, err)
 }
 
 func TestOverallHealth(t *testing.T) {
@@ -665,7 +1000,7 @@ func TestOverallHealth(t *testing.T) {
 							ID:          ulids.MustNew().String(),
 							Description: fmt.Sprintf("Check #%d", i),
 							RedImpact:   fmt.Sprintf("red impact #%d", i),
-						}, health.CheckerOpts{}, func() (status health.Status, e error) {
+						}, health.CheckerOpts{}, func(ctx context.Context) (status health.Status, e error) {
 							return health.Green, nil
 						})
 						if err != nil {
@@ -688,6 +1023,7 @@ func TestOverallHealth(t *testing.T) {
 
 	t.Run("1 health check is Yellow", func(t *testing.T) {
 		var overallHealth health.OverallHealth
+		var monitorOverallHealth health.MonitorOverallHealth
 		app := fx.New(
 			health.Module(health.DefaultOpts()),
 			fx.Invoke(
@@ -697,7 +1033,7 @@ func TestOverallHealth(t *testing.T) {
 							ID:          ulids.MustNew().String(),
 							Description: fmt.Sprintf("Check #%d", i),
 							RedImpact:   fmt.Sprintf("red impact #%d", i),
-						}, health.CheckerOpts{}, func() (status health.Status, e error) {
+						}, health.CheckerOpts{}, func(ctx context.Context) (status health.Status, e error) {
 							return health.Green, nil
 						})
 						if err != nil {
@@ -708,7 +1044,7 @@ func TestOverallHealth(t *testing.T) {
 						ID:          ulids.MustNew().String(),
 						Description: "Check",
 						RedImpact:   "red impact",
-					}, health.CheckerOpts{}, func() (status health.Status, e error) {
+					}, health.CheckerOpts{}, func(ctx context.Context) (status health.Status, e error) {
 						return health.Yellow, errors.New("yellow error")
 					})
 					if err != nil {
@@ -717,28 +1053,24 @@ func TestOverallHealth(t *testing.T) {
 					return nil
 				},
 			),
-			fx.Populate(&overallHealth),
+			fx.Populate(&overallHealth, &monitorOverallHealth),
 		)
 
 		assert.NoError(t, app.Err(), "app failed to initialize")
+		healthMonitor := monitorOverallHealth()
 		assert.NoError(t, app.Start(context.Background()), "app failed to start")
 
-		// health checks are run async - thus, let's wait until
-		deadline := time.Now().Add(time.Second)
-		for {
-			if overallHealth() == health.Yellow {
-				break
-			}
-			assert.False(t, time.Now().After(deadline), "running health checks is taking too long")
-			runtime.Gosched()
-			time.Sleep(time.Microsecond)
-		}
+		// health checks are run async - thus, let's wait until the overall health status changes
+		awaitOverallHealth(t, healthMonitor, health.Yellow)
+		assert.Equal(t, health.Yellow, overallHealth())
+		healthMonitor.Close()
 
 		assert.NoError(t, app.Stop(context.Background()), "app failed to stop")
 	})
 
 	t.Run("1 health check is Yellow", func(t *testing.T) {
 		var overallHealth health.OverallHealth
+		var monitorOverallHealth health.MonitorOverallHealth
 		app := fx.New(
 			health.Module(health.DefaultOpts()),
 			fx.Invoke(
@@ -748,7 +1080,7 @@ func TestOverallHealth(t *testing.T) {
 							ID:          ulids.MustNew().String(),
 							Description: fmt.Sprintf("Check #%d", i),
 							RedImpact:   fmt.Sprintf("red impact #%d", i),
-						}, health.CheckerOpts{}, func() (status health.Status, e error) {
+						}, health.CheckerOpts{}, func(ctx context.Context) (status health.Status, e error) {
 							return health.Green, nil
 						})
 						if err != nil {
@@ -759,7 +1091,7 @@ func TestOverallHealth(t *testing.T) {
 						ID:          ulids.MustNew().String(),
 						Description: "Check",
 						RedImpact:   "red impact",
-					}, health.CheckerOpts{}, func() (status health.Status, e error) {
+					}, health.CheckerOpts{}, func(ctx context.Context) (status health.Status, e error) {
 						return health.Yellow, errors.New("yellow error")
 					}); err != nil {
 						return err
@@ -769,7 +1101,7 @@ func TestOverallHealth(t *testing.T) {
 						ID:          ulids.MustNew().String(),
 						Description: "Check",
 						RedImpact:   "red impact",
-					}, health.CheckerOpts{}, func() (status health.Status, e error) {
+					}, health.CheckerOpts{}, func(ctx context.Context) (status health.Status, e error) {
 						return health.Red, errors.New("yellow error")
 					}); err != nil {
 						return err
@@ -777,27 +1109,36 @@ func TestOverallHealth(t *testing.T) {
 					return nil
 				},
 			),
-			fx.Populate(&overallHealth),
+			fx.Populate(&overallHealth, &monitorOverallHealth),
 		)
 
 		assert.NoError(t, app.Err(), "app failed to initialize")
+		healthMonitor := monitorOverallHealth()
 		assert.NoError(t, app.Start(context.Background()), "app failed to start")
 
-		// health checks are run async - thus, let's wait until
-		deadline := time.Now().Add(time.Second)
-		for {
-			if overallHealth() == health.Red {
-				break
-			}
-			assert.False(t, time.Now().After(deadline), "running health checks is taking too long")
-			runtime.Gosched()
-			time.Sleep(time.Microsecond)
-		}
+		// health checks are run async - thus, let's wait until the overall health status changes
+		awaitOverallHealth(t, healthMonitor, health.Red)
+		assert.Equal(t, health.Red, overallHealth())
+		healthMonitor.Close()
 
 		assert.NoError(t, app.Stop(context.Background()), "app failed to stop")
 	})
 }
 
+// waits for the overall health status to change to the specified status
+func awaitOverallHealth(t *testing.T, monitor health.OverallHealthMonitor, status health.Status) {
+	for {
+		select {
+		case current := <-monitor.Chan():
+			if current == status {
+				return
+			}
+		case <-time.After(5 * time.Second):
+			t.Fatalf("*** timed out waiting for the overall health status to change to: %s", status)
+		}
+	}
+}
+
 func TestMonitorOverallHealth(t *testing.T) {
 	var healthStatus uint32
 
@@ -814,7 +1155,7 @@ func TestMonitorOverallHealth(t *testing.T) {
 					ID:          ulids.MustNew().String(),
 					Description: "desc",
 					RedImpact:   "red impact",
-				}, health.CheckerOpts{}, func() (status health.Status, e error) {
+				}, health.CheckerOpts{}, func(ctx context.Context) (status health.Status, e error) {
 					switch health.Status(atomic.LoadUint32(&healthStatus)) {
 					case health.Green:
 						return health.Green, nil
@@ -884,3 +1225,98 @@ func TestMonitorOverallHealth(t *testing.T) {
 	assert.False(t, ok, "after the app is stopped, new monitor channels should be closed")
 
 }
+
+func TestOpts_Interceptor(t *testing.T) {
+	t.Parallel()
+
+	var Foo = health.Check{
+		ID:          ulids.MustNew().String(),
+		Description: "Foo",
+		RedImpact:   "App is unusable",
+	}
+
+	var intercepted int32
+	opts := health.DefaultOpts().SetInterceptor(func(check health.Check, checker func(ctx context.Context) (health.Status, error)) func(ctx context.Context) (health.Status, error) {
+		return func(ctx context.Context) (health.Status, error) {
+			atomic.AddInt32(&intercepted, 1)
+			if check.ID == Foo.ID {
+				return health.Yellow, errors.New("intercepted")
+			}
+			return checker(ctx)
+		}
+	})
+
+	var shutdowner fx.Shutdowner
+	var register health.Register
+	var runCheckNow health.RunCheckNow
+	app := fx.New(
+		health.Module(opts),
+		fx.Populate(&shutdowner, &register, &runCheckNow),
+	)
+	require.Nil(t, app.Err(), "app initialization failed : %v", app.Err())
+
+	runApp(t, app, shutdowner, func() {
+		err := register(Foo, health.CheckerOpts{RunInterval: time.Hour}, func(ctx context.Context) (health.Status, error) {
+			return health.Green, nil
+		})
+		require.NoError(t, err)
+		result, err := runCheckNow(Foo.ID)
+		require.NoError(t, err)
+		assert.Equal(t, health.Yellow, result.Status)
+		assert.Contains(t, result.Err.Error(), "intercepted")
+		assert.True(t, atomic.LoadInt32(&intercepted) > 0)
+	})
+}
+
+func TestCheckerPanics(t *testing.T) {
+	t.Parallel()
+
+	var shutdowner fx.Shutdowner
+	var register health.Register
+	var runCheckNow health.RunCheckNow
+	var checkerPanics health.CheckerPanics
+	var subscribe health.SubscribeForCheckResults
+	app := fx.New(
+		health.Module(health.DefaultOpts()),
+		fx.Populate(&shutdowner, &register, &runCheckNow, &checkerPanics, &subscribe),
+	)
+	require.Nil(t, app.Err(), "app initialization failed : %v", app.Err())
+
+	runApp(t, app, shutdowner, func() {
+		assert.Empty(t, checkerPanics())
+		results := subscribe(nil)
+		defer results.Close()
+
+		checkPanic := func(t *testing.T, checker func(ctx context.Context) (health.Status, error)) {
+			check := health.Check{ID: ulids.MustNew().String(), Description: "Foo", RedImpact: "App is unusable"}
+			require.NoError(t, register(check, health.CheckerOpts{RunInterval: time.Hour}, checker))
+			// wait for the health check to run after it is registered
+			for result := range results.Chan() {
+				if result.ID == check.ID {
+					break
+				}
+			}
+
+			result, err := runCheckNow(check.ID)
+			require.NoError(t, err)
+			assert.Equal(t, health.Red, result.Status)
+			assert.Contains(t, result.Err.Error(), health.ErrCheckerPanic.Error())
+			assert.Contains(t, result.Err.Error(), "BOOM")
+			assert.Contains(t, result.Details[health.DetailPanicStack], "runtime/debug.Stack")
+			assert.Equal(t, uint64(2), checkerPanics()[check.ID])
+		}
+
+		t.Run("checker panics", func(t *testing.T) {
+			checkPanic(t, func(ctx context.Context) (health.Status, error) {
+				panic("BOOM")
+			})
+		})
+
+		t.Run("composite sub-check panics", func(t *testing.T) {
+			checkPanic(t, health.Composite(
+				health.SubCheck{Name: "ok", Checker: func(ctx context.Context) (health.Status, error) { return health.Green, nil }},
+				health.SubCheck{Name: "panic", Checker: func(ctx context.Context) (health.Status, error) { panic(errors.New("BOOM")) }},
+			))
+		})
+	})
+}
@@ -19,11 +19,13 @@ package health
 import (
 	"context"
 	"fmt"
+	"github.com/oysterpack/andiamo/pkg/clock"
 	"github.com/oysterpack/andiamo/pkg/ulids"
 	"github.com/pkg/errors"
 	"go.uber.org/fx"
 	"go.uber.org/multierr"
 	"strings"
+	"sync/atomic"
 )
 
 // Module provides the fx Module for the health module
@@ -33,6 +35,11 @@ func Module(opts Opts) fx.Option {
 			startService(opts),
 
 			provideRegisterFunc,
+			provideUnregisterFunc,
+			provideRunCheckNowFunc,
+			provideRunQueueStatsFunc,
+			provideOrphanedCheckersFunc,
+			provideCheckerPanicsFunc,
 
 			provideRegisteredChecksFunc,
 			provideCheckResultsFunc,
@@ -50,14 +57,26 @@ func Module(opts Opts) fx.Option {
 	return fx.Options(options...)
 }
 
-func startService(svcOpts Opts) func(lc fx.Lifecycle) *service {
-	s := newService(svcOpts)
-	return func(lc fx.Lifecycle) *service {
+// serviceParams are the health service dependencies
+type serviceParams struct {
+	fx.In
+	Lifecycle fx.Lifecycle
+	// if no Clock is provided, then the real clock is used
+	Clock clock.Clock `optional:"true"`
+}
+
+func startService(svcOpts Opts) func(params serviceParams) *service {
+	return func(params serviceParams) *service {
+		clk := params.Clock
+		if clk == nil {
+			clk = clock.Real()
+		}
+		s := newService(svcOpts, clk)
+		lc := params.Lifecycle
 		go s.run()
 		lc.Append(fx.Hook{
-			OnStop: func(context.Context) error {
-				s.TriggerShutdown()
-				return nil
+			OnStop: func(ctx context.Context) error {
+				return s.Shutdown(ctx)
 			},
 		})
 		return s
@@ -71,8 +90,11 @@ func provideRegisterFunc(s *service) Register {
 		check.RedImpact = strings.TrimSpace(check.RedImpact)
 		check.YellowImpact = strings.TrimSpace(check.YellowImpact)
 
-		for i := 0; i < len(check.Tags); i++ {
-			check.Tags[i] = strings.TrimSpace(check.Tags[i])
+		// the tags are copied because the caller owns the tags slice
+		tags := check.Tags
+		check.Tags = nil
+		for _, tag := range tags {
+			check.Tags = append(check.Tags, strings.TrimSpace(tag))
 		}
 
 		return check
@@ -99,125 +121,91 @@ func provideRegisterFunc(s *service) Register {
 		return err
 	}
 
-	return func(check Check, opts CheckerOpts, checker func() (Status, error)) error {
+	return func(check Check, opts CheckerOpts, checker func(ctx context.Context) (Status, error)) error {
 		check = TrimSpace(check)
 		if err := Validate(check); err != nil {
 			return multierr.Append(fmt.Errorf("invalid health check: %#v", check), err)
 		}
 
-		reply := make(chan error, 1) // a chan buf size 1 decouples the producer from the consumer
-		req := registerRequest{
-			check:   check,
-			opts:    opts,
-			checker: checker,
-			reply:   reply,
-		}
-		// send service request
-		select {
-		case <-s.stop:
-			return ErrServiceNotRunning
-		case s.register <- req:
-		}
+		return s.Register(check, opts, checker)
+	}
+}
 
-		// receive service reply
-		select {
-		case <-s.stop:
-			return ErrServiceNotRunning
-		case err := <-reply:
-			return err
-		}
+func provideUnregisterFunc(s *service) Unregister {
+	return func(id string) error {
+		return s.Unregister(strings.TrimSpace(id))
+	}
+}
+
+func provideRunCheckNowFunc(s *service) RunCheckNow {
+	return func(id string) (Result, error) {
+		// the check is run on the caller's goroutine because it may take up to the check's timeout to complete
+		return s.RunCheckNow(strings.TrimSpace(id))
 	}
 }
 
+func provideRunQueueStatsFunc(s *service) RunQueueStats {
+	return s.runQueue.stats
+}
+
+func provideOrphanedCheckersFunc(s *service) OrphanedCheckers {
+	return func() int {
+		return int(atomic.LoadInt32(&s.orphanedCheckers))
+	}
+}
+
+func provideCheckerPanicsFunc(s *service) CheckerPanics {
+	return s.CheckerPanics
+}
+
 func provideRegisteredChecksFunc(s *service) RegisteredChecks {
-	return func() <-chan []RegisteredCheck {
+	return func(query Query) <-chan []RegisteredCheck {
 		reply := make(chan []RegisteredCheck, 1) // a chan buf size 1 decouples the producer from the consumer
-		go func() {
-			select {
-			case <-s.stop:
-				close(reply)
-			case s.getRegisteredChecks <- reply:
-			}
-		}()
+		defer close(reply)
+		if !s.stopped() {
+			reply <- s.registry.checks(query)
+		}
 		return reply
 	}
 }
 
 func provideCheckResultsFunc(s *service) CheckResults {
-	return func(filter func(result Result) bool) <-chan []Result {
-		req := checkResultsRequest{
-			reply:  make(chan []Result, 1), // a chan buf size 1 decouples the producer from the consumer
-			filter: filter,
+	return func(filter func(result Result) bool, query Query) <-chan []Result {
+		reply := make(chan []Result, 1) // a chan buf size 1 decouples the producer from the consumer
+		defer close(reply)
+		if !s.stopped() {
+			reply <- s.registry.results(filter, query)
 		}
-		go func() {
-			select {
-			case <-s.stop:
-				close(req.reply)
-			case s.getCheckResults <- req:
-			}
-		}()
-		return req.reply
+		return reply
 	}
 }
 
 func provideSubscribeForRegisteredChecks(s *service) SubscribeForRegisteredChecks {
 	return func() RegisteredCheckSubscription {
-		closedChan := func() RegisteredCheckSubscription {
+		if s.stopped() {
 			ch := make(chan RegisteredCheck)
 			close(ch)
-			return RegisteredCheckSubscription{ch}
-		}
-
-		reply := make(chan chan RegisteredCheck, 1) // a chan buf size 1 decouples the producer from the consumer
-
-		select {
-		case <-s.stop:
-			return closedChan()
-		case s.subscribeForRegisteredChecks <- subscribeForRegisteredChecksRequest{reply}:
-			select {
-			case <-s.stop:
-				return closedChan()
-			case ch, ok := <-reply:
-				if ok {
-					return RegisteredCheckSubscription{ch}
-				}
-				return closedChan()
-			}
+			return RegisteredCheckSubscription{ch: ch}
 		}
+		return s.SubscribeForRegisteredChecks()
 	}
 }
 
 func provideSubscribeForCheckResults(s *service) SubscribeForCheckResults {
 	return func(filter func(result Result) bool) CheckResultsSubscription {
-		closedChan := func() CheckResultsSubscription {
+		if s.stopped() {
 			ch := make(chan Result)
 			close(ch)
-			return CheckResultsSubscription{ch}
-		}
-
-		reply := make(chan chan Result, 1) // a chan buf size 1 decouples the producer from the consumer
-
-		select {
-		case <-s.stop:
-			return closedChan()
-		case s.subscribeForCheckResults <- subscribeForCheckResults{reply, filter}:
-			select {
-			case <-s.stop:
-				return closedChan()
-			case ch, ok := <-reply:
-				if ok {
-					return CheckResultsSubscription{ch}
-				}
-				return closedChan()
-			}
+			return CheckResultsSubscription{ch: ch}
 		}
+		return s.SubscribeForCheckResults(filter)
 	}
 }
 
 func checkHealthOnStart(lc fx.Lifecycle, checks RegisteredChecks, checkResults CheckResults) {
 	lc.Append(fx.Hook{
 		OnStart: func(ctx context.Context) error {
-			registeredCheckChan := checks()
+			registeredCheckChan := checks(Query{})
 			select {
 			case <-ctx.Done():
 				return ErrContextTimout
@@ -235,7 +223,7 @@ func checkHealthOnStart(lc fx.Lifecycle, checks RegisteredChecks, checkResults C
 				select {
 				case <-ctx.Done():
 					return ErrContextTimout
-				case results, ok := <-checkResults(func(result Result) bool { return result.Status == Green }):
+				case results, ok := <-checkResults(func(result Result) bool { return result.Status == Green }, Query{}):
 					if !ok {
 						return errors.New("failed to get health check results because the channel is closed")
 					}
@@ -260,42 +248,16 @@ func checkHealthOnStart(lc fx.Lifecycle, checks RegisteredChecks, checkResults C
 }
 
 func provideOverallHealth(s *service) OverallHealth {
-	return func() Status {
-		reply := make(chan Status, 1)
-		select {
-		case <-s.stop:
-			return Red
-		case s.getOverallHealth <- reply:
-			select {
-			case <-s.stop:
-				return Red
-			case status := <-reply:
-				return status
-			}
-		}
-	}
+	return s.OverallHealth
 }
 
 func provideMonitorOverallHealth(s *service) MonitorOverallHealth {
 	return func() OverallHealthMonitor {
-		closedChan := func() OverallHealthMonitor {
+		if s.stopped() {
 			ch := make(chan Status)
 			close(ch)
-			return OverallHealthMonitor{ch}
+			return OverallHealthMonitor{ch: ch}
 		}
-
-		reply := make(chan chan Status)
-		select {
-		case <-s.stop:
-			return closedChan()
-		case s.subscribeForOverallHealthChanges <- reply:
-			select {
-			case <-s.stop:
-				return closedChan()
-			case ch := <-reply:
-				return OverallHealthMonitor{ch}
-			}
-		}
-
+		return s.SubscribeForOverallHealthChanges()
 	}
 }
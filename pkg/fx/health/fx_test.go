@@ -42,7 +42,7 @@ func TestModuleConfiguredToRunChecksOnStartUp(t *testing.T) {
 						ID:          ulids.MustNew().String(),
 						Description: "Foo",
 						RedImpact:   "RED",
-					}, health.CheckerOpts{}, func() (status health.Status, e error) {
+					}, health.CheckerOpts{}, func(ctx context.Context) (status health.Status, e error) {
 						return health.Red, errors.New("BOOM")
 					})
 				},
@@ -60,6 +60,9 @@ func TestModuleConfiguredToRunChecksOnStartUp(t *testing.T) {
 	})
 
 	t.Run("app start up times out before health checks complete", func(t *testing.T) {
+		// the health check does not complete until it is released
+		release := make(chan struct{})
+		defer close(release)
 		opts := health.DefaultOpts()
 		opts.FailFastOnStartup = true
 		app := fx.New(
@@ -70,8 +73,8 @@ func TestModuleConfiguredToRunChecksOnStartUp(t *testing.T) {
 						ID:          ulids.MustNew().String(),
 						Description: "Foo",
 						RedImpact:   "RED",
-					}, health.CheckerOpts{}, func() (status health.Status, e error) {
-						time.Sleep(2 * time.Second)
+					}, health.CheckerOpts{}, func(ctx context.Context) (status health.Status, e error) {
+						<-release
 						return health.Red, errors.New("BOOM")
 					})
 				},
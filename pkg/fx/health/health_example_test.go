@@ -67,17 +67,17 @@ Red -> SQL error or operation took longer than 1 sec
 			},
 			// register some health checks
 			func(register health.Register) error {
-				return register(DatabaseHealthCheck, health.CheckerOpts{}, func() (status health.Status, e error) {
+				return register(DatabaseHealthCheck, health.CheckerOpts{}, func(ctx context.Context) (status health.Status, e error) {
 					return health.Green, nil
 				})
 			},
 			func(register health.Register) error {
-				return register(SmokeTest, health.CheckerOpts{}, func() (status health.Status, e error) {
+				return register(SmokeTest, health.CheckerOpts{}, func(ctx context.Context) (status health.Status, e error) {
 					return health.Green, nil
 				})
 			},
 			func(registeredChecks health.RegisteredChecks) {
-				log.Print(<-registeredChecks())
+				log.Print(<-registeredChecks(health.Query{}))
 			},
 		),
 		fx.Populate(&checkResults),
@@ -103,7 +103,7 @@ Red -> SQL error or operation took longer than 1 sec
 	// we subscribed to receive health check results for the smoke test
 	log.Println(<-checkResultsSubscription.Chan())
 	// get all check results
-	log.Println(<-checkResults(nil))
+	log.Println(<-checkResults(nil, health.Query{}))
 
 	// Output:
 }
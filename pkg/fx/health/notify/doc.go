@@ -0,0 +1,31 @@
+/*
+ * Copyright (c) 2019 OysterPack, Inc.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ * http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+// Package notify provides an fx module that posts health notifications to webhooks.
+//
+// The following notifications are driven by the health subscription stream:
+//   - overall health status changes
+//   - health check Red results
+//   - health check recoveries, i.e., a health check that was notified as Red is no longer Red
+//
+// Supported webhook formats:
+//   - generic JSON - the Notification is posted as JSON
+//   - Slack - incoming webhook text messages
+//   - PagerDuty - Events API v2, where Red results trigger incidents and recoveries resolve them
+//
+// Notifications are deduped using a cooldown period, e.g., a health check that remains Red is re-notified after the
+// cooldown period has elapsed, and overall health flapping is suppressed within the cooldown period.
+package notify
@@ -0,0 +1,45 @@
+/*
+ * Copyright (c) 2019 OysterPack, Inc.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ * http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package notify
+
+import (
+	"github.com/rs/zerolog"
+)
+
+// notify module events
+const (
+	//	type Data struct {
+	//		Event   string `json:"event"`
+	//		Format  string `json:"format"`
+	//		URL     string `json:"url"`
+	//		Err     string `json:"err"`
+	//	}
+	WebhookFailedEvent = "01DHV1Y13ZF1R66ED1SKDAHMFQ"
+)
+
+type webhookFailure struct {
+	Notification
+	Webhook
+	err error
+}
+
+func (f *webhookFailure) MarshalZerologObject(e *zerolog.Event) {
+	e.Str("event", string(f.Event))
+	e.Str("format", f.Format.String())
+	e.Str("url", f.url())
+	e.Err(f.err)
+}
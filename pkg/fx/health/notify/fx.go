@@ -0,0 +1,181 @@
+/*
+ * Copyright (c) 2019 OysterPack, Inc.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ * http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package notify
+
+import (
+	"context"
+	"github.com/oysterpack/andiamo/pkg/eventlog"
+	"github.com/oysterpack/andiamo/pkg/fx/health"
+	"github.com/rs/zerolog"
+	"go.uber.org/fx"
+	"net/http"
+	"time"
+)
+
+// Module provides the fx Module for the notify module, which depends on the health module.
+//
+// Webhook delivery failures are logged using the *zerolog.Logger, i.e., it must be provided by the app.
+func Module(opts Opts) fx.Option {
+	return fx.Invoke(func(lc fx.Lifecycle, monitor health.MonitorOverallHealth, subscribe health.SubscribeForCheckResults, registeredChecks health.RegisteredChecks, logger *zerolog.Logger) error {
+		if err := opts.validate(); err != nil {
+			return err
+		}
+		n := newNotifier(opts.withDefaults(), registeredChecks, logger)
+		overallHealth := monitor()
+		results := subscribe(nil)
+		done := make(chan struct{})
+		lc.Append(fx.Hook{
+			OnStart: func(context.Context) error {
+				go func() {
+					defer close(done)
+					n.run(overallHealth, results)
+				}()
+				return nil
+			},
+			OnStop: func(context.Context) error {
+				// the subscriptions are closed, which stops the notifier
+				overallHealth.Close()
+				results.Close()
+				<-done
+				return nil
+			},
+		})
+		return nil
+	})
+}
+
+type notifier struct {
+	Opts
+	client           *http.Client
+	registeredChecks health.RegisteredChecks
+	logWebhookFailed eventlog.Logger
+
+	// used to dedup notifications - the time when the notification was last sent is tracked by dedup key
+	sent map[string]time.Time
+	// health checks that were notified as Red
+	redChecks map[string]struct{}
+	// the overall health is initialized when the first status is received from the monitor
+	overallHealth *health.Status
+}
+
+func newNotifier(opts Opts, registeredChecks health.RegisteredChecks, logger *zerolog.Logger) *notifier {
+	return &notifier{
+		Opts:             opts,
+		client:           newHTTPClient(opts),
+		registeredChecks: registeredChecks,
+		logWebhookFailed: eventlog.NewLogger(WebhookFailedEvent, logger, zerolog.ErrorLevel),
+		sent:             make(map[string]time.Time),
+		redChecks:        make(map[string]struct{}),
+	}
+}
+
+// runs until both subscriptions are closed
+func (n *notifier) run(overallHealth health.OverallHealthMonitor, results health.CheckResultsSubscription) {
+	overallHealthChan, resultsChan := overallHealth.Chan(), results.Chan()
+	for overallHealthChan != nil || resultsChan != nil {
+		select {
+		case status, ok := <-overallHealthChan:
+			if !ok {
+				overallHealthChan = nil
+				continue
+			}
+			n.overallHealthChanged(status)
+		case result, ok := <-resultsChan:
+			if !ok {
+				resultsChan = nil
+				continue
+			}
+			n.checkResult(result)
+		}
+	}
+}
+
+// The monitor sends the current status when it is first created - the initial status is not notified.
+func (n *notifier) overallHealthChanged(status health.Status) {
+	previous := n.overallHealth
+	n.overallHealth = &status
+	if previous == nil || *previous == status {
+		return
+	}
+	// flapping is suppressed via the cooldown
+	if !n.cooledDown("overall:" + status.String()) {
+		return
+	}
+	n.send(Notification{
+		Event:          OverallHealthChanged,
+		Status:         status.String(),
+		PreviousStatus: previous.String(),
+		Time:           time.Now(),
+	})
+}
+
+func (n *notifier) checkResult(result health.Result) {
+	_, notifiedRed := n.redChecks[result.ID]
+	switch {
+	case result.Status == health.Red:
+		// a health check that remains Red is re-notified after the cooldown
+		if !n.cooledDown(result.ID) {
+			return
+		}
+		n.redChecks[result.ID] = struct{}{}
+		n.send(Notification{
+			Event:  CheckRed,
+			Status: result.Status.String(),
+			Check:  newCheck(result, n.registeredCheck(result.ID)),
+			Time:   result.Time,
+		})
+	case notifiedRed:
+		delete(n.redChecks, result.ID)
+		// the cooldown is reset, i.e., if the health check goes Red again, then it is notified
+		delete(n.sent, result.ID)
+		n.send(Notification{
+			Event:  CheckRecovered,
+			Status: result.Status.String(),
+			Check:  newCheck(result, n.registeredCheck(result.ID)),
+			Time:   result.Time,
+		})
+	}
+}
+
+// returns true if the notification for the dedup key has not been sent within the cooldown period. If true is returned,
+// then the notification is tracked as sent.
+func (n *notifier) cooledDown(key string) bool {
+	now := time.Now()
+	if sent, ok := n.sent[key]; ok && now.Sub(sent) < n.Cooldown {
+		return false
+	}
+	n.sent[key] = now
+	return true
+}
+
+func (n *notifier) registeredCheck(id string) *health.RegisteredCheck {
+	for _, check := range <-n.registeredChecks(health.Query{}) {
+		if check.ID == id {
+			return &check
+		}
+	}
+	return nil
+}
+
+func (n *notifier) send(notification Notification) {
+	notification.Source = n.Source
+	for _, webhook := range n.Webhooks {
+		if err := webhook.post(n.client, notification); err != nil {
+			n.logWebhookFailed(&webhookFailure{notification, webhook, err}, "failed to post notification to webhook")
+		}
+	}
+}
@@ -0,0 +1,208 @@
+/*
+ * Copyright (c) 2019 OysterPack, Inc.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ * http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package notify
+
+import (
+	"errors"
+	"fmt"
+	"github.com/oysterpack/andiamo/pkg/fx/health"
+	"go.uber.org/multierr"
+	"net/http"
+	"net/url"
+	"os"
+	"time"
+)
+
+// Format is the webhook payload format
+type Format uint8
+
+// Format enum
+const (
+	JSON Format = iota
+	Slack
+	PagerDuty
+)
+
+func (f Format) String() string {
+	switch f {
+	case JSON:
+		return "JSON"
+	case Slack:
+		return "Slack"
+	case PagerDuty:
+		return "PagerDuty"
+	default:
+		return fmt.Sprintf("Format(%d)", f)
+	}
+}
+
+// PagerDutyEventsURL is the PagerDuty Events API v2 URL, which is used by default for PagerDuty webhooks
+const PagerDutyEventsURL = "https://events.pagerduty.com/v2/enqueue"
+
+// Webhook is used to configure a webhook that notifications are posted to
+type Webhook struct {
+	// URL is optional for PagerDuty webhooks, i.e., defaults to PagerDutyEventsURL
+	URL    string
+	Format Format
+	// RoutingKey is the PagerDuty integration key - required for PagerDuty webhooks
+	RoutingKey string
+}
+
+func (w Webhook) validate() error {
+	var err error
+	if w.Format > PagerDuty {
+		err = multierr.Append(err, ErrUnsupportedFormat)
+	}
+	if w.Format == PagerDuty && w.RoutingKey == "" {
+		err = multierr.Append(err, ErrBlankRoutingKey)
+	}
+	if w.URL == "" && w.Format != PagerDuty {
+		err = multierr.Append(err, ErrInvalidURL)
+	}
+	if w.URL != "" {
+		if u, e := url.Parse(w.URL); e != nil || u.Host == "" {
+			err = multierr.Append(err, ErrInvalidURL)
+		}
+	}
+	if err != nil {
+		return multierr.Append(fmt.Errorf("invalid webhook: %s : %s", w.Format, w.URL), err)
+	}
+	return nil
+}
+
+func (w Webhook) url() string {
+	if w.URL == "" && w.Format == PagerDuty {
+		return PagerDutyEventsURL
+	}
+	return w.URL
+}
+
+// notify defaults
+const (
+	DefaultCooldown = 5 * time.Minute
+	DefaultTimeout  = 5 * time.Second
+)
+
+// Opts is used to configure the notify module. Zero values imply using the default values.
+type Opts struct {
+	Webhooks []Webhook
+
+	// Cooldown is used to dedup notifications, i.e., the same notification is not sent again within the cooldown period
+	//
+	// default = 5 mins
+	Cooldown time.Duration
+	// Timeout is the webhook HTTP request timeout
+	//
+	// default = 5 secs
+	Timeout time.Duration
+	// Source identifies where the notifications are coming from
+	//
+	// default = hostname
+	Source string
+}
+
+func (o Opts) withDefaults() Opts {
+	if o.Cooldown == time.Duration(0) {
+		o.Cooldown = DefaultCooldown
+	}
+	if o.Timeout == time.Duration(0) {
+		o.Timeout = DefaultTimeout
+	}
+	if o.Source == "" {
+		o.Source, _ = os.Hostname()
+	}
+	return o
+}
+
+func (o Opts) validate() error {
+	if len(o.Webhooks) == 0 {
+		return ErrNoWebhooks
+	}
+	var err error
+	for _, w := range o.Webhooks {
+		err = multierr.Append(err, w.validate())
+	}
+	return err
+}
+
+// notify module errors
+var (
+	ErrNoWebhooks        = errors.New("at least 1 webhook is required")
+	ErrUnsupportedFormat = errors.New("webhook format is not supported")
+	ErrBlankRoutingKey   = errors.New("PagerDuty webhook `RoutingKey` must not be blank")
+	ErrInvalidURL        = errors.New("webhook `URL` must be a valid absolute URL")
+)
+
+// Event is the notification event type
+type Event string
+
+// notification events
+const (
+	OverallHealthChanged Event = "overall_health_changed"
+	CheckRed             Event = "check_red"
+	CheckRecovered       Event = "check_recovered"
+)
+
+// Notification is the notification that is posted to webhooks. Generic JSON webhooks receive the Notification as JSON.
+type Notification struct {
+	Event  Event  `json:"event"`
+	Status string `json:"status"`
+	// PreviousStatus is only set for OverallHealthChanged notifications
+	PreviousStatus string `json:"previous_status,omitempty"`
+	// Check is only set for health check notifications
+	Check  *Check    `json:"check,omitempty"`
+	Time   time.Time `json:"time"`
+	Source string    `json:"source,omitempty"`
+}
+
+// Check describes the health check that the notification is about
+type Check struct {
+	ID          string `json:"id"`
+	Description string `json:"description,omitempty"`
+	RedImpact   string `json:"red_impact,omitempty"`
+	Error       string `json:"error,omitempty"`
+}
+
+func newCheck(result health.Result, check *health.RegisteredCheck) *Check {
+	c := &Check{ID: result.ID}
+	if check != nil {
+		c.Description = check.Description
+		c.RedImpact = check.RedImpact
+	}
+	if result.Err != nil {
+		c.Error = result.Err.Error()
+	}
+	return c
+}
+
+func (n Notification) String() string {
+	switch n.Event {
+	case OverallHealthChanged:
+		return fmt.Sprintf("overall health changed: %s -> %s", n.PreviousStatus, n.Status)
+	case CheckRed:
+		if n.Check.Error != "" {
+			return fmt.Sprintf("health check is Red: %s (%s) : %s", n.Check.Description, n.Check.ID, n.Check.Error)
+		}
+		return fmt.Sprintf("health check is Red: %s (%s)", n.Check.Description, n.Check.ID)
+	default:
+		return fmt.Sprintf("health check recovered: %s (%s) : %s", n.Check.Description, n.Check.ID, n.Status)
+	}
+}
+
+func newHTTPClient(opts Opts) *http.Client {
+	return &http.Client{Timeout: opts.Timeout}
+}
@@ -0,0 +1,188 @@
+/*
+ * Copyright (c) 2019 OysterPack, Inc.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ * http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package notify_test
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"github.com/oysterpack/andiamo/pkg/fx/health"
+	"github.com/oysterpack/andiamo/pkg/fx/health/notify"
+	"github.com/oysterpack/andiamo/pkg/ulids"
+	"github.com/rs/zerolog"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.uber.org/fx"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+type post struct {
+	path string
+	body map[string]interface{}
+}
+
+func TestModule(t *testing.T) {
+	t.Parallel()
+
+	posts := make(chan post, 32)
+	server := httptest.NewServer(http.HandlerFunc(func(writer http.ResponseWriter, request *http.Request) {
+		body, err := ioutil.ReadAll(request.Body)
+		require.NoError(t, err)
+		var payload map[string]interface{}
+		require.NoError(t, json.Unmarshal(body, &payload))
+		posts <- post{request.URL.Path, payload}
+	}))
+	defer server.Close()
+
+	Foo := health.Check{ID: ulids.MustNew().String(), Description: "Foo", RedImpact: "Foo is unavailable"}
+	var red int32
+	var runCheckNow health.RunCheckNow
+	app := fx.New(
+		health.Module(health.DefaultOpts()),
+		fx.Provide(func() *zerolog.Logger {
+			logger := zerolog.Nop()
+			return &logger
+		}),
+		notify.Module(notify.Opts{
+			Webhooks: []notify.Webhook{
+				{URL: server.URL + "/json"},
+				{URL: server.URL + "/slack", Format: notify.Slack},
+				{URL: server.URL + "/pagerduty", Format: notify.PagerDuty, RoutingKey: "KEY"},
+			},
+			Cooldown: time.Hour,
+			Source:   "foo-host",
+		}),
+		fx.Invoke(func(register health.Register) error {
+			return register(Foo, health.CheckerOpts{RunInterval: time.Hour}, func(ctx context.Context) (health.Status, error) {
+				if atomic.LoadInt32(&red) == 1 {
+					return health.Red, errors.New("BOOM")
+				}
+				return health.Green, nil
+			})
+		}),
+		fx.Populate(&runCheckNow),
+	)
+	require.NoError(t, app.Err())
+	require.NoError(t, app.Start(context.Background()))
+	defer app.Stop(context.Background())
+
+	// collects the posts for the specified number of notifications, keyed by path and event
+	receive := func(notifications int) map[string]map[string]interface{} {
+		received := make(map[string]map[string]interface{})
+		timeout := time.After(5 * time.Second)
+		for i := 0; i < notifications*3; i++ {
+			select {
+			case p := <-posts:
+				key := p.path
+				switch p.path {
+				case "/json":
+					key += ":" + p.body["event"].(string)
+				case "/pagerduty":
+					key += ":" + p.body["dedup_key"].(string)
+				default:
+					key += ":" + p.body["text"].(string)
+				}
+				received[key] = p.body
+			case <-timeout:
+				t.Fatalf("*** timed out waiting for notifications: %v", received)
+			}
+		}
+		return received
+	}
+
+	// When the health check turns Red
+	atomic.StoreInt32(&red, 1)
+	_, err := runCheckNow(Foo.ID)
+	require.NoError(t, err)
+	// Then the Red health check and overall health change are notified
+	received := receive(2)
+	t.Log(received)
+	checkRed := received["/json:check_red"]
+	require.NotNil(t, checkRed)
+	assert.Equal(t, "Red", checkRed["status"])
+	assert.Equal(t, "foo-host", checkRed["source"])
+	check := checkRed["check"].(map[string]interface{})
+	assert.Equal(t, Foo.ID, check["id"])
+	assert.Equal(t, Foo.RedImpact, check["red_impact"])
+	assert.Contains(t, check["error"], "BOOM")
+
+	overallHealthChanged := received["/json:overall_health_changed"]
+	require.NotNil(t, overallHealthChanged)
+	assert.Equal(t, "Green", overallHealthChanged["previous_status"])
+	assert.Equal(t, "Red", overallHealthChanged["status"])
+
+	assert.NotNil(t, received["/slack:overall health changed: Green -> Red"])
+	pagerDutyIncident := received["/pagerduty:"+Foo.ID]
+	require.NotNil(t, pagerDutyIncident)
+	assert.Equal(t, "KEY", pagerDutyIncident["routing_key"])
+	assert.Equal(t, "trigger", pagerDutyIncident["event_action"])
+	assert.Equal(t, "critical", pagerDutyIncident["payload"].(map[string]interface{})["severity"])
+
+	// When the health check remains Red
+	_, err = runCheckNow(Foo.ID)
+	require.NoError(t, err)
+	// And then recovers
+	atomic.StoreInt32(&red, 0)
+	_, err = runCheckNow(Foo.ID)
+	require.NoError(t, err)
+	// Then the duplicate Red result is not notified, and the recovery is notified
+	received = receive(2)
+	t.Log(received)
+	checkRecovered := received["/json:check_recovered"]
+	require.NotNil(t, checkRecovered)
+	assert.Equal(t, "Green", checkRecovered["status"])
+	assert.Nil(t, received["/json:check_red"])
+	assert.Equal(t, "resolve", received["/pagerduty:"+Foo.ID]["event_action"])
+	assert.Equal(t, "resolve", received["/pagerduty:overall-health"]["event_action"])
+}
+
+func TestModule_InvalidOpts(t *testing.T) {
+	t.Parallel()
+
+	cases := []struct {
+		name string
+		opts notify.Opts
+		err  error
+	}{
+		{"no webhooks", notify.Opts{}, notify.ErrNoWebhooks},
+		{"blank URL", notify.Opts{Webhooks: []notify.Webhook{{Format: notify.Slack}}}, notify.ErrInvalidURL},
+		{"relative URL", notify.Opts{Webhooks: []notify.Webhook{{URL: "/foo"}}}, notify.ErrInvalidURL},
+		{"PagerDuty routing key", notify.Opts{Webhooks: []notify.Webhook{{Format: notify.PagerDuty}}}, notify.ErrBlankRoutingKey},
+		{"unsupported format", notify.Opts{Webhooks: []notify.Webhook{{URL: "http://foo", Format: notify.Format(99)}}}, notify.ErrUnsupportedFormat},
+	}
+
+	for _, c := range cases {
+		c := c
+		t.Run(c.name, func(t *testing.T) {
+			app := fx.New(
+				health.Module(health.DefaultOpts()),
+				fx.Provide(func() *zerolog.Logger {
+					logger := zerolog.Nop()
+					return &logger
+				}),
+				notify.Module(c.opts),
+			)
+			require.Error(t, app.Err())
+			assert.Contains(t, app.Err().Error(), c.err.Error())
+		})
+	}
+}
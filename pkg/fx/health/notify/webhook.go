@@ -0,0 +1,111 @@
+/*
+ * Copyright (c) 2019 OysterPack, Inc.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ * http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package notify
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+)
+
+// encodes the notification using the webhook format
+func (w Webhook) payload(n Notification) ([]byte, error) {
+	switch w.Format {
+	case Slack:
+		return json.Marshal(struct {
+			Text string `json:"text"`
+		}{n.String()})
+	case PagerDuty:
+		return json.Marshal(pagerDutyEvent(w.RoutingKey, n))
+	default:
+		return json.Marshal(n)
+	}
+}
+
+func (w Webhook) post(client *http.Client, n Notification) error {
+	payload, err := w.payload(n)
+	if err != nil {
+		return err
+	}
+	response, err := client.Post(w.url(), "application/json", bytes.NewReader(payload))
+	if err != nil {
+		return err
+	}
+	defer response.Body.Close()
+	// drain the response body to enable the connection to be reused
+	io.Copy(ioutil.Discard, response.Body)
+	if response.StatusCode < 200 || response.StatusCode > 299 {
+		return fmt.Errorf("webhook responded with HTTP status: %s", response.Status)
+	}
+	return nil
+}
+
+// used as the PagerDuty dedup key for overall health notifications
+const overallHealthDedupKey = "overall-health"
+
+// https://developer.pagerduty.com/docs/events-api-v2/trigger-events/
+type pagerDutyEventPayload struct {
+	RoutingKey  string            `json:"routing_key"`
+	EventAction string            `json:"event_action"`
+	DedupKey    string            `json:"dedup_key"`
+	Payload     *pagerDutyPayload `json:"payload,omitempty"`
+}
+
+type pagerDutyPayload struct {
+	Summary       string       `json:"summary"`
+	Source        string       `json:"source"`
+	Severity      string       `json:"severity"`
+	Timestamp     string       `json:"timestamp"`
+	CustomDetails Notification `json:"custom_details"`
+}
+
+// - health check Red results trigger incidents, which are resolved when the health check recovers
+// - overall health changes trigger incidents when not Green, and are resolved when the overall health is Green
+func pagerDutyEvent(routingKey string, n Notification) pagerDutyEventPayload {
+	event := pagerDutyEventPayload{
+		RoutingKey:  routingKey,
+		EventAction: "trigger",
+		DedupKey:    overallHealthDedupKey,
+	}
+	if n.Check != nil {
+		event.DedupKey = n.Check.ID
+	}
+	if n.Event == CheckRecovered || (n.Event == OverallHealthChanged && n.Status == "Green") {
+		event.EventAction = "resolve"
+		return event
+	}
+
+	severity := "critical"
+	if n.Status == "Yellow" {
+		severity = "warning"
+	}
+	source := n.Source
+	if source == "" {
+		source = "unknown"
+	}
+	event.Payload = &pagerDutyPayload{
+		Summary:       n.String(),
+		Source:        source,
+		Severity:      severity,
+		Timestamp:     n.Time.Format("2006-01-02T15:04:05.000Z07:00"),
+		CustomDetails: n,
+	}
+	return event
+}
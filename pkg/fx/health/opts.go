@@ -16,7 +16,14 @@
 
 package health
 
-import "time"
+import (
+	"context"
+	"time"
+)
+
+// CheckerInterceptor is used to intercept health checkers, e.g., to instrument them or to inject faults. The interceptor
+// is applied when the health check is registered, and the returned checker is scheduled in place of the checker.
+type CheckerInterceptor func(check Check, checker func(ctx context.Context) (Status, error)) func(ctx context.Context) (Status, error)
 
 // Opts are used to configure the fx module.
 type Opts struct {
@@ -28,11 +35,26 @@ type Opts struct {
 
 	MaxCheckParallelism uint8
 
+	// SubscriptionBufferSize is the max number of messages that are buffered per subscription. When a subscription buffer
+	// is full, the oldest message is dropped.
+	//
+	// default = 64
+	SubscriptionBufferSize int
+
+	// ShutdownTimeout is the max amount of time to wait for in-flight health checks to complete when the health service is
+	// shutdown. In-flight health check results are published to subscribers before the subscriptions are closed.
+	//
+	// default = 5s
+	ShutdownTimeout time.Duration
+
 	// FailFastOnStartup means the app will fail fast if any health checks fail to pass on app start up.
 	// If true, then all registered health checks are run on application startup.
 	//
 	// default = false
 	FailFastOnStartup bool
+
+	// Interceptor is optional - if specified, then it is applied to all registered health checkers
+	Interceptor CheckerInterceptor
 }
 
 // DefaultOpts constructs a new Opts using recommended default values.
@@ -45,6 +67,10 @@ func DefaultOpts() Opts {
 		DefaultTimeout:     DefaultTimeout,
 
 		MaxCheckParallelism: MaxCheckParallelism,
+
+		SubscriptionBufferSize: DefaultSubscriptionBufferSize,
+
+		ShutdownTimeout: DefaultShutdownTimeout,
 	}
 }
 
@@ -72,8 +98,26 @@ func (o Opts) SetDefaultRunInterval(runInterval time.Duration) Opts {
 	return o
 }
 
+// SetSubscriptionBufferSize sets the max number of messages that are buffered per subscription
+func (o Opts) SetSubscriptionBufferSize(size int) Opts {
+	o.SubscriptionBufferSize = size
+	return o
+}
+
+// SetShutdownTimeout sets the max amount of time to wait for in-flight health checks to complete on shutdown
+func (o Opts) SetShutdownTimeout(timeout time.Duration) Opts {
+	o.ShutdownTimeout = timeout
+	return o
+}
+
 // SetFailFastOnStartup sets the fail fast on startup setting
 func (o Opts) SetFailFastOnStartup(failFastOnStartup bool) Opts {
 	o.FailFastOnStartup = failFastOnStartup
 	return o
 }
+
+// SetInterceptor sets the health checker interceptor
+func (o Opts) SetInterceptor(interceptor CheckerInterceptor) Opts {
+	o.Interceptor = interceptor
+	return o
+}
@@ -0,0 +1,112 @@
+/*
+ * Copyright (c) 2019 OysterPack, Inc.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ * http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package health
+
+import (
+	"fmt"
+	"strings"
+)
+
+// Query is used to filter and paginate the registered health checks and health check results, e.g., for admin APIs
+// when hundreds of health checks are registered - see `RegisteredChecks` and `CheckResults`.
+//
+// All of the specified filters must match. The zero value matches all health checks, i.e., all health checks are returned
+// in registration order.
+type Query struct {
+	// Statuses matches health checks whose latest result status is any of the specified statuses. Health checks that have
+	// not yet run do not match.
+	Statuses []Status
+	// Tags matches health checks that have all of the specified tags
+	Tags []string
+	// IDs matches health checks whose ID is any of the specified IDs
+	IDs []string
+	// IDPrefix matches health checks whose ID has the specified prefix
+	IDPrefix string
+
+	// SortByID means the matching health checks are sorted by ID before they are paginated, instead of registration order
+	SortByID bool
+
+	// Offset is the number of matching health checks to skip
+	Offset int
+	// Limit is the max number of health checks to return. If zero, then there is no limit.
+	//
+	// NOTE: negative offsets and limits are treated as zero
+	Limit int
+}
+
+// ParseStatus parses the status name, which is case insensitive, e.g., "green", "Yellow", "RED"
+func ParseStatus(s string) (Status, error) {
+	for _, status := range []Status{Green, Yellow, Red} {
+		if strings.EqualFold(s, status.String()) {
+			return status, nil
+		}
+	}
+	return Red, fmt.Errorf("invalid health check status : %q", s)
+}
+
+func (q Query) matches(check Check, result *Result) bool {
+	if len(q.Statuses) > 0 {
+		if result == nil || !q.matchesStatus(result.Status) {
+			return false
+		}
+	}
+	if q.IDPrefix != "" && !strings.HasPrefix(check.ID, q.IDPrefix) {
+		return false
+	}
+	if len(q.IDs) > 0 && !containsString(q.IDs, check.ID) {
+		return false
+	}
+	for _, tag := range q.Tags {
+		if !containsString(check.Tags, tag) {
+			return false
+		}
+	}
+	return true
+}
+
+func (q Query) matchesStatus(status Status) bool {
+	for _, s := range q.Statuses {
+		if s == status {
+			return true
+		}
+	}
+	return false
+}
+
+// page returns the [start:end] slice bounds for the page within the specified number of matching health checks
+func (q Query) page(count int) (start, end int) {
+	if q.Offset > 0 {
+		start = q.Offset
+	}
+	if start > count {
+		start = count
+	}
+	end = count
+	if q.Limit > 0 && q.Limit < end-start {
+		end = start + q.Limit
+	}
+	return start, end
+}
+
+func containsString(values []string, value string) bool {
+	for _, v := range values {
+		if v == value {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,192 @@
+/*
+ * Copyright (c) 2019 OysterPack, Inc.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ * http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package health
+
+import (
+	"hash/fnv"
+	"sort"
+	"sync"
+	"sync/atomic"
+)
+
+// the number of registry shards - registry operations on health checks that map to different shards do not contend
+const registryShardCount = 16
+
+// registry stores the registered health checks along with their latest results.
+//
+// The registry is sharded by health check ID, where each shard is protected by a RWMutex. Thus, recording health check
+// results and querying the registry scales with the number of health checks.
+type registry struct {
+	shards [registryShardCount]registryShard
+	// used to track registration order
+	seq uint64
+}
+
+type registryShard struct {
+	sync.RWMutex
+	checks map[string]*registration
+}
+
+type registration struct {
+	RegisteredCheck
+	// registration sequence
+	seq uint64
+	// closed when the health check is unregistered, which stops the health check from being scheduled
+	stop chan struct{}
+	// latest result - nil if the health check has not yet run
+	result *Result
+}
+
+func newRegistry() *registry {
+	r := &registry{}
+	for i := range r.shards {
+		r.shards[i].checks = make(map[string]*registration)
+	}
+	return r
+}
+
+func (r *registry) shard(id string) *registryShard {
+	h := fnv.New32a()
+	h.Write([]byte(id))
+	return &r.shards[h.Sum32()%registryShardCount]
+}
+
+// add registers the health check - false is returned if a health check with the same ID is already registered
+func (r *registry) add(check RegisteredCheck) (*registration, bool) {
+	shard := r.shard(check.ID)
+	shard.Lock()
+	defer shard.Unlock()
+	if _, exists := shard.checks[check.ID]; exists {
+		return nil, false
+	}
+	reg := &registration{
+		RegisteredCheck: check,
+		seq:             atomic.AddUint64(&r.seq, 1),
+		stop:            make(chan struct{}),
+	}
+	shard.checks[check.ID] = reg
+	return reg, true
+}
+
+// remove unregisters the health check - the onRemove callback is invoked while the shard lock is held.
+// False is returned if the health check is not registered.
+func (r *registry) remove(id string, onRemove func(reg *registration)) bool {
+	shard := r.shard(id)
+	shard.Lock()
+	defer shard.Unlock()
+	reg, exists := shard.checks[id]
+	if !exists {
+		return false
+	}
+	delete(shard.checks, id)
+	close(reg.stop)
+	onRemove(reg)
+	return true
+}
+
+func (r *registry) get(id string) (RegisteredCheck, bool) {
+	shard := r.shard(id)
+	shard.RLock()
+	defer shard.RUnlock()
+	reg, exists := shard.checks[id]
+	if !exists {
+		return RegisteredCheck{}, false
+	}
+	return reg.RegisteredCheck, true
+}
+
+// setResult records the health check's latest result - the onResult callback is invoked with the previous result while
+// the shard lock is held, which guarantees that results for the same health check are processed in order.
+// False is returned if the health check is not registered, e.g., it was unregistered while it was running.
+func (r *registry) setResult(result Result, onResult func(previous *Result)) bool {
+	shard := r.shard(result.ID)
+	shard.Lock()
+	defer shard.Unlock()
+	reg, exists := shard.checks[result.ID]
+	if !exists {
+		return false
+	}
+	previous := reg.result
+	reg.result = &result
+	onResult(previous)
+	return true
+}
+
+// returns the registered checks that match the query in registration order
+func (r *registry) checks(query Query) []RegisteredCheck {
+	type seqCheck struct {
+		seq uint64
+		RegisteredCheck
+	}
+	var seqChecks []seqCheck
+	for i := range r.shards {
+		shard := &r.shards[i]
+		shard.RLock()
+		for _, reg := range shard.checks {
+			if query.matches(reg.Check, reg.result) {
+				seqChecks = append(seqChecks, seqCheck{reg.seq, reg.RegisteredCheck})
+			}
+		}
+		shard.RUnlock()
+	}
+	sort.Slice(seqChecks, func(i, j int) bool {
+		if query.SortByID {
+			return seqChecks[i].ID < seqChecks[j].ID
+		}
+		return seqChecks[i].seq < seqChecks[j].seq
+	})
+
+	start, end := query.page(len(seqChecks))
+	checks := make([]RegisteredCheck, 0, end-start)
+	for _, c := range seqChecks[start:end] {
+		checks = append(checks, c.RegisteredCheck)
+	}
+	return checks
+}
+
+// returns the latest health check results that match the filter and query in registration order, unless the query sorts
+// by ID
+func (r *registry) results(filter func(result Result) bool, query Query) []Result {
+	type seqResult struct {
+		seq uint64
+		Result
+	}
+	var seqResults []seqResult
+	for i := range r.shards {
+		shard := &r.shards[i]
+		shard.RLock()
+		for _, reg := range shard.checks {
+			if reg.result != nil && (filter == nil || filter(*reg.result)) && query.matches(reg.Check, reg.result) {
+				seqResults = append(seqResults, seqResult{reg.seq, *reg.result})
+			}
+		}
+		shard.RUnlock()
+	}
+	sort.Slice(seqResults, func(i, j int) bool {
+		if query.SortByID {
+			return seqResults[i].ID < seqResults[j].ID
+		}
+		return seqResults[i].seq < seqResults[j].seq
+	})
+
+	start, end := query.page(len(seqResults))
+	results := make([]Result, 0, end-start)
+	for _, r := range seqResults[start:end] {
+		results = append(results, r.Result)
+	}
+	return results
+}
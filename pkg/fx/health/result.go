@@ -17,7 +17,9 @@
 package health
 
 import (
+	"context"
 	"fmt"
+	"go.uber.org/multierr"
 	"time"
 )
 
@@ -29,6 +31,11 @@ type Result struct {
 	Status Status
 	// error should be nil if the status is `Green`
 	Err error
+	// SubResults are the sub-check results for composite health checks - see Composite
+	SubResults []SubResult
+	// Details is optional structured failure metadata that checkers can report, e.g., latency, endpoint, attempted host,
+	// or error class, because a bare error is often insufficient for triage - see SetDetail
+	Details map[string]interface{}
 
 	// Time is when the health check was run
 	time.Time
@@ -36,6 +43,42 @@ type Result struct {
 	time.Duration
 }
 
+// TimedOut returns true if the health check run timed out - see ErrTimeout
+func (r Result) TimedOut() bool {
+	for _, err := range multierr.Errors(r.Err) {
+		if err == ErrTimeout {
+			return true
+		}
+	}
+	return false
+}
+
+// well known Result.Details keys
+const (
+	// DetailLatency is the latency of the call that was made to check the dependency, e.g., as a time.Duration
+	DetailLatency = "latency"
+	// DetailEndpoint is the endpoint that was checked, e.g., a URL
+	DetailEndpoint = "endpoint"
+	// DetailHost is the host that was attempted, e.g., the resolved IP address
+	DetailHost = "host"
+	// DetailErrorClass classifies the failure, e.g., "timeout", "connection_refused", "dns", "tls"
+	DetailErrorClass = "error_class"
+	// DetailPanicStack is the stack trace of a recovered checker panic - see ErrCheckerPanic
+	DetailPanicStack = "panic_stack"
+)
+
+// SetDetail reports structured details for the health check result, which are reported via Result.Details - see the
+// well known detail keys, e.g., DetailEndpoint. Checkers must use the context that was passed to the checker by the
+// health service. If the checker is not being run by the health service, then the details are discarded.
+//
+// SetDetail is safe to use concurrently, e.g., by composite sub-checks, whose details are reported via the composite
+// health check's result.
+func SetDetail(ctx context.Context, key string, value interface{}) {
+	if recorder, ok := ctx.Value(resultRecorderContextKey{}).(*resultRecorder); ok {
+		recorder.setDetail(key, value)
+	}
+}
+
 func (r *Result) String() string {
 	return fmt.Sprintf("Result{ID: %q, Status: %s, Time: %s, Duration: %s", r.ID, r.Status, r.Time, r.Duration)
 }
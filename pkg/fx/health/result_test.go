@@ -0,0 +1,90 @@
+/*
+ * Copyright (c) 2019 OysterPack, Inc.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ * http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package health_test
+
+import (
+	"context"
+	"errors"
+	"github.com/oysterpack/andiamo/pkg/fx/health"
+	"github.com/oysterpack/andiamo/pkg/ulids"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.uber.org/fx"
+	"testing"
+	"time"
+)
+
+func TestSetDetail(t *testing.T) {
+	t.Parallel()
+
+	var shutdowner fx.Shutdowner
+	var register health.Register
+	var runCheckNow health.RunCheckNow
+	app := fx.New(
+		health.Module(health.DefaultOpts()),
+		fx.Populate(&shutdowner, &register, &runCheckNow),
+	)
+	require.Nil(t, app.Err(), "app initialization failed : %v", app.Err())
+
+	runApp(t, app, shutdowner, func() {
+		t.Run("checker reports details", func(t *testing.T) {
+			check := health.Check{ID: ulids.MustNew().String(), Description: "Foo", RedImpact: "App is unusable"}
+			require.NoError(t, register(check, health.CheckerOpts{RunInterval: time.Hour}, func(ctx context.Context) (health.Status, error) {
+				health.SetDetail(ctx, health.DetailEndpoint, "https://api.example.com")
+				health.SetDetail(ctx, health.DetailLatency, time.Second)
+				health.SetDetail(ctx, health.DetailErrorClass, "timeout")
+				return health.Red, errors.New("request timed out")
+			}))
+
+			result, err := runCheckNow(check.ID)
+			require.NoError(t, err)
+			assert.Equal(t, map[string]interface{}{
+				health.DetailEndpoint:   "https://api.example.com",
+				health.DetailLatency:    time.Second,
+				health.DetailErrorClass: "timeout",
+			}, result.Details)
+		})
+
+		t.Run("composite sub-checks report details", func(t *testing.T) {
+			subCheck := func(host string) health.SubCheck {
+				return health.SubCheck{Name: host, Checker: func(ctx context.Context) (health.Status, error) {
+					health.SetDetail(ctx, host, health.Green.String())
+					return health.Green, nil
+				}}
+			}
+			check := health.Check{ID: ulids.MustNew().String(), Description: "Foo", RedImpact: "App is unusable"}
+			require.NoError(t, register(check, health.CheckerOpts{RunInterval: time.Hour}, health.Composite(subCheck("host-1"), subCheck("host-2"))))
+
+			result, err := runCheckNow(check.ID)
+			require.NoError(t, err)
+			assert.Equal(t, map[string]interface{}{"host-1": "Green", "host-2": "Green"}, result.Details)
+		})
+
+		t.Run("no details", func(t *testing.T) {
+			check := health.Check{ID: ulids.MustNew().String(), Description: "Foo", RedImpact: "App is unusable"}
+			require.NoError(t, register(check, health.CheckerOpts{RunInterval: time.Hour}, func(ctx context.Context) (health.Status, error) {
+				return health.Green, nil
+			}))
+			result, err := runCheckNow(check.ID)
+			require.NoError(t, err)
+			assert.Nil(t, result.Details)
+		})
+	})
+
+	// details are discarded if the checker is not being run by the health service
+	health.SetDetail(context.Background(), health.DetailHost, "localhost")
+}
@@ -0,0 +1,223 @@
+/*
+ * Copyright (c) 2019 OysterPack, Inc.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ * http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package health
+
+import (
+	"github.com/oysterpack/andiamo/pkg/clock"
+	"sync"
+	"time"
+)
+
+// QueueStats is a snapshot of the health check run queue stats
+type QueueStats struct {
+	// MaxParallelism is the max number of health checks that can run concurrently
+	MaxParallelism int
+	// Running is the number of health checks that are currently running
+	Running int
+	// Queued is the number of health check runs that are waiting to run because max parallelism is saturated
+	Queued int
+	// Dispatched is the total number of health check runs that have been dispatched
+	Dispatched uint64
+	// WaitTime is the total time that dispatched health check runs spent waiting in the queue
+	WaitTime time.Duration
+}
+
+// runQueue limits the number of health checks that are allowed to run concurrently.
+//
+// When max parallelism is saturated, health check runs are queued per health check family and dispatched round-robin
+// across the families, i.e., a family of slow health checks cannot starve other health checks. The health check family
+// is the health check's first tag. Health checks with no tags are their own family.
+//
+// Both scheduled runs and on demand runs are queued, i.e., scheduled runs are submitted without blocking, and run on their
+// own goroutine when they are dispatched, while on demand runs block until they are dispatched - see submit() and
+// acquire(). Thus, the queue stats report the whole backlog.
+type runQueue struct {
+	mutex sync.Mutex
+	clock clock.Clock
+
+	maxParallelism int
+	running        int
+	queued         int
+	// queued runs per family
+	queues map[string][]*queuedRun
+	// families with queued runs in round-robin order
+	families []string
+
+	dispatched uint64
+	waitTime   time.Duration
+}
+
+// queuedRun is a health check run that is waiting to be dispatched
+type queuedRun struct {
+	enqueued time.Time
+	// closed when the run is dispatched - used by acquire()
+	ready chan struct{}
+	// run on its own goroutine when the run is dispatched - used by submit()
+	run func()
+}
+
+func newRunQueue(maxParallelism uint8, clock clock.Clock) *runQueue {
+	return &runQueue{
+		clock:          clock,
+		maxParallelism: int(maxParallelism),
+		queues:         make(map[string][]*queuedRun),
+	}
+}
+
+func checkFamily(check Check) string {
+	if len(check.Tags) > 0 {
+		return check.Tags[0]
+	}
+	return check.ID
+}
+
+// acquire blocks until the health check is allowed to run. If stop is closed while waiting, then false is returned.
+// If true is returned, then release must be called when the health check run is done.
+func (q *runQueue) acquire(family string, stop <-chan struct{}) bool {
+	q.mutex.Lock()
+	if q.tryDispatch() {
+		q.mutex.Unlock()
+		return true
+	}
+	run := &queuedRun{enqueued: q.clock.Now(), ready: make(chan struct{})}
+	q.enqueue(family, run)
+	q.mutex.Unlock()
+
+	select {
+	case <-run.ready:
+		return true
+	case <-stop:
+		q.mutex.Lock()
+		defer q.mutex.Unlock()
+		if q.remove(family, run) {
+			return false
+		}
+		// the run was dispatched concurrently with the stop
+		q.running--
+		q.dispatch()
+		return false
+	}
+}
+
+// submit runs the health check on its own goroutine when it is allowed to run, i.e., submit does not block. The run slot
+// is released when the run returns.
+func (q *runQueue) submit(family string, run func()) {
+	q.mutex.Lock()
+	defer q.mutex.Unlock()
+	if q.tryDispatch() {
+		go q.runSubmitted(run)
+		return
+	}
+	q.enqueue(family, &queuedRun{enqueued: q.clock.Now(), run: run})
+}
+
+func (q *runQueue) runSubmitted(run func()) {
+	defer q.release()
+	run()
+}
+
+func (q *runQueue) release() {
+	q.mutex.Lock()
+	defer q.mutex.Unlock()
+	q.running--
+	q.dispatch()
+}
+
+// tryDispatch dispatches the run immediately if max parallelism is not saturated and no runs are queued.
+// NOTE: the mutex must be held by the caller
+func (q *runQueue) tryDispatch() bool {
+	if q.running < q.maxParallelism && q.queued == 0 {
+		q.running++
+		q.dispatched++
+		return true
+	}
+	return false
+}
+
+// NOTE: the mutex must be held by the caller
+func (q *runQueue) enqueue(family string, run *queuedRun) {
+	if _, ok := q.queues[family]; !ok {
+		q.families = append(q.families, family)
+	}
+	q.queues[family] = append(q.queues[family], run)
+	q.queued++
+}
+
+// dispatches the next queued run, if any, from the family that is next in round-robin order.
+// NOTE: the mutex must be held by the caller
+func (q *runQueue) dispatch() {
+	if q.running >= q.maxParallelism || len(q.families) == 0 {
+		return
+	}
+	family := q.families[0]
+	queue := q.queues[family]
+	run := queue[0]
+	if len(queue) == 1 {
+		delete(q.queues, family)
+		q.families = q.families[1:]
+	} else {
+		q.queues[family] = queue[1:]
+		// move the family to the back of the line
+		q.families = append(q.families[1:], family)
+	}
+	q.queued--
+	q.running++
+	q.dispatched++
+	q.waitTime += q.clock.Since(run.enqueued)
+	if run.run != nil {
+		go q.runSubmitted(run.run)
+		return
+	}
+	close(run.ready)
+}
+
+// removes the queued run - returns false if the run is not queued, i.e., it has already been dispatched.
+// NOTE: the mutex must be held by the caller
+func (q *runQueue) remove(family string, run *queuedRun) bool {
+	queue := q.queues[family]
+	for i, r := range queue {
+		if r == run {
+			queue = append(queue[:i:i], queue[i+1:]...)
+			q.queued--
+			if len(queue) > 0 {
+				q.queues[family] = queue
+				return true
+			}
+			delete(q.queues, family)
+			for j, f := range q.families {
+				if f == family {
+					q.families = append(q.families[:j:j], q.families[j+1:]...)
+					break
+				}
+			}
+			return true
+		}
+	}
+	return false
+}
+
+func (q *runQueue) stats() QueueStats {
+	q.mutex.Lock()
+	defer q.mutex.Unlock()
+	return QueueStats{
+		MaxParallelism: q.maxParallelism,
+		Running:        q.running,
+		Queued:         q.queued,
+		Dispatched:     q.dispatched,
+		WaitTime:       q.waitTime,
+	}
+}
@@ -0,0 +1,103 @@
+/*
+ * Copyright (c) 2019 OysterPack, Inc.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ * http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package health
+
+import (
+	"github.com/oysterpack/andiamo/pkg/clock"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"runtime"
+	"testing"
+	"time"
+)
+
+func TestRunQueue(t *testing.T) {
+	t.Parallel()
+
+	// queues a run for the specified family, and waits until the run is queued
+	// - when the run is dispatched, the family is sent on the dispatched channel
+	enqueue := func(q *runQueue, family string, stop <-chan struct{}, dispatched chan<- string) <-chan bool {
+		queued := q.stats().Queued
+		acquired := make(chan bool, 1)
+		go func() {
+			ok := q.acquire(family, stop)
+			if ok {
+				dispatched <- family
+			}
+			acquired <- ok
+		}()
+		for q.stats().Queued == queued {
+			runtime.Gosched()
+		}
+		return acquired
+	}
+
+	t.Run("queued runs are dispatched round-robin across families", func(t *testing.T) {
+		t.Parallel()
+		fakeClock := clock.NewFake(time.Date(2019, time.September, 1, 0, 0, 0, 0, time.UTC))
+		q := newRunQueue(1, fakeClock)
+		stop := make(chan struct{})
+		require.True(t, q.acquire("A", stop))
+
+		dispatched := make(chan string, 4)
+		for _, family := range []string{"A", "A", "A", "B"} {
+			enqueue(q, family, stop, dispatched)
+		}
+		// the queued runs wait 1 sec before they are dispatched
+		fakeClock.Advance(time.Second)
+		stats := q.stats()
+		assert.Equal(t, 1, stats.Running)
+		assert.Equal(t, 4, stats.Queued)
+
+		var order []string
+		for i := 0; i < 4; i++ {
+			q.release()
+			order = append(order, <-dispatched)
+		}
+		q.release()
+		// the slow family A is not allowed to starve family B
+		assert.Equal(t, []string{"A", "B", "A", "A"}, order)
+
+		stats = q.stats()
+		assert.Equal(t, 0, stats.Running)
+		assert.Equal(t, 0, stats.Queued)
+		assert.Equal(t, uint64(5), stats.Dispatched)
+		assert.Equal(t, 4*time.Second, stats.WaitTime)
+	})
+
+	t.Run("queued runs are abandoned when stopped", func(t *testing.T) {
+		t.Parallel()
+		q := newRunQueue(1, clock.Real())
+		stop := make(chan struct{})
+		require.True(t, q.acquire("A", stop))
+
+		dispatched := make(chan string, 2)
+		acquired := []<-chan bool{
+			enqueue(q, "A", stop, dispatched),
+			enqueue(q, "B", stop, dispatched),
+		}
+		close(stop)
+		for _, ok := range acquired {
+			assert.False(t, <-ok)
+		}
+		stats := q.stats()
+		assert.Equal(t, 1, stats.Running)
+		assert.Equal(t, 0, stats.Queued)
+		assert.Empty(t, q.families)
+		assert.Empty(t, q.queues)
+	})
+}
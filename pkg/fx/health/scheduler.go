@@ -0,0 +1,152 @@
+/*
+ * Copyright (c) 2019 OysterPack, Inc.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ * http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package health
+
+import (
+	"container/heap"
+	"github.com/oysterpack/andiamo/pkg/clock"
+	"time"
+)
+
+// scheduler runs the registered health checks on their run intervals.
+//
+// A single goroutine manages the schedule, which is ordered by next run time. When health checks are due, they are
+// submitted to the run queue, i.e., scheduled runs are subject to the max check parallelism and are dispatched
+// round-robin across health check families, the same as on demand runs. The number of goroutines does not grow with the
+// number of registered health checks, because a goroutine is only started when a run is dispatched. When the run is
+// done, the health check is rescheduled, i.e., runs of the same health check never overlap.
+//
+// The run interval is measured from the scheduled run time, which compensates for the health check execution time and
+// the time spent waiting in the run queue, i.e., the schedule does not drift - see `nextRun()`.
+type scheduler struct {
+	clock clock.Clock
+	stop  <-chan struct{}
+	add   chan *scheduledCheck
+	queue *runQueue
+	// runs the health check, which must not acquire the run queue, i.e., the run was dispatched by the run queue
+	runCheck func(check RegisteredCheck)
+}
+
+type scheduledCheck struct {
+	RegisteredCheck
+	// closed when the health check is unregistered
+	stop <-chan struct{}
+	next time.Time
+}
+
+func newScheduler(clock clock.Clock, stop <-chan struct{}, queue *runQueue, runCheck func(check RegisteredCheck)) *scheduler {
+	return &scheduler{
+		clock:    clock,
+		stop:     stop,
+		add:      make(chan *scheduledCheck),
+		queue:    queue,
+		runCheck: runCheck,
+	}
+}
+
+// schedule schedules the health check to run at the specified time. False is returned if the scheduler is stopped.
+func (s *scheduler) schedule(check RegisteredCheck, stop <-chan struct{}, next time.Time) bool {
+	return s.reschedule(&scheduledCheck{check, stop, next})
+}
+
+func (s *scheduler) reschedule(check *scheduledCheck) bool {
+	select {
+	case <-s.stop:
+		return false
+	case <-check.stop:
+		return false
+	case s.add <- check:
+		return true
+	}
+}
+
+func (s *scheduler) run() {
+	var checks schedule
+	timer := s.clock.NewTimer(time.Hour)
+	timer.Stop()
+	defer timer.Stop()
+
+	for {
+		if len(checks) > 0 {
+			timer.Reset(s.clock.Until(checks[0].next))
+		}
+		select {
+		case <-s.stop:
+			return
+		case check := <-s.add:
+			heap.Push(&checks, check)
+		case <-timer.C():
+			now := s.clock.Now()
+			for len(checks) > 0 && !checks[0].next.After(now) {
+				s.submit(heap.Pop(&checks).(*scheduledCheck))
+			}
+		}
+		if !timer.Stop() {
+			select {
+			case <-timer.C():
+			default:
+			}
+		}
+	}
+}
+
+// submit submits the due health check to the run queue
+func (s *scheduler) submit(check *scheduledCheck) {
+	s.queue.submit(checkFamily(check.Check), func() {
+		select {
+		case <-s.stop:
+			return
+		case <-check.stop: // the health check has been unregistered
+			return
+		default:
+		}
+		s.runCheck(check.RegisteredCheck)
+		check.next = nextRun(check.next, check.RunInterval, s.clock.Now())
+		s.reschedule(check)
+	})
+}
+
+// nextRun returns the health check's next run time, which is measured from the scheduled run time instead of when the
+// run completed. If the run overran the run interval, then the missed runs are skipped, i.e., the next run is scheduled
+// for the next run interval boundary after now.
+func nextRun(scheduled time.Time, runInterval time.Duration, now time.Time) time.Time {
+	next := scheduled.Add(runInterval)
+	if next.After(now) {
+		return next
+	}
+	return next.Add(runInterval * (now.Sub(next)/runInterval + 1))
+}
+
+// schedule implements heap.Interface, ordered by next run time
+type schedule []*scheduledCheck
+
+func (s schedule) Len() int { return len(s) }
+
+func (s schedule) Less(i, j int) bool { return s[i].next.Before(s[j].next) }
+
+func (s schedule) Swap(i, j int) { s[i], s[j] = s[j], s[i] }
+
+func (s *schedule) Push(x interface{}) { *s = append(*s, x.(*scheduledCheck)) }
+
+func (s *schedule) Pop() interface{} {
+	old := *s
+	n := len(old)
+	check := old[n-1]
+	old[n-1] = nil
+	*s = old[:n-1]
+	return check
+}
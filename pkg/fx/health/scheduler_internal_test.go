@@ -0,0 +1,131 @@
+/*
+ * Copyright (c) 2019 OysterPack, Inc.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ * http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package health
+
+import (
+	"context"
+	"github.com/oysterpack/andiamo/pkg/clock"
+	"github.com/oysterpack/andiamo/pkg/ulids"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"runtime"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestNextRun(t *testing.T) {
+	t.Parallel()
+
+	scheduled := time.Date(2019, time.September, 1, 0, 0, 0, 0, time.UTC)
+	tests := []struct {
+		name string
+		now  time.Time
+		next time.Time
+	}{
+		{"run completed immediately", scheduled, scheduled.Add(time.Minute)},
+		{"execution time is compensated", scheduled.Add(10 * time.Second), scheduled.Add(time.Minute)},
+		{"run completed on the next boundary", scheduled.Add(time.Minute), scheduled.Add(2 * time.Minute)},
+		{"missed runs are skipped", scheduled.Add(150 * time.Second), scheduled.Add(3 * time.Minute)},
+	}
+	for _, test := range tests {
+		assert.Equal(t, test.next, nextRun(scheduled, time.Minute, test.now), test.name)
+	}
+}
+
+func TestScheduler_NoDrift(t *testing.T) {
+	t.Parallel()
+
+	fakeClock := clock.NewFake(time.Date(2019, time.September, 1, 0, 0, 0, 0, time.UTC))
+	s := newService(DefaultOpts(), fakeClock)
+	go s.run()
+	defer s.TriggerShutdown()
+	sub := s.SubscribeForCheckResults(nil)
+
+	start := fakeClock.Now()
+	var runs int32
+	check := Check{ID: ulids.MustNew().String(), Description: "Foo", RedImpact: "none"}
+	require.NoError(t, s.Register(check, CheckerOpts{RunInterval: time.Minute, Timeout: 10 * time.Second}, func(ctx context.Context) (Status, error) {
+		if atomic.AddInt32(&runs, 1) == 1 {
+			// simulate the health check execution time
+			fakeClock.Advance(5 * time.Second)
+		}
+		return Green, nil
+	}))
+
+	result := <-sub.Chan()
+	assert.Equal(t, start, result.Time)
+	assert.Equal(t, 5*time.Second, result.Duration)
+
+	// the next run is scheduled a minute after the previous scheduled run, i.e., the execution time is compensated for
+	fakeClock.BlockUntil(1)
+	fakeClock.Advance(55 * time.Second)
+	select {
+	case result = <-sub.Chan():
+		assert.Equal(t, start.Add(time.Minute), result.Time)
+	case <-time.After(5 * time.Second):
+		t.Fatal("*** the health check did not run on schedule")
+	}
+}
+
+func TestScheduler_ScheduledRunsAreQueuedFairly(t *testing.T) {
+	t.Parallel()
+
+	fakeClock := clock.NewFake(time.Date(2019, time.September, 1, 0, 0, 0, 0, time.UTC))
+	opts := DefaultOpts()
+	opts.MaxCheckParallelism = 1
+	s := newService(opts, fakeClock)
+	go s.run()
+	defer s.TriggerShutdown()
+
+	// max parallelism is saturated, i.e., the scheduled runs are queued
+	require.True(t, s.runQueue.acquire("X", s.stop))
+
+	familyA, familyB := ulids.MustNew().String(), ulids.MustNew().String()
+	runs := make(chan string, 4)
+	register := func(family string) {
+		check := Check{ID: ulids.MustNew().String(), Description: "Foo", RedImpact: "none", Tags: []string{family}}
+		require.NoError(t, s.Register(check, CheckerOpts{RunInterval: time.Minute}, func(ctx context.Context) (Status, error) {
+			runs <- family
+			return Green, nil
+		}))
+	}
+	for _, family := range []string{familyA, familyA, familyA, familyB} {
+		register(family)
+	}
+	// the runs are submitted by the scheduler goroutine
+	for s.runQueue.stats().Queued < 4 {
+		runtime.Gosched()
+	}
+
+	fakeClock.Advance(time.Second)
+	s.runQueue.release()
+	var order []string
+	for i := 0; i < 4; i++ {
+		select {
+		case family := <-runs:
+			order = append(order, family)
+		case <-time.After(5 * time.Second):
+			t.Fatal("*** timed out waiting for the scheduled runs")
+		}
+	}
+	// family A is not allowed to starve family B
+	assert.Contains(t, order[:2], familyB)
+	stats := s.runQueue.stats()
+	assert.Equal(t, uint64(5), stats.Dispatched)
+	assert.Equal(t, 4*time.Second, stats.WaitTime, "the scheduled runs wait time should be reported")
+}
@@ -17,161 +17,234 @@
 package health
 
 import (
+	"context"
 	"fmt"
+	"github.com/oysterpack/andiamo/pkg/clock"
 	"github.com/pkg/errors"
 	"go.uber.org/multierr"
+	"sort"
+	"sync"
+	"sync/atomic"
 	"time"
 )
 
 type service struct {
 	Opts
-
-	checks []RegisteredCheck
-
-	stop                chan struct{}
-	register            chan registerRequest
-	getRegisteredChecks chan chan<- []RegisteredCheck
-	getCheckResults     chan checkResultsRequest
-	getOverallHealth    chan chan<- Status
-
-	subscribeForRegisteredChecks     chan subscribeForRegisteredChecksRequest
-	subscriptionsForRegisteredChecks map[chan<- RegisteredCheck]struct{}
-
-	subscribeForCheckResults     chan subscribeForCheckResults
-	subscriptionsForCheckResults map[chan<- Result]func(result Result) bool
-
-	subscribeForOverallHealthChanges     chan chan (chan Status)
-	subscriptionsForOverallHealthChanges map[chan<- Status]struct{}
-	overallHealth                        Status
-
+	// used to schedule health checks, enforce timeouts, and measure durations
+	clock clock.Clock
+
+	// closed when the service is shutdown - new health check runs and API requests are rejected
+	stop chan struct{}
+	// closed when the service shutdown is complete, i.e., after in-flight health checks have completed and their results
+	// have been published
+	done chan struct{}
+
+	// checker contexts are derived from this context, which is canceled when the service is shutdown
+	ctx    context.Context
+	cancel context.CancelFunc
+	// the number of checker goroutines that are still running after their context was done
+	orphanedCheckers int32
+	// the number of recovered checker panics per health check ID
+	checkerPanicsMutex sync.Mutex
+	checkerPanics      map[string]uint64
+
+	// tracks the health checks that are currently running
+	inFlightMutex sync.Mutex
+	inFlight      map[string]int
+	inFlightWG    sync.WaitGroup
+	shutdownOnce  sync.Once
+
+	registry  *registry
+	scheduler *scheduler
 	// to protect the application and system from the health checks themselves we want to limit the number of health checks
 	// that are allowed to run concurrently
-	runSemaphore chan struct{}
-	results      chan Result
-	runResults   map[string]Result
+	runQueue *runQueue
+
+	subscriptionsMutex                   sync.RWMutex
+	subscriptionsForRegisteredChecks     subscriptions
+	subscriptionsForCheckResults         subscriptions
+	subscriptionsForOverallHealthChanges subscriptions
+
+	// protects the overall health, which is derived from the number of Yellow and Red health check results
+	overallHealthMutex sync.Mutex
+	yellowCount        int
+	redCount           int
+	overallHealth      Status
 }
 
-func newService(opts Opts) *service {
-	runSemaphore := make(chan struct{}, opts.MaxCheckParallelism)
-	var i uint8
-	for ; i < opts.MaxCheckParallelism; i++ {
-		runSemaphore <- struct{}{}
-	}
+func newService(opts Opts, clock clock.Clock) *service {
+	s := &service{
+		Opts:  opts,
+		clock: clock,
 
-	return &service{
-		stop:                make(chan struct{}),
-		register:            make(chan registerRequest),
-		getRegisteredChecks: make(chan chan<- []RegisteredCheck),
-		getCheckResults:     make(chan checkResultsRequest),
-		getOverallHealth:    make(chan chan<- Status),
+		stop:     make(chan struct{}),
+		done:     make(chan struct{}),
+		inFlight: make(map[string]int),
 
-		subscribeForRegisteredChecks:     make(chan subscribeForRegisteredChecksRequest),
-		subscriptionsForRegisteredChecks: make(map[chan<- RegisteredCheck]struct{}),
+		checkerPanics: make(map[string]uint64),
 
-		subscribeForCheckResults:     make(chan subscribeForCheckResults),
-		subscriptionsForCheckResults: make(map[chan<- Result]func(result Result) bool),
+		registry: newRegistry(),
+		runQueue: newRunQueue(opts.MaxCheckParallelism, clock),
 
-		subscribeForOverallHealthChanges:     make(chan chan (chan Status)),
-		subscriptionsForOverallHealthChanges: make(map[chan<- Status]struct{}),
+		subscriptionsForRegisteredChecks:     make(subscriptions),
+		subscriptionsForCheckResults:         make(subscriptions),
+		subscriptionsForOverallHealthChanges: make(subscriptions),
+	}
+	s.ctx, s.cancel = context.WithCancel(context.Background())
+	s.scheduler = newScheduler(clock, s.stop, s.runQueue, func(check RegisteredCheck) {
+		s.runDispatchedCheck(check)
+	})
+	return s
+}
 
-		runSemaphore: runSemaphore,
-		results:      make(chan Result),
-		runResults:   make(map[string]Result),
+// run runs the health check scheduler until the service is shutdown
+func (s *service) run() {
+	s.scheduler.run()
+}
 
-		Opts: opts,
+func (s *service) stopped() bool {
+	select {
+	case <-s.stop:
+		return true
+	default:
+		return false
 	}
 }
 
-func (s *service) run() {
-	for {
-		select {
-		case <-s.stop:
-			return
-		case req := <-s.register:
-			err := s.Register(req)
-			s.sendError(req.reply, err)
-		case result := <-s.results:
-			s.runResults[result.ID] = result
-			s.updateOverallHealth()
-			s.publishResult(result)
-		case replyChan := <-s.getRegisteredChecks:
-			s.SendRegisteredChecks(replyChan)
-		case replyChan := <-s.getCheckResults:
-			s.SendCheckResults(replyChan)
-		case req := <-s.subscribeForRegisteredChecks:
-			s.SubscribeForRegisteredChecks(req)
-		case req := <-s.subscribeForCheckResults:
-			s.SubscribeForCheckResults(req)
-		case reply := <-s.getOverallHealth:
-			reply <- s.overallHealth
-		case reply := <-s.subscribeForOverallHealthChanges:
-			s.SubscribeForOverallHealthChanges(reply)
+// TriggerShutdown shuts down the service immediately, i.e., without waiting for in-flight health checks to complete.
+// TriggerShutdown is idempotent.
+func (s *service) TriggerShutdown() {
+	s.shutdown(nil)
+}
+
+// Shutdown shuts down the service gracefully:
+//  1. new health check runs and API requests are rejected
+//  2. waits for in-flight health checks to complete, up to the shutdown timeout. The in-flight health check results are
+//     recorded and published.
+//  3. subscriptions are drained and closed, i.e., subscriber channels are closed after the buffered messages have been
+//     delivered. Subscribers are given up to the shutdown timeout to receive the buffered messages.
+//
+// The shutdown timeout is shortened if the context is done before the timeout expires.
+//
+// If any in-flight health checks did not complete before the timeout, then ErrInFlightChecksAbandoned is returned.
+func (s *service) Shutdown(ctx context.Context) error {
+	var err error
+	s.shutdown(func() {
+		timeout := make(chan struct{})
+		go func() {
+			defer close(timeout)
+			timer := s.clock.NewTimer(s.ShutdownTimeout)
+			defer timer.Stop()
+			select {
+			case <-timer.C():
+			case <-ctx.Done():
+			case <-s.done:
+			}
+		}()
+		if ids := s.awaitInFlightChecks(timeout); len(ids) > 0 {
+			err = multierr.Append(ErrInFlightChecksAbandoned, fmt.Errorf("%v", ids))
 		}
-	}
+		// abandoned health checks are canceled
+		s.cancel()
+		s.drainSubscriptions(timeout)
+	})
+	return err
 }
 
-func (s *service) sendError(ch chan<- error, err error) {
-	defer close(ch)
+func (s *service) shutdown(drain func()) {
+	s.shutdownOnce.Do(func() {
+		s.inFlightMutex.Lock()
+		close(s.stop)
+		s.inFlightMutex.Unlock()
 
-	if err == nil {
-		return
-	}
+		if drain != nil {
+			drain()
+		}
+		s.cancel()
+		close(s.done)
+	})
+}
 
+// returns the IDs of the health checks that are still running when the timeout expires
+func (s *service) awaitInFlightChecks(timeout <-chan struct{}) []string {
+	inFlightChecksDone := make(chan struct{})
+	go func() {
+		s.inFlightWG.Wait()
+		close(inFlightChecksDone)
+	}()
 	select {
-	case <-s.stop:
-	case ch <- err:
+	case <-inFlightChecksDone:
+		return nil
+	case <-timeout:
+		s.inFlightMutex.Lock()
+		defer s.inFlightMutex.Unlock()
+		ids := make([]string, 0, len(s.inFlight))
+		for id := range s.inFlight {
+			ids = append(ids, id)
+		}
+		sort.Strings(ids)
+		return ids
 	}
 }
 
-func (s *service) publishResult(result Result) {
-	for ch, filter := range s.subscriptionsForCheckResults {
-		if filter(result) {
-			go func(ch chan<- Result) {
-				select {
-				case <-s.stop:
-				case ch <- result:
-				}
-			}(ch)
+func (s *service) drainSubscriptions(timeout <-chan struct{}) {
+	s.subscriptionsMutex.RLock()
+	var subs []*subscription
+	for _, subscriptions := range []subscriptions{s.subscriptionsForRegisteredChecks, s.subscriptionsForCheckResults, s.subscriptionsForOverallHealthChanges} {
+		for sub := range subscriptions {
+			subs = append(subs, sub)
 		}
 	}
+	s.subscriptionsMutex.RUnlock()
+
+	var wg sync.WaitGroup
+	wg.Add(len(subs))
+	for _, sub := range subs {
+		go func(sub *subscription) {
+			defer wg.Done()
+			sub.drain(timeout)
+		}(sub)
+	}
+	wg.Wait()
 }
 
-// - compute the current overall health
-// - if the overall health status has changed, then notify monitors
-func (s *service) updateOverallHealth() {
-	previous := s.overallHealth
-	s.overallHealth = s.OverallHealth()
-	if previous == s.overallHealth {
-		return
-	}
-	for ch := range s.subscriptionsForOverallHealthChanges {
-		go func(ch chan<- Status, status Status) {
-			select {
-			case <-s.stop:
-			case ch <- status:
-			}
-		}(ch, s.overallHealth)
+// maps subscriptions to their message filters
+type subscriptions map[*subscription]func(msg interface{}) bool
+
+func acceptAll(interface{}) bool { return true }
+
+// publishes the message to the subscriptions that match the filter - closed subscriptions are removed
+func (s *service) publish(subscriptions subscriptions, msg interface{}) {
+	var closed []*subscription
+	s.subscriptionsMutex.RLock()
+	for sub, filter := range subscriptions {
+		switch {
+		case sub.isClosed():
+			closed = append(closed, sub)
+		case filter(msg):
+			sub.publish(msg)
+		}
 	}
-}
+	s.subscriptionsMutex.RUnlock()
 
-func (s *service) TriggerShutdown() {
-	select {
-	case <-s.stop:
-	default:
-		close(s.stop)
+	if len(closed) > 0 {
+		s.subscriptionsMutex.Lock()
+		for _, sub := range closed {
+			delete(subscriptions, sub)
+		}
+		s.subscriptionsMutex.Unlock()
 	}
 }
 
-type registerRequest struct {
-	check   Check
-	opts    CheckerOpts
-	checker func() (Status, error)
-
-	reply chan<- error
+func (s *service) subscribe(subscriptions subscriptions, sub *subscription, filter func(msg interface{}) bool) {
+	s.subscriptionsMutex.Lock()
+	defer s.subscriptionsMutex.Unlock()
+	subscriptions[sub] = filter
 }
 
-func (s *service) Register(req registerRequest) error {
-	WithTimeout := func(id string, check func() (Status, error), timeout time.Duration) Checker {
+// Register registers the health check and schedules it to run immediately.
+func (s *service) Register(check Check, opts CheckerOpts, checker func(ctx context.Context) (Status, error)) error {
+	WithTimeout := func(id string, check func(ctx context.Context) (Status, error), timeout time.Duration) Checker {
 		healthCheckFailure := func(status Status, err error) error {
 			if status == Green {
 				return nil
@@ -184,78 +257,73 @@ func (s *service) Register(req registerRequest) error {
 		}
 
 		return func() Result {
+			ctx, cancel := s.clock.WithTimeout(s.ctx, timeout)
+			defer cancel()
 			reply := make(chan Result, 1)
-			timer := time.After(timeout)
+			// closed when the checker returns
+			checkerDone := make(chan struct{})
 			// run the check
 			go func() {
-				start := time.Now()
-				status, err := check()
-				duration := time.Since(start)
+				defer close(checkerDone)
+				// composite checkers report their sub-check results, and checkers report result details via the context
+				recorder := &resultRecorder{clock: s.clock}
+				start := s.clock.Now()
+				status, err := s.runChecker(ctx, recorder, id, check)
+				duration := s.clock.Since(start)
 				reply <- Result{
 					ID: id,
 
-					Status: status,
-					Err:    healthCheckFailure(status, err),
+					Status:     status,
+					Err:        healthCheckFailure(status, err),
+					SubResults: recorder.results,
+					Details:    recorder.detailsSnapshot(),
 
 					Time:     start,
 					Duration: duration,
 				}
 			}()
 
-			// wait for the check result with a timeout
-			result := func() Result {
-				select {
-				case <-timer: // health check timed out
-					return Result{
-						ID: id,
+			canceled := func() Result {
+				err := ErrTimeout
+				if ctx.Err() == context.Canceled {
+					err = ErrServiceNotRunning
+				}
+				return Result{
+					ID: id,
 
-						Status: Red,
-						Err:    healthCheckFailure(Red, ErrTimeout),
+					Status: Red,
+					Err:    healthCheckFailure(Red, err),
 
-						Time:     time.Now().Add(timeout * -1),
-						Duration: timeout,
-					}
-				case result := <-reply:
-					return result
+					Time:     s.clock.Now().Add(timeout * -1),
+					Duration: timeout,
 				}
-			}()
+			}
 
-			// report the health check result
-			go func() {
+			// wait for the check result with a timeout
+			result := func() Result {
 				select {
-				case <-s.stop:
-				case s.results <- result:
+				case <-ctx.Done(): // health check timed out or the service is shutting down
+					// the checker goroutine is orphaned until the checker returns
+					atomic.AddInt32(&s.orphanedCheckers, 1)
+					go func() {
+						<-checkerDone
+						atomic.AddInt32(&s.orphanedCheckers, -1)
+					}()
+					return canceled()
+				case result := <-reply:
+					// a checker that honors the context may return after the context is done, e.g., with a context error
+					if ctx.Err() != nil {
+						return canceled()
+					}
+					return result
 				}
 			}()
 
+			s.recordResult(result)
 			return result
 		}
 	}
 
-	Schedule := func(id string, check Checker, interval time.Duration) {
-		run := func() {
-			<-s.runSemaphore
-			defer func() {
-				s.runSemaphore <- struct{}{}
-			}()
-			check()
-		}
-
-		// run the health check immediately
-		run()
-
-		// then run it on its specified interval
-		for {
-			timer := time.After(interval)
-			select {
-			case <-s.stop:
-				return
-			case <-timer:
-				run()
-			}
-		}
-	}
-
 	ApplyDefaultOpts := func(opts CheckerOpts) CheckerOpts {
 		if opts.Timeout == time.Duration(0) {
 			opts.Timeout = s.DefaultTimeout
@@ -278,134 +346,211 @@ func (s *service) Register(req registerRequest) error {
 		return err
 	}
 
-	SendRegisteredCheckToSubscribers := func(check RegisteredCheck) {
-		for ch := range s.subscriptionsForRegisteredChecks {
-			go func(ch chan<- RegisteredCheck) {
-				select {
-				case <-s.stop:
-				case ch <- check:
-				}
-			}(ch)
-		}
+	if s.stopped() {
+		return ErrServiceNotRunning
 	}
 
-	check := req.check
-
-	if req.checker == nil {
+	if checker == nil {
 		return multierr.Append(errors.New(check.ID), ErrNilChecker)
 	}
 
-	opts := ApplyDefaultOpts(req.opts)
+	opts = ApplyDefaultOpts(opts)
 	if err := ValidateOpts(opts); err != nil {
 		return multierr.Append(fmt.Errorf("invalid health checker opts: %s : %#v", check.ID, opts), err)
 	}
-
-	if s.RegisteredCheck(check.ID) != nil {
-		return fmt.Errorf("health check is already registered: %s", check.ID)
+	if s.Interceptor != nil {
+		checker = s.Interceptor(check, checker)
 	}
 
-	registeredCheck := RegisteredCheck{
+	reg, ok := s.registry.add(RegisteredCheck{
 		Check:       check,
 		CheckerOpts: opts,
-		Checker:     WithTimeout(check.ID, req.checker, opts.Timeout),
+		Checker:     WithTimeout(check.ID, checker, opts.Timeout),
+	})
+	if !ok {
+		return fmt.Errorf("health check is already registered: %s", check.ID)
+	}
+	s.publish(s.subscriptionsForRegisteredChecks, reg.RegisteredCheck)
+	// run the health check immediately
+	if !s.scheduler.schedule(reg.RegisteredCheck, reg.stop, s.clock.Now()) {
+		return ErrServiceNotRunning
 	}
-	s.checks = append(s.checks, registeredCheck)
-	go Schedule(registeredCheck.ID, registeredCheck.Checker, registeredCheck.RunInterval)
-	SendRegisteredCheckToSubscribers(registeredCheck)
-
 	return nil
 }
 
-func (s *service) RegisteredCheck(id string) *RegisteredCheck {
-	for _, c := range s.checks {
-		if c.ID == id {
-			return &c
+// Unregister stops the scheduled health check and removes the health check and its latest result.
+// The overall health is then updated because the health check no longer applies.
+func (s *service) Unregister(id string) error {
+	if s.stopped() {
+		return ErrServiceNotRunning
+	}
+	removed := s.registry.remove(id, func(reg *registration) {
+		if reg.result != nil {
+			s.updateOverallHealth(reg.result, nil)
 		}
+	})
+	if !removed {
+		return CheckNotRegisteredError{id}
 	}
 	return nil
 }
 
-type checkResultsRequest struct {
-	reply  chan []Result
-	filter func(result Result) bool
+// records the health check result and publishes it to subscribers.
+// Results are ignored if the health check is no longer registered, e.g., it was unregistered while it was running, or
+// if the service shutdown is complete.
+func (s *service) recordResult(result Result) {
+	select {
+	case <-s.done:
+		return
+	default:
+	}
+	s.registry.setResult(result, func(previous *Result) {
+		s.updateOverallHealth(previous, &result)
+		s.publish(s.subscriptionsForCheckResults, result)
+	})
 }
 
-func (s *service) SendCheckResults(req checkResultsRequest) {
-	var results []Result
-	if req.filter == nil {
-		results = make([]Result, 0, len(s.runResults))
-		for _, result := range s.runResults {
-			results = append(results, result)
-		}
-	} else {
-		for _, result := range s.runResults {
-			if req.filter(result) {
-				results = append(results, result)
-			}
+// - updates the status counts using the previous and current results - nil means there is no result
+// - if the overall health status has changed, then notify monitors
+func (s *service) updateOverallHealth(previous, current *Result) {
+	s.overallHealthMutex.Lock()
+	defer s.overallHealthMutex.Unlock()
+
+	count := func(result *Result, delta int) {
+		switch {
+		case result == nil:
+		case result.Status == Yellow:
+			s.yellowCount += delta
+		case result.Status != Green:
+			s.redCount += delta
 		}
 	}
-
-	defer close(req.reply)
-	req.reply <- results
+	count(previous, -1)
+	count(current, 1)
+
+	status := Green
+	switch {
+	case s.redCount > 0:
+		status = Red
+	case s.yellowCount > 0:
+		status = Yellow
+	}
+	if status == s.overallHealth {
+		return
+	}
+	s.overallHealth = status
+	s.publish(s.subscriptionsForOverallHealthChanges, status)
 }
 
-func (s *service) SendRegisteredChecks(reply chan<- []RegisteredCheck) {
-	checks := make([]RegisteredCheck, len(s.checks))
-	copy(checks, s.checks)
-
-	defer close(reply)
-	reply <- checks
+// runChecker runs the checker, recovering from panics, i.e., a panic is reported as a Red result, and the panic stack trace
+// is reported via the result details - see DetailPanicStack
+func (s *service) runChecker(ctx context.Context, recorder *resultRecorder, id string, checker func(ctx context.Context) (Status, error)) (status Status, err error) {
+	defer func() {
+		if p := recover(); p != nil {
+			status, err = Red, recorder.recordPanic(p)
+		}
+		// composite sub-check panics are recovered by the composite checker, and recorded via the result recorder
+		if panics := recorder.panicCount(); panics > 0 {
+			s.checkerPanicsMutex.Lock()
+			s.checkerPanics[id] += panics
+			s.checkerPanicsMutex.Unlock()
+		}
+	}()
+	return checker(withResultRecorder(ctx, recorder))
 }
 
-type subscribeForRegisteredChecksRequest struct {
-	reply chan chan RegisteredCheck
+// CheckerPanics returns the number of recovered checker panics per health check ID
+func (s *service) CheckerPanics() map[string]uint64 {
+	s.checkerPanicsMutex.Lock()
+	defer s.checkerPanicsMutex.Unlock()
+	panics := make(map[string]uint64, len(s.checkerPanics))
+	for id, count := range s.checkerPanics {
+		panics[id] = count
+	}
+	return panics
 }
 
-func (s *service) SubscribeForRegisteredChecks(req subscribeForRegisteredChecksRequest) {
-	ch := make(chan RegisteredCheck)
-	s.subscriptionsForRegisteredChecks[ch] = struct{}{}
-
-	defer close(req.reply)
-	req.reply <- ch
+// RunCheck runs the health check, subject to the max check parallelism constraint.
+// If the service is stopped while the health check run is queued, then false is returned.
+func (s *service) RunCheck(check RegisteredCheck) (Result, bool) {
+	if !s.runQueue.acquire(checkFamily(check.Check), s.stop) {
+		return Result{}, false
+	}
+	defer s.runQueue.release()
+	return s.runDispatchedCheck(check)
 }
 
-type subscribeForCheckResults struct {
-	reply  chan chan Result
-	filter func(result Result) bool
+// runDispatchedCheck runs the health check, which has been dispatched by the run queue
+func (s *service) runDispatchedCheck(check RegisteredCheck) (Result, bool) {
+	// the in-flight check is tracked while holding the mutex to ensure that it is not started after the service is
+	// shutdown, i.e., after the shutdown started waiting for in-flight checks
+	s.inFlightMutex.Lock()
+	if s.stopped() {
+		s.inFlightMutex.Unlock()
+		return Result{}, false
+	}
+	s.inFlight[check.ID]++
+	s.inFlightWG.Add(1)
+	s.inFlightMutex.Unlock()
+	defer func() {
+		s.inFlightMutex.Lock()
+		if s.inFlight[check.ID]--; s.inFlight[check.ID] == 0 {
+			delete(s.inFlight, check.ID)
+		}
+		s.inFlightMutex.Unlock()
+		s.inFlightWG.Done()
+	}()
+
+	return check.Checker(), true
 }
 
-func (s *service) SubscribeForCheckResults(req subscribeForCheckResults) {
-	ch := make(chan Result)
-	if req.filter != nil {
-		s.subscriptionsForCheckResults[ch] = req.filter
-	} else {
-		s.subscriptionsForCheckResults[ch] = func(Result) bool { return true }
+// RunCheckNow runs the registered health check immediately, outside of its schedule.
+func (s *service) RunCheckNow(id string) (Result, error) {
+	if s.stopped() {
+		return Result{}, ErrServiceNotRunning
 	}
-
-	defer close(req.reply)
-	req.reply <- ch
+	check, ok := s.registry.get(id)
+	if !ok {
+		return Result{}, CheckNotRegisteredError{id}
+	}
+	result, ok := s.RunCheck(check)
+	if !ok {
+		return Result{}, ErrServiceNotRunning
+	}
+	return result, nil
 }
 
 func (s *service) OverallHealth() Status {
-	var status Status
-	for _, result := range s.runResults {
-		switch result.Status {
-		case Yellow:
-			status = result.Status
-		case Red:
-			return Red
-		}
+	if s.stopped() {
+		return Red
 	}
+	s.overallHealthMutex.Lock()
+	defer s.overallHealthMutex.Unlock()
+	return s.overallHealth
+}
 
-	return status
+func (s *service) SubscribeForRegisteredChecks() RegisteredCheckSubscription {
+	sub := newRegisteredCheckSubscription(s.SubscriptionBufferSize, s.done)
+	s.subscribe(s.subscriptionsForRegisteredChecks, sub.subscription, acceptAll)
+	return sub
 }
 
-func (s *service) SubscribeForOverallHealthChanges(reply chan (chan Status)) {
-	ch := make(chan Status, 1)
-	ch <- s.overallHealth
-	s.subscriptionsForOverallHealthChanges[ch] = struct{}{}
-	select {
-	case <-s.stop:
-	case reply <- ch:
+func (s *service) SubscribeForCheckResults(filter func(result Result) bool) CheckResultsSubscription {
+	sub := newCheckResultsSubscription(s.SubscriptionBufferSize, s.done)
+	msgFilter := acceptAll
+	if filter != nil {
+		msgFilter = func(msg interface{}) bool { return filter(msg.(Result)) }
 	}
+	s.subscribe(s.subscriptionsForCheckResults, sub.subscription, msgFilter)
+	return sub
+}
+
+func (s *service) SubscribeForOverallHealthChanges() OverallHealthMonitor {
+	monitor := newOverallHealthMonitor(s.SubscriptionBufferSize, s.done)
+	// the overall health mutex is held to ensure that no overall health changes are missed
+	s.overallHealthMutex.Lock()
+	defer s.overallHealthMutex.Unlock()
+	monitor.publish(s.overallHealth)
+	s.subscribe(s.subscriptionsForOverallHealthChanges, monitor.subscription, acceptAll)
+	return monitor
 }
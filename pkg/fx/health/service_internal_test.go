@@ -17,7 +17,15 @@
 package health
 
 import (
+	"context"
+	"github.com/oysterpack/andiamo/pkg/clock"
+	"github.com/oysterpack/andiamo/pkg/ulids"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"sync"
+	"sync/atomic"
 	"testing"
+	"time"
 )
 
 func TestService_TriggerShutdown(t *testing.T) {
@@ -25,7 +33,7 @@ func TestService_TriggerShutdown(t *testing.T) {
 
 	t.Run("trigger shutdown is idempotent", func(t *testing.T) {
 		t.Parallel()
-		s := newService(DefaultOpts())
+		s := newService(DefaultOpts(), clock.Real())
 		go s.run()
 		s.TriggerShutdown()
 		// calling it again should have no effect
@@ -33,3 +41,216 @@ func TestService_TriggerShutdown(t *testing.T) {
 		<-s.stop
 	})
 }
+
+// registers the specified number of health checks that are scheduled to run hourly
+func newBenchmarkService(b *testing.B, count int) (*service, []RegisteredCheck) {
+	s := newService(DefaultOpts(), clock.Real())
+	go s.run()
+	for i := 0; i < count; i++ {
+		check := Check{ID: ulids.MustNew().String(), Description: "Foo", RedImpact: "none"}
+		if err := s.Register(check, CheckerOpts{RunInterval: time.Hour}, func(ctx context.Context) (Status, error) { return Green, nil }); err != nil {
+			b.Fatal(err)
+		}
+	}
+	return s, s.registry.checks(Query{})
+}
+
+func BenchmarkService_RecordResultParallel(b *testing.B) {
+	s, checks := newBenchmarkService(b, 256)
+	defer s.TriggerShutdown()
+	var next uint64
+	b.ResetTimer()
+	b.RunParallel(func(pb *testing.PB) {
+		for pb.Next() {
+			check := checks[atomic.AddUint64(&next, 1)%uint64(len(checks))]
+			s.recordResult(Result{ID: check.ID, Status: Green, Time: time.Now()})
+		}
+	})
+}
+
+func BenchmarkService_CheckResultsParallel(b *testing.B) {
+	s, checks := newBenchmarkService(b, 256)
+	defer s.TriggerShutdown()
+	for _, check := range checks {
+		s.recordResult(Result{ID: check.ID, Status: Green, Time: time.Now()})
+	}
+	b.ResetTimer()
+	b.RunParallel(func(pb *testing.PB) {
+		for pb.Next() {
+			s.registry.results(nil, Query{})
+		}
+	})
+}
+
+func BenchmarkService_OverallHealthParallel(b *testing.B) {
+	s, _ := newBenchmarkService(b, 256)
+	defer s.TriggerShutdown()
+	b.ResetTimer()
+	b.RunParallel(func(pb *testing.PB) {
+		for pb.Next() {
+			s.OverallHealth()
+		}
+	})
+}
+
+func BenchmarkService_Register(b *testing.B) {
+	s := newService(DefaultOpts(), clock.Real())
+	go s.run()
+	defer s.TriggerShutdown()
+	ids := make([]string, b.N)
+	for i := range ids {
+		ids[i] = ulids.MustNew().String()
+	}
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		if err := s.Register(Check{ID: ids[i], Description: "Foo", RedImpact: "none"}, CheckerOpts{RunInterval: time.Hour}, func(ctx context.Context) (Status, error) { return Green, nil }); err != nil {
+			b.Fatal(err)
+		}
+	}
+}
+
+func TestService_Shutdown(t *testing.T) {
+	t.Parallel()
+
+	// registers a health check that signals when it has started running, and completes when it is released, i.e., the
+	// checker ignores the context
+	registerCheck := func(t *testing.T, s *service, release <-chan struct{}) (Check, <-chan struct{}) {
+		check := Check{ID: ulids.MustNew().String(), Description: "Foo", RedImpact: "none"}
+		started := make(chan struct{})
+		var once sync.Once
+		require.NoError(t, s.Register(check, CheckerOpts{RunInterval: time.Hour, Timeout: MaxTimeout}, func(ctx context.Context) (Status, error) {
+			once.Do(func() { close(started) })
+			<-release
+			return Green, nil
+		}))
+		return check, started
+	}
+
+	t.Run("in-flight health checks complete before subscriptions are closed", func(t *testing.T) {
+		t.Parallel()
+		fakeClock := clock.NewFake(time.Date(2019, time.September, 1, 0, 0, 0, 0, time.UTC))
+		s := newService(DefaultOpts(), fakeClock)
+		go s.run()
+		sub := s.SubscribeForCheckResults(nil)
+		release := make(chan struct{})
+		check, started := registerCheck(t, s, release)
+		<-started
+
+		shutdownErr := make(chan error, 1)
+		go func() {
+			shutdownErr <- s.Shutdown(context.Background())
+		}()
+		// wait for the shutdown to wait on the in-flight health check, i.e., the health check timeout timer and the
+		// shutdown timeout timer are active, and then release the health check
+		fakeClock.BlockUntil(2)
+		close(release)
+
+		// the in-flight health check result is delivered, and then the subscription is closed
+		var results []Result
+		for result := range sub.Chan() {
+			results = append(results, result)
+		}
+		require.Len(t, results, 1)
+		assert.Equal(t, check.ID, results[0].ID)
+		assert.Equal(t, Green, results[0].Status)
+		assert.NoError(t, <-shutdownErr)
+
+		// new health checks are rejected
+		assert.Equal(t, ErrServiceNotRunning, s.Register(Check{ID: ulids.MustNew().String(), Description: "Foo", RedImpact: "none"}, CheckerOpts{}, func(ctx context.Context) (Status, error) {
+			return Green, nil
+		}))
+	})
+
+	t.Run("in-flight health checks that do not complete before the timeout are abandoned", func(t *testing.T) {
+		t.Parallel()
+		fakeClock := clock.NewFake(time.Date(2019, time.September, 1, 0, 0, 0, 0, time.UTC))
+		s := newService(DefaultOpts().SetShutdownTimeout(50*time.Millisecond), fakeClock)
+		go s.run()
+		sub := s.SubscribeForCheckResults(nil)
+		release := make(chan struct{})
+		defer close(release)
+		check, started := registerCheck(t, s, release)
+		<-started
+
+		shutdownErr := make(chan error, 1)
+		go func() {
+			shutdownErr <- s.Shutdown(context.Background())
+		}()
+		// wait for the shutdown timeout timer, and then advance the time to trigger the shutdown timeout
+		fakeClock.BlockUntil(2)
+		fakeClock.Advance(50 * time.Millisecond)
+		err := <-shutdownErr
+		require.Error(t, err)
+		assert.Contains(t, err.Error(), ErrInFlightChecksAbandoned.Error())
+		assert.Contains(t, err.Error(), check.ID)
+		_, ok := <-sub.Chan()
+		assert.False(t, ok, "subscription should be closed")
+	})
+
+	t.Run("shutdown is bounded by the context", func(t *testing.T) {
+		t.Parallel()
+		fakeClock := clock.NewFake(time.Date(2019, time.September, 1, 0, 0, 0, 0, time.UTC))
+		s := newService(DefaultOpts(), fakeClock)
+		go s.run()
+		release := make(chan struct{})
+		defer close(release)
+		_, started := registerCheck(t, s, release)
+		<-started
+
+		ctx, cancel := context.WithCancel(context.Background())
+		shutdownErr := make(chan error, 1)
+		go func() {
+			shutdownErr <- s.Shutdown(ctx)
+		}()
+		// the shutdown timeout never expires, i.e., the shutdown is bounded by the context
+		fakeClock.BlockUntil(2)
+		cancel()
+		assert.Error(t, <-shutdownErr)
+	})
+}
+
+func TestService_FakeClock(t *testing.T) {
+	t.Parallel()
+
+	fakeClock := clock.NewFake(time.Date(2019, time.September, 1, 0, 0, 0, 0, time.UTC))
+	s := newService(DefaultOpts(), fakeClock)
+	go s.run()
+	defer s.TriggerShutdown()
+	sub := s.SubscribeForCheckResults(nil)
+
+	var runs int32
+	check := Check{ID: ulids.MustNew().String(), Description: "Foo", RedImpact: "none"}
+	require.NoError(t, s.Register(check, CheckerOpts{RunInterval: time.Minute, Timeout: time.Second}, func(ctx context.Context) (Status, error) {
+		if atomic.AddInt32(&runs, 1) < 3 {
+			return Green, nil
+		}
+		// the 3rd run blocks until it times out
+		<-ctx.Done()
+		return Red, ctx.Err()
+	}))
+
+	// the health check runs immediately after it is registered
+	start := fakeClock.Now()
+	result := <-sub.Chan()
+	assert.Equal(t, Green, result.Status)
+	assert.Equal(t, start, result.Time)
+	assert.Zero(t, result.Duration)
+
+	// wait for the scheduler to schedule the next run, and then advance the time to trigger it
+	fakeClock.BlockUntil(1)
+	fakeClock.Advance(time.Minute)
+	result = <-sub.Chan()
+	assert.Equal(t, Green, result.Status)
+	assert.Equal(t, start.Add(time.Minute), result.Time)
+
+	// the 3rd run is waiting on its timeout timer - the scheduler timer is not active while the check is running
+	fakeClock.BlockUntil(1)
+	fakeClock.Advance(time.Minute)
+	fakeClock.BlockUntil(1)
+	fakeClock.Advance(time.Second)
+	result = <-sub.Chan()
+	assert.Equal(t, Red, result.Status)
+	assert.Equal(t, time.Second, result.Duration)
+	assert.Equal(t, start.Add(2*time.Minute), result.Time)
+	assert.Contains(t, result.Err.Error(), ErrTimeout.Error())
+}
@@ -16,9 +16,173 @@
 
 package health
 
-// RegisteredCheckSubscription wraps the channel used to notify subscribers
+import "sync"
+
+// DefaultSubscriptionBufferSize is the default max number of messages that are buffered per subscription
+const DefaultSubscriptionBufferSize = 64
+
+// subscription delivers messages to a single subscriber via a bounded buffer, i.e., slow subscribers do not block the
+// health service. When the buffer is full, the oldest message is dropped and the overflow counter is incremented.
+type subscription struct {
+	mutex     sync.Mutex
+	buf       []interface{}
+	size      int
+	overflows uint64
+
+	notify chan struct{}
+	// closed when the subscription is requested to deliver the buffered messages and then close
+	draining  chan struct{}
+	closed    chan struct{}
+	closeOnce sync.Once
+	// closed when the message forwarder exits
+	forwarderDone chan struct{}
+	// closes the subscriber channel
+	closeChan func()
+}
+
+// newSubscription starts the message forwarder, which uses the send function to forward buffered messages to the
+// subscriber channel. The send function returns false if the message could not be sent because the done chan was closed.
+//
+// The forwarder exits when either the subscription or the health service is closed. If the subscription is draining,
+// then the forwarder exits after all buffered messages are delivered.
+func newSubscription(size int, stop <-chan struct{}, send func(msg interface{}, done <-chan struct{}) bool, closeChan func()) *subscription {
+	if size <= 0 {
+		size = DefaultSubscriptionBufferSize
+	}
+	s := &subscription{
+		size:          size,
+		notify:        make(chan struct{}, 1),
+		draining:      make(chan struct{}),
+		closed:        make(chan struct{}),
+		forwarderDone: make(chan struct{}),
+		closeChan:     closeChan,
+	}
+	go s.forward(stop, send)
+	return s
+}
+
+func (s *subscription) forward(stop <-chan struct{}, send func(msg interface{}, done <-chan struct{}) bool) {
+	defer close(s.forwarderDone)
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		select {
+		case <-stop:
+		case <-s.closed:
+		}
+	}()
+
+	sendBufferedMessages := func() bool {
+		for {
+			msg, ok := s.next()
+			if !ok {
+				return true
+			}
+			if !send(msg, done) {
+				return false
+			}
+		}
+	}
+
+	for {
+		select {
+		case <-done:
+			return
+		case <-s.notify:
+			if !sendBufferedMessages() {
+				return
+			}
+		case <-s.draining:
+			sendBufferedMessages()
+			return
+		}
+	}
+}
+
+func (s *subscription) next() (interface{}, bool) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	if len(s.buf) == 0 {
+		return nil, false
+	}
+	msg := s.buf[0]
+	s.buf[0] = nil
+	s.buf = s.buf[1:]
+	return msg, true
+}
+
+// publish never blocks. If the buffer is full, then the oldest message is dropped.
+func (s *subscription) publish(msg interface{}) {
+	s.mutex.Lock()
+	if len(s.buf) == s.size {
+		s.buf[0] = nil
+		s.buf = s.buf[1:]
+		s.overflows++
+	}
+	s.buf = append(s.buf, msg)
+	s.mutex.Unlock()
+
+	select {
+	case s.notify <- struct{}{}:
+	default: // the forwarder has already been notified
+	}
+}
+
+func (s *subscription) isClosed() bool {
+	select {
+	case <-s.closed:
+		return true
+	default:
+		return false
+	}
+}
+
+// Close stops message delivery and closes the subscriber channel. Close is idempotent.
+func (s *subscription) Close() {
+	s.close(nil)
+}
+
+// drains the buffered messages to the subscriber before closing the subscriber channel. If the messages are not
+// delivered before the timeout, then the remaining messages are dropped.
+func (s *subscription) drain(timeout <-chan struct{}) {
+	s.close(timeout)
+}
+
+func (s *subscription) close(drainTimeout <-chan struct{}) {
+	if s == nil {
+		return
+	}
+	s.closeOnce.Do(func() {
+		if drainTimeout != nil {
+			close(s.draining)
+			select {
+			case <-s.forwarderDone:
+			case <-drainTimeout:
+			}
+		}
+		close(s.closed)
+		<-s.forwarderDone
+		s.closeChan()
+	})
+}
+
+// Overflows returns the number of messages that have been dropped because the subscriber was not keeping up
+func (s *subscription) Overflows() uint64 {
+	if s == nil {
+		return 0
+	}
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	return s.overflows
+}
+
+// RegisteredCheckSubscription wraps the channel used to notify subscribers.
+//
+// Messages are buffered per subscription. If the subscriber does not keep up and the buffer is full, then the oldest
+// message is dropped - see Overflows(). When the subscription is no longer needed, it should be closed.
 type RegisteredCheckSubscription struct {
 	ch chan RegisteredCheck
+	*subscription
 }
 
 // Chan returns the chan in read-only mode
@@ -26,9 +190,26 @@ func (s RegisteredCheckSubscription) Chan() <-chan RegisteredCheck {
 	return s.ch
 }
 
-//CheckResultsSubscription wraps the channel used to notify subscribers
+func newRegisteredCheckSubscription(size int, stop <-chan struct{}) RegisteredCheckSubscription {
+	ch := make(chan RegisteredCheck)
+	send := func(msg interface{}, done <-chan struct{}) bool {
+		select {
+		case <-done:
+			return false
+		case ch <- msg.(RegisteredCheck):
+			return true
+		}
+	}
+	return RegisteredCheckSubscription{ch, newSubscription(size, stop, send, func() { close(ch) })}
+}
+
+// CheckResultsSubscription wraps the channel used to notify subscribers.
+//
+// Messages are buffered per subscription. If the subscriber does not keep up and the buffer is full, then the oldest
+// message is dropped - see Overflows(). When the subscription is no longer needed, it should be closed.
 type CheckResultsSubscription struct {
 	ch chan Result
+	*subscription
 }
 
 // Chan returns the chan in read-only mode
@@ -36,14 +217,44 @@ func (s CheckResultsSubscription) Chan() <-chan Result {
 	return s.ch
 }
 
+func newCheckResultsSubscription(size int, stop <-chan struct{}) CheckResultsSubscription {
+	ch := make(chan Result)
+	send := func(msg interface{}, done <-chan struct{}) bool {
+		select {
+		case <-done:
+			return false
+		case ch <- msg.(Result):
+			return true
+		}
+	}
+	return CheckResultsSubscription{ch, newSubscription(size, stop, send, func() { close(ch) })}
+}
+
 // OverallHealthMonitor publishes overall health changes.
 // When first created, it immediately sends the current status.
 // From that point on, when ever the overall health status changes, it is published.
+//
+// Messages are buffered per monitor. If the subscriber does not keep up and the buffer is full, then the oldest
+// message is dropped - see Overflows(). When the monitor is no longer needed, it should be closed.
 type OverallHealthMonitor struct {
 	ch chan Status
+	*subscription
 }
 
 // Chan returns the chan in read-only mode
 func (m OverallHealthMonitor) Chan() <-chan Status {
 	return m.ch
 }
+
+func newOverallHealthMonitor(size int, stop <-chan struct{}) OverallHealthMonitor {
+	ch := make(chan Status)
+	send := func(msg interface{}, done <-chan struct{}) bool {
+		select {
+		case <-done:
+			return false
+		case ch <- msg.(Status):
+			return true
+		}
+	}
+	return OverallHealthMonitor{ch, newSubscription(size, stop, send, func() { close(ch) })}
+}
@@ -0,0 +1,103 @@
+/*
+ * Copyright (c) 2019 OysterPack, Inc.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ * http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package health
+
+import (
+	"github.com/oysterpack/andiamo/pkg/clock"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"runtime"
+	"testing"
+)
+
+func TestSubscription(t *testing.T) {
+	t.Parallel()
+
+	bufLen := func(s *subscription) int {
+		s.mutex.Lock()
+		defer s.mutex.Unlock()
+		return len(s.buf)
+	}
+
+	t.Run("when buffer is full the oldest message is dropped", func(t *testing.T) {
+		t.Parallel()
+		stop := make(chan struct{})
+		defer close(stop)
+		sub := newOverallHealthMonitor(2, stop)
+		defer sub.Close()
+
+		sub.publish(Green)
+		// wait for the forwarder to pick up the message - it is blocked until the subscriber receives it
+		for bufLen(sub.subscription) > 0 {
+			runtime.Gosched()
+		}
+		for _, status := range []Status{Yellow, Red, Yellow, Red} {
+			sub.publish(status)
+		}
+		assert.Equal(t, uint64(2), sub.Overflows())
+
+		var received []Status
+		for i := 0; i < 3; i++ {
+			received = append(received, <-sub.Chan())
+		}
+		assert.Equal(t, []Status{Green, Yellow, Red}, received)
+	})
+
+	t.Run("close", func(t *testing.T) {
+		t.Parallel()
+		stop := make(chan struct{})
+		defer close(stop)
+		sub := newCheckResultsSubscription(1, stop)
+		sub.publish(Result{ID: "foo"})
+		sub.Close()
+		// Close is idempotent
+		sub.Close()
+		// the subscriber channel is closed
+		for range sub.Chan() {
+		}
+		assert.True(t, sub.isClosed())
+	})
+
+	t.Run("close after the service is stopped", func(t *testing.T) {
+		t.Parallel()
+		stop := make(chan struct{})
+		sub := newRegisteredCheckSubscription(1, stop)
+		close(stop)
+		sub.Close()
+		_, ok := <-sub.Chan()
+		assert.False(t, ok)
+	})
+
+	t.Run("closed subscriptions are removed by the service", func(t *testing.T) {
+		t.Parallel()
+		s := newService(DefaultOpts(), clock.Real())
+		defer s.TriggerShutdown()
+		sub := s.SubscribeForCheckResults(nil)
+		require.Len(t, s.subscriptionsForCheckResults, 1)
+
+		sub.Close()
+		s.publish(s.subscriptionsForCheckResults, Result{ID: "foo"})
+		assert.Empty(t, s.subscriptionsForCheckResults)
+	})
+
+	t.Run("nil subscription", func(t *testing.T) {
+		t.Parallel()
+		var sub CheckResultsSubscription
+		sub.Close()
+		assert.Zero(t, sub.Overflows())
+	})
+}
@@ -18,11 +18,23 @@ package health_test
 
 import (
 	"context"
+	"github.com/oysterpack/andiamo/pkg/clock"
 	"github.com/stretchr/testify/assert"
 	"go.uber.org/fx"
 	"testing"
+	"time"
 )
 
+// newFakeClock is used to advance time deterministically instead of sleeping
+func newFakeClock() *clock.Fake {
+	return clock.NewFake(time.Date(2019, time.September, 1, 0, 0, 0, 0, time.UTC))
+}
+
+// provideClock provides the clock that is used by the health module
+func provideClock(c clock.Clock) fx.Option {
+	return fx.Provide(func() clock.Clock { return c })
+}
+
 func runApp(t *testing.T, app *fx.App, shutdowner fx.Shutdowner, funcs ...func()) {
 	defer func() {
 		ctx, cancel := context.WithTimeout(context.Background(), app.StopTimeout())
@@ -0,0 +1,35 @@
+/*
+ * Copyright (c) 2019 OysterPack, Inc.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ * http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+// Package idempotency provides an optional fx module that tracks idempotency keys, i.e., operations that are retried
+// with the same key are only processed once, and the cached result is returned for the retries. It is meant to be shared
+// by APIs and at-least-once message consumers.
+//
+// The module provides:
+//   - `Keys` - used to run an operation once per key
+//   - `HTTPMiddleware` - used to make HTTP handlers idempotent via the "Idempotency-Key" request header
+//
+// Keys are tracked in a pluggable `Store`. If a Store is not provided by the app, then keys are tracked in memory, which
+// is only suitable for single instance deployments - see `NewMemoryStore()`.
+//
+// Key lifecycle:
+//  1. when a key is first seen, it is reserved, i.e., concurrent requests with the same key are rejected while the
+//     operation is in progress
+//  2. if the operation succeeds, then its result is cached for the TTL
+//  3. if the operation fails, then the reservation is released, i.e., the operation can be retried
+//
+// Key lookups are recorded as hits, misses, and conflicts via the `LookupsMetricID` metric.
+package idempotency
@@ -0,0 +1,44 @@
+/*
+ * Copyright (c) 2019 OysterPack, Inc.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ * http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package idempotency
+
+import (
+	"github.com/rs/zerolog"
+)
+
+// idempotency module events
+const (
+	// StoreFailedEvent is logged when a Store operation fails
+	//
+	//	type Data struct {
+	//		// one of: reserve, complete, release
+	//		Op  string `json:"op"`
+	//		Err string `json:"e"`
+	//	}
+	StoreFailedEvent = "01DJ0Q6T40RBHC1NX1AACZBS9J"
+)
+
+type storeFailed struct {
+	op  string
+	err error
+}
+
+func (e storeFailed) MarshalZerologObject(event *zerolog.Event) {
+	event.
+		Str("op", e.op).
+		Err(e.err)
+}
@@ -0,0 +1,52 @@
+/*
+ * Copyright (c) 2019 OysterPack, Inc.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ * http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package idempotency
+
+import (
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/rs/zerolog"
+	"go.uber.org/fx"
+)
+
+type keysParams struct {
+	fx.In
+
+	Store      Store `optional:"true"`
+	Logger     *zerolog.Logger
+	Registerer prometheus.Registerer
+}
+
+// Module provides the fx Module for the idempotency module, which provides the following:
+//   - Keys
+//   - HTTPMiddleware
+//
+// The *zerolog.Logger and prometheus.Registerer must be provided by the app. The Store is optional - if not provided,
+// then keys are tracked in memory.
+func Module(opts Opts) fx.Option {
+	opts = opts.withDefaults()
+	return fx.Provide(func(params keysParams) (Keys, HTTPMiddleware, error) {
+		store := params.Store
+		if store == nil {
+			store = NewMemoryStore()
+		}
+		k := newKeys(opts, store, params.Logger)
+		if err := params.Registerer.Register(k.lookups); err != nil {
+			return nil, nil, err
+		}
+		return k, k.httpMiddleware, nil
+	})
+}
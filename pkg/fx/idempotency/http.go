@@ -0,0 +1,170 @@
+/*
+ * Copyright (c) 2019 OysterPack, Inc.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ * http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package idempotency
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"strings"
+)
+
+// ReplayedHeader is set on HTTP responses that are replayed from the cache
+const ReplayedHeader = "Idempotent-Replayed"
+
+// MaxKeyLength is the max idempotency key length
+const MaxKeyLength = 255
+
+// HTTPMiddleware is used to make HTTP handlers idempotent, e.g., it is registered as fxapp HTTP route middleware.
+//
+// Requests are keyed by the method, path, caller scope, and idempotency key header - see `Opts.Scope`:
+//   - if the request does not have an idempotency key, then the request is handled normally, unless the key is required,
+//     i.e., see `Opts.RequireKey`
+//   - the first request is handled, and its response is cached, unless the response status is 5xx, i.e., server errors
+//     can be retried
+//   - retries are replayed from the cache, i.e., the cached response is returned with the "Idempotent-Replayed: true"
+//     header
+//   - if the key is reused with a different request body, then the request is rejected with HTTP 422
+//   - while the first request is in progress, retries are rejected with HTTP 409
+//
+// NOTE: the request body is read in order to hash it, i.e., the request body size should be limited by upstream
+// middleware.
+type HTTPMiddleware func(http.Handler) http.Handler
+
+// the response is not cached, e.g., because of a 5xx response status
+var errResponseNotCacheable = errors.New("response is not cacheable")
+
+type cachedResponse struct {
+	Status int         `json:"status"`
+	Header http.Header `json:"header"`
+	Body   []byte      `json:"body"`
+	// the SHA-256 hash of the request body, which is used to detect keys that are reused with a different request
+	RequestHash string `json:"request_hash"`
+}
+
+// responseRecorder writes the response through, and records it in order to cache it
+type responseRecorder struct {
+	http.ResponseWriter
+	maxBytes int
+
+	status   int
+	header   http.Header
+	body     []byte
+	overflow bool
+}
+
+func (r *responseRecorder) WriteHeader(status int) {
+	if r.status == 0 {
+		r.status = status
+		r.header = r.ResponseWriter.Header().Clone()
+	}
+	r.ResponseWriter.WriteHeader(status)
+}
+
+func (r *responseRecorder) Write(p []byte) (int, error) {
+	if r.status == 0 {
+		r.WriteHeader(http.StatusOK)
+	}
+	if len(r.body)+len(p) > r.maxBytes {
+		r.overflow = true
+	} else {
+		r.body = append(r.body, p...)
+	}
+	return r.ResponseWriter.Write(p)
+}
+
+// Unwrap returns the wrapped response writer, which enables http.ResponseController to access it, e.g., to flush the
+// response
+func (r *responseRecorder) Unwrap() http.ResponseWriter {
+	return r.ResponseWriter
+}
+
+func (k *keys) httpMiddleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(writer http.ResponseWriter, request *http.Request) {
+		key := strings.TrimSpace(request.Header.Get(k.opts.Header))
+		if key == "" {
+			if k.opts.RequireKey {
+				http.Error(writer, fmt.Sprintf("%s header is required", k.opts.Header), http.StatusBadRequest)
+				return
+			}
+			next.ServeHTTP(writer, request)
+			return
+		}
+		if len(key) > MaxKeyLength {
+			http.Error(writer, fmt.Sprintf("%s header must not be longer than %d", k.opts.Header, MaxKeyLength), http.StatusBadRequest)
+			return
+		}
+
+		body, err := ioutil.ReadAll(request.Body)
+		if err != nil {
+			http.Error(writer, err.Error(), http.StatusBadRequest)
+			return
+		}
+		request.Body = ioutil.NopCloser(bytes.NewReader(body))
+		requestHash := sha256.Sum256(body)
+
+		handled := false
+		scopedKey := fmt.Sprintf("%s %s %q %s", request.Method, request.URL.Path, k.opts.Scope(request), key)
+		result, hit, err := k.Do(request.Context(), scopedKey, func(ctx context.Context) ([]byte, error) {
+			handled = true
+			recorder := &responseRecorder{ResponseWriter: writer, maxBytes: k.opts.MaxResponseBytes}
+			next.ServeHTTP(recorder, request)
+			if recorder.status == 0 {
+				recorder.WriteHeader(http.StatusOK)
+			}
+			if recorder.status >= http.StatusInternalServerError || recorder.overflow {
+				return nil, errResponseNotCacheable
+			}
+			return json.Marshal(cachedResponse{
+				Status:      recorder.status,
+				Header:      recorder.header,
+				Body:        recorder.body,
+				RequestHash: hex.EncodeToString(requestHash[:]),
+			})
+		})
+		switch {
+		case handled:
+			// the response has already been written
+		case err == ErrInProgress:
+			http.Error(writer, err.Error(), http.StatusConflict)
+		case err != nil:
+			http.Error(writer, http.StatusText(http.StatusServiceUnavailable), http.StatusServiceUnavailable)
+		case hit:
+			var response cachedResponse
+			if err := json.Unmarshal(result, &response); err != nil {
+				http.Error(writer, err.Error(), http.StatusInternalServerError)
+				return
+			}
+			if response.RequestHash != hex.EncodeToString(requestHash[:]) {
+				http.Error(writer, fmt.Sprintf("%s header was already used with a different request", k.opts.Header), http.StatusUnprocessableEntity)
+				return
+			}
+			for name, values := range response.Header {
+				writer.Header()[name] = values
+			}
+			writer.Header().Set(ReplayedHeader, "true")
+			writer.WriteHeader(response.Status)
+			writer.Write(response.Body)
+		}
+	})
+}
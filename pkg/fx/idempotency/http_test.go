@@ -0,0 +1,150 @@
+/*
+ * Copyright (c) 2019 OysterPack, Inc.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ * http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package idempotency_test
+
+import (
+	"github.com/oysterpack/andiamo/pkg/fx/idempotency"
+	"github.com/oysterpack/andiamo/pkg/reqctx"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"testing"
+)
+
+// withPrincipal simulates the request context middleware, i.e., the principal is carried by the request context
+func withPrincipal(handler http.Handler) http.Handler {
+	return http.HandlerFunc(func(writer http.ResponseWriter, request *http.Request) {
+		ctx := reqctx.NewContext(request.Context(), reqctx.RequestContext{Principal: request.Header.Get("X-Principal")})
+		handler.ServeHTTP(writer, request.WithContext(ctx))
+	})
+}
+
+func TestHTTPMiddleware(t *testing.T) {
+	t.Parallel()
+
+	app := newTestApp(t, idempotency.DefaultOpts())
+	orders := 0
+	status := http.StatusCreated
+	server := httptest.NewServer(withPrincipal(app.middleware(http.HandlerFunc(func(writer http.ResponseWriter, request *http.Request) {
+		orders++
+		writer.Header().Set("Location", "/orders/"+strconv.Itoa(orders))
+		writer.WriteHeader(status)
+		writer.Write([]byte(strconv.Itoa(orders)))
+	}))))
+	defer server.Close()
+
+	postAs := func(principal, key, payload string) (*http.Response, string) {
+		request, err := http.NewRequest(http.MethodPost, server.URL+"/orders", strings.NewReader(payload))
+		require.NoError(t, err)
+		request.Header.Set("X-Principal", principal)
+		if key != "" {
+			request.Header.Set(idempotency.DefaultHeader, key)
+		}
+		response, err := http.DefaultClient.Do(request)
+		require.NoError(t, err)
+		defer response.Body.Close()
+		body, err := ioutil.ReadAll(response.Body)
+		require.NoError(t, err)
+		return response, string(body)
+	}
+	post := func(key string) (*http.Response, string) {
+		return postAs("alice", key, "{}")
+	}
+
+	response, body := post("a")
+	assert.Equal(t, http.StatusCreated, response.StatusCode)
+	assert.Equal(t, "1", body)
+	assert.Empty(t, response.Header.Get(idempotency.ReplayedHeader))
+
+	t.Run("retries are replayed", func(t *testing.T) {
+		response, body := post("a")
+		assert.Equal(t, http.StatusCreated, response.StatusCode)
+		assert.Equal(t, "1", body)
+		assert.Equal(t, "/orders/1", response.Header.Get("Location"))
+		assert.Equal(t, "true", response.Header.Get(idempotency.ReplayedHeader))
+		assert.Equal(t, 1, orders)
+	})
+
+	t.Run("requests without a key are not tracked", func(t *testing.T) {
+		_, body := post("")
+		assert.Equal(t, "2", body)
+		_, body = post("")
+		assert.Equal(t, "3", body)
+	})
+
+	t.Run("server errors are not cached", func(t *testing.T) {
+		status = http.StatusInternalServerError
+		response, _ := post("b")
+		assert.Equal(t, http.StatusInternalServerError, response.StatusCode)
+		status = http.StatusCreated
+		response, body := post("b")
+		assert.Equal(t, http.StatusCreated, response.StatusCode)
+		assert.Equal(t, "5", body)
+	})
+
+	t.Run("keys are scoped to the principal", func(t *testing.T) {
+		response, body := postAs("bob", "a", "{}")
+		assert.Equal(t, http.StatusCreated, response.StatusCode)
+		assert.Equal(t, "6", body, "another principal's response must not be replayed")
+		assert.Empty(t, response.Header.Get(idempotency.ReplayedHeader))
+	})
+
+	t.Run("keys that are reused with a different request body are rejected", func(t *testing.T) {
+		response, _ := postAs("alice", "a", `{"qty":2}`)
+		assert.Equal(t, http.StatusUnprocessableEntity, response.StatusCode)
+		assert.Equal(t, 6, orders)
+	})
+}
+
+func TestHTTPMiddleware_ResponseController(t *testing.T) {
+	t.Parallel()
+
+	app := newTestApp(t, idempotency.DefaultOpts())
+	flushed := make(chan error, 1)
+	server := httptest.NewServer(app.middleware(http.HandlerFunc(func(writer http.ResponseWriter, request *http.Request) {
+		writer.Write([]byte("1"))
+		flushed <- http.NewResponseController(writer).Flush()
+	})))
+	defer server.Close()
+
+	request, err := http.NewRequest(http.MethodPost, server.URL+"/orders", nil)
+	require.NoError(t, err)
+	request.Header.Set(idempotency.DefaultHeader, "a")
+	response, err := http.DefaultClient.Do(request)
+	require.NoError(t, err)
+	defer response.Body.Close()
+	io.Copy(ioutil.Discard, response.Body)
+	assert.NoError(t, <-flushed, "the response writer should be flushable through the middleware")
+}
+
+func TestHTTPMiddleware_RequireKey(t *testing.T) {
+	t.Parallel()
+
+	opts := idempotency.DefaultOpts()
+	opts.RequireKey = true
+	app := newTestApp(t, opts)
+	handler := app.middleware(http.HandlerFunc(func(writer http.ResponseWriter, request *http.Request) {}))
+
+	recorder := httptest.NewRecorder()
+	handler.ServeHTTP(recorder, httptest.NewRequest(http.MethodPost, "/orders", nil))
+	assert.Equal(t, http.StatusBadRequest, recorder.Code)
+}
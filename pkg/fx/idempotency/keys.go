@@ -0,0 +1,113 @@
+/*
+ * Copyright (c) 2019 OysterPack, Inc.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ * http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package idempotency
+
+import (
+	"context"
+	"errors"
+	"github.com/oysterpack/andiamo/pkg/eventlog"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/rs/zerolog"
+)
+
+// metric IDs, which are used as the prometheus metric names
+const (
+	// counter - the number of idempotency key lookups, labeled by result, i.e., hit, miss, conflict
+	LookupsMetricID = "U01DJ0Q6T892674D2YR8YG7FSH3"
+
+	ResultLabel = "result"
+)
+
+// key lookup results
+const (
+	// the operation result was cached
+	Hit = "hit"
+	// the key was reserved, i.e., the operation was run
+	Miss = "miss"
+	// the operation is in progress
+	Conflict = "conflict"
+)
+
+// ErrInProgress indicates the operation for the key is in progress
+var ErrInProgress = errors.New("operation for the idempotency key is in progress")
+
+// Keys is used to run operations once per idempotency key
+type Keys interface {
+	// Do runs the operation, if the key has not been seen before, and caches its result. If the operation has already
+	// completed, then its cached result is returned, i.e., hit is true. If the operation is in progress, then
+	// ErrInProgress is returned.
+	//
+	// If the operation fails, then its error is returned, and the key is released, i.e., the operation can be retried.
+	Do(ctx context.Context, key string, operation func(ctx context.Context) ([]byte, error)) (result []byte, hit bool, err error)
+}
+
+type keys struct {
+	opts    Opts
+	store   Store
+	lookups *prometheus.CounterVec
+
+	logStoreFailed eventlog.Logger
+}
+
+func newKeys(opts Opts, store Store, logger *zerolog.Logger) *keys {
+	return &keys{
+		opts:  opts,
+		store: store,
+		lookups: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Name: LookupsMetricID,
+			Help: "number of idempotency key lookups",
+		}, []string{ResultLabel}),
+		logStoreFailed: eventlog.NewLogger(StoreFailedEvent, logger, zerolog.ErrorLevel),
+	}
+}
+
+func (k *keys) Do(ctx context.Context, key string, operation func(ctx context.Context) ([]byte, error)) ([]byte, bool, error) {
+	record, reserved, err := k.store.Reserve(ctx, key, k.opts.InProgressTTL)
+	if err != nil {
+		k.logStoreFailed(storeFailed{"reserve", err}, "failed to reserve idempotency key")
+		return nil, false, err
+	}
+	if !reserved {
+		if record.Completed {
+			k.lookups.WithLabelValues(Hit).Inc()
+			return record.Result, true, nil
+		}
+		k.lookups.WithLabelValues(Conflict).Inc()
+		return nil, false, ErrInProgress
+	}
+	k.lookups.WithLabelValues(Miss).Inc()
+
+	completed := false
+	defer func() {
+		// the key is also released if the operation panics
+		if !completed {
+			if err := k.store.Release(context.Background(), key); err != nil {
+				k.logStoreFailed(storeFailed{"release", err}, "failed to release idempotency key")
+			}
+		}
+	}()
+	result, err := operation(ctx)
+	if err != nil {
+		return nil, false, err
+	}
+	completed = true
+	if err := k.store.Complete(ctx, key, result, k.opts.TTL); err != nil {
+		// the operation succeeded, but its result could not be cached, i.e., the key reservation will expire
+		k.logStoreFailed(storeFailed{"complete", err}, "failed to cache idempotency key result")
+	}
+	return result, false, nil
+}
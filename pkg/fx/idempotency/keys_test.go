@@ -0,0 +1,158 @@
+/*
+ * Copyright (c) 2019 OysterPack, Inc.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ * http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package idempotency_test
+
+import (
+	"context"
+	"errors"
+	"github.com/oysterpack/andiamo/pkg/fx/idempotency"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/rs/zerolog"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.uber.org/fx"
+	"testing"
+	"time"
+)
+
+type testApp struct {
+	keys       idempotency.Keys
+	middleware idempotency.HTTPMiddleware
+	registry   *prometheus.Registry
+}
+
+func newTestApp(t *testing.T, opts idempotency.Opts, options ...fx.Option) testApp {
+	var app testApp
+	app.registry = prometheus.NewRegistry()
+	logger := zerolog.Nop()
+	fxApp := fx.New(
+		fx.Provide(
+			func() *zerolog.Logger { return &logger },
+			func() prometheus.Registerer { return app.registry },
+		),
+		fx.Options(options...),
+		idempotency.Module(opts),
+		fx.Populate(&app.keys, &app.middleware),
+	)
+	require.NoError(t, fxApp.Err())
+	return app
+}
+
+func (app testApp) lookups(t *testing.T) map[string]float64 {
+	mfs, err := app.registry.Gather()
+	require.NoError(t, err)
+	lookups := make(map[string]float64)
+	for _, mf := range mfs {
+		if mf.GetName() != idempotency.LookupsMetricID {
+			continue
+		}
+		for _, m := range mf.Metric {
+			lookups[m.Label[0].GetValue()] = m.GetCounter().GetValue()
+		}
+	}
+	return lookups
+}
+
+func TestKeys_Do(t *testing.T) {
+	t.Parallel()
+
+	app := newTestApp(t, idempotency.DefaultOpts())
+	ctx := context.Background()
+	runs := 0
+	operation := func(ctx context.Context) ([]byte, error) {
+		runs++
+		return []byte("result"), nil
+	}
+
+	result, hit, err := app.keys.Do(ctx, "foo", operation)
+	require.NoError(t, err)
+	assert.False(t, hit)
+	assert.Equal(t, "result", string(result))
+
+	result, hit, err = app.keys.Do(ctx, "foo", operation)
+	require.NoError(t, err)
+	assert.True(t, hit)
+	assert.Equal(t, "result", string(result))
+	assert.Equal(t, 1, runs, "the operation should only be run once")
+
+	t.Run("failed operations can be retried", func(t *testing.T) {
+		_, _, err := app.keys.Do(ctx, "bar", func(ctx context.Context) ([]byte, error) {
+			return nil, errors.New("failed")
+		})
+		require.Error(t, err)
+		_, hit, err := app.keys.Do(ctx, "bar", operation)
+		require.NoError(t, err)
+		assert.False(t, hit)
+	})
+
+	t.Run("operation in progress", func(t *testing.T) {
+		running := make(chan struct{})
+		done := make(chan struct{})
+		go app.keys.Do(ctx, "baz", func(ctx context.Context) ([]byte, error) {
+			close(running)
+			<-done
+			return nil, nil
+		})
+		<-running
+		_, _, err := app.keys.Do(ctx, "baz", operation)
+		close(done)
+		assert.Equal(t, idempotency.ErrInProgress, err)
+	})
+
+	assert.Equal(t, map[string]float64{idempotency.Hit: 1, idempotency.Miss: 4, idempotency.Conflict: 1}, app.lookups(t))
+}
+
+func TestMemoryStore_Expiration(t *testing.T) {
+	t.Parallel()
+
+	store := idempotency.NewMemoryStore()
+	ctx := context.Background()
+	_, reserved, err := store.Reserve(ctx, "foo", time.Millisecond)
+	require.NoError(t, err)
+	require.True(t, reserved)
+	require.NoError(t, store.Complete(ctx, "foo", []byte("result"), 10*time.Millisecond))
+
+	record, reserved, err := store.Reserve(ctx, "foo", time.Millisecond)
+	require.NoError(t, err)
+	assert.False(t, reserved)
+	assert.True(t, record.Completed)
+
+	time.Sleep(20 * time.Millisecond)
+	_, reserved, err = store.Reserve(ctx, "foo", time.Millisecond)
+	require.NoError(t, err)
+	assert.True(t, reserved, "expired keys can be reserved")
+}
+
+func TestModule_Store(t *testing.T) {
+	t.Parallel()
+
+	store := &countingStore{Store: idempotency.NewMemoryStore()}
+	app := newTestApp(t, idempotency.DefaultOpts(), fx.Provide(func() idempotency.Store { return store }))
+	_, _, err := app.keys.Do(context.Background(), "foo", func(ctx context.Context) ([]byte, error) { return nil, nil })
+	require.NoError(t, err)
+	assert.Equal(t, 1, store.reservations, "the provided store should be used")
+}
+
+type countingStore struct {
+	idempotency.Store
+	reservations int
+}
+
+func (s *countingStore) Reserve(ctx context.Context, key string, ttl time.Duration) (idempotency.Record, bool, error) {
+	s.reservations++
+	return s.Store.Reserve(ctx, key, ttl)
+}
@@ -0,0 +1,82 @@
+/*
+ * Copyright (c) 2019 OysterPack, Inc.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ * http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package idempotency
+
+import (
+	"github.com/oysterpack/andiamo/pkg/reqctx"
+	"net/http"
+	"time"
+)
+
+// DefaultHeader is the default idempotency key HTTP request header
+const DefaultHeader = "Idempotency-Key"
+
+// Opts is used to configure the module
+type Opts struct {
+	// TTL is how long results are cached - defaults to 24 hours
+	TTL time.Duration
+	// InProgressTTL is how long a key is reserved while the operation is in progress, i.e., if the app instance crashes
+	// while processing, then the operation can be retried after the reservation expires - defaults to 1 min
+	InProgressTTL time.Duration
+
+	// Header is the idempotency key HTTP request header - defaults to DefaultHeader
+	Header string
+	// RequireKey means HTTP requests without an idempotency key are rejected with HTTP 400
+	RequireKey bool
+	// MaxResponseBytes is the max HTTP response body size that is cached. Larger responses are not cached - defaults to
+	// 1 MiB
+	MaxResponseBytes int
+	// Scope resolves the caller that HTTP idempotency keys are scoped to, i.e., a caller can only replay its own
+	// responses - defaults to the authenticated principal that is carried by the request context, i.e., see
+	// `reqctx.Principal()`
+	Scope func(request *http.Request) string
+}
+
+// DefaultOpts returns the default module options
+func DefaultOpts() Opts {
+	return Opts{
+		TTL:              24 * time.Hour,
+		InProgressTTL:    time.Minute,
+		Header:           DefaultHeader,
+		MaxResponseBytes: 1 << 20,
+		Scope:            principalScope,
+	}
+}
+
+func (opts Opts) withDefaults() Opts {
+	defaults := DefaultOpts()
+	if opts.TTL <= 0 {
+		opts.TTL = defaults.TTL
+	}
+	if opts.InProgressTTL <= 0 {
+		opts.InProgressTTL = defaults.InProgressTTL
+	}
+	if opts.Header == "" {
+		opts.Header = defaults.Header
+	}
+	if opts.MaxResponseBytes <= 0 {
+		opts.MaxResponseBytes = defaults.MaxResponseBytes
+	}
+	if opts.Scope == nil {
+		opts.Scope = defaults.Scope
+	}
+	return opts
+}
+
+func principalScope(request *http.Request) string {
+	return reqctx.Principal(request.Context())
+}
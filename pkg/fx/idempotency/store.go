@@ -0,0 +1,91 @@
+/*
+ * Copyright (c) 2019 OysterPack, Inc.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ * http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package idempotency
+
+import (
+	"context"
+	"sync"
+	"time"
+)
+
+// Record is the idempotency key record
+type Record struct {
+	Key string
+	// Completed means the operation has completed and its result is cached. Otherwise, the operation is in progress.
+	Completed bool
+	Result    []byte
+	ExpiresAt time.Time
+}
+
+// Store is used to track idempotency keys. Expired records must not be returned.
+type Store interface {
+	// Reserve reserves the key for the TTL, if the key does not exist. If the key exists, then its record is returned,
+	// i.e., reserved is false.
+	Reserve(ctx context.Context, key string, ttl time.Duration) (record Record, reserved bool, err error)
+	// Complete caches the operation result for the key for the TTL
+	Complete(ctx context.Context, key string, result []byte, ttl time.Duration) error
+	// Release deletes the key, i.e., the operation can be retried
+	Release(ctx context.Context, key string) error
+}
+
+// memoryStoreSweepInterval is the number of reservations between sweeps of the expired records
+const memoryStoreSweepInterval = 1000
+
+// NewMemoryStore returns a Store that tracks keys in memory. Expired records are swept periodically.
+func NewMemoryStore() Store {
+	return &memoryStore{records: make(map[string]Record)}
+}
+
+type memoryStore struct {
+	mutex        sync.Mutex
+	records      map[string]Record
+	reservations int
+}
+
+func (s *memoryStore) Reserve(ctx context.Context, key string, ttl time.Duration) (Record, bool, error) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	now := time.Now()
+	s.reservations++
+	if s.reservations%memoryStoreSweepInterval == 0 {
+		for k, record := range s.records {
+			if !now.Before(record.ExpiresAt) {
+				delete(s.records, k)
+			}
+		}
+	}
+	if record, ok := s.records[key]; ok && now.Before(record.ExpiresAt) {
+		return record, false, nil
+	}
+	record := Record{Key: key, ExpiresAt: now.Add(ttl)}
+	s.records[key] = record
+	return record, true, nil
+}
+
+func (s *memoryStore) Complete(ctx context.Context, key string, result []byte, ttl time.Duration) error {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	s.records[key] = Record{Key: key, Completed: true, Result: result, ExpiresAt: time.Now().Add(ttl)}
+	return nil
+}
+
+func (s *memoryStore) Release(ctx context.Context, key string) error {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	delete(s.records, key)
+	return nil
+}
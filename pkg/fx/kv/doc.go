@@ -0,0 +1,29 @@
+/*
+ * Copyright (c) 2019 OysterPack, Inc.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ * http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+// Package kv provides an optional fx module that provides a durable local key/value `Store`, which is backed by an
+// embedded bbolt database file, i.e., small services can persist local state without a database server.
+//
+// The module manages the database lifecycle, i.e., the database is opened when the Store is constructed and is closed
+// when the app is stopped. In addition, the module:
+//   - compacts the database file on a schedule, when the free space ratio reaches the threshold - see `Opts`
+//   - records metrics for the database file size, and operation latencies and failures
+//   - registers a health check that checks the database integrity, i.e., detects corruption
+//
+// Keys and values are byte slices that are organized into buckets, i.e., namespaces. Buckets are created on demand.
+//
+// NOTE: the database file is locked while it is open, i.e., only 1 process can open the database at a time.
+package kv
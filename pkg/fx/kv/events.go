@@ -0,0 +1,55 @@
+/*
+ * Copyright (c) 2019 OysterPack, Inc.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ * http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package kv
+
+import (
+	"github.com/rs/zerolog"
+	"time"
+)
+
+// kv module events
+const (
+	// CompactedEvent is logged when the database is compacted
+	//
+	//	type Data struct {
+	//		// database file size in bytes
+	//		Before   int64 `json:"before"`
+	//		After    int64 `json:"after"`
+	//		Duration uint  `json:"duration"`
+	//	}
+	CompactedEvent = "01DJ2CRPD35AHTPAAGJEBD4JTY"
+
+	// CompactionFailedEvent is logged when the database compaction fails. The database is left as is, i.e., compaction
+	// is retried on the next interval.
+	//
+	//	type Data struct {
+	//		Err string `json:"e"`
+	//	}
+	CompactionFailedEvent = "01DJ2CRPHCH941A1KD9N4DGMM1"
+)
+
+type compacted struct {
+	before, after int64
+	duration      time.Duration
+}
+
+func (e compacted) MarshalZerologObject(event *zerolog.Event) {
+	event.
+		Int64("before", e.before).
+		Int64("after", e.after).
+		Dur("duration", e.duration)
+}
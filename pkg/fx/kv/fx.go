@@ -0,0 +1,85 @@
+/*
+ * Copyright (c) 2019 OysterPack, Inc.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ * http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package kv
+
+import (
+	"context"
+	"github.com/oysterpack/andiamo/pkg/fx/health"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/rs/zerolog"
+	"go.uber.org/fx"
+)
+
+type storeParams struct {
+	fx.In
+
+	Lifecycle  fx.Lifecycle
+	Logger     *zerolog.Logger
+	Registerer prometheus.Registerer
+	Register   health.Register
+}
+
+// Module provides the fx Module for the kv module, which provides the `Store`.
+//
+// The database is opened when the Store is constructed, i.e., app functions can use the Store, and is closed when the
+// app is stopped. Compactions are run while the app is running.
+//
+// The *zerolog.Logger, prometheus.Registerer, and health.Register must be provided by the app.
+func Module(opts Opts) fx.Option {
+	opts = opts.withDefaults()
+	return fx.Provide(func(params storeParams) (Store, error) {
+		if err := opts.validate(); err != nil {
+			return nil, err
+		}
+		s, err := openStore(opts, params.Logger)
+		if err != nil {
+			return nil, err
+		}
+		if err := s.registerMetrics(params.Registerer); err != nil {
+			s.close()
+			return nil, err
+		}
+		if err := s.registerHealthCheck(params.Register); err != nil {
+			s.close()
+			return nil, err
+		}
+
+		ctx, cancel := context.WithCancel(context.Background())
+		done := make(chan struct{})
+		params.Lifecycle.Append(fx.Hook{
+			OnStart: func(context.Context) error {
+				go func() {
+					defer close(done)
+					if opts.CompactionInterval > 0 {
+						s.runCompactions(ctx)
+					}
+				}()
+				return nil
+			},
+			OnStop: func(stopCtx context.Context) error {
+				cancel()
+				select {
+				case <-done:
+					return s.close()
+				case <-stopCtx.Done():
+					return stopCtx.Err()
+				}
+			},
+		})
+		return s, nil
+	})
+}
@@ -0,0 +1,392 @@
+/*
+ * Copyright (c) 2019 OysterPack, Inc.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ * http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package kv
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"github.com/oysterpack/andiamo/pkg/eventlog"
+	"github.com/oysterpack/andiamo/pkg/fx/health"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/rs/zerolog"
+	bolt "go.etcd.io/bbolt"
+	"go.uber.org/multierr"
+	"os"
+	"sync"
+	"time"
+)
+
+// metric IDs, which are used as the prometheus metric names
+const (
+	// gauge - the database file size in bytes
+	SizeMetricID = "U01DJ2CRNVZ8K50S6QVB83GKZRB"
+	// histogram - operation latency in seconds, labeled by operation, i.e., get, put, delete, foreach, compact
+	OpLatencyMetricID = "U01DJ2CRP0871MFM50K006H41BR"
+	// counter - operation failures, labeled by operation
+	OpFailuresMetricID = "U01DJ2CRP4HBVK9FB3A67MH2118"
+
+	// OpLabel is the metric label for the operation
+	OpLabel = "op"
+)
+
+// IntegrityHealthCheckID checks the database integrity, i.e., the database is Red if it is corrupted
+const IntegrityHealthCheckID = "01DJ2CRP8T0WD9079AV47308XC"
+
+// operations
+const (
+	GetOp     = "get"
+	PutOp     = "put"
+	DeleteOp  = "delete"
+	ForEachOp = "foreach"
+	CompactOp = "compact"
+)
+
+// errors
+var (
+	ErrInvalidOpts = errors.New("kv options are invalid")
+	ErrNotFound    = errors.New("key was not found")
+	ErrBlankBucket = errors.New("bucket name must not be blank")
+	ErrClosed      = errors.New("kv store is closed")
+)
+
+// Store is a durable local key/value store
+type Store interface {
+	// Get returns a copy of the value. If the key does not exist, then ErrNotFound is returned.
+	Get(bucket string, key []byte) ([]byte, error)
+	// Put sets the value for the key. The bucket is created if it does not exist.
+	Put(bucket string, key, value []byte) error
+	// Delete deletes the key. Deleting a key that does not exist is not an error.
+	Delete(bucket string, key []byte) error
+	// ForEach iterates over the bucket's keys in sorted order. The key and value are only valid for the duration of the
+	// call, i.e., they must be copied to be retained. Iteration stops if the function returns an error.
+	ForEach(bucket string, f func(key, value []byte) error) error
+}
+
+type store struct {
+	opts Opts
+
+	// the lock is held exclusively while the database is compacted
+	mutex sync.RWMutex
+	db    *bolt.DB
+
+	latency  *prometheus.HistogramVec
+	failures *prometheus.CounterVec
+
+	logCompacted, logCompactionFailed eventlog.Logger
+}
+
+func openStore(opts Opts, logger *zerolog.Logger) (*store, error) {
+	s := &store{
+		opts: opts,
+		latency: prometheus.NewHistogramVec(
+			prometheus.HistogramOpts{
+				Name:    OpLatencyMetricID,
+				Help:    "kv store operation latency in seconds",
+				Buckets: []float64{0.0001, 0.0005, 0.001, 0.005, 0.01, 0.05, 0.1, 0.5, 1, 5},
+			},
+			[]string{OpLabel},
+		),
+		failures: prometheus.NewCounterVec(
+			prometheus.CounterOpts{Name: OpFailuresMetricID, Help: "kv store operation failures"},
+			[]string{OpLabel},
+		),
+		logCompacted:        eventlog.NewLogger(CompactedEvent, logger, zerolog.InfoLevel),
+		logCompactionFailed: eventlog.NewLogger(CompactionFailedEvent, logger, zerolog.ErrorLevel),
+	}
+	db, err := s.open(opts.Path)
+	if err != nil {
+		return nil, err
+	}
+	s.db = db
+	return s, nil
+}
+
+func (s *store) open(path string) (*bolt.DB, error) {
+	return bolt.Open(path, 0600, &bolt.Options{Timeout: s.opts.OpenTimeout})
+}
+
+// run runs the operation and records its metrics
+func (s *store) run(op string, f func(db *bolt.DB) error) error {
+	s.mutex.RLock()
+	defer s.mutex.RUnlock()
+	if s.db == nil {
+		s.failures.WithLabelValues(op).Inc()
+		return ErrClosed
+	}
+	start := time.Now()
+	err := f(s.db)
+	s.latency.WithLabelValues(op).Observe(time.Since(start).Seconds())
+	if err != nil && err != ErrNotFound {
+		s.failures.WithLabelValues(op).Inc()
+	}
+	return err
+}
+
+func (s *store) Get(bucket string, key []byte) ([]byte, error) {
+	if bucket == "" {
+		return nil, ErrBlankBucket
+	}
+	var value []byte
+	err := s.run(GetOp, func(db *bolt.DB) error {
+		return db.View(func(tx *bolt.Tx) error {
+			b := tx.Bucket([]byte(bucket))
+			if b == nil {
+				return ErrNotFound
+			}
+			v := b.Get(key)
+			if v == nil {
+				return ErrNotFound
+			}
+			value = append([]byte{}, v...)
+			return nil
+		})
+	})
+	return value, err
+}
+
+func (s *store) Put(bucket string, key, value []byte) error {
+	if bucket == "" {
+		return ErrBlankBucket
+	}
+	return s.run(PutOp, func(db *bolt.DB) error {
+		return db.Update(func(tx *bolt.Tx) error {
+			b, err := tx.CreateBucketIfNotExists([]byte(bucket))
+			if err != nil {
+				return err
+			}
+			return b.Put(key, value)
+		})
+	})
+}
+
+func (s *store) Delete(bucket string, key []byte) error {
+	if bucket == "" {
+		return ErrBlankBucket
+	}
+	return s.run(DeleteOp, func(db *bolt.DB) error {
+		return db.Update(func(tx *bolt.Tx) error {
+			b := tx.Bucket([]byte(bucket))
+			if b == nil {
+				return nil
+			}
+			return b.Delete(key)
+		})
+	})
+}
+
+func (s *store) ForEach(bucket string, f func(key, value []byte) error) error {
+	if bucket == "" {
+		return ErrBlankBucket
+	}
+	return s.run(ForEachOp, func(db *bolt.DB) error {
+		return db.View(func(tx *bolt.Tx) error {
+			b := tx.Bucket([]byte(bucket))
+			if b == nil {
+				return nil
+			}
+			return b.ForEach(f)
+		})
+	})
+}
+
+// size returns the database file size in bytes
+func (s *store) size() int64 {
+	s.mutex.RLock()
+	defer s.mutex.RUnlock()
+	if s.db == nil {
+		return 0
+	}
+	var size int64
+	s.db.View(func(tx *bolt.Tx) error {
+		size = tx.Size()
+		return nil
+	})
+	return size
+}
+
+// freeRatio returns the ratio of free pages to total pages
+func (s *store) freeRatio() float64 {
+	s.mutex.RLock()
+	defer s.mutex.RUnlock()
+	if s.db == nil {
+		return 0
+	}
+	var pages int64
+	s.db.View(func(tx *bolt.Tx) error {
+		pages = tx.Size() / int64(s.db.Info().PageSize)
+		return nil
+	})
+	if pages == 0 {
+		return 0
+	}
+	stats := s.db.Stats()
+	return float64(stats.FreePageN+stats.PendingPageN) / float64(pages)
+}
+
+// compact copies the database into a new file, which replaces the database file. If compaction fails, then the
+// database is left as is.
+func (s *store) compact() error {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	if s.db == nil {
+		return ErrClosed
+	}
+	start := time.Now()
+	var before int64
+	s.db.View(func(tx *bolt.Tx) error {
+		before = tx.Size()
+		return nil
+	})
+
+	err := func() error {
+		compactPath := s.opts.Path + ".compact"
+		if err := os.Remove(compactPath); err != nil && !os.IsNotExist(err) {
+			return err
+		}
+		dst, err := s.open(compactPath)
+		if err != nil {
+			return err
+		}
+		if err := copyDB(dst, s.db); err != nil {
+			return multierr.Combine(err, dst.Close(), os.Remove(compactPath))
+		}
+		// the original database is kept open until the compacted database replaces it, i.e., if compaction fails, then
+		// the store continues to use the original database
+		if err := os.Rename(compactPath, s.opts.Path); err != nil {
+			return multierr.Combine(err, dst.Close(), os.Remove(compactPath))
+		}
+		// the original database file was replaced, i.e., the compacted database is used even if closing the original fails
+		db := s.db
+		s.db = dst
+		return db.Close()
+	}()
+	s.latency.WithLabelValues(CompactOp).Observe(time.Since(start).Seconds())
+	if err != nil {
+		s.failures.WithLabelValues(CompactOp).Inc()
+		s.logCompactionFailed(eventlog.NewError(err), "kv store compaction failed")
+		return err
+	}
+	var after int64
+	s.db.View(func(tx *bolt.Tx) error {
+		after = tx.Size()
+		return nil
+	})
+	s.logCompacted(compacted{before: before, after: after, duration: time.Since(start)}, "kv store compacted")
+	return nil
+}
+
+// copyDB copies all of the buckets, including nested buckets, from src to dst within a single transaction
+func copyDB(dst, src *bolt.DB) error {
+	return src.View(func(srcTx *bolt.Tx) error {
+		return dst.Update(func(dstTx *bolt.Tx) error {
+			return srcTx.ForEach(func(name []byte, srcBucket *bolt.Bucket) error {
+				dstBucket, err := dstTx.CreateBucket(name)
+				if err != nil {
+					return err
+				}
+				return copyBucket(dstBucket, srcBucket)
+			})
+		})
+	})
+}
+
+func copyBucket(dst, src *bolt.Bucket) error {
+	dst.FillPercent = 1
+	return src.ForEach(func(k, v []byte) error {
+		if v != nil {
+			return dst.Put(k, v)
+		}
+		nested, err := dst.CreateBucket(k)
+		if err != nil {
+			return err
+		}
+		return copyBucket(nested, src.Bucket(k))
+	})
+}
+
+// runCompactions checks the free space ratio on each interval, and compacts the database when the ratio reaches the
+// threshold
+func (s *store) runCompactions(ctx context.Context) {
+	ticker := time.NewTicker(s.opts.CompactionInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			if s.freeRatio() >= s.opts.CompactionThreshold {
+				// failures are logged, and compaction is retried on the next interval
+				s.compact()
+			}
+		}
+	}
+}
+
+// checkIntegrity runs the bbolt consistency check, i.e., the database is Red if it is corrupted.
+//
+// The check is run within a writable transaction, which is rolled back, because the check reads the freelist, which is
+// not safe while a write transaction is committed concurrently.
+func (s *store) checkIntegrity(ctx context.Context) (health.Status, error) {
+	s.mutex.RLock()
+	defer s.mutex.RUnlock()
+	if s.db == nil {
+		return health.Red, ErrClosed
+	}
+	tx, err := s.db.Begin(true)
+	if err != nil {
+		return health.Red, fmt.Errorf("kv store is corrupted : %s", err)
+	}
+	defer tx.Rollback()
+	for e := range tx.Check() {
+		err = multierr.Append(err, e)
+	}
+	if err != nil {
+		return health.Red, fmt.Errorf("kv store is corrupted : %s", err)
+	}
+	return health.Green, nil
+}
+
+func (s *store) close() error {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	if s.db == nil {
+		return nil
+	}
+	err := s.db.Close()
+	s.db = nil
+	return err
+}
+
+func (s *store) registerMetrics(registerer prometheus.Registerer) error {
+	return multierr.Combine(
+		registerer.Register(s.latency),
+		registerer.Register(s.failures),
+		registerer.Register(prometheus.NewGaugeFunc(
+			prometheus.GaugeOpts{Name: SizeMetricID, Help: "kv store database file size in bytes"},
+			func() float64 { return float64(s.size()) },
+		)),
+	)
+}
+
+func (s *store) registerHealthCheck(register health.Register) error {
+	return register(health.Check{
+		ID:          IntegrityHealthCheckID,
+		Description: fmt.Sprintf("kv store integrity: %s", s.opts.Path),
+		RedImpact:   "kv store is corrupted, i.e., local state may be lost or invalid",
+	}, health.CheckerOpts{RunInterval: s.opts.IntegrityCheckInterval}, s.checkIntegrity)
+}
@@ -0,0 +1,229 @@
+/*
+ * Copyright (c) 2019 OysterPack, Inc.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ * http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package kv_test
+
+import (
+	"bytes"
+	"fmt"
+	"github.com/oysterpack/andiamo/pkg/fx/health"
+	"github.com/oysterpack/andiamo/pkg/fx/kv"
+	"github.com/oysterpack/andiamo/pkg/fxapp"
+	"github.com/oysterpack/andiamo/pkg/fxapptest"
+	"github.com/oysterpack/andiamo/pkg/ulids"
+	"github.com/prometheus/client_golang/prometheus"
+	dto "github.com/prometheus/client_model/go"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+// newBuilder returns an app builder with the kv store enabled
+func newBuilder(opts kv.Opts, logs *fxapptest.LogCapture) fxapp.Builder {
+	return fxapp.NewBuilder(fxapp.ID(ulids.MustNew()), fxapp.ReleaseID(ulids.MustNew())).
+		Invoke(func() {}).
+		EnableKVStore(opts).
+		LogWriter(logs)
+}
+
+// metric returns the metric value summed across all label values, where histograms are measured by their sample count
+func metric(t *testing.T, gatherer prometheus.Gatherer, metricID string) float64 {
+	mfs, err := gatherer.Gather()
+	require.NoError(t, err)
+	var total float64
+	for _, mf := range fxapp.FindMetricFamilies(mfs, func(mf *dto.MetricFamily) bool { return mf.GetName() == metricID }) {
+		for _, m := range mf.Metric {
+			switch {
+			case m.Gauge != nil:
+				total += m.GetGauge().GetValue()
+			case m.Counter != nil:
+				total += m.GetCounter().GetValue()
+			case m.Histogram != nil:
+				total += float64(m.GetHistogram().GetSampleCount())
+			}
+		}
+	}
+	return total
+}
+
+// fragment writes n values, and then deletes all but the first 10, which leaves the database file fragmented
+func fragment(n int, value []byte) func(store kv.Store) error {
+	return func(store kv.Store) error {
+		for i := 0; i < n; i++ {
+			if err := store.Put("data", []byte(fmt.Sprintf("%04d", i)), value); err != nil {
+				return err
+			}
+		}
+		for i := 10; i < n; i++ {
+			if err := store.Delete("data", []byte(fmt.Sprintf("%04d", i))); err != nil {
+				return err
+			}
+		}
+		return nil
+	}
+}
+
+func tempDir(t *testing.T) (string, func()) {
+	dir, err := ioutil.TempDir("", "kv")
+	require.NoError(t, err)
+	return dir, func() { os.RemoveAll(dir) }
+}
+
+func TestStore(t *testing.T) {
+	t.Parallel()
+
+	dir, cleanup := tempDir(t)
+	defer cleanup()
+	path := filepath.Join(dir, "app.db")
+	var store kv.Store
+	var gatherer prometheus.Gatherer
+	var registeredChecks health.RegisteredChecks
+	var integrityCheck health.Checker
+	builder := newBuilder(kv.Opts{Path: path}, fxapptest.NewLogCapture()).Populate(&store, &gatherer, &registeredChecks)
+	fxapptest.RunApp(t, builder, func(fxapp.App, *fxapptest.HTTPClient) {
+		_, err := store.Get("users", []byte("alice"))
+		assert.Equal(t, kv.ErrNotFound, err, "bucket does not exist")
+
+		require.NoError(t, store.Put("users", []byte("bob"), []byte("2")))
+		require.NoError(t, store.Put("users", []byte("alice"), []byte("1")))
+		value, err := store.Get("users", []byte("alice"))
+		require.NoError(t, err)
+		assert.Equal(t, []byte("1"), value)
+		_, err = store.Get("users", []byte("carol"))
+		assert.Equal(t, kv.ErrNotFound, err)
+
+		var keys []string
+		require.NoError(t, store.ForEach("users", func(key, value []byte) error {
+			keys = append(keys, string(key))
+			return nil
+		}))
+		assert.Equal(t, []string{"alice", "bob"}, keys, "keys are iterated in sorted order")
+
+		require.NoError(t, store.Delete("users", []byte("alice")))
+		require.NoError(t, store.Delete("groups", []byte("admins")), "bucket does not exist")
+		_, err = store.Get("users", []byte("alice"))
+		assert.Equal(t, kv.ErrNotFound, err)
+
+		assert.Equal(t, kv.ErrBlankBucket, store.Put("", []byte("alice"), []byte("1")))
+
+		assert.True(t, metric(t, gatherer, kv.SizeMetricID) > 0)
+		assert.True(t, metric(t, gatherer, kv.OpLatencyMetricID) >= 8)
+		assert.Equal(t, float64(0), metric(t, gatherer, kv.OpFailuresMetricID), "not found is not a failure")
+
+		checks := <-registeredChecks(health.Query{IDs: []string{kv.IntegrityHealthCheckID}})
+		require.Len(t, checks, 1)
+		integrityCheck = checks[0].Checker
+		result := integrityCheck()
+		assert.NoError(t, result.Err)
+		assert.Equal(t, health.Green, result.Status)
+	})
+
+	// the database is closed when the app is stopped
+	_, err := store.Get("users", []byte("bob"))
+	assert.Equal(t, kv.ErrClosed, err)
+	assert.Equal(t, health.Red, integrityCheck().Status)
+
+	// state is durable, i.e., the database file lock was released and the data is retained
+	fxapptest.RunApp(t, newBuilder(kv.Opts{Path: path}, fxapptest.NewLogCapture()).Populate(&store), func(fxapp.App, *fxapptest.HTTPClient) {
+		value, err := store.Get("users", []byte("bob"))
+		require.NoError(t, err)
+		assert.Equal(t, []byte("2"), value)
+	})
+}
+
+func TestStore_Compaction(t *testing.T) {
+	t.Parallel()
+
+	dir, cleanup := tempDir(t)
+	defer cleanup()
+	path := filepath.Join(dir, "app.db")
+	value := bytes.Repeat([]byte("x"), 1024)
+	var before os.FileInfo
+	var store kv.Store
+	logs := fxapptest.NewLogCapture()
+	// the database is fragmented before the app is started, i.e., before compaction is scheduled
+	builder := newBuilder(kv.Opts{Path: path, CompactionInterval: 10 * time.Millisecond, CompactionThreshold: 0.2}, logs).
+		Invoke(fragment(1000, value)).
+		Invoke(func() (err error) {
+			before, err = os.Stat(path)
+			return
+		}).
+		Populate(&store)
+	fxapptest.RunApp(t, builder, func(fxapp.App, *fxapptest.HTTPClient) {
+		_, err := logs.WaitForEvent(kv.CompactedEvent, 5*time.Second)
+		require.NoError(t, err)
+
+		after, err := os.Stat(path)
+		require.NoError(t, err)
+		assert.True(t, after.Size() < before.Size(), "%d < %d", after.Size(), before.Size())
+		var count int
+		require.NoError(t, store.ForEach("data", func(key, v []byte) error {
+			count++
+			assert.Equal(t, value, v)
+			return nil
+		}))
+		assert.Equal(t, 10, count)
+	})
+}
+
+func TestStore_CompactionFailed(t *testing.T) {
+	t.Parallel()
+
+	dir, cleanup := tempDir(t)
+	defer cleanup()
+	path := filepath.Join(dir, "app.db")
+	// the compacted database file cannot be created because a non-empty directory is in the way
+	require.NoError(t, os.MkdirAll(filepath.Join(path+".compact", "blocker"), 0700))
+	value := bytes.Repeat([]byte("x"), 1024)
+	var store kv.Store
+	logs := fxapptest.NewLogCapture()
+	builder := newBuilder(kv.Opts{Path: path, CompactionInterval: 10 * time.Millisecond, CompactionThreshold: 0.2}, logs).
+		Invoke(fragment(100, value)).
+		Populate(&store)
+	fxapptest.RunApp(t, builder, func(fxapp.App, *fxapptest.HTTPClient) {
+		_, err := logs.WaitForEvent(kv.CompactionFailedEvent, 5*time.Second)
+		require.NoError(t, err)
+
+		// the store is still usable after compaction failed
+		require.NoError(t, store.Put("data", []byte("foo"), []byte("bar")))
+		v, err := store.Get("data", []byte("foo"))
+		require.NoError(t, err)
+		assert.Equal(t, []byte("bar"), v)
+		v, err = store.Get("data", []byte("0000"))
+		require.NoError(t, err)
+		assert.Equal(t, value, v)
+	})
+}
+
+func TestModule_InvalidOpts(t *testing.T) {
+	t.Parallel()
+
+	for _, opts := range []kv.Opts{
+		{},
+		{Path: "app.db", CompactionInterval: -time.Second},
+		{Path: "app.db", CompactionThreshold: 1.5},
+	} {
+		_, err := newBuilder(opts, fxapptest.NewLogCapture()).
+			Invoke(func(kv.Store) {}).
+			Build()
+		require.Error(t, err)
+		assert.Contains(t, err.Error(), kv.ErrInvalidOpts.Error())
+	}
+}
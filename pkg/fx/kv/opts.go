@@ -0,0 +1,79 @@
+/*
+ * Copyright (c) 2019 OysterPack, Inc.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ * http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package kv
+
+import (
+	"fmt"
+	"strings"
+	"time"
+)
+
+// Opts is used to configure the module
+type Opts struct {
+	// Path is the database file path - required
+	Path string
+	// OpenTimeout is how long to wait to obtain the database file lock - defaults to 1 sec
+	OpenTimeout time.Duration
+	// CompactionInterval is how often the free space ratio is checked, in order to decide if the database should be
+	// compacted. If zero, then the database is not compacted.
+	//
+	// NOTE: store operations are blocked while the database is compacted.
+	CompactionInterval time.Duration
+	// CompactionThreshold is the free space ratio, i.e., free pages / total pages, at which the database is compacted -
+	// defaults to 0.5
+	CompactionThreshold float64
+	// IntegrityCheckInterval is how often the database integrity is checked - defaults to 5 mins
+	IntegrityCheckInterval time.Duration
+}
+
+// DefaultOpts returns the default module options for the specified database file path
+func DefaultOpts(path string) Opts {
+	return Opts{
+		Path:                   path,
+		OpenTimeout:            time.Second,
+		CompactionInterval:     time.Hour,
+		CompactionThreshold:    0.5,
+		IntegrityCheckInterval: 5 * time.Minute,
+	}
+}
+
+func (opts Opts) withDefaults() Opts {
+	defaults := DefaultOpts(opts.Path)
+	if opts.OpenTimeout <= 0 {
+		opts.OpenTimeout = defaults.OpenTimeout
+	}
+	if opts.CompactionThreshold == 0 {
+		opts.CompactionThreshold = defaults.CompactionThreshold
+	}
+	if opts.IntegrityCheckInterval <= 0 {
+		opts.IntegrityCheckInterval = defaults.IntegrityCheckInterval
+	}
+	return opts
+}
+
+func (opts Opts) validate() error {
+	if strings.TrimSpace(opts.Path) == "" {
+		return fmt.Errorf("%s : path is required", ErrInvalidOpts)
+	}
+	if opts.CompactionInterval < 0 {
+		return fmt.Errorf("%s : compaction interval must not be negative : %s", ErrInvalidOpts, opts.CompactionInterval)
+	}
+	if opts.CompactionThreshold <= 0 || opts.CompactionThreshold >= 1 {
+		return fmt.Errorf("%s : compaction threshold must be in the range (0, 1) : %v", ErrInvalidOpts, opts.CompactionThreshold)
+	}
+	return nil
+}
@@ -0,0 +1,341 @@
+/*
+ * Copyright (c) 2019 OysterPack, Inc.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ * http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package lock_test
+
+import (
+	"context"
+	"database/sql"
+	"database/sql/driver"
+	"errors"
+	"fmt"
+	"github.com/oysterpack/andiamo/pkg/fx/lock"
+	"github.com/oysterpack/andiamo/pkg/fxapp"
+	"github.com/oysterpack/andiamo/pkg/fxapptest"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"io"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+// fakeRedis implements the lock scripts, i.e., the get, pexpire, and del calls, ignoring expiration
+type fakeRedis struct {
+	mutex sync.Mutex
+	keys  map[string]string
+	ttls  map[string]time.Duration
+}
+
+func (r *fakeRedis) SetNX(ctx context.Context, key, value string, ttl time.Duration) (bool, error) {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+	if _, ok := r.keys[key]; ok {
+		return false, nil
+	}
+	r.keys[key] = value
+	r.ttls[key] = ttl
+	return true, nil
+}
+
+func (r *fakeRedis) Eval(ctx context.Context, script string, keys []string, args ...interface{}) (interface{}, error) {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+	if r.keys[keys[0]] != args[0] {
+		return int64(0), nil
+	}
+	switch {
+	case strings.Contains(script, "pexpire"):
+		r.ttls[keys[0]] = time.Duration(args[1].(int64)) * time.Millisecond
+	case strings.Contains(script, "del"):
+		delete(r.keys, keys[0])
+	default:
+		return nil, errors.New("unsupported script")
+	}
+	return int64(1), nil
+}
+
+func TestRedisBackend(t *testing.T) {
+	t.Parallel()
+
+	client := &fakeRedis{keys: make(map[string]string), ttls: make(map[string]time.Duration)}
+	backend := lock.NewRedisBackend(client, "locks:")
+	ctx := context.Background()
+
+	ok, err := backend.TryLock(ctx, "foo", "a", time.Second)
+	require.NoError(t, err)
+	require.True(t, ok)
+	assert.Equal(t, "a", client.keys["locks:foo"])
+
+	ok, err = backend.TryLock(ctx, "foo", "b", time.Second)
+	require.NoError(t, err)
+	assert.False(t, ok)
+
+	ok, err = backend.Renew(ctx, "foo", "a", time.Minute)
+	require.NoError(t, err)
+	assert.True(t, ok)
+	assert.Equal(t, time.Minute, client.ttls["locks:foo"])
+
+	ok, err = backend.Renew(ctx, "foo", "b", time.Minute)
+	require.NoError(t, err)
+	assert.False(t, ok, "only the owner can renew the lock")
+
+	require.NoError(t, backend.Unlock(ctx, "foo", "b"))
+	assert.Contains(t, client.keys, "locks:foo", "only the owner can unlock the lock")
+	require.NoError(t, backend.Unlock(ctx, "foo", "a"))
+	assert.NotContains(t, client.keys, "locks:foo")
+}
+
+// fakePostgres tracks the advisory locks that are held per connection
+type fakePostgres struct {
+	mutex sync.Mutex
+	locks map[int64]*fakePostgresConn
+	// if set, then pg_advisory_unlock fails
+	unlockErr error
+}
+
+func (pg *fakePostgres) Open(name string) (driver.Conn, error) {
+	return &fakePostgresConn{pg: pg}, nil
+}
+
+type fakePostgresConn struct {
+	pg     *fakePostgres
+	closed bool
+	killed bool
+}
+
+// kill simulates the lock connections dying, i.e., Postgres ends the sessions and releases their advisory locks
+func (pg *fakePostgres) kill() {
+	pg.mutex.Lock()
+	defer pg.mutex.Unlock()
+	for key, conn := range pg.locks {
+		conn.killed = true
+		delete(pg.locks, key)
+	}
+}
+
+func (c *fakePostgresConn) Ping(ctx context.Context) error {
+	c.pg.mutex.Lock()
+	defer c.pg.mutex.Unlock()
+	if c.killed {
+		return errors.New("connection reset by peer")
+	}
+	return nil
+}
+
+func (c *fakePostgresConn) Prepare(query string) (driver.Stmt, error) {
+	return nil, errors.New("not supported")
+}
+func (c *fakePostgresConn) Begin() (driver.Tx, error) { return nil, errors.New("not supported") }
+
+// session level advisory locks are released when the connection is closed
+func (c *fakePostgresConn) Close() error {
+	c.pg.mutex.Lock()
+	defer c.pg.mutex.Unlock()
+	for key, conn := range c.pg.locks {
+		if conn == c {
+			delete(c.pg.locks, key)
+		}
+	}
+	c.closed = true
+	return nil
+}
+
+func (c *fakePostgresConn) QueryContext(ctx context.Context, query string, args []driver.NamedValue) (driver.Rows, error) {
+	c.pg.mutex.Lock()
+	defer c.pg.mutex.Unlock()
+	if query == "SELECT count(*) FROM pg_locks WHERE locktype = 'advisory'" {
+		return &countRows{values: []int64{int64(len(c.pg.locks))}}, nil
+	}
+	key := args[0].Value.(int64)
+	switch query {
+	case "SELECT pg_try_advisory_lock($1)":
+		if conn, ok := c.pg.locks[key]; ok && conn != c {
+			return &boolRows{values: []bool{false}}, nil
+		}
+		c.pg.locks[key] = c
+		return &boolRows{values: []bool{true}}, nil
+	case "SELECT pg_advisory_unlock($1)":
+		if c.pg.unlockErr != nil {
+			return nil, c.pg.unlockErr
+		}
+		if c.pg.locks[key] != c {
+			return &boolRows{values: []bool{false}}, nil
+		}
+		delete(c.pg.locks, key)
+		return &boolRows{values: []bool{true}}, nil
+	}
+	return nil, errors.New("unsupported query")
+}
+
+func (c *fakePostgresConn) ExecContext(ctx context.Context, query string, args []driver.NamedValue) (driver.Result, error) {
+	if _, err := c.QueryContext(ctx, query, args); err != nil {
+		return nil, err
+	}
+	return driver.RowsAffected(0), nil
+}
+
+type boolRows struct {
+	values []bool
+}
+
+func (r *boolRows) Columns() []string { return []string{"locked"} }
+func (r *boolRows) Close() error      { return nil }
+func (r *boolRows) Next(dest []driver.Value) error {
+	if len(r.values) == 0 {
+		return io.EOF
+	}
+	dest[0] = r.values[0]
+	r.values = r.values[1:]
+	return nil
+}
+
+type countRows struct {
+	values []int64
+}
+
+func (r *countRows) Columns() []string { return []string{"count"} }
+func (r *countRows) Close() error      { return nil }
+func (r *countRows) Next(dest []driver.Value) error {
+	if len(r.values) == 0 {
+		return io.EOF
+	}
+	dest[0] = r.values[0]
+	r.values = r.values[1:]
+	return nil
+}
+
+var fakePostgresDriver = &fakePostgres{locks: make(map[int64]*fakePostgresConn)}
+
+// used by TestPostgresBackend_ConnectionLost, which kills the lock connections
+var connectionLostPostgresDriver = &fakePostgres{locks: make(map[int64]*fakePostgresConn)}
+
+// used by TestPostgresBackend_UnlockFailed, which fails the advisory unlocks
+var unlockFailedPostgresDriver = &fakePostgres{locks: make(map[int64]*fakePostgresConn)}
+
+func init() {
+	sql.Register("lock-fake-postgres", fakePostgresDriver)
+	sql.Register("lock-fake-postgres-connection-lost", connectionLostPostgresDriver)
+	sql.Register("lock-fake-postgres-unlock-failed", unlockFailedPostgresDriver)
+}
+
+func TestPostgresBackend(t *testing.T) {
+	t.Parallel()
+
+	db, err := sql.Open("lock-fake-postgres", "")
+	require.NoError(t, err)
+	defer db.Close()
+	backend := lock.NewPostgresBackend(db)
+	ctx := context.Background()
+
+	ok, err := backend.TryLock(ctx, "foo", "a", time.Second)
+	require.NoError(t, err)
+	require.True(t, ok)
+
+	ok, err = backend.TryLock(ctx, "foo", "b", time.Second)
+	require.NoError(t, err)
+	assert.False(t, ok)
+
+	ok, err = backend.Renew(ctx, "foo", "a", time.Second)
+	require.NoError(t, err)
+	assert.True(t, ok)
+	ok, err = backend.Renew(ctx, "foo", "b", time.Second)
+	require.NoError(t, err)
+	assert.False(t, ok, "only the owner can renew the lock")
+
+	require.NoError(t, backend.Unlock(ctx, "foo", "a"))
+	fakePostgresDriver.mutex.Lock()
+	assert.Empty(t, fakePostgresDriver.locks)
+	fakePostgresDriver.mutex.Unlock()
+
+	ok, err = backend.TryLock(ctx, "foo", "b", time.Second)
+	require.NoError(t, err)
+	assert.True(t, ok)
+	require.NoError(t, backend.Unlock(ctx, "foo", "b"))
+}
+
+func TestPostgresBackend_UnlockFailed(t *testing.T) {
+	t.Parallel()
+
+	pg := unlockFailedPostgresDriver
+	db, err := sql.Open("lock-fake-postgres-unlock-failed", "")
+	require.NoError(t, err)
+	defer db.Close()
+	backend := lock.NewPostgresBackend(db)
+	ctx := context.Background()
+	advisoryLocks := func() int64 {
+		var count int64
+		require.NoError(t, db.QueryRowContext(ctx, "SELECT count(*) FROM pg_locks WHERE locktype = 'advisory'").Scan(&count))
+		return count
+	}
+
+	ok, err := backend.TryLock(ctx, "foo", "a", time.Second)
+	require.NoError(t, err)
+	require.True(t, ok)
+	assert.Equal(t, int64(1), advisoryLocks())
+
+	// When the unlock fails
+	pg.mutex.Lock()
+	pg.unlockErr = errors.New("connection timed out")
+	pg.mutex.Unlock()
+	assert.Error(t, backend.Unlock(ctx, "foo", "a"))
+	pg.mutex.Lock()
+	pg.unlockErr = nil
+	pg.mutex.Unlock()
+
+	// Then the lock connection is discarded, i.e., its session no longer holds the advisory lock
+	assert.Equal(t, int64(0), advisoryLocks())
+	ok, err = backend.TryLock(ctx, "foo", "b", time.Second)
+	require.NoError(t, err)
+	assert.True(t, ok)
+
+	// And when the unlock is not confirmed, i.e., the session does not hold the lock, then the connection is discarded
+	pg.kill()
+	err = backend.Unlock(ctx, "foo", "b")
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), lock.ErrLockLost.Error())
+	assert.Equal(t, int64(0), advisoryLocks())
+}
+
+func TestPostgresBackend_ConnectionLost(t *testing.T) {
+	t.Parallel()
+
+	pg := connectionLostPostgresDriver
+	db, err := sql.Open("lock-fake-postgres-connection-lost", "")
+	require.NoError(t, err)
+	defer db.Close()
+	logs := fxapptest.NewLogCapture()
+	var distributedLock lock.DistributedLock
+	builder, _ := newBuilder(lock.Opts{TTL: time.Minute, RenewInterval: 20 * time.Millisecond}, lock.NewPostgresBackend(db), logs)
+	fxapptest.RunApp(t, builder.Populate(&distributedLock), func(fxapp.App, *fxapptest.HTTPClient) {
+		lease, ok, err := distributedLock.TryAcquire(context.Background(), "foo")
+		require.NoError(t, err)
+		require.True(t, ok)
+
+		// the lock is lost as soon as the renewal detects that the session is gone, i.e., well before the TTL expires
+		pg.kill()
+		select {
+		case <-lease.Lost():
+		case <-time.After(5 * time.Second):
+			t.Fatal("*** timed out waiting for the lock to be lost")
+		}
+		assert.Equal(t, lock.ErrLockLost, lease.Release(context.Background()))
+		fxapptest.AssertEventLogged(t, logs, lock.LockLostEvent, fxapptest.Field("d.lock", "foo"), fxapptest.FieldMatches("d.e", func(v interface{}) bool {
+			return strings.Contains(fmt.Sprint(v), "connection reset by peer")
+		}))
+	})
+}
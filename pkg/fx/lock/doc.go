@@ -0,0 +1,30 @@
+/*
+ * Copyright (c) 2019 OysterPack, Inc.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ * http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+// Package lock provides an optional fx module that provides a `DistributedLock`, which is used to coordinate work across
+// app instances in multi-replica deployments, e.g., schedulers and migrations.
+//
+// Locks are held via a pluggable `Backend`:
+//   - Redis - see `NewRedisBackend()`
+//   - Postgres advisory locks - see `NewPostgresBackend()`
+//   - in memory, i.e., for tests and single instance deployments - see `NewMemoryBackend()`
+//
+// While a lock is held, it is renewed in the background. If the lock cannot be renewed, then the lock is lost, i.e., the
+// lease's `Lost()` channel is closed, and the lock holder must stop the work that the lock protects. When the app is
+// stopped, all held locks are released.
+//
+// Lock acquisitions, releases, and losses are logged as events, and hold times and contention are recorded as metrics.
+package lock
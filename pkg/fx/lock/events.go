@@ -0,0 +1,72 @@
+/*
+ * Copyright (c) 2019 OysterPack, Inc.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ * http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package lock
+
+import (
+	"github.com/rs/zerolog"
+	"time"
+)
+
+// lock module events
+const (
+	// LockAcquiredEvent is logged when a lock is acquired
+	//
+	//	type Data struct {
+	//		Lock  string `json:"lock"`
+	//		Owner string `json:"owner"`
+	//	}
+	LockAcquiredEvent = "01DJ06QF3ZQ2FJ25T2XAK5CN2J"
+
+	// LockReleasedEvent is logged when a lock is released
+	//
+	//	type Data struct {
+	//		Lock  string `json:"lock"`
+	//		Owner string `json:"owner"`
+	//		// how long the lock was held
+	//		Held  uint   `json:"held"`
+	//	}
+	LockReleasedEvent = "01DJ06QF88KZH29BX7G8PNZRY2"
+
+	// LockLostEvent is logged when a lock is lost, i.e., it could not be renewed
+	//
+	//	type Data struct {
+	//		Lock  string `json:"lock"`
+	//		Owner string `json:"owner"`
+	//		Held  uint   `json:"held"`
+	//		Err   string `json:"e"`
+	//	}
+	LockLostEvent = "01DJ06QFCHXA81VZN6BY5C31Q6"
+)
+
+type lockEvent struct {
+	lock  string
+	owner string
+	held  time.Duration
+	err   error
+}
+
+func (e lockEvent) MarshalZerologObject(event *zerolog.Event) {
+	event.
+		Str("lock", e.lock).
+		Str("owner", e.owner)
+	if e.held > 0 {
+		event.Dur("held", e.held)
+	}
+	if e.err != nil {
+		event.Err(e.err)
+	}
+}
@@ -0,0 +1,41 @@
+/*
+ * Copyright (c) 2019 OysterPack, Inc.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ * http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package lock
+
+import (
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/rs/zerolog"
+	"go.uber.org/fx"
+)
+
+// Module provides the fx Module for the lock module, which provides the `DistributedLock`.
+//
+// The Backend, *zerolog.Logger, and prometheus.Registerer must be provided by the app.
+func Module(opts Opts) fx.Option {
+	opts = opts.withDefaults()
+	return fx.Provide(func(lc fx.Lifecycle, backend Backend, logger *zerolog.Logger, registerer prometheus.Registerer) (DistributedLock, error) {
+		metrics, err := newMetrics(registerer)
+		if err != nil {
+			return nil, err
+		}
+		m := newManager(opts, backend, metrics, logger)
+		lc.Append(fx.Hook{
+			OnStop: m.stop,
+		})
+		return m, nil
+	})
+}
@@ -0,0 +1,310 @@
+/*
+ * Copyright (c) 2019 OysterPack, Inc.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ * http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package lock
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"github.com/oysterpack/andiamo/pkg/eventlog"
+	"github.com/oysterpack/andiamo/pkg/ulids"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/rs/zerolog"
+	"go.uber.org/multierr"
+	"sync"
+	"time"
+)
+
+// metric IDs, which are used as the prometheus metric names
+const (
+	// histogram - how long locks are held, in seconds
+	HoldTimeMetricID = "U01DJ06QFGTW90S4ABCV2X38CDX"
+	// counter - the number of times a lock could not be acquired because it was held by another owner
+	ContentionMetricID = "U01DJ06QFN37PN2YS9D6QYK4D1R"
+	// counter - the number of times a lock was lost, i.e., it could not be renewed
+	LostMetricID = "U01DJ06QFSCBFKWZDVX7P70HJV9"
+
+	// LockLabel is the metric label for the lock name
+	LockLabel = "lock"
+)
+
+// errors
+var (
+	ErrLockLost = errors.New("lock was lost")
+	ErrStopped  = errors.New("distributed lock has been stopped")
+)
+
+// DistributedLock is used to acquire named locks that are exclusive across app instances
+type DistributedLock interface {
+	// TryAcquire tries to acquire the lock without waiting, i.e., false is returned if the lock is held by another owner
+	TryAcquire(ctx context.Context, name string) (Lease, bool, error)
+	// Acquire waits until the lock is acquired, or the context is done
+	Acquire(ctx context.Context, name string) (Lease, error)
+}
+
+// Lease represents a held lock, which is renewed in the background until it is released
+type Lease interface {
+	Name() string
+	// Owner is the unique lease token
+	Owner() string
+	// Lost is closed if the lock is lost, i.e., the lock could not be renewed before its TTL expired
+	Lost() <-chan struct{}
+	// Release releases the lock. ErrLockLost is returned if the lock was lost. Releasing a lock more than once is a no-op.
+	Release(ctx context.Context) error
+}
+
+// Backend is where locks are held, e.g., Redis or Postgres
+type Backend interface {
+	// TryLock tries to acquire the lock for the owner - false is returned if the lock is held by another owner
+	TryLock(ctx context.Context, name, owner string, ttl time.Duration) (bool, error)
+	// Renew extends the lock TTL - false is returned if the lock is no longer held by the owner. Renewal errors are
+	// retried until the TTL expires, unless the error is a SessionLostError, i.e., the lock is lost immediately.
+	Renew(ctx context.Context, name, owner string, ttl time.Duration) (bool, error)
+	// Unlock releases the lock, if it is held by the owner
+	Unlock(ctx context.Context, name, owner string) error
+}
+
+// SessionLostError is returned by `Backend.Renew()` when the backend session that held the lock is gone, e.g., the
+// connection that held a Postgres advisory lock died. The backend has already released the lock, i.e., another owner may
+// acquire it, and thus the lock is lost immediately instead of retrying the renewal until the TTL expires.
+type SessionLostError struct {
+	Err error
+}
+
+func (e SessionLostError) Error() string {
+	return fmt.Sprintf("%s : lock session was lost : %s", ErrLockLost, e.Err)
+}
+
+type metrics struct {
+	holdTime   *prometheus.HistogramVec
+	contention *prometheus.CounterVec
+	lost       *prometheus.CounterVec
+}
+
+func newMetrics(registerer prometheus.Registerer) (*metrics, error) {
+	m := &metrics{
+		holdTime: prometheus.NewHistogramVec(prometheus.HistogramOpts{
+			Name:    HoldTimeMetricID,
+			Help:    "distributed lock hold time in seconds",
+			Buckets: []float64{0.1, 1, 10, 60, 300, 1800, 3600},
+		}, []string{LockLabel}),
+		contention: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Name: ContentionMetricID,
+			Help: "number of times a distributed lock could not be acquired because it was held by another owner",
+		}, []string{LockLabel}),
+		lost: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Name: LostMetricID,
+			Help: "number of times a distributed lock was lost",
+		}, []string{LockLabel}),
+	}
+	err := multierr.Combine(
+		registerer.Register(m.holdTime),
+		registerer.Register(m.contention),
+		registerer.Register(m.lost),
+	)
+	return m, err
+}
+
+type manager struct {
+	opts    Opts
+	backend Backend
+	metrics *metrics
+
+	logAcquired, logReleased, logLost eventlog.Logger
+
+	mutex   sync.Mutex
+	leases  map[*lease]bool
+	stopped bool
+}
+
+func newManager(opts Opts, backend Backend, metrics *metrics, logger *zerolog.Logger) *manager {
+	return &manager{
+		opts:        opts,
+		backend:     backend,
+		metrics:     metrics,
+		logAcquired: eventlog.NewLogger(LockAcquiredEvent, logger, zerolog.InfoLevel),
+		logReleased: eventlog.NewLogger(LockReleasedEvent, logger, zerolog.InfoLevel),
+		logLost:     eventlog.NewLogger(LockLostEvent, logger, zerolog.WarnLevel),
+		leases:      make(map[*lease]bool),
+	}
+}
+
+func (m *manager) TryAcquire(ctx context.Context, name string) (Lease, bool, error) {
+	owner := ulids.MustNew().String()
+	ok, err := m.backend.TryLock(ctx, name, owner, m.opts.TTL)
+	if err != nil {
+		return nil, false, err
+	}
+	if !ok {
+		m.metrics.contention.WithLabelValues(name).Inc()
+		return nil, false, nil
+	}
+
+	l := &lease{
+		m:        m,
+		name:     name,
+		owner:    owner,
+		acquired: time.Now(),
+		lost:     make(chan struct{}),
+		stop:     make(chan struct{}),
+		done:     make(chan struct{}),
+	}
+	m.mutex.Lock()
+	if m.stopped {
+		m.mutex.Unlock()
+		return nil, false, multierr.Append(ErrStopped, m.backend.Unlock(ctx, name, owner))
+	}
+	m.leases[l] = true
+	m.mutex.Unlock()
+
+	go l.renew()
+	m.logAcquired(lockEvent{lock: name, owner: owner}, "lock acquired")
+	return l, true, nil
+}
+
+func (m *manager) Acquire(ctx context.Context, name string) (Lease, error) {
+	for {
+		l, ok, err := m.TryAcquire(ctx, name)
+		if err != nil || ok {
+			return l, err
+		}
+		timer := time.NewTimer(m.opts.RetryInterval)
+		select {
+		case <-ctx.Done():
+			timer.Stop()
+			return nil, ctx.Err()
+		case <-timer.C:
+		}
+	}
+}
+
+func (m *manager) remove(l *lease) {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+	delete(m.leases, l)
+}
+
+// stop releases all held locks, i.e., when the app is stopped
+func (m *manager) stop(ctx context.Context) error {
+	m.mutex.Lock()
+	m.stopped = true
+	leases := make([]*lease, 0, len(m.leases))
+	for l := range m.leases {
+		leases = append(leases, l)
+	}
+	m.mutex.Unlock()
+
+	var err error
+	for _, l := range leases {
+		if e := l.Release(ctx); e != nil && e != ErrLockLost {
+			err = multierr.Append(err, e)
+		}
+	}
+	return err
+}
+
+type lease struct {
+	m        *manager
+	name     string
+	owner    string
+	acquired time.Time
+
+	// closed if the lock is lost
+	lost chan struct{}
+	// used to stop the renewal goroutine
+	stop     chan struct{}
+	stopOnce sync.Once
+	// closed when the renewal goroutine exits
+	done chan struct{}
+
+	releaseOnce sync.Once
+	releaseErr  error
+}
+
+func (l *lease) Name() string { return l.name }
+
+func (l *lease) Owner() string { return l.owner }
+
+func (l *lease) Lost() <-chan struct{} { return l.lost }
+
+// renew renews the lock until it is released. Renewal errors are tolerated until the TTL has expired since the last
+// successful renewal, i.e., the lock is lost if it is no longer held, if the backend session was lost, or if it could not
+// be renewed in time.
+func (l *lease) renew() {
+	defer close(l.done)
+	ticker := time.NewTicker(l.m.opts.RenewInterval)
+	defer ticker.Stop()
+	renewed := l.acquired
+	for {
+		select {
+		case <-l.stop:
+			return
+		case <-ticker.C:
+		}
+		ctx, cancel := context.WithTimeout(context.Background(), l.m.opts.RenewInterval)
+		ok, err := l.m.backend.Renew(ctx, l.name, l.owner, l.m.opts.TTL)
+		cancel()
+		switch {
+		case err == nil && ok:
+			renewed = time.Now()
+			continue
+		case err == nil:
+			err = ErrLockLost
+		case isSessionLost(err):
+			// the backend has already released the lock
+		case time.Since(renewed) < l.m.opts.TTL:
+			continue
+		}
+		// the lock is no longer held, i.e., the backend resources for the lock are released on a best effort basis
+		ctx, cancel = context.WithTimeout(context.Background(), l.m.opts.RenewInterval)
+		l.m.backend.Unlock(ctx, l.name, l.owner)
+		cancel()
+		held := time.Since(l.acquired)
+		l.m.metrics.lost.WithLabelValues(l.name).Inc()
+		l.m.metrics.holdTime.WithLabelValues(l.name).Observe(held.Seconds())
+		l.m.logLost(lockEvent{lock: l.name, owner: l.owner, held: held, err: err}, "lock lost")
+		close(l.lost)
+		return
+	}
+}
+
+func isSessionLost(err error) bool {
+	_, ok := err.(SessionLostError)
+	return ok
+}
+
+func (l *lease) Release(ctx context.Context) error {
+	l.releaseOnce.Do(func() {
+		l.stopOnce.Do(func() { close(l.stop) })
+		<-l.done
+		defer l.m.remove(l)
+		select {
+		case <-l.lost:
+			l.releaseErr = ErrLockLost
+			return
+		default:
+		}
+		if err := l.m.backend.Unlock(ctx, l.name, l.owner); err != nil {
+			l.releaseErr = err
+			return
+		}
+		held := time.Since(l.acquired)
+		l.m.metrics.holdTime.WithLabelValues(l.name).Observe(held.Seconds())
+		l.m.logReleased(lockEvent{lock: l.name, owner: l.owner, held: held}, "lock released")
+	})
+	return l.releaseErr
+}
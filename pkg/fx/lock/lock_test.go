@@ -0,0 +1,208 @@
+/*
+ * Copyright (c) 2019 OysterPack, Inc.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ * http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package lock_test
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"github.com/oysterpack/andiamo/pkg/fx/lock"
+	"github.com/oysterpack/andiamo/pkg/fxapp"
+	"github.com/oysterpack/andiamo/pkg/fxapptest"
+	"github.com/oysterpack/andiamo/pkg/ulids"
+	"github.com/prometheus/client_golang/prometheus"
+	dto "github.com/prometheus/client_model/go"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+// flakyBackend wraps a Backend, and fails renewals when failing is set
+type flakyBackend struct {
+	lock.Backend
+	mutex   sync.Mutex
+	failing error
+	lost    bool
+}
+
+func (b *flakyBackend) fail(err error, lost bool) {
+	b.mutex.Lock()
+	defer b.mutex.Unlock()
+	b.failing, b.lost = err, lost
+}
+
+func (b *flakyBackend) Renew(ctx context.Context, name, owner string, ttl time.Duration) (bool, error) {
+	b.mutex.Lock()
+	failing, lost := b.failing, b.lost
+	b.mutex.Unlock()
+	if lost {
+		return false, nil
+	}
+	if failing != nil {
+		return false, failing
+	}
+	return b.Backend.Renew(ctx, name, owner, ttl)
+}
+
+// newBuilder returns an app builder with the lock module enabled. Lock renewals can be failed via the returned backend.
+func newBuilder(opts lock.Opts, b lock.Backend, logs *fxapptest.LogCapture) (fxapp.Builder, *flakyBackend) {
+	backend := &flakyBackend{Backend: b}
+	return fxapp.NewBuilder(fxapp.ID(ulids.MustNew()), fxapp.ReleaseID(ulids.MustNew())).
+		Provide(func() lock.Backend { return backend }).
+		Invoke(func() {}).
+		EnableDistributedLocks(opts).
+		LogWriter(logs), backend
+}
+
+func counter(t *testing.T, gatherer prometheus.Gatherer, metricID string) float64 {
+	mfs, err := gatherer.Gather()
+	require.NoError(t, err)
+	mf := fxapp.FindMetricFamily(mfs, func(mf *dto.MetricFamily) bool {
+		return mf.GetName() == metricID
+	})
+	if mf == nil {
+		return 0
+	}
+	return mf.Metric[0].GetCounter().GetValue()
+}
+
+func TestDistributedLock(t *testing.T) {
+	t.Parallel()
+
+	logs := fxapptest.NewLogCapture()
+	var distributedLock lock.DistributedLock
+	var gatherer prometheus.Gatherer
+	builder, backend := newBuilder(lock.Opts{TTL: 300 * time.Millisecond, RenewInterval: 20 * time.Millisecond, RetryInterval: 10 * time.Millisecond}, lock.NewMemoryBackend(), logs)
+	fxapptest.RunApp(t, builder.Populate(&distributedLock, &gatherer), func(fxapp.App, *fxapptest.HTTPClient) {
+		ctx := context.Background()
+
+		lease, ok, err := distributedLock.TryAcquire(ctx, "foo")
+		require.NoError(t, err)
+		require.True(t, ok)
+		assert.Equal(t, "foo", lease.Name())
+		fxapptest.AssertEventLogged(t, logs, lock.LockAcquiredEvent, fxapptest.Field("d.lock", "foo"))
+
+		t.Run("lock is renewed while it is held", func(t *testing.T) {
+			time.Sleep(500 * time.Millisecond)
+			select {
+			case <-lease.Lost():
+				t.Fatal("*** lock should not be lost")
+			default:
+			}
+			_, ok, err := distributedLock.TryAcquire(ctx, "foo")
+			require.NoError(t, err)
+			assert.False(t, ok)
+			assert.Equal(t, float64(1), counter(t, gatherer, lock.ContentionMetricID))
+		})
+
+		t.Run("acquire waits until the lock is released", func(t *testing.T) {
+			acquired := make(chan lock.Lease)
+			go func() {
+				lease, err := distributedLock.Acquire(ctx, "foo")
+				if err == nil {
+					acquired <- lease
+				}
+			}()
+			time.Sleep(50 * time.Millisecond)
+			require.NoError(t, lease.Release(ctx))
+			require.NoError(t, lease.Release(ctx), "releasing a lock more than once is a no-op")
+			fxapptest.AssertEventLogged(t, logs, lock.LockReleasedEvent, fxapptest.Field("d.lock", "foo"))
+			select {
+			case lease = <-acquired:
+			case <-time.After(5 * time.Second):
+				t.Fatal("*** timed out waiting for the lock to be acquired")
+			}
+		})
+
+		t.Run("acquire is canceled", func(t *testing.T) {
+			ctx, cancel := context.WithTimeout(ctx, 50*time.Millisecond)
+			defer cancel()
+			_, err := distributedLock.Acquire(ctx, "foo")
+			assert.Equal(t, context.DeadlineExceeded, err)
+		})
+
+		t.Run("lock is lost when it is no longer held", func(t *testing.T) {
+			backend.fail(nil, true)
+			defer backend.fail(nil, false)
+			select {
+			case <-lease.Lost():
+			case <-time.After(5 * time.Second):
+				t.Fatal("*** timed out waiting for the lock to be lost")
+			}
+			assert.Equal(t, lock.ErrLockLost, lease.Release(ctx))
+			fxapptest.AssertEventLogged(t, logs, lock.LockLostEvent, fxapptest.Field("d.lock", "foo"))
+			assert.Equal(t, float64(1), counter(t, gatherer, lock.LostMetricID))
+		})
+	})
+}
+
+func TestDistributedLock_RenewalErrors(t *testing.T) {
+	t.Parallel()
+
+	logs := fxapptest.NewLogCapture()
+	var distributedLock lock.DistributedLock
+	builder, backend := newBuilder(lock.Opts{TTL: 200 * time.Millisecond, RenewInterval: 20 * time.Millisecond}, lock.NewMemoryBackend(), logs)
+	fxapptest.RunApp(t, builder.Populate(&distributedLock), func(fxapp.App, *fxapptest.HTTPClient) {
+		lease, ok, err := distributedLock.TryAcquire(context.Background(), "foo")
+		require.NoError(t, err)
+		require.True(t, ok)
+
+		// renewal errors are tolerated until the TTL expires
+		backend.fail(errors.New("backend is unavailable"), false)
+		time.Sleep(100 * time.Millisecond)
+		select {
+		case <-lease.Lost():
+			t.Fatal("*** lock should not be lost until the TTL expires")
+		default:
+		}
+		select {
+		case <-lease.Lost():
+		case <-time.After(5 * time.Second):
+			t.Fatal("*** timed out waiting for the lock to be lost")
+		}
+		_, err = logs.WaitForEvent(lock.LockLostEvent, 5*time.Second, fxapptest.Field("d.lock", "foo"), fxapptest.FieldMatches("d.e", func(v interface{}) bool {
+			return strings.Contains(fmt.Sprint(v), "backend is unavailable")
+		}))
+		assert.NoError(t, err)
+	})
+}
+
+func TestModule_LocksAreReleasedWhenStopped(t *testing.T) {
+	t.Parallel()
+
+	logs := fxapptest.NewLogCapture()
+	var distributedLock lock.DistributedLock
+	builder, backend := newBuilder(lock.DefaultOpts(), lock.NewMemoryBackend(), logs)
+	fxapptest.RunApp(t, builder.Populate(&distributedLock), func(fxapp.App, *fxapptest.HTTPClient) {
+		for _, name := range []string{"foo", "bar"} {
+			_, ok, err := distributedLock.TryAcquire(context.Background(), name)
+			require.NoError(t, err)
+			require.True(t, ok)
+		}
+	})
+	assert.Len(t, logs.FindEvents(lock.LockReleasedEvent), 2)
+
+	_, _, err := distributedLock.TryAcquire(context.Background(), "foo")
+	assert.Equal(t, lock.ErrStopped, err)
+	// the lock was released, i.e., it is available
+	ok, err := backend.TryLock(context.Background(), "foo", "owner", time.Second)
+	require.NoError(t, err)
+	assert.True(t, ok)
+}
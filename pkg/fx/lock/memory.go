@@ -0,0 +1,71 @@
+/*
+ * Copyright (c) 2019 OysterPack, Inc.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ * http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package lock
+
+import (
+	"context"
+	"sync"
+	"time"
+)
+
+// NewMemoryBackend returns a Backend that holds locks in memory, i.e., locks are only exclusive within the process. It is
+// meant for tests and single instance deployments.
+func NewMemoryBackend() Backend {
+	return &memoryBackend{locks: make(map[string]memoryLock)}
+}
+
+type memoryLock struct {
+	owner   string
+	expires time.Time
+}
+
+type memoryBackend struct {
+	mutex sync.Mutex
+	locks map[string]memoryLock
+}
+
+func (b *memoryBackend) TryLock(ctx context.Context, name, owner string, ttl time.Duration) (bool, error) {
+	b.mutex.Lock()
+	defer b.mutex.Unlock()
+	now := time.Now()
+	if lock, ok := b.locks[name]; ok && lock.owner != owner && now.Before(lock.expires) {
+		return false, nil
+	}
+	b.locks[name] = memoryLock{owner: owner, expires: now.Add(ttl)}
+	return true, nil
+}
+
+func (b *memoryBackend) Renew(ctx context.Context, name, owner string, ttl time.Duration) (bool, error) {
+	b.mutex.Lock()
+	defer b.mutex.Unlock()
+	now := time.Now()
+	lock, ok := b.locks[name]
+	if !ok || lock.owner != owner || !now.Before(lock.expires) {
+		return false, nil
+	}
+	b.locks[name] = memoryLock{owner: owner, expires: now.Add(ttl)}
+	return true, nil
+}
+
+func (b *memoryBackend) Unlock(ctx context.Context, name, owner string) error {
+	b.mutex.Lock()
+	defer b.mutex.Unlock()
+	if lock, ok := b.locks[name]; ok && lock.owner == owner {
+		delete(b.locks, name)
+	}
+	return nil
+}
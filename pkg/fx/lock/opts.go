@@ -0,0 +1,54 @@
+/*
+ * Copyright (c) 2019 OysterPack, Inc.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ * http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package lock
+
+import (
+	"time"
+)
+
+// Opts is used to configure the module
+type Opts struct {
+	// TTL is how long a lock is held if it is not renewed, e.g., if the app instance crashes - defaults to 30 secs
+	TTL time.Duration
+	// RenewInterval is how often held locks are renewed - defaults to TTL / 3
+	RenewInterval time.Duration
+	// RetryInterval is how often `DistributedLock.Acquire()` retries to acquire a lock that is held - defaults to 1 sec
+	RetryInterval time.Duration
+}
+
+// DefaultOpts returns the default module options
+func DefaultOpts() Opts {
+	return Opts{
+		TTL:           30 * time.Second,
+		RenewInterval: 10 * time.Second,
+		RetryInterval: time.Second,
+	}
+}
+
+func (opts Opts) withDefaults() Opts {
+	defaults := DefaultOpts()
+	if opts.TTL <= 0 {
+		opts.TTL = defaults.TTL
+	}
+	if opts.RenewInterval <= 0 || opts.RenewInterval >= opts.TTL {
+		opts.RenewInterval = opts.TTL / 3
+	}
+	if opts.RetryInterval <= 0 {
+		opts.RetryInterval = defaults.RetryInterval
+	}
+	return opts
+}
@@ -0,0 +1,126 @@
+/*
+ * Copyright (c) 2019 OysterPack, Inc.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ * http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package lock
+
+import (
+	"context"
+	"database/sql"
+	"database/sql/driver"
+	"fmt"
+	"hash/fnv"
+	"sync"
+	"time"
+)
+
+// NewPostgresBackend returns a Backend that holds locks as Postgres session level advisory locks. Each held lock uses a
+// dedicated DB connection, i.e., the lock is held for as long as the connection is alive. Thus, the lock TTL does not
+// apply - if the app instance crashes, then the lock is released when Postgres closes the connection. Likewise, if the
+// lock connection fails, then the lock is lost immediately, because Postgres releases the lock when the session ends.
+//
+// Lock names are hashed to the advisory lock 64-bit key.
+//
+// NOTE: a lock connection is never returned to the DB connection pool if its session may still hold an advisory lock,
+// i.e., it is discarded instead. Otherwise, the next user of the pooled connection would silently hold the lock.
+func NewPostgresBackend(db *sql.DB) Backend {
+	return &postgresBackend{db: db, conns: make(map[postgresLock]*sql.Conn)}
+}
+
+type postgresLock struct {
+	name, owner string
+}
+
+type postgresBackend struct {
+	db    *sql.DB
+	mutex sync.Mutex
+	conns map[postgresLock]*sql.Conn
+}
+
+func postgresLockKey(name string) int64 {
+	h := fnv.New64a()
+	h.Write([]byte(name))
+	return int64(h.Sum64())
+}
+
+func (b *postgresBackend) TryLock(ctx context.Context, name, owner string, ttl time.Duration) (bool, error) {
+	conn, err := b.db.Conn(ctx)
+	if err != nil {
+		return false, err
+	}
+	var locked bool
+	if err := conn.QueryRowContext(ctx, "SELECT pg_try_advisory_lock($1)", postgresLockKey(name)).Scan(&locked); err != nil {
+		// the lock may have been acquired even though the query failed
+		discardConn(conn)
+		return false, err
+	}
+	if !locked {
+		conn.Close()
+		return false, nil
+	}
+	b.mutex.Lock()
+	defer b.mutex.Unlock()
+	b.conns[postgresLock{name, owner}] = conn
+	return true, nil
+}
+
+// Renew checks that the lock connection is still alive. If the connection failed, then the session and its advisory
+// lock are gone, i.e., the connection is discarded and a SessionLostError is returned.
+func (b *postgresBackend) Renew(ctx context.Context, name, owner string, ttl time.Duration) (bool, error) {
+	b.mutex.Lock()
+	conn, ok := b.conns[postgresLock{name, owner}]
+	b.mutex.Unlock()
+	if !ok {
+		return false, nil
+	}
+	if err := conn.PingContext(ctx); err != nil {
+		b.mutex.Lock()
+		delete(b.conns, postgresLock{name, owner})
+		b.mutex.Unlock()
+		discardConn(conn)
+		return false, SessionLostError{err}
+	}
+	return true, nil
+}
+
+// Unlock releases the advisory lock, and returns the lock connection to the pool. If the unlock fails or is not
+// confirmed, then the lock connection is discarded, which ends the session and thus releases its advisory locks.
+func (b *postgresBackend) Unlock(ctx context.Context, name, owner string) error {
+	b.mutex.Lock()
+	conn, ok := b.conns[postgresLock{name, owner}]
+	delete(b.conns, postgresLock{name, owner})
+	b.mutex.Unlock()
+	if !ok {
+		return nil
+	}
+	var unlocked bool
+	if err := conn.QueryRowContext(ctx, "SELECT pg_advisory_unlock($1)", postgresLockKey(name)).Scan(&unlocked); err != nil {
+		discardConn(conn)
+		return err
+	}
+	if !unlocked {
+		discardConn(conn)
+		return fmt.Errorf("%s : advisory lock was not held by the lock session : %s", ErrLockLost, name)
+	}
+	return conn.Close()
+}
+
+// discardConn closes the connection's session, i.e., the connection is not returned to the pool. database/sql closes
+// the driver connection when driver.ErrBadConn is returned.
+func discardConn(conn *sql.Conn) {
+	conn.Raw(func(interface{}) error {
+		return driver.ErrBadConn
+	})
+}
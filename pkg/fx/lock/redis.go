@@ -0,0 +1,84 @@
+/*
+ * Copyright (c) 2019 OysterPack, Inc.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ * http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package lock
+
+import (
+	"context"
+	"fmt"
+	"time"
+)
+
+// RedisClient is the subset of the Redis client API that is required by the Redis backend. It decouples the backend from
+// the Redis client library, i.e., the app provides an adapter for the Redis client that it uses.
+type RedisClient interface {
+	// SetNX sets the key value with the TTL, only if the key does not exist, i.e., SET key value NX PX ttl
+	SetNX(ctx context.Context, key, value string, ttl time.Duration) (bool, error)
+	// Eval runs the Lua script, and returns the script result
+	Eval(ctx context.Context, script string, keys []string, args ...interface{}) (interface{}, error)
+}
+
+// the lock is only renewed or deleted by its owner
+const (
+	redisRenewScript  = `if redis.call("get", KEYS[1]) == ARGV[1] then return redis.call("pexpire", KEYS[1], ARGV[2]) else return 0 end`
+	redisUnlockScript = `if redis.call("get", KEYS[1]) == ARGV[1] then return redis.call("del", KEYS[1]) else return 0 end`
+)
+
+// NewRedisBackend returns a Backend that holds locks as Redis keys, i.e., the key value is the lock owner, and the key
+// expires after the lock TTL. The key prefix is used to namespace the lock keys, e.g., "locks:".
+//
+// NOTE: locks are only as reliable as the Redis deployment, i.e., a lock may be lost on a Redis failover.
+func NewRedisBackend(client RedisClient, keyPrefix string) Backend {
+	return &redisBackend{client: client, keyPrefix: keyPrefix}
+}
+
+type redisBackend struct {
+	client    RedisClient
+	keyPrefix string
+}
+
+func (b *redisBackend) key(name string) string {
+	return b.keyPrefix + name
+}
+
+func (b *redisBackend) TryLock(ctx context.Context, name, owner string, ttl time.Duration) (bool, error) {
+	return b.client.SetNX(ctx, b.key(name), owner, ttl)
+}
+
+func (b *redisBackend) Renew(ctx context.Context, name, owner string, ttl time.Duration) (bool, error) {
+	result, err := b.client.Eval(ctx, redisRenewScript, []string{b.key(name)}, owner, ttl.Nanoseconds()/int64(time.Millisecond))
+	if err != nil {
+		return false, err
+	}
+	return redisBool(result)
+}
+
+func (b *redisBackend) Unlock(ctx context.Context, name, owner string) error {
+	_, err := b.client.Eval(ctx, redisUnlockScript, []string{b.key(name)}, owner)
+	return err
+}
+
+// Lua booleans and integers are returned as Redis integers
+func redisBool(result interface{}) (bool, error) {
+	switch n := result.(type) {
+	case int64:
+		return n == 1, nil
+	case int:
+		return n == 1, nil
+	default:
+		return false, fmt.Errorf("unexpected Redis script result type : %T", result)
+	}
+}
@@ -0,0 +1,93 @@
+/*
+ * Copyright (c) 2019 OysterPack, Inc.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ * http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package maxprocs
+
+import (
+	"fmt"
+	"github.com/pkg/errors"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+)
+
+const cgroupRoot = "/sys/fs/cgroup"
+
+// ErrInvalidCPUQuota indicates the cgroup CPU quota files could not be parsed
+var ErrInvalidCPUQuota = errors.New("invalid cgroup CPU quota")
+
+// cpuQuota returns the CPU quota, i.e., the number of CPUs, that is configured via cgroups under the specified root.
+// cgroup v2 is checked first, then cgroup v1. If there is no CPU quota, then false is returned.
+func cpuQuota(root string) (float64, bool, error) {
+	// cgroup v2 - "$MAX $PERIOD", where $MAX is "max" when there is no quota
+	content, err := ioutil.ReadFile(filepath.Join(root, "cpu.max"))
+	switch {
+	case err == nil:
+		fields := strings.Fields(string(content))
+		if len(fields) != 2 {
+			return 0, false, fmt.Errorf("%s : cpu.max : %q", ErrInvalidCPUQuota, content)
+		}
+		if fields[0] == "max" {
+			return 0, false, nil
+		}
+		return quotaCPUs(fields[0], fields[1])
+	case !os.IsNotExist(err):
+		return 0, false, err
+	}
+
+	// cgroup v1 - the quota is -1 when there is no quota
+	quota, err := ioutil.ReadFile(filepath.Join(root, "cpu", "cpu.cfs_quota_us"))
+	if err != nil {
+		if os.IsNotExist(err) {
+			return 0, false, nil
+		}
+		return 0, false, err
+	}
+	if strings.TrimSpace(string(quota)) == "-1" {
+		return 0, false, nil
+	}
+	period, err := ioutil.ReadFile(filepath.Join(root, "cpu", "cpu.cfs_period_us"))
+	if err != nil {
+		return 0, false, err
+	}
+	return quotaCPUs(strings.TrimSpace(string(quota)), strings.TrimSpace(string(period)))
+}
+
+func quotaCPUs(quota, period string) (float64, bool, error) {
+	q, err := strconv.ParseFloat(quota, 64)
+	if err != nil {
+		return 0, false, fmt.Errorf("%s : quota : %v", ErrInvalidCPUQuota, err)
+	}
+	p, err := strconv.ParseFloat(period, 64)
+	if err != nil || p <= 0 {
+		return 0, false, fmt.Errorf("%s : period : %q", ErrInvalidCPUQuota, period)
+	}
+	if q <= 0 {
+		return 0, false, nil
+	}
+	return q / p, true, nil
+}
+
+// returns the GOMAXPROCS value for the CPU quota, i.e., the quota rounded down, but not less than min procs
+func procsForQuota(quota float64, minProcs int) int {
+	procs := int(quota)
+	if procs < minProcs {
+		return minProcs
+	}
+	return procs
+}
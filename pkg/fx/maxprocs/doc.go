@@ -0,0 +1,31 @@
+/*
+ * Copyright (c) 2019 OysterPack, Inc.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ * http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+// Package maxprocs provides an optional fx module that sets GOMAXPROCS to match the container CPU quota.
+//
+// By default, the Go runtime sets GOMAXPROCS to the number of host CPUs, which is not aware of container CPU quotas. When
+// the CPU quota is lower than the number of host CPUs, the app is throttled, which degrades latency.
+//
+// The module detects the CPU quota via cgroups (v2 and v1):
+//   - GOMAXPROCS is set to the CPU quota, rounded down, and is never set lower than the configured min procs
+//   - if the GOMAXPROCS env var is set, then it is honored, i.e., GOMAXPROCS is not changed
+//   - if there is no CPU quota, then GOMAXPROCS is not changed
+//
+// When the module is stopped, GOMAXPROCS is restored to its previous value.
+//
+// The detected limits are logged via the MaxProcsEvent and are exposed as metrics - see CPUQuotaMetricID and
+// MaxProcsMetricID.
+package maxprocs
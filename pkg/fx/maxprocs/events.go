@@ -0,0 +1,56 @@
+/*
+ * Copyright (c) 2019 OysterPack, Inc.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ * http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package maxprocs
+
+import (
+	"github.com/rs/zerolog"
+)
+
+// maxprocs module events
+const (
+	//	type Data struct {
+	//		Source   string  `json:"source"`
+	//		Quota    float64 `json:"quota"`
+	//		Previous int     `json:"previous"`
+	//		Procs    int     `json:"procs"`
+	//	}
+	MaxProcsEvent = "01DHWKC240YDJ66D68NTAHPZKW"
+)
+
+// GOMAXPROCS sources
+const (
+	// the GOMAXPROCS env var is set
+	EnvSource = "env"
+	// GOMAXPROCS was set based on the cgroup CPU quota
+	CgroupSource = "cgroup"
+	// there is no CPU quota, i.e., the runtime default is used
+	DefaultSource = "default"
+)
+
+type maxProcs struct {
+	source   string
+	quota    float64
+	previous int
+	procs    int
+}
+
+func (m *maxProcs) MarshalZerologObject(e *zerolog.Event) {
+	e.Str("source", m.source)
+	e.Float64("quota", m.quota)
+	e.Int("previous", m.previous)
+	e.Int("procs", m.procs)
+}
@@ -0,0 +1,96 @@
+/*
+ * Copyright (c) 2019 OysterPack, Inc.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ * http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package maxprocs
+
+import (
+	"context"
+	"github.com/oysterpack/andiamo/pkg/eventlog"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/rs/zerolog"
+	"go.uber.org/fx"
+	"go.uber.org/multierr"
+	"os"
+	"runtime"
+)
+
+// metric IDs, which are used as the prometheus metric names
+const (
+	// gauge - the detected CPU quota, i.e., number of CPUs - 0 if there is no CPU quota
+	CPUQuotaMetricID = "U01DHWKC289K1EWK3D1STF23X7G"
+	// gauge - the current GOMAXPROCS value
+	MaxProcsMetricID = "U01DHWKC2CJPNYF9768Y48APZ9W"
+)
+
+// Module provides the fx Module for the maxprocs module.
+//
+// The *zerolog.Logger and prometheus.Registerer must be provided by the app.
+func Module(opts Opts) fx.Option {
+	return fx.Invoke(func(lc fx.Lifecycle, logger *zerolog.Logger, registerer prometheus.Registerer) error {
+		m, err := setMaxProcs(opts.withDefaults(), cgroupRoot)
+		if err != nil {
+			return err
+		}
+		eventlog.NewLogger(MaxProcsEvent, logger, zerolog.InfoLevel)(m, "GOMAXPROCS")
+		lc.Append(fx.Hook{
+			OnStop: func(context.Context) error {
+				if m.procs != m.previous {
+					runtime.GOMAXPROCS(m.previous)
+				}
+				return nil
+			},
+		})
+		return registerMetrics(m, registerer)
+	})
+}
+
+func setMaxProcs(opts Opts, root string) (*maxProcs, error) {
+	m := &maxProcs{
+		source:   DefaultSource,
+		previous: runtime.GOMAXPROCS(0),
+	}
+	m.procs = m.previous
+	quota, ok, err := cpuQuota(root)
+	if err != nil {
+		return nil, err
+	}
+	if ok {
+		m.quota = quota
+	}
+	if _, exists := os.LookupEnv("GOMAXPROCS"); exists {
+		m.source = EnvSource
+		return m, nil
+	}
+	if ok {
+		m.source = CgroupSource
+		m.procs = procsForQuota(quota, opts.MinProcs)
+		runtime.GOMAXPROCS(m.procs)
+	}
+	return m, nil
+}
+
+func registerMetrics(m *maxProcs, registerer prometheus.Registerer) error {
+	return multierr.Combine(
+		registerer.Register(prometheus.NewGaugeFunc(
+			prometheus.GaugeOpts{Name: CPUQuotaMetricID, Help: "container CPU quota, i.e., number of CPUs - 0 if there is no CPU quota"},
+			func() float64 { return m.quota },
+		)),
+		registerer.Register(prometheus.NewGaugeFunc(
+			prometheus.GaugeOpts{Name: MaxProcsMetricID, Help: "GOMAXPROCS"},
+			func() float64 { return float64(runtime.GOMAXPROCS(0)) },
+		)),
+	)
+}
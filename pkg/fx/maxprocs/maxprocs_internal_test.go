@@ -0,0 +1,95 @@
+/*
+ * Copyright (c) 2019 OysterPack, Inc.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ * http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package maxprocs
+
+import (
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"runtime"
+	"testing"
+)
+
+func cgroupDir(t *testing.T, files map[string]string) string {
+	root, err := ioutil.TempDir("", "cgroup")
+	require.NoError(t, err)
+	for name, content := range files {
+		path := filepath.Join(root, name)
+		require.NoError(t, os.MkdirAll(filepath.Dir(path), 0755))
+		require.NoError(t, ioutil.WriteFile(path, []byte(content), 0644))
+	}
+	return root
+}
+
+func TestCPUQuota(t *testing.T) {
+	t.Parallel()
+
+	testCases := []struct {
+		name  string
+		files map[string]string
+		quota float64
+		ok    bool
+		err   bool
+	}{
+		{"cgroup v2 quota", map[string]string{"cpu.max": "250000 100000\n"}, 2.5, true, false},
+		{"cgroup v2 no quota", map[string]string{"cpu.max": "max 100000\n"}, 0, false, false},
+		{"cgroup v2 invalid", map[string]string{"cpu.max": "250000\n"}, 0, false, true},
+		{"cgroup v1 quota", map[string]string{"cpu/cpu.cfs_quota_us": "50000\n", "cpu/cpu.cfs_period_us": "100000\n"}, 0.5, true, false},
+		{"cgroup v1 no quota", map[string]string{"cpu/cpu.cfs_quota_us": "-1\n", "cpu/cpu.cfs_period_us": "100000\n"}, 0, false, false},
+		{"no cgroup", map[string]string{}, 0, false, false},
+	}
+	for _, testCase := range testCases {
+		root := cgroupDir(t, testCase.files)
+		quota, ok, err := cpuQuota(root)
+		os.RemoveAll(root)
+		if testCase.err {
+			assert.Error(t, err, testCase.name)
+			continue
+		}
+		assert.NoError(t, err, testCase.name)
+		assert.Equal(t, testCase.ok, ok, testCase.name)
+		assert.Equal(t, testCase.quota, quota, testCase.name)
+	}
+}
+
+func TestProcsForQuota(t *testing.T) {
+	t.Parallel()
+
+	assert.Equal(t, 2, procsForQuota(2.5, 1))
+	assert.Equal(t, 1, procsForQuota(0.5, 1))
+	assert.Equal(t, 2, procsForQuota(0.5, 2))
+}
+
+func TestSetMaxProcs(t *testing.T) {
+	previous := runtime.GOMAXPROCS(0)
+	defer runtime.GOMAXPROCS(previous)
+	if _, exists := os.LookupEnv("GOMAXPROCS"); exists {
+		t.Skip("GOMAXPROCS env var is set")
+	}
+
+	root := cgroupDir(t, map[string]string{"cpu.max": "300000 100000\n"})
+	defer os.RemoveAll(root)
+	m, err := setMaxProcs(DefaultOpts(), root)
+	require.NoError(t, err)
+	assert.Equal(t, CgroupSource, m.source)
+	assert.Equal(t, 3.0, m.quota)
+	assert.Equal(t, previous, m.previous)
+	assert.Equal(t, 3, m.procs)
+	assert.Equal(t, 3, runtime.GOMAXPROCS(0))
+}
@@ -0,0 +1,58 @@
+/*
+ * Copyright (c) 2019 OysterPack, Inc.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ * http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package maxprocs_test
+
+import (
+	"context"
+	"github.com/oysterpack/andiamo/pkg/fx/maxprocs"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/rs/zerolog"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.uber.org/fx"
+	"runtime"
+	"testing"
+)
+
+func TestModule(t *testing.T) {
+	previous := runtime.GOMAXPROCS(0)
+
+	registry := prometheus.NewRegistry()
+	logger := zerolog.Nop()
+	app := fx.New(
+		fx.Provide(
+			func() *zerolog.Logger { return &logger },
+			func() prometheus.Registerer { return registry },
+		),
+		maxprocs.Module(maxprocs.DefaultOpts()),
+	)
+	require.NoError(t, app.Err())
+	require.NoError(t, app.Start(context.Background()))
+
+	mfs, err := registry.Gather()
+	require.NoError(t, err)
+	metrics := make(map[string]float64)
+	for _, mf := range mfs {
+		metrics[mf.GetName()] = mf.Metric[0].GetGauge().GetValue()
+	}
+	require.Contains(t, metrics, maxprocs.CPUQuotaMetricID)
+	assert.Equal(t, float64(runtime.GOMAXPROCS(0)), metrics[maxprocs.MaxProcsMetricID])
+
+	// When the module is stopped, then GOMAXPROCS is restored
+	require.NoError(t, app.Stop(context.Background()))
+	assert.Equal(t, previous, runtime.GOMAXPROCS(0))
+}
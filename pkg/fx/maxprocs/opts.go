@@ -0,0 +1,35 @@
+/*
+ * Copyright (c) 2019 OysterPack, Inc.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ * http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package maxprocs
+
+// Opts is used to configure the module
+type Opts struct {
+	// MinProcs is the min GOMAXPROCS value that is set based on the CPU quota - defaults to 1
+	MinProcs int
+}
+
+// DefaultOpts returns the default module options
+func DefaultOpts() Opts {
+	return Opts{MinProcs: 1}
+}
+
+func (opts Opts) withDefaults() Opts {
+	if opts.MinProcs < 1 {
+		opts.MinProcs = 1
+	}
+	return opts
+}
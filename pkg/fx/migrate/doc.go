@@ -0,0 +1,33 @@
+/*
+ * Copyright (c) 2019 OysterPack, Inc.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ * http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+// Package migrate provides an optional fx module that runs database schema migrations when the app is started, i.e.,
+// before the app is ready to service requests.
+//
+// Migrations are loaded from a pluggable `Source`, e.g., an embedded filesystem or a directory - see `FSSource()` and
+// `DirSource()`. Each migration is a SQL file that is named using the following convention:
+//
+//	<version>_<name>.sql, e.g., 0001_create_users.sql
+//
+// Migrations are applied in version order, and each migration is applied within its own transaction. The applied
+// versions are tracked in the migrations table, i.e., the schema version is the max applied version.
+//
+// For Jobs, e.g., a pre-deploy Job that verifies the database schema, the module can be run in "check only" mode, i.e.,
+// migrations are not applied, and the app fails to start if there are pending migrations - see `Opts`.
+//
+// NOTE: migrations are not coordinated across app instances, i.e., in multi-replica deployments migrations should be
+// applied by a single instance, e.g., by a Job, and the other instances should run in check only mode.
+package migrate
@@ -0,0 +1,77 @@
+/*
+ * Copyright (c) 2019 OysterPack, Inc.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ * http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package migrate
+
+import (
+	"github.com/rs/zerolog"
+	"time"
+)
+
+// migrate module events
+const (
+	// MigrationAppliedEvent is logged for each migration that is applied
+	//
+	//	type Data struct {
+	//		Version  uint64 `json:"version"`
+	//		Name     string `json:"name"`
+	//		Duration uint   `json:"duration"`
+	//	}
+	MigrationAppliedEvent = "01DHZYFSM0JDP66XBH64FEBDS2"
+
+	// MigrationsEvent is logged after the migrations are run, or checked
+	//
+	//	type Data struct {
+	//		// the schema version
+	//		Version   uint64   `json:"version"`
+	//		// the number of migrations that were applied
+	//		Applied   int      `json:"applied"`
+	//		// pending migration versions - only in check only mode
+	//		Pending   []uint64 `json:"pending"`
+	//		CheckOnly bool     `json:"check_only"`
+	//	}
+	MigrationsEvent = "01DHZYFSR9HE0BJ571J8Q2FYHZ"
+)
+
+type migrationApplied struct {
+	Migration
+	duration time.Duration
+}
+
+func (e migrationApplied) MarshalZerologObject(event *zerolog.Event) {
+	event.
+		Uint64("version", e.Version).
+		Str("name", e.Name).
+		Dur("duration", e.duration)
+}
+
+type migrationsRun struct {
+	status    Status
+	applied   int
+	checkOnly bool
+}
+
+func (e migrationsRun) MarshalZerologObject(event *zerolog.Event) {
+	pending := make([]uint64, len(e.status.Pending))
+	for i, migration := range e.status.Pending {
+		pending[i] = migration.Version
+	}
+	event.
+		Uint64("version", e.status.Version).
+		Int("applied", e.applied).
+		Uints64("pending", pending).
+		Bool("check_only", e.checkOnly)
+}
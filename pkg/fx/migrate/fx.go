@@ -0,0 +1,65 @@
+/*
+ * Copyright (c) 2019 OysterPack, Inc.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ * http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package migrate
+
+import (
+	"database/sql"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/rs/zerolog"
+	"go.uber.org/fx"
+	"go.uber.org/multierr"
+)
+
+// Module provides the fx Module for the migrate module, which provides `SchemaStatus`.
+//
+// The migrations are run when the app is started. Thus, the app start timeout must allow enough time for the migrations
+// to run. If a migration fails, then the app fails to start.
+//
+// The *sql.DB, *zerolog.Logger, and prometheus.Registerer must be provided by the app.
+func Module(opts Opts) fx.Option {
+	opts = opts.withDefaults()
+	return fx.Options(
+		fx.Provide(func(lc fx.Lifecycle, db *sql.DB, logger *zerolog.Logger, registerer prometheus.Registerer) (SchemaStatus, error) {
+			if err := opts.validate(); err != nil {
+				return nil, err
+			}
+			m := newMigrator(opts, db, logger)
+			if err := registerMetrics(m, registerer); err != nil {
+				return nil, err
+			}
+			lc.Append(fx.Hook{
+				OnStart: m.migrate,
+			})
+			return m.schemaStatus, nil
+		}),
+		// the migrations start hook is registered when the SchemaStatus is constructed
+		fx.Invoke(func(SchemaStatus) {}),
+	)
+}
+
+func registerMetrics(m *migrator, registerer prometheus.Registerer) error {
+	return multierr.Combine(
+		registerer.Register(prometheus.NewGaugeFunc(
+			prometheus.GaugeOpts{Name: SchemaVersionMetricID, Help: "database schema version"},
+			func() float64 { return float64(m.schemaStatus().Version) },
+		)),
+		registerer.Register(prometheus.NewGaugeFunc(
+			prometheus.GaugeOpts{Name: PendingMigrationsMetricID, Help: "number of pending database schema migrations"},
+			func() float64 { return float64(len(m.schemaStatus().Pending)) },
+		)),
+	)
+}
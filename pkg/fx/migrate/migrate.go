@@ -0,0 +1,189 @@
+/*
+ * Copyright (c) 2019 OysterPack, Inc.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ * http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package migrate
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"github.com/oysterpack/andiamo/pkg/eventlog"
+	"github.com/rs/zerolog"
+	"sync"
+	"time"
+)
+
+// metric IDs, which are used as the prometheus metric names
+const (
+	// gauge - the current schema version
+	SchemaVersionMetricID = "U01DHZYFSWJ5MVZ0CHBP0P5BAC2"
+	// gauge - the number of pending migrations
+	PendingMigrationsMetricID = "U01DHZYFT0VJ1J6WFHEDT4BXFKE"
+)
+
+// errors
+var (
+	ErrInvalidOpts         = errors.New("migrate options are invalid")
+	ErrInvalidMigration    = errors.New("migration is invalid")
+	ErrMigrationFailed     = errors.New("migration failed")
+	ErrPendingMigrations   = errors.New("there are pending migrations")
+	ErrOutOfOrderMigration = errors.New("migration version is lower than the current schema version")
+)
+
+// Status is the database schema migration status
+type Status struct {
+	// Version is the current schema version, i.e., the max applied migration version - 0 means no migrations have been
+	// applied
+	Version uint64
+	// Pending migrations, sorted by version
+	Pending []Migration
+}
+
+// SchemaStatus returns the current database schema migration status
+type SchemaStatus func() Status
+
+type migrator struct {
+	opts Opts
+	db   *sql.DB
+
+	logApplied, logMigrations eventlog.Logger
+
+	mutex  sync.RWMutex
+	status Status
+}
+
+func newMigrator(opts Opts, db *sql.DB, logger *zerolog.Logger) *migrator {
+	return &migrator{
+		opts:          opts,
+		db:            db,
+		logApplied:    eventlog.NewLogger(MigrationAppliedEvent, logger, zerolog.InfoLevel),
+		logMigrations: eventlog.NewLogger(MigrationsEvent, logger, zerolog.InfoLevel),
+	}
+}
+
+func (m *migrator) schemaStatus() Status {
+	m.mutex.RLock()
+	defer m.mutex.RUnlock()
+	return m.status
+}
+
+func (m *migrator) setStatus(status Status) {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+	m.status = status
+}
+
+// migrate applies the pending migrations in version order. In check only mode, ErrPendingMigrations is returned if there
+// are pending migrations.
+func (m *migrator) migrate(ctx context.Context) error {
+	migrations, err := m.opts.Source.Migrations()
+	if err != nil {
+		return err
+	}
+	if !m.opts.CheckOnly {
+		if _, err := m.db.ExecContext(ctx, fmt.Sprintf(
+			"CREATE TABLE IF NOT EXISTS %s (version BIGINT PRIMARY KEY, applied_at TIMESTAMP NOT NULL)",
+			m.opts.Table,
+		)); err != nil {
+			return err
+		}
+	}
+	status, err := m.pending(ctx, migrations)
+	if err != nil {
+		return err
+	}
+	m.setStatus(status)
+
+	if m.opts.CheckOnly {
+		m.logMigrations(migrationsRun{status: status, checkOnly: true}, "schema migrations checked")
+		if len(status.Pending) > 0 {
+			return fmt.Errorf("%s : %v", ErrPendingMigrations, status.Pending)
+		}
+		return nil
+	}
+
+	pending := status.Pending
+	for i, migration := range pending {
+		start := time.Now()
+		if err := m.apply(ctx, migration); err != nil {
+			return fmt.Errorf("%s : %s : %s", ErrMigrationFailed, migration, err)
+		}
+		m.logApplied(migrationApplied{migration, time.Since(start)}, "schema migration applied")
+		status = Status{Version: migration.Version, Pending: pending[i+1:]}
+		m.setStatus(status)
+	}
+	m.logMigrations(migrationsRun{status: status, applied: len(pending)}, "schema migrations")
+	return nil
+}
+
+// pending returns the migrations that have not been applied
+func (m *migrator) pending(ctx context.Context, migrations []Migration) (Status, error) {
+	rows, err := m.db.QueryContext(ctx, fmt.Sprintf("SELECT version FROM %s", m.opts.Table))
+	if err != nil {
+		return Status{}, err
+	}
+	defer rows.Close()
+	var status Status
+	applied := make(map[uint64]bool)
+	for rows.Next() {
+		var version int64
+		if err := rows.Scan(&version); err != nil {
+			return Status{}, err
+		}
+		applied[uint64(version)] = true
+		if uint64(version) > status.Version {
+			status.Version = uint64(version)
+		}
+	}
+	if err := rows.Err(); err != nil {
+		return Status{}, err
+	}
+
+	for _, migration := range migrations {
+		if applied[migration.Version] {
+			continue
+		}
+		if migration.Version < status.Version {
+			return Status{}, fmt.Errorf("%s : %s : schema version is %d", ErrOutOfOrderMigration, migration, status.Version)
+		}
+		status.Pending = append(status.Pending, migration)
+	}
+	return status, nil
+}
+
+// apply runs the migration within a transaction, i.e., the migration is recorded in the same transaction.
+//
+// NOTE: some databases, e.g., MySQL, do not support transactional DDL.
+func (m *migrator) apply(ctx context.Context, migration Migration) error {
+	tx, err := m.db.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	if _, err := tx.ExecContext(ctx, migration.SQL); err != nil {
+		tx.Rollback()
+		return err
+	}
+	// the version is an integer, i.e., it is safe to format it into the statement, which avoids driver specific placeholders
+	if _, err := tx.ExecContext(ctx, fmt.Sprintf(
+		"INSERT INTO %s (version, applied_at) VALUES (%d, CURRENT_TIMESTAMP)",
+		m.opts.Table, migration.Version,
+	)); err != nil {
+		tx.Rollback()
+		return err
+	}
+	return tx.Commit()
+}
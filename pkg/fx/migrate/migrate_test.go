@@ -0,0 +1,331 @@
+/*
+ * Copyright (c) 2019 OysterPack, Inc.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ * http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package migrate_test
+
+import (
+	"context"
+	"database/sql"
+	"database/sql/driver"
+	"errors"
+	"github.com/oysterpack/andiamo/pkg/fx/migrate"
+	"github.com/oysterpack/andiamo/pkg/fxapptest"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/rs/zerolog"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.uber.org/fx"
+	"io"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+	"testing/fstest"
+)
+
+// fakeDB records the applied migrations. Statements that contain "FAIL" fail.
+type fakeDB struct {
+	mutex      sync.Mutex
+	tableReady bool
+	versions   []int64
+	statements []string
+}
+
+var fakeDBs = struct {
+	sync.Mutex
+	dbs map[string]*fakeDB
+}{dbs: make(map[string]*fakeDB)}
+
+type fakeDriver struct{}
+
+func (fakeDriver) Open(name string) (driver.Conn, error) {
+	return &fakeConn{db: getFakeDB(name)}, nil
+}
+
+func getFakeDB(name string) *fakeDB {
+	fakeDBs.Lock()
+	defer fakeDBs.Unlock()
+	db, ok := fakeDBs.dbs[name]
+	if !ok {
+		db = &fakeDB{}
+		fakeDBs.dbs[name] = db
+	}
+	return db
+}
+
+type fakeConn struct {
+	db *fakeDB
+	// statements are buffered while in a transaction
+	tx []string
+	in bool
+}
+
+func (c *fakeConn) Prepare(query string) (driver.Stmt, error) {
+	return nil, errors.New("not supported")
+}
+func (c *fakeConn) Close() error { return nil }
+func (c *fakeConn) Begin() (driver.Tx, error) {
+	c.in = true
+	c.tx = nil
+	return c, nil
+}
+
+func (c *fakeConn) Commit() error {
+	c.db.mutex.Lock()
+	defer c.db.mutex.Unlock()
+	for _, statement := range c.tx {
+		c.db.exec(statement)
+	}
+	c.in = false
+	return nil
+}
+
+func (c *fakeConn) Rollback() error {
+	c.in = false
+	c.tx = nil
+	return nil
+}
+
+func (c *fakeConn) ExecContext(ctx context.Context, query string, args []driver.NamedValue) (driver.Result, error) {
+	if strings.Contains(query, "FAIL") {
+		return nil, errors.New("statement failed")
+	}
+	if c.in {
+		c.tx = append(c.tx, query)
+		return driver.RowsAffected(0), nil
+	}
+	c.db.mutex.Lock()
+	defer c.db.mutex.Unlock()
+	c.db.exec(query)
+	return driver.RowsAffected(0), nil
+}
+
+func (c *fakeConn) QueryContext(ctx context.Context, query string, args []driver.NamedValue) (driver.Rows, error) {
+	c.db.mutex.Lock()
+	defer c.db.mutex.Unlock()
+	if !c.db.tableReady {
+		return nil, errors.New("table does not exist")
+	}
+	return &fakeRows{versions: append([]int64(nil), c.db.versions...)}, nil
+}
+
+func (db *fakeDB) exec(statement string) {
+	switch {
+	case strings.HasPrefix(statement, "CREATE TABLE IF NOT EXISTS schema_migrations"):
+		db.tableReady = true
+	case strings.HasPrefix(statement, "INSERT INTO schema_migrations"):
+		values := strings.TrimPrefix(statement, "INSERT INTO schema_migrations (version, applied_at) VALUES (")
+		version, _ := strconv.ParseInt(strings.Split(values, ",")[0], 10, 64)
+		db.versions = append(db.versions, version)
+	default:
+		db.statements = append(db.statements, statement)
+	}
+}
+
+func (db *fakeDB) state() ([]int64, []string) {
+	db.mutex.Lock()
+	defer db.mutex.Unlock()
+	return append([]int64(nil), db.versions...), append([]string(nil), db.statements...)
+}
+
+type fakeRows struct {
+	versions []int64
+}
+
+func (r *fakeRows) Columns() []string { return []string{"version"} }
+func (r *fakeRows) Close() error      { return nil }
+func (r *fakeRows) Next(dest []driver.Value) error {
+	if len(r.versions) == 0 {
+		return io.EOF
+	}
+	dest[0] = r.versions[0]
+	r.versions = r.versions[1:]
+	return nil
+}
+
+func init() {
+	sql.Register("migrate-fake", fakeDriver{})
+}
+
+type testApp struct {
+	*fx.App
+	db       *fakeDB
+	status   migrate.SchemaStatus
+	registry *prometheus.Registry
+	logs     *fxapptest.LogCapture
+}
+
+func newTestApp(t *testing.T, dsn string, opts migrate.Opts) testApp {
+	db, err := sql.Open("migrate-fake", dsn)
+	require.NoError(t, err)
+	registry := prometheus.NewRegistry()
+	logs := fxapptest.NewLogCapture()
+	logger := zerolog.New(logs)
+	var status migrate.SchemaStatus
+	app := fx.New(
+		fx.Provide(
+			func() *sql.DB { return db },
+			func() *zerolog.Logger { return &logger },
+			func() prometheus.Registerer { return registry },
+		),
+		migrate.Module(opts),
+		fx.Populate(&status),
+	)
+	require.NoError(t, app.Err())
+	return testApp{App: app, db: getFakeDB(dsn), status: status, registry: registry, logs: logs}
+}
+
+func (app testApp) gauges(t *testing.T) map[string]float64 {
+	mfs, err := app.registry.Gather()
+	require.NoError(t, err)
+	metrics := make(map[string]float64)
+	for _, mf := range mfs {
+		metrics[mf.GetName()] = mf.Metric[0].GetGauge().GetValue()
+	}
+	return metrics
+}
+
+func TestModule(t *testing.T) {
+	t.Parallel()
+
+	source := fstest.MapFS{
+		"migrations/0001_create_users.sql":  {Data: []byte("CREATE TABLE users")},
+		"migrations/0002_create_orders.sql": {Data: []byte("CREATE TABLE orders")},
+		"migrations/README.md":              {Data: []byte("ignored")},
+	}
+	opts := migrate.Opts{Source: migrate.FSSource(source, "migrations")}
+
+	t.Run("migrations are applied on start", func(t *testing.T) {
+		dsn := t.Name()
+		app := newTestApp(t, dsn, opts)
+		require.NoError(t, app.Start(context.Background()))
+		defer app.Stop(context.Background())
+
+		versions, statements := app.db.state()
+		assert.Equal(t, []int64{1, 2}, versions)
+		assert.Equal(t, []string{"CREATE TABLE users", "CREATE TABLE orders"}, statements)
+		assert.Equal(t, migrate.Status{Version: 2, Pending: []migrate.Migration{}}, normalize(app.status()))
+		assert.Len(t, app.logs.FindEvents(migrate.MigrationAppliedEvent), 2)
+		fxapptest.AssertEventLogged(t, app.logs, migrate.MigrationsEvent)
+		gauges := app.gauges(t)
+		assert.Equal(t, float64(2), gauges[migrate.SchemaVersionMetricID])
+		assert.Equal(t, float64(0), gauges[migrate.PendingMigrationsMetricID])
+
+		t.Run("only pending migrations are applied", func(t *testing.T) {
+			source["migrations/0003_create_items.sql"] = &fstest.MapFile{Data: []byte("CREATE TABLE items")}
+			defer delete(source, "migrations/0003_create_items.sql")
+			app := newTestApp(t, dsn, opts)
+			require.NoError(t, app.Start(context.Background()))
+			defer app.Stop(context.Background())
+
+			versions, statements := app.db.state()
+			assert.Equal(t, []int64{1, 2, 3}, versions)
+			assert.Equal(t, "CREATE TABLE items", statements[len(statements)-1])
+			assert.Equal(t, uint64(3), app.status().Version)
+		})
+	})
+
+	t.Run("check only", func(t *testing.T) {
+		checkOnlyOpts := opts
+		checkOnlyOpts.CheckOnly = true
+
+		// migrations are not applied in check only mode
+		dsn := t.Name()
+		app := newTestApp(t, dsn, checkOnlyOpts)
+		err := app.Start(context.Background())
+		require.Error(t, err)
+
+		app = newTestApp(t, dsn, opts)
+		require.NoError(t, app.Start(context.Background()))
+		require.NoError(t, app.Stop(context.Background()))
+
+		app = newTestApp(t, dsn, checkOnlyOpts)
+		require.NoError(t, app.Start(context.Background()))
+		defer app.Stop(context.Background())
+		assert.Equal(t, uint64(2), app.status().Version)
+
+		t.Run("pending migrations", func(t *testing.T) {
+			source["migrations/0003_create_items.sql"] = &fstest.MapFile{Data: []byte("CREATE TABLE items")}
+			defer delete(source, "migrations/0003_create_items.sql")
+			app := newTestApp(t, dsn, checkOnlyOpts)
+			err := app.Start(context.Background())
+			require.Error(t, err)
+			assert.Contains(t, err.Error(), migrate.ErrPendingMigrations.Error())
+			assert.Equal(t, 1, len(app.status().Pending))
+			versions, _ := app.db.state()
+			assert.Equal(t, []int64{1, 2}, versions)
+		})
+	})
+
+	t.Run("failed migration", func(t *testing.T) {
+		source := fstest.MapFS{
+			"0001_create_users.sql": {Data: []byte("CREATE TABLE users")},
+			"0002_fail.sql":         {Data: []byte("FAIL")},
+		}
+		app := newTestApp(t, t.Name(), migrate.Opts{Source: migrate.FSSource(source, ".")})
+		err := app.Start(context.Background())
+		require.Error(t, err)
+		assert.Contains(t, err.Error(), migrate.ErrMigrationFailed.Error())
+		// the failed migration is rolled back
+		versions, statements := app.db.state()
+		assert.Equal(t, []int64{1}, versions)
+		assert.Equal(t, []string{"CREATE TABLE users"}, statements)
+		assert.Equal(t, migrate.Status{Version: 1, Pending: []migrate.Migration{{Version: 2, Name: "fail", SQL: "FAIL"}}}, app.status())
+	})
+
+	t.Run("out of order migration", func(t *testing.T) {
+		source := fstest.MapFS{"0002_create_orders.sql": {Data: []byte("CREATE TABLE orders")}}
+		app := newTestApp(t, t.Name(), migrate.Opts{Source: migrate.FSSource(source, ".")})
+		require.NoError(t, app.Start(context.Background()))
+		require.NoError(t, app.Stop(context.Background()))
+
+		source["0001_create_users.sql"] = &fstest.MapFile{Data: []byte("CREATE TABLE users")}
+		app = newTestApp(t, t.Name(), migrate.Opts{Source: migrate.FSSource(source, ".")})
+		err := app.Start(context.Background())
+		require.Error(t, err)
+		assert.Contains(t, err.Error(), migrate.ErrOutOfOrderMigration.Error())
+	})
+}
+
+func normalize(status migrate.Status) migrate.Status {
+	if status.Pending == nil {
+		status.Pending = []migrate.Migration{}
+	}
+	return status
+}
+
+func TestModule_InvalidOpts(t *testing.T) {
+	t.Parallel()
+
+	for _, opts := range []migrate.Opts{
+		{},
+		{Source: migrate.DirSource("migrations"), Table: "migrations; DROP TABLE users"},
+	} {
+		db, err := sql.Open("migrate-fake", t.Name())
+		require.NoError(t, err)
+		logger := zerolog.Nop()
+		app := fx.New(
+			fx.Provide(
+				func() *sql.DB { return db },
+				func() *zerolog.Logger { return &logger },
+				func() prometheus.Registerer { return prometheus.NewRegistry() },
+			),
+			migrate.Module(opts),
+		)
+		require.Error(t, app.Err())
+		assert.Contains(t, app.Err().Error(), migrate.ErrInvalidOpts.Error())
+	}
+}
@@ -0,0 +1,54 @@
+/*
+ * Copyright (c) 2019 OysterPack, Inc.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ * http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package migrate
+
+import (
+	"fmt"
+	"regexp"
+)
+
+// DefaultTable is the default migrations table name
+const DefaultTable = "schema_migrations"
+
+var tableNameRegexp = regexp.MustCompile(`^[A-Za-z_][A-Za-z0-9_]*(\.[A-Za-z_][A-Za-z0-9_]*)?$`)
+
+// Opts is used to configure the module
+type Opts struct {
+	// Source is used to load the migrations - required
+	Source Source
+	// Table is the name of the table that tracks the applied migrations - defaults to DefaultTable
+	Table string
+	// CheckOnly means migrations are not applied. If there are pending migrations, then the app fails to start.
+	CheckOnly bool
+}
+
+func (opts Opts) withDefaults() Opts {
+	if opts.Table == "" {
+		opts.Table = DefaultTable
+	}
+	return opts
+}
+
+func (opts Opts) validate() error {
+	if opts.Source == nil {
+		return fmt.Errorf("%s : source is required", ErrInvalidOpts)
+	}
+	if !tableNameRegexp.MatchString(opts.Table) {
+		return fmt.Errorf("%s : invalid table name : %q", ErrInvalidOpts, opts.Table)
+	}
+	return nil
+}
@@ -0,0 +1,105 @@
+/*
+ * Copyright (c) 2019 OysterPack, Inc.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ * http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package migrate
+
+import (
+	"fmt"
+	"io/fs"
+	"os"
+	"path"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// Migration is a database schema migration
+type Migration struct {
+	// Version must be unique - migrations are applied in version order
+	Version uint64
+	Name    string
+	SQL     string
+}
+
+func (m Migration) String() string {
+	return fmt.Sprintf("%d_%s", m.Version, m.Name)
+}
+
+// Source is used to load the migrations
+type Source interface {
+	// Migrations returns the migrations sorted by version
+	Migrations() ([]Migration, error)
+}
+
+// SourceFunc is a function that implements the Source interface
+type SourceFunc func() ([]Migration, error)
+
+// Migrations implements the Source interface
+func (f SourceFunc) Migrations() ([]Migration, error) {
+	return f()
+}
+
+// FSSource loads the migrations from the specified filesystem directory, e.g., an embedded filesystem. Files that do not
+// have a ".sql" extension are ignored.
+func FSSource(fsys fs.FS, dir string) Source {
+	return SourceFunc(func() ([]Migration, error) {
+		entries, err := fs.ReadDir(fsys, dir)
+		if err != nil {
+			return nil, err
+		}
+		var migrations []Migration
+		versions := make(map[uint64]string, len(entries))
+		for _, entry := range entries {
+			if entry.IsDir() || path.Ext(entry.Name()) != ".sql" {
+				continue
+			}
+			migration, err := parseMigrationFileName(entry.Name())
+			if err != nil {
+				return nil, err
+			}
+			if name, exists := versions[migration.Version]; exists {
+				return nil, fmt.Errorf("%s : duplicate version : %s, %s", ErrInvalidMigration, name, entry.Name())
+			}
+			versions[migration.Version] = entry.Name()
+			sql, err := fs.ReadFile(fsys, path.Join(dir, entry.Name()))
+			if err != nil {
+				return nil, err
+			}
+			migration.SQL = string(sql)
+			migrations = append(migrations, migration)
+		}
+		sort.Slice(migrations, func(i, j int) bool { return migrations[i].Version < migrations[j].Version })
+		return migrations, nil
+	})
+}
+
+// DirSource loads the migrations from the specified directory - see `FSSource()`
+func DirSource(dir string) Source {
+	return FSSource(os.DirFS(dir), ".")
+}
+
+// parses the migration version and name from the file name, e.g., "0001_create_users.sql"
+func parseMigrationFileName(fileName string) (Migration, error) {
+	parts := strings.SplitN(strings.TrimSuffix(fileName, ".sql"), "_", 2)
+	if len(parts) != 2 || parts[1] == "" {
+		return Migration{}, fmt.Errorf("%s : file name must be formatted as <version>_<name>.sql : %s", ErrInvalidMigration, fileName)
+	}
+	version, err := strconv.ParseUint(parts[0], 10, 63)
+	if err != nil {
+		return Migration{}, fmt.Errorf("%s : version is not valid : %s", ErrInvalidMigration, fileName)
+	}
+	return Migration{Version: version, Name: parts[1]}, nil
+}
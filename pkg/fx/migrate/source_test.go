@@ -0,0 +1,62 @@
+/*
+ * Copyright (c) 2019 OysterPack, Inc.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ * http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package migrate_test
+
+import (
+	"github.com/oysterpack/andiamo/pkg/fx/migrate"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"io/ioutil"
+	"path/filepath"
+	"testing"
+	"testing/fstest"
+)
+
+func TestDirSource(t *testing.T) {
+	t.Parallel()
+
+	dir := t.TempDir()
+	for name, sql := range map[string]string{
+		"0010_create_orders.sql": "CREATE TABLE orders",
+		"0002_create_users.sql":  "CREATE TABLE users",
+		"notes.txt":              "ignored",
+	} {
+		require.NoError(t, ioutil.WriteFile(filepath.Join(dir, name), []byte(sql), 0600))
+	}
+
+	migrations, err := migrate.DirSource(dir).Migrations()
+	require.NoError(t, err)
+	assert.Equal(t, []migrate.Migration{
+		{Version: 2, Name: "create_users", SQL: "CREATE TABLE users"},
+		{Version: 10, Name: "create_orders", SQL: "CREATE TABLE orders"},
+	}, migrations)
+}
+
+func TestFSSource_InvalidMigrations(t *testing.T) {
+	t.Parallel()
+
+	for _, source := range []fstest.MapFS{
+		{"create_users.sql": {}},
+		{"0001.sql": {}},
+		{"0001_.sql": {}},
+		{"0001_create_users.sql": {}, "01_create_orders.sql": {}},
+	} {
+		_, err := migrate.FSSource(source, ".").Migrations()
+		require.Error(t, err, "%v", source)
+		assert.Contains(t, err.Error(), migrate.ErrInvalidMigration.Error())
+	}
+}
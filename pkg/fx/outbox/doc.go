@@ -0,0 +1,29 @@
+/*
+ * Copyright (c) 2019 OysterPack, Inc.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ * http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+// Package outbox provides an optional fx module that relays events from a transactional outbox to a message broker.
+//
+// The transactional outbox pattern is used to reliably publish events, i.e., the app writes events to the outbox within
+// the same DB transaction as the business data changes. The relay polls the outbox `Store` for pending messages and
+// publishes them in order via the `Publisher`, e.g., a NATS or Kafka client adapter. Messages are marked as published
+// after they are published, i.e., messages are delivered at least once.
+//
+// The relay registers a health check for the relay lag, i.e., the age of the oldest pending message, and records
+// metrics for published messages, failures, and lag.
+//
+// In multi-replica deployments, only 1 instance should relay messages. If a `lock.DistributedLock` is provided, then the
+// relay only runs while it holds the relay lock - see `Opts.LockName`.
+package outbox
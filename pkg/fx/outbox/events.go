@@ -0,0 +1,58 @@
+/*
+ * Copyright (c) 2019 OysterPack, Inc.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ * http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package outbox
+
+import (
+	"github.com/rs/zerolog"
+)
+
+// outbox module events
+const (
+	// RelayFailedEvent is logged when the relay fails to acquire the relay lock, poll, publish, or mark messages as published. The relay retries
+	// on the next poll.
+	//
+	//	type Data struct {
+	//		// one of: lock, poll, publish, mark
+	//		Stage   string `json:"stage"`
+	//		// the ID of the message that failed to publish
+	//		Message int64  `json:"msg"`
+	//		Err     string `json:"e"`
+	//	}
+	RelayFailedEvent = "01DJ0EZ4M0J6DDHAJRMNCXVWME"
+)
+
+// relay stages
+const (
+	LockStage    = "lock"
+	PollStage    = "poll"
+	PublishStage = "publish"
+	MarkStage    = "mark"
+)
+
+type relayFailed struct {
+	stage   string
+	message int64
+	err     error
+}
+
+func (e relayFailed) MarshalZerologObject(event *zerolog.Event) {
+	event.Str("stage", e.stage)
+	if e.message != 0 {
+		event.Int64("msg", e.message)
+	}
+	event.Err(e.err)
+}
@@ -0,0 +1,76 @@
+/*
+ * Copyright (c) 2019 OysterPack, Inc.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ * http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package outbox
+
+import (
+	"context"
+	"github.com/oysterpack/andiamo/pkg/fx/health"
+	"github.com/oysterpack/andiamo/pkg/fx/lock"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/rs/zerolog"
+	"go.uber.org/fx"
+)
+
+type relayParams struct {
+	fx.In
+
+	Lifecycle  fx.Lifecycle
+	Store      Store
+	Publisher  Publisher
+	Logger     *zerolog.Logger
+	Registerer prometheus.Registerer
+	Register   health.Register
+	Lock       lock.DistributedLock `optional:"true"`
+}
+
+// Module provides the fx Module for the outbox module, which runs the outbox relay while the app is running.
+//
+// The Store, Publisher, *zerolog.Logger, prometheus.Registerer, and health.Register must be provided by the app. The
+// lock.DistributedLock is optional - see `Opts.LockName`.
+func Module(opts Opts) fx.Option {
+	opts = opts.withDefaults()
+	return fx.Invoke(func(params relayParams) error {
+		r := newRelay(opts, params.Store, params.Publisher, params.Lock, params.Logger)
+		if err := r.registerMetrics(params.Registerer); err != nil {
+			return err
+		}
+		if err := r.registerHealthCheck(params.Register); err != nil {
+			return err
+		}
+		ctx, cancel := context.WithCancel(context.Background())
+		done := make(chan struct{})
+		params.Lifecycle.Append(fx.Hook{
+			OnStart: func(context.Context) error {
+				go func() {
+					defer close(done)
+					r.run(ctx)
+				}()
+				return nil
+			},
+			OnStop: func(stopCtx context.Context) error {
+				cancel()
+				select {
+				case <-done:
+					return nil
+				case <-stopCtx.Done():
+					return stopCtx.Err()
+				}
+			},
+		})
+		return nil
+	})
+}
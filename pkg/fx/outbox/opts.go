@@ -0,0 +1,77 @@
+/*
+ * Copyright (c) 2019 OysterPack, Inc.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ * http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package outbox
+
+import (
+	"time"
+)
+
+// Opts is used to configure the module
+type Opts struct {
+	// PollInterval is how often the outbox is polled for pending messages - defaults to 1 sec
+	PollInterval time.Duration
+	// BatchSize is the max number of messages that are relayed per poll - defaults to 100
+	BatchSize int
+	// LagThresholds map the relay lag to the health check status
+	LagThresholds LagThresholds
+	// LockName is the distributed lock name that is used to elect the relay instance - defaults to "outbox-relay"
+	LockName string
+}
+
+// LagThresholds are used to map the relay lag to `Yellow` and `Red` health check statuses
+type LagThresholds struct {
+	// defaults to 1 min
+	Yellow time.Duration
+	// defaults to 5 mins
+	Red time.Duration
+}
+
+// DefaultOpts returns the default module options
+func DefaultOpts() Opts {
+	return Opts{
+		PollInterval: time.Second,
+		BatchSize:    100,
+		LagThresholds: LagThresholds{
+			Yellow: time.Minute,
+			Red:    5 * time.Minute,
+		},
+		LockName: "outbox-relay",
+	}
+}
+
+func (opts Opts) withDefaults() Opts {
+	defaults := DefaultOpts()
+	if opts.PollInterval <= 0 {
+		opts.PollInterval = defaults.PollInterval
+	}
+	if opts.BatchSize <= 0 {
+		opts.BatchSize = defaults.BatchSize
+	}
+	if opts.LagThresholds.Yellow <= 0 {
+		opts.LagThresholds.Yellow = defaults.LagThresholds.Yellow
+	}
+	if opts.LagThresholds.Red <= 0 {
+		opts.LagThresholds.Red = defaults.LagThresholds.Red
+	}
+	if opts.LagThresholds.Red < opts.LagThresholds.Yellow {
+		opts.LagThresholds.Red = opts.LagThresholds.Yellow
+	}
+	if opts.LockName == "" {
+		opts.LockName = defaults.LockName
+	}
+	return opts
+}
@@ -0,0 +1,55 @@
+/*
+ * Copyright (c) 2019 OysterPack, Inc.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ * http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package outbox
+
+import (
+	"context"
+	"time"
+)
+
+// Message is an outbox message
+type Message struct {
+	// ID is assigned by the store, and determines the message order
+	ID    int64
+	Topic string
+	// Key is optional, e.g., it is used as the Kafka partition key
+	Key       string
+	Payload   []byte
+	CreatedAt time.Time
+}
+
+// Store is the outbox message store
+type Store interface {
+	// Pending returns the pending messages in ID order, up to the specified limit
+	Pending(ctx context.Context, limit int) ([]Message, error)
+	// MarkPublished marks the messages as published
+	MarkPublished(ctx context.Context, ids []int64) error
+}
+
+// Publisher publishes messages to the message broker, e.g., NATS or Kafka
+type Publisher interface {
+	// Publish returns after the message broker has acknowledged the message
+	Publish(ctx context.Context, msg Message) error
+}
+
+// PublisherFunc is a function that implements the Publisher interface
+type PublisherFunc func(ctx context.Context, msg Message) error
+
+// Publish implements the Publisher interface
+func (f PublisherFunc) Publish(ctx context.Context, msg Message) error {
+	return f(ctx, msg)
+}
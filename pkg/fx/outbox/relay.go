@@ -0,0 +1,267 @@
+/*
+ * Copyright (c) 2019 OysterPack, Inc.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ * http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package outbox
+
+import (
+	"context"
+	"fmt"
+	"github.com/oysterpack/andiamo/pkg/eventlog"
+	"github.com/oysterpack/andiamo/pkg/fx/health"
+	"github.com/oysterpack/andiamo/pkg/fx/lock"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/rs/zerolog"
+	"go.uber.org/multierr"
+	"sync"
+	"time"
+)
+
+// metric IDs, which are used as the prometheus metric names
+const (
+	// counter - the number of published messages, labeled by topic
+	PublishedMetricID = "U01DJ0EZ4R9TKR4NRWZN6QNNX4V"
+	// counter - the number of relay failures, labeled by stage
+	FailuresMetricID = "U01DJ0EZ4WJX5PAV6MR3FW5W87G"
+	// gauge - the relay lag in seconds, i.e., the age of the oldest pending message
+	LagMetricID = "U01DJ0EZ50V8VRZ4CK7DF3PAGSV"
+
+	TopicLabel = "topic"
+	StageLabel = "stage"
+)
+
+// health check IDs
+const (
+	RelayLagHealthCheckID = "01DJ0EZ554CW3FK4MFKSDTYZ87"
+
+	// HealthCheckTag is used to tag the outbox health checks
+	HealthCheckTag = "01DJ0EZ59D2W15TARHQ69V28GK"
+)
+
+type metrics struct {
+	published *prometheus.CounterVec
+	failures  *prometheus.CounterVec
+}
+
+type relay struct {
+	opts      Opts
+	store     Store
+	publisher Publisher
+	lock      lock.DistributedLock
+	metrics   metrics
+	logFailed eventlog.Logger
+
+	mutex sync.RWMutex
+	// the created time of the oldest pending message - zero means there are no pending messages
+	oldestPending time.Time
+	pollErr       error
+}
+
+func newRelay(opts Opts, store Store, publisher Publisher, distributedLock lock.DistributedLock, logger *zerolog.Logger) *relay {
+	return &relay{
+		opts:      opts,
+		store:     store,
+		publisher: publisher,
+		lock:      distributedLock,
+		metrics: metrics{
+			published: prometheus.NewCounterVec(prometheus.CounterOpts{
+				Name: PublishedMetricID,
+				Help: "number of outbox messages that were published",
+			}, []string{TopicLabel}),
+			failures: prometheus.NewCounterVec(prometheus.CounterOpts{
+				Name: FailuresMetricID,
+				Help: "number of outbox relay failures",
+			}, []string{StageLabel}),
+		},
+		logFailed: eventlog.NewLogger(RelayFailedEvent, logger, zerolog.WarnLevel),
+	}
+}
+
+func (r *relay) registerMetrics(registerer prometheus.Registerer) error {
+	return multierr.Combine(
+		registerer.Register(r.metrics.published),
+		registerer.Register(r.metrics.failures),
+		registerer.Register(prometheus.NewGaugeFunc(
+			prometheus.GaugeOpts{Name: LagMetricID, Help: "outbox relay lag in seconds, i.e., the age of the oldest pending message"},
+			func() float64 {
+				lag, _ := r.lag()
+				return lag.Seconds()
+			},
+		)),
+	)
+}
+
+func (r *relay) registerHealthCheck(register health.Register) error {
+	return register(health.Check{
+		ID:           RelayLagHealthCheckID,
+		Description:  "outbox relay lag, i.e., the age of the oldest pending message",
+		YellowImpact: "events are being published with a delay",
+		RedImpact:    "events are not being published",
+		Tags:         []string{HealthCheckTag},
+	}, health.CheckerOpts{}, func(ctx context.Context) (health.Status, error) {
+		lag, err := r.lag()
+		switch {
+		case err != nil:
+			return health.Red, err
+		case lag >= r.opts.LagThresholds.Red:
+			return health.Red, fmt.Errorf("outbox relay lag is %s", lag)
+		case lag >= r.opts.LagThresholds.Yellow:
+			return health.Yellow, fmt.Errorf("outbox relay lag is %s", lag)
+		default:
+			return health.Green, nil
+		}
+	})
+}
+
+// lag returns the relay lag and the last poll error
+func (r *relay) lag() (time.Duration, error) {
+	r.mutex.RLock()
+	defer r.mutex.RUnlock()
+	if r.oldestPending.IsZero() {
+		return 0, r.pollErr
+	}
+	return time.Since(r.oldestPending), r.pollErr
+}
+
+func (r *relay) setPollResult(oldestPending time.Time, err error) {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+	r.oldestPending = oldestPending
+	r.pollErr = err
+}
+
+func (r *relay) failed(ctx context.Context, stage string, message int64, err error) {
+	if ctx.Err() == context.Canceled {
+		// the relay is stopping, or the lease was lost
+		return
+	}
+	r.metrics.failures.WithLabelValues(stage).Inc()
+	r.logFailed(relayFailed{stage: stage, message: message, err: err}, "outbox relay failed")
+}
+
+// run relays messages until the context is canceled. If a distributed lock is provided, then messages are only relayed
+// while the lock is held.
+func (r *relay) run(ctx context.Context) {
+	var lease lock.Lease
+	defer func() {
+		if lease != nil {
+			releaseCtx, cancel := context.WithTimeout(context.Background(), r.opts.PollInterval)
+			defer cancel()
+			lease.Release(releaseCtx)
+		}
+	}()
+
+	ticker := time.NewTicker(r.opts.PollInterval)
+	defer ticker.Stop()
+	for {
+		if lease != nil {
+			select {
+			case <-lease.Lost():
+				lease = nil
+			default:
+			}
+		}
+		if r.lock != nil && lease == nil {
+			var ok bool
+			var err error
+			lease, ok, err = r.lock.TryAcquire(ctx, r.opts.LockName)
+			if err != nil {
+				r.failed(ctx, LockStage, 0, err)
+			}
+			if !ok {
+				// another instance is the relay, i.e., its lag is not reported by this instance
+				lease = nil
+				r.setPollResult(time.Time{}, nil)
+			}
+		}
+		if r.lock == nil || lease != nil {
+			// the outbox is drained, i.e., the next batch is polled immediately while batches are full. Batches are only
+			// relayed while the lease is held, i.e., if the lease is lost, then in-flight publishing is canceled.
+			relayCtx, cancel := leaseContext(ctx, lease)
+			for relayCtx.Err() == nil && r.relay(relayCtx) == r.opts.BatchSize {
+			}
+			cancel()
+		}
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// leaseContext returns a context that is canceled when the lease is lost. If the lease is nil, i.e., distributed locking
+// is not enabled, then the context is only canceled when the parent context is canceled.
+func leaseContext(ctx context.Context, lease lock.Lease) (context.Context, context.CancelFunc) {
+	ctx, cancel := context.WithCancel(ctx)
+	if lease != nil {
+		go func() {
+			select {
+			case <-lease.Lost():
+				cancel()
+			case <-ctx.Done():
+			}
+		}()
+	}
+	return ctx, cancel
+}
+
+// relay publishes the next batch of pending messages in order, and returns the number of messages that were relayed. If
+// a message fails to publish, then the batch is stopped, i.e., the message will be retried on the next poll.
+func (r *relay) relay(ctx context.Context) int {
+	msgs, err := r.store.Pending(ctx, r.opts.BatchSize)
+	if err != nil {
+		r.setPollResult(time.Time{}, err)
+		r.failed(ctx, PollStage, 0, err)
+		return 0
+	}
+	if len(msgs) == 0 {
+		r.setPollResult(time.Time{}, nil)
+		return 0
+	}
+	r.setPollResult(msgs[0].CreatedAt, nil)
+
+	published := make([]int64, 0, len(msgs))
+	var publishErr error
+	for _, msg := range msgs {
+		if publishErr = ctx.Err(); publishErr != nil {
+			// the relay is stopping, or the lease was lost
+			break
+		}
+		if publishErr = r.publisher.Publish(ctx, msg); publishErr != nil {
+			r.failed(ctx, PublishStage, msg.ID, publishErr)
+			break
+		}
+		published = append(published, msg.ID)
+		r.metrics.published.WithLabelValues(msg.Topic).Inc()
+	}
+	if len(published) == 0 {
+		return 0
+	}
+	// the published messages are marked even if the relay is stopping or the lease was lost - otherwise, they would be
+	// published again by the next relay
+	markCtx, cancel := context.WithTimeout(context.Background(), r.opts.PollInterval)
+	defer cancel()
+	if err := r.store.MarkPublished(markCtx, published); err != nil {
+		r.failed(markCtx, MarkStage, 0, err)
+		return 0
+	}
+	if publishErr != nil {
+		r.setPollResult(msgs[len(published)].CreatedAt, nil)
+		return 0
+	}
+	r.setPollResult(time.Time{}, nil)
+	return len(msgs)
+}
@@ -0,0 +1,361 @@
+/*
+ * Copyright (c) 2019 OysterPack, Inc.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ * http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package outbox_test
+
+import (
+	"context"
+	"errors"
+	"github.com/oysterpack/andiamo/pkg/fx/health"
+	"github.com/oysterpack/andiamo/pkg/fx/lock"
+	"github.com/oysterpack/andiamo/pkg/fx/outbox"
+	"github.com/oysterpack/andiamo/pkg/fxapp"
+	"github.com/oysterpack/andiamo/pkg/fxapptest"
+	"github.com/oysterpack/andiamo/pkg/ulids"
+	"github.com/prometheus/client_golang/prometheus"
+	dto "github.com/prometheus/client_model/go"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+type memoryStore struct {
+	mutex     sync.Mutex
+	msgs      []outbox.Message
+	published map[int64]bool
+	// if set, then MarkPublished fails
+	markErr error
+}
+
+func newMemoryStore(msgs ...outbox.Message) *memoryStore {
+	return &memoryStore{msgs: msgs, published: make(map[int64]bool)}
+}
+
+func (s *memoryStore) Pending(ctx context.Context, limit int) ([]outbox.Message, error) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	var pending []outbox.Message
+	for _, msg := range s.msgs {
+		if len(pending) == limit {
+			break
+		}
+		if !s.published[msg.ID] {
+			pending = append(pending, msg)
+		}
+	}
+	return pending, nil
+}
+
+// MarkPublished fails if the context is done, i.e., the same as a DB query
+func (s *memoryStore) MarkPublished(ctx context.Context, ids []int64) error {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	if s.markErr != nil {
+		return s.markErr
+	}
+	for _, id := range ids {
+		s.published[id] = true
+	}
+	return nil
+}
+
+func (s *memoryStore) pending() int {
+	msgs, _ := s.Pending(context.Background(), len(s.msgs)+1)
+	return len(msgs)
+}
+
+type recordingPublisher struct {
+	mutex sync.Mutex
+	msgs  []int64
+	// messages with these IDs fail to publish the first time
+	failOnce map[int64]bool
+}
+
+func (p *recordingPublisher) Publish(ctx context.Context, msg outbox.Message) error {
+	p.mutex.Lock()
+	defer p.mutex.Unlock()
+	if p.failOnce[msg.ID] {
+		delete(p.failOnce, msg.ID)
+		return errors.New("broker is unavailable")
+	}
+	p.msgs = append(p.msgs, msg.ID)
+	return nil
+}
+
+func (p *recordingPublisher) published() []int64 {
+	p.mutex.Lock()
+	defer p.mutex.Unlock()
+	return append([]int64(nil), p.msgs...)
+}
+
+// newBuilder returns an app builder with the outbox relay enabled
+func newBuilder(opts outbox.Opts, store outbox.Store, publisher outbox.Publisher, logs *fxapptest.LogCapture) fxapp.Builder {
+	return fxapp.NewBuilder(fxapp.ID(ulids.MustNew()), fxapp.ReleaseID(ulids.MustNew())).
+		Provide(
+			func() outbox.Store { return store },
+			func() outbox.Publisher { return publisher },
+		).
+		Invoke(func() {}).
+		EnableOutboxRelay(opts).
+		LogWriter(logs)
+}
+
+// withLocks enables distributed locks, i.e., only the app instance that holds the relay lock relays messages
+func withLocks(builder fxapp.Builder, backend lock.Backend, opts lock.Opts) fxapp.Builder {
+	return builder.
+		Provide(func() lock.Backend { return backend }).
+		EnableDistributedLocks(opts)
+}
+
+// counter returns the counter value summed across all label values
+func counter(t *testing.T, gatherer prometheus.Gatherer, metricID string) float64 {
+	mfs, err := gatherer.Gather()
+	require.NoError(t, err)
+	var total float64
+	for _, mf := range fxapp.FindMetricFamilies(mfs, func(mf *dto.MetricFamily) bool { return mf.GetName() == metricID }) {
+		for _, m := range mf.Metric {
+			total += m.GetCounter().GetValue()
+		}
+	}
+	return total
+}
+
+func waitFor(t *testing.T, condition func() bool) {
+	t.Helper()
+	timeout := time.After(5 * time.Second)
+	for !condition() {
+		select {
+		case <-timeout:
+			t.Fatal("*** timed out")
+		case <-time.After(5 * time.Millisecond):
+		}
+	}
+}
+
+func messages(n int, createdAt time.Time) []outbox.Message {
+	msgs := make([]outbox.Message, n)
+	for i := range msgs {
+		msgs[i] = outbox.Message{ID: int64(i + 1), Topic: "orders", Payload: []byte("{}"), CreatedAt: createdAt}
+	}
+	return msgs
+}
+
+func TestModule(t *testing.T) {
+	t.Parallel()
+
+	store := newMemoryStore(messages(5, time.Now())...)
+	publisher := &recordingPublisher{failOnce: map[int64]bool{3: true}}
+	logs := fxapptest.NewLogCapture()
+	var gatherer prometheus.Gatherer
+	var runCheckNow health.RunCheckNow
+	builder := newBuilder(outbox.Opts{PollInterval: 10 * time.Millisecond, BatchSize: 2}, store, publisher, logs).
+		Populate(&gatherer, &runCheckNow)
+	fxapptest.RunApp(t, builder, func(fxapp.App, *fxapptest.HTTPClient) {
+		waitFor(t, func() bool { return store.pending() == 0 })
+		// messages are published in order, and the failed message is retried
+		assert.Equal(t, []int64{1, 2, 3, 4, 5}, publisher.published())
+		assert.Equal(t, float64(5), counter(t, gatherer, outbox.PublishedMetricID))
+		assert.Equal(t, float64(1), counter(t, gatherer, outbox.FailuresMetricID))
+		fxapptest.AssertEventLogged(t, logs, outbox.RelayFailedEvent, fxapptest.Field("d.stage", outbox.PublishStage))
+
+		result, err := runCheckNow(outbox.RelayLagHealthCheckID)
+		require.NoError(t, err)
+		assert.NoError(t, result.Err)
+		assert.Equal(t, health.Green, result.Status)
+	})
+}
+
+func TestModule_LagHealthCheck(t *testing.T) {
+	t.Parallel()
+
+	store := newMemoryStore()
+	publisher := outbox.PublisherFunc(func(ctx context.Context, msg outbox.Message) error {
+		return errors.New("broker is unavailable")
+	})
+	opts := outbox.Opts{
+		PollInterval:  10 * time.Millisecond,
+		LagThresholds: outbox.LagThresholds{Yellow: time.Minute, Red: 3 * time.Minute},
+	}
+	logs := fxapptest.NewLogCapture()
+	var runCheckNow health.RunCheckNow
+	fxapptest.RunApp(t, newBuilder(opts, store, publisher, logs).Populate(&runCheckNow), func(fxapp.App, *fxapptest.HTTPClient) {
+		// the message is added after the app is started, i.e., the start up health checks pass
+		store.mutex.Lock()
+		store.msgs = messages(1, time.Now().Add(-2*time.Minute))
+		store.mutex.Unlock()
+		_, err := logs.WaitForEvent(outbox.RelayFailedEvent, 5*time.Second, fxapptest.Field("d.stage", outbox.PublishStage))
+		require.NoError(t, err)
+		result, err := runCheckNow(outbox.RelayLagHealthCheckID)
+		require.NoError(t, err)
+		assert.Error(t, result.Err)
+		assert.Equal(t, health.Yellow, result.Status)
+	})
+}
+
+func TestModule_DistributedLock(t *testing.T) {
+	t.Parallel()
+
+	store := newMemoryStore()
+	backend := lock.NewMemoryBackend()
+	opts := outbox.Opts{PollInterval: 10 * time.Millisecond}
+	run := func(publisher *recordingPublisher, test func(app fxapp.App)) {
+		builder := withLocks(newBuilder(opts, store, publisher, fxapptest.NewLogCapture()), backend, lock.Opts{TTL: time.Second})
+		fxapptest.RunApp(t, builder, func(app fxapp.App, _ *fxapptest.HTTPClient) {
+			test(app)
+		})
+	}
+
+	publishers := []*recordingPublisher{{}, {}}
+	run(publishers[0], func(app0 fxapp.App) {
+		run(publishers[1], func(app1 fxapp.App) {
+			apps := []fxapp.App{app0, app1}
+			store.mutex.Lock()
+			store.msgs = messages(10, time.Now())
+			store.mutex.Unlock()
+			waitFor(t, func() bool { return store.pending() == 0 })
+			// only the instance that holds the lock relays messages
+			leader, standby := 0, 1
+			if len(publishers[leader].published()) == 0 {
+				leader, standby = standby, leader
+			}
+			assert.Len(t, publishers[leader].published(), 10)
+			assert.Empty(t, publishers[standby].published())
+
+			// when the leader is stopped, then the lock is released, and the standby takes over
+			require.NoError(t, apps[leader].Shutdown())
+			<-apps[leader].Done()
+			store.mutex.Lock()
+			store.msgs = append(store.msgs, outbox.Message{ID: 11, Topic: "orders", CreatedAt: time.Now()})
+			store.mutex.Unlock()
+			waitFor(t, func() bool { return store.pending() == 0 })
+			assert.Equal(t, []int64{11}, publishers[standby].published())
+		})
+	})
+}
+
+// losingBackend loses the locks when lost is set, i.e., locks can no longer be renewed or acquired
+type losingBackend struct {
+	lock.Backend
+	lost int32
+}
+
+func (b *losingBackend) TryLock(ctx context.Context, name, owner string, ttl time.Duration) (bool, error) {
+	if atomic.LoadInt32(&b.lost) == 1 {
+		return false, nil
+	}
+	return b.Backend.TryLock(ctx, name, owner, ttl)
+}
+
+func (b *losingBackend) Renew(ctx context.Context, name, owner string, ttl time.Duration) (bool, error) {
+	if atomic.LoadInt32(&b.lost) == 1 {
+		return false, nil
+	}
+	return b.Backend.Renew(ctx, name, owner, ttl)
+}
+
+func TestModule_LeaseLost(t *testing.T) {
+	t.Parallel()
+
+	store := newMemoryStore(messages(10, time.Now())...)
+	backend := &losingBackend{Backend: lock.NewMemoryBackend()}
+	var mutex sync.Mutex
+	var published []int64
+	canceled := make(chan error, 1)
+	publisher := outbox.PublisherFunc(func(ctx context.Context, msg outbox.Message) error {
+		if msg.ID == 3 {
+			// the lock is lost while the message is being published
+			atomic.StoreInt32(&backend.lost, 1)
+			select {
+			case <-ctx.Done():
+				canceled <- ctx.Err()
+				return ctx.Err()
+			case <-time.After(5 * time.Second):
+				canceled <- nil
+				return errors.New("broker timed out")
+			}
+		}
+		mutex.Lock()
+		defer mutex.Unlock()
+		published = append(published, msg.ID)
+		return nil
+	})
+	builder := withLocks(
+		newBuilder(outbox.Opts{PollInterval: 10 * time.Millisecond, BatchSize: 1}, store, publisher, fxapptest.NewLogCapture()),
+		backend, lock.Opts{TTL: time.Second, RenewInterval: 10 * time.Millisecond},
+	)
+	fxapptest.RunApp(t, builder, func(fxapp.App, *fxapptest.HTTPClient) {
+		// the in-flight publish is canceled when the lease is lost, and no more batches are relayed
+		require.Error(t, <-canceled)
+		time.Sleep(50 * time.Millisecond)
+		mutex.Lock()
+		defer mutex.Unlock()
+		assert.Equal(t, []int64{1, 2}, published)
+		assert.Equal(t, 8, store.pending())
+	})
+}
+
+func TestModule_LeaseLostBeforeMark(t *testing.T) {
+	t.Parallel()
+
+	run := func(t *testing.T, store *memoryStore, test func(logs *fxapptest.LogCapture, gatherer prometheus.Gatherer)) {
+		backend := &losingBackend{Backend: lock.NewMemoryBackend()}
+		publisher := outbox.PublisherFunc(func(ctx context.Context, msg outbox.Message) error {
+			// the lock is lost after the message is published, but before it is marked as published
+			atomic.StoreInt32(&backend.lost, 1)
+			select {
+			case <-ctx.Done():
+			case <-time.After(5 * time.Second):
+			}
+			return nil
+		})
+		logs := fxapptest.NewLogCapture()
+		var gatherer prometheus.Gatherer
+		builder := withLocks(
+			newBuilder(outbox.Opts{PollInterval: 10 * time.Millisecond, BatchSize: 1}, store, publisher, logs),
+			backend, lock.Opts{TTL: time.Second, RenewInterval: 10 * time.Millisecond},
+		)
+		fxapptest.RunApp(t, builder.Populate(&gatherer), func(fxapp.App, *fxapptest.HTTPClient) {
+			test(logs, gatherer)
+		})
+	}
+
+	t.Run("published messages are marked after the lease is lost", func(t *testing.T) {
+		store := newMemoryStore(messages(2, time.Now())...)
+		run(t, store, func(*fxapptest.LogCapture, prometheus.Gatherer) {
+			waitFor(t, func() bool { return store.pending() == 1 })
+			store.mutex.Lock()
+			defer store.mutex.Unlock()
+			assert.True(t, store.published[1])
+		})
+	})
+
+	t.Run("mark failures are reported after the lease is lost", func(t *testing.T) {
+		store := newMemoryStore(messages(2, time.Now())...)
+		store.markErr = errors.New("DB is unavailable")
+		run(t, store, func(logs *fxapptest.LogCapture, gatherer prometheus.Gatherer) {
+			_, err := logs.WaitForEvent(outbox.RelayFailedEvent, 5*time.Second, fxapptest.Field("d.stage", outbox.MarkStage))
+			require.NoError(t, err)
+			assert.True(t, counter(t, gatherer, outbox.FailuresMetricID) > 0)
+			assert.Equal(t, 2, store.pending())
+		})
+	})
+}
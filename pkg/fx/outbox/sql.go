@@ -0,0 +1,97 @@
+/*
+ * Copyright (c) 2019 OysterPack, Inc.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ * http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package outbox
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+// ErrInvalidTable indicates the outbox table name is invalid
+var ErrInvalidTable = errors.New("outbox table name is invalid")
+
+var tableNameRegexp = regexp.MustCompile(`^[A-Za-z_][A-Za-z0-9_]*(\.[A-Za-z_][A-Za-z0-9_]*)?$`)
+
+// NewSQLStore returns a Store that is backed by the specified DB table, which must have the following columns, e.g., for
+// Postgres:
+//
+//	CREATE TABLE outbox (
+//		id           BIGSERIAL PRIMARY KEY,
+//		topic        VARCHAR(255) NOT NULL,
+//		msg_key      VARCHAR(255) NOT NULL DEFAULT '',
+//		payload      BYTEA NOT NULL,
+//		created_at   TIMESTAMPTZ NOT NULL DEFAULT CURRENT_TIMESTAMP,
+//		published_at TIMESTAMPTZ
+//	)
+//
+// The timestamps must include the time zone, because the relay lag is computed from created_at using the app clock, i.e.,
+// a timestamp without time zone is skewed by the offset between the DB session time zone and UTC.
+//
+// The app inserts messages within its business transactions, and the relay sets published_at when the message is
+// published. Published messages should be purged periodically.
+func NewSQLStore(db *sql.DB, table string) (Store, error) {
+	if !tableNameRegexp.MatchString(table) {
+		return nil, fmt.Errorf("%s : %q", ErrInvalidTable, table)
+	}
+	return &sqlStore{db: db, table: table}, nil
+}
+
+type sqlStore struct {
+	db    *sql.DB
+	table string
+}
+
+func (s *sqlStore) Pending(ctx context.Context, limit int) ([]Message, error) {
+	rows, err := s.db.QueryContext(ctx, fmt.Sprintf(
+		"SELECT id, topic, msg_key, payload, created_at FROM %s WHERE published_at IS NULL ORDER BY id LIMIT %d",
+		s.table, limit,
+	))
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var msgs []Message
+	for rows.Next() {
+		var msg Message
+		if err := rows.Scan(&msg.ID, &msg.Topic, &msg.Key, &msg.Payload, &msg.CreatedAt); err != nil {
+			return nil, err
+		}
+		msgs = append(msgs, msg)
+	}
+	return msgs, rows.Err()
+}
+
+// the IDs are integers, i.e., it is safe to format them into the statement, which avoids driver specific placeholders
+func (s *sqlStore) MarkPublished(ctx context.Context, ids []int64) error {
+	if len(ids) == 0 {
+		return nil
+	}
+	values := make([]string, len(ids))
+	for i, id := range ids {
+		values[i] = strconv.FormatInt(id, 10)
+	}
+	_, err := s.db.ExecContext(ctx, fmt.Sprintf(
+		"UPDATE %s SET published_at = CURRENT_TIMESTAMP WHERE id IN (%s)",
+		s.table, strings.Join(values, ", "),
+	))
+	return err
+}
@@ -0,0 +1,109 @@
+/*
+ * Copyright (c) 2019 OysterPack, Inc.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ * http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package outbox_test
+
+import (
+	"context"
+	"database/sql"
+	"database/sql/driver"
+	"errors"
+	"github.com/oysterpack/andiamo/pkg/fx/outbox"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"io"
+	"testing"
+	"time"
+)
+
+// fakeOutboxDB returns 2 pending messages, and records the executed statements
+type fakeOutboxDB struct {
+	queries    []string
+	statements []string
+	createdAt  time.Time
+}
+
+func (db *fakeOutboxDB) Open(name string) (driver.Conn, error) { return db, nil }
+func (db *fakeOutboxDB) Prepare(query string) (driver.Stmt, error) {
+	return nil, errors.New("not supported")
+}
+func (db *fakeOutboxDB) Close() error              { return nil }
+func (db *fakeOutboxDB) Begin() (driver.Tx, error) { return nil, errors.New("not supported") }
+func (db *fakeOutboxDB) ExecContext(ctx context.Context, query string, args []driver.NamedValue) (driver.Result, error) {
+	db.statements = append(db.statements, query)
+	return driver.RowsAffected(2), nil
+}
+func (db *fakeOutboxDB) QueryContext(ctx context.Context, query string, args []driver.NamedValue) (driver.Rows, error) {
+	db.queries = append(db.queries, query)
+	return &outboxRows{rows: [][]driver.Value{
+		{int64(1), "orders", "a", []byte("1"), db.createdAt},
+		{int64(2), "orders", "", []byte("2"), db.createdAt},
+	}}, nil
+}
+
+type outboxRows struct {
+	rows [][]driver.Value
+}
+
+func (r *outboxRows) Columns() []string {
+	return []string{"id", "topic", "msg_key", "payload", "created_at"}
+}
+func (r *outboxRows) Close() error { return nil }
+func (r *outboxRows) Next(dest []driver.Value) error {
+	if len(r.rows) == 0 {
+		return io.EOF
+	}
+	copy(dest, r.rows[0])
+	r.rows = r.rows[1:]
+	return nil
+}
+
+var fakeOutbox = &fakeOutboxDB{createdAt: time.Now().UTC().Truncate(time.Second)}
+
+func init() {
+	sql.Register("outbox-fake", fakeOutbox)
+}
+
+func TestSQLStore(t *testing.T) {
+	t.Parallel()
+
+	db, err := sql.Open("outbox-fake", "")
+	require.NoError(t, err)
+	store, err := outbox.NewSQLStore(db, "app.outbox")
+	require.NoError(t, err)
+
+	msgs, err := store.Pending(context.Background(), 10)
+	require.NoError(t, err)
+	assert.Equal(t, []outbox.Message{
+		{ID: 1, Topic: "orders", Key: "a", Payload: []byte("1"), CreatedAt: fakeOutbox.createdAt},
+		{ID: 2, Topic: "orders", Payload: []byte("2"), CreatedAt: fakeOutbox.createdAt},
+	}, msgs)
+	assert.Equal(t, []string{
+		"SELECT id, topic, msg_key, payload, created_at FROM app.outbox WHERE published_at IS NULL ORDER BY id LIMIT 10",
+	}, fakeOutbox.queries)
+
+	require.NoError(t, store.MarkPublished(context.Background(), []int64{1, 2}))
+	require.NoError(t, store.MarkPublished(context.Background(), nil))
+	assert.Equal(t, []string{
+		"UPDATE app.outbox SET published_at = CURRENT_TIMESTAMP WHERE id IN (1, 2)",
+	}, fakeOutbox.statements)
+
+	t.Run("invalid table name", func(t *testing.T) {
+		_, err := outbox.NewSQLStore(db, "outbox; DROP TABLE users")
+		require.Error(t, err)
+		assert.Contains(t, err.Error(), outbox.ErrInvalidTable.Error())
+	})
+}
@@ -0,0 +1,30 @@
+/*
+ * Copyright (c) 2019 OysterPack, Inc.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ * http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+// Package retry provides an optional fx module that provides a `Retrier`, which is used to retry operations, e.g.,
+// outbound calls, with consistent and observable retry behavior.
+//
+// Retry policy:
+//   - exponential backoff, i.e., the backoff is multiplied after each failed attempt, and is capped by the max backoff
+//   - jitter, i.e., the backoff is randomized in order to avoid synchronized retry storms
+//   - max attempts
+//   - retryable error predicates - errors that are wrapped via `Permanent()` are never retried
+//
+// The default policy is configured via the module `Opts`, and can be overridden per operation via `Retrier.WithOpts()`.
+//
+// Failed attempts are logged as events, and attempt outcomes are recorded via the `AttemptsMetricID` metric. Operation
+// names are used as metric label values, and thus should be static names, e.g., "payments.charge".
+package retry
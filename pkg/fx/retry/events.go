@@ -0,0 +1,77 @@
+/*
+ * Copyright (c) 2019 OysterPack, Inc.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ * http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package retry
+
+import (
+	"github.com/rs/zerolog"
+	"time"
+)
+
+// retry module events
+const (
+	// RetryEvent is logged when an attempt fails and the operation will be retried after the backoff
+	//
+	//	type Data struct {
+	//		Op      string `json:"op"`
+	//		Attempt uint   `json:"attempt"`
+	//		// msec
+	//		Backoff uint   `json:"backoff"`
+	//		Err     string `json:"e"`
+	//	}
+	RetryEvent = "01DJ17P540JVMSN70NS7DATQAE"
+
+	// RetryFailedEvent is logged when the operation fails, i.e., it will not be retried
+	//
+	//	type Data struct {
+	//		Op       string `json:"op"`
+	//		Attempts uint   `json:"attempts"`
+	//		// one of: exhausted, permanent, canceled
+	//		Result   string `json:"result"`
+	//		Err      string `json:"e"`
+	//	}
+	RetryFailedEvent = "01DJ17P589RY8TYGW7CHANVHJ9"
+)
+
+type retry struct {
+	op      string
+	attempt int
+	backoff time.Duration
+	err     error
+}
+
+func (e retry) MarshalZerologObject(event *zerolog.Event) {
+	event.
+		Str("op", e.op).
+		Int("attempt", e.attempt).
+		Dur("backoff", e.backoff).
+		Err(e.err)
+}
+
+type retryFailed struct {
+	op       string
+	attempts int
+	result   string
+	err      error
+}
+
+func (e retryFailed) MarshalZerologObject(event *zerolog.Event) {
+	event.
+		Str("op", e.op).
+		Int("attempts", e.attempts).
+		Str("result", e.result).
+		Err(e.err)
+}
@@ -0,0 +1,51 @@
+/*
+ * Copyright (c) 2019 OysterPack, Inc.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ * http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package retry
+
+import (
+	"github.com/oysterpack/andiamo/pkg/clock"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/rs/zerolog"
+	"go.uber.org/fx"
+)
+
+type retrierParams struct {
+	fx.In
+
+	Clock      clock.Clock `optional:"true"`
+	Logger     *zerolog.Logger
+	Registerer prometheus.Registerer
+}
+
+// Module provides the fx Module for the retry module, which provides the `Retrier`. The module options are used as the
+// default retry policy.
+//
+// The *zerolog.Logger and prometheus.Registerer must be provided by the app. The clock.Clock is optional - if not
+// provided, then the real clock is used.
+func Module(opts Opts) fx.Option {
+	return fx.Provide(func(params retrierParams) (Retrier, error) {
+		clk := params.Clock
+		if clk == nil {
+			clk = clock.Real()
+		}
+		r := newRetrier(opts, clk, params.Logger)
+		if err := params.Registerer.Register(r.attempts); err != nil {
+			return nil, err
+		}
+		return r, nil
+	})
+}
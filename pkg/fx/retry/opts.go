@@ -0,0 +1,106 @@
+/*
+ * Copyright (c) 2019 OysterPack, Inc.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ * http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package retry
+
+import (
+	"math/rand"
+	"time"
+)
+
+// Opts is used to configure the retry policy
+type Opts struct {
+	// MaxAttempts is the max number of times the operation is attempted, i.e., including the first attempt - defaults to 5
+	MaxAttempts int
+	// InitialBackoff is the backoff after the first failed attempt - defaults to 100 msec
+	InitialBackoff time.Duration
+	// MaxBackoff caps the backoff - defaults to 10 sec
+	MaxBackoff time.Duration
+	// Multiplier is used to grow the backoff after each failed attempt - defaults to 2
+	Multiplier float64
+	// Jitter randomizes the backoff by the specified ratio in the range [0, 1], e.g., 0.2 means +/- 20%. If zero, then
+	// there is no jitter.
+	Jitter float64
+
+	// Retryable is optional, and is used to decide if an error is retryable. If not specified, then all errors are
+	// retryable, except for permanent errors - see `Permanent()`.
+	Retryable func(err error) bool
+}
+
+// DefaultOpts returns the default retry policy
+func DefaultOpts() Opts {
+	return Opts{
+		MaxAttempts:    5,
+		InitialBackoff: 100 * time.Millisecond,
+		MaxBackoff:     10 * time.Second,
+		Multiplier:     2,
+		Jitter:         0.2,
+	}
+}
+
+func (opts Opts) withDefaults() Opts {
+	defaults := DefaultOpts()
+	if opts.MaxAttempts <= 0 {
+		opts.MaxAttempts = defaults.MaxAttempts
+	}
+	if opts.InitialBackoff <= 0 {
+		opts.InitialBackoff = defaults.InitialBackoff
+	}
+	if opts.MaxBackoff <= 0 {
+		opts.MaxBackoff = defaults.MaxBackoff
+	}
+	if opts.MaxBackoff < opts.InitialBackoff {
+		opts.MaxBackoff = opts.InitialBackoff
+	}
+	if opts.Multiplier < 1 {
+		opts.Multiplier = defaults.Multiplier
+	}
+	if opts.Jitter < 0 {
+		opts.Jitter = 0
+	}
+	if opts.Jitter > 1 {
+		opts.Jitter = 1
+	}
+	return opts
+}
+
+// Backoff returns the backoff after the specified failed attempt, which starts at 1. Jitter is applied after the backoff
+// is capped, i.e., the backoff may exceed MaxBackoff by the jitter ratio.
+func (opts Opts) Backoff(attempt int) time.Duration {
+	opts = opts.withDefaults()
+	backoff := float64(opts.InitialBackoff)
+	for i := 1; i < attempt && backoff < float64(opts.MaxBackoff); i++ {
+		backoff *= opts.Multiplier
+	}
+	if backoff > float64(opts.MaxBackoff) {
+		backoff = float64(opts.MaxBackoff)
+	}
+	if opts.Jitter > 0 {
+		backoff += backoff * opts.Jitter * (2*rand.Float64() - 1)
+	}
+	return time.Duration(backoff)
+}
+
+// retryable returns false for permanent errors
+func (opts Opts) retryable(err error) bool {
+	if _, ok := err.(permanent); ok {
+		return false
+	}
+	if opts.Retryable == nil {
+		return true
+	}
+	return opts.Retryable(err)
+}
@@ -0,0 +1,165 @@
+/*
+ * Copyright (c) 2019 OysterPack, Inc.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ * http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package retry
+
+import (
+	"context"
+	"github.com/oysterpack/andiamo/pkg/clock"
+	"github.com/oysterpack/andiamo/pkg/eventlog"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/rs/zerolog"
+)
+
+// metric IDs, which are used as the prometheus metric names
+const (
+	// counter - the number of operation attempts, labelled by the operation name and the attempt result
+	AttemptsMetricID = "U01DJ17P5CJS79365FMPHRXKJEM"
+
+	// OpLabel is the metric label for the operation name
+	OpLabel = "op"
+	// ResultLabel is the metric label for the attempt result
+	ResultLabel = "result"
+)
+
+// attempt results
+const (
+	// OK means the attempt succeeded
+	OK = "ok"
+	// Retry means the attempt failed, and the operation will be retried
+	Retry = "retry"
+	// Exhausted means the attempt failed, and the max attempts have been reached
+	Exhausted = "exhausted"
+	// PermanentFailure means the attempt failed with an error that is not retryable
+	PermanentFailure = "permanent"
+	// Canceled means the attempt failed, and the context was done before the operation could be retried
+	Canceled = "canceled"
+)
+
+// Op is the operation that is retried
+type Op func(ctx context.Context) error
+
+// Retrier is used to retry operations
+type Retrier interface {
+	// Do runs the operation until it succeeds, it fails with an error that is not retryable, the max attempts are
+	// reached, or the context is done.
+	//
+	// If the operation fails, then the last error returned by the operation is returned, i.e., permanent errors are
+	// unwrapped. If the context is done before the first attempt, then the context error is returned.
+	Do(ctx context.Context, name string, op Op) error
+	// WithOpts returns a Retrier that uses the specified retry policy. Events and metrics are shared.
+	WithOpts(opts Opts) Retrier
+}
+
+// Permanent wraps the error to signal that it is not retryable
+func Permanent(err error) error {
+	if err == nil {
+		return nil
+	}
+	return permanent{err}
+}
+
+type permanent struct {
+	error
+}
+
+func unwrapPermanent(err error) error {
+	if p, ok := err.(permanent); ok {
+		return p.error
+	}
+	return err
+}
+
+type retrier struct {
+	opts     Opts
+	clock    clock.Clock
+	attempts *prometheus.CounterVec
+
+	logRetry, logFailed eventlog.Logger
+}
+
+func newRetrier(opts Opts, clock clock.Clock, logger *zerolog.Logger) *retrier {
+	return &retrier{
+		opts:  opts.withDefaults(),
+		clock: clock,
+		attempts: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Name: AttemptsMetricID,
+			Help: "the number of operation attempts",
+		}, []string{OpLabel, ResultLabel}),
+		logRetry:  eventlog.NewLogger(RetryEvent, logger, zerolog.WarnLevel),
+		logFailed: eventlog.NewLogger(RetryFailedEvent, logger, zerolog.ErrorLevel),
+	}
+}
+
+func (r *retrier) WithOpts(opts Opts) Retrier {
+	retrier := *r
+	retrier.opts = opts.withDefaults()
+	return &retrier
+}
+
+func (r *retrier) Do(ctx context.Context, name string, op Op) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	for attempt := 1; ; attempt++ {
+		err := op(ctx)
+		if err == nil {
+			r.attempts.WithLabelValues(name, OK).Inc()
+			return nil
+		}
+
+		failed := func(result string) error {
+			r.attempts.WithLabelValues(name, result).Inc()
+			return r.failed(name, attempt, result, err)
+		}
+		switch {
+		case !r.opts.retryable(err):
+			return failed(PermanentFailure)
+		case attempt >= r.opts.MaxAttempts:
+			return failed(Exhausted)
+		case ctx.Err() != nil:
+			return failed(Canceled)
+		}
+
+		backoff := r.opts.Backoff(attempt)
+		r.attempts.WithLabelValues(name, Retry).Inc()
+		r.logRetry(retry{
+			op:      name,
+			attempt: attempt,
+			backoff: backoff,
+			err:     err,
+		}, "operation will be retried")
+		timer := r.clock.NewTimer(backoff)
+		select {
+		case <-ctx.Done():
+			// the attempt was already recorded as a retry
+			timer.Stop()
+			return r.failed(name, attempt, Canceled, err)
+		case <-timer.C():
+		}
+	}
+}
+
+func (r *retrier) failed(name string, attempts int, result string, err error) error {
+	err = unwrapPermanent(err)
+	r.logFailed(retryFailed{
+		op:       name,
+		attempts: attempts,
+		result:   result,
+		err:      err,
+	}, "operation failed")
+	return err
+}
@@ -0,0 +1,209 @@
+/*
+ * Copyright (c) 2019 OysterPack, Inc.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ * http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package retry_test
+
+import (
+	"context"
+	"errors"
+	"github.com/oysterpack/andiamo/pkg/fx/retry"
+	"github.com/oysterpack/andiamo/pkg/fxapp"
+	"github.com/oysterpack/andiamo/pkg/fxapptest"
+	"github.com/oysterpack/andiamo/pkg/ulids"
+	"github.com/prometheus/client_golang/prometheus"
+	dto "github.com/prometheus/client_model/go"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"testing"
+	"time"
+)
+
+// runApp runs an app with retries enabled, and then runs the test - see `fxapptest.RunApp()`
+func runApp(t *testing.T, opts retry.Opts, test func(retrier retry.Retrier, logs *fxapptest.LogCapture, gatherer prometheus.Gatherer)) {
+	var retrier retry.Retrier
+	var gatherer prometheus.Gatherer
+	logs := fxapptest.NewLogCapture()
+	builder := fxapp.NewBuilder(fxapp.ID(ulids.MustNew()), fxapp.ReleaseID(ulids.MustNew())).
+		Invoke(func() {}).
+		EnableRetries(opts).
+		Populate(&retrier, &gatherer).
+		LogWriter(logs)
+	fxapptest.RunApp(t, builder, func(fxapp.App, *fxapptest.HTTPClient) {
+		test(retrier, logs, gatherer)
+	})
+}
+
+// returns the attempt counts for the operation by result
+func attempts(t *testing.T, gatherer prometheus.Gatherer, op string) map[string]float64 {
+	mfs, err := gatherer.Gather()
+	require.NoError(t, err)
+	attempts := make(map[string]float64)
+	for _, mf := range fxapp.FindMetricFamilies(mfs, func(mf *dto.MetricFamily) bool { return mf.GetName() == retry.AttemptsMetricID }) {
+		for _, m := range mf.GetMetric() {
+			labels := make(map[string]string)
+			for _, label := range m.GetLabel() {
+				labels[label.GetName()] = label.GetValue()
+			}
+			if labels[retry.OpLabel] == op {
+				attempts[labels[retry.ResultLabel]] = m.GetCounter().GetValue()
+			}
+		}
+	}
+	return attempts
+}
+
+// fails the specified number of times before succeeding
+func failingOp(failures int, err error) (retry.Op, *int) {
+	calls := 0
+	return func(ctx context.Context) error {
+		calls++
+		if calls <= failures {
+			return err
+		}
+		return nil
+	}, &calls
+}
+
+var errTest = errors.New("BOOM")
+
+func TestRetrier_Do(t *testing.T) {
+	t.Parallel()
+
+	opts := retry.Opts{
+		MaxAttempts:    3,
+		InitialBackoff: time.Millisecond,
+		MaxBackoff:     5 * time.Millisecond,
+	}
+
+	t.Run("succeeds after retries", func(t *testing.T) {
+		runApp(t, opts, func(retrier retry.Retrier, logs *fxapptest.LogCapture, gatherer prometheus.Gatherer) {
+			op, calls := failingOp(2, errTest)
+			require.NoError(t, retrier.Do(context.Background(), "foo", op))
+			assert.Equal(t, 3, *calls)
+			assert.Equal(t, map[string]float64{retry.Retry: 2, retry.OK: 1}, attempts(t, gatherer, "foo"))
+
+			assert.Len(t, logs.FindEvents(retry.RetryEvent), 2)
+			for attempt := 1; attempt <= 2; attempt++ {
+				fxapptest.AssertEventLogged(t, logs, retry.RetryEvent,
+					fxapptest.Field("d.op", "foo"),
+					fxapptest.Field("d.attempt", attempt),
+					fxapptest.Field("d.e", errTest.Error()),
+				)
+			}
+			fxapptest.AssertEventNotLogged(t, logs, retry.RetryFailedEvent)
+		})
+	})
+
+	t.Run("max attempts exhausted", func(t *testing.T) {
+		runApp(t, opts, func(retrier retry.Retrier, logs *fxapptest.LogCapture, gatherer prometheus.Gatherer) {
+			op, calls := failingOp(10, errTest)
+			assert.Equal(t, errTest, retrier.Do(context.Background(), "foo", op))
+			assert.Equal(t, 3, *calls)
+			assert.Equal(t, map[string]float64{retry.Retry: 2, retry.Exhausted: 1}, attempts(t, gatherer, "foo"))
+
+			assert.Len(t, logs.FindEvents(retry.RetryFailedEvent), 1)
+			fxapptest.AssertEventLogged(t, logs, retry.RetryFailedEvent, fxapptest.Field("d.result", retry.Exhausted), fxapptest.Field("d.attempts", 3))
+		})
+	})
+
+	t.Run("permanent error", func(t *testing.T) {
+		runApp(t, opts, func(retrier retry.Retrier, logs *fxapptest.LogCapture, gatherer prometheus.Gatherer) {
+			op, calls := failingOp(10, retry.Permanent(errTest))
+			assert.Equal(t, errTest, retrier.Do(context.Background(), "foo", op))
+			assert.Equal(t, 1, *calls)
+			assert.Equal(t, map[string]float64{retry.PermanentFailure: 1}, attempts(t, gatherer, "foo"))
+		})
+	})
+
+	t.Run("retryable predicate", func(t *testing.T) {
+		opts := opts
+		opts.Retryable = func(err error) bool { return err != errTest }
+		runApp(t, opts, func(retrier retry.Retrier, logs *fxapptest.LogCapture, gatherer prometheus.Gatherer) {
+			op, calls := failingOp(10, errTest)
+			assert.Equal(t, errTest, retrier.Do(context.Background(), "foo", op))
+			assert.Equal(t, 1, *calls)
+		})
+	})
+
+	t.Run("with opts", func(t *testing.T) {
+		runApp(t, opts, func(retrier retry.Retrier, logs *fxapptest.LogCapture, gatherer prometheus.Gatherer) {
+			op, calls := failingOp(10, errTest)
+			assert.Equal(t, errTest, retrier.WithOpts(retry.Opts{MaxAttempts: 5, InitialBackoff: time.Millisecond}).Do(context.Background(), "foo", op))
+			assert.Equal(t, 5, *calls)
+			// metrics are shared
+			assert.Equal(t, map[string]float64{retry.Retry: 4, retry.Exhausted: 1}, attempts(t, gatherer, "foo"))
+		})
+	})
+
+	t.Run("context canceled while backing off", func(t *testing.T) {
+		runApp(t, retry.Opts{MaxAttempts: 3, InitialBackoff: time.Minute}, func(retrier retry.Retrier, logs *fxapptest.LogCapture, gatherer prometheus.Gatherer) {
+			ctx, cancel := context.WithCancel(context.Background())
+			op, calls := failingOp(10, errTest)
+			go func() {
+				defer cancel()
+				logs.WaitForEvent(retry.RetryEvent, 5*time.Second)
+			}()
+			assert.Equal(t, errTest, retrier.Do(ctx, "foo", op))
+			assert.Equal(t, 1, *calls)
+
+			assert.Len(t, logs.FindEvents(retry.RetryFailedEvent), 1)
+			fxapptest.AssertEventLogged(t, logs, retry.RetryFailedEvent, fxapptest.Field("d.result", retry.Canceled))
+		})
+	})
+
+	t.Run("context done before the first attempt", func(t *testing.T) {
+		runApp(t, opts, func(retrier retry.Retrier, logs *fxapptest.LogCapture, gatherer prometheus.Gatherer) {
+			ctx, cancel := context.WithCancel(context.Background())
+			cancel()
+			op, calls := failingOp(0, nil)
+			assert.Equal(t, context.Canceled, retrier.Do(ctx, "foo", op))
+			assert.Zero(t, *calls)
+		})
+	})
+}
+
+func TestOpts_Backoff(t *testing.T) {
+	t.Parallel()
+
+	opts := retry.Opts{
+		InitialBackoff: 100 * time.Millisecond,
+		MaxBackoff:     time.Second,
+		Multiplier:     2,
+	}
+	for attempt, expected := range []time.Duration{
+		100 * time.Millisecond,
+		200 * time.Millisecond,
+		400 * time.Millisecond,
+		800 * time.Millisecond,
+		time.Second,
+		time.Second,
+	} {
+		assert.Equal(t, expected, opts.Backoff(attempt+1), "attempt: %d", attempt+1)
+	}
+
+	opts.Jitter = 0.5
+	for i := 0; i < 100; i++ {
+		backoff := opts.Backoff(1)
+		assert.True(t, backoff >= 50*time.Millisecond && backoff <= 150*time.Millisecond, "backoff: %s", backoff)
+	}
+}
+
+func TestPermanent(t *testing.T) {
+	t.Parallel()
+
+	assert.Nil(t, retry.Permanent(nil))
+	assert.Equal(t, errTest.Error(), retry.Permanent(errTest).Error())
+}
@@ -0,0 +1,34 @@
+/*
+ * Copyright (c) 2019 OysterPack, Inc.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ * http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+// Package upgrade provides an optional fx module that enables zero-downtime binary upgrades, i.e., in-place upgrades for
+// bare-metal deployments where there is no orchestrator to roll out a new instance.
+//
+// When an upgrade is triggered, the running process (old) hands off its listeners to a new process, which is started by
+// exec-ing the app binary, i.e., the binary on disk, which has been replaced with the new version:
+//  1. the active listeners are passed to the new process via file descriptors - see `listener.Export()`
+//  2. the new process inherits the listeners, i.e., both processes accept connections on the same sockets - see
+//     `listener.Listen()`
+//  3. when the new process is ready, it notifies the old process - see `NotifyReady`
+//  4. the old process starts draining, i.e., its readiness probe reports that it is not ready, and after the drain delay
+//     the old process is shutdown gracefully
+//
+// If the new process fails to become ready within the ready timeout, then it is killed and the old process keeps running.
+//
+// Upgrades are triggered via `Trigger`, or via OS signals, e.g., SIGUSR2 - see `Opts`.
+//
+// NOTE: only 1 upgrade can run at a time, and fd passing is not supported on Windows.
+package upgrade
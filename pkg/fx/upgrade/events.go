@@ -0,0 +1,82 @@
+/*
+ * Copyright (c) 2019 OysterPack, Inc.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ * http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package upgrade
+
+import (
+	"github.com/rs/zerolog"
+	"time"
+)
+
+// upgrade module events
+const (
+	// UpgradeStartingEvent is logged by the old process when the upgrade is triggered
+	//
+	//	type Data struct {
+	//		Executable string   `json:"exe"`
+	//		Listeners  []string `json:"listeners"`
+	//	}
+	UpgradeStartingEvent = "01DHZE0EM082MYC14WV5YJCSBE"
+
+	// UpgradedEvent is logged by the old process when the new process is ready, i.e., the old process is draining
+	//
+	//	type Data struct {
+	//		PID        int  `json:"pid"`
+	//		// how long it took for the new process to be ready
+	//		Duration   uint `json:"duration"`
+	//		DrainDelay uint `json:"drain_delay"`
+	//	}
+	UpgradedEvent = "01DHZE0ER9DJ42E1ENEJWTAFJN"
+
+	// UpgradeFailedEvent is logged by the old process when the upgrade fails, i.e., the old process keeps running
+	//
+	//	type Data struct {
+	//		Err string `json:"e"`
+	//	}
+	UpgradeFailedEvent = "01DHZE0EWJS6EB9BA8S0W69SFW"
+)
+
+type upgradeStarting struct {
+	exe       string
+	listeners []string
+}
+
+func (e upgradeStarting) MarshalZerologObject(event *zerolog.Event) {
+	event.
+		Str("exe", e.exe).
+		Strs("listeners", e.listeners)
+}
+
+type upgraded struct {
+	pid        int
+	duration   time.Duration
+	drainDelay time.Duration
+}
+
+func (e upgraded) MarshalZerologObject(event *zerolog.Event) {
+	event.
+		Int("pid", e.pid).
+		Dur("duration", e.duration).
+		Dur("drain_delay", e.drainDelay)
+}
+
+type upgradeFailed struct {
+	error
+}
+
+func (e upgradeFailed) MarshalZerologObject(event *zerolog.Event) {
+	event.Err(e.error)
+}
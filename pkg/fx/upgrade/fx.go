@@ -0,0 +1,73 @@
+/*
+ * Copyright (c) 2019 OysterPack, Inc.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ * http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package upgrade
+
+import (
+	"context"
+	"github.com/rs/zerolog"
+	"go.uber.org/fx"
+	"os"
+	"os/signal"
+)
+
+// Module provides the fx Module for the upgrade module, which provides the following:
+//   - Trigger
+//   - Draining
+//   - NotifyReady
+//
+// The *zerolog.Logger and fx.Shutdowner must be provided by the app.
+//
+// NOTE: the new process must call NotifyReady when it is ready, e.g., fxapp calls it when the app is ready.
+func Module(opts Opts) fx.Option {
+	opts = opts.withDefaults()
+	return fx.Options(
+		fx.Provide(func(lc fx.Lifecycle, shutdowner fx.Shutdowner, logger *zerolog.Logger) (Trigger, Draining, NotifyReady) {
+			u := newUpgrader(opts, logger, func() error { return shutdowner.Shutdown() })
+			signals := make(chan os.Signal, 1)
+			stop := make(chan struct{})
+			lc.Append(fx.Hook{
+				OnStart: func(context.Context) error {
+					if len(opts.Signals) == 0 {
+						return nil
+					}
+					signal.Notify(signals, opts.Signals...)
+					go func() {
+						for {
+							select {
+							case <-stop:
+								return
+							case <-signals:
+								// the error is logged
+								u.upgrade()
+							}
+						}
+					}()
+					return nil
+				},
+				OnStop: func(context.Context) error {
+					signal.Stop(signals)
+					close(stop)
+					u.stop()
+					return nil
+				},
+			})
+			return u.upgrade, u.isDraining, newNotifyReady()
+		}),
+		// the signal handler is registered when the Trigger is constructed
+		fx.Invoke(func(Trigger) {}),
+	)
+}
@@ -0,0 +1,53 @@
+/*
+ * Copyright (c) 2019 OysterPack, Inc.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ * http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package upgrade
+
+import (
+	"os"
+	"time"
+)
+
+// Opts is used to configure the module
+type Opts struct {
+	// Signals are used to trigger upgrades, e.g., syscall.SIGUSR2 - if not specified, then upgrades can only be triggered
+	// via `Trigger`
+	Signals []os.Signal
+	// ReadyTimeout is how long to wait for the new process to be ready - defaults to 1 min
+	ReadyTimeout time.Duration
+	// DrainDelay is how long the old process reports that it is not ready before it is shutdown, i.e., to give load
+	// balancers time to stop routing requests to the old process - defaults to 5 secs
+	DrainDelay time.Duration
+}
+
+// DefaultOpts returns the default module options
+func DefaultOpts() Opts {
+	return Opts{
+		ReadyTimeout: time.Minute,
+		DrainDelay:   5 * time.Second,
+	}
+}
+
+func (opts Opts) withDefaults() Opts {
+	defaults := DefaultOpts()
+	if opts.ReadyTimeout <= 0 {
+		opts.ReadyTimeout = defaults.ReadyTimeout
+	}
+	if opts.DrainDelay < 0 {
+		opts.DrainDelay = defaults.DrainDelay
+	}
+	return opts
+}
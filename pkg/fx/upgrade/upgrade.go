@@ -0,0 +1,225 @@
+/*
+ * Copyright (c) 2019 OysterPack, Inc.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ * http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package upgrade
+
+import (
+	"errors"
+	"fmt"
+	"github.com/oysterpack/andiamo/pkg/eventlog"
+	"github.com/oysterpack/andiamo/pkg/listener"
+	"github.com/rs/zerolog"
+	"os"
+	"os/exec"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// ReadyFDEnvVar is set for the new process. The value is the file descriptor that the new process uses to notify the old
+// process that it is ready - see `NotifyReady`.
+const ReadyFDEnvVar = "APP12X_UPGRADE_READY_FD"
+
+// upgrade errors
+var (
+	ErrUpgradeInProgress = errors.New("upgrade is already in progress")
+	ErrDraining          = errors.New("app has already been upgraded, i.e., it is draining")
+	ErrNotReady          = errors.New("new process exited before it was ready")
+	ErrReadyTimeout      = errors.New("timed out waiting for the new process to be ready")
+)
+
+// Trigger starts an upgrade, and blocks until the new process is ready or the upgrade fails.
+type Trigger func() error
+
+// Draining returns true after the new process is ready, i.e., the old process is draining and will be shutdown after the
+// drain delay. It is used to report that the old process is not ready.
+type Draining func() bool
+
+// NotifyReady is used by the new process to notify the old process that it is ready. If the process was not started by
+// an upgrade, then it is a noop. Only the first call sends the notification.
+type NotifyReady func() error
+
+type upgrader struct {
+	opts     Opts
+	shutdown func() error
+
+	logStarting eventlog.Logger
+	logUpgraded eventlog.Logger
+	logFailed   eventlog.Logger
+
+	// the command that is used to start the new process - defaults to the app binary with the same args
+	exe  string
+	args []string
+
+	mutex      sync.Mutex
+	upgrading  bool
+	draining   bool
+	drainTimer *time.Timer
+}
+
+func newUpgrader(opts Opts, logger *zerolog.Logger, shutdown func() error) *upgrader {
+	return &upgrader{
+		opts:        opts,
+		shutdown:    shutdown,
+		logStarting: eventlog.NewLogger(UpgradeStartingEvent, logger, zerolog.InfoLevel),
+		logUpgraded: eventlog.NewLogger(UpgradedEvent, logger, zerolog.InfoLevel),
+		logFailed:   eventlog.NewLogger(UpgradeFailedEvent, logger, zerolog.ErrorLevel),
+		args:        os.Args[1:],
+	}
+}
+
+func (u *upgrader) isDraining() bool {
+	u.mutex.Lock()
+	defer u.mutex.Unlock()
+	return u.draining
+}
+
+func (u *upgrader) upgrade() error {
+	u.mutex.Lock()
+	switch {
+	case u.draining:
+		u.mutex.Unlock()
+		return ErrDraining
+	case u.upgrading:
+		u.mutex.Unlock()
+		return ErrUpgradeInProgress
+	}
+	u.upgrading = true
+	u.mutex.Unlock()
+	defer func() {
+		u.mutex.Lock()
+		defer u.mutex.Unlock()
+		u.upgrading = false
+	}()
+
+	if err := u.startNewProcess(); err != nil {
+		u.logFailed(upgradeFailed{err}, "upgrade failed")
+		return err
+	}
+	return nil
+}
+
+// stop cancels the pending shutdown, i.e., when the app is stopped before the drain delay expires
+func (u *upgrader) stop() {
+	u.mutex.Lock()
+	defer u.mutex.Unlock()
+	if u.drainTimer != nil {
+		u.drainTimer.Stop()
+	}
+}
+
+func (u *upgrader) startNewProcess() error {
+	exe := u.exe
+	if exe == "" {
+		var err error
+		if exe, err = os.Executable(); err != nil {
+			return err
+		}
+	}
+	files, listenersEnv, err := listener.Export()
+	if err != nil {
+		return err
+	}
+	defer func() {
+		for _, f := range files {
+			f.Close()
+		}
+	}()
+	readyReader, readyWriter, err := os.Pipe()
+	if err != nil {
+		return err
+	}
+	defer readyReader.Close()
+
+	listeners := strings.Split(strings.TrimPrefix(listenersEnv, listener.InheritedListenersEnvVar+"="), ",")
+	u.logStarting(upgradeStarting{exe, listeners}, "upgrade starting")
+
+	cmd := exec.Command(exe, u.args...)
+	cmd.Stdin, cmd.Stdout, cmd.Stderr = os.Stdin, os.Stdout, os.Stderr
+	// the extra files start at file descriptor 3, i.e., the ready pipe follows the listeners
+	cmd.ExtraFiles = append(append([]*os.File(nil), files...), readyWriter)
+	cmd.Env = append(environ(), listenersEnv, fmt.Sprintf("%s=%d", ReadyFDEnvVar, 3+len(files)))
+	start := time.Now()
+	err = cmd.Start()
+	readyWriter.Close()
+	if err != nil {
+		return err
+	}
+	// reap the new process if it exits while the old process is still running
+	go cmd.Wait()
+
+	ready := make(chan error, 1)
+	go func() {
+		_, err := readyReader.Read(make([]byte, 1))
+		ready <- err
+	}()
+	select {
+	case err := <-ready:
+		if err != nil {
+			cmd.Process.Kill()
+			return fmt.Errorf("%s : %v", ErrNotReady, err)
+		}
+	case <-time.After(u.opts.ReadyTimeout):
+		cmd.Process.Kill()
+		return ErrReadyTimeout
+	}
+
+	u.mutex.Lock()
+	defer u.mutex.Unlock()
+	u.draining = true
+	u.logUpgraded(upgraded{cmd.Process.Pid, time.Since(start), u.opts.DrainDelay}, "upgraded - draining")
+	u.drainTimer = time.AfterFunc(u.opts.DrainDelay, func() {
+		if err := u.shutdown(); err != nil {
+			u.logFailed(upgradeFailed{err}, "failed to shutdown after upgrade")
+		}
+	})
+	return nil
+}
+
+// environ returns the process env, excluding the env vars that were set by an upgrade
+func environ() []string {
+	env := os.Environ()
+	result := make([]string, 0, len(env))
+	for _, kv := range env {
+		if strings.HasPrefix(kv, listener.InheritedListenersEnvVar+"=") || strings.HasPrefix(kv, ReadyFDEnvVar+"=") {
+			continue
+		}
+		result = append(result, kv)
+	}
+	return result
+}
+
+func newNotifyReady() NotifyReady {
+	var once sync.Once
+	return func() (err error) {
+		once.Do(func() {
+			value := os.Getenv(ReadyFDEnvVar)
+			if value == "" {
+				return
+			}
+			fd, e := strconv.Atoi(value)
+			if e != nil {
+				err = fmt.Errorf("%s is invalid : %q", ReadyFDEnvVar, value)
+				return
+			}
+			f := os.NewFile(uintptr(fd), "upgrade-ready")
+			defer f.Close()
+			_, err = f.Write([]byte{1})
+		})
+		return
+	}
+}
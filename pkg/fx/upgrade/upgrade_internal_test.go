@@ -0,0 +1,116 @@
+/*
+ * Copyright (c) 2019 OysterPack, Inc.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ * http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package upgrade
+
+import (
+	"bufio"
+	"fmt"
+	"github.com/oysterpack/andiamo/pkg/listener"
+	"github.com/rs/zerolog"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"io/ioutil"
+	"net"
+	"os"
+	"testing"
+	"time"
+)
+
+// the test binary is used as the new process, i.e., it runs TestHelperProcess
+const helperProcessEnvVar = "UPGRADE_HELPER_PROCESS"
+
+func TestHelperProcess(t *testing.T) {
+	switch os.Getenv(helperProcessEnvVar) {
+	case "ready":
+	case "fail":
+		os.Exit(1)
+	default:
+		return
+	}
+	time.AfterFunc(10*time.Second, func() { os.Exit(2) })
+	l, err := listener.Listen("127.0.0.1:0")
+	if err != nil {
+		os.Exit(3)
+	}
+	if err := newNotifyReady()(); err != nil {
+		os.Exit(4)
+	}
+	conn, err := l.Accept()
+	if err != nil {
+		os.Exit(5)
+	}
+	fmt.Fprintln(conn, "new process")
+	conn.Close()
+	os.Exit(0)
+}
+
+func newTestUpgrader(opts Opts, shutdown func() error) *upgrader {
+	logger := zerolog.New(ioutil.Discard)
+	u := newUpgrader(opts.withDefaults(), &logger, shutdown)
+	u.exe = os.Args[0]
+	u.args = []string{"-test.run=^TestHelperProcess$"}
+	return u
+}
+
+func TestUpgrade(t *testing.T) {
+	t.Setenv(helperProcessEnvVar, "ready")
+	l, err := listener.Listen("127.0.0.1:0")
+	require.NoError(t, err)
+	defer l.Close()
+
+	shutdown := make(chan struct{})
+	u := newTestUpgrader(Opts{ReadyTimeout: 10 * time.Second}, func() error {
+		close(shutdown)
+		return nil
+	})
+	require.NoError(t, u.upgrade())
+	assert.True(t, u.isDraining())
+	select {
+	case <-shutdown:
+	case <-time.After(5 * time.Second):
+		t.Fatal("*** the old process should be shutdown after the drain delay")
+	}
+	assert.Equal(t, ErrDraining, u.upgrade())
+
+	// the old process is not accepting connections, i.e., the connection is accepted by the new process
+	conn, err := net.Dial("tcp", l.Addr().String())
+	require.NoError(t, err)
+	defer conn.Close()
+	conn.SetReadDeadline(time.Now().Add(5 * time.Second))
+	line, err := bufio.NewReader(conn).ReadString('\n')
+	require.NoError(t, err)
+	assert.Equal(t, "new process\n", line)
+}
+
+func TestUpgrade_NewProcessFailed(t *testing.T) {
+	t.Setenv(helperProcessEnvVar, "fail")
+
+	u := newTestUpgrader(Opts{ReadyTimeout: 10 * time.Second}, func() error {
+		t.Error("*** the old process should not be shutdown")
+		return nil
+	})
+	err := u.upgrade()
+	if assert.Error(t, err) {
+		assert.Contains(t, err.Error(), ErrNotReady.Error())
+	}
+	assert.False(t, u.isDraining())
+}
+
+func TestNotifyReady_NotUpgraded(t *testing.T) {
+	t.Setenv(ReadyFDEnvVar, "")
+	assert.NoError(t, newNotifyReady()())
+}
@@ -0,0 +1,275 @@
+/*
+ * Copyright (c) 2019 OysterPack, Inc.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ * http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package fxapp
+
+import (
+	"bytes"
+	"fmt"
+	"github.com/oklog/ulid"
+	"github.com/oysterpack/andiamo/pkg/appdesc"
+	"github.com/oysterpack/andiamo/pkg/fx/health"
+	"github.com/prometheus/client_golang/prometheus"
+	"go.uber.org/fx"
+	"html/template"
+	"net/http"
+	"sort"
+	"strings"
+	"time"
+)
+
+// AdminUIEndpoint is used to construct the HTTP endpoint that serves the embedded admin UI, which is a single page that
+// is designed for on-call debugging of a single app instance. The page shows:
+//   - app info, i.e., the app descriptor, instance ID, and registered components
+//   - the app dependency graph, i.e., the registered constructors and the types that they provide
+//   - the health check table, which is refreshed every 5 seconds via the health check results endpoint
+//   - the metrics summary, i.e., the registered metrics and the number of series per metric
+//   - recent log events, which are fed by the event stream endpoint - see `EventStreamEndpoint`
+//
+// The page is rendered server side. The only assets are the inlined styles and script, i.e., no external resources are
+// loaded, which enables the page to be used in restricted environments.
+const AdminUIEndpoint = "01DHY4T34062G92VNN721SFCRC"
+
+// HTMLMediaType is the HTML media type
+const HTMLMediaType = "text/html"
+
+type adminUIParams struct {
+	fx.In
+
+	Desc             appdesc.Desc
+	InstanceID       InstanceID
+	Components       RegisteredComponents
+	DotGraph         fx.DotGraph
+	RegisteredChecks health.RegisteredChecks
+	CheckResults     health.CheckResults
+	Gatherer         prometheus.Gatherer
+}
+
+type adminUIPage struct {
+	Desc       appdesc.Desc
+	InstanceID string
+	Time       time.Time
+	Components []Component
+
+	Constructors []*Constructor
+	DotGraph     string
+
+	HealthChecks []adminUIHealthCheck
+
+	Metrics       []adminUIMetric
+	MetricsSeries int
+	MetricsErr    string
+
+	HealthCheckResultsURL string
+	EventStreamURL        string
+}
+
+type adminUIHealthCheck struct {
+	ID          string
+	Description string
+	Status      string
+	Time        string
+	Duration    string
+	Err         string
+}
+
+type adminUIMetric struct {
+	Name   string
+	Type   string
+	Help   string
+	Series int
+}
+
+func adminUIHTTPHandler(params adminUIParams) HTTPHandler {
+	return NewHTTPRoute(http.MethodGet, fmt.Sprintf("/%s", AdminUIEndpoint), func(writer http.ResponseWriter, request *http.Request) {
+		page := adminUIPage{
+			Desc:       params.Desc,
+			InstanceID: ulid.ULID(params.InstanceID).String(),
+			Time:       time.Now().UTC(),
+			Components: params.Components(),
+
+			Constructors: NewDependencies(params.DotGraph).Constructors,
+			DotGraph:     string(params.DotGraph),
+
+			HealthChecks: adminUIHealthChecks(<-params.RegisteredChecks(health.Query{}), <-params.CheckResults(nil, health.Query{})),
+
+			HealthCheckResultsURL: fmt.Sprintf("/%s", HealthCheckResultsEndpoint),
+			EventStreamURL:        fmt.Sprintf("/%s?typed=false", EventStreamEndpoint),
+		}
+		mfs, err := params.Gatherer.Gather()
+		if err != nil {
+			page.MetricsErr = err.Error()
+		}
+		for _, mf := range mfs {
+			page.Metrics = append(page.Metrics, adminUIMetric{
+				Name:   mf.GetName(),
+				Type:   strings.ToLower(mf.GetType().String()),
+				Help:   mf.GetHelp(),
+				Series: len(mf.GetMetric()),
+			})
+			page.MetricsSeries += len(mf.GetMetric())
+		}
+
+		body := new(bytes.Buffer)
+		if err := adminUITemplate.Execute(body, page); err != nil {
+			http.Error(writer, err.Error(), http.StatusInternalServerError)
+			return
+		}
+		writer.Header().Set("Content-Type", HTMLMediaType+"; charset=utf-8")
+		writer.Write(body.Bytes())
+	}).WithDoc(OpenAPIOperation{
+		Summary:   "admin UI",
+		Tags:      []string{BuiltinOpenAPITag},
+		Responses: []OpenAPIResponse{{Status: http.StatusOK, MediaTypes: []string{HTMLMediaType}}},
+	}).AdminOnly()
+}
+
+// the health checks are sorted by ID. Health checks that have not yet been run have no result.
+func adminUIHealthChecks(checks []health.RegisteredCheck, results []health.Result) []adminUIHealthCheck {
+	resultsByID := make(map[string]health.Result, len(results))
+	for _, result := range results {
+		resultsByID[result.ID] = result
+	}
+	healthChecks := make([]adminUIHealthCheck, 0, len(checks))
+	for _, check := range checks {
+		healthCheck := adminUIHealthCheck{
+			ID:          check.ID,
+			Description: check.Description,
+		}
+		if result, ok := resultsByID[check.ID]; ok {
+			healthCheck.Status = result.Status.String()
+			healthCheck.Time = result.Time.UTC().Format(time.RFC3339)
+			healthCheck.Duration = result.Duration.String()
+			if result.Err != nil {
+				healthCheck.Err = result.Err.Error()
+			}
+		}
+		healthChecks = append(healthChecks, healthCheck)
+	}
+	sort.Slice(healthChecks, func(i, j int) bool { return healthChecks[i].ID < healthChecks[j].ID })
+	return healthChecks
+}
+
+var adminUITemplate = template.Must(template.New("admin").Funcs(template.FuncMap{
+	"lower": strings.ToLower,
+}).Parse(`<!DOCTYPE html>
+<html lang="en">
+<head>
+<meta charset="utf-8">
+<title>{{with .Desc.Name}}{{.}}{{else}}{{.Desc.ID}}{{end}} - {{.InstanceID}}</title>
+<style>
+body { font-family: sans-serif; font-size: 14px; margin: 1em 2em; }
+h2 { border-bottom: 1px solid #ccc; }
+table { border-collapse: collapse; width: 100%; }
+th, td { text-align: left; padding: 2px 8px; border-bottom: 1px solid #eee; vertical-align: top; }
+td.mono, pre { font-family: monospace; }
+pre { background: #f6f6f6; padding: 1em; overflow: auto; max-height: 30em; }
+tr.green .status { color: #080; }
+tr.yellow .status { color: #b80; }
+tr.red .status { color: #c00; font-weight: bold; }
+tr.warn td { color: #b80; }
+tr.error td, tr.fatal td, tr.panic td { color: #c00; }
+</style>
+</head>
+<body>
+<h1>{{with .Desc.Name}}{{.}}{{else}}{{.Desc.ID}}{{end}}</h1>
+<p>Rendered at {{.Time.Format "2006-01-02T15:04:05Z07:00"}}</p>
+
+<h2 id="app">App</h2>
+<table>
+<tr><th>ID</th><td class="mono">{{.Desc.ID}}</td></tr>
+<tr><th>Release ID</th><td class="mono">{{.Desc.ReleaseID}}</td></tr>
+<tr><th>Instance ID</th><td class="mono">{{.InstanceID}}</td></tr>
+{{with .Desc.Name}}<tr><th>Name</th><td>{{.}}</td></tr>{{end}}
+<tr><th>Version</th><td>{{.Desc.Version}}</td></tr>
+</table>
+{{if .Components}}
+<h3>Components</h3>
+<table>
+<tr><th>ID</th><th>Name</th><th>Version</th></tr>
+{{range .Components}}<tr><td class="mono">{{.ID}}</td><td>{{.Name}}</td><td>{{.Version}}</td></tr>
+{{end}}</table>
+{{end}}
+
+<h2 id="health">Health Checks</h2>
+<table id="health-checks">
+<tr><th>ID</th><th>Description</th><th>Status</th><th>Time</th><th>Duration</th><th>Error</th></tr>
+{{range .HealthChecks}}<tr id="h-{{.ID}}" class="{{lower .Status}}"><td class="mono">{{.ID}}</td><td>{{.Description}}</td><td class="status">{{.Status}}</td><td class="time">{{.Time}}</td><td class="duration">{{.Duration}}</td><td class="error">{{.Err}}</td></tr>
+{{else}}<tr><td colspan="6">no health checks are registered</td></tr>
+{{end}}</table>
+
+<h2 id="events">Recent Events</h2>
+<table id="recent-events">
+<tr><th>Time</th><th>Level</th><th>Event</th><th>Message</th><th>Data</th></tr>
+</table>
+
+<h2 id="metrics">Metrics</h2>
+<p>{{len .Metrics}} metrics, {{.MetricsSeries}} series</p>
+{{with .MetricsErr}}<p class="error">{{.}}</p>{{end}}
+<table>
+<tr><th>Name</th><th>Type</th><th>Series</th><th>Help</th></tr>
+{{range .Metrics}}<tr><td class="mono">{{.Name}}</td><td>{{.Type}}</td><td>{{.Series}}</td><td>{{.Help}}</td></tr>
+{{end}}</table>
+
+<h2 id="dependencies">Dependencies</h2>
+<table>
+<tr><th>Constructor</th><th>Params</th><th>Provides</th></tr>
+{{range .Constructors}}<tr><td class="mono">{{.Name}}</td><td class="mono">{{range .Params}}{{.Type}}{{if .Optional}} (optional){{end}}<br>{{end}}</td><td class="mono">{{range .Results}}{{.}}<br>{{end}}</td></tr>
+{{end}}</table>
+<details><summary>DOT graph</summary><pre>{{.DotGraph}}</pre></details>
+
+<script>
+(function() {
+  var maxEvents = 100;
+
+  function refreshHealthChecks() {
+    fetch({{.HealthCheckResultsURL}}, {headers: {"Accept": "application/json"}})
+      .then(function(response) { return response.json(); })
+      .then(function(results) {
+        results.forEach(function(result) {
+          var row = document.getElementById("h-" + result.id);
+          if (!row) { return; }
+          row.className = result.status.toLowerCase();
+          row.querySelector(".status").textContent = result.status;
+          row.querySelector(".time").textContent = result.time;
+          row.querySelector(".duration").textContent = result.duration;
+          row.querySelector(".error").textContent = result.error || "";
+        });
+      })
+      .catch(function() {});
+  }
+  setInterval(refreshHealthChecks, 5000);
+
+  var events = document.getElementById("recent-events");
+  var source = new EventSource({{.EventStreamURL}});
+  source.onmessage = function(msg) {
+    var event;
+    try { event = JSON.parse(msg.data); } catch (e) { return; }
+    var row = events.insertRow(1);
+    row.className = event.l || "";
+    [event.t, event.l, event.n, event.m, event.d ? JSON.stringify(event.d) : ""].forEach(function(value) {
+      var cell = row.insertCell();
+      cell.textContent = value || "";
+    });
+    while (events.rows.length > maxEvents + 1) {
+      events.deleteRow(events.rows.length - 1);
+    }
+  };
+})();
+</script>
+</body>
+</html>
+`))
@@ -0,0 +1,84 @@
+/*
+ * Copyright (c) 2019 OysterPack, Inc.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ * http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package fxapp_test
+
+import (
+	"context"
+	"github.com/oklog/ulid"
+	"github.com/oysterpack/andiamo/pkg/fx/health"
+	"github.com/oysterpack/andiamo/pkg/fxapp"
+	"github.com/oysterpack/andiamo/pkg/fxapptest"
+	"github.com/oysterpack/andiamo/pkg/ulids"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"io/ioutil"
+	"net/http"
+	"testing"
+)
+
+func TestAdminUIEndpoint(t *testing.T) {
+	t.Parallel()
+
+	const CheckID = "01DHY4T389WBWYJYS3Z483WEKB"
+	appID := ulids.MustNew()
+	builder := fxapp.NewBuilder(fxapp.ID(appID), fxapp.ReleaseID(ulids.MustNew())).
+		RegisterComponents(fxapp.Component{
+			ID:      "01DHY4T3CJQY1PHHYCMGVWBR25",
+			Name:    "admin-ui-test",
+			Version: "1.0.0",
+			Invoke:  []interface{}{func() {}},
+		}).
+		Invoke(func(register health.Register) error {
+			return register(health.Check{ID: CheckID, Description: "admin UI test check", RedImpact: "none"}, health.CheckerOpts{}, func(ctx context.Context) (health.Status, error) {
+				return health.Green, nil
+			})
+		}).
+		LogWriter(ioutil.Discard)
+
+	fxapptest.RunApp(t, builder, func(app fxapp.App, client *fxapptest.HTTPClient) {
+		response, err := client.Get(fxapp.AdminUIEndpoint)
+		require.NoError(t, err)
+		defer response.Body.Close()
+		require.Equal(t, http.StatusOK, response.StatusCode)
+		assert.Equal(t, "text/html; charset=utf-8", response.Header.Get("Content-Type"))
+		body, err := ioutil.ReadAll(response.Body)
+		require.NoError(t, err)
+		page := string(body)
+
+		// app info
+		assert.Contains(t, page, appID.String())
+		assert.Contains(t, page, ulid.ULID(app.InstanceID()).String())
+		assert.Contains(t, page, "admin-ui-test")
+		// health checks
+		assert.Contains(t, page, `id="h-`+CheckID+`" class="green"`)
+		assert.Contains(t, page, "admin UI test check")
+		// metrics
+		assert.Contains(t, page, "go_goroutines")
+		// dependencies
+		assert.Contains(t, page, "*zerolog.Logger")
+		// the page is fed by the health check results and event stream endpoints
+		assert.Contains(t, page, fxapp.HealthCheckResultsEndpoint)
+		assert.Contains(t, page, fxapp.EventStreamEndpoint+`?typed=false`)
+
+		t.Run("POST is not allowed", func(t *testing.T) {
+			response, err := client.Post(client.URL(fxapp.AdminUIEndpoint), "text/plain", nil)
+			require.NoError(t, err)
+			response.Body.Close()
+			assert.Equal(t, http.StatusMethodNotAllowed, response.StatusCode)
+		})
+	})
+}
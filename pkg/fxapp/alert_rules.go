@@ -0,0 +1,389 @@
+/*
+ * Copyright (c) 2019 OysterPack, Inc.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ * http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package fxapp
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"github.com/oysterpack/andiamo/pkg/appdesc"
+	"github.com/oysterpack/andiamo/pkg/ulids"
+	"go.uber.org/multierr"
+	"net/http"
+	"net/url"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// AlertRule defines an alert that is derived from an event ID. Because events are logged with stable ULIDs, the alert
+// configuration can be generated from code, i.e., rather than hand-maintained:
+//   - Prometheus alerting rules - only for health check rules, which are backed by the health check gauge
+//   - Loki ruler alerting rules - LogQL queries over the event log
+//   - Elasticsearch query templates - queries over the ECS documents that are indexed by the log sink
+//
+// Health check rules, i.e., where `Event` is `HealthCheckResultEvent`, alert on Red health check results. `HealthCheck`
+// is used to narrow the rule to a single health check, otherwise the rule alerts on any Red health check.
+//
+// Alert rules are registered via the app builder - see `Builder.RegisterAlertRules()`.
+type AlertRule struct {
+	// Name is the alert name, e.g., "AppStartFailed"
+	Name string
+	// Summary is used as the alert summary annotation
+	Summary string
+
+	// Event is the ID of the event that triggers the alert
+	Event string
+	// Level is optional, and is used to only match events that are logged at the specified level, e.g., "error".
+	// It is ignored by health check rules.
+	Level string
+	// Err is optional, and is used to only match events whose error message contains the error message
+	Err error
+	// HealthCheck is optional, and can only be specified by health check rules
+	HealthCheck string
+
+	// Window is the look back window over which the events are counted. Defaults to `DefaultAlertRuleWindow`.
+	Window time.Duration
+	// For is how long the condition must hold before the alert fires. If zero, then the alert fires immediately.
+	For time.Duration
+	// Severity is used as the alert severity label. Defaults to `DefaultAlertSeverity`.
+	Severity string
+
+	// RunbookURL is optional, but if specified, then it must be an absolute URL
+	RunbookURL string
+}
+
+// alert rule defaults
+const (
+	DefaultAlertRuleWindow = 5 * time.Minute
+	DefaultAlertSeverity   = "critical"
+)
+
+// alert rule registration validation errors
+var (
+	ErrAlertRuleBlankName          = errors.New("alert rule `Name` must not be blank")
+	ErrAlertRuleEventNotULID       = errors.New("alert rule `Event` must be a ULID")
+	ErrAlertRuleHealthCheckNotULID = errors.New("alert rule `HealthCheck` must be a ULID")
+	ErrAlertRuleNotHealthCheckRule = errors.New("alert rule `HealthCheck` requires `Event` to be the HealthCheckResultEvent")
+	ErrAlertRuleNegativeDuration   = errors.New("alert rule `Window` and `For` must not be negative")
+	ErrAlertRuleInvalidRunbookURL  = errors.New("alert rule `RunbookURL` must be an absolute URL")
+	ErrAlertRuleAlreadyRegistered  = errors.New("alert rule is already registered")
+)
+
+// StandardAlertRules returns alert rules for the standard app failure events, i.e., the app failed to initialize,
+// start, or stop, and health checks are Red.
+func StandardAlertRules() []AlertRule {
+	return []AlertRule{
+		{Name: "AppInitFailed", Summary: "app failed to initialize", Event: InitFailedEvent},
+		{Name: "AppStartFailed", Summary: "app failed to start", Event: StartFailedEvent},
+		{Name: "AppStopFailed", Summary: "app failed to stop cleanly", Event: StopFailedEvent, Severity: "warning"},
+		{Name: "HealthCheckRed", Summary: "health check is Red", Event: HealthCheckResultEvent, For: time.Minute},
+	}
+}
+
+func (r *AlertRule) validate() error {
+	var err error
+	if strings.TrimSpace(r.Name) == "" {
+		err = multierr.Append(err, ErrAlertRuleBlankName)
+	}
+	if _, e := ulids.Parse(r.Event); e != nil {
+		err = multierr.Append(err, ErrAlertRuleEventNotULID)
+	}
+	if r.HealthCheck != "" {
+		if _, e := ulids.Parse(r.HealthCheck); e != nil {
+			err = multierr.Append(err, ErrAlertRuleHealthCheckNotULID)
+		}
+		if !r.healthCheckRule() {
+			err = multierr.Append(err, ErrAlertRuleNotHealthCheckRule)
+		}
+	}
+	if r.Window < 0 || r.For < 0 {
+		err = multierr.Append(err, ErrAlertRuleNegativeDuration)
+	}
+	if r.RunbookURL != "" {
+		if u, e := url.Parse(r.RunbookURL); e != nil || !u.IsAbs() {
+			err = multierr.Append(err, ErrAlertRuleInvalidRunbookURL)
+		}
+	}
+	if err != nil {
+		return multierr.Append(fmt.Errorf("invalid alert rule: %s", r.Name), err)
+	}
+	return nil
+}
+
+func (r *AlertRule) healthCheckRule() bool {
+	return r.Event == HealthCheckResultEvent
+}
+
+func (r *AlertRule) window() time.Duration {
+	if r.Window == 0 {
+		return DefaultAlertRuleWindow
+	}
+	return r.Window
+}
+
+func (r *AlertRule) severity() string {
+	if r.Severity == "" {
+		return DefaultAlertSeverity
+	}
+	return r.Severity
+}
+
+// level returns the level that the matched events are logged at - Red health check results are logged as errors
+func (r *AlertRule) level() string {
+	if r.healthCheckRule() {
+		return "error"
+	}
+	return r.Level
+}
+
+// PrometheusExpr returns the PromQL expression for health check rules, which fires when the health check gauge
+// reports Red. Alerts that are not backed by a metric return a blank string.
+func (r *AlertRule) PrometheusExpr(desc appdesc.Desc) string {
+	if !r.healthCheckRule() {
+		return ""
+	}
+	selector := []string{fmt.Sprintf("%s=%q", AppIDLabel, desc.ID)}
+	if r.HealthCheck != "" {
+		selector = append(selector, fmt.Sprintf("%s=%q", HealthCheckIDLabel, r.HealthCheck))
+	}
+	return fmt.Sprintf("max by (%s, %s) (%s{%s}) == 2", AppInstanceIDLabel, HealthCheckIDLabel, HealthCheckMetricID, strings.Join(selector, ","))
+}
+
+// LogQLQuery returns the LogQL log query that selects the events that trigger the alert
+func (r *AlertRule) LogQLQuery(desc appdesc.Desc) string {
+	selector := []string{
+		fmt.Sprintf("app_id=%q", desc.ID),
+		fmt.Sprintf("event=%q", r.Event),
+	}
+	if level := r.level(); level != "" {
+		selector = append(selector, fmt.Sprintf("level=%q", level))
+	}
+	query := fmt.Sprintf("{%s}", strings.Join(selector, ","))
+	if r.Err != nil {
+		query += fmt.Sprintf(" |= %q", r.Err.Error())
+	}
+	if r.HealthCheck != "" {
+		// the json parser flattens the nested event data fields, i.e., "d.id" is extracted as "d_id"
+		query += fmt.Sprintf(" | json | d_id=%q", r.HealthCheck)
+	}
+	return query
+}
+
+// LogQLExpr returns the LogQL metric expression, which fires when any matching events are logged within the window
+func (r *AlertRule) LogQLExpr(desc appdesc.Desc) string {
+	return fmt.Sprintf("sum by (instance_id) (count_over_time(%s[%s])) > 0", r.LogQLQuery(desc), promDuration(r.window()))
+}
+
+// ElasticsearchQuery returns the Elasticsearch query DSL that selects the events that trigger the alert within the
+// window. The query is over the ECS documents that are indexed by the log sink - see `eventlog.ECSFields`.
+func (r *AlertRule) ElasticsearchQuery(desc appdesc.Desc) map[string]interface{} {
+	term := func(field, value string) map[string]interface{} {
+		return map[string]interface{}{"term": map[string]string{field: value}}
+	}
+	filters := []interface{}{
+		term("service.id", desc.ID.String()),
+		term("event.code", r.Event),
+	}
+	if level := r.level(); level != "" {
+		filters = append(filters, term("log.level", level))
+	}
+	if r.Err != nil {
+		filters = append(filters, map[string]interface{}{"match_phrase": map[string]string{"error.message": r.Err.Error()}})
+	}
+	if r.HealthCheck != "" {
+		filters = append(filters, term("andiamo.d.id", r.HealthCheck))
+	}
+	filters = append(filters, map[string]interface{}{
+		"range": map[string]interface{}{"@timestamp": map[string]string{"gte": "now-" + promDuration(r.window())}},
+	})
+	return map[string]interface{}{"bool": map[string]interface{}{"filter": filters}}
+}
+
+// PrometheusAlertRules renders the health check rules as a Prometheus alerting rules file, i.e., rules that are not
+// backed by metrics are skipped. The rules are grouped by the app name.
+func PrometheusAlertRules(desc appdesc.Desc, rules []AlertRule) []byte {
+	return alertRulesYAML(desc, rules, func(rule *AlertRule) string {
+		return rule.PrometheusExpr(desc)
+	})
+}
+
+// LokiAlertRules renders the rules as a Loki ruler alerting rules file, i.e., the rule expressions are LogQL queries.
+// The rules are grouped by the app name.
+func LokiAlertRules(desc appdesc.Desc, rules []AlertRule) []byte {
+	return alertRulesYAML(desc, rules, func(rule *AlertRule) string {
+		return rule.LogQLExpr(desc)
+	})
+}
+
+// the Prometheus and Loki ruler share the same rules file format - strings are double quoted, which makes them valid
+// YAML escaped strings
+func alertRulesYAML(desc appdesc.Desc, rules []AlertRule, expr func(rule *AlertRule) string) []byte {
+	buf := new(bytes.Buffer)
+	fmt.Fprintf(buf, "groups:\n  - name: %s\n    rules:", strconv.Quote(desc.Name))
+	var count int
+	for i := range rules {
+		rule := &rules[i]
+		ruleExpr := expr(rule)
+		if ruleExpr == "" {
+			continue
+		}
+		count++
+		fmt.Fprintf(buf, "\n      - alert: %s\n", strconv.Quote(rule.Name))
+		fmt.Fprintf(buf, "        expr: %s\n", strconv.Quote(ruleExpr))
+		if rule.For > 0 {
+			fmt.Fprintf(buf, "        for: %s\n", promDuration(rule.For))
+		}
+		labels := map[string]string{
+			"severity":   rule.severity(),
+			AppIDLabel:   desc.ID.String(),
+			AppNameLabel: desc.Name,
+			"event":      rule.Event,
+		}
+		writeYAMLMap(buf, "labels", labels)
+		annotations := map[string]string{}
+		if rule.Summary != "" {
+			annotations["summary"] = rule.Summary
+		}
+		if rule.RunbookURL != "" {
+			annotations["runbook_url"] = rule.RunbookURL
+		}
+		if len(annotations) > 0 {
+			writeYAMLMap(buf, "annotations", annotations)
+		}
+	}
+	if count == 0 {
+		buf.WriteString(" []")
+	}
+	buf.WriteString("\n")
+	return buf.Bytes()
+}
+
+func writeYAMLMap(buf *bytes.Buffer, name string, m map[string]string) {
+	keys := make([]string, 0, len(m))
+	for k := range m {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	fmt.Fprintf(buf, "        %s:\n", name)
+	for _, k := range keys {
+		fmt.Fprintf(buf, "          %s: %s\n", k, strconv.Quote(m[k]))
+	}
+}
+
+// ElasticsearchAlertQueries renders the rules as Elasticsearch query templates, e.g., to configure Watcher or Kibana
+// alerting.
+func ElasticsearchAlertQueries(desc appdesc.Desc, rules []AlertRule) ([]byte, error) {
+	type query struct {
+		Alert      string                 `json:"alert"`
+		Summary    string                 `json:"summary,omitempty"`
+		Severity   string                 `json:"severity"`
+		Window     string                 `json:"window"`
+		RunbookURL string                 `json:"runbook_url,omitempty"`
+		Query      map[string]interface{} `json:"query"`
+	}
+	queries := make([]query, 0, len(rules))
+	for i := range rules {
+		rule := &rules[i]
+		queries = append(queries, query{
+			Alert:      rule.Name,
+			Summary:    rule.Summary,
+			Severity:   rule.severity(),
+			Window:     promDuration(rule.window()),
+			RunbookURL: rule.RunbookURL,
+			Query:      rule.ElasticsearchQuery(desc),
+		})
+	}
+	return json.Marshal(queries)
+}
+
+// promDuration formats the duration using the largest unit that the duration is a multiple of, e.g., 5m
+func promDuration(d time.Duration) string {
+	switch {
+	case d%time.Hour == 0:
+		return fmt.Sprintf("%dh", d/time.Hour)
+	case d%time.Minute == 0:
+		return fmt.Sprintf("%dm", d/time.Minute)
+	case d%time.Second == 0:
+		return fmt.Sprintf("%ds", d/time.Second)
+	default:
+		return fmt.Sprintf("%dms", d/time.Millisecond)
+	}
+}
+
+// RegisteredAlertRules returns the alert rules that are registered with the app
+type RegisteredAlertRules func() []AlertRule
+
+// AlertRulesEndpoint is used to construct the alert rules HTTP endpoint, which generates the alert configuration for
+// the registered alert rules. The output format is selected via the "format" query param:
+//   - prometheus (default) - Prometheus alerting rules file (YAML)
+//   - loki - Loki ruler alerting rules file (YAML)
+//   - elasticsearch - Elasticsearch query templates (JSON)
+//
+// For example:
+//
+//	GET /01DJ9ZV0CJF8RSESQHH7AQPAEP?format=loki
+const AlertRulesEndpoint = "01DJ9ZV0CJF8RSESQHH7AQPAEP"
+
+// alert rules formats
+const (
+	PrometheusAlertRulesFormat    = "prometheus"
+	LokiAlertRulesFormat          = "loki"
+	ElasticsearchAlertRulesFormat = "elasticsearch"
+)
+
+// YAMLMediaType is the media type used to render YAML documents
+const YAMLMediaType = "application/yaml"
+
+func alertRulesHTTPHandler(desc appdesc.Desc, rules RegisteredAlertRules) HTTPHandler {
+	return NewHTTPHandler(fmt.Sprintf("/%s", AlertRulesEndpoint), func(writer http.ResponseWriter, request *http.Request) {
+		var body []byte
+		var err error
+		mediaType := YAMLMediaType
+		switch format := request.URL.Query().Get("format"); format {
+		case "", PrometheusAlertRulesFormat:
+			body = PrometheusAlertRules(desc, rules())
+		case LokiAlertRulesFormat:
+			body = LokiAlertRules(desc, rules())
+		case ElasticsearchAlertRulesFormat:
+			body, err = ElasticsearchAlertQueries(desc, rules())
+			mediaType = JSONMediaType
+		default:
+			http.Error(writer, fmt.Sprintf("unsupported format: %q - supported formats are: %s, %s, %s", format, PrometheusAlertRulesFormat, LokiAlertRulesFormat, ElasticsearchAlertRulesFormat), http.StatusBadRequest)
+			return
+		}
+		if err != nil {
+			http.Error(writer, err.Error(), http.StatusInternalServerError)
+			return
+		}
+		writer.Header().Set("Content-Type", mediaType)
+		writer.Write(body)
+	}).WithDoc(OpenAPIOperation{
+		Summary: "alert rules generated from the registered alert rules",
+		Tags:    []string{BuiltinOpenAPITag},
+		Params: []OpenAPIParam{{
+			Name:        "format",
+			Description: fmt.Sprintf("%s (default), %s, or %s", PrometheusAlertRulesFormat, LokiAlertRulesFormat, ElasticsearchAlertRulesFormat),
+		}},
+		Responses: []OpenAPIResponse{
+			{Status: http.StatusOK, MediaTypes: []string{YAMLMediaType, JSONMediaType}},
+			{Status: http.StatusBadRequest, Description: "unsupported format"},
+		},
+	}).AdminOnly()
+}
@@ -0,0 +1,181 @@
+/*
+ * Copyright (c) 2019 OysterPack, Inc.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ * http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package fxapp_test
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"github.com/oysterpack/andiamo/pkg/fxapp"
+	"github.com/oysterpack/andiamo/pkg/ulids"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"io/ioutil"
+	"net/http"
+	"testing"
+	"time"
+)
+
+func TestBuilder_RegisterAlertRules(t *testing.T) {
+	t.Parallel()
+
+	t.Run("valid alert rules", func(t *testing.T) {
+		var rules fxapp.RegisteredAlertRules
+		_, err := fxapp.NewBuilder(fxapp.ID(ulids.MustNew()), fxapp.ReleaseID(ulids.MustNew())).
+			RegisterAlertRules(fxapp.StandardAlertRules()...).
+			Invoke(func() {}).
+			Populate(&rules).
+			DisableHTTPServer().
+			Build()
+		require.NoError(t, err)
+		assert.Len(t, rules(), len(fxapp.StandardAlertRules()))
+	})
+
+	t.Run("invalid alert rule", func(t *testing.T) {
+		_, err := fxapp.NewBuilder(fxapp.ID(ulids.MustNew()), fxapp.ReleaseID(ulids.MustNew())).
+			RegisterAlertRules(fxapp.AlertRule{Event: fxapp.StartFailedEvent, HealthCheck: "invalid", For: -time.Second, RunbookURL: "runbooks/start"}).
+			Invoke(func() {}).
+			DisableHTTPServer().
+			Build()
+		require.Error(t, err)
+		t.Log(err)
+		assert.Contains(t, err.Error(), fxapp.ErrAlertRuleBlankName.Error())
+		assert.Contains(t, err.Error(), fxapp.ErrAlertRuleHealthCheckNotULID.Error())
+		assert.Contains(t, err.Error(), fxapp.ErrAlertRuleNotHealthCheckRule.Error())
+		assert.Contains(t, err.Error(), fxapp.ErrAlertRuleNegativeDuration.Error())
+		assert.Contains(t, err.Error(), fxapp.ErrAlertRuleInvalidRunbookURL.Error())
+	})
+
+	t.Run("alert rule is registered twice", func(t *testing.T) {
+		_, err := fxapp.NewBuilder(fxapp.ID(ulids.MustNew()), fxapp.ReleaseID(ulids.MustNew())).
+			RegisterAlertRules(fxapp.StandardAlertRules()...).
+			RegisterAlertRules(fxapp.StandardAlertRules()[0]).
+			Invoke(func() {}).
+			DisableHTTPServer().
+			Build()
+		require.Error(t, err)
+		assert.Contains(t, err.Error(), fxapp.ErrAlertRuleAlreadyRegistered.Error())
+	})
+}
+
+func TestAlertRule(t *testing.T) {
+	t.Parallel()
+
+	app, err := fxapp.NewBuilder(fxapp.ID(ulids.MustNew()), fxapp.ReleaseID(ulids.MustNew())).
+		Invoke(func() {}).
+		DisableHTTPServer().
+		Build()
+	require.NoError(t, err)
+	desc := app.Desc()
+
+	t.Run("event rule", func(t *testing.T) {
+		rule := fxapp.AlertRule{Name: "AppStartFailed", Event: fxapp.StartFailedEvent, Level: "error", Err: errors.New("BOOM")}
+		assert.Empty(t, rule.PrometheusExpr(desc))
+		assert.Equal(t,
+			fmt.Sprintf(`sum by (instance_id) (count_over_time({app_id="%s",event="%s",level="error"} |= "BOOM"[5m])) > 0`, desc.ID, fxapp.StartFailedEvent),
+			rule.LogQLExpr(desc),
+		)
+	})
+
+	t.Run("health check rule", func(t *testing.T) {
+		check := ulids.MustNew().String()
+		rule := fxapp.AlertRule{Name: "FooRed", Event: fxapp.HealthCheckResultEvent, HealthCheck: check, Window: time.Minute}
+		assert.Equal(t,
+			fmt.Sprintf(`max by (i, h) (%s{a="%s",h="%s"}) == 2`, fxapp.HealthCheckMetricID, desc.ID, check),
+			rule.PrometheusExpr(desc),
+		)
+		assert.Equal(t,
+			fmt.Sprintf(`sum by (instance_id) (count_over_time({app_id="%s",event="%s",level="error"} | json | d_id="%s"[1m])) > 0`, desc.ID, fxapp.HealthCheckResultEvent, check),
+			rule.LogQLExpr(desc),
+		)
+	})
+
+	t.Run("prometheus rules only include the health check rules", func(t *testing.T) {
+		rules := string(fxapp.PrometheusAlertRules(desc, fxapp.StandardAlertRules()))
+		t.Log(rules)
+		assert.Contains(t, rules, `alert: "HealthCheckRed"`)
+		assert.Contains(t, rules, "for: 1m")
+		assert.NotContains(t, rules, "AppStartFailed")
+	})
+
+	t.Run("no prometheus rules", func(t *testing.T) {
+		rules := string(fxapp.PrometheusAlertRules(desc, fxapp.StandardAlertRules()[:1]))
+		assert.Contains(t, rules, "rules: []")
+	})
+}
+
+func TestAlertRulesHTTPEndpoint(t *testing.T) {
+	app, err := fxapp.NewBuilder(fxapp.ID(ulids.MustNew()), fxapp.ReleaseID(ulids.MustNew())).
+		RegisterAlertRules(fxapp.StandardAlertRules()...).
+		Invoke(func() {}).
+		AllowUnauthenticatedAdmin().
+		Build()
+	require.NoError(t, err)
+
+	go app.Run()
+	<-app.Ready()
+	defer func() {
+		app.Shutdown()
+		<-app.Done()
+	}()
+
+	get := func(format string) (string, string) {
+		var body []byte
+		var mediaType string
+		checkHTTPGetResponse(t, fmt.Sprintf("http://:8008/%s?format=%s", fxapp.AlertRulesEndpoint, format), func(response *http.Response) {
+			defer response.Body.Close()
+			require.Equal(t, http.StatusOK, response.StatusCode)
+			mediaType = response.Header.Get("Content-Type")
+			body, err = ioutil.ReadAll(response.Body)
+			require.NoError(t, err)
+		})
+		return mediaType, string(body)
+	}
+
+	t.Run("prometheus", func(t *testing.T) {
+		mediaType, rules := get("")
+		assert.Equal(t, fxapp.YAMLMediaType, mediaType)
+		assert.Contains(t, rules, fxapp.HealthCheckMetricID)
+	})
+
+	t.Run("loki", func(t *testing.T) {
+		mediaType, rules := get(fxapp.LokiAlertRulesFormat)
+		assert.Equal(t, fxapp.YAMLMediaType, mediaType)
+		for _, rule := range fxapp.StandardAlertRules() {
+			assert.Contains(t, rules, fmt.Sprintf("alert: %q", rule.Name))
+		}
+	})
+
+	t.Run("elasticsearch", func(t *testing.T) {
+		mediaType, body := get(fxapp.ElasticsearchAlertRulesFormat)
+		assert.Equal(t, fxapp.JSONMediaType, mediaType)
+		var queries []struct {
+			Alert  string                 `json:"alert"`
+			Window string                 `json:"window"`
+			Query  map[string]interface{} `json:"query"`
+		}
+		require.NoError(t, json.Unmarshal([]byte(body), &queries))
+		require.Len(t, queries, len(fxapp.StandardAlertRules()))
+		assert.Equal(t, "AppInitFailed", queries[0].Alert)
+		assert.Equal(t, "5m", queries[0].Window)
+		assert.Contains(t, queries[0].Query, "bool")
+	})
+
+	t.Run("unsupported format", func(t *testing.T) {
+		checkHTTPGetResponseStatus(t, fmt.Sprintf("http://:8008/%s?format=json", fxapp.AlertRulesEndpoint), http.StatusBadRequest)
+	})
+}
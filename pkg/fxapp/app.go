@@ -22,9 +22,12 @@ import (
 	"errors"
 	"fmt"
 	"github.com/oklog/ulid"
+	"github.com/oysterpack/andiamo/pkg/appdesc"
+	"github.com/oysterpack/andiamo/pkg/clock"
 	"github.com/oysterpack/andiamo/pkg/eventlog"
 	"github.com/rs/zerolog"
 	"go.uber.org/fx"
+	"io"
 	"os"
 	"reflect"
 	"time"
@@ -78,6 +81,33 @@ import (
 // to document and understand application logs. All events are assigned a unique identifier - it is recommended to use
 // a XID as the event name.
 //
+// Zerolog hooks can be registered with the application logger, e.g., for per-event counters, trace ID injection, or
+// external forwarding, without replacing the log writer - see `Builder.LogHooks()` and `Builder.LogEventHooks()`. The hooks
+// are scoped to the app, and can also be added at runtime via the provided *eventlog.Hooks.
+//
+// Application Components
+//
+// Related application functionality can be packaged as a `Component`. The component descriptor documents what the
+// component provides to the app - functions, events, errors, health checks, and metrics. Components are registered via
+// the app builder. A `ComponentRegisteredEvent` is logged for each registered component and the registered components
+// are exposed via HTTP.
+//
+// The prometheus.Registerer that is injected into the component's functions is wrapped with the component ID and version
+// labels, i.e., all metrics registered by the component are attributable to the component. This also applies to
+// parameter objects, i.e., structs that embed fx.In.
+//
+// Likewise, the *zerolog.Logger that is injected into the component's functions is scoped to the component, i.e., log
+// events are annotated with the component ID ('c') and name ('cn') fields.
+//
+// Health checks are declared as part of the component descriptor. The component health checks are registered with the
+// health module when the app is initialized, and are unregistered when the app is stopped.
+//
+// Related events, errors, metrics, and health checks can be cross-referenced and linked to a runbook via `XRef`. XRefs
+// are registered via the app builder and are exposed via HTTP, where they can be looked up by the IDs that are present
+// in the logs and metrics, e.g., the event ID. Errors are mapped to the xrefs that reference them via
+// `RegisteredXRefs.Classify()` - use `WrapErr()` to add context to an error while preserving it for matching. Likewise,
+// alerting configuration is derived from the event IDs via `AlertRule` - see `StandardAlertRules()`.
+//
 // Prometheus Metrics
 //
 // The following are automatically provided for the app:
@@ -89,9 +119,21 @@ import (
 // 	- Endpoint = /01DF9JKZ73Y3V1AJN89B58D9HY
 //  - Timeout = 5 secs
 //  - ErrorHandling = promhttp.HTTPErrorOnError (HTTP status code 500 is returned upon the first error encountered)
+//  - MaxRequestsInFlight = 3 (concurrent scrapes beyond the limit are responded to with 503)
+//  - responses are gzip compressed when the scrape request accepts gzip encoding
+// Additional metrics endpoints that expose filtered views of the metrics can be configured via
+// `PrometheusHTTPHandlerOpts.Views`, e.g., to exclude the Go and process collector metrics - see `ExcludeMetricPrefixes()`.
 // If a `PrometheusHTTPHandlerOpts` is provided, then it will be used instead. However, if the provided endpoint is blank,
 // then it will be set to '/metrics' and if timeout is zero, then it will be set to 5 secs.
 //
+// The provided prometheus.Registerer enforces metric naming conventions at registration time, i.e., metrics that violate
+// the conventions fail to register - see `NewLintingRegisterer()`. The lint rules can be configured by providing a
+// `*MetricLintOpts`. By default, `DefaultMetricLintOpts()` is used.
+//
+// The app HTTP server records the request rate, errors, and duration per route - see `HTTPRequestsMetricID` and
+// `HTTPRequestDurationMetricID`. A Grafana dashboard for the standard app metrics can be generated via
+// `GrafanaDashboard()`.
+//
 // TODO: Metrics are logged on a scheduled basis. By default, every minute - but is configurable.
 //
 // Health Checks
@@ -104,8 +146,22 @@ import (
 //    - health check gauges have the following labels:
 //		- "h" - health check ID
 //		- "d" - health check descriptor ID
+//  - the health check run queue is instrumented with metrics (see `HealthCheckQueuedMetricID`, `HealthCheckRunningMetricID`,
+//    `HealthCheckDispatchedMetricID`, `HealthCheckQueueWaitMetricID`)
+//  - checker goroutines that do not honor context cancellation are tracked via `HealthCheckOrphanedMetricID`
+//  - checker panics are recovered and reported as Red results, and are counted via `HealthCheckPanicsMetricID`
+//  - resource pressure health checks (filesystem, memory, and file descriptor usage) can be enabled via
+//    `Builder.EnableResourceHealthChecks()`
+//  - error rate health checks, which track prometheus error counters over sliding windows, can be enabled via
+//    `Builder.EnableErrorRateHealthChecks()`
+//  - SLO health checks, which track availability and latency objectives via error budget burn rates, can be enabled via
+//    `Builder.EnableSLOs()`
+//  - a clock skew health check, which compares the local clock against an NTP server or the k8s node time annotation, can
+//    be enabled via `Builder.EnableClockSkewHealthCheck()`
 // 	- health checks are registered with the app readiness probe. The app is not ready until all health checks are pass green.
 //    If any health checks fail, i.e., not green, then the app will fail to start up.
+//  - health checks that are tagged with `ReadinessHealthCheckTag` gate the readiness probe instead of the liveness probe,
+//    i.e., the app is taken out of rotation while they are Red instead of being restarted
 //  - TODO: health check GRPC API
 //
 // Readiness Probe
@@ -120,6 +176,17 @@ import (
 //    - if the app is ready, then HTTP 200 is returned
 //    - if the app is not ready, then HTTP 503 is returned with response returns header `x-readiness-wait-group-count` set
 //      to the number of components that the app is waiting on
+//  - the app is not ready until its required dependencies have been verified - see `Builder.RequireDependencies()`
+//  - readiness health checks that have not yet run or are Red are reported via the `x-readiness-health-checks-pending`
+//    and `x-readiness-health-checks-red` response headers - see `ReadinessHealthCheckTag`
+//  - the readiness probe status is exposed as a gauge - see `AppReadyMetricID`
+//
+// Warm-Up
+//
+// After the app is started, the registered warm-up tasks are run before the app readiness opens, e.g., to prime caches or
+// pre-establish connections - see `WarmUp`. Warm-up tasks run concurrently with a separate timeout, and report progress
+// via `WarmUpEvent` and `WarmUpCompletedEvent`. Warm-up is best effort, i.e., task failures are logged but do not fail
+// the app. The warm-up can be skipped via `Builder.SkipWarmUp()` or the `WarmUpSkipEnvVar` env var.
 //
 // Liveliness Probe
 //
@@ -134,24 +201,130 @@ import (
 // HTTP server support
 //
 // Any HTTPHandler(s) that are discovered, i.e., have been provided, will be registered with the app's HTTP server.
+// HTTP handlers are discovered via the "HTTPHandler" and "HTTPHandlers" fx value groups. Each HTTPEndpoint specifies its
+// route, i.e., method and path, and the middleware that wraps the handler - see `NewHTTPRoute()`. Routes are validated
+// when the app is built, i.e., conflicting routes will cause the app build to fail. The route table is logged via the
+// `HTTPRoutesEvent` when the HTTP server is starting.
+//
 // HTTP server settings can be provided via an *http.Server (NOTE: http.Server.Handler will be overwritten using
 // http handlers that are provided by the app). If no *http.Server is discovered, then the app will automatically
 // create an HTTP server with the following settings:
 // 	- Addr:              ":8008",
 //	- ReadHeaderTimeout: time.Second,
 //	- MaxHeaderBytes:    1024,
+//	- ReadTimeout:       30 * time.Second,
+//	- IdleTimeout:       2 * time.Minute,
+//
+// The HTTP server timeouts and max request body size can be configured via `Builder.SetHTTPServerLimits()`. The max
+// request body size can also be set per route via `HTTPHandler.WithMaxBodyBytes()`. Limit violations are logged via the
+// `HTTPLimitViolationEvent` and counted via the `HTTPLimitViolationsMetricID` counter.
+//
+// The HTTP server address can be configured via `Builder.SetHTTPServerAddr()` or the APP12X_HTTP_SERVER_ADDR env var,
+// which take precedence over the provided *http.Server Addr. Use ":0" to listen on a random free port - the bound address
+// is provided via `HTTPServerAddr` and is logged with the `StartedEvent`. The HTTP server can also listen on a Unix domain
+// socket, e.g., "unix:/var/run/app.sock", or on a listener that is inherited via systemd socket activation, e.g.,
+// "systemd:http" - see `listener.Listen()`.
+//
+// The admin endpoints, i.e., all built-in endpoints except for the readiness and liveness probes, are protected via an
+// `Authenticator`, e.g., bearer token or mTLS client certificate allow-list. Routes are marked as admin endpoints via
+// `HTTPHandler.AdminOnly()`. Failed authentication attempts are logged as security events - see `AdminAuthFailedEvent`.
+// If no authenticator is configured, then admin requests are denied, unless unauthenticated admin access is explicitly
+// allowed - see `Builder.AllowUnauthenticatedAdmin()`. The metrics endpoint is an admin endpoint, i.e., Prometheus must
+// be configured with the admin credentials in order to scrape the metrics - see `KubernetesManifests()`.
+//
+// CORS and the standard security headers, e.g., HSTS and X-Content-Type-Options, can be enabled for all routes via the
+// builder - see `Builder.EnableCORS()` and `Builder.EnableSecurityHeaders()`.
+//
+// Request deadlines can be propagated across apps via the `DeadlineHeader` - see `Builder.EnableDeadlinePropagation()`.
+// Operation deadlines are derived from the request deadline via `WithBudget()`.
+//
+// Non-critical requests can be shed when load signals degrade, e.g., Yellow health or CPU / memory pressure - see
+// `Builder.EnableLoadShedding()`.
+//
+// The request correlation ID, principal, tenant, and deadline can be carried by the request context - see
+// `Builder.EnableRequestContext()` and the reqctx package.
+//
+// Request scoped values, e.g., a DB transaction or a logger with the request correlation ID, can be resolved by handlers
+// via the request scope, which is created per request by the app HTTP server - see `Builder.ProvideScoped()` and `Scope`.
+//
+// Latency and errors can be injected into health checks, HTTP handlers, and lifecycle hooks in order to validate alerting
+// and readiness behavior, e.g., in staging - see `FaultInjectionEndpoint`. Fault injection is disabled by default, and can
+// only be enabled via the APP12X_FAULT_INJECTION_ENABLED env var.
+//
+// Constructors and functions can be registered via the generic typed helpers, which are type checked at compile time,
+// e.g., `builder.Apply(fxapp.Provide1(NewRepo), fxapp.Invoke2(RegisterRoutes))` - see `Provide1()`, `Invoke1()`, and
+// `Supply()`.
+//
+// Optional modules can be enabled per environment via env flags, i.e., without code changes or recompiles - see
+// `Builder.EnableIf()` and `ModuleEnabled()`. The admin UI and pprof endpoints are toggled via the
+// APP12X_MODULE_ADMIN_UI_ENABLED and APP12X_MODULE_PPROF_ENABLED env vars.
+//
+// Named bundles of options, i.e., profiles such as "dev", "prod", and "test", can be registered with the builder and
+// selected via the APP12X_PROFILE env var, which enables the same binary to run with different infrastructure in
+// different environments - see `Builder.RegisterProfile()`.
+//
+// Log events can be shipped to a log collector over TCP, UDP, or HTTP, for environments where the stderr logs are not
+// scraped - see `Builder.EnableLogSink()`. The log sink can also be enabled via the APP12X_LOG_SINK_URL env var.
+//
+// The most recent events, at all levels, can be retained in memory and dumped to a file when the app fails to
+// initialize, start, or stop, i.e., the debug context around failures is captured without logging at debug level
+// permanently - see `Builder.EnableReplayBuffer()`.
+//
+// Debug level logging can be temporarily enabled for a specific component or event via a rate limited and audited admin
+// HTTP endpoint, i.e., without changing the app log level during an incident - see `Builder.EnableDebugSampling()`.
+//
+// The app shutdown reason, e.g., signal, health critical, admin request, fatal error, or memory soft limit, is propagated
+// via the Stopping and Done channels, logged with the StoppingEvent and StoppedEvent, and mapped to process exit codes,
+// i.e., postmortems can tell why an instance exited - see `RequestShutdown` and `ShutdownReason`.
+//
+// A periodic heartbeat, which reports the instance ID, uptime, overall health, and key counters, can be logged and sent to
+// a monitoring endpoint via HTTP or UDP, for environments where the app cannot be scraped - see `Builder.EnableHeartbeat()`.
+//
+// Long-running services, e.g., queue consumers, can be run in the background as workers, which are provided via
+// dependency injection - see `NewWorker()`. Worker failures shutdown the app, unless the worker is supervised, i.e., it
+// is restarted with backoff, and the failure is only escalated to an app shutdown after N consecutive failures - see
+// `Worker.WithRestartPolicy()` and `WorkerRestartsMetricID`.
+//
+// Queue consumers, e.g., for Kafka, NATS, or SQS, only need to implement the message handler. The consumer module handles
+// concurrency, panic recovery, ack/nack semantics, rebalancing, shutdown draining, and per consumer metrics and health
+// checks - see `Builder.EnableQueueConsumers()` and the consumer package.
+//
+// Health checks can be marked as fatal, i.e., after N consecutive Red results the app fails liveness and shuts down
+// gracefully, which implements the fail fast pattern for unrecoverable states - see `Builder.EnableFatalHealthChecks()`.
+//
+// Apps that were built using the deprecated fx/app package can be migrated incrementally, i.e., the app builder can be
+// constructed from the fx/app module Opts, and the fx/app module functions can still be injected - see
+// `NewBuilderFromLegacyOpts()` and `Builder.EnableLegacyShims()`.
+//
+// The APP12X env var name prefix can be customized per app, i.e., all of the framework env vars are consistently renamed,
+// which enables multiple apps to be configured independently within the same process or test environment - see
+// `Builder.SetEnvPrefix()`. App modules name their env vars via the provided `EnvPrefix`.
+//
+// Multiple isolated apps can be hosted in the same process, e.g., modular monoliths and integration test rigs, i.e.,
+// a `Supervisor` starts the apps in order and shuts them down in reverse order when any app stops - see `NewSupervisor()`.
 //
 // When building the app, the app HTTP server can be disabled - when using the App in unit testing, it is best to disable
 // the HTTP server if HTTP functionality is not being tested.
 //
 // Automatically Provided
 //  - Application Metadata
-//	  - Desc
+//	  - appdesc.Desc
+//	  - appdesc.InstanceMetadata - only set if enabled via the builder
 //	  - InstanceID
+//	  - RegisteredComponents
+//	  - RegisteredXRefs
+//	  - RegisteredAlertRules
+//	  - RegisteredEnvVars
+//	  - clock.Clock - the real clock, unless it is overridden via the builder
+//	  - HTTPServerAddr - the address that the HTTP server is bound to
+//	  - Profiles - the active profiles
+//	  - EnvPrefix - the env var name prefix
+//	  - RequestShutdown - used to trigger app shutdown with a reason
 //  - fx provided
 //	  - fx.Lifecycle - for components to use to bind to the app lifecycle
-//	  - fx.Shutdowner - used to trigger app shutdown
+//	  - fx.Shutdowner - used to trigger app shutdown - the shutdown is reported as a SIGTERM signal
 //	  - fx.Dotgraph - contains a DOT language visualization of the app dependency graph
+//	    - the app Dependencies model is derived from the fx.DotGraph, see `App.Dependencies()`
 //  - Prometheus metrics related
 //	  - prometheus.Gatherer
 //	  - prometheus.Registerer
@@ -170,10 +343,43 @@ import (
 //    - /01DF9JKZ73Y3V1AJN89B58D9HY - exposes prometheus metrics
 //    - /01DEJ5RA8XRZVECJDJFAA2PWJF - readiness probe
 //    - /01DF91XTSXWVDJQ4XJ432KQFXY - liveness probe
+//    - /01DH8RXAR935E9EC2SRKZN9R9J - registered components
+//    - /01DHXMAR3ZX9ZXWK64NMQ6A5SW - registered xrefs, which can be looked up by the referenced IDs via the "id" query param
+//    - /01DHNMWXM02YP82GZKN3DPRVR8 - health check results, supports JSON, text, and OpenMetrics formats via the Accept header
+//    - /01DHQPT9M06QXQV8XJFDXZZNBZ - runs a health check on demand and returns the result (POST)
+//    - /01DHXC32M0B3K2CP572AXHFGYT - metrics catalog, i.e., the registered metric descriptors keyed by the release ID,
+//      supports JSON and markdown formats via the Accept header
+//    - /01DHXWJDR9CD8PW0NRWX62DRSF - streams log events via Server-Sent Events, which can be filtered by event name via the
+//      "event" query param
+//    - /01DHY4T34062G92VNN721SFCRC - admin UI, i.e., a single page that shows the app info, dependency graph, health checks,
+//      metrics summary, and recent events - unless disabled via the APP12X_MODULE_ADMIN_UI_ENABLED env var
+//    - /01DHYD1RM0GKJTNNKEYHE8EG9J - goroutine, heap, and allocs dumps - only if enabled via the builder
+//    - /01DHYN9E406TH17S1FXMZGSE8T - OpenAPI document, which describes the built-in endpoints and the app routes that
+//      are documented via `HTTPHandler.WithDoc()`
+//    - /01DHZE0F0VMBAH8BBVM5H9W2WM - triggers a zero-downtime binary upgrade (POST) - only if enabled via the builder
+//    - /01DHZYFT54QFPRHZHCW0SD67EV - database schema version and pending migrations - only if enabled via the builder
+//    - /01DJ1R5GCH6J6JMM3HQZAW2EER - tenant health check roll-ups - only if tenancy is enabled via the builder
+//    - /01DJ20D5M0MP8ZGKVVXDB2EP0B - manages the injected faults - only if fault injection is enabled via env vars, see
+//      `LoadFaultInjectionOptsFromEnv()`
+//    - /01DJ3T2W4085QRXVTSY59BEF5H - temporarily enables debug logging for a specific component or event - only if
+//      enabled via the builder
+//    - /01DJ5KRJKZ6Q3SYEMQY2EKMW39 - support bundle, i.e., a tar.gz archive of the app state that is designed to be
+//      attached to incident tickets
+//    - /01DJ647XWJTQSH5TX7A0QQH2CM - shuts down the app (POST) - only if enabled via the builder
+//    - /01DJ9ZV0CJF8RSESQHH7AQPAEP - alert rules generated from the registered alert rules, i.e., Prometheus and Loki
+//      alerting rules, and Elasticsearch query templates, selected via the "format" query param
+//    - /01DJDVE2WJSRTVASARQZZE7TT7 - Grafana dashboard for the standard app metrics, i.e., health checks, HTTP server RED
+//      metrics, and the Go runtime and process collectors
+//    - /01DJHQ15CJ8SAVPTHKDKEZGV0K - Kubernetes manifests, i.e., Deployment, Service, ServiceMonitor, and
+//      PodDisruptionBudget, generated from the app descriptor, HTTP server port, probes, and metrics endpoint
+//    - /01DJNJM7WJ012W7C2JB2WVEDHA - Helm values.yaml for the env vars that are understood by the app, see `EnvCatalog()`
+//    - /debug/pprof/ - the standard net/http/pprof endpoints - only if enabled, see `ProfilingOpts`
 type App interface {
 	ID() ID
 	ReleaseID() ReleaseID
 	InstanceID() InstanceID
+	// Desc returns the app descriptor. If the app was built using `NewBuilder()`, then only the descriptor IDs are set.
+	Desc() appdesc.Desc
 
 	Options
 	LifeCycle
@@ -183,9 +389,21 @@ type App interface {
 	Run() error
 
 	// StopAsync signals the app to shutdown. This method does not block, i.e., application shutdown occurs async.
+	// The shutdown reason is `ShutdownRequested` - see `RequestShutdown` to shutdown the app with a specific reason.
 	//
 	// StopAsync can only be called after the app has been started - otherwise an error is returned.
 	Shutdown() error
+	// ShutdownReason returns the reason why the app is shutting down, e.g., to exit the process with the reason's exit
+	// code after the app is run - see `ShutdownReason.ExitCode()`. False is returned if the app is not shutting down.
+	ShutdownReason() (ShutdownReason, bool)
+
+	// Dependencies returns the app's dependency injection model, which is derived from the app's fx.DotGraph
+	Dependencies() *Dependencies
+
+	// SupportBundle writes the app support bundle as a tar.gz archive, which is designed to be attached to incident
+	// tickets. The bundle contains the app info, effective config (redacted), dependency graph, health check results,
+	// metrics, recent events (if the replay buffer is enabled), and goroutine stacks - see `SupportBundleEndpoint`.
+	SupportBundle(w io.Writer) error
 }
 
 // LifeCycle defines the application lifecycle.
@@ -198,10 +416,10 @@ type LifeCycle interface {
 	// Ready means the app is ready to serve requests
 	Ready() <-chan struct{}
 	// Stopping signals that app is stopping.
-	// The channel is closed after the stop signal is sent.
+	// The channel is closed after the stop signal is sent. The stop signal is the `ShutdownReason`.
 	Stopping() <-chan os.Signal
 	// Done signals that the app has shutdown.
-	// The channel is closed after the stop signal is sent.
+	// The channel is closed after the stop signal is sent. The stop signal is the `ShutdownReason`.
 	// If the app fails to startup, then the channel is simply closed, i.e., no stop signal will be sent on the channel.
 	Done() <-chan os.Signal
 }
@@ -225,9 +443,11 @@ type app struct {
 	id         ID
 	releaseID  ReleaseID
 	instanceID InstanceID
+	desc       appdesc.Desc
 
 	constructors []interface{}
 	funcs        []interface{}
+	clock        clock.Clock
 
 	startErrorHandlers, stopErrorHandlers []func(error)
 
@@ -237,7 +457,20 @@ type app struct {
 	readiness         ReadinessWaitGroup
 	stopping, stopped chan os.Signal
 
-	logger *zerolog.Logger
+	warmUpTasks   []WarmUpTask
+	warmUpTimeout time.Duration
+	skipWarmUp    bool
+
+	logger           *zerolog.Logger
+	dotGraph         fx.DotGraph
+	httpServerAddr   HTTPServerAddr
+	events           *eventStream
+	logSink          *eventlog.Sink
+	replay           *replayBuffer
+	config           effectiveConfig
+	bundle           *supportBundle
+	shutdownState    *shutdownState
+	lifecycleMetrics *lifecycleMetrics
 }
 
 func (a *app) String() string {
@@ -293,6 +526,14 @@ func (a *app) InstanceID() InstanceID {
 	return a.instanceID
 }
 
+func (a *app) Desc() appdesc.Desc {
+	return a.desc
+}
+
+func (a *app) Dependencies() *Dependencies {
+	return NewDependencies(a.dotGraph, a.funcs...)
+}
+
 func types(values []interface{}) []reflect.Type {
 	if len(values) == 0 {
 		return nil
@@ -320,47 +561,76 @@ func (a *app) Run() error {
 	default:
 		// app has not been started yet
 	}
+	if a.replay != nil {
+		// lifecycle hooks are run on the Run goroutine, i.e., panics in lifecycle hooks are captured
+		defer func() {
+			if p := recover(); p != nil {
+				a.replay.dump(ReplayPanic)
+				closeLogSink(a.logSink, a.StopTimeout())
+				panic(p)
+			}
+		}()
+	}
 	a.logAppStarting()
 
-	startCtx, cancel := context.WithTimeout(context.Background(), a.StartTimeout())
+	startCtx, cancel := a.clock.WithTimeout(context.Background(), a.StartTimeout())
 	defer cancel()
 	defer close(a.stopped)
 
 	stopChan := a.App.Done()
 
 	close(a.starting)
-	startingTime := time.Now()
+	startingTime := a.clock.Now()
 	if e := a.Start(startCtx); e != nil {
+		defer closeLogSink(a.logSink, a.StopTimeout())
+		defer dumpReplayBuffer(a.replay, ReplayStartFailed)
 		return a.handleStartError(e)
 	}
-	a.logAppStarted(time.Since(startingTime))
+	startupTime := a.clock.Since(startingTime)
+	a.lifecycleMetrics.started(startupTime)
+	a.logAppStarted(startupTime)
 	close(a.started)
+	// the warm-up holds the app readiness until the warm-up tasks are completed
+	cancelWarmUp := a.warmUp()
 	a.readiness.Done() // the app has started
 
 	// wait for the app to be ready to service requests
 	select {
 	case <-a.readiness.Ready():
 		a.logAppReady()
-		return a.shutdown(<-stopChan) // shutdown on stop signal
+		signal := <-stopChan // shutdown on stop signal
+		cancelWarmUp()
+		return a.shutdown(a.shutdownState.stopReason(signal))
 	case signal := <-stopChan: // wait for the app to be signalled to stop
-		return a.shutdown(signal)
+		cancelWarmUp()
+		return a.shutdown(a.shutdownState.stopReason(signal))
 	}
 }
 
-func (a *app) shutdown(signal os.Signal) error {
-	a.stopping <- signal
+func (a *app) shutdown(reason ShutdownReason) error {
+	a.stopping <- reason
 	close(a.stopping)
 	defer func() {
-		a.stopped <- signal
+		a.stopped <- reason
 	}()
+	// the log sink is closed after the app stopped event is logged
+	defer closeLogSink(a.logSink, a.StopTimeout())
 
-	a.logAppStopping()
+	a.logAppStopping(reason)
+	// event streams are closed before the HTTP server is shutdown, otherwise the HTTP server shutdown would block on the
+	// event stream connections
+	a.events.close()
 
-	stopCtx, cancel := context.WithTimeout(context.Background(), a.StopTimeout())
+	stopCtx, cancel := a.clock.WithTimeout(context.Background(), a.StopTimeout())
 	defer cancel()
-	stoppingTime := time.Now()
-	defer func() { a.logAppStopped(time.Since(stoppingTime)) }()
+	stoppingTime := a.clock.Now()
+	defer func() {
+		shutdownTime := a.clock.Since(stoppingTime)
+		a.lifecycleMetrics.stopped(shutdownTime)
+		a.logAppStopped(shutdownTime, reason)
+	}()
 	if e := a.Stop(stopCtx); e != nil {
+		defer dumpReplayBuffer(a.replay, ReplayStopFailed)
 		return a.handleStopError(e)
 	}
 	return nil
@@ -403,16 +673,21 @@ func (a *app) Done() <-chan os.Signal {
 func (a *app) Shutdown() error {
 	select {
 	case <-a.started:
-		return a.Shutdowner.Shutdown()
+		a.shutdownState.request(ShutdownReason{Code: ShutdownRequested})
+		return nil
 	default:
 		return errors.New("app can only be shutdown after it has started")
 	}
 
 }
 
+func (a *app) ShutdownReason() (ShutdownReason, bool) {
+	return a.shutdownState.shutdownReason()
+}
+
 func (a *app) logAppInitialized(dependencyGraph fx.DotGraph) {
 	logEvent := eventlog.NewLogger(InitializedEvent, a.logger, zerolog.NoLevel)
-	logEvent(appInfo{a, dependencyGraph}, "app initialized")
+	logEvent(appInfo{a, dependencyGraph, a.config}, "app initialized")
 }
 
 func (a *app) logAppStarting() {
@@ -422,7 +697,7 @@ func (a *app) logAppStarting() {
 
 func (a *app) logAppStarted(startupTime time.Duration) {
 	logEvent := eventlog.NewLogger(StartedEvent, a.logger, zerolog.NoLevel)
-	logEvent(duration(startupTime), "app started")
+	logEvent(appStarted{duration: startupTime, httpServerAddr: a.httpServerAddr()}, "app started")
 }
 
 func (a *app) logAppReady() {
@@ -430,12 +705,12 @@ func (a *app) logAppReady() {
 	logEvent(nil, "app is ready to service requests")
 }
 
-func (a *app) logAppStopping() {
+func (a *app) logAppStopping(reason ShutdownReason) {
 	logEvent := eventlog.NewLogger(StoppingEvent, a.logger, zerolog.NoLevel)
-	logEvent(nil, "app stopping")
+	logEvent(appStopping{reason}, "app stopping")
 }
 
-func (a *app) logAppStopped(shutdownDuration time.Duration) {
+func (a *app) logAppStopped(shutdownDuration time.Duration, reason ShutdownReason) {
 	logEvent := eventlog.NewLogger(StoppedEvent, a.logger, zerolog.NoLevel)
-	logEvent(duration(shutdownDuration), "app stopped")
+	logEvent(appStopped{shutdownDuration, reason}, "app stopped")
 }
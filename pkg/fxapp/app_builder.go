@@ -21,9 +21,22 @@ import (
 	"context"
 	"errors"
 	"fmt"
+	"github.com/blang/semver"
 	"github.com/oklog/ulid"
+	"github.com/oysterpack/andiamo/pkg/appdesc"
+	"github.com/oysterpack/andiamo/pkg/clock"
 	"github.com/oysterpack/andiamo/pkg/eventlog"
+	"github.com/oysterpack/andiamo/pkg/fx/consumer"
+	"github.com/oysterpack/andiamo/pkg/fx/dns"
+	"github.com/oysterpack/andiamo/pkg/fx/filewatch"
 	"github.com/oysterpack/andiamo/pkg/fx/health"
+	"github.com/oysterpack/andiamo/pkg/fx/idempotency"
+	"github.com/oysterpack/andiamo/pkg/fx/kv"
+	"github.com/oysterpack/andiamo/pkg/fx/lock"
+	"github.com/oysterpack/andiamo/pkg/fx/migrate"
+	"github.com/oysterpack/andiamo/pkg/fx/outbox"
+	"github.com/oysterpack/andiamo/pkg/fx/retry"
+	"github.com/oysterpack/andiamo/pkg/fx/upgrade"
 	"github.com/oysterpack/andiamo/pkg/ulids"
 	"github.com/prometheus/client_golang/prometheus"
 	"github.com/rs/zerolog"
@@ -33,6 +46,8 @@ import (
 	"log"
 	"os"
 	"reflect"
+	"strings"
+	"sync"
 	"time"
 )
 
@@ -42,18 +57,121 @@ import (
 type Builder interface {
 	// Provide is used to provide dependency injection
 	Provide(constructors ...interface{}) Builder
+	// Replace replaces provided types with the specified values, e.g., to swap a real DB client for a fake in tests.
+	// The constructors that provide the replaced types no longer provide them, i.e., constructors are not run for
+	// replaced types. To replace an interface type, pass a pointer to the interface value, e.g.,
+	//
+	//	var c clock.Clock = clock.NewFake(time.Now())
+	//	builder.Replace(&c)
+	//
+	// The app fails to build if a replaced type is not provided, or if a type is replaced more than once.
+	//
+	// NOTE: named and value group types cannot be replaced.
+	Replace(values ...interface{}) Builder
+	// Decorate registers functions that decorate provided types, e.g., to wrap a client with instrumentation. A decorator
+	// accepts the decorated type as its first param, followed by any dependencies, and returns the decorated type, and
+	// optionally an error, e.g.,
+	//
+	//	func(client *http.Client, logger *zerolog.Logger) *http.Client
+	//
+	// Decorators for the same type are applied in the order that they are registered. Replacements are decorated as well.
+	// The app fails to build if a decorated type is not provided.
+	//
+	// NOTE: named and value group types cannot be decorated.
+	Decorate(decorators ...interface{}) Builder
+	// ProvideScoped registers scoped constructors, i.e., constructors for values that are scoped to a request or job, e.g.,
+	// a DB transaction or a logger with the request correlation ID. Scoped values are constructed lazily per scope, and
+	// are resolved via the `Scope`. A scoped constructor returns the scoped value, optionally followed by a cleanup
+	// function, which is run when the scope is closed, and optionally an error, e.g.,
+	//
+	//	func(ctx context.Context, db *sql.DB) (*sql.Tx, func(), error)
+	//
+	// The app HTTP server creates a scope per request, which is carried by the request context - see `ScopeFromContext()`.
+	// Scopes can be created for jobs via `NewScope`, which is provided via dependency injection. Scopes are pooled in order
+	// to avoid per request allocations.
+	ProvideScoped(constructors ...interface{}) Builder
+	// Apply applies the options to the builder, e.g., to register the typed constructors and functions - see `Provide1()`,
+	// `Invoke1()`, and `Supply()`. Nil options are ignored.
+	Apply(options ...BuilderOption) Builder
+	// EnableIf applies the options if the condition is met, e.g., to enable optional modules per environment via env
+	// flags without code changes - see `EnvFlag()` and `ModuleEnabled()`. Conditions are evaluated lazily, i.e., when the
+	// app is built. Options may register conditional options themselves.
+	//
+	// The following built-in modules are toggled via env vars - see `ModuleEnabledEnvVar()`:
+	//   - `AdminUIModule` - enabled by default
+	//   - `PprofModule` - disabled by default
+	EnableIf(condition Condition, options ...BuilderOption) Builder
+	// RegisterProfile registers a named bundle of options, e.g., "dev", "prod", or "test", which can contribute providers,
+	// middleware, log settings, etc. Profiles are selected via the APP12X_PROFILE env var, which enables the same binary
+	// to run with different infrastructure in different environments - see `ProfileEnvVar`.
+	//
+	// The active profiles are provided via dependency injection - see `Profiles`.
+	RegisterProfile(name string, options ...BuilderOption) Builder
+	// SetProfiles selects the profiles that are applied when the app is built, which takes precedence over the
+	// APP12X_PROFILE env var. Profiles are applied in the specified order.
+	SetProfiles(names ...string) Builder
 	// Invoke is used to register application functions, which will be invoked to to initialize the app.
 	// The functions are invoked in the order that they are registered.
 	Invoke(funcs ...interface{}) Builder
+	// RegisterComponents is used to register application components.
+	// The component's Provide and Invoke functions are registered with the app. Component functions are invoked before
+	// the app functions.
+	RegisterComponents(components ...Component) Builder
+	// RegisterXRefs is used to register cross-references between related events, errors, metrics, and health checks.
+	// The registered xrefs are exposed via HTTP - see `XRefsEndpoint`.
+	RegisterXRefs(xrefs ...XRef) Builder
+	// RegisterAlertRules is used to register alert rules, which are used to generate the alerting configuration for the
+	// app events, e.g., `StandardAlertRules()`. The generated configuration is exposed via HTTP - see `AlertRulesEndpoint`.
+	RegisterAlertRules(rules ...AlertRule) Builder
+	// RegisterEnvVars is used to register the env vars that the app understands, which are added to the env var catalog -
+	// see `EnvCatalog()` and `HelmValuesEndpoint`.
+	RegisterEnvVars(vars ...EnvVar) Builder
 
 	SetStartTimeout(timeout time.Duration) Builder
 	SetStopTimeout(timeout time.Duration) Builder
+	// SetWarmUpTimeout sets the warm-up phase timeout - see `WarmUp`. When the warm-up times out, the app readiness opens
+	// and the warm-up tasks that are still running are abandoned.
+	//
+	// The default timeout is 1 min.
+	SetWarmUpTimeout(timeout time.Duration) Builder
+	// SkipWarmUp skips the warm-up phase, i.e., the app is ready as soon as it is started.
+	//
+	// The warm-up phase can also be skipped via the `WarmUpSkipEnvVar` env var.
+	SkipWarmUp() Builder
+	// SetClock sets the clock that is used for the app start and stop timeouts, health check scheduling and timeouts,
+	// and duration measurements. The clock is provided via dependency injection.
+	//
+	// By default, the real clock is used. Tests can use a fake clock to advance time deterministically instead of
+	// sleeping - see `clock.NewFake()`.
+	SetClock(c clock.Clock) Builder
 
 	// LogWriter is used as the zerolog writer.
 	//
 	// By default, stderr is used.
 	LogWriter(w io.Writer) Builder
 	LogLevel(level LogLevel) Builder
+	// LogHooks registers zerolog hooks with the app logger, e.g., for trace ID injection or external forwarding, without
+	// replacing the log writer.
+	//
+	// The hooks are scoped to the app. Hooks can also be added at runtime via the provided *eventlog.Hooks, e.g., when a
+	// component starts - see `eventlog.Hooks`.
+	LogHooks(hooks ...zerolog.Hook) Builder
+	// LogEventHooks registers event hooks with the app logger, which have access to the event name, e.g., for per-event
+	// counters - see `eventlog.EventHook`.
+	LogEventHooks(hooks ...eventlog.EventHook) Builder
+	// EnableLogSink ships the log events to a log collector over the network, e.g., Vector, Fluentd, Loki, or
+	// Elasticsearch, for environments where the stderr logs are not scraped. Events are still written to the log writer.
+	// The Loki and Elasticsearch exporters map the event fields to Loki labels and ECS fields - see `eventlog.SinkOpts`.
+	// The sink's backpressure and export lag are recorded as metrics, e.g., dropped events - see `LogSinkDroppedMetricID`.
+	//
+	// If the log sink is not enabled via the builder, then it is configured via env vars - see `LoadLogSinkOptsFromEnv()`.
+	EnableLogSink(opts eventlog.SinkOpts) Builder
+	// EnableReplayBuffer retains the most recent events in memory, at all levels regardless of the app log level, which
+	// are dumped to a file when the app fails to initialize, start, or stop, or when a lifecycle hook panics. The events
+	// can also be dumped on demand via the provided `ReplayBuffer`, or retrieved via the `ReplayBufferEndpoint`.
+	//
+	// NOTE: debug events are always constructed when the replay buffer is enabled, which adds logging overhead.
+	EnableReplayBuffer(opts ReplayBufferOpts) Builder
 
 	// Error handlers
 	HandleInvokeError(errorHandlers ...func(error)) Builder
@@ -69,6 +187,12 @@ type Builder interface {
 	// NOTE: this is useful for unit testing
 	Populate(targets ...interface{}) Builder
 
+	// SetHTTPServerAddr sets the HTTP server address, which takes precedence over the APP12X_HTTP_SERVER_ADDR env var and
+	// the provided http.Server Addr. Use ":0" to listen on a random free port, e.g., to run tests in parallel or to run
+	// multiple app instances locally. The bound address is provided via `HTTPServerAddr` and is logged with the
+	// `StartedEvent`.
+	SetHTTPServerAddr(addr string) Builder
+
 	// DisableHTTPServer disables the HTTP server
 	//
 	// Uses cases for disabling the HTTP server:
@@ -77,7 +201,221 @@ type Builder interface {
 	//  - for CLI based apps
 	DisableHTTPServer() Builder
 
+	// EnableInstanceMetadata enriches log events and metric labels with the runtime environment metadata, i.e., hostname,
+	// k8s pod/namespace/node, and cloud region/zone - see `appdesc.LoadInstanceMetadata()`.
+	//
+	// It is disabled by default in order to not pollute local runs.
+	EnableInstanceMetadata() Builder
+
+	// SetEnvPrefix sets the env var name prefix that all of the app's env vars are namespaced with, e.g., "FOO" maps
+	// APP12X_HTTP_SERVER_ADDR to FOO_HTTP_SERVER_ADDR. It is applied consistently to the HTTP server, admin bearer token,
+	// profiles, module toggles, warm-up, profiling, log sink, fault injection, instance metadata, effective config, and
+	// the env var catalog, which enables multiple apps to be configured independently within the same process or test
+	// environment. The prefix is provided via `EnvPrefix`, i.e., app modules use it to name their env vars. The app IDs
+	// are loaded from the prefixed env vars via `LoadIDsFromEnvPrefix()`.
+	//
+	// The default prefix is `EnvconfigPrefix`.
+	SetEnvPrefix(prefix string) Builder
+
+	// EnableLegacyShims provides the functions that are provided by the deprecated fx/app module, i.e., app.ID,
+	// app.ReleaseID, app.InstanceID, app.Name, app.Version, app.Labels, and app.Logger. Thus, components that were written
+	// for fx/app based apps can be registered without being rewritten, and migrated incrementally. The `DeprecationEvent`
+	// is logged for each legacy function that is injected - see `NewBuilderFromLegacyOpts()`.
+	EnableLegacyShims() Builder
+
+	// EnableResourceHealthChecks registers health checks for resource pressure, i.e., filesystem usage, memory usage,
+	// and open file descriptors. Usage thresholds are mapped to `Yellow` and `Red` statuses, which surfaces resource
+	// exhaustion in readiness before the app is OOM killed or fails to open files - see `ResourceHealthCheckOpts`.
+	EnableResourceHealthChecks(opts ResourceHealthCheckOpts) Builder
+
+	// EnableErrorRateHealthChecks registers health checks that track the rate of errors, as recorded by prometheus
+	// counters, over sliding windows. Error rate thresholds are mapped to `Yellow` and `Red` statuses, which surfaces
+	// elevated error rates in readiness - see `ErrorRateHealthCheck`.
+	//
+	// The method is additive, i.e., it can be called multiple times to register more error rate health checks.
+	EnableErrorRateHealthChecks(checks ...ErrorRateHealthCheck) Builder
+
+	// EnableSLOs registers service level objectives that are tracked against request metrics, i.e., availability and
+	// latency objectives. The error budget burn rates are exposed as metrics - see `SLOBurnRateMetricID`, and each SLO is
+	// registered as a health check that flips when the fast-burn thresholds are crossed - see `SLO`.
+	//
+	// The method is additive, i.e., it can be called multiple times to register more SLOs.
+	EnableSLOs(slos ...SLO) Builder
+
+	// RequireDependencies declares the external dependencies that the app requires, i.e., URLs, TCP endpoints, or health
+	// check tags. The app is not ready until each dependency has been verified, and dependency failures are handled per
+	// the dependency policy, i.e., they either fail the readiness probe or the liveness probe - see `Dependency`.
+	//
+	// The method is additive, i.e., it can be called multiple times to declare more dependencies.
+	RequireDependencies(dependencies ...Dependency) Builder
+
+	// EnableClockSkewHealthCheck registers a health check that compares the local clock against the reference clock, e.g.,
+	// an NTP server, and that detects wall clock drift relative to the monotonic clock. Skew thresholds are mapped to
+	// `Yellow` and `Red` statuses - see `ClockSkewHealthCheckOpts`.
+	EnableClockSkewHealthCheck(opts ClockSkewHealthCheckOpts) Builder
+
+	// EnableDebugDumps enables the debug dump HTTP endpoint, which produces goroutine stacks, heap profiles, and allocation
+	// profiles on demand. The endpoint is rate limited, optionally token protected, and audited - see `DebugDumpEndpoint`.
+	EnableDebugDumps(opts DebugDumpOpts) Builder
+
+	// EnableDebugSampling enables the debug sampling HTTP endpoint, which temporarily enables debug level logging for a
+	// specific component or event, and automatically reverts - see `DebugSamplingEndpoint`. Sessions are rate limited
+	// and audited.
+	//
+	// NOTE: debug events are constructed for all components while a session is active, which adds logging overhead.
+	EnableDebugSampling(opts DebugSamplingOpts) Builder
+
+	// EnableHeartbeat enables the app heartbeat, i.e., the `HeartbeatEvent` is logged periodically, and optionally sent to
+	// a monitoring endpoint via HTTP POST or UDP. The heartbeat reports the instance ID, uptime, overall health, and key
+	// counters, and is designed for environments where the app cannot be scraped - see `HeartbeatOpts`.
+	EnableHeartbeat(opts HeartbeatOpts) Builder
+
+	// EnableShutdownEndpoint registers the admin HTTP endpoint that shuts down the app, using the `ShutdownAdminRequest`
+	// reason - see `ShutdownEndpoint`.
+	EnableShutdownEndpoint() Builder
+
+	// EnableFatalHealthChecks marks the specified health checks as fatal. After N consecutive `Red` results, the app logs
+	// the `FatalHealthCheckEvent`, fails liveness, and initiates a graceful shutdown using the `ShutdownHealthCritical`
+	// reason, i.e., it implements the fail fast pattern for unrecoverable states - see `FatalHealthCheck`.
+	//
+	// The method is additive, i.e., it can be called multiple times to mark more health checks as fatal.
+	EnableFatalHealthChecks(checks ...FatalHealthCheck) Builder
+	// SetSlowHealthCheckThreshold sets the percentage of the health check timeout, e.g., 0.8, that a health check run
+	// duration must exceed to be logged as slow - see `HealthCheckSlowEvent`. The threshold must be greater than 0 and
+	// must not exceed 1.
+	//
+	// The default threshold is `DefaultSlowHealthCheckThreshold`.
+	SetSlowHealthCheckThreshold(threshold float64) Builder
+
+	// SetAdminAuthenticator is used to protect the app's admin HTTP endpoints, i.e., metrics, health checks, components,
+	// event stream, etc. It takes precedence over an Authenticator that is provided via dependency injection and the
+	// APP12X_ADMIN_BEARER_TOKEN env var - see `Authenticator`.
+	SetAdminAuthenticator(authenticator Authenticator) Builder
+
+	// AllowUnauthenticatedAdmin explicitly allows unauthenticated access to the app's admin HTTP endpoints, if no admin
+	// authenticator is configured, e.g., for local development. By default, admin requests are denied if no admin
+	// authenticator is configured - see `Authenticator` and `AdminUnauthenticatedEvent`.
+	AllowUnauthenticatedAdmin() Builder
+
+	// EnableCORS enables Cross-Origin Resource Sharing for the app HTTP server, i.e., it is applied to all routes - see
+	// `NewCORSMiddleware()`.
+	EnableCORS(opts CORSOpts) Builder
+
+	// EnableSecurityHeaders sets the standard security headers, e.g., HSTS and X-Content-Type-Options, on all app HTTP
+	// server responses - see `DefaultSecurityHeadersOpts()`.
+	EnableSecurityHeaders(opts SecurityHeadersOpts) Builder
+
+	// EnableDeadlinePropagation applies request deadlines to the app HTTP server request contexts, i.e., deadlines that
+	// are propagated via the `DeadlineHeader` are honored, and requests whose deadline has already been exceeded are
+	// rejected - see `NewDeadlineMiddleware()`.
+	EnableDeadlinePropagation(opts DeadlineOpts) Builder
+
+	// EnableLoadShedding rejects a fraction of the non-critical app HTTP server requests with HTTP 429 or 503 while load
+	// signals are degraded, e.g., Yellow health, high goroutine count, or CPU / memory pressure. Shed requests are counted
+	// via `LoadShedMetricID`, and `LoadSheddingEvent` is logged when load shedding engages and disengages - see
+	// `LoadSheddingOpts`.
+	EnableLoadShedding(opts LoadSheddingOpts) Builder
+
+	// EnableRequestContext extracts the `reqctx.RequestContext` from the app HTTP server requests, i.e., the correlation
+	// ID, principal, tenant, and deadline are carried by the request context - see `NewRequestContextMiddleware()`.
+	EnableRequestContext(opts RequestContextOpts) Builder
+
+	// EnableTenancy enables tenant-awareness, i.e., the request tenant is resolved via the `TenantResolver`, if one is
+	// provided, and is carried by the request context, which enriches request log events. The following are provided:
+	//   - `TenantLabels` - used to add the tenant label to metrics, with a cardinality guard
+	//   - `TenantHealth` - used to register health checks per tenant, and to roll up their results
+	EnableTenancy(opts TenancyOpts) Builder
+
+	// SetHTTPServerLimits is used to configure the app HTTP server timeouts and max request body size, which take
+	// precedence over the provided http.Server settings. Violations are logged and counted - see `HTTPServerLimits`.
+	SetHTTPServerLimits(limits HTTPServerLimits) Builder
+
+	// SetKubernetesOpts is used to declare the Kubernetes deployment hints, e.g., resource requests and limits, which
+	// are used to generate the app Kubernetes manifests - see `KubernetesManifestsEndpoint`.
+	SetKubernetesOpts(opts KubernetesOpts) Builder
+
+	// EnableUpgrades enables zero-downtime binary upgrades, i.e., the app hands off its listeners to a new process, and
+	// drains after the new process is ready - see the upgrade package and `UpgradeEndpoint`.
+	//
+	// While the app is draining, the readiness probe reports that the app is not ready.
+	EnableUpgrades(opts upgrade.Opts) Builder
+
+	// EnableProfiling integrates the app with continuous profilers, i.e., CPU profiles are pushed to a profiler server,
+	// and / or the pprof endpoints are registered for scraping. Profiles are labeled with the app ID, release ID, and
+	// instance ID - see `ProfilingOpts`.
+	//
+	// If profiling is not enabled via the builder, then it is configured via env vars - see `LoadProfilingOptsFromEnv()`.
+	EnableProfiling(opts ProfilingOpts) Builder
+
+	// EnableMigrations runs the database schema migrations when the app is started, i.e., before the app is ready. The
+	// *sql.DB must be provided by the app. The schema version is exposed via metrics and `MigrationsEndpoint` - see the
+	// migrate package.
+	EnableMigrations(opts migrate.Opts) Builder
+
+	// EnableDistributedLocks provides the `lock.DistributedLock`, which is used to coordinate work across app instances.
+	// The lock.Backend must be provided by the app - see the lock package.
+	EnableDistributedLocks(opts lock.Opts) Builder
+
+	// EnableOutboxRelay runs the transactional outbox relay, which publishes the outbox messages to the message broker.
+	// The outbox.Store and outbox.Publisher must be provided by the app. If distributed locks are enabled, then only 1 app
+	// instance relays messages - see the outbox package.
+	EnableOutboxRelay(opts outbox.Opts) Builder
+
+	// EnableQueueConsumers runs the queue consumers that are registered via `consumer.NewRegistration()`, i.e., business
+	// code only implements the `consumer.Handler`. When the app is stopped, the in-flight messages are drained - see the
+	// consumer package.
+	EnableQueueConsumers(opts consumer.Opts) Builder
+
+	// EnableIdempotency provides idempotency key tracking, i.e., `idempotency.Keys` and `idempotency.HTTPMiddleware`,
+	// which can be registered as HTTP route middleware. If an idempotency.Store is not provided by the app, then keys are
+	// tracked in memory - see the idempotency package.
+	EnableIdempotency(opts idempotency.Opts) Builder
+
+	// EnableRetries provides the `retry.Retrier`, which is used to retry operations, e.g., outbound calls, using the
+	// specified default retry policy. Retries are logged as events and recorded as metrics - see the retry package.
+	EnableRetries(opts retry.Opts) Builder
+
+	// EnableKVStore provides the `kv.Store`, which is a durable local key/value store that is backed by an embedded
+	// database file. The database is compacted on a schedule, and its integrity is health checked - see the kv package.
+	EnableKVStore(opts kv.Opts) Builder
+
+	// EnableFileWatcher provides the `filewatch.Watcher`, which is used to watch files and directories for changes. Change
+	// events are debounced and delivered in batches - see the filewatch package.
+	EnableFileWatcher(opts filewatch.Opts) Builder
+
+	// EnableDNSCache provides the `dns.Resolver`, which caches and refreshes the resolved host addresses in the background,
+	// and serves stale addresses when hosts fail to resolve. HTTP clients use the resolver via `dns.NewTransport()` - see
+	// the dns package.
+	EnableDNSCache(opts dns.Opts) Builder
+
+	// Build builds the app. If the app fails to build, then a *BuildReport error is returned, which aggregates all of the
+	// problems that were found, e.g., invalid options and missing providers.
 	Build() (App, error)
+
+	// Validate is a dry run build, i.e., the app dependency graph is built and checked without running any constructors,
+	// app functions, or lifecycle hooks. It is designed to be used in CI to catch wiring problems cheaply before
+	// deployment. If problems are found, then a *BuildReport error is returned.
+	//
+	// NOTE: problems that can only be detected by running the app, e.g., constructor errors, are not detected.
+	Validate() error
+	// EnvCatalog returns the env vars that are understood by the app, i.e., the standard env vars and the registered env
+	// vars. It is designed to be used to generate or validate deployment config without running the app, e.g.,
+	// Helm chart values - see `HelmValues()`.
+	EnvCatalog() []EnvVar
+	// EnvPrefix returns the env var name prefix - see `SetEnvPrefix()`. It is used to name app env vars when configuring
+	// the builder, e.g., `EnvPrefix.ModuleEnabled()` conditions.
+	EnvPrefix() EnvPrefix
+}
+
+// NewBuilderFromDesc constructs a new Builder using the app descriptor.
+//
+// The descriptor name and version are added to log events and metric labels, in addition to the app IDs.
+func NewBuilderFromDesc(desc appdesc.Desc) Builder {
+	b := NewBuilder(ID(desc.ID), ReleaseID(desc.ReleaseID)).(*builder)
+	b.name = desc.Name
+	b.version = desc.Version
+	b.validateDesc = true
+	return b
 }
 
 // NewBuilder constructs a new Builder
@@ -87,8 +425,12 @@ func NewBuilder(id ID, releaseID ReleaseID) Builder {
 		id:         id,
 		releaseID:  releaseID,
 
-		startTimeout: fx.DefaultTimeout,
-		stopTimeout:  fx.DefaultTimeout,
+		startTimeout:  fx.DefaultTimeout,
+		stopTimeout:   fx.DefaultTimeout,
+		warmUpTimeout: DefaultWarmUpTimeout,
+		clock:         clock.Real(),
+
+		slowHealthCheckThreshold: DefaultSlowHealthCheckThreshold,
 
 		globalLogLevel: zerolog.InfoLevel,
 		logWriter:      os.Stderr,
@@ -99,20 +441,107 @@ type builder struct {
 	instanceID InstanceID
 	id         ID
 	releaseID  ReleaseID
+	name       string
+	version    semver.Version
+	// set when the builder is constructed from an app descriptor
+	validateDesc bool
+
+	startTimeout  time.Duration
+	stopTimeout   time.Duration
+	warmUpTimeout time.Duration
+	skipWarmUp    bool
+	clock         clock.Clock
+
+	constructors []interface{}
+	funcs        []interface{}
+	scoped       []interface{}
+	overrides    overrides
+	conditionals []conditional
+	profiles     []profile
+	// the profile names that were selected via the builder
+	profileNames    []string
+	profileNamesSet bool
+	profilesApplied bool
+	activeProfiles  Profiles
+	// the conditions that were evaluated when the app was built
+	conditionResults []conditionResult
+	populateTargets  []interface{}
+	components       []Component
+	xrefs            []XRef
+	alertRules       []AlertRule
+	envVars          []EnvVar
+
+	logWriter        io.Writer
+	logHooks         []zerolog.Hook
+	logEventHooks    []eventlog.EventHook
+	logSinkOpts      *eventlog.SinkOpts
+	replayBufferOpts *ReplayBufferOpts
+	globalLogLevel   zerolog.Level
+
+	invokeErrorHandlers, startErrorHandlers, stopErrorHandlers []func(error)
 
-	startTimeout time.Duration
-	stopTimeout  time.Duration
+	disableHTTPServer bool
+	httpServerAddr    string
 
-	constructors    []interface{}
-	funcs           []interface{}
-	populateTargets []interface{}
+	envPrefix               EnvPrefix
+	instanceMetadataEnabled bool
+	instanceMetadata        appdesc.InstanceMetadata
 
-	logWriter      io.Writer
-	globalLogLevel zerolog.Level
+	resourceHealthCheckOpts  *ResourceHealthCheckOpts
+	errorRateHealthChecks    []ErrorRateHealthCheck
+	slos                     []SLO
+	dependencies             []Dependency
+	clockSkewHealthCheckOpts *ClockSkewHealthCheckOpts
+	debugDumpOpts            *DebugDumpOpts
+	debugSamplingOpts        *DebugSamplingOpts
+	heartbeatOpts            *HeartbeatOpts
+	shutdownEndpoint         bool
+	fatalHealthChecks        []FatalHealthCheck
+	slowHealthCheckThreshold float64
 
-	invokeErrorHandlers, startErrorHandlers, stopErrorHandlers []func(error)
+	legacyShims bool
+	// deprecated APIs that were used to construct the builder
+	deprecations []deprecation
 
-	disableHTTPServer bool
+	adminAuthenticator    Authenticator
+	adminAuthenticatorSet bool
+	adminAuthDisabled     bool
+
+	corsOpts            *CORSOpts
+	securityHeadersOpts *SecurityHeadersOpts
+	deadlineOpts        *DeadlineOpts
+	loadSheddingOpts    *LoadSheddingOpts
+	requestContextOpts  *RequestContextOpts
+	tenancyOpts         *TenancyOpts
+
+	httpServerLimits HTTPServerLimits
+	kubernetesOpts   KubernetesOpts
+
+	upgradeOpts *upgrade.Opts
+
+	adminUIDisabled bool
+
+	profilingOpts *ProfilingOpts
+
+	faultInjectionOpts *FaultInjectionOpts
+
+	migrateOpts *migrate.Opts
+
+	lockOpts *lock.Opts
+
+	outboxOpts *outbox.Opts
+
+	consumerOpts *consumer.Opts
+
+	idempotencyOpts *idempotency.Opts
+
+	retryOpts *retry.Opts
+
+	kvOpts *kv.Opts
+
+	fileWatchOpts *filewatch.Opts
+
+	dnsOpts *dns.Opts
 }
 
 func (b *builder) String() string {
@@ -137,8 +566,8 @@ func (b *builder) String() string {
 		ulid.ULID(b.releaseID),
 		b.startTimeout,
 		b.startTimeout,
-		types(b.constructors),
-		types(b.funcs),
+		types(b.appConstructors()),
+		types(b.appFuncs()),
 		types(b.populateTargets),
 		len(b.invokeErrorHandlers),
 		len(b.startErrorHandlers),
@@ -147,22 +576,102 @@ func (b *builder) String() string {
 
 // New tries to construct and initialize a new App instance.
 // All of the app's functions are run as part of the app initialization phase.
+//
+// If the app fails to build, then a *BuildReport is returned, which aggregates all of the problems that were found.
 func (b *builder) Build() (App, error) {
-	if err := b.validate(); err != nil {
-		return nil, err
+	// the builder is checked before the logger is initialized because profiles may configure the log settings
+	report := b.check()
+	// log events are streamed via the event stream HTTP endpoint
+	events := newEventStream()
+	writers := []io.Writer{b.logWriter, events}
+	var logSink *eventlog.Sink
+	if b.logSinkOpts != nil && !report.failed() {
+		sink, err := eventlog.NewSink(*b.logSinkOpts)
+		report.addErrors(InvalidOptsProblem, err)
+		if err == nil {
+			logSink = sink
+			writers = append(writers, sink)
+		}
+	}
+	var replay *replayBuffer
+	if b.replayBufferOpts != nil && !report.failed() {
+		replay = newReplayBuffer(*b.replayBufferOpts, b.instanceID)
+	}
+	var sampler *debugSampler
+	if b.debugSamplingOpts != nil && !report.failed() {
+		sampler = newDebugSampler(*b.debugSamplingOpts, b.clock)
+	}
+	// each app gets its own hook registry, i.e., hooks that are added at runtime do not leak into other apps
+	hooks := eventlog.NewHooks()
+	hooks.AddHook(b.logHooks...)
+	hooks.AddEventHook(b.logEventHooks...)
+	logger := b.initZerolog(io.MultiWriter(writers...), hooks, replay, sampler)
+	if replay != nil {
+		replay.logger = logger
+	}
+	if sampler != nil {
+		sampler.logger = logger
+	}
+	logInitFailed := func(report *BuildReport) {
+		logEvent := eventlog.NewLogger(InitFailedEvent, logger, zerolog.ErrorLevel)
+		logEvent(report, "app init failed")
+		dumpReplayBuffer(replay, ReplayInitFailed)
+		closeLogSink(logSink, b.stopTimeout)
+	}
+
+	if report.failed() {
+		logInitFailed(report)
+		return nil, report
 	}
 
 	var shutdowner fx.Shutdowner
-	var logger *zerolog.Logger
 	var readinessWaitGroup ReadinessWaitGroup
 	var dotGraph fx.DotGraph
-	b.populateTargets = append(b.populateTargets, &shutdowner, &logger, &readinessWaitGroup, &dotGraph)
+	var httpServerAddr HTTPServerAddr
+	var initErr error
+	var endpoints configuredHTTPEndpoints
+	var warmUp warmUpTasks
+	var bundle *supportBundle
+	var shutdown *shutdownState
+	var lifecycle *lifecycleMetrics
+	b.populateTargets = append(b.populateTargets, &shutdowner, &readinessWaitGroup, &dotGraph, &httpServerAddr, &warmUp, &bundle, &shutdown, &lifecycle)
+	if !b.disableHTTPServer {
+		b.populateTargets = append(b.populateTargets, &endpoints)
+	}
+	options, err := b.overrides.apply(b.options(logger, events))
+	if err != nil {
+		report := &BuildReport{}
+		report.addErrors(InvalidOverrideProblem, err)
+		logInitFailed(report)
+		return nil, report
+	}
+	options = append(options, fx.Provide(func() *eventlog.Hooks { return hooks }))
+	if logSink != nil {
+		options = append(options, fx.Invoke(registerLogSinkMetrics(logSink)))
+	}
+	if replay != nil {
+		options = append(options,
+			fx.Provide(func() ReplayBuffer { return replay }),
+			fx.Provide(replayBufferHTTPHandler(replay)),
+		)
+	}
+	if sampler != nil {
+		options = append(options,
+			fx.Provide(debugSamplingHTTPHandlers(sampler)),
+			fx.Invoke(sampler.endOnStop),
+		)
+	}
 	app := &app{
 		instanceID:   b.instanceID,
 		id:           b.id,
 		releaseID:    b.releaseID,
-		constructors: b.constructors,
-		funcs:        b.funcs,
+		desc:         b.desc(),
+		constructors: b.appConstructors(),
+		funcs:        b.appFuncs(),
+		clock:        b.clock,
+
+		warmUpTimeout: b.warmUpTimeout,
+		skipWarmUp:    b.skipWarmUp,
 
 		startErrorHandlers: b.startErrorHandlers,
 		stopErrorHandlers:  b.stopErrorHandlers,
@@ -175,7 +684,11 @@ func (b *builder) Build() (App, error) {
 		App: fx.New(
 			fx.StartTimeout(b.startTimeout),
 			fx.StopTimeout(b.stopTimeout),
-			fx.Options(b.options()...),
+			fx.Options(options...),
+			// the init error provides the app dependency graph, which is used to diagnose missing providers
+			fx.ErrorHook(errorHandler(func(err error) {
+				initErr = err
+			})),
 		),
 
 		Shutdowner: shutdowner,
@@ -190,45 +703,494 @@ func (b *builder) Build() (App, error) {
 	})
 
 	if err := app.Err(); err != nil {
-		return nil, err
+		report := &BuildReport{}
+		report.add(BuildProblem{Kind: InitErrorProblem, Msg: err.Error()})
+		if graph, e := fx.VisualizeError(initErr); e == nil {
+			report.checkProviders(fx.DotGraph(graph), b.appConstructors(), b.appFuncs())
+		}
+		logInitFailed(report)
+		return nil, report
 	}
 	app.logger = logger
 	app.readiness = readinessWaitGroup
+	app.warmUpTasks = warmUp.Tasks
+	app.dotGraph = dotGraph
+	app.httpServerAddr = httpServerAddr
+	app.events = events
+	app.logSink = logSink
+	app.replay = replay
+	app.config = b.effectiveConfig(endpoints)
+	bundle.config = app.config
+	app.bundle = bundle
+	shutdown.started = app.started
+	app.shutdownState = shutdown
+	app.lifecycleMetrics = lifecycle
 	app.logAppInitialized(dotGraph)
 	return app, nil
 }
 
-func (b *builder) validate() error {
-	if len(b.funcs) == 0 {
-		return errors.New("at least 1 functional option is required")
+// Validate builds the app dependency graph without running any constructors, app functions, or lifecycle hooks.
+func (b *builder) Validate() error {
+	if report := b.check(); report.failed() {
+		return report
+	}
+
+	logger := zerolog.Nop()
+	options, err := b.overrides.apply(b.options(&logger, newEventStream()))
+	if err != nil {
+		report := &BuildReport{}
+		report.addErrors(InvalidOverrideProblem, err)
+		return report
+	}
+	provides, invokes := dryRunOptions(options)
+	var dotGraph fx.DotGraph
+	var initErr error
+	app := fx.New(
+		fx.Options(provides...),
+		// the DOT graph is provided by fx, i.e., the app constructors are not run
+		fx.Invoke(func(graph fx.DotGraph) {
+			dotGraph = graph
+		}),
+		fx.ErrorHook(errorHandler(func(err error) {
+			initErr = err
+		})),
+	)
+	report := &BuildReport{}
+	if err := app.Err(); err != nil {
+		report.add(BuildProblem{Kind: InitErrorProblem, Msg: err.Error()})
+		if graph, e := fx.VisualizeError(initErr); e == nil {
+			report.checkProviders(fx.DotGraph(graph), b.appConstructors(), b.appFuncs())
+		}
+		return report
+	}
+	report.checkDependencies(NewDependencies(dotGraph), b.appConstructors(), invokes)
+	if report.failed() {
+		return report
 	}
 	return nil
 }
 
-// This is the key method used to compose the application options
-func (b *builder) options() []fx.Option {
-	logger := b.initZerolog()
+// check runs the checks that do not require the app dependency graph, i.e., the env vars, options, descriptor, and
+// the constructors and app functions are checked.
+func (b *builder) check() *BuildReport {
+	report := &BuildReport{}
+	// profiles and conditional options are applied first because they configure the builder
+	report.addErrors(InvalidOptsProblem, b.applyProfiles())
+	report.addErrors(InvalidOptsProblem, b.applyConditionals())
+	if b.instanceMetadataEnabled {
+		b.instanceMetadata = appdesc.LoadInstanceMetadata(b.envPrefix.String())
+	}
+	if b.profilingOpts == nil {
+		opts, err := loadProfilingOpts(b.envPrefix)
+		report.addErrors(InvalidOptsProblem, err)
+		if err == nil && opts.enabled() {
+			b.profilingOpts = &opts
+		}
+	}
+	if b.logSinkOpts == nil {
+		opts, err := loadLogSinkOpts(b.envPrefix)
+		report.addErrors(InvalidOptsProblem, err)
+		if err == nil && opts.URL != "" {
+			b.logSinkOpts = &opts
+		}
+	}
+	if !b.skipWarmUp {
+		skip, err := EnvFlag(b.envPrefix.EnvVar(warmUpSkipEnvName), false).Eval()
+		report.addErrors(InvalidOptsProblem, err)
+		b.skipWarmUp = skip
+	}
+	// fault injection can only be enabled via env vars
+	{
+		opts, err := loadFaultInjectionOpts(b.envPrefix)
+		report.addErrors(InvalidOptsProblem, err)
+		b.faultInjectionOpts = nil
+		if err == nil && opts.Enabled {
+			b.faultInjectionOpts = &opts
+		}
+	}
+	report.addErrors(InvalidOptsProblem, b.loadModuleToggles())
+	if b.validateDesc {
+		report.addErrors(InvalidDescProblem, b.desc().Validate())
+	}
+	report.addErrors(InvalidOptsProblem, b.validate())
+	report.checkFuncs(b.appConstructors(), b.appFuncs())
+	return report
+}
 
+func (b *builder) validate() error {
+	var err error
+	if len(b.appFuncs()) == 0 {
+		err = errors.New("at least 1 functional option is required")
+	}
+	if b.warmUpTimeout <= 0 {
+		err = multierr.Append(err, errors.New("warm-up timeout must be greater than 0"))
+	}
+	if b.slowHealthCheckThreshold <= 0 || b.slowHealthCheckThreshold > 1 {
+		err = multierr.Append(err, fmt.Errorf("%s : %v", ErrInvalidSlowHealthCheckThreshold, b.slowHealthCheckThreshold))
+	}
+	if b.resourceHealthCheckOpts != nil {
+		err = multierr.Append(err, b.resourceHealthCheckOpts.validate())
+	}
+	err = multierr.Append(err, b.overrides.validate())
+	for _, check := range b.errorRateHealthChecks {
+		err = multierr.Append(err, check.validate())
+	}
+	sloIDs := make(map[string]bool, len(b.slos))
+	for _, slo := range b.slos {
+		err = multierr.Append(err, slo.validate())
+		if sloIDs[slo.Check.ID] {
+			err = multierr.Append(err, fmt.Errorf("%s : duplicate SLO health check ID : %s", ErrInvalidSLO, slo.Check.ID))
+		}
+		sloIDs[slo.Check.ID] = true
+	}
+	dependencyIDs := make(map[string]bool, len(b.dependencies))
+	for _, dependency := range b.dependencies {
+		err = multierr.Append(err, dependency.validate())
+		if dependencyIDs[dependency.Check.ID] {
+			err = multierr.Append(err, fmt.Errorf("%s : duplicate dependency health check ID : %s", ErrInvalidDependency, dependency.Check.ID))
+		}
+		dependencyIDs[dependency.Check.ID] = true
+	}
+	fatalHealthCheckIDs := make(map[string]bool, len(b.fatalHealthChecks))
+	for _, check := range b.fatalHealthChecks {
+		err = multierr.Append(err, check.validate())
+		if fatalHealthCheckIDs[check.CheckID] {
+			err = multierr.Append(err, fmt.Errorf("%s : duplicate health check ID : %s", ErrInvalidFatalHealthCheck, check.CheckID))
+		}
+		fatalHealthCheckIDs[check.CheckID] = true
+	}
+	if b.clockSkewHealthCheckOpts != nil {
+		err = multierr.Append(err, b.clockSkewHealthCheckOpts.validate())
+	}
+	if b.faultInjectionOpts != nil {
+		err = multierr.Append(err, b.faultInjectionOpts.validate())
+	}
+	if b.debugDumpOpts != nil {
+		err = multierr.Append(err, b.debugDumpOpts.validate())
+	}
+	if b.debugSamplingOpts != nil {
+		err = multierr.Append(err, b.debugSamplingOpts.validate())
+	}
+	if b.heartbeatOpts != nil {
+		err = multierr.Append(err, b.heartbeatOpts.validate())
+	}
+	if b.profilingOpts != nil {
+		err = multierr.Append(err, b.profilingOpts.validate())
+	}
+	if b.logSinkOpts != nil {
+		err = multierr.Append(err, b.logSinkOpts.Validate())
+	}
+	if b.replayBufferOpts != nil {
+		err = multierr.Append(err, b.replayBufferOpts.validate())
+	}
+	if b.httpServerAddr != "" {
+		err = multierr.Append(err, validateHTTPServerAddr(b.httpServerAddr))
+	}
+	if b.adminAuthenticatorSet && b.adminAuthenticator == nil {
+		err = multierr.Append(err, ErrNilAdminAuthenticator)
+	}
+	if b.corsOpts != nil {
+		err = multierr.Append(err, b.corsOpts.validate())
+	}
+	if b.securityHeadersOpts != nil {
+		err = multierr.Append(err, b.securityHeadersOpts.validate())
+	}
+	if b.deadlineOpts != nil {
+		err = multierr.Append(err, b.deadlineOpts.validate())
+	}
+	err = multierr.Append(err, validateScopedConstructors(b.scoped))
+	if b.loadSheddingOpts != nil {
+		err = multierr.Append(err, b.loadSheddingOpts.validate())
+	}
+	if b.tenancyOpts != nil {
+		err = multierr.Append(err, b.tenancyOpts.validate())
+	}
+	err = multierr.Append(err, b.httpServerLimits.validate())
+	err = multierr.Append(err, b.kubernetesOpts.validate())
+	xrefIDs := make(map[string]bool, len(b.xrefs))
+	for _, x := range b.xrefs {
+		if e := x.validate(); e != nil {
+			err = multierr.Append(err, e)
+			continue
+		}
+		if xrefIDs[x.ID] {
+			err = multierr.Append(err, fmt.Errorf("%s : %s", ErrXRefAlreadyRegistered, x.ID))
+		}
+		xrefIDs[x.ID] = true
+	}
+	alertRuleNames := make(map[string]bool, len(b.alertRules))
+	for _, r := range b.alertRules {
+		if e := r.validate(); e != nil {
+			err = multierr.Append(err, e)
+			continue
+		}
+		if alertRuleNames[r.Name] {
+			err = multierr.Append(err, fmt.Errorf("%s : %s", ErrAlertRuleAlreadyRegistered, r.Name))
+		}
+		alertRuleNames[r.Name] = true
+	}
+	err = multierr.Append(err, b.envPrefix.validate())
+	envVarNames := make(map[string]bool, len(b.envVars))
+	for _, v := range b.envVars {
+		if strings.TrimSpace(v.Name) == "" {
+			err = multierr.Append(err, ErrEnvVarBlankName)
+			continue
+		}
+		if envVarNames[v.Name] {
+			err = multierr.Append(err, fmt.Errorf("%s : %s", ErrEnvVarAlreadyRegistered, v.Name))
+		}
+		envVarNames[v.Name] = true
+	}
+	componentIDs := make(map[string]bool, len(b.components))
+	for _, c := range b.components {
+		if e := c.validate(); e != nil {
+			err = multierr.Append(err, e)
+			continue
+		}
+		if componentIDs[c.ID] {
+			err = multierr.Append(err, fmt.Errorf("%s : %s : %s", ErrComponentAlreadyRegistered, c.ID, c.Name))
+		}
+		componentIDs[c.ID] = true
+	}
+	if err != nil {
+		return err
+	}
+	// component constraints are only checked if all components are valid
+	return checkComponentConstraints(b.components)
+}
+
+func (b *builder) desc() appdesc.Desc {
+	return appdesc.Desc{
+		ID:        ulid.ULID(b.id),
+		Name:      b.name,
+		Version:   b.version,
+		ReleaseID: ulid.ULID(b.releaseID),
+	}
+}
+
+// returns the app constructors, including the component constructors
+func (b *builder) appConstructors() []interface{} {
+	constructors := append([]interface{}{}, b.constructors...)
+	for _, c := range b.components {
+		constructors = append(constructors, c.Provide...)
+	}
+	return constructors
+}
+
+// returns the app functions in the order that they are invoked - component functions are invoked before the app functions
+func (b *builder) appFuncs() []interface{} {
+	var funcs []interface{}
+	for _, c := range b.components {
+		funcs = append(funcs, c.Invoke...)
+	}
+	return append(funcs, b.funcs...)
+}
+
+// This is the key method used to compose the application options
+func (b *builder) options(logger *zerolog.Logger, events *eventStream) []fx.Option {
 	compOptions := make([]fx.Option, 0, len(b.invokeErrorHandlers)+9)
 	compOptions = append(compOptions, fx.Provide(
 		func() (ID, ReleaseID, InstanceID, *zerolog.Logger) { return b.id, b.releaseID, b.instanceID, logger },
+		b.desc,
+		func() appdesc.InstanceMetadata { return b.instanceMetadata },
+		func() clock.Clock { return b.clock },
+		func() Profiles { return append(Profiles(nil), b.activeProfiles...) },
+		b.EnvPrefix,
+		func() adminAuthenticatorConfig { return b.adminAuthenticator },
+		func() adminAuthDisabledConfig { return adminAuthDisabledConfig(b.adminAuthDisabled) },
+		func() slowHealthCheckThreshold { return slowHealthCheckThreshold(b.slowHealthCheckThreshold) },
+		b.httpServerMiddleware,
+		func() httpServerLimits { return httpServerLimits(b.httpServerLimits) },
+		func() httpServerAddrConfig {
+			if b.httpServerAddr != "" {
+				return httpServerAddrConfig(b.httpServerAddr)
+			}
+			return httpServerAddrConfig(strings.TrimSpace(os.Getenv(b.envPrefix.EnvVar(httpServerAddrEnvName))))
+		},
+		newHTTPServerListener,
+		func() *eventStream { return events },
 
 		providePrometheusMetricsSupport,
-		newPrometheusHTTPHandler,
+		newPrometheusHTTPHandlers,
 
 		func() ReadinessWaitGroup { return NewReadinessWaitgroup(1) },
+		newReadinessProbe,
 		readinessProbeHTTPHandler,
 
 		livenessProbe,
 		livenessProbeHTTPHandler,
+
+		func() RegisteredComponents {
+			return func() []Component {
+				return append([]Component{}, b.components...)
+			}
+		},
+		componentsHTTPHandler,
+		func() RegisteredXRefs {
+			return func() []XRef {
+				return append([]XRef{}, b.xrefs...)
+			}
+		},
+		xrefsHTTPHandler,
+		func() RegisteredAlertRules {
+			return func() []AlertRule {
+				return append([]AlertRule{}, b.alertRules...)
+			}
+		},
+		alertRulesHTTPHandler,
+		grafanaDashboardHTTPHandler,
+		func() KubernetesOpts { return b.kubernetesOpts },
+		kubernetesManifestsHTTPHandler,
+		func() RegisteredEnvVars { return b.EnvCatalog },
+		helmValuesHTTPHandler,
+		healthCheckResultsHTTPHandler,
+		runHealthCheckHTTPHandler,
+		metricsCatalogHTTPHandler,
+		eventStreamHTTPHandler,
+		newSupportBundle,
+		supportBundleHTTPHandler,
+		newShutdownState,
+		newLifecycleMetrics,
+		provideRequestShutdown,
 	))
-	compOptions = append(compOptions, health.Module(health.DefaultOpts()))
+	if !b.adminUIDisabled {
+		compOptions = append(compOptions, fx.Provide(adminUIHTTPHandler))
+	}
+	healthOpts := health.DefaultOpts()
+	if b.faultInjectionOpts != nil {
+		injector := newFaultInjector(*b.faultInjectionOpts, b.clock)
+		healthOpts = healthOpts.SetInterceptor(injector.interceptHealthCheck)
+		compOptions = append(compOptions,
+			fx.Provide(
+				func() *faultInjector { return injector },
+				faultInjectionHTTPHandlers,
+			),
+			fx.Invoke(injector.registerLifecycleFaults),
+		)
+	}
+	compOptions = append(compOptions, health.Module(healthOpts))
+	if b.legacyShims {
+		compOptions = append(compOptions, legacyShims())
+	}
+	if len(b.deprecations) > 0 {
+		compOptions = append(compOptions, fx.Invoke(b.logDeprecations))
+	}
+	if b.loadSheddingOpts != nil {
+		compOptions = append(compOptions,
+			fx.Provide(newLoadShedder(*b.loadSheddingOpts, b.clock)),
+			fx.Invoke(runLoadShedder),
+		)
+	}
+	if b.debugDumpOpts != nil {
+		compOptions = append(compOptions, fx.Provide(debugDumpHTTPHandler(*b.debugDumpOpts)))
+	}
+	if b.heartbeatOpts != nil {
+		compOptions = append(compOptions, fx.Invoke(runHeartbeat(*b.heartbeatOpts)))
+	}
+	if b.shutdownEndpoint {
+		compOptions = append(compOptions, fx.Provide(shutdownHTTPHandler))
+	}
+	if len(b.fatalHealthChecks) > 0 {
+		checks := newFatalHealthChecks(b.fatalHealthChecks)
+		compOptions = append(compOptions,
+			fx.Provide(func() *fatalHealthChecks { return checks }),
+			fx.Invoke(runFatalHealthChecks),
+		)
+	}
+	if b.upgradeOpts != nil {
+		compOptions = append(compOptions,
+			upgrade.Module(*b.upgradeOpts),
+			fx.Provide(upgradeHTTPHandler),
+			fx.Invoke(notifyUpgradeReady),
+		)
+	}
+	if b.lockOpts != nil {
+		compOptions = append(compOptions, lock.Module(*b.lockOpts))
+	}
+	if b.idempotencyOpts != nil {
+		compOptions = append(compOptions, idempotency.Module(*b.idempotencyOpts))
+	}
+	if b.retryOpts != nil {
+		compOptions = append(compOptions, retry.Module(*b.retryOpts))
+	}
+	if b.outboxOpts != nil {
+		compOptions = append(compOptions, outbox.Module(*b.outboxOpts))
+	}
+	if b.consumerOpts != nil {
+		compOptions = append(compOptions, consumer.Module(*b.consumerOpts))
+	}
+	if b.kvOpts != nil {
+		compOptions = append(compOptions, kv.Module(*b.kvOpts))
+	}
+	if b.fileWatchOpts != nil {
+		compOptions = append(compOptions, filewatch.Module(*b.fileWatchOpts))
+	}
+	if b.dnsOpts != nil {
+		compOptions = append(compOptions, dns.Module(*b.dnsOpts))
+	}
+	if b.migrateOpts != nil {
+		compOptions = append(compOptions,
+			migrate.Module(*b.migrateOpts),
+			fx.Provide(migrationsHTTPHandler),
+		)
+	}
+	if b.tenancyOpts != nil {
+		compOptions = append(compOptions, fx.Provide(provideTenancy(*b.tenancyOpts), tenantHealthHTTPHandler))
+	}
+	if b.profilingOpts != nil {
+		if b.profilingOpts.PprofEndpoints {
+			compOptions = append(compOptions, fx.Provide(pprofHTTPHandlers))
+		}
+		if b.profilingOpts.PushURL != "" {
+			compOptions = append(compOptions, fx.Invoke(runProfilePusher(*b.profilingOpts)))
+		}
+	}
 	compOptions = append(compOptions, fx.Provide(b.constructors...))
+	if len(b.scoped) > 0 {
+		providers := newScopedProviders(b.scoped)
+		compOptions = append(compOptions,
+			fx.Provide(func() *scopedProviders { return providers }),
+			providers.options(),
+		)
+	}
+	for _, c := range b.components {
+		compOptions = append(compOptions, fx.Provide(c.constructors()...))
+	}
 	compOptions = append(compOptions, fx.Invoke(
 		handleHealthCheckRegistrations,
 		logHealthCheckResults,
+		logSlowHealthChecks,
+		registerHealthCheckQueueMetrics,
+		registerHealthCheckOrphanedMetric,
+		registerHealthCheckPanicsMetric,
+		registerAppReadyGauge,
+		registerShutdownMetrics,
+		registerLifecycleMetrics,
+		logComponentRegistrations,
 	))
+	for _, c := range b.components {
+		compOptions = append(compOptions, fx.Invoke(c.healthCheckFuncs()...))
+		compOptions = append(compOptions, fx.Invoke(c.funcs()...))
+	}
+	if b.resourceHealthCheckOpts != nil {
+		compOptions = append(compOptions, fx.Invoke(registerResourceHealthChecks(*b.resourceHealthCheckOpts)))
+	}
+	if len(b.errorRateHealthChecks) > 0 {
+		compOptions = append(compOptions, fx.Invoke(registerErrorRateHealthChecks(b.errorRateHealthChecks)))
+	}
+	if len(b.slos) > 0 {
+		compOptions = append(compOptions, fx.Invoke(registerSLOs(b.slos)))
+	}
+	if b.clockSkewHealthCheckOpts != nil {
+		compOptions = append(compOptions, fx.Invoke(registerClockSkewHealthCheck(*b.clockSkewHealthCheckOpts)))
+	}
 	compOptions = append(compOptions, fx.Invoke(b.funcs...))
+	// registered after the app functions because dependencies can be rolled up from the health checks that the app registers
+	if len(b.dependencies) > 0 {
+		compOptions = append(compOptions, fx.Invoke(registerRequiredDependencies(b.dependencies)))
+	}
+	// workers are started after the app functions' lifecycle hooks, i.e., after the resources they use are started
+	compOptions = append(compOptions, fx.Invoke(runWorkers))
 	compOptions = append(compOptions, fx.Invoke(healthCheckReadiness))
 
 	if !b.disableHTTPServer {
@@ -238,14 +1200,8 @@ func (b *builder) options() []fx.Option {
 	// configure fx logger
 	compOptions = append(compOptions, fx.Logger(newFxLogger(logger)))
 	// register error handlers
-	{
-		for _, f := range b.invokeErrorHandlers {
-			compOptions = append(compOptions, fx.ErrorHook(errorHandler(f)))
-		}
-		compOptions = append(compOptions, fx.ErrorHook(errorHandler(func(err error) {
-			logEvent := eventlog.NewLogger(InitFailedEvent, logger, zerolog.ErrorLevel)
-			logEvent(eventlog.NewError(err), "app init failed")
-		})))
+	for _, f := range b.invokeErrorHandlers {
+		compOptions = append(compOptions, fx.ErrorHook(errorHandler(f)))
 	}
 
 	return compOptions
@@ -258,24 +1214,38 @@ func (f errorHandler) HandleError(err error) {
 	f(err)
 }
 
-func providePrometheusMetricsSupport(id ID, releaseID ReleaseID, instanceID InstanceID) (prometheus.Gatherer, prometheus.Registerer) {
+type prometheusMetricsSupportParams struct {
+	fx.In
+
+	Desc             appdesc.Desc
+	InstanceID       InstanceID
+	InstanceMetadata appdesc.InstanceMetadata
+	LintOpts         *MetricLintOpts `optional:"true"`
+}
+
+// the provided registerer enforces the metric lint rules - the lint rules can be configured by providing MetricLintOpts
+func providePrometheusMetricsSupport(params prometheusMetricsSupportParams) (prometheus.Gatherer, prometheus.Registerer) {
 	registry := prometheus.NewRegistry()
-	regsisterer := prometheus.WrapRegistererWith(
-		prometheus.Labels{
-			AppIDLabel:         ulid.ULID(id).String(),
-			AppReleaseIDLabel:  ulid.ULID(releaseID).String(),
-			AppInstanceIDLabel: ulid.ULID(instanceID).String(),
-		},
-		registry,
-	)
+	labels := prometheus.Labels(params.Desc.Labels())
+	labels[AppInstanceIDLabel] = ulid.ULID(params.InstanceID).String()
+	for label, value := range params.InstanceMetadata.Labels() {
+		labels[label] = value
+	}
+	regsisterer := prometheus.WrapRegistererWith(labels, registry)
 	regsisterer.MustRegister(prometheus.NewGoCollector())
 
-	return registry, regsisterer
+	lintOpts := DefaultMetricLintOpts()
+	if params.LintOpts != nil {
+		lintOpts = *params.LintOpts
+	}
+	return registry, NewLintingRegisterer(regsisterer, lintOpts)
 }
 
 // - registers a lifecycle hook that waits until all health checks are run on app start up
 //   - the app is not ready to service requests until all health checks have been run and passed with a Green status
 //   - if any health checks fail to run on start up then the app will fail to start up
+//   - readiness health checks are skipped because they gate the readiness probe instead - see `ReadinessHealthCheckTag`
+//   - required dependencies are skipped because they are verified after the app is started - see `Dependency`
 func healthCheckReadiness(registeredChecks health.RegisteredChecks, checkResults health.CheckResults, wg ReadinessWaitGroup, lc fx.Lifecycle) {
 	wg.Add(1)
 	lc.Append(fx.Hook{
@@ -283,7 +1253,10 @@ func healthCheckReadiness(registeredChecks health.RegisteredChecks, checkResults
 			defer wg.Done()
 
 			var err error
-			for _, check := range <-registeredChecks() {
+			for _, check := range <-registeredChecks(health.Query{}) {
+				if isReadinessHealthCheck(check.Check) || hasHealthCheckTag(check.Check, DependencyHealthCheckTag) {
+					continue
+				}
 				if result := check.Checker(); result.Status != health.Green {
 					err = multierr.Combine(err, fmt.Errorf("health check failed: %s", check.ID), result.Err)
 				}
@@ -304,7 +1277,13 @@ func handleHealthCheckRegistrations(subscribeForRegisteredChecks health.Subscrib
 	logHealthCheckRegistered := eventlog.NewLogger(HealthCheckRegisteredEvent, logger, zerolog.NoLevel)
 	logHealthCheckGaugeRegistrationError := eventlog.NewLogger(HealthCheckGaugeRegistrationErrorEvent, logger, zerolog.ErrorLevel)
 	healthCheckRegistered := subscribeForRegisteredChecks()
+	// used to wait for the health check gauges to unsubscribe on stop - otherwise, the health service would wait for the
+	// gauges to receive their buffered results on shutdown
+	var gauges sync.WaitGroup
+	stopped := make(chan struct{})
 	go func() {
+		defer close(stopped)
+		defer healthCheckRegistered.Close()
 		for {
 			select {
 			case <-done:
@@ -312,7 +1291,7 @@ func handleHealthCheckRegistrations(subscribeForRegisteredChecks health.Subscrib
 			case registeredCheck, ok := <-healthCheckRegistered.Chan():
 				if ok {
 					logHealthCheckRegistered(&healthCheck{registeredCheck, nil}, "health check registered")
-					if err := registerHealthCheckGauge(done, registeredCheck, subscribeForCheckResults, checkResults, metricRegisterer); err != nil {
+					if err := registerHealthCheckGauge(done, &gauges, registeredCheck, subscribeForCheckResults, checkResults, metricRegisterer); err != nil {
 						// this should never happen
 						logHealthCheckGaugeRegistrationError(&healthCheck{registeredCheck, err}, "health check failed to register")
 					}
@@ -323,25 +1302,22 @@ func handleHealthCheckRegistrations(subscribeForRegisteredChecks health.Subscrib
 	lc.Append(fx.Hook{
 		OnStop: func(context.Context) error {
 			close(done)
+			<-stopped
+			gauges.Wait()
 			return nil
 		},
 	})
 }
 
-func logHealthCheckResults(subscribe health.SubscribeForCheckResults, logger *zerolog.Logger, lc fx.Lifecycle) {
-	done := make(chan struct{})
-	startHealthCheckLogger := startHealthCheckLoggerFunc(subscribe(nil), logger, done)
+// The health check results logger runs until the health service closes the subscription on shutdown, i.e., the results
+// of in-flight health checks that complete during shutdown are logged.
+func logHealthCheckResults(subscribe health.SubscribeForCheckResults, logger *zerolog.Logger) {
+	startHealthCheckLogger := startHealthCheckLoggerFunc(subscribe(nil), logger, nil)
 	go startHealthCheckLogger()
-	lc.Append(fx.Hook{
-		OnStop: func(context.Context) error {
-			close(done)
-			return nil
-		},
-	})
 }
 
 // Creates a function that starts up a listener on the  healthCheckResults channel. The listener stops when a signal
-// is received on the done channel. When a health check result message is received it logs it.
+// is received on the done channel or when the subscription is closed. When a health check result message is received it logs it.
 //
 // NOTE: this is extracted out in order to make it testable
 func startHealthCheckLoggerFunc(healthCheckResults health.CheckResultsSubscription, logger *zerolog.Logger, done <-chan struct{}) func() {
@@ -349,11 +1325,15 @@ func startHealthCheckLoggerFunc(healthCheckResults health.CheckResultsSubscripti
 	logYellowHealthCheck := eventlog.NewLogger(HealthCheckResultEvent, logger, zerolog.WarnLevel)
 	logRedHealthCheck := eventlog.NewLogger(HealthCheckResultEvent, logger, zerolog.ErrorLevel)
 	return func() {
+		defer healthCheckResults.Close()
 		for {
 			select {
 			case <-done:
 				return
-			case result := <-healthCheckResults.Chan():
+			case result, ok := <-healthCheckResults.Chan():
+				if !ok {
+					return
+				}
 				switch result.Status {
 				case health.Green:
 					logGreenHealthCheck(&healthCheckResult{result}, "health check is Green")
@@ -379,15 +1359,31 @@ func (l fxlogger) Printf(msg string, params ...interface{}) {
 	l.Log().Msgf(msg, params...)
 }
 
-func (b *builder) initZerolog() *zerolog.Logger {
+// initZerolog initializes the app logger. If the replay buffer is enabled, then it captures the events at all levels,
+// i.e., the app log level is applied to the log writer instead of globally. If debug sampling is enabled, then the
+// sampler applies the app log level to the log writer, plus it lets through the sampled debug events.
+func (b *builder) initZerolog(w io.Writer, hooks *eventlog.Hooks, replay *replayBuffer, sampler *debugSampler) *zerolog.Logger {
 	zerolog.SetGlobalLevel(b.globalLogLevel)
+	if sampler != nil {
+		sampler.Writer = w
+		sampler.min, sampler.restoreLevel = b.globalLogLevel, b.globalLogLevel
+		w = sampler
+	}
+	if replay != nil {
+		zerolog.SetGlobalLevel(zerolog.DebugLevel)
+		if sampler != nil {
+			sampler.restoreLevel = zerolog.DebugLevel
+		} else {
+			w = levelFilterWriter{Writer: w, min: b.globalLogLevel}
+		}
+		// the replay buffer is written first, i.e., an event is buffered by the time it is written to the log, and log
+		// writer failures do not prevent events from being buffered
+		w = zerolog.MultiLevelWriter(replay, w)
+	}
 
-	logger := eventlog.NewZeroLogger(b.logWriter).
-		With().
-		Str(AppIDLabel, ulid.ULID(b.id).String()).
-		Str(AppReleaseIDLabel, ulid.ULID(b.releaseID).String()).
-		Str(AppInstanceIDLabel, ulid.ULID(b.instanceID).String()).
-		Logger()
+	loggerContext := b.desc().WithLabels(eventlog.WithHooks(eventlog.NewZeroLogger(w), hooks).With()).
+		Str(AppInstanceIDLabel, ulid.ULID(b.instanceID).String())
+	logger := b.instanceMetadata.WithLabels(loggerContext).Logger()
 
 	// use the logger as the go standard log output
 	log.SetFlags(0)
@@ -406,6 +1402,65 @@ func (b *builder) SetStopTimeout(timeout time.Duration) Builder {
 	return b
 }
 
+func (b *builder) SetWarmUpTimeout(timeout time.Duration) Builder {
+	b.warmUpTimeout = timeout
+	return b
+}
+
+func (b *builder) SkipWarmUp() Builder {
+	b.skipWarmUp = true
+	return b
+}
+
+func (b *builder) SetClock(c clock.Clock) Builder {
+	b.clock = c
+	return b
+}
+
+func (b *builder) Replace(values ...interface{}) Builder {
+	for _, value := range values {
+		b.overrides.replacements = append(b.overrides.replacements, reflect.ValueOf(value))
+	}
+	return b
+}
+
+func (b *builder) ProvideScoped(constructors ...interface{}) Builder {
+	b.scoped = append(b.scoped, constructors...)
+	return b
+}
+
+func (b *builder) Decorate(decorators ...interface{}) Builder {
+	for _, decorator := range decorators {
+		b.overrides.decorators = append(b.overrides.decorators, reflect.ValueOf(decorator))
+	}
+	return b
+}
+
+func (b *builder) Apply(options ...BuilderOption) Builder {
+	for _, option := range options {
+		if option != nil {
+			option(b)
+		}
+	}
+	return b
+}
+
+func (b *builder) EnableIf(condition Condition, options ...BuilderOption) Builder {
+	b.conditionals = append(b.conditionals, conditional{condition: condition, options: options})
+	return b
+}
+
+func (b *builder) RegisterProfile(name string, options ...BuilderOption) Builder {
+	b.profiles = append(b.profiles, profile{name: name, options: options})
+	return b
+}
+
+func (b *builder) SetProfiles(names ...string) Builder {
+	b.profileNames = names
+	b.profileNamesSet = true
+	return b
+}
+
 func (b *builder) Provide(constructors ...interface{}) Builder {
 	b.constructors = append(b.constructors, constructors...)
 	return b
@@ -416,6 +1471,34 @@ func (b *builder) Invoke(funcs ...interface{}) Builder {
 	return b
 }
 
+func (b *builder) RegisterComponents(components ...Component) Builder {
+	b.components = append(b.components, components...)
+	return b
+}
+
+func (b *builder) RegisterXRefs(xrefs ...XRef) Builder {
+	b.xrefs = append(b.xrefs, xrefs...)
+	return b
+}
+
+func (b *builder) RegisterAlertRules(rules ...AlertRule) Builder {
+	b.alertRules = append(b.alertRules, rules...)
+	return b
+}
+
+func (b *builder) RegisterEnvVars(vars ...EnvVar) Builder {
+	b.envVars = append(b.envVars, vars...)
+	return b
+}
+
+func (b *builder) EnvCatalog() []EnvVar {
+	return envCatalog(b.envPrefix, b.envVars)
+}
+
+func (b *builder) EnvPrefix() EnvPrefix {
+	return EnvPrefix(b.envPrefix.String())
+}
+
 func (b *builder) Populate(targets ...interface{}) Builder {
 	b.populateTargets = append(b.populateTargets, targets...)
 	return b
@@ -453,7 +1536,292 @@ func (b *builder) LogLevel(level LogLevel) Builder {
 	return b
 }
 
+func (b *builder) LogHooks(hooks ...zerolog.Hook) Builder {
+	b.logHooks = append(b.logHooks, hooks...)
+	return b
+}
+
+func (b *builder) LogEventHooks(hooks ...eventlog.EventHook) Builder {
+	b.logEventHooks = append(b.logEventHooks, hooks...)
+	return b
+}
+
+func (b *builder) SetHTTPServerAddr(addr string) Builder {
+	b.httpServerAddr = strings.TrimSpace(addr)
+	return b
+}
+
 func (b *builder) DisableHTTPServer() Builder {
 	b.disableHTTPServer = true
 	return b
 }
+
+func (b *builder) EnableClockSkewHealthCheck(opts ClockSkewHealthCheckOpts) Builder {
+	b.clockSkewHealthCheckOpts = &opts
+	return b
+}
+
+func (b *builder) EnableResourceHealthChecks(opts ResourceHealthCheckOpts) Builder {
+	opts.FilesystemPaths = append([]string(nil), opts.FilesystemPaths...)
+	b.resourceHealthCheckOpts = &opts
+	return b
+}
+
+func (b *builder) EnableErrorRateHealthChecks(checks ...ErrorRateHealthCheck) Builder {
+	for _, check := range checks {
+		labels := make(map[string]string, len(check.Labels))
+		for k, v := range check.Labels {
+			labels[k] = v
+		}
+		check.Labels = labels
+		b.errorRateHealthChecks = append(b.errorRateHealthChecks, check)
+	}
+	return b
+}
+
+func (b *builder) RequireDependencies(dependencies ...Dependency) Builder {
+	for _, dependency := range dependencies {
+		dependency.Check.Tags = append([]string(nil), dependency.Check.Tags...)
+		b.dependencies = append(b.dependencies, dependency)
+	}
+	return b
+}
+
+func (b *builder) EnableSLOs(slos ...SLO) Builder {
+	copyLabels := func(labels map[string]string) map[string]string {
+		c := make(map[string]string, len(labels))
+		for k, v := range labels {
+			c[k] = v
+		}
+		return c
+	}
+	for _, slo := range slos {
+		if slo.Availability != nil {
+			sli := *slo.Availability
+			sli.TotalLabels = copyLabels(sli.TotalLabels)
+			sli.ErrorLabels = copyLabels(sli.ErrorLabels)
+			slo.Availability = &sli
+		}
+		if slo.Latency != nil {
+			sli := *slo.Latency
+			sli.Labels = copyLabels(sli.Labels)
+			slo.Latency = &sli
+		}
+		b.slos = append(b.slos, slo)
+	}
+	return b
+}
+
+func (b *builder) EnableDebugDumps(opts DebugDumpOpts) Builder {
+	b.debugDumpOpts = &opts
+	return b
+}
+
+func (b *builder) EnableDebugSampling(opts DebugSamplingOpts) Builder {
+	b.debugSamplingOpts = &opts
+	return b
+}
+
+func (b *builder) EnableHeartbeat(opts HeartbeatOpts) Builder {
+	b.heartbeatOpts = &opts
+	return b
+}
+
+func (b *builder) EnableShutdownEndpoint() Builder {
+	b.shutdownEndpoint = true
+	return b
+}
+
+func (b *builder) EnableFatalHealthChecks(checks ...FatalHealthCheck) Builder {
+	b.fatalHealthChecks = append(b.fatalHealthChecks, checks...)
+	return b
+}
+
+func (b *builder) EnableCORS(opts CORSOpts) Builder {
+	opts.AllowedOrigins = append([]string(nil), opts.AllowedOrigins...)
+	opts.AllowedMethods = append([]string(nil), opts.AllowedMethods...)
+	opts.AllowedHeaders = append([]string(nil), opts.AllowedHeaders...)
+	opts.ExposedHeaders = append([]string(nil), opts.ExposedHeaders...)
+	b.corsOpts = &opts
+	return b
+}
+
+func (b *builder) EnableSecurityHeaders(opts SecurityHeadersOpts) Builder {
+	b.securityHeadersOpts = &opts
+	return b
+}
+
+func (b *builder) EnableDeadlinePropagation(opts DeadlineOpts) Builder {
+	b.deadlineOpts = &opts
+	return b
+}
+
+func (b *builder) EnableLoadShedding(opts LoadSheddingOpts) Builder {
+	b.loadSheddingOpts = &opts
+	return b
+}
+
+func (b *builder) EnableRequestContext(opts RequestContextOpts) Builder {
+	b.requestContextOpts = &opts
+	return b
+}
+
+func (b *builder) EnableTenancy(opts TenancyOpts) Builder {
+	b.tenancyOpts = &opts
+	return b
+}
+
+// the security headers are set on all responses, including CORS preflight responses
+type httpServerMiddlewareParams struct {
+	fx.In
+
+	Logger        *zerolog.Logger
+	Tenancy       *tenancy         `optional:"true"`
+	FaultInjector *faultInjector   `optional:"true"`
+	LoadShedder   *loadShedder     `optional:"true"`
+	Scopes        *scopedProviders `optional:"true"`
+}
+
+func (b *builder) httpServerMiddleware(params httpServerMiddlewareParams) httpServerMiddleware {
+	var middleware httpServerMiddleware
+	if b.profilingOpts != nil {
+		middleware = append(middleware, newProfilerLabelsMiddleware(profilerLabels(b.id, b.releaseID, b.instanceID)))
+	}
+	if b.securityHeadersOpts != nil {
+		middleware = append(middleware, NewSecurityHeadersMiddleware(*b.securityHeadersOpts))
+	}
+	if b.corsOpts != nil {
+		middleware = append(middleware, NewCORSMiddleware(*b.corsOpts))
+	}
+	// requests are shed before any work is done on their behalf
+	if params.LoadShedder != nil {
+		middleware = append(middleware, params.LoadShedder.middleware)
+	}
+	if b.deadlineOpts != nil {
+		middleware = append(middleware, NewDeadlineMiddleware(*b.deadlineOpts, b.clock, params.Logger))
+	}
+	// the request context middleware is applied after the deadline middleware in order to capture the request deadline
+	if b.requestContextOpts != nil {
+		middleware = append(middleware, NewRequestContextMiddleware(*b.requestContextOpts))
+	}
+	// the tenant that is resolved via the TenantResolver overrides the request context tenant
+	if params.Tenancy != nil {
+		middleware = append(middleware, params.Tenancy.middleware)
+	}
+	// the request scope is created after the request context is established
+	if params.Scopes != nil {
+		middleware = append(middleware, params.Scopes.middleware)
+	}
+	// faults are injected after the request context is established, i.e., just before the request is routed
+	if params.FaultInjector != nil {
+		middleware = append(middleware, params.FaultInjector.middleware)
+	}
+	return middleware
+}
+
+func (b *builder) EnableUpgrades(opts upgrade.Opts) Builder {
+	opts.Signals = append([]os.Signal(nil), opts.Signals...)
+	b.upgradeOpts = &opts
+	return b
+}
+
+func (b *builder) EnableLogSink(opts eventlog.SinkOpts) Builder {
+	b.logSinkOpts = &opts
+	return b
+}
+
+func (b *builder) EnableReplayBuffer(opts ReplayBufferOpts) Builder {
+	b.replayBufferOpts = &opts
+	return b
+}
+
+func (b *builder) EnableProfiling(opts ProfilingOpts) Builder {
+	b.profilingOpts = &opts
+	return b
+}
+
+func (b *builder) EnableMigrations(opts migrate.Opts) Builder {
+	b.migrateOpts = &opts
+	return b
+}
+
+func (b *builder) EnableDistributedLocks(opts lock.Opts) Builder {
+	b.lockOpts = &opts
+	return b
+}
+
+func (b *builder) EnableOutboxRelay(opts outbox.Opts) Builder {
+	b.outboxOpts = &opts
+	return b
+}
+
+func (b *builder) EnableQueueConsumers(opts consumer.Opts) Builder {
+	b.consumerOpts = &opts
+	return b
+}
+
+func (b *builder) EnableIdempotency(opts idempotency.Opts) Builder {
+	b.idempotencyOpts = &opts
+	return b
+}
+
+func (b *builder) EnableRetries(opts retry.Opts) Builder {
+	b.retryOpts = &opts
+	return b
+}
+
+func (b *builder) EnableKVStore(opts kv.Opts) Builder {
+	b.kvOpts = &opts
+	return b
+}
+
+func (b *builder) EnableFileWatcher(opts filewatch.Opts) Builder {
+	b.fileWatchOpts = &opts
+	return b
+}
+
+func (b *builder) EnableDNSCache(opts dns.Opts) Builder {
+	b.dnsOpts = &opts
+	return b
+}
+
+func (b *builder) SetHTTPServerLimits(limits HTTPServerLimits) Builder {
+	b.httpServerLimits = limits
+	return b
+}
+
+func (b *builder) SetKubernetesOpts(opts KubernetesOpts) Builder {
+	b.kubernetesOpts = opts
+	return b
+}
+
+func (b *builder) SetSlowHealthCheckThreshold(threshold float64) Builder {
+	b.slowHealthCheckThreshold = threshold
+	return b
+}
+
+func (b *builder) SetAdminAuthenticator(authenticator Authenticator) Builder {
+	b.adminAuthenticator = authenticator
+	b.adminAuthenticatorSet = true
+	return b
+}
+
+func (b *builder) AllowUnauthenticatedAdmin() Builder {
+	b.adminAuthDisabled = true
+	return b
+}
+
+func (b *builder) EnableLegacyShims() Builder {
+	b.legacyShims = true
+	return b
+}
+
+func (b *builder) EnableInstanceMetadata() Builder {
+	b.instanceMetadataEnabled = true
+	return b
+}
+
+func (b *builder) SetEnvPrefix(prefix string) Builder {
+	b.envPrefix = EnvPrefix(prefix)
+	return b
+}
@@ -20,22 +20,54 @@ import (
 	"github.com/oysterpack/andiamo/pkg/fx/health"
 	"github.com/rs/zerolog"
 	"go.uber.org/fx"
+	"net"
 	"reflect"
 	"time"
 )
 
 // app lifecycle event IDs
 const (
+	// InitializedEvent data includes the effective resolved configuration, i.e., support can see exactly how an instance
+	// was configured from its first log line. Secret env var values are redacted - see `RedactedValue`.
+	//
 	// 	type Data struct {
 	//		StartTimeout 	uint `json:"start_timeout"`
 	//		StopTimeout  	uint `json:"stop_timeout"`
 	//		Provides     	[]string
 	//		Invokes      	[]string
 	//		DependencyGraph string `json:"dot_graph"` // DOT language visualization of the app dependency graph
+	//		Config struct {
+	//			Profiles   []string
+	//			Conditions map[string]bool // the evaluated `Builder.EnableIf()` conditions
+	//			Modules    []string        // the enabled optional modules
+	//			LogLevel   string `json:"log_level"`
+	//			// only logged if the HTTP server is enabled
+	//			HTTPServer struct {
+	//				// only logged if the address is configured via the builder or env
+	//				Addr                string
+	//				MaxRequestBodyBytes int64 `json:"max_request_body_bytes"`
+	//				ReadTimeout         uint  `json:"read_timeout"`
+	//				WriteTimeout        uint  `json:"write_timeout"`
+	//				IdleTimeout         uint  `json:"idle_timeout"`
+	//				Endpoints           []string
+	//			} `json:"http_server"`
+	//			Env map[string]string // APP12X env vars
+	//		}
 	//	}
 	InitializedEvent = "01DE4STZ0S24RG7R08PAY1RQX3"
+	// InitFailedEvent data is the `BuildReport`, i.e., all of the problems that were found when building the app
+	//
 	// 	type Data struct {
 	//		Err string `json:"e"`
+	//		Problems []struct{
+	//			// see BuildProblemKind
+	//			Kind string `json:"kind"`
+	//			Msg  string `json:"msg"`
+	//			// the constructor or app function name and source position, i.e., "file:line"
+	//			Func string `json:"func"`
+	//			Pos  string `json:"pos"`
+	//			Type string `json:"type"`
+	//		} `json:"problems"`
 	//	}
 	InitFailedEvent = "01DE4SWMZXD1ZB40QRT7RGQVPN"
 
@@ -47,11 +79,22 @@ const (
 
 	// 	type Data struct {
 	//		Duration uint
+	//		// the address that the HTTP server is bound to - only logged if the HTTP server is running
+	//		HTTPServerAddr string `json:"http_server_addr"`
 	//	}
 	StartedEvent = "01DE4X10QCV1M8TKRNXDK6AK7C"
 
 	ReadyEvent = "01DEJ5RA8XRZVECJDJFAA2PWJF"
 
+	// 	type Data struct {
+	//		// see `ShutdownReason`
+	//		Reason struct {
+	//			Code   string `json:"code"`
+	//			// only logged if the shutdown was triggered by a signal
+	//			Signal string `json:"signal"`
+	//			Msg    string `json:"msg"`
+	//		} `json:"reason"`
+	//	}
 	StoppingEvent = "01DE4SZ1KY60JQTF7XP4DQ8WGC"
 	// 	type Data struct {
 	//		Err string `json:"e"`
@@ -60,6 +103,8 @@ const (
 
 	// 	type Data struct {
 	//		Duration uint
+	//		// see `StoppingEvent`
+	//		Reason struct{...} `json:"reason"`
 	//	}
 	StoppedEvent = "01DE4T1V9N50BB67V424S6MG5C"
 )
@@ -67,6 +112,7 @@ const (
 type appInfo struct {
 	App
 	fx.DotGraph
+	config effectiveConfig
 }
 
 // MarshalZerologObject implements zerolog.LogObjectMarshaler interface
@@ -85,6 +131,7 @@ func (event appInfo) MarshalZerologObject(e *zerolog.Event) {
 	e.Strs("provides", typeNames(event.App.ConstructorTypes()))
 	e.Strs("invokes", typeNames(event.App.FuncTypes()))
 	e.Str("dot_graph", string(event.DotGraph))
+	e.Object("config", event.config)
 }
 
 type duration time.Duration
@@ -94,6 +141,39 @@ func (d duration) MarshalZerologObject(e *zerolog.Event) {
 	e.Dur("duration", time.Duration(d))
 }
 
+type appStarted struct {
+	duration       time.Duration
+	httpServerAddr net.Addr
+}
+
+// MarshalZerologObject implements zerolog.LogObjectMarshaler interface
+func (e appStarted) MarshalZerologObject(event *zerolog.Event) {
+	event.Dur("duration", e.duration)
+	if e.httpServerAddr != nil {
+		event.Str("http_server_addr", e.httpServerAddr.String())
+	}
+}
+
+type appStopping struct {
+	reason ShutdownReason
+}
+
+// MarshalZerologObject implements zerolog.LogObjectMarshaler interface
+func (e appStopping) MarshalZerologObject(event *zerolog.Event) {
+	event.Object("reason", e.reason)
+}
+
+type appStopped struct {
+	duration time.Duration
+	reason   ShutdownReason
+}
+
+// MarshalZerologObject implements zerolog.LogObjectMarshaler interface
+func (e appStopped) MarshalZerologObject(event *zerolog.Event) {
+	event.Dur("duration", e.duration)
+	event.Object("reason", e.reason)
+}
+
 // health check related events
 const (
 	//  sample event data:
@@ -112,11 +192,31 @@ const (
 	//  {
 	//    "id": "01DF3MNDKPB69AJR7ZGDNB3KA1",
 	//	  "t": 155454546546,
-	//	  "d": 9
+	//	  "d": 9,
+	//	  "details": {"endpoint": "https://api.example.com", "error_class": "timeout"}
 	//  }
+	//
+	//  details are only logged if the checker reported them - see `health.SetDetail()`
 	HealthCheckResultEvent = "01DF3X60Z7XFYVVXGE9TFFQ7Z1"
 
 	HealthCheckGaugeRegistrationErrorEvent = "01DF6M0T7K3DNSFMFQ26TM7XX4"
+
+	// Logged as a warning when a health check run duration exceeds the slow health check threshold percentage of its
+	// timeout, e.g., 80% - see `Builder.SetSlowHealthCheckThreshold()`. Timed out runs are not logged as slow.
+	// The duration percentiles are computed from the recent health check run durations.
+	//
+	//  sample event data:
+	//  {
+	//    "id": "01DF3MNDKPB69AJR7ZGDNB3KA1",
+	//    "dur": 4200,
+	//    "timeout": 5000,
+	//    "timeout_pct": 84,
+	//    "p50": 1200,
+	//    "p90": 3900,
+	//    "p99": 4200,
+	//    "samples": 32
+	//  }
+	HealthCheckSlowEvent = "01DHPNVKM0F5JFNBSW5CZRT24Z"
 )
 
 type healthCheck struct {
@@ -150,6 +250,9 @@ func (h *healthCheckResult) MarshalZerologObject(e *zerolog.Event) {
 	if h.Err != nil {
 		e.Err(h.Err)
 	}
+	if len(h.Details) > 0 {
+		e.Dict("details", zerolog.Dict().Fields(h.Details))
+	}
 }
 
 // probe related events
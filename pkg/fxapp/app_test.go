@@ -23,13 +23,22 @@ import (
 	"encoding/json"
 	"errors"
 	"fmt"
+	"github.com/blang/semver"
 	"github.com/oklog/ulid"
+	"github.com/oysterpack/andiamo/pkg/appdesc"
+	"github.com/oysterpack/andiamo/pkg/clock"
+	"github.com/oysterpack/andiamo/pkg/eventlog"
+	"github.com/oysterpack/andiamo/pkg/fx/health"
 	"github.com/oysterpack/andiamo/pkg/fxapp"
 	"github.com/oysterpack/andiamo/pkg/fxapptest"
 	"github.com/oysterpack/andiamo/pkg/ulids"
+	"github.com/prometheus/client_golang/prometheus"
 	"github.com/rs/zerolog"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
 	"go.uber.org/fx"
 	"log"
+	"os"
 	"reflect"
 	"strings"
 	"testing"
@@ -262,6 +271,105 @@ func TestBuildingAppWithNoDesc(t *testing.T) {
 	}
 }
 
+func TestNewBuilderFromDesc(t *testing.T) {
+	t.Parallel()
+
+	desc := appdesc.Desc{
+		ID:        ulids.MustNew(),
+		Name:      "foo",
+		Version:   semver.MustParse("1.2.3"),
+		ReleaseID: ulids.MustNew(),
+	}
+
+	t.Run("with valid desc", func(t *testing.T) {
+		buf := fxapptest.NewSyncLog()
+		var providedDesc appdesc.Desc
+		var gatherer prometheus.Gatherer
+		app, err := fxapp.NewBuilderFromDesc(desc).
+			Invoke(func(logger *zerolog.Logger) {
+				logger.Info().Msg("foo")
+			}).
+			LogWriter(buf).
+			Populate(&providedDesc, &gatherer).
+			DisableHTTPServer().
+			Build()
+		require.NoError(t, err)
+
+		assert.Equal(t, desc, app.Desc())
+		assert.Equal(t, fxapp.ID(desc.ID), app.ID())
+		assert.Equal(t, desc, providedDesc)
+
+		// Then the descriptor fields are added to log events
+		type LogEvent struct {
+			ID        string `json:"a"`
+			Name      string `json:"an"`
+			Version   string `json:"av"`
+			ReleaseID string `json:"r"`
+		}
+		var logEvent LogEvent
+		line, err := bufio.NewReader(buf).ReadString('\n')
+		require.NoError(t, err)
+		require.NoError(t, json.Unmarshal([]byte(line), &logEvent))
+		assert.Equal(t, LogEvent{desc.ID.String(), "foo", "1.2.3", desc.ReleaseID.String()}, logEvent)
+
+		// And to metric labels
+		mfs, err := gatherer.Gather()
+		require.NoError(t, err)
+		labels := make(map[string]string)
+		for _, label := range mfs[0].Metric[0].Label {
+			labels[label.GetName()] = label.GetValue()
+		}
+		for k, v := range desc.Labels() {
+			assert.Equal(t, v, labels[k])
+		}
+	})
+
+	t.Run("with invalid desc", func(t *testing.T) {
+		_, err := fxapp.NewBuilderFromDesc(appdesc.Desc{ID: desc.ID, ReleaseID: desc.ReleaseID}).
+			Invoke(func() {}).
+			DisableHTTPServer().
+			Build()
+		require.Error(t, err)
+		assert.Contains(t, err.Error(), appdesc.ErrBlankName.Error())
+	})
+}
+
+func TestBuilder_EnableInstanceMetadata(t *testing.T) {
+	t.Parallel()
+
+	hostname, err := os.Hostname()
+	require.NoError(t, err)
+
+	buf := fxapptest.NewSyncLog()
+	var gatherer prometheus.Gatherer
+	var metadata appdesc.InstanceMetadata
+	_, err = fxapp.NewBuilder(fxapp.ID(ulids.MustNew()), fxapp.ReleaseID(ulids.MustNew())).
+		Invoke(func() {}).
+		LogWriter(buf).
+		Populate(&gatherer, &metadata).
+		EnableInstanceMetadata().
+		DisableHTTPServer().
+		Build()
+	require.NoError(t, err)
+	assert.Equal(t, hostname, metadata.Hostname)
+
+	// Then the instance metadata is added to log events
+	line, err := bufio.NewReader(buf).ReadString('\n')
+	require.NoError(t, err)
+	assert.Contains(t, line, fmt.Sprintf("%q:%q", appdesc.HostnameLabel, hostname))
+
+	// And to metric labels
+	mfs, err := gatherer.Gather()
+	require.NoError(t, err)
+	var hostLabel string
+	for _, label := range mfs[0].Metric[0].Label {
+		if label.GetName() == appdesc.HostnameLabel {
+			hostLabel = label.GetValue()
+		}
+	}
+	assert.Equal(t, hostname, hostLabel)
+}
+
 func checkConstructorsAreRegistered(t *testing.T, app fxapp.App, constructors ...interface{}) {
 Loop:
 	for _, c := range constructors {
@@ -686,6 +794,73 @@ func TestAppDefaultTimeouts(t *testing.T) {
 	}
 }
 
+func TestAppBuilder_SetClock(t *testing.T) {
+	t.Parallel()
+
+	t.Run("clock is provided and used by the health service", func(t *testing.T) {
+		t.Parallel()
+		fakeClock := clock.NewFake(time.Date(2019, time.September, 1, 0, 0, 0, 0, time.UTC))
+		var appClock clock.Clock
+		var checkResults health.CheckResults
+		app, err := fxapp.NewBuilder(fxapp.ID(ulids.MustNew()), fxapp.ReleaseID(ulids.MustNew())).
+			SetClock(fakeClock).
+			Invoke(func(register health.Register) error {
+				return register(health.Check{ID: ulids.MustNew().String(), Description: "Foo", RedImpact: "none"}, health.CheckerOpts{}, func(ctx context.Context) (health.Status, error) {
+					return health.Green, nil
+				})
+			}).
+			Populate(&appClock, &checkResults).
+			DisableHTTPServer().
+			Build()
+		require.NoError(t, err)
+		assert.True(t, appClock == fakeClock)
+
+		go app.Run()
+		<-app.Ready()
+		defer func() {
+			app.Shutdown()
+			<-app.Done()
+		}()
+
+		results := <-checkResults(nil, health.Query{})
+		require.Len(t, results, 1)
+		assert.Equal(t, fakeClock.Now(), results[0].Time)
+		assert.Zero(t, results[0].Duration)
+	})
+
+	t.Run("app start timeout is measured by the clock", func(t *testing.T) {
+		t.Parallel()
+		fakeClock := clock.NewFake(time.Now())
+		app, err := fxapp.NewBuilder(fxapp.ID(ulids.MustNew()), fxapp.ReleaseID(ulids.MustNew())).
+			SetClock(fakeClock).
+			SetStartTimeout(time.Minute).
+			Invoke(func(lc fx.Lifecycle) {
+				lc.Append(fx.Hook{
+					OnStart: func(ctx context.Context) error {
+						<-ctx.Done()
+						return ctx.Err()
+					},
+				})
+			}).
+			DisableHTTPServer().
+			Build()
+		require.NoError(t, err)
+
+		runErr := make(chan error, 1)
+		go func() { runErr <- app.Run() }()
+		// wait for the app start timeout timer
+		fakeClock.BlockUntil(1)
+		fakeClock.Advance(time.Minute)
+		select {
+		case err := <-runErr:
+			assert.Error(t, err)
+			assert.Contains(t, err.Error(), context.DeadlineExceeded.Error())
+		case <-time.After(5 * time.Second):
+			t.Fatal("*** app start did not time out")
+		}
+	})
+}
+
 // app can populate targets with values from the dependency injection container
 func TestPopulate(t *testing.T) {
 	var shutdowner fx.Shutdowner
@@ -874,6 +1049,48 @@ func TestAppBuilder_LogLevel(t *testing.T) {
 // zerolog is used for go standard logging
 // - the events are logged with no level
 // - with component field set to "log"
+func TestAppBuilder_LogHooks(t *testing.T) {
+	t.Parallel()
+
+	const TraceEvent = "01DQ7ZB1K6W8R3N5X2T9VJ4HCA"
+	counts := make(map[string]int)
+	logs := fxapptest.NewLogCapture()
+	_, err := fxapp.NewBuilder(fxapp.ID(ulids.MustNew()), fxapp.ReleaseID(ulids.MustNew())).
+		LogWriter(logs).
+		LogHooks(zerolog.HookFunc(func(e *zerolog.Event, level zerolog.Level, msg string) {
+			e.Str("trace_id", "4bf92f3577b34da6")
+		})).
+		LogEventHooks(func(e *zerolog.Event, level zerolog.Level, event, msg string) {
+			counts[event]++
+		}).
+		Invoke(func(logger *zerolog.Logger, hooks *eventlog.Hooks) {
+			// hooks can be added at runtime
+			hooks.AddHook(zerolog.HookFunc(func(e *zerolog.Event, level zerolog.Level, msg string) {
+				e.Bool("runtime_hook", true)
+			}))
+			logEvent := eventlog.NewLogger(TraceEvent, logger, zerolog.InfoLevel)
+			logEvent(nil, "trace")
+		}).
+		Build()
+	require.NoError(t, err)
+
+	fxapptest.AssertEventLogged(t, logs, TraceEvent, fxapptest.Field("trace_id", "4bf92f3577b34da6"), fxapptest.Field("runtime_hook", true))
+	fxapptest.AssertEventLogged(t, logs, fxapp.InitializedEvent, fxapptest.Field("trace_id", "4bf92f3577b34da6"))
+	assert.Equal(t, 1, counts[TraceEvent])
+	assert.Equal(t, 1, counts[fxapp.InitializedEvent])
+
+	// hooks are scoped to the app
+	otherLogs := fxapptest.NewLogCapture()
+	_, err = fxapp.NewBuilder(fxapp.ID(ulids.MustNew()), fxapp.ReleaseID(ulids.MustNew())).
+		LogWriter(otherLogs).
+		Invoke(func() {}).
+		Build()
+	require.NoError(t, err)
+	fxapptest.AssertEventLogged(t, otherLogs, fxapp.InitializedEvent)
+	fxapptest.AssertEventNotLogged(t, otherLogs, fxapp.InitializedEvent, fxapptest.FieldExists("trace_id"))
+	assert.Equal(t, 1, counts[fxapp.InitializedEvent])
+}
+
 func TestGoStandardLogUsesZeroLog(t *testing.T) {
 	msg := ulids.MustNew().String()
 	buf := fxapptest.NewSyncLog()
@@ -0,0 +1,352 @@
+/*
+ * Copyright (c) 2019 OysterPack, Inc.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ * http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package fxapp
+
+import (
+	"fmt"
+	"github.com/rs/zerolog"
+	"go.uber.org/fx"
+	"go.uber.org/multierr"
+	"reflect"
+	"runtime"
+	"strings"
+)
+
+// BuildProblemKind classifies app build problems
+type BuildProblemKind string
+
+// build problem kinds
+const (
+	// InvalidOptsProblem means the builder options are invalid
+	InvalidOptsProblem BuildProblemKind = "invalid_opts"
+	// InvalidDescProblem means the app descriptor is invalid
+	InvalidDescProblem BuildProblemKind = "invalid_desc"
+	// InvalidFuncProblem means a constructor or app function is not a function
+	InvalidFuncProblem BuildProblemKind = "invalid_func"
+	// DuplicateProviderProblem means a type is provided by more than 1 constructor
+	DuplicateProviderProblem BuildProblemKind = "duplicate_provider"
+	// MissingProviderProblem means a constructor or app function depends on a type that is not provided
+	MissingProviderProblem BuildProblemKind = "missing_provider"
+	// InvalidOverrideProblem means a replaced or decorated type is not provided - see `Builder.Replace()` and
+	// `Builder.Decorate()`
+	InvalidOverrideProblem BuildProblemKind = "invalid_override"
+	// InitErrorProblem is the error that failed the app initialization, e.g., a constructor or app function failed
+	InitErrorProblem BuildProblemKind = "init_error"
+)
+
+// BuildProblem describes a problem that was found while building the app
+type BuildProblem struct {
+	Kind BuildProblemKind
+	Msg  string
+	// Func is the name of the constructor or app function that the problem relates to, if any
+	Func string
+	// Pos is the Func source position, i.e., "file:line"
+	Pos string
+	// Type is the dependency injection type that the problem relates to, if any
+	Type string
+}
+
+func (p BuildProblem) String() string {
+	s := fmt.Sprintf("%s : %s", p.Kind, p.Msg)
+	switch {
+	case p.Pos != "":
+		s = fmt.Sprintf("%s : %s (%s)", s, p.Func, p.Pos)
+	case p.Func != "":
+		s = fmt.Sprintf("%s : %s", s, p.Func)
+	}
+	return s
+}
+
+// MarshalZerologObject implements zerolog.LogObjectMarshaler
+func (p BuildProblem) MarshalZerologObject(e *zerolog.Event) {
+	e.Str("kind", string(p.Kind)).Str("msg", p.Msg)
+	if p.Func != "" {
+		e.Str("func", p.Func)
+	}
+	if p.Pos != "" {
+		e.Str("pos", p.Pos)
+	}
+	if p.Type != "" {
+		e.Str("type", p.Type)
+	}
+}
+
+// BuildReport is the error that is returned by `Builder.Build()` when the app fails to build. Instead of surfacing only
+// the first error, the report aggregates all of the problems that were found, i.e., invalid options, invalid app
+// descriptor, duplicate provisions, and missing providers. Dependency problems are reported with the constructor or app
+// function source positions.
+//
+// Problems are reported in a deterministic order, i.e., in the order that the options, constructors, and app functions
+// were registered. The report is logged as the `InitFailedEvent` data.
+type BuildReport struct {
+	Problems []BuildProblem
+}
+
+func (r *BuildReport) Error() string {
+	s := new(strings.Builder)
+	fmt.Fprintf(s, "app build failed: %d problem(s)", len(r.Problems))
+	for _, p := range r.Problems {
+		s.WriteString("\n  - ")
+		s.WriteString(p.String())
+	}
+	return s.String()
+}
+
+// MarshalZerologObject implements zerolog.LogObjectMarshaler
+func (r *BuildReport) MarshalZerologObject(e *zerolog.Event) {
+	e.Str(zerolog.ErrorFieldName, r.Error()).Array("problems", buildProblems(r.Problems))
+}
+
+type buildProblems []BuildProblem
+
+func (problems buildProblems) MarshalZerologArray(a *zerolog.Array) {
+	for _, p := range problems {
+		a.Object(p)
+	}
+}
+
+func (r *BuildReport) failed() bool {
+	return len(r.Problems) > 0
+}
+
+func (r *BuildReport) add(p BuildProblem) {
+	for _, problem := range r.Problems {
+		if problem == p {
+			return
+		}
+	}
+	r.Problems = append(r.Problems, p)
+}
+
+// addErrors adds each error that is combined in err as a separate problem
+func (r *BuildReport) addErrors(kind BuildProblemKind, err error) {
+	for _, e := range multierr.Errors(err) {
+		r.add(BuildProblem{Kind: kind, Msg: e.Error()})
+	}
+}
+
+// buildFunc is a constructor or app function, described via reflection
+type buildFunc struct {
+	name    string
+	pos     string
+	params  []Param
+	results []Type
+}
+
+func (f buildFunc) problem(kind BuildProblemKind, t Type, msg string) BuildProblem {
+	return BuildProblem{Kind: kind, Msg: msg, Func: f.name, Pos: f.pos, Type: t.String()}
+}
+
+var fxOutType = reflect.TypeOf(fx.Out{})
+
+// newBuildFunc returns false if f is not a function
+func newBuildFunc(f interface{}) (buildFunc, bool) {
+	var annotation fx.Annotated
+	if annotated, ok := f.(fx.Annotated); ok {
+		annotation = annotated
+		f = annotated.Target
+	}
+	funcValue := reflect.ValueOf(f)
+	if funcValue.Kind() != reflect.Func {
+		return buildFunc{}, false
+	}
+	fn := newFunc(f)
+	bf := buildFunc{name: fn.Name, params: fn.Params}
+	if pc := runtime.FuncForPC(funcValue.Pointer()); pc != nil {
+		file, line := pc.FileLine(pc.Entry())
+		bf.pos = fmt.Sprintf("%s:%d", file, line)
+	}
+	funcType := funcValue.Type()
+	for i := 0; i < funcType.NumOut(); i++ {
+		for _, t := range results(funcType.Out(i)) {
+			if annotation.Name != "" {
+				t.Name = annotation.Name
+			}
+			if annotation.Group != "" {
+				t.Group = annotation.Group
+			}
+			bf.results = append(bf.results, t)
+		}
+	}
+	return bf, true
+}
+
+// expands result objects, i.e., structs that embed fx.Out - errors are not results
+func results(t reflect.Type) []Type {
+	if t == errorType {
+		return nil
+	}
+	if !isResultObject(t) {
+		return []Type{{Type: t.String()}}
+	}
+	var types []Type
+	for i := 0; i < t.NumField(); i++ {
+		field := t.Field(i)
+		if field.Anonymous && field.Type == fxOutType {
+			continue
+		}
+		if isResultObject(field.Type) {
+			types = append(types, results(field.Type)...)
+			continue
+		}
+		types = append(types, Type{
+			Type:  field.Type.String(),
+			Name:  field.Tag.Get("name"),
+			Group: field.Tag.Get("group"),
+		})
+	}
+	return types
+}
+
+func isResultObject(t reflect.Type) bool {
+	if t.Kind() != reflect.Struct {
+		return false
+	}
+	for i := 0; i < t.NumField(); i++ {
+		field := t.Field(i)
+		if field.Anonymous && field.Type == fxOutType {
+			return true
+		}
+	}
+	return false
+}
+
+// checkFuncs checks that the constructors and app functions are functions, and that the constructors do not provide the
+// same types. These problems are found before the app is initialized.
+func (r *BuildReport) checkFuncs(constructors, funcs []interface{}) {
+	providers := make(map[Type]buildFunc)
+	for _, c := range constructors {
+		f, ok := newBuildFunc(c)
+		if !ok {
+			r.add(BuildProblem{Kind: InvalidFuncProblem, Msg: fmt.Sprintf("constructor must be a function : %T", c)})
+			continue
+		}
+		for _, t := range f.results {
+			// value groups support multiple providers
+			if t.Group != "" {
+				continue
+			}
+			if provider, ok := providers[t]; ok {
+				r.add(f.problem(DuplicateProviderProblem, t, fmt.Sprintf("%s is already provided by %s (%s)", t, provider.name, provider.pos)))
+				continue
+			}
+			providers[t] = f
+		}
+	}
+	for _, fn := range funcs {
+		if _, ok := newBuildFunc(fn); !ok {
+			r.add(BuildProblem{Kind: InvalidFuncProblem, Msg: fmt.Sprintf("app function must be a function : %T", fn)})
+		}
+	}
+}
+
+// checkProviders checks that the types that the constructors and app functions depend on are provided by the app
+// dependency graph.
+func (r *BuildReport) checkProviders(dotGraph fx.DotGraph, constructors, funcs []interface{}) {
+	provided := make(map[Type]bool)
+	for _, t := range NewDependencies(dotGraph).Provided() {
+		provided[t] = true
+	}
+	for _, f := range append(append([]interface{}(nil), constructors...), funcs...) {
+		bf, ok := newBuildFunc(f)
+		if !ok {
+			continue
+		}
+		for _, p := range bf.params {
+			// value groups may be empty
+			if p.Optional || p.Group != "" || provided[p.Type] {
+				continue
+			}
+			r.add(bf.problem(MissingProviderProblem, p.Type, fmt.Sprintf("%s is not provided", p.Type)))
+		}
+	}
+}
+
+// dryRunOptions splits the options into the invoked functions and the remaining options, which provide the app
+// dependency graph. The error hooks are dropped because nothing is invoked.
+//
+// NOTE: fx does not expose its option types, i.e., the options are inspected via reflection.
+func dryRunOptions(options []fx.Option) (provides []fx.Option, invokes []interface{}) {
+	for _, option := range options {
+		value := reflect.ValueOf(option)
+		switch value.Type().String() {
+		case "fx.optionGroup":
+			group := make([]fx.Option, value.Len())
+			for i := range group {
+				group[i] = value.Index(i).Interface().(fx.Option)
+			}
+			groupProvides, groupInvokes := dryRunOptions(group)
+			provides = append(provides, groupProvides...)
+			invokes = append(invokes, groupInvokes...)
+		case "fx.invokeOption":
+			for i := 0; i < value.Len(); i++ {
+				invokes = append(invokes, value.Index(i).Interface())
+			}
+		case "fx.errorHookOption":
+		default:
+			provides = append(provides, option)
+		}
+	}
+	return provides, invokes
+}
+
+// checkDependencies checks that the dependencies of the invoked functions are provided, transitively, i.e., only the
+// constructors that would be run when the app is built are checked.
+func (r *BuildReport) checkDependencies(deps *Dependencies, constructors, funcs []interface{}) {
+	// source positions are only known for the app constructors
+	positions := make(map[string]string)
+	for _, c := range constructors {
+		if f, ok := newBuildFunc(c); ok {
+			positions[f.name] = f.pos
+		}
+	}
+	providers := make(map[Type][]*Constructor)
+	for _, c := range deps.Constructors {
+		for _, t := range c.Results {
+			providers[t] = append(providers[t], c)
+		}
+	}
+
+	checked := make(map[*Constructor]bool)
+	var check func(name, pos string, params []Param)
+	check = func(name, pos string, params []Param) {
+		for _, p := range params {
+			ps := providers[p.Type]
+			// value groups may be empty
+			if len(ps) == 0 && !p.Optional && p.Group == "" {
+				r.add(BuildProblem{
+					Kind: MissingProviderProblem,
+					Msg:  fmt.Sprintf("%s is not provided", p.Type),
+					Func: name,
+					Pos:  pos,
+					Type: p.Type.String(),
+				})
+			}
+			for _, c := range ps {
+				if !checked[c] {
+					checked[c] = true
+					check(c.Name, positions[c.Name], c.Params)
+				}
+			}
+		}
+	}
+	for _, f := range funcs {
+		if bf, ok := newBuildFunc(f); ok {
+			check(bf.name, bf.pos, bf.params)
+		}
+	}
+}
@@ -0,0 +1,220 @@
+/*
+ * Copyright (c) 2019 OysterPack, Inc.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ * http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package fxapp_test
+
+import (
+	"github.com/oysterpack/andiamo/pkg/appdesc"
+	"github.com/oysterpack/andiamo/pkg/fx/lock"
+	"github.com/oysterpack/andiamo/pkg/fxapp"
+	"github.com/oysterpack/andiamo/pkg/fxapptest"
+	"github.com/oysterpack/andiamo/pkg/ulids"
+	"github.com/rs/zerolog"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"strings"
+	"testing"
+	"time"
+)
+
+type buildReportFoo struct{}
+type buildReportBar struct{}
+type buildReportBaz struct{}
+
+func newBuildReportFoo(buildReportBar) buildReportFoo { return buildReportFoo{} }
+
+func buildReport(t *testing.T, builder fxapp.Builder) *fxapp.BuildReport {
+	_, err := builder.Build()
+	require.Error(t, err)
+	report, ok := err.(*fxapp.BuildReport)
+	require.True(t, ok, "*** error is not a *BuildReport: %T", err)
+	t.Log(report)
+	return report
+}
+
+func problemsOfKind(report *fxapp.BuildReport, kind fxapp.BuildProblemKind) []fxapp.BuildProblem {
+	var problems []fxapp.BuildProblem
+	for _, p := range report.Problems {
+		if p.Kind == kind {
+			problems = append(problems, p)
+		}
+	}
+	return problems
+}
+
+func TestBuildReport_AggregatesProblems(t *testing.T) {
+	t.Parallel()
+
+	logs := fxapptest.NewLogCapture()
+	report := buildReport(t, fxapp.NewBuilderFromDesc(appdesc.Desc{ID: ulids.MustNew()}).
+		Provide(
+			func() buildReportFoo { return buildReportFoo{} },
+			"not a constructor",
+			newBuildReportFoo,
+		).
+		Invoke(func(buildReportFoo) {}).
+		EnableDebugDumps(fxapp.DebugDumpOpts{MinInterval: -time.Second}).
+		EnableDeadlinePropagation(fxapp.DeadlineOpts{DefaultBudget: -time.Second}).
+		DisableHTTPServer().
+		LogWriter(logs))
+
+	descProblems := problemsOfKind(report, fxapp.InvalidDescProblem)
+	assert.Len(t, descProblems, 2)
+
+	optsProblems := problemsOfKind(report, fxapp.InvalidOptsProblem)
+	require.Len(t, optsProblems, 2)
+	assert.Contains(t, optsProblems[0].Msg, fxapp.ErrInvalidDebugDumpOpts.Error())
+	assert.Contains(t, optsProblems[1].Msg, fxapp.ErrInvalidDeadlineOpts.Error())
+
+	funcProblems := problemsOfKind(report, fxapp.InvalidFuncProblem)
+	require.Len(t, funcProblems, 1)
+	assert.Contains(t, funcProblems[0].Msg, "string")
+
+	duplicates := problemsOfKind(report, fxapp.DuplicateProviderProblem)
+	require.Len(t, duplicates, 1)
+	assert.Equal(t, "fxapp_test.buildReportFoo", duplicates[0].Type)
+	assert.Equal(t, "newBuildReportFoo", duplicates[0].Func)
+	assert.Contains(t, duplicates[0].Pos, "build_report_test.go:")
+	assert.Contains(t, duplicates[0].Msg, "TestBuildReport_AggregatesProblems.func1")
+
+	event, ok := fxapptest.AssertEventLogged(t, logs, fxapp.InitFailedEvent)
+	if ok {
+		var data struct {
+			Err      string `json:"e"`
+			Problems []struct {
+				Kind string `json:"kind"`
+				Pos  string `json:"pos"`
+			} `json:"problems"`
+		}
+		require.NoError(t, event.DecodeData(&data))
+		assert.Equal(t, report.Error(), data.Err)
+		require.Len(t, data.Problems, len(report.Problems))
+		for i, p := range report.Problems {
+			assert.Equal(t, string(p.Kind), data.Problems[i].Kind)
+			assert.Equal(t, p.Pos, data.Problems[i].Pos)
+		}
+	}
+}
+
+func TestBuildReport_MissingProviders(t *testing.T) {
+	t.Parallel()
+
+	newBuilder := func() fxapp.Builder {
+		return fxapp.NewBuilder(fxapp.ID(ulids.MustNew()), fxapp.ReleaseID(ulids.MustNew())).
+			Provide(newBuildReportFoo).
+			Invoke(
+				func(buildReportFoo) {},
+				func(buildReportBaz) {},
+			).
+			DisableHTTPServer().
+			LogWriter(fxapptest.NewLogCapture())
+	}
+	report := buildReport(t, newBuilder())
+
+	// fx fails on the first invoke, but all missing providers are reported
+	require.Len(t, problemsOfKind(report, fxapp.InitErrorProblem), 1)
+	missing := problemsOfKind(report, fxapp.MissingProviderProblem)
+	require.Len(t, missing, 2)
+	assert.Equal(t, "fxapp_test.buildReportBar", missing[0].Type)
+	assert.Equal(t, "newBuildReportFoo", missing[0].Func)
+	assert.Equal(t, "fxapp_test.buildReportBaz", missing[1].Type)
+	assert.True(t, strings.HasPrefix(missing[1].Func, "TestBuildReport_MissingProviders"), missing[1].Func)
+	for _, p := range missing {
+		assert.Contains(t, p.Pos, "build_report_test.go:")
+	}
+
+	t.Run("the report is deterministic", func(t *testing.T) {
+		assert.Equal(t, report.Problems, buildReport(t, newBuilder()).Problems)
+	})
+}
+
+func TestBuilder_Validate(t *testing.T) {
+	t.Parallel()
+
+	t.Run("valid app", func(t *testing.T) {
+		var constructed, invoked bool
+		err := fxapp.NewBuilder(fxapp.ID(ulids.MustNew()), fxapp.ReleaseID(ulids.MustNew())).
+			Provide(func(logger *zerolog.Logger) buildReportFoo {
+				constructed = true
+				return buildReportFoo{}
+			}).
+			Invoke(func(buildReportFoo) {
+				invoked = true
+			}).
+			Validate()
+		require.NoError(t, err)
+		assert.False(t, constructed, "*** constructors must not be run")
+		assert.False(t, invoked, "*** app functions must not be run")
+	})
+
+	t.Run("missing providers", func(t *testing.T) {
+		err := fxapp.NewBuilder(fxapp.ID(ulids.MustNew()), fxapp.ReleaseID(ulids.MustNew())).
+			Provide(newBuildReportFoo).
+			Invoke(
+				func(buildReportFoo) {},
+				func(buildReportBaz) {},
+			).
+			EnableDistributedLocks(lock.Opts{}).
+			Validate()
+		require.Error(t, err)
+		report, ok := err.(*fxapp.BuildReport)
+		require.True(t, ok, "*** error is not a *BuildReport: %T", err)
+		t.Log(report)
+		// the distributed lock module is not used, i.e., the missing lock backend is not reported
+		require.Len(t, report.Problems, 2)
+		for _, p := range report.Problems {
+			assert.Equal(t, fxapp.MissingProviderProblem, p.Kind)
+			assert.Contains(t, p.Pos, "build_report_test.go:")
+		}
+		assert.Equal(t, "fxapp_test.buildReportBar", report.Problems[0].Type)
+		assert.Equal(t, "newBuildReportFoo", report.Problems[0].Func)
+		assert.Equal(t, "fxapp_test.buildReportBaz", report.Problems[1].Type)
+	})
+
+	t.Run("transitive framework dependencies", func(t *testing.T) {
+		err := fxapp.NewBuilder(fxapp.ID(ulids.MustNew()), fxapp.ReleaseID(ulids.MustNew())).
+			Invoke(func(lock.DistributedLock) {}).
+			EnableDistributedLocks(lock.Opts{}).
+			Validate()
+		require.Error(t, err)
+		report := err.(*fxapp.BuildReport)
+		t.Log(report)
+		require.Len(t, report.Problems, 1)
+		assert.Equal(t, "lock.Backend", report.Problems[0].Type)
+	})
+
+	t.Run("duplicate framework provision", func(t *testing.T) {
+		err := fxapp.NewBuilder(fxapp.ID(ulids.MustNew()), fxapp.ReleaseID(ulids.MustNew())).
+			Provide(func() *zerolog.Logger { return nil }).
+			Invoke(func() {}).
+			Validate()
+		require.Error(t, err)
+		report := err.(*fxapp.BuildReport)
+		t.Log(report)
+		require.Len(t, report.Problems, 1)
+		assert.Equal(t, fxapp.InitErrorProblem, report.Problems[0].Kind)
+		assert.Contains(t, report.Problems[0].Msg, "already provided")
+	})
+
+	t.Run("invalid options", func(t *testing.T) {
+		err := fxapp.NewBuilder(fxapp.ID(ulids.MustNew()), fxapp.ReleaseID(ulids.MustNew())).
+			Invoke(func() {}).
+			EnableDebugDumps(fxapp.DebugDumpOpts{MinInterval: -time.Second}).
+			Validate()
+		require.Error(t, err)
+		assert.Contains(t, err.Error(), fxapp.ErrInvalidDebugDumpOpts.Error())
+	})
+}
@@ -0,0 +1,236 @@
+/*
+ * Copyright (c) 2019 OysterPack, Inc.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ * http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package fxapp
+
+import (
+	"bufio"
+	"context"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"github.com/oysterpack/andiamo/pkg/clock"
+	"github.com/oysterpack/andiamo/pkg/fx/health"
+	"net"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// clock skew health check IDs
+const (
+	// ClockSkewHealthCheckID checks the local clock against the reference clock, and the wall clock against the monotonic
+	// clock, i.e., ULIDs and event ordering depend on sane clocks.
+	ClockSkewHealthCheckID = "01DJ28MV402E1J2J0W5XKMXNM9"
+)
+
+// DefaultNTPPort is used if the NTP server address does not specify a port
+const DefaultNTPPort = "123"
+
+// ErrInvalidClockSkewHealthCheckOpts indicates the clock skew health check options are invalid
+var ErrInvalidClockSkewHealthCheckOpts = errors.New("clock skew health check options are invalid")
+
+var (
+	errInvalidNTPResponse       = errors.New("invalid NTP response")
+	errNodeTimeAnnotationNotSet = errors.New("node time annotation is not set")
+)
+
+// ReferenceClock returns the reference time that the local clock is compared against, e.g., the NTP server time - see
+// `NTPReferenceClock()` and `NodeTimeAnnotationReferenceClock()`.
+type ReferenceClock func(ctx context.Context) (time.Time, error)
+
+// ClockSkewThresholds are used to map the absolute clock skew to health check statuses, i.e., the skew is `Yellow`
+// when it reaches the Yellow threshold and `Red` when it reaches the Red threshold.
+type ClockSkewThresholds struct {
+	Yellow, Red time.Duration
+}
+
+func (t ClockSkewThresholds) status(skew time.Duration) health.Status {
+	if skew < 0 {
+		skew = -skew
+	}
+	switch {
+	case skew >= t.Red:
+		return health.Red
+	case skew >= t.Yellow:
+		return health.Yellow
+	default:
+		return health.Green
+	}
+}
+
+// ClockSkewHealthCheckOpts is used to configure the clock skew health check
+type ClockSkewHealthCheckOpts struct {
+	// Reference is the clock that the local clock is compared against. If nil, then only the wall clock drift, relative
+	// to the monotonic clock, is checked.
+	Reference ReferenceClock
+	ClockSkewThresholds
+}
+
+// DefaultClockSkewHealthCheckOpts returns the default clock skew health check options, i.e., the skew is Yellow at 500ms
+// and Red at 2s.
+func DefaultClockSkewHealthCheckOpts(reference ReferenceClock) ClockSkewHealthCheckOpts {
+	return ClockSkewHealthCheckOpts{
+		Reference:           reference,
+		ClockSkewThresholds: ClockSkewThresholds{Yellow: 500 * time.Millisecond, Red: 2 * time.Second},
+	}
+}
+
+func (opts ClockSkewHealthCheckOpts) validate() error {
+	if opts.Yellow <= 0 || opts.Yellow > opts.Red {
+		return fmt.Errorf("%s : thresholds must satisfy: 0 < Yellow <= Red : %#v", ErrInvalidClockSkewHealthCheckOpts, opts.ClockSkewThresholds)
+	}
+	return nil
+}
+
+// NTPReferenceClock queries the NTP server, e.g., "pool.ntp.org" or "169.254.169.123:123", using SNTP. The reference
+// time is adjusted for the network round trip delay. If the address does not specify a port, then `DefaultNTPPort` is
+// used.
+func NTPReferenceClock(addr string) ReferenceClock {
+	if _, _, err := net.SplitHostPort(addr); err != nil {
+		addr = net.JoinHostPort(addr, DefaultNTPPort)
+	}
+	return func(ctx context.Context) (time.Time, error) {
+		var dialer net.Dialer
+		conn, err := dialer.DialContext(ctx, "udp", addr)
+		if err != nil {
+			return time.Time{}, err
+		}
+		defer conn.Close()
+		if deadline, ok := ctx.Deadline(); ok {
+			conn.SetDeadline(deadline)
+		}
+
+		// LI = 0, VN = 4, Mode = 3 (client)
+		request := make([]byte, 48)
+		request[0] = 0x23
+		sent := time.Now()
+		if _, err := conn.Write(request); err != nil {
+			return time.Time{}, err
+		}
+		response := make([]byte, 48)
+		n, err := conn.Read(response)
+		if err != nil {
+			return time.Time{}, err
+		}
+		received := time.Now()
+		if n < 48 {
+			return time.Time{}, fmt.Errorf("%s : response length is %d", errInvalidNTPResponse, n)
+		}
+		// stratum 0 is a kiss-o'-death packet
+		if response[1] == 0 {
+			return time.Time{}, fmt.Errorf("%s : kiss-o'-death : %q", errInvalidNTPResponse, response[12:16])
+		}
+		serverReceived := ntpTime(response[32:40])
+		serverTransmitted := ntpTime(response[40:48])
+		delay := received.Sub(sent) - serverTransmitted.Sub(serverReceived)
+		if delay < 0 {
+			delay = 0
+		}
+		return serverTransmitted.Add(delay / 2), nil
+	}
+}
+
+// ntp timestamps are seconds since 1900 in 32.32 fixed point format
+func ntpTime(b []byte) time.Time {
+	const ntpEpochOffset = 2208988800
+	seconds := int64(binary.BigEndian.Uint32(b[:4])) - ntpEpochOffset
+	fraction := int64(binary.BigEndian.Uint32(b[4:]))
+	return time.Unix(seconds, (fraction*int64(time.Second))>>32)
+}
+
+// NodeTimeAnnotationReferenceClock reads the node time from the pod annotations file that is exposed via the k8s Downward
+// API, e.g.,
+//
+//	volumes:
+//	- name: podinfo
+//	  downwardAPI:
+//	    items:
+//	    - path: annotations
+//	      fieldRef:
+//	        fieldPath: metadata.annotations
+//
+// The annotation value must be an RFC 3339 timestamp, which is expected to be refreshed by a node agent.
+func NodeTimeAnnotationReferenceClock(path, annotation string) ReferenceClock {
+	return func(ctx context.Context) (time.Time, error) {
+		f, err := os.Open(path)
+		if err != nil {
+			return time.Time{}, err
+		}
+		defer f.Close()
+		scanner := bufio.NewScanner(f)
+		for scanner.Scan() {
+			i := strings.Index(scanner.Text(), "=")
+			if i < 0 || scanner.Text()[:i] != annotation {
+				continue
+			}
+			value, err := strconv.Unquote(scanner.Text()[i+1:])
+			if err != nil {
+				return time.Time{}, fmt.Errorf("%s : %s", annotation, err)
+			}
+			return time.Parse(time.RFC3339Nano, value)
+		}
+		if err := scanner.Err(); err != nil {
+			return time.Time{}, err
+		}
+		return time.Time{}, fmt.Errorf("%s : %s", errNodeTimeAnnotationNotSet, annotation)
+	}
+}
+
+// registers the clock skew health check, which is composed of the following sub-checks:
+//   - "reference" - the local clock vs the reference clock - only if a reference clock is configured
+//   - "monotonic" - the wall clock drift relative to the monotonic clock since the app was initialized, i.e., wall clock
+//     jumps are detected
+func registerClockSkewHealthCheck(opts ClockSkewHealthCheckOpts) func(register health.Register, c clock.Clock) error {
+	return func(register health.Register, c clock.Clock) error {
+		start := c.Now()
+		subChecks := []health.SubCheck{{
+			Name: "monotonic",
+			Checker: func(ctx context.Context) (health.Status, error) {
+				now := c.Now()
+				// Round(0) strips the monotonic clock reading
+				drift := now.Round(0).Sub(start.Round(0)) - now.Sub(start)
+				if status := opts.status(drift); status != health.Green {
+					return status, fmt.Errorf("wall clock drifted from the monotonic clock : %s", drift)
+				}
+				return health.Green, nil
+			},
+		}}
+		if opts.Reference != nil {
+			subChecks = append(subChecks, health.SubCheck{
+				Name: "reference",
+				Checker: func(ctx context.Context) (health.Status, error) {
+					reference, err := opts.Reference(ctx)
+					if err != nil {
+						return health.Yellow, fmt.Errorf("failed to read reference clock : %s", err)
+					}
+					skew := c.Now().Sub(reference)
+					if status := opts.status(skew); status != health.Green {
+						return status, fmt.Errorf("local clock is skewed from the reference clock : %s", skew)
+					}
+					return health.Green, nil
+				},
+			})
+		}
+		return register(health.Check{
+			ID:           ClockSkewHealthCheckID,
+			Description:  "local clock skew vs reference clock and wall clock drift vs monotonic clock",
+			YellowImpact: "ULID and event ordering across instances may be inaccurate",
+			RedImpact:    "ULID and event ordering is unreliable, and time based tokens may be rejected",
+		}, health.CheckerOpts{}, health.Composite(subChecks...))
+	}
+}
@@ -0,0 +1,174 @@
+/*
+ * Copyright (c) 2019 OysterPack, Inc.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ * http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package fxapp_test
+
+import (
+	"context"
+	"encoding/binary"
+	"errors"
+	"github.com/oysterpack/andiamo/pkg/clock"
+	"github.com/oysterpack/andiamo/pkg/fx/health"
+	"github.com/oysterpack/andiamo/pkg/fxapp"
+	"github.com/oysterpack/andiamo/pkg/ulids"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"io/ioutil"
+	"net"
+	"os"
+	"path/filepath"
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestEnableClockSkewHealthCheck(t *testing.T) {
+	t.Parallel()
+
+	fakeClock := clock.NewFake(time.Now())
+	var mutex sync.Mutex
+	var skew time.Duration
+	var referenceErr error
+	reference := func(ctx context.Context) (time.Time, error) {
+		mutex.Lock()
+		defer mutex.Unlock()
+		return fakeClock.Now().Add(skew), referenceErr
+	}
+
+	var registeredChecks health.RegisteredChecks
+	var runCheckNow health.RunCheckNow
+	app, err := fxapp.NewBuilder(fxapp.ID(ulids.MustNew()), fxapp.ReleaseID(ulids.MustNew())).
+		EnableClockSkewHealthCheck(fxapp.DefaultClockSkewHealthCheckOpts(reference)).
+		Invoke(func() {}).
+		SetClock(fakeClock).
+		Populate(&registeredChecks, &runCheckNow).
+		LogWriter(ioutil.Discard).
+		DisableHTTPServer().
+		Build()
+	require.NoError(t, err)
+
+	go app.Run()
+	defer func() {
+		app.Shutdown()
+		<-app.Done()
+	}()
+	<-app.Ready()
+
+	registered := false
+	for _, check := range <-registeredChecks(health.Query{}) {
+		if check.ID == fxapp.ClockSkewHealthCheckID {
+			registered = true
+		}
+	}
+	require.True(t, registered)
+
+	run := func(s time.Duration, e error) health.Result {
+		mutex.Lock()
+		skew, referenceErr = s, e
+		mutex.Unlock()
+		result, err := runCheckNow(fxapp.ClockSkewHealthCheckID)
+		require.NoError(t, err)
+		return result
+	}
+	result := run(0, nil)
+	assert.Equal(t, health.Green, result.Status)
+	require.Len(t, result.SubResults, 2)
+	assert.Equal(t, "monotonic", result.SubResults[0].Name)
+	assert.Equal(t, "reference", result.SubResults[1].Name)
+
+	assert.Equal(t, health.Yellow, run(time.Second, nil).Status)
+	assert.Equal(t, health.Red, run(-5*time.Second, nil).Status)
+	result = run(0, errors.New("NTP server is unreachable"))
+	assert.Equal(t, health.Yellow, result.Status)
+	assert.Contains(t, result.Err.Error(), "NTP server is unreachable")
+}
+
+func TestEnableClockSkewHealthCheck_InvalidOpts(t *testing.T) {
+	t.Parallel()
+
+	for _, thresholds := range []fxapp.ClockSkewThresholds{
+		{},
+		{Yellow: time.Second, Red: time.Millisecond},
+		{Yellow: -time.Second, Red: time.Second},
+	} {
+		_, err := fxapp.NewBuilder(fxapp.ID(ulids.MustNew()), fxapp.ReleaseID(ulids.MustNew())).
+			EnableClockSkewHealthCheck(fxapp.ClockSkewHealthCheckOpts{ClockSkewThresholds: thresholds}).
+			Invoke(func() {}).
+			DisableHTTPServer().
+			Build()
+		require.Error(t, err)
+		assert.Contains(t, err.Error(), fxapp.ErrInvalidClockSkewHealthCheckOpts.Error())
+	}
+}
+
+func TestNTPReferenceClock(t *testing.T) {
+	t.Parallel()
+
+	conn, err := net.ListenPacket("udp", "127.0.0.1:0")
+	require.NoError(t, err)
+	defer conn.Close()
+
+	// the NTP server clock is 1 hour ahead
+	serverTime := func() time.Time { return time.Now().Add(time.Hour) }
+	go func() {
+		request := make([]byte, 48)
+		_, addr, err := conn.ReadFrom(request)
+		if err != nil {
+			return
+		}
+		ntpTime := func(b []byte, t time.Time) {
+			binary.BigEndian.PutUint32(b[:4], uint32(t.Unix()+2208988800))
+			binary.BigEndian.PutUint32(b[4:], uint32((int64(t.Nanosecond())<<32)/int64(time.Second)))
+		}
+		response := make([]byte, 48)
+		response[0] = 0x24 // VN = 4, Mode = 4 (server)
+		response[1] = 1    // stratum
+		ntpTime(response[32:40], serverTime())
+		ntpTime(response[40:48], serverTime())
+		conn.WriteTo(response, addr)
+	}()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	reference, err := fxapp.NTPReferenceClock(conn.LocalAddr().String())(ctx)
+	require.NoError(t, err)
+	skew := reference.Sub(time.Now())
+	assert.True(t, skew > 59*time.Minute && skew < 61*time.Minute, "skew: %s", skew)
+}
+
+func TestNodeTimeAnnotationReferenceClock(t *testing.T) {
+	t.Parallel()
+
+	const Annotation = "example.com/node-time"
+	dir, err := ioutil.TempDir("", "fxapp")
+	require.NoError(t, err)
+	defer os.RemoveAll(dir)
+	path := filepath.Join(dir, "annotations")
+	nodeTime := time.Date(2019, 8, 15, 12, 30, 0, 0, time.UTC)
+	err = ioutil.WriteFile(path, []byte(`kubernetes.io/config.seen="2019-08-15T12:00:00Z"
+`+Annotation+`="`+nodeTime.Format(time.RFC3339Nano)+`"
+`), 0644)
+	require.NoError(t, err)
+
+	reference, err := fxapp.NodeTimeAnnotationReferenceClock(path, Annotation)(context.Background())
+	require.NoError(t, err)
+	assert.True(t, nodeTime.Equal(reference))
+
+	_, err = fxapp.NodeTimeAnnotationReferenceClock(path, "example.com/missing")(context.Background())
+	assert.Error(t, err)
+	_, err = fxapp.NodeTimeAnnotationReferenceClock(filepath.Join(dir, "missing"), Annotation)(context.Background())
+	assert.Error(t, err)
+}
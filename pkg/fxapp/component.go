@@ -0,0 +1,340 @@
+/*
+ * Copyright (c) 2019 OysterPack, Inc.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ * http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package fxapp
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"github.com/blang/semver"
+	"github.com/oysterpack/andiamo/pkg/eventlog"
+	"github.com/oysterpack/andiamo/pkg/fx/health"
+	"github.com/oysterpack/andiamo/pkg/ulids"
+	"github.com/rs/zerolog"
+	"go.uber.org/multierr"
+	"net/http"
+	"reflect"
+	"strings"
+)
+
+// Component represents an application component, i.e., a logical grouping of related application functionality.
+//
+// The component descriptor documents what the component provides to the app - it's functions, events, errors, health checks,
+// and metrics. When a component is registered with the app builder, its Provide and Invoke functions are registered with
+// the app.
+type Component struct {
+	// ID format is ULID
+	ID   string
+	Name string
+	// Version must be a valid semantic version (https://semver.org/), e.g., 1.2.3
+	Version string
+
+	// Provide constructor functions are registered with the app
+	Provide []interface{}
+	// Invoke functions are registered with the app and invoked before the app functions
+	Invoke []interface{}
+
+	// Events are the IDs of the events that the component logs
+	Events []string
+	// Errors are the errors that are returned by the component
+	Errors []error
+	// HealthChecks are registered with the health module when the app starts and unregistered when the app stops
+	HealthChecks []ComponentHealthCheck
+	// Metrics describe the metrics that are registered by the component
+	Metrics []MetricDesc
+
+	// Requires declares the component's version constraints on other components that it depends on
+	Requires []ComponentConstraint
+}
+
+// ComponentConstraint declares a dependency on another component, constrained by a semantic version range.
+//
+// Supported version range formats, e.g.:
+//   - "=1.2.3", "1.2.3" - equal
+//   - "!=1.2.3" - not equal
+//   - ">1.2.3", ">=1.2.3", "<1.2.3", "<=1.2.3"
+//   - ">=1.2.0 <2.0.0" - AND: ranges separated by spaces
+//   - "<1.2.0 || >=1.3.0" - OR: ranges separated by "||"
+//
+// NOTE: versions must be fully specified, i.e., ">=1.2" is not valid and must be specified as ">=1.2.0"
+type ComponentConstraint struct {
+	// ID is the ID of the component that is required
+	ID string
+	// Version is the semantic version range that the required component version must satisfy
+	Version string
+}
+
+func (c ComponentConstraint) String() string {
+	return fmt.Sprintf("%s %s", c.ID, c.Version)
+}
+
+// ComponentHealthCheck declares a health check that is registered by the component.
+type ComponentHealthCheck struct {
+	health.Check
+	health.CheckerOpts
+
+	// Checker is a factory function for the health checker function, i.e., it must return a
+	// `func(ctx context.Context) (health.Status, error)`. It may optionally return an error as its second return value.
+	// The factory function params are injected, e.g.,
+	//
+	//   func(db *sql.DB) func(ctx context.Context) (health.Status, error)
+	//
+	// The checker context is canceled when the health check times out or when the app is shutdown - see health.Register.
+	Checker interface{}
+}
+
+var (
+	checkerFuncType = reflect.TypeOf(func(ctx context.Context) (health.Status, error) { return health.Green, nil })
+	errorType       = reflect.TypeOf((*error)(nil)).Elem()
+)
+
+func (c ComponentHealthCheck) validate() error {
+	if c.Checker == nil {
+		return fmt.Errorf("%s : %s", ErrComponentInvalidHealthChecker, c.ID)
+	}
+	t := reflect.TypeOf(c.Checker)
+	switch {
+	case t.Kind() != reflect.Func,
+		t.IsVariadic(),
+		t.NumOut() == 0 || t.NumOut() > 2,
+		t.Out(0) != checkerFuncType,
+		t.NumOut() == 2 && t.Out(1) != errorType:
+		return fmt.Errorf("%s : %s : %s", ErrComponentInvalidHealthChecker, c.ID, t)
+	default:
+		return nil
+	}
+}
+
+// component registration validation errors
+var (
+	ErrComponentIDNotULID         = errors.New("component `ID` must be a ULID")
+	ErrComponentBlankName         = errors.New("component `Name` must not be blank")
+	ErrComponentInvalidVersion    = errors.New("component `Version` must be a valid semantic version")
+	ErrComponentAlreadyRegistered = errors.New("component is already registered")
+
+	ErrComponentInvalidHealthChecker = errors.New("component health check `Checker` must be a function that returns `func(ctx context.Context) (health.Status, error)` and optionally an error")
+
+	ErrComponentConstraintsUnsatisfied = errors.New("component version constraints are not satisfied")
+)
+
+func (c *Component) validate() error {
+	var err error
+	if _, e := ulids.Parse(c.ID); e != nil {
+		err = multierr.Append(err, ErrComponentIDNotULID)
+	}
+	if strings.TrimSpace(c.Name) == "" {
+		err = multierr.Append(err, ErrComponentBlankName)
+	}
+	if _, e := semver.Parse(c.Version); e != nil {
+		err = multierr.Append(err, multierr.Append(ErrComponentInvalidVersion, e))
+	}
+	for _, check := range c.HealthChecks {
+		err = multierr.Append(err, check.validate())
+	}
+	if err != nil {
+		return multierr.Append(fmt.Errorf("invalid component: %s : %s", c.ID, c.Name), err)
+	}
+	return nil
+}
+
+// checks that the component version constraints are satisfied by the registered components.
+// All unsatisfied constraints are reported.
+func checkComponentConstraints(components []Component) error {
+	versions := make(map[string]semver.Version, len(components))
+	for _, c := range components {
+		if v, err := semver.Parse(c.Version); err == nil {
+			versions[c.ID] = v
+		}
+	}
+
+	var err error
+	for _, c := range components {
+		for _, constraint := range c.Requires {
+			versionRange, e := semver.ParseRange(constraint.Version)
+			if e != nil {
+				err = multierr.Append(err, fmt.Errorf("%s (%s) requires %s : invalid version range : %v", c.Name, c.ID, constraint, e))
+				continue
+			}
+			version, ok := versions[constraint.ID]
+			switch {
+			case !ok:
+				err = multierr.Append(err, fmt.Errorf("%s (%s) requires %s : component is not registered", c.Name, c.ID, constraint))
+			case !versionRange(version):
+				err = multierr.Append(err, fmt.Errorf("%s (%s) requires %s : registered version is %s", c.Name, c.ID, constraint, version))
+			}
+		}
+	}
+	if err != nil {
+		return multierr.Append(ErrComponentConstraintsUnsatisfied, err)
+	}
+	return nil
+}
+
+func constraintStrings(constraints []ComponentConstraint) []string {
+	strs := make([]string, 0, len(constraints))
+	for _, c := range constraints {
+		strs = append(strs, c.String())
+	}
+	return strs
+}
+
+// MarshalZerologObject implements zerolog.LogObjectMarshaler interface
+func (c *Component) MarshalZerologObject(e *zerolog.Event) {
+	e.Str("id", c.ID)
+	e.Str("name", c.Name)
+	e.Str("version", c.Version)
+	e.Strs("provides", funcTypeNames(c.Provide))
+	e.Strs("invokes", funcTypeNames(c.Invoke))
+	if len(c.Events) > 0 {
+		e.Strs("events", c.Events)
+	}
+	if len(c.Errors) > 0 {
+		e.Strs("errors", errorMessages(c.Errors))
+	}
+	if len(c.HealthChecks) > 0 {
+		e.Strs("health_checks", healthCheckIDs(c.HealthChecks))
+	}
+	if len(c.Metrics) > 0 {
+		e.Strs("metrics", metricNames(c.Metrics))
+	}
+	if len(c.Requires) > 0 {
+		e.Strs("requires", constraintStrings(c.Requires))
+	}
+}
+
+// MarshalJSON implements json.Marshaler interface
+func (c *Component) MarshalJSON() ([]byte, error) {
+	type metric struct {
+		Name   string   `json:"name"`
+		Help   string   `json:"help"`
+		Type   string   `json:"type"`
+		Labels []string `json:"labels,omitempty"`
+	}
+	metrics := make([]metric, 0, len(c.Metrics))
+	for _, m := range c.Metrics {
+		metrics = append(metrics, metric{m.Name, m.Help, m.MetricType.String(), m.Labels})
+	}
+
+	return json.Marshal(struct {
+		ID           string   `json:"id"`
+		Name         string   `json:"name"`
+		Version      string   `json:"version"`
+		Provides     []string `json:"provides,omitempty"`
+		Invokes      []string `json:"invokes,omitempty"`
+		Events       []string `json:"events,omitempty"`
+		Errors       []string `json:"errors,omitempty"`
+		HealthChecks []string `json:"health_checks,omitempty"`
+		Metrics      []metric `json:"metrics,omitempty"`
+		Requires     []string `json:"requires,omitempty"`
+	}{
+		ID:           c.ID,
+		Name:         c.Name,
+		Version:      c.Version,
+		Provides:     funcTypeNames(c.Provide),
+		Invokes:      funcTypeNames(c.Invoke),
+		Events:       c.Events,
+		Errors:       errorMessages(c.Errors),
+		HealthChecks: healthCheckIDs(c.HealthChecks),
+		Metrics:      metrics,
+		Requires:     constraintStrings(c.Requires),
+	})
+}
+
+func funcTypeNames(funcs []interface{}) []string {
+	names := make([]string, 0, len(funcs))
+	for _, f := range funcs {
+		names = append(names, reflect.TypeOf(f).String())
+	}
+	return names
+}
+
+func errorMessages(errs []error) []string {
+	msgs := make([]string, 0, len(errs))
+	for _, err := range errs {
+		msgs = append(msgs, err.Error())
+	}
+	return msgs
+}
+
+func healthCheckIDs(checks []ComponentHealthCheck) []string {
+	ids := make([]string, 0, len(checks))
+	for _, check := range checks {
+		ids = append(ids, check.ID)
+	}
+	return ids
+}
+
+func metricNames(metrics []MetricDesc) []string {
+	names := make([]string, 0, len(metrics))
+	for _, m := range metrics {
+		names = append(names, m.Name)
+	}
+	return names
+}
+
+// RegisteredComponents returns the components that are registered with the app
+type RegisteredComponents func() []Component
+
+// component related events
+const (
+	//  sample event data:
+	//  {
+	//    "id": "01DH8RXAWJND9WYAVHQ2V8XGB0",
+	//    "name": "foo",
+	//    "version": "1.0.0",
+	//    "provides": ["func() fxapp_test.Foo"],
+	//    "invokes": ["func(fxapp_test.Foo)"],
+	//    "events": ["01DH8S1Y3Z6P8Q1WJZ0YV5XB8Q"],
+	//    "errors": ["BOOM"],
+	//    "health_checks": ["01DH8S2PKS7MXN0Q0R8XS3T1RA"],
+	//    "metrics": ["foo_requests"],
+	//    "requires": ["01DH8T06J3V7FZ5D5X0C9QYV1W >=1.2.0"]
+	//  }
+	ComponentRegisteredEvent = "01DH8RXAM01PE10K8FP0N1EM4R"
+)
+
+// ComponentsEndpoint is used to construct the components HTTP endpoint, which returns the registered components as JSON.
+const ComponentsEndpoint = "01DH8RXAR935E9EC2SRKZN9R9J"
+
+func logComponentRegistrations(components RegisteredComponents, logger *zerolog.Logger) {
+	logComponentRegistered := eventlog.NewLogger(ComponentRegisteredEvent, logger, zerolog.NoLevel)
+	for _, c := range components() {
+		logComponentRegistered(&c, "component registered")
+	}
+}
+
+func componentsHTTPHandler(components RegisteredComponents) HTTPHandler {
+	return NewHTTPHandler(fmt.Sprintf("/%s", ComponentsEndpoint), func(writer http.ResponseWriter, request *http.Request) {
+		comps := components()
+		jsonComps := make([]*Component, 0, len(comps))
+		for i := range comps {
+			jsonComps = append(jsonComps, &comps[i])
+		}
+		data, err := json.Marshal(jsonComps)
+		if err != nil {
+			http.Error(writer, err.Error(), http.StatusInternalServerError)
+			return
+		}
+		writer.Header().Set("Content-Type", "application/json")
+		writer.Write(data)
+	}).WithDoc(OpenAPIOperation{
+		Summary:   "registered components",
+		Tags:      []string{BuiltinOpenAPITag},
+		Responses: []OpenAPIResponse{{Status: http.StatusOK, MediaTypes: []string{JSONMediaType}}},
+	}).AdminOnly()
+}
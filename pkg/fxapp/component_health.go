@@ -0,0 +1,84 @@
+/*
+ * Copyright (c) 2019 OysterPack, Inc.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ * http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package fxapp
+
+import (
+	"context"
+	"github.com/oysterpack/andiamo/pkg/fx/health"
+	"go.uber.org/fx"
+	"reflect"
+)
+
+var (
+	healthRegisterType   = reflect.TypeOf(health.Register(nil))
+	healthUnregisterType = reflect.TypeOf(health.Unregister(nil))
+	lifecycleType        = reflect.TypeOf((*fx.Lifecycle)(nil)).Elem()
+)
+
+// returns functions that are invoked to register the component's health checks.
+// The health checks are unregistered when the app is stopped.
+func (c *Component) healthCheckFuncs() []interface{} {
+	decorators := c.argDecorators()
+	funcs := make([]interface{}, 0, len(c.HealthChecks))
+	for _, check := range c.HealthChecks {
+		funcs = append(funcs, healthCheckFunc(check, decorators.decorateFunc(check.Checker)))
+	}
+	return funcs
+}
+
+// The checker factory function params are injected. Thus, the function signature is constructed dynamically via
+// reflection: the factory params + health.Register, health.Unregister, and fx.Lifecycle. It returns an error.
+func healthCheckFunc(check ComponentHealthCheck, checkerFactory interface{}) interface{} {
+	factory := reflect.ValueOf(checkerFactory)
+	factoryType := factory.Type()
+	paramCount := factoryType.NumIn()
+	params := make([]reflect.Type, 0, paramCount+3)
+	for i := 0; i < paramCount; i++ {
+		params = append(params, factoryType.In(i))
+	}
+	params = append(params, healthRegisterType, healthUnregisterType, lifecycleType)
+	funcType := reflect.FuncOf(params, []reflect.Type{errorType}, false)
+
+	returnErr := func(err error) []reflect.Value {
+		errValue := reflect.New(errorType).Elem()
+		if err != nil {
+			errValue.Set(reflect.ValueOf(err))
+		}
+		return []reflect.Value{errValue}
+	}
+
+	return reflect.MakeFunc(funcType, func(args []reflect.Value) []reflect.Value {
+		results := factory.Call(args[:paramCount])
+		if len(results) == 2 && !results[1].IsNil() {
+			return returnErr(results[1].Interface().(error))
+		}
+		checker := results[0].Interface().(func(ctx context.Context) (health.Status, error))
+		register := args[paramCount].Interface().(health.Register)
+		unregister := args[paramCount+1].Interface().(health.Unregister)
+		lc := args[paramCount+2].Interface().(fx.Lifecycle)
+
+		if err := register(check.Check, check.CheckerOpts, checker); err != nil {
+			return returnErr(err)
+		}
+		lc.Append(fx.Hook{
+			OnStop: func(context.Context) error {
+				return unregister(check.ID)
+			},
+		})
+		return returnErr(nil)
+	}).Interface()
+}
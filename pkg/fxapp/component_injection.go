@@ -0,0 +1,153 @@
+/*
+ * Copyright (c) 2019 OysterPack, Inc.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ * http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package fxapp
+
+import (
+	"github.com/oysterpack/andiamo/pkg/eventlog"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/rs/zerolog"
+	"reflect"
+)
+
+// argDecorators map function parameter types to functions that decorate the injected values
+type argDecorators map[reflect.Type]func(arg reflect.Value) reflect.Value
+
+var (
+	registererType = reflect.TypeOf((*prometheus.Registerer)(nil)).Elem()
+	loggerType     = reflect.TypeOf((*zerolog.Logger)(nil))
+)
+
+// returns the decorators that are applied to values injected into the component's functions:
+//   - prometheus.Registerer is wrapped with the component ID and version labels
+//   - *zerolog.Logger is scoped to the component, i.e., log events are annotated with the component ID and name
+func (c *Component) argDecorators() argDecorators {
+	id, name := c.ID, c.Name
+	labels := prometheus.Labels{
+		ComponentIDLabel:      c.ID,
+		ComponentVersionLabel: c.Version,
+	}
+	return argDecorators{
+		registererType: func(arg reflect.Value) reflect.Value {
+			registerer := prometheus.WrapRegistererWith(labels, arg.Interface().(prometheus.Registerer))
+			return reflect.ValueOf(&registerer).Elem()
+		},
+		loggerType: func(arg reflect.Value) reflect.Value {
+			logger := eventlog.ForComponent(arg.Interface().(*zerolog.Logger), id).
+				With().
+				Str(ComponentNameLabel, name).
+				Logger()
+			return reflect.ValueOf(&logger)
+		},
+	}
+}
+
+// returns the component's Provide functions with component scoped args injected
+func (c *Component) constructors() []interface{} {
+	return c.argDecorators().decorateFuncs(c.Provide)
+}
+
+// returns the component's Invoke functions with component scoped args injected
+func (c *Component) funcs() []interface{} {
+	return c.argDecorators().decorateFuncs(c.Invoke)
+}
+
+func (decorators argDecorators) decorateFuncs(funcs []interface{}) []interface{} {
+	decorated := make([]interface{}, 0, len(funcs))
+	for _, f := range funcs {
+		decorated = append(decorated, decorators.decorateFunc(f))
+	}
+	return decorated
+}
+
+// wraps the function, if needed, in order to decorate the injected args.
+//
+// NOTE: wrapped functions are reported as reflect.makeFuncStub in the fx DOT graph and logs because the function is
+// constructed via reflection. Functions that do not have any params that need to be decorated are returned as is.
+func (decorators argDecorators) decorateFunc(f interface{}) interface{} {
+	funcValue := reflect.ValueOf(f)
+	if funcValue.Kind() != reflect.Func {
+		return f
+	}
+	funcType := funcValue.Type()
+	decorate := false
+	for i := 0; i < funcType.NumIn(); i++ {
+		if decorators.applies(funcType.In(i)) {
+			decorate = true
+			break
+		}
+	}
+	if !decorate {
+		return f
+	}
+
+	return reflect.MakeFunc(funcType, func(args []reflect.Value) []reflect.Value {
+		for i, arg := range args {
+			args[i] = decorators.decorateArg(arg)
+		}
+		if funcType.IsVariadic() {
+			return funcValue.CallSlice(args)
+		}
+		return funcValue.Call(args)
+	}).Interface()
+}
+
+// returns true if the type needs to be decorated, which includes parameter objects, i.e., structs that embed fx.In,
+// that contain fields that need to be decorated
+func (decorators argDecorators) applies(t reflect.Type) bool {
+	if _, ok := decorators[t]; ok {
+		return true
+	}
+	if !isParamObject(t) {
+		return false
+	}
+	for i := 0; i < t.NumField(); i++ {
+		if field := t.Field(i); field.PkgPath == "" && decorators.applies(field.Type) {
+			return true
+		}
+	}
+	return false
+}
+
+func (decorators argDecorators) decorateArg(arg reflect.Value) reflect.Value {
+	if decorate, ok := decorators[arg.Type()]; ok {
+		if isNil(arg) { // optional dependency that was not provided
+			return arg
+		}
+		return decorate(arg)
+	}
+	if !decorators.applies(arg.Type()) {
+		return arg
+	}
+	// parameter objects are passed by value - thus the decorated fields are set on a copy
+	paramObject := reflect.New(arg.Type()).Elem()
+	paramObject.Set(arg)
+	for i := 0; i < paramObject.NumField(); i++ {
+		if field := paramObject.Field(i); field.CanSet() {
+			field.Set(decorators.decorateArg(field))
+		}
+	}
+	return paramObject
+}
+
+func isNil(v reflect.Value) bool {
+	switch v.Kind() {
+	case reflect.Interface, reflect.Ptr, reflect.Map, reflect.Slice, reflect.Func, reflect.Chan:
+		return v.IsNil()
+	default:
+		return false
+	}
+}
@@ -0,0 +1,460 @@
+/*
+ * Copyright (c) 2019 OysterPack, Inc.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ * http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package fxapp_test
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"github.com/oysterpack/andiamo/pkg/fx/health"
+	"github.com/oysterpack/andiamo/pkg/fxapp"
+	"github.com/oysterpack/andiamo/pkg/fxapptest"
+	"github.com/oysterpack/andiamo/pkg/ulids"
+	"github.com/prometheus/client_golang/prometheus"
+	dto "github.com/prometheus/client_model/go"
+	"github.com/rs/zerolog"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.uber.org/fx"
+	"net/http"
+	"testing"
+)
+
+type Foo string
+
+var FooComp = fxapp.Component{
+	ID:      "01DH8XG3VRM0M3V5T3RFP2A6WN",
+	Name:    "foo",
+	Version: "1.0.0",
+	Provide: []interface{}{
+		func() Foo { return "foo" },
+	},
+	Invoke: []interface{}{
+		func(foo Foo) {},
+	},
+	Events: []string{"01DH8XGKDMC0AHB9QDJ3XN2NEK"},
+	Errors: []error{errors.New("BOOM")},
+	HealthChecks: []fxapp.ComponentHealthCheck{{
+		Check: health.Check{ID: "01DH8XH0DPA3Y6HMA8V5VG0B2C", Description: "foo", RedImpact: "fatal"},
+		Checker: func(foo Foo) func(ctx context.Context) (health.Status, error) {
+			return func(ctx context.Context) (health.Status, error) { return health.Green, nil }
+		},
+	}},
+	Metrics: []fxapp.MetricDesc{{Name: "foo_requests", Help: "foo requests", MetricType: fxapp.Counter}},
+}
+
+func TestBuilder_RegisterComponents(t *testing.T) {
+	t.Parallel()
+
+	var components fxapp.RegisteredComponents
+	var foo Foo
+	buf := fxapptest.NewSyncLog()
+	_, err := fxapp.NewBuilder(fxapp.ID(ulids.MustNew()), fxapp.ReleaseID(ulids.MustNew())).
+		RegisterComponents(FooComp).
+		LogWriter(buf).
+		Populate(&components, &foo).
+		DisableHTTPServer().
+		Build()
+	require.NoError(t, err)
+
+	// Then the component constructors are registered with the app
+	assert.Equal(t, Foo("foo"), foo)
+	// And the component is registered
+	require.Len(t, components(), 1)
+	assert.Equal(t, FooComp.ID, components()[0].ID)
+
+	// And the component registration is logged
+	type Data struct {
+		ID           string
+		Name         string
+		Version      string
+		Provides     []string
+		Invokes      []string
+		Events       []string
+		Errors       []string
+		HealthChecks []string `json:"health_checks"`
+		Metrics      []string
+	}
+
+	type LogEvent struct {
+		Name string `json:"n"`
+		Data Data   `json:"d"`
+	}
+
+	reader := bufio.NewReader(buf)
+	for {
+		line, err := reader.ReadString('\n')
+		if err != nil {
+			t.Error("*** component registered event was not logged")
+			return
+		}
+		var logEvent LogEvent
+		require.NoError(t, json.Unmarshal([]byte(line), &logEvent))
+		if logEvent.Name == fxapp.ComponentRegisteredEvent {
+			t.Log(line)
+			assert.Equal(t, FooComp.ID, logEvent.Data.ID)
+			assert.Equal(t, FooComp.Name, logEvent.Data.Name)
+			assert.Equal(t, FooComp.Version, logEvent.Data.Version)
+			assert.Equal(t, []string{"func() fxapp_test.Foo"}, logEvent.Data.Provides)
+			assert.Equal(t, []string{"func(fxapp_test.Foo)"}, logEvent.Data.Invokes)
+			assert.Equal(t, FooComp.Events, logEvent.Data.Events)
+			assert.Equal(t, []string{"BOOM"}, logEvent.Data.Errors)
+			assert.Equal(t, []string{"01DH8XH0DPA3Y6HMA8V5VG0B2C"}, logEvent.Data.HealthChecks)
+			assert.Equal(t, []string{"foo_requests"}, logEvent.Data.Metrics)
+			return
+		}
+	}
+}
+
+func TestBuilder_RegisterComponents_ComponentFuncsInvokedBeforeAppFuncs(t *testing.T) {
+	t.Parallel()
+
+	var invoked []string
+	comp := FooComp
+	comp.Invoke = []interface{}{func() { invoked = append(invoked, "comp") }}
+	app, err := fxapp.NewBuilder(fxapp.ID(ulids.MustNew()), fxapp.ReleaseID(ulids.MustNew())).
+		Invoke(func() { invoked = append(invoked, "app") }).
+		RegisterComponents(comp).
+		DisableHTTPServer().
+		Build()
+	require.NoError(t, err)
+	assert.Equal(t, []string{"comp", "app"}, invoked)
+	assert.Len(t, app.FuncTypes(), 2)
+}
+
+func TestBuilder_RegisterComponents_Invalid(t *testing.T) {
+	t.Parallel()
+
+	t.Run("invalid component descriptor", func(t *testing.T) {
+		_, err := fxapp.NewBuilder(fxapp.ID(ulids.MustNew()), fxapp.ReleaseID(ulids.MustNew())).
+			RegisterComponents(fxapp.Component{ID: "foo", Version: "1.0"}).
+			Invoke(func() {}).
+			DisableHTTPServer().
+			Build()
+		require.Error(t, err)
+		t.Log(err)
+		assert.Contains(t, err.Error(), fxapp.ErrComponentIDNotULID.Error())
+		assert.Contains(t, err.Error(), fxapp.ErrComponentBlankName.Error())
+		assert.Contains(t, err.Error(), fxapp.ErrComponentInvalidVersion.Error())
+	})
+
+	t.Run("component is registered twice", func(t *testing.T) {
+		_, err := fxapp.NewBuilder(fxapp.ID(ulids.MustNew()), fxapp.ReleaseID(ulids.MustNew())).
+			RegisterComponents(FooComp, FooComp).
+			DisableHTTPServer().
+			Build()
+		require.Error(t, err)
+		t.Log(err)
+		assert.Contains(t, err.Error(), fxapp.ErrComponentAlreadyRegistered.Error())
+	})
+}
+
+func TestComponentsHTTPEndpoint(t *testing.T) {
+	app, err := fxapp.NewBuilder(fxapp.ID(ulids.MustNew()), fxapp.ReleaseID(ulids.MustNew())).
+		RegisterComponents(FooComp).
+		AllowUnauthenticatedAdmin().
+		Build()
+	require.NoError(t, err)
+
+	go app.Run()
+	<-app.Ready()
+	defer func() {
+		app.Shutdown()
+		<-app.Done()
+	}()
+
+	checkHTTPGetResponse(t, fmt.Sprintf("http://:8008/%s", fxapp.ComponentsEndpoint), func(response *http.Response) {
+		require.Equal(t, http.StatusOK, response.StatusCode)
+		var components []struct {
+			ID      string
+			Name    string
+			Version string
+		}
+		require.NoError(t, json.NewDecoder(response.Body).Decode(&components))
+		require.Len(t, components, 1)
+		assert.Equal(t, FooComp.ID, components[0].ID)
+		assert.Equal(t, FooComp.Name, components[0].Name)
+		assert.Equal(t, FooComp.Version, components[0].Version)
+	})
+}
+
+func TestBuilder_RegisterComponents_VersionConstraints(t *testing.T) {
+	t.Parallel()
+
+	Bar := fxapp.Component{
+		ID:      "01DH8ZK1M5XQ1F2R7QF8V3J3WS",
+		Name:    "bar",
+		Version: "2.0.0",
+		Invoke:  []interface{}{func() {}},
+	}
+
+	build := func(components ...fxapp.Component) error {
+		_, err := fxapp.NewBuilder(fxapp.ID(ulids.MustNew()), fxapp.ReleaseID(ulids.MustNew())).
+			RegisterComponents(components...).
+			DisableHTTPServer().
+			Build()
+		return err
+	}
+
+	t.Run("constraints are satisfied", func(t *testing.T) {
+		bar := Bar
+		bar.Requires = []fxapp.ComponentConstraint{{ID: FooComp.ID, Version: ">=1.0.0 <2.0.0"}}
+		assert.NoError(t, build(FooComp, bar))
+	})
+
+	t.Run("required component version is not satisfied", func(t *testing.T) {
+		bar := Bar
+		bar.Requires = []fxapp.ComponentConstraint{{ID: FooComp.ID, Version: ">=1.2.0"}}
+		err := build(FooComp, bar)
+		require.Error(t, err)
+		t.Log(err)
+		assert.Contains(t, err.Error(), fxapp.ErrComponentConstraintsUnsatisfied.Error())
+		assert.Contains(t, err.Error(), "registered version is 1.0.0")
+	})
+
+	t.Run("all unsatisfied constraints are reported", func(t *testing.T) {
+		bar := Bar
+		bar.Requires = []fxapp.ComponentConstraint{
+			{ID: FooComp.ID, Version: ">=1.2.0"},
+			{ID: "01DH8ZN5G4WQ7B2C9F2E6D3M8H", Version: ">=1.0.0"},
+			{ID: FooComp.ID, Version: ">=1.2"},
+		}
+		err := build(FooComp, bar)
+		require.Error(t, err)
+		t.Log(err)
+		assert.Contains(t, err.Error(), "registered version is 1.0.0")
+		assert.Contains(t, err.Error(), "component is not registered")
+		assert.Contains(t, err.Error(), "invalid version range")
+	})
+}
+
+type FooCounters struct {
+	fx.Out
+
+	Requests prometheus.Counter `name:"requests"`
+}
+
+type BarParams struct {
+	fx.In
+
+	Registerer prometheus.Registerer
+}
+
+func TestComponent_MetricsAreLabeledWithComponent(t *testing.T) {
+	t.Parallel()
+
+	foo := FooComp
+	foo.HealthChecks = nil
+	foo.Provide = []interface{}{
+		func(registerer prometheus.Registerer) (FooCounters, error) {
+			counter := prometheus.NewCounter(prometheus.CounterOpts{Name: "foo_requests", Help: "foo requests"})
+			return FooCounters{Requests: counter}, registerer.Register(counter)
+		},
+	}
+	foo.Invoke = []interface{}{func(params struct {
+		fx.In
+		Requests prometheus.Counter `name:"requests"`
+	}) {
+		params.Requests.Inc()
+	}}
+	bar := fxapp.Component{
+		ID:      "01DH8ZK1M5XQ1F2R7QF8V3J3WS",
+		Name:    "bar",
+		Version: "2.0.0",
+		Invoke: []interface{}{func(params BarParams) error {
+			return params.Registerer.Register(prometheus.NewGauge(prometheus.GaugeOpts{Name: "bar_gauge", Help: "bar gauge"}))
+		}},
+	}
+
+	var gatherer prometheus.Gatherer
+	_, err := fxapp.NewBuilder(fxapp.ID(ulids.MustNew()), fxapp.ReleaseID(ulids.MustNew())).
+		RegisterComponents(foo, bar).
+		Populate(&gatherer).
+		DisableHTTPServer().
+		Build()
+	require.NoError(t, err)
+
+	mfs, err := gatherer.Gather()
+	require.NoError(t, err)
+	checkComponentLabels := func(metricName string, comp fxapp.Component) {
+		mf := fxapp.FindMetricFamily(mfs, func(mf *dto.MetricFamily) bool { return mf.GetName() == metricName })
+		require.NotNil(t, mf, metricName)
+		labels := make(map[string]string)
+		for _, label := range mf.Metric[0].Label {
+			labels[label.GetName()] = label.GetValue()
+		}
+		t.Log(labels)
+		assert.Equal(t, comp.ID, labels[fxapp.ComponentIDLabel])
+		assert.Equal(t, comp.Version, labels[fxapp.ComponentVersionLabel])
+		// And the app labels are still applied
+		assert.NotEmpty(t, labels[fxapp.AppIDLabel])
+	}
+	checkComponentLabels("foo_requests", foo)
+	checkComponentLabels("bar_gauge", bar)
+}
+
+func TestComponent_LoggerIsScopedToComponent(t *testing.T) {
+	t.Parallel()
+
+	foo := FooComp
+	foo.Provide = []interface{}{
+		func(logger *zerolog.Logger) Foo {
+			logger.Info().Msg("providing foo")
+			return "foo"
+		},
+	}
+	foo.Invoke = []interface{}{func(params struct {
+		fx.In
+		Foo    Foo
+		Logger *zerolog.Logger
+	}) {
+		params.Logger.Info().Msg("invoked foo")
+	}}
+
+	buf := fxapptest.NewSyncLog()
+	_, err := fxapp.NewBuilder(fxapp.ID(ulids.MustNew()), fxapp.ReleaseID(ulids.MustNew())).
+		RegisterComponents(foo).
+		Invoke(func(logger *zerolog.Logger) {
+			logger.Info().Msg("app func")
+		}).
+		LogWriter(buf).
+		DisableHTTPServer().
+		Build()
+	require.NoError(t, err)
+
+	type LogEvent struct {
+		Component     string `json:"c"`
+		ComponentName string `json:"cn"`
+		Message       string `json:"m"`
+	}
+	logEvents := make(map[string]LogEvent)
+	reader := bufio.NewReader(buf)
+	for {
+		line, err := reader.ReadString('\n')
+		if err != nil {
+			break
+		}
+		var logEvent LogEvent
+		require.NoError(t, json.Unmarshal([]byte(line), &logEvent))
+		logEvents[logEvent.Message] = logEvent
+	}
+
+	for _, msg := range []string{"providing foo", "invoked foo"} {
+		logEvent, ok := logEvents[msg]
+		require.True(t, ok, msg)
+		assert.Equal(t, foo.ID, logEvent.Component)
+		assert.Equal(t, foo.Name, logEvent.ComponentName)
+	}
+	// And the app logger is not scoped to the component
+	require.Contains(t, logEvents, "app func")
+	assert.Empty(t, logEvents["app func"].Component)
+}
+
+func TestComponent_HealthChecks(t *testing.T) {
+	var unregistered bool
+	var registeredChecks health.RegisteredChecks
+	// the foo component health checks are unregistered before the bar component's OnStop hook runs, because bar is
+	// registered before foo
+	bar := fxapp.Component{
+		ID:      "01DH8ZK1M5XQ1F2R7QF8V3J3WS",
+		Name:    "bar",
+		Version: "2.0.0",
+		Invoke: []interface{}{func(lc fx.Lifecycle, checks health.RegisteredChecks) {
+			registeredChecks = checks
+			lc.Append(fx.Hook{
+				OnStop: func(context.Context) error {
+					for _, check := range <-checks(health.Query{}) {
+						if check.ID == FooComp.HealthChecks[0].ID {
+							return nil
+						}
+					}
+					unregistered = true
+					return nil
+				},
+			})
+		}},
+	}
+
+	app, err := fxapp.NewBuilder(fxapp.ID(ulids.MustNew()), fxapp.ReleaseID(ulids.MustNew())).
+		RegisterComponents(bar, FooComp).
+		DisableHTTPServer().
+		Build()
+	require.NoError(t, err)
+
+	go app.Run()
+	<-app.Ready()
+	// Then the component health check is registered
+	checks := <-registeredChecks(health.Query{})
+	var check *health.RegisteredCheck
+	for i := range checks {
+		if checks[i].ID == FooComp.HealthChecks[0].ID {
+			check = &checks[i]
+		}
+	}
+	require.NotNil(t, check)
+	assert.Equal(t, health.Green, check.Checker().Status)
+
+	app.Shutdown()
+	<-app.Done()
+	// And the health check is unregistered when the app is stopped
+	assert.True(t, unregistered)
+}
+
+func TestComponent_HealthChecks_Invalid(t *testing.T) {
+	t.Parallel()
+
+	invalidCheckers := []interface{}{
+		nil,
+		"not a func",
+		func() {},
+		func() func() health.Status { return nil },
+		func() (func(ctx context.Context) (health.Status, error), string) { return nil, "" },
+		func(...Foo) func(ctx context.Context) (health.Status, error) { return nil },
+	}
+	for _, checker := range invalidCheckers {
+		foo := FooComp
+		foo.HealthChecks = []fxapp.ComponentHealthCheck{{
+			Check:   FooComp.HealthChecks[0].Check,
+			Checker: checker,
+		}}
+		_, err := fxapp.NewBuilder(fxapp.ID(ulids.MustNew()), fxapp.ReleaseID(ulids.MustNew())).
+			RegisterComponents(foo).
+			DisableHTTPServer().
+			Build()
+		require.Error(t, err)
+		t.Log(err)
+		assert.Contains(t, err.Error(), fxapp.ErrComponentInvalidHealthChecker.Error())
+	}
+
+	t.Run("checker factory fails", func(t *testing.T) {
+		foo := FooComp
+		foo.HealthChecks = []fxapp.ComponentHealthCheck{{
+			Check: FooComp.HealthChecks[0].Check,
+			Checker: func() (func(ctx context.Context) (health.Status, error), error) {
+				return nil, errors.New("checker factory failed")
+			},
+		}}
+		_, err := fxapp.NewBuilder(fxapp.ID(ulids.MustNew()), fxapp.ReleaseID(ulids.MustNew())).
+			RegisterComponents(foo).
+			DisableHTTPServer().
+			Build()
+		require.Error(t, err)
+		assert.Contains(t, err.Error(), "checker factory failed")
+	})
+}
@@ -0,0 +1,171 @@
+/*
+ * Copyright (c) 2019 OysterPack, Inc.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ * http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package fxapp
+
+import (
+	"errors"
+	"fmt"
+	"go.uber.org/multierr"
+	"os"
+	"strconv"
+	"strings"
+)
+
+// Built-in modules that can be toggled via env vars - see `ModuleEnabledEnvVar()`
+const (
+	// AdminUIModule is enabled by default, i.e., APP12X_MODULE_ADMIN_UI_ENABLED=false disables the admin UI - see
+	// `AdminUIEndpoint`
+	AdminUIModule = "admin_ui"
+	// PprofModule is disabled by default, i.e., APP12X_MODULE_PPROF_ENABLED=true registers the pprof endpoints - see
+	// `PprofEndpointPathPrefix`. It is equivalent to APP12X_PROFILER_PPROF_ENDPOINTS=true.
+	PprofModule = "pprof"
+)
+
+// ErrInvalidCondition indicates a condition is invalid, e.g., an env flag is not a valid boolean
+var ErrInvalidCondition = errors.New("condition is invalid")
+
+// BuilderOption is used to configure the app builder, e.g., to enable optional modules.
+type BuilderOption func(b Builder) Builder
+
+// Condition is used to conditionally configure the app - see `Builder.EnableIf()`
+//
+// Conditions are evaluated lazily, i.e., when the app is built, which enables the same binary to be configured per
+// environment via env vars.
+type Condition struct {
+	// Name describes the condition, e.g., the env var name
+	Name string
+	Eval func() (bool, error)
+}
+
+// EnvFlag returns a condition that is based on the env var boolean value, i.e., the values accepted by
+// `strconv.ParseBool()`. If the env var is not set, then the default value is used.
+func EnvFlag(name string, defaultValue bool) Condition {
+	return Condition{
+		Name: name,
+		Eval: func() (bool, error) {
+			value, ok := os.LookupEnv(name)
+			value = strings.TrimSpace(value)
+			if !ok || value == "" {
+				return defaultValue, nil
+			}
+			return strconv.ParseBool(value)
+		},
+	}
+}
+
+// ModuleEnabledEnvVar returns the env var name that is used to toggle the module, i.e., APP12X_MODULE_<NAME>_ENABLED.
+// The module name is upper cased, and '-', '.', and ' ' are replaced with '_', e.g., "admin-ui" maps to
+// APP12X_MODULE_ADMIN_UI_ENABLED.
+func ModuleEnabledEnvVar(module string) string {
+	return EnvPrefix(EnvconfigPrefix).ModuleEnabledEnvVar(module)
+}
+
+// ModuleEnabledEnvVar returns the env var name that is used to toggle the module within the env prefix namespace, i.e.,
+// ${prefix}_MODULE_<NAME>_ENABLED - see `ModuleEnabledEnvVar()`
+func (p EnvPrefix) ModuleEnabledEnvVar(module string) string {
+	name := strings.Map(func(r rune) rune {
+		switch r {
+		case '-', '.', ' ':
+			return '_'
+		}
+		return r
+	}, strings.ToUpper(strings.TrimSpace(module)))
+	return p.EnvVar(fmt.Sprintf("MODULE_%s_ENABLED", name))
+}
+
+// ModuleEnabled returns an env flag condition that is used to toggle the module - see `ModuleEnabledEnvVar()`, e.g.,
+//
+//	builder.EnableIf(fxapp.ModuleEnabled("outbox", false), func(b fxapp.Builder) fxapp.Builder {
+//		return b.EnableOutboxRelay(opts)
+//	})
+func ModuleEnabled(module string, defaultValue bool) Condition {
+	return EnvPrefix(EnvconfigPrefix).ModuleEnabled(module, defaultValue)
+}
+
+// ModuleEnabled returns an env flag condition that is used to toggle the module within the env prefix namespace, e.g.,
+//
+//	builder.EnableIf(builder.EnvPrefix().ModuleEnabled("outbox", false), func(b fxapp.Builder) fxapp.Builder {
+//		return b.EnableOutboxRelay(opts)
+//	})
+func (p EnvPrefix) ModuleEnabled(module string, defaultValue bool) Condition {
+	return EnvFlag(p.ModuleEnabledEnvVar(module), defaultValue)
+}
+
+type conditional struct {
+	condition Condition
+	options   []BuilderOption
+}
+
+// records how a condition was evaluated when the app was built
+type conditionResult struct {
+	Name    string
+	Enabled bool
+}
+
+// applyConditionals evaluates the registered conditions, and applies the options for the conditions that are met.
+// Options may register conditionals themselves, which are evaluated in turn. Each conditional is evaluated once, i.e.,
+// it is consumed when it is applied.
+func (b *builder) applyConditionals() error {
+	var err error
+	for len(b.conditionals) > 0 {
+		conditionals := b.conditionals
+		b.conditionals = nil
+		for _, c := range conditionals {
+			if c.condition.Eval == nil {
+				err = multierr.Append(err, fmt.Errorf("%s : %q : Eval is required", ErrInvalidCondition, c.condition.Name))
+				continue
+			}
+			enabled, e := c.condition.Eval()
+			if e != nil {
+				err = multierr.Append(err, fmt.Errorf("%s : %q : %s", ErrInvalidCondition, c.condition.Name, e))
+				continue
+			}
+			b.conditionResults = append(b.conditionResults, conditionResult{Name: c.condition.Name, Enabled: enabled})
+			if !enabled {
+				continue
+			}
+			for _, option := range c.options {
+				if option == nil {
+					err = multierr.Append(err, fmt.Errorf("%s : %q : option must not be nil", ErrInvalidCondition, c.condition.Name))
+					continue
+				}
+				option(b)
+			}
+		}
+	}
+	return err
+}
+
+// loadModuleToggles loads the built-in module env var toggles
+func (b *builder) loadModuleToggles() error {
+	adminUI, err := b.envPrefix.ModuleEnabled(AdminUIModule, true).Eval()
+	if err != nil {
+		return fmt.Errorf("%s : %q : %s", ErrInvalidCondition, b.envPrefix.ModuleEnabledEnvVar(AdminUIModule), err)
+	}
+	pprof, err := b.envPrefix.ModuleEnabled(PprofModule, false).Eval()
+	if err != nil {
+		return fmt.Errorf("%s : %q : %s", ErrInvalidCondition, b.envPrefix.ModuleEnabledEnvVar(PprofModule), err)
+	}
+	b.adminUIDisabled = !adminUI
+	if pprof {
+		if b.profilingOpts == nil {
+			b.profilingOpts = &ProfilingOpts{}
+		}
+		b.profilingOpts.PprofEndpoints = true
+	}
+	return nil
+}
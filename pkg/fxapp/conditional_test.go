@@ -0,0 +1,108 @@
+/*
+ * Copyright (c) 2019 OysterPack, Inc.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ * http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package fxapp_test
+
+import (
+	"github.com/oysterpack/andiamo/pkg/fxapp"
+	"github.com/oysterpack/andiamo/pkg/fxapptest"
+	"github.com/oysterpack/andiamo/pkg/ulids"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"io/ioutil"
+	"net/http"
+	"testing"
+)
+
+func TestModuleEnabledEnvVar(t *testing.T) {
+	t.Parallel()
+
+	assert.Equal(t, "APP12X_MODULE_ADMIN_UI_ENABLED", fxapp.ModuleEnabledEnvVar(fxapp.AdminUIModule))
+	assert.Equal(t, "APP12X_MODULE_ADMIN_UI_ENABLED", fxapp.ModuleEnabledEnvVar(" admin-ui "))
+	assert.Equal(t, "APP12X_MODULE_OUTBOX_RELAY_ENABLED", fxapp.ModuleEnabledEnvVar("outbox.relay"))
+}
+
+func TestBuilder_EnableIf(t *testing.T) {
+	const Flag = "FXAPP_TEST_ENABLE_IF"
+	t.Setenv(fxapp.ModuleEnabledEnvVar("foo"), "true")
+	t.Setenv(Flag, "false")
+
+	var foo, bar, baz, nested bool
+	_, err := fxapp.NewBuilder(fxapp.ID(ulids.MustNew()), fxapp.ReleaseID(ulids.MustNew())).
+		Invoke(func() {}).
+		EnableIf(fxapp.ModuleEnabled("foo", false), func(b fxapp.Builder) fxapp.Builder {
+			return b.Invoke(func() { foo = true }).
+				EnableIf(fxapp.ModuleEnabled("nested", true), func(b fxapp.Builder) fxapp.Builder {
+					return b.Invoke(func() { nested = true })
+				})
+		}).
+		EnableIf(fxapp.EnvFlag(Flag, true), func(b fxapp.Builder) fxapp.Builder {
+			return b.Invoke(func() { bar = true })
+		}).
+		EnableIf(fxapp.ModuleEnabled("baz", false), func(b fxapp.Builder) fxapp.Builder {
+			return b.Invoke(func() { baz = true })
+		}).
+		DisableHTTPServer().
+		LogWriter(ioutil.Discard).
+		Build()
+	require.NoError(t, err)
+	assert.True(t, foo, "the env flag is set")
+	assert.True(t, nested, "the env flag defaults to true")
+	assert.False(t, bar, "the env flag is set to false")
+	assert.False(t, baz, "the env flag defaults to false")
+}
+
+func TestBuilder_EnableIf_InvalidCondition(t *testing.T) {
+	t.Setenv(fxapp.ModuleEnabledEnvVar("foo"), "yes please")
+
+	err := fxapp.NewBuilder(fxapp.ID(ulids.MustNew()), fxapp.ReleaseID(ulids.MustNew())).
+		Invoke(func() {}).
+		EnableIf(fxapp.ModuleEnabled("foo", false)).
+		EnableIf(fxapp.Condition{Name: "nil eval"}).
+		EnableIf(fxapp.Condition{Name: "nil option", Eval: func() (bool, error) { return true, nil }}, nil).
+		DisableHTTPServer().
+		LogWriter(ioutil.Discard).
+		Validate()
+	require.Error(t, err)
+	report, ok := err.(*fxapp.BuildReport)
+	require.True(t, ok)
+	require.Len(t, report.Problems, 3)
+	for _, problem := range report.Problems {
+		assert.Equal(t, fxapp.InvalidOptsProblem, problem.Kind)
+		assert.Contains(t, problem.Msg, fxapp.ErrInvalidCondition.Error())
+	}
+	assert.Contains(t, report.Problems[0].Msg, "APP12X_MODULE_FOO_ENABLED")
+}
+
+func TestModuleToggles(t *testing.T) {
+	t.Setenv(fxapp.ModuleEnabledEnvVar(fxapp.AdminUIModule), "false")
+	t.Setenv(fxapp.ModuleEnabledEnvVar(fxapp.PprofModule), "true")
+
+	builder := fxapp.NewBuilder(fxapp.ID(ulids.MustNew()), fxapp.ReleaseID(ulids.MustNew())).
+		Invoke(func() {}).
+		LogWriter(ioutil.Discard)
+	fxapptest.RunApp(t, builder, func(app fxapp.App, client *fxapptest.HTTPClient) {
+		response, err := client.Get(fxapp.AdminUIEndpoint)
+		require.NoError(t, err)
+		response.Body.Close()
+		assert.Equal(t, http.StatusNotFound, response.StatusCode)
+
+		response, err = client.Get(fxapp.PprofEndpointPathPrefix)
+		require.NoError(t, err)
+		response.Body.Close()
+		assert.Equal(t, http.StatusOK, response.StatusCode)
+	})
+}
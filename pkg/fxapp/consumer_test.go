@@ -0,0 +1,73 @@
+/*
+ * Copyright (c) 2019 OysterPack, Inc.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ * http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package fxapp_test
+
+import (
+	"context"
+	"github.com/oysterpack/andiamo/pkg/fx/consumer"
+	"github.com/oysterpack/andiamo/pkg/fxapp"
+	"github.com/oysterpack/andiamo/pkg/fxapptest"
+	"github.com/oysterpack/andiamo/pkg/ulids"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"io/ioutil"
+	"net/http"
+	"testing"
+	"time"
+)
+
+func TestBuilder_EnableQueueConsumers(t *testing.T) {
+	t.Parallel()
+
+	msgs := make(chan consumer.Message, 1)
+	handled := make(chan string, 1)
+	healthCheckID := ulids.MustNew().String()
+	builder := fxapp.NewBuilder(fxapp.ID(ulids.MustNew()), fxapp.ReleaseID(ulids.MustNew())).
+		Provide(func() consumer.Registration {
+			return consumer.NewRegistration(consumer.Consumer{
+				Name:   "orders",
+				Source: consumer.NewChannelSource(msgs, nil),
+				Handler: consumer.HandlerFunc(func(ctx context.Context, msg consumer.Message) error {
+					handled <- msg.ID
+					return nil
+				}),
+				HealthCheckID: healthCheckID,
+			})
+		}).
+		Invoke(func() {}).
+		EnableQueueConsumers(consumer.Opts{}).
+		LogWriter(ioutil.Discard)
+
+	fxapptest.RunApp(t, builder, func(app fxapp.App, client *fxapptest.HTTPClient) {
+		msgs <- consumer.Message{ID: "1"}
+		select {
+		case id := <-handled:
+			assert.Equal(t, "1", id)
+		case <-time.After(5 * time.Second):
+			t.Fatal("*** timed out waiting for the message to be handled")
+		}
+
+		// the consumer health check is registered
+		response, err := client.Get(fxapp.HealthCheckResultsEndpoint)
+		require.NoError(t, err)
+		defer response.Body.Close()
+		body, err := ioutil.ReadAll(response.Body)
+		require.NoError(t, err)
+		require.Equal(t, http.StatusOK, response.StatusCode)
+		assert.Contains(t, string(body), healthCheckID)
+	})
+}
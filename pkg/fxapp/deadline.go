@@ -0,0 +1,197 @@
+/*
+ * Copyright (c) 2019 OysterPack, Inc.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ * http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package fxapp
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"github.com/oysterpack/andiamo/pkg/clock"
+	"github.com/oysterpack/andiamo/pkg/eventlog"
+	"github.com/rs/zerolog"
+	"net/http"
+	"time"
+)
+
+// DeadlineHeader is used to propagate request deadlines across app boundaries. The header value is the absolute deadline,
+// formatted as RFC 3339 with nanoseconds, e.g., "2019-08-01T15:04:05.999999999Z".
+//
+// NOTE: absolute deadlines assume the app instance clocks are synchronized, e.g., via NTP.
+const DeadlineHeader = "X-Request-Deadline"
+
+// deadline events
+const (
+	// DeadlineExceededEvent is logged when an HTTP request is rejected because its propagated deadline has already been
+	// exceeded.
+	//
+	//	type Data struct {
+	//		Method     string `json:"method"`
+	//		Path       string `json:"path"`
+	//		RemoteAddr string `json:"remote_addr"`
+	//		Deadline   string `json:"deadline"`
+	//		// how long ago the deadline was exceeded - msec
+	//		Exceeded   uint   `json:"exceeded"`
+	//	}
+	DeadlineExceededEvent = "01DJ1FXTKZHH9MNGS7KZVXGC3W"
+
+	// DeadlineBudgetEvent is logged at debug level to trace the remaining deadline budget for an operation - see
+	// `LogRemainingBudget()`
+	//
+	//	type Data struct {
+	//		Op        string `json:"op"`
+	//		// the time remaining until the context deadline - msec
+	//		Remaining uint   `json:"remaining"`
+	//		// false means the context has no deadline
+	//		Deadline  bool   `json:"deadline"`
+	//	}
+	DeadlineBudgetEvent = "01DJ1FXTR84QDGSBX7C7JD1TA1"
+)
+
+// ErrInvalidDeadlineOpts indicates the deadline options are invalid
+var ErrInvalidDeadlineOpts = errors.New("deadline `DefaultBudget` and `MaxBudget` must not be negative")
+
+// DeadlineOpts is used to configure request deadline propagation - see `NewDeadlineMiddleware()`
+type DeadlineOpts struct {
+	// DefaultBudget is applied to requests that do not propagate a deadline. If zero, then the request has no deadline.
+	DefaultBudget time.Duration
+	// MaxBudget caps the propagated deadlines, i.e., clients cannot request more time than the MaxBudget. If zero, then
+	// propagated deadlines are not capped.
+	MaxBudget time.Duration
+}
+
+func (opts DeadlineOpts) validate() error {
+	if opts.DefaultBudget < 0 || opts.MaxBudget < 0 {
+		return fmt.Errorf("%s : %#v", ErrInvalidDeadlineOpts, opts)
+	}
+	return nil
+}
+
+// WithBudget derives the context for an operation from the budget, i.e., the context deadline is the sooner of the
+// parent context deadline and the budget from now. Thus, an operation budget never extends the parent deadline.
+func WithBudget(ctx context.Context, budget time.Duration) (context.Context, context.CancelFunc) {
+	if deadline, ok := ctx.Deadline(); ok && time.Until(deadline) <= budget {
+		return context.WithCancel(ctx)
+	}
+	return context.WithTimeout(ctx, budget)
+}
+
+// RemainingBudget returns the time remaining until the context deadline. False is returned if the context has no deadline.
+// If the deadline has been exceeded, then the remaining budget is negative.
+func RemainingBudget(ctx context.Context) (time.Duration, bool) {
+	deadline, ok := ctx.Deadline()
+	if !ok {
+		return 0, false
+	}
+	return time.Until(deadline), true
+}
+
+// LogRemainingBudget logs the remaining deadline budget for the operation at debug level - see `DeadlineBudgetEvent`
+func LogRemainingBudget(ctx context.Context, logger *zerolog.Logger, op string) {
+	remaining, ok := RemainingBudget(ctx)
+	eventlog.NewLogger(DeadlineBudgetEvent, logger, zerolog.DebugLevel)(deadlineBudget{
+		op:        op,
+		remaining: remaining,
+		deadline:  ok,
+	}, "deadline budget")
+}
+
+// SetDeadlineHeader propagates the context deadline via the request header - see `DeadlineHeader`. If the context has no
+// deadline, then the header is not set.
+func SetDeadlineHeader(ctx context.Context, header http.Header) {
+	if deadline, ok := ctx.Deadline(); ok {
+		header.Set(DeadlineHeader, deadline.UTC().Format(time.RFC3339Nano))
+	}
+}
+
+// NewDeadlineMiddleware returns middleware that applies request deadlines to the request context:
+//   - if the request propagates a deadline via the `DeadlineHeader`, then it is applied, capped by the MaxBudget
+//   - if the propagated deadline has already been exceeded, then the request is rejected with HTTP 504, and the
+//     `DeadlineExceededEvent` is logged, i.e., there is no point in doing work that the client has given up on
+//   - if the deadline header is invalid, then the request is rejected with HTTP 400
+//   - otherwise, the DefaultBudget is applied
+//
+// NOTE: the options are assumed to be valid
+func NewDeadlineMiddleware(opts DeadlineOpts, clock clock.Clock, logger *zerolog.Logger) func(http.Handler) http.Handler {
+	logDeadlineExceeded := eventlog.NewLogger(DeadlineExceededEvent, logger, zerolog.WarnLevel)
+	return func(handler http.Handler) http.Handler {
+		return http.HandlerFunc(func(writer http.ResponseWriter, request *http.Request) {
+			now := clock.Now()
+			var budget time.Duration
+			if value := request.Header.Get(DeadlineHeader); value != "" {
+				deadline, err := time.Parse(time.RFC3339Nano, value)
+				if err != nil {
+					http.Error(writer, fmt.Sprintf("invalid %s header : %s", DeadlineHeader, err), http.StatusBadRequest)
+					return
+				}
+				budget = deadline.Sub(now)
+				if budget <= 0 {
+					logDeadlineExceeded(deadlineExceeded{
+						method:     request.Method,
+						path:       request.URL.Path,
+						remoteAddr: request.RemoteAddr,
+						deadline:   deadline,
+						exceeded:   -budget,
+					}, "request deadline exceeded")
+					http.Error(writer, "request deadline exceeded", http.StatusGatewayTimeout)
+					return
+				}
+				if opts.MaxBudget > 0 && budget > opts.MaxBudget {
+					budget = opts.MaxBudget
+				}
+			} else {
+				budget = opts.DefaultBudget
+			}
+
+			if budget > 0 {
+				ctx, cancel := context.WithTimeout(request.Context(), budget)
+				defer cancel()
+				request = request.WithContext(ctx)
+			}
+			handler.ServeHTTP(writer, request)
+		})
+	}
+}
+
+type deadlineExceeded struct {
+	method     string
+	path       string
+	remoteAddr string
+	deadline   time.Time
+	exceeded   time.Duration
+}
+
+func (e deadlineExceeded) MarshalZerologObject(event *zerolog.Event) {
+	event.
+		Str("method", e.method).
+		Str("path", e.path).
+		Str("remote_addr", e.remoteAddr).
+		Str("deadline", e.deadline.Format(time.RFC3339Nano)).
+		Dur("exceeded", e.exceeded)
+}
+
+type deadlineBudget struct {
+	op        string
+	remaining time.Duration
+	deadline  bool
+}
+
+func (e deadlineBudget) MarshalZerologObject(event *zerolog.Event) {
+	event.
+		Str("op", e.op).
+		Dur("remaining", e.remaining).
+		Bool("deadline", e.deadline)
+}
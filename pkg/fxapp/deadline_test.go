@@ -0,0 +1,146 @@
+/*
+ * Copyright (c) 2019 OysterPack, Inc.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ * http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package fxapp_test
+
+import (
+	"context"
+	"github.com/oysterpack/andiamo/pkg/fxapp"
+	"github.com/oysterpack/andiamo/pkg/fxapptest"
+	"github.com/oysterpack/andiamo/pkg/ulids"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"io/ioutil"
+	"net/http"
+	"testing"
+	"time"
+)
+
+func TestBuilder_EnableDeadlinePropagation(t *testing.T) {
+	t.Parallel()
+
+	// the route reports the remaining request budget
+	remainingBudgets := make(chan time.Duration, 1)
+	logs := fxapptest.NewLogCapture()
+	builder := fxapp.NewBuilder(fxapp.ID(ulids.MustNew()), fxapp.ReleaseID(ulids.MustNew())).
+		Provide(func() fxapp.HTTPHandler {
+			return fxapp.NewHTTPRoute(http.MethodGet, "/foo", func(writer http.ResponseWriter, request *http.Request) {
+				remaining, ok := fxapp.RemainingBudget(request.Context())
+				if !ok {
+					remaining = -1
+				}
+				remainingBudgets <- remaining
+			})
+		}).
+		Invoke(func() {}).
+		EnableDeadlinePropagation(fxapp.DeadlineOpts{
+			DefaultBudget: 5 * time.Second,
+			MaxBudget:     10 * time.Second,
+		}).
+		LogWriter(logs)
+
+	fxapptest.RunApp(t, builder, func(app fxapp.App, client *fxapptest.HTTPClient) {
+		get := func(deadline string) *http.Response {
+			request, err := http.NewRequest(http.MethodGet, client.URL("foo"), nil)
+			require.NoError(t, err)
+			if deadline != "" {
+				request.Header.Set(fxapp.DeadlineHeader, deadline)
+			}
+			response, err := client.Do(request)
+			require.NoError(t, err)
+			response.Body.Close()
+			return response
+		}
+
+		t.Run("default budget", func(t *testing.T) {
+			response := get("")
+			require.Equal(t, http.StatusOK, response.StatusCode)
+			remaining := <-remainingBudgets
+			assert.True(t, remaining > 0 && remaining <= 5*time.Second, "remaining: %s", remaining)
+		})
+
+		t.Run("propagated deadline", func(t *testing.T) {
+			ctx, cancel := context.WithTimeout(context.Background(), 2*time.Second)
+			defer cancel()
+			request, err := http.NewRequest(http.MethodGet, client.URL("foo"), nil)
+			require.NoError(t, err)
+			fxapp.SetDeadlineHeader(ctx, request.Header)
+			response, err := client.Do(request)
+			require.NoError(t, err)
+			response.Body.Close()
+			require.Equal(t, http.StatusOK, response.StatusCode)
+			remaining := <-remainingBudgets
+			assert.True(t, remaining > 0 && remaining <= 2*time.Second, "remaining: %s", remaining)
+		})
+
+		t.Run("propagated deadline is capped", func(t *testing.T) {
+			response := get(time.Now().Add(time.Hour).Format(time.RFC3339Nano))
+			require.Equal(t, http.StatusOK, response.StatusCode)
+			remaining := <-remainingBudgets
+			assert.True(t, remaining > 5*time.Second && remaining <= 10*time.Second, "remaining: %s", remaining)
+		})
+
+		t.Run("deadline exceeded", func(t *testing.T) {
+			response := get(time.Now().Add(-time.Second).Format(time.RFC3339Nano))
+			assert.Equal(t, http.StatusGatewayTimeout, response.StatusCode)
+			fxapptest.AssertEventLogged(t, logs, fxapp.DeadlineExceededEvent, fxapptest.Field("d.path", "/foo"))
+		})
+
+		t.Run("invalid deadline", func(t *testing.T) {
+			response := get("tomorrow")
+			assert.Equal(t, http.StatusBadRequest, response.StatusCode)
+		})
+	})
+}
+
+func TestDeadlineOpts_Validation(t *testing.T) {
+	t.Parallel()
+
+	_, err := fxapp.NewBuilder(fxapp.ID(ulids.MustNew()), fxapp.ReleaseID(ulids.MustNew())).
+		Invoke(func() {}).
+		EnableDeadlinePropagation(fxapp.DeadlineOpts{DefaultBudget: -time.Second}).
+		LogWriter(ioutil.Discard).
+		Build()
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), fxapp.ErrInvalidDeadlineOpts.Error())
+}
+
+func TestWithBudget(t *testing.T) {
+	t.Parallel()
+
+	// without a parent deadline, the budget is applied
+	ctx, cancel := fxapp.WithBudget(context.Background(), time.Minute)
+	defer cancel()
+	remaining, ok := fxapp.RemainingBudget(ctx)
+	require.True(t, ok)
+	assert.True(t, remaining > 59*time.Second && remaining <= time.Minute, "remaining: %s", remaining)
+
+	// the budget never extends the parent deadline
+	child, cancelChild := fxapp.WithBudget(ctx, time.Hour)
+	defer cancelChild()
+	childDeadline, _ := child.Deadline()
+	parentDeadline, _ := ctx.Deadline()
+	assert.Equal(t, parentDeadline, childDeadline)
+
+	// the budget is applied when it is sooner than the parent deadline
+	child, cancelChild = fxapp.WithBudget(ctx, time.Second)
+	defer cancelChild()
+	remaining, _ = fxapp.RemainingBudget(child)
+	assert.True(t, remaining <= time.Second, "remaining: %s", remaining)
+
+	_, ok = fxapp.RemainingBudget(context.Background())
+	assert.False(t, ok)
+}
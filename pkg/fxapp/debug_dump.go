@@ -0,0 +1,244 @@
+/*
+ * Copyright (c) 2019 OysterPack, Inc.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ * http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package fxapp
+
+import (
+	"crypto/subtle"
+	"errors"
+	"fmt"
+	"github.com/oklog/ulid"
+	"github.com/oysterpack/andiamo/pkg/clock"
+	"github.com/oysterpack/andiamo/pkg/eventlog"
+	"github.com/rs/zerolog"
+	"math"
+	"net/http"
+	"runtime"
+	"runtime/pprof"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// DebugDumpEndpoint is used to construct the HTTP endpoint that produces goroutine stacks, heap profiles, and allocation
+// profiles on demand, i.e., production diagnostics do not require exec-ing into containers. The endpoint is disabled by
+// default - see `Builder.EnableDebugDumps()`.
+//
+// The profile is specified via the "profile" query param, which defaults to "goroutine", e.g.,
+//
+//		GET /01DHYD1RM0GKJTNNKEYHE8EG9J?profile=heap
+//
+//	  - goroutine - the goroutine stacks are returned as text
+//	  - heap, allocs - the profile is returned in the pprof format, which can be analyzed via `go tool pprof`. If the
+//	    "debug=1" query param is specified, then the profile is returned as text. If the "gc=1" query param is specified,
+//	    then a garbage collection is run before the heap profile is taken.
+//
+// Safeguards:
+//   - if a token is configured, then requests must specify the token via the Authorization header, i.e.,
+//     "Authorization: Bearer <token>". Otherwise, HTTP 401 is returned.
+//   - dumps are rate limited, i.e., only 1 dump is produced at a time and dumps must be spaced apart by the configured
+//     min interval. Otherwise, HTTP 429 is returned.
+//   - each request is audited via the `DebugDumpEvent`
+const DebugDumpEndpoint = "01DHYD1RM0GKJTNNKEYHE8EG9J"
+
+// DebugDumpEvent is logged each time the debug dump endpoint is invoked, i.e., it is used as an audit log.
+//
+//	type Data struct {
+//		Profile    string `json:"profile"`
+//		// one of: ok, unauthorized, rate_limited, bad_request, error
+//		Outcome    string `json:"outcome"`
+//		RemoteAddr string `json:"remote_addr"`
+//		UserAgent  string `json:"user_agent"`
+//		Duration   uint   `json:"duration"`
+//	}
+const DebugDumpEvent = "01DHYD1RR9X6H2JP5FMD5C1124"
+
+// supported debug dump profiles
+const (
+	GoroutineDump = "goroutine"
+	HeapDump      = "heap"
+	AllocsDump    = "allocs"
+)
+
+// DefaultDebugDumpMinInterval is the default min amount of time between debug dumps
+const DefaultDebugDumpMinInterval = 10 * time.Second
+
+// ErrInvalidDebugDumpOpts indicates the debug dump options are invalid
+var ErrInvalidDebugDumpOpts = errors.New("debug dump `MinInterval` must not be negative")
+
+// DebugDumpOpts is used to configure the debug dump endpoint - see `DebugDumpEndpoint`
+type DebugDumpOpts struct {
+	// Token is used to protect the endpoint. If blank, then the endpoint is not token protected.
+	Token string
+	// MinInterval is the min amount of time between debug dumps. If zero, then DefaultDebugDumpMinInterval is used.
+	MinInterval time.Duration
+}
+
+func (opts DebugDumpOpts) validate() error {
+	if opts.MinInterval < 0 {
+		return fmt.Errorf("%s : %s", ErrInvalidDebugDumpOpts, opts.MinInterval)
+	}
+	return nil
+}
+
+func (opts DebugDumpOpts) withDefaults() DebugDumpOpts {
+	if opts.MinInterval == 0 {
+		opts.MinInterval = DefaultDebugDumpMinInterval
+	}
+	return opts
+}
+
+// debugDumpLimiter ensures that only 1 dump is produced at a time and that dumps are spaced apart by the min interval
+type debugDumpLimiter struct {
+	mutex       sync.Mutex
+	clock       clock.Clock
+	minInterval time.Duration
+	running     bool
+	last        time.Time
+}
+
+// acquire returns how long to wait before retrying if the dump is not allowed
+func (l *debugDumpLimiter) acquire() (bool, time.Duration) {
+	l.mutex.Lock()
+	defer l.mutex.Unlock()
+	if l.running {
+		return false, l.minInterval
+	}
+	if !l.last.IsZero() {
+		if wait := l.minInterval - l.clock.Since(l.last); wait > 0 {
+			return false, wait
+		}
+	}
+	l.running = true
+	l.last = l.clock.Now()
+	return true, 0
+}
+
+func (l *debugDumpLimiter) release() {
+	l.mutex.Lock()
+	defer l.mutex.Unlock()
+	l.running = false
+}
+
+type debugDumpAudit struct {
+	profile    string
+	outcome    string
+	remoteAddr string
+	userAgent  string
+	duration   time.Duration
+}
+
+func (a debugDumpAudit) MarshalZerologObject(e *zerolog.Event) {
+	e.
+		Str("profile", a.profile).
+		Str("outcome", a.outcome).
+		Str("remote_addr", a.remoteAddr).
+		Str("user_agent", a.userAgent).
+		Dur("duration", a.duration)
+}
+
+func debugDumpHTTPHandler(opts DebugDumpOpts) func(logger *zerolog.Logger, clock clock.Clock, instanceID InstanceID) HTTPHandler {
+	opts = opts.withDefaults()
+	return func(logger *zerolog.Logger, clock clock.Clock, instanceID InstanceID) HTTPHandler {
+		logAudit := eventlog.NewLogger(DebugDumpEvent, logger, zerolog.InfoLevel)
+		logAuditWarning := eventlog.NewLogger(DebugDumpEvent, logger, zerolog.WarnLevel)
+		limiter := &debugDumpLimiter{clock: clock, minInterval: opts.MinInterval}
+
+		return NewHTTPRoute(http.MethodGet, fmt.Sprintf("/%s", DebugDumpEndpoint), func(writer http.ResponseWriter, request *http.Request) {
+			query := request.URL.Query()
+			audit := debugDumpAudit{
+				profile:    query.Get("profile"),
+				remoteAddr: request.RemoteAddr,
+				userAgent:  request.UserAgent(),
+			}
+			if audit.profile == "" {
+				audit.profile = GoroutineDump
+			}
+
+			if opts.Token != "" {
+				token := strings.TrimPrefix(request.Header.Get("Authorization"), "Bearer ")
+				if subtle.ConstantTimeCompare([]byte(token), []byte(opts.Token)) != 1 {
+					audit.outcome = "unauthorized"
+					logAuditWarning(audit, "debug dump request is unauthorized")
+					writer.Header().Set("WWW-Authenticate", "Bearer")
+					http.Error(writer, http.StatusText(http.StatusUnauthorized), http.StatusUnauthorized)
+					return
+				}
+			}
+
+			profile := pprof.Lookup(audit.profile)
+			if profile == nil || (audit.profile != GoroutineDump && audit.profile != HeapDump && audit.profile != AllocsDump) {
+				audit.outcome = "bad_request"
+				logAuditWarning(audit, "debug dump profile is not supported")
+				http.Error(writer, fmt.Sprintf("supported profiles are: %s, %s, %s", GoroutineDump, HeapDump, AllocsDump), http.StatusBadRequest)
+				return
+			}
+
+			ok, wait := limiter.acquire()
+			if !ok {
+				audit.outcome = "rate_limited"
+				logAuditWarning(audit, "debug dump request is rate limited")
+				writer.Header().Set("Retry-After", strconv.Itoa(int(math.Ceil(wait.Seconds()))))
+				http.Error(writer, http.StatusText(http.StatusTooManyRequests), http.StatusTooManyRequests)
+				return
+			}
+			defer limiter.release()
+
+			start := clock.Now()
+			debug := 0
+			switch {
+			case audit.profile == GoroutineDump:
+				debug = 2
+			case query.Get("debug") == "1":
+				debug = 1
+			}
+			if audit.profile == HeapDump && query.Get("gc") == "1" {
+				runtime.GC()
+			}
+			if debug > 0 {
+				writer.Header().Set("Content-Type", TextMediaType+"; charset=utf-8")
+			} else {
+				writer.Header().Set("Content-Type", "application/octet-stream")
+				writer.Header().Set("Content-Disposition", fmt.Sprintf(`attachment; filename="%s-%s-%d.pb.gz"`, audit.profile, ulid.ULID(instanceID), start.Unix()))
+			}
+			err := profile.WriteTo(writer, debug)
+			audit.duration = clock.Since(start)
+			if err != nil {
+				audit.outcome = "error"
+				logAuditWarning(audit, fmt.Sprintf("debug dump failed: %v", err))
+				return
+			}
+			audit.outcome = "ok"
+			logAudit(audit, "debug dump")
+		}).WithDoc(OpenAPIOperation{
+			Summary: "goroutine, heap, and allocs dumps",
+			Tags:    []string{BuiltinOpenAPITag},
+			Params: []OpenAPIParam{
+				{Name: "profile", Description: "goroutine (default), heap, or allocs"},
+				{Name: "debug", Description: "if 1, then the heap and allocs profiles are returned as text"},
+				{Name: "gc", Description: "if 1, then a garbage collection is run before the heap profile is taken"},
+				{Name: "Authorization", In: "header", Description: "Bearer token - required if the endpoint is token protected"},
+			},
+			Responses: []OpenAPIResponse{
+				{Status: http.StatusOK, MediaTypes: []string{TextMediaType, "application/octet-stream"}},
+				{Status: http.StatusBadRequest, Description: "profile is not supported"},
+				{Status: http.StatusUnauthorized},
+				{Status: http.StatusTooManyRequests, Description: "rate limited - see the Retry-After header"},
+			},
+		}).AdminOnly()
+	}
+}
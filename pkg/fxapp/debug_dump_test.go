@@ -0,0 +1,137 @@
+/*
+ * Copyright (c) 2019 OysterPack, Inc.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ * http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package fxapp_test
+
+import (
+	"github.com/oysterpack/andiamo/pkg/clock"
+	"github.com/oysterpack/andiamo/pkg/fxapp"
+	"github.com/oysterpack/andiamo/pkg/fxapptest"
+	"github.com/oysterpack/andiamo/pkg/ulids"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"io/ioutil"
+	"net/http"
+	"testing"
+	"time"
+)
+
+func TestBuilder_EnableDebugDumps(t *testing.T) {
+	t.Parallel()
+
+	const Token = "secret"
+	fakeClock := clock.NewFake(time.Now())
+	logs := fxapptest.NewLogCapture()
+	builder := fxapp.NewBuilder(fxapp.ID(ulids.MustNew()), fxapp.ReleaseID(ulids.MustNew())).
+		Invoke(func() {}).
+		SetClock(fakeClock).
+		EnableDebugDumps(fxapp.DebugDumpOpts{Token: Token, MinInterval: time.Minute}).
+		LogWriter(logs)
+
+	fxapptest.RunApp(t, builder, func(app fxapp.App, client *fxapptest.HTTPClient) {
+		dump := func(query, token string) (*http.Response, []byte) {
+			request, err := http.NewRequest(http.MethodGet, client.URL(fxapp.DebugDumpEndpoint+query), nil)
+			require.NoError(t, err)
+			if token != "" {
+				request.Header.Set("Authorization", "Bearer "+token)
+			}
+			response, err := client.Do(request)
+			require.NoError(t, err)
+			defer response.Body.Close()
+			body, err := ioutil.ReadAll(response.Body)
+			require.NoError(t, err)
+			return response, body
+		}
+
+		t.Run("unauthorized", func(t *testing.T) {
+			for _, token := range []string{"", "invalid"} {
+				response, _ := dump("", token)
+				assert.Equal(t, http.StatusUnauthorized, response.StatusCode)
+			}
+			fxapptest.AssertEventLogged(t, logs, fxapp.DebugDumpEvent, fxapptest.Field("d.outcome", "unauthorized"))
+		})
+
+		t.Run("unsupported profile", func(t *testing.T) {
+			response, _ := dump("?profile=block", Token)
+			assert.Equal(t, http.StatusBadRequest, response.StatusCode)
+			fxapptest.AssertEventLogged(t, logs, fxapp.DebugDumpEvent,
+				fxapptest.Field("d.outcome", "bad_request"),
+				fxapptest.Field("d.profile", "block"),
+			)
+		})
+
+		t.Run("goroutine dump", func(t *testing.T) {
+			response, body := dump("", Token)
+			require.Equal(t, http.StatusOK, response.StatusCode)
+			assert.Contains(t, string(body), "goroutine")
+			fxapptest.AssertEventLogged(t, logs, fxapp.DebugDumpEvent,
+				fxapptest.Field("d.outcome", "ok"),
+				fxapptest.Field("d.profile", fxapp.GoroutineDump),
+			)
+		})
+
+		t.Run("rate limited", func(t *testing.T) {
+			response, _ := dump("?profile=heap", Token)
+			assert.Equal(t, http.StatusTooManyRequests, response.StatusCode)
+			assert.Equal(t, "60", response.Header.Get("Retry-After"))
+			fxapptest.AssertEventLogged(t, logs, fxapp.DebugDumpEvent, fxapptest.Field("d.outcome", "rate_limited"))
+		})
+
+		t.Run("heap dump", func(t *testing.T) {
+			fakeClock.Advance(time.Minute)
+			response, body := dump("?profile=heap&gc=1", Token)
+			require.Equal(t, http.StatusOK, response.StatusCode)
+			assert.Equal(t, "application/octet-stream", response.Header.Get("Content-Type"))
+			assert.Contains(t, response.Header.Get("Content-Disposition"), "attachment")
+			// the pprof format is gzip compressed
+			require.True(t, len(body) > 2)
+			assert.Equal(t, []byte{0x1f, 0x8b}, body[:2])
+		})
+
+		t.Run("allocs dump as text", func(t *testing.T) {
+			fakeClock.Advance(time.Minute)
+			response, body := dump("?profile=allocs&debug=1", Token)
+			require.Equal(t, http.StatusOK, response.StatusCode)
+			assert.Contains(t, string(body), "heap profile")
+		})
+	})
+}
+
+func TestDebugDumps_DisabledByDefault(t *testing.T) {
+	t.Parallel()
+
+	builder := fxapp.NewBuilder(fxapp.ID(ulids.MustNew()), fxapp.ReleaseID(ulids.MustNew())).
+		Invoke(func() {}).
+		LogWriter(ioutil.Discard)
+	fxapptest.RunApp(t, builder, func(app fxapp.App, client *fxapptest.HTTPClient) {
+		response, err := client.Get(fxapp.DebugDumpEndpoint)
+		require.NoError(t, err)
+		response.Body.Close()
+		assert.Equal(t, http.StatusNotFound, response.StatusCode)
+	})
+}
+
+func TestDebugDumpOpts_Validation(t *testing.T) {
+	t.Parallel()
+
+	_, err := fxapp.NewBuilder(fxapp.ID(ulids.MustNew()), fxapp.ReleaseID(ulids.MustNew())).
+		Invoke(func() {}).
+		EnableDebugDumps(fxapp.DebugDumpOpts{MinInterval: -time.Second}).
+		DisableHTTPServer().
+		Build()
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), fxapp.ErrInvalidDebugDumpOpts.Error())
+}
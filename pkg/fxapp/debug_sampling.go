@@ -0,0 +1,397 @@
+/*
+ * Copyright (c) 2019 OysterPack, Inc.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ * http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package fxapp
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"github.com/oysterpack/andiamo/pkg/clock"
+	"github.com/oysterpack/andiamo/pkg/eventlog"
+	"github.com/rs/zerolog"
+	"go.uber.org/fx"
+	"io"
+	"math"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// DebugSamplingEndpoint is used to construct the admin HTTP endpoint that temporarily enables debug level logging for a
+// specific component or event, i.e., it is safer than lowering the app log level during an incident. The endpoint is
+// disabled by default - see `Builder.EnableDebugSampling()`.
+//
+//   - POST starts a debug sampling session, which is specified via query params:
+//   - component - the component name, i.e., the "c" event field
+//   - event - the event ID, i.e., the "n" event field
+//   - duration - how long to sample debug events, e.g., "30s" - defaults to 1 min, and is capped by `MaxDuration`
+//   - limit - optional max number of debug events to sample
+//     Exactly 1 of component or event must be specified. The session automatically reverts when the duration elapses
+//     or the limit is reached.
+//   - GET returns the active session as JSON - HTTP 404 is returned if there is no active session
+//   - DELETE ends the active session
+//
+// Only 1 session can be active at a time, and sessions must be spaced apart by the configured min interval. Otherwise,
+// HTTP 429 is returned. Session changes are audited via the `DebugSamplingEvent`.
+const DebugSamplingEndpoint = "01DJ3T2W4085QRXVTSY59BEF5H"
+
+// DebugSamplingEvent is logged at warn level when a debug sampling session starts or ends, or when a session request is
+// rejected, i.e., it is used as an audit log.
+//
+//	type Data struct {
+//		// one of: start, stop, expired, limit_reached, rate_limited, bad_request
+//		Op         string `json:"op"`
+//		Component  string `json:"component"`
+//		Event      string `json:"event"`
+//		// msec
+//		Duration   uint   `json:"duration"`
+//		Limit      int    `json:"limit"`
+//		// the number of debug events that were sampled - set when the session ends
+//		Sampled    int    `json:"sampled"`
+//		RemoteAddr string `json:"remote_addr"`
+//		UserAgent  string `json:"user_agent"`
+//	}
+const DebugSamplingEvent = "01DJ3T2W89ZT3NCT34NDM8R6Y2"
+
+// debug sampling defaults
+const (
+	DefaultDebugSamplingDuration    = time.Minute
+	DefaultDebugSamplingMaxDuration = 10 * time.Minute
+	DefaultDebugSamplingMinInterval = 10 * time.Second
+)
+
+// ErrInvalidDebugSamplingOpts indicates the debug sampling options are invalid
+var ErrInvalidDebugSamplingOpts = errors.New("debug sampling `MaxDuration` and `MinInterval` must not be negative")
+
+// DebugSamplingOpts is used to configure the debug sampling endpoint - see `DebugSamplingEndpoint`
+type DebugSamplingOpts struct {
+	// MaxDuration caps the session duration. If zero, then DefaultDebugSamplingMaxDuration is used.
+	MaxDuration time.Duration
+	// MinInterval is the min amount of time between session starts. If zero, then DefaultDebugSamplingMinInterval is used.
+	MinInterval time.Duration
+}
+
+func (opts DebugSamplingOpts) validate() error {
+	if opts.MaxDuration < 0 || opts.MinInterval < 0 {
+		return fmt.Errorf("%s : %#v", ErrInvalidDebugSamplingOpts, opts)
+	}
+	return nil
+}
+
+func (opts DebugSamplingOpts) withDefaults() DebugSamplingOpts {
+	if opts.MaxDuration == 0 {
+		opts.MaxDuration = DefaultDebugSamplingMaxDuration
+	}
+	if opts.MinInterval == 0 {
+		opts.MinInterval = DefaultDebugSamplingMinInterval
+	}
+	return opts
+}
+
+// debugSamplingSession is a debug sampling session - the session is immutable, except for the sampled count
+type debugSamplingSession struct {
+	Component string    `json:"component,omitempty"`
+	Event     string    `json:"event,omitempty"`
+	Started   time.Time `json:"started"`
+	Expires   time.Time `json:"expires"`
+	Limit     int       `json:"limit,omitempty"`
+	Sampled   int       `json:"sampled"`
+
+	// the event field that is matched, e.g., `"c":"foo"`
+	match []byte
+	stop  chan struct{}
+}
+
+// debugSampler is a level filtering log writer, i.e., it only writes events at or above the app log level, plus the
+// debug events that match the active debug sampling session.
+type debugSampler struct {
+	io.Writer
+	opts DebugSamplingOpts
+	// the app log level
+	min zerolog.Level
+	// the global log level that is restored when the session ends, i.e., it is the debug level if the replay buffer is enabled
+	restoreLevel zerolog.Level
+
+	clock  clock.Clock
+	logger *zerolog.Logger
+
+	mutex     sync.Mutex
+	session   *debugSamplingSession
+	lastStart time.Time
+}
+
+func newDebugSampler(opts DebugSamplingOpts, clock clock.Clock) *debugSampler {
+	return &debugSampler{
+		opts:  opts.withDefaults(),
+		clock: clock,
+	}
+}
+
+// WriteLevel implements zerolog.LevelWriter
+func (s *debugSampler) WriteLevel(level zerolog.Level, p []byte) (int, error) {
+	if level >= s.min {
+		return s.Write(p)
+	}
+	if level != zerolog.DebugLevel {
+		return len(p), nil
+	}
+
+	s.mutex.Lock()
+	session := s.session
+	sampled := session != nil && bytes.Contains(p, session.match) && (session.Limit == 0 || session.Sampled < session.Limit)
+	limitReached := false
+	if sampled {
+		session.Sampled++
+		limitReached = session.Limit > 0 && session.Sampled == session.Limit
+	}
+	s.mutex.Unlock()
+
+	if !sampled {
+		return len(p), nil
+	}
+	n, err := s.Write(p)
+	if limitReached {
+		// the session is ended async because ending the session logs an event, i.e., the writer must not be reentered
+		go s.end(session, "limit_reached")
+	}
+	return n, err
+}
+
+type debugSamplingAudit struct {
+	op         string
+	session    debugSamplingSession
+	duration   time.Duration
+	remoteAddr string
+	userAgent  string
+}
+
+func (a debugSamplingAudit) MarshalZerologObject(e *zerolog.Event) {
+	e.
+		Str("op", a.op).
+		Str("component", a.session.Component).
+		Str("event", a.session.Event).
+		Dur("duration", a.duration).
+		Int("limit", a.session.Limit).
+		Int("sampled", a.session.Sampled).
+		Str("remote_addr", a.remoteAddr).
+		Str("user_agent", a.userAgent)
+}
+
+func (s *debugSampler) audit(audit debugSamplingAudit, msg string) {
+	eventlog.NewLogger(DebugSamplingEvent, s.logger, zerolog.WarnLevel)(audit, msg)
+}
+
+// start starts a new session. If the session is rate limited, then how long to wait before retrying is returned.
+func (s *debugSampler) start(session *debugSamplingSession, duration time.Duration) (bool, time.Duration) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	if s.session != nil {
+		return false, s.clock.Until(s.session.Expires)
+	}
+	if !s.lastStart.IsZero() {
+		if wait := s.opts.MinInterval - s.clock.Since(s.lastStart); wait > 0 {
+			return false, wait
+		}
+	}
+	s.lastStart = s.clock.Now()
+	session.Started = s.lastStart
+	session.Expires = s.lastStart.Add(duration)
+	session.stop = make(chan struct{})
+	if session.Component != "" {
+		session.match = []byte(fmt.Sprintf(`"%s":%q`, eventlog.Component, session.Component))
+	} else {
+		session.match = []byte(fmt.Sprintf(`"%s":%q`, eventlog.Name, session.Event))
+	}
+	s.session = session
+	// debug events must be constructed in order to be sampled
+	zerolog.SetGlobalLevel(zerolog.DebugLevel)
+
+	timer := s.clock.NewTimer(duration)
+	go func() {
+		select {
+		case <-timer.C():
+			s.end(session, "expired")
+		case <-session.stop:
+			timer.Stop()
+		}
+	}()
+	return true, 0
+}
+
+// end ends the session, if it is still active, and restores the log level
+func (s *debugSampler) end(session *debugSamplingSession, op string) (debugSamplingSession, bool) {
+	s.mutex.Lock()
+	if s.session != session {
+		s.mutex.Unlock()
+		return debugSamplingSession{}, false
+	}
+	s.session = nil
+	close(session.stop)
+	zerolog.SetGlobalLevel(s.restoreLevel)
+	ended := *session
+	s.mutex.Unlock()
+
+	s.audit(debugSamplingAudit{op: op, session: ended, duration: s.clock.Since(ended.Started)}, "debug sampling session ended")
+	return ended, true
+}
+
+func (s *debugSampler) activeSession() (debugSamplingSession, bool) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	if s.session == nil {
+		return debugSamplingSession{}, false
+	}
+	return *s.session, true
+}
+
+// stop ends the active session, if there is one
+func (s *debugSampler) stop() (debugSamplingSession, bool) {
+	s.mutex.Lock()
+	session := s.session
+	s.mutex.Unlock()
+	if session == nil {
+		return debugSamplingSession{}, false
+	}
+	return s.end(session, "stop")
+}
+
+func debugSamplingHTTPHandlers(sampler *debugSampler) func() HTTPHandlers {
+	return func() HTTPHandlers {
+		path := fmt.Sprintf("/%s", DebugSamplingEndpoint)
+		writeSession := func(writer http.ResponseWriter, session debugSamplingSession) {
+			writer.Header().Set("Content-Type", JSONMediaType)
+			json.NewEncoder(writer).Encode(session)
+		}
+		jsonResponse := OpenAPIResponse{Status: http.StatusOK, MediaTypes: []string{JSONMediaType}}
+
+		handlers := []HTTPHandler{
+			NewHTTPRoute(http.MethodGet, path, func(writer http.ResponseWriter, request *http.Request) {
+				session, ok := sampler.activeSession()
+				if !ok {
+					http.Error(writer, "there is no active debug sampling session", http.StatusNotFound)
+					return
+				}
+				writeSession(writer, session)
+			}).WithDoc(OpenAPIOperation{
+				Summary:   "active debug sampling session",
+				Tags:      []string{BuiltinOpenAPITag},
+				Responses: []OpenAPIResponse{jsonResponse, {Status: http.StatusNotFound, Description: "there is no active session"}},
+			}),
+			NewHTTPRoute(http.MethodPost, path, func(writer http.ResponseWriter, request *http.Request) {
+				query := request.URL.Query()
+				audit := debugSamplingAudit{
+					session: debugSamplingSession{
+						Component: strings.TrimSpace(query.Get("component")),
+						Event:     strings.TrimSpace(query.Get("event")),
+					},
+					duration:   DefaultDebugSamplingDuration,
+					remoteAddr: request.RemoteAddr,
+					userAgent:  request.UserAgent(),
+				}
+				badRequest := func(msg string) {
+					audit.op = "bad_request"
+					sampler.audit(audit, msg)
+					http.Error(writer, msg, http.StatusBadRequest)
+				}
+				if (audit.session.Component == "") == (audit.session.Event == "") {
+					badRequest("exactly 1 of the component or event query params must be specified")
+					return
+				}
+				if value := query.Get("duration"); value != "" {
+					duration, err := time.ParseDuration(value)
+					if err != nil || duration <= 0 {
+						badRequest(fmt.Sprintf("invalid duration : %q", value))
+						return
+					}
+					audit.duration = duration
+				}
+				if audit.duration > sampler.opts.MaxDuration {
+					audit.duration = sampler.opts.MaxDuration
+				}
+				if value := query.Get("limit"); value != "" {
+					limit, err := strconv.Atoi(value)
+					if err != nil || limit <= 0 {
+						badRequest(fmt.Sprintf("invalid limit : %q", value))
+						return
+					}
+					audit.session.Limit = limit
+				}
+
+				session := audit.session
+				if ok, wait := sampler.start(&session, audit.duration); !ok {
+					audit.op = "rate_limited"
+					sampler.audit(audit, "debug sampling session request is rate limited")
+					writer.Header().Set("Retry-After", strconv.Itoa(int(math.Ceil(wait.Seconds()))))
+					http.Error(writer, http.StatusText(http.StatusTooManyRequests), http.StatusTooManyRequests)
+					return
+				}
+				audit.op = "start"
+				sampler.audit(audit, "debug sampling session started")
+				if active, ok := sampler.activeSession(); ok {
+					writeSession(writer, active)
+					return
+				}
+				// the session already ended, e.g., the limit was reached
+				writer.WriteHeader(http.StatusNoContent)
+			}).WithDoc(OpenAPIOperation{
+				Summary: "starts a debug sampling session",
+				Tags:    []string{BuiltinOpenAPITag},
+				Params: []OpenAPIParam{
+					{Name: "component", Description: "the component name"},
+					{Name: "event", Description: "the event ID"},
+					{Name: "duration", Description: "how long to sample debug events, e.g., 30s - defaults to 1m"},
+					{Name: "limit", Description: "the max number of debug events to sample"},
+				},
+				Responses: []OpenAPIResponse{
+					jsonResponse,
+					{Status: http.StatusBadRequest},
+					{Status: http.StatusTooManyRequests, Description: "rate limited - see the Retry-After header"},
+				},
+			}),
+			NewHTTPRoute(http.MethodDelete, path, func(writer http.ResponseWriter, request *http.Request) {
+				if session, ok := sampler.stop(); ok {
+					writeSession(writer, session)
+					return
+				}
+				writer.WriteHeader(http.StatusNoContent)
+			}).WithDoc(OpenAPIOperation{
+				Summary:   "ends the active debug sampling session",
+				Tags:      []string{BuiltinOpenAPITag},
+				Responses: []OpenAPIResponse{jsonResponse, {Status: http.StatusNoContent, Description: "there is no active session"}},
+			}),
+		}
+		endpoints := make([]HTTPEndpoint, len(handlers))
+		for i, handler := range handlers {
+			endpoints[i] = handler.AdminOnly().HTTPEndpoint
+		}
+		return HTTPHandlers{HTTPEndpoints: endpoints}
+	}
+}
+
+// endOnStop ends the active session when the app is stopped
+func (s *debugSampler) endOnStop(lc fx.Lifecycle) {
+	lc.Append(fx.Hook{
+		OnStop: func(context.Context) error {
+			s.stop()
+			return nil
+		},
+	})
+}
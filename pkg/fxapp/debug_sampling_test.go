@@ -0,0 +1,194 @@
+/*
+ * Copyright (c) 2019 OysterPack, Inc.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ * http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package fxapp_test
+
+import (
+	"encoding/json"
+	"github.com/oysterpack/andiamo/pkg/clock"
+	"github.com/oysterpack/andiamo/pkg/eventlog"
+	"github.com/oysterpack/andiamo/pkg/fxapp"
+	"github.com/oysterpack/andiamo/pkg/fxapptest"
+	"github.com/oysterpack/andiamo/pkg/ulids"
+	"github.com/rs/zerolog"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"io/ioutil"
+	"net/http"
+	"testing"
+	"time"
+)
+
+// the debug sampling test is not run in parallel because debug sampling changes the global log level
+func TestBuilder_EnableDebugSampling(t *testing.T) {
+	const (
+		Component      = "01DJ3T2WCJET6JESATA3KADAF6"
+		DebugEvent     = "01DJ39KHGVM5DSPT1HYRRGDM1M"
+		SampledEvent   = "01DJ39KHN4N176C38AGZWPDMTA"
+		UnsampledEvent = "01DJ39KHSD4AAGS2PRGA3BRVBM"
+	)
+
+	fakeClock := clock.NewFake(time.Now())
+	logs := fxapptest.NewLogCapture()
+	var logger *zerolog.Logger
+	builder := fxapp.NewBuilder(fxapp.ID(ulids.MustNew()), fxapp.ReleaseID(ulids.MustNew())).
+		Invoke(func(l *zerolog.Logger) {
+			logger = l
+		}).
+		SetClock(fakeClock).
+		EnableDebugSampling(fxapp.DebugSamplingOpts{MinInterval: time.Minute}).
+		LogWriter(logs)
+
+	fxapptest.RunApp(t, builder, func(app fxapp.App, client *fxapptest.HTTPClient) {
+		send := func(method, query string) (*http.Response, []byte) {
+			request, err := http.NewRequest(method, client.URL(fxapp.DebugSamplingEndpoint+query), nil)
+			require.NoError(t, err)
+			response, err := client.Do(request)
+			require.NoError(t, err)
+			defer response.Body.Close()
+			body, err := ioutil.ReadAll(response.Body)
+			require.NoError(t, err)
+			return response, body
+		}
+		componentLogger := logger.With().Str(eventlog.Component, Component).Logger()
+		logDebugEvents := func() {
+			componentLogger.Debug().Str(eventlog.Name, SampledEvent).Msg("sampled")
+			logger.Debug().Str(eventlog.Name, UnsampledEvent).Msg("not sampled")
+		}
+
+		t.Run("no active session", func(t *testing.T) {
+			response, _ := send(http.MethodGet, "")
+			assert.Equal(t, http.StatusNotFound, response.StatusCode)
+			response, _ = send(http.MethodDelete, "")
+			assert.Equal(t, http.StatusNoContent, response.StatusCode)
+
+			logDebugEvents()
+			assert.Empty(t, logs.FindEvents(SampledEvent))
+		})
+
+		t.Run("bad request", func(t *testing.T) {
+			for _, query := range []string{
+				"",
+				"?component=a&event=b",
+				"?component=a&duration=xyz",
+				"?component=a&duration=-1s",
+				"?component=a&limit=0",
+			} {
+				response, _ := send(http.MethodPost, query)
+				assert.Equal(t, http.StatusBadRequest, response.StatusCode, query)
+			}
+			fxapptest.AssertEventLogged(t, logs, fxapp.DebugSamplingEvent, fxapptest.Field("d.op", "bad_request"))
+		})
+
+		t.Run("component session", func(t *testing.T) {
+			response, body := send(http.MethodPost, "?component="+Component+"&duration=30s")
+			require.Equal(t, http.StatusOK, response.StatusCode)
+			var session map[string]interface{}
+			require.NoError(t, json.Unmarshal(body, &session))
+			assert.Equal(t, Component, session["component"])
+			fxapptest.AssertEventLogged(t, logs, fxapp.DebugSamplingEvent,
+				fxapptest.Field("d.op", "start"),
+				fxapptest.Field("d.component", Component),
+			)
+
+			logDebugEvents()
+			assert.Len(t, logs.FindEvents(SampledEvent), 1)
+			assert.Empty(t, logs.FindEvents(UnsampledEvent))
+
+			response, body = send(http.MethodGet, "")
+			require.Equal(t, http.StatusOK, response.StatusCode)
+			require.NoError(t, json.Unmarshal(body, &session))
+			assert.Equal(t, float64(1), session["sampled"])
+
+			t.Run("rate limited", func(t *testing.T) {
+				response, _ := send(http.MethodPost, "?event="+DebugEvent)
+				assert.Equal(t, http.StatusTooManyRequests, response.StatusCode)
+				assert.Equal(t, "30", response.Header.Get("Retry-After"))
+				fxapptest.AssertEventLogged(t, logs, fxapp.DebugSamplingEvent, fxapptest.Field("d.op", "rate_limited"))
+			})
+
+			fakeClock.Advance(30 * time.Second)
+			_, err := logs.WaitForEvent(fxapp.DebugSamplingEvent, 5*time.Second,
+				fxapptest.Field("d.op", "expired"),
+				fxapptest.Field("d.sampled", float64(1)),
+			)
+			require.NoError(t, err)
+			logDebugEvents()
+			assert.Len(t, logs.FindEvents(SampledEvent), 1)
+		})
+
+		t.Run("event session with limit", func(t *testing.T) {
+			response, _ := send(http.MethodPost, "?event="+DebugEvent)
+			require.Equal(t, http.StatusTooManyRequests, response.StatusCode)
+			assert.Equal(t, "30", response.Header.Get("Retry-After"))
+
+			fakeClock.Advance(30 * time.Second)
+			response, _ = send(http.MethodPost, "?event="+DebugEvent+"&limit=2")
+			require.Equal(t, http.StatusOK, response.StatusCode)
+			for i := 0; i < 5; i++ {
+				logger.Debug().Str(eventlog.Name, DebugEvent).Msg("sampled")
+			}
+			_, err := logs.WaitForEvent(fxapp.DebugSamplingEvent, 5*time.Second,
+				fxapptest.Field("d.op", "limit_reached"),
+				fxapptest.Field("d.sampled", float64(2)),
+			)
+			require.NoError(t, err)
+			assert.Len(t, logs.FindEvents(DebugEvent), 2)
+		})
+
+		t.Run("stop session", func(t *testing.T) {
+			fakeClock.Advance(time.Minute)
+			response, _ := send(http.MethodPost, "?component="+Component)
+			require.Equal(t, http.StatusOK, response.StatusCode)
+			response, body := send(http.MethodDelete, "")
+			require.Equal(t, http.StatusOK, response.StatusCode)
+			var session map[string]interface{}
+			require.NoError(t, json.Unmarshal(body, &session))
+			assert.Equal(t, Component, session["component"])
+			fxapptest.AssertEventLogged(t, logs, fxapp.DebugSamplingEvent, fxapptest.Field("d.op", "stop"))
+
+			response, _ = send(http.MethodGet, "")
+			assert.Equal(t, http.StatusNotFound, response.StatusCode)
+			assert.Equal(t, zerolog.InfoLevel, zerolog.GlobalLevel())
+		})
+	})
+}
+
+func TestDebugSampling_DisabledByDefault(t *testing.T) {
+	t.Parallel()
+
+	builder := fxapp.NewBuilder(fxapp.ID(ulids.MustNew()), fxapp.ReleaseID(ulids.MustNew())).
+		Invoke(func() {}).
+		LogWriter(ioutil.Discard)
+	fxapptest.RunApp(t, builder, func(app fxapp.App, client *fxapptest.HTTPClient) {
+		response, err := client.Get(fxapp.DebugSamplingEndpoint)
+		require.NoError(t, err)
+		response.Body.Close()
+		assert.Equal(t, http.StatusNotFound, response.StatusCode)
+	})
+}
+
+func TestDebugSamplingOpts_Validation(t *testing.T) {
+	t.Parallel()
+
+	_, err := fxapp.NewBuilder(fxapp.ID(ulids.MustNew()), fxapp.ReleaseID(ulids.MustNew())).
+		Invoke(func() {}).
+		EnableDebugSampling(fxapp.DebugSamplingOpts{MaxDuration: -time.Second}).
+		DisableHTTPServer().
+		Build()
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), fxapp.ErrInvalidDebugSamplingOpts.Error())
+}
@@ -0,0 +1,280 @@
+/*
+ * Copyright (c) 2019 OysterPack, Inc.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ * http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package fxapp
+
+import (
+	"fmt"
+	"go.uber.org/fx"
+	"reflect"
+	"regexp"
+	"runtime"
+	"strings"
+)
+
+// Dependencies models the app's dependency injection container. It is derived from the fx.DotGraph, which makes it possible
+// for tooling and tests to assert how the app is wired programmatically, e.g., "nothing depends on package X", instead of
+// string matching the DOT output.
+type Dependencies struct {
+	// Constructors are listed in the order that they were registered with the container
+	Constructors []*Constructor
+	// Invokes are the app functions listed in the order that they are invoked
+	Invokes []*Func
+}
+
+// Type represents a type key within the dependency injection container
+type Type struct {
+	// Type is the type name in the same format as reflect.Type.String(), e.g., "*zerolog.Logger"
+	Type string
+	// Name is set for named values
+	Name string
+	// Group is set for value groups
+	Group string
+}
+
+// Package returns the name of the package that the type belongs to.
+//
+// An empty string is returned for builtin types.
+func (t Type) Package() string {
+	typeName := strings.TrimLeft(t.Type, "*[]")
+	if i := strings.LastIndex(typeName, "]"); i >= 0 { // maps
+		typeName = strings.TrimLeft(typeName[i+1:], "*[]")
+	}
+	i := strings.Index(typeName, ".")
+	if i < 0 {
+		return ""
+	}
+	return typeName[:i]
+}
+
+func (t Type) String() string {
+	switch {
+	case t.Name != "":
+		return fmt.Sprintf("%s[name=%s]", t.Type, t.Name)
+	case t.Group != "":
+		return fmt.Sprintf("%s[group=%s]", t.Type, t.Group)
+	default:
+		return t.Type
+	}
+}
+
+// Param represents a function parameter that is injected by the dependency injection container
+type Param struct {
+	Type
+	Optional bool
+}
+
+// Constructor represents a provider constructor function that is registered with the dependency injection container
+type Constructor struct {
+	Name    string
+	Params  []Param
+	Results []Type
+}
+
+// Func represents an app function that is invoked when the app is initialized
+type Func struct {
+	Name   string
+	Params []Param
+}
+
+// Provided returns all types that are provided by the container
+func (d *Dependencies) Provided() []Type {
+	var types []Type
+	provided := make(map[Type]bool)
+	for _, c := range d.Constructors {
+		for _, t := range c.Results {
+			if !provided[t] {
+				provided[t] = true
+				types = append(types, t)
+			}
+		}
+	}
+	return types
+}
+
+// Providers returns the constructors that provide types that match the filter
+func (d *Dependencies) Providers(filter func(t Type) bool) []*Constructor {
+	var constructors []*Constructor
+	for _, c := range d.Constructors {
+		for _, t := range c.Results {
+			if filter(t) {
+				constructors = append(constructors, c)
+				break
+			}
+		}
+	}
+	return constructors
+}
+
+// Consumers returns the names of the constructors and invoked functions that depend on types that match the filter.
+func (d *Dependencies) Consumers(filter func(t Type) bool) []string {
+	var names []string
+	dependsOn := func(params []Param) bool {
+		for _, p := range params {
+			if filter(p.Type) {
+				return true
+			}
+		}
+		return false
+	}
+	for _, c := range d.Constructors {
+		if dependsOn(c.Params) {
+			names = append(names, c.Name)
+		}
+	}
+	for _, f := range d.Invokes {
+		if dependsOn(f.Params) {
+			names = append(names, f.Name)
+		}
+	}
+	return names
+}
+
+// TypesInPackage returns a filter that matches types that belong to the specified package
+func TypesInPackage(pkg string) func(t Type) bool {
+	return func(t Type) bool {
+		return t.Package() == pkg
+	}
+}
+
+var (
+	dotConstructorNode = regexp.MustCompile(`^constructor_(\d+) \[shape=plaintext label="(.*)"\];$`)
+	dotResultNode      = regexp.MustCompile(`^"(.+)" \[label=<.*>\];$`)
+	dotParamEdge       = regexp.MustCompile(`^constructor_(\d+) -> "(.+)" \[ltail=cluster_\d+( style=dashed)?\];$`)
+	dotNamedType       = regexp.MustCompile(`^(.+)\[name=(.+)\]$`)
+	dotGroupResult     = regexp.MustCompile(`^(.+)\[group=(.+)\]\d+$`)
+	dotGroupParam      = regexp.MustCompile(`^\[type=(.+) group=(.+)\]$`)
+)
+
+// NewDependencies parses the DOT graph to construct the dependency model.
+// The funcs are used to model the invoked functions.
+func NewDependencies(dotGraph fx.DotGraph, funcs ...interface{}) *Dependencies {
+	deps := &Dependencies{}
+	constructors := make(map[string]*Constructor)
+	var current *Constructor
+	for _, line := range strings.Split(string(dotGraph), "\n") {
+		line = strings.TrimSpace(line)
+		switch {
+		case line == "}":
+			current = nil
+		case dotConstructorNode.MatchString(line):
+			match := dotConstructorNode.FindStringSubmatch(line)
+			current = &Constructor{Name: match[2]}
+			constructors[match[1]] = current
+			deps.Constructors = append(deps.Constructors, current)
+		case current != nil && dotResultNode.MatchString(line):
+			match := dotResultNode.FindStringSubmatch(line)
+			current.Results = append(current.Results, parseDotType(match[1]))
+		case dotParamEdge.MatchString(line):
+			match := dotParamEdge.FindStringSubmatch(line)
+			if c, ok := constructors[match[1]]; ok {
+				c.Params = append(c.Params, Param{parseDotType(match[2]), match[3] != ""})
+			}
+		}
+	}
+
+	for _, f := range funcs {
+		deps.Invokes = append(deps.Invokes, newFunc(f))
+	}
+
+	return deps
+}
+
+func parseDotType(s string) Type {
+	if match := dotGroupParam.FindStringSubmatch(s); match != nil {
+		return Type{Type: match[1], Group: match[2]}
+	}
+	if match := dotGroupResult.FindStringSubmatch(s); match != nil {
+		return Type{Type: match[1], Group: match[2]}
+	}
+	if match := dotNamedType.FindStringSubmatch(s); match != nil {
+		return Type{Type: match[1], Name: match[2]}
+	}
+	return Type{Type: s}
+}
+
+var fxInType = reflect.TypeOf(fx.In{})
+
+func newFunc(f interface{}) *Func {
+	funcValue := reflect.ValueOf(f)
+	fn := &Func{Name: funcName(funcValue)}
+	funcType := funcValue.Type()
+	for i := 0; i < funcType.NumIn(); i++ {
+		fn.Params = append(fn.Params, params(funcType.In(i))...)
+	}
+	return fn
+}
+
+// returns the func name in the same format as the DOT graph, i.e., the package path is trimmed off
+func funcName(f reflect.Value) string {
+	fn := runtime.FuncForPC(f.Pointer())
+	if fn == nil {
+		return f.Type().String()
+	}
+	name := fn.Name()
+	if i := strings.LastIndex(name, "/"); i >= 0 {
+		name = name[i+1:]
+	}
+	if i := strings.Index(name, "."); i >= 0 {
+		name = name[i+1:]
+	}
+	return name
+}
+
+// expands parameter objects, i.e., structs that embed fx.In
+func params(t reflect.Type) []Param {
+	if !isParamObject(t) {
+		return []Param{{Type: Type{Type: t.String()}}}
+	}
+
+	var ps []Param
+	for i := 0; i < t.NumField(); i++ {
+		field := t.Field(i)
+		if field.Anonymous && field.Type == fxInType {
+			continue
+		}
+		if isParamObject(field.Type) {
+			ps = append(ps, params(field.Type)...)
+			continue
+		}
+		p := Param{
+			Type: Type{
+				Type:  field.Type.String(),
+				Name:  field.Tag.Get("name"),
+				Group: field.Tag.Get("group"),
+			},
+			Optional: field.Tag.Get("optional") == "true",
+		}
+		if p.Group != "" && field.Type.Kind() == reflect.Slice {
+			p.Type.Type = field.Type.Elem().String()
+		}
+		ps = append(ps, p)
+	}
+	return ps
+}
+
+func isParamObject(t reflect.Type) bool {
+	if t.Kind() != reflect.Struct {
+		return false
+	}
+	for i := 0; i < t.NumField(); i++ {
+		field := t.Field(i)
+		if field.Anonymous && field.Type == fxInType {
+			return true
+		}
+	}
+	return false
+}
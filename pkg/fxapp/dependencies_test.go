@@ -0,0 +1,102 @@
+/*
+ * Copyright (c) 2019 OysterPack, Inc.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ * http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package fxapp_test
+
+import (
+	"github.com/oysterpack/andiamo/pkg/fxapp"
+	"github.com/oysterpack/andiamo/pkg/ulids"
+	"github.com/rs/zerolog"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.uber.org/fx"
+	"testing"
+)
+
+type BazParams struct {
+	fx.In
+
+	Baz    Baz
+	Logins []Login `group:"Login"`
+	Bar    *Bar    `optional:"true"`
+}
+
+func TestApp_Dependencies(t *testing.T) {
+	t.Parallel()
+
+	app, err := fxapp.NewBuilder(fxapp.ID(ulids.MustNew()), fxapp.ReleaseID(ulids.MustNew())).
+		Provide(
+			ProvideBar,
+			func(bar Bar) Baz { return Baz(bar) },
+			ProvidePasswordLogin,
+			GroupPasswordLogin,
+		).
+		Invoke(
+			InvokePrintBaz,
+			func(params BazParams, logger *zerolog.Logger) {},
+		).
+		DisableHTTPServer().
+		Build()
+	require.NoError(t, err)
+
+	deps := app.Dependencies()
+	require.NotEmpty(t, deps.Constructors)
+
+	t.Run("provided types", func(t *testing.T) {
+		provided := deps.Provided()
+		assert.Contains(t, provided, fxapp.Type{Type: "fxapp_test.Bar"})
+		assert.Contains(t, provided, fxapp.Type{Type: "fxapp_test.Login", Name: "PasswordLogin"})
+		assert.Contains(t, provided, fxapp.Type{Type: "fxapp_test.Login", Group: "Login"})
+		assert.Contains(t, provided, fxapp.Type{Type: "*zerolog.Logger"})
+	})
+
+	t.Run("providers", func(t *testing.T) {
+		providers := deps.Providers(func(t fxapp.Type) bool { return t.Type == "fxapp_test.Bar" })
+		require.Len(t, providers, 1)
+		assert.Equal(t, "ProvideBar", providers[0].Name)
+	})
+
+	t.Run("constructor params", func(t *testing.T) {
+		providers := deps.Providers(func(t fxapp.Type) bool { return t.Type == "fxapp_test.Baz" })
+		require.Len(t, providers, 1)
+		assert.Equal(t, []fxapp.Param{{Type: fxapp.Type{Type: "fxapp_test.Bar"}}}, providers[0].Params)
+	})
+
+	t.Run("invokes are listed in order", func(t *testing.T) {
+		require.Len(t, deps.Invokes, 2)
+		assert.Equal(t, "InvokePrintBaz", deps.Invokes[0].Name)
+		assert.Contains(t, deps.Invokes[1].Params, fxapp.Param{Type: fxapp.Type{Type: "fxapp_test.Login", Group: "Login"}})
+		assert.Contains(t, deps.Invokes[1].Params, fxapp.Param{Type: fxapp.Type{Type: "*fxapp_test.Bar"}, Optional: true})
+	})
+
+	t.Run("consumers", func(t *testing.T) {
+		consumers := deps.Consumers(func(t fxapp.Type) bool { return t.Type == "fxapp_test.Baz" })
+		assert.Len(t, consumers, 2)
+		assert.Contains(t, consumers, "InvokePrintBaz")
+
+		assert.NotEmpty(t, deps.Consumers(fxapp.TypesInPackage("zerolog")))
+		assert.Empty(t, deps.Consumers(fxapp.TypesInPackage("sql")), "nothing should depend on package sql")
+	})
+}
+
+func TestType_Package(t *testing.T) {
+	t.Parallel()
+
+	assert.Equal(t, "zerolog", fxapp.Type{Type: "*zerolog.Logger"}.Package())
+	assert.Equal(t, "fxapp", fxapp.Type{Type: "[]fxapp.HTTPEndpoint"}.Package())
+	assert.Equal(t, "fxapp", fxapp.Type{Type: "map[string]*fxapp.ID"}.Package())
+	assert.Equal(t, "", fxapp.Type{Type: "string"}.Package())
+}
@@ -0,0 +1,61 @@
+/*
+ * Copyright (c) 2019 OysterPack, Inc.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ * http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package fxapp_test
+
+import (
+	"context"
+	"github.com/oysterpack/andiamo/pkg/fx/dns"
+	"github.com/oysterpack/andiamo/pkg/fx/health"
+	"github.com/oysterpack/andiamo/pkg/fxapp"
+	"github.com/oysterpack/andiamo/pkg/ulids"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"io/ioutil"
+	"testing"
+)
+
+func TestBuilder_EnableDNSCache(t *testing.T) {
+	t.Parallel()
+
+	var resolver dns.Resolver
+	var runCheckNow health.RunCheckNow
+	app, err := fxapp.NewBuilder(fxapp.ID(ulids.MustNew()), fxapp.ReleaseID(ulids.MustNew())).
+		Invoke(func() {}).
+		EnableDNSCache(dns.Opts{
+			LookupHost: func(ctx context.Context, host string) ([]string, error) {
+				return []string{"127.0.0.1"}, nil
+			},
+		}).
+		Populate(&resolver, &runCheckNow).
+		DisableHTTPServer().
+		LogWriter(ioutil.Discard).
+		Build()
+	require.NoError(t, err)
+	go app.Run()
+	<-app.Ready()
+	defer func() {
+		app.Shutdown()
+		<-app.Done()
+	}()
+
+	addrs, err := resolver.LookupHost(context.Background(), "app.test")
+	require.NoError(t, err)
+	assert.Equal(t, []string{"127.0.0.1"}, addrs)
+	result, err := runCheckNow(dns.HealthCheckID)
+	require.NoError(t, err)
+	assert.Equal(t, health.Green, result.Status)
+}
@@ -0,0 +1,227 @@
+/*
+ * Copyright (c) 2019 OysterPack, Inc.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ * http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package fxapp
+
+import (
+	"github.com/oysterpack/andiamo/pkg/appdesc"
+	"github.com/rs/zerolog"
+	"go.uber.org/fx"
+	"net/url"
+	"os"
+	"sort"
+	"strings"
+)
+
+// RedactedValue replaces secret values in the effective configuration that is logged with the `InitializedEvent`
+const RedactedValue = "REDACTED"
+
+// env var names that contain any of the following are treated as secrets
+var secretEnvVarNameParts = []string{"TOKEN", "SECRET", "PASSWORD", "PASSWD", "CREDENTIAL", "KEY", "AUTH"}
+
+// effectiveConfig is the resolved app configuration, which is logged with the `InitializedEvent`
+type effectiveConfig struct {
+	profiles   Profiles
+	conditions []conditionResult
+	modules    []string
+	logLevel   zerolog.Level
+	// nil if the HTTP server is disabled
+	httpServer *httpServerConfig
+	// the env vars within the app env prefix namespace, with secrets redacted
+	env map[string]string
+}
+
+type httpServerConfig struct {
+	// blank means the address was not configured via the builder or env
+	addr      string
+	limits    HTTPServerLimits
+	endpoints []string
+}
+
+// configuredHTTPEndpoints is used to populate the HTTP endpoints that are registered with the app HTTP server
+type configuredHTTPEndpoints struct {
+	fx.In
+
+	Endpoints      []HTTPEndpoint   `group:"HTTPHandler"`
+	EndpointGroups [][]HTTPEndpoint `group:"HTTPHandlers"`
+}
+
+func (c configuredHTTPEndpoints) paths() []string {
+	endpoints := append([]HTTPEndpoint(nil), c.Endpoints...)
+	for _, group := range c.EndpointGroups {
+		endpoints = append(endpoints, group...)
+	}
+	paths := make([]string, 0, len(endpoints))
+	registered := make(map[string]bool, len(endpoints))
+	for _, endpoint := range endpoints {
+		if !registered[endpoint.Path] {
+			paths = append(paths, endpoint.Path)
+			registered[endpoint.Path] = true
+		}
+	}
+	sort.Strings(paths)
+	return paths
+}
+
+// effectiveConfig returns the resolved configuration - it must be called after the builder is checked, i.e., after the
+// profiles, conditional options, and env vars are applied.
+func (b *builder) effectiveConfig(endpoints configuredHTTPEndpoints) effectiveConfig {
+	config := effectiveConfig{
+		profiles:   b.activeProfiles,
+		conditions: b.conditionResults,
+		modules:    b.enabledModules(),
+		logLevel:   b.globalLogLevel,
+		env:        loadEnvConfig(b.envPrefix),
+	}
+	if !b.disableHTTPServer {
+		addr := b.httpServerAddr
+		if addr == "" {
+			addr = strings.TrimSpace(os.Getenv(b.envPrefix.EnvVar(httpServerAddrEnvName)))
+		}
+		config.httpServer = &httpServerConfig{
+			addr:      addr,
+			limits:    b.httpServerLimits,
+			endpoints: endpoints.paths(),
+		}
+	}
+	return config
+}
+
+// returns the optional modules that are enabled
+func (b *builder) enabledModules() []string {
+	var modules []string
+	enabled := func(module string, isEnabled bool) {
+		if isEnabled {
+			modules = append(modules, module)
+		}
+	}
+	enabled("http_server", !b.disableHTTPServer)
+	enabled(AdminUIModule, !b.disableHTTPServer && !b.adminUIDisabled)
+	enabled("instance_metadata", b.instanceMetadata != (appdesc.InstanceMetadata{}))
+	enabled("resource_health_checks", b.resourceHealthCheckOpts != nil)
+	enabled("error_rate_health_checks", len(b.errorRateHealthChecks) > 0)
+	enabled("slos", len(b.slos) > 0)
+	enabled("required_dependencies", len(b.dependencies) > 0)
+	enabled("clock_skew_health_check", b.clockSkewHealthCheckOpts != nil)
+	enabled("debug_dumps", b.debugDumpOpts != nil)
+	enabled("debug_sampling", b.debugSamplingOpts != nil)
+	enabled("heartbeat", b.heartbeatOpts != nil)
+	enabled("shutdown_endpoint", b.shutdownEndpoint)
+	enabled("fatal_health_checks", len(b.fatalHealthChecks) > 0)
+	enabled("legacy_shims", b.legacyShims)
+	enabled("request_scopes", len(b.scoped) > 0)
+	enabled("cors", b.corsOpts != nil)
+	enabled("security_headers", b.securityHeadersOpts != nil)
+	enabled("deadline_propagation", b.deadlineOpts != nil)
+	enabled("load_shedding", b.loadSheddingOpts != nil)
+	enabled("request_context", b.requestContextOpts != nil)
+	enabled("tenancy", b.tenancyOpts != nil)
+	enabled("upgrades", b.upgradeOpts != nil)
+	enabled("profiling", b.profilingOpts != nil)
+	enabled("log_sink", b.logSinkOpts != nil)
+	enabled("replay_buffer", b.replayBufferOpts != nil)
+	enabled(PprofModule, b.profilingOpts != nil && b.profilingOpts.PprofEndpoints)
+	enabled("fault_injection", b.faultInjectionOpts != nil)
+	enabled("migrations", b.migrateOpts != nil)
+	enabled("distributed_locks", b.lockOpts != nil)
+	enabled("outbox_relay", b.outboxOpts != nil)
+	enabled("queue_consumers", b.consumerOpts != nil)
+	enabled("idempotency", b.idempotencyOpts != nil)
+	enabled("retries", b.retryOpts != nil)
+	enabled("kv_store", b.kvOpts != nil)
+	enabled("file_watcher", b.fileWatchOpts != nil)
+	enabled("dns_cache", b.dnsOpts != nil)
+	return modules
+}
+
+// loadEnvConfig returns the env vars within the env prefix namespace, with secrets redacted - see `redactEnvValue()`
+func loadEnvConfig(prefix EnvPrefix) map[string]string {
+	env := make(map[string]string)
+	for _, kv := range os.Environ() {
+		i := strings.Index(kv, "=")
+		if i < 0 || !strings.HasPrefix(kv[:i], prefix.EnvVar("")) {
+			continue
+		}
+		env[kv[:i]] = redactEnvValue(kv[:i], kv[i+1:])
+	}
+	return env
+}
+
+// redactEnvValue redacts the value if the env var name indicates the value is a secret, e.g., APP12X_ADMIN_BEARER_TOKEN.
+// URL passwords are redacted as well.
+func redactEnvValue(name, value string) string {
+	if value == "" {
+		return value
+	}
+	upperName := strings.ToUpper(name)
+	for _, part := range secretEnvVarNameParts {
+		if strings.Contains(upperName, part) {
+			return RedactedValue
+		}
+	}
+	if u, err := url.Parse(value); err == nil && u.User != nil {
+		if _, ok := u.User.Password(); ok {
+			u.User = url.UserPassword(u.User.Username(), RedactedValue)
+			return u.String()
+		}
+	}
+	return value
+}
+
+// MarshalZerologObject implements zerolog.LogObjectMarshaler interface
+func (c effectiveConfig) MarshalZerologObject(e *zerolog.Event) {
+	e.Strs("profiles", c.profiles)
+	conditions := zerolog.Dict()
+	for _, condition := range c.conditions {
+		conditions.Bool(condition.Name, condition.Enabled)
+	}
+	e.Dict("conditions", conditions)
+	e.Strs("modules", c.modules)
+	e.Str("log_level", c.logLevel.String())
+	if c.httpServer != nil {
+		e.Object("http_server", c.httpServer)
+	}
+	names := make([]string, 0, len(c.env))
+	for name := range c.env {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	env := zerolog.Dict()
+	for _, name := range names {
+		env.Str(name, c.env[name])
+	}
+	e.Dict("env", env)
+}
+
+// MarshalZerologObject implements zerolog.LogObjectMarshaler interface
+func (c *httpServerConfig) MarshalZerologObject(e *zerolog.Event) {
+	if c.addr != "" {
+		e.Str("addr", c.addr)
+	}
+	if c.limits.MaxRequestBodyBytes > 0 {
+		e.Int64("max_request_body_bytes", c.limits.MaxRequestBodyBytes)
+	}
+	if c.limits.ReadTimeout > 0 {
+		e.Dur("read_timeout", c.limits.ReadTimeout)
+	}
+	if c.limits.WriteTimeout > 0 {
+		e.Dur("write_timeout", c.limits.WriteTimeout)
+	}
+	if c.limits.IdleTimeout > 0 {
+		e.Dur("idle_timeout", c.limits.IdleTimeout)
+	}
+	e.Strs("endpoints", c.endpoints)
+}
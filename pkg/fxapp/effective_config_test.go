@@ -0,0 +1,90 @@
+/*
+ * Copyright (c) 2019 OysterPack, Inc.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ * http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package fxapp_test
+
+import (
+	"github.com/oysterpack/andiamo/pkg/fxapp"
+	"github.com/oysterpack/andiamo/pkg/fxapptest"
+	"github.com/oysterpack/andiamo/pkg/ulids"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"testing"
+	"time"
+)
+
+func TestInitializedEvent_EffectiveConfig(t *testing.T) {
+	t.Setenv(fxapp.EnvconfigPrefix+"_TEST_DB_PASSWORD", "secret")
+	t.Setenv(fxapp.EnvconfigPrefix+"_TEST_DB_URL", "postgres://app:secret@db:5432/app")
+	t.Setenv(fxapp.EnvconfigPrefix+"_TEST_REGION", "us-east-1")
+	t.Setenv(fxapp.ModuleEnabledEnvVar("foo"), "true")
+	t.Setenv(fxapp.ProfileEnvVar, "")
+
+	logs := fxapptest.NewLogCapture()
+	_, err := fxapp.NewBuilder(fxapp.ID(ulids.MustNew()), fxapp.ReleaseID(ulids.MustNew())).
+		Invoke(func() {}).
+		RegisterProfile("dev", func(b fxapp.Builder) fxapp.Builder {
+			return b.LogLevel(fxapp.DebugLogLevel)
+		}).
+		SetProfiles("dev").
+		EnableIf(fxapp.ModuleEnabled("foo", false), func(b fxapp.Builder) fxapp.Builder {
+			return b.EnableRequestContext(fxapp.RequestContextOpts{})
+		}).
+		SetHTTPServerAddr(":0").
+		SetHTTPServerLimits(fxapp.HTTPServerLimits{ReadTimeout: 5 * time.Second}).
+		LogWriter(logs).
+		Build()
+	require.NoError(t, err)
+
+	event, ok := fxapptest.AssertEventLogged(t, logs, fxapp.InitializedEvent,
+		fxapptest.Field("d.config.profiles", []string{"dev"}),
+		fxapptest.Field("d.config.conditions.APP12X_MODULE_FOO_ENABLED", true),
+		fxapptest.Field("d.config.log_level", "debug"),
+		fxapptest.Field("d.config.http_server.addr", ":0"),
+		fxapptest.FieldExists("d.config.http_server.read_timeout"),
+		fxapptest.Field("d.config.env.APP12X_TEST_DB_PASSWORD", fxapp.RedactedValue),
+		fxapptest.Field("d.config.env.APP12X_TEST_DB_URL", "postgres://app:"+fxapp.RedactedValue+"@db:5432/app"),
+		fxapptest.Field("d.config.env.APP12X_TEST_REGION", "us-east-1"),
+	)
+	require.True(t, ok)
+	modules, ok := event.Field("d.config.modules")
+	require.True(t, ok)
+	assert.Contains(t, modules, "http_server")
+	assert.Contains(t, modules, fxapp.AdminUIModule)
+	assert.Contains(t, modules, "request_context")
+	assert.NotContains(t, modules, "tenancy")
+	endpoints, ok := event.Field("d.config.http_server.endpoints")
+	require.True(t, ok)
+	assert.Contains(t, endpoints, "/"+fxapp.AdminUIEndpoint)
+	assert.NotContains(t, logs.String(), "app:secret@")
+}
+
+func TestInitializedEvent_EffectiveConfig_HTTPServerDisabled(t *testing.T) {
+	t.Parallel()
+
+	logs := fxapptest.NewLogCapture()
+	_, err := fxapp.NewBuilder(fxapp.ID(ulids.MustNew()), fxapp.ReleaseID(ulids.MustNew())).
+		Invoke(func() {}).
+		DisableHTTPServer().
+		LogWriter(logs).
+		Build()
+	require.NoError(t, err)
+
+	event, ok := fxapptest.AssertEventLogged(t, logs, fxapp.InitializedEvent, fxapptest.Field("d.config.log_level", "info"))
+	require.True(t, ok)
+	_, ok = event.Field("d.config.http_server")
+	assert.False(t, ok)
+}
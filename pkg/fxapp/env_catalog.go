@@ -0,0 +1,196 @@
+/*
+ * Copyright (c) 2019 OysterPack, Inc.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ * http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package fxapp
+
+import (
+	"bufio"
+	"bytes"
+	"errors"
+	"fmt"
+	"github.com/kelseyhightower/envconfig"
+	"github.com/oysterpack/andiamo/pkg/appdesc"
+	"github.com/oysterpack/andiamo/pkg/eventlog"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// EnvVar describes an env var that the app understands. The env var catalog is used to generate the deployment config,
+// e.g., Helm chart values, which can then be validated against what the binary actually expects - see `EnvCatalog()`.
+type EnvVar struct {
+	Name        string
+	Description string
+	// Type is optional, e.g., "Duration"
+	Type string
+	// Default is the value that is used if the env var is not set
+	Default  string
+	Required bool
+	// Secret env var values must not be stored in plain config, e.g., they should be mounted from a k8s Secret. Env
+	// vars whose names indicate a secret are always treated as secrets - see `RedactedValue`.
+	Secret bool
+}
+
+// env var registration validation errors
+var (
+	ErrEnvVarBlankName         = errors.New("env var `Name` must not be blank")
+	ErrEnvVarAlreadyRegistered = errors.New("env var is already registered")
+)
+
+func (v EnvVar) secret() bool {
+	return v.Secret || redactEnvValue(v.Name, "x") == RedactedValue
+}
+
+// StandardEnvVars returns the env vars that are understood by the framework, i.e., the app descriptor, instance
+// metadata, and the framework modules that are configured via env vars. The env vars are named using the default env
+// prefix, i.e., the builder's env catalog is named using the app env prefix - see `Builder.SetEnvPrefix()`.
+func StandardEnvVars() []EnvVar {
+	return standardEnvVars(EnvconfigPrefix)
+}
+
+func standardEnvVars(prefix EnvPrefix) []EnvVar {
+	vars := []EnvVar{
+		{Name: prefix.EnvVar("ID"), Description: "app ID", Type: "ULID", Required: true},
+		{Name: prefix.EnvVar("NAME"), Description: "app name", Type: "String", Required: true},
+		{Name: prefix.EnvVar("VERSION"), Description: "app version", Type: "semver", Required: true},
+		{Name: prefix.EnvVar("RELEASE_ID"), Description: "app release ID", Type: "ULID", Required: true},
+		{Name: appdesc.PodNameEnvVar, Description: "instance metadata - k8s pod name"},
+		{Name: appdesc.PodNamespaceEnvVar, Description: "instance metadata - k8s pod namespace"},
+		{Name: appdesc.NodeNameEnvVar, Description: "instance metadata - k8s node name"},
+		{Name: prefix.EnvVar(httpServerAddrEnvName), Description: "HTTP server address, unless set via the builder", Default: DefaultHTTPServerAddr},
+		{Name: prefix.EnvVar(adminBearerTokenEnvName), Description: "bearer token that protects the admin HTTP endpoints"},
+		{Name: prefix.EnvVar(adminAuthDisabledEnvName), Description: "allows unauthenticated access to the admin HTTP endpoints, if no admin authenticator is configured", Type: "True or False", Default: "false"},
+		{Name: prefix.EnvVar(profileEnvName), Description: "active profiles", Type: "Comma-separated list of String"},
+		{Name: prefix.EnvVar(warmUpSkipEnvName), Description: "skips the app warm-up phase", Type: "True or False", Default: "false"},
+		{Name: prefix.ModuleEnabledEnvVar(AdminUIModule), Description: "toggles the admin UI", Type: "True or False", Default: "true"},
+	}
+	vars = append(vars, envconfigVars(prefix.EnvVar(profilerEnvName), &ProfilingOpts{}, "profiling - see `LoadProfilingOptsFromEnv()`")...)
+	vars = append(vars, envconfigVars(prefix.EnvVar(logSinkEnvName), &eventlog.SinkOpts{}, "log sink - see `LoadLogSinkOptsFromEnv()`")...)
+	vars = append(vars, envconfigVars(prefix.EnvVar(faultInjectionEnvName), &FaultInjectionOpts{}, "fault injection - see `LoadFaultInjectionOptsFromEnv()`")...)
+	return vars
+}
+
+// envconfigVars derives the env vars from the envconfig spec, i.e., the catalog stays in sync with the spec
+func envconfigVars(prefix string, spec interface{}, description string) []EnvVar {
+	buf := new(bytes.Buffer)
+	const format = "{{range .}}{{usage_key .}}\t{{usage_type .}}\t{{usage_default .}}\t{{usage_required .}}\n{{end}}"
+	if err := envconfig.Usagef(prefix, spec, buf, format); err != nil {
+		// the specs are static, i.e., this is a programming error
+		panic(err)
+	}
+	var vars []EnvVar
+	scanner := bufio.NewScanner(buf)
+	for scanner.Scan() {
+		fields := strings.Split(scanner.Text(), "\t")
+		required, _ := strconv.ParseBool(fields[3])
+		vars = append(vars, EnvVar{Name: fields[0], Description: description, Type: fields[1], Default: fields[2], Required: required})
+	}
+	return vars
+}
+
+// EnvCatalog returns the standard env vars followed by the app env vars, which are registered via
+// `Builder.RegisterEnvVars()`. If an app env var has the same name as a standard env var, then it replaces the
+// standard env var.
+func EnvCatalog(appEnvVars ...EnvVar) []EnvVar {
+	return envCatalog(EnvconfigPrefix, appEnvVars)
+}
+
+func envCatalog(prefix EnvPrefix, appEnvVars []EnvVar) []EnvVar {
+	registered := make(map[string]bool, len(appEnvVars))
+	for _, v := range appEnvVars {
+		registered[v.Name] = true
+	}
+	var catalog []EnvVar
+	for _, v := range standardEnvVars(prefix) {
+		if !registered[v.Name] {
+			catalog = append(catalog, v)
+		}
+	}
+	return append(catalog, appEnvVars...)
+}
+
+// HelmValues renders the env var catalog as Helm values.yaml, i.e., the env vars are mapped to their default values.
+// Secret env vars are listed under "secretEnv" with blank values - they are expected to be mounted from a k8s Secret.
+// Each env var is preceded by a comment that describes it, e.g.,
+//
+//	env:
+//	  # HTTP server address, unless set via the builder
+//	  APP12X_HTTP_SERVER_ADDR: ":8008"
+//	secretEnv:
+//	  # bearer token that protects the admin HTTP endpoints
+//	  APP12X_ADMIN_BEARER_TOKEN: ""
+func HelmValues(desc appdesc.Desc, catalog []EnvVar) []byte {
+	var env, secretEnv []EnvVar
+	for _, v := range catalog {
+		if v.secret() {
+			secretEnv = append(secretEnv, v)
+		} else {
+			env = append(env, v)
+		}
+	}
+	buf := new(bytes.Buffer)
+	fmt.Fprintf(buf, "# env vars that are understood by %s %s (release %s)\n", desc.Name, desc.Version, desc.ReleaseID)
+	writeHelmEnvVars(buf, "env", env)
+	writeHelmEnvVars(buf, "secretEnv", secretEnv)
+	return buf.Bytes()
+}
+
+func writeHelmEnvVars(buf *bytes.Buffer, key string, vars []EnvVar) {
+	if len(vars) == 0 {
+		fmt.Fprintf(buf, "%s: {}\n", key)
+		return
+	}
+	vars = append([]EnvVar(nil), vars...)
+	sort.SliceStable(vars, func(i, j int) bool { return vars[i].Name < vars[j].Name })
+	fmt.Fprintf(buf, "%s:\n", key)
+	for _, v := range vars {
+		var notes []string
+		if v.Type != "" {
+			notes = append(notes, v.Type)
+		}
+		if v.Required {
+			notes = append(notes, "required")
+		}
+		comment := v.Description
+		if len(notes) > 0 {
+			comment = strings.TrimSpace(fmt.Sprintf("%s (%s)", comment, strings.Join(notes, ", ")))
+		}
+		if comment != "" {
+			fmt.Fprintf(buf, "  # %s\n", comment)
+		}
+		fmt.Fprintf(buf, "  %s: %s\n", v.Name, strconv.Quote(v.Default))
+	}
+}
+
+// RegisteredEnvVars returns the app env var catalog, i.e., the standard env vars and the env vars that are registered
+// via `Builder.RegisterEnvVars()`
+type RegisteredEnvVars func() []EnvVar
+
+// HelmValuesEndpoint is used to construct the Helm values HTTP endpoint, which returns the app env var catalog as Helm
+// values.yaml - see `HelmValues()`
+const HelmValuesEndpoint = "01DJNJM7WJ012W7C2JB2WVEDHA"
+
+func helmValuesHTTPHandler(desc appdesc.Desc, envVars RegisteredEnvVars) HTTPHandler {
+	return NewHTTPHandler(fmt.Sprintf("/%s", HelmValuesEndpoint), func(writer http.ResponseWriter, request *http.Request) {
+		writer.Header().Set("Content-Type", YAMLMediaType)
+		writer.Write(HelmValues(desc, envVars()))
+	}).WithDoc(OpenAPIOperation{
+		Summary:   "Helm values for the env vars that are understood by the app",
+		Tags:      []string{BuiltinOpenAPITag},
+		Responses: []OpenAPIResponse{{Status: http.StatusOK, MediaTypes: []string{YAMLMediaType}}},
+	}).AdminOnly()
+}
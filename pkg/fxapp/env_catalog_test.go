@@ -0,0 +1,134 @@
+/*
+ * Copyright (c) 2019 OysterPack, Inc.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ * http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package fxapp_test
+
+import (
+	"fmt"
+	"github.com/oysterpack/andiamo/pkg/appdesc"
+	"github.com/oysterpack/andiamo/pkg/fxapp"
+	"github.com/oysterpack/andiamo/pkg/ulids"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"io/ioutil"
+	"net/http"
+	"strings"
+	"testing"
+)
+
+func TestEnvCatalog(t *testing.T) {
+	t.Parallel()
+
+	catalog := fxapp.EnvCatalog(
+		fxapp.EnvVar{Name: "APP12X_FOO_URL", Description: "foo service URL", Required: true},
+		fxapp.EnvVar{Name: fxapp.HTTPServerAddrEnvVar, Description: "HTTP server address", Default: ":8080"},
+	)
+	vars := make(map[string]fxapp.EnvVar, len(catalog))
+	for _, v := range catalog {
+		_, exists := vars[v.Name]
+		assert.False(t, exists, "env var is listed more than once: %s", v.Name)
+		vars[v.Name] = v
+	}
+
+	t.Run("standard env vars", func(t *testing.T) {
+		assert.True(t, vars["APP12X_ID"].Required)
+		assert.Contains(t, vars, fxapp.AdminBearerTokenEnvVar)
+		assert.Contains(t, vars, fxapp.ModuleEnabledEnvVar(fxapp.AdminUIModule))
+	})
+
+	t.Run("envconfig env vars are derived from the specs", func(t *testing.T) {
+		for _, name := range []string{
+			fxapp.ProfilerEnvconfigPrefix + "_PUSH_URL",
+			fxapp.LogSinkEnvconfigPrefix + "_FLUSH_INTERVAL",
+			fxapp.FaultInjectionEnvconfigPrefix + "_ENABLED",
+		} {
+			assert.Contains(t, vars, name)
+		}
+		assert.Equal(t, "Duration", vars[fxapp.LogSinkEnvconfigPrefix+"_FLUSH_INTERVAL"].Type)
+	})
+
+	t.Run("app env vars replace standard env vars", func(t *testing.T) {
+		assert.Equal(t, ":8080", vars[fxapp.HTTPServerAddrEnvVar].Default)
+		assert.Equal(t, "APP12X_FOO_URL", catalog[len(catalog)-2].Name)
+	})
+
+	t.Run("helm values", func(t *testing.T) {
+		desc := appdesc.Desc{ID: ulids.MustNew(), Name: "foo", ReleaseID: ulids.MustNew()}
+		values := string(fxapp.HelmValues(desc, catalog))
+		t.Log(values)
+		i := strings.Index(values, "\nsecretEnv:\n")
+		require.True(t, i > 0)
+		env, secretEnv := values[:i], values[i:]
+		assert.Contains(t, env, "\n  # foo service URL (required)\n  APP12X_FOO_URL: \"\"\n")
+		assert.Contains(t, env, fmt.Sprintf("\n  %s: \":8080\"\n", fxapp.HTTPServerAddrEnvVar))
+		assert.NotContains(t, env, fxapp.AdminBearerTokenEnvVar)
+		assert.Contains(t, secretEnv, fmt.Sprintf("\n  %s: \"\"\n", fxapp.AdminBearerTokenEnvVar))
+		assert.Contains(t, secretEnv, fxapp.LogSinkEnvconfigPrefix+"_AUTH_TOKEN")
+	})
+}
+
+func TestBuilder_RegisterEnvVars(t *testing.T) {
+	t.Parallel()
+
+	t.Run("env var catalog", func(t *testing.T) {
+		var envVars fxapp.RegisteredEnvVars
+		builder := fxapp.NewBuilder(fxapp.ID(ulids.MustNew()), fxapp.ReleaseID(ulids.MustNew())).
+			RegisterEnvVars(fxapp.EnvVar{Name: "APP12X_FOO_URL"}).
+			Invoke(func() {}).
+			Populate(&envVars).
+			DisableHTTPServer()
+		assert.Equal(t, "APP12X_FOO_URL", builder.EnvCatalog()[len(builder.EnvCatalog())-1].Name)
+		_, err := builder.Build()
+		require.NoError(t, err)
+		assert.Equal(t, builder.EnvCatalog(), envVars())
+	})
+
+	t.Run("invalid env vars", func(t *testing.T) {
+		_, err := fxapp.NewBuilder(fxapp.ID(ulids.MustNew()), fxapp.ReleaseID(ulids.MustNew())).
+			RegisterEnvVars(fxapp.EnvVar{Name: " "}, fxapp.EnvVar{Name: "APP12X_FOO_URL"}, fxapp.EnvVar{Name: "APP12X_FOO_URL"}).
+			Invoke(func() {}).
+			DisableHTTPServer().
+			Build()
+		require.Error(t, err)
+		assert.Contains(t, err.Error(), fxapp.ErrEnvVarBlankName.Error())
+		assert.Contains(t, err.Error(), fxapp.ErrEnvVarAlreadyRegistered.Error())
+	})
+}
+
+func TestHelmValuesHTTPEndpoint(t *testing.T) {
+	app, err := fxapp.NewBuilder(fxapp.ID(ulids.MustNew()), fxapp.ReleaseID(ulids.MustNew())).
+		RegisterEnvVars(fxapp.EnvVar{Name: "APP12X_FOO_URL"}).
+		Invoke(func() {}).
+		AllowUnauthenticatedAdmin().
+		Build()
+	require.NoError(t, err)
+
+	go app.Run()
+	<-app.Ready()
+	defer func() {
+		app.Shutdown()
+		<-app.Done()
+	}()
+
+	checkHTTPGetResponse(t, fmt.Sprintf("http://:8008/%s", fxapp.HelmValuesEndpoint), func(response *http.Response) {
+		defer response.Body.Close()
+		require.Equal(t, http.StatusOK, response.StatusCode)
+		assert.Equal(t, fxapp.YAMLMediaType, response.Header.Get("Content-Type"))
+		body, err := ioutil.ReadAll(response.Body)
+		require.NoError(t, err)
+		assert.Contains(t, string(body), "  APP12X_FOO_URL: \"\"\n")
+	})
+}
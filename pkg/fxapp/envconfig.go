@@ -16,9 +16,75 @@
 
 package fxapp
 
+import (
+	"errors"
+	"fmt"
+	"regexp"
+	"strings"
+)
+
 // envconfig related constants
 const (
 	// EnvconfigPrefix is the standard env var name prefix.
 	// "APP12X" was chosen to represent 12-factor apps.
 	EnvconfigPrefix = "APP12X"
+
+	// HTTPServerAddrEnvVar is used to configure the app HTTP server address, e.g., ":0" to listen on a random free port,
+	// "unix:/var/run/app.sock" to listen on a Unix domain socket, or "systemd" to listen on the inherited systemd socket.
+	// The address that is set via the builder takes precedence.
+	HTTPServerAddrEnvVar = EnvconfigPrefix + "_" + httpServerAddrEnvName
+
+	// AdminBearerTokenEnvVar is used to protect the app's admin HTTP endpoints with a bearer token, if an admin
+	// authenticator is not configured - see `Authenticator`
+	AdminBearerTokenEnvVar = EnvconfigPrefix + "_" + adminBearerTokenEnvName
+
+	// AdminAuthDisabledEnvVar is used to explicitly allow unauthenticated access to the app's admin HTTP endpoints, if an
+	// admin authenticator is not configured, e.g., for local development - see `Authenticator`
+	AdminAuthDisabledEnvVar = EnvconfigPrefix + "_" + adminAuthDisabledEnvName
+)
+
+// env var names relative to the env prefix - see `EnvPrefix.EnvVar()`
+const (
+	httpServerAddrEnvName    = "HTTP_SERVER_ADDR"
+	adminBearerTokenEnvName  = "ADMIN_BEARER_TOKEN"
+	adminAuthDisabledEnvName = "ADMIN_AUTH_DISABLED"
+	profileEnvName           = "PROFILE"
+	warmUpSkipEnvName        = "WARM_UP_SKIP"
+	profilerEnvName          = "PROFILER"
+	logSinkEnvName           = "LOG_SINK"
+	faultInjectionEnvName    = "FAULT_INJECTION"
 )
+
+// ErrInvalidEnvPrefix indicates the env prefix is not a valid env var name, i.e., it must start with a letter and may
+// only contain letters, digits, and '_'
+var ErrInvalidEnvPrefix = errors.New("env prefix is invalid")
+
+var envPrefixRegexp = regexp.MustCompile(`^[A-Za-z][A-Za-z0-9_]*$`)
+
+// EnvPrefix is the env var name prefix that the app env vars are namespaced with, which enables multiple apps to be
+// configured independently within the same process or test environment. It is set via `Builder.SetEnvPrefix()` and
+// is provided via dependency injection, i.e., modules use it to name their env vars.
+//
+// A blank prefix maps to `EnvconfigPrefix`. The prefix is upper cased, e.g., "foo" maps to the "FOO_" env var namespace.
+type EnvPrefix string
+
+func (p EnvPrefix) String() string {
+	prefix := strings.ToUpper(strings.TrimSpace(string(p)))
+	if prefix == "" {
+		return EnvconfigPrefix
+	}
+	return prefix
+}
+
+// EnvVar returns the env var name, i.e., ${prefix}_${NAME}, e.g., EnvPrefix("FOO").EnvVar("http_server_addr") returns
+// FOO_HTTP_SERVER_ADDR
+func (p EnvPrefix) EnvVar(name string) string {
+	return p.String() + "_" + strings.ToUpper(strings.TrimSpace(name))
+}
+
+func (p EnvPrefix) validate() error {
+	if prefix := strings.TrimSpace(string(p)); prefix != "" && !envPrefixRegexp.MatchString(prefix) {
+		return fmt.Errorf("%s : %q", ErrInvalidEnvPrefix, prefix)
+	}
+	return nil
+}
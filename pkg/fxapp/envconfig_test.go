@@ -0,0 +1,92 @@
+/*
+ * Copyright (c) 2019 OysterPack, Inc.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ * http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package fxapp_test
+
+import (
+	"github.com/oysterpack/andiamo/pkg/fxapp"
+	"github.com/oysterpack/andiamo/pkg/ulids"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"io/ioutil"
+	"net"
+	"testing"
+)
+
+func TestEnvPrefix(t *testing.T) {
+	assert.Equal(t, fxapp.HTTPServerAddrEnvVar, fxapp.EnvPrefix("").EnvVar("HTTP_SERVER_ADDR"))
+	assert.Equal(t, "FOO_HTTP_SERVER_ADDR", fxapp.EnvPrefix(" foo ").EnvVar("http_server_addr"))
+	assert.Equal(t, "FOO_MODULE_ADMIN_UI_ENABLED", fxapp.EnvPrefix("FOO").ModuleEnabledEnvVar("admin-ui"))
+	assert.Equal(t, fxapp.ModuleEnabledEnvVar("outbox"), fxapp.EnvPrefix("").ModuleEnabledEnvVar("outbox"))
+}
+
+func TestBuilder_SetEnvPrefix(t *testing.T) {
+	t.Setenv(fxapp.ProfileEnvVar, "prod")
+	t.Setenv("FOO_PROFILE", "dev")
+	t.Setenv("FOO_HTTP_SERVER_ADDR", ":0")
+	t.Setenv("FOO_MODULE_BAR_ENABLED", "true")
+
+	var profiles fxapp.Profiles
+	var envPrefix fxapp.EnvPrefix
+	var addr fxapp.HTTPServerAddr
+	var envVars fxapp.RegisteredEnvVars
+	barEnabled := false
+	builder := fxapp.NewBuilder(fxapp.ID(ulids.MustNew()), fxapp.ReleaseID(ulids.MustNew())).
+		SetEnvPrefix("foo")
+	app, err := builder.
+		RegisterProfile("dev", func(b fxapp.Builder) fxapp.Builder { return b }).
+		RegisterProfile("prod", func(b fxapp.Builder) fxapp.Builder { return b }).
+		EnableIf(builder.EnvPrefix().ModuleEnabled("bar", false), func(b fxapp.Builder) fxapp.Builder {
+			barEnabled = true
+			return b
+		}).
+		Invoke(func() {}).
+		Populate(&profiles, &envPrefix, &addr, &envVars).
+		LogWriter(ioutil.Discard).
+		Build()
+	require.NoError(t, err)
+	assert.Equal(t, fxapp.EnvPrefix("FOO"), envPrefix)
+	assert.Equal(t, fxapp.Profiles{"dev"}, profiles)
+	assert.True(t, barEnabled)
+
+	go app.Run()
+	<-app.Ready()
+	defer func() {
+		app.Shutdown()
+		<-app.Done()
+	}()
+	assert.NotEqual(t, 8008, addr().(*net.TCPAddr).Port)
+
+	names := make(map[string]bool)
+	for _, v := range envVars() {
+		names[v.Name] = true
+	}
+	assert.True(t, names["FOO_ID"])
+	assert.True(t, names["FOO_LOG_SINK_URL"])
+	assert.False(t, names[fxapp.HTTPServerAddrEnvVar])
+}
+
+func TestBuilder_SetEnvPrefix_Invalid(t *testing.T) {
+	t.Parallel()
+
+	err := fxapp.NewBuilder(fxapp.ID(ulids.MustNew()), fxapp.ReleaseID(ulids.MustNew())).
+		SetEnvPrefix("foo-bar").
+		Invoke(func() {}).
+		DisableHTTPServer().
+		Validate()
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), fxapp.ErrInvalidEnvPrefix.Error())
+}
@@ -0,0 +1,288 @@
+/*
+ * Copyright (c) 2019 OysterPack, Inc.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ * http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package fxapp
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"github.com/oysterpack/andiamo/pkg/clock"
+	"github.com/oysterpack/andiamo/pkg/fx/health"
+	"github.com/oysterpack/andiamo/pkg/ulids"
+	"github.com/prometheus/client_golang/prometheus"
+	dto "github.com/prometheus/client_model/go"
+	"go.uber.org/fx"
+	"go.uber.org/multierr"
+	"strings"
+	"sync"
+	"time"
+)
+
+// ErrorRateHealthCheckTag is used to tag the error rate health checks
+const ErrorRateHealthCheckTag = "01DJ0ZEFM0FYHN737TJZNEN8H9"
+
+// error rate health check defaults
+const (
+	DefaultErrorRateWindow         = 5 * time.Minute
+	DefaultErrorRateSampleInterval = 15 * time.Second
+)
+
+// ErrInvalidErrorRateHealthCheck indicates the error rate health check is misconfigured
+var ErrInvalidErrorRateHealthCheck = errors.New("invalid error rate health check")
+
+var errMetricIsNotCounter = errors.New("metric is not a counter")
+
+// ErrorRateThresholds are used to map error rates, i.e., errors per second, to health check statuses, i.e., the error
+// rate is `Yellow` when it reaches the Yellow threshold and `Red` when it reaches the Red threshold.
+type ErrorRateThresholds struct {
+	Yellow, Red float64
+}
+
+func (t ErrorRateThresholds) status(rate float64) health.Status {
+	switch {
+	case rate >= t.Red:
+		return health.Red
+	case rate >= t.Yellow:
+		return health.Yellow
+	default:
+		return health.Green
+	}
+}
+
+// ErrorRateHealthCheck bridges error metrics with health checks. The error rate is computed from a prometheus counter
+// over a sliding window, and mapped to a health check status via the thresholds. For example, the HTTP server's limit
+// violations counter (see `HTTPLimitViolationsMetricID`) can be used to flip the app's readiness when clients are being
+// rejected at a high rate.
+//
+// The counter is sampled in the background on the `SampleInterval`, and the health check reports the error rate as of the
+// latest sample. Metrics are not gathered by the health check itself because the health check gauges are gathered too.
+// The error rate is computed using the newest sample that is at least `Window` old as the baseline. If there is no such
+// sample yet, then the oldest sample is used.
+type ErrorRateHealthCheck struct {
+	// Check is registered with the ErrorRateHealthCheckTag added to its tags
+	Check health.Check
+	// RunInterval is optional - if zero, then the health check default run interval is used
+	RunInterval time.Duration
+
+	// MetricID is the counter metric name
+	MetricID string
+	// Labels are optional, and are used to select the counter series to track. If multiple series match, then their
+	// values are summed. If no series match, then the error count is zero.
+	Labels map[string]string
+	// Window is the sliding window the error rate is computed over. If zero, then DefaultErrorRateWindow is used.
+	Window time.Duration
+	// SampleInterval is how often the counter is sampled. If zero, then DefaultErrorRateSampleInterval is used.
+	SampleInterval time.Duration
+	Thresholds     ErrorRateThresholds
+}
+
+func (c ErrorRateHealthCheck) withDefaults() ErrorRateHealthCheck {
+	if c.Window == 0 {
+		c.Window = DefaultErrorRateWindow
+	}
+	if c.SampleInterval == 0 {
+		c.SampleInterval = DefaultErrorRateSampleInterval
+	}
+	c.Check.Tags = append(append([]string(nil), c.Check.Tags...), ErrorRateHealthCheckTag)
+	if strings.TrimSpace(c.Check.Description) == "" {
+		c.Check.Description = fmt.Sprintf("error rate: %s", c.MetricID)
+	}
+	return c
+}
+
+func (c ErrorRateHealthCheck) validate() error {
+	var err error
+	if _, e := ulids.Parse(c.Check.ID); e != nil {
+		err = multierr.Append(err, fmt.Errorf("%s : health check ID must be a ULID : %q", ErrInvalidErrorRateHealthCheck, c.Check.ID))
+	}
+	if strings.TrimSpace(c.MetricID) == "" {
+		err = multierr.Append(err, fmt.Errorf("%s : MetricID is required : %s", ErrInvalidErrorRateHealthCheck, c.Check.ID))
+	}
+	if c.Window < 0 {
+		err = multierr.Append(err, fmt.Errorf("%s : Window must not be negative : %s", ErrInvalidErrorRateHealthCheck, c.Check.ID))
+	}
+	if c.SampleInterval < 0 {
+		err = multierr.Append(err, fmt.Errorf("%s : SampleInterval must not be negative : %s", ErrInvalidErrorRateHealthCheck, c.Check.ID))
+	}
+	if c.Thresholds.Yellow <= 0 || c.Thresholds.Yellow > c.Thresholds.Red {
+		err = multierr.Append(err, fmt.Errorf("%s : thresholds must satisfy: 0 < Yellow <= Red : %s : %#v", ErrInvalidErrorRateHealthCheck, c.Check.ID, c.Thresholds))
+	}
+	return err
+}
+
+// returns the sum of the counter series that match the labels
+func (c ErrorRateHealthCheck) count(mfs []*dto.MetricFamily) (float64, error) {
+	mf := FindMetricFamily(mfs, func(mf *dto.MetricFamily) bool {
+		return mf.GetName() == c.MetricID
+	})
+	if mf == nil {
+		return 0, nil
+	}
+	if mf.GetType() != dto.MetricType_COUNTER {
+		return 0, fmt.Errorf("%s : %s", errMetricIsNotCounter, c.MetricID)
+	}
+	var count float64
+	for _, m := range mf.GetMetric() {
+		if matchLabels(m, c.Labels) {
+			count += m.GetCounter().GetValue()
+		}
+	}
+	return count, nil
+}
+
+func matchLabels(m *dto.Metric, labels map[string]string) bool {
+	matched := 0
+	for _, label := range m.GetLabel() {
+		if value, ok := labels[label.GetName()]; ok {
+			if value != label.GetValue() {
+				return false
+			}
+			matched++
+		}
+	}
+	return matched == len(labels)
+}
+
+type errorRateSample struct {
+	time  time.Time
+	count float64
+}
+
+// errorRateWindow is used to compute the error rate over a sliding window
+type errorRateWindow struct {
+	mutex   sync.Mutex
+	window  time.Duration
+	samples []errorRateSample
+}
+
+// add records the sample and returns the error rate per second over the sliding window
+func (w *errorRateWindow) add(sample errorRateSample) float64 {
+	w.mutex.Lock()
+	defer w.mutex.Unlock()
+	// the counter was reset, i.e., the app counters are not expected to be reset, but we want to be defensive
+	if n := len(w.samples); n > 0 && sample.count < w.samples[n-1].count {
+		w.samples = w.samples[:0]
+	}
+	w.samples = append(w.samples, sample)
+	// keep the newest sample that is at least the window old as the baseline
+	cutoff := sample.time.Add(-w.window)
+	i := 0
+	for i < len(w.samples)-1 && !w.samples[i+1].time.After(cutoff) {
+		i++
+	}
+	w.samples = append(w.samples[:0], w.samples[i:]...)
+
+	baseline := w.samples[0]
+	elapsed := sample.time.Sub(baseline.time).Seconds()
+	if elapsed <= 0 {
+		return 0
+	}
+	return (sample.count - baseline.count) / elapsed
+}
+
+// errorRateTracker samples the error counter and retains the latest health check status
+type errorRateTracker struct {
+	check    ErrorRateHealthCheck
+	gatherer prometheus.Gatherer
+	clock    clock.Clock
+	window   *errorRateWindow
+
+	mutex  sync.Mutex
+	status health.Status
+	err    error
+}
+
+func newErrorRateTracker(check ErrorRateHealthCheck, gatherer prometheus.Gatherer, clock clock.Clock) *errorRateTracker {
+	return &errorRateTracker{
+		check:    check,
+		gatherer: gatherer,
+		clock:    clock,
+		window:   &errorRateWindow{window: check.Window},
+	}
+}
+
+func (t *errorRateTracker) sample() {
+	status, err := func() (health.Status, error) {
+		mfs, gatherErr := t.gatherer.Gather()
+		count, err := t.check.count(mfs)
+		if err != nil {
+			return health.Red, err
+		}
+		// metrics are gathered on a best effort basis, i.e., collector errors only matter if the counter is not found
+		if count == 0 && gatherErr != nil {
+			return health.Red, gatherErr
+		}
+		rate := t.window.add(errorRateSample{time: t.clock.Now(), count: count})
+		status := t.check.Thresholds.status(rate)
+		if status == health.Green {
+			return status, nil
+		}
+		return status, fmt.Errorf("%s error rate is %.3f/sec over %s", t.check.MetricID, rate, t.check.Window)
+	}()
+
+	t.mutex.Lock()
+	defer t.mutex.Unlock()
+	t.status, t.err = status, err
+}
+
+func (t *errorRateTracker) checker(ctx context.Context) (health.Status, error) {
+	t.mutex.Lock()
+	defer t.mutex.Unlock()
+	return t.status, t.err
+}
+
+func (t *errorRateTracker) run(stop <-chan struct{}) {
+	timer := t.clock.NewTimer(t.check.SampleInterval)
+	defer timer.Stop()
+	for {
+		t.sample()
+		select {
+		case <-stop:
+			return
+		case <-timer.C():
+			timer.Reset(t.check.SampleInterval)
+		}
+	}
+}
+
+// registers the error rate health checks, and samples the error counters in the background while the app is running
+func registerErrorRateHealthChecks(checks []ErrorRateHealthCheck) func(lc fx.Lifecycle, register health.Register, gatherer prometheus.Gatherer, clock clock.Clock) error {
+	return func(lc fx.Lifecycle, register health.Register, gatherer prometheus.Gatherer, clock clock.Clock) error {
+		var err error
+		stop := make(chan struct{})
+		trackers := make([]*errorRateTracker, 0, len(checks))
+		for _, check := range checks {
+			check = check.withDefaults()
+			tracker := newErrorRateTracker(check, gatherer, clock)
+			trackers = append(trackers, tracker)
+			err = multierr.Append(err, register(check.Check, health.CheckerOpts{RunInterval: check.RunInterval}, tracker.checker))
+		}
+		lc.Append(fx.Hook{
+			OnStart: func(context.Context) error {
+				for _, tracker := range trackers {
+					go tracker.run(stop)
+				}
+				return nil
+			},
+			OnStop: func(context.Context) error {
+				close(stop)
+				return nil
+			},
+		})
+		return err
+	}
+}
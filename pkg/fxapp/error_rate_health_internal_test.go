@@ -0,0 +1,115 @@
+/*
+ * Copyright (c) 2019 OysterPack, Inc.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ * http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package fxapp
+
+import (
+	"context"
+	"github.com/oysterpack/andiamo/pkg/clock"
+	"github.com/oysterpack/andiamo/pkg/fx/health"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"testing"
+	"time"
+)
+
+func TestErrorRateWindow(t *testing.T) {
+	t.Parallel()
+
+	start := time.Now()
+	window := &errorRateWindow{window: time.Minute}
+	sample := func(offset time.Duration, count float64) float64 {
+		return window.add(errorRateSample{time: start.Add(offset), count: count})
+	}
+
+	assert.Zero(t, sample(0, 0))
+	assert.Equal(t, 1.0, sample(10*time.Second, 10))
+	assert.Equal(t, 2.0, sample(30*time.Second, 60))
+	// the sample at 10 sec is the newest sample that is at least a minute old
+	assert.Equal(t, 1.0, sample(70*time.Second, 70))
+	assert.Len(t, window.samples, 3)
+	// counter reset
+	assert.Zero(t, sample(80*time.Second, 5))
+	assert.Len(t, window.samples, 1)
+}
+
+func TestErrorRateTracker(t *testing.T) {
+	t.Parallel()
+
+	const MetricID = "U01DJ0ZEFR9NV4TED12QMV6ZDY8"
+	registry := prometheus.NewRegistry()
+	counter := prometheus.NewCounterVec(prometheus.CounterOpts{Name: MetricID, Help: "errors"}, []string{"code"})
+	require.NoError(t, registry.Register(counter))
+
+	fakeClock := clock.NewFake(time.Now())
+	tracker := newErrorRateTracker(ErrorRateHealthCheck{
+		MetricID:   MetricID,
+		Labels:     map[string]string{"code": "500"},
+		Thresholds: ErrorRateThresholds{Yellow: 1, Red: 5},
+	}.withDefaults(), registry, fakeClock)
+	checkStatus := func(expected health.Status) {
+		status, err := tracker.checker(context.Background())
+		assert.Equal(t, expected, status)
+		assert.Equal(t, status != health.Green, err != nil)
+	}
+
+	// the counter series has not been created yet
+	tracker.sample()
+	checkStatus(health.Green)
+
+	// errors that do not match the labels are not counted
+	counter.WithLabelValues("400").Add(1000)
+	fakeClock.Advance(10 * time.Second)
+	tracker.sample()
+	checkStatus(health.Green)
+
+	// 20 errors over 20 sec
+	counter.WithLabelValues("500").Add(20)
+	fakeClock.Advance(10 * time.Second)
+	tracker.sample()
+	checkStatus(health.Yellow)
+
+	// 200 more errors -> 220 errors over 30 sec
+	counter.WithLabelValues("500").Add(200)
+	fakeClock.Advance(10 * time.Second)
+	tracker.sample()
+	checkStatus(health.Red)
+
+	// once the errors stop, they eventually slide out of the window
+	for i := 0; i < 60; i++ {
+		fakeClock.Advance(10 * time.Second)
+		tracker.sample()
+	}
+	checkStatus(health.Green)
+}
+
+func TestErrorRateTracker_NotCounter(t *testing.T) {
+	t.Parallel()
+
+	const MetricID = "U01DJ0ZEFWJRSRMRCR90959J5JR"
+	registry := prometheus.NewRegistry()
+	require.NoError(t, registry.Register(prometheus.NewGauge(prometheus.GaugeOpts{Name: MetricID, Help: "gauge"})))
+
+	tracker := newErrorRateTracker(ErrorRateHealthCheck{
+		MetricID:   MetricID,
+		Thresholds: ErrorRateThresholds{Yellow: 1, Red: 5},
+	}.withDefaults(), registry, clock.Real())
+	tracker.sample()
+	status, err := tracker.checker(context.Background())
+	assert.Equal(t, health.Red, status)
+	assert.Error(t, err)
+}
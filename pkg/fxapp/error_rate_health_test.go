@@ -0,0 +1,138 @@
+/*
+ * Copyright (c) 2019 OysterPack, Inc.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ * http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package fxapp_test
+
+import (
+	"github.com/oysterpack/andiamo/pkg/fx/health"
+	"github.com/oysterpack/andiamo/pkg/fxapp"
+	"github.com/oysterpack/andiamo/pkg/ulids"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"io/ioutil"
+	"testing"
+	"time"
+)
+
+func TestEnableErrorRateHealthChecks(t *testing.T) {
+	t.Parallel()
+
+	const ErrorsMetricID = "U01DJ0ZEFR9NV4TED12QMV6ZDY8"
+	checkID := ulids.MustNew().String()
+	errorCounter := prometheus.NewCounter(prometheus.CounterOpts{
+		Name: ErrorsMetricID,
+		Help: "errors",
+	})
+
+	var registeredChecks health.RegisteredChecks
+	var runCheckNow health.RunCheckNow
+	app, err := fxapp.NewBuilder(fxapp.ID(ulids.MustNew()), fxapp.ReleaseID(ulids.MustNew())).
+		EnableErrorRateHealthChecks(fxapp.ErrorRateHealthCheck{
+			Check: health.Check{
+				ID:        checkID,
+				RedImpact: "clients are failing",
+			},
+			MetricID:       ErrorsMetricID,
+			Window:         time.Second,
+			SampleInterval: 10 * time.Millisecond,
+			Thresholds:     fxapp.ErrorRateThresholds{Yellow: 10, Red: 100},
+		}).
+		Invoke(func(registerer prometheus.Registerer) error {
+			return registerer.Register(errorCounter)
+		}).
+		Populate(&registeredChecks, &runCheckNow).
+		LogWriter(ioutil.Discard).
+		DisableHTTPServer().
+		Build()
+	require.NoError(t, err)
+
+	go app.Run()
+	defer func() {
+		app.Shutdown()
+		<-app.Done()
+	}()
+	<-app.Ready()
+
+	registered := false
+	for _, check := range <-registeredChecks(health.Query{}) {
+		if check.ID == checkID {
+			registered = true
+			assert.Equal(t, []string{fxapp.ErrorRateHealthCheckTag}, check.Tags)
+			assert.Contains(t, check.Description, ErrorsMetricID)
+		}
+	}
+	require.True(t, registered)
+
+	status := func() health.Status {
+		result, err := runCheckNow(checkID)
+		require.NoError(t, err)
+		return result.Status
+	}
+	// generateErrors is used to simulate errors while waiting for the health check status to transition
+	waitForStatus := func(expected health.Status, generateErrors bool) {
+		for timeout := time.After(5 * time.Second); status() != expected; {
+			select {
+			case <-timeout:
+				t.Fatalf("health check status did not transition to: %v", expected)
+			case <-time.After(10 * time.Millisecond):
+				if generateErrors {
+					errorCounter.Add(10)
+				}
+			}
+		}
+	}
+	assert.Equal(t, health.Green, status())
+	waitForStatus(health.Red, true)
+	// once the errors stop, they slide out of the window
+	waitForStatus(health.Green, false)
+}
+
+func TestEnableErrorRateHealthChecks_Invalid(t *testing.T) {
+	t.Parallel()
+
+	checks := []fxapp.ErrorRateHealthCheck{
+		{
+			Check:      health.Check{ID: "invalid"},
+			MetricID:   "U01DJ0ZEFR9NV4TED12QMV6ZDY8",
+			Thresholds: fxapp.ErrorRateThresholds{Yellow: 1, Red: 5},
+		},
+		{
+			Check:      health.Check{ID: ulids.MustNew().String()},
+			Thresholds: fxapp.ErrorRateThresholds{Yellow: 1, Red: 5},
+		},
+		{
+			Check:      health.Check{ID: ulids.MustNew().String()},
+			MetricID:   "U01DJ0ZEFR9NV4TED12QMV6ZDY8",
+			Thresholds: fxapp.ErrorRateThresholds{Yellow: 5, Red: 1},
+		},
+		{
+			Check:      health.Check{ID: ulids.MustNew().String()},
+			MetricID:   "U01DJ0ZEFR9NV4TED12QMV6ZDY8",
+			Window:     -time.Second,
+			Thresholds: fxapp.ErrorRateThresholds{Yellow: 1, Red: 5},
+		},
+	}
+	for _, check := range checks {
+		_, err := fxapp.NewBuilder(fxapp.ID(ulids.MustNew()), fxapp.ReleaseID(ulids.MustNew())).
+			EnableErrorRateHealthChecks(check).
+			Invoke(func() {}).
+			DisableHTTPServer().
+			Build()
+		require.Error(t, err)
+		assert.Contains(t, err.Error(), fxapp.ErrInvalidErrorRateHealthCheck.Error())
+	}
+}
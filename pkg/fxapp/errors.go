@@ -0,0 +1,82 @@
+/*
+ * Copyright (c) 2019 OysterPack, Inc.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ * http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package fxapp
+
+import (
+	"errors"
+	"fmt"
+	"go.uber.org/multierr"
+	"strings"
+)
+
+// WrapErr wraps the error with context, using the package error message format, i.e., "<err> : <context>". The wrapped
+// error is preserved, i.e., it can be matched via `errors.Is()` and `errors.As()`.
+func WrapErr(err error, format string, args ...interface{}) error {
+	return &wrappedErr{err: err, context: fmt.Sprintf(format, args...)}
+}
+
+type wrappedErr struct {
+	err     error
+	context string
+}
+
+func (e *wrappedErr) Error() string {
+	return fmt.Sprintf("%s : %s", e.err, e.context)
+}
+
+// Unwrap returns the wrapped error
+func (e *wrappedErr) Unwrap() error {
+	return e.err
+}
+
+// Classify returns the xrefs that reference the error. Errors that are combined via multierr are classified
+// individually. An error matches an xref error if:
+//   - it matches via `errors.Is()`, or
+//   - its message equals the xref error message, or is prefixed by it using the package error message format, i.e.,
+//     "<err> : <context>" - errors that were formatted via `fmt.Errorf("%s : ...", err)` do not wrap the error
+func (x RegisteredXRefs) Classify(err error) []XRef {
+	if err == nil {
+		return nil
+	}
+	errs := multierr.Errors(err)
+	var refs []XRef
+	for _, xref := range x() {
+		if xref.refsErr(errs) {
+			refs = append(refs, xref)
+		}
+	}
+	return refs
+}
+
+func (x *XRef) refsErr(errs []error) bool {
+	for _, ref := range x.Errors {
+		for _, err := range errs {
+			if errMatches(err, ref) {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+func errMatches(err, ref error) bool {
+	if errors.Is(err, ref) {
+		return true
+	}
+	msg, refMsg := err.Error(), ref.Error()
+	return msg == refMsg || strings.HasPrefix(msg, refMsg+" : ")
+}
@@ -0,0 +1,82 @@
+/*
+ * Copyright (c) 2019 OysterPack, Inc.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ * http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package fxapp_test
+
+import (
+	"errors"
+	"fmt"
+	"github.com/oysterpack/andiamo/pkg/fx/health"
+	"github.com/oysterpack/andiamo/pkg/fxapp"
+	"github.com/oysterpack/andiamo/pkg/ulids"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.uber.org/multierr"
+	"testing"
+)
+
+func TestWrapErr(t *testing.T) {
+	t.Parallel()
+
+	err := fxapp.WrapErr(fxapp.ErrInvalidRestartPolicy, "fields must not be negative : %d", -2)
+	assert.Equal(t, fmt.Sprintf("%s : fields must not be negative : -2", fxapp.ErrInvalidRestartPolicy), err.Error())
+	assert.True(t, errors.Is(err, fxapp.ErrInvalidRestartPolicy))
+	assert.False(t, errors.Is(err, fxapp.ErrInvalidWorker))
+
+	// the wrapped error is preserved through multiple wraps
+	err = fxapp.WrapErr(fxapp.WrapErr(health.CheckNotRegisteredError{ID: "foo"}, "unregister"), "shutdown")
+	assert.True(t, errors.Is(err, health.ErrCheckNotRegistered))
+	var checkNotRegistered health.CheckNotRegisteredError
+	require.True(t, errors.As(err, &checkNotRegistered))
+	assert.Equal(t, "foo", checkNotRegistered.ID)
+}
+
+func TestRegisteredXRefs_Classify(t *testing.T) {
+	t.Parallel()
+
+	errFoo := errors.New("foo failed")
+	errBar := errors.New("bar failed")
+	fooXRef := fxapp.XRef{ID: ulids.MustNew().String(), Errors: []error{errFoo}}
+	barXRef := fxapp.XRef{ID: ulids.MustNew().String(), Errors: []error{errBar}}
+	var xrefs fxapp.RegisteredXRefs
+	_, err := fxapp.NewBuilder(fxapp.ID(ulids.MustNew()), fxapp.ReleaseID(ulids.MustNew())).
+		RegisterXRefs(fooXRef, barXRef).
+		Invoke(func() {}).
+		Populate(&xrefs).
+		DisableHTTPServer().
+		Build()
+	require.NoError(t, err)
+
+	xrefIDs := func(refs []fxapp.XRef) []string {
+		var ids []string
+		for _, ref := range refs {
+			ids = append(ids, ref.ID)
+		}
+		return ids
+	}
+
+	// errors are matched via errors.Is()
+	assert.Equal(t, []string{fooXRef.ID}, xrefIDs(xrefs.Classify(errFoo)))
+	assert.Equal(t, []string{fooXRef.ID}, xrefIDs(xrefs.Classify(fxapp.WrapErr(errFoo, "BOOM"))))
+	// errors that were formatted using the package error message format are matched by their message
+	assert.Equal(t, []string{barXRef.ID}, xrefIDs(xrefs.Classify(fmt.Errorf("%s : BOOM", errBar))))
+	// combined errors are classified individually
+	assert.Equal(t, []string{fooXRef.ID, barXRef.ID}, xrefIDs(xrefs.Classify(multierr.Combine(errBar, fxapp.WrapErr(errFoo, "BOOM")))))
+	// errors that only share a message prefix do not match
+	assert.Empty(t, xrefs.Classify(errors.New("foo failed badly")))
+	assert.Empty(t, xrefs.Classify(errors.New("BOOM")))
+	assert.Empty(t, xrefs.Classify(nil))
+}
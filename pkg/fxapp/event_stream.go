@@ -0,0 +1,212 @@
+/*
+ * Copyright (c) 2019 OysterPack, Inc.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ * http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package fxapp
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+)
+
+// EventStreamEndpoint is used to construct the HTTP endpoint that streams app log events via Server-Sent Events (SSE).
+// It is designed to feed lightweight live dashboards that are pointed at a single app instance, i.e., without requiring
+// log infrastructure.
+//
+// All log events are streamed, which includes the app lifecycle events (see `StartingEvent`, `StartedEvent`, `ReadyEvent`,
+// `StoppingEvent`) and health check results (see `HealthCheckResultEvent`). Events can be filtered by event name via
+// the "event" query param, which can be specified multiple times or as a comma separated list, e.g.,
+//
+//	GET /01DHXWJDR9CD8PW0NRWX62DRSF?event=01DE4X10QCV1M8TKRNXDK6AK7C,01DEJ5RA8XRZVECJDJFAA2PWJF
+//
+// Each log event is sent as an SSE message, where the SSE event type is the log event name and the data is the JSON log
+// event. Log events that have no name are sent using the default SSE event type, i.e., "message". Browser EventSource
+// clients can only receive typed events via listeners that are registered per event type. Thus, to receive all events
+// via the EventSource onmessage handler, specify the "typed=false" query param, which sends all log events using the
+// default SSE event type.
+//
+// Log events are buffered per stream. If a client is too slow to keep up, then log events are dropped for that client.
+// Streams are closed when the app is stopping, i.e., after the `StoppingEvent` is sent.
+const EventStreamEndpoint = "01DHXWJDR9CD8PW0NRWX62DRSF"
+
+// EventStreamMediaType is the Server-Sent Events media type
+const EventStreamMediaType = "text/event-stream"
+
+const (
+	// the number of log events that are buffered per stream
+	eventStreamBufferSize = 256
+	// a heartbeat comment is sent periodically to keep the connection alive through proxies
+	eventStreamHeartbeatInterval = 15 * time.Second
+)
+
+// eventStream is an io.Writer that fans out log events to the event stream subscribers. It is used as a log writer.
+type eventStream struct {
+	mutex       sync.RWMutex
+	subscribers map[*eventSubscriber]struct{}
+	closed      bool
+}
+
+type eventSubscriber struct {
+	// if empty, then all events are streamed
+	names map[string]bool
+	ch    chan eventStreamMessage
+}
+
+type eventStreamMessage struct {
+	name string
+	data []byte
+}
+
+func newEventStream() *eventStream {
+	return &eventStream{subscribers: make(map[*eventSubscriber]struct{})}
+}
+
+// Write fans out the log event to the subscribers. Subscribers are never blocked, i.e., if a subscriber buffer is full,
+// then the log event is dropped for the subscriber.
+func (s *eventStream) Write(p []byte) (int, error) {
+	s.mutex.RLock()
+	defer s.mutex.RUnlock()
+	if len(s.subscribers) == 0 {
+		return len(p), nil
+	}
+
+	var event struct {
+		Name string `json:"n"`
+	}
+	// the log event name is only used for filtering, i.e., invalid JSON is streamed using the default SSE event type
+	_ = json.Unmarshal(p, &event)
+	msg := eventStreamMessage{
+		name: event.Name,
+		// the log writer buffer is reused by the logger, thus the data must be copied
+		data: append([]byte(nil), bytes.TrimSpace(p)...),
+	}
+	for subscriber := range s.subscribers {
+		if len(subscriber.names) > 0 && !subscriber.names[msg.name] {
+			continue
+		}
+		select {
+		case subscriber.ch <- msg:
+		default: // the subscriber is too slow
+		}
+	}
+	return len(p), nil
+}
+
+// subscribe returns nil if the stream is closed
+func (s *eventStream) subscribe(names []string) *eventSubscriber {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	if s.closed {
+		return nil
+	}
+	subscriber := &eventSubscriber{
+		names: make(map[string]bool, len(names)),
+		ch:    make(chan eventStreamMessage, eventStreamBufferSize),
+	}
+	for _, name := range names {
+		subscriber.names[name] = true
+	}
+	s.subscribers[subscriber] = struct{}{}
+	return subscriber
+}
+
+func (s *eventStream) unsubscribe(subscriber *eventSubscriber) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	if _, ok := s.subscribers[subscriber]; ok {
+		delete(s.subscribers, subscriber)
+		close(subscriber.ch)
+	}
+}
+
+// close closes all subscriber channels, which ends the streams after the buffered log events are sent.
+// New subscriptions are rejected after the stream is closed.
+func (s *eventStream) close() {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	s.closed = true
+	for subscriber := range s.subscribers {
+		delete(s.subscribers, subscriber)
+		close(subscriber.ch)
+	}
+}
+
+func eventStreamHTTPHandler(stream *eventStream) HTTPHandler {
+	return NewHTTPRoute(http.MethodGet, fmt.Sprintf("/%s", EventStreamEndpoint), func(writer http.ResponseWriter, request *http.Request) {
+		flusher, ok := writer.(http.Flusher)
+		if !ok {
+			http.Error(writer, "streaming is not supported", http.StatusInternalServerError)
+			return
+		}
+
+		var names []string
+		for _, param := range request.URL.Query()["event"] {
+			for _, name := range strings.Split(param, ",") {
+				if name = strings.TrimSpace(name); name != "" {
+					names = append(names, name)
+				}
+			}
+		}
+		typed := request.URL.Query().Get("typed") != "false"
+		subscriber := stream.subscribe(names)
+		if subscriber == nil {
+			http.Error(writer, "app is stopping", http.StatusServiceUnavailable)
+			return
+		}
+		defer stream.unsubscribe(subscriber)
+
+		writer.Header().Set("Content-Type", EventStreamMediaType)
+		writer.Header().Set("Cache-Control", "no-cache")
+		writer.WriteHeader(http.StatusOK)
+		fmt.Fprint(writer, ": connected\n\n")
+		flusher.Flush()
+
+		heartbeat := time.NewTicker(eventStreamHeartbeatInterval)
+		defer heartbeat.Stop()
+		for {
+			select {
+			case <-request.Context().Done():
+				return
+			case <-heartbeat.C:
+				fmt.Fprint(writer, ": heartbeat\n\n")
+			case msg, ok := <-subscriber.ch:
+				if !ok {
+					return
+				}
+				if typed && msg.name != "" {
+					fmt.Fprintf(writer, "event: %s\n", msg.name)
+				}
+				fmt.Fprintf(writer, "data: %s\n\n", msg.data)
+			}
+			flusher.Flush()
+		}
+	}).WithDoc(OpenAPIOperation{
+		Summary: "log event stream",
+		Tags:    []string{BuiltinOpenAPITag},
+		Params: []OpenAPIParam{
+			{Name: "event", Description: "event names to stream - can be specified multiple times or as a comma separated list"},
+			{Name: "typed", Description: "if false, then events are sent using the default SSE event type"},
+		},
+		Responses: []OpenAPIResponse{
+			{Status: http.StatusOK, MediaTypes: []string{EventStreamMediaType}},
+			{Status: http.StatusServiceUnavailable, Description: "app is stopping"},
+		},
+	}).AdminOnly().AsStream()
+}
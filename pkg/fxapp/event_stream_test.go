@@ -0,0 +1,167 @@
+/*
+ * Copyright (c) 2019 OysterPack, Inc.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ * http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package fxapp_test
+
+import (
+	"bufio"
+	"fmt"
+	"github.com/oysterpack/andiamo/pkg/eventlog"
+	"github.com/oysterpack/andiamo/pkg/fxapp"
+	"github.com/oysterpack/andiamo/pkg/fxapptest"
+	"github.com/oysterpack/andiamo/pkg/ulids"
+	"github.com/rs/zerolog"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"io/ioutil"
+	"net/http"
+	"strings"
+	"testing"
+	"time"
+)
+
+// sseMessage is a Server-Sent Events message
+type sseMessage struct {
+	event string
+	data  string
+}
+
+// connects to the event stream, and returns after the stream is connected. The messages channel is closed when the
+// stream ends.
+func connectEventStream(t *testing.T, url string) <-chan sseMessage {
+	response, err := http.Get(url)
+	require.NoError(t, err)
+	require.Equal(t, http.StatusOK, response.StatusCode)
+	assert.Equal(t, fxapp.EventStreamMediaType, response.Header.Get("Content-Type"))
+
+	reader := bufio.NewReader(response.Body)
+	line, err := reader.ReadString('\n')
+	require.NoError(t, err)
+	require.Equal(t, ": connected\n", line)
+
+	messages := make(chan sseMessage, 100)
+	go func() {
+		defer close(messages)
+		defer response.Body.Close()
+		var msg sseMessage
+		for {
+			line, err := reader.ReadString('\n')
+			if err != nil {
+				return
+			}
+			line = strings.TrimSuffix(line, "\n")
+			switch {
+			case strings.HasPrefix(line, "event: "):
+				msg.event = strings.TrimPrefix(line, "event: ")
+			case strings.HasPrefix(line, "data: "):
+				msg.data = strings.TrimPrefix(line, "data: ")
+			case line == "" && msg.data != "":
+				messages <- msg
+				msg = sseMessage{}
+			}
+		}
+	}()
+	return messages
+}
+
+func TestEventStreamEndpoint(t *testing.T) {
+	t.Parallel()
+
+	FooEvent := ulids.MustNew().String()
+	BarEvent := ulids.MustNew().String()
+	var logger *zerolog.Logger
+	builder := fxapp.NewBuilder(fxapp.ID(ulids.MustNew()), fxapp.ReleaseID(ulids.MustNew())).
+		Invoke(func() {}).
+		LogWriter(ioutil.Discard).
+		Populate(&logger)
+
+	fxapptest.RunApp(t, builder, func(app fxapp.App, client *fxapptest.HTTPClient) {
+		messages := connectEventStream(t, client.URL(fmt.Sprintf("%s?event=%s", fxapp.EventStreamEndpoint, FooEvent)))
+
+		eventlog.NewLogger(BarEvent, logger, zerolog.InfoLevel)(nil, "bar")
+		eventlog.NewLogger(FooEvent, logger, zerolog.InfoLevel)(nil, "foo")
+		select {
+		case msg := <-messages:
+			assert.Equal(t, FooEvent, msg.event, "only the Foo event should be streamed")
+			logEvent, err := fxapptest.ParseLogEvent(msg.data)
+			require.NoError(t, err)
+			assert.Equal(t, FooEvent, logEvent.Name)
+			assert.Equal(t, "foo", logEvent.Message)
+		case <-time.After(5 * time.Second):
+			t.Fatal("*** timed out waiting for event")
+		}
+
+		t.Run("untyped events", func(t *testing.T) {
+			messages := connectEventStream(t, client.URL(fmt.Sprintf("%s?event=%s&typed=false", fxapp.EventStreamEndpoint, FooEvent)))
+			eventlog.NewLogger(FooEvent, logger, zerolog.InfoLevel)(nil, "foo")
+			select {
+			case msg := <-messages:
+				assert.Empty(t, msg.event, "the default SSE event type should be used")
+				logEvent, err := fxapptest.ParseLogEvent(msg.data)
+				require.NoError(t, err)
+				assert.Equal(t, FooEvent, logEvent.Name)
+			case <-time.After(5 * time.Second):
+				t.Fatal("*** timed out waiting for event")
+			}
+		})
+
+		t.Run("POST is not allowed", func(t *testing.T) {
+			response, err := client.Post(client.URL(fxapp.EventStreamEndpoint), "text/plain", nil)
+			require.NoError(t, err)
+			response.Body.Close()
+			assert.Equal(t, http.StatusMethodNotAllowed, response.StatusCode)
+		})
+	})
+}
+
+func TestEventStreamEndpoint_ClosedWhenAppIsStopping(t *testing.T) {
+	t.Parallel()
+
+	var httpServerAddr fxapp.HTTPServerAddr
+	app, err := fxapp.NewBuilder(fxapp.ID(ulids.MustNew()), fxapp.ReleaseID(ulids.MustNew())).
+		Invoke(func() {}).
+		LogWriter(ioutil.Discard).
+		SetHTTPServerAddr("127.0.0.1:0").
+		Populate(&httpServerAddr).
+		AllowUnauthenticatedAdmin().
+		Build()
+	require.NoError(t, err)
+	go app.Run()
+	<-app.Ready()
+
+	messages := connectEventStream(t, fmt.Sprintf("http://%s/%s", httpServerAddr(), fxapp.EventStreamEndpoint))
+	app.Shutdown()
+	var events []string
+	timeout := time.After(5 * time.Second)
+ReadLoop:
+	for {
+		select {
+		case msg, ok := <-messages:
+			if !ok {
+				break ReadLoop
+			}
+			events = append(events, msg.event)
+		case <-timeout:
+			t.Fatal("*** timed out waiting for the event stream to be closed")
+		}
+	}
+	assert.Contains(t, events, fxapp.StoppingEvent)
+	select {
+	case <-app.Done():
+	case <-time.After(5 * time.Second):
+		t.Fatal("*** timed out waiting for the app to stop")
+	}
+}
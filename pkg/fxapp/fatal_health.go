@@ -0,0 +1,189 @@
+/*
+ * Copyright (c) 2019 OysterPack, Inc.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ * http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package fxapp
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"github.com/oysterpack/andiamo/pkg/eventlog"
+	"github.com/oysterpack/andiamo/pkg/fx/health"
+	"github.com/rs/zerolog"
+	"go.uber.org/fx"
+	"sync"
+)
+
+// FatalHealthCheckEvent is logged when a fatal health check reports consecutive Red results, which exceeds its threshold.
+// The app liveness probe fails, and the app is shutdown using the `ShutdownHealthCritical` reason.
+//
+//	type Data struct {
+//		ID              string `json:"id"`
+//		ConsecutiveReds int    `json:"consecutive_reds"`
+//		Err             string `json:"err"`
+//	}
+const FatalHealthCheckEvent = "01DJ6CFK4063GVHMN56A56ERBA"
+
+// DefaultFatalHealthCheckMaxConsecutiveReds is the default number of consecutive Red results that trigger the app to
+// shutdown
+const DefaultFatalHealthCheckMaxConsecutiveReds = 3
+
+// ErrInvalidFatalHealthCheck indicates the fatal health check is invalid
+var ErrInvalidFatalHealthCheck = errors.New("fatal health check is invalid")
+
+// FatalHealthCheck marks a health check as fatal, i.e., it implements the fail fast pattern for unrecoverable states,
+// e.g., a poisoned local cache. After the specified number of consecutive Red results:
+//   - the `FatalHealthCheckEvent` is logged
+//   - the app liveness probe fails, even if the health check recovers
+//   - the app is shutdown gracefully using the `ShutdownHealthCritical` reason
+type FatalHealthCheck struct {
+	// CheckID is the health check ID
+	CheckID string
+	// MaxConsecutiveReds defaults to DefaultFatalHealthCheckMaxConsecutiveReds
+	MaxConsecutiveReds int
+}
+
+func (c FatalHealthCheck) validate() error {
+	if c.CheckID == "" {
+		return fmt.Errorf("%s : check ID is required", ErrInvalidFatalHealthCheck)
+	}
+	if c.MaxConsecutiveReds < 0 {
+		return fmt.Errorf("%s : %s : max consecutive reds must not be negative : %d", ErrInvalidFatalHealthCheck, c.CheckID, c.MaxConsecutiveReds)
+	}
+	return nil
+}
+
+func (c FatalHealthCheck) withDefaults() FatalHealthCheck {
+	if c.MaxConsecutiveReds == 0 {
+		c.MaxConsecutiveReds = DefaultFatalHealthCheckMaxConsecutiveReds
+	}
+	return c
+}
+
+type fatalHealthCheckTripped struct {
+	id              string
+	consecutiveReds int
+	err             error
+}
+
+// MarshalZerologObject implements zerolog.LogObjectMarshaler interface
+func (e fatalHealthCheckTripped) MarshalZerologObject(event *zerolog.Event) {
+	event.Str("id", e.id).Int("consecutive_reds", e.consecutiveReds)
+	if e.err != nil {
+		event.Str("err", e.err.Error())
+	}
+}
+
+// fatalHealthChecks tracks the consecutive Red results for the fatal health checks
+type fatalHealthChecks struct {
+	thresholds map[string]int
+
+	mutex   sync.Mutex
+	reds    map[string]int
+	tripped *fatalHealthCheckTripped
+}
+
+func newFatalHealthChecks(checks []FatalHealthCheck) *fatalHealthChecks {
+	thresholds := make(map[string]int, len(checks))
+	for _, check := range checks {
+		check = check.withDefaults()
+		thresholds[check.CheckID] = check.MaxConsecutiveReds
+	}
+	return &fatalHealthChecks{
+		thresholds: thresholds,
+		reds:       make(map[string]int, len(checks)),
+	}
+}
+
+func (f *fatalHealthChecks) isFatal(result health.Result) bool {
+	_, ok := f.thresholds[result.ID]
+	return ok
+}
+
+// observe returns the trip if the result trips the fatal health check. Once tripped, results are ignored.
+func (f *fatalHealthChecks) observe(result health.Result) *fatalHealthCheckTripped {
+	f.mutex.Lock()
+	defer f.mutex.Unlock()
+	if f.tripped != nil {
+		return nil
+	}
+	if result.Status != health.Red {
+		delete(f.reds, result.ID)
+		return nil
+	}
+	f.reds[result.ID]++
+	if f.reds[result.ID] < f.thresholds[result.ID] {
+		return nil
+	}
+	f.tripped = &fatalHealthCheckTripped{id: result.ID, consecutiveReds: f.reds[result.ID], err: result.Err}
+	return f.tripped
+}
+
+// err returns an error once a fatal health check has tripped
+func (f *fatalHealthChecks) err() error {
+	f.mutex.Lock()
+	defer f.mutex.Unlock()
+	if f.tripped == nil {
+		return nil
+	}
+	return fmt.Errorf("fatal health check [%s] reported %d consecutive Red results : %v", f.tripped.id, f.tripped.consecutiveReds, f.tripped.err)
+}
+
+type fatalHealthChecksParams struct {
+	fx.In
+
+	Lifecycle       fx.Lifecycle
+	Checks          *fatalHealthChecks
+	Subscribe       health.SubscribeForCheckResults
+	RequestShutdown RequestShutdown
+	Logger          *zerolog.Logger
+}
+
+// monitors the fatal health check results, and shuts down the app when a fatal health check trips
+func runFatalHealthChecks(params fatalHealthChecksParams) {
+	logTripped := eventlog.NewLogger(FatalHealthCheckEvent, params.Logger, zerolog.ErrorLevel)
+	done := make(chan struct{})
+	params.Lifecycle.Append(fx.Hook{
+		OnStart: func(context.Context) error {
+			subscription := params.Subscribe(params.Checks.isFatal)
+			go func() {
+				defer subscription.Close()
+				for {
+					select {
+					case <-done:
+						return
+					case result, ok := <-subscription.Chan():
+						if !ok {
+							return
+						}
+						tripped := params.Checks.observe(result)
+						if tripped == nil {
+							continue
+						}
+						logTripped(tripped, "fatal health check tripped")
+						params.RequestShutdown(ShutdownReason{Code: ShutdownHealthCritical, Msg: params.Checks.err().Error()})
+						return
+					}
+				}
+			}()
+			return nil
+		},
+		OnStop: func(context.Context) error {
+			close(done)
+			return nil
+		},
+	})
+}
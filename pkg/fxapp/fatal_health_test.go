@@ -0,0 +1,111 @@
+/*
+ * Copyright (c) 2019 OysterPack, Inc.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ * http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package fxapp_test
+
+import (
+	"context"
+	"errors"
+	"github.com/oysterpack/andiamo/pkg/fx/health"
+	"github.com/oysterpack/andiamo/pkg/fxapp"
+	"github.com/oysterpack/andiamo/pkg/fxapptest"
+	"github.com/oysterpack/andiamo/pkg/ulids"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestBuilder_EnableFatalHealthChecks(t *testing.T) {
+	t.Parallel()
+
+	CacheHealthCheckID := ulids.MustNew().String()
+	var poisoned int32
+	logs := fxapptest.NewLogCapture()
+	var (
+		runCheckNow   health.RunCheckNow
+		livenessProbe fxapp.LivenessProbe
+	)
+	app, err := fxapp.NewBuilder(fxapp.ID(ulids.MustNew()), fxapp.ReleaseID(ulids.MustNew())).
+		Invoke(func(register health.Register) error {
+			return register(health.Check{
+				ID:          CacheHealthCheckID,
+				Description: "local cache",
+				RedImpact:   "cache is poisoned",
+			}, health.CheckerOpts{RunInterval: time.Hour}, func(ctx context.Context) (health.Status, error) {
+				if atomic.LoadInt32(&poisoned) == 1 {
+					return health.Red, errors.New("cache is poisoned")
+				}
+				return health.Green, nil
+			})
+		}).
+		EnableFatalHealthChecks(fxapp.FatalHealthCheck{CheckID: CacheHealthCheckID, MaxConsecutiveReds: 2}).
+		Populate(&runCheckNow, &livenessProbe).
+		LogWriter(logs).
+		DisableHTTPServer().
+		Build()
+	require.NoError(t, err)
+
+	runErr := runApp(t, app)
+	require.NoError(t, livenessProbe())
+
+	atomic.StoreInt32(&poisoned, 1)
+	for i := 0; i < 2; i++ {
+		_, err := runCheckNow(CacheHealthCheckID)
+		require.NoError(t, err)
+	}
+
+	select {
+	case signal := <-app.Done():
+		reason, ok := signal.(fxapp.ShutdownReason)
+		require.True(t, ok)
+		assert.Equal(t, fxapp.ShutdownHealthCritical, reason.Code)
+		assert.Equal(t, fxapp.ExitCodeHealthCritical, reason.ExitCode())
+		assert.Contains(t, reason.Msg, CacheHealthCheckID)
+	case <-time.After(fxapptest.RunAppTimeout):
+		t.Fatal("*** timed out waiting for the app to shutdown")
+	}
+	require.NoError(t, <-runErr)
+
+	fxapptest.AssertEventLogged(t, logs, fxapp.FatalHealthCheckEvent,
+		fxapptest.Field("d.id", CacheHealthCheckID),
+		fxapptest.Field("d.consecutive_reds", float64(2)),
+		fxapptest.FieldExists("d.err"),
+	)
+	// once tripped, the liveness probe fails even if the health check recovers
+	atomic.StoreInt32(&poisoned, 0)
+	assert.Error(t, livenessProbe())
+}
+
+func TestFatalHealthCheck_Validation(t *testing.T) {
+	t.Parallel()
+
+	CheckID := ulids.MustNew().String()
+	for _, checks := range [][]fxapp.FatalHealthCheck{
+		{{}},
+		{{CheckID: CheckID, MaxConsecutiveReds: -1}},
+		{{CheckID: CheckID}, {CheckID: CheckID}},
+	} {
+		_, err := fxapp.NewBuilder(fxapp.ID(ulids.MustNew()), fxapp.ReleaseID(ulids.MustNew())).
+			Invoke(func() {}).
+			EnableFatalHealthChecks(checks...).
+			DisableHTTPServer().
+			Build()
+		require.Error(t, err)
+		assert.Contains(t, err.Error(), fxapp.ErrInvalidFatalHealthCheck.Error())
+	}
+}
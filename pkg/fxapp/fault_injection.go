@@ -0,0 +1,457 @@
+/*
+ * Copyright (c) 2019 OysterPack, Inc.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ * http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package fxapp
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"github.com/kelseyhightower/envconfig"
+	"github.com/oysterpack/andiamo/pkg/clock"
+	"github.com/oysterpack/andiamo/pkg/eventlog"
+	"github.com/oysterpack/andiamo/pkg/fx/health"
+	"github.com/rs/zerolog"
+	"go.uber.org/fx"
+	"net/http"
+	"sort"
+	"sync"
+	"time"
+)
+
+// FaultInjectionEndpoint is used to construct the admin HTTP endpoint that manages the injected faults. The endpoint is
+// only registered if fault injection is enabled via env vars - see `LoadFaultInjectionOptsFromEnv()`.
+//
+//   - GET returns the active faults as JSON
+//   - PUT sets the fault that is specified by the JSON request body, i.e., it replaces the fault with the same target
+//     and ID, and returns the active faults
+//   - DELETE clears the faults that match the "target" and "id" query params - if no query params are specified, then all
+//     faults are cleared
+//
+// Fault JSON example:
+//
+//	{"target": "http", "id": "/foo", "latency": "250ms", "status": 503}
+//
+// The endpoint itself is exempt from HTTP faults.
+const FaultInjectionEndpoint = "01DJ20D5M0MP8ZGKVVXDB2EP0B"
+
+// FaultInjectionEvent is logged at warn level when faults are set or cleared via the `FaultInjectionEndpoint`, and when
+// a lifecycle fault is injected.
+//
+//	type Data struct {
+//		// one of: set, clear, inject
+//		Op      string `json:"op"`
+//		Target  string `json:"target"`
+//		ID      string `json:"id"`
+//		// msec
+//		Latency uint   `json:"latency"`
+//		Err     string `json:"err"`
+//		Status  int    `json:"status"`
+//	}
+const FaultInjectionEvent = "01DJ20D5R98E89Z8DXQFTBK3R7"
+
+// FaultInjectionEnvconfigPrefix is used to load the fault injection options from env vars - see
+// `LoadFaultInjectionOptsFromEnv()`
+const FaultInjectionEnvconfigPrefix = EnvconfigPrefix + "_" + faultInjectionEnvName
+
+// FaultTarget is what the fault is injected into
+type FaultTarget string
+
+// fault targets
+const (
+	// HealthCheckFault faults are injected into health checkers - the fault ID is the health check ID
+	HealthCheckFault FaultTarget = "health"
+	// HTTPFault faults are injected into the HTTP server request handling - the fault ID is the request URL path
+	HTTPFault FaultTarget = "http"
+	// LifecycleFault faults are injected into app lifecycle hooks - the fault ID is either `StartFaultID` or `StopFaultID`
+	LifecycleFault FaultTarget = "lifecycle"
+)
+
+// lifecycle fault IDs
+const (
+	// StartFaultID is injected when the app is started. Because the app must be started in order to serve the
+	// `FaultInjectionEndpoint`, start faults can only be configured via env vars - see `FaultInjectionOpts`.
+	StartFaultID = "start"
+	// StopFaultID is injected when the app is stopped
+	StopFaultID = "stop"
+)
+
+// ErrInvalidFault indicates the fault is invalid
+var ErrInvalidFault = errors.New("invalid fault")
+
+// FaultInjectionOpts is used to configure fault injection, which is used to validate alerting and readiness behavior,
+// e.g., in staging environments.
+//
+// Fault injection can only be enabled via env vars, i.e., it is never enabled by default and must be explicitly enabled
+// per deployment.
+type FaultInjectionOpts struct {
+	Enabled bool
+	// StartLatency is injected when the app is started
+	StartLatency time.Duration `split_words:"true"`
+	// StartError fails the app start, if specified
+	StartError string `split_words:"true"`
+}
+
+// LoadFaultInjectionOptsFromEnv tries to load the fault injection options from env vars:
+//
+//   - APP12X_FAULT_INJECTION_ENABLED, e.g., "true"
+//   - APP12X_FAULT_INJECTION_START_LATENCY, e.g., "5s"
+//   - APP12X_FAULT_INJECTION_START_ERROR
+//
+// When fault injection is enabled, faults are injected on demand via the `FaultInjectionEndpoint`.
+func LoadFaultInjectionOptsFromEnv() (FaultInjectionOpts, error) {
+	return loadFaultInjectionOpts(EnvconfigPrefix)
+}
+
+func loadFaultInjectionOpts(prefix EnvPrefix) (FaultInjectionOpts, error) {
+	var opts FaultInjectionOpts
+	err := envconfig.Process(prefix.EnvVar(faultInjectionEnvName), &opts)
+	return opts, err
+}
+
+func (opts FaultInjectionOpts) startFault() (Fault, bool) {
+	fault := Fault{
+		Target:  LifecycleFault,
+		ID:      StartFaultID,
+		Latency: opts.StartLatency,
+		Error:   opts.StartError,
+	}
+	return fault, fault.Latency != 0 || fault.Error != ""
+}
+
+func (opts FaultInjectionOpts) validate() error {
+	if fault, ok := opts.startFault(); ok {
+		return fault.validate()
+	}
+	return nil
+}
+
+// Fault specifies the latency and / or error that is injected into the target
+type Fault struct {
+	Target FaultTarget
+	// ID is the health check ID, HTTP request path, or lifecycle fault ID, depending on the target. If blank, then the
+	// fault applies to everything within the target, unless a more specific fault matches.
+	ID string
+
+	Latency time.Duration
+	// Error is returned after the latency is injected, if specified, i.e., health checks fail with a Red status, and
+	// lifecycle hooks fail
+	Error string
+	// Status is the HTTP response status for HTTP faults - if zero and an error is specified, then 500 is used
+	Status int
+}
+
+type faultJSON struct {
+	Target FaultTarget `json:"target"`
+	ID     string      `json:"id,omitempty"`
+	// time.Duration string format, e.g., "250ms"
+	Latency string `json:"latency,omitempty"`
+	Error   string `json:"error,omitempty"`
+	Status  int    `json:"status,omitempty"`
+}
+
+// MarshalJSON implements json.Marshaler - the latency is formatted as a duration string
+func (f Fault) MarshalJSON() ([]byte, error) {
+	fault := faultJSON{
+		Target: f.Target,
+		ID:     f.ID,
+		Error:  f.Error,
+		Status: f.Status,
+	}
+	if f.Latency != 0 {
+		fault.Latency = f.Latency.String()
+	}
+	return json.Marshal(fault)
+}
+
+// UnmarshalJSON implements json.Unmarshaler - the latency is parsed as a duration string
+func (f *Fault) UnmarshalJSON(data []byte) error {
+	var fault faultJSON
+	if err := json.Unmarshal(data, &fault); err != nil {
+		return err
+	}
+	var latency time.Duration
+	if fault.Latency != "" {
+		var err error
+		if latency, err = time.ParseDuration(fault.Latency); err != nil {
+			return fmt.Errorf("%s : invalid latency : %s", ErrInvalidFault, err)
+		}
+	}
+	*f = Fault{
+		Target:  fault.Target,
+		ID:      fault.ID,
+		Latency: latency,
+		Error:   fault.Error,
+		Status:  fault.Status,
+	}
+	return nil
+}
+
+func (f Fault) validate() error {
+	switch f.Target {
+	case HealthCheckFault, HTTPFault:
+	case LifecycleFault:
+		if f.ID != "" && f.ID != StartFaultID && f.ID != StopFaultID {
+			return fmt.Errorf("%s : lifecycle fault ID must be one of [%s, %s] : %q", ErrInvalidFault, StartFaultID, StopFaultID, f.ID)
+		}
+	default:
+		return fmt.Errorf("%s : unknown target : %q", ErrInvalidFault, f.Target)
+	}
+	if f.Latency < 0 {
+		return fmt.Errorf("%s : latency must not be negative : %s", ErrInvalidFault, f.Latency)
+	}
+	if f.Status != 0 {
+		if f.Target != HTTPFault {
+			return fmt.Errorf("%s : status only applies to HTTP faults", ErrInvalidFault)
+		}
+		if f.Status < 400 || f.Status > 599 {
+			return fmt.Errorf("%s : status must be an HTTP error status : %d", ErrInvalidFault, f.Status)
+		}
+	}
+	if f.Latency == 0 && f.Error == "" && f.Status == 0 {
+		return fmt.Errorf("%s : a latency, error, or status must be specified", ErrInvalidFault)
+	}
+	return nil
+}
+
+// inject waits for the fault latency, and then returns the fault error. If the context is done before the latency
+// elapses, then the context error is returned.
+func (f Fault) inject(ctx context.Context, clock clock.Clock) error {
+	if f.Latency > 0 {
+		timer := clock.NewTimer(f.Latency)
+		select {
+		case <-timer.C():
+		case <-ctx.Done():
+			timer.Stop()
+			return ctx.Err()
+		}
+	}
+	switch {
+	case f.Error != "":
+		return errors.New(f.Error)
+	case f.Status != 0:
+		return errors.New(http.StatusText(f.Status))
+	default:
+		return nil
+	}
+}
+
+// MarshalZerologObject implements zerolog.LogObjectMarshaler
+func (f Fault) MarshalZerologObject(e *zerolog.Event) {
+	e.Str("target", string(f.Target)).
+		Str("id", f.ID).
+		Dur("latency", f.Latency).
+		Str("err", f.Error).
+		Int("status", f.Status)
+}
+
+type faultKey struct {
+	target FaultTarget
+	id     string
+}
+
+// faultInjector holds the active faults
+type faultInjector struct {
+	clock clock.Clock
+
+	mutex  sync.RWMutex
+	faults map[faultKey]Fault
+}
+
+func newFaultInjector(opts FaultInjectionOpts, clock clock.Clock) *faultInjector {
+	injector := &faultInjector{
+		clock:  clock,
+		faults: make(map[faultKey]Fault),
+	}
+	if fault, ok := opts.startFault(); ok {
+		injector.set(fault)
+	}
+	return injector
+}
+
+func (f *faultInjector) set(fault Fault) {
+	f.mutex.Lock()
+	defer f.mutex.Unlock()
+	f.faults[faultKey{fault.Target, fault.ID}] = fault
+}
+
+// clear removes the faults that match the target and ID - blank matches all
+func (f *faultInjector) clear(target FaultTarget, id string) []Fault {
+	f.mutex.Lock()
+	defer f.mutex.Unlock()
+	var cleared []Fault
+	for key, fault := range f.faults {
+		if (target == "" || key.target == target) && (id == "" || key.id == id) {
+			delete(f.faults, key)
+			cleared = append(cleared, fault)
+		}
+	}
+	sortFaults(cleared)
+	return cleared
+}
+
+// lookup returns the fault that matches the ID, or else the fault that applies to all within the target
+func (f *faultInjector) lookup(target FaultTarget, id string) (Fault, bool) {
+	f.mutex.RLock()
+	defer f.mutex.RUnlock()
+	if fault, ok := f.faults[faultKey{target, id}]; ok {
+		return fault, true
+	}
+	fault, ok := f.faults[faultKey{target: target}]
+	return fault, ok
+}
+
+func (f *faultInjector) activeFaults() []Fault {
+	f.mutex.RLock()
+	defer f.mutex.RUnlock()
+	faults := make([]Fault, 0, len(f.faults))
+	for _, fault := range f.faults {
+		faults = append(faults, fault)
+	}
+	sortFaults(faults)
+	return faults
+}
+
+func sortFaults(faults []Fault) {
+	sort.Slice(faults, func(i, j int) bool {
+		if faults[i].Target != faults[j].Target {
+			return faults[i].Target < faults[j].Target
+		}
+		return faults[i].ID < faults[j].ID
+	})
+}
+
+// interceptHealthCheck injects faults into health checkers - health checks fail with a Red status
+func (f *faultInjector) interceptHealthCheck(check health.Check, checker func(ctx context.Context) (health.Status, error)) func(ctx context.Context) (health.Status, error) {
+	return func(ctx context.Context) (health.Status, error) {
+		if fault, ok := f.lookup(HealthCheckFault, check.ID); ok {
+			if err := fault.inject(ctx, f.clock); err != nil {
+				return health.Red, err
+			}
+		}
+		return checker(ctx)
+	}
+}
+
+// middleware injects faults into HTTP request handling
+func (f *faultInjector) middleware(next http.Handler) http.Handler {
+	exempt := fmt.Sprintf("/%s", FaultInjectionEndpoint)
+	return http.HandlerFunc(func(writer http.ResponseWriter, request *http.Request) {
+		if request.URL.Path != exempt {
+			if fault, ok := f.lookup(HTTPFault, request.URL.Path); ok {
+				if err := fault.inject(request.Context(), f.clock); err != nil {
+					status := fault.Status
+					if status == 0 {
+						status = http.StatusInternalServerError
+					}
+					http.Error(writer, err.Error(), status)
+					return
+				}
+			}
+		}
+		next.ServeHTTP(writer, request)
+	})
+}
+
+type faultInjectionAudit struct {
+	op    string
+	fault Fault
+}
+
+func (a faultInjectionAudit) MarshalZerologObject(e *zerolog.Event) {
+	e.Str("op", a.op)
+	a.fault.MarshalZerologObject(e)
+}
+
+// registerLifecycleFaults injects the lifecycle faults into app start and stop
+func (f *faultInjector) registerLifecycleFaults(lc fx.Lifecycle, logger *zerolog.Logger) {
+	logEvent := eventlog.NewLogger(FaultInjectionEvent, logger, zerolog.WarnLevel)
+	inject := func(ctx context.Context, id string) error {
+		fault, ok := f.lookup(LifecycleFault, id)
+		if !ok {
+			return nil
+		}
+		logEvent(faultInjectionAudit{"inject", fault}, "injecting lifecycle fault")
+		return fault.inject(ctx, f.clock)
+	}
+	lc.Append(fx.Hook{
+		OnStart: func(ctx context.Context) error {
+			return inject(ctx, StartFaultID)
+		},
+		OnStop: func(ctx context.Context) error {
+			return inject(ctx, StopFaultID)
+		},
+	})
+}
+
+func faultInjectionHTTPHandlers(injector *faultInjector, logger *zerolog.Logger) HTTPHandlers {
+	logEvent := eventlog.NewLogger(FaultInjectionEvent, logger, zerolog.WarnLevel)
+	path := fmt.Sprintf("/%s", FaultInjectionEndpoint)
+	writeFaults := func(writer http.ResponseWriter, faults []Fault) {
+		writer.Header().Set("Content-Type", JSONMediaType)
+		json.NewEncoder(writer).Encode(faults)
+	}
+	jsonResponse := []OpenAPIResponse{{Status: http.StatusOK, MediaTypes: []string{JSONMediaType}}}
+
+	handlers := []HTTPHandler{
+		NewHTTPRoute(http.MethodGet, path, func(writer http.ResponseWriter, request *http.Request) {
+			writeFaults(writer, injector.activeFaults())
+		}).WithDoc(OpenAPIOperation{
+			Summary:   "active faults",
+			Tags:      []string{BuiltinOpenAPITag},
+			Responses: jsonResponse,
+		}),
+		NewHTTPRoute(http.MethodPut, path, func(writer http.ResponseWriter, request *http.Request) {
+			var fault Fault
+			if err := json.NewDecoder(request.Body).Decode(&fault); err != nil {
+				http.Error(writer, err.Error(), http.StatusBadRequest)
+				return
+			}
+			if err := fault.validate(); err != nil {
+				http.Error(writer, err.Error(), http.StatusBadRequest)
+				return
+			}
+			injector.set(fault)
+			logEvent(faultInjectionAudit{"set", fault}, "fault set")
+			writeFaults(writer, injector.activeFaults())
+		}).WithDoc(OpenAPIOperation{
+			Summary:   "sets a fault",
+			Tags:      []string{BuiltinOpenAPITag},
+			Responses: append(jsonResponse, OpenAPIResponse{Status: http.StatusBadRequest}),
+		}),
+		NewHTTPRoute(http.MethodDelete, path, func(writer http.ResponseWriter, request *http.Request) {
+			query := request.URL.Query()
+			for _, fault := range injector.clear(FaultTarget(query.Get("target")), query.Get("id")) {
+				logEvent(faultInjectionAudit{"clear", fault}, "fault cleared")
+			}
+			writeFaults(writer, injector.activeFaults())
+		}).WithDoc(OpenAPIOperation{
+			Summary: "clears faults",
+			Tags:    []string{BuiltinOpenAPITag},
+			Params: []OpenAPIParam{
+				{Name: "target", Description: "one of: health, http, lifecycle"},
+				{Name: "id", Description: "the fault ID within the target"},
+			},
+			Responses: jsonResponse,
+		}),
+	}
+	endpoints := make([]HTTPEndpoint, len(handlers))
+	for i, handler := range handlers {
+		endpoints[i] = handler.AdminOnly().HTTPEndpoint
+	}
+	return HTTPHandlers{HTTPEndpoints: endpoints}
+}
@@ -0,0 +1,214 @@
+/*
+ * Copyright (c) 2019 OysterPack, Inc.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ * http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package fxapp_test
+
+import (
+	"context"
+	"encoding/json"
+	"github.com/oysterpack/andiamo/pkg/fx/health"
+	"github.com/oysterpack/andiamo/pkg/fxapp"
+	"github.com/oysterpack/andiamo/pkg/fxapptest"
+	"github.com/oysterpack/andiamo/pkg/ulids"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"io/ioutil"
+	"net/http"
+	"os"
+	"strings"
+	"testing"
+	"time"
+)
+
+// fault injection tests are not run in parallel because fault injection is enabled via env vars
+func setFaultInjectionEnv(t *testing.T, env map[string]string) func() {
+	for name, value := range env {
+		require.NoError(t, os.Setenv(name, value))
+	}
+	return func() {
+		for name := range env {
+			os.Unsetenv(name)
+		}
+	}
+}
+
+func TestFaultInjection(t *testing.T) {
+	defer setFaultInjectionEnv(t, map[string]string{fxapp.FaultInjectionEnvconfigPrefix + "_ENABLED": "true"})()
+
+	const CheckID = "01DJ20D5WJ1269BSX21XJ2AWEQ"
+	var runCheckNow health.RunCheckNow
+	logs := fxapptest.NewLogCapture()
+	builder := fxapp.NewBuilder(fxapp.ID(ulids.MustNew()), fxapp.ReleaseID(ulids.MustNew())).
+		Provide(func() fxapp.HTTPHandler {
+			return fxapp.NewHTTPRoute(http.MethodGet, "/foo", func(writer http.ResponseWriter, request *http.Request) {
+				writer.Write([]byte("foo"))
+			})
+		}).
+		Invoke(func(register health.Register) error {
+			return register(health.Check{ID: CheckID, Description: "fault injection test check", RedImpact: "none"}, health.CheckerOpts{}, func(ctx context.Context) (health.Status, error) {
+				return health.Green, nil
+			})
+		}).
+		Populate(&runCheckNow).
+		LogWriter(logs)
+
+	fxapptest.RunApp(t, builder, func(app fxapp.App, client *fxapptest.HTTPClient) {
+		do := func(method, path, body string) (*http.Response, string) {
+			request, err := http.NewRequest(method, client.URL(path), strings.NewReader(body))
+			require.NoError(t, err)
+			response, err := client.Do(request)
+			require.NoError(t, err)
+			defer response.Body.Close()
+			responseBody, err := ioutil.ReadAll(response.Body)
+			require.NoError(t, err)
+			return response, string(responseBody)
+		}
+		activeFaults := func() []fxapp.Fault {
+			response, body := do(http.MethodGet, fxapp.FaultInjectionEndpoint, "")
+			require.Equal(t, http.StatusOK, response.StatusCode)
+			var faults []fxapp.Fault
+			require.NoError(t, json.Unmarshal([]byte(body), &faults))
+			return faults
+		}
+
+		require.Empty(t, activeFaults())
+
+		t.Run("HTTP fault", func(t *testing.T) {
+			response, body := do(http.MethodPut, fxapp.FaultInjectionEndpoint, `{"target": "http", "id": "/foo", "latency": "10ms", "status": 503}`)
+			require.Equal(t, http.StatusOK, response.StatusCode, body)
+			fxapptest.AssertEventLogged(t, logs, fxapp.FaultInjectionEvent,
+				fxapptest.Field("d.op", "set"),
+				fxapptest.Field("d.target", "http"),
+				fxapptest.Field("d.id", "/foo"),
+				fxapptest.Field("d.status", float64(503)),
+			)
+
+			start := time.Now()
+			response, _ = do(http.MethodGet, "/foo", "")
+			assert.Equal(t, http.StatusServiceUnavailable, response.StatusCode)
+			assert.True(t, time.Since(start) >= 10*time.Millisecond)
+		})
+
+		t.Run("health check fault", func(t *testing.T) {
+			response, body := do(http.MethodPut, fxapp.FaultInjectionEndpoint, `{"target": "health", "id": "`+CheckID+`", "error": "BOOM"}`)
+			require.Equal(t, http.StatusOK, response.StatusCode, body)
+
+			result, err := runCheckNow(CheckID)
+			require.NoError(t, err)
+			assert.Equal(t, health.Red, result.Status)
+			assert.Contains(t, result.Err.Error(), "BOOM")
+		})
+
+		t.Run("list faults", func(t *testing.T) {
+			faults := activeFaults()
+			require.Len(t, faults, 2)
+			assert.Equal(t, fxapp.Fault{Target: fxapp.HealthCheckFault, ID: CheckID, Error: "BOOM"}, faults[0])
+			assert.Equal(t, fxapp.Fault{Target: fxapp.HTTPFault, ID: "/foo", Latency: 10 * time.Millisecond, Status: 503}, faults[1])
+		})
+
+		t.Run("the fault injection endpoint is exempt from HTTP faults", func(t *testing.T) {
+			response, body := do(http.MethodPut, fxapp.FaultInjectionEndpoint, `{"target": "http", "status": 500}`)
+			require.Equal(t, http.StatusOK, response.StatusCode, body)
+			assert.Len(t, activeFaults(), 3)
+		})
+
+		t.Run("invalid faults", func(t *testing.T) {
+			for _, fault := range []string{
+				`{"target": "disk"}`,
+				`{"target": "http", "latency": "1 sec"}`,
+				`{"target": "http", "latency": "-1s"}`,
+				`{"target": "health", "status": 500}`,
+				`{"target": "lifecycle", "id": "restart", "error": "BOOM"}`,
+				`{"target": "http", "id": "/foo"}`,
+			} {
+				response, _ := do(http.MethodPut, fxapp.FaultInjectionEndpoint, fault)
+				assert.Equal(t, http.StatusBadRequest, response.StatusCode, fault)
+			}
+		})
+
+		t.Run("clear faults", func(t *testing.T) {
+			response, _ := do(http.MethodDelete, fxapp.FaultInjectionEndpoint+"?target=http&id=/foo", "")
+			require.Equal(t, http.StatusOK, response.StatusCode)
+			fxapptest.AssertEventLogged(t, logs, fxapp.FaultInjectionEvent,
+				fxapptest.Field("d.op", "clear"),
+				fxapptest.Field("d.id", "/foo"),
+			)
+			assert.Len(t, activeFaults(), 2)
+
+			response, _ = do(http.MethodDelete, fxapp.FaultInjectionEndpoint, "")
+			require.Equal(t, http.StatusOK, response.StatusCode)
+			assert.Empty(t, activeFaults())
+
+			response, body := do(http.MethodGet, "/foo", "")
+			assert.Equal(t, http.StatusOK, response.StatusCode)
+			assert.Equal(t, "foo", body)
+			result, err := runCheckNow(CheckID)
+			require.NoError(t, err)
+			assert.Equal(t, health.Green, result.Status)
+		})
+	})
+}
+
+func TestFaultInjection_StartFault(t *testing.T) {
+	defer setFaultInjectionEnv(t, map[string]string{
+		fxapp.FaultInjectionEnvconfigPrefix + "_ENABLED":     "true",
+		fxapp.FaultInjectionEnvconfigPrefix + "_START_ERROR": "BOOM",
+	})()
+
+	logs := fxapptest.NewLogCapture()
+	app, err := fxapp.NewBuilder(fxapp.ID(ulids.MustNew()), fxapp.ReleaseID(ulids.MustNew())).
+		Invoke(func() {}).
+		DisableHTTPServer().
+		LogWriter(logs).
+		Build()
+	require.NoError(t, err)
+	err = app.Run()
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), "BOOM")
+	fxapptest.AssertEventLogged(t, logs, fxapp.FaultInjectionEvent,
+		fxapptest.Field("d.op", "inject"),
+		fxapptest.Field("d.target", "lifecycle"),
+		fxapptest.Field("d.id", fxapp.StartFaultID),
+	)
+}
+
+func TestFaultInjection_InvalidEnv(t *testing.T) {
+	defer setFaultInjectionEnv(t, map[string]string{
+		fxapp.FaultInjectionEnvconfigPrefix + "_ENABLED":       "true",
+		fxapp.FaultInjectionEnvconfigPrefix + "_START_LATENCY": "-1s",
+	})()
+
+	_, err := fxapp.NewBuilder(fxapp.ID(ulids.MustNew()), fxapp.ReleaseID(ulids.MustNew())).
+		Invoke(func() {}).
+		DisableHTTPServer().
+		Build()
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), fxapp.ErrInvalidFault.Error())
+}
+
+func TestFaultInjection_DisabledByDefault(t *testing.T) {
+	t.Parallel()
+
+	builder := fxapp.NewBuilder(fxapp.ID(ulids.MustNew()), fxapp.ReleaseID(ulids.MustNew())).
+		Invoke(func() {}).
+		LogWriter(ioutil.Discard)
+	fxapptest.RunApp(t, builder, func(app fxapp.App, client *fxapptest.HTTPClient) {
+		response, err := client.Get(fxapp.FaultInjectionEndpoint)
+		require.NoError(t, err)
+		response.Body.Close()
+		assert.Equal(t, http.StatusNotFound, response.StatusCode)
+	})
+}
@@ -0,0 +1,68 @@
+/*
+ * Copyright (c) 2019 OysterPack, Inc.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ * http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package fxapp_test
+
+import (
+	"github.com/oysterpack/andiamo/pkg/fx/filewatch"
+	"github.com/oysterpack/andiamo/pkg/fxapp"
+	"github.com/oysterpack/andiamo/pkg/ulids"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestBuilder_EnableFileWatcher(t *testing.T) {
+	t.Parallel()
+
+	dir, err := ioutil.TempDir("", "fxapp")
+	require.NoError(t, err)
+	defer os.RemoveAll(dir)
+	path := filepath.Join(dir, "config.json")
+
+	changes := make(chan []filewatch.Event, 1)
+	app, err := fxapp.NewBuilder(fxapp.ID(ulids.MustNew()), fxapp.ReleaseID(ulids.MustNew())).
+		Invoke(func(watcher filewatch.Watcher) error {
+			_, err := watcher.Watch(path, func(events []filewatch.Event) {
+				changes <- events
+			})
+			return err
+		}).
+		EnableFileWatcher(filewatch.Opts{Debounce: 10 * time.Millisecond}).
+		DisableHTTPServer().
+		LogWriter(ioutil.Discard).
+		Build()
+	require.NoError(t, err)
+	go app.Run()
+	<-app.Ready()
+	defer func() {
+		app.Shutdown()
+		<-app.Done()
+	}()
+
+	require.NoError(t, ioutil.WriteFile(path, []byte("{}"), 0644))
+	select {
+	case events := <-changes:
+		require.Len(t, events, 1)
+		assert.Equal(t, path, events[0].Path)
+	case <-time.After(5 * time.Second):
+		t.Fatal("*** timed out waiting for change events")
+	}
+}
@@ -0,0 +1,212 @@
+/*
+ * Copyright (c) 2019 OysterPack, Inc.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ * http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package fxapp
+
+import (
+	"encoding/json"
+	"fmt"
+	"github.com/oysterpack/andiamo/pkg/appdesc"
+	"net/http"
+	"strings"
+)
+
+// GrafanaDashboardEndpoint is used to construct the Grafana dashboard HTTP endpoint, which returns the dashboard JSON
+// that is generated for the app - see `GrafanaDashboard()`.
+const GrafanaDashboardEndpoint = "01DJDVE2WJSRTVASARQZZE7TT7"
+
+// GrafanaDashboard generates a Grafana dashboard that covers the standard metrics that are produced by the framework:
+//   - app readiness, start and stop durations, and shutdown requests
+//   - health check status, queue, and recovered panics
+//   - HTTP server RED metrics, i.e., request rate, errors, and duration
+//   - Go runtime collector
+//   - process collector - only populated if the process collector is registered, see `RegisterProcessMetricsCollector()`
+//
+// The dashboard queries are keyed by the app ID label, and are filtered by the release ID and instance ID labels via
+// dashboard variables, i.e., the same dashboard can be used across releases. The Prometheus datasource is selected via
+// the "datasource" dashboard variable.
+func GrafanaDashboard(desc appdesc.Desc) ([]byte, error) {
+	selector := fmt.Sprintf(`%s="%s",%s=~"$release_id",%s=~"$instance_id"`, AppIDLabel, desc.ID, AppReleaseIDLabel, AppInstanceIDLabel)
+	// "{}" is replaced with the dashboard selector
+	q := func(format string, metrics ...interface{}) string {
+		return strings.Replace(fmt.Sprintf(format, metrics...), "{}", "{"+selector+"}", -1)
+	}
+
+	rows := []grafanaRow{
+		{"App", []grafanaGraph{
+			{"Ready", "1 if the app readiness probe passes", []grafanaTarget{{Expr: q("%s{}", AppReadyMetricID), LegendFormat: "{{i}}"}}},
+			{"Start / Stop Duration (s)", "", []grafanaTarget{
+				{Expr: q("%s{}", AppStartDurationMetricID), LegendFormat: "start {{i}}"},
+				{Expr: q("%s{}", AppStopDurationMetricID), LegendFormat: "stop {{i}}"},
+			}},
+			{"Shutdown Requests", "", []grafanaTarget{{Expr: q("sum by (reason, outcome) (increase(%s{}[5m]))", AppShutdownRequestsMetricID), LegendFormat: "{{reason}} {{outcome}}"}}},
+		}},
+		{"Health Checks", []grafanaGraph{
+			{"Health Check Status", "0=Green, 1=Yellow, 2=Red", []grafanaTarget{{Expr: q("max by (%s) (%s{})", HealthCheckIDLabel, HealthCheckMetricID), LegendFormat: "{{" + HealthCheckIDLabel + "}}"}}},
+			{"Health Check Queue", "", []grafanaTarget{
+				{Expr: q("sum(%s{})", HealthCheckQueuedMetricID), LegendFormat: "queued"},
+				{Expr: q("sum(%s{})", HealthCheckRunningMetricID), LegendFormat: "running"},
+			}},
+			{"Health Checker Panics", "", []grafanaTarget{{Expr: q("sum by (%s) (increase(%s{}[5m]))", HealthCheckIDLabel, HealthCheckPanicsMetricID), LegendFormat: "{{" + HealthCheckIDLabel + "}}"}}},
+		}},
+		{"HTTP Server", []grafanaGraph{
+			{"Request Rate", "requests per second", []grafanaTarget{{Expr: q("sum by (path) (rate(%s{}[5m]))", HTTPRequestsMetricID), LegendFormat: "{{path}}"}}},
+			{"Error Rate", "5xx responses per second", []grafanaTarget{{Expr: fmt.Sprintf(`sum by (path) (rate(%s{%s,code=~"5.."}[5m]))`, HTTPRequestsMetricID, selector), LegendFormat: "{{path}}"}}},
+			{"Request Duration p99 (s)", "", []grafanaTarget{{Expr: q("histogram_quantile(0.99, sum by (path, le) (rate(%s_bucket{}[5m])))", HTTPRequestDurationMetricID), LegendFormat: "{{path}}"}}},
+		}},
+		{"Go Runtime", []grafanaGraph{
+			{"Goroutines", "", []grafanaTarget{{Expr: q("go_goroutines{}"), LegendFormat: "{{i}}"}}},
+			{"Heap Alloc (bytes)", "", []grafanaTarget{{Expr: q("go_memstats_heap_alloc_bytes{}"), LegendFormat: "{{i}}"}}},
+			{"GC Duration (s/s)", "", []grafanaTarget{{Expr: q("rate(go_gc_duration_seconds_sum{}[5m])"), LegendFormat: "{{i}}"}}},
+		}},
+		{"Process", []grafanaGraph{
+			{"CPU (s/s)", "", []grafanaTarget{{Expr: q("rate(process_cpu_seconds_total{}[5m])"), LegendFormat: "{{i}}"}}},
+			{"Resident Memory (bytes)", "", []grafanaTarget{{Expr: q("process_resident_memory_bytes{}"), LegendFormat: "{{i}}"}}},
+			{"Open FDs", "", []grafanaTarget{{Expr: q("process_open_fds{}"), LegendFormat: "{{i}}"}}},
+		}},
+	}
+
+	var panels []grafanaPanel
+	var y int
+	for _, row := range rows {
+		panels = append(panels, grafanaPanel{
+			ID:      len(panels) + 1,
+			Type:    "row",
+			Title:   row.title,
+			GridPos: grafanaGridPos{H: 1, W: 24, X: 0, Y: y},
+		})
+		y++
+		width := 24 / len(row.graphs)
+		for i, graph := range row.graphs {
+			targets := make([]grafanaTarget, len(graph.targets))
+			for j, target := range graph.targets {
+				target.RefID = string(rune('A' + j))
+				targets[j] = target
+			}
+			panels = append(panels, grafanaPanel{
+				ID:          len(panels) + 1,
+				Type:        "graph",
+				Title:       graph.title,
+				Description: graph.description,
+				Datasource:  "$datasource",
+				GridPos:     grafanaGridPos{H: 8, W: width, X: i * width, Y: y},
+				Targets:     targets,
+			})
+		}
+		y += 8
+	}
+
+	labelValues := func(name, label string) grafanaVariable {
+		return grafanaVariable{
+			Name:       name,
+			Type:       "query",
+			Datasource: "$datasource",
+			Query:      fmt.Sprintf(`label_values(%s{%s="%s"}, %s)`, AppReadyMetricID, AppIDLabel, desc.ID, label),
+			Refresh:    2, // refreshed when the time range changes
+			IncludeAll: true,
+			AllValue:   ".*",
+			Current:    map[string]interface{}{"text": "All", "value": "$__all"},
+		}
+	}
+	return json.Marshal(grafanaDashboard{
+		UID:           desc.ID.String(),
+		Title:         desc.Name,
+		Tags:          []string{"andiamo"},
+		SchemaVersion: 18,
+		Time:          map[string]string{"from": "now-6h", "to": "now"},
+		Refresh:       "30s",
+		Templating: map[string][]grafanaVariable{
+			"list": {
+				{Name: "datasource", Type: "datasource", Query: "prometheus"},
+				labelValues("release_id", AppReleaseIDLabel),
+				labelValues("instance_id", AppInstanceIDLabel),
+			},
+		},
+		Panels: panels,
+	})
+}
+
+type grafanaRow struct {
+	title  string
+	graphs []grafanaGraph
+}
+
+type grafanaGraph struct {
+	title       string
+	description string
+	targets     []grafanaTarget
+}
+
+type grafanaDashboard struct {
+	UID           string                       `json:"uid"`
+	Title         string                       `json:"title"`
+	Tags          []string                     `json:"tags"`
+	SchemaVersion int                          `json:"schemaVersion"`
+	Time          map[string]string            `json:"time"`
+	Refresh       string                       `json:"refresh"`
+	Templating    map[string][]grafanaVariable `json:"templating"`
+	Panels        []grafanaPanel               `json:"panels"`
+}
+
+type grafanaVariable struct {
+	Name       string                 `json:"name"`
+	Type       string                 `json:"type"`
+	Datasource string                 `json:"datasource,omitempty"`
+	Query      string                 `json:"query"`
+	Refresh    int                    `json:"refresh,omitempty"`
+	IncludeAll bool                   `json:"includeAll,omitempty"`
+	AllValue   string                 `json:"allValue,omitempty"`
+	Current    map[string]interface{} `json:"current,omitempty"`
+}
+
+type grafanaPanel struct {
+	ID          int             `json:"id"`
+	Type        string          `json:"type"`
+	Title       string          `json:"title"`
+	Description string          `json:"description,omitempty"`
+	Datasource  string          `json:"datasource,omitempty"`
+	GridPos     grafanaGridPos  `json:"gridPos"`
+	Targets     []grafanaTarget `json:"targets,omitempty"`
+}
+
+type grafanaGridPos struct {
+	H int `json:"h"`
+	W int `json:"w"`
+	X int `json:"x"`
+	Y int `json:"y"`
+}
+
+type grafanaTarget struct {
+	Expr         string `json:"expr"`
+	LegendFormat string `json:"legendFormat,omitempty"`
+	RefID        string `json:"refId"`
+}
+
+func grafanaDashboardHTTPHandler(desc appdesc.Desc) HTTPHandler {
+	return NewHTTPHandler(fmt.Sprintf("/%s", GrafanaDashboardEndpoint), func(writer http.ResponseWriter, request *http.Request) {
+		dashboard, err := GrafanaDashboard(desc)
+		if err != nil {
+			http.Error(writer, err.Error(), http.StatusInternalServerError)
+			return
+		}
+		writer.Header().Set("Content-Type", JSONMediaType)
+		writer.Write(dashboard)
+	}).WithDoc(OpenAPIOperation{
+		Summary:   "Grafana dashboard for the standard app metrics",
+		Tags:      []string{BuiltinOpenAPITag},
+		Responses: []OpenAPIResponse{{Status: http.StatusOK, MediaTypes: []string{JSONMediaType}}},
+	}).AdminOnly()
+}
@@ -0,0 +1,106 @@
+/*
+ * Copyright (c) 2019 OysterPack, Inc.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ * http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package fxapp_test
+
+import (
+	"encoding/json"
+	"fmt"
+	"github.com/oysterpack/andiamo/pkg/fxapp"
+	"github.com/oysterpack/andiamo/pkg/ulids"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"net/http"
+	"strings"
+	"testing"
+)
+
+type grafanaDashboard struct {
+	UID    string `json:"uid"`
+	Title  string `json:"title"`
+	Panels []struct {
+		Type    string `json:"type"`
+		Title   string `json:"title"`
+		Targets []struct {
+			Expr  string `json:"expr"`
+			RefID string `json:"refId"`
+		} `json:"targets"`
+	} `json:"panels"`
+}
+
+func TestGrafanaDashboard(t *testing.T) {
+	t.Parallel()
+
+	app, err := fxapp.NewBuilder(fxapp.ID(ulids.MustNew()), fxapp.ReleaseID(ulids.MustNew())).
+		Invoke(func() {}).
+		DisableHTTPServer().
+		Build()
+	require.NoError(t, err)
+	desc := app.Desc()
+
+	data, err := fxapp.GrafanaDashboard(desc)
+	require.NoError(t, err)
+	var dashboard grafanaDashboard
+	require.NoError(t, json.Unmarshal(data, &dashboard))
+	assert.Equal(t, desc.ID.String(), dashboard.UID)
+	assert.Equal(t, desc.Name, dashboard.Title)
+
+	var exprs []string
+	for _, panel := range dashboard.Panels {
+		for _, target := range panel.Targets {
+			assert.NotEmpty(t, target.RefID)
+			// queries are keyed by the app ID, and filtered by the release ID and instance ID
+			assert.Contains(t, target.Expr, fmt.Sprintf(`a="%s",r=~"$release_id",i=~"$instance_id"`, desc.ID))
+			exprs = append(exprs, target.Expr)
+		}
+	}
+	queries := strings.Join(exprs, "\n")
+	for _, metric := range []string{
+		fxapp.AppReadyMetricID,
+		fxapp.AppStartDurationMetricID,
+		fxapp.HealthCheckMetricID,
+		fxapp.HTTPRequestsMetricID,
+		fxapp.HTTPRequestDurationMetricID,
+		"go_goroutines",
+		"process_cpu_seconds_total",
+	} {
+		assert.Contains(t, queries, metric)
+	}
+}
+
+func TestGrafanaDashboardHTTPEndpoint(t *testing.T) {
+	app, err := fxapp.NewBuilder(fxapp.ID(ulids.MustNew()), fxapp.ReleaseID(ulids.MustNew())).
+		Invoke(func() {}).
+		AllowUnauthenticatedAdmin().
+		Build()
+	require.NoError(t, err)
+
+	go app.Run()
+	<-app.Ready()
+	defer func() {
+		app.Shutdown()
+		<-app.Done()
+	}()
+
+	checkHTTPGetResponse(t, fmt.Sprintf("http://:8008/%s", fxapp.GrafanaDashboardEndpoint), func(response *http.Response) {
+		defer response.Body.Close()
+		require.Equal(t, http.StatusOK, response.StatusCode)
+		assert.Equal(t, fxapp.JSONMediaType, response.Header.Get("Content-Type"))
+		var dashboard grafanaDashboard
+		require.NoError(t, json.NewDecoder(response.Body).Decode(&dashboard))
+		assert.Equal(t, app.Desc().ID.String(), dashboard.UID)
+	})
+}
@@ -0,0 +1,310 @@
+/*
+ * Copyright (c) 2019 OysterPack, Inc.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ * http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package fxapp
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"github.com/oysterpack/andiamo/pkg/fx/health"
+	"mime"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// HealthCheckResultsEndpoint is used to construct the health check results HTTP endpoint.
+//
+// The response format is selected via the HTTP Accept header:
+//   - application/json (default)
+//   - text/plain - each line contains the health check ID, status, duration, and error (if not Green), separated by tabs.
+//     The format is designed for simple scripts, e.g., using grep, awk, and cut
+//   - application/openmetrics-text - health check statuses exposed as OpenMetrics gauges
+//
+// The results are sorted by health check ID, and can be filtered and paginated via query params, e.g.,
+//
+//	GET /01DHNMWXM02YP82GZKN3DPRVR8?status=red&status=yellow&tag=db&offset=0&limit=50
+//
+// The supported query params are - see `health.Query`:
+//   - status - Green, Yellow, or Red (case insensitive) - multiple statuses can be specified
+//   - tag - multiple tags can be specified, i.e., the health check must have all of the tags
+//   - id - multiple IDs can be specified
+//   - id_prefix
+//   - offset, limit - the total number of matching results is returned via the X-Total-Count response header
+const HealthCheckResultsEndpoint = "01DHNMWXM02YP82GZKN3DPRVR8"
+
+// RunHealthCheckEndpoint is used to construct the HTTP endpoint that runs a health check on demand, i.e., outside of its
+// schedule, and returns the result. It is designed to be used to verify that a health check has recovered after fixing
+// a dependency without waiting for the next scheduled run.
+//
+// The health check is run via a POST request, where the health check ID is specified by the "id" query param, e.g.,
+//
+//	POST /01DHQPT9M06QXQV8XJFDXZZNBZ?id=01DHQ1V7ZB4N8T3GJ5X0R2KM6W
+//
+// The result is returned using the same formats as the health check results endpoint. If the health check is not
+// registered, then HTTP status code 404 is returned.
+const RunHealthCheckEndpoint = "01DHQPT9M06QXQV8XJFDXZZNBZ"
+
+// supported health check results media types
+const (
+	JSONMediaType        = "application/json"
+	TextMediaType        = "text/plain"
+	OpenMetricsMediaType = "application/openmetrics-text"
+)
+
+// HealthCheckIDLabel is the health check metric label name used for the health check ID
+const HealthCheckIDLabel = "h"
+
+// TotalCountHeader is the HTTP response header that is used to report the total number of matching items for paginated
+// results
+const TotalCountHeader = "X-Total-Count"
+
+func healthCheckResultsHTTPHandler(checkResults health.CheckResults) HTTPHandler {
+	return NewHTTPHandler(fmt.Sprintf("/%s", HealthCheckResultsEndpoint), func(writer http.ResponseWriter, request *http.Request) {
+		query, err := parseHealthCheckQuery(request.URL.Query())
+		if err != nil {
+			http.Error(writer, err.Error(), http.StatusBadRequest)
+			return
+		}
+		// the total count is reported for the unpaginated query
+		countQuery := query
+		countQuery.Offset, countQuery.Limit = 0, 0
+		writer.Header().Set(TotalCountHeader, strconv.Itoa(len(<-checkResults(nil, countQuery))))
+		writeHealthCheckResults(writer, request, <-checkResults(nil, query))
+	}).WithDoc(OpenAPIOperation{
+		Summary: "health check results",
+		Tags:    []string{BuiltinOpenAPITag},
+		Params: []OpenAPIParam{
+			{Name: "status", Description: "Green, Yellow, or Red - multiple statuses can be specified"},
+			{Name: "tag", Description: "health check tag - multiple tags can be specified"},
+			{Name: "id", Description: "health check ID - multiple IDs can be specified"},
+			{Name: "id_prefix", Description: "health check ID prefix"},
+			{Name: "offset", Description: "the number of matching results to skip"},
+			{Name: "limit", Description: "the max number of results to return"},
+		},
+		Responses: []OpenAPIResponse{
+			{Status: http.StatusOK, MediaTypes: []string{JSONMediaType, TextMediaType, OpenMetricsMediaType}},
+			{Status: http.StatusBadRequest, Description: "invalid query params"},
+			{Status: http.StatusNotAcceptable},
+		},
+	}).AdminOnly()
+}
+
+// parses the health check results endpoint query params - see `HealthCheckResultsEndpoint`
+func parseHealthCheckQuery(values url.Values) (health.Query, error) {
+	query := health.Query{
+		Tags:     values["tag"],
+		IDs:      values["id"],
+		IDPrefix: values.Get("id_prefix"),
+		// the results are sorted by ID before they are paginated
+		SortByID: true,
+	}
+	for _, s := range values["status"] {
+		status, err := health.ParseStatus(s)
+		if err != nil {
+			return query, err
+		}
+		query.Statuses = append(query.Statuses, status)
+	}
+	parseCount := func(name string) (int, error) {
+		value := values.Get(name)
+		if value == "" {
+			return 0, nil
+		}
+		n, err := strconv.Atoi(value)
+		if err != nil || n < 0 {
+			return 0, fmt.Errorf("%q query param must be a non-negative integer : %q", name, value)
+		}
+		return n, nil
+	}
+	var err error
+	if query.Offset, err = parseCount("offset"); err != nil {
+		return query, err
+	}
+	query.Limit, err = parseCount("limit")
+	return query, err
+}
+
+func runHealthCheckHTTPHandler(runCheckNow health.RunCheckNow) HTTPHandler {
+	return NewHTTPRoute(http.MethodPost, fmt.Sprintf("/%s", RunHealthCheckEndpoint), func(writer http.ResponseWriter, request *http.Request) {
+		id := request.URL.Query().Get("id")
+		if strings.TrimSpace(id) == "" {
+			http.Error(writer, "health check ID must be specified via the 'id' query param", http.StatusBadRequest)
+			return
+		}
+		result, err := runCheckNow(id)
+		switch {
+		case err == nil:
+			writeHealthCheckResults(writer, request, []health.Result{result})
+		case errors.Is(err, health.ErrCheckNotRegistered):
+			http.Error(writer, err.Error(), http.StatusNotFound)
+		default:
+			http.Error(writer, err.Error(), http.StatusServiceUnavailable)
+		}
+	}).WithDoc(OpenAPIOperation{
+		Summary: "runs a health check on demand",
+		Tags:    []string{BuiltinOpenAPITag},
+		Params:  []OpenAPIParam{{Name: "id", Description: "health check ID", Required: true}},
+		Responses: []OpenAPIResponse{
+			{Status: http.StatusOK, MediaTypes: []string{JSONMediaType, TextMediaType, OpenMetricsMediaType}},
+			{Status: http.StatusBadRequest, Description: "health check ID is not specified"},
+			{Status: http.StatusNotFound, Description: "health check is not registered"},
+		},
+	}).AdminOnly()
+}
+
+// writes the results using the media type that is negotiated via the request Accept header
+func writeHealthCheckResults(writer http.ResponseWriter, request *http.Request, results []health.Result) {
+	var body []byte
+	var err error
+	mediaType := negotiateMediaType(request.Header.Get("Accept"), JSONMediaType, TextMediaType, OpenMetricsMediaType)
+	switch mediaType {
+	case "":
+		http.Error(writer, fmt.Sprintf("supported media types are: %s, %s, %s", JSONMediaType, TextMediaType, OpenMetricsMediaType), http.StatusNotAcceptable)
+		return
+	case TextMediaType:
+		body = healthCheckResultsText(results)
+	case OpenMetricsMediaType:
+		body = healthCheckResultsOpenMetrics(results)
+		mediaType += "; version=0.0.1; charset=utf-8"
+	default:
+		body, err = healthCheckResultsJSON(results)
+	}
+	if err != nil {
+		http.Error(writer, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	writer.Header().Set("Content-Type", mediaType)
+	writer.Write(body)
+}
+
+// returns the first supported media type that is accepted, in the order listed in the Accept header.
+// If the Accept header is blank or accepts any media type, then the first supported media type is returned.
+// If none of the supported media types are accepted, then a blank string is returned.
+func negotiateMediaType(accept string, supported ...string) string {
+	if strings.TrimSpace(accept) == "" {
+		return supported[0]
+	}
+	for _, mediaRange := range strings.Split(accept, ",") {
+		mediaType, _, err := mime.ParseMediaType(mediaRange)
+		if err != nil {
+			continue
+		}
+		for _, s := range supported {
+			switch {
+			case mediaType == s:
+				return s
+			case mediaType == "*/*":
+				return supported[0]
+			case strings.HasSuffix(mediaType, "/*") && strings.HasPrefix(s, strings.TrimSuffix(mediaType, "*")):
+				return s
+			}
+		}
+	}
+	return ""
+}
+
+func healthCheckResultsJSON(results []health.Result) ([]byte, error) {
+	type subResult struct {
+		Name     string `json:"name"`
+		Status   string `json:"status"`
+		Duration string `json:"duration"`
+		Err      string `json:"error,omitempty"`
+	}
+	type result struct {
+		ID         string                 `json:"id"`
+		Status     string                 `json:"status"`
+		Time       time.Time              `json:"time"`
+		Duration   string                 `json:"duration"`
+		Err        string                 `json:"error,omitempty"`
+		SubResults []subResult            `json:"sub_results,omitempty"`
+		Details    map[string]interface{} `json:"details,omitempty"`
+	}
+	jsonResults := make([]result, 0, len(results))
+	for _, r := range results {
+		jsonResult := result{
+			ID:       r.ID,
+			Status:   r.Status.String(),
+			Time:     r.Time,
+			Duration: r.Duration.String(),
+			Details:  healthCheckResultDetailsJSON(r.Details),
+		}
+		if r.Err != nil {
+			jsonResult.Err = r.Err.Error()
+		}
+		for _, sr := range r.SubResults {
+			jsonSubResult := subResult{
+				Name:     sr.Name,
+				Status:   sr.Status.String(),
+				Duration: sr.Duration.String(),
+			}
+			if sr.Err != nil {
+				jsonSubResult.Err = sr.Err.Error()
+			}
+			jsonResult.SubResults = append(jsonResult.SubResults, jsonSubResult)
+		}
+		jsonResults = append(jsonResults, jsonResult)
+	}
+	return json.Marshal(jsonResults)
+}
+
+// durations and errors are formatted as strings, which is consistent with the result duration and error
+func healthCheckResultDetailsJSON(details map[string]interface{}) map[string]interface{} {
+	if len(details) == 0 {
+		return nil
+	}
+	jsonDetails := make(map[string]interface{}, len(details))
+	for k, v := range details {
+		switch v := v.(type) {
+		case time.Duration:
+			jsonDetails[k] = v.String()
+		case error:
+			jsonDetails[k] = v.Error()
+		default:
+			jsonDetails[k] = v
+		}
+	}
+	return jsonDetails
+}
+
+func healthCheckResultsText(results []health.Result) []byte {
+	buf := new(bytes.Buffer)
+	for _, r := range results {
+		fmt.Fprintf(buf, "%s\t%s\t%s", r.ID, r.Status, r.Duration)
+		if r.Err != nil {
+			// keep each result on a single line
+			fmt.Fprintf(buf, "\t%s", strings.Replace(r.Err.Error(), "\n", " ", -1))
+		}
+		buf.WriteString("\n")
+	}
+	return buf.Bytes()
+}
+
+// health check statuses are exposed using the same metric name and labels as the health check gauges
+func healthCheckResultsOpenMetrics(results []health.Result) []byte {
+	buf := new(bytes.Buffer)
+	fmt.Fprintf(buf, "# TYPE %s gauge\n", HealthCheckMetricID)
+	fmt.Fprintf(buf, "# HELP %s health check status: 0=Green, 1=Yellow, 2=Red\n", HealthCheckMetricID)
+	for _, r := range results {
+		fmt.Fprintf(buf, "%s{%s=%q} %d\n", HealthCheckMetricID, HealthCheckIDLabel, r.ID, r.Status)
+	}
+	buf.WriteString("# EOF\n")
+	return buf.Bytes()
+}
@@ -0,0 +1,338 @@
+/*
+ * Copyright (c) 2019 OysterPack, Inc.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ * http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package fxapp_test
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"github.com/oysterpack/andiamo/pkg/fx/health"
+	"github.com/oysterpack/andiamo/pkg/fxapp"
+	"github.com/oysterpack/andiamo/pkg/fxapptest"
+	"github.com/oysterpack/andiamo/pkg/ulids"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"io/ioutil"
+	"net/http"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestHealthCheckResultsEndpoint(t *testing.T) {
+	const (
+		GreenCheckID = "01DHNQ8Z7F2H3GNRBJ1X6W5E4A"
+		RedCheckID   = "01DHNQ9CXMB8Q2SRTK4Y8B7V3D"
+	)
+
+	var register health.Register
+	var subscribe health.SubscribeForCheckResults
+	app, err := fxapp.NewBuilder(fxapp.ID(ulids.MustNew()), fxapp.ReleaseID(ulids.MustNew())).
+		Invoke(func(register health.Register) error {
+			return register(health.Check{ID: GreenCheckID, Description: "green", RedImpact: "none"}, health.CheckerOpts{}, func(ctx context.Context) (health.Status, error) {
+				return health.Green, nil
+			})
+		}).
+		Populate(&register, &subscribe).
+		AllowUnauthenticatedAdmin().
+		Build()
+	require.NoError(t, err)
+
+	go app.Run()
+	<-app.Ready()
+	defer func() {
+		app.Shutdown()
+		<-app.Done()
+	}()
+
+	// the Red health check is registered after the app is ready, otherwise the app would fail to start
+	redResults := subscribe(func(result health.Result) bool { return result.ID == RedCheckID })
+	require.NoError(t, register(health.Check{ID: RedCheckID, Description: "red", RedImpact: "none"}, health.CheckerOpts{}, func(ctx context.Context) (health.Status, error) {
+		return health.Red, errors.New("BOOM")
+	}))
+	<-redResults.Chan()
+	redResults.Close()
+
+	get := func(accept string) *http.Response {
+		request, err := http.NewRequest(http.MethodGet, fmt.Sprintf("http://:8008/%s", fxapp.HealthCheckResultsEndpoint), nil)
+		require.NoError(t, err)
+		if accept != "" {
+			request.Header.Set("Accept", accept)
+		}
+		response, err := http.DefaultClient.Do(request)
+		require.NoError(t, err)
+		return response
+	}
+
+	readBody := func(response *http.Response) string {
+		defer response.Body.Close()
+		body, err := ioutil.ReadAll(response.Body)
+		require.NoError(t, err)
+		t.Log(string(body))
+		return string(body)
+	}
+
+	t.Run("JSON is the default", func(t *testing.T) {
+		for _, accept := range []string{"", "*/*", fxapp.JSONMediaType} {
+			response := get(accept)
+			require.Equal(t, http.StatusOK, response.StatusCode)
+			assert.Equal(t, fxapp.JSONMediaType, response.Header.Get("Content-Type"))
+			var results []struct {
+				ID     string
+				Status string
+				Error  string
+			}
+			require.NoError(t, json.Unmarshal([]byte(readBody(response)), &results))
+			require.Len(t, results, 2)
+			assert.Equal(t, GreenCheckID, results[0].ID)
+			assert.Equal(t, "Green", results[0].Status)
+			assert.Equal(t, RedCheckID, results[1].ID)
+			assert.Equal(t, "Red", results[1].Status)
+			assert.Contains(t, results[1].Error, "BOOM")
+		}
+	})
+
+	t.Run("text", func(t *testing.T) {
+		response := get("text/plain, application/json;q=0.9")
+		require.Equal(t, http.StatusOK, response.StatusCode)
+		assert.Equal(t, fxapp.TextMediaType, response.Header.Get("Content-Type"))
+		lines := strings.Split(strings.TrimSpace(readBody(response)), "\n")
+		require.Len(t, lines, 2)
+		assert.True(t, strings.HasPrefix(lines[0], GreenCheckID+"\tGreen\t"))
+		assert.True(t, strings.HasPrefix(lines[1], RedCheckID+"\tRed\t"))
+		assert.Contains(t, lines[1], "BOOM")
+	})
+
+	t.Run("OpenMetrics", func(t *testing.T) {
+		response := get(fxapp.OpenMetricsMediaType)
+		require.Equal(t, http.StatusOK, response.StatusCode)
+		assert.Contains(t, response.Header.Get("Content-Type"), fxapp.OpenMetricsMediaType)
+		body := readBody(response)
+		assert.Contains(t, body, fmt.Sprintf("%s{%s=%q} 0\n", fxapp.HealthCheckMetricID, fxapp.HealthCheckIDLabel, GreenCheckID))
+		assert.Contains(t, body, fmt.Sprintf("%s{%s=%q} 2\n", fxapp.HealthCheckMetricID, fxapp.HealthCheckIDLabel, RedCheckID))
+		assert.True(t, strings.HasSuffix(body, "# EOF\n"))
+	})
+
+	t.Run("unsupported media type", func(t *testing.T) {
+		response := get("application/xml")
+		assert.Equal(t, http.StatusNotAcceptable, response.StatusCode)
+	})
+}
+
+func TestRunHealthCheckEndpoint(t *testing.T) {
+	const FooCheckID = "01DHQPZ3K8V1R6TQ2MWX9B4NJE"
+
+	var register health.Register
+	var subscribe health.SubscribeForCheckResults
+	app, err := fxapp.NewBuilder(fxapp.ID(ulids.MustNew()), fxapp.ReleaseID(ulids.MustNew())).
+		Invoke(func() {}).
+		Populate(&register, &subscribe).
+		AllowUnauthenticatedAdmin().
+		Build()
+	require.NoError(t, err)
+
+	go app.Run()
+	<-app.Ready()
+	defer func() {
+		app.Shutdown()
+		<-app.Done()
+	}()
+
+	// the Red health check is registered after the app is ready, otherwise the app would fail to start
+	var fixed int32
+	fooResults := subscribe(func(result health.Result) bool { return result.ID == FooCheckID })
+	require.NoError(t, register(health.Check{ID: FooCheckID, Description: "foo", RedImpact: "none"}, health.CheckerOpts{RunInterval: time.Hour}, func(ctx context.Context) (health.Status, error) {
+		if atomic.LoadInt32(&fixed) == 1 {
+			return health.Green, nil
+		}
+		return health.Red, errors.New("BOOM")
+	}))
+	<-fooResults.Chan()
+	fooResults.Close()
+
+	runCheck := func(method, id string) *http.Response {
+		request, err := http.NewRequest(method, fmt.Sprintf("http://:8008/%s?id=%s", fxapp.RunHealthCheckEndpoint, id), nil)
+		require.NoError(t, err)
+		response, err := http.DefaultClient.Do(request)
+		require.NoError(t, err)
+		return response
+	}
+
+	t.Run("run health check after it is fixed", func(t *testing.T) {
+		atomic.StoreInt32(&fixed, 1)
+		response := runCheck(http.MethodPost, FooCheckID)
+		defer response.Body.Close()
+		require.Equal(t, http.StatusOK, response.StatusCode)
+		assert.Equal(t, fxapp.JSONMediaType, response.Header.Get("Content-Type"))
+		var results []struct {
+			ID     string
+			Status string
+		}
+		require.NoError(t, json.NewDecoder(response.Body).Decode(&results))
+		require.Len(t, results, 1)
+		assert.Equal(t, FooCheckID, results[0].ID)
+		assert.Equal(t, "Green", results[0].Status)
+	})
+
+	t.Run("health check not registered", func(t *testing.T) {
+		response := runCheck(http.MethodPost, ulids.MustNew().String())
+		response.Body.Close()
+		assert.Equal(t, http.StatusNotFound, response.StatusCode)
+	})
+
+	t.Run("health check ID not specified", func(t *testing.T) {
+		response := runCheck(http.MethodPost, "")
+		response.Body.Close()
+		assert.Equal(t, http.StatusBadRequest, response.StatusCode)
+	})
+
+	t.Run("GET is not allowed", func(t *testing.T) {
+		response := runCheck(http.MethodGet, FooCheckID)
+		response.Body.Close()
+		assert.Equal(t, http.StatusMethodNotAllowed, response.StatusCode)
+	})
+}
+
+func TestHealthCheckResultsEndpoint_Query(t *testing.T) {
+	t.Parallel()
+
+	// health check IDs and tags must be ULIDs
+	prefix := ulids.MustNew().String()[:20]
+	DB1, DB2, Cache := prefix+"000001", prefix+"000002", prefix+"000003"
+	DBTag, PrimaryTag, CacheTag := ulids.MustNew().String(), ulids.MustNew().String(), ulids.MustNew().String()
+	checks := []struct {
+		id     string
+		tags   []string
+		status health.Status
+	}{
+		{DB1, []string{DBTag}, health.Green},
+		{DB2, []string{DBTag, PrimaryTag}, health.Yellow},
+		{Cache, []string{CacheTag}, health.Yellow},
+		{ulids.MustNew().String(), nil, health.Green},
+	}
+	// the health checks are Green until the app is started, otherwise the app would fail to start
+	var started int32
+	var runCheckNow health.RunCheckNow
+	builder := fxapp.NewBuilder(fxapp.ID(ulids.MustNew()), fxapp.ReleaseID(ulids.MustNew())).
+		Invoke(func(register health.Register) error {
+			for _, check := range checks {
+				status := check.status
+				if err := register(health.Check{ID: check.id, Description: check.id, RedImpact: "none", Tags: check.tags}, health.CheckerOpts{RunInterval: time.Hour}, func(ctx context.Context) (health.Status, error) {
+					if atomic.LoadInt32(&started) == 0 {
+						return health.Green, nil
+					}
+					return status, nil
+				}); err != nil {
+					return err
+				}
+			}
+			return nil
+		}).
+		Populate(&runCheckNow).
+		LogWriter(ioutil.Discard)
+
+	fxapptest.RunApp(t, builder, func(app fxapp.App, client *fxapptest.HTTPClient) {
+		atomic.StoreInt32(&started, 1)
+		for _, check := range checks {
+			_, err := runCheckNow(check.id)
+			require.NoError(t, err)
+		}
+
+		query := func(params string) (*http.Response, []string) {
+			response, err := client.Get(fxapp.HealthCheckResultsEndpoint + "?" + params)
+			require.NoError(t, err)
+			defer response.Body.Close()
+			if response.StatusCode != http.StatusOK {
+				return response, nil
+			}
+			var results []struct{ ID string }
+			require.NoError(t, json.NewDecoder(response.Body).Decode(&results))
+			ids := make([]string, 0, len(results))
+			for _, result := range results {
+				ids = append(ids, result.ID)
+			}
+			return response, ids
+		}
+
+		tests := []struct {
+			params string
+			total  string
+			ids    []string
+		}{
+			{"id_prefix=" + prefix, "3", []string{DB1, DB2, Cache}},
+			{"id_prefix=" + prefix + "&status=yellow", "2", []string{DB2, Cache}},
+			{"status=Yellow&tag=" + DBTag, "1", []string{DB2}},
+			{"tag=" + DBTag + "&tag=" + PrimaryTag, "1", []string{DB2}},
+			{"id=" + Cache + "&id=" + DB1, "2", []string{DB1, Cache}},
+			{"id_prefix=" + prefix + "&offset=1&limit=1", "3", []string{DB2}},
+			{"id_prefix=" + prefix + "&offset=10", "3", []string{}},
+		}
+		for _, test := range tests {
+			response, ids := query(test.params)
+			require.Equal(t, http.StatusOK, response.StatusCode, test.params)
+			assert.Equal(t, test.total, response.Header.Get(fxapp.TotalCountHeader), test.params)
+			assert.Equal(t, test.ids, ids, test.params)
+		}
+
+		for _, params := range []string{"status=blue", "limit=-1", "offset=x"} {
+			response, _ := query(params)
+			assert.Equal(t, http.StatusBadRequest, response.StatusCode, params)
+		}
+	})
+}
+
+func TestHealthCheckResult_Details(t *testing.T) {
+	t.Parallel()
+
+	CheckID := ulids.MustNew().String()
+	logs := fxapptest.NewLogCapture()
+	builder := fxapp.NewBuilder(fxapp.ID(ulids.MustNew()), fxapp.ReleaseID(ulids.MustNew())).
+		Invoke(func(register health.Register) error {
+			return register(health.Check{ID: CheckID, Description: "foo", RedImpact: "none"}, health.CheckerOpts{RunInterval: time.Hour}, func(ctx context.Context) (health.Status, error) {
+				health.SetDetail(ctx, health.DetailEndpoint, "https://api.example.com")
+				health.SetDetail(ctx, health.DetailLatency, 150*time.Millisecond)
+				return health.Green, nil
+			})
+		}).
+		LogWriter(logs)
+
+	fxapptest.RunApp(t, builder, func(app fxapp.App, client *fxapptest.HTTPClient) {
+		// the details are logged with the health check result event
+		fxapptest.AssertEventLogged(t, logs, fxapp.HealthCheckResultEvent,
+			fxapptest.Field("d.id", CheckID),
+			fxapptest.Field("d.details.endpoint", "https://api.example.com"),
+			fxapptest.FieldExists("d.details.latency"),
+		)
+
+		// the details are returned by the health check results endpoint
+		response, err := client.Get(fxapp.HealthCheckResultsEndpoint + "?id=" + CheckID)
+		require.NoError(t, err)
+		defer response.Body.Close()
+		var results []struct {
+			ID      string
+			Details map[string]interface{}
+		}
+		require.NoError(t, json.NewDecoder(response.Body).Decode(&results))
+		require.Len(t, results, 1)
+		assert.Equal(t, map[string]interface{}{
+			health.DetailEndpoint: "https://api.example.com",
+			health.DetailLatency:  "150ms",
+		}, results[0].Details)
+	})
+}
@@ -18,14 +18,15 @@ package fxapp
 
 import (
 	"bufio"
+	"bytes"
+	"context"
 	"encoding/json"
 	"errors"
+	"github.com/oysterpack/andiamo/pkg/clock"
 	"github.com/oysterpack/andiamo/pkg/fx/health"
-	"github.com/oysterpack/andiamo/pkg/fxapptest"
 	"github.com/oysterpack/andiamo/pkg/ulids"
 	"github.com/rs/zerolog"
 	"go.uber.org/fx"
-	"runtime"
 	"sync"
 	"testing"
 	"time"
@@ -41,11 +42,14 @@ func TestLogYellowHealthCheckResult(t *testing.T) {
 		RedImpact:    "app is unavailable",
 	}
 
+	// the health check duration is measured using the fake clock, i.e., the checker advances the time instead of sleeping
+	fakeClock := clock.NewFake(time.Date(2019, time.September, 1, 0, 0, 0, 0, time.UTC))
 	var shutdowner fx.Shutdowner
 	var subscription health.CheckResultsSubscription
 	var healthCheckResults health.CheckResults
 	app := fx.New(
 		health.Module(health.DefaultOpts()),
+		fx.Provide(func() clock.Clock { return fakeClock }),
 		fx.Invoke(
 			func(subscribe health.SubscribeForCheckResults) {
 				subscription = subscribe(func(result health.Result) bool {
@@ -53,8 +57,8 @@ func TestLogYellowHealthCheckResult(t *testing.T) {
 				})
 			},
 			func(register health.Register) error {
-				return register(FooHealth, health.CheckerOpts{}, func() (health.Status, error) {
-					time.Sleep(time.Millisecond)
+				return register(FooHealth, health.CheckerOpts{}, func(ctx context.Context) (health.Status, error) {
+					fakeClock.Advance(time.Millisecond)
 					return health.Yellow, errors.New("warning")
 				})
 			}),
@@ -66,7 +70,7 @@ func TestLogYellowHealthCheckResult(t *testing.T) {
 		shutdowner.Shutdown()
 	}()
 
-	buf := fxapptest.NewSyncLog()
+	buf := newSyncLog()
 	logger := zerolog.New(zerolog.SyncWriter(buf))
 	done := make(chan struct{})
 	defer close(done)
@@ -82,7 +86,7 @@ func TestLogYellowHealthCheckResult(t *testing.T) {
 	}()
 	wg.Wait()
 
-	t.Log(<-healthCheckResults(nil))
+	t.Log(<-healthCheckResults(nil, health.Query{}))
 
 	type Data struct {
 		ID     string
@@ -119,8 +123,12 @@ FoundEvent:
 				break FoundEvent
 			}
 		}
-		time.Sleep(time.Millisecond)
-		runtime.Gosched()
+		// wait for the next log event to be written
+		select {
+		case <-buf.written:
+		case <-time.After(5 * time.Second):
+			t.Fatal("*** timed out waiting for the health check result to be logged")
+		}
 	}
 
 	switch {
@@ -160,11 +168,14 @@ func TestLogRedHealthCheckResult(t *testing.T) {
 		RedImpact:    "app is unavailable",
 	}
 
+	// the health check duration is measured using the fake clock, i.e., the checker advances the time instead of sleeping
+	fakeClock := clock.NewFake(time.Date(2019, time.September, 1, 0, 0, 0, 0, time.UTC))
 	var shutdowner fx.Shutdowner
 	var subscription health.CheckResultsSubscription
 	var healthCheckResults health.CheckResults
 	app := fx.New(
 		health.Module(health.DefaultOpts()),
+		fx.Provide(func() clock.Clock { return fakeClock }),
 		fx.Invoke(
 			func(subscribe health.SubscribeForCheckResults) {
 				subscription = subscribe(func(result health.Result) bool {
@@ -172,8 +183,8 @@ func TestLogRedHealthCheckResult(t *testing.T) {
 				})
 			},
 			func(register health.Register) error {
-				return register(FooHealth, health.CheckerOpts{}, func() (health.Status, error) {
-					time.Sleep(time.Millisecond)
+				return register(FooHealth, health.CheckerOpts{}, func(ctx context.Context) (health.Status, error) {
+					fakeClock.Advance(time.Millisecond)
 					return health.Red, errors.New("error")
 				})
 			}),
@@ -185,7 +196,7 @@ func TestLogRedHealthCheckResult(t *testing.T) {
 		shutdowner.Shutdown()
 	}()
 
-	buf := fxapptest.NewSyncLog()
+	buf := newSyncLog()
 	logger := zerolog.New(zerolog.SyncWriter(buf))
 	done := make(chan struct{})
 	defer close(done)
@@ -202,7 +213,7 @@ func TestLogRedHealthCheckResult(t *testing.T) {
 	wg.Wait()
 
 	// When the health check is registered, it is run
-	t.Log(<-healthCheckResults(nil))
+	t.Log(<-healthCheckResults(nil, health.Query{}))
 
 	type Data struct {
 		ID     string
@@ -239,8 +250,12 @@ FoundEvent:
 				break FoundEvent
 			}
 		}
-		time.Sleep(time.Millisecond)
-		runtime.Gosched()
+		// wait for the next log event to be written
+		select {
+		case <-buf.written:
+		case <-time.After(5 * time.Second):
+			t.Fatal("*** timed out waiting for the health check result to be logged")
+		}
 	}
 
 	switch {
@@ -269,3 +284,56 @@ FoundEvent:
 		t.Error("*** health check registration event was not logged")
 	}
 }
+
+func TestDurationHistory(t *testing.T) {
+	t.Parallel()
+
+	history := &durationHistory{}
+	for i := 1; i <= 100; i++ {
+		history.add(time.Duration(i) * time.Millisecond)
+	}
+	// only the most recent durations are retained
+	if len(history.durations) != healthCheckDurationHistorySize {
+		t.Errorf("*** history size should be capped: %d", len(history.durations))
+	}
+	percentiles := history.percentiles(0, 0.5, 1)
+	expected := []time.Duration{69 * time.Millisecond, 84 * time.Millisecond, 100 * time.Millisecond}
+	for i := range expected {
+		if percentiles[i] != expected[i] {
+			t.Errorf("*** percentiles did not match: %v != %v", percentiles, expected)
+			break
+		}
+	}
+}
+
+// syncLog is a concurrency safe read/write log.
+//
+// NOTE: fxapptest.SyncLog cannot be used by internal tests because fxapptest imports fxapp
+type syncLog struct {
+	sync.Mutex
+	buf bytes.Buffer
+	// signaled when data is written
+	written chan struct{}
+}
+
+func newSyncLog() *syncLog {
+	return &syncLog{written: make(chan struct{}, 1)}
+}
+
+func (l *syncLog) Write(data []byte) (int, error) {
+	l.Lock()
+	defer l.Unlock()
+	defer func() {
+		select {
+		case l.written <- struct{}{}:
+		default:
+		}
+	}()
+	return l.buf.Write(data)
+}
+
+func (l *syncLog) Read(p []byte) (int, error) {
+	l.Lock()
+	defer l.Unlock()
+	return l.buf.Read(p)
+}
@@ -17,15 +17,15 @@
 package fxapp_test
 
 import (
-	"bufio"
+	"context"
 	"encoding/json"
+	"github.com/oysterpack/andiamo/pkg/clock"
 	"github.com/oysterpack/andiamo/pkg/fx/health"
 	"github.com/oysterpack/andiamo/pkg/fxapp"
 	"github.com/oysterpack/andiamo/pkg/fxapptest"
 	"github.com/oysterpack/andiamo/pkg/ulids"
 	"github.com/pkg/errors"
 	"github.com/rs/zerolog"
-	"strings"
 	"testing"
 	"time"
 )
@@ -41,7 +41,7 @@ func TestAppHealthCheckRegistry(t *testing.T) {
 				ID:          ulids.MustNew().String(),
 				Description: "Foo",
 				RedImpact:   "Red",
-			}, health.CheckerOpts{}, func() (health.Status, error) {
+			}, health.CheckerOpts{}, func(ctx context.Context) (health.Status, error) {
 				return health.Green, nil
 			})
 		}).
@@ -55,7 +55,7 @@ func TestAppHealthCheckRegistry(t *testing.T) {
 
 	// health checks are scheduled to run as they are registered
 
-	healthChecks := <-registeredChecks()
+	healthChecks := <-registeredChecks(health.Query{})
 	if len(healthChecks) == 0 {
 		t.Error("*** health check registry is empty")
 		return
@@ -80,12 +80,12 @@ func TestRegisteredHealthChecksAreLogged(t *testing.T) {
 	}
 
 	var healthCheckRegistered <-chan health.RegisteredCheck
-	buf := fxapptest.NewSyncLog()
+	logs := fxapptest.NewLogCapture()
 	_, err := fxapp.NewBuilder(fxapp.ID(ulids.MustNew()), fxapp.ReleaseID(ulids.MustNew())).
-		LogWriter(buf).
+		LogWriter(logs).
 		Invoke(func(register health.Register, subscribe health.SubscribeForRegisteredChecks) error {
 			healthCheckRegistered = subscribe().Chan()
-			return register(Foo, health.CheckerOpts{}, func() (health.Status, error) {
+			return register(Foo, health.CheckerOpts{}, func(ctx context.Context) (health.Status, error) {
 				return health.Green, nil
 			})
 		}).
@@ -109,29 +109,17 @@ func TestRegisteredHealthChecksAreLogged(t *testing.T) {
 	}
 
 	type LogEvent struct {
-		Name    string `json:"n"`
-		Message string `json:"m"`
-		Data    Data   `json:"d"`
+		Name    string
+		Message string
+		Data    Data
 	}
 	var logEvent LogEvent
 
-FoundEvent:
-	for i := 0; i < 3; i++ {
-		for _, line := range strings.Split(buf.String(), "\n") {
-			if line == "" {
-				break
-			}
-			t.Log(line)
-			err := json.Unmarshal([]byte(line), &logEvent)
-			if err != nil {
-				t.Errorf("*** failed to parse log event: %v : %v", err, line)
-				break
-			}
-			if logEvent.Name == "01DF3FV60A2J1WKX5NQHP47H61" {
-				break FoundEvent
-			}
+	if event, err := logs.WaitForEvent("01DF3FV60A2J1WKX5NQHP47H61", 5*time.Second); err == nil {
+		logEvent = LogEvent{Name: event.Name, Message: event.Message}
+		if err := json.Unmarshal(event.Data, &logEvent.Data); err != nil {
+			t.Errorf("*** failed to parse log event data: %v : %s", err, event.Data)
 		}
-		time.Sleep(time.Millisecond)
 	}
 
 	switch {
@@ -164,14 +152,17 @@ func TestHealthCheckResultsAreLogged(t *testing.T) {
 		YellowImpact: "Yellow",
 	}
 
-	var healthCheckResults <-chan health.Result
-	buf := fxapptest.NewSyncLog()
+	// the health check duration is measured using the fake clock, i.e., the checker advances the time instead of sleeping
+	fakeClock := clock.NewFake(time.Date(2019, time.September, 1, 0, 0, 0, 0, time.UTC))
+	var healthCheckResults health.CheckResultsSubscription
+	logs := fxapptest.NewLogCapture()
 	app, err := fxapp.NewBuilder(fxapp.ID(ulids.MustNew()), fxapp.ReleaseID(ulids.MustNew())).
-		LogWriter(buf).
+		LogWriter(logs).
+		SetClock(fakeClock).
 		Invoke(func(register health.Register, subscribe health.SubscribeForCheckResults) error {
-			healthCheckResults = subscribe(nil).Chan()
-			return register(Foo, health.CheckerOpts{}, func() (health.Status, error) {
-				time.Sleep(time.Millisecond)
+			healthCheckResults = subscribe(nil)
+			return register(Foo, health.CheckerOpts{}, func(ctx context.Context) (health.Status, error) {
+				fakeClock.Advance(time.Millisecond)
 				return health.Green, nil
 			})
 		}).
@@ -189,7 +180,9 @@ func TestHealthCheckResultsAreLogged(t *testing.T) {
 	}()
 	<-app.Ready()
 
-	t.Log(<-healthCheckResults)
+	t.Log(<-healthCheckResults.Chan())
+	// unsubscribe, otherwise the health service would wait for the buffered results to be received on shutdown
+	healthCheckResults.Close()
 
 	type Data struct {
 		ID     string
@@ -199,31 +192,17 @@ func TestHealthCheckResultsAreLogged(t *testing.T) {
 	}
 
 	type LogEvent struct {
-		Name    string `json:"n"`
-		Message string `json:"m"`
-		Data    Data   `json:"d"`
+		Name    string
+		Message string
+		Data    Data
 	}
 	var logEvent LogEvent
 
-FoundEvent:
-	for i := 0; i < 3; i++ {
-		reader := bufio.NewReader(buf)
-		for {
-			line, err := reader.ReadString('\n')
-			if err != nil {
-				break
-			}
-			t.Log(line)
-			err = json.Unmarshal([]byte(line), &logEvent)
-			if err != nil {
-				t.Errorf("*** failed to parse log event: %v : %v", err, line)
-				break
-			}
-			if logEvent.Name == "01DF3X60Z7XFYVVXGE9TFFQ7Z1" {
-				break FoundEvent
-			}
+	if event, err := logs.WaitForEvent("01DF3X60Z7XFYVVXGE9TFFQ7Z1", 5*time.Second); err == nil {
+		logEvent = LogEvent{Name: event.Name, Message: event.Message}
+		if err := json.Unmarshal(event.Data, &logEvent.Data); err != nil {
+			t.Errorf("*** failed to parse log event data: %v : %s", err, event.Data)
 		}
-		time.Sleep(time.Millisecond)
 	}
 
 	switch {
@@ -238,8 +217,8 @@ FoundEvent:
 		if logEvent.Data.Start == 0 {
 			t.Error("*** start should be set")
 		}
-		if logEvent.Data.Dur == 0 {
-			t.Error("*** duration should be set")
+		if logEvent.Data.Dur != 1 {
+			t.Errorf("*** duration should be 1 msec: %v", logEvent.Data.Dur)
 		}
 
 	default:
@@ -257,11 +236,10 @@ func TestHealthCheckFailureCausesAppStartupFailure(t *testing.T) {
 		YellowImpact: "Yellow",
 	}
 
-	buf := fxapptest.NewSyncLog()
 	app, err := fxapp.NewBuilder(fxapp.ID(ulids.MustNew()), fxapp.ReleaseID(ulids.MustNew())).
-		LogWriter(buf).
+		LogWriter(fxapptest.NewSyncLog()).
 		Invoke(func(register health.Register) error {
-			return register(Foo, health.CheckerOpts{}, func() (health.Status, error) {
+			return register(Foo, health.CheckerOpts{}, func(ctx context.Context) (health.Status, error) {
 				return health.Red, errors.New("BOOM!!!")
 			})
 		}).
@@ -272,8 +250,6 @@ func TestHealthCheckFailureCausesAppStartupFailure(t *testing.T) {
 		t.Errorf("*** failed to build app: %v", err)
 	}
 
-	time.Sleep(time.Millisecond)
-
 	err = app.Run()
 	if err == nil {
 		t.Error("*** app should have failed to startup because of health check failure")
@@ -0,0 +1,138 @@
+/*
+ * Copyright (c) 2019 OysterPack, Inc.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ * http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package fxapp
+
+import (
+	"errors"
+	"github.com/oysterpack/andiamo/pkg/eventlog"
+	"github.com/oysterpack/andiamo/pkg/fx/health"
+	"github.com/rs/zerolog"
+	"sort"
+	"time"
+)
+
+// DefaultSlowHealthCheckThreshold is the default percentage of the health check timeout that a health check run duration
+// must exceed to be considered slow. Slow health checks are logged as warnings because they are at risk of timing out,
+// i.e., flapping between Red and Green. The threshold is configurable - see `Builder.SetSlowHealthCheckThreshold()`.
+const DefaultSlowHealthCheckThreshold = 0.8
+
+// ErrInvalidSlowHealthCheckThreshold indicates the slow health check threshold is not greater than 0 or exceeds 1
+var ErrInvalidSlowHealthCheckThreshold = errors.New("slow health check threshold must be greater than 0 and must not exceed 1")
+
+// slowHealthCheckThreshold is the slow health check threshold that is configured via the builder
+type slowHealthCheckThreshold float64
+
+// number of recent run durations that are tracked per health check, which are used to compute the duration percentiles
+const healthCheckDurationHistorySize = 32
+
+// durationHistory is a ring buffer
+type durationHistory struct {
+	durations []time.Duration
+	next      int
+}
+
+func (h *durationHistory) add(d time.Duration) {
+	if len(h.durations) < healthCheckDurationHistorySize {
+		h.durations = append(h.durations, d)
+		return
+	}
+	h.durations[h.next] = d
+	h.next = (h.next + 1) % healthCheckDurationHistorySize
+}
+
+// percentiles uses the nearest rank method
+func (h *durationHistory) percentiles(ps ...float64) []time.Duration {
+	sorted := append([]time.Duration{}, h.durations...)
+	sort.Slice(sorted, func(i, j int) bool { return sorted[i] < sorted[j] })
+	percentiles := make([]time.Duration, len(ps))
+	for i, p := range ps {
+		rank := int(p*float64(len(sorted))+0.5) - 1
+		switch {
+		case rank < 0:
+			rank = 0
+		case rank >= len(sorted):
+			rank = len(sorted) - 1
+		}
+		percentiles[i] = sorted[rank]
+	}
+	return percentiles
+}
+
+type slowHealthCheck struct {
+	health.Result
+	timeout       time.Duration
+	p50, p90, p99 time.Duration
+	samples       int
+}
+
+func (h *slowHealthCheck) MarshalZerologObject(e *zerolog.Event) {
+	e.Str("id", h.ID)
+	e.Dur("dur", h.Duration)
+	e.Dur("timeout", h.timeout)
+	e.Float64("timeout_pct", float64(h.Duration)/float64(h.timeout)*100)
+	e.Dur("p50", h.p50)
+	e.Dur("p90", h.p90)
+	e.Dur("p99", h.p99)
+	e.Int("samples", h.samples)
+}
+
+// tracks the recent health check run durations, and logs a warning when a health check run duration exceeds the
+// slow health check threshold. Timed out runs are tracked, but are not logged as slow because the timeout is already
+// reported as a Red result.
+//
+// The logger runs until the health service closes the subscription on shutdown, i.e., the results of in-flight health
+// checks that complete during shutdown are also tracked.
+func logSlowHealthChecks(subscribe health.SubscribeForCheckResults, registeredChecks health.RegisteredChecks, threshold slowHealthCheckThreshold, logger *zerolog.Logger) {
+	results := subscribe(nil)
+	logSlowHealthCheck := eventlog.NewLogger(HealthCheckSlowEvent, logger, zerolog.WarnLevel)
+
+	timeouts := make(map[string]time.Duration)
+	timeout := func(id string) time.Duration {
+		if t, ok := timeouts[id]; ok {
+			return t
+		}
+		for _, check := range <-registeredChecks(health.Query{}) {
+			timeouts[check.ID] = check.Timeout
+		}
+		return timeouts[id]
+	}
+	histories := make(map[string]*durationHistory)
+
+	go func() {
+		for result := range results.Chan() {
+			history, ok := histories[result.ID]
+			if !ok {
+				history = &durationHistory{}
+				histories[result.ID] = history
+			}
+			history.add(result.Duration)
+
+			checkTimeout := timeout(result.ID)
+			if checkTimeout > 0 && !result.TimedOut() && float64(result.Duration) > float64(checkTimeout)*float64(threshold) {
+				percentiles := history.percentiles(0.5, 0.9, 0.99)
+				logSlowHealthCheck(&slowHealthCheck{
+					Result:  result,
+					timeout: checkTimeout,
+					p50:     percentiles[0],
+					p90:     percentiles[1],
+					p99:     percentiles[2],
+					samples: len(history.durations),
+				}, "health check is slow")
+			}
+		}
+	}()
+}
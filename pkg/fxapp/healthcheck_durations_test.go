@@ -0,0 +1,170 @@
+/*
+ * Copyright (c) 2019 OysterPack, Inc.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ * http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package fxapp_test
+
+import (
+	"context"
+	"encoding/json"
+	"github.com/oysterpack/andiamo/pkg/clock"
+	"github.com/oysterpack/andiamo/pkg/fx/health"
+	"github.com/oysterpack/andiamo/pkg/fxapp"
+	"github.com/oysterpack/andiamo/pkg/fxapptest"
+	"github.com/oysterpack/andiamo/pkg/ulids"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"testing"
+	"time"
+)
+
+func TestSlowHealthChecksAreLogged(t *testing.T) {
+	t.Parallel()
+
+	SlowCheck := health.Check{
+		ID:          ulids.MustNew().String(),
+		Description: "Slow",
+		RedImpact:   "Red",
+	}
+	FastCheck := health.Check{
+		ID:          ulids.MustNew().String(),
+		Description: "Fast",
+		RedImpact:   "Red",
+	}
+	const timeout = 500 * time.Millisecond
+
+	// the health check durations are measured using the fake clock, i.e., the checkers advance the time instead of sleeping
+	fakeClock := clock.NewFake(time.Date(2019, time.September, 1, 0, 0, 0, 0, time.UTC))
+	logs := fxapptest.NewLogCapture()
+	app, err := fxapp.NewBuilder(fxapp.ID(ulids.MustNew()), fxapp.ReleaseID(ulids.MustNew())).
+		Invoke(func(register health.Register) error {
+			// the slow health check run duration is 84% of its timeout
+			if err := register(SlowCheck, health.CheckerOpts{Timeout: timeout}, func(ctx context.Context) (health.Status, error) {
+				fakeClock.Advance(420 * time.Millisecond)
+				return health.Green, nil
+			}); err != nil {
+				return err
+			}
+			return register(FastCheck, health.CheckerOpts{Timeout: timeout}, func(ctx context.Context) (health.Status, error) {
+				return health.Green, nil
+			})
+		}).
+		SetClock(fakeClock).
+		LogWriter(logs).
+		DisableHTTPServer().
+		Build()
+	require.NoError(t, err)
+
+	go app.Run()
+	<-app.Ready()
+	defer func() {
+		app.Shutdown()
+		<-app.Done()
+	}()
+
+	// the slow health check event is logged async
+	logEvent, err := logs.WaitForEvent(fxapp.HealthCheckSlowEvent, 5*time.Second)
+	require.NoError(t, err)
+	t.Log(logEvent)
+
+	type Data struct {
+		ID         string
+		Duration   uint    `json:"dur"`
+		Timeout    uint    `json:"timeout"`
+		TimeoutPct float64 `json:"timeout_pct"`
+		P50        uint
+		Samples    int
+	}
+	var data Data
+	require.NoError(t, json.Unmarshal(logEvent.Data, &data))
+	assert.Equal(t, SlowCheck.ID, data.ID)
+	assert.Equal(t, "warn", logEvent.Level)
+	assert.Equal(t, uint(420), data.Duration)
+	assert.Equal(t, uint(timeout/time.Millisecond), data.Timeout)
+	assert.Equal(t, float64(84), data.TimeoutPct)
+	assert.True(t, data.TimeoutPct > fxapp.DefaultSlowHealthCheckThreshold*100)
+	assert.Equal(t, 1, data.Samples)
+	assert.Equal(t, uint(420), data.P50)
+	fxapptest.AssertEventNotLogged(t, logs, fxapp.HealthCheckSlowEvent, fxapptest.Field("d.id", FastCheck.ID))
+}
+
+func TestBuilder_SetSlowHealthCheckThreshold(t *testing.T) {
+	t.Parallel()
+
+	SlowCheck := health.Check{
+		ID:          ulids.MustNew().String(),
+		Description: "Slow",
+		RedImpact:   "Red",
+	}
+	TimeoutCheck := health.Check{
+		ID:          ulids.MustNew().String(),
+		Description: "Timeout",
+		RedImpact:   "Red",
+	}
+
+	fakeClock := clock.NewFake(time.Date(2019, time.September, 1, 0, 0, 0, 0, time.UTC))
+	logs := fxapptest.NewLogCapture()
+	var register health.Register
+	app, err := fxapp.NewBuilder(fxapp.ID(ulids.MustNew()), fxapp.ReleaseID(ulids.MustNew())).
+		Invoke(func() {}).
+		SetSlowHealthCheckThreshold(0.2).
+		SetClock(fakeClock).
+		Populate(&register).
+		LogWriter(logs).
+		DisableHTTPServer().
+		Build()
+	require.NoError(t, err)
+
+	go app.Run()
+	<-app.Ready()
+	defer func() {
+		app.Shutdown()
+		<-app.Done()
+	}()
+
+	// the health checks are registered after the app is started because Red health checks fail the app start up
+	// the timeout check advances the time to its timeout, and then waits for the timeout
+	require.NoError(t, register(TimeoutCheck, health.CheckerOpts{Timeout: 100 * time.Millisecond}, func(ctx context.Context) (health.Status, error) {
+		fakeClock.Advance(100 * time.Millisecond)
+		<-ctx.Done()
+		return health.Red, ctx.Err()
+	}))
+	_, err = logs.WaitForEvent(fxapp.HealthCheckResultEvent, 5*time.Second, fxapptest.Field("d.id", TimeoutCheck.ID))
+	require.NoError(t, err)
+	// the slow health check run duration is 30% of its timeout
+	require.NoError(t, register(SlowCheck, health.CheckerOpts{Timeout: time.Second}, func(ctx context.Context) (health.Status, error) {
+		fakeClock.Advance(300 * time.Millisecond)
+		return health.Green, nil
+	}))
+
+	// health check results are processed in order, i.e., the timed out result was processed before the slow result
+	_, err = logs.WaitForEvent(fxapp.HealthCheckSlowEvent, 5*time.Second, fxapptest.Field("d.id", SlowCheck.ID))
+	require.NoError(t, err)
+	fxapptest.AssertEventNotLogged(t, logs, fxapp.HealthCheckSlowEvent, fxapptest.Field("d.id", TimeoutCheck.ID))
+}
+
+func TestBuilder_SetSlowHealthCheckThreshold_Invalid(t *testing.T) {
+	t.Parallel()
+
+	for _, threshold := range []float64{0, -0.5, 1.1} {
+		_, err := fxapp.NewBuilder(fxapp.ID(ulids.MustNew()), fxapp.ReleaseID(ulids.MustNew())).
+			Invoke(func() {}).
+			SetSlowHealthCheckThreshold(threshold).
+			DisableHTTPServer().
+			Build()
+		require.Error(t, err)
+		assert.Contains(t, err.Error(), fxapp.ErrInvalidSlowHealthCheckThreshold.Error())
+	}
+}
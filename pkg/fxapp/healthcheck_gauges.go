@@ -19,24 +19,28 @@ package fxapp
 import (
 	"github.com/oysterpack/andiamo/pkg/fx/health"
 	"github.com/prometheus/client_golang/prometheus"
+	"sync"
 )
 
 // HealthCheckMetricID is used as the prometheus metric name
 const HealthCheckMetricID = "U01DF4CVSSF4RT1ZB4EXC44G668"
 
-func registerHealthCheckGauge(done <-chan struct{}, check health.RegisteredCheck, subscribeForCheckResults health.SubscribeForCheckResults, checkResults health.CheckResults, registerer prometheus.Registerer) error {
+func registerHealthCheckGauge(done <-chan struct{}, gauges *sync.WaitGroup, check health.RegisteredCheck, subscribeForCheckResults health.SubscribeForCheckResults, checkResults health.CheckResults, registerer prometheus.Registerer) error {
 	healthCheckResult := subscribeForCheckResults(func(result health.Result) bool {
 		return result.ID == check.ID
 	})
 
 	getResult := make(chan chan health.Result)
+	gauges.Add(1)
 	go func() {
+		defer gauges.Done()
+		defer healthCheckResult.Close()
 		var result health.Result
 
 		// initialize the health check result
 		resultsChan := checkResults(func(result health.Result) bool {
 			return result.ID == check.ID
-		})
+		}, health.Query{})
 		results := <-resultsChan
 		if len(results) == 1 {
 			result = results[0]
@@ -45,11 +49,17 @@ func registerHealthCheckGauge(done <-chan struct{}, check health.RegisteredCheck
 		}
 
 		// event loop
+		latestResults := healthCheckResult.Chan()
 		for {
 			select {
 			case <-done:
 				return
-			case result = <-healthCheckResult.Chan(): // update the health check result with the latest result
+			case latest, ok := <-latestResults: // update the health check result with the latest result
+				if !ok { // the health service has been shutdown
+					latestResults = nil
+					continue
+				}
+				result = latest
 			case reply := <-getResult: // metrics are being gathered
 				go func(result health.Result) {
 					reply <- result
@@ -61,7 +71,7 @@ func registerHealthCheckGauge(done <-chan struct{}, check health.RegisteredCheck
 	opts := prometheus.GaugeOpts{
 		Name: HealthCheckMetricID,
 		ConstLabels: map[string]string{
-			"h": check.ID,
+			HealthCheckIDLabel: check.ID,
 		},
 		Help: "health check",
 	}
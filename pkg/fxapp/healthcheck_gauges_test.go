@@ -17,6 +17,7 @@
 package fxapp_test
 
 import (
+	"context"
 	"github.com/oysterpack/andiamo/pkg/fx/health"
 	"github.com/oysterpack/andiamo/pkg/fxapp"
 	"github.com/oysterpack/andiamo/pkg/ulids"
@@ -46,12 +47,12 @@ func TestHealthCheckGauge(t *testing.T) {
 	var gatherer prometheus.Gatherer
 	app, err := fxapp.NewBuilder(fxapp.ID(ulids.MustNew()), fxapp.ReleaseID(ulids.MustNew())).
 		Invoke(func(register health.Register) error {
-			if err := register(Foo1, health.CheckerOpts{}, func() (health.Status, error) {
+			if err := register(Foo1, health.CheckerOpts{}, func(ctx context.Context) (health.Status, error) {
 				return health.Green, nil
 			}); err != nil {
 				return err
 			}
-			if err := register(Foo2, health.CheckerOpts{}, func() (health.Status, error) {
+			if err := register(Foo2, health.CheckerOpts{}, func(ctx context.Context) (health.Status, error) {
 				return health.Green, nil
 			}); err != nil {
 				return err
@@ -0,0 +1,99 @@
+/*
+ * Copyright (c) 2019 OysterPack, Inc.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ * http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package fxapp
+
+import (
+	"github.com/oysterpack/andiamo/pkg/fx/health"
+	"github.com/prometheus/client_golang/prometheus"
+	"go.uber.org/multierr"
+)
+
+// health check run queue metric IDs, which are used as the prometheus metric names
+//
+// The health module limits the number of health checks that are allowed to run concurrently. When max parallelism is
+// saturated, health check runs are queued. The average queue wait time can be computed using the wait time and dispatched
+// counters.
+const (
+	// gauge
+	HealthCheckQueuedMetricID = "U01DHRQRZM0X3YE31054QEX1CBP"
+	// gauge
+	HealthCheckRunningMetricID = "U01DHRQRZR9W5QDRTRRJ6S9RWKS"
+	// counter
+	HealthCheckDispatchedMetricID = "U01DHRQRZWJHSB3R6AJCTEEYSXZ"
+	// counter - seconds
+	HealthCheckQueueWaitMetricID = "U01DHRQS00V3FDQH8R42JC69N0C"
+)
+
+// HealthCheckOrphanedMetricID is the gauge metric ID for the number of health checker goroutines that are still running
+// after their context was done, i.e., checkers that do not honor context cancellation. A non-zero value indicates that
+// checkers need to be migrated to honor context cancellation.
+const HealthCheckOrphanedMetricID = "U01DHVTN1M0CCS2AAETFPPJ0QSC"
+
+func registerHealthCheckOrphanedMetric(orphaned health.OrphanedCheckers, registerer prometheus.Registerer) error {
+	return registerer.Register(prometheus.NewGaugeFunc(
+		prometheus.GaugeOpts{Name: HealthCheckOrphanedMetricID, Help: "number of health checker goroutines that are still running after their context was done"},
+		func() float64 { return float64(orphaned()) },
+	))
+}
+
+// HealthCheckPanicsMetricID is the counter metric ID for the number of recovered health checker panics, labeled by health
+// check ID - see `HealthCheckIDLabel`. Checker panics are reported as Red results.
+const HealthCheckPanicsMetricID = "U01DJ6MQ8KZTBTRWZBN4GPMKPJA"
+
+func registerHealthCheckPanicsMetric(panics health.CheckerPanics, registerer prometheus.Registerer) error {
+	return registerer.Register(healthCheckPanicsCollector{
+		desc:   prometheus.NewDesc(HealthCheckPanicsMetricID, "number of recovered health checker panics", []string{HealthCheckIDLabel}, nil),
+		panics: panics,
+	})
+}
+
+// the panic counts are tracked by the health service, i.e., the counters are collected on demand
+type healthCheckPanicsCollector struct {
+	desc   *prometheus.Desc
+	panics health.CheckerPanics
+}
+
+func (c healthCheckPanicsCollector) Describe(descs chan<- *prometheus.Desc) {
+	descs <- c.desc
+}
+
+func (c healthCheckPanicsCollector) Collect(metrics chan<- prometheus.Metric) {
+	for id, count := range c.panics() {
+		metrics <- prometheus.MustNewConstMetric(c.desc, prometheus.CounterValue, float64(count), id)
+	}
+}
+
+func registerHealthCheckQueueMetrics(stats health.RunQueueStats, registerer prometheus.Registerer) error {
+	return multierr.Combine(
+		registerer.Register(prometheus.NewGaugeFunc(
+			prometheus.GaugeOpts{Name: HealthCheckQueuedMetricID, Help: "number of health check runs that are queued, waiting to run"},
+			func() float64 { return float64(stats().Queued) },
+		)),
+		registerer.Register(prometheus.NewGaugeFunc(
+			prometheus.GaugeOpts{Name: HealthCheckRunningMetricID, Help: "number of health checks that are currently running"},
+			func() float64 { return float64(stats().Running) },
+		)),
+		registerer.Register(prometheus.NewCounterFunc(
+			prometheus.CounterOpts{Name: HealthCheckDispatchedMetricID, Help: "total number of health check runs that have been dispatched"},
+			func() float64 { return float64(stats().Dispatched) },
+		)),
+		registerer.Register(prometheus.NewCounterFunc(
+			prometheus.CounterOpts{Name: HealthCheckQueueWaitMetricID, Help: "total time in seconds that health check runs spent waiting in the queue"},
+			func() float64 { return stats().WaitTime.Seconds() },
+		)),
+	)
+}
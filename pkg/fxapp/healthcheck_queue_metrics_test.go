@@ -0,0 +1,191 @@
+/*
+ * Copyright (c) 2019 OysterPack, Inc.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ * http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package fxapp_test
+
+import (
+	"context"
+	"github.com/oysterpack/andiamo/pkg/clock"
+	"github.com/oysterpack/andiamo/pkg/fx/health"
+	"github.com/oysterpack/andiamo/pkg/fxapp"
+	"github.com/oysterpack/andiamo/pkg/ulids"
+	"github.com/prometheus/client_golang/prometheus"
+	io_prometheus_client "github.com/prometheus/client_model/go"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"runtime"
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestHealthCheckQueueMetrics(t *testing.T) {
+	t.Parallel()
+
+	var gatherer prometheus.Gatherer
+	app, err := fxapp.NewBuilder(fxapp.ID(ulids.MustNew()), fxapp.ReleaseID(ulids.MustNew())).
+		Invoke(func(register health.Register) error {
+			for i := 0; i < 2; i++ {
+				check := health.Check{ID: ulids.MustNew().String(), Description: "Foo", RedImpact: "Red"}
+				if err := register(check, health.CheckerOpts{}, func(ctx context.Context) (health.Status, error) {
+					return health.Green, nil
+				}); err != nil {
+					return err
+				}
+			}
+			return nil
+		}).
+		Populate(&gatherer).
+		DisableHTTPServer().
+		Build()
+	require.NoError(t, err)
+
+	go app.Run()
+	defer func() {
+		app.Shutdown()
+		<-app.Done()
+	}()
+	<-app.Ready()
+
+	metric := func(mfs []*io_prometheus_client.MetricFamily, name string) *io_prometheus_client.Metric {
+		mf := fxapp.FindMetricFamily(mfs, func(mf *io_prometheus_client.MetricFamily) bool {
+			return mf.GetName() == name
+		})
+		require.NotNil(t, mf, "metric was not gathered: %s", name)
+		require.Len(t, mf.Metric, 1)
+		return mf.Metric[0]
+	}
+
+	for {
+		mfs, err := gatherer.Gather()
+		require.NoError(t, err)
+		// wait for both health checks to be dispatched
+		if metric(mfs, fxapp.HealthCheckDispatchedMetricID).GetCounter().GetValue() < 2 {
+			time.Sleep(time.Millisecond)
+			continue
+		}
+		assert.Equal(t, float64(0), metric(mfs, fxapp.HealthCheckQueuedMetricID).GetGauge().GetValue())
+		assert.True(t, metric(mfs, fxapp.HealthCheckRunningMetricID).GetGauge().GetValue() <= 1)
+		assert.True(t, metric(mfs, fxapp.HealthCheckQueueWaitMetricID).GetCounter().GetValue() >= 0)
+		break
+	}
+}
+
+func TestHealthCheckOrphanedMetric(t *testing.T) {
+	t.Parallel()
+
+	fakeClock := clock.NewFake(time.Date(2019, time.September, 1, 0, 0, 0, 0, time.UTC))
+	started := make(chan struct{})
+	var startedOnce sync.Once
+	release := make(chan struct{})
+	var gatherer prometheus.Gatherer
+	var register health.Register
+	app, err := fxapp.NewBuilder(fxapp.ID(ulids.MustNew()), fxapp.ReleaseID(ulids.MustNew())).
+		SetClock(fakeClock).
+		Invoke(func() {}).
+		Populate(&gatherer, &register).
+		DisableHTTPServer().
+		Build()
+	require.NoError(t, err)
+
+	go app.Run()
+	defer func() {
+		app.Shutdown()
+		<-app.Done()
+	}()
+	<-app.Ready()
+
+	orphaned := func() float64 {
+		mfs, err := gatherer.Gather()
+		require.NoError(t, err)
+		mf := fxapp.FindMetricFamily(mfs, func(mf *io_prometheus_client.MetricFamily) bool {
+			return mf.GetName() == fxapp.HealthCheckOrphanedMetricID
+		})
+		require.NotNil(t, mf)
+		return mf.Metric[0].GetGauge().GetValue()
+	}
+	assert.Equal(t, float64(0), orphaned())
+
+	// When a checker that ignores the context times out
+	check := health.Check{ID: ulids.MustNew().String(), Description: "Foo", RedImpact: "Red"}
+	err = register(check, health.CheckerOpts{Timeout: time.Millisecond}, health.IgnoreContext(func() (health.Status, error) {
+		// the check may be run again while the first run is orphaned
+		startedOnce.Do(func() { close(started) })
+		<-release
+		return health.Green, nil
+	}))
+	require.NoError(t, err)
+	<-started
+	fakeClock.Advance(time.Millisecond)
+	// Then the checker goroutine is reported as orphaned
+	for orphaned() == 0 {
+		runtime.Gosched()
+	}
+	// And when the checker returns, then it is no longer reported as orphaned
+	close(release)
+	for orphaned() != 0 {
+		runtime.Gosched()
+	}
+}
+
+func TestHealthCheckPanicsMetric(t *testing.T) {
+	t.Parallel()
+
+	var gatherer prometheus.Gatherer
+	var register health.Register
+	var runCheckNow health.RunCheckNow
+	app, err := fxapp.NewBuilder(fxapp.ID(ulids.MustNew()), fxapp.ReleaseID(ulids.MustNew())).
+		Invoke(func() {}).
+		Populate(&gatherer, &register, &runCheckNow).
+		DisableHTTPServer().
+		Build()
+	require.NoError(t, err)
+
+	go app.Run()
+	defer func() {
+		app.Shutdown()
+		<-app.Done()
+	}()
+	<-app.Ready()
+
+	// When a checker panics
+	check := health.Check{ID: ulids.MustNew().String(), Description: "Foo", RedImpact: "Red"}
+	require.NoError(t, register(check, health.CheckerOpts{RunInterval: time.Hour}, func(ctx context.Context) (health.Status, error) {
+		panic("BOOM")
+	}))
+	// Then the panic is reported as a Red result
+	result, err := runCheckNow(check.ID)
+	require.NoError(t, err)
+	assert.Equal(t, health.Red, result.Status)
+	assert.Contains(t, result.Err.Error(), health.ErrCheckerPanic.Error())
+
+	// And the panics are counted per health check
+	mfs, err := gatherer.Gather()
+	require.NoError(t, err)
+	mf := fxapp.FindMetricFamily(mfs, func(mf *io_prometheus_client.MetricFamily) bool {
+		return mf.GetName() == fxapp.HealthCheckPanicsMetricID
+	})
+	require.NotNil(t, mf)
+	require.Len(t, mf.Metric, 1)
+	var checkID string
+	for _, label := range mf.Metric[0].Label {
+		if label.GetName() == fxapp.HealthCheckIDLabel {
+			checkID = label.GetValue()
+		}
+	}
+	assert.Equal(t, check.ID, checkID)
+	assert.True(t, mf.Metric[0].GetCounter().GetValue() >= 1)
+}
@@ -0,0 +1,331 @@
+/*
+ * Copyright (c) 2019 OysterPack, Inc.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ * http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package fxapp
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"github.com/oklog/ulid"
+	"github.com/oysterpack/andiamo/pkg/appdesc"
+	"github.com/oysterpack/andiamo/pkg/clock"
+	"github.com/oysterpack/andiamo/pkg/eventlog"
+	"github.com/oysterpack/andiamo/pkg/fx/health"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/rs/zerolog"
+	"go.uber.org/fx"
+	"net"
+	"net/http"
+	"net/url"
+	"sort"
+	"time"
+)
+
+// HeartbeatEvent is logged periodically while the app is running - see `Builder.EnableHeartbeat()`
+//
+//	type Data struct {
+//		// the heartbeat sequence number, starting at 1
+//		Seq      uint               `json:"seq"`
+//		Uptime   uint               `json:"uptime"`
+//		// overall health status
+//		Health   string             `json:"health"`
+//		// the metric values - see `HeartbeatOpts.Counters`
+//		Counters map[string]float64 `json:"counters,omitempty"`
+//	}
+const HeartbeatEvent = "01DJ5W0840ANNB4CTGQCSA5R3Y"
+
+// HeartbeatBeaconFailedEvent is logged when the heartbeat beacon fails to be sent to the monitoring endpoint
+//
+//	type Data struct {
+//		URL string `json:"url"`
+//		Seq uint   `json:"seq"`
+//	}
+const HeartbeatBeaconFailedEvent = "01DJ5W08891C0VT9T8WCDYKTRN"
+
+// DefaultHeartbeatInterval is the default heartbeat interval
+const DefaultHeartbeatInterval = time.Minute
+
+// DefaultHeartbeatBeaconTimeout is the default heartbeat beacon timeout
+const DefaultHeartbeatBeaconTimeout = 5 * time.Second
+
+// ErrInvalidHeartbeatOpts indicates the heartbeat options are invalid
+var ErrInvalidHeartbeatOpts = errors.New("heartbeat options are invalid")
+
+// HeartbeatOpts is used to configure the app heartbeat, which is designed for environments where the app cannot be
+// scraped, e.g., the app runs behind NAT, or is a short lived job.
+type HeartbeatOpts struct {
+	// Interval is the heartbeat interval - defaults to DefaultHeartbeatInterval
+	Interval time.Duration
+	// BeaconURL is the monitoring endpoint that the heartbeat is sent to as JSON - see `HeartbeatBeacon`. If blank, then
+	// the heartbeat is only logged. Supported schemes are:
+	//   - http, https - the heartbeat is sent via HTTP POST
+	//   - udp - the heartbeat is sent as a single datagram, e.g., "udp://monitor:9999"
+	BeaconURL string
+	// BeaconAuthToken is sent as a bearer token for HTTP beacons, if specified
+	BeaconAuthToken string
+	// BeaconTimeout is the beacon send timeout - defaults to DefaultHeartbeatBeaconTimeout
+	BeaconTimeout time.Duration
+	// Counters are the names of the key metrics that are reported with the heartbeat. Counter, gauge, and untyped metric
+	// values are summed across all series. Metrics that are not registered are not reported.
+	Counters []string
+}
+
+// HeartbeatBeacon is the heartbeat that is sent to the monitoring endpoint as JSON
+type HeartbeatBeacon struct {
+	AppID      string `json:"app_id"`
+	ReleaseID  string `json:"release_id"`
+	InstanceID string `json:"instance_id"`
+	Name       string `json:"name,omitempty"`
+	Version    string `json:"version"`
+
+	Time time.Time `json:"time"`
+	// the heartbeat sequence number, starting at 1
+	Seq           uint64             `json:"seq"`
+	UptimeSeconds float64            `json:"uptime_seconds"`
+	Health        string             `json:"health"`
+	Counters      map[string]float64 `json:"counters,omitempty"`
+}
+
+func (opts HeartbeatOpts) validate() error {
+	if opts.Interval < 0 {
+		return fmt.Errorf("%s : interval must not be negative : %s", ErrInvalidHeartbeatOpts, opts.Interval)
+	}
+	if opts.BeaconTimeout < 0 {
+		return fmt.Errorf("%s : beacon timeout must not be negative : %s", ErrInvalidHeartbeatOpts, opts.BeaconTimeout)
+	}
+	if opts.BeaconURL != "" {
+		u, err := url.Parse(opts.BeaconURL)
+		if err != nil {
+			return fmt.Errorf("%s : invalid beacon URL : %s", ErrInvalidHeartbeatOpts, err)
+		}
+		switch {
+		case u.Host == "":
+			return fmt.Errorf("%s : beacon URL host is required : %s", ErrInvalidHeartbeatOpts, opts.BeaconURL)
+		case u.Scheme != "http" && u.Scheme != "https" && u.Scheme != "udp":
+			return fmt.Errorf("%s : beacon URL scheme must be one of http, https, udp : %s", ErrInvalidHeartbeatOpts, opts.BeaconURL)
+		}
+	}
+	return nil
+}
+
+func (opts HeartbeatOpts) withDefaults() HeartbeatOpts {
+	if opts.Interval == 0 {
+		opts.Interval = DefaultHeartbeatInterval
+	}
+	if opts.BeaconTimeout == 0 {
+		opts.BeaconTimeout = DefaultHeartbeatBeaconTimeout
+	}
+	return opts
+}
+
+// MarshalZerologObject implements zerolog.LogObjectMarshaler interface
+func (b HeartbeatBeacon) MarshalZerologObject(e *zerolog.Event) {
+	e.Uint64("seq", b.Seq).
+		Dur("uptime", time.Duration(b.UptimeSeconds*float64(time.Second))).
+		Str("health", b.Health)
+	if len(b.Counters) > 0 {
+		names := make([]string, 0, len(b.Counters))
+		for name := range b.Counters {
+			names = append(names, name)
+		}
+		sort.Strings(names)
+		counters := zerolog.Dict()
+		for _, name := range names {
+			counters.Float64(name, b.Counters[name])
+		}
+		e.Dict("counters", counters)
+	}
+}
+
+type heartbeatBeaconFailure struct {
+	url string
+	seq uint64
+}
+
+func (f heartbeatBeaconFailure) MarshalZerologObject(e *zerolog.Event) {
+	e.Str("url", f.url).Uint64("seq", f.seq)
+}
+
+type heartbeatParams struct {
+	fx.In
+
+	Lifecycle     fx.Lifecycle
+	Desc          appdesc.Desc
+	InstanceID    InstanceID
+	Clock         clock.Clock
+	Logger        *zerolog.Logger
+	OverallHealth health.OverallHealth
+	Gatherer      prometheus.Gatherer
+}
+
+type heartbeat struct {
+	opts   HeartbeatOpts
+	params heartbeatParams
+	client *http.Client
+	// set when the app is started
+	start time.Time
+	seq   uint64
+
+	logHeartbeat, logBeaconFailed eventlog.Logger
+}
+
+// beacon returns the next heartbeat
+func (h *heartbeat) beacon() HeartbeatBeacon {
+	h.seq++
+	now := h.params.Clock.Now()
+	beacon := HeartbeatBeacon{
+		AppID:         ulid.ULID(h.params.Desc.ID).String(),
+		ReleaseID:     ulid.ULID(h.params.Desc.ReleaseID).String(),
+		InstanceID:    ulid.ULID(h.params.InstanceID).String(),
+		Name:          h.params.Desc.Name,
+		Version:       h.params.Desc.Version.String(),
+		Time:          now.UTC(),
+		Seq:           h.seq,
+		UptimeSeconds: now.Sub(h.start).Seconds(),
+		Health:        h.params.OverallHealth().String(),
+	}
+	if len(h.opts.Counters) == 0 {
+		return beacon
+	}
+	// metrics are best effort, i.e., the gathered metrics are reported on partial errors
+	mfs, _ := h.params.Gatherer.Gather()
+	for _, mf := range mfs {
+		for _, name := range h.opts.Counters {
+			if mf.GetName() != name {
+				continue
+			}
+			if beacon.Counters == nil {
+				beacon.Counters = make(map[string]float64, len(h.opts.Counters))
+			}
+			var sum float64
+			for _, m := range mf.GetMetric() {
+				switch {
+				case m.Counter != nil:
+					sum += m.Counter.GetValue()
+				case m.Gauge != nil:
+					sum += m.Gauge.GetValue()
+				case m.Untyped != nil:
+					sum += m.Untyped.GetValue()
+				}
+			}
+			beacon.Counters[name] = sum
+		}
+	}
+	return beacon
+}
+
+func (h *heartbeat) send(ctx context.Context, beacon HeartbeatBeacon) error {
+	body, err := json.Marshal(beacon)
+	if err != nil {
+		return err
+	}
+	u, err := url.Parse(h.opts.BeaconURL)
+	if err != nil {
+		return err
+	}
+	if u.Scheme == "udp" {
+		conn, err := net.DialTimeout("udp", u.Host, h.opts.BeaconTimeout)
+		if err != nil {
+			return err
+		}
+		defer conn.Close()
+		_, err = conn.Write(body)
+		return err
+	}
+
+	request, err := http.NewRequest(http.MethodPost, h.opts.BeaconURL, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	request = request.WithContext(ctx)
+	request.Header.Set("Content-Type", JSONMediaType)
+	if h.opts.BeaconAuthToken != "" {
+		request.Header.Set("Authorization", "Bearer "+h.opts.BeaconAuthToken)
+	}
+	response, err := h.client.Do(request)
+	if err != nil {
+		return err
+	}
+	defer response.Body.Close()
+	if response.StatusCode/100 != 2 {
+		return fmt.Errorf("unexpected HTTP response status : %s", response.Status)
+	}
+	return nil
+}
+
+func (h *heartbeat) beat(ctx context.Context) {
+	beacon := h.beacon()
+	h.logHeartbeat(beacon, "heartbeat")
+	if h.opts.BeaconURL == "" {
+		return
+	}
+	if err := h.send(ctx, beacon); err != nil {
+		h.logBeaconFailed(heartbeatBeaconFailure{url: h.opts.BeaconURL, seq: beacon.Seq}, fmt.Sprintf("failed to send heartbeat beacon: %v", err))
+	}
+}
+
+// run sends a heartbeat when the app is started, and then on each interval until the stop channel is closed
+func (h *heartbeat) run(ctx context.Context, stop <-chan struct{}) {
+	for {
+		h.beat(ctx)
+		timer := h.params.Clock.NewTimer(h.opts.Interval)
+		select {
+		case <-stop:
+			timer.Stop()
+			return
+		case <-timer.C():
+		}
+	}
+}
+
+func runHeartbeat(opts HeartbeatOpts) func(params heartbeatParams) {
+	opts = opts.withDefaults()
+	return func(params heartbeatParams) {
+		h := &heartbeat{
+			opts:            opts,
+			params:          params,
+			client:          &http.Client{Timeout: opts.BeaconTimeout},
+			logHeartbeat:    eventlog.NewLogger(HeartbeatEvent, params.Logger, zerolog.InfoLevel),
+			logBeaconFailed: eventlog.NewLogger(HeartbeatBeaconFailedEvent, params.Logger, zerolog.WarnLevel),
+		}
+		ctx, cancel := context.WithCancel(context.Background())
+		stop := make(chan struct{})
+		done := make(chan struct{})
+		params.Lifecycle.Append(fx.Hook{
+			OnStart: func(context.Context) error {
+				h.start = params.Clock.Now()
+				go func() {
+					defer close(done)
+					h.run(ctx, stop)
+				}()
+				return nil
+			},
+			OnStop: func(stopCtx context.Context) error {
+				close(stop)
+				cancel()
+				select {
+				case <-done:
+					return nil
+				case <-stopCtx.Done():
+					return stopCtx.Err()
+				}
+			},
+		})
+	}
+}
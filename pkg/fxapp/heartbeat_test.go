@@ -0,0 +1,179 @@
+/*
+ * Copyright (c) 2019 OysterPack, Inc.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ * http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package fxapp_test
+
+import (
+	"encoding/json"
+	"github.com/oklog/ulid"
+	"github.com/oysterpack/andiamo/pkg/clock"
+	"github.com/oysterpack/andiamo/pkg/fxapp"
+	"github.com/oysterpack/andiamo/pkg/fxapptest"
+	"github.com/oysterpack/andiamo/pkg/ulids"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+func TestBuilder_EnableHeartbeat(t *testing.T) {
+	t.Parallel()
+
+	const Token = "secret"
+	beacons := make(chan fxapp.HeartbeatBeacon, 10)
+	monitor := httptest.NewServer(http.HandlerFunc(func(writer http.ResponseWriter, request *http.Request) {
+		if request.Header.Get("Authorization") != "Bearer "+Token {
+			http.Error(writer, http.StatusText(http.StatusUnauthorized), http.StatusUnauthorized)
+			return
+		}
+		var beacon fxapp.HeartbeatBeacon
+		if err := json.NewDecoder(request.Body).Decode(&beacon); err != nil {
+			http.Error(writer, err.Error(), http.StatusBadRequest)
+			return
+		}
+		beacons <- beacon
+	}))
+	defer monitor.Close()
+
+	MetricID := "U" + ulids.MustNew().String()
+	fakeClock := clock.NewFake(time.Now())
+	logs := fxapptest.NewLogCapture()
+	builder := fxapp.NewBuilder(fxapp.ID(ulids.MustNew()), fxapp.ReleaseID(ulids.MustNew())).
+		Invoke(func(registerer prometheus.Registerer) error {
+			counter := prometheus.NewCounterVec(prometheus.CounterOpts{Name: MetricID, Help: "orders"}, []string{"status"})
+			counter.WithLabelValues("ok").Add(2)
+			counter.WithLabelValues("failed").Add(1)
+			return registerer.Register(counter)
+		}).
+		SetClock(fakeClock).
+		EnableHeartbeat(fxapp.HeartbeatOpts{
+			Interval:        time.Minute,
+			BeaconURL:       monitor.URL,
+			BeaconAuthToken: Token,
+			Counters:        []string{MetricID, "not_registered"},
+		}).
+		LogWriter(logs)
+
+	fxapptest.RunApp(t, builder, func(app fxapp.App, client *fxapptest.HTTPClient) {
+		receive := func() fxapp.HeartbeatBeacon {
+			// the time is advanced until the heartbeat timer fires
+			for i := 0; i < 100; i++ {
+				select {
+				case beacon := <-beacons:
+					return beacon
+				case <-time.After(50 * time.Millisecond):
+					fakeClock.Advance(time.Minute)
+				}
+			}
+			t.Fatal("*** timed out waiting for heartbeat beacon")
+			return fxapp.HeartbeatBeacon{}
+		}
+
+		// the first heartbeat is sent when the app is started
+		var beacon fxapp.HeartbeatBeacon
+		select {
+		case beacon = <-beacons:
+		case <-time.After(5 * time.Second):
+			t.Fatal("*** timed out waiting for heartbeat beacon")
+		}
+		assert.Equal(t, uint64(1), beacon.Seq)
+		assert.Equal(t, ulid.ULID(app.ID()).String(), beacon.AppID)
+		assert.Equal(t, ulid.ULID(app.InstanceID()).String(), beacon.InstanceID)
+		assert.NotEmpty(t, beacon.Health)
+		assert.Equal(t, map[string]float64{MetricID: 3}, beacon.Counters)
+
+		beacon = receive()
+		assert.Equal(t, uint64(2), beacon.Seq)
+		assert.True(t, beacon.UptimeSeconds >= time.Minute.Seconds())
+
+		fxapptest.AssertEventLogged(t, logs, fxapp.HeartbeatEvent,
+			fxapptest.Field("d.seq", float64(1)),
+			fxapptest.FieldExists("d.health"),
+			fxapptest.Field("d.counters."+MetricID, float64(3)),
+		)
+	})
+}
+
+func TestHeartbeat_UDPBeacon(t *testing.T) {
+	t.Parallel()
+
+	conn, err := net.ListenPacket("udp", "127.0.0.1:0")
+	require.NoError(t, err)
+	defer conn.Close()
+
+	builder := fxapp.NewBuilder(fxapp.ID(ulids.MustNew()), fxapp.ReleaseID(ulids.MustNew())).
+		Invoke(func() {}).
+		EnableHeartbeat(fxapp.HeartbeatOpts{BeaconURL: "udp://" + conn.LocalAddr().String()}).
+		LogWriter(fxapptest.NewLogCapture())
+
+	fxapptest.RunApp(t, builder, func(app fxapp.App, client *fxapptest.HTTPClient) {
+		require.NoError(t, conn.SetReadDeadline(time.Now().Add(5*time.Second)))
+		buf := make([]byte, 64*1024)
+		n, _, err := conn.ReadFrom(buf)
+		require.NoError(t, err)
+		var beacon fxapp.HeartbeatBeacon
+		require.NoError(t, json.Unmarshal(buf[:n], &beacon))
+		assert.Equal(t, uint64(1), beacon.Seq)
+		assert.Equal(t, ulid.ULID(app.InstanceID()).String(), beacon.InstanceID)
+	})
+}
+
+func TestHeartbeat_BeaconFailed(t *testing.T) {
+	t.Parallel()
+
+	monitor := httptest.NewServer(http.HandlerFunc(func(writer http.ResponseWriter, request *http.Request) {
+		http.Error(writer, "unavailable", http.StatusServiceUnavailable)
+	}))
+	defer monitor.Close()
+
+	logs := fxapptest.NewLogCapture()
+	builder := fxapp.NewBuilder(fxapp.ID(ulids.MustNew()), fxapp.ReleaseID(ulids.MustNew())).
+		Invoke(func() {}).
+		EnableHeartbeat(fxapp.HeartbeatOpts{BeaconURL: monitor.URL}).
+		LogWriter(logs)
+
+	fxapptest.RunApp(t, builder, func(app fxapp.App, client *fxapptest.HTTPClient) {
+		_, err := logs.WaitForEvent(fxapp.HeartbeatBeaconFailedEvent, 5*time.Second,
+			fxapptest.Field("d.url", monitor.URL),
+			fxapptest.Field("d.seq", float64(1)),
+		)
+		assert.NoError(t, err)
+	})
+}
+
+func TestHeartbeatOpts_Validation(t *testing.T) {
+	t.Parallel()
+
+	for _, opts := range []fxapp.HeartbeatOpts{
+		{Interval: -time.Second},
+		{BeaconTimeout: -time.Second},
+		{BeaconURL: "tcp://monitor:9999"},
+		{BeaconURL: "http://"},
+		{BeaconURL: "://monitor"},
+	} {
+		_, err := fxapp.NewBuilder(fxapp.ID(ulids.MustNew()), fxapp.ReleaseID(ulids.MustNew())).
+			Invoke(func() {}).
+			EnableHeartbeat(opts).
+			DisableHTTPServer().
+			Build()
+		require.Error(t, err, "%v", opts)
+		assert.Contains(t, err.Error(), fxapp.ErrInvalidHeartbeatOpts.Error())
+	}
+}
@@ -18,18 +18,70 @@ package fxapp
 
 import (
 	"context"
+	"crypto/tls"
 	"errors"
 	"fmt"
+	"github.com/oysterpack/andiamo/pkg/appdesc"
+	"github.com/oysterpack/andiamo/pkg/clock"
 	"github.com/oysterpack/andiamo/pkg/eventlog"
+	"github.com/oysterpack/andiamo/pkg/listener"
+	"github.com/prometheus/client_golang/prometheus"
 	"github.com/rs/zerolog"
 	"go.uber.org/fx"
 	"log"
+	"net"
 	"net/http"
+	"os"
 	"sort"
+	"strconv"
+	"strings"
 	"sync"
 	"time"
 )
 
+// DefaultHTTPServerAddr is the default app HTTP server address
+const DefaultHTTPServerAddr = ":8008"
+
+// ErrInvalidHTTPServerAddr indicates the HTTP server address is invalid - see `listener.Listen()` for the supported address
+// formats
+var ErrInvalidHTTPServerAddr = errors.New("HTTP server address is invalid")
+
+// HTTPServerAddr returns the address that the app HTTP server is bound to, which may differ from the configured address,
+// e.g., when the server is configured to listen on a random free port via ":0".
+//
+// nil is returned if the HTTP server is not listening, i.e., the app has not been started yet or the HTTP server is disabled.
+type HTTPServerAddr func() net.Addr
+
+// httpServerListener tracks the address that the app HTTP server is bound to
+type httpServerListener struct {
+	mutex sync.RWMutex
+	addr  net.Addr
+}
+
+func (l *httpServerListener) setAddr(addr net.Addr) {
+	l.mutex.Lock()
+	defer l.mutex.Unlock()
+	l.addr = addr
+}
+
+func (l *httpServerListener) Addr() net.Addr {
+	l.mutex.RLock()
+	defer l.mutex.RUnlock()
+	return l.addr
+}
+
+func newHTTPServerListener() (*httpServerListener, HTTPServerAddr) {
+	l := &httpServerListener{}
+	return l, l.Addr
+}
+
+func validateHTTPServerAddr(addr string) error {
+	if err := listener.Validate(addr); err != nil {
+		return fmt.Errorf("%s : %s", ErrInvalidHTTPServerAddr, err)
+	}
+	return nil
+}
+
 // HTTPHandler is used to group HTTPEndpoint(s) together.
 // The HTTPEndpoint(s) are automatically registered with the app's HTTP server.
 type HTTPHandler struct {
@@ -38,7 +90,7 @@ type HTTPHandler struct {
 	HTTPEndpoint `group:"HTTPHandler"`
 }
 
-// NewHTTPHandler constructs a new HTTPHandler
+// NewHTTPHandler constructs a new HTTPHandler, which handles all HTTP methods - see `NewHTTPRoute()`
 func NewHTTPHandler(path string, handler func(http.ResponseWriter, *http.Request)) HTTPHandler {
 	return HTTPHandler{
 		HTTPEndpoint: HTTPEndpoint{
@@ -48,10 +100,35 @@ func NewHTTPHandler(path string, handler func(http.ResponseWriter, *http.Request
 	}
 }
 
-// HTTPEndpoint maps an HTTP handler to an HTTP path
+// HTTPHandlers is used to group multiple HTTPEndpoint(s) together, e.g., when the number of endpoints that a constructor
+// provides is determined at runtime. The HTTPEndpoint(s) are automatically registered with the app's HTTP server.
+type HTTPHandlers struct {
+	fx.Out
+
+	HTTPEndpoints []HTTPEndpoint `group:"HTTPHandlers"`
+}
+
+// HTTPEndpoint maps an HTTP handler to an HTTP route, i.e., method and path
 type HTTPEndpoint struct {
+	// Method is the HTTP method that the endpoint handles. If blank, then the endpoint handles all HTTP methods.
+	//
+	// Multiple endpoints can be registered for the same path as long as their methods are different. If a request method
+	// does not match any of the path's endpoints, then HTTP 405 is returned.
+	Method  string
 	Path    string
 	Handler func(http.ResponseWriter, *http.Request)
+	// Middleware is used to wrap the handler, e.g., for authentication or instrumentation. The middleware is applied in
+	// order, i.e., the first middleware is the outermost handler.
+	Middleware []func(http.Handler) http.Handler
+	// Doc is used to describe the route in the app's OpenAPI document. If nil, then the route is not included in the
+	// OpenAPI document - see `OpenAPIEndpoint`.
+	Doc *OpenAPIOperation
+	// Admin endpoints require requests to be authenticated by the app's admin authenticator - see `Authenticator`
+	Admin bool
+	// MaxBodyBytes is the max request body size. If zero, then the HTTP server limit applies - see `HTTPServerLimits`.
+	MaxBodyBytes int64
+	// Streaming routes, e.g., Server-Sent Events, are long lived, i.e., they are exempt from the HTTP server write timeout
+	Streaming bool
 }
 
 // httpServerOpts is used by the app to configure and run an HTTP server only if HTTPEndpoint(s) are discovered, i.e.,
@@ -62,46 +139,118 @@ type HTTPEndpoint struct {
 // 	- Addr:              ":8008",
 //	- ReadHeaderTimeout: time.Second,
 //	- MaxHeaderBytes:    1024,
+//	- ReadTimeout:       30 * time.Second,
+//	- IdleTimeout:       2 * time.Minute,
+//
+// The HTTP server address is resolved in the following order:
+//  1. the address that is set via the builder - see `Builder.SetHTTPServerAddr()`
+//  2. APP12X_HTTP_SERVER_ADDR env var
+//  3. the provided http.Server Addr
+//  4. DefaultHTTPServerAddr
+//
+// Besides TCP addresses, the HTTP server can listen on a Unix domain socket, e.g., "unix:/var/run/app.sock", or on a
+// listener that is inherited via systemd socket activation, e.g., "systemd:http" - see `listener.Listen()`.
+//
+// The HTTP server timeouts and max request body size can be configured via the builder, which take precedence over the
+// provided http.Server settings - see `HTTPServerLimits`.
+//
+// If the provided http.Server has a TLSConfig, then the server serves HTTPS, i.e., the TLSConfig must provide the server
+// certificate.
 type httpServerOpts struct {
 	fx.In
 
 	Server *http.Server `optional:"true"`
+	Desc   appdesc.Desc
+	// Addr is the address that is configured via the builder or env - blank means it was not configured
+	Addr     httpServerAddrConfig
+	Listener *httpServerListener
+	// AdminAuthenticator is the authenticator that is set via the builder - nil means it was not set
+	AdminAuthenticator adminAuthenticatorConfig
+	AdminAuthDisabled  adminAuthDisabledConfig
+	Authenticator      Authenticator `optional:"true"`
+	EnvPrefix          EnvPrefix
+	// Middleware is applied to all requests, e.g., CORS and security headers
+	Middleware httpServerMiddleware
+	Limits     httpServerLimits
+	Registerer prometheus.Registerer
+	Clock      clock.Clock
 
-	Endpoints []HTTPEndpoint `group:"HTTPHandler"`
-}
-
-// validate runs the following checks:
-//	- endpoint paths are unique
-//	- handler funcs are not nil
-func (opts httpServerOpts) validate() error {
-	paths := make(map[string]bool, len(opts.Endpoints))
-	for _, endpoint := range opts.Endpoints {
-		if paths[endpoint.Path] {
-			return fmt.Errorf("duplicate HTTP endpoint path: %v", endpoint.Path)
-		}
-		if endpoint.Handler == nil {
-			return fmt.Errorf("http handler func is nil for: %v", endpoint.Path)
-		}
-		paths[endpoint.Path] = true
-	}
-
-	return nil
+	Endpoints      []HTTPEndpoint   `group:"HTTPHandler"`
+	EndpointGroups [][]HTTPEndpoint `group:"HTTPHandlers"`
 }
 
 func (opts httpServerOpts) httpServerInfo() httpServerInfo {
 	endpoints := make([]string, 0, len(opts.Endpoints))
+	paths := make(map[string]bool, len(opts.Endpoints))
 	for _, endpoint := range opts.Endpoints {
-		endpoints = append(endpoints, endpoint.Path)
+		if !paths[endpoint.Path] {
+			endpoints = append(endpoints, endpoint.Path)
+			paths[endpoint.Path] = true
+		}
 	}
 	sort.Strings(endpoints)
 
-	return httpServerInfo{
+	info := httpServerInfo{
 		addr:      opts.Server.Addr,
 		endpoints: endpoints,
 	}
+	if addr := opts.Listener.Addr(); addr != nil {
+		info.listenAddr = addr.String()
+	}
+	return info
+}
+
+// adminAuthenticator returns the admin authenticator - nil means unauthenticated admin access was explicitly allowed.
+// If no authenticator is configured, then admin requests are denied.
+func (opts httpServerOpts) adminAuthenticator() Authenticator {
+	switch {
+	case opts.AdminAuthenticator != nil:
+		return opts.AdminAuthenticator
+	case opts.Authenticator != nil:
+		return opts.Authenticator
+	}
+	if token := strings.TrimSpace(os.Getenv(opts.EnvPrefix.EnvVar(adminBearerTokenEnvName))); token != "" {
+		return NewBearerTokenAuthenticator(token)
+	}
+	if opts.AdminAuthDisabled {
+		return nil
+	}
+	if disabled, err := strconv.ParseBool(strings.TrimSpace(os.Getenv(opts.EnvPrefix.EnvVar(adminAuthDisabledEnvName)))); err == nil && disabled {
+		return nil
+	}
+	return denyAdminAuthenticator
 }
 
 func runHTTPServer(opts httpServerOpts, logger *zerolog.Logger, lc fx.Lifecycle, readiness ReadinessWaitGroup) error {
+	for _, endpoints := range opts.EndpointGroups {
+		opts.Endpoints = append(opts.Endpoints, endpoints...)
+	}
+	for i := range opts.Endpoints {
+		opts.Endpoints[i].Method = strings.ToUpper(strings.TrimSpace(opts.Endpoints[i].Method))
+	}
+	opts.Endpoints = append(opts.Endpoints, newOpenAPIHTTPEndpoint(opts.Desc, opts.Endpoints))
+	// the route table is captured before the app middleware is applied, i.e., auth and limits
+	routeTable := newHTTPRouteTable(opts.Endpoints)
+	if authenticator := opts.adminAuthenticator(); authenticator != nil {
+		auth := adminAuthMiddleware(authenticator, logger)
+		for i := range opts.Endpoints {
+			if opts.Endpoints[i].Admin {
+				// authentication runs before the endpoint middleware, but within the request metrics and limits middleware,
+				// which are applied below, i.e., requests that fail authentication are counted and are subject to the limits
+				opts.Endpoints[i].Middleware = append([]func(http.Handler) http.Handler{auth}, opts.Endpoints[i].Middleware...)
+			}
+		}
+	} else {
+		var adminEndpoints adminUnauthenticated
+		for _, endpoint := range opts.Endpoints {
+			if endpoint.Admin {
+				adminEndpoints = append(adminEndpoints, endpoint.Path)
+			}
+		}
+		if len(adminEndpoints) > 0 {
+			eventlog.NewLogger(AdminUnauthenticatedEvent, logger, zerolog.WarnLevel)(adminEndpoints, "admin HTTP endpoints are not protected")
+		}
+	}
 	if len(opts.Endpoints) == 0 {
 		// If there are no HTTP endpoints, then we don't need to run the HTTP server, but ...
 		//
@@ -115,33 +264,68 @@ func runHTTPServer(opts httpServerOpts, logger *zerolog.Logger, lc fx.Lifecycle,
 		log.Fatal("FATAL: trying to run HTTP server with no handlers")
 	}
 
-	if err := opts.validate(); err != nil {
+	if err := validateHTTPRoutes(opts.Endpoints); err != nil {
 		return err
 	}
 
 	readiness.Inc()
 
-	serveMux := http.NewServeMux()
-	for _, endpoint := range opts.Endpoints {
-		serveMux.HandleFunc(endpoint.Path, endpoint.Handler)
-	}
-
 	if opts.Server == nil {
 		opts.Server = newHTTPServerWithDefaultOpts()
 	}
-	opts.Server.Handler = serveMux
+	HTTPServerLimits(opts.Limits).apply(opts.Server)
+	violations, err := newHTTPLimitViolations(logger, opts.Registerer)
+	if err != nil {
+		return err
+	}
+	requestMetrics, err := newHTTPRequestMetrics(opts.Registerer)
+	if err != nil {
+		return err
+	}
+	for i := range opts.Endpoints {
+		if opts.Endpoints[i].MaxBodyBytes == 0 {
+			opts.Endpoints[i].MaxBodyBytes = opts.Limits.MaxRequestBodyBytes
+		}
+		// limits are enforced before any other middleware - the request metrics are recorded outside of the limits, i.e.,
+		// limit violation responses are counted
+		limits := violations.middleware(opts.Endpoints[i], opts.Server, opts.Clock)
+		metrics := requestMetrics.middleware(opts.Endpoints[i], opts.Clock)
+		opts.Endpoints[i].Middleware = append([]func(http.Handler) http.Handler{metrics, limits}, opts.Endpoints[i].Middleware...)
+	}
+	serveMux := newHTTPRouter(opts.Endpoints)
+
+	switch {
+	case opts.Addr != "":
+		opts.Server.Addr = string(opts.Addr)
+	case opts.Server.Addr == "":
+		opts.Server.Addr = DefaultHTTPServerAddr
+	}
+	if err := validateHTTPServerAddr(opts.Server.Addr); err != nil {
+		return err
+	}
+	opts.Server.Handler = opts.Middleware.wrap(serveMux)
 
 	logHTTPServerErr := httpServerErrorLog(eventlog.NewLogger(HTTPServerError, logger, zerolog.ErrorLevel))
 	lc.Append(fx.Hook{
 		OnStart: func(context.Context) error {
+			// the listener is created synchronously, i.e., if the address is already in use, then the app will fail to start
+			ln, err := listener.Listen(opts.Server.Addr)
+			if err != nil {
+				return err
+			}
+			opts.Listener.setAddr(ln.Addr())
+			if opts.Server.TLSConfig != nil {
+				ln = tls.NewListener(ln, opts.Server.TLSConfig)
+			}
 			eventlog.NewLogger(HTTPServerStarting, logger, zerolog.InfoLevel)(opts.httpServerInfo(), "starting HTTP server")
+			eventlog.NewLogger(HTTPRoutesEvent, logger, zerolog.InfoLevel)(routeTable, "HTTP routes")
 			// wait for the HTTP server go routine to start running before returning
 			var wg sync.WaitGroup
 			wg.Add(1)
 			go func() {
 				wg.Done()
 				readiness.Done()
-				err := opts.Server.ListenAndServe()
+				err := opts.Server.Serve(ln)
 				if err != http.ErrServerClosed {
 					logHTTPServerErr(httpListenAndServerError{err}, "HTTP server has exited with an error")
 				}
@@ -150,6 +334,7 @@ func runHTTPServer(opts httpServerOpts, logger *zerolog.Logger, lc fx.Lifecycle,
 			return nil
 		},
 		OnStop: func(ctx context.Context) error {
+			defer opts.Listener.setAddr(nil)
 			return opts.Server.Shutdown(ctx)
 		},
 	})
@@ -159,9 +344,11 @@ func runHTTPServer(opts httpServerOpts, logger *zerolog.Logger, lc fx.Lifecycle,
 
 func newHTTPServerWithDefaultOpts() *http.Server {
 	return &http.Server{
-		Addr:              ":8008",
+		Addr:              DefaultHTTPServerAddr,
 		ReadHeaderTimeout: time.Second,
 		MaxHeaderBytes:    1024,
+		ReadTimeout:       30 * time.Second,
+		IdleTimeout:       2 * time.Minute,
 	}
 }
 
@@ -176,6 +363,8 @@ const (
 
 	// 	type Data struct {
 	//		Addr      string
+	//		// the address that the HTTP server is bound to, e.g., when Addr is ":0", then the port is randomly assigned
+	//		ListenAddr string `json:"listen_addr"`
 	//		Endpoints []string
 	//	}
 	HTTPServerStarting = "01DEFM9FFSH58ZGNPSR7Z4C3G2"
@@ -202,12 +391,26 @@ func (err httpListenAndServerError) MarshalZerologObject(e *zerolog.Event) {
 }
 
 type httpServerInfo struct {
-	addr      string
-	endpoints []string
+	addr       string
+	listenAddr string
+	endpoints  []string
 }
 
 func (info httpServerInfo) MarshalZerologObject(e *zerolog.Event) {
 	e.
 		Str("addr", info.addr).
+		Str("listen_addr", info.listenAddr).
 		Strs("endpoints", info.endpoints)
 }
+
+// httpServerAddrConfig is the HTTP server address that is configured via the builder or env
+type httpServerAddrConfig string
+
+// httpServerLimits is the HTTP server limits that are configured via the builder
+type httpServerLimits HTTPServerLimits
+
+// adminAuthenticatorConfig is the admin authenticator that is configured via the builder
+type adminAuthenticatorConfig Authenticator
+
+// adminAuthDisabledConfig is true if unauthenticated admin access was explicitly allowed via the builder
+type adminAuthDisabledConfig bool
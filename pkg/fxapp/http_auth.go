@@ -0,0 +1,191 @@
+/*
+ * Copyright (c) 2019 OysterPack, Inc.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ * http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package fxapp
+
+import (
+	"crypto/subtle"
+	"errors"
+	"github.com/oysterpack/andiamo/pkg/eventlog"
+	"github.com/rs/zerolog"
+	"net/http"
+	"strings"
+)
+
+// AdminAuthFailedEvent is logged as a security event when an admin HTTP endpoint request fails authentication - see
+// `Authenticator`.
+//
+//	type Data struct {
+//		Method     string `json:"method"`
+//		Path       string `json:"path"`
+//		RemoteAddr string `json:"remote_addr"`
+//		UserAgent  string `json:"user_agent"`
+//		Err        string `json:"e"`
+//	}
+const AdminAuthFailedEvent = "01DHYXH3KZTE1JZ6ACNT0Z9A43"
+
+// AdminUnauthenticatedEvent is logged as a security event when the HTTP server is started with admin endpoints that are
+// not protected, i.e., unauthenticated admin access was explicitly allowed - see `Builder.AllowUnauthenticatedAdmin()`.
+//
+//	type Data struct {
+//		// admin endpoint paths
+//		Endpoints []string `json:"endpoints"`
+//	}
+const AdminUnauthenticatedEvent = "01DJ9ZV0CJ4QQQNHXN1K4VXX4Q"
+
+// Authentication related errors
+var (
+	ErrUnauthenticated       = errors.New("request is not authenticated")
+	ErrInvalidBearerToken    = errors.New("bearer token is missing or invalid")
+	ErrClientCertNotVerified = errors.New("verified TLS client certificate is required")
+	ErrClientCertNotAllowed  = errors.New("TLS client certificate is not allowed")
+	ErrNilAdminAuthenticator = errors.New("admin authenticator must not be nil")
+	ErrNoAdminAuthenticator  = errors.New("admin authenticator is not configured")
+)
+
+// Authenticator is used to authenticate requests to the app's admin HTTP endpoints, i.e., metrics, health checks,
+// components, event stream, etc. The readiness and liveness probes are not admin endpoints, i.e., they are never
+// protected.
+//
+// The authenticator is resolved in the following order:
+//  1. the authenticator that is set via the builder - see `Builder.SetAdminAuthenticator()`
+//  2. an Authenticator that is provided via dependency injection
+//  3. if the APP12X_ADMIN_BEARER_TOKEN env var is set, then a bearer token authenticator
+//
+// If no authenticator is configured, then admin endpoint requests are denied, i.e., metrics and health data are not
+// world-readable by default. Unauthenticated admin access must be explicitly allowed, e.g., for local development, via
+// `Builder.AllowUnauthenticatedAdmin()` or the APP12X_ADMIN_AUTH_DISABLED env var, in which case the
+// AdminUnauthenticatedEvent is logged when the HTTP server is started.
+//
+// NOTE: the metrics endpoint is an admin endpoint, i.e., Prometheus scrapes fail with HTTP 401 unless the scrape config
+// specifies the admin credentials, e.g., the bearer token. This is a breaking change for apps whose metrics were
+// scraped without credentials. The generated Kubernetes manifests configure the ServiceMonitor with the admin bearer
+// token - see `KubernetesManifests()`.
+//
+// Requests that fail authentication are rejected with HTTP 401 and logged as security events - see `AdminAuthFailedEvent`.
+type Authenticator interface {
+	// Authenticate returns an error if the request is not authenticated
+	Authenticate(request *http.Request) error
+}
+
+// AuthenticatorFunc is a func that implements the Authenticator interface
+type AuthenticatorFunc func(request *http.Request) error
+
+// Authenticate implements the Authenticator interface
+func (f AuthenticatorFunc) Authenticate(request *http.Request) error {
+	return f(request)
+}
+
+// NewBearerTokenAuthenticator returns an Authenticator that requires requests to specify one of the tokens via the
+// Authorization header, i.e., "Authorization: Bearer <token>". Multiple tokens are supported in order to rotate tokens
+// without downtime. Blank tokens are ignored, i.e., if no tokens are specified, then all requests fail authentication.
+func NewBearerTokenAuthenticator(tokens ...string) Authenticator {
+	validTokens := make([][]byte, 0, len(tokens))
+	for _, token := range tokens {
+		if token = strings.TrimSpace(token); token != "" {
+			validTokens = append(validTokens, []byte(token))
+		}
+	}
+	return AuthenticatorFunc(func(request *http.Request) error {
+		authorization := request.Header.Get("Authorization")
+		if !strings.HasPrefix(authorization, "Bearer ") {
+			return ErrInvalidBearerToken
+		}
+		token := []byte(strings.TrimSpace(strings.TrimPrefix(authorization, "Bearer ")))
+		for _, validToken := range validTokens {
+			if subtle.ConstantTimeCompare(token, validToken) == 1 {
+				return nil
+			}
+		}
+		return ErrInvalidBearerToken
+	})
+}
+
+// NewClientCertAuthenticator returns an Authenticator that requires requests to present a verified TLS client
+// certificate, i.e., mTLS, whose subject common name or DNS SAN is in the allow-list.
+//
+// NOTE: the app HTTP server must be configured to serve TLS and to verify client certificates, i.e., the provided
+// http.Server TLSConfig must specify the server certificate, the client CAs, and `tls.VerifyClientCertIfGiven` or
+// `tls.RequireAndVerifyClientCert` client auth.
+func NewClientCertAuthenticator(allowed ...string) Authenticator {
+	names := make(map[string]bool, len(allowed))
+	for _, name := range allowed {
+		names[strings.TrimSpace(name)] = true
+	}
+	return AuthenticatorFunc(func(request *http.Request) error {
+		if request.TLS == nil || len(request.TLS.VerifiedChains) == 0 || len(request.TLS.VerifiedChains[0]) == 0 {
+			return ErrClientCertNotVerified
+		}
+		cert := request.TLS.VerifiedChains[0][0]
+		if cert.Subject.CommonName != "" && names[cert.Subject.CommonName] {
+			return nil
+		}
+		for _, name := range cert.DNSNames {
+			if names[name] {
+				return nil
+			}
+		}
+		return ErrClientCertNotAllowed
+	})
+}
+
+// denyAdminAuthenticator is used when no authenticator is configured, i.e., all admin requests fail authentication
+var denyAdminAuthenticator = AuthenticatorFunc(func(request *http.Request) error {
+	return ErrNoAdminAuthenticator
+})
+
+type adminUnauthenticated []string
+
+func (e adminUnauthenticated) MarshalZerologObject(event *zerolog.Event) {
+	event.Strs("endpoints", e)
+}
+
+// adminAuthMiddleware rejects requests that fail authentication with HTTP 401
+func adminAuthMiddleware(authenticator Authenticator, logger *zerolog.Logger) func(http.Handler) http.Handler {
+	logAuthFailed := eventlog.NewLogger(AdminAuthFailedEvent, logger, zerolog.WarnLevel)
+	return func(handler http.Handler) http.Handler {
+		return http.HandlerFunc(func(writer http.ResponseWriter, request *http.Request) {
+			if err := authenticator.Authenticate(request); err != nil {
+				logAuthFailed(adminAuthFailed{request, err}, ErrUnauthenticated.Error())
+				writer.Header().Set("WWW-Authenticate", "Bearer")
+				http.Error(writer, http.StatusText(http.StatusUnauthorized), http.StatusUnauthorized)
+				return
+			}
+			handler.ServeHTTP(writer, request)
+		})
+	}
+}
+
+type adminAuthFailed struct {
+	request *http.Request
+	err     error
+}
+
+func (e adminAuthFailed) MarshalZerologObject(event *zerolog.Event) {
+	event.
+		Str("method", e.request.Method).
+		Str("path", e.request.URL.Path).
+		Str("remote_addr", e.request.RemoteAddr).
+		Str("user_agent", e.request.UserAgent()).
+		Err(e.err)
+}
+
+// AdminOnly marks the HTTP route as an admin endpoint, i.e., requests must be authenticated by the app's admin
+// authenticator - see `Authenticator`
+func (h HTTPHandler) AdminOnly() HTTPHandler {
+	h.Admin = true
+	return h
+}
@@ -0,0 +1,303 @@
+/*
+ * Copyright (c) 2019 OysterPack, Inc.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ * http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package fxapp_test
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"errors"
+	"github.com/oysterpack/andiamo/pkg/fxapp"
+	"github.com/oysterpack/andiamo/pkg/fxapptest"
+	"github.com/oysterpack/andiamo/pkg/ulids"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestBuilder_SetAdminAuthenticator(t *testing.T) {
+	t.Parallel()
+
+	const Token = "secret"
+	ok := func(writer http.ResponseWriter, request *http.Request) {}
+	logs := fxapptest.NewLogCapture()
+	builder := fxapp.NewBuilder(fxapp.ID(ulids.MustNew()), fxapp.ReleaseID(ulids.MustNew())).
+		Provide(
+			func() fxapp.HTTPHandler { return fxapp.NewHTTPRoute(http.MethodGet, "/admin", ok).AdminOnly() },
+			func() fxapp.HTTPHandler { return fxapp.NewHTTPRoute(http.MethodGet, "/public", ok) },
+		).
+		Invoke(func() {}).
+		SetAdminAuthenticator(fxapp.NewBearerTokenAuthenticator(Token)).
+		LogWriter(logs)
+
+	fxapptest.RunApp(t, builder, func(app fxapp.App, client *fxapptest.HTTPClient) {
+		get := func(path, token string) *http.Response {
+			request, err := http.NewRequest(http.MethodGet, client.URL(path), nil)
+			require.NoError(t, err)
+			if token != "" {
+				request.Header.Set("Authorization", "Bearer "+token)
+			}
+			response, err := client.Do(request)
+			require.NoError(t, err)
+			response.Body.Close()
+			return response
+		}
+
+		adminEndpoints := []string{
+			fxapp.DefaultPrometheusHTTPHandlerOpts().Endpoint,
+			fxapp.ComponentsEndpoint,
+			fxapp.XRefsEndpoint,
+			fxapp.HealthCheckResultsEndpoint,
+			fxapp.MetricsCatalogEndpoint,
+			fxapp.AdminUIEndpoint,
+			fxapp.OpenAPIEndpoint,
+			"/admin",
+		}
+
+		t.Run("admin endpoints require authentication", func(t *testing.T) {
+			for _, path := range adminEndpoints {
+				for _, token := range []string{"", "invalid"} {
+					response := get(path, token)
+					assert.Equal(t, http.StatusUnauthorized, response.StatusCode, path)
+					assert.Equal(t, "Bearer", response.Header.Get("WWW-Authenticate"))
+				}
+			}
+			fxapptest.AssertEventLogged(t, logs, fxapp.AdminAuthFailedEvent,
+				fxapptest.Field("d.method", http.MethodGet),
+				fxapptest.Field("d.path", "/admin"),
+				fxapptest.Field("d.e", fxapp.ErrInvalidBearerToken.Error()),
+			)
+		})
+
+		t.Run("authenticated admin requests", func(t *testing.T) {
+			for _, path := range adminEndpoints {
+				response := get(path, Token)
+				assert.Equal(t, http.StatusOK, response.StatusCode, path)
+			}
+		})
+
+		t.Run("probes and user routes are not protected", func(t *testing.T) {
+			for _, path := range []string{fxapp.ReadyEvent, fxapp.LivenessProbeEvent, "/public"} {
+				response := get(path, "")
+				assert.Equal(t, http.StatusOK, response.StatusCode, path)
+			}
+		})
+	})
+}
+
+func TestBuilder_SetAdminAuthenticator_Nil(t *testing.T) {
+	t.Parallel()
+
+	_, err := fxapp.NewBuilder(fxapp.ID(ulids.MustNew()), fxapp.ReleaseID(ulids.MustNew())).
+		Invoke(func() {}).
+		SetAdminAuthenticator(nil).
+		LogWriter(ioutil.Discard).
+		Build()
+	assert.Error(t, err)
+	assert.Contains(t, err.Error(), fxapp.ErrNilAdminAuthenticator.Error())
+}
+
+func TestInjectedAdminAuthenticator(t *testing.T) {
+	t.Parallel()
+
+	builder := fxapp.NewBuilder(fxapp.ID(ulids.MustNew()), fxapp.ReleaseID(ulids.MustNew())).
+		Provide(func() fxapp.Authenticator {
+			return fxapp.AuthenticatorFunc(func(request *http.Request) error {
+				if request.Header.Get("X-API-Key") != "secret" {
+					return errors.New("invalid API key")
+				}
+				return nil
+			})
+		}).
+		Invoke(func() {}).
+		LogWriter(ioutil.Discard)
+
+	fxapptest.RunApp(t, builder, func(app fxapp.App, client *fxapptest.HTTPClient) {
+		response, err := client.Get(fxapp.ComponentsEndpoint)
+		require.NoError(t, err)
+		response.Body.Close()
+		assert.Equal(t, http.StatusUnauthorized, response.StatusCode)
+
+		request, err := http.NewRequest(http.MethodGet, client.URL(fxapp.ComponentsEndpoint), nil)
+		require.NoError(t, err)
+		request.Header.Set("X-API-Key", "secret")
+		response, err = client.Do(request)
+		require.NoError(t, err)
+		response.Body.Close()
+		assert.Equal(t, http.StatusOK, response.StatusCode)
+	})
+}
+
+func TestAdminBearerTokenEnvVar(t *testing.T) {
+	t.Setenv(fxapp.AdminBearerTokenEnvVar, "secret")
+
+	builder := fxapp.NewBuilder(fxapp.ID(ulids.MustNew()), fxapp.ReleaseID(ulids.MustNew())).
+		Invoke(func() {}).
+		LogWriter(ioutil.Discard)
+
+	fxapptest.RunApp(t, builder, func(app fxapp.App, client *fxapptest.HTTPClient) {
+		response, err := client.Get(fxapp.HealthCheckResultsEndpoint)
+		require.NoError(t, err)
+		response.Body.Close()
+		assert.Equal(t, http.StatusUnauthorized, response.StatusCode)
+
+		request, err := http.NewRequest(http.MethodGet, client.URL(fxapp.HealthCheckResultsEndpoint), nil)
+		require.NoError(t, err)
+		request.Header.Set("Authorization", "Bearer secret")
+		response, err = client.Do(request)
+		require.NoError(t, err)
+		response.Body.Close()
+		assert.Equal(t, http.StatusOK, response.StatusCode)
+	})
+}
+
+func TestNewBearerTokenAuthenticator(t *testing.T) {
+	t.Parallel()
+
+	authenticator := fxapp.NewBearerTokenAuthenticator("old", " ", "new")
+	for token, expected := range map[string]error{
+		"Bearer old":  nil,
+		"Bearer new":  nil,
+		"Bearer ":     fxapp.ErrInvalidBearerToken,
+		"Bearer  ":    fxapp.ErrInvalidBearerToken,
+		"Basic old":   fxapp.ErrInvalidBearerToken,
+		"":            fxapp.ErrInvalidBearerToken,
+		"Bearer olds": fxapp.ErrInvalidBearerToken,
+	} {
+		request := httptest.NewRequest(http.MethodGet, "/", nil)
+		request.Header.Set("Authorization", token)
+		assert.Equal(t, expected, authenticator.Authenticate(request), token)
+	}
+}
+
+func TestNewClientCertAuthenticator(t *testing.T) {
+	t.Parallel()
+
+	authenticator := fxapp.NewClientCertAuthenticator("ops", "monitor.example.com")
+	request := func(cert *x509.Certificate) *http.Request {
+		request := httptest.NewRequest(http.MethodGet, "/", nil)
+		if cert != nil {
+			request.TLS = &tls.ConnectionState{VerifiedChains: [][]*x509.Certificate{{cert}}}
+		}
+		return request
+	}
+
+	assert.NoError(t, authenticator.Authenticate(request(&x509.Certificate{Subject: pkix.Name{CommonName: "ops"}})))
+	assert.NoError(t, authenticator.Authenticate(request(&x509.Certificate{DNSNames: []string{"foo.example.com", "monitor.example.com"}})))
+	assert.Equal(t, fxapp.ErrClientCertNotAllowed, authenticator.Authenticate(request(&x509.Certificate{Subject: pkix.Name{CommonName: "dev"}})))
+	assert.Equal(t, fxapp.ErrClientCertNotVerified, authenticator.Authenticate(request(nil)))
+
+	t.Run("unverified client certs are not authenticated", func(t *testing.T) {
+		r := httptest.NewRequest(http.MethodGet, "/", nil)
+		r.TLS = &tls.ConnectionState{PeerCertificates: []*x509.Certificate{{Subject: pkix.Name{CommonName: "ops"}}}}
+		assert.Equal(t, fxapp.ErrClientCertNotVerified, authenticator.Authenticate(r))
+	})
+}
+
+// runAppWithDefaultAdminAuth runs the app without allowing unauthenticated admin access, i.e., unlike fxapptest.RunApp()
+func runAppWithDefaultAdminAuth(t *testing.T, builder fxapp.Builder, test func(client *fxapptest.HTTPClient)) {
+	var httpServerAddr fxapp.HTTPServerAddr
+	app, err := builder.
+		SetHTTPServerAddr("127.0.0.1:0").
+		Populate(&httpServerAddr).
+		Build()
+	require.NoError(t, err)
+
+	go app.Run()
+	<-app.Ready()
+	defer func() {
+		app.Shutdown()
+		<-app.Done()
+	}()
+
+	test(&fxapptest.HTTPClient{
+		Client:  &http.Client{Timeout: fxapptest.RunAppTimeout},
+		BaseURL: "http://" + httpServerAddr().String(),
+	})
+}
+
+func TestAdminEndpointsAreDeniedByDefault(t *testing.T) {
+	t.Parallel()
+
+	logs := fxapptest.NewLogCapture()
+	builder := fxapp.NewBuilder(fxapp.ID(ulids.MustNew()), fxapp.ReleaseID(ulids.MustNew())).
+		Invoke(func() {}).
+		LogWriter(logs)
+
+	runAppWithDefaultAdminAuth(t, builder, func(client *fxapptest.HTTPClient) {
+		for _, path := range []string{fxapp.ComponentsEndpoint, fxapp.HealthCheckResultsEndpoint, fxapp.DefaultPrometheusHTTPHandlerOpts().Endpoint} {
+			response, err := client.Get(path)
+			require.NoError(t, err)
+			response.Body.Close()
+			assert.Equal(t, http.StatusUnauthorized, response.StatusCode, path)
+		}
+
+		response, err := client.Get(fxapp.ReadyEvent)
+		require.NoError(t, err)
+		response.Body.Close()
+		assert.Equal(t, http.StatusOK, response.StatusCode, "public endpoints are not protected")
+
+		_, err = logs.WaitForEvent(fxapp.AdminAuthFailedEvent, fxapptest.RunAppTimeout)
+		assert.NoError(t, err)
+		assert.Empty(t, logs.FindEvents(fxapp.AdminUnauthenticatedEvent))
+	})
+}
+
+func TestAdminAuthDisabledEnvVar(t *testing.T) {
+	const EnvPrefix = "ADMIN_AUTH_DISABLED_TEST"
+	t.Setenv(fxapp.EnvPrefix(EnvPrefix).EnvVar("ADMIN_AUTH_DISABLED"), "true")
+
+	logs := fxapptest.NewLogCapture()
+	builder := fxapp.NewBuilder(fxapp.ID(ulids.MustNew()), fxapp.ReleaseID(ulids.MustNew())).
+		SetEnvPrefix(EnvPrefix).
+		Invoke(func() {}).
+		LogWriter(logs)
+
+	runAppWithDefaultAdminAuth(t, builder, func(client *fxapptest.HTTPClient) {
+		response, err := client.Get(fxapp.ComponentsEndpoint)
+		require.NoError(t, err)
+		response.Body.Close()
+		assert.Equal(t, http.StatusOK, response.StatusCode)
+
+		event, err := logs.WaitForEvent(fxapp.AdminUnauthenticatedEvent, fxapptest.RunAppTimeout)
+		require.NoError(t, err)
+		assert.Contains(t, string(event.Data), fxapp.ComponentsEndpoint)
+	})
+}
+
+func TestBuilder_AllowUnauthenticatedAdmin(t *testing.T) {
+	t.Parallel()
+
+	logs := fxapptest.NewLogCapture()
+	builder := fxapp.NewBuilder(fxapp.ID(ulids.MustNew()), fxapp.ReleaseID(ulids.MustNew())).
+		Invoke(func() {}).
+		AllowUnauthenticatedAdmin().
+		LogWriter(logs)
+
+	runAppWithDefaultAdminAuth(t, builder, func(client *fxapptest.HTTPClient) {
+		response, err := client.Get(fxapp.HealthCheckResultsEndpoint)
+		require.NoError(t, err)
+		response.Body.Close()
+		assert.Equal(t, http.StatusOK, response.StatusCode)
+
+		_, err = logs.WaitForEvent(fxapp.AdminUnauthenticatedEvent, fxapptest.RunAppTimeout)
+		assert.NoError(t, err)
+	})
+}
@@ -0,0 +1,208 @@
+/*
+ * Copyright (c) 2019 OysterPack, Inc.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ * http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package fxapp
+
+import (
+	"errors"
+	"fmt"
+	"github.com/oysterpack/andiamo/pkg/clock"
+	"github.com/oysterpack/andiamo/pkg/eventlog"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/rs/zerolog"
+	"io"
+	"net"
+	"net/http"
+	"sync"
+	"time"
+)
+
+// HTTPLimitViolationEvent is logged when an HTTP request violates one of the HTTP server limits - see `HTTPServerLimits`.
+//
+//	type Data struct {
+//		// one of: body_size, read_timeout, write_timeout
+//		Limit      string `json:"limit"`
+//		Method     string `json:"method"`
+//		Path       string `json:"path"`
+//		RemoteAddr string `json:"remote_addr"`
+//	}
+const HTTPLimitViolationEvent = "01DHZ5RS400PSEJ590DYNVTRT7"
+
+// HTTPLimitViolationsMetricID is the counter metric ID for HTTP server limit violations, labeled by limit and route path.
+const HTTPLimitViolationsMetricID = "U01DHZ5RS89ED7MYZ5AP0Z6E6GQ"
+
+// HTTP server limits
+const (
+	BodySizeLimit     = "body_size"
+	ReadTimeoutLimit  = "read_timeout"
+	WriteTimeoutLimit = "write_timeout"
+)
+
+// ErrInvalidHTTPServerLimits indicates the HTTP server limits are invalid
+var ErrInvalidHTTPServerLimits = errors.New("HTTP server limits must not be negative")
+
+// HTTPServerLimits is used to harden the app HTTP server. Zero values mean the limit is not set, i.e., the http.Server
+// setting is used.
+//
+// NOTE: the read and write timeouts do not apply to streaming routes, e.g., the event stream endpoint - see
+// `HTTPHandler.AsStream()`.
+type HTTPServerLimits struct {
+	// MaxRequestBodyBytes is the max request body size for all routes, which can be overridden per route via
+	// `HTTPHandler.WithMaxBodyBytes()`. If the request body is too large, then HTTP 413 is returned.
+	MaxRequestBodyBytes int64
+	ReadTimeout         time.Duration
+	WriteTimeout        time.Duration
+	IdleTimeout         time.Duration
+}
+
+func (limits HTTPServerLimits) validate() error {
+	if limits.MaxRequestBodyBytes < 0 || limits.ReadTimeout < 0 || limits.WriteTimeout < 0 || limits.IdleTimeout < 0 {
+		return fmt.Errorf("%s : %#v", ErrInvalidHTTPServerLimits, limits)
+	}
+	return nil
+}
+
+// apply overrides the server timeouts
+func (limits HTTPServerLimits) apply(server *http.Server) {
+	if limits.ReadTimeout > 0 {
+		server.ReadTimeout = limits.ReadTimeout
+	}
+	if limits.WriteTimeout > 0 {
+		server.WriteTimeout = limits.WriteTimeout
+	}
+	if limits.IdleTimeout > 0 {
+		server.IdleTimeout = limits.IdleTimeout
+	}
+}
+
+// WithMaxBodyBytes sets the max request body size for the HTTP route, which overrides the HTTP server limit - see
+// `HTTPServerLimits`
+func (h HTTPHandler) WithMaxBodyBytes(n int64) HTTPHandler {
+	h.MaxBodyBytes = n
+	return h
+}
+
+// AsStream marks the HTTP route as a streaming route, e.g., Server-Sent Events, which is exempt from the HTTP server read
+// and write timeouts
+func (h HTTPHandler) AsStream() HTTPHandler {
+	h.Streaming = true
+	return h
+}
+
+// httpLimitViolations logs and counts HTTP server limit violations
+type httpLimitViolations struct {
+	log     eventlog.Logger
+	counter *prometheus.CounterVec
+}
+
+func newHTTPLimitViolations(logger *zerolog.Logger, registerer prometheus.Registerer) (*httpLimitViolations, error) {
+	counter := prometheus.NewCounterVec(
+		prometheus.CounterOpts{Name: HTTPLimitViolationsMetricID, Help: "number of HTTP requests that violated an HTTP server limit"},
+		[]string{"limit", "path"},
+	)
+	if err := registerer.Register(counter); err != nil {
+		return nil, err
+	}
+	return &httpLimitViolations{
+		log:     eventlog.NewLogger(HTTPLimitViolationEvent, logger, zerolog.WarnLevel),
+		counter: counter,
+	}, nil
+}
+
+func (v *httpLimitViolations) violated(limit string, path string, request *http.Request) {
+	v.counter.WithLabelValues(limit, path).Inc()
+	v.log(httpLimitViolation{limit, request}, "HTTP server limit violation")
+}
+
+// middleware enforces the max request body size, and detects read and write timeouts.
+//
+// The server timeouts are enforced by the http.Server. The middleware detects read timeouts via request body read errors,
+// and write timeouts by comparing the time the handler took to the write timeout.
+func (v *httpLimitViolations) middleware(endpoint HTTPEndpoint, server *http.Server, clock clock.Clock) func(http.Handler) http.Handler {
+	maxBodyBytes := endpoint.MaxBodyBytes
+	return func(handler http.Handler) http.Handler {
+		return http.HandlerFunc(func(writer http.ResponseWriter, request *http.Request) {
+			if maxBodyBytes > 0 && request.ContentLength > maxBodyBytes {
+				v.violated(BodySizeLimit, endpoint.Path, request)
+				http.Error(writer, http.StatusText(http.StatusRequestEntityTooLarge), http.StatusRequestEntityTooLarge)
+				return
+			}
+			body := &httpLimitedBody{
+				ReadCloser: request.Body,
+				max:        maxBodyBytes,
+				violated: func(limit string) {
+					v.violated(limit, endpoint.Path, request)
+				},
+			}
+			if maxBodyBytes > 0 {
+				body.ReadCloser = http.MaxBytesReader(writer, request.Body, maxBodyBytes)
+			}
+			request.Body = body
+
+			if endpoint.Streaming {
+				// the server read and write deadlines are cleared - the read deadline would otherwise cancel the request
+				// context when it expires
+				controller := http.NewResponseController(writer)
+				controller.SetReadDeadline(time.Time{})
+				controller.SetWriteDeadline(time.Time{})
+				handler.ServeHTTP(writer, request)
+				return
+			}
+
+			start := clock.Now()
+			handler.ServeHTTP(writer, request)
+			if server.WriteTimeout > 0 && clock.Since(start) > server.WriteTimeout {
+				v.violated(WriteTimeoutLimit, endpoint.Path, request)
+			}
+		})
+	}
+}
+
+// httpLimitedBody reports the first body size or read timeout violation
+type httpLimitedBody struct {
+	io.ReadCloser
+	max      int64
+	read     int64
+	once     sync.Once
+	violated func(limit string)
+}
+
+func (b *httpLimitedBody) Read(p []byte) (int, error) {
+	n, err := b.ReadCloser.Read(p)
+	b.read += int64(n)
+	if err != nil && err != io.EOF {
+		switch e, ok := err.(net.Error); {
+		case ok && e.Timeout():
+			b.once.Do(func() { b.violated(ReadTimeoutLimit) })
+		case b.max > 0 && b.read >= b.max:
+			b.once.Do(func() { b.violated(BodySizeLimit) })
+		}
+	}
+	return n, err
+}
+
+type httpLimitViolation struct {
+	limit   string
+	request *http.Request
+}
+
+func (v httpLimitViolation) MarshalZerologObject(e *zerolog.Event) {
+	e.
+		Str("limit", v.limit).
+		Str("method", v.request.Method).
+		Str("path", v.request.URL.Path).
+		Str("remote_addr", v.request.RemoteAddr)
+}
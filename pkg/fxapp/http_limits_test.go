@@ -0,0 +1,184 @@
+/*
+ * Copyright (c) 2019 OysterPack, Inc.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ * http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package fxapp_test
+
+import (
+	"bytes"
+	"github.com/oysterpack/andiamo/pkg/clock"
+	"github.com/oysterpack/andiamo/pkg/eventlog"
+	"github.com/oysterpack/andiamo/pkg/fxapp"
+	"github.com/oysterpack/andiamo/pkg/fxapptest"
+	"github.com/oysterpack/andiamo/pkg/ulids"
+	"github.com/prometheus/client_golang/prometheus"
+	dto "github.com/prometheus/client_model/go"
+	"github.com/rs/zerolog"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"testing"
+	"time"
+)
+
+func TestBuilder_SetHTTPServerLimits(t *testing.T) {
+	t.Parallel()
+
+	readBody := func(writer http.ResponseWriter, request *http.Request) {
+		if _, err := ioutil.ReadAll(request.Body); err != nil {
+			http.Error(writer, err.Error(), http.StatusRequestEntityTooLarge)
+		}
+	}
+	fakeClock := clock.NewFake(time.Now())
+	logs := fxapptest.NewLogCapture()
+	var gatherer prometheus.Gatherer
+	builder := fxapp.NewBuilder(fxapp.ID(ulids.MustNew()), fxapp.ReleaseID(ulids.MustNew())).
+		Provide(
+			func() fxapp.HTTPHandler { return fxapp.NewHTTPRoute(http.MethodPost, "/small", readBody) },
+			func() fxapp.HTTPHandler {
+				return fxapp.NewHTTPRoute(http.MethodPost, "/large", readBody).WithMaxBodyBytes(1024)
+			},
+			func() fxapp.HTTPHandler {
+				return fxapp.NewHTTPRoute(http.MethodGet, "/slow", func(writer http.ResponseWriter, request *http.Request) {
+					fakeClock.Advance(time.Minute)
+				})
+			},
+		).
+		Invoke(func() {}).
+		SetClock(fakeClock).
+		SetHTTPServerLimits(fxapp.HTTPServerLimits{
+			MaxRequestBodyBytes: 16,
+			WriteTimeout:        30 * time.Second,
+		}).
+		LogWriter(logs).
+		Populate(&gatherer)
+
+	fxapptest.RunApp(t, builder, func(app fxapp.App, client *fxapptest.HTTPClient) {
+		post := func(path string, body io.Reader) *http.Response {
+			response, err := client.Post(client.URL(path), "text/plain", body)
+			require.NoError(t, err)
+			response.Body.Close()
+			return response
+		}
+		// the request body is sent chunked, i.e., without a content length
+		type chunkedBody struct{ io.Reader }
+
+		t.Run("body size", func(t *testing.T) {
+			body := bytes.Repeat([]byte("a"), 32)
+			assert.Equal(t, http.StatusRequestEntityTooLarge, post("/small", bytes.NewReader(body)).StatusCode)
+			assert.Equal(t, http.StatusRequestEntityTooLarge, post("/small", chunkedBody{bytes.NewReader(body)}).StatusCode)
+			assert.Equal(t, http.StatusOK, post("/small", bytes.NewReader(body[:16])).StatusCode)
+			// the route limit overrides the server limit
+			assert.Equal(t, http.StatusOK, post("/large", bytes.NewReader(body)).StatusCode)
+
+			events := logs.FindEvents(fxapp.HTTPLimitViolationEvent,
+				fxapptest.Field("d.limit", fxapp.BodySizeLimit),
+				fxapptest.Field("d.path", "/small"),
+				fxapptest.Field("d.method", http.MethodPost),
+			)
+			assert.Len(t, events, 2)
+		})
+
+		t.Run("write timeout", func(t *testing.T) {
+			response, err := client.Get("/slow")
+			require.NoError(t, err)
+			response.Body.Close()
+			fxapptest.AssertEventLogged(t, logs, fxapp.HTTPLimitViolationEvent,
+				fxapptest.Field("d.limit", fxapp.WriteTimeoutLimit),
+				fxapptest.Field("d.path", "/slow"),
+			)
+		})
+
+		t.Run("violations are counted", func(t *testing.T) {
+			mfs, err := gatherer.Gather()
+			require.NoError(t, err)
+			mf := fxapp.FindMetricFamily(mfs, func(mf *dto.MetricFamily) bool {
+				return mf.GetName() == fxapp.HTTPLimitViolationsMetricID
+			})
+			require.NotNil(t, mf)
+			counts := make(map[string]float64)
+			for _, metric := range mf.Metric {
+				var limit, path string
+				for _, label := range metric.Label {
+					switch label.GetName() {
+					case "limit":
+						limit = label.GetValue()
+					case "path":
+						path = label.GetValue()
+					}
+				}
+				counts[limit+" "+path] = metric.GetCounter().GetValue()
+			}
+			assert.Equal(t, map[string]float64{
+				fxapp.BodySizeLimit + " /small":    2,
+				fxapp.WriteTimeoutLimit + " /slow": 1,
+			}, counts)
+		})
+	})
+}
+
+func TestBuilder_SetHTTPServerLimits_Invalid(t *testing.T) {
+	t.Parallel()
+
+	_, err := fxapp.NewBuilder(fxapp.ID(ulids.MustNew()), fxapp.ReleaseID(ulids.MustNew())).
+		Invoke(func() {}).
+		SetHTTPServerLimits(fxapp.HTTPServerLimits{IdleTimeout: -time.Second}).
+		LogWriter(ioutil.Discard).
+		Build()
+	if assert.Error(t, err) {
+		assert.Contains(t, err.Error(), fxapp.ErrInvalidHTTPServerLimits.Error())
+	}
+
+	_, err = fxapp.NewBuilder(fxapp.ID(ulids.MustNew()), fxapp.ReleaseID(ulids.MustNew())).
+		Provide(func() fxapp.HTTPHandler {
+			return fxapp.NewHTTPRoute(http.MethodPost, "/foo", func(http.ResponseWriter, *http.Request) {}).WithMaxBodyBytes(-1)
+		}).
+		Invoke(func() {}).
+		LogWriter(ioutil.Discard).
+		Build()
+	if assert.Error(t, err) {
+		assert.Contains(t, err.Error(), fxapp.ErrInvalidHTTPRoute.Error())
+	}
+}
+
+func TestHTTPServerLimits_StreamingRoutesAreExempt(t *testing.T) {
+	t.Parallel()
+
+	FooEvent := ulids.MustNew().String()
+	var logger *zerolog.Logger
+	builder := fxapp.NewBuilder(fxapp.ID(ulids.MustNew()), fxapp.ReleaseID(ulids.MustNew())).
+		Invoke(func() {}).
+		SetHTTPServerLimits(fxapp.HTTPServerLimits{
+			ReadTimeout:  50 * time.Millisecond,
+			WriteTimeout: 50 * time.Millisecond,
+		}).
+		LogWriter(ioutil.Discard).
+		Populate(&logger)
+
+	fxapptest.RunApp(t, builder, func(app fxapp.App, client *fxapptest.HTTPClient) {
+		messages := connectEventStream(t, client.URL(fxapp.EventStreamEndpoint+"?event="+FooEvent))
+		time.Sleep(200 * time.Millisecond)
+		eventlog.NewLogger(FooEvent, logger, zerolog.InfoLevel)(nil, "foo")
+		select {
+		case msg, ok := <-messages:
+			require.True(t, ok, "*** event stream was closed")
+			assert.Equal(t, FooEvent, msg.event)
+		case <-time.After(5 * time.Second):
+			t.Fatal("*** timed out waiting for event")
+		}
+	})
+}
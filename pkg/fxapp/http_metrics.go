@@ -0,0 +1,109 @@
+/*
+ * Copyright (c) 2019 OysterPack, Inc.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ * http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package fxapp
+
+import (
+	"github.com/oysterpack/andiamo/pkg/clock"
+	"github.com/prometheus/client_golang/prometheus"
+	"net/http"
+	"strconv"
+)
+
+// HTTP server RED metrics, i.e., request rate, errors, and duration - labeled by route path and method. The request
+// counter is also labeled by the response status code.
+const (
+	HTTPRequestsMetricID        = "U01DJDVE2WJS7SNM2RRMKXH66NE"
+	HTTPRequestDurationMetricID = "U01DJDVE2WJ8QR27VEXJGG45K65"
+)
+
+// httpRequestMetrics collects the HTTP server RED metrics per route
+type httpRequestMetrics struct {
+	requests *prometheus.CounterVec
+	duration *prometheus.HistogramVec
+}
+
+func newHTTPRequestMetrics(registerer prometheus.Registerer) (*httpRequestMetrics, error) {
+	metrics := &httpRequestMetrics{
+		requests: prometheus.NewCounterVec(
+			prometheus.CounterOpts{Name: HTTPRequestsMetricID, Help: "HTTP server requests"},
+			[]string{"path", "method", "code"},
+		),
+		duration: prometheus.NewHistogramVec(
+			prometheus.HistogramOpts{Name: HTTPRequestDurationMetricID, Help: "HTTP server request duration in seconds"},
+			[]string{"path", "method"},
+		),
+	}
+	for _, c := range []prometheus.Collector{metrics.requests, metrics.duration} {
+		if err := registerer.Register(c); err != nil {
+			return nil, err
+		}
+	}
+	return metrics, nil
+}
+
+// middleware records the request metrics. The route path is used as the label, i.e., not the request URL path, which
+// keeps the label cardinality bounded.
+func (m *httpRequestMetrics) middleware(endpoint HTTPEndpoint, clock clock.Clock) func(http.Handler) http.Handler {
+	return func(handler http.Handler) http.Handler {
+		return http.HandlerFunc(func(writer http.ResponseWriter, request *http.Request) {
+			start := clock.Now()
+			recorder := &httpStatusRecorder{ResponseWriter: writer}
+			handler.ServeHTTP(recorder, request)
+			m.requests.WithLabelValues(endpoint.Path, request.Method, strconv.Itoa(recorder.status())).Inc()
+			m.duration.WithLabelValues(endpoint.Path, request.Method).Observe(clock.Since(start).Seconds())
+		})
+	}
+}
+
+// httpStatusRecorder records the response status code
+type httpStatusRecorder struct {
+	http.ResponseWriter
+	code int
+}
+
+func (r *httpStatusRecorder) WriteHeader(code int) {
+	if r.code == 0 {
+		r.code = code
+	}
+	r.ResponseWriter.WriteHeader(code)
+}
+
+func (r *httpStatusRecorder) Write(p []byte) (int, error) {
+	if r.code == 0 {
+		r.code = http.StatusOK
+	}
+	return r.ResponseWriter.Write(p)
+}
+
+// Flush implements http.Flusher, which is required by streaming routes
+func (r *httpStatusRecorder) Flush() {
+	if flusher, ok := r.ResponseWriter.(http.Flusher); ok {
+		flusher.Flush()
+	}
+}
+
+// Unwrap is used by http.ResponseController to access the underlying response writer
+func (r *httpStatusRecorder) Unwrap() http.ResponseWriter {
+	return r.ResponseWriter
+}
+
+func (r *httpStatusRecorder) status() int {
+	if r.code == 0 {
+		return http.StatusOK
+	}
+	return r.code
+}
@@ -0,0 +1,98 @@
+/*
+ * Copyright (c) 2019 OysterPack, Inc.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ * http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package fxapp_test
+
+import (
+	"github.com/oysterpack/andiamo/pkg/fxapp"
+	"github.com/oysterpack/andiamo/pkg/fxapptest"
+	"github.com/oysterpack/andiamo/pkg/ulids"
+	"github.com/prometheus/client_golang/prometheus"
+	dto "github.com/prometheus/client_model/go"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"net/http"
+	"testing"
+)
+
+func TestHTTPRequestMetrics(t *testing.T) {
+	t.Parallel()
+
+	var gatherer prometheus.Gatherer
+	builder := fxapp.NewBuilder(fxapp.ID(ulids.MustNew()), fxapp.ReleaseID(ulids.MustNew())).
+		Provide(
+			func() fxapp.HTTPHandler {
+				return fxapp.NewHTTPRoute(http.MethodGet, "/ok", func(writer http.ResponseWriter, request *http.Request) {
+					writer.Write([]byte("OK"))
+				})
+			},
+			func() fxapp.HTTPHandler {
+				return fxapp.NewHTTPRoute(http.MethodGet, "/fail", func(writer http.ResponseWriter, request *http.Request) {
+					http.Error(writer, "BOOM", http.StatusInternalServerError)
+				})
+			},
+		).
+		Invoke(func() {}).
+		Populate(&gatherer)
+
+	fxapptest.RunApp(t, builder, func(app fxapp.App, client *fxapptest.HTTPClient) {
+		for _, path := range []string{"/ok", "/ok", "/fail"} {
+			response, err := client.Get(path)
+			require.NoError(t, err)
+			response.Body.Close()
+		}
+
+		mfs, err := gatherer.Gather()
+		require.NoError(t, err)
+
+		t.Run("requests are counted by path, method, and status code", func(t *testing.T) {
+			mf := fxapp.FindMetricFamily(mfs, func(mf *dto.MetricFamily) bool {
+				return mf.GetName() == fxapp.HTTPRequestsMetricID
+			})
+			require.NotNil(t, mf)
+			counts := make(map[string]float64)
+			for _, metric := range mf.Metric {
+				labels := make(map[string]string)
+				for _, label := range metric.Label {
+					labels[label.GetName()] = label.GetValue()
+				}
+				counts[labels["method"]+" "+labels["path"]+" "+labels["code"]] = metric.GetCounter().GetValue()
+			}
+			assert.Equal(t, float64(2), counts["GET /ok 200"])
+			assert.Equal(t, float64(1), counts["GET /fail 500"])
+		})
+
+		t.Run("request durations are observed", func(t *testing.T) {
+			mf := fxapp.FindMetricFamily(mfs, func(mf *dto.MetricFamily) bool {
+				return mf.GetName() == fxapp.HTTPRequestDurationMetricID
+			})
+			require.NotNil(t, mf)
+			var count uint64
+			for _, metric := range mf.Metric {
+				count += metric.GetHistogram().GetSampleCount()
+			}
+			assert.True(t, count >= 3)
+		})
+
+		t.Run("app start duration is recorded", func(t *testing.T) {
+			mf := fxapp.FindMetricFamily(mfs, func(mf *dto.MetricFamily) bool {
+				return mf.GetName() == fxapp.AppStartDurationMetricID
+			})
+			require.NotNil(t, mf)
+			assert.True(t, mf.Metric[0].GetGauge().GetValue() > 0)
+		})
+	})
+}
@@ -0,0 +1,281 @@
+/*
+ * Copyright (c) 2019 OysterPack, Inc.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ * http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package fxapp
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// HTTP middleware related errors
+var (
+	ErrInvalidCORSOpts            = errors.New("CORS `AllowedOrigins` must not be empty, `MaxAge` must not be negative, and `AllowCredentials` cannot be used with the \"*\" origin")
+	ErrInvalidSecurityHeadersOpts = errors.New("security headers `HSTSMaxAge` must not be negative")
+)
+
+// CORSOpts is used to configure the CORS middleware - see `NewCORSMiddleware()`
+type CORSOpts struct {
+	// AllowedOrigins are the origins that are allowed to make cross-origin requests, e.g., "https://example.com".
+	// "*" allows all origins.
+	AllowedOrigins []string
+	// AllowedMethods defaults to GET, HEAD, and POST
+	AllowedMethods []string
+	// AllowedHeaders are the request headers that are allowed, which defaults to Accept, Authorization, and Content-Type.
+	// "*" allows all headers.
+	AllowedHeaders []string
+	// ExposedHeaders are the response headers that the browser is allowed to access
+	ExposedHeaders []string
+	// AllowCredentials indicates whether requests can include credentials, e.g., cookies and authorization headers.
+	AllowCredentials bool
+	// MaxAge is how long preflight responses can be cached. If zero, then the header is not set.
+	MaxAge time.Duration
+}
+
+func (opts CORSOpts) validate() error {
+	if len(opts.AllowedOrigins) == 0 || opts.MaxAge < 0 || (opts.AllowCredentials && containsString(opts.AllowedOrigins, "*")) {
+		return fmt.Errorf("%s : %#v", ErrInvalidCORSOpts, opts)
+	}
+	return nil
+}
+
+func (opts CORSOpts) withDefaults() CORSOpts {
+	if len(opts.AllowedMethods) == 0 {
+		opts.AllowedMethods = []string{http.MethodGet, http.MethodHead, http.MethodPost}
+	}
+	if len(opts.AllowedHeaders) == 0 {
+		opts.AllowedHeaders = []string{"Accept", "Authorization", "Content-Type"}
+	}
+	return opts
+}
+
+// NewCORSMiddleware returns middleware that implements Cross-Origin Resource Sharing (CORS).
+//
+//   - requests that do not specify the Origin header are passed through as is
+//   - preflight requests, i.e., OPTIONS requests that specify the Access-Control-Request-Method header, are handled by the
+//     middleware. If the origin, method, or headers are not allowed, then HTTP 403 is returned. Otherwise, HTTP 204 is
+//     returned.
+//   - if the origin is allowed, then the CORS response headers are set. Otherwise, the request is passed through without
+//     the CORS response headers, i.e., the browser will block the response.
+//
+// NOTE: the options are assumed to be valid
+func NewCORSMiddleware(opts CORSOpts) func(http.Handler) http.Handler {
+	opts = opts.withDefaults()
+	allowAllOrigins := containsString(opts.AllowedOrigins, "*")
+	allowAllHeaders := containsString(opts.AllowedHeaders, "*")
+	allowedMethods := strings.ToUpper(strings.Join(opts.AllowedMethods, ", "))
+	allowedHeaders := strings.Join(opts.AllowedHeaders, ", ")
+	exposedHeaders := strings.Join(opts.ExposedHeaders, ", ")
+
+	originAllowed := func(origin string) bool {
+		if allowAllOrigins {
+			return true
+		}
+		for _, allowed := range opts.AllowedOrigins {
+			if strings.EqualFold(allowed, origin) {
+				return true
+			}
+		}
+		return false
+	}
+	methodAllowed := func(method string) bool {
+		for _, allowed := range opts.AllowedMethods {
+			if strings.EqualFold(allowed, method) {
+				return true
+			}
+		}
+		return false
+	}
+	headersAllowed := func(headers string) bool {
+		if allowAllHeaders || strings.TrimSpace(headers) == "" {
+			return true
+		}
+		for _, header := range strings.Split(headers, ",") {
+			allowed := false
+			for _, allowedHeader := range opts.AllowedHeaders {
+				if strings.EqualFold(allowedHeader, strings.TrimSpace(header)) {
+					allowed = true
+					break
+				}
+			}
+			if !allowed {
+				return false
+			}
+		}
+		return true
+	}
+
+	return func(handler http.Handler) http.Handler {
+		return http.HandlerFunc(func(writer http.ResponseWriter, request *http.Request) {
+			origin := request.Header.Get("Origin")
+			if origin == "" {
+				handler.ServeHTTP(writer, request)
+				return
+			}
+			header := writer.Header()
+			header.Add("Vary", "Origin")
+			preflight := request.Method == http.MethodOptions && request.Header.Get("Access-Control-Request-Method") != ""
+			if preflight {
+				header.Add("Vary", "Access-Control-Request-Method")
+				header.Add("Vary", "Access-Control-Request-Headers")
+			}
+
+			allowed := originAllowed(origin)
+			if allowed {
+				if allowAllOrigins && !opts.AllowCredentials {
+					header.Set("Access-Control-Allow-Origin", "*")
+				} else {
+					header.Set("Access-Control-Allow-Origin", origin)
+				}
+				if opts.AllowCredentials {
+					header.Set("Access-Control-Allow-Credentials", "true")
+				}
+			}
+
+			if !preflight {
+				if allowed && exposedHeaders != "" {
+					header.Set("Access-Control-Expose-Headers", exposedHeaders)
+				}
+				handler.ServeHTTP(writer, request)
+				return
+			}
+
+			if !allowed || !methodAllowed(request.Header.Get("Access-Control-Request-Method")) || !headersAllowed(request.Header.Get("Access-Control-Request-Headers")) {
+				header.Del("Access-Control-Allow-Origin")
+				header.Del("Access-Control-Allow-Credentials")
+				http.Error(writer, http.StatusText(http.StatusForbidden), http.StatusForbidden)
+				return
+			}
+			header.Set("Access-Control-Allow-Methods", allowedMethods)
+			if allowAllHeaders {
+				header.Set("Access-Control-Allow-Headers", request.Header.Get("Access-Control-Request-Headers"))
+			} else {
+				header.Set("Access-Control-Allow-Headers", allowedHeaders)
+			}
+			if opts.MaxAge > 0 {
+				header.Set("Access-Control-Max-Age", strconv.Itoa(int(opts.MaxAge.Seconds())))
+			}
+			writer.WriteHeader(http.StatusNoContent)
+		})
+	}
+}
+
+// SecurityHeadersOpts is used to configure the security headers middleware - see `NewSecurityHeadersMiddleware()`.
+//
+// Blank header values are not set.
+type SecurityHeadersOpts struct {
+	// HSTSMaxAge is the Strict-Transport-Security max-age. If zero, then the header is not set.
+	//
+	// The header is only set on HTTPS requests, i.e., if the request was received over TLS or the X-Forwarded-Proto
+	// header is "https", e.g., when TLS is terminated by a load balancer.
+	HSTSMaxAge            time.Duration
+	HSTSIncludeSubDomains bool
+
+	// ContentTypeOptions is the X-Content-Type-Options header value, e.g., "nosniff"
+	ContentTypeOptions string
+	// FrameOptions is the X-Frame-Options header value, e.g., "DENY"
+	FrameOptions string
+	// ReferrerPolicy is the Referrer-Policy header value, e.g., "no-referrer"
+	ReferrerPolicy string
+	// ContentSecurityPolicy is the Content-Security-Policy header value
+	ContentSecurityPolicy string
+}
+
+// DefaultSecurityHeadersOpts constructs a new SecurityHeadersOpts with the following options:
+//   - Strict-Transport-Security: max-age=31536000; includeSubDomains
+//   - X-Content-Type-Options: nosniff
+//   - X-Frame-Options: DENY
+//   - Referrer-Policy: no-referrer
+//
+// NOTE: Content-Security-Policy is not set by default because the policy depends on the content that is served, e.g.,
+// the admin UI uses inline scripts and styles.
+func DefaultSecurityHeadersOpts() SecurityHeadersOpts {
+	return SecurityHeadersOpts{
+		HSTSMaxAge:            365 * 24 * time.Hour,
+		HSTSIncludeSubDomains: true,
+		ContentTypeOptions:    "nosniff",
+		FrameOptions:          "DENY",
+		ReferrerPolicy:        "no-referrer",
+	}
+}
+
+func (opts SecurityHeadersOpts) validate() error {
+	if opts.HSTSMaxAge < 0 {
+		return fmt.Errorf("%s : %s", ErrInvalidSecurityHeadersOpts, opts.HSTSMaxAge)
+	}
+	return nil
+}
+
+// NewSecurityHeadersMiddleware returns middleware that sets the standard security response headers.
+//
+// NOTE: the options are assumed to be valid
+func NewSecurityHeadersMiddleware(opts SecurityHeadersOpts) func(http.Handler) http.Handler {
+	var hsts string
+	if opts.HSTSMaxAge > 0 {
+		hsts = fmt.Sprintf("max-age=%d", int(opts.HSTSMaxAge.Seconds()))
+		if opts.HSTSIncludeSubDomains {
+			hsts += "; includeSubDomains"
+		}
+	}
+	headers := map[string]string{
+		"X-Content-Type-Options":  opts.ContentTypeOptions,
+		"X-Frame-Options":         opts.FrameOptions,
+		"Referrer-Policy":         opts.ReferrerPolicy,
+		"Content-Security-Policy": opts.ContentSecurityPolicy,
+	}
+	for name, value := range headers {
+		if value == "" {
+			delete(headers, name)
+		}
+	}
+
+	return func(handler http.Handler) http.Handler {
+		return http.HandlerFunc(func(writer http.ResponseWriter, request *http.Request) {
+			header := writer.Header()
+			for name, value := range headers {
+				header.Set(name, value)
+			}
+			if hsts != "" && (request.TLS != nil || strings.EqualFold(request.Header.Get("X-Forwarded-Proto"), "https")) {
+				header.Set("Strict-Transport-Security", hsts)
+			}
+			handler.ServeHTTP(writer, request)
+		})
+	}
+}
+
+// httpServerMiddleware wraps the HTTP server handler, i.e., it is applied to all requests before they are routed. The
+// first middleware is the outermost handler.
+type httpServerMiddleware []func(http.Handler) http.Handler
+
+func (middleware httpServerMiddleware) wrap(handler http.Handler) http.Handler {
+	for i := len(middleware) - 1; i >= 0; i-- {
+		handler = middleware[i](handler)
+	}
+	return handler
+}
+
+func containsString(values []string, s string) bool {
+	for _, value := range values {
+		if value == s {
+			return true
+		}
+	}
+	return false
+}
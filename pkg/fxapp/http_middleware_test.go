@@ -0,0 +1,220 @@
+/*
+ * Copyright (c) 2019 OysterPack, Inc.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ * http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package fxapp_test
+
+import (
+	"crypto/tls"
+	"github.com/oysterpack/andiamo/pkg/fxapp"
+	"github.com/oysterpack/andiamo/pkg/fxapptest"
+	"github.com/oysterpack/andiamo/pkg/ulids"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+func TestBuilder_EnableCORSAndSecurityHeaders(t *testing.T) {
+	t.Parallel()
+
+	ok := func(writer http.ResponseWriter, request *http.Request) {}
+	builder := fxapp.NewBuilder(fxapp.ID(ulids.MustNew()), fxapp.ReleaseID(ulids.MustNew())).
+		Provide(func() fxapp.HTTPHandler { return fxapp.NewHTTPRoute(http.MethodPut, "/foo", ok) }).
+		Invoke(func() {}).
+		EnableCORS(fxapp.CORSOpts{
+			AllowedOrigins: []string{"https://example.com"},
+			AllowedMethods: []string{http.MethodGet, http.MethodPut},
+			MaxAge:         time.Hour,
+		}).
+		EnableSecurityHeaders(fxapp.DefaultSecurityHeadersOpts()).
+		LogWriter(ioutil.Discard)
+
+	fxapptest.RunApp(t, builder, func(app fxapp.App, client *fxapptest.HTTPClient) {
+		send := func(method, path string, headers map[string]string) *http.Response {
+			request, err := http.NewRequest(method, client.URL(path), nil)
+			require.NoError(t, err)
+			for name, value := range headers {
+				request.Header.Set(name, value)
+			}
+			response, err := client.Do(request)
+			require.NoError(t, err)
+			response.Body.Close()
+			return response
+		}
+
+		t.Run("security headers are set on all responses", func(t *testing.T) {
+			for _, path := range []string{fxapp.ReadyEvent, "/foo", "/not-found"} {
+				response := send(http.MethodGet, path, nil)
+				assert.Equal(t, "nosniff", response.Header.Get("X-Content-Type-Options"), path)
+				assert.Equal(t, "DENY", response.Header.Get("X-Frame-Options"), path)
+				assert.Equal(t, "no-referrer", response.Header.Get("Referrer-Policy"), path)
+				// the request was not sent over HTTPS
+				assert.Empty(t, response.Header.Get("Strict-Transport-Security"), path)
+			}
+			response := send(http.MethodGet, fxapp.ReadyEvent, map[string]string{"X-Forwarded-Proto": "https"})
+			assert.Equal(t, "max-age=31536000; includeSubDomains", response.Header.Get("Strict-Transport-Security"))
+		})
+
+		t.Run("preflight requests are handled before routing", func(t *testing.T) {
+			response := send(http.MethodOptions, "/foo", map[string]string{
+				"Origin":                        "https://example.com",
+				"Access-Control-Request-Method": http.MethodPut,
+			})
+			assert.Equal(t, http.StatusNoContent, response.StatusCode)
+			assert.Equal(t, "https://example.com", response.Header.Get("Access-Control-Allow-Origin"))
+			assert.Equal(t, "GET, PUT", response.Header.Get("Access-Control-Allow-Methods"))
+			assert.Equal(t, "3600", response.Header.Get("Access-Control-Max-Age"))
+			assert.Equal(t, "nosniff", response.Header.Get("X-Content-Type-Options"))
+		})
+
+		t.Run("cross-origin request", func(t *testing.T) {
+			response := send(http.MethodPut, "/foo", map[string]string{"Origin": "https://example.com"})
+			assert.Equal(t, http.StatusOK, response.StatusCode)
+			assert.Equal(t, "https://example.com", response.Header.Get("Access-Control-Allow-Origin"))
+
+			response = send(http.MethodPut, "/foo", map[string]string{"Origin": "https://evil.com"})
+			assert.Equal(t, http.StatusOK, response.StatusCode)
+			assert.Empty(t, response.Header.Get("Access-Control-Allow-Origin"))
+		})
+	})
+}
+
+func TestBuilder_EnableCORS_InvalidOpts(t *testing.T) {
+	t.Parallel()
+
+	for _, opts := range []fxapp.CORSOpts{
+		{},
+		{AllowedOrigins: []string{"*"}, AllowCredentials: true},
+		{AllowedOrigins: []string{"*"}, MaxAge: -time.Second},
+	} {
+		_, err := fxapp.NewBuilder(fxapp.ID(ulids.MustNew()), fxapp.ReleaseID(ulids.MustNew())).
+			Invoke(func() {}).
+			EnableCORS(opts).
+			LogWriter(ioutil.Discard).
+			Build()
+		if assert.Error(t, err, "%#v", opts) {
+			assert.Contains(t, err.Error(), fxapp.ErrInvalidCORSOpts.Error())
+		}
+	}
+
+	_, err := fxapp.NewBuilder(fxapp.ID(ulids.MustNew()), fxapp.ReleaseID(ulids.MustNew())).
+		Invoke(func() {}).
+		EnableSecurityHeaders(fxapp.SecurityHeadersOpts{HSTSMaxAge: -time.Second}).
+		LogWriter(ioutil.Discard).
+		Build()
+	if assert.Error(t, err) {
+		assert.Contains(t, err.Error(), fxapp.ErrInvalidSecurityHeadersOpts.Error())
+	}
+}
+
+func TestNewCORSMiddleware(t *testing.T) {
+	t.Parallel()
+
+	handler := func(opts fxapp.CORSOpts) http.Handler {
+		return fxapp.NewCORSMiddleware(opts)(http.HandlerFunc(func(writer http.ResponseWriter, request *http.Request) {
+			writer.WriteHeader(http.StatusOK)
+		}))
+	}
+	serve := func(handler http.Handler, method string, headers map[string]string) *httptest.ResponseRecorder {
+		request := httptest.NewRequest(method, "/", nil)
+		for name, value := range headers {
+			request.Header.Set(name, value)
+		}
+		response := httptest.NewRecorder()
+		handler.ServeHTTP(response, request)
+		return response
+	}
+
+	t.Run("same origin requests are passed through", func(t *testing.T) {
+		response := serve(handler(fxapp.CORSOpts{AllowedOrigins: []string{"*"}}), http.MethodGet, nil)
+		assert.Equal(t, http.StatusOK, response.Code)
+		assert.Empty(t, response.Header().Get("Access-Control-Allow-Origin"))
+		assert.Empty(t, response.Header().Get("Vary"))
+	})
+
+	t.Run("all origins", func(t *testing.T) {
+		response := serve(handler(fxapp.CORSOpts{AllowedOrigins: []string{"*"}, ExposedHeaders: []string{"X-Request-Id"}}), http.MethodGet, map[string]string{"Origin": "https://example.com"})
+		assert.Equal(t, "*", response.Header().Get("Access-Control-Allow-Origin"))
+		assert.Equal(t, "X-Request-Id", response.Header().Get("Access-Control-Expose-Headers"))
+		assert.Equal(t, "Origin", response.Header().Get("Vary"))
+	})
+
+	t.Run("credentials", func(t *testing.T) {
+		response := serve(handler(fxapp.CORSOpts{AllowedOrigins: []string{"https://example.com"}, AllowCredentials: true}), http.MethodGet, map[string]string{"Origin": "https://example.com"})
+		assert.Equal(t, "https://example.com", response.Header().Get("Access-Control-Allow-Origin"))
+		assert.Equal(t, "true", response.Header().Get("Access-Control-Allow-Credentials"))
+	})
+
+	t.Run("preflight", func(t *testing.T) {
+		h := handler(fxapp.CORSOpts{AllowedOrigins: []string{"https://example.com"}})
+		preflight := func(origin, method, headers string) *httptest.ResponseRecorder {
+			return serve(h, http.MethodOptions, map[string]string{
+				"Origin":                         origin,
+				"Access-Control-Request-Method":  method,
+				"Access-Control-Request-Headers": headers,
+			})
+		}
+
+		response := preflight("https://example.com", http.MethodPost, "content-type, authorization")
+		assert.Equal(t, http.StatusNoContent, response.Code)
+		assert.Equal(t, "GET, HEAD, POST", response.Header().Get("Access-Control-Allow-Methods"))
+		assert.Equal(t, "Accept, Authorization, Content-Type", response.Header().Get("Access-Control-Allow-Headers"))
+		assert.Empty(t, response.Header().Get("Access-Control-Max-Age"))
+
+		for _, response := range []*httptest.ResponseRecorder{
+			preflight("https://evil.com", http.MethodPost, ""),
+			preflight("https://example.com", http.MethodDelete, ""),
+			preflight("https://example.com", http.MethodPost, "X-Custom"),
+		} {
+			assert.Equal(t, http.StatusForbidden, response.Code)
+			assert.Empty(t, response.Header().Get("Access-Control-Allow-Origin"))
+		}
+	})
+
+	t.Run("all headers", func(t *testing.T) {
+		response := serve(handler(fxapp.CORSOpts{AllowedOrigins: []string{"*"}, AllowedHeaders: []string{"*"}}), http.MethodOptions, map[string]string{
+			"Origin":                         "https://example.com",
+			"Access-Control-Request-Method":  http.MethodGet,
+			"Access-Control-Request-Headers": "X-Custom",
+		})
+		assert.Equal(t, http.StatusNoContent, response.Code)
+		assert.Equal(t, "X-Custom", response.Header().Get("Access-Control-Allow-Headers"))
+	})
+}
+
+func TestNewSecurityHeadersMiddleware(t *testing.T) {
+	t.Parallel()
+
+	handler := fxapp.NewSecurityHeadersMiddleware(fxapp.SecurityHeadersOpts{
+		HSTSMaxAge:            time.Hour,
+		ContentSecurityPolicy: "default-src 'self'",
+	})(http.HandlerFunc(func(writer http.ResponseWriter, request *http.Request) {}))
+
+	request := httptest.NewRequest(http.MethodGet, "/", nil)
+	request.TLS = &tls.ConnectionState{}
+	response := httptest.NewRecorder()
+	handler.ServeHTTP(response, request)
+	assert.Equal(t, "max-age=3600", response.Header().Get("Strict-Transport-Security"))
+	assert.Equal(t, "default-src 'self'", response.Header().Get("Content-Security-Policy"))
+	// blank headers are not set
+	for _, header := range []string{"X-Content-Type-Options", "X-Frame-Options", "Referrer-Policy"} {
+		_, ok := response.Header()[header]
+		assert.False(t, ok, header)
+	}
+}
@@ -0,0 +1,194 @@
+/*
+ * Copyright (c) 2019 OysterPack, Inc.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ * http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package fxapp
+
+import (
+	"errors"
+	"fmt"
+	"github.com/rs/zerolog"
+	"go.uber.org/multierr"
+	"net/http"
+	"sort"
+	"strings"
+)
+
+// HTTPRoutesEvent is logged when the HTTP server is starting. It logs the HTTP server route table, sorted by path and
+// method.
+//
+//	type Data struct {
+//		Routes []struct{
+//			// "*" means all HTTP methods are handled
+//			Method     string `json:"method"`
+//			Path       string `json:"path"`
+//			// the number of route middleware that wrap the handler, i.e., excluding the app's auth and limits middleware
+//			Middleware int    `json:"middleware"`
+//			// true if the route requires admin authentication - see `Authenticator`
+//			Admin      bool   `json:"admin"`
+//		} `json:"routes"`
+//	}
+const HTTPRoutesEvent = "01DHXWJDM0V2WSYSPZE4J4F5XX"
+
+// HTTP route related errors
+var (
+	ErrInvalidHTTPRoute  = errors.New("HTTP route is invalid")
+	ErrHTTPRouteConflict = errors.New("HTTP route conflicts with another registered route")
+)
+
+// NewHTTPRoute constructs a new HTTPHandler for the specified HTTP method and path. The handler is wrapped by the
+// middleware, where the first middleware is the outermost handler - see `HTTPEndpoint`.
+func NewHTTPRoute(method, path string, handler func(http.ResponseWriter, *http.Request), middleware ...func(http.Handler) http.Handler) HTTPHandler {
+	return HTTPHandler{
+		HTTPEndpoint: HTTPEndpoint{
+			Method:     method,
+			Path:       path,
+			Handler:    handler,
+			Middleware: middleware,
+		},
+	}
+}
+
+func (e HTTPEndpoint) route() string {
+	if e.Method == "" {
+		return fmt.Sprintf("* %s", e.Path)
+	}
+	return fmt.Sprintf("%s %s", e.Method, e.Path)
+}
+
+func (e HTTPEndpoint) handler() http.Handler {
+	var handler http.Handler = http.HandlerFunc(e.Handler)
+	for i := len(e.Middleware) - 1; i >= 0; i-- {
+		handler = e.Middleware[i](handler)
+	}
+	return handler
+}
+
+// validateHTTPRoutes runs the following checks:
+//   - paths must start with "/"
+//   - handler funcs and middleware are not nil
+//   - max body bytes is not negative
+//   - routes do not conflict, i.e., a path can only be registered once per method, and a path that handles all methods
+//     cannot be registered with any other method
+func validateHTTPRoutes(endpoints []HTTPEndpoint) error {
+	var err error
+	methods := make(map[string]map[string]bool, len(endpoints))
+	for _, endpoint := range endpoints {
+		if !strings.HasPrefix(endpoint.Path, "/") {
+			err = multierr.Append(err, fmt.Errorf("%s : path must start with '/' : %s", ErrInvalidHTTPRoute, endpoint.route()))
+		}
+		if endpoint.MaxBodyBytes < 0 {
+			err = multierr.Append(err, fmt.Errorf("%s : max body bytes must not be negative : %s", ErrInvalidHTTPRoute, endpoint.route()))
+		}
+		if endpoint.Handler == nil {
+			err = multierr.Append(err, fmt.Errorf("%s : http handler func is nil : %s", ErrInvalidHTTPRoute, endpoint.route()))
+		}
+		for _, middleware := range endpoint.Middleware {
+			if middleware == nil {
+				err = multierr.Append(err, fmt.Errorf("%s : middleware is nil : %s", ErrInvalidHTTPRoute, endpoint.route()))
+				break
+			}
+		}
+
+		pathMethods, ok := methods[endpoint.Path]
+		if !ok {
+			pathMethods = make(map[string]bool)
+			methods[endpoint.Path] = pathMethods
+		}
+		if pathMethods[endpoint.Method] || pathMethods[""] || (endpoint.Method == "" && len(pathMethods) > 0) {
+			err = multierr.Append(err, fmt.Errorf("%s : %s", ErrHTTPRouteConflict, endpoint.route()))
+		}
+		pathMethods[endpoint.Method] = true
+	}
+	return err
+}
+
+// newHTTPRouter routes requests by path and then by method.
+//
+// NOTE: the routes are assumed to be valid - see `validateHTTPRoutes()`
+func newHTTPRouter(endpoints []HTTPEndpoint) *http.ServeMux {
+	paths := make([]string, 0, len(endpoints))
+	handlers := make(map[string]map[string]http.Handler, len(endpoints))
+	for _, endpoint := range endpoints {
+		methodHandlers, ok := handlers[endpoint.Path]
+		if !ok {
+			paths = append(paths, endpoint.Path)
+			methodHandlers = make(map[string]http.Handler)
+			handlers[endpoint.Path] = methodHandlers
+		}
+		methodHandlers[endpoint.Method] = endpoint.handler()
+	}
+
+	serveMux := http.NewServeMux()
+	for _, path := range paths {
+		methodHandlers := handlers[path]
+		if handler, ok := methodHandlers[""]; ok {
+			serveMux.Handle(path, handler)
+			continue
+		}
+		allowed := make([]string, 0, len(methodHandlers))
+		for method := range methodHandlers {
+			allowed = append(allowed, method)
+		}
+		sort.Strings(allowed)
+		allow := strings.Join(allowed, ", ")
+		serveMux.HandleFunc(path, func(writer http.ResponseWriter, request *http.Request) {
+			if handler, ok := methodHandlers[request.Method]; ok {
+				handler.ServeHTTP(writer, request)
+				return
+			}
+			writer.Header().Set("Allow", allow)
+			http.Error(writer, http.StatusText(http.StatusMethodNotAllowed), http.StatusMethodNotAllowed)
+		})
+	}
+	return serveMux
+}
+
+type httpRouteTable []HTTPEndpoint
+
+func newHTTPRouteTable(endpoints []HTTPEndpoint) httpRouteTable {
+	routes := append(httpRouteTable(nil), endpoints...)
+	sort.Slice(routes, func(i, j int) bool {
+		if routes[i].Path != routes[j].Path {
+			return routes[i].Path < routes[j].Path
+		}
+		return routes[i].Method < routes[j].Method
+	})
+	return routes
+}
+
+func (routes httpRouteTable) MarshalZerologObject(e *zerolog.Event) {
+	e.Array("routes", routes)
+}
+
+func (routes httpRouteTable) MarshalZerologArray(a *zerolog.Array) {
+	for _, route := range routes {
+		a.Object(httpRoute(route))
+	}
+}
+
+type httpRoute HTTPEndpoint
+
+func (route httpRoute) MarshalZerologObject(e *zerolog.Event) {
+	method := route.Method
+	if method == "" {
+		method = "*"
+	}
+	e.
+		Str("method", method).
+		Str("path", route.Path).
+		Int("middleware", len(route.Middleware)).
+		Bool("admin", route.Admin)
+}
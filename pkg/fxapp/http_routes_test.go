@@ -0,0 +1,173 @@
+/*
+ * Copyright (c) 2019 OysterPack, Inc.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ * http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package fxapp_test
+
+import (
+	"github.com/oysterpack/andiamo/pkg/fxapp"
+	"github.com/oysterpack/andiamo/pkg/fxapptest"
+	"github.com/oysterpack/andiamo/pkg/ulids"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"io/ioutil"
+	"net/http"
+	"testing"
+)
+
+func TestNewHTTPRoute(t *testing.T) {
+	t.Parallel()
+
+	const path = "/foo"
+	// appends the middleware name to the response header, which is used to verify the middleware order
+	middleware := func(name string) func(http.Handler) http.Handler {
+		return func(next http.Handler) http.Handler {
+			return http.HandlerFunc(func(writer http.ResponseWriter, request *http.Request) {
+				writer.Header().Add("X-Middleware", name)
+				next.ServeHTTP(writer, request)
+			})
+		}
+	}
+	handler := func(body string) func(http.ResponseWriter, *http.Request) {
+		return func(writer http.ResponseWriter, request *http.Request) {
+			writer.Write([]byte(body))
+		}
+	}
+
+	logs := fxapptest.NewLogCapture()
+	builder := fxapp.NewBuilder(fxapp.ID(ulids.MustNew()), fxapp.ReleaseID(ulids.MustNew())).
+		Provide(
+			func() fxapp.HTTPHandler {
+				return fxapp.NewHTTPRoute(http.MethodGet, path, handler("GET"), middleware("a"), middleware("b"))
+			},
+			func() fxapp.HTTPHandler {
+				return fxapp.NewHTTPRoute(http.MethodPost, path, handler("POST"))
+			},
+		).
+		Invoke(func() {}).
+		LogWriter(logs)
+
+	fxapptest.RunApp(t, builder, func(app fxapp.App, client *fxapptest.HTTPClient) {
+		t.Run("GET", func(t *testing.T) {
+			response, err := client.Get(path)
+			require.NoError(t, err)
+			defer response.Body.Close()
+			body, err := ioutil.ReadAll(response.Body)
+			require.NoError(t, err)
+			assert.Equal(t, "GET", string(body))
+			assert.Equal(t, []string{"a", "b"}, response.Header["X-Middleware"])
+		})
+
+		t.Run("POST", func(t *testing.T) {
+			response, err := client.Post(client.URL(path), "text/plain", nil)
+			require.NoError(t, err)
+			defer response.Body.Close()
+			body, err := ioutil.ReadAll(response.Body)
+			require.NoError(t, err)
+			assert.Equal(t, "POST", string(body))
+			assert.Empty(t, response.Header["X-Middleware"])
+		})
+
+		t.Run("method not allowed", func(t *testing.T) {
+			request, err := http.NewRequest(http.MethodPut, client.URL(path), nil)
+			require.NoError(t, err)
+			response, err := client.Do(request)
+			require.NoError(t, err)
+			response.Body.Close()
+			assert.Equal(t, http.StatusMethodNotAllowed, response.StatusCode)
+			assert.Equal(t, "GET, POST", response.Header.Get("Allow"))
+		})
+	})
+
+	routesEvent, ok := fxapptest.AssertEventLogged(t, logs, fxapp.HTTPRoutesEvent)
+	require.True(t, ok)
+	var data struct {
+		Routes []struct {
+			Method     string `json:"method"`
+			Path       string `json:"path"`
+			Middleware int    `json:"middleware"`
+		} `json:"routes"`
+	}
+	require.NoError(t, routesEvent.DecodeData(&data))
+	var fooRoutes []string
+	for _, route := range data.Routes {
+		if route.Path == path {
+			fooRoutes = append(fooRoutes, route.Method)
+			if route.Method == http.MethodGet {
+				assert.Equal(t, 2, route.Middleware)
+			}
+		}
+	}
+	assert.Equal(t, []string{http.MethodGet, http.MethodPost}, fooRoutes)
+}
+
+func TestHTTPRouteValidation(t *testing.T) {
+	t.Parallel()
+
+	ok := func(writer http.ResponseWriter, request *http.Request) {}
+	tests := []struct {
+		name     string
+		handlers []fxapp.HTTPHandler
+		err      error
+	}{
+		{
+			name: "same method",
+			handlers: []fxapp.HTTPHandler{
+				fxapp.NewHTTPRoute(http.MethodGet, "/foo", ok),
+				fxapp.NewHTTPRoute("get", "/foo", ok),
+			},
+			err: fxapp.ErrHTTPRouteConflict,
+		},
+		{
+			name: "all methods conflicts with specific method",
+			handlers: []fxapp.HTTPHandler{
+				fxapp.NewHTTPRoute(http.MethodGet, "/foo", ok),
+				fxapp.NewHTTPHandler("/foo", ok),
+			},
+			err: fxapp.ErrHTTPRouteConflict,
+		},
+		{
+			name: "path does not start with '/'",
+			handlers: []fxapp.HTTPHandler{
+				fxapp.NewHTTPRoute(http.MethodGet, "foo", ok),
+			},
+			err: fxapp.ErrInvalidHTTPRoute,
+		},
+		{
+			name: "nil middleware",
+			handlers: []fxapp.HTTPHandler{
+				fxapp.NewHTTPRoute(http.MethodGet, "/foo", ok, nil),
+			},
+			err: fxapp.ErrInvalidHTTPRoute,
+		},
+	}
+
+	for _, test := range tests {
+		test := test
+		t.Run(test.name, func(t *testing.T) {
+			t.Parallel()
+			builder := fxapp.NewBuilder(fxapp.ID(ulids.MustNew()), fxapp.ReleaseID(ulids.MustNew())).
+				Invoke(func() {}).
+				LogWriter(ioutil.Discard)
+			for _, handler := range test.handlers {
+				handler := handler
+				builder.Provide(func() fxapp.HTTPHandler { return handler })
+			}
+			_, err := builder.Build()
+			require.Error(t, err)
+			assert.Contains(t, err.Error(), test.err.Error())
+		})
+	}
+}
@@ -18,14 +18,22 @@ package fxapp_test
 
 import (
 	"bufio"
+	"context"
 	"encoding/json"
 	"fmt"
 	"github.com/hashicorp/go-retryablehttp"
 	"github.com/oysterpack/andiamo/pkg/fxapp"
 	"github.com/oysterpack/andiamo/pkg/fxapptest"
+	"github.com/oysterpack/andiamo/pkg/listener"
 	"github.com/oysterpack/andiamo/pkg/ulids"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
 	"io"
+	"io/ioutil"
+	"net"
 	"net/http"
+	"os"
+	"path/filepath"
 	"testing"
 )
 
@@ -48,6 +56,7 @@ func TestHTTPServer_WithDefaultOpts(t *testing.T) {
 		).
 		Invoke(func() {}).
 		LogWriter(buf).
+		AllowUnauthenticatedAdmin().
 		Build()
 
 	switch {
@@ -87,6 +96,7 @@ func TestHTTPServer_WithProvidedServer(t *testing.T) {
 		).
 		Invoke(func() {}).
 		LogWriter(buf).
+		AllowUnauthenticatedAdmin().
 		Build()
 
 	switch {
@@ -169,6 +179,7 @@ func TestHTTPServer_HandlerPanic(t *testing.T) {
 			},
 		).
 		Invoke(func() {}).
+		AllowUnauthenticatedAdmin().
 		Build()
 
 	switch {
@@ -298,3 +309,148 @@ func TestBuilder_DisableHTTPServer(t *testing.T) {
 		}
 	}
 }
+
+func TestBuilder_SetHTTPServerAddr(t *testing.T) {
+	t.Parallel()
+
+	t.Run("random free port", func(t *testing.T) {
+		t.Parallel()
+		logs := fxapptest.NewLogCapture()
+		var httpServerAddr fxapp.HTTPServerAddr
+		app, err := fxapp.NewBuilder(fxapp.ID(ulids.MustNew()), fxapp.ReleaseID(ulids.MustNew())).
+			Invoke(func() {}).
+			SetHTTPServerAddr("127.0.0.1:0").
+			LogWriter(logs).
+			Populate(&httpServerAddr).
+			AllowUnauthenticatedAdmin().
+			Build()
+		require.NoError(t, err)
+		assert.Nil(t, httpServerAddr(), "HTTP server should not be listening before the app is started")
+
+		go app.Run()
+		<-app.Ready()
+		addr := httpServerAddr()
+		require.NotNil(t, addr)
+		assert.NotEqual(t, 0, addr.(*net.TCPAddr).Port)
+		checkHTTPGetResponseStatusOK(t, fmt.Sprintf("http://%s/%s", addr, fxapp.MetricsEndpoint))
+
+		app.Shutdown()
+		<-app.Done()
+		assert.Nil(t, httpServerAddr(), "HTTP server should not be listening after the app is stopped")
+
+		fxapptest.AssertEventLogged(t, logs, fxapp.StartedEvent, fxapptest.Field("d.http_server_addr", addr.String()))
+		fxapptest.AssertEventLogged(t, logs, fxapp.HTTPServerStarting,
+			fxapptest.Field("d.addr", "127.0.0.1:0"),
+			fxapptest.Field("d.listen_addr", addr.String()),
+		)
+	})
+
+	t.Run("builder addr takes precedence over the provided server addr", func(t *testing.T) {
+		t.Parallel()
+		var httpServerAddr fxapp.HTTPServerAddr
+		app, err := fxapp.NewBuilder(fxapp.ID(ulids.MustNew()), fxapp.ReleaseID(ulids.MustNew())).
+			Provide(func() *http.Server { return &http.Server{Addr: ":5050"} }).
+			Invoke(func() {}).
+			SetHTTPServerAddr("127.0.0.1:0").
+			Populate(&httpServerAddr).
+			AllowUnauthenticatedAdmin().
+			Build()
+		require.NoError(t, err)
+		go app.Run()
+		<-app.Ready()
+		defer func() {
+			app.Shutdown()
+			<-app.Done()
+		}()
+		require.NotNil(t, httpServerAddr())
+		assert.NotEqual(t, 5050, httpServerAddr().(*net.TCPAddr).Port)
+	})
+
+	t.Run("address is already in use", func(t *testing.T) {
+		t.Parallel()
+		listener, err := net.Listen("tcp", "127.0.0.1:0")
+		require.NoError(t, err)
+		defer listener.Close()
+
+		app, err := fxapp.NewBuilder(fxapp.ID(ulids.MustNew()), fxapp.ReleaseID(ulids.MustNew())).
+			Invoke(func() {}).
+			SetHTTPServerAddr(listener.Addr().String()).
+			LogWriter(ioutil.Discard).
+			AllowUnauthenticatedAdmin().
+			Build()
+		require.NoError(t, err)
+		assert.Error(t, app.Run(), "app should fail to start because the HTTP server address is already in use")
+	})
+
+	t.Run("unix socket", func(t *testing.T) {
+		t.Parallel()
+		dir, err := ioutil.TempDir("", "fxapp")
+		require.NoError(t, err)
+		defer os.RemoveAll(dir)
+		socket := filepath.Join(dir, "app.sock")
+
+		var httpServerAddr fxapp.HTTPServerAddr
+		app, err := fxapp.NewBuilder(fxapp.ID(ulids.MustNew()), fxapp.ReleaseID(ulids.MustNew())).
+			Invoke(func() {}).
+			SetHTTPServerAddr(listener.UnixPrefix + socket).
+			LogWriter(ioutil.Discard).
+			Populate(&httpServerAddr).
+			AllowUnauthenticatedAdmin().
+			Build()
+		require.NoError(t, err)
+		go app.Run()
+		<-app.Ready()
+		defer func() {
+			app.Shutdown()
+			<-app.Done()
+		}()
+		require.NotNil(t, httpServerAddr())
+		assert.Equal(t, "unix", httpServerAddr().Network())
+
+		client := &http.Client{
+			Transport: &http.Transport{
+				DialContext: func(ctx context.Context, network, addr string) (net.Conn, error) {
+					return (&net.Dialer{}).DialContext(ctx, "unix", socket)
+				},
+			},
+		}
+		response, err := client.Get(fmt.Sprintf("http://app/%s", fxapp.ReadyEvent))
+		require.NoError(t, err)
+		response.Body.Close()
+		assert.Equal(t, http.StatusOK, response.StatusCode)
+	})
+
+	t.Run("invalid address", func(t *testing.T) {
+		t.Parallel()
+		for _, addr := range []string{"8008", "unix:", "systemd:"} {
+			_, err := fxapp.NewBuilder(fxapp.ID(ulids.MustNew()), fxapp.ReleaseID(ulids.MustNew())).
+				Invoke(func() {}).
+				SetHTTPServerAddr(addr).
+				AllowUnauthenticatedAdmin().
+				Build()
+			if assert.Error(t, err, addr) {
+				assert.Contains(t, err.Error(), fxapp.ErrInvalidHTTPServerAddr.Error())
+			}
+		}
+	})
+}
+
+// the env var cannot be set in parallel tests
+func TestHTTPServerAddrEnvVar(t *testing.T) {
+	t.Setenv(fxapp.HTTPServerAddrEnvVar, "127.0.0.1:0")
+
+	var httpServerAddr fxapp.HTTPServerAddr
+	app, err := fxapp.NewBuilder(fxapp.ID(ulids.MustNew()), fxapp.ReleaseID(ulids.MustNew())).
+		Invoke(func() {}).
+		Populate(&httpServerAddr).
+		Build()
+	require.NoError(t, err)
+	go app.Run()
+	<-app.Ready()
+	defer func() {
+		app.Shutdown()
+		<-app.Done()
+	}()
+	require.NotNil(t, httpServerAddr())
+	assert.NotEqual(t, 8008, httpServerAddr().(*net.TCPAddr).Port)
+}
@@ -0,0 +1,58 @@
+/*
+ * Copyright (c) 2019 OysterPack, Inc.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ * http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package fxapp_test
+
+import (
+	"github.com/oysterpack/andiamo/pkg/fx/idempotency"
+	"github.com/oysterpack/andiamo/pkg/fxapp"
+	"github.com/oysterpack/andiamo/pkg/fxapptest"
+	"github.com/oysterpack/andiamo/pkg/ulids"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"io/ioutil"
+	"net/http"
+	"testing"
+)
+
+func TestBuilder_EnableIdempotency(t *testing.T) {
+	t.Parallel()
+
+	orders := 0
+	builder := fxapp.NewBuilder(fxapp.ID(ulids.MustNew()), fxapp.ReleaseID(ulids.MustNew())).
+		Provide(func(idempotent idempotency.HTTPMiddleware) fxapp.HTTPHandler {
+			return fxapp.NewHTTPRoute(http.MethodPost, "/orders", func(writer http.ResponseWriter, request *http.Request) {
+				orders++
+				writer.WriteHeader(http.StatusCreated)
+			}, idempotent)
+		}).
+		Invoke(func() {}).
+		EnableIdempotency(idempotency.DefaultOpts()).
+		LogWriter(ioutil.Discard)
+
+	fxapptest.RunApp(t, builder, func(app fxapp.App, client *fxapptest.HTTPClient) {
+		for i := 0; i < 2; i++ {
+			request, err := http.NewRequest(http.MethodPost, client.URL("orders"), nil)
+			require.NoError(t, err)
+			request.Header.Set(idempotency.DefaultHeader, "order-1")
+			response, err := client.Do(request)
+			require.NoError(t, err)
+			response.Body.Close()
+			assert.Equal(t, http.StatusCreated, response.StatusCode)
+		}
+		assert.Equal(t, 1, orders)
+	})
+}
@@ -17,6 +17,7 @@
 package fxapp
 
 import (
+	"fmt"
 	"github.com/kelseyhightower/envconfig"
 	"github.com/oklog/ulid"
 	"github.com/oysterpack/andiamo/pkg/ulids"
@@ -35,26 +36,37 @@ type InstanceID ulid.ULID
 //
 //   - APP12X_ID
 //   - APP12X_RELEASE_ID
+//
+// If the app env vars are namespaced with a different prefix, then use `LoadIDsFromEnvPrefix()`.
 func LoadIDsFromEnv() (ID, ReleaseID, error) {
+	return LoadIDsFromEnvPrefix(EnvconfigPrefix)
+}
+
+// LoadIDsFromEnvPrefix tries to load the app descriptor from env vars that are namespaced with the env prefix, i.e., the
+// same env vars that are listed in the app env catalog - see `Builder.SetEnvPrefix()`:
+//
+//   - ${prefix}_ID
+//   - ${prefix}_RELEASE_ID
+func LoadIDsFromEnvPrefix(prefix EnvPrefix) (ID, ReleaseID, error) {
 	type desc struct {
 		ID        string `required:"true"`                    // ULID
 		ReleaseID string `required:"true" split_words:"true"` // ULID
 	}
 
 	var cfg desc
-	err := envconfig.Process(EnvconfigPrefix, &cfg)
+	err := envconfig.Process(prefix.String(), &cfg)
 	if err != nil {
 		return ID(ulid.ULID{}), ReleaseID(ulid.ULID{}), err
 	}
 
 	id, err := ulids.Parse(cfg.ID)
 	if err != nil {
-		return ID(ulid.ULID{}), ReleaseID(ulid.ULID{}), err
+		return ID(ulid.ULID{}), ReleaseID(ulid.ULID{}), fmt.Errorf("%s : %v", prefix.EnvVar("ID"), err)
 	}
 
 	releaseID, err := ulids.Parse(cfg.ReleaseID)
 	if err != nil {
-		return ID(id), ReleaseID(ulid.ULID{}), err
+		return ID(id), ReleaseID(ulid.ULID{}), fmt.Errorf("%s : %v", prefix.EnvVar("RELEASE_ID"), err)
 	}
 
 	return ID(id), ReleaseID(releaseID), nil
@@ -94,3 +94,47 @@ func TestLoadIDsFromEnv(t *testing.T) {
 	_, _, e = fxapp.LoadIDsFromEnv()
 	checkLoadDescFromEnvFailed(e)
 }
+
+func TestLoadIDsFromEnvPrefix(t *testing.T) {
+	prefix := fxapp.EnvPrefix("ids_test")
+	ulidID := ulids.MustNew()
+	ulidReleaseID := ulids.MustNew()
+	t.Setenv(prefix.EnvVar("ID"), ulidID.String())
+	t.Setenv(prefix.EnvVar("RELEASE_ID"), ulidReleaseID.String())
+
+	id, releaseID, e := fxapp.LoadIDsFromEnvPrefix(prefix)
+	switch {
+	case e != nil:
+		t.Errorf("*** IDs failed to load from env: %v", e)
+	default:
+		if fxapp.ID(ulidID) != id {
+			t.Error("*** ID did not match")
+		}
+		if fxapp.ReleaseID(ulidReleaseID) != releaseID {
+			t.Error("*** ReleaseID did not match")
+		}
+	}
+
+	// the IDs are listed in the env catalog using the same prefix
+	catalog := fxapp.NewBuilder(id, releaseID).SetEnvPrefix(string(prefix)).EnvCatalog()
+	for _, name := range []string{prefix.EnvVar("ID"), prefix.EnvVar("RELEASE_ID")} {
+		found := false
+		for _, v := range catalog {
+			if v.Name == name {
+				found = v.Required
+			}
+		}
+		if !found {
+			t.Errorf("*** required env var is not in the catalog: %s", name)
+		}
+	}
+
+	t.Setenv(prefix.EnvVar("RELEASE_ID"), "INVALID")
+	_, _, e = fxapp.LoadIDsFromEnvPrefix(prefix)
+	switch {
+	case e == nil:
+		t.Error("*** IDs should have failed to load")
+	case !strings.Contains(e.Error(), prefix.EnvVar("RELEASE_ID")):
+		t.Errorf("*** error should reference the env var: %v", e)
+	}
+}
@@ -0,0 +1,347 @@
+/*
+ * Copyright (c) 2019 OysterPack, Inc.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ * http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package fxapp
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"github.com/oysterpack/andiamo/pkg/appdesc"
+	"go.uber.org/fx"
+	"go.uber.org/multierr"
+	"net"
+	"net/http"
+	"regexp"
+	"sort"
+	"strconv"
+	"text/template"
+	"time"
+)
+
+// KubernetesOpts are the Kubernetes deployment hints that are declared in code, which are used to generate the app
+// Kubernetes manifests - see `KubernetesManifests()`.
+type KubernetesOpts struct {
+	// Namespace is optional
+	Namespace string
+	// Image defaults to "<app name>:<app version>"
+	Image string
+	// Replicas defaults to `DefaultKubernetesReplicas`
+	Replicas int
+	// Requests and Limits are the container resource hints, e.g., {"cpu": "100m", "memory": "128Mi"}
+	Requests map[string]string
+	Limits   map[string]string
+	// MinAvailable is the PodDisruptionBudget min available pods. Defaults to 1 less than the replicas, but at least 1.
+	MinAvailable int
+	// ScrapeInterval is the ServiceMonitor scrape interval. Defaults to `DefaultKubernetesScrapeInterval`.
+	ScrapeInterval time.Duration
+	// AdminTokenSecret is the name of the Secret that holds the admin bearer token under the
+	// `KubernetesAdminTokenSecretKey` key. Defaults to "<app name>-admin".
+	AdminTokenSecret string
+}
+
+// Kubernetes manifest defaults
+const (
+	DefaultKubernetesReplicas       = 2
+	DefaultKubernetesScrapeInterval = 30 * time.Second
+)
+
+// KubernetesAdminTokenSecretKey is the `KubernetesOpts.AdminTokenSecret` key that holds the admin bearer token
+const KubernetesAdminTokenSecretKey = "admin-bearer-token"
+
+// Kubernetes opts validation errors
+var (
+	ErrInvalidKubernetesOpts = errors.New("invalid Kubernetes opts")
+	// ErrKubernetesInvalidName indicates the app name is not a valid Kubernetes resource name, i.e., DNS-1123 label
+	ErrKubernetesInvalidName = errors.New("app name must be a DNS-1123 label to be used as the Kubernetes resource name")
+)
+
+// DNS-1123 label, which is required for Kubernetes resource names
+var kubernetesNameRegexp = regexp.MustCompile(`^[a-z0-9]([-a-z0-9]{0,61}[a-z0-9])?$`)
+
+// DNS-1123 subdomain, which is required for Secret names
+var kubernetesSecretNameRegexp = regexp.MustCompile(`^[a-z0-9]([-a-z0-9]*[a-z0-9])?(\.[a-z0-9]([-a-z0-9]*[a-z0-9])?)*$`)
+
+// Kubernetes resource quantity, e.g., 100m, 0.5, 128Mi, 1G
+var kubernetesQuantityRegexp = regexp.MustCompile(`^[0-9]+(\.[0-9]+)?(m|k|M|G|T|P|E|Ki|Mi|Gi|Ti|Pi|Ei)?$`)
+
+func (opts KubernetesOpts) validate() error {
+	var err error
+	if opts.Replicas < 0 || opts.MinAvailable < 0 || opts.ScrapeInterval < 0 {
+		err = multierr.Append(err, fmt.Errorf("%s : `Replicas`, `MinAvailable`, and `ScrapeInterval` must not be negative", ErrInvalidKubernetesOpts))
+	}
+	if opts.AdminTokenSecret != "" && !kubernetesSecretNameRegexp.MatchString(opts.AdminTokenSecret) {
+		err = multierr.Append(err, fmt.Errorf("%s : `AdminTokenSecret` must be a DNS-1123 subdomain : %q", ErrInvalidKubernetesOpts, opts.AdminTokenSecret))
+	}
+	for _, resources := range []map[string]string{opts.Requests, opts.Limits} {
+		for resource, quantity := range resources {
+			if !kubernetesQuantityRegexp.MatchString(quantity) {
+				err = multierr.Append(err, fmt.Errorf("%s : invalid resource quantity : %s=%q", ErrInvalidKubernetesOpts, resource, quantity))
+			}
+		}
+	}
+	return err
+}
+
+func (opts KubernetesOpts) withDefaults(desc appdesc.Desc) KubernetesOpts {
+	if opts.Image == "" {
+		opts.Image = fmt.Sprintf("%s:%s", desc.Name, desc.Version)
+	}
+	if opts.Replicas == 0 {
+		opts.Replicas = DefaultKubernetesReplicas
+	}
+	if opts.MinAvailable == 0 {
+		opts.MinAvailable = opts.Replicas - 1
+		if opts.MinAvailable < 1 {
+			opts.MinAvailable = 1
+		}
+	}
+	if opts.ScrapeInterval == 0 {
+		opts.ScrapeInterval = DefaultKubernetesScrapeInterval
+	}
+	if opts.AdminTokenSecret == "" {
+		opts.AdminTokenSecret = desc.Name + "-admin"
+	}
+	return opts
+}
+
+// KubernetesApp describes what the app binary exposes, which the Kubernetes manifests are kept in sync with
+type KubernetesApp struct {
+	Desc appdesc.Desc
+	// HTTPPort is the port that the app HTTP server listens on
+	HTTPPort int
+	// MetricsEndpoint is the Prometheus metrics endpoint path - see `PrometheusHTTPHandlerOpts`
+	MetricsEndpoint string
+	// EnvPrefix is used to name the container env vars - see `Builder.SetEnvPrefix()`
+	EnvPrefix EnvPrefix
+}
+
+// KubernetesManifests generates the following Kubernetes manifests as a multi-document YAML file:
+//   - Deployment - the container is configured with the app descriptor env vars, the HTTP server address, the admin
+//     bearer token, and the readiness and liveness probes
+//   - Service
+//   - ServiceMonitor - Prometheus operator scrape config for the metrics endpoint, which authenticates with the admin
+//     bearer token
+//   - PodDisruptionBudget
+//
+// The app name is used as the resource name, and thus must be a DNS-1123 label.
+//
+// NOTE: admin endpoints, which include the metrics endpoint, are protected by default - see `Authenticator`. The admin
+// bearer token is read from the `KubernetesOpts.AdminTokenSecret` Secret, which is not generated, i.e., it must be
+// created in the namespace before the app is deployed.
+func KubernetesManifests(app KubernetesApp, opts KubernetesOpts) ([]byte, error) {
+	if !kubernetesNameRegexp.MatchString(app.Desc.Name) {
+		return nil, fmt.Errorf("%s : %q", ErrKubernetesInvalidName, app.Desc.Name)
+	}
+	if err := opts.validate(); err != nil {
+		return nil, err
+	}
+	opts = opts.withDefaults(app.Desc)
+	buf := new(bytes.Buffer)
+	err := kubernetesManifestsTemplate.Execute(buf, struct {
+		KubernetesApp
+		KubernetesOpts
+		ReadinessEndpoint   string
+		LivenessEndpoint    string
+		AdminTokenSecretKey string
+	}{
+		KubernetesApp:       app,
+		KubernetesOpts:      opts,
+		ReadinessEndpoint:   "/" + ReadyEvent,
+		LivenessEndpoint:    "/" + LivenessProbeEvent,
+		AdminTokenSecretKey: KubernetesAdminTokenSecretKey,
+	})
+	return buf.Bytes(), err
+}
+
+var kubernetesManifestsTemplate = template.Must(template.New("k8s").Funcs(template.FuncMap{
+	"quote": func(v interface{}) string { return strconv.Quote(fmt.Sprint(v)) },
+	"keys": func(m map[string]string) []string {
+		keys := make([]string, 0, len(m))
+		for k := range m {
+			keys = append(keys, k)
+		}
+		sort.Strings(keys)
+		return keys
+	},
+	"duration": promDuration,
+}).Parse(`{{define "metadata"}}metadata:
+  name: {{.Desc.Name}}
+{{- if .Namespace}}
+  namespace: {{.Namespace}}
+{{- end}}
+  labels:
+    app.kubernetes.io/name: {{.Desc.Name}}
+    app.kubernetes.io/version: {{quote .Desc.Version}}
+    andiamo/app-id: {{.Desc.ID}}
+    andiamo/release-id: {{.Desc.ReleaseID}}
+{{- end -}}
+{{define "resources"}}{{$resources := .}}{{range keys .}}
+              {{.}}: {{quote (index $resources .)}}
+{{- end}}{{end -}}
+apiVersion: apps/v1
+kind: Deployment
+{{template "metadata" .}}
+spec:
+  replicas: {{.Replicas}}
+  selector:
+    matchLabels:
+      app.kubernetes.io/name: {{.Desc.Name}}
+  template:
+    metadata:
+      labels:
+        app.kubernetes.io/name: {{.Desc.Name}}
+        app.kubernetes.io/version: {{quote .Desc.Version}}
+        andiamo/app-id: {{.Desc.ID}}
+        andiamo/release-id: {{.Desc.ReleaseID}}
+    spec:
+      containers:
+        - name: {{.Desc.Name}}
+          image: {{quote .Image}}
+          ports:
+            - name: http
+              containerPort: {{.HTTPPort}}
+          env:
+            - name: {{.EnvPrefix}}_ID
+              value: {{quote .Desc.ID}}
+            - name: {{.EnvPrefix}}_NAME
+              value: {{quote .Desc.Name}}
+            - name: {{.EnvPrefix}}_VERSION
+              value: {{quote .Desc.Version}}
+            - name: {{.EnvPrefix}}_RELEASE_ID
+              value: {{quote .Desc.ReleaseID}}
+            - name: {{.EnvPrefix}}_HTTP_SERVER_ADDR
+              value: ":{{.HTTPPort}}"
+            - name: {{.EnvPrefix}}_ADMIN_BEARER_TOKEN
+              valueFrom:
+                secretKeyRef:
+                  name: {{.AdminTokenSecret}}
+                  key: {{.AdminTokenSecretKey}}
+            - name: POD_NAME
+              valueFrom:
+                fieldRef:
+                  fieldPath: metadata.name
+            - name: POD_NAMESPACE
+              valueFrom:
+                fieldRef:
+                  fieldPath: metadata.namespace
+            - name: NODE_NAME
+              valueFrom:
+                fieldRef:
+                  fieldPath: spec.nodeName
+{{- if or .Requests .Limits}}
+          resources:
+{{- if .Requests}}
+            requests:{{template "resources" .Requests}}
+{{- end}}
+{{- if .Limits}}
+            limits:{{template "resources" .Limits}}
+{{- end}}
+{{- end}}
+          readinessProbe:
+            httpGet:
+              path: {{.ReadinessEndpoint}}
+              port: http
+          livenessProbe:
+            httpGet:
+              path: {{.LivenessEndpoint}}
+              port: http
+---
+apiVersion: v1
+kind: Service
+{{template "metadata" .}}
+spec:
+  selector:
+    app.kubernetes.io/name: {{.Desc.Name}}
+  ports:
+    - name: http
+      port: {{.HTTPPort}}
+      targetPort: http
+---
+apiVersion: monitoring.coreos.com/v1
+kind: ServiceMonitor
+{{template "metadata" .}}
+spec:
+  selector:
+    matchLabels:
+      app.kubernetes.io/name: {{.Desc.Name}}
+  endpoints:
+    - port: http
+      path: {{.MetricsEndpoint}}
+      interval: {{duration .ScrapeInterval}}
+      bearerTokenSecret:
+        name: {{.AdminTokenSecret}}
+        key: {{.AdminTokenSecretKey}}
+---
+apiVersion: policy/v1
+kind: PodDisruptionBudget
+{{template "metadata" .}}
+spec:
+  minAvailable: {{.MinAvailable}}
+  selector:
+    matchLabels:
+      app.kubernetes.io/name: {{.Desc.Name}}
+`))
+
+// KubernetesManifestsEndpoint is used to construct the Kubernetes manifests HTTP endpoint, which returns the manifests
+// that are generated from the running app, i.e., the HTTP server port and metrics endpoint are what the app actually
+// exposes - see `KubernetesManifests()`. The deployment hints are configured via `Builder.SetKubernetesOpts()`.
+const KubernetesManifestsEndpoint = "01DJHQ15CJ8SAVPTHKDKEZGV0K"
+
+type kubernetesManifestsParams struct {
+	fx.In
+
+	Desc           appdesc.Desc
+	Opts           KubernetesOpts
+	HTTPServerAddr HTTPServerAddr
+	EnvPrefix      EnvPrefix
+	PrometheusOpts PrometheusHTTPHandlerOpts `optional:"true"`
+}
+
+func kubernetesManifestsHTTPHandler(params kubernetesManifestsParams) HTTPHandler {
+	return NewHTTPHandler(fmt.Sprintf("/%s", KubernetesManifestsEndpoint), func(writer http.ResponseWriter, request *http.Request) {
+		manifests, err := KubernetesManifests(KubernetesApp{
+			Desc:            params.Desc,
+			HTTPPort:        httpServerPort(params.HTTPServerAddr()),
+			MetricsEndpoint: params.PrometheusOpts.withDefaults().Endpoint,
+			EnvPrefix:       params.EnvPrefix,
+		}, params.Opts)
+		if err != nil {
+			http.Error(writer, err.Error(), http.StatusInternalServerError)
+			return
+		}
+		writer.Header().Set("Content-Type", YAMLMediaType)
+		writer.Write(manifests)
+	}).WithDoc(OpenAPIOperation{
+		Summary: "Kubernetes manifests generated from the app",
+		Tags:    []string{BuiltinOpenAPITag},
+		Responses: []OpenAPIResponse{
+			{Status: http.StatusOK, MediaTypes: []string{YAMLMediaType}},
+			{Status: http.StatusInternalServerError, Description: "the app name is not a valid Kubernetes resource name"},
+		},
+	}).AdminOnly()
+}
+
+// httpServerPort returns the TCP port that the HTTP server is bound to. If the HTTP server is not bound to a TCP
+// address, e.g., a Unix domain socket, then the default HTTP server port is returned.
+func httpServerPort(addr net.Addr) int {
+	if tcpAddr, ok := addr.(*net.TCPAddr); ok && tcpAddr.Port > 0 {
+		return tcpAddr.Port
+	}
+	_, port, _ := net.SplitHostPort(DefaultHTTPServerAddr)
+	n, _ := strconv.Atoi(port)
+	return n
+}
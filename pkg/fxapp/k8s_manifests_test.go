@@ -0,0 +1,155 @@
+/*
+ * Copyright (c) 2019 OysterPack, Inc.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ * http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package fxapp_test
+
+import (
+	"fmt"
+	"github.com/oysterpack/andiamo/pkg/appdesc"
+	"github.com/oysterpack/andiamo/pkg/fxapp"
+	"github.com/oysterpack/andiamo/pkg/ulids"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"io/ioutil"
+	"net/http"
+	"strings"
+	"testing"
+)
+
+func TestKubernetesManifests(t *testing.T) {
+	t.Parallel()
+
+	desc := appdesc.Desc{ID: ulids.MustNew(), Name: "foo", ReleaseID: ulids.MustNew()}
+	app := fxapp.KubernetesApp{Desc: desc, HTTPPort: 8080, MetricsEndpoint: "/metrics"}
+
+	t.Run("with defaults", func(t *testing.T) {
+		manifests, err := fxapp.KubernetesManifests(app, fxapp.KubernetesOpts{})
+		require.NoError(t, err)
+		t.Log(string(manifests))
+		docs := strings.Split(string(manifests), "\n---\n")
+		require.Len(t, docs, 4)
+		for i, kind := range []string{"Deployment", "Service", "ServiceMonitor", "PodDisruptionBudget"} {
+			assert.Contains(t, docs[i], "kind: "+kind+"\n")
+			assert.Contains(t, docs[i], "  name: foo\n")
+			assert.Contains(t, docs[i], fmt.Sprintf("andiamo/release-id: %s\n", desc.ReleaseID))
+		}
+		assert.Contains(t, docs[0], "replicas: 2\n")
+		assert.Contains(t, docs[0], `image: "foo:0.0.0"`)
+		assert.Contains(t, docs[0], "containerPort: 8080\n")
+		assert.Contains(t, docs[0], fmt.Sprintf("path: /%s\n", fxapp.ReadyEvent))
+		assert.Contains(t, docs[0], fmt.Sprintf("path: /%s\n", fxapp.LivenessProbeEvent))
+		assert.NotContains(t, docs[0], "resources:")
+		assert.NotContains(t, docs[0], "namespace:")
+		assert.Contains(t, docs[2], "path: /metrics\n")
+		assert.Contains(t, docs[2], "interval: 30s")
+		// the metrics endpoint is an admin endpoint, i.e., the scrape is authenticated via the admin bearer token
+		assert.Contains(t, docs[0], fmt.Sprintf(`
+            - name: %s_ADMIN_BEARER_TOKEN
+              valueFrom:
+                secretKeyRef:
+                  name: foo-admin
+                  key: %s
+`, app.EnvPrefix, fxapp.KubernetesAdminTokenSecretKey))
+		assert.Contains(t, docs[2], fmt.Sprintf(`
+      bearerTokenSecret:
+        name: foo-admin
+        key: %s`, fxapp.KubernetesAdminTokenSecretKey))
+		assert.Contains(t, docs[3], "minAvailable: 1\n")
+	})
+
+	t.Run("with opts", func(t *testing.T) {
+		manifests, err := fxapp.KubernetesManifests(app, fxapp.KubernetesOpts{
+			Namespace: "bar",
+			Image:     "registry.example.com/foo:1.0.0",
+			Replicas:  5,
+			Requests:  map[string]string{"memory": "128Mi", "cpu": "100m"},
+			Limits:    map[string]string{"memory": "256Mi"},
+
+			AdminTokenSecret: "foo-scrape",
+		})
+		require.NoError(t, err)
+		t.Log(string(manifests))
+		assert.Contains(t, string(manifests), "  namespace: bar\n")
+		assert.Contains(t, string(manifests), `image: "registry.example.com/foo:1.0.0"`)
+		assert.Contains(t, string(manifests), "replicas: 5\n")
+		assert.Contains(t, string(manifests), "minAvailable: 4\n")
+		assert.Equal(t, 2, strings.Count(string(manifests), "name: foo-scrape\n"))
+		assert.Contains(t, string(manifests), `
+          resources:
+            requests:
+              cpu: "100m"
+              memory: "128Mi"
+            limits:
+              memory: "256Mi"
+`)
+	})
+
+	t.Run("invalid name", func(t *testing.T) {
+		app := app
+		app.Desc.Name = "Foo_Bar"
+		_, err := fxapp.KubernetesManifests(app, fxapp.KubernetesOpts{})
+		require.Error(t, err)
+		assert.Contains(t, err.Error(), fxapp.ErrKubernetesInvalidName.Error())
+	})
+
+	t.Run("invalid opts", func(t *testing.T) {
+		_, err := fxapp.KubernetesManifests(app, fxapp.KubernetesOpts{Replicas: -1, Limits: map[string]string{"cpu": "lots"}, AdminTokenSecret: "Foo_Admin"})
+		require.Error(t, err)
+		t.Log(err)
+		assert.Contains(t, err.Error(), "must not be negative")
+		assert.Contains(t, err.Error(), "invalid resource quantity")
+		assert.Contains(t, err.Error(), "`AdminTokenSecret` must be a DNS-1123 subdomain")
+	})
+}
+
+func TestKubernetesManifestsHTTPEndpoint(t *testing.T) {
+	app, err := fxapp.NewBuilderFromDesc(appdesc.Desc{ID: ulids.MustNew(), Name: "foo", ReleaseID: ulids.MustNew()}).
+		SetKubernetesOpts(fxapp.KubernetesOpts{Replicas: 3}).
+		Invoke(func() {}).
+		AllowUnauthenticatedAdmin().
+		Build()
+	require.NoError(t, err)
+
+	go app.Run()
+	<-app.Ready()
+	defer func() {
+		app.Shutdown()
+		<-app.Done()
+	}()
+
+	checkHTTPGetResponse(t, fmt.Sprintf("http://:8008/%s", fxapp.KubernetesManifestsEndpoint), func(response *http.Response) {
+		defer response.Body.Close()
+		require.Equal(t, http.StatusOK, response.StatusCode)
+		assert.Equal(t, fxapp.YAMLMediaType, response.Header.Get("Content-Type"))
+		body, err := ioutil.ReadAll(response.Body)
+		require.NoError(t, err)
+		assert.Contains(t, string(body), "replicas: 3\n")
+		assert.Contains(t, string(body), "containerPort: 8008\n")
+		assert.Contains(t, string(body), fmt.Sprintf("path: /%s\n", fxapp.MetricsEndpoint))
+	})
+}
+
+func TestBuilder_SetKubernetesOpts(t *testing.T) {
+	t.Parallel()
+
+	_, err := fxapp.NewBuilder(fxapp.ID(ulids.MustNew()), fxapp.ReleaseID(ulids.MustNew())).
+		SetKubernetesOpts(fxapp.KubernetesOpts{Requests: map[string]string{"cpu": "1 core"}}).
+		Invoke(func() {}).
+		DisableHTTPServer().
+		Build()
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), fxapp.ErrInvalidKubernetesOpts.Error())
+}
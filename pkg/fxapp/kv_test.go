@@ -0,0 +1,66 @@
+/*
+ * Copyright (c) 2019 OysterPack, Inc.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ * http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package fxapp_test
+
+import (
+	"github.com/oysterpack/andiamo/pkg/fx/health"
+	"github.com/oysterpack/andiamo/pkg/fx/kv"
+	"github.com/oysterpack/andiamo/pkg/fxapp"
+	"github.com/oysterpack/andiamo/pkg/ulids"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestBuilder_EnableKVStore(t *testing.T) {
+	t.Parallel()
+
+	dir, err := ioutil.TempDir("", "fxapp")
+	require.NoError(t, err)
+	defer os.RemoveAll(dir)
+
+	var store kv.Store
+	var runCheckNow health.RunCheckNow
+	app, err := fxapp.NewBuilder(fxapp.ID(ulids.MustNew()), fxapp.ReleaseID(ulids.MustNew())).
+		Invoke(func(store kv.Store) error {
+			return store.Put("app", []byte("state"), []byte("initialized"))
+		}).
+		EnableKVStore(kv.DefaultOpts(filepath.Join(dir, "app.db"))).
+		Populate(&store, &runCheckNow).
+		DisableHTTPServer().
+		LogWriter(ioutil.Discard).
+		Build()
+	require.NoError(t, err)
+	go app.Run()
+	<-app.Ready()
+
+	value, err := store.Get("app", []byte("state"))
+	require.NoError(t, err)
+	assert.Equal(t, []byte("initialized"), value)
+	result, err := runCheckNow(kv.IntegrityHealthCheckID)
+	require.NoError(t, err)
+	assert.Equal(t, health.Green, result.Status)
+
+	// the store is closed when the app is stopped
+	app.Shutdown()
+	<-app.Done()
+	_, err = store.Get("app", []byte("state"))
+	assert.Equal(t, kv.ErrClosed, err)
+}
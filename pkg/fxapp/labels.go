@@ -16,11 +16,19 @@
 
 package fxapp
 
+import "github.com/oysterpack/andiamo/pkg/appdesc"
+
 // standard application labels used for metrics and logging
 const (
-	AppIDLabel         = "a"
-	AppReleaseIDLabel  = "r"
+	AppIDLabel         = appdesc.IDLabel
+	AppNameLabel       = appdesc.NameLabel
+	AppVersionLabel    = appdesc.VersionLabel
+	AppReleaseIDLabel  = appdesc.ReleaseIDLabel
 	AppInstanceIDLabel = "i"
 
 	EventLabel = "z"
+
+	ComponentIDLabel      = "c"
+	ComponentNameLabel    = "cn"
+	ComponentVersionLabel = "cv"
 )
@@ -0,0 +1,136 @@
+/*
+ * Copyright (c) 2019 OysterPack, Inc.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ * http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package fxapp
+
+import (
+	"errors"
+	"fmt"
+	"github.com/blang/semver"
+	"github.com/oklog/ulid"
+	"github.com/oysterpack/andiamo/pkg/appdesc"
+	"github.com/oysterpack/andiamo/pkg/eventlog"
+	legacyapp "github.com/oysterpack/andiamo/pkg/fx/app"
+	"github.com/rs/zerolog"
+	"go.uber.org/fx"
+)
+
+// DeprecationEvent is logged at warn level when a deprecated API is used, i.e., when the app builder is constructed from
+// the fx/app module Opts, and when a type that is provided by the legacy shims is injected - see `Builder.EnableLegacyShims()`.
+//
+//	type Data struct {
+//		API         string `json:"api"`
+//		Replacement string `json:"replacement"`
+//	}
+const DeprecationEvent = "01DJ42AHR8XGSNYD15W7E1SGRK"
+
+// ErrInvalidLegacyOpts indicates the fx/app module Opts could not be resolved, e.g., the app ID env var is not defined
+var ErrInvalidLegacyOpts = errors.New("invalid fx/app Opts")
+
+type deprecation struct {
+	api         string
+	replacement string
+}
+
+func (d deprecation) MarshalZerologObject(e *zerolog.Event) {
+	e.Str("api", d.api).Str("replacement", d.replacement)
+}
+
+func logDeprecation(logger *zerolog.Logger, d deprecation) {
+	eventlog.NewLogger(DeprecationEvent, logger, zerolog.WarnLevel)(d, "deprecated API is used")
+}
+
+// NewBuilderFromLegacyOpts constructs a new Builder from the deprecated fx/app module Opts, i.e., the app descriptor, log
+// writer, log level, env prefix, and instance metadata settings are carried over. The Opts are resolved the same way the fx/app
+// module resolves them, i.e., the app descriptor and log level are loaded from the env if not set.
+//
+// It is used to migrate fx/app based apps incrementally, i.e., the fx/app module functions can still be injected by
+// enabling the legacy shims - see `Builder.EnableLegacyShims()`.
+func NewBuilderFromLegacyOpts(opts legacyapp.Opts) (Builder, error) {
+	desc, err := opts.Desc()
+	if err != nil {
+		return nil, fmt.Errorf("%s : %s", ErrInvalidLegacyOpts, err)
+	}
+	level, err := opts.LogLevel()
+	if err != nil {
+		return nil, fmt.Errorf("%s : %s", ErrInvalidLegacyOpts, err)
+	}
+
+	b := NewBuilder(ID(desc.ID), ReleaseID(desc.ReleaseID)).(*builder)
+	b.name = desc.Name
+	b.version = desc.Version
+	b.globalLogLevel = level
+	if opts.LogWriter != nil {
+		b.logWriter = opts.LogWriter
+	}
+	b.envPrefix = EnvPrefix(opts.EnvPrefix)
+	b.instanceMetadataEnabled = opts.InstanceMetadata
+	b.deprecations = append(b.deprecations, deprecation{"app.Opts", "fxapp.NewBuilder"})
+	return b, nil
+}
+
+// logDeprecations logs the deprecated APIs that were used to build the app
+func (b *builder) logDeprecations(logger *zerolog.Logger) {
+	for _, d := range b.deprecations {
+		logDeprecation(logger, d)
+	}
+}
+
+// legacyShims provides the fx/app module functions, which are derived from the fxapp provided types.
+//
+// NOTE: constructors are only invoked if the type they provide is required, i.e., the DeprecationEvent is only logged
+// for the legacy types that are actually injected.
+func legacyShims() fx.Option {
+	return fx.Provide(
+		func(id ID, logger *zerolog.Logger) legacyapp.ID {
+			logDeprecation(logger, deprecation{"app.ID", "fxapp.ID"})
+			return func() ulid.ULID { return ulid.ULID(id) }
+		},
+		func(releaseID ReleaseID, logger *zerolog.Logger) legacyapp.ReleaseID {
+			logDeprecation(logger, deprecation{"app.ReleaseID", "fxapp.ReleaseID"})
+			return func() ulid.ULID { return ulid.ULID(releaseID) }
+		},
+		func(instanceID InstanceID, logger *zerolog.Logger) legacyapp.InstanceID {
+			logDeprecation(logger, deprecation{"app.InstanceID", "fxapp.InstanceID"})
+			return func() ulid.ULID { return ulid.ULID(instanceID) }
+		},
+		func(desc appdesc.Desc, logger *zerolog.Logger) legacyapp.Name {
+			logDeprecation(logger, deprecation{"app.Name", "appdesc.Desc"})
+			return func() string { return desc.Name }
+		},
+		func(desc appdesc.Desc, logger *zerolog.Logger) legacyapp.Version {
+			logDeprecation(logger, deprecation{"app.Version", "appdesc.Desc"})
+			return func() semver.Version { return desc.Version }
+		},
+		func(desc appdesc.Desc, instanceID InstanceID, instanceMetadata appdesc.InstanceMetadata, logger *zerolog.Logger) legacyapp.Labels {
+			logDeprecation(logger, deprecation{"app.Labels", "appdesc.Desc.Labels"})
+			return func() map[string]string {
+				labels := desc.Labels()
+				labels[AppInstanceIDLabel] = ulid.ULID(instanceID).String()
+				for label, value := range instanceMetadata.Labels() {
+					labels[label] = value
+				}
+				return labels
+			}
+		},
+		func(logger *zerolog.Logger) legacyapp.Logger {
+			logDeprecation(logger, deprecation{"app.Logger", "eventlog.NewLogger"})
+			return func(event string, level zerolog.Level) eventlog.Logger {
+				return eventlog.NewLogger(event, logger, level)
+			}
+		},
+	)
+}
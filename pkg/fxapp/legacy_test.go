@@ -0,0 +1,118 @@
+/*
+ * Copyright (c) 2019 OysterPack, Inc.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ * http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package fxapp_test
+
+import (
+	"github.com/blang/semver"
+	"github.com/oklog/ulid"
+	"github.com/oysterpack/andiamo/pkg/appdesc"
+	"github.com/oysterpack/andiamo/pkg/eventlog"
+	legacyapp "github.com/oysterpack/andiamo/pkg/fx/app"
+	"github.com/oysterpack/andiamo/pkg/fxapp"
+	"github.com/oysterpack/andiamo/pkg/fxapptest"
+	"github.com/oysterpack/andiamo/pkg/ulids"
+	"github.com/rs/zerolog"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"testing"
+)
+
+func TestNewBuilderFromLegacyOpts(t *testing.T) {
+	t.Parallel()
+
+	t.Run("with valid opts", func(t *testing.T) {
+		const (
+			InfoEvent = "01DJ42AJ0TBD0KS6NFSSZEK7HH"
+			WarnEvent = "01DJ42AHWHXG55Y3TFZS5R1Z8J"
+		)
+		logs := fxapptest.NewLogCapture()
+		level := zerolog.WarnLevel
+		opts := legacyapp.Opts{
+			ID:             ulids.MustNew(),
+			ReleaseID:      ulids.MustNew(),
+			Name:           "foo",
+			Version:        "1.2.3",
+			LogWriter:      logs,
+			GlobalLogLevel: &level,
+		}
+		builder, err := fxapp.NewBuilderFromLegacyOpts(opts)
+		require.NoError(t, err)
+		app, err := builder.
+			Invoke(func(logger *zerolog.Logger) {
+				eventlog.NewLogger(InfoEvent, logger, zerolog.InfoLevel)(nil, "info")
+				eventlog.NewLogger(WarnEvent, logger, zerolog.WarnLevel)(nil, "warn")
+			}).
+			DisableHTTPServer().
+			Build()
+		require.NoError(t, err)
+
+		assert.Equal(t, appdesc.Desc{
+			ID:        opts.ID,
+			ReleaseID: opts.ReleaseID,
+			Name:      "foo",
+			Version:   semver.MustParse("1.2.3"),
+		}, app.Desc())
+		// the log level is carried over
+		assert.Empty(t, logs.FindEvents(InfoEvent))
+		fxapptest.AssertEventLogged(t, logs, WarnEvent)
+		fxapptest.AssertEventLogged(t, logs, fxapp.DeprecationEvent,
+			fxapptest.Field("d.api", "app.Opts"),
+			fxapptest.Field("d.replacement", "fxapp.NewBuilder"),
+		)
+	})
+
+	t.Run("with invalid opts", func(t *testing.T) {
+		_, err := fxapp.NewBuilderFromLegacyOpts(legacyapp.Opts{EnvPrefix: "LEGACY_OPTS_TEST"})
+		require.Error(t, err)
+		assert.Contains(t, err.Error(), fxapp.ErrInvalidLegacyOpts.Error())
+	})
+}
+
+func TestBuilder_EnableLegacyShims(t *testing.T) {
+	t.Parallel()
+
+	const Event = "01DJ4AJ73ZAS1N862TD19GZFK6"
+	logs := fxapptest.NewLogCapture()
+	var (
+		id         legacyapp.ID
+		instanceID legacyapp.InstanceID
+		labels     legacyapp.Labels
+	)
+	app, err := fxapp.NewBuilder(fxapp.ID(ulids.MustNew()), fxapp.ReleaseID(ulids.MustNew())).
+		Invoke(func(logger legacyapp.Logger) {
+			logger(Event, zerolog.InfoLevel)(nil, "legacy component")
+		}).
+		Populate(&id, &instanceID, &labels).
+		EnableLegacyShims().
+		LogWriter(logs).
+		DisableHTTPServer().
+		Build()
+	require.NoError(t, err)
+
+	assert.Equal(t, ulid.ULID(app.ID()), id())
+	assert.Equal(t, ulid.ULID(app.InstanceID()), instanceID())
+	assert.Equal(t, ulid.ULID(app.InstanceID()).String(), labels()[legacyapp.InstanceIDLabel])
+	assert.Equal(t, ulid.ULID(app.ID()).String(), labels()[legacyapp.IDLabel])
+	fxapptest.AssertEventLogged(t, logs, Event)
+
+	for _, api := range []string{"app.Logger", "app.ID", "app.InstanceID", "app.Labels"} {
+		fxapptest.AssertEventLogged(t, logs, fxapp.DeprecationEvent, fxapptest.Field("d.api", api))
+	}
+	// deprecations are only logged for the legacy types that are injected
+	assert.Empty(t, logs.FindEvents(fxapp.DeprecationEvent, fxapptest.Field("d.api", "app.Name")))
+	assert.Empty(t, logs.FindEvents(fxapp.DeprecationEvent, fxapptest.Field("d.api", "app.Opts")))
+}
@@ -0,0 +1,62 @@
+/*
+ * Copyright (c) 2019 OysterPack, Inc.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ * http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package fxapp
+
+import (
+	"github.com/prometheus/client_golang/prometheus"
+	"time"
+)
+
+// app lifecycle metrics
+const (
+	// AppStartDurationMetricID is the gauge metric ID for how long the app took to start in seconds
+	AppStartDurationMetricID = "U01DJDVE2WJMZRXVZKCJ9EEPYEM"
+	// AppStopDurationMetricID is the gauge metric ID for how long the app took to stop in seconds.
+	//
+	// NOTE: the gauge is set after the app HTTP server is stopped, i.e., it is only observable if the metrics are
+	// gathered after the app is stopped, e.g., when the metrics are pushed.
+	AppStopDurationMetricID = "U01DJDVE2WJ3NVFBC1GSN5CXKY4"
+)
+
+type lifecycleMetrics struct {
+	startDuration prometheus.Gauge
+	stopDuration  prometheus.Gauge
+}
+
+func newLifecycleMetrics() *lifecycleMetrics {
+	return &lifecycleMetrics{
+		startDuration: prometheus.NewGauge(prometheus.GaugeOpts{Name: AppStartDurationMetricID, Help: "app start duration in seconds"}),
+		stopDuration:  prometheus.NewGauge(prometheus.GaugeOpts{Name: AppStopDurationMetricID, Help: "app stop duration in seconds"}),
+	}
+}
+
+func (m *lifecycleMetrics) started(d time.Duration) {
+	m.startDuration.Set(d.Seconds())
+}
+
+func (m *lifecycleMetrics) stopped(d time.Duration) {
+	m.stopDuration.Set(d.Seconds())
+}
+
+func registerLifecycleMetrics(m *lifecycleMetrics, registerer prometheus.Registerer) error {
+	for _, gauge := range []prometheus.Collector{m.startDuration, m.stopDuration} {
+		if err := registerer.Register(gauge); err != nil {
+			return err
+		}
+	}
+	return nil
+}
@@ -0,0 +1,375 @@
+/*
+ * Copyright (c) 2019 OysterPack, Inc.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ * http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package fxapp
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"github.com/oysterpack/andiamo/pkg/clock"
+	"github.com/oysterpack/andiamo/pkg/eventlog"
+	"github.com/oysterpack/andiamo/pkg/fx/health"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/rs/zerolog"
+	"go.uber.org/fx"
+	"go.uber.org/multierr"
+	"net/http"
+	"runtime"
+	"strconv"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// LoadSheddingEvent is logged at warn level when load shedding engages, and at info level when it disengages.
+//
+//	type Data struct {
+//		Engaged  bool     `json:"engaged"`
+//		// the degraded signals, e.g., health, goroutines, cpu, memory
+//		Signals  []string `json:"signals"`
+//		Fraction float64  `json:"fraction"`
+//		// the number of requests that were shed while load shedding was engaged - only set when load shedding disengages
+//		Shed     uint64   `json:"shed"`
+//	}
+const LoadSheddingEvent = "01DJ39KH40VPE5WHKAA9N5RXGM"
+
+// load shedding metric IDs
+const (
+	// LoadShedMetricID counts the requests that were shed
+	LoadShedMetricID = "U01DJ39KH89DEHCWVFBK75MN4NX"
+	// LoadSheddingMetricID is a gauge that is set to 1 while load shedding is engaged, and 0 otherwise
+	LoadSheddingMetricID = "U01DJ39KHCJ3WRKSAEJFQY79J45"
+)
+
+// load shedding signal names
+const (
+	HealthLoadSignal     = "health"
+	GoroutinesLoadSignal = "goroutines"
+	CPULoadSignal        = "cpu"
+	MemoryLoadSignal     = "memory"
+)
+
+// ErrInvalidLoadSheddingOpts indicates the load shedding options are invalid
+var ErrInvalidLoadSheddingOpts = errors.New("invalid load shedding options")
+
+// LoadSheddingOpts is used to configure load shedding - see `Builder.EnableLoadShedding()`.
+//
+// Load shedding engages when any of the enabled signals degrade, and disengages once all of the signals recover.
+type LoadSheddingOpts struct {
+	// Fraction is the fraction of non-critical requests that are rejected while load shedding is engaged, in the range
+	// (0, 1]
+	Fraction float64
+	// Status is the HTTP status for shed requests, i.e., either 429 or 503. If zero, then 503 is used.
+	Status int
+	// RetryAfter is returned via the `Retry-After` response header for shed requests. If zero, then the header is not set.
+	RetryAfter time.Duration
+	// CheckInterval is how often the signals are evaluated. If zero, then 1 sec is used.
+	CheckInterval time.Duration
+
+	// ShedOnYellow engages load shedding when the overall health is not Green
+	ShedOnYellow bool
+	// MaxGoroutines engages load shedding when the number of goroutines reaches the max. If zero, then the signal is disabled.
+	MaxGoroutines int
+	// MaxCPUUsage engages load shedding when the process CPU usage reaches the max, which is a ratio of GOMAXPROCS in the
+	// range (0, 1]. If zero, then the signal is disabled.
+	MaxCPUUsage float64
+	// MaxMemoryUsage engages load shedding when the process RSS reaches the max, which is a ratio of the memory limit in
+	// the range (0, 1]. If zero, then the signal is disabled.
+	MaxMemoryUsage float64
+	// MemoryLimit is the memory limit in bytes. If zero, then the cgroup memory limit is used.
+	MemoryLimit uint64
+
+	// Critical requests are never shed. The readiness probe, liveness probe, and metrics endpoints are always critical.
+	Critical func(request *http.Request) bool
+}
+
+// DefaultLoadSheddingOpts returns the default load shedding options:
+//   - half of the non-critical requests are rejected with HTTP 503 while load shedding is engaged
+//   - load shedding engages when the overall health is not Green, or CPU or memory usage reaches 90%
+func DefaultLoadSheddingOpts() LoadSheddingOpts {
+	return LoadSheddingOpts{
+		Fraction:       0.5,
+		Status:         http.StatusServiceUnavailable,
+		RetryAfter:     time.Second,
+		CheckInterval:  time.Second,
+		ShedOnYellow:   true,
+		MaxCPUUsage:    0.9,
+		MaxMemoryUsage: 0.9,
+	}
+}
+
+func (opts LoadSheddingOpts) withDefaults() LoadSheddingOpts {
+	if opts.Status == 0 {
+		opts.Status = http.StatusServiceUnavailable
+	}
+	if opts.CheckInterval == 0 {
+		opts.CheckInterval = time.Second
+	}
+	return opts
+}
+
+func (opts LoadSheddingOpts) validate() error {
+	var err error
+	invalid := func(msg string) {
+		err = multierr.Append(err, fmt.Errorf("%s : %s", ErrInvalidLoadSheddingOpts, msg))
+	}
+	if opts.Fraction <= 0 || opts.Fraction > 1 {
+		invalid(fmt.Sprintf("Fraction must be in the range (0, 1] : %v", opts.Fraction))
+	}
+	if opts.Status != 0 && opts.Status != http.StatusTooManyRequests && opts.Status != http.StatusServiceUnavailable {
+		invalid(fmt.Sprintf("Status must be either 429 or 503 : %d", opts.Status))
+	}
+	if opts.RetryAfter < 0 || opts.CheckInterval < 0 {
+		invalid("RetryAfter and CheckInterval must not be negative")
+	}
+	if opts.MaxGoroutines < 0 {
+		invalid(fmt.Sprintf("MaxGoroutines must not be negative : %d", opts.MaxGoroutines))
+	}
+	if opts.MaxCPUUsage < 0 || opts.MaxCPUUsage > 1 {
+		invalid(fmt.Sprintf("MaxCPUUsage must be in the range (0, 1] : %v", opts.MaxCPUUsage))
+	}
+	if opts.MaxMemoryUsage < 0 || opts.MaxMemoryUsage > 1 {
+		invalid(fmt.Sprintf("MaxMemoryUsage must be in the range (0, 1] : %v", opts.MaxMemoryUsage))
+	}
+	if !opts.ShedOnYellow && opts.MaxGoroutines == 0 && opts.MaxCPUUsage == 0 && opts.MaxMemoryUsage == 0 {
+		invalid("at least 1 signal must be enabled")
+	}
+	return err
+}
+
+// loadSignal reports whether the signal is degraded
+type loadSignal struct {
+	name     string
+	degraded func() bool
+}
+
+func loadSignals(opts LoadSheddingOpts, overallHealth health.OverallHealth, clock clock.Clock) []loadSignal {
+	var signals []loadSignal
+	if opts.ShedOnYellow {
+		signals = append(signals, loadSignal{HealthLoadSignal, func() bool {
+			return overallHealth() != health.Green
+		}})
+	}
+	if opts.MaxGoroutines > 0 {
+		signals = append(signals, loadSignal{GoroutinesLoadSignal, func() bool {
+			return runtime.NumGoroutine() >= opts.MaxGoroutines
+		}})
+	}
+	if opts.MaxCPUUsage > 0 {
+		signals = append(signals, loadSignal{CPULoadSignal, cpuUsageSignal(opts.MaxCPUUsage, clock)})
+	}
+	if opts.MaxMemoryUsage > 0 {
+		signals = append(signals, loadSignal{MemoryLoadSignal, func() bool {
+			rss, limit, err := memoryUsage()
+			if opts.MemoryLimit > 0 {
+				limit = opts.MemoryLimit
+			}
+			// memory usage is not measurable on the platform, or there is no memory limit
+			if err != nil || limit == 0 {
+				return false
+			}
+			return float64(rss)/float64(limit) >= opts.MaxMemoryUsage
+		}})
+	}
+	return signals
+}
+
+// the CPU usage is measured between evaluations, relative to GOMAXPROCS
+func cpuUsageSignal(max float64, clock clock.Clock) func() bool {
+	var lastTime time.Time
+	var lastCPU time.Duration
+	return func() bool {
+		cpu, err := processCPUTime()
+		if err != nil {
+			return false
+		}
+		now := clock.Now()
+		defer func() {
+			lastTime, lastCPU = now, cpu
+		}()
+		if lastTime.IsZero() {
+			return false
+		}
+		elapsed := now.Sub(lastTime)
+		if elapsed <= 0 {
+			return false
+		}
+		usage := float64(cpu-lastCPU) / (float64(elapsed) * float64(runtime.GOMAXPROCS(0)))
+		return usage >= max
+	}
+}
+
+type loadShedder struct {
+	opts    LoadSheddingOpts
+	signals []loadSignal
+	clock   clock.Clock
+	exempt  map[string]bool
+
+	logEngaged, logDisengaged eventlog.Logger
+
+	// used to shed the configured fraction of requests
+	requests uint64
+	shed     uint64
+	engaged  int32
+
+	mutex sync.Mutex
+	// the degraded signals
+	degraded []string
+	// the shed count when load shedding engaged
+	shedWhenEngaged uint64
+}
+
+func newLoadShedder(opts LoadSheddingOpts, clock clock.Clock) func(overallHealth health.OverallHealth, logger *zerolog.Logger) *loadShedder {
+	opts = opts.withDefaults()
+	return func(overallHealth health.OverallHealth, logger *zerolog.Logger) *loadShedder {
+		return &loadShedder{
+			opts:    opts,
+			signals: loadSignals(opts, overallHealth, clock),
+			clock:   clock,
+			exempt: map[string]bool{
+				fmt.Sprintf("/%s", ReadyEvent):         true,
+				fmt.Sprintf("/%s", LivenessProbeEvent): true,
+				fmt.Sprintf("/%s", MetricsEndpoint):    true,
+			},
+			logEngaged:    eventlog.NewLogger(LoadSheddingEvent, logger, zerolog.WarnLevel),
+			logDisengaged: eventlog.NewLogger(LoadSheddingEvent, logger, zerolog.InfoLevel),
+		}
+	}
+}
+
+type loadSheddingChange struct {
+	engaged  bool
+	signals  []string
+	fraction float64
+	shed     uint64
+}
+
+func (e loadSheddingChange) MarshalZerologObject(event *zerolog.Event) {
+	event.
+		Bool("engaged", e.engaged).
+		Strs("signals", e.signals).
+		Float64("fraction", e.fraction)
+	if !e.engaged {
+		event.Uint64("shed", e.shed)
+	}
+}
+
+// evaluate evaluates the signals, and engages or disengages load shedding
+func (s *loadShedder) evaluate() {
+	var degraded []string
+	for _, signal := range s.signals {
+		if signal.degraded() {
+			degraded = append(degraded, signal.name)
+		}
+	}
+
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	wasEngaged := len(s.degraded) > 0
+	s.degraded = degraded
+	switch {
+	case !wasEngaged && len(degraded) > 0:
+		s.shedWhenEngaged = atomic.LoadUint64(&s.shed)
+		atomic.StoreInt32(&s.engaged, 1)
+		s.logEngaged(loadSheddingChange{engaged: true, signals: degraded, fraction: s.opts.Fraction}, "load shedding engaged")
+	case wasEngaged && len(degraded) == 0:
+		atomic.StoreInt32(&s.engaged, 0)
+		s.logDisengaged(loadSheddingChange{
+			signals:  []string{},
+			fraction: s.opts.Fraction,
+			shed:     atomic.LoadUint64(&s.shed) - s.shedWhenEngaged,
+		}, "load shedding disengaged")
+	}
+}
+
+func (s *loadShedder) isEngaged() bool {
+	return atomic.LoadInt32(&s.engaged) == 1
+}
+
+// shouldShed sheds the configured fraction of requests deterministically, i.e., a request is shed each time the
+// cumulative shed quota crosses an integer boundary
+func (s *loadShedder) shouldShed() bool {
+	n := atomic.AddUint64(&s.requests, 1)
+	return uint64(float64(n)*s.opts.Fraction) > uint64(float64(n-1)*s.opts.Fraction)
+}
+
+func (s *loadShedder) critical(request *http.Request) bool {
+	return s.exempt[request.URL.Path] || (s.opts.Critical != nil && s.opts.Critical(request))
+}
+
+// middleware rejects the configured fraction of non-critical requests while load shedding is engaged
+func (s *loadShedder) middleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(writer http.ResponseWriter, request *http.Request) {
+		if s.isEngaged() && !s.critical(request) && s.shouldShed() {
+			atomic.AddUint64(&s.shed, 1)
+			if s.opts.RetryAfter > 0 {
+				writer.Header().Set("Retry-After", strconv.Itoa(int((s.opts.RetryAfter+time.Second-1)/time.Second)))
+			}
+			http.Error(writer, "load shedding", s.opts.Status)
+			return
+		}
+		next.ServeHTTP(writer, request)
+	})
+}
+
+// runLoadShedder evaluates the load signals on the check interval while the app is running
+func runLoadShedder(lc fx.Lifecycle, shedder *loadShedder, registerer prometheus.Registerer) error {
+	err := multierr.Combine(
+		registerer.Register(prometheus.NewCounterFunc(prometheus.CounterOpts{Name: LoadShedMetricID, Help: "requests that were shed"}, func() float64 {
+			return float64(atomic.LoadUint64(&shedder.shed))
+		})),
+		registerer.Register(prometheus.NewGaugeFunc(prometheus.GaugeOpts{Name: LoadSheddingMetricID, Help: "1 if load shedding is engaged, 0 otherwise"}, func() float64 {
+			return float64(atomic.LoadInt32(&shedder.engaged))
+		})),
+	)
+	if err != nil {
+		return err
+	}
+
+	stop := make(chan struct{})
+	done := make(chan struct{})
+	lc.Append(fx.Hook{
+		OnStart: func(context.Context) error {
+			shedder.evaluate()
+			go func() {
+				defer close(done)
+				timer := shedder.clock.NewTimer(shedder.opts.CheckInterval)
+				defer timer.Stop()
+				for {
+					select {
+					case <-timer.C():
+						timer.Reset(shedder.opts.CheckInterval)
+						shedder.evaluate()
+					case <-stop:
+						return
+					}
+				}
+			}()
+			return nil
+		},
+		OnStop: func(ctx context.Context) error {
+			close(stop)
+			select {
+			case <-done:
+				return nil
+			case <-ctx.Done():
+				return ctx.Err()
+			}
+		},
+	})
+	return nil
+}
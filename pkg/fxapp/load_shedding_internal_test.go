@@ -0,0 +1,69 @@
+/*
+ * Copyright (c) 2019 OysterPack, Inc.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ * http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package fxapp
+
+import (
+	"github.com/oysterpack/andiamo/pkg/clock"
+	"github.com/oysterpack/andiamo/pkg/fx/health"
+	"github.com/rs/zerolog"
+	"github.com/stretchr/testify/assert"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestLoadShedder(t *testing.T) {
+	t.Parallel()
+
+	buf := new(strings.Builder)
+	logger := zerolog.New(buf)
+	status := health.Green
+	shedder := newLoadShedder(LoadSheddingOpts{Fraction: 0.5, ShedOnYellow: true}, clock.NewFake(time.Now()))(
+		func() health.Status { return status },
+		&logger,
+	)
+	handler := shedder.middleware(http.HandlerFunc(func(writer http.ResponseWriter, request *http.Request) {}))
+	shed := func(requests int) int {
+		count := 0
+		for i := 0; i < requests; i++ {
+			recorder := httptest.NewRecorder()
+			handler.ServeHTTP(recorder, httptest.NewRequest(http.MethodGet, "/foo", nil))
+			if recorder.Code == http.StatusServiceUnavailable {
+				count++
+			}
+		}
+		return count
+	}
+
+	shedder.evaluate()
+	assert.False(t, shedder.isEngaged())
+	assert.Zero(t, shed(10))
+
+	status = health.Yellow
+	shedder.evaluate()
+	assert.True(t, shedder.isEngaged())
+	assert.Equal(t, 5, shed(10), "half of the requests are shed")
+	assert.Contains(t, buf.String(), `"engaged":true,"signals":["health"]`)
+
+	status = health.Green
+	shedder.evaluate()
+	assert.False(t, shedder.isEngaged())
+	assert.Zero(t, shed(10))
+	assert.Contains(t, buf.String(), `"engaged":false,"signals":[],"fraction":0.5,"shed":5`)
+}
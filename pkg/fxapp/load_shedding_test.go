@@ -0,0 +1,130 @@
+/*
+ * Copyright (c) 2019 OysterPack, Inc.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ * http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package fxapp_test
+
+import (
+	"fmt"
+	"github.com/oysterpack/andiamo/pkg/fxapp"
+	"github.com/oysterpack/andiamo/pkg/fxapptest"
+	"github.com/oysterpack/andiamo/pkg/ulids"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"io/ioutil"
+	"net/http"
+	"testing"
+	"time"
+)
+
+func TestBuilder_EnableLoadShedding(t *testing.T) {
+	t.Parallel()
+
+	logs := fxapptest.NewLogCapture()
+	var gatherer prometheus.Gatherer
+	builder := fxapp.NewBuilder(fxapp.ID(ulids.MustNew()), fxapp.ReleaseID(ulids.MustNew())).
+		Provide(
+			func() fxapp.HTTPHandler {
+				return fxapp.NewHTTPHandler("/foo", func(writer http.ResponseWriter, request *http.Request) {})
+			},
+			func() fxapp.HTTPHandler {
+				return fxapp.NewHTTPHandler("/critical", func(writer http.ResponseWriter, request *http.Request) {})
+			},
+		).
+		Invoke(func() {}).
+		EnableLoadShedding(fxapp.LoadSheddingOpts{
+			Fraction:   1,
+			Status:     http.StatusTooManyRequests,
+			RetryAfter: 1500 * time.Millisecond,
+			// there are always more than 1 goroutines, i.e., load shedding is engaged when the app starts
+			MaxGoroutines: 1,
+			Critical: func(request *http.Request) bool {
+				return request.URL.Path == "/critical"
+			},
+		}).
+		Populate(&gatherer).
+		LogWriter(logs)
+
+	fxapptest.RunApp(t, builder, func(app fxapp.App, client *fxapptest.HTTPClient) {
+		fxapptest.AssertEventLogged(t, logs, fxapp.LoadSheddingEvent,
+			fxapptest.Field("l", "warn"),
+			fxapptest.Field("d.engaged", true),
+			fxapptest.Field("d.signals", []interface{}{fxapp.GoroutinesLoadSignal}),
+		)
+
+		status := func(path string) int {
+			response, err := client.Get(path)
+			require.NoError(t, err)
+			defer response.Body.Close()
+			ioutil.ReadAll(response.Body)
+			if response.StatusCode == http.StatusTooManyRequests {
+				assert.Equal(t, "2", response.Header.Get("Retry-After"))
+			}
+			return response.StatusCode
+		}
+		for i := 0; i < 3; i++ {
+			assert.Equal(t, http.StatusTooManyRequests, status("foo"))
+		}
+		assert.Equal(t, http.StatusOK, status("critical"))
+		// the probes are never shed
+		assert.Equal(t, http.StatusOK, status(fxapp.ReadyEvent))
+		assert.Equal(t, http.StatusOK, status(fxapp.LivenessProbeEvent))
+
+		metrics, err := gatherer.Gather()
+		require.NoError(t, err)
+		values := make(map[string]float64)
+		for _, mf := range metrics {
+			for _, m := range mf.Metric {
+				switch {
+				case m.Counter != nil:
+					values[mf.GetName()] = m.Counter.GetValue()
+				case m.Gauge != nil:
+					values[mf.GetName()] = m.Gauge.GetValue()
+				}
+			}
+		}
+		assert.Equal(t, 3.0, values[fxapp.LoadShedMetricID], fmt.Sprint(values))
+		assert.Equal(t, 1.0, values[fxapp.LoadSheddingMetricID])
+	})
+}
+
+func TestLoadSheddingOpts_Validation(t *testing.T) {
+	t.Parallel()
+
+	for _, opts := range []fxapp.LoadSheddingOpts{
+		{Fraction: 0, ShedOnYellow: true},
+		{Fraction: 1.5, ShedOnYellow: true},
+		{Fraction: 0.5, ShedOnYellow: true, Status: http.StatusInternalServerError},
+		{Fraction: 0.5, MaxCPUUsage: 2},
+		// no signals are enabled
+		{Fraction: 0.5},
+	} {
+		_, err := fxapp.NewBuilder(fxapp.ID(ulids.MustNew()), fxapp.ReleaseID(ulids.MustNew())).
+			Invoke(func() {}).
+			EnableLoadShedding(opts).
+			DisableHTTPServer().
+			Build()
+		require.Error(t, err, "%#v", opts)
+		assert.Contains(t, err.Error(), fxapp.ErrInvalidLoadSheddingOpts.Error())
+	}
+
+	_, err := fxapp.NewBuilder(fxapp.ID(ulids.MustNew()), fxapp.ReleaseID(ulids.MustNew())).
+		Invoke(func() {}).
+		EnableLoadShedding(fxapp.DefaultLoadSheddingOpts()).
+		DisableHTTPServer().
+		Build()
+	assert.NoError(t, err)
+}
@@ -0,0 +1,56 @@
+/*
+ * Copyright (c) 2019 OysterPack, Inc.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ * http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package fxapp_test
+
+import (
+	"context"
+	"github.com/oysterpack/andiamo/pkg/fx/lock"
+	"github.com/oysterpack/andiamo/pkg/fxapp"
+	"github.com/oysterpack/andiamo/pkg/fxapptest"
+	"github.com/oysterpack/andiamo/pkg/ulids"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"testing"
+)
+
+func TestBuilder_EnableDistributedLocks(t *testing.T) {
+	t.Parallel()
+
+	var distributedLock lock.DistributedLock
+	logs := fxapptest.NewLogCapture()
+	app, err := fxapp.NewBuilder(fxapp.ID(ulids.MustNew()), fxapp.ReleaseID(ulids.MustNew())).
+		Provide(lock.NewMemoryBackend).
+		Invoke(func() {}).
+		EnableDistributedLocks(lock.DefaultOpts()).
+		Populate(&distributedLock).
+		DisableHTTPServer().
+		LogWriter(logs).
+		Build()
+	require.NoError(t, err)
+	go app.Run()
+	<-app.Ready()
+
+	_, ok, err := distributedLock.TryAcquire(context.Background(), "foo")
+	require.NoError(t, err)
+	assert.True(t, ok)
+	fxapptest.AssertEventLogged(t, logs, lock.LockAcquiredEvent, fxapptest.Field("d.lock", "foo"))
+
+	// locks are released when the app is stopped
+	app.Shutdown()
+	<-app.Done()
+	fxapptest.AssertEventLogged(t, logs, lock.LockReleasedEvent, fxapptest.Field("d.lock", "foo"))
+}
@@ -0,0 +1,110 @@
+/*
+ * Copyright (c) 2019 OysterPack, Inc.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ * http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package fxapp
+
+import (
+	"context"
+	"github.com/kelseyhightower/envconfig"
+	"github.com/oysterpack/andiamo/pkg/eventlog"
+	"github.com/prometheus/client_golang/prometheus"
+	"go.uber.org/multierr"
+	"time"
+)
+
+// LogSinkEnvconfigPrefix is used to load the log sink options from env vars - see `LoadLogSinkOptsFromEnv()`
+const LogSinkEnvconfigPrefix = EnvconfigPrefix + "_" + logSinkEnvName
+
+// log sink metric IDs, which are used as the prometheus metric names
+const (
+	// counter - events that were shipped to the log collector
+	LogSinkSentMetricID = "U01DJ2S46N3W6ZJR4VQ5DM8R39V"
+	// counter - events that were dropped because the sink buffer was full
+	LogSinkDroppedMetricID = "U01DJ2S46SCF6FFFTR0S24ES3XV"
+	// counter - events that were dropped because they failed to ship after all retries
+	LogSinkFailedMetricID = "U01DJ2GWGWJEMSP6TYWPRSV9VVF"
+	// counter - batch retries
+	LogSinkRetriesMetricID = "U01DJ2GWH0VXBW06Z1HTBW8KSW9"
+	// gauge - events that are buffered
+	LogSinkQueuedMetricID = "U01DJ2GWH54APV7ZKJCE3CC0158"
+	// gauge - seconds - the export lag, i.e., how long the oldest event in the last shipped batch was buffered
+	LogSinkLagMetricID = "U01DJ2GWH9D3B3SK1VGNV70WJSS"
+)
+
+// LoadLogSinkOptsFromEnv tries to load the log sink options from env vars:
+//
+//   - APP12X_LOG_SINK_URL, e.g., "tcp://vector:9000", "http://fluentd:9880/app.logs"
+//   - APP12X_LOG_SINK_FORMAT, i.e., "ndjson", "loki", or "elasticsearch" - see `eventlog.LokiFormat` and
+//     `eventlog.ElasticsearchFormat`
+//   - APP12X_LOG_SINK_INDEX - the Elasticsearch index
+//   - APP12X_LOG_SINK_BATCH_SIZE
+//   - APP12X_LOG_SINK_FLUSH_INTERVAL, e.g., "1s"
+//   - APP12X_LOG_SINK_BUFFER_SIZE
+//   - APP12X_LOG_SINK_MAX_RETRIES
+//   - APP12X_LOG_SINK_RETRY_BACKOFF, e.g., "500ms"
+//   - APP12X_LOG_SINK_TIMEOUT, e.g., "5s"
+//   - APP12X_LOG_SINK_AUTH_TOKEN
+//
+// If the log sink is not enabled via the builder, then it is enabled if the URL is configured via env vars.
+func LoadLogSinkOptsFromEnv() (eventlog.SinkOpts, error) {
+	return loadLogSinkOpts(EnvconfigPrefix)
+}
+
+func loadLogSinkOpts(prefix EnvPrefix) (eventlog.SinkOpts, error) {
+	var opts eventlog.SinkOpts
+	err := envconfig.Process(prefix.EnvVar(logSinkEnvName), &opts)
+	return opts, err
+}
+
+// closeLogSink flushes the buffered events within the timeout
+func closeLogSink(sink *eventlog.Sink, timeout time.Duration) {
+	if sink == nil {
+		return
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), timeout)
+	defer cancel()
+	sink.Close(ctx)
+}
+
+func registerLogSinkMetrics(sink *eventlog.Sink) func(registerer prometheus.Registerer) error {
+	return func(registerer prometheus.Registerer) error {
+		counter := func(name, help string, value func(stats eventlog.SinkStats) uint64) prometheus.Collector {
+			return prometheus.NewCounterFunc(prometheus.CounterOpts{Name: name, Help: help}, func() float64 {
+				return float64(value(sink.Stats()))
+			})
+		}
+		return multierr.Combine(
+			registerer.Register(counter(LogSinkSentMetricID, "events that were shipped to the log collector", func(stats eventlog.SinkStats) uint64 {
+				return stats.Sent
+			})),
+			registerer.Register(counter(LogSinkDroppedMetricID, "events that were dropped because the log sink buffer was full", func(stats eventlog.SinkStats) uint64 {
+				return stats.Dropped
+			})),
+			registerer.Register(counter(LogSinkFailedMetricID, "events that failed to ship to the log collector after all retries", func(stats eventlog.SinkStats) uint64 {
+				return stats.Failed
+			})),
+			registerer.Register(counter(LogSinkRetriesMetricID, "log sink batch retries", func(stats eventlog.SinkStats) uint64 {
+				return stats.Retries
+			})),
+			registerer.Register(prometheus.NewGaugeFunc(prometheus.GaugeOpts{Name: LogSinkQueuedMetricID, Help: "events that are buffered by the log sink"}, func() float64 {
+				return float64(sink.Stats().Queued)
+			})),
+			registerer.Register(prometheus.NewGaugeFunc(prometheus.GaugeOpts{Name: LogSinkLagMetricID, Help: "log sink export lag in seconds"}, func() float64 {
+				return sink.Stats().Lag.Seconds()
+			})),
+		)
+	}
+}
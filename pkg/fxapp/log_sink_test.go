@@ -0,0 +1,127 @@
+/*
+ * Copyright (c) 2019 OysterPack, Inc.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ * http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package fxapp_test
+
+import (
+	"github.com/oysterpack/andiamo/pkg/eventlog"
+	"github.com/oysterpack/andiamo/pkg/fxapp"
+	"github.com/oysterpack/andiamo/pkg/ulids"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+)
+
+type logCollector struct {
+	*httptest.Server
+	mutex  sync.Mutex
+	events []string
+}
+
+func newLogCollector() *logCollector {
+	collector := &logCollector{}
+	collector.Server = httptest.NewServer(http.HandlerFunc(func(writer http.ResponseWriter, request *http.Request) {
+		body, _ := ioutil.ReadAll(request.Body)
+		collector.mutex.Lock()
+		defer collector.mutex.Unlock()
+		collector.events = append(collector.events, strings.Split(strings.TrimSpace(string(body)), "\n")...)
+	}))
+	return collector
+}
+
+func (c *logCollector) logged(event string) bool {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	for _, e := range c.events {
+		if strings.Contains(e, event) {
+			return true
+		}
+	}
+	return false
+}
+
+func TestBuilder_EnableLogSink(t *testing.T) {
+	t.Parallel()
+
+	collector := newLogCollector()
+	defer collector.Close()
+
+	var gatherer prometheus.Gatherer
+	app, err := fxapp.NewBuilder(fxapp.ID(ulids.MustNew()), fxapp.ReleaseID(ulids.MustNew())).
+		Invoke(func() {}).
+		EnableLogSink(eventlog.SinkOpts{URL: collector.URL}).
+		Populate(&gatherer).
+		DisableHTTPServer().
+		LogWriter(ioutil.Discard).
+		Build()
+	require.NoError(t, err)
+	go app.Run()
+	<-app.Ready()
+
+	mfs, err := gatherer.Gather()
+	require.NoError(t, err)
+	metrics := make(map[string]bool)
+	for _, mf := range mfs {
+		metrics[mf.GetName()] = true
+	}
+	for _, metricID := range []string{fxapp.LogSinkSentMetricID, fxapp.LogSinkDroppedMetricID, fxapp.LogSinkFailedMetricID, fxapp.LogSinkRetriesMetricID, fxapp.LogSinkQueuedMetricID, fxapp.LogSinkLagMetricID} {
+		assert.True(t, metrics[metricID], metricID)
+	}
+
+	// the buffered events are flushed when the app is stopped
+	app.Shutdown()
+	<-app.Done()
+	for _, event := range []string{fxapp.InitializedEvent, fxapp.StartedEvent, fxapp.StoppedEvent} {
+		assert.True(t, collector.logged(event), event)
+	}
+}
+
+func TestLogSink_EnabledViaEnv(t *testing.T) {
+	collector := newLogCollector()
+	defer collector.Close()
+	t.Setenv(fxapp.LogSinkEnvconfigPrefix+"_URL", collector.URL)
+
+	app, err := fxapp.NewBuilder(fxapp.ID(ulids.MustNew()), fxapp.ReleaseID(ulids.MustNew())).
+		Invoke(func() {}).
+		DisableHTTPServer().
+		LogWriter(ioutil.Discard).
+		Build()
+	require.NoError(t, err)
+	go app.Run()
+	<-app.Ready()
+	app.Shutdown()
+	<-app.Done()
+	assert.True(t, collector.logged(fxapp.StoppedEvent))
+}
+
+func TestLogSinkOpts_Validation(t *testing.T) {
+	t.Parallel()
+
+	_, err := fxapp.NewBuilder(fxapp.ID(ulids.MustNew()), fxapp.ReleaseID(ulids.MustNew())).
+		Invoke(func() {}).
+		EnableLogSink(eventlog.SinkOpts{URL: "ftp://collector"}).
+		DisableHTTPServer().
+		LogWriter(ioutil.Discard).
+		Build()
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), eventlog.ErrInvalidSinkOpts.Error())
+}
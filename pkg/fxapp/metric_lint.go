@@ -0,0 +1,219 @@
+/*
+ * Copyright (c) 2019 OysterPack, Inc.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ * http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package fxapp
+
+import (
+	"fmt"
+	"github.com/oklog/ulid"
+	"github.com/pkg/errors"
+	"github.com/prometheus/client_golang/prometheus"
+	"go.uber.org/multierr"
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+// metric lint errors
+var (
+	ErrMetricNameConvention      = errors.New("metric name must be snake_case or a ULID metric ID, i.e., \"U\" + ULID")
+	ErrMetricLabelNameConvention = errors.New("metric label name must be snake_case")
+	ErrMetricNonBaseUnit         = errors.New("metric name must use base units, i.e., seconds and bytes")
+	ErrCounterMissingTotalSuffix = errors.New("counter metric name must end with `_total`")
+	ErrTooManyMetricLabels       = errors.New("metric has too many variable labels")
+	ErrForbiddenMetricLabel      = errors.New("metric label is forbidden")
+)
+
+// MetricLintOpts is used to configure the metric lint rules that are enforced when metrics are registered via the
+// app provided prometheus.Registerer.
+type MetricLintOpts struct {
+	// MaxVariableLabels bounds label cardinality by limiting the number of variable labels per metric
+	MaxVariableLabels int
+	// ForbiddenLabels are label names that are not allowed, e.g., unbounded labels like user IDs
+	ForbiddenLabels []string
+	// Disabled disables the metric lint rules
+	Disabled bool
+}
+
+// DefaultMetricLintOpts constructs a new MetricLintOpts with the following options:
+//   - max variable labels: 5
+//   - forbidden labels: user_id, email, request_id, session_id, trace_id
+func DefaultMetricLintOpts() MetricLintOpts {
+	return MetricLintOpts{
+		MaxVariableLabels: 5,
+		ForbiddenLabels:   []string{"user_id", "email", "request_id", "session_id", "trace_id"},
+	}
+}
+
+var (
+	snakeCase = regexp.MustCompile("^[a-z][a-z0-9]*(_[a-z0-9]+)*$")
+
+	// non base unit suffixes mapped to the base unit
+	nonBaseUnits = map[string]string{
+		"milliseconds": "seconds",
+		"microseconds": "seconds",
+		"nanoseconds":  "seconds",
+		"minutes":      "seconds",
+		"hours":        "seconds",
+		"days":         "seconds",
+		"kilobytes":    "bytes",
+		"megabytes":    "bytes",
+		"gigabytes":    "bytes",
+	}
+)
+
+// NewLintingRegisterer wraps the registerer with a validating layer that enforces the metric naming conventions:
+//   - metric names must be snake_case or ULID metric IDs, i.e., "U" + ULID
+//   - snake_case metric names must use base units, e.g., `_seconds` instead of `_milliseconds`
+//   - snake_case counter names must end with `_total` - counters are detected for collectors created via
+//     prometheus.NewCounter() and prometheus.NewCounterVec(). Counters that are registered via a wrapping registerer,
+//     e.g., prometheus.WrapRegistererWith(), are not detected.
+//   - variable label names must be snake_case and must not be forbidden
+//   - the number of variable labels is bounded
+//
+// Metrics that violate the conventions are rejected at registration time with a descriptive error.
+func NewLintingRegisterer(registerer prometheus.Registerer, opts MetricLintOpts) prometheus.Registerer {
+	if opts.Disabled {
+		return registerer
+	}
+	forbiddenLabels := make(map[string]bool, len(opts.ForbiddenLabels))
+	for _, label := range opts.ForbiddenLabels {
+		forbiddenLabels[label] = true
+	}
+	return &lintingRegisterer{
+		Registerer:        registerer,
+		maxVariableLabels: opts.MaxVariableLabels,
+		forbiddenLabels:   forbiddenLabels,
+	}
+}
+
+type lintingRegisterer struct {
+	prometheus.Registerer
+	maxVariableLabels int
+	forbiddenLabels   map[string]bool
+}
+
+func (r *lintingRegisterer) Register(collector prometheus.Collector) error {
+	if err := r.lint(collector); err != nil {
+		return err
+	}
+	return r.Registerer.Register(collector)
+}
+
+func (r *lintingRegisterer) MustRegister(collectors ...prometheus.Collector) {
+	for _, collector := range collectors {
+		if err := r.Register(collector); err != nil {
+			panic(err)
+		}
+	}
+}
+
+func (r *lintingRegisterer) lint(collector prometheus.Collector) error {
+	descs := make(chan *prometheus.Desc)
+	go func() {
+		defer close(descs)
+		collector.Describe(descs)
+	}()
+
+	var err error
+	for desc := range descs {
+		name, labels, ok := parseDesc(desc)
+		if !ok {
+			// the desc is invalid, which is reported by the registry
+			continue
+		}
+		err = multierr.Append(err, r.lintMetric(collector, name, labels))
+	}
+	return err
+}
+
+func (r *lintingRegisterer) lintMetric(collector prometheus.Collector, name string, labels []string) error {
+	var err error
+	lintErr := func(e error, msg string) {
+		err = multierr.Append(err, fmt.Errorf("%s : %s", e, msg))
+	}
+	switch {
+	case isMetricID(name):
+	case !snakeCase.MatchString(name):
+		lintErr(ErrMetricNameConvention, name)
+	default:
+		for _, part := range strings.Split(name, "_") {
+			if base, ok := nonBaseUnits[part]; ok {
+				lintErr(ErrMetricNonBaseUnit, fmt.Sprintf("%s : use %s instead of %s", name, base, part))
+			}
+		}
+		if isCounter(collector) && !strings.HasSuffix(name, "_total") {
+			lintErr(ErrCounterMissingTotalSuffix, name)
+		}
+	}
+
+	if r.maxVariableLabels > 0 && len(labels) > r.maxVariableLabels {
+		lintErr(ErrTooManyMetricLabels, fmt.Sprintf("%s : %v : max allowed is %d", name, labels, r.maxVariableLabels))
+	}
+	for _, label := range labels {
+		if !snakeCase.MatchString(label) {
+			lintErr(ErrMetricLabelNameConvention, fmt.Sprintf("%s : %s", name, label))
+		}
+		if r.forbiddenLabels[label] {
+			lintErr(ErrForbiddenMetricLabel, fmt.Sprintf("%s : %s", name, label))
+		}
+	}
+	return err
+}
+
+func isMetricID(name string) bool {
+	if !strings.HasPrefix(name, "U") {
+		return false
+	}
+	_, err := ulid.ParseStrict(name[1:])
+	return err == nil
+}
+
+func isCounter(collector prometheus.Collector) bool {
+	switch collector.(type) {
+	case prometheus.Gauge: // gauges implement the Counter interface
+		return false
+	case prometheus.Counter, *prometheus.CounterVec:
+		return true
+	default:
+		return false
+	}
+}
+
+// parses the metric name and variable label names from the desc, which are not exposed by the prometheus client.
+// The desc string format is:
+//
+//	Desc{fqName: "name", help: "help", constLabels: {...}, variableLabels: [a b]}
+func parseDesc(desc *prometheus.Desc) (name string, labels []string, ok bool) {
+	s := desc.String()
+	const namePrefix = "Desc{fqName: "
+	const labelsPrefix = "variableLabels: ["
+	if !strings.HasPrefix(s, namePrefix) {
+		return "", nil, false
+	}
+	quotedName, err := strconv.QuotedPrefix(s[len(namePrefix):])
+	if err != nil {
+		return "", nil, false
+	}
+	if name, err = strconv.Unquote(quotedName); err != nil {
+		return "", nil, false
+	}
+	i := strings.LastIndex(s, labelsPrefix)
+	if i < 0 || !strings.HasSuffix(s, "]}") {
+		return "", nil, false
+	}
+	return name, strings.Fields(s[i+len(labelsPrefix) : len(s)-2]), true
+}
@@ -0,0 +1,87 @@
+/*
+ * Copyright (c) 2019 OysterPack, Inc.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ * http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package fxapp_test
+
+import (
+	"github.com/oysterpack/andiamo/pkg/fxapp"
+	"github.com/oysterpack/andiamo/pkg/ulids"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/stretchr/testify/assert"
+	"testing"
+)
+
+func TestNewLintingRegisterer(t *testing.T) {
+	t.Parallel()
+
+	registerer := fxapp.NewLintingRegisterer(prometheus.NewRegistry(), fxapp.DefaultMetricLintOpts())
+
+	testCases := []struct {
+		name      string
+		collector prometheus.Collector
+		err       error
+	}{
+		{"ULID metric ID", prometheus.NewCounter(prometheus.CounterOpts{Name: "U" + ulids.MustNew().String(), Help: "help"}), nil},
+		{"snake_case counter", prometheus.NewCounter(prometheus.CounterOpts{Name: "requests_total", Help: "help"}), nil},
+		{"snake_case gauge", prometheus.NewGaugeVec(prometheus.GaugeOpts{Name: "queue_size", Help: "help"}, []string{"queue"}), nil},
+		{"camel case name", prometheus.NewGauge(prometheus.GaugeOpts{Name: "queueSize", Help: "help"}), fxapp.ErrMetricNameConvention},
+		{"counter without total suffix", prometheus.NewCounterVec(prometheus.CounterOpts{Name: "errors", Help: "help"}, []string{"code"}), fxapp.ErrCounterMissingTotalSuffix},
+		{"non base unit", prometheus.NewHistogram(prometheus.HistogramOpts{Name: "latency_milliseconds", Help: "help"}), fxapp.ErrMetricNonBaseUnit},
+		{"camel case label", prometheus.NewGaugeVec(prometheus.GaugeOpts{Name: "pool_size", Help: "help"}, []string{"poolName"}), fxapp.ErrMetricLabelNameConvention},
+		{"forbidden label", prometheus.NewGaugeVec(prometheus.GaugeOpts{Name: "logins", Help: "help"}, []string{"user_id"}), fxapp.ErrForbiddenMetricLabel},
+		{"too many labels", prometheus.NewGaugeVec(prometheus.GaugeOpts{Name: "foo", Help: "help"}, []string{"a", "b", "c", "d", "e", "f"}), fxapp.ErrTooManyMetricLabels},
+	}
+	for _, testCase := range testCases {
+		err := registerer.Register(testCase.collector)
+		if testCase.err == nil {
+			assert.NoError(t, err, testCase.name)
+			continue
+		}
+		if assert.Error(t, err, testCase.name) {
+			assert.Contains(t, err.Error(), testCase.err.Error(), testCase.name)
+		}
+	}
+
+	t.Run("lint disabled", func(t *testing.T) {
+		registerer := fxapp.NewLintingRegisterer(prometheus.NewRegistry(), fxapp.MetricLintOpts{Disabled: true})
+		assert.NoError(t, registerer.Register(prometheus.NewGauge(prometheus.GaugeOpts{Name: "queueSize", Help: "help"})))
+	})
+}
+
+func TestAppRegistererEnforcesMetricLintRules(t *testing.T) {
+	t.Parallel()
+
+	_, err := fxapp.NewBuilder(fxapp.ID(ulids.MustNew()), fxapp.ReleaseID(ulids.MustNew())).
+		Invoke(func(registerer prometheus.Registerer) error {
+			return registerer.Register(prometheus.NewCounter(prometheus.CounterOpts{Name: "requests", Help: "help"}))
+		}).
+		DisableHTTPServer().
+		Build()
+	if assert.Error(t, err) {
+		assert.Contains(t, err.Error(), fxapp.ErrCounterMissingTotalSuffix.Error())
+	}
+
+	t.Run("lint rules are configurable", func(t *testing.T) {
+		_, err := fxapp.NewBuilder(fxapp.ID(ulids.MustNew()), fxapp.ReleaseID(ulids.MustNew())).
+			Provide(func() *fxapp.MetricLintOpts { return &fxapp.MetricLintOpts{Disabled: true} }).
+			Invoke(func(registerer prometheus.Registerer) error {
+				return registerer.Register(prometheus.NewCounter(prometheus.CounterOpts{Name: "requests", Help: "help"}))
+			}).
+			DisableHTTPServer().
+			Build()
+		assert.NoError(t, err)
+	})
+}
@@ -25,6 +25,8 @@ import (
 	dto "github.com/prometheus/client_model/go"
 	"github.com/rs/zerolog"
 	"go.uber.org/fx"
+	"go.uber.org/multierr"
+	"net/http"
 	"strings"
 	"time"
 )
@@ -99,6 +101,21 @@ const (
 	Summary
 )
 
+func (t MetricType) String() string {
+	switch t {
+	case Counter:
+		return "counter"
+	case Gauge:
+		return "gauge"
+	case Histogram:
+		return "histogram"
+	case Summary:
+		return "summary"
+	default:
+		return "untyped"
+	}
+}
+
 func mapMetricType(t dto.MetricType) MetricType {
 	switch t {
 	case dto.MetricType_COUNTER:
@@ -141,17 +158,54 @@ type PrometheusHTTPHandlerOpts struct {
 	//
 	// Note: errors are always logged regardless of the configured ErrorHandling
 	ErrorHandling promhttp.HandlerErrorHandling
+	// MaxRequestsInFlight limits the number of concurrent scrapes. Additional scrape requests are responded to with 503
+	// ServiceUnavailable. If zero, then it defaults to 3. If negative, then no limit is applied.
+	MaxRequestsInFlight int
+	// DisableCompression disables gzip compression. By default, the response is gzip compressed if the scrape request
+	// accepts gzip encoding via the Accept-Encoding header.
+	DisableCompression bool
+	// Views are additional metrics endpoints that expose filtered views of the metrics, e.g., to support scrapers with
+	// different needs. The views use the same handler options.
+	Views []MetricsView
 }
 
+// MetricsView is a metrics endpoint that only exposes the metric families that pass the filter
+type MetricsView struct {
+	Endpoint string
+	// Filter returns true if the metric family should be exposed
+	Filter func(mf *dto.MetricFamily) bool
+}
+
+// ExcludeMetricPrefixes returns a MetricsView filter that excludes metrics whose names have any of the specified prefixes,
+// e.g., to exclude the Go and process collector metrics:
+//
+//	ExcludeMetricPrefixes("go_", "process_")
+func ExcludeMetricPrefixes(prefixes ...string) func(mf *dto.MetricFamily) bool {
+	return func(mf *dto.MetricFamily) bool {
+		for _, prefix := range prefixes {
+			if strings.HasPrefix(mf.GetName(), prefix) {
+				return false
+			}
+		}
+		return true
+	}
+}
+
+// ErrInvalidMetricsView indicates a MetricsView endpoint is blank or the filter is nil
+var ErrInvalidMetricsView = errors.New("metrics view `Endpoint` must not be blank and `Filter` must not be nil")
+
 // DefaultPrometheusHTTPHandlerOpts constructs a new PrometheusHTTPHandlerOpts with the following options:
 // 	- timeout: 5 secs
 //	- endpoint: /metrics
 //	- error handling: promhttp.HTTPErrorOnError
 // 	  - Serve an HTTP status code 500 upon the first error encountered. Report the error message in the body.
+//	- max requests in flight: 3
+//	- gzip compression is enabled
 func DefaultPrometheusHTTPHandlerOpts() PrometheusHTTPHandlerOpts {
 	return PrometheusHTTPHandlerOpts{
-		Timeout:  5 * time.Second,
-		Endpoint: fmt.Sprintf("/%s", MetricsEndpoint),
+		Timeout:             5 * time.Second,
+		Endpoint:            fmt.Sprintf("/%s", MetricsEndpoint),
+		MaxRequestsInFlight: 3,
 	}
 }
 
@@ -167,27 +221,124 @@ type prometheusHTTPHandlerParams struct {
 // MetricsEndpoint is used to construct the default metrics HTTP endpoint
 const MetricsEndpoint = "01DF9JKZ73Y3V1AJN89B58D9HY"
 
-// NewHTTPHandler constructs a new HTTPHandler from the PrometheusHTTPHandlerOpts
+// MetricsScrapeDurationMetricID is the histogram metric ID for the metrics endpoint scrape durations in seconds
+const MetricsScrapeDurationMetricID = "U01DHX3VD40MH33JQM1GTF0M0A4"
+
+type prometheusHTTPHandlers struct {
+	fx.Out
+
+	Endpoint HTTPEndpoint   `group:"HTTPHandler"`
+	Views    []HTTPEndpoint `group:"HTTPHandlers"`
+}
+
+// newPrometheusHTTPHandlers constructs the metrics HTTP handlers from the PrometheusHTTPHandlerOpts, i.e., the metrics
+// endpoint and the metrics views endpoints, which are backed by filtered gatherers.
 //
-// The max requests in flight is limited to 3.
-func newPrometheusHTTPHandler(params prometheusHTTPHandlerParams) HTTPHandler {
-	if strings.TrimSpace(params.Opts.Endpoint) == "" {
-		params.Opts.Endpoint = fmt.Sprintf("/%s", MetricsEndpoint)
+// The handlers are instrumented with the following self-metrics:
+//	- promhttp_metric_handler_requests_in_flight - gauge
+//	- promhttp_metric_handler_requests_total - counter, labeled by HTTP status code
+//	- scrape durations - see `MetricsScrapeDurationMetricID`
+func newPrometheusHTTPHandlers(params prometheusHTTPHandlerParams) (prometheusHTTPHandlers, error) {
+	params.Opts = params.Opts.withDefaults()
+	for _, view := range params.Opts.Views {
+		if strings.TrimSpace(view.Endpoint) == "" || view.Filter == nil {
+			return prometheusHTTPHandlers{}, fmt.Errorf("%s : %#v", ErrInvalidMetricsView, view)
+		}
+	}
+
+	instrument, err := newPrometheusHTTPHandlerInstrumentation(params.Registerer)
+	if err != nil {
+		return prometheusHTTPHandlers{}, err
+	}
+	newHandler := func(gatherer prometheus.Gatherer, opts promhttp.HandlerOpts) func(http.ResponseWriter, *http.Request) {
+		return instrument(promhttp.HandlerFor(gatherer, opts)).ServeHTTP
+	}
+
+	handlers := prometheusHTTPHandlers{
+		Endpoint: HTTPEndpoint{
+			Path:    params.Opts.Endpoint,
+			Handler: newHandler(params.Gatherer, params.promhttpHandlerOpts()),
+			Doc:     prometheusMetricsOpenAPIDoc("prometheus metrics"),
+			Admin:   true,
+		},
+		Views: make([]HTTPEndpoint, 0, len(params.Opts.Views)),
 	}
-	if params.Opts.Timeout == time.Duration(0) {
-		params.Opts.Timeout = 5 * time.Second
+	for _, view := range params.Opts.Views {
+		filter := view.Filter
+		gatherer := prometheus.GathererFunc(func() ([]*dto.MetricFamily, error) {
+			mfs, err := params.Gatherer.Gather()
+			return FindMetricFamilies(mfs, filter), err
+		})
+		// the promhttp_metric_handler_errors_total counter can only be registered once, i.e., gather errors are only
+		// counted for the metrics endpoint
+		opts := params.promhttpHandlerOpts()
+		opts.Registry = nil
+		handlers.Views = append(handlers.Views, HTTPEndpoint{
+			Path:    view.Endpoint,
+			Handler: newHandler(gatherer, opts),
+			Doc:     prometheusMetricsOpenAPIDoc("prometheus metrics view"),
+			Admin:   true,
+		})
 	}
+	return handlers, nil
+}
+
+func prometheusMetricsOpenAPIDoc(summary string) *OpenAPIOperation {
+	return &OpenAPIOperation{
+		Summary:   summary,
+		Tags:      []string{BuiltinOpenAPITag},
+		Responses: []OpenAPIResponse{{Status: http.StatusOK, MediaTypes: []string{TextMediaType, OpenMetricsMediaType}}},
+	}
+}
 
-	errorLog := prometheusHTTPErrorLog(eventlog.NewLogger(PrometheusHTTPError, params.Logger, zerolog.ErrorLevel))
-	promhttpHandlerOpts := promhttp.HandlerOpts{
-		ErrorLog:            errorLog,
+// the instrumentation is shared by the metrics endpoint and the metrics views endpoints
+func newPrometheusHTTPHandlerInstrumentation(registerer prometheus.Registerer) (func(handler http.Handler) http.Handler, error) {
+	inFlight := prometheus.NewGauge(prometheus.GaugeOpts{
+		Name: "promhttp_metric_handler_requests_in_flight",
+		Help: "Current number of scrapes being served.",
+	})
+	requests := prometheus.NewCounterVec(prometheus.CounterOpts{
+		Name: "promhttp_metric_handler_requests_total",
+		Help: "Total number of scrapes by HTTP status code.",
+	}, []string{"code"})
+	scrapeDuration := prometheus.NewHistogramVec(prometheus.HistogramOpts{
+		Name: MetricsScrapeDurationMetricID,
+		Help: "metrics endpoint scrape durations in seconds",
+	}, nil)
+	if err := multierr.Combine(registerer.Register(inFlight), registerer.Register(requests), registerer.Register(scrapeDuration)); err != nil {
+		return nil, err
+	}
+	return func(handler http.Handler) http.Handler {
+		return promhttp.InstrumentHandlerDuration(scrapeDuration,
+			promhttp.InstrumentHandlerCounter(requests,
+				promhttp.InstrumentHandlerInFlight(inFlight, handler),
+			),
+		)
+	}, nil
+}
+
+func (opts PrometheusHTTPHandlerOpts) withDefaults() PrometheusHTTPHandlerOpts {
+	if strings.TrimSpace(opts.Endpoint) == "" {
+		opts.Endpoint = fmt.Sprintf("/%s", MetricsEndpoint)
+	}
+	if opts.Timeout == time.Duration(0) {
+		opts.Timeout = 5 * time.Second
+	}
+	if opts.MaxRequestsInFlight == 0 {
+		opts.MaxRequestsInFlight = 3
+	}
+	return opts
+}
+
+func (params prometheusHTTPHandlerParams) promhttpHandlerOpts() promhttp.HandlerOpts {
+	return promhttp.HandlerOpts{
+		ErrorLog:            prometheusHTTPErrorLog(eventlog.NewLogger(PrometheusHTTPError, params.Logger, zerolog.ErrorLevel)),
 		ErrorHandling:       params.Opts.ErrorHandling,
 		Registry:            params.Registerer,
-		MaxRequestsInFlight: 3,
+		DisableCompression:  params.Opts.DisableCompression,
+		MaxRequestsInFlight: params.Opts.MaxRequestsInFlight,
 		Timeout:             params.Opts.Timeout,
 	}
-	handler := promhttp.HandlerFor(params.Gatherer, promhttpHandlerOpts)
-	return NewHTTPHandler(params.Opts.Endpoint, handler.ServeHTTP)
 }
 
 // PrometheusHTTPError indicates an error occurred while handling a metrics scrape HTTP request.
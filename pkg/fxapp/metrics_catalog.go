@@ -0,0 +1,131 @@
+/*
+ * Copyright (c) 2019 OysterPack, Inc.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ * http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package fxapp
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"github.com/oklog/ulid"
+	"github.com/prometheus/client_golang/prometheus"
+	"net/http"
+	"strings"
+)
+
+// MetricsCatalogEndpoint is used to construct the metrics catalog HTTP endpoint, which describes the metrics that are
+// registered with the app, i.e., name, help, type, and labels. The catalog is keyed by the app release ID, which makes
+// it possible to auto-generate the metrics documentation for each release.
+//
+// The response format is selected via the HTTP Accept header:
+//   - application/json (default)
+//   - text/markdown - the metrics are rendered as a markdown table
+//
+// Metrics are sorted by name.
+const MetricsCatalogEndpoint = "01DHXC32M0B3K2CP572AXHFGYT"
+
+// MarkdownMediaType is the media type used to render the metrics catalog as markdown
+const MarkdownMediaType = "text/markdown"
+
+func metricsCatalogHTTPHandler(gatherer prometheus.Gatherer, releaseID ReleaseID) HTTPHandler {
+	return NewHTTPHandler(fmt.Sprintf("/%s", MetricsCatalogEndpoint), func(writer http.ResponseWriter, request *http.Request) {
+		mediaType := negotiateMediaType(request.Header.Get("Accept"), JSONMediaType, MarkdownMediaType)
+		if mediaType == "" {
+			http.Error(writer, fmt.Sprintf("supported media types are: %s, %s", JSONMediaType, MarkdownMediaType), http.StatusNotAcceptable)
+			return
+		}
+
+		// metric families returned by the gatherer are sorted by name
+		mfs, err := gatherer.Gather()
+		if err != nil {
+			http.Error(writer, err.Error(), http.StatusInternalServerError)
+			return
+		}
+		descs := DescsFromMetricFamilies(mfs)
+
+		var body []byte
+		switch mediaType {
+		case MarkdownMediaType:
+			body = metricsCatalogMarkdown(releaseID, descs)
+			mediaType += "; charset=utf-8"
+		default:
+			body, err = metricsCatalogJSON(releaseID, descs)
+		}
+		if err != nil {
+			http.Error(writer, err.Error(), http.StatusInternalServerError)
+			return
+		}
+		writer.Header().Set("Content-Type", mediaType)
+		writer.Write(body)
+	}).WithDoc(OpenAPIOperation{
+		Summary: "metrics catalog",
+		Tags:    []string{BuiltinOpenAPITag},
+		Responses: []OpenAPIResponse{
+			{Status: http.StatusOK, MediaTypes: []string{JSONMediaType, MarkdownMediaType}},
+			{Status: http.StatusNotAcceptable},
+		},
+	}).AdminOnly()
+}
+
+func metricsCatalogJSON(releaseID ReleaseID, descs []*MetricDesc) ([]byte, error) {
+	type metric struct {
+		Name   string   `json:"name"`
+		Help   string   `json:"help"`
+		Type   string   `json:"type"`
+		Labels []string `json:"labels,omitempty"`
+	}
+	metrics := make([]metric, 0, len(descs))
+	for _, desc := range descs {
+		metrics = append(metrics, metric{desc.Name, desc.Help, desc.MetricType.String(), desc.Labels})
+	}
+	return json.Marshal(struct {
+		ReleaseID string   `json:"release_id"`
+		Metrics   []metric `json:"metrics"`
+	}{
+		ReleaseID: ulid.ULID(releaseID).String(),
+		Metrics:   metrics,
+	})
+}
+
+func metricsCatalogMarkdown(releaseID ReleaseID, descs []*MetricDesc) []byte {
+	buf := new(bytes.Buffer)
+	fmt.Fprintf(buf, "# Metrics Catalog\n\nRelease ID: `%s`\n\n", ulid.ULID(releaseID))
+	buf.WriteString("| Name | Type | Labels | Help |\n")
+	buf.WriteString("|------|------|--------|------|\n")
+	for _, desc := range descs {
+		fmt.Fprintf(buf, "| `%s` | %s | %s | %s |\n",
+			desc.Name,
+			desc.MetricType,
+			markdownCode(desc.Labels),
+			markdownTableCell(desc.Help),
+		)
+	}
+	return buf.Bytes()
+}
+
+func markdownCode(values []string) string {
+	codes := make([]string, 0, len(values))
+	for _, v := range values {
+		codes = append(codes, fmt.Sprintf("`%s`", v))
+	}
+	return strings.Join(codes, ", ")
+}
+
+// escapes the text, such that it can be rendered within a markdown table cell
+func markdownTableCell(text string) string {
+	text = strings.Replace(text, "|", `\|`, -1)
+	return strings.Replace(text, "\n", "<br>", -1)
+}
@@ -0,0 +1,132 @@
+/*
+ * Copyright (c) 2019 OysterPack, Inc.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ * http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package fxapp_test
+
+import (
+	"encoding/json"
+	"fmt"
+	"github.com/oklog/ulid"
+	"github.com/oysterpack/andiamo/pkg/fxapp"
+	"github.com/oysterpack/andiamo/pkg/ulids"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"io/ioutil"
+	"net/http"
+	"strings"
+	"testing"
+)
+
+func TestMetricsCatalogEndpoint(t *testing.T) {
+	releaseID := ulids.MustNew()
+	app, err := fxapp.NewBuilder(fxapp.ID(ulids.MustNew()), fxapp.ReleaseID(releaseID)).
+		Invoke(func(registerer prometheus.Registerer) error {
+			counter := prometheus.NewCounterVec(prometheus.CounterOpts{
+				Name: "foo_total",
+				Help: "foo | bar",
+			}, []string{"op"})
+			if err := registerer.Register(counter); err != nil {
+				return err
+			}
+			// metric vecs are only gathered once they have been observed
+			counter.WithLabelValues("get").Inc()
+			return nil
+		}).
+		AllowUnauthenticatedAdmin().
+		Build()
+	require.NoError(t, err)
+
+	go app.Run()
+	<-app.Ready()
+	defer func() {
+		app.Shutdown()
+		<-app.Done()
+	}()
+
+	get := func(accept string) *http.Response {
+		request, err := http.NewRequest(http.MethodGet, fmt.Sprintf("http://:8008/%s", fxapp.MetricsCatalogEndpoint), nil)
+		require.NoError(t, err)
+		if accept != "" {
+			request.Header.Set("Accept", accept)
+		}
+		response, err := http.DefaultClient.Do(request)
+		require.NoError(t, err)
+		return response
+	}
+
+	readBody := func(response *http.Response) string {
+		defer response.Body.Close()
+		body, err := ioutil.ReadAll(response.Body)
+		require.NoError(t, err)
+		t.Log(string(body))
+		return string(body)
+	}
+
+	t.Run("JSON is the default", func(t *testing.T) {
+		response := get("")
+		require.Equal(t, http.StatusOK, response.StatusCode)
+		assert.Equal(t, fxapp.JSONMediaType, response.Header.Get("Content-Type"))
+		var catalog struct {
+			ReleaseID string `json:"release_id"`
+			Metrics   []struct {
+				Name   string
+				Help   string
+				Type   string
+				Labels []string
+			}
+		}
+		require.NoError(t, json.Unmarshal([]byte(readBody(response)), &catalog))
+		assert.Equal(t, ulid.ULID(releaseID).String(), catalog.ReleaseID)
+		require.NotEmpty(t, catalog.Metrics)
+		var found bool
+		for i, m := range catalog.Metrics {
+			if i > 0 {
+				assert.True(t, catalog.Metrics[i-1].Name < m.Name, "metrics should be sorted by name")
+			}
+			if m.Name == "foo_total" {
+				found = true
+				assert.Equal(t, "foo | bar", m.Help)
+				assert.Equal(t, "counter", m.Type)
+				assert.Contains(t, m.Labels, "op")
+			}
+		}
+		assert.True(t, found, "foo_total metric was not found in the catalog")
+	})
+
+	t.Run("markdown", func(t *testing.T) {
+		response := get(fxapp.MarkdownMediaType)
+		require.Equal(t, http.StatusOK, response.StatusCode)
+		assert.Contains(t, response.Header.Get("Content-Type"), fxapp.MarkdownMediaType)
+		body := readBody(response)
+		assert.Contains(t, body, ulid.ULID(releaseID).String())
+		var fooLine string
+		for _, line := range strings.Split(body, "\n") {
+			if strings.HasPrefix(line, "| `foo_total` | counter |") {
+				fooLine = line
+			}
+		}
+		require.NotEmpty(t, fooLine, "foo_total metric was not found in the catalog")
+		assert.Contains(t, fooLine, "`op`")
+		// the table cell separator is escaped
+		assert.True(t, strings.HasSuffix(fooLine, `| foo \| bar |`))
+	})
+
+	t.Run("unsupported media type", func(t *testing.T) {
+		response := get("application/xml")
+		assert.Equal(t, http.StatusNotAcceptable, response.StatusCode)
+	})
+}
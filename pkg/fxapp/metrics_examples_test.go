@@ -36,6 +36,7 @@ func ExamplePrometheusHTTPHandlerOpts() {
 			return opts
 		}).
 		Invoke(func() {}).
+		AllowUnauthenticatedAdmin().
 		Build()
 
 	if err != nil {
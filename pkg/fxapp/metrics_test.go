@@ -31,6 +31,7 @@ import (
 	"io/ioutil"
 	"log"
 	"net/http"
+	"runtime"
 	"strings"
 	"testing"
 	"time"
@@ -46,7 +47,7 @@ func TestMetricsRegistryProvided(t *testing.T) {
 	_, err := fxapp.NewBuilder(fxapp.ID(ulids.MustNew()), fxapp.ReleaseID(ulids.MustNew())).
 		Provide(func(registerer prometheus.Registerer) (FooCounter, error) {
 			counter := prometheus.NewCounter(prometheus.CounterOpts{
-				Name: "foo",
+				Name: "foo_total",
 				Help: "foo help",
 			})
 			err := registerer.Register(counter)
@@ -101,7 +102,7 @@ func TestMetricsContainAppLabels(t *testing.T) {
 			// Given a custom metric is registered
 			func(metricRegisterer prometheus.Registerer) (FooCounter, error) {
 				counter := prometheus.NewCounter(prometheus.CounterOpts{
-					Name: "foo",
+					Name: "foo_total",
 					Help: "foo counter",
 				})
 				err := metricRegisterer.Register(counter)
@@ -126,7 +127,7 @@ func TestMetricsContainAppLabels(t *testing.T) {
 		default:
 			// Then the custom metric is returned when gathering metrics
 			mf := fxapp.FindMetricFamily(mfs, func(mf *io_prometheus_client.MetricFamily) bool {
-				return *mf.Name == "foo"
+				return *mf.Name == "foo_total"
 			})
 			if mf == nil {
 				t.Error("*** foo metric is not registered")
@@ -210,6 +211,46 @@ func TestRegisterProcessMetricsCollector(t *testing.T) {
 	}
 }
 
+func TestRegisterRuntimeMetricsCollector(t *testing.T) {
+	var metricsGatherer prometheus.Gatherer
+	_, err := fxapp.NewBuilder(fxapp.ID(ulids.MustNew()), fxapp.ReleaseID(ulids.MustNew())).
+		Invoke(fxapp.RegisterRuntimeMetricsCollector).
+		Populate(&metricsGatherer).
+		DisableHTTPServer().
+		Build()
+	if err != nil {
+		t.Fatalf("*** app build error: %v", err)
+	}
+	runtime.GC()
+
+	mfs, err := metricsGatherer.Gather()
+	if err != nil {
+		t.Fatalf("*** failed to gather metrics: %v", err)
+	}
+	for _, id := range []string{fxapp.SchedulerLatencyMetricID, fxapp.GCPauseMetricID} {
+		mf := fxapp.FindMetricFamily(mfs, func(mf *io_prometheus_client.MetricFamily) bool {
+			return mf.GetName() == id
+		})
+		switch {
+		case mf == nil:
+			t.Errorf("*** runtime metric was not collected: %s", id)
+		case mf.GetType() != io_prometheus_client.MetricType_HISTOGRAM:
+			t.Errorf("*** runtime metric should be a histogram: %s : %v", id, mf.GetType())
+		case mf.Metric[0].GetHistogram().GetSampleCount() == 0:
+			t.Errorf("*** runtime histogram should have samples: %s", id)
+		}
+	}
+	mf := fxapp.FindMetricFamily(mfs, func(mf *io_prometheus_client.MetricFamily) bool {
+		return mf.GetName() == fxapp.GoroutineStatesMetricID
+	})
+	if mf == nil {
+		t.Fatal("*** goroutine states were not collected")
+	}
+	for _, m := range mf.Metric {
+		t.Logf("%v = %v", m.GetLabel(), m.GetGauge().GetValue())
+	}
+}
+
 func TestFindMetricFamily(t *testing.T) {
 	registry := prometheus.NewRegistry()
 	registry.MustRegister(prometheus.NewCounter(prometheus.CounterOpts{
@@ -411,6 +452,7 @@ func TestDescsFromMetricFamilies(t *testing.T) {
 func TestExposePrometheusMetricsViaHTTP(t *testing.T) {
 	app, err := fxapp.NewBuilder(fxapp.ID(ulids.MustNew()), fxapp.ReleaseID(ulids.MustNew())).
 		Invoke(func() {}).
+		AllowUnauthenticatedAdmin().
 		Build()
 
 	switch {
@@ -443,6 +485,124 @@ func TestExposePrometheusMetricsViaHTTP(t *testing.T) {
 	}
 }
 
+func TestPrometheusHTTPHandler_GzipAndSelfMetrics(t *testing.T) {
+	app, err := fxapp.NewBuilder(fxapp.ID(ulids.MustNew()), fxapp.ReleaseID(ulids.MustNew())).
+		Invoke(func() {}).
+		AllowUnauthenticatedAdmin().
+		Build()
+	if err != nil {
+		t.Fatalf("*** app build failure: %v", err)
+	}
+	go app.Run()
+	defer func() {
+		app.Shutdown()
+		<-app.Done()
+	}()
+	<-app.Ready()
+
+	scrape := func(acceptEncoding string) *http.Response {
+		request, err := retryablehttp.NewRequest(http.MethodGet, fmt.Sprintf("http://:8008/%s", fxapp.MetricsEndpoint), nil)
+		if err != nil {
+			t.Fatalf("*** failed to create request: %v", err)
+		}
+		request.Header.Set("Accept-Encoding", acceptEncoding)
+		client := retryablehttp.NewClient()
+		// disable transparent gzip decompression
+		client.HTTPClient.Transport = &http.Transport{DisableCompression: true}
+		resp, err := client.Do(request)
+		if err != nil {
+			t.Fatalf("*** failed to HTTP scrape metrics: %v", err)
+		}
+		return resp
+	}
+
+	// When the scrape request accepts gzip encoding
+	resp := scrape("gzip")
+	resp.Body.Close()
+	// Then the response is gzip compressed
+	if resp.Header.Get("Content-Encoding") != "gzip" {
+		t.Errorf("*** response should be gzip compressed: %v", resp.Header)
+	}
+
+	// And the metrics handler self-metrics are exposed
+	resp = scrape("identity")
+	metrics, err := ioutil.ReadAll(resp.Body)
+	resp.Body.Close()
+	if err != nil {
+		t.Fatalf("*** failed to read response body: %v", err)
+	}
+	for _, name := range []string{"promhttp_metric_handler_requests_in_flight", "promhttp_metric_handler_requests_total", fxapp.MetricsScrapeDurationMetricID} {
+		if !strings.Contains(string(metrics), name) {
+			t.Errorf("*** metric is not exposed: %s", name)
+		}
+	}
+}
+
+func TestPrometheusHTTPHandler_Views(t *testing.T) {
+	app, err := fxapp.NewBuilder(fxapp.ID(ulids.MustNew()), fxapp.ReleaseID(ulids.MustNew())).
+		Provide(func() fxapp.PrometheusHTTPHandlerOpts {
+			opts := fxapp.DefaultPrometheusHTTPHandlerOpts()
+			opts.Views = []fxapp.MetricsView{{Endpoint: "/metrics/app", Filter: fxapp.ExcludeMetricPrefixes("go_", "process_")}}
+			return opts
+		}).
+		Invoke(fxapp.RegisterProcessMetricsCollector).
+		AllowUnauthenticatedAdmin().
+		Build()
+	if err != nil {
+		t.Fatalf("*** app build failure: %v", err)
+	}
+	go app.Run()
+	defer func() {
+		app.Shutdown()
+		<-app.Done()
+	}()
+	<-app.Ready()
+
+	scrape := func(endpoint string) string {
+		resp, err := retryablehttp.Get(fmt.Sprintf("http://:8008%s", endpoint))
+		if err != nil {
+			t.Fatalf("*** failed to HTTP scrape metrics: %v", err)
+		}
+		defer resp.Body.Close()
+		if resp.StatusCode != http.StatusOK {
+			t.Fatalf("*** %s http request failed: %v", endpoint, resp.Status)
+		}
+		metrics, err := ioutil.ReadAll(resp.Body)
+		if err != nil {
+			t.Fatalf("*** failed to read response body: %v", err)
+		}
+		return string(metrics)
+	}
+
+	// the default endpoint exposes all metrics
+	metrics := scrape(fmt.Sprintf("/%s", fxapp.MetricsEndpoint))
+	if !strings.Contains(metrics, "go_goroutines") || !strings.Contains(metrics, "process_cpu_seconds_total") {
+		t.Error("*** all metrics should be exposed")
+	}
+	// the view excludes the Go and process metrics
+	metrics = scrape("/metrics/app")
+	if strings.Contains(metrics, "go_goroutines") || strings.Contains(metrics, "process_cpu_seconds_total") {
+		t.Error("*** go and process metrics should have been excluded")
+	}
+	if !strings.Contains(metrics, fxapp.HealthCheckQueuedMetricID) {
+		t.Error("*** app metrics should be exposed")
+	}
+}
+
+func TestPrometheusHTTPHandler_InvalidView(t *testing.T) {
+	_, err := fxapp.NewBuilder(fxapp.ID(ulids.MustNew()), fxapp.ReleaseID(ulids.MustNew())).
+		Provide(func() fxapp.PrometheusHTTPHandlerOpts {
+			opts := fxapp.DefaultPrometheusHTTPHandlerOpts()
+			opts.Views = []fxapp.MetricsView{{Endpoint: "/metrics/app"}}
+			return opts
+		}).
+		Invoke(func() {}).
+		Build()
+	if err == nil || !strings.Contains(err.Error(), fxapp.ErrInvalidMetricsView.Error()) {
+		t.Errorf("*** app build should have failed because the view filter is nil: %v", err)
+	}
+}
+
 func TestPrometheusHTTPServerRunner_FailOnCollectErrorWithHTTP500(t *testing.T) {
 	app, err := fxapp.NewBuilder(fxapp.ID(ulids.MustNew()), fxapp.ReleaseID(ulids.MustNew())).
 		Invoke(
@@ -451,6 +611,7 @@ func TestPrometheusHTTPServerRunner_FailOnCollectErrorWithHTTP500(t *testing.T)
 				return registerer.Register(FailingMetricCollector{})
 			},
 		).
+		AllowUnauthenticatedAdmin().
 		Build()
 
 	switch {
@@ -501,6 +662,7 @@ func TestPrometheusHTTPServerRunner_ContinueOnCollectError(t *testing.T) {
 				return registerer.Register(FailingMetricCollector{})
 			},
 		).
+		AllowUnauthenticatedAdmin().
 		Build()
 
 	switch {
@@ -569,4 +731,10 @@ func TestDefaultPrometheusHTTPHandlerOpts(t *testing.T) {
 	if opts.ErrorHandling != promhttp.HTTPErrorOnError {
 		t.Error("*** error handling option did not match")
 	}
+	if opts.MaxRequestsInFlight != 3 {
+		t.Error("*** max requests in flight option did not match")
+	}
+	if opts.DisableCompression {
+		t.Error("*** compression should be enabled")
+	}
 }
@@ -0,0 +1,65 @@
+/*
+ * Copyright (c) 2019 OysterPack, Inc.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ * http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package fxapp
+
+import (
+	"encoding/json"
+	"fmt"
+	"github.com/oysterpack/andiamo/pkg/fx/migrate"
+	"net/http"
+)
+
+// MigrationsEndpoint is used to construct the HTTP endpoint that reports the database schema version and the pending
+// migrations as JSON. The endpoint is only registered if migrations are enabled - see `Builder.EnableMigrations()`.
+//
+//	type Response struct {
+//		Version uint64 `json:"version"`
+//		Pending []struct {
+//			Version uint64 `json:"version"`
+//			Name    string `json:"name"`
+//		} `json:"pending"`
+//	}
+const MigrationsEndpoint = "01DHZYFT54QFPRHZHCW0SD67EV"
+
+type schemaMigration struct {
+	Version uint64 `json:"version"`
+	Name    string `json:"name"`
+}
+
+type schemaStatus struct {
+	Version uint64            `json:"version"`
+	Pending []schemaMigration `json:"pending"`
+}
+
+func migrationsHTTPHandler(status migrate.SchemaStatus) HTTPHandler {
+	return NewHTTPRoute(http.MethodGet, fmt.Sprintf("/%s", MigrationsEndpoint), func(writer http.ResponseWriter, request *http.Request) {
+		current := status()
+		response := schemaStatus{
+			Version: current.Version,
+			Pending: make([]schemaMigration, len(current.Pending)),
+		}
+		for i, migration := range current.Pending {
+			response.Pending[i] = schemaMigration{Version: migration.Version, Name: migration.Name}
+		}
+		writer.Header().Set("Content-Type", JSONMediaType)
+		json.NewEncoder(writer).Encode(response)
+	}).WithDoc(OpenAPIOperation{
+		Summary:   "database schema version",
+		Tags:      []string{BuiltinOpenAPITag},
+		Responses: []OpenAPIResponse{{Status: http.StatusOK, MediaTypes: []string{JSONMediaType}}},
+	}).AdminOnly()
+}
@@ -0,0 +1,93 @@
+/*
+ * Copyright (c) 2019 OysterPack, Inc.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ * http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package fxapp_test
+
+import (
+	"context"
+	"database/sql"
+	"database/sql/driver"
+	"encoding/json"
+	"errors"
+	"github.com/oysterpack/andiamo/pkg/fx/migrate"
+	"github.com/oysterpack/andiamo/pkg/fxapp"
+	"github.com/oysterpack/andiamo/pkg/fxapptest"
+	"github.com/oysterpack/andiamo/pkg/ulids"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"io"
+	"net/http"
+	"testing"
+)
+
+// emptyDB has no applied migrations, and every statement succeeds
+type emptyDB struct{}
+
+func (emptyDB) Open(name string) (driver.Conn, error) { return emptyDB{}, nil }
+func (emptyDB) Prepare(query string) (driver.Stmt, error) {
+	return nil, errors.New("not supported")
+}
+func (emptyDB) Close() error              { return nil }
+func (emptyDB) Begin() (driver.Tx, error) { return emptyDB{}, nil }
+func (emptyDB) Commit() error             { return nil }
+func (emptyDB) Rollback() error           { return nil }
+func (emptyDB) ExecContext(ctx context.Context, query string, args []driver.NamedValue) (driver.Result, error) {
+	return driver.RowsAffected(0), nil
+}
+func (emptyDB) QueryContext(ctx context.Context, query string, args []driver.NamedValue) (driver.Rows, error) {
+	return emptyDB{}, nil
+}
+func (emptyDB) Columns() []string              { return []string{"version"} }
+func (emptyDB) Next(dest []driver.Value) error { return io.EOF }
+
+func init() {
+	sql.Register("fxapp-empty", emptyDB{})
+}
+
+func TestBuilder_EnableMigrations(t *testing.T) {
+	t.Parallel()
+
+	db, err := sql.Open("fxapp-empty", "")
+	require.NoError(t, err)
+	source := migrate.SourceFunc(func() ([]migrate.Migration, error) {
+		return []migrate.Migration{
+			{Version: 1, Name: "create_users", SQL: "CREATE TABLE users"},
+			{Version: 2, Name: "create_orders", SQL: "CREATE TABLE orders"},
+		}, nil
+	})
+	logs := fxapptest.NewLogCapture()
+	builder := fxapp.NewBuilder(fxapp.ID(ulids.MustNew()), fxapp.ReleaseID(ulids.MustNew())).
+		Provide(func() *sql.DB { return db }).
+		Invoke(func() {}).
+		EnableMigrations(migrate.Opts{Source: source}).
+		LogWriter(logs)
+
+	fxapptest.RunApp(t, builder, func(app fxapp.App, client *fxapptest.HTTPClient) {
+		fxapptest.AssertEventLogged(t, logs, migrate.MigrationAppliedEvent, fxapptest.Field("d.name", "create_orders"))
+
+		response, err := client.Get(fxapp.MigrationsEndpoint)
+		require.NoError(t, err)
+		defer response.Body.Close()
+		require.Equal(t, http.StatusOK, response.StatusCode)
+		var status struct {
+			Version uint64        `json:"version"`
+			Pending []interface{} `json:"pending"`
+		}
+		require.NoError(t, json.NewDecoder(response.Body).Decode(&status))
+		assert.Equal(t, uint64(2), status.Version)
+		assert.Empty(t, status.Pending)
+	})
+}
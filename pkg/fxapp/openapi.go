@@ -0,0 +1,206 @@
+/*
+ * Copyright (c) 2019 OysterPack, Inc.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ * http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package fxapp
+
+import (
+	"encoding/json"
+	"fmt"
+	"github.com/oklog/ulid"
+	"github.com/oysterpack/andiamo/pkg/appdesc"
+	"net/http"
+	"strconv"
+	"strings"
+)
+
+// OpenAPIEndpoint is used to construct the HTTP endpoint that serves the app's OpenAPI (v3) document as JSON. The document
+// describes the app's built-in endpoints, plus the registered routes that provide an OpenAPI description - see
+// `HTTPEndpoint.Doc`. Routes that do not provide a description are not included.
+//
+// The OpenAPI document is designed to be used by API gateways and tests to validate against the spec.
+const OpenAPIEndpoint = "01DHYN9E406TH17S1FXMZGSE8T"
+
+// OpenAPIVersion is the OpenAPI specification version that the app's OpenAPI document conforms to
+const OpenAPIVersion = "3.0.3"
+
+// BuiltinOpenAPITag is used to tag the app's built-in endpoints in the OpenAPI document
+const BuiltinOpenAPITag = "fxapp"
+
+// OpenAPIOperation describes an HTTP route in the app's OpenAPI document.
+type OpenAPIOperation struct {
+	Summary     string
+	Description string
+	Tags        []string
+	Params      []OpenAPIParam
+	// If no responses are specified, then a single HTTP 200 response is documented
+	Responses []OpenAPIResponse
+}
+
+// OpenAPIParam describes an HTTP route parameter. Parameters are assumed to be strings.
+type OpenAPIParam struct {
+	Name string
+	// In is the param location, i.e., "query", "header", or "path". If blank, then "query" is used.
+	In          string
+	Description string
+	Required    bool
+}
+
+// OpenAPIResponse describes an HTTP route response
+type OpenAPIResponse struct {
+	Status      int
+	Description string
+	// MediaTypes are the response content media types
+	MediaTypes []string
+}
+
+// WithDoc sets the OpenAPI description for the HTTP route
+func (h HTTPHandler) WithDoc(doc OpenAPIOperation) HTTPHandler {
+	h.Doc = &doc
+	return h
+}
+
+// the OpenAPI document model - only the subset that is used to describe the app's routes is modeled
+type openAPIDoc struct {
+	OpenAPI string                                 `json:"openapi"`
+	Info    openAPIInfo                            `json:"info"`
+	Paths   map[string]map[string]openAPIOperation `json:"paths"`
+}
+
+type openAPIInfo struct {
+	Title       string `json:"title"`
+	Description string `json:"description,omitempty"`
+	Version     string `json:"version"`
+}
+
+type openAPIOperation struct {
+	Summary     string                     `json:"summary,omitempty"`
+	Description string                     `json:"description,omitempty"`
+	Tags        []string                   `json:"tags,omitempty"`
+	Parameters  []openAPIParam             `json:"parameters,omitempty"`
+	Responses   map[string]openAPIResponse `json:"responses"`
+}
+
+type openAPIParam struct {
+	Name        string        `json:"name"`
+	In          string        `json:"in"`
+	Description string        `json:"description,omitempty"`
+	Required    bool          `json:"required,omitempty"`
+	Schema      openAPISchema `json:"schema"`
+}
+
+type openAPISchema struct {
+	Type string `json:"type"`
+}
+
+type openAPIResponse struct {
+	Description string                      `json:"description"`
+	Content     map[string]openAPIMediaType `json:"content,omitempty"`
+}
+
+type openAPIMediaType struct{}
+
+// newOpenAPIDoc describes the routes that provide an OpenAPI description. Routes that handle all HTTP methods are
+// described as GET operations.
+func newOpenAPIDoc(desc appdesc.Desc, endpoints []HTTPEndpoint) openAPIDoc {
+	doc := openAPIDoc{
+		OpenAPI: OpenAPIVersion,
+		Info: openAPIInfo{
+			Title:       desc.Name,
+			Description: fmt.Sprintf("app ID: %s, release ID: %s", desc.ID, desc.ReleaseID),
+			Version:     desc.Version.String(),
+		},
+		Paths: make(map[string]map[string]openAPIOperation),
+	}
+	if doc.Info.Title == "" {
+		doc.Info.Title = ulid.ULID(desc.ID).String()
+	}
+
+	for _, endpoint := range endpoints {
+		if endpoint.Doc == nil {
+			continue
+		}
+		method := strings.ToLower(endpoint.Method)
+		if method == "" {
+			method = "get"
+		}
+		operation := openAPIOperation{
+			Summary:     endpoint.Doc.Summary,
+			Description: endpoint.Doc.Description,
+			Tags:        endpoint.Doc.Tags,
+			Responses:   make(map[string]openAPIResponse),
+		}
+		for _, param := range endpoint.Doc.Params {
+			in := param.In
+			if in == "" {
+				in = "query"
+			}
+			operation.Parameters = append(operation.Parameters, openAPIParam{
+				Name:        param.Name,
+				In:          in,
+				Description: param.Description,
+				// path params are always required
+				Required: param.Required || in == "path",
+				Schema:   openAPISchema{Type: "string"},
+			})
+		}
+		responses := endpoint.Doc.Responses
+		if len(responses) == 0 {
+			responses = []OpenAPIResponse{{Status: http.StatusOK}}
+		}
+		for _, response := range responses {
+			description := response.Description
+			if description == "" {
+				description = http.StatusText(response.Status)
+			}
+			r := openAPIResponse{Description: description}
+			for _, mediaType := range response.MediaTypes {
+				if r.Content == nil {
+					r.Content = make(map[string]openAPIMediaType)
+				}
+				r.Content[mediaType] = openAPIMediaType{}
+			}
+			operation.Responses[strconv.Itoa(response.Status)] = r
+		}
+
+		operations, ok := doc.Paths[endpoint.Path]
+		if !ok {
+			operations = make(map[string]openAPIOperation)
+			doc.Paths[endpoint.Path] = operations
+		}
+		operations[method] = operation
+	}
+	return doc
+}
+
+// newOpenAPIHTTPEndpoint is registered by the HTTP server because the OpenAPI document describes all of the HTTP server's
+// routes, including itself.
+func newOpenAPIHTTPEndpoint(desc appdesc.Desc, endpoints []HTTPEndpoint) HTTPEndpoint {
+	endpoint := NewHTTPRoute(http.MethodGet, fmt.Sprintf("/%s", OpenAPIEndpoint), nil).WithDoc(OpenAPIOperation{
+		Summary:   "OpenAPI document",
+		Tags:      []string{BuiltinOpenAPITag},
+		Responses: []OpenAPIResponse{{Status: http.StatusOK, MediaTypes: []string{JSONMediaType}}},
+	}).AdminOnly().HTTPEndpoint
+	body, err := json.Marshal(newOpenAPIDoc(desc, append(append([]HTTPEndpoint(nil), endpoints...), endpoint)))
+	endpoint.Handler = func(writer http.ResponseWriter, request *http.Request) {
+		if err != nil {
+			http.Error(writer, err.Error(), http.StatusInternalServerError)
+			return
+		}
+		writer.Header().Set("Content-Type", JSONMediaType)
+		writer.Write(body)
+	}
+	return endpoint
+}
@@ -0,0 +1,131 @@
+/*
+ * Copyright (c) 2019 OysterPack, Inc.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ * http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package fxapp_test
+
+import (
+	"encoding/json"
+	"fmt"
+	"github.com/blang/semver"
+	"github.com/oysterpack/andiamo/pkg/appdesc"
+	"github.com/oysterpack/andiamo/pkg/fxapp"
+	"github.com/oysterpack/andiamo/pkg/fxapptest"
+	"github.com/oysterpack/andiamo/pkg/ulids"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"io/ioutil"
+	"net/http"
+	"testing"
+)
+
+func TestOpenAPIEndpoint(t *testing.T) {
+	t.Parallel()
+
+	ok := func(writer http.ResponseWriter, request *http.Request) {}
+	desc := appdesc.Desc{
+		ID:        ulids.MustNew(),
+		Name:      "openapi-test",
+		Version:   semver.MustParse("1.2.3"),
+		ReleaseID: ulids.MustNew(),
+	}
+	builder := fxapp.NewBuilderFromDesc(desc).
+		Provide(
+			func() fxapp.HTTPHandler {
+				return fxapp.NewHTTPRoute(http.MethodPut, "/foo", ok).WithDoc(fxapp.OpenAPIOperation{
+					Summary: "updates foo",
+					Params:  []fxapp.OpenAPIParam{{Name: "id", Required: true}},
+					Responses: []fxapp.OpenAPIResponse{
+						{Status: http.StatusNoContent},
+						{Status: http.StatusNotFound, Description: "foo not found"},
+					},
+				})
+			},
+			// routes that do not provide an OpenAPI description are not included
+			func() fxapp.HTTPHandler {
+				return fxapp.NewHTTPRoute(http.MethodGet, "/bar", ok)
+			},
+		).
+		Invoke(func() {}).
+		LogWriter(ioutil.Discard)
+
+	fxapptest.RunApp(t, builder, func(app fxapp.App, client *fxapptest.HTTPClient) {
+		response, err := client.Get(fxapp.OpenAPIEndpoint)
+		require.NoError(t, err)
+		defer response.Body.Close()
+		require.Equal(t, http.StatusOK, response.StatusCode)
+		assert.Equal(t, fxapp.JSONMediaType, response.Header.Get("Content-Type"))
+
+		type Param struct {
+			Name     string
+			In       string
+			Required bool
+		}
+		type Operation struct {
+			Summary    string
+			Tags       []string
+			Parameters []Param
+			Responses  map[string]struct {
+				Description string
+				Content     map[string]interface{}
+			}
+		}
+		var doc struct {
+			OpenAPI string
+			Info    struct {
+				Title   string
+				Version string
+			}
+			Paths map[string]map[string]Operation
+		}
+		require.NoError(t, json.NewDecoder(response.Body).Decode(&doc))
+		assert.Equal(t, fxapp.OpenAPIVersion, doc.OpenAPI)
+		assert.Equal(t, "openapi-test", doc.Info.Title)
+		assert.Equal(t, "1.2.3", doc.Info.Version)
+
+		t.Run("built-in endpoints", func(t *testing.T) {
+			for path, method := range map[string]string{
+				fxapp.ReadyEvent:                 "get",
+				fxapp.LivenessProbeEvent:         "get",
+				fxapp.MetricsEndpoint:            "get",
+				fxapp.ComponentsEndpoint:         "get",
+				fxapp.XRefsEndpoint:              "get",
+				fxapp.HealthCheckResultsEndpoint: "get",
+				fxapp.RunHealthCheckEndpoint:     "post",
+				fxapp.MetricsCatalogEndpoint:     "get",
+				fxapp.EventStreamEndpoint:        "get",
+				fxapp.AdminUIEndpoint:            "get",
+				fxapp.OpenAPIEndpoint:            "get",
+			} {
+				operation, ok := doc.Paths[fmt.Sprintf("/%s", path)][method]
+				if assert.True(t, ok, "%s %s is not documented", method, path) {
+					assert.Equal(t, []string{fxapp.BuiltinOpenAPITag}, operation.Tags)
+					assert.NotEmpty(t, operation.Summary)
+				}
+			}
+			assert.Contains(t, doc.Paths["/"+fxapp.HealthCheckResultsEndpoint]["get"].Responses["200"].Content, fxapp.OpenMetricsMediaType)
+		})
+
+		t.Run("user registered routes", func(t *testing.T) {
+			operation, ok := doc.Paths["/foo"]["put"]
+			require.True(t, ok)
+			assert.Equal(t, "updates foo", operation.Summary)
+			assert.Equal(t, []Param{{Name: "id", In: "query", Required: true}}, operation.Parameters)
+			assert.Equal(t, "No Content", operation.Responses["204"].Description)
+			assert.Equal(t, "foo not found", operation.Responses["404"].Description)
+			assert.NotContains(t, doc.Paths, "/bar")
+		})
+	})
+}
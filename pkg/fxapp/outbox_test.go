@@ -0,0 +1,81 @@
+/*
+ * Copyright (c) 2019 OysterPack, Inc.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ * http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package fxapp_test
+
+import (
+	"context"
+	"github.com/oysterpack/andiamo/pkg/fx/outbox"
+	"github.com/oysterpack/andiamo/pkg/fxapp"
+	"github.com/oysterpack/andiamo/pkg/fxapptest"
+	"github.com/oysterpack/andiamo/pkg/ulids"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"io/ioutil"
+	"net/http"
+	"testing"
+	"time"
+)
+
+type singleMessageStore struct {
+	published chan []int64
+}
+
+func (s singleMessageStore) Pending(ctx context.Context, limit int) ([]outbox.Message, error) {
+	return []outbox.Message{{ID: 1, Topic: "orders", CreatedAt: time.Now()}}, nil
+}
+
+func (s singleMessageStore) MarkPublished(ctx context.Context, ids []int64) error {
+	select {
+	case s.published <- ids:
+	default:
+	}
+	return nil
+}
+
+func TestBuilder_EnableOutboxRelay(t *testing.T) {
+	t.Parallel()
+
+	store := singleMessageStore{published: make(chan []int64, 1)}
+	builder := fxapp.NewBuilder(fxapp.ID(ulids.MustNew()), fxapp.ReleaseID(ulids.MustNew())).
+		Provide(
+			func() outbox.Store { return store },
+			func() outbox.Publisher {
+				return outbox.PublisherFunc(func(ctx context.Context, msg outbox.Message) error { return nil })
+			},
+		).
+		Invoke(func() {}).
+		EnableOutboxRelay(outbox.Opts{PollInterval: 10 * time.Millisecond}).
+		LogWriter(ioutil.Discard)
+
+	fxapptest.RunApp(t, builder, func(app fxapp.App, client *fxapptest.HTTPClient) {
+		select {
+		case ids := <-store.published:
+			assert.Equal(t, []int64{1}, ids)
+		case <-time.After(5 * time.Second):
+			t.Fatal("*** timed out waiting for the outbox message to be published")
+		}
+
+		// the relay lag health check is registered
+		response, err := client.Get(fxapp.HealthCheckResultsEndpoint)
+		require.NoError(t, err)
+		defer response.Body.Close()
+		body, err := ioutil.ReadAll(response.Body)
+		require.NoError(t, err)
+		require.Equal(t, http.StatusOK, response.StatusCode)
+		assert.Contains(t, string(body), outbox.RelayLagHealthCheckID)
+	})
+}
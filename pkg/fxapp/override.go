@@ -0,0 +1,384 @@
+/*
+ * Copyright (c) 2019 OysterPack, Inc.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ * http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package fxapp
+
+import (
+	"errors"
+	"fmt"
+	"go.uber.org/fx"
+	"go.uber.org/multierr"
+	"reflect"
+)
+
+// override related errors
+var (
+	ErrInvalidDecorator   = errors.New("decorator must be a function that accepts the decorated type as its first param and returns the decorated type, and optionally an error")
+	ErrInvalidReplacement = errors.New("replacement must not be nil")
+	ErrOverrideConflict   = errors.New("type is replaced more than once")
+	ErrOverrideNotMatched = errors.New("overridden type is not provided")
+)
+
+// overrides are applied to the app constructors, i.e., the replaced types are no longer provided by the constructors,
+// and decorated types are passed through the decorators - see `Builder.Replace()` and `Builder.Decorate()`
+type overrides struct {
+	// replacements and decorators are kept in registration order in order to report problems deterministically
+	replacements []reflect.Value
+	decorators   []reflect.Value
+}
+
+func (o *overrides) empty() bool {
+	return len(o.replacements) == 0 && len(o.decorators) == 0
+}
+
+// replacementType returns the replaced type - a pointer to an interface value is used to replace the interface type
+func replacementType(value reflect.Value) reflect.Type {
+	if value.Kind() == reflect.Ptr && value.Type().Elem().Kind() == reflect.Interface {
+		return value.Type().Elem()
+	}
+	return value.Type()
+}
+
+func replacementValue(value reflect.Value) reflect.Value {
+	if value.Kind() == reflect.Ptr && value.Type().Elem().Kind() == reflect.Interface {
+		return value.Elem()
+	}
+	return value
+}
+
+func (o *overrides) validate() error {
+	var err error
+	replaced := make(map[reflect.Type]bool)
+	for _, value := range o.replacements {
+		if !value.IsValid() || (value.Kind() == reflect.Ptr && value.IsNil()) {
+			err = multierr.Append(err, ErrInvalidReplacement)
+			continue
+		}
+		t := replacementType(value)
+		if replaced[t] {
+			err = multierr.Append(err, fmt.Errorf("%s : %s", ErrOverrideConflict, t))
+		}
+		replaced[t] = true
+	}
+	for _, decorator := range o.decorators {
+		if !validDecorator(decorator) {
+			decoratorType := "nil"
+			if decorator.IsValid() {
+				decoratorType = decorator.Type().String()
+			}
+			err = multierr.Append(err, fmt.Errorf("%s : %s", ErrInvalidDecorator, decoratorType))
+		}
+	}
+	return err
+}
+
+func validDecorator(decorator reflect.Value) bool {
+	if !decorator.IsValid() || decorator.Kind() != reflect.Func || decorator.IsNil() {
+		return false
+	}
+	t := decorator.Type()
+	if t.IsVariadic() || t.NumIn() == 0 || isParamObject(t.In(0)) {
+		return false
+	}
+	switch t.NumOut() {
+	case 1:
+		return t.Out(0) == t.In(0)
+	case 2:
+		return t.Out(0) == t.In(0) && t.Out(1) == errorType
+	default:
+		return false
+	}
+}
+
+func (o *overrides) replacement(t reflect.Type) (reflect.Value, bool) {
+	for _, value := range o.replacements {
+		if replacementType(value) == t {
+			return replacementValue(value), true
+		}
+	}
+	return reflect.Value{}, false
+}
+
+// decoratorsFor returns the indexes of the decorators for the type
+func (o *overrides) decoratorsFor(t reflect.Type) []int {
+	var decorators []int
+	for i, decorator := range o.decorators {
+		if decorator.Type().In(0) == t {
+			decorators = append(decorators, i)
+		}
+	}
+	return decorators
+}
+
+// apply returns the options with the overrides applied to the provided constructors, plus the replacement constructors.
+// The returned error reports the overrides that did not match any provided type.
+//
+// NOTE: named and value group constructors, i.e., fx.Annotated constructors, are not overridden.
+func (o *overrides) apply(options []fx.Option) ([]fx.Option, error) {
+	if o.empty() {
+		return options, nil
+	}
+	matched := make(map[reflect.Type]bool)
+	options = o.applyOptions(options, matched)
+
+	var err error
+	var replacements []interface{}
+	for _, value := range o.replacements {
+		t := replacementType(value)
+		if !matched[t] {
+			err = multierr.Append(err, fmt.Errorf("%s : replaced type : %s", ErrOverrideNotMatched, t))
+			continue
+		}
+		constructor := replacementConstructor(t, replacementValue(value))
+		// the replacement is decorated, if decorators are registered for the replaced type
+		replacements = append(replacements, o.wrap(constructor, nil, false).Interface())
+	}
+	for _, decorator := range o.decorators {
+		if t := decorator.Type().In(0); !matched[t] {
+			err = multierr.Append(err, fmt.Errorf("%s : decorated type : %s", ErrOverrideNotMatched, t))
+		}
+	}
+	if len(replacements) > 0 {
+		options = append(options, fx.Provide(replacements...))
+	}
+	return options, err
+}
+
+func (o *overrides) applyOptions(options []fx.Option, matched map[reflect.Type]bool) []fx.Option {
+	applied := make([]fx.Option, 0, len(options))
+	for _, option := range options {
+		value := reflect.ValueOf(option)
+		switch value.Type().String() {
+		case "fx.optionGroup":
+			group := make([]fx.Option, value.Len())
+			for i := range group {
+				group[i] = value.Index(i).Interface().(fx.Option)
+			}
+			applied = append(applied, fx.Options(o.applyOptions(group, matched)...))
+		case "fx.provideOption":
+			var constructors []interface{}
+			for i := 0; i < value.Len(); i++ {
+				constructor := value.Index(i).Elem()
+				if constructor.Kind() != reflect.Func {
+					constructors = append(constructors, constructor.Interface())
+					continue
+				}
+				if wrapped := o.wrap(constructor, matched, true); wrapped.IsValid() {
+					constructors = append(constructors, wrapped.Interface())
+				}
+			}
+			if len(constructors) > 0 {
+				applied = append(applied, fx.Provide(constructors...))
+			}
+		default:
+			applied = append(applied, option)
+		}
+	}
+	return applied
+}
+
+func replacementConstructor(t reflect.Type, value reflect.Value) reflect.Value {
+	return reflect.MakeFunc(reflect.FuncOf(nil, []reflect.Type{t}, false), func([]reflect.Value) []reflect.Value {
+		return []reflect.Value{value}
+	})
+}
+
+// constructorResult maps a constructor result to the wrapped constructor result
+type constructorResult struct {
+	// index is the constructor result index
+	index int
+	// the wrapped constructor result type - a result object type is rebuilt without the replaced fields
+	t reflect.Type
+	// fields maps the wrapped result object fields to the constructor result object fields
+	fields []int
+	// decorators are applied to the result, or to the result object fields, by field index - the decorators are
+	// referenced by their index
+	decorators map[int][]int
+}
+
+// wrap returns the constructor with the overrides applied. If the constructor is not overridden, then it is returned
+// as is. If all of the constructor results are replaced, then an invalid reflect.Value is returned, i.e., the
+// constructor is dropped.
+func (o *overrides) wrap(constructor reflect.Value, matched map[reflect.Type]bool, replace bool) reflect.Value {
+	funcType := constructor.Type()
+	if funcType.IsVariadic() {
+		return constructor
+	}
+	match := func(t reflect.Type) (replaced bool, decorators []int) {
+		if replace {
+			if _, ok := o.replacement(t); ok {
+				if matched != nil {
+					matched[t] = true
+				}
+				return true, nil
+			}
+		}
+		decorators = o.decoratorsFor(t)
+		if len(decorators) > 0 && matched != nil {
+			matched[t] = true
+		}
+		return false, decorators
+	}
+
+	overridden := false
+	errIndex := -1
+	var results []constructorResult
+	for i := 0; i < funcType.NumOut(); i++ {
+		t := funcType.Out(i)
+		if t == errorType {
+			errIndex = i
+			continue
+		}
+		if !isResultObject(t) {
+			replaced, decorators := match(t)
+			if replaced {
+				overridden = true
+				continue
+			}
+			result := constructorResult{index: i, t: t}
+			if len(decorators) > 0 {
+				overridden = true
+				result.decorators = map[int][]int{-1: decorators}
+			}
+			results = append(results, result)
+			continue
+		}
+
+		result := constructorResult{index: i, decorators: make(map[int][]int)}
+		var fields []reflect.StructField
+		for j := 0; j < t.NumField(); j++ {
+			field := t.Field(j)
+			// named and grouped fields are not overridden
+			if !field.Anonymous && field.Tag.Get("name") == "" && field.Tag.Get("group") == "" {
+				replaced, decorators := match(field.Type)
+				if replaced {
+					overridden = true
+					continue
+				}
+				if len(decorators) > 0 {
+					overridden = true
+					result.decorators[len(fields)] = decorators
+				}
+			}
+			fields = append(fields, field)
+			result.fields = append(result.fields, j)
+		}
+		result.t = t
+		if len(fields) < t.NumField() {
+			result.t = reflect.StructOf(fields)
+		}
+		results = append(results, result)
+	}
+	if !overridden {
+		return constructor
+	}
+	if len(results) == 0 {
+		return reflect.Value{}
+	}
+
+	// the decorator dependencies are appended to the constructor params
+	ins := make([]reflect.Type, funcType.NumIn())
+	for i := range ins {
+		ins[i] = funcType.In(i)
+	}
+	returnsErr := errIndex >= 0
+	type decoratorArgs struct{ offset, count int }
+	args := make(map[int]decoratorArgs)
+	for _, result := range results {
+		for _, decorators := range result.decorators {
+			for _, decorator := range decorators {
+				args[decorator] = decoratorArgs{}
+			}
+		}
+	}
+	// the decorator params are appended in the decorator registration order
+	for i, decorator := range o.decorators {
+		if _, ok := args[i]; !ok {
+			continue
+		}
+		decoratorType := decorator.Type()
+		args[i] = decoratorArgs{len(ins), decoratorType.NumIn() - 1}
+		for j := 1; j < decoratorType.NumIn(); j++ {
+			ins = append(ins, decoratorType.In(j))
+		}
+		returnsErr = returnsErr || decoratorType.NumOut() == 2
+	}
+	outs := make([]reflect.Type, 0, len(results)+1)
+	for _, result := range results {
+		outs = append(outs, result.t)
+	}
+	if returnsErr {
+		outs = append(outs, errorType)
+	}
+
+	wrappedType := reflect.FuncOf(ins, outs, false)
+	return reflect.MakeFunc(wrappedType, func(in []reflect.Value) []reflect.Value {
+		failed := func(err reflect.Value) []reflect.Value {
+			out := make([]reflect.Value, len(outs))
+			for i, t := range outs {
+				out[i] = reflect.Zero(t)
+			}
+			out[len(out)-1] = err
+			return out
+		}
+		decorate := func(value reflect.Value, decorators []int) (reflect.Value, reflect.Value) {
+			for _, decorator := range decorators {
+				a := args[decorator]
+				decoratorIn := append([]reflect.Value{value}, in[a.offset:a.offset+a.count]...)
+				decoratorOut := o.decorators[decorator].Call(decoratorIn)
+				if len(decoratorOut) == 2 && !decoratorOut[1].IsNil() {
+					return value, decoratorOut[1]
+				}
+				value = decoratorOut[0]
+			}
+			return value, reflect.Value{}
+		}
+
+		constructorOut := constructor.Call(in[:funcType.NumIn()])
+		if errIndex >= 0 && !constructorOut[errIndex].IsNil() {
+			return failed(constructorOut[errIndex])
+		}
+		out := make([]reflect.Value, 0, len(outs))
+		for _, result := range results {
+			value := constructorOut[result.index]
+			if result.fields == nil {
+				decorated, err := decorate(value, result.decorators[-1])
+				if err.IsValid() {
+					return failed(err)
+				}
+				out = append(out, decorated)
+				continue
+			}
+			object := reflect.New(result.t).Elem()
+			for i, j := range result.fields {
+				field := value.Field(j)
+				if decorators, ok := result.decorators[i]; ok {
+					decorated, err := decorate(field, decorators)
+					if err.IsValid() {
+						return failed(err)
+					}
+					field = decorated
+				}
+				object.Field(i).Set(field)
+			}
+			out = append(out, object)
+		}
+		if returnsErr {
+			out = append(out, reflect.Zero(errorType))
+		}
+		return out
+	})
+}
@@ -0,0 +1,224 @@
+/*
+ * Copyright (c) 2019 OysterPack, Inc.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ * http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package fxapp_test
+
+import (
+	"errors"
+	"github.com/oysterpack/andiamo/pkg/clock"
+	"github.com/oysterpack/andiamo/pkg/fxapp"
+	"github.com/oysterpack/andiamo/pkg/ulids"
+	"github.com/rs/zerolog"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.uber.org/fx"
+	"io/ioutil"
+	"testing"
+	"time"
+)
+
+type overrideDB struct {
+	name string
+}
+
+type overrideCache struct {
+	name string
+}
+
+type overrideResults struct {
+	fx.Out
+
+	DB    *overrideDB
+	Cache *overrideCache
+}
+
+func newOverrideBuilder() fxapp.Builder {
+	return fxapp.NewBuilder(fxapp.ID(ulids.MustNew()), fxapp.ReleaseID(ulids.MustNew())).
+		DisableHTTPServer().
+		LogWriter(ioutil.Discard)
+}
+
+func TestBuilder_Replace(t *testing.T) {
+	t.Parallel()
+
+	t.Run("replace a provided type", func(t *testing.T) {
+		constructed := false
+		var db *overrideDB
+		_, err := newOverrideBuilder().
+			Provide(func() *overrideDB {
+				constructed = true
+				return &overrideDB{"real"}
+			}).
+			Replace(&overrideDB{"fake"}).
+			Invoke(func(d *overrideDB) { db = d }).
+			Build()
+		require.NoError(t, err)
+		assert.False(t, constructed, "*** the replaced constructor must not be run")
+		assert.Equal(t, "fake", db.name)
+	})
+
+	t.Run("replace an interface type", func(t *testing.T) {
+		var fakeClock clock.Clock = clock.NewFake(time.Now())
+		var appClock clock.Clock
+		_, err := newOverrideBuilder().
+			Replace(&fakeClock).
+			Invoke(func(c clock.Clock) { appClock = c }).
+			Build()
+		require.NoError(t, err)
+		assert.True(t, appClock == fakeClock)
+	})
+
+	t.Run("replace 1 of the constructor results", func(t *testing.T) {
+		var db *overrideDB
+		var cache *overrideCache
+		_, err := newOverrideBuilder().
+			Provide(func() (*overrideDB, *overrideCache, error) {
+				return &overrideDB{"real"}, &overrideCache{"real"}, nil
+			}).
+			Replace(&overrideDB{"fake"}).
+			Invoke(func(d *overrideDB, c *overrideCache) {
+				db, cache = d, c
+			}).
+			Build()
+		require.NoError(t, err)
+		assert.Equal(t, "fake", db.name)
+		assert.Equal(t, "real", cache.name)
+	})
+
+	t.Run("replace a result object field", func(t *testing.T) {
+		var db *overrideDB
+		var cache *overrideCache
+		_, err := newOverrideBuilder().
+			Provide(func() overrideResults {
+				return overrideResults{DB: &overrideDB{"real"}, Cache: &overrideCache{"real"}}
+			}).
+			Replace(&overrideCache{"fake"}).
+			Invoke(func(d *overrideDB, c *overrideCache) {
+				db, cache = d, c
+			}).
+			Build()
+		require.NoError(t, err)
+		assert.Equal(t, "real", db.name)
+		assert.Equal(t, "fake", cache.name)
+	})
+
+	t.Run("conflicts", func(t *testing.T) {
+		_, err := newOverrideBuilder().
+			Provide(func() *overrideDB { return &overrideDB{"real"} }).
+			Replace(&overrideDB{"fake"}, &overrideDB{"fake2"}).
+			Invoke(func(*overrideDB) {}).
+			Build()
+		require.Error(t, err)
+		assert.Contains(t, err.Error(), fxapp.ErrOverrideConflict.Error())
+	})
+
+	t.Run("replaced type is not provided", func(t *testing.T) {
+		_, err := newOverrideBuilder().
+			Replace(&overrideDB{"fake"}).
+			Invoke(func() {}).
+			Build()
+		require.Error(t, err)
+		report := err.(*fxapp.BuildReport)
+		require.Len(t, report.Problems, 1)
+		assert.Equal(t, fxapp.InvalidOverrideProblem, report.Problems[0].Kind)
+		assert.Contains(t, report.Problems[0].Msg, fxapp.ErrOverrideNotMatched.Error())
+	})
+}
+
+func TestBuilder_Decorate(t *testing.T) {
+	t.Parallel()
+
+	t.Run("decorators are applied in order", func(t *testing.T) {
+		var db *overrideDB
+		_, err := newOverrideBuilder().
+			Provide(func() *overrideDB { return &overrideDB{"db"} }).
+			Decorate(
+				func(d *overrideDB, logger *zerolog.Logger) *overrideDB {
+					require.NotNil(t, logger)
+					return &overrideDB{d.name + "+logged"}
+				},
+				func(d *overrideDB) (*overrideDB, error) {
+					return &overrideDB{d.name + "+metered"}, nil
+				},
+			).
+			Invoke(func(d *overrideDB) { db = d }).
+			Build()
+		require.NoError(t, err)
+		assert.Equal(t, "db+logged+metered", db.name)
+	})
+
+	t.Run("decorate a result object field", func(t *testing.T) {
+		var cache *overrideCache
+		_, err := newOverrideBuilder().
+			Provide(func() overrideResults {
+				return overrideResults{DB: &overrideDB{"db"}, Cache: &overrideCache{"cache"}}
+			}).
+			Decorate(func(c *overrideCache) *overrideCache { return &overrideCache{c.name + "+decorated"} }).
+			Invoke(func(c *overrideCache) { cache = c }).
+			Build()
+		require.NoError(t, err)
+		assert.Equal(t, "cache+decorated", cache.name)
+	})
+
+	t.Run("decorate a replacement", func(t *testing.T) {
+		var db *overrideDB
+		_, err := newOverrideBuilder().
+			Provide(func() *overrideDB { return &overrideDB{"real"} }).
+			Replace(&overrideDB{"fake"}).
+			Decorate(func(d *overrideDB) *overrideDB { return &overrideDB{d.name + "+decorated"} }).
+			Invoke(func(d *overrideDB) { db = d }).
+			Build()
+		require.NoError(t, err)
+		assert.Equal(t, "fake+decorated", db.name)
+	})
+
+	t.Run("decorator error", func(t *testing.T) {
+		_, err := newOverrideBuilder().
+			Provide(func() *overrideDB { return &overrideDB{"db"} }).
+			Decorate(func(d *overrideDB) (*overrideDB, error) { return nil, errors.New("BOOM") }).
+			Invoke(func(*overrideDB) {}).
+			Build()
+		require.Error(t, err)
+		assert.Contains(t, err.Error(), "BOOM")
+	})
+
+	t.Run("invalid decorators", func(t *testing.T) {
+		_, err := newOverrideBuilder().
+			Provide(func() *overrideDB { return &overrideDB{"db"} }).
+			Decorate(
+				nil,
+				func(d *overrideDB) *overrideCache { return nil },
+				func() *overrideDB { return nil },
+			).
+			Invoke(func(*overrideDB) {}).
+			Build()
+		require.Error(t, err)
+		report := err.(*fxapp.BuildReport)
+		require.Len(t, report.Problems, 3)
+		for _, p := range report.Problems {
+			assert.Contains(t, p.Msg, fxapp.ErrInvalidDecorator.Error())
+		}
+	})
+
+	t.Run("validate", func(t *testing.T) {
+		err := newOverrideBuilder().
+			Decorate(func(d *overrideDB) *overrideDB { return d }).
+			Invoke(func() {}).
+			Validate()
+		require.Error(t, err)
+		assert.Contains(t, err.Error(), fxapp.ErrOverrideNotMatched.Error())
+	})
+}
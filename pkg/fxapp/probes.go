@@ -18,14 +18,19 @@ package fxapp
 
 import (
 	"fmt"
+	"github.com/oysterpack/andiamo/pkg/clock"
 	"github.com/oysterpack/andiamo/pkg/eventlog"
 	"github.com/oysterpack/andiamo/pkg/fx/health"
+	"github.com/oysterpack/andiamo/pkg/fx/upgrade"
 	"github.com/pkg/errors"
+	"github.com/prometheus/client_golang/prometheus"
 	"github.com/rs/zerolog"
+	"go.uber.org/fx"
 	"go.uber.org/multierr"
 	"net/http"
+	"sort"
+	"strings"
 	"sync"
-	"time"
 )
 
 // ReadinessWaitGroup is used by application components to signal when they are ready to service requests
@@ -95,27 +100,172 @@ func (r *readinessWaitGroup) Ready() <-chan struct{} {
 	return c
 }
 
-func readinessProbeHTTPHandler(readiness ReadinessWaitGroup) HTTPHandler {
+// ReadinessHealthCheckTag is used to tag the health checks that gate the app readiness instead of the app liveness, e.g.,
+// health checks on downstream dependencies, where the app should be taken out of rotation instead of being restarted:
+//   - the readiness probe fails until each readiness health check has run, and while any readiness health check is Red
+//   - readiness health checks are excluded from the liveness probe
+//   - readiness health checks that are not Green on start up do not fail the app start up
+const ReadinessHealthCheckTag = "01DJ4JSWM0QKJN4WWF8JNQWFJ5"
+
+// AppReadyMetricID is the gauge metric ID for the app readiness probe status, i.e., 1 if the app is ready, 0 if not
+const AppReadyMetricID = "U01DJ4JSWR9Y2FHAH4YS36ENDBE"
+
+func isReadinessHealthCheck(check health.Check) bool {
+	return hasHealthCheckTag(check, ReadinessHealthCheckTag)
+}
+
+func hasHealthCheckTag(check health.Check, tag string) bool {
+	for _, t := range check.Tags {
+		if t == tag {
+			return true
+		}
+	}
+	return false
+}
+
+// readinessStatus is the app readiness probe status
+type readinessStatus struct {
+	draining bool
+	// readiness wait group count
+	waitCount uint
+	// the readiness health checks that have not yet run
+	pendingChecks []string
+	// the readiness health checks that are Red
+	redChecks []string
+}
+
+func (s readinessStatus) ready() bool {
+	return !s.draining && s.waitCount == 0 && len(s.pendingChecks) == 0 && len(s.redChecks) == 0
+}
+
+// readinessProbe returns the app readiness status
+type readinessProbe func() readinessStatus
+
+type readinessProbeParams struct {
+	fx.In
+
+	Readiness        ReadinessWaitGroup
+	RegisteredChecks health.RegisteredChecks
+	CheckResults     health.CheckResults
+	// only provided if upgrades are enabled
+	Draining upgrade.Draining `optional:"true"`
+}
+
+// the app is not ready while it is draining, i.e., after it has been upgraded
+func newReadinessProbe(params readinessProbeParams) readinessProbe {
+	draining := params.Draining
+	if draining == nil {
+		draining = func() bool { return false }
+	}
+	return func() readinessStatus {
+		status := readinessStatus{
+			draining:  draining(),
+			waitCount: params.Readiness.Count(),
+		}
+
+		readinessChecks := make(map[string]bool)
+		for _, check := range <-params.RegisteredChecks(health.Query{}) {
+			if isReadinessHealthCheck(check.Check) {
+				readinessChecks[check.ID] = false
+			}
+		}
+		if len(readinessChecks) == 0 {
+			return status
+		}
+		for _, result := range <-params.CheckResults(func(result health.Result) bool {
+			_, ok := readinessChecks[result.ID]
+			return ok
+		}, health.Query{}) {
+			readinessChecks[result.ID] = true
+			if result.Status == health.Red {
+				status.redChecks = append(status.redChecks, result.ID)
+			}
+		}
+		for id, hasResult := range readinessChecks {
+			if !hasResult {
+				status.pendingChecks = append(status.pendingChecks, id)
+			}
+		}
+		sort.Strings(status.pendingChecks)
+		return status
+	}
+}
+
+func readinessProbeHTTPHandler(probe readinessProbe) HTTPHandler {
 	return NewHTTPHandler(fmt.Sprintf("/%s", ReadyEvent), func(writer http.ResponseWriter, request *http.Request) {
-		count := readiness.Count()
-		switch count {
-		case 0:
+		status := probe()
+		switch {
+		case status.draining:
+			writer.Header().Add("x-draining", "true")
+			writer.WriteHeader(http.StatusServiceUnavailable)
+		case status.ready():
 			writer.WriteHeader(http.StatusOK)
 		default:
-			writer.Header().Add("x-readiness-wait-group-count", fmt.Sprint(count))
+			if status.waitCount > 0 {
+				writer.Header().Add("x-readiness-wait-group-count", fmt.Sprint(status.waitCount))
+			}
+			if len(status.pendingChecks) > 0 {
+				writer.Header().Add("x-readiness-health-checks-pending", strings.Join(status.pendingChecks, ","))
+			}
+			if len(status.redChecks) > 0 {
+				writer.Header().Add("x-readiness-health-checks-red", strings.Join(status.redChecks, ","))
+			}
 			writer.WriteHeader(http.StatusServiceUnavailable)
 		}
+	}).WithDoc(OpenAPIOperation{
+		Summary: "readiness probe",
+		Tags:    []string{BuiltinOpenAPITag},
+		Responses: []OpenAPIResponse{
+			{Status: http.StatusOK, Description: "app is ready"},
+			{Status: http.StatusServiceUnavailable, Description: "app is not ready, readiness health checks are pending or Red, or it is draining after an upgrade"},
+		},
 	})
 }
 
+func registerAppReadyGauge(probe readinessProbe, registerer prometheus.Registerer) error {
+	return registerer.Register(prometheus.NewGaugeFunc(
+		prometheus.GaugeOpts{Name: AppReadyMetricID, Help: "1 if the app readiness probe passes, 0 if not"},
+		func() float64 {
+			if probe().ready() {
+				return 1
+			}
+			return 0
+		},
+	))
+}
+
 // LivenessProbe checks if the app is healthy. It returns an error if probe fails, indicating the app is unhealthy.
 type LivenessProbe func() error
 
-func livenessProbe(checkResults health.CheckResults) LivenessProbe {
+type livenessProbeParams struct {
+	fx.In
+
+	RegisteredChecks health.RegisteredChecks
+	CheckResults     health.CheckResults
+	// FatalHealthChecks is only provided if fatal health checks are enabled - see `Builder.EnableFatalHealthChecks()`
+	FatalHealthChecks *fatalHealthChecks `optional:"true"`
+}
+
+// readiness health checks are excluded, i.e., they gate the app readiness instead - see `ReadinessHealthCheckTag`.
+//
+// Once a fatal health check has tripped, the liveness probe fails, even if the health check recovers.
+func livenessProbe(params livenessProbeParams) LivenessProbe {
+	registeredChecks, checkResults := params.RegisteredChecks, params.CheckResults
 	return func() error {
+		if params.FatalHealthChecks != nil {
+			if err := params.FatalHealthChecks.err(); err != nil {
+				return err
+			}
+		}
+		readinessChecks := make(map[string]bool)
+		for _, check := range <-registeredChecks(health.Query{}) {
+			if isReadinessHealthCheck(check.Check) {
+				readinessChecks[check.ID] = true
+			}
+		}
 		redCheckResults := <-checkResults(func(result health.Result) bool {
-			return result.Status == health.Red
-		})
+			return result.Status == health.Red && !readinessChecks[result.ID]
+		}, health.Query{})
 		if len(redCheckResults) > 0 {
 			err := errors.New("liveness probe failed because health checks are RED")
 			for _, result := range redCheckResults {
@@ -129,13 +279,13 @@ func livenessProbe(checkResults health.CheckResults) LivenessProbe {
 }
 
 // if any health check status is Red, then the liveness check fails
-func livenessProbeHTTPHandler(probe LivenessProbe, logger *zerolog.Logger) HTTPHandler {
+func livenessProbeHTTPHandler(probe LivenessProbe, logger *zerolog.Logger, clock clock.Clock) HTTPHandler {
 	logProbeSuccess := eventlog.NewLogger(LivenessProbeEvent, logger, zerolog.InfoLevel)
 	logProbeFailure := eventlog.NewLogger(LivenessProbeEvent, logger, zerolog.ErrorLevel)
 	return NewHTTPHandler(fmt.Sprintf("/%s", LivenessProbeEvent), func(writer http.ResponseWriter, request *http.Request) {
-		start := time.Now()
+		start := clock.Now()
 		err := probe()
-		probeDuration := duration(time.Since(start))
+		probeDuration := duration(clock.Since(start))
 		if err != nil {
 			writer.WriteHeader(http.StatusServiceUnavailable)
 			logProbeFailure(eventlog.NewError(err), "liveness probe failed")
@@ -143,5 +293,12 @@ func livenessProbeHTTPHandler(probe LivenessProbe, logger *zerolog.Logger) HTTPH
 		}
 		writer.WriteHeader(http.StatusOK)
 		logProbeSuccess(probeDuration, "liveness probe success")
+	}).WithDoc(OpenAPIOperation{
+		Summary: "liveness probe",
+		Tags:    []string{BuiltinOpenAPITag},
+		Responses: []OpenAPIResponse{
+			{Status: http.StatusOK, Description: "app is healthy"},
+			{Status: http.StatusServiceUnavailable, Description: "health checks are Red"},
+		},
 	})
 }
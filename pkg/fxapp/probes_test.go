@@ -28,11 +28,15 @@ import (
 	"github.com/oysterpack/andiamo/pkg/ulids"
 	"github.com/prometheus/client_golang/prometheus"
 	io_prometheus_client "github.com/prometheus/client_model/go"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
 	"go.uber.org/fx"
+	"io/ioutil"
 	"net/http"
 	"strconv"
 	"strings"
 	"sync"
+	"sync/atomic"
 	"testing"
 	"time"
 )
@@ -203,7 +207,7 @@ func TestLivenessProbe(t *testing.T) {
 	}
 
 	checkProbe := func(t *testing.T, status health.Status, test func(t *testing.T, probe fxapp.LivenessProbe)) {
-		Checker := func() (health.Status, error) {
+		Checker := func(ctx context.Context) (health.Status, error) {
 			switch status {
 			case health.Green:
 				return health.Green, nil
@@ -337,7 +341,7 @@ func TestLivenessProbHTTPEndpoint(t *testing.T) {
 	livenessProbeEndpoint := fmt.Sprintf("http://:8008/%s", fxapp.LivenessProbeEvent)
 
 	checkProbe := func(t *testing.T, status health.Status) {
-		Checker := func() (health.Status, error) {
+		Checker := func(ctx context.Context) (health.Status, error) {
 			switch status {
 			case health.Green:
 				return health.Green, nil
@@ -456,3 +460,67 @@ func TestLivenessProbHTTPEndpoint(t *testing.T) {
 		checkProbe(t, health.Red)
 	})
 }
+
+func TestReadinessHealthChecks(t *testing.T) {
+	t.Parallel()
+
+	readinessCheck := health.Check{
+		ID:          ulids.MustNew().String(),
+		Description: "downstream dependency",
+		RedImpact:   "requests cannot be serviced",
+		Tags:        []string{fxapp.ReadinessHealthCheckTag},
+	}
+	var status uint32 = uint32(health.Red)
+	var (
+		runCheckNow   health.RunCheckNow
+		livenessProbe fxapp.LivenessProbe
+		gatherer      prometheus.Gatherer
+	)
+	builder := fxapp.NewBuilder(fxapp.ID(ulids.MustNew()), fxapp.ReleaseID(ulids.MustNew())).
+		Invoke(func(register health.Register) error {
+			return register(readinessCheck, health.CheckerOpts{}, func(ctx context.Context) (health.Status, error) {
+				if s := health.Status(atomic.LoadUint32(&status)); s != health.Green {
+					return s, errors.New("dependency is unavailable")
+				}
+				return health.Green, nil
+			})
+		}).
+		Populate(&runCheckNow, &livenessProbe, &gatherer).
+		LogWriter(ioutil.Discard)
+
+	// the app starts up even though the readiness health check is Red
+	fxapptest.RunApp(t, builder, func(app fxapp.App, client *fxapptest.HTTPClient) {
+		appReadyGauge := func() float64 {
+			metrics, err := gatherer.Gather()
+			require.NoError(t, err)
+			for _, mf := range metrics {
+				if mf.GetName() == fxapp.AppReadyMetricID {
+					return mf.Metric[0].Gauge.GetValue()
+				}
+			}
+			t.Fatal("*** app ready gauge is not registered")
+			return -1
+		}
+		probe := func() *http.Response {
+			response, err := client.Get(fxapp.ReadyEvent)
+			require.NoError(t, err)
+			response.Body.Close()
+			return response
+		}
+
+		_, err := runCheckNow(readinessCheck.ID)
+		require.NoError(t, err)
+		response := probe()
+		assert.Equal(t, http.StatusServiceUnavailable, response.StatusCode)
+		assert.Equal(t, readinessCheck.ID, response.Header.Get("x-readiness-health-checks-red"))
+		assert.Equal(t, 0.0, appReadyGauge())
+		// readiness health checks are excluded from the liveness probe
+		assert.NoError(t, livenessProbe())
+
+		atomic.StoreUint32(&status, uint32(health.Green))
+		_, err = runCheckNow(readinessCheck.ID)
+		require.NoError(t, err)
+		assert.Equal(t, http.StatusOK, probe().StatusCode)
+		assert.Equal(t, 1.0, appReadyGauge())
+	})
+}
@@ -0,0 +1,114 @@
+/*
+ * Copyright (c) 2019 OysterPack, Inc.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ * http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package fxapp
+
+import (
+	"errors"
+	"fmt"
+	"go.uber.org/multierr"
+	"os"
+	"strings"
+)
+
+// ProfileEnvVar is used to select the app profiles, i.e., a comma separated list of profile names, e.g., "prod" or
+// "dev,local-db". The profiles that are set via the builder take precedence - see `Builder.RegisterProfile()`.
+const ProfileEnvVar = EnvconfigPrefix + "_" + profileEnvName
+
+// Profile related errors
+var (
+	ErrProfileBlankName         = errors.New("profile name must not be blank")
+	ErrProfileAlreadyRegistered = errors.New("profile is already registered")
+	ErrProfileNotRegistered     = errors.New("profile is not registered")
+	ErrProfileNilOption         = errors.New("profile option must not be nil")
+)
+
+// Profiles are the names of the active app profiles, in the order that they were applied. It is provided via
+// dependency injection.
+type Profiles []string
+
+// Has returns true if the profile is active
+func (p Profiles) Has(name string) bool {
+	for _, profile := range p {
+		if profile == name {
+			return true
+		}
+	}
+	return false
+}
+
+type profile struct {
+	name    string
+	options []BuilderOption
+}
+
+// selectedProfiles returns the profile names that were set via the builder, or else via the env var
+func (b *builder) selectedProfiles() []string {
+	if b.profileNamesSet {
+		return b.profileNames
+	}
+	var names []string
+	for _, name := range strings.Split(os.Getenv(b.envPrefix.EnvVar(profileEnvName)), ",") {
+		if name = strings.TrimSpace(name); name != "" {
+			names = append(names, name)
+		}
+	}
+	return names
+}
+
+// applyProfiles applies the selected profiles' options, in the order that the profiles were selected. Profiles are
+// only applied once.
+func (b *builder) applyProfiles() error {
+	if b.profilesApplied {
+		return nil
+	}
+	b.profilesApplied = true
+
+	var err error
+	profiles := make(map[string]profile, len(b.profiles))
+	for _, p := range b.profiles {
+		if strings.TrimSpace(p.name) == "" {
+			err = multierr.Append(err, ErrProfileBlankName)
+			continue
+		}
+		if _, exists := profiles[p.name]; exists {
+			err = multierr.Append(err, fmt.Errorf("%s : %s", ErrProfileAlreadyRegistered, p.name))
+			continue
+		}
+		profiles[p.name] = p
+	}
+	var active Profiles
+	for _, name := range b.selectedProfiles() {
+		p, ok := profiles[name]
+		if !ok {
+			err = multierr.Append(err, fmt.Errorf("%s : %s", ErrProfileNotRegistered, name))
+			continue
+		}
+		if active.Has(name) {
+			continue
+		}
+		for _, option := range p.options {
+			if option == nil {
+				err = multierr.Append(err, fmt.Errorf("%s : %s", ErrProfileNilOption, name))
+				continue
+			}
+			option(b)
+		}
+		active = append(active, name)
+	}
+	b.activeProfiles = active
+	return err
+}
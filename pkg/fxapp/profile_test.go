@@ -0,0 +1,108 @@
+/*
+ * Copyright (c) 2019 OysterPack, Inc.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ * http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package fxapp_test
+
+import (
+	"github.com/oysterpack/andiamo/pkg/fxapp"
+	"github.com/oysterpack/andiamo/pkg/fxapptest"
+	"github.com/oysterpack/andiamo/pkg/ulids"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"io/ioutil"
+	"testing"
+)
+
+type profileDB string
+
+func newProfileTestBuilder(logs *fxapptest.LogCapture) fxapp.Builder {
+	return fxapp.NewBuilder(fxapp.ID(ulids.MustNew()), fxapp.ReleaseID(ulids.MustNew())).
+		Invoke(func() {}).
+		RegisterProfile("dev", func(b fxapp.Builder) fxapp.Builder {
+			return b.Provide(func() profileDB { return "sqlite" }).
+				LogLevel(fxapp.DebugLogLevel).
+				LogWriter(logs)
+		}).
+		RegisterProfile("prod", func(b fxapp.Builder) fxapp.Builder {
+			return b.Provide(func() profileDB { return "postgres" })
+		}).
+		RegisterProfile("verbose", func(b fxapp.Builder) fxapp.Builder {
+			return b.LogLevel(fxapp.DebugLogLevel)
+		}).
+		DisableHTTPServer().
+		LogWriter(ioutil.Discard)
+}
+
+func TestBuilder_RegisterProfile(t *testing.T) {
+	t.Run("profiles are selected via env var", func(t *testing.T) {
+		t.Setenv(fxapp.ProfileEnvVar, "prod, verbose")
+
+		var db profileDB
+		var profiles fxapp.Profiles
+		_, err := newProfileTestBuilder(fxapptest.NewLogCapture()).Populate(&db, &profiles).Build()
+		require.NoError(t, err)
+		assert.Equal(t, profileDB("postgres"), db)
+		assert.Equal(t, fxapp.Profiles{"prod", "verbose"}, profiles)
+		assert.True(t, profiles.Has("verbose"))
+		assert.False(t, profiles.Has("dev"))
+	})
+
+	t.Run("profiles set via builder take precedence", func(t *testing.T) {
+		t.Setenv(fxapp.ProfileEnvVar, "prod")
+
+		logs := fxapptest.NewLogCapture()
+		var db profileDB
+		var profiles fxapp.Profiles
+		_, err := newProfileTestBuilder(logs).SetProfiles("dev").Populate(&db, &profiles).Build()
+		require.NoError(t, err)
+		assert.Equal(t, profileDB("sqlite"), db)
+		assert.Equal(t, fxapp.Profiles{"dev"}, profiles)
+		// the profile log settings are applied
+		fxapptest.AssertEventLogged(t, logs, fxapp.InitializedEvent)
+	})
+
+	t.Run("no profiles selected", func(t *testing.T) {
+		t.Setenv(fxapp.ProfileEnvVar, "")
+
+		var db profileDB
+		err := newProfileTestBuilder(fxapptest.NewLogCapture()).Populate(&db).Validate()
+		require.Error(t, err, "profileDB is not provided")
+		report, ok := err.(*fxapp.BuildReport)
+		require.True(t, ok)
+		require.Len(t, report.Problems, 1)
+		assert.Equal(t, fxapp.MissingProviderProblem, report.Problems[0].Kind)
+	})
+}
+
+func TestBuilder_RegisterProfile_Invalid(t *testing.T) {
+	t.Parallel()
+
+	_, err := newProfileTestBuilder(fxapptest.NewLogCapture()).
+		RegisterProfile("dev").
+		RegisterProfile(" ").
+		RegisterProfile("nil", nil).
+		SetProfiles("nil", "qa").
+		Build()
+	require.Error(t, err)
+	for _, e := range []error{
+		fxapp.ErrProfileAlreadyRegistered,
+		fxapp.ErrProfileBlankName,
+		fxapp.ErrProfileNilOption,
+		fxapp.ErrProfileNotRegistered,
+	} {
+		assert.Contains(t, err.Error(), e.Error())
+	}
+}
@@ -0,0 +1,303 @@
+/*
+ * Copyright (c) 2019 OysterPack, Inc.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ * http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package fxapp
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"github.com/kelseyhightower/envconfig"
+	"github.com/oklog/ulid"
+	"github.com/oysterpack/andiamo/pkg/appdesc"
+	"github.com/oysterpack/andiamo/pkg/clock"
+	"github.com/oysterpack/andiamo/pkg/eventlog"
+	"github.com/rs/zerolog"
+	"go.uber.org/fx"
+	"net/http"
+	httppprof "net/http/pprof"
+	"net/url"
+	"runtime/pprof"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// ProfilerPushEvent is logged each time a CPU profile is pushed to the continuous profiler. Successful pushes are logged
+// at debug level, and failures are logged at warn level.
+//
+//	type Data struct {
+//		URL      string `json:"url"`
+//		// one of: ok, error
+//		Outcome  string `json:"outcome"`
+//		// the profile duration
+//		Duration uint   `json:"duration"`
+//	}
+const ProfilerPushEvent = "01DHZP844005XKE131MFC0EN6C"
+
+// PprofEndpointPathPrefix is the path prefix for the standard net/http/pprof endpoints, which are used by pull based
+// continuous profilers, e.g., Parca. The standard path is used because scrapers expect it by default.
+const PprofEndpointPathPrefix = "/debug/pprof/"
+
+// DefaultProfilerPushInterval is the default CPU profile duration for each push
+const DefaultProfilerPushInterval = 10 * time.Second
+
+// ProfilerEnvconfigPrefix is used to load the profiling options from env vars - see `LoadProfilingOptsFromEnv()`
+const ProfilerEnvconfigPrefix = EnvconfigPrefix + "_" + profilerEnvName
+
+// ErrInvalidProfilingOpts indicates the profiling options are invalid
+var ErrInvalidProfilingOpts = errors.New("profiling options are invalid")
+
+// ProfilingOpts is used to integrate the app with continuous profilers, via push (Pyroscope style) and / or via pprof
+// scraping (Parca style).
+//
+// Profiles are correlated with the same identifiers that are used in logs and metrics:
+//   - pushed profiles are labeled with the app ID, release ID, and instance ID, i.e., "a", "r", "i"
+//   - HTTP requests are served with the app ID, release ID, and instance ID pprof labels, i.e., the CPU profile samples
+//     are labeled
+//
+// NOTE: CPU profiling is process wide, i.e., while profiles are being pushed, CPU profile requests to the pprof
+// endpoints will fail.
+type ProfilingOpts struct {
+	// PushURL is the continuous profiler server URL, e.g., "http://pyroscope:4040". CPU profiles are pushed to its
+	// "/ingest" endpoint in the pprof format. If blank, then profiles are not pushed.
+	PushURL string `split_words:"true"`
+	// PushInterval is the CPU profile duration for each push. If zero, then DefaultProfilerPushInterval is used.
+	PushInterval time.Duration `split_words:"true"`
+	// PushAuthToken is sent as a bearer token, if specified
+	PushAuthToken string `split_words:"true"`
+	// PprofEndpoints registers the standard net/http/pprof endpoints as admin endpoints - see `PprofEndpointPathPrefix`
+	PprofEndpoints bool `split_words:"true"`
+}
+
+// LoadProfilingOptsFromEnv tries to load the profiling options from env vars:
+//
+//   - APP12X_PROFILER_PUSH_URL
+//   - APP12X_PROFILER_PUSH_INTERVAL, e.g., "15s"
+//   - APP12X_PROFILER_PUSH_AUTH_TOKEN
+//   - APP12X_PROFILER_PPROF_ENDPOINTS, e.g., "true"
+//
+// If profiling is not enabled via the builder, then it is enabled if either the push URL or the pprof endpoints are
+// configured via env vars.
+func LoadProfilingOptsFromEnv() (ProfilingOpts, error) {
+	return loadProfilingOpts(EnvconfigPrefix)
+}
+
+func loadProfilingOpts(prefix EnvPrefix) (ProfilingOpts, error) {
+	var opts ProfilingOpts
+	err := envconfig.Process(prefix.EnvVar(profilerEnvName), &opts)
+	return opts, err
+}
+
+func (opts ProfilingOpts) enabled() bool {
+	return opts.PushURL != "" || opts.PprofEndpoints
+}
+
+func (opts ProfilingOpts) validate() error {
+	if opts.PushInterval < 0 {
+		return fmt.Errorf("%s : push interval must not be negative : %s", ErrInvalidProfilingOpts, opts.PushInterval)
+	}
+	if opts.PushURL != "" {
+		u, err := url.Parse(opts.PushURL)
+		if err != nil {
+			return fmt.Errorf("%s : invalid push URL : %s", ErrInvalidProfilingOpts, err)
+		}
+		if (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+			return fmt.Errorf("%s : push URL must be an absolute HTTP URL : %s", ErrInvalidProfilingOpts, opts.PushURL)
+		}
+	}
+	return nil
+}
+
+func (opts ProfilingOpts) withDefaults() ProfilingOpts {
+	opts.PushURL = strings.TrimSuffix(opts.PushURL, "/")
+	if opts.PushInterval == 0 {
+		opts.PushInterval = DefaultProfilerPushInterval
+	}
+	return opts
+}
+
+// profilerLabels returns the app ID, release ID, and instance ID labels
+func profilerLabels(id ID, releaseID ReleaseID, instanceID InstanceID) []string {
+	return []string{
+		AppIDLabel, ulid.ULID(id).String(),
+		AppReleaseIDLabel, ulid.ULID(releaseID).String(),
+		AppInstanceIDLabel, ulid.ULID(instanceID).String(),
+	}
+}
+
+// newProfilerLabelsMiddleware serves requests with the pprof labels, i.e., the CPU profile samples are labeled
+func newProfilerLabelsMiddleware(labels []string) func(http.Handler) http.Handler {
+	labelSet := pprof.Labels(labels...)
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(writer http.ResponseWriter, request *http.Request) {
+			pprof.Do(request.Context(), labelSet, func(ctx context.Context) {
+				next.ServeHTTP(writer, request.WithContext(ctx))
+			})
+		})
+	}
+}
+
+func pprofHTTPHandlers() HTTPHandlers {
+	handlers := []HTTPHandler{
+		NewHTTPHandler(PprofEndpointPathPrefix, httppprof.Index).WithDoc(OpenAPIOperation{
+			Summary: "pprof profiles",
+			Tags:    []string{BuiltinOpenAPITag},
+		}),
+		NewHTTPHandler(PprofEndpointPathPrefix+"cmdline", httppprof.Cmdline),
+		NewHTTPHandler(PprofEndpointPathPrefix+"profile", httppprof.Profile).AsStream(),
+		NewHTTPHandler(PprofEndpointPathPrefix+"symbol", httppprof.Symbol),
+		NewHTTPHandler(PprofEndpointPathPrefix+"trace", httppprof.Trace).AsStream(),
+	}
+	endpoints := make([]HTTPEndpoint, len(handlers))
+	for i, handler := range handlers {
+		endpoints[i] = handler.AdminOnly().HTTPEndpoint
+	}
+	return HTTPHandlers{HTTPEndpoints: endpoints}
+}
+
+type profilerPush struct {
+	url      string
+	outcome  string
+	duration time.Duration
+}
+
+func (p profilerPush) MarshalZerologObject(e *zerolog.Event) {
+	e.
+		Str("url", p.url).
+		Str("outcome", p.outcome).
+		Dur("duration", p.duration)
+}
+
+// profilePusher continuously profiles the CPU, and pushes the profiles to the continuous profiler server
+type profilePusher struct {
+	opts   ProfilingOpts
+	client *http.Client
+	clock  clock.Clock
+	// the profile name, including the labels, e.g., "foo.cpu{a=...,r=...,i=...}"
+	name string
+
+	logPushed, logPushFailed eventlog.Logger
+}
+
+func newProfilePusher(opts ProfilingOpts, desc appdesc.Desc, instanceID InstanceID, clock clock.Clock, logger *zerolog.Logger) *profilePusher {
+	appName := desc.Name
+	if appName == "" {
+		appName = ulid.ULID(desc.ID).String()
+	}
+	labels := profilerLabels(ID(desc.ID), ReleaseID(desc.ReleaseID), instanceID)
+	pairs := make([]string, 0, len(labels)/2)
+	for i := 0; i < len(labels); i += 2 {
+		pairs = append(pairs, labels[i]+"="+labels[i+1])
+	}
+	return &profilePusher{
+		opts:          opts,
+		client:        &http.Client{Timeout: opts.PushInterval},
+		clock:         clock,
+		name:          fmt.Sprintf("%s.cpu{%s}", appName, strings.Join(pairs, ",")),
+		logPushed:     eventlog.NewLogger(ProfilerPushEvent, logger, zerolog.DebugLevel),
+		logPushFailed: eventlog.NewLogger(ProfilerPushEvent, logger, zerolog.WarnLevel),
+	}
+}
+
+// run profiles the CPU until the stop channel is closed
+func (p *profilePusher) run(ctx context.Context, stop <-chan struct{}) {
+	for {
+		profile := new(bytes.Buffer)
+		from := p.clock.Now()
+		err := pprof.StartCPUProfile(profile)
+		timer := p.clock.NewTimer(p.opts.PushInterval)
+		select {
+		case <-stop:
+			timer.Stop()
+			if err == nil {
+				pprof.StopCPUProfile()
+			}
+			return
+		case <-timer.C():
+		}
+		until := p.clock.Now()
+		if err == nil {
+			pprof.StopCPUProfile()
+			err = p.push(ctx, profile, from, until)
+		}
+		push := profilerPush{url: p.opts.PushURL, outcome: "ok", duration: until.Sub(from)}
+		if err != nil {
+			push.outcome = "error"
+			p.logPushFailed(push, fmt.Sprintf("failed to push CPU profile: %v", err))
+			continue
+		}
+		p.logPushed(push, "pushed CPU profile")
+	}
+}
+
+func (p *profilePusher) push(ctx context.Context, profile *bytes.Buffer, from, until time.Time) error {
+	query := url.Values{}
+	query.Set("name", p.name)
+	query.Set("from", strconv.FormatInt(from.Unix(), 10))
+	query.Set("until", strconv.FormatInt(until.Unix(), 10))
+	query.Set("format", "pprof")
+	query.Set("spyName", "gospy")
+	query.Set("sampleRate", "100")
+	request, err := http.NewRequest(http.MethodPost, fmt.Sprintf("%s/ingest?%s", p.opts.PushURL, query.Encode()), profile)
+	if err != nil {
+		return err
+	}
+	request = request.WithContext(ctx)
+	request.Header.Set("Content-Type", "application/octet-stream")
+	if p.opts.PushAuthToken != "" {
+		request.Header.Set("Authorization", "Bearer "+p.opts.PushAuthToken)
+	}
+	response, err := p.client.Do(request)
+	if err != nil {
+		return err
+	}
+	defer response.Body.Close()
+	if response.StatusCode/100 != 2 {
+		return fmt.Errorf("unexpected HTTP response status : %s", response.Status)
+	}
+	return nil
+}
+
+func runProfilePusher(opts ProfilingOpts) func(lc fx.Lifecycle, desc appdesc.Desc, instanceID InstanceID, clock clock.Clock, logger *zerolog.Logger) {
+	opts = opts.withDefaults()
+	return func(lc fx.Lifecycle, desc appdesc.Desc, instanceID InstanceID, clock clock.Clock, logger *zerolog.Logger) {
+		pusher := newProfilePusher(opts, desc, instanceID, clock, logger)
+		ctx, cancel := context.WithCancel(context.Background())
+		stop := make(chan struct{})
+		done := make(chan struct{})
+		lc.Append(fx.Hook{
+			OnStart: func(context.Context) error {
+				go func() {
+					defer close(done)
+					pusher.run(ctx, stop)
+				}()
+				return nil
+			},
+			OnStop: func(stopCtx context.Context) error {
+				close(stop)
+				cancel()
+				select {
+				case <-done:
+					return nil
+				case <-stopCtx.Done():
+					return stopCtx.Err()
+				}
+			},
+		})
+	}
+}
@@ -0,0 +1,207 @@
+/*
+ * Copyright (c) 2019 OysterPack, Inc.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ * http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package fxapp_test
+
+import (
+	"github.com/oklog/ulid"
+	"github.com/oysterpack/andiamo/pkg/clock"
+	"github.com/oysterpack/andiamo/pkg/fxapp"
+	"github.com/oysterpack/andiamo/pkg/fxapptest"
+	"github.com/oysterpack/andiamo/pkg/ulids"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"runtime/pprof"
+	"testing"
+	"time"
+)
+
+type pushedProfile struct {
+	query url.Values
+	auth  string
+	body  []byte
+}
+
+func TestBuilder_EnableProfiling_Push(t *testing.T) {
+	t.Parallel()
+
+	profiles := make(chan pushedProfile, 10)
+	status := make(chan int, 1)
+	status <- http.StatusInternalServerError
+	server := httptest.NewServer(http.HandlerFunc(func(writer http.ResponseWriter, request *http.Request) {
+		body, _ := ioutil.ReadAll(request.Body)
+		if request.URL.Path != "/ingest" || request.Method != http.MethodPost {
+			writer.WriteHeader(http.StatusNotFound)
+			return
+		}
+		select {
+		case s := <-status:
+			writer.WriteHeader(s)
+			return
+		default:
+		}
+		profiles <- pushedProfile{query: request.URL.Query(), auth: request.Header.Get("Authorization"), body: body}
+	}))
+	defer server.Close()
+
+	const Interval = 10 * time.Second
+	fakeClock := clock.NewFake(time.Now())
+	logs := fxapptest.NewLogCapture()
+	builder := fxapp.NewBuilder(fxapp.ID(ulids.MustNew()), fxapp.ReleaseID(ulids.MustNew())).
+		Invoke(func() {}).
+		SetClock(fakeClock).
+		EnableProfiling(fxapp.ProfilingOpts{PushURL: server.URL, PushInterval: Interval, PushAuthToken: "secret"}).
+		LogWriter(logs)
+
+	fxapptest.RunApp(t, builder, func(app fxapp.App, client *fxapptest.HTTPClient) {
+		waitForProfile := func() pushedProfile {
+			timeout := time.After(5 * time.Second)
+			for {
+				fakeClock.Advance(Interval)
+				select {
+				case profile := <-profiles:
+					return profile
+				case <-time.After(10 * time.Millisecond):
+				case <-timeout:
+					t.Fatal("*** timed out waiting for profile to be pushed")
+				}
+			}
+		}
+
+		profile := waitForProfile()
+		fxapptest.AssertEventLogged(t, logs, fxapp.ProfilerPushEvent, fxapptest.Field("d.outcome", "error"))
+		assert.Equal(t, "pprof", profile.query.Get("format"))
+		assert.Equal(t, "Bearer secret", profile.auth)
+		assert.Equal(t, ulid.ULID(app.ID()).String()+".cpu{a="+ulid.ULID(app.ID()).String()+
+			",r="+ulid.ULID(app.ReleaseID()).String()+
+			",i="+ulid.ULID(app.InstanceID()).String()+"}", profile.query.Get("name"))
+		// the pprof format is gzip compressed
+		require.True(t, len(profile.body) > 2)
+		assert.Equal(t, []byte{0x1f, 0x8b}, profile.body[:2])
+	})
+}
+
+func TestBuilder_EnableProfiling_PprofEndpoints(t *testing.T) {
+	t.Parallel()
+
+	var labels []string
+	builder := fxapp.NewBuilder(fxapp.ID(ulids.MustNew()), fxapp.ReleaseID(ulids.MustNew())).
+		Provide(func() fxapp.HTTPHandler {
+			return fxapp.NewHTTPHandler("/labels", func(writer http.ResponseWriter, request *http.Request) {
+				for _, key := range []string{fxapp.AppIDLabel, fxapp.AppReleaseIDLabel, fxapp.AppInstanceIDLabel} {
+					value, _ := pprof.Label(request.Context(), key)
+					labels = append(labels, value)
+				}
+			})
+		}).
+		Invoke(func() {}).
+		EnableProfiling(fxapp.ProfilingOpts{PprofEndpoints: true}).
+		SetAdminAuthenticator(fxapp.NewBearerTokenAuthenticator("secret")).
+		LogWriter(ioutil.Discard)
+
+	fxapptest.RunApp(t, builder, func(app fxapp.App, client *fxapptest.HTTPClient) {
+		get := func(path, token string) int {
+			request, err := http.NewRequest(http.MethodGet, client.URL(path), nil)
+			require.NoError(t, err)
+			if token != "" {
+				request.Header.Set("Authorization", "Bearer "+token)
+			}
+			response, err := client.Do(request)
+			require.NoError(t, err)
+			response.Body.Close()
+			return response.StatusCode
+		}
+
+		t.Run("pprof endpoints are admin endpoints", func(t *testing.T) {
+			assert.Equal(t, http.StatusUnauthorized, get(fxapp.PprofEndpointPathPrefix, ""))
+			assert.Equal(t, http.StatusOK, get(fxapp.PprofEndpointPathPrefix, "secret"))
+			assert.Equal(t, http.StatusOK, get(fxapp.PprofEndpointPathPrefix+"goroutine?debug=1", "secret"))
+			assert.Equal(t, http.StatusOK, get(fxapp.PprofEndpointPathPrefix+"cmdline", "secret"))
+		})
+
+		t.Run("requests are served with the app profiler labels", func(t *testing.T) {
+			require.Equal(t, http.StatusOK, get("labels", ""))
+			assert.Equal(t, []string{
+				ulid.ULID(app.ID()).String(),
+				ulid.ULID(app.ReleaseID()).String(),
+				ulid.ULID(app.InstanceID()).String(),
+			}, labels)
+		})
+	})
+}
+
+func TestProfiling_DisabledByDefault(t *testing.T) {
+	t.Parallel()
+
+	builder := fxapp.NewBuilder(fxapp.ID(ulids.MustNew()), fxapp.ReleaseID(ulids.MustNew())).
+		Invoke(func() {}).
+		LogWriter(ioutil.Discard)
+	fxapptest.RunApp(t, builder, func(app fxapp.App, client *fxapptest.HTTPClient) {
+		response, err := client.Get(fxapp.PprofEndpointPathPrefix)
+		require.NoError(t, err)
+		response.Body.Close()
+		assert.Equal(t, http.StatusNotFound, response.StatusCode)
+	})
+}
+
+func TestLoadProfilingOptsFromEnv(t *testing.T) {
+	t.Setenv(fxapp.ProfilerEnvconfigPrefix+"_PUSH_URL", "http://pyroscope:4040")
+	t.Setenv(fxapp.ProfilerEnvconfigPrefix+"_PUSH_INTERVAL", "15s")
+	t.Setenv(fxapp.ProfilerEnvconfigPrefix+"_PPROF_ENDPOINTS", "true")
+
+	opts, err := fxapp.LoadProfilingOptsFromEnv()
+	require.NoError(t, err)
+	assert.Equal(t, fxapp.ProfilingOpts{
+		PushURL:        "http://pyroscope:4040",
+		PushInterval:   15 * time.Second,
+		PprofEndpoints: true,
+	}, opts)
+
+	t.Run("profiling is enabled via env", func(t *testing.T) {
+		t.Setenv(fxapp.ProfilerEnvconfigPrefix+"_PUSH_URL", "")
+		builder := fxapp.NewBuilder(fxapp.ID(ulids.MustNew()), fxapp.ReleaseID(ulids.MustNew())).
+			Invoke(func() {}).
+			LogWriter(ioutil.Discard)
+		fxapptest.RunApp(t, builder, func(app fxapp.App, client *fxapptest.HTTPClient) {
+			response, err := client.Get(fxapp.PprofEndpointPathPrefix)
+			require.NoError(t, err)
+			response.Body.Close()
+			assert.Equal(t, http.StatusOK, response.StatusCode)
+		})
+	})
+}
+
+func TestProfilingOpts_Validation(t *testing.T) {
+	t.Parallel()
+
+	for _, opts := range []fxapp.ProfilingOpts{
+		{PushURL: "http://pyroscope:4040", PushInterval: -time.Second},
+		{PushURL: "pyroscope:4040"},
+		{PushURL: "/ingest"},
+	} {
+		_, err := fxapp.NewBuilder(fxapp.ID(ulids.MustNew()), fxapp.ReleaseID(ulids.MustNew())).
+			Invoke(func() {}).
+			EnableProfiling(opts).
+			DisableHTTPServer().
+			Build()
+		require.Error(t, err, "%v", opts)
+		assert.Contains(t, err.Error(), fxapp.ErrInvalidProfilingOpts.Error())
+	}
+}
@@ -0,0 +1,220 @@
+/*
+ * Copyright (c) 2019 OysterPack, Inc.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ * http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package fxapp
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"github.com/oklog/ulid"
+	"github.com/oysterpack/andiamo/pkg/eventlog"
+	"github.com/rs/zerolog"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+)
+
+// ReplayBufferEndpoint is used to construct the HTTP endpoint that returns the events in the replay buffer as newline
+// delimited JSON, oldest first - see `Builder.EnableReplayBuffer()`.
+const ReplayBufferEndpoint = "01DJ31BVKZ8307F0JV2JS0GYCM"
+
+// ReplayBufferDumpedEvent is logged when the replay buffer is dumped to a file
+//
+//	type Data struct {
+//		// one of: init_failed, start_failed, stop_failed, panic, on_demand
+//		Reason string `json:"reason"`
+//		Path   string `json:"path"`
+//		Events int    `json:"events"`
+//	}
+const ReplayBufferDumpedEvent = "01DJ31BVR82CJ920ADCVPST9C3"
+
+// replay buffer dump reasons
+const (
+	ReplayInitFailed  = "init_failed"
+	ReplayStartFailed = "start_failed"
+	ReplayStopFailed  = "stop_failed"
+	ReplayPanic       = "panic"
+	ReplayOnDemand    = "on_demand"
+)
+
+// DefaultReplayBufferSize is the default max number of events that are retained by the replay buffer
+const DefaultReplayBufferSize = 1000
+
+// ErrInvalidReplayBufferOpts indicates the replay buffer options are invalid
+var ErrInvalidReplayBufferOpts = errors.New("replay buffer options are invalid")
+
+// ReplayBufferOpts is used to configure the replay buffer
+type ReplayBufferOpts struct {
+	// Size is the max number of events that are retained - defaults to DefaultReplayBufferSize
+	Size int
+	// Dir is the directory that the events are dumped to - defaults to os.TempDir()
+	Dir string
+}
+
+func (opts ReplayBufferOpts) withDefaults() ReplayBufferOpts {
+	if opts.Size == 0 {
+		opts.Size = DefaultReplayBufferSize
+	}
+	if opts.Dir == "" {
+		opts.Dir = os.TempDir()
+	}
+	return opts
+}
+
+func (opts ReplayBufferOpts) validate() error {
+	if opts.Size < 0 {
+		return fmt.Errorf("%s : size must not be negative : %d", ErrInvalidReplayBufferOpts, opts.Size)
+	}
+	return nil
+}
+
+// ReplayBuffer retains the most recent events, at all levels, i.e., regardless of the app log level. It is used to
+// capture the debug context around failures without logging at debug level permanently.
+type ReplayBuffer interface {
+	// Events returns the buffered events, oldest first
+	Events() [][]byte
+	// Dump writes the buffered events to a file as newline delimited JSON, and returns the file path. The dump is logged
+	// via the `ReplayBufferDumpedEvent`.
+	Dump() (path string, err error)
+}
+
+// replayBuffer is a ring buffer of log events, which is used as a log writer
+type replayBuffer struct {
+	opts       ReplayBufferOpts
+	instanceID InstanceID
+	logger     *zerolog.Logger
+
+	mutex  sync.Mutex
+	events [][]byte
+	// the index of the next event to be overwritten, once the buffer is full
+	next int
+}
+
+func newReplayBuffer(opts ReplayBufferOpts, instanceID InstanceID) *replayBuffer {
+	opts = opts.withDefaults()
+	return &replayBuffer{
+		opts:       opts,
+		instanceID: instanceID,
+		events:     make([][]byte, 0, opts.Size),
+	}
+}
+
+func (b *replayBuffer) Write(p []byte) (int, error) {
+	// the log writer buffer is reused by the logger, thus the data must be copied
+	event := append([]byte(nil), bytes.TrimSpace(p)...)
+	b.mutex.Lock()
+	defer b.mutex.Unlock()
+	if len(b.events) < b.opts.Size {
+		b.events = append(b.events, event)
+		return len(p), nil
+	}
+	if b.opts.Size > 0 {
+		b.events[b.next] = event
+		b.next = (b.next + 1) % b.opts.Size
+	}
+	return len(p), nil
+}
+
+func (b *replayBuffer) Events() [][]byte {
+	b.mutex.Lock()
+	defer b.mutex.Unlock()
+	events := make([][]byte, 0, len(b.events))
+	events = append(events, b.events[b.next:]...)
+	return append(events, b.events[:b.next]...)
+}
+
+func (b *replayBuffer) writeTo(w io.Writer) error {
+	for _, event := range b.Events() {
+		if _, err := w.Write(append(event, '\n')); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (b *replayBuffer) Dump() (string, error) {
+	return b.dump(ReplayOnDemand)
+}
+
+func (b *replayBuffer) dump(reason string) (string, error) {
+	events := b.Events()
+	var buf bytes.Buffer
+	for _, event := range events {
+		buf.Write(event)
+		buf.WriteByte('\n')
+	}
+	path := filepath.Join(b.opts.Dir, fmt.Sprintf("events-%s-%d.ndjson", ulid.ULID(b.instanceID), time.Now().UnixNano()))
+	if err := ioutil.WriteFile(path, buf.Bytes(), 0600); err != nil {
+		return "", err
+	}
+	if b.logger != nil {
+		logEvent := eventlog.NewLogger(ReplayBufferDumpedEvent, b.logger, zerolog.WarnLevel)
+		logEvent(replayBufferDumped{reason: reason, path: path, events: len(events)}, "replay buffer dumped")
+	}
+	return path, nil
+}
+
+// dumpReplayBuffer is used to dump the replay buffer on failures - it is a no-op if the replay buffer is not enabled
+func dumpReplayBuffer(b *replayBuffer, reason string) {
+	if b != nil {
+		b.dump(reason)
+	}
+}
+
+type replayBufferDumped struct {
+	reason string
+	path   string
+	events int
+}
+
+func (e replayBufferDumped) MarshalZerologObject(event *zerolog.Event) {
+	event.
+		Str("reason", e.reason).
+		Str("path", e.path).
+		Int("events", e.events)
+}
+
+// levelFilterWriter only writes events at or above the min level, and events without a level. It is used to apply the
+// app log level to the log writers when the replay buffer is enabled, because the replay buffer captures all levels.
+type levelFilterWriter struct {
+	io.Writer
+	min zerolog.Level
+}
+
+func (w levelFilterWriter) WriteLevel(level zerolog.Level, p []byte) (int, error) {
+	if level < w.min {
+		return len(p), nil
+	}
+	return w.Write(p)
+}
+
+func replayBufferHTTPHandler(b *replayBuffer) func() HTTPHandler {
+	return func() HTTPHandler {
+		return NewHTTPRoute(http.MethodGet, fmt.Sprintf("/%s", ReplayBufferEndpoint), func(writer http.ResponseWriter, request *http.Request) {
+			writer.Header().Set("Content-Type", eventlog.NDJSONMediaType)
+			b.writeTo(writer)
+		}).WithDoc(OpenAPIOperation{
+			Summary:   "replay buffer events",
+			Tags:      []string{BuiltinOpenAPITag},
+			Responses: []OpenAPIResponse{{Status: http.StatusOK, MediaTypes: []string{eventlog.NDJSONMediaType}}},
+		}).AdminOnly()
+	}
+}
@@ -0,0 +1,136 @@
+/*
+ * Copyright (c) 2019 OysterPack, Inc.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ * http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package fxapp_test
+
+import (
+	"bufio"
+	"context"
+	"errors"
+	"github.com/oysterpack/andiamo/pkg/fxapp"
+	"github.com/oysterpack/andiamo/pkg/fxapptest"
+	"github.com/oysterpack/andiamo/pkg/ulids"
+	"github.com/rs/zerolog"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.uber.org/fx"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestBuilder_EnableReplayBuffer(t *testing.T) {
+	t.Parallel()
+
+	dir, err := ioutil.TempDir("", "fxapp")
+	require.NoError(t, err)
+	defer os.RemoveAll(dir)
+
+	logs := fxapptest.NewLogCapture()
+	var replay fxapp.ReplayBuffer
+	builder := fxapp.NewBuilder(fxapp.ID(ulids.MustNew()), fxapp.ReleaseID(ulids.MustNew())).
+		Invoke(func(logger *zerolog.Logger) {
+			logger.Debug().Msg("debug context")
+		}).
+		EnableReplayBuffer(fxapp.ReplayBufferOpts{Size: 5, Dir: dir}).
+		Populate(&replay).
+		LogLevel(fxapp.InfoLogLevel).
+		LogWriter(logs)
+
+	fxapptest.RunApp(t, builder, func(app fxapp.App, client *fxapptest.HTTPClient) {
+		assert.NotContains(t, logs.String(), "debug context", "the app log level is applied to the log writer")
+
+		// the app is ready before the ready event is logged
+		_, err := logs.WaitForEvent(fxapp.ReadyEvent, 5*time.Second)
+		require.NoError(t, err)
+		events := replay.Events()
+		require.Len(t, events, 5, "the buffer retains the most recent events")
+		assert.Contains(t, string(events[4]), fxapp.ReadyEvent, "events are ordered oldest first")
+
+		response, err := client.Get(fxapp.ReplayBufferEndpoint)
+		require.NoError(t, err)
+		defer response.Body.Close()
+		body, err := ioutil.ReadAll(response.Body)
+		require.NoError(t, err)
+		assert.Len(t, strings.Split(strings.TrimSpace(string(body)), "\n"), 5)
+
+		path, err := replay.Dump()
+		require.NoError(t, err)
+		assert.Equal(t, dir, filepath.Dir(path))
+		fxapptest.AssertEventLogged(t, logs, fxapp.ReplayBufferDumpedEvent,
+			fxapptest.Field("d.reason", fxapp.ReplayOnDemand),
+			fxapptest.Field("d.path", path),
+		)
+	})
+}
+
+func TestReplayBuffer_DumpedOnStartFailure(t *testing.T) {
+	t.Parallel()
+
+	dir, err := ioutil.TempDir("", "fxapp")
+	require.NoError(t, err)
+	defer os.RemoveAll(dir)
+
+	logs := fxapptest.NewLogCapture()
+	app, err := fxapp.NewBuilder(fxapp.ID(ulids.MustNew()), fxapp.ReleaseID(ulids.MustNew())).
+		Invoke(func(lc fx.Lifecycle, logger *zerolog.Logger) {
+			lc.Append(fx.Hook{
+				OnStart: func(context.Context) error {
+					logger.Debug().Msg("connecting to the database")
+					return errors.New("BOOM")
+				},
+			})
+		}).
+		EnableReplayBuffer(fxapp.ReplayBufferOpts{Dir: dir}).
+		DisableHTTPServer().
+		LogWriter(logs).
+		Build()
+	require.NoError(t, err)
+	require.Error(t, app.Run())
+
+	files, err := ioutil.ReadDir(dir)
+	require.NoError(t, err)
+	require.Len(t, files, 1)
+	f, err := os.Open(filepath.Join(dir, files[0].Name()))
+	require.NoError(t, err)
+	defer f.Close()
+	var lines []string
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		lines = append(lines, scanner.Text())
+	}
+	dump := strings.Join(lines, "\n")
+	assert.Contains(t, dump, "connecting to the database", "debug events are captured")
+	assert.Contains(t, dump, fxapp.StartFailedEvent)
+	assert.NotContains(t, logs.String(), "connecting to the database")
+	fxapptest.AssertEventLogged(t, logs, fxapp.ReplayBufferDumpedEvent, fxapptest.Field("d.reason", fxapp.ReplayStartFailed))
+}
+
+func TestReplayBufferOpts_Validation(t *testing.T) {
+	t.Parallel()
+
+	_, err := fxapp.NewBuilder(fxapp.ID(ulids.MustNew()), fxapp.ReleaseID(ulids.MustNew())).
+		Invoke(func() {}).
+		EnableReplayBuffer(fxapp.ReplayBufferOpts{Size: -1}).
+		DisableHTTPServer().
+		LogWriter(ioutil.Discard).
+		Build()
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), fxapp.ErrInvalidReplayBufferOpts.Error())
+}
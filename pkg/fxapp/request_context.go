@@ -0,0 +1,88 @@
+/*
+ * Copyright (c) 2019 OysterPack, Inc.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ * http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package fxapp
+
+import (
+	"github.com/oysterpack/andiamo/pkg/reqctx"
+	"github.com/oysterpack/andiamo/pkg/ulids"
+	"net/http"
+	"strings"
+)
+
+// MaxCorrelationIDLength is the max length for inbound correlation IDs. Longer correlation IDs are replaced.
+const MaxCorrelationIDLength = 128
+
+// RequestContextOpts is used to configure the request context middleware - see `NewRequestContextMiddleware()`
+type RequestContextOpts struct {
+	// ResolvePrincipal is optional, and is used to resolve the authenticated principal from the request, e.g., from a
+	// verified token or TLS client certificate. Blank means the request is not authenticated.
+	ResolvePrincipal func(request *http.Request) string
+	// ResolveTenant is optional. If not specified, then the tenant is extracted from the `reqctx.TenantHeader`.
+	ResolveTenant func(request *http.Request) string
+}
+
+// NewRequestContextMiddleware returns middleware that extracts the `reqctx.RequestContext` from the request, and carries
+// it via the request context:
+//   - the correlation ID is extracted from the `reqctx.CorrelationIDHeader`. If the header is not specified, or is not
+//     valid, then a new ULID is assigned. The correlation ID is returned via the response header.
+//   - the principal and tenant are resolved via the options
+//   - the deadline is extracted from the request context, i.e., the request context middleware should be applied after
+//     the deadline middleware - see `NewDeadlineMiddleware()`
+//
+// Use `eventlog.NewContextLogger()` to log events that are enriched with the request context fields.
+//
+// TODO: gRPC interceptor
+func NewRequestContextMiddleware(opts RequestContextOpts) func(http.Handler) http.Handler {
+	resolveTenant := opts.ResolveTenant
+	if resolveTenant == nil {
+		resolveTenant = func(request *http.Request) string {
+			return strings.TrimSpace(request.Header.Get(reqctx.TenantHeader))
+		}
+	}
+	return func(handler http.Handler) http.Handler {
+		return http.HandlerFunc(func(writer http.ResponseWriter, request *http.Request) {
+			rc := reqctx.RequestContext{
+				CorrelationID: request.Header.Get(reqctx.CorrelationIDHeader),
+				Tenant:        resolveTenant(request),
+			}
+			if !validCorrelationID(rc.CorrelationID) {
+				rc.CorrelationID = ulids.MustNew().String()
+			}
+			if opts.ResolvePrincipal != nil {
+				rc.Principal = opts.ResolvePrincipal(request)
+			}
+			if deadline, ok := request.Context().Deadline(); ok {
+				rc.Deadline = deadline
+			}
+			writer.Header().Set(reqctx.CorrelationIDHeader, rc.CorrelationID)
+			handler.ServeHTTP(writer, request.WithContext(reqctx.NewContext(request.Context(), rc)))
+		})
+	}
+}
+
+// correlation IDs are logged and returned via the response header, thus only printable ASCII is allowed
+func validCorrelationID(id string) bool {
+	if id == "" || len(id) > MaxCorrelationIDLength {
+		return false
+	}
+	for i := 0; i < len(id); i++ {
+		if id[i] <= ' ' || id[i] > '~' {
+			return false
+		}
+	}
+	return true
+}
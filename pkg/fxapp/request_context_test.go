@@ -0,0 +1,91 @@
+/*
+ * Copyright (c) 2019 OysterPack, Inc.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ * http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package fxapp_test
+
+import (
+	"github.com/oysterpack/andiamo/pkg/fxapp"
+	"github.com/oysterpack/andiamo/pkg/fxapptest"
+	"github.com/oysterpack/andiamo/pkg/reqctx"
+	"github.com/oysterpack/andiamo/pkg/ulids"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"io/ioutil"
+	"net/http"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestBuilder_EnableRequestContext(t *testing.T) {
+	t.Parallel()
+
+	requestContexts := make(chan reqctx.RequestContext, 1)
+	builder := fxapp.NewBuilder(fxapp.ID(ulids.MustNew()), fxapp.ReleaseID(ulids.MustNew())).
+		Provide(func() fxapp.HTTPHandler {
+			return fxapp.NewHTTPRoute(http.MethodGet, "/foo", func(writer http.ResponseWriter, request *http.Request) {
+				rc, _ := reqctx.FromContext(request.Context())
+				requestContexts <- rc
+			})
+		}).
+		Invoke(func() {}).
+		EnableDeadlinePropagation(fxapp.DeadlineOpts{DefaultBudget: time.Minute}).
+		EnableRequestContext(fxapp.RequestContextOpts{
+			ResolvePrincipal: func(request *http.Request) string {
+				return request.Header.Get("X-User")
+			},
+		}).
+		LogWriter(ioutil.Discard)
+
+	fxapptest.RunApp(t, builder, func(app fxapp.App, client *fxapptest.HTTPClient) {
+		get := func(header map[string]string) (*http.Response, reqctx.RequestContext) {
+			request, err := http.NewRequest(http.MethodGet, client.URL("foo"), nil)
+			require.NoError(t, err)
+			for k, v := range header {
+				request.Header.Set(k, v)
+			}
+			response, err := client.Do(request)
+			require.NoError(t, err)
+			response.Body.Close()
+			require.Equal(t, http.StatusOK, response.StatusCode)
+			return response, <-requestContexts
+		}
+
+		t.Run("request context is extracted", func(t *testing.T) {
+			response, rc := get(map[string]string{
+				reqctx.CorrelationIDHeader: "abc-123",
+				reqctx.TenantHeader:        "acme",
+				"X-User":                   "alice",
+			})
+			assert.Equal(t, "abc-123", rc.CorrelationID)
+			assert.Equal(t, "acme", rc.Tenant)
+			assert.Equal(t, "alice", rc.Principal)
+			assert.False(t, rc.Deadline.IsZero())
+			assert.Equal(t, "abc-123", response.Header.Get(reqctx.CorrelationIDHeader))
+		})
+
+		t.Run("correlation ID is assigned", func(t *testing.T) {
+			for _, correlationID := range []string{"", strings.Repeat("a", fxapp.MaxCorrelationIDLength+1), "a b"} {
+				response, rc := get(map[string]string{reqctx.CorrelationIDHeader: correlationID})
+				_, err := ulids.Parse(rc.CorrelationID)
+				assert.NoError(t, err)
+				assert.Equal(t, rc.CorrelationID, response.Header.Get(reqctx.CorrelationIDHeader))
+				assert.Empty(t, rc.Tenant)
+				assert.Empty(t, rc.Principal)
+			}
+		})
+	})
+}
@@ -0,0 +1,356 @@
+/*
+ * Copyright (c) 2019 OysterPack, Inc.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ * http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package fxapp
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"github.com/oysterpack/andiamo/pkg/eventlog"
+	"github.com/oysterpack/andiamo/pkg/reqctx"
+	"github.com/rs/zerolog"
+	"go.uber.org/fx"
+	"go.uber.org/multierr"
+	"net/http"
+	"reflect"
+	"sync"
+)
+
+// request scope related errors
+var (
+	ErrInvalidScopedConstructor = errors.New("scoped constructor must be a function that returns the scoped value, optionally followed by a cleanup func(), and optionally an error")
+	ErrScopedTypeConflict       = errors.New("scoped type is provided more than once")
+	ErrScopedTypeNotProvided    = errors.New("scoped type is not provided")
+	ErrScopedDependencyCycle    = errors.New("scoped constructors have a dependency cycle")
+	ErrInvalidScopeTarget       = errors.New("scope resolve target must be a non-nil pointer")
+)
+
+// RequestLogger is the app logger enriched with the request context fields, which are logged as a dictionary using "rc"
+// as the key - see `eventlog.NewContextLogger()`. It is available to scoped constructors and via `Scope.Resolve()`.
+type RequestLogger struct {
+	*zerolog.Logger
+}
+
+var (
+	contextType        = reflect.TypeOf((*context.Context)(nil)).Elem()
+	requestContextType = reflect.TypeOf(reqctx.RequestContext{})
+	requestLoggerType  = reflect.TypeOf(RequestLogger{})
+	scopeType          = reflect.TypeOf((*Scope)(nil))
+	cleanupType        = reflect.TypeOf(func() {})
+	zerologLoggerType  = reflect.TypeOf((*zerolog.Logger)(nil))
+)
+
+// Scope is a child scope of the app container, e.g., per request or per job. Scoped values are constructed lazily, i.e.,
+// on first use, by the scoped constructors that are registered via `Builder.ProvideScoped()`, and are cached for the
+// lifetime of the scope. The following values are always available within a scope:
+//   - context.Context - the scope context, which carries the scope - see `ScopeFromContext()`
+//   - reqctx.RequestContext - the zero value is provided if the context does not carry one
+//   - RequestLogger
+//   - *Scope
+//
+// Scoped constructors can also depend on app scoped types, which are resolved from the app container when the app is
+// initialized.
+//
+// Scopes are pooled, i.e., the scope must not be used after it is closed.
+type Scope struct {
+	providers *scopedProviders
+	ctx       context.Context
+
+	mutex     sync.Mutex
+	values    map[reflect.Type]reflect.Value
+	resolving map[reflect.Type]bool
+	// run in reverse order when the scope is closed
+	cleanups []func()
+}
+
+type scopeContextKey struct{}
+
+// ScopeFromContext returns the scope that is carried by the context, e.g., the request scope that is created by the app
+// HTTP server when scoped constructors are registered
+func ScopeFromContext(ctx context.Context) (*Scope, bool) {
+	scope, ok := ctx.Value(scopeContextKey{}).(*Scope)
+	return scope, ok
+}
+
+// NewScope is used to create a new scope, e.g., for background jobs. The scope must be closed when it is no longer
+// needed. NewScope is provided when scoped constructors are registered - see `Builder.ProvideScoped()`.
+type NewScope func(ctx context.Context) *Scope
+
+// Context returns the scope context
+func (s *Scope) Context() context.Context {
+	return s.ctx
+}
+
+// Resolve populates the targets, which must be pointers to the scoped types
+func (s *Scope) Resolve(targets ...interface{}) error {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	for _, target := range targets {
+		v := reflect.ValueOf(target)
+		if !v.IsValid() || v.Kind() != reflect.Ptr || v.IsNil() {
+			return fmt.Errorf("%s : %T", ErrInvalidScopeTarget, target)
+		}
+		value, err := s.resolve(v.Type().Elem())
+		if err != nil {
+			return err
+		}
+		v.Elem().Set(value)
+	}
+	return nil
+}
+
+// Invoke invokes the function with its params resolved from the scope. If the function returns an error as its last
+// result, then the error is returned.
+func (s *Scope) Invoke(f interface{}) error {
+	fn := reflect.ValueOf(f)
+	if !fn.IsValid() || fn.Kind() != reflect.Func || fn.IsNil() {
+		return fmt.Errorf("%s : %T", ErrInvalidScopedConstructor, f)
+	}
+	s.mutex.Lock()
+	args, err := s.args(fn.Type())
+	s.mutex.Unlock()
+	if err != nil {
+		return err
+	}
+	results := fn.Call(args)
+	if n := len(results); n > 0 && fn.Type().Out(n-1) == errorType && !results[n-1].IsNil() {
+		return results[n-1].Interface().(error)
+	}
+	return nil
+}
+
+// Close runs the cleanup functions that were returned by the scoped constructors in reverse order, and releases the
+// scope back to the pool.
+func (s *Scope) Close() {
+	s.mutex.Lock()
+	for i := len(s.cleanups) - 1; i >= 0; i-- {
+		s.cleanups[i]()
+	}
+	s.reset()
+	s.mutex.Unlock()
+	s.providers.pool.Put(s)
+}
+
+func (s *Scope) reset() {
+	s.ctx = nil
+	for t := range s.values {
+		delete(s.values, t)
+	}
+	for i := range s.cleanups {
+		s.cleanups[i] = nil
+	}
+	s.cleanups = s.cleanups[:0]
+}
+
+func (s *Scope) args(fnType reflect.Type) ([]reflect.Value, error) {
+	args := make([]reflect.Value, fnType.NumIn())
+	for i := range args {
+		arg, err := s.resolve(fnType.In(i))
+		if err != nil {
+			return nil, err
+		}
+		args[i] = arg
+	}
+	return args, nil
+}
+
+// resolve must be called while holding the scope mutex
+func (s *Scope) resolve(t reflect.Type) (reflect.Value, error) {
+	if value, ok := s.values[t]; ok {
+		return value, nil
+	}
+	switch t {
+	case contextType:
+		return reflect.ValueOf(&s.ctx).Elem(), nil
+	case scopeType:
+		return reflect.ValueOf(s), nil
+	case requestContextType:
+		rc, _ := reqctx.FromContext(s.ctx)
+		return reflect.ValueOf(rc), nil
+	case requestLoggerType:
+		value := reflect.ValueOf(s.providers.requestLogger(s.ctx))
+		s.values[t] = value
+		return value, nil
+	}
+
+	constructor, ok := s.providers.constructors[t]
+	if !ok {
+		if value, ok := s.providers.appValues[t]; ok {
+			return value, nil
+		}
+		return reflect.Value{}, fmt.Errorf("%s : %s", ErrScopedTypeNotProvided, t)
+	}
+	if s.resolving[t] {
+		return reflect.Value{}, fmt.Errorf("%s : %s", ErrScopedDependencyCycle, t)
+	}
+	s.resolving[t] = true
+	defer delete(s.resolving, t)
+
+	args, err := s.args(constructor.Type())
+	if err != nil {
+		return reflect.Value{}, err
+	}
+	results := constructor.Call(args)
+	if last := results[len(results)-1]; last.Type() == errorType {
+		if !last.IsNil() {
+			return reflect.Value{}, multierr.Append(fmt.Errorf("scoped constructor failed : %s", t), last.Interface().(error))
+		}
+		results = results[:len(results)-1]
+	}
+	if len(results) == 2 && !results[1].IsNil() {
+		s.cleanups = append(s.cleanups, results[1].Interface().(func()))
+	}
+	s.values[t] = results[0]
+	return results[0], nil
+}
+
+// scopedProviders is shared by all scopes, i.e., it is read only once the app is initialized
+type scopedProviders struct {
+	// keyed by the scoped type
+	constructors map[reflect.Type]reflect.Value
+	// the app scoped types that the scoped constructors depend on - populated when the app is initialized
+	appValues map[reflect.Type]reflect.Value
+	logger    *zerolog.Logger
+	pool      sync.Pool
+}
+
+func isBuiltinScopedType(t reflect.Type) bool {
+	return t == contextType || t == requestContextType || t == requestLoggerType || t == scopeType
+}
+
+func validScopedConstructor(constructor reflect.Value) bool {
+	if !constructor.IsValid() || constructor.Kind() != reflect.Func || constructor.IsNil() {
+		return false
+	}
+	t := constructor.Type()
+	if t.IsVariadic() {
+		return false
+	}
+	switch t.NumOut() {
+	case 1:
+		return t.Out(0) != errorType
+	case 2:
+		return t.Out(0) != errorType && (t.Out(1) == errorType || t.Out(1) == cleanupType)
+	case 3:
+		return t.Out(0) != errorType && t.Out(1) == cleanupType && t.Out(2) == errorType
+	default:
+		return false
+	}
+}
+
+func validateScopedConstructors(constructors []interface{}) error {
+	var err error
+	provided := make(map[reflect.Type]bool)
+	for _, constructor := range constructors {
+		c := reflect.ValueOf(constructor)
+		if !validScopedConstructor(c) {
+			err = multierr.Append(err, fmt.Errorf("%s : %T", ErrInvalidScopedConstructor, constructor))
+			continue
+		}
+		t := c.Type().Out(0)
+		if provided[t] || isBuiltinScopedType(t) {
+			err = multierr.Append(err, fmt.Errorf("%s : %s", ErrScopedTypeConflict, t))
+		}
+		provided[t] = true
+	}
+	return err
+}
+
+// the constructors are expected to be validated
+func newScopedProviders(constructors []interface{}) *scopedProviders {
+	providers := &scopedProviders{
+		constructors: make(map[reflect.Type]reflect.Value, len(constructors)),
+		appValues:    make(map[reflect.Type]reflect.Value),
+	}
+	for _, constructor := range constructors {
+		c := reflect.ValueOf(constructor)
+		providers.constructors[c.Type().Out(0)] = c
+	}
+	providers.pool.New = func() interface{} {
+		return &Scope{
+			providers: providers,
+			values:    make(map[reflect.Type]reflect.Value),
+			resolving: make(map[reflect.Type]bool),
+		}
+	}
+	return providers
+}
+
+// appTypes returns the app scoped types that the scoped constructors depend on. The app logger is always required
+// because it is used to construct the RequestLogger.
+func (p *scopedProviders) appTypes() []reflect.Type {
+	types := []reflect.Type{zerologLoggerType}
+	seen := map[reflect.Type]bool{zerologLoggerType: true}
+	for _, constructor := range p.constructors {
+		t := constructor.Type()
+		for i := 0; i < t.NumIn(); i++ {
+			in := t.In(i)
+			if _, ok := p.constructors[in]; ok || seen[in] || isBuiltinScopedType(in) {
+				continue
+			}
+			seen[in] = true
+			types = append(types, in)
+		}
+	}
+	return types
+}
+
+// populateAppValues returns an fx.Invoke function that resolves the app scoped types that the scoped constructors
+// depend on from the app container
+func (p *scopedProviders) populateAppValues() interface{} {
+	types := p.appTypes()
+	fnType := reflect.FuncOf(types, nil, false)
+	return reflect.MakeFunc(fnType, func(args []reflect.Value) []reflect.Value {
+		for i, arg := range args {
+			p.appValues[types[i]] = arg
+		}
+		p.logger = args[0].Interface().(*zerolog.Logger)
+		return nil
+	}).Interface()
+}
+
+func (p *scopedProviders) newScope(ctx context.Context) *Scope {
+	scope := p.pool.Get().(*Scope)
+	scope.ctx = context.WithValue(ctx, scopeContextKey{}, scope)
+	return scope
+}
+
+func (p *scopedProviders) requestLogger(ctx context.Context) RequestLogger {
+	rc, ok := reqctx.FromContext(ctx)
+	if !ok {
+		return RequestLogger{p.logger}
+	}
+	logger := p.logger.With().Object(eventlog.RequestContext, rc).Logger()
+	return RequestLogger{&logger}
+}
+
+// middleware creates a new scope per request, which is carried by the request context, and closes the scope after the
+// request is handled
+func (p *scopedProviders) middleware(handler http.Handler) http.Handler {
+	return http.HandlerFunc(func(writer http.ResponseWriter, request *http.Request) {
+		scope := p.newScope(request.Context())
+		defer scope.Close()
+		handler.ServeHTTP(writer, request.WithContext(scope.Context()))
+	})
+}
+
+func (p *scopedProviders) options() fx.Option {
+	return fx.Options(
+		fx.Provide(func() NewScope { return p.newScope }),
+		fx.Invoke(p.populateAppValues()),
+	)
+}
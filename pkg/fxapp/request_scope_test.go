@@ -0,0 +1,187 @@
+/*
+ * Copyright (c) 2019 OysterPack, Inc.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ * http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package fxapp_test
+
+import (
+	"context"
+	"errors"
+	"github.com/oysterpack/andiamo/pkg/eventlog"
+	"github.com/oysterpack/andiamo/pkg/fxapp"
+	"github.com/oysterpack/andiamo/pkg/fxapptest"
+	"github.com/oysterpack/andiamo/pkg/reqctx"
+	"github.com/oysterpack/andiamo/pkg/ulids"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"net/http"
+	"sync/atomic"
+	"testing"
+)
+
+// app scoped
+type unitOfWorkCounter struct {
+	opened, closed int32
+}
+
+// request scoped
+type unitOfWork struct {
+	rc reqctx.RequestContext
+}
+
+type orderService struct {
+	uow    *unitOfWork
+	logger fxapp.RequestLogger
+}
+
+func TestBuilder_ProvideScoped(t *testing.T) {
+	t.Parallel()
+
+	const OrderEvent = "01DJ5BGX3ZTY257ZANBMZ3WEAM"
+	counter := &unitOfWorkCounter{}
+	logs := fxapptest.NewLogCapture()
+	var newScope fxapp.NewScope
+	builder := fxapp.NewBuilder(fxapp.ID(ulids.MustNew()), fxapp.ReleaseID(ulids.MustNew())).
+		Provide(
+			func() *unitOfWorkCounter { return counter },
+			func() fxapp.HTTPHandler {
+				return fxapp.NewHTTPRoute(http.MethodPost, "/orders", func(writer http.ResponseWriter, request *http.Request) {
+					scope, ok := fxapp.ScopeFromContext(request.Context())
+					if !ok {
+						http.Error(writer, "request scope is not available", http.StatusInternalServerError)
+						return
+					}
+					err := scope.Invoke(func(service *orderService, uow *unitOfWork) error {
+						if service.uow != uow {
+							return errors.New("scoped values should be cached per scope")
+						}
+						eventlog.NewLogger(OrderEvent, service.logger.Logger, 1)(nil, "order placed")
+						return nil
+					})
+					if err != nil {
+						http.Error(writer, err.Error(), http.StatusInternalServerError)
+					}
+				})
+			},
+		).
+		ProvideScoped(
+			func(rc reqctx.RequestContext, counter *unitOfWorkCounter) (*unitOfWork, func(), error) {
+				atomic.AddInt32(&counter.opened, 1)
+				return &unitOfWork{rc}, func() { atomic.AddInt32(&counter.closed, 1) }, nil
+			},
+			func(uow *unitOfWork, logger fxapp.RequestLogger) *orderService {
+				return &orderService{uow, logger}
+			},
+		).
+		Invoke(func() {}).
+		Populate(&newScope).
+		EnableRequestContext(fxapp.RequestContextOpts{}).
+		LogWriter(logs)
+
+	fxapptest.RunApp(t, builder, func(app fxapp.App, client *fxapptest.HTTPClient) {
+		t.Run("request scope", func(t *testing.T) {
+			for i := 0; i < 3; i++ {
+				request, err := http.NewRequest(http.MethodPost, client.URL("orders"), nil)
+				require.NoError(t, err)
+				request.Header.Set(reqctx.CorrelationIDHeader, "order-123")
+				response, err := client.Do(request)
+				require.NoError(t, err)
+				response.Body.Close()
+				require.Equal(t, http.StatusOK, response.StatusCode)
+			}
+			// scoped values are constructed once per request, and cleaned up when the request scope is closed
+			assert.Equal(t, int32(3), atomic.LoadInt32(&counter.opened))
+			assert.Equal(t, int32(3), atomic.LoadInt32(&counter.closed))
+			// the request logger is enriched with the request context
+			events := logs.FindEvents(OrderEvent, fxapptest.Field("rc.cid", "order-123"))
+			assert.Len(t, events, 3)
+		})
+
+		t.Run("job scope", func(t *testing.T) {
+			ctx := reqctx.NewContext(context.Background(), reqctx.RequestContext{CorrelationID: "job-1"})
+			scope := newScope(ctx)
+			var uow1, uow2 *unitOfWork
+			require.NoError(t, scope.Resolve(&uow1))
+			require.NoError(t, scope.Resolve(&uow2))
+			assert.True(t, uow1 == uow2)
+			assert.Equal(t, "job-1", uow1.rc.CorrelationID)
+			scoped, ok := fxapp.ScopeFromContext(scope.Context())
+			assert.True(t, ok)
+			assert.True(t, scoped == scope)
+
+			var notProvided *http.Client
+			err := scope.Resolve(&notProvided)
+			require.Error(t, err)
+			assert.Contains(t, err.Error(), fxapp.ErrScopedTypeNotProvided.Error())
+			assert.Contains(t, scope.Resolve(uow1).Error(), fxapp.ErrScopedTypeNotProvided.Error())
+			assert.Contains(t, scope.Resolve(nil).Error(), fxapp.ErrInvalidScopeTarget.Error())
+
+			closed := atomic.LoadInt32(&counter.closed)
+			scope.Close()
+			assert.Equal(t, closed+1, atomic.LoadInt32(&counter.closed))
+		})
+	})
+}
+
+type scopedA struct{}
+type scopedB struct{}
+
+func TestScope_DependencyCycle(t *testing.T) {
+	t.Parallel()
+
+	var newScope fxapp.NewScope
+	_, err := fxapp.NewBuilder(fxapp.ID(ulids.MustNew()), fxapp.ReleaseID(ulids.MustNew())).
+		ProvideScoped(
+			func(*scopedB) *scopedA { return &scopedA{} },
+			func(*scopedA) *scopedB { return &scopedB{} },
+		).
+		Invoke(func() {}).
+		Populate(&newScope).
+		DisableHTTPServer().
+		Build()
+	require.NoError(t, err)
+
+	scope := newScope(context.Background())
+	defer scope.Close()
+	var a *scopedA
+	err = scope.Resolve(&a)
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), fxapp.ErrScopedDependencyCycle.Error())
+}
+
+func TestBuilder_ProvideScoped_Validation(t *testing.T) {
+	t.Parallel()
+
+	for _, test := range []struct {
+		constructors []interface{}
+		err          error
+	}{
+		{[]interface{}{nil}, fxapp.ErrInvalidScopedConstructor},
+		{[]interface{}{"not a func"}, fxapp.ErrInvalidScopedConstructor},
+		{[]interface{}{func() {}}, fxapp.ErrInvalidScopedConstructor},
+		{[]interface{}{func() error { return nil }}, fxapp.ErrInvalidScopedConstructor},
+		{[]interface{}{func() (*scopedA, error, func()) { return nil, nil, nil }}, fxapp.ErrInvalidScopedConstructor},
+		{[]interface{}{func() *scopedA { return nil }, func() (*scopedA, error) { return nil, nil }}, fxapp.ErrScopedTypeConflict},
+		{[]interface{}{func() context.Context { return nil }}, fxapp.ErrScopedTypeConflict},
+	} {
+		_, err := fxapp.NewBuilder(fxapp.ID(ulids.MustNew()), fxapp.ReleaseID(ulids.MustNew())).
+			ProvideScoped(test.constructors...).
+			Invoke(func() {}).
+			DisableHTTPServer().
+			Build()
+		require.Error(t, err)
+		assert.Contains(t, err.Error(), test.err.Error())
+	}
+}
@@ -0,0 +1,359 @@
+/*
+ * Copyright (c) 2019 OysterPack, Inc.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ * http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package fxapp
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"github.com/oysterpack/andiamo/pkg/clock"
+	"github.com/oysterpack/andiamo/pkg/eventlog"
+	"github.com/oysterpack/andiamo/pkg/fx/health"
+	"github.com/oysterpack/andiamo/pkg/ulids"
+	"github.com/rs/zerolog"
+	"go.uber.org/fx"
+	"go.uber.org/multierr"
+	"io"
+	"io/ioutil"
+	"net"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync/atomic"
+	"time"
+)
+
+// DependencyHealthCheckTag is used to tag the required dependency health checks - see `Dependency`
+const DependencyHealthCheckTag = "01DJ4V1J408MN8ZCPCER54Z1XM"
+
+// DependenciesVerifiedEvent is logged when all of the required dependencies have been verified on start up, i.e., when
+// the dependencies stop holding the app readiness.
+//
+//	type Data struct {
+//		// the dependency health check IDs
+//		Dependencies []string `json:"dependencies"`
+//		// msec - how long it took to verify the dependencies after the app was started
+//		Duration     uint     `json:"duration"`
+//	}
+const DependenciesVerifiedEvent = "01DJ4V1J89EW9ET9NHQHTEWCRK"
+
+// ErrInvalidDependency indicates the required dependency is misconfigured
+var ErrInvalidDependency = errors.New("invalid required dependency")
+
+// DependencyPolicy specifies how the app reacts when a required dependency becomes unavailable after it was verified
+type DependencyPolicy uint8
+
+// DependencyPolicy enum
+const (
+	// RequiredForReadiness means the app is taken out of rotation while the dependency is unavailable, i.e., the
+	// readiness probe fails - see `ReadinessHealthCheckTag`
+	RequiredForReadiness DependencyPolicy = iota
+	// RequiredForLiveness means the app is restarted when the dependency is unavailable, i.e., the liveness probe fails
+	RequiredForLiveness
+)
+
+func (p DependencyPolicy) String() string {
+	switch p {
+	case RequiredForReadiness:
+		return "readiness"
+	case RequiredForLiveness:
+		return "liveness"
+	default:
+		return fmt.Sprintf("DependencyPolicy(%d)", p)
+	}
+}
+
+// Dependency declares an external dependency that the app requires in order to function. Each dependency is registered
+// as a health check, which verifies exactly 1 of the following:
+//   - URL - an HTTP GET request returns a 2xx or 3xx status
+//   - TCPAddr - a TCP connection can be established, e.g., to a database
+//   - HealthCheckTag - none of the health checks that are registered with the tag are Red, i.e., the dependency status
+//     is rolled up from the health checks that are registered by the app components
+//
+// The app is not ready until each dependency has been verified, i.e., has reported a Green status. Dependency failures
+// on start up do not fail the app start up. Before a dependency is verified, it reports `Yellow` instead of `Red`, i.e.,
+// an app that is waiting on its dependencies is not restarted. Once verified, dependency failures are reported as `Red`,
+// which is handled according to the dependency's `Policy`.
+type Dependency struct {
+	// Check is registered with the DependencyHealthCheckTag added to its tags, plus the ReadinessHealthCheckTag if the
+	// dependency is required for readiness
+	Check health.Check
+	// RunInterval and Timeout are optional - if zero, then the health check defaults are used
+	RunInterval time.Duration
+	Timeout     time.Duration
+
+	URL            string
+	TCPAddr        string
+	HealthCheckTag string
+
+	Policy DependencyPolicy
+}
+
+func (d Dependency) withDefaults() Dependency {
+	d.Check.Tags = append(append([]string(nil), d.Check.Tags...), DependencyHealthCheckTag)
+	if d.Policy == RequiredForReadiness {
+		d.Check.Tags = append(d.Check.Tags, ReadinessHealthCheckTag)
+	}
+	if strings.TrimSpace(d.Check.Description) == "" {
+		d.Check.Description = fmt.Sprintf("required dependency: %s", d.target())
+	}
+	return d
+}
+
+func (d Dependency) target() string {
+	switch {
+	case d.URL != "":
+		return d.URL
+	case d.TCPAddr != "":
+		return fmt.Sprintf("tcp://%s", d.TCPAddr)
+	default:
+		return fmt.Sprintf("health check tag: %s", d.HealthCheckTag)
+	}
+}
+
+func (d Dependency) validate() error {
+	var err error
+	if _, e := ulids.Parse(d.Check.ID); e != nil {
+		err = multierr.Append(err, fmt.Errorf("%s : health check ID must be a ULID : %q", ErrInvalidDependency, d.Check.ID))
+	}
+	targets := 0
+	for _, target := range []string{d.URL, d.TCPAddr, d.HealthCheckTag} {
+		if strings.TrimSpace(target) != "" {
+			targets++
+		}
+	}
+	if targets != 1 {
+		err = multierr.Append(err, fmt.Errorf("%s : exactly 1 of URL, TCPAddr, or HealthCheckTag must be specified : %s", ErrInvalidDependency, d.Check.ID))
+	}
+	if d.URL != "" {
+		if u, e := url.Parse(d.URL); e != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+			err = multierr.Append(err, fmt.Errorf("%s : URL must be an absolute HTTP(S) URL : %s : %q", ErrInvalidDependency, d.Check.ID, d.URL))
+		}
+	}
+	if d.TCPAddr != "" {
+		if _, _, e := net.SplitHostPort(d.TCPAddr); e != nil {
+			err = multierr.Append(err, fmt.Errorf("%s : TCPAddr must be a host:port address : %s : %v", ErrInvalidDependency, d.Check.ID, e))
+		}
+	}
+	if d.Policy > RequiredForLiveness {
+		err = multierr.Append(err, fmt.Errorf("%s : unknown policy : %s : %s", ErrInvalidDependency, d.Check.ID, d.Policy))
+	}
+	if d.RunInterval < 0 || d.Timeout < 0 {
+		err = multierr.Append(err, fmt.Errorf("%s : RunInterval and Timeout must not be negative : %s", ErrInvalidDependency, d.Check.ID))
+	}
+	return err
+}
+
+// dependencyChecker verifies the dependency. Failures are reported as Yellow until the dependency has been verified.
+type dependencyChecker struct {
+	Dependency
+	check    func(ctx context.Context) (health.Status, error)
+	verified uint32
+}
+
+func (c *dependencyChecker) checker(ctx context.Context) (health.Status, error) {
+	status, err := c.check(ctx)
+	switch {
+	case status == health.Green:
+		atomic.StoreUint32(&c.verified, 1)
+	case status == health.Red && atomic.LoadUint32(&c.verified) == 0:
+		return health.Yellow, fmt.Errorf("dependency has not yet been verified : %v", err)
+	}
+	return status, err
+}
+
+func checkURL(client *http.Client, target string) func(ctx context.Context) (health.Status, error) {
+	return func(ctx context.Context) (health.Status, error) {
+		request, err := http.NewRequest(http.MethodGet, target, nil)
+		if err != nil {
+			return health.Red, err
+		}
+		response, err := client.Do(request.WithContext(ctx))
+		if err != nil {
+			return health.Red, err
+		}
+		io.Copy(ioutil.Discard, response.Body)
+		response.Body.Close()
+		if response.StatusCode >= http.StatusBadRequest {
+			return health.Red, fmt.Errorf("GET %s : HTTP %d", target, response.StatusCode)
+		}
+		return health.Green, nil
+	}
+}
+
+func checkTCPAddr(addr string) func(ctx context.Context) (health.Status, error) {
+	return func(ctx context.Context) (health.Status, error) {
+		var dialer net.Dialer
+		conn, err := dialer.DialContext(ctx, "tcp", addr)
+		if err != nil {
+			return health.Red, err
+		}
+		conn.Close()
+		return health.Green, nil
+	}
+}
+
+// checkHealthCheckTag rolls up the latest results of the health checks that are registered with the tag, i.e., the worst
+// status is reported. Health checks that have not yet run are reported as Yellow.
+func checkHealthCheckTag(id, tag string, registeredChecks health.RegisteredChecks, checkResults health.CheckResults) func(ctx context.Context) (health.Status, error) {
+	return func(ctx context.Context) (health.Status, error) {
+		tagged := make(map[string]bool)
+		for _, check := range <-registeredChecks(health.Query{}) {
+			if check.ID != id && hasHealthCheckTag(check.Check, tag) {
+				tagged[check.ID] = false
+			}
+		}
+		if len(tagged) == 0 {
+			return health.Red, fmt.Errorf("no health checks are registered with tag : %s", tag)
+		}
+
+		status := health.Green
+		var err error
+		for _, result := range <-checkResults(func(result health.Result) bool {
+			_, ok := tagged[result.ID]
+			return ok
+		}, health.Query{}) {
+			tagged[result.ID] = true
+			if result.Status > status {
+				status = result.Status
+			}
+			if result.Status != health.Green {
+				err = multierr.Append(err, fmt.Errorf("[%s] %v", result.ID, result.Err))
+			}
+		}
+		for checkID, ran := range tagged {
+			if !ran {
+				if status < health.Yellow {
+					status = health.Yellow
+				}
+				err = multierr.Append(err, fmt.Errorf("[%s] health check has not yet run", checkID))
+			}
+		}
+		return status, err
+	}
+}
+
+type dependenciesVerified struct {
+	dependencies []string
+	duration     time.Duration
+}
+
+func (e dependenciesVerified) MarshalZerologObject(event *zerolog.Event) {
+	event.Strs("dependencies", e.dependencies).Dur("duration", e.duration)
+}
+
+type requiredDependenciesParams struct {
+	fx.In
+
+	Lifecycle        fx.Lifecycle
+	Register         health.Register
+	RegisteredChecks health.RegisteredChecks
+	CheckResults     health.CheckResults
+	Subscribe        health.SubscribeForCheckResults
+	Readiness        ReadinessWaitGroup
+	Clock            clock.Clock
+	Logger           *zerolog.Logger
+}
+
+// registers the dependency health checks, and holds the app readiness until all of the dependencies have been verified
+func registerRequiredDependencies(dependencies []Dependency) func(params requiredDependenciesParams) error {
+	return func(params requiredDependenciesParams) error {
+		var err error
+		client := &http.Client{}
+		dependencyIDs := make(map[string]bool, len(dependencies))
+		ids := make([]string, 0, len(dependencies))
+		for _, dependency := range dependencies {
+			dependency = dependency.withDefaults()
+			checker := &dependencyChecker{Dependency: dependency}
+			switch {
+			case dependency.URL != "":
+				checker.check = checkURL(client, dependency.URL)
+			case dependency.TCPAddr != "":
+				checker.check = checkTCPAddr(dependency.TCPAddr)
+			default:
+				checker.check = checkHealthCheckTag(dependency.Check.ID, dependency.HealthCheckTag, params.RegisteredChecks, params.CheckResults)
+			}
+			opts := health.CheckerOpts{Timeout: dependency.Timeout, RunInterval: dependency.RunInterval}
+			err = multierr.Append(err, params.Register(dependency.Check, opts, checker.checker))
+			dependencyIDs[dependency.Check.ID] = true
+			ids = append(ids, dependency.Check.ID)
+		}
+		if err != nil {
+			return err
+		}
+
+		params.Readiness.Inc()
+		done := make(chan struct{})
+		logVerified := eventlog.NewLogger(DependenciesVerifiedEvent, params.Logger, zerolog.InfoLevel)
+		params.Lifecycle.Append(fx.Hook{
+			OnStart: func(context.Context) error {
+				start := params.Clock.Now()
+				isDependency := func(result health.Result) bool { return dependencyIDs[result.ID] }
+				// subscribe before checking the latest results in order to not miss any results
+				subscription := params.Subscribe(isDependency)
+				latestResults := params.CheckResults(isDependency, health.Query{})
+				go func() {
+					defer subscription.Close()
+					if !waitForDependencies(dependencyIDs, <-latestResults, subscription.Chan(), done) {
+						return
+					}
+					logVerified(dependenciesVerified{ids, params.Clock.Since(start)}, "required dependencies are verified")
+					params.Readiness.Done()
+				}()
+				return nil
+			},
+			OnStop: func(context.Context) error {
+				close(done)
+				return nil
+			},
+		})
+		return nil
+	}
+}
+
+// waitForDependencies waits until each dependency has reported a Green result. False is returned if the app is stopped
+// or the health service is shutdown before the dependencies are verified.
+func waitForDependencies(dependencyIDs map[string]bool, latestResults []health.Result, results <-chan health.Result, done <-chan struct{}) bool {
+	pending := make(map[string]bool, len(dependencyIDs))
+	for id := range dependencyIDs {
+		pending[id] = true
+	}
+	verified := func(result health.Result) bool {
+		if result.Status == health.Green {
+			delete(pending, result.ID)
+		}
+		return len(pending) == 0
+	}
+	for _, result := range latestResults {
+		if verified(result) {
+			return true
+		}
+	}
+	for {
+		select {
+		case <-done:
+			return false
+		case result, ok := <-results:
+			if !ok {
+				return false
+			}
+			if verified(result) {
+				return true
+			}
+		}
+	}
+}
@@ -0,0 +1,199 @@
+/*
+ * Copyright (c) 2019 OysterPack, Inc.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ * http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package fxapp_test
+
+import (
+	"context"
+	"github.com/oysterpack/andiamo/pkg/fx/health"
+	"github.com/oysterpack/andiamo/pkg/fxapp"
+	"github.com/oysterpack/andiamo/pkg/fxapptest"
+	"github.com/oysterpack/andiamo/pkg/ulids"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestBuilder_RequireDependencies(t *testing.T) {
+	t.Parallel()
+
+	const (
+		ServiceDependencyID  = "01DJ5397M0AJC5KCRV82ZMDZR4"
+		DatabaseDependencyID = "01DJ5397R977DRP006M8KX9F5S"
+		CacheDependencyID    = "01DJ5397WJ0X4KXJ7R4304TP5E"
+		CacheHealthCheckID   = "01DJ53980VR6AMCAD9SR3ZR4Z9"
+		CacheHealthCheckTag  = "01DJ539854HB9Y2S1HE7P73VK4"
+	)
+
+	// the service is unavailable until the test makes it available
+	var serviceStatus int32 = http.StatusServiceUnavailable
+	service := httptest.NewServer(http.HandlerFunc(func(writer http.ResponseWriter, request *http.Request) {
+		writer.WriteHeader(int(atomic.LoadInt32(&serviceStatus)))
+	}))
+	defer service.Close()
+	database, err := net.Listen("tcp", "127.0.0.1:0")
+	require.NoError(t, err)
+	defer database.Close()
+
+	logs := fxapptest.NewLogCapture()
+	var (
+		runCheckNow   health.RunCheckNow
+		livenessProbe fxapp.LivenessProbe
+		gatherer      prometheus.Gatherer
+	)
+	app, err := fxapp.NewBuilder(fxapp.ID(ulids.MustNew()), fxapp.ReleaseID(ulids.MustNew())).
+		Invoke(func(register health.Register) error {
+			return register(health.Check{
+				ID:          CacheHealthCheckID,
+				Description: "cache",
+				RedImpact:   "cache is unavailable",
+				Tags:        []string{CacheHealthCheckTag},
+			}, health.CheckerOpts{}, func(ctx context.Context) (health.Status, error) {
+				return health.Green, nil
+			})
+		}).
+		RequireDependencies(
+			fxapp.Dependency{
+				Check: health.Check{ID: ServiceDependencyID, RedImpact: "requests cannot be serviced"},
+				URL:   service.URL,
+			},
+			fxapp.Dependency{
+				Check:   health.Check{ID: DatabaseDependencyID, RedImpact: "database is unavailable"},
+				TCPAddr: database.Addr().String(),
+				Policy:  fxapp.RequiredForLiveness,
+			},
+			fxapp.Dependency{
+				Check:          health.Check{ID: CacheDependencyID, RedImpact: "cache is unavailable"},
+				HealthCheckTag: CacheHealthCheckTag,
+			},
+		).
+		Populate(&runCheckNow, &livenessProbe, &gatherer).
+		LogWriter(logs).
+		DisableHTTPServer().
+		Build()
+	require.NoError(t, err)
+
+	go app.Run()
+	defer func() {
+		app.Shutdown()
+		<-app.Done()
+	}()
+	<-app.Started()
+
+	runChecks := func(ids ...string) map[string]health.Result {
+		results := make(map[string]health.Result)
+		for _, id := range ids {
+			result, err := runCheckNow(id)
+			require.NoError(t, err)
+			results[id] = result
+		}
+		return results
+	}
+	appReadyGauge := func() float64 {
+		metrics, err := gatherer.Gather()
+		require.NoError(t, err)
+		for _, mf := range metrics {
+			if mf.GetName() == fxapp.AppReadyMetricID {
+				return mf.Metric[0].Gauge.GetValue()
+			}
+		}
+		return -1
+	}
+
+	t.Run("unverified dependencies hold the app readiness", func(t *testing.T) {
+		results := runChecks(CacheHealthCheckID, ServiceDependencyID, DatabaseDependencyID, CacheDependencyID)
+		assert.Equal(t, health.Yellow, results[ServiceDependencyID].Status, "dependency failures are Yellow until verified")
+		assert.Equal(t, health.Green, results[DatabaseDependencyID].Status)
+		assert.Equal(t, health.Green, results[CacheDependencyID].Status, "dependency is rolled up from the tagged health checks")
+		select {
+		case <-app.Ready():
+			t.Fatal("*** app should not be ready until the dependencies are verified")
+		case <-time.After(100 * time.Millisecond):
+		}
+		// the app is not restarted while it is waiting on its dependencies
+		assert.NoError(t, livenessProbe())
+	})
+
+	t.Run("verified dependencies open the app readiness", func(t *testing.T) {
+		atomic.StoreInt32(&serviceStatus, http.StatusOK)
+		runChecks(ServiceDependencyID)
+		select {
+		case <-app.Ready():
+		case <-time.After(5 * time.Second):
+			t.Fatal("*** app should be ready once the dependencies are verified")
+		}
+		_, err := logs.WaitForEvent(fxapp.DependenciesVerifiedEvent, 5*time.Second)
+		assert.NoError(t, err)
+		assert.Equal(t, 1.0, appReadyGauge())
+	})
+
+	t.Run("readiness dependency failure", func(t *testing.T) {
+		atomic.StoreInt32(&serviceStatus, http.StatusInternalServerError)
+		results := runChecks(ServiceDependencyID)
+		assert.Equal(t, health.Red, results[ServiceDependencyID].Status)
+		assert.Equal(t, 0.0, appReadyGauge())
+		assert.NoError(t, livenessProbe())
+
+		atomic.StoreInt32(&serviceStatus, http.StatusOK)
+		runChecks(ServiceDependencyID)
+		assert.Equal(t, 1.0, appReadyGauge())
+	})
+
+	t.Run("liveness dependency failure", func(t *testing.T) {
+		database.Close()
+		results := runChecks(DatabaseDependencyID)
+		assert.Equal(t, health.Red, results[DatabaseDependencyID].Status)
+		assert.Error(t, livenessProbe())
+		assert.Equal(t, 1.0, appReadyGauge())
+	})
+}
+
+func TestDependency_Validation(t *testing.T) {
+	t.Parallel()
+
+	for _, dependency := range []fxapp.Dependency{
+		{Check: health.Check{ID: "invalid"}, URL: "http://localhost"},
+		{Check: health.Check{ID: ulids.MustNew().String()}},
+		{Check: health.Check{ID: ulids.MustNew().String()}, URL: "http://localhost", TCPAddr: "localhost:5432"},
+		{Check: health.Check{ID: ulids.MustNew().String()}, URL: "localhost"},
+		{Check: health.Check{ID: ulids.MustNew().String()}, TCPAddr: "localhost"},
+		{Check: health.Check{ID: ulids.MustNew().String()}, TCPAddr: "localhost:5432", Policy: fxapp.DependencyPolicy(99)},
+		{Check: health.Check{ID: ulids.MustNew().String()}, TCPAddr: "localhost:5432", Timeout: -time.Second},
+	} {
+		_, err := fxapp.NewBuilder(fxapp.ID(ulids.MustNew()), fxapp.ReleaseID(ulids.MustNew())).
+			Invoke(func() {}).
+			RequireDependencies(dependency).
+			DisableHTTPServer().
+			Build()
+		require.Error(t, err, "%#v", dependency)
+		assert.Contains(t, err.Error(), fxapp.ErrInvalidDependency.Error())
+	}
+
+	dependency := fxapp.Dependency{Check: health.Check{ID: ulids.MustNew().String()}, TCPAddr: "localhost:5432"}
+	_, err := fxapp.NewBuilder(fxapp.ID(ulids.MustNew()), fxapp.ReleaseID(ulids.MustNew())).
+		Invoke(func() {}).
+		RequireDependencies(dependency, dependency).
+		DisableHTTPServer().
+		Build()
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), "duplicate dependency")
+}
@@ -0,0 +1,181 @@
+/*
+ * Copyright (c) 2019 OysterPack, Inc.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ * http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package fxapp
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"github.com/oysterpack/andiamo/pkg/fx/health"
+	"go.uber.org/multierr"
+)
+
+// resource pressure health check IDs
+const (
+	FilesystemUsageHealthCheckID     = "01DHWB4CKZ3G5KD8Y5HAV67VWN"
+	MemoryUsageHealthCheckID         = "01DHWB4CR82Y3CEPDMHW7F841X"
+	FileDescriptorUsageHealthCheckID = "01DHWB4CWHEBD136PBSTQEMB61"
+
+	// ResourcePressureHealthCheckTag is used to tag the resource pressure health checks
+	ResourcePressureHealthCheckTag = "01DHWB4D0THJTXVK9XHYNZ1GMP"
+)
+
+// ErrInvalidResourceUsageThresholds indicates the resource usage thresholds are invalid
+var ErrInvalidResourceUsageThresholds = errors.New("resource usage thresholds must satisfy: 0 < Yellow <= Red <= 1")
+
+var (
+	errResourceUsageUnsupported = errors.New("resource usage is not supported on this platform")
+	errUnexpectedProcFormat     = errors.New("unexpected /proc file format")
+	errNoMemoryLimit            = errors.New("there is no memory limit")
+)
+
+// ResourceUsageThresholds are used to map resource usage ratios to health check statuses, i.e., the usage is `Yellow`
+// when it reaches the Yellow threshold and `Red` when it reaches the Red threshold. Thresholds are ratios in the range
+// (0, 1], e.g., 0.9 means 90% of the limit.
+type ResourceUsageThresholds struct {
+	Yellow, Red float64
+}
+
+func (t ResourceUsageThresholds) validate() error {
+	if t.Yellow <= 0 || t.Yellow > t.Red || t.Red > 1 {
+		return fmt.Errorf("%s : %#v", ErrInvalidResourceUsageThresholds, t)
+	}
+	return nil
+}
+
+func (t ResourceUsageThresholds) status(usage float64) health.Status {
+	switch {
+	case usage >= t.Red:
+		return health.Red
+	case usage >= t.Yellow:
+		return health.Yellow
+	default:
+		return health.Green
+	}
+}
+
+// ResourceHealthCheckOpts is used to configure the resource pressure health checks
+type ResourceHealthCheckOpts struct {
+	// FilesystemPaths are the paths whose filesystem usage is checked. If no paths are specified, then the filesystem
+	// usage health check is not registered.
+	FilesystemPaths []string
+	Filesystem      ResourceUsageThresholds
+
+	// MemoryLimit is the memory limit in bytes that the process RSS is checked against. If zero, then the cgroup memory
+	// limit is used. If there is no memory limit, then the memory usage health check is not registered.
+	MemoryLimit uint64
+	Memory      ResourceUsageThresholds
+
+	// open file descriptors are checked against the process file descriptor soft limit, i.e., `ulimit -n`
+	FileDescriptors ResourceUsageThresholds
+}
+
+// DefaultResourceHealthCheckOpts returns the default resource pressure health check options:
+//   - filesystem usage is checked for the working directory
+//   - usage is Yellow at 85% and Red at 95%
+func DefaultResourceHealthCheckOpts() ResourceHealthCheckOpts {
+	thresholds := ResourceUsageThresholds{Yellow: 0.85, Red: 0.95}
+	return ResourceHealthCheckOpts{
+		FilesystemPaths: []string{"."},
+		Filesystem:      thresholds,
+		Memory:          thresholds,
+		FileDescriptors: thresholds,
+	}
+}
+
+func (opts ResourceHealthCheckOpts) validate() error {
+	return multierr.Combine(
+		opts.Filesystem.validate(),
+		opts.Memory.validate(),
+		opts.FileDescriptors.validate(),
+	)
+}
+
+// returns a checker that maps the resource usage to a health check status
+func resourceUsageChecker(resource string, thresholds ResourceUsageThresholds, usage func() (used, limit uint64, err error)) func(ctx context.Context) (health.Status, error) {
+	return func(ctx context.Context) (health.Status, error) {
+		used, limit, err := usage()
+		if err != nil {
+			return health.Red, err
+		}
+		ratio := float64(used) / float64(limit)
+		status := thresholds.status(ratio)
+		if status == health.Green {
+			return status, nil
+		}
+		return status, fmt.Errorf("%s usage is %.1f%% : %d / %d", resource, ratio*100, used, limit)
+	}
+}
+
+// registers the resource pressure health checks.
+//
+// The memory and file descriptor usage health checks are only registered if the usage can be measured on the platform.
+func registerResourceHealthChecks(opts ResourceHealthCheckOpts) func(register health.Register) error {
+	return func(register health.Register) error {
+		var err error
+		if len(opts.FilesystemPaths) > 0 {
+			subChecks := make([]health.SubCheck, 0, len(opts.FilesystemPaths))
+			for _, path := range opts.FilesystemPaths {
+				path := path
+				subChecks = append(subChecks, health.SubCheck{
+					Name: path,
+					Checker: resourceUsageChecker(path, opts.Filesystem, func() (uint64, uint64, error) {
+						return filesystemUsage(path)
+					}),
+				})
+			}
+			err = multierr.Append(err, register(health.Check{
+				ID:           FilesystemUsageHealthCheckID,
+				Description:  fmt.Sprintf("filesystem usage: %v", opts.FilesystemPaths),
+				YellowImpact: "filesystem is close to running out of space",
+				RedImpact:    "writes will fail when the filesystem runs out of space",
+				Tags:         []string{ResourcePressureHealthCheckTag},
+			}, health.CheckerOpts{}, health.Composite(subChecks...)))
+		}
+
+		memoryUsage := func() (uint64, uint64, error) {
+			rss, limit, err := memoryUsage()
+			if opts.MemoryLimit > 0 {
+				limit = opts.MemoryLimit
+			}
+			if err == nil && limit == 0 {
+				err = errNoMemoryLimit
+			}
+			return rss, limit, err
+		}
+		if _, _, e := memoryUsage(); e == nil {
+			err = multierr.Append(err, register(health.Check{
+				ID:           MemoryUsageHealthCheckID,
+				Description:  "process RSS vs memory limit",
+				YellowImpact: "app is close to its memory limit",
+				RedImpact:    "app is at risk of being OOM killed",
+				Tags:         []string{ResourcePressureHealthCheckTag},
+			}, health.CheckerOpts{}, resourceUsageChecker("memory", opts.Memory, memoryUsage)))
+		}
+
+		if _, _, e := fileDescriptorUsage(); e == nil {
+			err = multierr.Append(err, register(health.Check{
+				ID:           FileDescriptorUsageHealthCheckID,
+				Description:  "open file descriptors vs ulimit",
+				YellowImpact: "app is close to its open file descriptor limit",
+				RedImpact:    "app will fail to open files and network connections",
+				Tags:         []string{ResourcePressureHealthCheckTag},
+			}, health.CheckerOpts{}, resourceUsageChecker("file descriptor", opts.FileDescriptors, fileDescriptorUsage)))
+		}
+		return err
+	}
+}
@@ -0,0 +1,49 @@
+/*
+ * Copyright (c) 2019 OysterPack, Inc.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ * http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package fxapp
+
+import (
+	"context"
+	"github.com/oysterpack/andiamo/pkg/fx/health"
+	"github.com/stretchr/testify/assert"
+	"testing"
+)
+
+func TestResourceUsageChecker(t *testing.T) {
+	t.Parallel()
+
+	thresholds := ResourceUsageThresholds{Yellow: 0.8, Red: 0.9}
+	testCases := []struct {
+		used     uint64
+		expected health.Status
+	}{
+		{10, health.Green},
+		{79, health.Green},
+		{80, health.Yellow},
+		{90, health.Red},
+		{100, health.Red},
+	}
+	for _, testCase := range testCases {
+		used := testCase.used
+		checker := resourceUsageChecker("foo", thresholds, func() (uint64, uint64, error) {
+			return used, 100, nil
+		})
+		status, err := checker(context.Background())
+		assert.Equal(t, testCase.expected, status, "used: %d", used)
+		assert.Equal(t, status != health.Green, err != nil, "used: %d", used)
+	}
+}
@@ -0,0 +1,87 @@
+/*
+ * Copyright (c) 2019 OysterPack, Inc.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ * http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package fxapp_test
+
+import (
+	"github.com/oysterpack/andiamo/pkg/fx/health"
+	"github.com/oysterpack/andiamo/pkg/fxapp"
+	"github.com/oysterpack/andiamo/pkg/ulids"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"runtime"
+	"testing"
+)
+
+func TestEnableResourceHealthChecks(t *testing.T) {
+	t.Parallel()
+
+	if runtime.GOOS != "linux" {
+		t.Skip("resource usage is only supported on linux")
+	}
+
+	var registeredChecks health.RegisteredChecks
+	var results health.CheckResultsSubscription
+	app, err := fxapp.NewBuilder(fxapp.ID(ulids.MustNew()), fxapp.ReleaseID(ulids.MustNew())).
+		EnableResourceHealthChecks(fxapp.DefaultResourceHealthCheckOpts()).
+		Invoke(func(subscribe health.SubscribeForCheckResults) {
+			results = subscribe(func(result health.Result) bool {
+				return result.ID == fxapp.FilesystemUsageHealthCheckID
+			})
+		}).
+		Populate(&registeredChecks).
+		DisableHTTPServer().
+		Build()
+	require.NoError(t, err)
+
+	go app.Run()
+	defer func() {
+		app.Shutdown()
+		<-app.Done()
+	}()
+	<-app.Ready()
+
+	checks := make(map[string]health.RegisteredCheck)
+	for _, check := range <-registeredChecks(health.Query{}) {
+		checks[check.ID] = check
+	}
+	for _, id := range []string{fxapp.FilesystemUsageHealthCheckID, fxapp.FileDescriptorUsageHealthCheckID} {
+		check, ok := checks[id]
+		require.True(t, ok, "health check is not registered: %s", id)
+		assert.Equal(t, []string{fxapp.ResourcePressureHealthCheckTag}, check.Tags)
+	}
+
+	// wait for the filesystem usage health check to run
+	result := <-results.Chan()
+	results.Close()
+	// the filesystem usage health check reports the usage per path
+	require.Len(t, result.SubResults, 1)
+	assert.Equal(t, ".", result.SubResults[0].Name)
+}
+
+func TestEnableResourceHealthChecks_InvalidThresholds(t *testing.T) {
+	t.Parallel()
+
+	opts := fxapp.DefaultResourceHealthCheckOpts()
+	opts.Memory = fxapp.ResourceUsageThresholds{Yellow: 0.9, Red: 0.8}
+	_, err := fxapp.NewBuilder(fxapp.ID(ulids.MustNew()), fxapp.ReleaseID(ulids.MustNew())).
+		EnableResourceHealthChecks(opts).
+		Invoke(func() {}).
+		DisableHTTPServer().
+		Build()
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), fxapp.ErrInvalidResourceUsageThresholds.Error())
+}
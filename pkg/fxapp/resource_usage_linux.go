@@ -0,0 +1,108 @@
+/*
+ * Copyright (c) 2019 OysterPack, Inc.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ * http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package fxapp
+
+import (
+	"bytes"
+	"io/ioutil"
+	"os"
+	"strconv"
+	"strings"
+	"syscall"
+	"time"
+)
+
+// cgroup memory limit files - v2 and v1
+var cgroupMemoryLimitFiles = []string{
+	"/sys/fs/cgroup/memory.max",
+	"/sys/fs/cgroup/memory/memory.limit_in_bytes",
+}
+
+// cgroup v1 reports an effectively unlimited memory limit as a very large number
+const cgroupUnlimitedMemory = 1 << 62
+
+// returns the used and total bytes for the filesystem that contains the path. Used bytes are computed from the bytes
+// available to unprivileged users.
+func filesystemUsage(path string) (used, total uint64, err error) {
+	var stat syscall.Statfs_t
+	if err := syscall.Statfs(path, &stat); err != nil {
+		return 0, 0, err
+	}
+	total = stat.Blocks * uint64(stat.Bsize)
+	return total - stat.Bavail*uint64(stat.Bsize), total, nil
+}
+
+// returns the process RSS and the cgroup memory limit. If there is no memory limit, then limit is zero.
+func memoryUsage() (rss, limit uint64, err error) {
+	statm, err := ioutil.ReadFile("/proc/self/statm")
+	if err != nil {
+		return 0, 0, err
+	}
+	fields := strings.Fields(string(statm))
+	if len(fields) < 2 {
+		return 0, 0, errUnexpectedProcFormat
+	}
+	pages, err := strconv.ParseUint(fields[1], 10, 64)
+	if err != nil {
+		return 0, 0, err
+	}
+	return pages * uint64(os.Getpagesize()), cgroupMemoryLimit(), nil
+}
+
+func cgroupMemoryLimit() uint64 {
+	for _, file := range cgroupMemoryLimitFiles {
+		content, err := ioutil.ReadFile(file)
+		if err != nil {
+			continue
+		}
+		limit, err := strconv.ParseUint(string(bytes.TrimSpace(content)), 10, 64)
+		if err != nil || limit >= cgroupUnlimitedMemory {
+			// cgroup v2 reports "max" when there is no limit
+			return 0
+		}
+		return limit
+	}
+	return 0
+}
+
+// returns the number of open file descriptors and the file descriptor soft limit
+func fileDescriptorUsage() (open, limit uint64, err error) {
+	var rlimit syscall.Rlimit
+	if err := syscall.Getrlimit(syscall.RLIMIT_NOFILE, &rlimit); err != nil {
+		return 0, 0, err
+	}
+	dir, err := os.Open("/proc/self/fd")
+	if err != nil {
+		return 0, 0, err
+	}
+	defer dir.Close()
+	fds, err := dir.Readdirnames(-1)
+	if err != nil {
+		return 0, 0, err
+	}
+	// exclude the file descriptor that is used to read the directory
+	return uint64(len(fds) - 1), rlimit.Cur, nil
+}
+
+// returns the process CPU time, i.e., user plus system time
+func processCPUTime() (time.Duration, error) {
+	var usage syscall.Rusage
+	if err := syscall.Getrusage(syscall.RUSAGE_SELF, &usage); err != nil {
+		return 0, err
+	}
+	return time.Duration(usage.Utime.Nano() + usage.Stime.Nano()), nil
+}
@@ -0,0 +1,38 @@
+//go:build !linux
+// +build !linux
+
+/*
+ * Copyright (c) 2019 OysterPack, Inc.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ * http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package fxapp
+
+import "time"
+
+func filesystemUsage(path string) (used, total uint64, err error) {
+	return 0, 0, errResourceUsageUnsupported
+}
+
+func memoryUsage() (rss, limit uint64, err error) {
+	return 0, 0, errResourceUsageUnsupported
+}
+
+func fileDescriptorUsage() (open, limit uint64, err error) {
+	return 0, 0, errResourceUsageUnsupported
+}
+
+func processCPUTime() (time.Duration, error) {
+	return 0, errResourceUsageUnsupported
+}
@@ -0,0 +1,63 @@
+/*
+ * Copyright (c) 2019 OysterPack, Inc.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ * http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package fxapp_test
+
+import (
+	"context"
+	"errors"
+	"github.com/oysterpack/andiamo/pkg/fx/retry"
+	"github.com/oysterpack/andiamo/pkg/fxapp"
+	"github.com/oysterpack/andiamo/pkg/fxapptest"
+	"github.com/oysterpack/andiamo/pkg/ulids"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"testing"
+	"time"
+)
+
+func TestBuilder_EnableRetries(t *testing.T) {
+	t.Parallel()
+
+	var retrier retry.Retrier
+	logs := fxapptest.NewLogCapture()
+	app, err := fxapp.NewBuilder(fxapp.ID(ulids.MustNew()), fxapp.ReleaseID(ulids.MustNew())).
+		EnableRetries(retry.Opts{MaxAttempts: 2, InitialBackoff: time.Millisecond}).
+		Invoke(func() {}).
+		Populate(&retrier).
+		LogWriter(logs).
+		DisableHTTPServer().
+		Build()
+	require.NoError(t, err)
+
+	go app.Run()
+	defer func() {
+		app.Shutdown()
+		<-app.Done()
+	}()
+	<-app.Ready()
+
+	errBoom := errors.New("BOOM")
+	attempts := 0
+	err = retrier.Do(context.Background(), "foo", func(ctx context.Context) error {
+		attempts++
+		return errBoom
+	})
+	assert.Equal(t, errBoom, err)
+	assert.Equal(t, 2, attempts)
+	fxapptest.AssertEventLogged(t, logs, retry.RetryEvent, fxapptest.Field("d.op", "foo"))
+	fxapptest.AssertEventLogged(t, logs, retry.RetryFailedEvent, fxapptest.Field("d.result", retry.Exhausted))
+}
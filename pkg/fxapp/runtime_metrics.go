@@ -0,0 +1,153 @@
+/*
+ * Copyright (c) 2019 OysterPack, Inc.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ * http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package fxapp
+
+import (
+	"github.com/prometheus/client_golang/prometheus"
+	"math"
+	"runtime/metrics"
+	"strings"
+)
+
+// runtime metric IDs, which are used as the prometheus metric names
+const (
+	// histogram - seconds - the time goroutines spent in the runnable state before running
+	SchedulerLatencyMetricID = "U01DHWVKQM0N13Y9G6J4N5YGSW7"
+	// histogram - seconds - stop-the-world GC pause latencies
+	GCPauseMetricID = "U01DHWVKQR97CHP58X1AEYD36F7"
+	// gauge vec - number of goroutines per state - see GoroutineStateLabel
+	GoroutineStatesMetricID = "U01DHWVKQWJ75MNSWJ0V1QKF4EQ"
+)
+
+// GoroutineStateLabel is the goroutine state label for the GoroutineStatesMetricID gauge vec, e.g., runnable, running,
+// waiting, not-in-go
+const GoroutineStateLabel = "state"
+
+// runtime/metrics sample names
+const (
+	schedLatenciesSample      = "/sched/latencies:seconds"
+	gcPausesSample            = "/sched/pauses/total/gc:seconds"
+	goroutineStatesSamplePath = "/sched/goroutines/"
+)
+
+// the runtime histograms have a very fine bucket resolution - they are rebinned into these buckets, i.e., 1 µs to ~4 s
+var runtimeLatencyBuckets = prometheus.ExponentialBuckets(1e-6, 4, 12)
+
+// RegisterRuntimeMetricsCollector is used to register a collector for runtime stats that complement the default Go
+// collector, which are collected via the runtime/metrics package:
+//   - scheduler latency histogram - see SchedulerLatencyMetricID
+//   - GC pause histogram - see GCPauseMetricID
+//   - goroutine states - see GoroutineStatesMetricID
+//
+// Runtime metrics that are not supported by the Go runtime version are not collected.
+func RegisterRuntimeMetricsCollector(registerer prometheus.Registerer) error {
+	return registerer.Register(newRuntimeMetricsCollector())
+}
+
+type runtimeMetricsCollector struct {
+	schedulerLatency *prometheus.Desc
+	gcPause          *prometheus.Desc
+	goroutineStates  *prometheus.Desc
+
+	// goroutine state sample names mapped to the state
+	goroutineStateSamples map[string]string
+}
+
+func newRuntimeMetricsCollector() *runtimeMetricsCollector {
+	c := &runtimeMetricsCollector{
+		schedulerLatency:      prometheus.NewDesc(SchedulerLatencyMetricID, "time in seconds that goroutines spent in the runnable state before running", nil, nil),
+		gcPause:               prometheus.NewDesc(GCPauseMetricID, "stop-the-world GC pause latencies in seconds", nil, nil),
+		goroutineStates:       prometheus.NewDesc(GoroutineStatesMetricID, "number of goroutines per state", []string{GoroutineStateLabel}, nil),
+		goroutineStateSamples: make(map[string]string),
+	}
+	for _, desc := range metrics.All() {
+		if strings.HasPrefix(desc.Name, goroutineStatesSamplePath) {
+			state := strings.TrimPrefix(desc.Name, goroutineStatesSamplePath)
+			c.goroutineStateSamples[desc.Name] = state[:strings.Index(state, ":")]
+		}
+	}
+	return c
+}
+
+func (c *runtimeMetricsCollector) Describe(descs chan<- *prometheus.Desc) {
+	descs <- c.schedulerLatency
+	descs <- c.gcPause
+	descs <- c.goroutineStates
+}
+
+func (c *runtimeMetricsCollector) Collect(ms chan<- prometheus.Metric) {
+	samples := make([]metrics.Sample, 0, 2+len(c.goroutineStateSamples))
+	samples = append(samples, metrics.Sample{Name: schedLatenciesSample}, metrics.Sample{Name: gcPausesSample})
+	for name := range c.goroutineStateSamples {
+		samples = append(samples, metrics.Sample{Name: name})
+	}
+	metrics.Read(samples)
+
+	for _, sample := range samples {
+		switch sample.Name {
+		case schedLatenciesSample:
+			if sample.Value.Kind() == metrics.KindFloat64Histogram {
+				ms <- newConstHistogram(c.schedulerLatency, sample.Value.Float64Histogram())
+			}
+		case gcPausesSample:
+			if sample.Value.Kind() == metrics.KindFloat64Histogram {
+				ms <- newConstHistogram(c.gcPause, sample.Value.Float64Histogram())
+			}
+		default:
+			if sample.Value.Kind() == metrics.KindUint64 {
+				ms <- prometheus.MustNewConstMetric(c.goroutineStates, prometheus.GaugeValue, float64(sample.Value.Uint64()), c.goroutineStateSamples[sample.Name])
+			}
+		}
+	}
+}
+
+// rebins the runtime histogram into the runtime latency buckets. Runtime bucket counts are attributed to the first
+// bucket whose upper bound is >= the runtime bucket's upper bound. The sum is estimated using the runtime bucket
+// midpoints, because the runtime does not track the sum.
+func newConstHistogram(desc *prometheus.Desc, h *metrics.Float64Histogram) prometheus.Metric {
+	buckets := make(map[float64]uint64, len(runtimeLatencyBuckets))
+	var count uint64
+	var sum float64
+	for i, n := range h.Counts {
+		if n == 0 {
+			continue
+		}
+		count += n
+		lower, upper := h.Buckets[i], h.Buckets[i+1]
+		switch {
+		case math.IsInf(lower, -1):
+			sum += upper * float64(n)
+		case math.IsInf(upper, 1):
+			sum += lower * float64(n)
+		default:
+			sum += (lower + upper) / 2 * float64(n)
+		}
+		for _, bound := range runtimeLatencyBuckets {
+			if upper <= bound {
+				buckets[bound] += n
+				break
+			}
+		}
+	}
+	// prometheus histogram bucket counts are cumulative
+	var cumulative uint64
+	for _, bound := range runtimeLatencyBuckets {
+		cumulative += buckets[bound]
+		buckets[bound] = cumulative
+	}
+	return prometheus.MustNewConstHistogram(desc, count, sum, buckets)
+}
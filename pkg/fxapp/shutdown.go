@@ -0,0 +1,264 @@
+/*
+ * Copyright (c) 2019 OysterPack, Inc.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ * http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package fxapp
+
+import (
+	"fmt"
+	"github.com/oysterpack/andiamo/pkg/eventlog"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/rs/zerolog"
+	"go.uber.org/fx"
+	"net/http"
+	"os"
+	"sync"
+)
+
+// ShutdownRequestedEvent is logged for each shutdown request. Only the first request initiates the shutdown, i.e.,
+// requests that are made while the app is already shutting down are superseded. Superseded requests are logged at warn
+// level.
+//
+//	type Data struct {
+//		Reason struct {
+//			Code   string `json:"code"`
+//			// only logged if the shutdown was triggered by a signal
+//			Signal string `json:"signal"`
+//			Msg    string `json:"msg"`
+//		} `json:"reason"`
+//		// one of: initiated, superseded
+//		Outcome string `json:"outcome"`
+//	}
+const ShutdownRequestedEvent = "01DJ647XM0DE8GZ7GP46TRRKTN"
+
+// AppShutdownRequestsMetricID is the counter metric ID for app shutdown requests, which is labeled with the reason code
+// ("reason") and the outcome ("outcome"), i.e., initiated or superseded
+const AppShutdownRequestsMetricID = "U01DJ647XR91R09XSE7KGADJJYT"
+
+// ShutdownEndpoint is used to construct the HTTP endpoint that shuts down the app (POST), using the
+// `ShutdownAdminRequest` reason. The optional "msg" query param describes why the app is being shutdown. HTTP 202 is
+// returned if the shutdown is initiated, and HTTP 409 is returned if the app is already shutting down.
+//
+// The endpoint is admin only, and is only registered if enabled via the builder - see `Builder.EnableShutdownEndpoint()`.
+const ShutdownEndpoint = "01DJ647XWJTQSH5TX7A0QQH2CM"
+
+// ShutdownReasonCode is used to classify why the app was shutdown, e.g., for postmortems
+type ShutdownReasonCode string
+
+// shutdown reason codes
+const (
+	// ShutdownSignal means the app received a SIGINT or SIGTERM signal, e.g., from the container orchestrator. Shutdowns
+	// that are triggered via the fx.Shutdowner are reported as SIGTERM signals.
+	ShutdownSignal ShutdownReasonCode = "signal"
+	// ShutdownRequested means the app was shutdown via `App.Shutdown()`
+	ShutdownRequested ShutdownReasonCode = "requested"
+	// ShutdownAdminRequest means an operator requested the shutdown, e.g., via the `ShutdownEndpoint`
+	ShutdownAdminRequest ShutdownReasonCode = "admin_request"
+	// ShutdownHealthCritical means the app is unhealthy, and cannot recover without being restarted
+	ShutdownHealthCritical ShutdownReasonCode = "health_critical"
+	// ShutdownFatalError means the app encountered an unrecoverable error
+	ShutdownFatalError ShutdownReasonCode = "fatal_error"
+	// ShutdownMemorySoftLimit means the app exceeded its memory soft limit, i.e., the app is shutdown gracefully before it
+	// is OOM killed
+	ShutdownMemorySoftLimit ShutdownReasonCode = "oom_soft_limit"
+)
+
+// process exit codes that are mapped to shutdown reasons - see `ShutdownReason.ExitCode()`
+const (
+	// ExitCodeOK is used for the signal, requested, and admin request shutdown reasons
+	ExitCodeOK              = 0
+	ExitCodeFatalError      = 1
+	ExitCodeHealthCritical  = 3
+	ExitCodeMemorySoftLimit = 4
+)
+
+// ShutdownReason describes why the app was shutdown. ShutdownReason implements the os.Signal interface, i.e., it is sent
+// on the app's `Stopping()` and `Done()` channels.
+type ShutdownReason struct {
+	Code ShutdownReasonCode
+	// OSSignal is the signal that triggered the shutdown - only set for the `ShutdownSignal` reason
+	OSSignal os.Signal
+	// Msg optionally describes the reason, e.g., the fatal error
+	Msg string
+}
+
+// Signal implements the os.Signal interface
+func (r ShutdownReason) Signal() {}
+
+func (r ShutdownReason) String() string {
+	switch {
+	case r.OSSignal != nil && r.Msg != "":
+		return fmt.Sprintf("%s (%s) : %s", r.Code, r.OSSignal, r.Msg)
+	case r.OSSignal != nil:
+		return fmt.Sprintf("%s (%s)", r.Code, r.OSSignal)
+	case r.Msg != "":
+		return fmt.Sprintf("%s : %s", r.Code, r.Msg)
+	default:
+		return string(r.Code)
+	}
+}
+
+// ExitCode returns the process exit code that is mapped to the shutdown reason, which enables the container orchestrator
+// to report why the instance exited:
+//   - `ShutdownSignal`, `ShutdownRequested`, `ShutdownAdminRequest` -> `ExitCodeOK`
+//   - `ShutdownFatalError` -> `ExitCodeFatalError`
+//   - `ShutdownHealthCritical` -> `ExitCodeHealthCritical`
+//   - `ShutdownMemorySoftLimit` -> `ExitCodeMemorySoftLimit`
+//
+// Unknown reason codes are mapped to `ExitCodeFatalError`.
+func (r ShutdownReason) ExitCode() int {
+	switch r.Code {
+	case ShutdownSignal, ShutdownRequested, ShutdownAdminRequest:
+		return ExitCodeOK
+	case ShutdownHealthCritical:
+		return ExitCodeHealthCritical
+	case ShutdownMemorySoftLimit:
+		return ExitCodeMemorySoftLimit
+	default:
+		return ExitCodeFatalError
+	}
+}
+
+// MarshalZerologObject implements zerolog.LogObjectMarshaler interface
+func (r ShutdownReason) MarshalZerologObject(e *zerolog.Event) {
+	e.Str("code", string(r.Code))
+	if r.OSSignal != nil {
+		e.Str("signal", r.OSSignal.String())
+	}
+	if r.Msg != "" {
+		e.Str("msg", r.Msg)
+	}
+}
+
+// RequestShutdown is used to initiate the app shutdown with a reason. It never blocks, i.e., it is safe to call from
+// health checks, HTTP handlers, and lifecycle hooks. It returns true if the request initiated the shutdown, and false if
+// the app is already shutting down, or if the app has not yet been started. Only the first shutdown reason is recorded.
+type RequestShutdown func(reason ShutdownReason) bool
+
+type shutdownRequest struct {
+	reason  ShutdownReason
+	outcome string
+}
+
+func (r shutdownRequest) MarshalZerologObject(e *zerolog.Event) {
+	e.Object("reason", r.reason).Str("outcome", r.outcome)
+}
+
+// shutdownState records the first shutdown reason
+type shutdownState struct {
+	shutdowner fx.Shutdowner
+	logger     *zerolog.Logger
+	// set when the app is built, i.e., shutdown requests are rejected until the app is started
+	started <-chan struct{}
+
+	requests *prometheus.CounterVec
+
+	mutex  sync.Mutex
+	reason *ShutdownReason
+}
+
+func newShutdownState(shutdowner fx.Shutdowner, logger *zerolog.Logger) *shutdownState {
+	return &shutdownState{
+		shutdowner: shutdowner,
+		logger:     logger,
+		requests: prometheus.NewCounterVec(
+			prometheus.CounterOpts{Name: AppShutdownRequestsMetricID, Help: "app shutdown requests"},
+			[]string{"reason", "outcome"},
+		),
+	}
+}
+
+// record returns true if the reason is the first shutdown reason that is recorded
+func (s *shutdownState) record(reason ShutdownReason) bool {
+	s.mutex.Lock()
+	initiated := s.reason == nil
+	if initiated {
+		s.reason = &reason
+	}
+	s.mutex.Unlock()
+
+	request := shutdownRequest{reason: reason, outcome: "initiated"}
+	level := zerolog.InfoLevel
+	if !initiated {
+		request.outcome = "superseded"
+		level = zerolog.WarnLevel
+	}
+	s.requests.WithLabelValues(string(reason.Code), request.outcome).Inc()
+	logEvent := eventlog.NewLogger(ShutdownRequestedEvent, s.logger, level)
+	logEvent(request, "shutdown requested")
+	return initiated
+}
+
+// request initiates the shutdown, if the app has been started and is not already shutting down
+func (s *shutdownState) request(reason ShutdownReason) bool {
+	select {
+	case <-s.started:
+	default:
+		return false
+	}
+	if !s.record(reason) {
+		return false
+	}
+	// the shutdown signal is dropped if the app is already being signalled to stop, e.g., via an OS signal - in that
+	// case the recorded reason is still reported
+	s.shutdowner.Shutdown()
+	return true
+}
+
+// stopReason returns the recorded shutdown reason. If no reason was recorded, then the app was shutdown via the signal.
+func (s *shutdownState) stopReason(signal os.Signal) ShutdownReason {
+	if reason, ok := s.shutdownReason(); ok {
+		return reason
+	}
+	s.record(ShutdownReason{Code: ShutdownSignal, OSSignal: signal})
+	reason, _ := s.shutdownReason()
+	return reason
+}
+
+func (s *shutdownState) shutdownReason() (ShutdownReason, bool) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	if s.reason == nil {
+		return ShutdownReason{}, false
+	}
+	return *s.reason, true
+}
+
+func provideRequestShutdown(s *shutdownState) RequestShutdown {
+	return s.request
+}
+
+func registerShutdownMetrics(s *shutdownState, registerer prometheus.Registerer) error {
+	return registerer.Register(s.requests)
+}
+
+func shutdownHTTPHandler(requestShutdown RequestShutdown) HTTPHandler {
+	return NewHTTPRoute(http.MethodPost, fmt.Sprintf("/%s", ShutdownEndpoint), func(writer http.ResponseWriter, request *http.Request) {
+		reason := ShutdownReason{Code: ShutdownAdminRequest, Msg: request.URL.Query().Get("msg")}
+		if !requestShutdown(reason) {
+			http.Error(writer, "app is already shutting down", http.StatusConflict)
+			return
+		}
+		writer.WriteHeader(http.StatusAccepted)
+	}).WithDoc(OpenAPIOperation{
+		Summary: "shuts down the app",
+		Tags:    []string{BuiltinOpenAPITag},
+		Params:  []OpenAPIParam{{Name: "msg", Description: "describes why the app is being shutdown"}},
+		Responses: []OpenAPIResponse{
+			{Status: http.StatusAccepted, Description: "shutdown is initiated"},
+			{Status: http.StatusConflict, Description: "app is already shutting down"},
+		},
+	}).AdminOnly()
+}
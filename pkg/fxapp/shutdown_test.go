@@ -0,0 +1,205 @@
+/*
+ * Copyright (c) 2019 OysterPack, Inc.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ * http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package fxapp_test
+
+import (
+	"github.com/oysterpack/andiamo/pkg/fxapp"
+	"github.com/oysterpack/andiamo/pkg/fxapptest"
+	"github.com/oysterpack/andiamo/pkg/ulids"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.uber.org/fx"
+	"net/http"
+	"syscall"
+	"testing"
+	"time"
+)
+
+// runApp runs the app until it is ready, and returns the channel that the app run error is sent on
+func runApp(t *testing.T, app fxapp.App) <-chan error {
+	runErr := make(chan error, 1)
+	go func() {
+		runErr <- app.Run()
+	}()
+	select {
+	case <-app.Ready():
+	case err := <-runErr:
+		t.Fatalf("*** app failed to run: %v", err)
+	case <-time.After(fxapptest.RunAppTimeout):
+		t.Fatal("*** timed out waiting for the app to be ready")
+	}
+	return runErr
+}
+
+func TestRequestShutdown(t *testing.T) {
+	t.Parallel()
+
+	logs := fxapptest.NewLogCapture()
+	var requestShutdown fxapp.RequestShutdown
+	var gatherer prometheus.Gatherer
+	app, err := fxapp.NewBuilder(fxapp.ID(ulids.MustNew()), fxapp.ReleaseID(ulids.MustNew())).
+		Invoke(func() {}).
+		Populate(&requestShutdown, &gatherer).
+		DisableHTTPServer().
+		LogWriter(logs).
+		Build()
+	require.NoError(t, err)
+
+	_, ok := app.ShutdownReason()
+	assert.False(t, ok)
+	assert.False(t, requestShutdown(fxapp.ShutdownReason{Code: fxapp.ShutdownFatalError}), "shutdown requests are rejected until the app is started")
+
+	runErr := runApp(t, app)
+	assert.True(t, requestShutdown(fxapp.ShutdownReason{Code: fxapp.ShutdownHealthCritical, Msg: "DB is corrupted"}))
+	// shutdown requests never block, and only the first reason is recorded
+	assert.False(t, requestShutdown(fxapp.ShutdownReason{Code: fxapp.ShutdownFatalError}))
+	assert.NoError(t, app.Shutdown())
+
+	signal := <-app.Stopping()
+	reason, ok := signal.(fxapp.ShutdownReason)
+	require.True(t, ok)
+	assert.Equal(t, fxapp.ShutdownHealthCritical, reason.Code)
+	assert.Equal(t, "DB is corrupted", reason.Msg)
+	assert.Equal(t, reason, <-app.Done())
+	require.NoError(t, <-runErr)
+
+	reason, ok = app.ShutdownReason()
+	require.True(t, ok)
+	assert.Equal(t, fxapp.ExitCodeHealthCritical, reason.ExitCode())
+
+	fxapptest.AssertEventLogged(t, logs, fxapp.StoppingEvent, fxapptest.Field("d.reason.code", "health_critical"))
+	fxapptest.AssertEventLogged(t, logs, fxapp.StoppedEvent,
+		fxapptest.Field("d.reason.code", "health_critical"),
+		fxapptest.Field("d.reason.msg", "DB is corrupted"),
+	)
+	fxapptest.AssertEventLogged(t, logs, fxapp.ShutdownRequestedEvent,
+		fxapptest.Field("l", "info"),
+		fxapptest.Field("d.reason.code", "health_critical"),
+		fxapptest.Field("d.outcome", "initiated"),
+	)
+	fxapptest.AssertEventLogged(t, logs, fxapp.ShutdownRequestedEvent,
+		fxapptest.Field("l", "warn"),
+		fxapptest.Field("d.reason.code", "requested"),
+		fxapptest.Field("d.outcome", "superseded"),
+	)
+
+	mfs, err := gatherer.Gather()
+	require.NoError(t, err)
+	requests := make(map[string]float64)
+	for _, mf := range mfs {
+		if mf.GetName() != fxapp.AppShutdownRequestsMetricID {
+			continue
+		}
+		for _, m := range mf.GetMetric() {
+			labels := make(map[string]string)
+			for _, label := range m.GetLabel() {
+				labels[label.GetName()] = label.GetValue()
+			}
+			requests[labels["reason"]+"/"+labels["outcome"]] = m.GetCounter().GetValue()
+		}
+	}
+	assert.Equal(t, map[string]float64{
+		"fatal_error/superseded":    1,
+		"health_critical/initiated": 1,
+		"requested/superseded":      1,
+	}, requests)
+}
+
+func TestApp_Shutdown_Reason(t *testing.T) {
+	t.Parallel()
+
+	t.Run("App.Shutdown", func(t *testing.T) {
+		app, err := fxapp.NewBuilder(fxapp.ID(ulids.MustNew()), fxapp.ReleaseID(ulids.MustNew())).
+			Invoke(func() {}).
+			DisableHTTPServer().
+			LogWriter(fxapptest.NewLogCapture()).
+			Build()
+		require.NoError(t, err)
+		runErr := runApp(t, app)
+		require.NoError(t, app.Shutdown())
+		require.NoError(t, <-runErr)
+		reason, ok := app.ShutdownReason()
+		require.True(t, ok)
+		assert.Equal(t, fxapp.ShutdownRequested, reason.Code)
+		assert.Equal(t, fxapp.ExitCodeOK, reason.ExitCode())
+	})
+
+	t.Run("fx.Shutdowner", func(t *testing.T) {
+		var shutdowner fx.Shutdowner
+		app, err := fxapp.NewBuilder(fxapp.ID(ulids.MustNew()), fxapp.ReleaseID(ulids.MustNew())).
+			Invoke(func() {}).
+			Populate(&shutdowner).
+			DisableHTTPServer().
+			LogWriter(fxapptest.NewLogCapture()).
+			Build()
+		require.NoError(t, err)
+		runErr := runApp(t, app)
+		require.NoError(t, shutdowner.Shutdown())
+		require.NoError(t, <-runErr)
+		reason, ok := app.ShutdownReason()
+		require.True(t, ok)
+		assert.Equal(t, fxapp.ShutdownSignal, reason.Code)
+		assert.Equal(t, syscall.SIGTERM, reason.OSSignal)
+	})
+}
+
+func TestBuilder_EnableShutdownEndpoint(t *testing.T) {
+	t.Parallel()
+
+	logs := fxapptest.NewLogCapture()
+	builder := fxapp.NewBuilder(fxapp.ID(ulids.MustNew()), fxapp.ReleaseID(ulids.MustNew())).
+		Invoke(func() {}).
+		EnableShutdownEndpoint().
+		LogWriter(logs)
+
+	fxapptest.RunApp(t, builder, func(app fxapp.App, client *fxapptest.HTTPClient) {
+		request, err := http.NewRequest(http.MethodPost, client.URL(fxapp.ShutdownEndpoint+"?msg=rotating+nodes"), nil)
+		require.NoError(t, err)
+		response, err := client.Do(request)
+		require.NoError(t, err)
+		response.Body.Close()
+		assert.Equal(t, http.StatusAccepted, response.StatusCode)
+
+		<-app.Done()
+		reason, ok := app.ShutdownReason()
+		require.True(t, ok)
+		assert.Equal(t, fxapp.ShutdownReason{Code: fxapp.ShutdownAdminRequest, Msg: "rotating nodes"}, reason)
+		fxapptest.AssertEventLogged(t, logs, fxapp.StoppedEvent, fxapptest.Field("d.reason.code", "admin_request"))
+	})
+}
+
+func TestShutdownReason(t *testing.T) {
+	t.Parallel()
+
+	for _, test := range []struct {
+		reason   fxapp.ShutdownReason
+		exitCode int
+		str      string
+	}{
+		{fxapp.ShutdownReason{Code: fxapp.ShutdownSignal, OSSignal: syscall.SIGINT}, fxapp.ExitCodeOK, "signal (interrupt)"},
+		{fxapp.ShutdownReason{Code: fxapp.ShutdownRequested}, fxapp.ExitCodeOK, "requested"},
+		{fxapp.ShutdownReason{Code: fxapp.ShutdownAdminRequest, Msg: "deploy"}, fxapp.ExitCodeOK, "admin_request : deploy"},
+		{fxapp.ShutdownReason{Code: fxapp.ShutdownFatalError, Msg: "BOOM"}, fxapp.ExitCodeFatalError, "fatal_error : BOOM"},
+		{fxapp.ShutdownReason{Code: fxapp.ShutdownHealthCritical}, fxapp.ExitCodeHealthCritical, "health_critical"},
+		{fxapp.ShutdownReason{Code: fxapp.ShutdownMemorySoftLimit}, fxapp.ExitCodeMemorySoftLimit, "oom_soft_limit"},
+		{fxapp.ShutdownReason{Code: "unknown"}, fxapp.ExitCodeFatalError, "unknown"},
+	} {
+		assert.Equal(t, test.exitCode, test.reason.ExitCode(), test.str)
+		assert.Equal(t, test.str, test.reason.String())
+	}
+}
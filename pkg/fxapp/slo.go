@@ -0,0 +1,395 @@
+/*
+ * Copyright (c) 2019 OysterPack, Inc.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ * http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package fxapp
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"github.com/oysterpack/andiamo/pkg/clock"
+	"github.com/oysterpack/andiamo/pkg/fx/health"
+	"github.com/oysterpack/andiamo/pkg/ulids"
+	"github.com/prometheus/client_golang/prometheus"
+	dto "github.com/prometheus/client_model/go"
+	"go.uber.org/fx"
+	"go.uber.org/multierr"
+	"math"
+	"strings"
+	"sync"
+	"time"
+)
+
+// SLOHealthCheckTag is used to tag the SLO health checks
+const SLOHealthCheckTag = "01DJ3HV6M00CQNM4CF58RSHRCX"
+
+// SLOBurnRateMetricID is a gauge that reports the SLO error budget burn rates. The gauge has the following labels:
+//   - slo - the SLO health check ID
+//   - window - either "long" or "short"
+const SLOBurnRateMetricID = "U01DJ3HV6R97N6YXTMT7JM81HR2"
+
+// SLO burn rate window label values
+const (
+	SLOLongWindow  = "long"
+	SLOShortWindow = "short"
+)
+
+// SLO defaults
+const (
+	DefaultSLOLongWindow     = time.Hour
+	DefaultSLOShortWindow    = 5 * time.Minute
+	DefaultSLOSampleInterval = 15 * time.Second
+)
+
+// ErrInvalidSLO indicates the SLO is misconfigured
+var ErrInvalidSLO = errors.New("invalid SLO")
+
+var (
+	errMetricIsNotHistogram      = errors.New("metric is not a histogram")
+	errLatencyThresholdNotBucket = errors.New("latency threshold is not a histogram bucket")
+)
+
+// SLOBurnRateThresholds are used to map error budget burn rates to health check statuses. A burn rate of 1 means the
+// error budget is being consumed at exactly the rate that exhausts it at the end of the SLO period.
+type SLOBurnRateThresholds struct {
+	Yellow, Red float64
+}
+
+// DefaultSLOBurnRateThresholds returns the commonly used fast-burn thresholds for a 30 day SLO period, i.e., a 14.4x
+// burn rate consumes 2% of the error budget in 1 hour, and a 6x burn rate consumes 5% of the error budget in 6 hours.
+func DefaultSLOBurnRateThresholds() SLOBurnRateThresholds {
+	return SLOBurnRateThresholds{Yellow: 6, Red: 14.4}
+}
+
+func (t SLOBurnRateThresholds) status(burnRate float64) health.Status {
+	switch {
+	case burnRate >= t.Red:
+		return health.Red
+	case burnRate >= t.Yellow:
+		return health.Yellow
+	default:
+		return health.Green
+	}
+}
+
+// AvailabilitySLI measures availability as the ratio of requests that did not fail. The total and error counts are
+// sourced from prometheus counters - they may be the same counter with different label selectors. If multiple series
+// match the labels, then their values are summed.
+type AvailabilitySLI struct {
+	TotalMetricID string
+	TotalLabels   map[string]string
+	ErrorMetricID string
+	ErrorLabels   map[string]string
+}
+
+// LatencySLI measures latency as the ratio of requests that completed within the threshold. The counts are sourced from
+// a prometheus histogram, i.e., the threshold must be one of the histogram bucket upper bounds.
+type LatencySLI struct {
+	MetricID  string
+	Labels    map[string]string
+	Threshold time.Duration
+}
+
+// SLO declares a service level objective that is tracked against request metrics. The error budget burn rate is
+// computed over a long and a short sliding window, and mapped to a health check status via the thresholds. The health
+// check only flips when both windows cross a threshold, i.e., the long window detects significant budget consumption,
+// and the short window ensures that the check recovers soon after the problem is resolved.
+//
+// Exactly one of `Availability` or `Latency` must be specified.
+//
+// The metrics are sampled in the background on the `SampleInterval`, and the health check reports the burn rates as
+// of the latest sample - see `ErrorRateHealthCheck`.
+type SLO struct {
+	// Check is registered with the SLOHealthCheckTag added to its tags. The health check ID identifies the SLO.
+	Check health.Check
+	// RunInterval is optional - if zero, then the health check default run interval is used
+	RunInterval time.Duration
+
+	// Objective is the target ratio of good requests in the range (0, 1), e.g., 0.999
+	Objective    float64
+	Availability *AvailabilitySLI
+	Latency      *LatencySLI
+
+	// LongWindow is optional - if zero, then DefaultSLOLongWindow is used
+	LongWindow time.Duration
+	// ShortWindow is optional - if zero, then DefaultSLOShortWindow is used
+	ShortWindow time.Duration
+	// SampleInterval is optional - if zero, then DefaultSLOSampleInterval is used
+	SampleInterval time.Duration
+	// Thresholds are optional - if zero, then DefaultSLOBurnRateThresholds() are used
+	Thresholds SLOBurnRateThresholds
+}
+
+func (s SLO) withDefaults() SLO {
+	if s.LongWindow == 0 {
+		s.LongWindow = DefaultSLOLongWindow
+	}
+	if s.ShortWindow == 0 {
+		s.ShortWindow = DefaultSLOShortWindow
+	}
+	if s.SampleInterval == 0 {
+		s.SampleInterval = DefaultSLOSampleInterval
+	}
+	if s.Thresholds == (SLOBurnRateThresholds{}) {
+		s.Thresholds = DefaultSLOBurnRateThresholds()
+	}
+	s.Check.Tags = append(append([]string(nil), s.Check.Tags...), SLOHealthCheckTag)
+	if strings.TrimSpace(s.Check.Description) == "" {
+		switch {
+		case s.Availability != nil:
+			s.Check.Description = fmt.Sprintf("availability SLO: %v of %s", s.Objective, s.Availability.TotalMetricID)
+		case s.Latency != nil:
+			s.Check.Description = fmt.Sprintf("latency SLO: %v of %s within %s", s.Objective, s.Latency.MetricID, s.Latency.Threshold)
+		}
+	}
+	return s
+}
+
+func (s SLO) validate() error {
+	var err error
+	invalid := func(format string, args ...interface{}) {
+		err = multierr.Append(err, fmt.Errorf("%s : %s : %s", ErrInvalidSLO, fmt.Sprintf(format, args...), s.Check.ID))
+	}
+	if _, e := ulids.Parse(s.Check.ID); e != nil {
+		err = multierr.Append(err, fmt.Errorf("%s : health check ID must be a ULID : %q", ErrInvalidSLO, s.Check.ID))
+	}
+	if s.Objective <= 0 || s.Objective >= 1 {
+		invalid("Objective must be in the range (0, 1) : %v", s.Objective)
+	}
+	switch {
+	case (s.Availability == nil) == (s.Latency == nil):
+		invalid("exactly 1 of Availability or Latency must be specified")
+	case s.Availability != nil:
+		if strings.TrimSpace(s.Availability.TotalMetricID) == "" || strings.TrimSpace(s.Availability.ErrorMetricID) == "" {
+			invalid("TotalMetricID and ErrorMetricID are required")
+		}
+	case s.Latency != nil:
+		if strings.TrimSpace(s.Latency.MetricID) == "" {
+			invalid("latency MetricID is required")
+		}
+		if s.Latency.Threshold <= 0 {
+			invalid("latency Threshold must be greater than 0")
+		}
+	}
+	if s.LongWindow < 0 || s.ShortWindow < 0 || s.SampleInterval < 0 {
+		invalid("LongWindow, ShortWindow, and SampleInterval must not be negative")
+	}
+	if s.LongWindow != 0 && s.ShortWindow != 0 && s.ShortWindow > s.LongWindow {
+		invalid("ShortWindow must not be greater than LongWindow")
+	}
+	if s.Thresholds != (SLOBurnRateThresholds{}) && (s.Thresholds.Yellow <= 0 || s.Thresholds.Yellow > s.Thresholds.Red) {
+		invalid("thresholds must satisfy: 0 < Yellow <= Red : %#v", s.Thresholds)
+	}
+	return err
+}
+
+// returns the total and bad request counts
+func (s SLO) counts(mfs []*dto.MetricFamily) (total, bad float64, err error) {
+	if s.Latency != nil {
+		return s.Latency.counts(mfs)
+	}
+	if total, err = sumCounter(mfs, s.Availability.TotalMetricID, s.Availability.TotalLabels); err != nil {
+		return 0, 0, err
+	}
+	if bad, err = sumCounter(mfs, s.Availability.ErrorMetricID, s.Availability.ErrorLabels); err != nil {
+		return 0, 0, err
+	}
+	return total, bad, nil
+}
+
+func (sli LatencySLI) counts(mfs []*dto.MetricFamily) (total, bad float64, err error) {
+	mf := FindMetricFamily(mfs, func(mf *dto.MetricFamily) bool {
+		return mf.GetName() == sli.MetricID
+	})
+	if mf == nil {
+		return 0, 0, nil
+	}
+	if mf.GetType() != dto.MetricType_HISTOGRAM {
+		return 0, 0, fmt.Errorf("%s : %s", errMetricIsNotHistogram, sli.MetricID)
+	}
+	threshold := sli.Threshold.Seconds()
+	for _, m := range mf.GetMetric() {
+		if !matchLabels(m, sli.Labels) {
+			continue
+		}
+		histogram := m.GetHistogram()
+		good, ok := 0.0, false
+		for _, bucket := range histogram.GetBucket() {
+			if math.Abs(bucket.GetUpperBound()-threshold) < 1e-9 {
+				good, ok = float64(bucket.GetCumulativeCount()), true
+				break
+			}
+		}
+		if !ok {
+			return 0, 0, fmt.Errorf("%s : %s : %s", errLatencyThresholdNotBucket, sli.MetricID, sli.Threshold)
+		}
+		total += float64(histogram.GetSampleCount())
+		bad += float64(histogram.GetSampleCount()) - good
+	}
+	return total, bad, nil
+}
+
+// returns the sum of the counter series that match the labels
+func sumCounter(mfs []*dto.MetricFamily, metricID string, labels map[string]string) (float64, error) {
+	return ErrorRateHealthCheck{MetricID: metricID, Labels: labels}.count(mfs)
+}
+
+type sloSample struct {
+	time       time.Time
+	total, bad float64
+}
+
+// sloWindow retains the samples that are needed to compute the burn rates over the long window
+type sloWindow struct {
+	long, short time.Duration
+	objective   float64
+	samples     []sloSample
+}
+
+// add records the sample, and returns the burn rates over the long and short windows
+func (w *sloWindow) add(sample sloSample) (long, short float64) {
+	// the counters were reset
+	if n := len(w.samples); n > 0 && (sample.total < w.samples[n-1].total || sample.bad < w.samples[n-1].bad) {
+		w.samples = w.samples[:0]
+	}
+	w.samples = append(w.samples, sample)
+	w.samples = w.samples[w.baseline(sample.time, w.long):]
+	return w.burnRate(sample, w.long), w.burnRate(sample, w.short)
+}
+
+// returns the index of the newest sample that is at least the window old, or else the oldest sample
+func (w *sloWindow) baseline(now time.Time, window time.Duration) int {
+	cutoff := now.Add(-window)
+	i := 0
+	for i < len(w.samples)-1 && !w.samples[i+1].time.After(cutoff) {
+		i++
+	}
+	return i
+}
+
+func (w *sloWindow) burnRate(sample sloSample, window time.Duration) float64 {
+	baseline := w.samples[w.baseline(sample.time, window)]
+	total := sample.total - baseline.total
+	if total <= 0 {
+		return 0
+	}
+	errorRatio := (sample.bad - baseline.bad) / total
+	return errorRatio / (1 - w.objective)
+}
+
+// sloTracker samples the SLO metrics and retains the latest health check status
+type sloTracker struct {
+	slo       SLO
+	gatherer  prometheus.Gatherer
+	clock     clock.Clock
+	burnRates *prometheus.GaugeVec
+
+	mutex  sync.Mutex
+	window *sloWindow
+	status health.Status
+	err    error
+}
+
+func newSLOTracker(slo SLO, gatherer prometheus.Gatherer, clock clock.Clock, burnRates *prometheus.GaugeVec) *sloTracker {
+	return &sloTracker{
+		slo:       slo,
+		gatherer:  gatherer,
+		clock:     clock,
+		burnRates: burnRates,
+		window: &sloWindow{
+			long:      slo.LongWindow,
+			short:     slo.ShortWindow,
+			objective: slo.Objective,
+		},
+	}
+}
+
+func (t *sloTracker) sample() {
+	t.mutex.Lock()
+	defer t.mutex.Unlock()
+	t.status, t.err = func() (health.Status, error) {
+		mfs, gatherErr := t.gatherer.Gather()
+		total, bad, err := t.slo.counts(mfs)
+		if err != nil {
+			return health.Red, err
+		}
+		// metrics are gathered on a best effort basis, i.e., collector errors only matter if the metrics are not found
+		if total == 0 && gatherErr != nil {
+			return health.Red, gatherErr
+		}
+		long, short := t.window.add(sloSample{time: t.clock.Now(), total: total, bad: bad})
+		t.burnRates.WithLabelValues(t.slo.Check.ID, SLOLongWindow).Set(long)
+		t.burnRates.WithLabelValues(t.slo.Check.ID, SLOShortWindow).Set(short)
+		status := t.slo.Thresholds.status(math.Min(long, short))
+		if status == health.Green {
+			return status, nil
+		}
+		return status, fmt.Errorf("SLO error budget burn rate is %.2fx over %s and %.2fx over %s", long, t.slo.LongWindow, short, t.slo.ShortWindow)
+	}()
+}
+
+func (t *sloTracker) checker(ctx context.Context) (health.Status, error) {
+	t.mutex.Lock()
+	defer t.mutex.Unlock()
+	return t.status, t.err
+}
+
+func (t *sloTracker) run(stop <-chan struct{}) {
+	timer := t.clock.NewTimer(t.slo.SampleInterval)
+	defer timer.Stop()
+	for {
+		t.sample()
+		select {
+		case <-stop:
+			return
+		case <-timer.C():
+			timer.Reset(t.slo.SampleInterval)
+		}
+	}
+}
+
+// registers the SLO health checks and burn rate metrics, and samples the SLO metrics in the background while the app is
+// running
+func registerSLOs(slos []SLO) func(lc fx.Lifecycle, register health.Register, registerer prometheus.Registerer, gatherer prometheus.Gatherer, clock clock.Clock) error {
+	return func(lc fx.Lifecycle, register health.Register, registerer prometheus.Registerer, gatherer prometheus.Gatherer, clock clock.Clock) error {
+		burnRates := prometheus.NewGaugeVec(prometheus.GaugeOpts{
+			Name: SLOBurnRateMetricID,
+			Help: "SLO error budget burn rate",
+		}, []string{"slo", "window"})
+		err := registerer.Register(burnRates)
+		stop := make(chan struct{})
+		trackers := make([]*sloTracker, 0, len(slos))
+		for _, slo := range slos {
+			slo = slo.withDefaults()
+			tracker := newSLOTracker(slo, gatherer, clock, burnRates)
+			trackers = append(trackers, tracker)
+			err = multierr.Append(err, register(slo.Check, health.CheckerOpts{RunInterval: slo.RunInterval}, tracker.checker))
+		}
+		lc.Append(fx.Hook{
+			OnStart: func(context.Context) error {
+				for _, tracker := range trackers {
+					go tracker.run(stop)
+				}
+				return nil
+			},
+			OnStop: func(context.Context) error {
+				close(stop)
+				return nil
+			},
+		})
+		return err
+	}
+}
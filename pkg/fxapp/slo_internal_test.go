@@ -0,0 +1,159 @@
+/*
+ * Copyright (c) 2019 OysterPack, Inc.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ * http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package fxapp
+
+import (
+	"context"
+	"github.com/oysterpack/andiamo/pkg/clock"
+	"github.com/oysterpack/andiamo/pkg/fx/health"
+	"github.com/prometheus/client_golang/prometheus"
+	dto "github.com/prometheus/client_model/go"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"testing"
+	"time"
+)
+
+func TestSLOWindow(t *testing.T) {
+	t.Parallel()
+
+	start := time.Now()
+	window := &sloWindow{long: time.Hour, short: 5 * time.Minute, objective: 0.99}
+	sample := func(offset time.Duration, total, bad float64) (float64, float64) {
+		return window.add(sloSample{time: start.Add(offset), total: total, bad: bad})
+	}
+
+	long, short := sample(0, 0, 0)
+	assert.Zero(t, long)
+	assert.Zero(t, short)
+	// 1% errors burns the error budget at exactly 1x
+	long, short = sample(time.Minute, 1000, 10)
+	assert.InDelta(t, 1, long, 0.0001)
+	assert.InDelta(t, 1, short, 0.0001)
+	// 10% errors over the last 5 min
+	long, short = sample(10*time.Minute, 2000, 110)
+	assert.InDelta(t, 5.5, long, 0.0001)
+	assert.InDelta(t, 10, short, 0.0001)
+	// no requests over the last 5 min
+	long, short = sample(20*time.Minute, 2000, 110)
+	assert.InDelta(t, 5.5, long, 0.0001)
+	assert.Zero(t, short)
+	// counter reset
+	long, short = sample(21*time.Minute, 10, 10)
+	assert.Zero(t, long)
+	assert.Zero(t, short)
+	assert.Len(t, window.samples, 1)
+}
+
+func TestSLOTracker_Availability(t *testing.T) {
+	t.Parallel()
+
+	const MetricID = "U01DJ3HV6WJKW1161N0PTJ4QWPA"
+	registry := prometheus.NewRegistry()
+	requests := prometheus.NewCounterVec(prometheus.CounterOpts{Name: MetricID, Help: "requests"}, []string{"code"})
+	require.NoError(t, registry.Register(requests))
+	burnRates := prometheus.NewGaugeVec(prometheus.GaugeOpts{Name: SLOBurnRateMetricID, Help: "burn rate"}, []string{"slo", "window"})
+	require.NoError(t, registry.Register(burnRates))
+
+	fakeClock := clock.NewFake(time.Now())
+	slo := SLO{
+		Check:     health.Check{ID: "01DJ3HV70V3CTK08V9J9CKCAGS"},
+		Objective: 0.99,
+		Availability: &AvailabilitySLI{
+			TotalMetricID: MetricID,
+			ErrorMetricID: MetricID,
+			ErrorLabels:   map[string]string{"code": "500"},
+		},
+	}.withDefaults()
+	tracker := newSLOTracker(slo, registry, fakeClock, burnRates)
+	checkStatus := func(expected health.Status) {
+		status, err := tracker.checker(context.Background())
+		assert.Equal(t, expected, status)
+		assert.Equal(t, status != health.Green, err != nil)
+	}
+
+	tracker.sample()
+	checkStatus(health.Green)
+
+	// 10% errors -> 10x burn rate
+	requests.WithLabelValues("200").Add(900)
+	requests.WithLabelValues("500").Add(100)
+	fakeClock.Advance(time.Minute)
+	tracker.sample()
+	checkStatus(health.Yellow)
+
+	// 50% errors -> 50x burn rate
+	requests.WithLabelValues("500").Add(2000)
+	requests.WithLabelValues("200").Add(1000)
+	fakeClock.Advance(time.Minute)
+	tracker.sample()
+	checkStatus(health.Red)
+	gauge := &dto.Metric{}
+	require.NoError(t, burnRates.WithLabelValues(slo.Check.ID, SLOLongWindow).Write(gauge))
+	assert.InDelta(t, 52.5, gauge.GetGauge().GetValue(), 0.0001)
+
+	// once the errors stop, the short window recovers quickly even though the long window is still burning
+	for i := 0; i < 6; i++ {
+		requests.WithLabelValues("200").Add(1000)
+		fakeClock.Advance(time.Minute)
+		tracker.sample()
+	}
+	checkStatus(health.Green)
+	require.NoError(t, burnRates.WithLabelValues(slo.Check.ID, SLOLongWindow).Write(gauge))
+	assert.True(t, gauge.GetGauge().GetValue() > 0)
+}
+
+func TestSLOTracker_Latency(t *testing.T) {
+	t.Parallel()
+
+	const MetricID = "U01DJ3HV6WJKW1161N0PTJ4QWPA"
+	registry := prometheus.NewRegistry()
+	latency := prometheus.NewHistogram(prometheus.HistogramOpts{Name: MetricID, Help: "latency", Buckets: []float64{0.1, 0.25, 1}})
+	require.NoError(t, registry.Register(latency))
+	burnRates := prometheus.NewGaugeVec(prometheus.GaugeOpts{Name: SLOBurnRateMetricID, Help: "burn rate"}, []string{"slo", "window"})
+
+	fakeClock := clock.NewFake(time.Now())
+	newTracker := func(threshold time.Duration) *sloTracker {
+		return newSLOTracker(SLO{
+			Check:     health.Check{ID: "01DJ3HV70V3CTK08V9J9CKCAGS"},
+			Objective: 0.9,
+			Latency:   &LatencySLI{MetricID: MetricID, Threshold: threshold},
+		}.withDefaults(), registry, fakeClock, burnRates)
+	}
+	tracker := newTracker(250 * time.Millisecond)
+	tracker.sample()
+	for i := 0; i < 10; i++ {
+		latency.Observe(0.05)
+		latency.Observe(0.5)
+	}
+	fakeClock.Advance(time.Minute)
+	tracker.sample()
+	// 50% of the requests are slow, i.e., the error budget is burning at 5x
+	status, err := tracker.checker(context.Background())
+	assert.Equal(t, health.Green, status)
+	assert.NoError(t, err)
+	gauge := &dto.Metric{}
+	require.NoError(t, burnRates.WithLabelValues(tracker.slo.Check.ID, SLOShortWindow).Write(gauge))
+	assert.InDelta(t, 5, gauge.GetGauge().GetValue(), 0.0001)
+
+	// the threshold must be a bucket upper bound
+	tracker = newTracker(200 * time.Millisecond)
+	tracker.sample()
+	status, err = tracker.checker(context.Background())
+	assert.Equal(t, health.Red, status)
+	assert.Error(t, err)
+}
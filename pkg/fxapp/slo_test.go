@@ -0,0 +1,136 @@
+/*
+ * Copyright (c) 2019 OysterPack, Inc.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ * http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package fxapp_test
+
+import (
+	"github.com/oysterpack/andiamo/pkg/fx/health"
+	"github.com/oysterpack/andiamo/pkg/fxapp"
+	"github.com/oysterpack/andiamo/pkg/ulids"
+	"github.com/prometheus/client_golang/prometheus"
+	dto "github.com/prometheus/client_model/go"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"io/ioutil"
+	"testing"
+	"time"
+)
+
+func TestEnableSLOs(t *testing.T) {
+	t.Parallel()
+
+	const RequestsMetricID = "U01DJ3HV6WJKW1161N0PTJ4QWPA"
+	sloID := ulids.MustNew().String()
+	requests := prometheus.NewCounterVec(prometheus.CounterOpts{Name: RequestsMetricID, Help: "requests"}, []string{"code"})
+
+	var registeredChecks health.RegisteredChecks
+	var gatherer prometheus.Gatherer
+	app, err := fxapp.NewBuilder(fxapp.ID(ulids.MustNew()), fxapp.ReleaseID(ulids.MustNew())).
+		EnableSLOs(fxapp.SLO{
+			Check:     health.Check{ID: sloID},
+			Objective: 0.999,
+			Availability: &fxapp.AvailabilitySLI{
+				TotalMetricID: RequestsMetricID,
+				ErrorMetricID: RequestsMetricID,
+				ErrorLabels:   map[string]string{"code": "500"},
+			},
+			SampleInterval: 10 * time.Millisecond,
+		}).
+		Invoke(func(registerer prometheus.Registerer) error {
+			return registerer.Register(requests)
+		}).
+		Populate(&registeredChecks, &gatherer).
+		LogWriter(ioutil.Discard).
+		DisableHTTPServer().
+		Build()
+	require.NoError(t, err)
+
+	go app.Run()
+	defer func() {
+		app.Shutdown()
+		<-app.Done()
+	}()
+	<-app.Ready()
+
+	registered := false
+	for _, check := range <-registeredChecks(health.Query{}) {
+		if check.ID == sloID {
+			registered = true
+			assert.Equal(t, []string{fxapp.SLOHealthCheckTag}, check.Tags)
+			assert.Contains(t, check.Description, RequestsMetricID)
+		}
+	}
+	require.True(t, registered)
+
+	burnRates := func() map[string]float64 {
+		mfs, err := gatherer.Gather()
+		require.NoError(t, err)
+		rates := make(map[string]float64)
+		mf := fxapp.FindMetricFamily(mfs, func(mf *dto.MetricFamily) bool {
+			return mf.GetName() == fxapp.SLOBurnRateMetricID
+		})
+		if mf == nil {
+			return rates
+		}
+		for _, m := range mf.GetMetric() {
+			labels := make(map[string]string)
+			for _, label := range m.GetLabel() {
+				labels[label.GetName()] = label.GetValue()
+			}
+			assert.Equal(t, sloID, labels["slo"])
+			rates[labels["window"]] = m.GetGauge().GetValue()
+		}
+		return rates
+	}
+	for timeout := time.After(5 * time.Second); burnRates()[fxapp.SLOShortWindow] == 0; {
+		select {
+		case <-timeout:
+			t.Fatal("burn rate was not reported")
+		case <-time.After(10 * time.Millisecond):
+			// half of the requests fail
+			requests.WithLabelValues("200").Inc()
+			requests.WithLabelValues("500").Inc()
+		}
+	}
+	rates := burnRates()
+	assert.InDelta(t, 500, rates[fxapp.SLOShortWindow], 0.0001)
+	assert.InDelta(t, 500, rates[fxapp.SLOLongWindow], 0.0001)
+}
+
+func TestEnableSLOs_Invalid(t *testing.T) {
+	t.Parallel()
+
+	availability := &fxapp.AvailabilitySLI{TotalMetricID: "U01DJ3HV6WJKW1161N0PTJ4QWPA", ErrorMetricID: "U01DJ3HV6WJKW1161N0PTJ4QWPA"}
+	latency := &fxapp.LatencySLI{MetricID: "U01DJ3HV6WJKW1161N0PTJ4QWPA", Threshold: time.Second}
+	slos := []fxapp.SLO{
+		{Check: health.Check{ID: "invalid"}, Objective: 0.99, Availability: availability},
+		{Check: health.Check{ID: ulids.MustNew().String()}, Objective: 1, Availability: availability},
+		{Check: health.Check{ID: ulids.MustNew().String()}, Objective: 0.99},
+		{Check: health.Check{ID: ulids.MustNew().String()}, Objective: 0.99, Availability: availability, Latency: latency},
+		{Check: health.Check{ID: ulids.MustNew().String()}, Objective: 0.99, Latency: &fxapp.LatencySLI{MetricID: "U01DJ3HV6WJKW1161N0PTJ4QWPA"}},
+		{Check: health.Check{ID: ulids.MustNew().String()}, Objective: 0.99, Availability: availability, LongWindow: time.Minute, ShortWindow: time.Hour},
+		{Check: health.Check{ID: ulids.MustNew().String()}, Objective: 0.99, Availability: availability, Thresholds: fxapp.SLOBurnRateThresholds{Yellow: 5, Red: 1}},
+	}
+	for _, slo := range slos {
+		_, err := fxapp.NewBuilder(fxapp.ID(ulids.MustNew()), fxapp.ReleaseID(ulids.MustNew())).
+			EnableSLOs(slo).
+			Invoke(func() {}).
+			DisableHTTPServer().
+			Build()
+		require.Error(t, err)
+		assert.Contains(t, err.Error(), fxapp.ErrInvalidSLO.Error())
+	}
+}
@@ -0,0 +1,250 @@
+/*
+ * Copyright (c) 2019 OysterPack, Inc.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ * http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package fxapp
+
+import (
+	"errors"
+	"fmt"
+	"github.com/oklog/ulid"
+	"go.uber.org/multierr"
+	"sync"
+)
+
+// Supervisor related errors
+var (
+	ErrSupervisorNoApps            = errors.New("supervisor requires at least 1 app")
+	ErrSupervisorNilApp            = errors.New("supervised app must not be nil")
+	ErrSupervisorAppAlreadyAdded   = errors.New("app is already supervised")
+	ErrSupervisorAppAlreadyStarted = errors.New("supervised app must not be started")
+	ErrSupervisorAlreadyRun        = errors.New("supervisor cannot be run again after it has already been run")
+	ErrSupervisorNotRunning        = errors.New("supervisor can only be shutdown after it has been run")
+)
+
+// Supervisor coordinates the lifecycles of multiple apps that are hosted in the same process, e.g., modular monoliths
+// and integration test rigs:
+//   - the apps are started in order, i.e., each app is started after the previous app has started
+//   - the supervisor is ready when all of the apps are ready
+//   - when any app stops, e.g., because it is health critical, then the other apps are shutdown in reverse order
+//   - if an app fails to start, then the apps that were already started are shutdown in reverse order
+//
+// Each app is isolated, i.e., it has its own instance ID, logger, metrics registry, HTTP server, and dependency graph.
+// The HTTP servers must be bound to distinct addresses, e.g., ":0" or per app env prefixes - see
+// `Builder.SetHTTPServerAddr()` and `Builder.SetEnvPrefix()`.
+//
+// NOTE: the zerolog global level and the go standard log output are process wide, i.e., they are set by the app that was
+// built last. OS signals are delivered to all of the apps, i.e., the apps shutdown concurrently on SIGINT or SIGTERM.
+type Supervisor interface {
+	// Apps returns the supervised apps in start order
+	Apps() []App
+
+	// Run starts the apps and blocks until all of the apps are shutdown. The app Run errors are combined.
+	Run() error
+	// Shutdown signals the supervisor to shutdown the apps in reverse order. This method does not block.
+	//
+	// Shutdown can only be called after the supervisor has been run - otherwise an error is returned.
+	Shutdown() error
+	// ShutdownReason returns the reason why the apps are shutting down, i.e., the shutdown reason of the first app that
+	// stopped, or `ShutdownRequested` if the supervisor was shutdown. It is used to exit the process with the reason's
+	// exit code - see `ShutdownReason.ExitCode()`. False is returned if the supervisor is not shutting down.
+	ShutdownReason() (ShutdownReason, bool)
+
+	// Ready is closed when all of the apps are ready to serve requests
+	Ready() <-chan struct{}
+	// Done is closed when all of the apps are shutdown
+	Done() <-chan struct{}
+}
+
+// NewSupervisor constructs a new Supervisor for the apps, which are started in the specified order. The apps must not be
+// started, i.e., the supervisor runs the apps.
+func NewSupervisor(apps ...App) (Supervisor, error) {
+	if len(apps) == 0 {
+		return nil, ErrSupervisorNoApps
+	}
+	var err error
+	instanceIDs := make(map[InstanceID]bool, len(apps))
+	for i, app := range apps {
+		if app == nil {
+			err = multierr.Append(err, fmt.Errorf("%s : apps[%d]", ErrSupervisorNilApp, i))
+			continue
+		}
+		if instanceIDs[app.InstanceID()] {
+			err = multierr.Append(err, fmt.Errorf("%s : %s", ErrSupervisorAppAlreadyAdded, ulid.ULID(app.InstanceID())))
+		}
+		instanceIDs[app.InstanceID()] = true
+		select {
+		case <-app.Starting():
+			err = multierr.Append(err, fmt.Errorf("%s : %s", ErrSupervisorAppAlreadyStarted, ulid.ULID(app.InstanceID())))
+		default:
+		}
+	}
+	if err != nil {
+		return nil, err
+	}
+	return &supervisor{
+		apps:     append([]App(nil), apps...),
+		shutdown: make(chan struct{}),
+		ready:    make(chan struct{}),
+		done:     make(chan struct{}),
+	}, nil
+}
+
+type supervisor struct {
+	apps []App
+
+	shutdown     chan struct{}
+	shutdownOnce sync.Once
+	ready, done  chan struct{}
+
+	mutex   sync.Mutex
+	running bool
+	reason  *ShutdownReason
+}
+
+// supervisedApp tracks the app Run result
+type supervisedApp struct {
+	App
+	err    error
+	exited chan struct{}
+}
+
+func (s *supervisor) Apps() []App {
+	return append([]App(nil), s.apps...)
+}
+
+func (s *supervisor) Run() error {
+	s.mutex.Lock()
+	if s.running {
+		s.mutex.Unlock()
+		return ErrSupervisorAlreadyRun
+	}
+	s.running = true
+	s.mutex.Unlock()
+	defer close(s.done)
+
+	// the index of the first app that exits is sent
+	exited := make(chan int, len(s.apps))
+	var launched []*supervisedApp
+	run := func(i int) *supervisedApp {
+		app := &supervisedApp{App: s.apps[i], exited: make(chan struct{})}
+		go func() {
+			app.err = app.Run()
+			close(app.exited)
+			exited <- i
+		}()
+		launched = append(launched, app)
+		return app
+	}
+
+	// the apps are started in order
+	stopped := -1
+START:
+	for i := range s.apps {
+		app := run(i)
+		select {
+		case <-app.Started():
+		case stopped = <-exited:
+			break START
+		case <-s.shutdown:
+			break START
+		}
+	}
+
+	if len(launched) == len(s.apps) && stopped < 0 {
+		go s.waitUntilReady()
+		select {
+		case stopped = <-exited:
+		case <-s.shutdown:
+		}
+	}
+	if stopped >= 0 {
+		s.recordShutdownReason(launched[stopped])
+	} else {
+		s.recordShutdownReason(nil)
+	}
+
+	// the apps are shutdown in reverse order
+	var err error
+	for i := len(launched) - 1; i >= 0; i-- {
+		app := launched[i]
+		select {
+		case <-app.exited:
+		case <-app.Started():
+			app.Shutdown()
+		}
+		<-app.exited
+		if app.err != nil {
+			err = multierr.Append(err, fmt.Errorf("app %s : %s", ulid.ULID(app.InstanceID()), app.err))
+		}
+	}
+	return err
+}
+
+func (s *supervisor) waitUntilReady() {
+	for _, app := range s.apps {
+		select {
+		case <-app.Ready():
+		case <-s.done:
+			return
+		}
+	}
+	close(s.ready)
+}
+
+// recordShutdownReason records the shutdown reason of the app that stopped first. If no app stopped, then the
+// supervisor was shutdown.
+func (s *supervisor) recordShutdownReason(app *supervisedApp) {
+	reason := ShutdownReason{Code: ShutdownRequested}
+	if app != nil {
+		if appReason, ok := app.ShutdownReason(); ok {
+			reason = appReason
+		} else if app.err != nil {
+			// the app failed to start
+			reason = ShutdownReason{Code: ShutdownFatalError, Msg: app.err.Error()}
+		}
+	}
+	s.mutex.Lock()
+	s.reason = &reason
+	s.mutex.Unlock()
+}
+
+func (s *supervisor) Shutdown() error {
+	s.mutex.Lock()
+	running := s.running
+	s.mutex.Unlock()
+	if !running {
+		return ErrSupervisorNotRunning
+	}
+	s.shutdownOnce.Do(func() { close(s.shutdown) })
+	return nil
+}
+
+func (s *supervisor) ShutdownReason() (ShutdownReason, bool) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	if s.reason == nil {
+		return ShutdownReason{}, false
+	}
+	return *s.reason, true
+}
+
+func (s *supervisor) Ready() <-chan struct{} {
+	return s.ready
+}
+
+func (s *supervisor) Done() <-chan struct{} {
+	return s.done
+}
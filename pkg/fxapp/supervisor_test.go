@@ -0,0 +1,143 @@
+/*
+ * Copyright (c) 2019 OysterPack, Inc.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ * http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package fxapp_test
+
+import (
+	"context"
+	"errors"
+	"github.com/oysterpack/andiamo/pkg/fxapp"
+	"github.com/oysterpack/andiamo/pkg/ulids"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.uber.org/fx"
+	"io/ioutil"
+	"sync"
+	"testing"
+)
+
+// lifecycleLog records the app lifecycle hooks in the order that they were run
+type lifecycleLog struct {
+	sync.Mutex
+	hooks []string
+}
+
+func (l *lifecycleLog) append(hook string) {
+	l.Lock()
+	defer l.Unlock()
+	l.hooks = append(l.hooks, hook)
+}
+
+func newSupervisedApp(t *testing.T, name string, log *lifecycleLog, startErr error) fxapp.App {
+	app, err := fxapp.NewBuilder(fxapp.ID(ulids.MustNew()), fxapp.ReleaseID(ulids.MustNew())).
+		Invoke(func(lc fx.Lifecycle) {
+			lc.Append(fx.Hook{
+				OnStart: func(context.Context) error {
+					log.append(name + " started")
+					return startErr
+				},
+				OnStop: func(context.Context) error {
+					log.append(name + " stopped")
+					return nil
+				},
+			})
+		}).
+		SetHTTPServerAddr(":0").
+		LogWriter(ioutil.Discard).
+		Build()
+	require.NoError(t, err)
+	return app
+}
+
+func TestSupervisor(t *testing.T) {
+	t.Parallel()
+
+	t.Run("supervisor shutdown", func(t *testing.T) {
+		log := &lifecycleLog{}
+		foo, bar := newSupervisedApp(t, "foo", log, nil), newSupervisedApp(t, "bar", log, nil)
+		supervisor, err := fxapp.NewSupervisor(foo, bar)
+		require.NoError(t, err)
+		assert.Equal(t, []fxapp.App{foo, bar}, supervisor.Apps())
+		assert.Equal(t, fxapp.ErrSupervisorNotRunning, supervisor.Shutdown())
+
+		errs := make(chan error, 1)
+		go func() { errs <- supervisor.Run() }()
+		<-supervisor.Ready()
+		assert.NotEqual(t, foo.InstanceID(), bar.InstanceID())
+		require.NoError(t, supervisor.Shutdown())
+		<-supervisor.Done()
+		require.NoError(t, <-errs)
+
+		assert.Equal(t, []string{"foo started", "bar started", "bar stopped", "foo stopped"}, log.hooks)
+		reason, ok := supervisor.ShutdownReason()
+		require.True(t, ok)
+		assert.Equal(t, fxapp.ShutdownRequested, reason.Code)
+		assert.Equal(t, fxapp.ErrSupervisorAlreadyRun, supervisor.Run())
+	})
+
+	t.Run("app shutdown stops the other apps", func(t *testing.T) {
+		log := &lifecycleLog{}
+		foo, bar, baz := newSupervisedApp(t, "foo", log, nil), newSupervisedApp(t, "bar", log, nil), newSupervisedApp(t, "baz", log, nil)
+		supervisor, err := fxapp.NewSupervisor(foo, bar, baz)
+		require.NoError(t, err)
+
+		errs := make(chan error, 1)
+		go func() { errs <- supervisor.Run() }()
+		<-supervisor.Ready()
+		require.NoError(t, bar.Shutdown())
+		<-supervisor.Done()
+		require.NoError(t, <-errs)
+
+		assert.Equal(t, []string{"foo started", "bar started", "baz started", "bar stopped", "baz stopped", "foo stopped"}, log.hooks)
+		reason, ok := supervisor.ShutdownReason()
+		require.True(t, ok)
+		assert.Equal(t, fxapp.ShutdownRequested, reason.Code)
+	})
+
+	t.Run("app start failure stops the started apps", func(t *testing.T) {
+		log := &lifecycleLog{}
+		startErr := errors.New("BOOM")
+		foo, bar, baz := newSupervisedApp(t, "foo", log, nil), newSupervisedApp(t, "bar", log, startErr), newSupervisedApp(t, "baz", log, nil)
+		supervisor, err := fxapp.NewSupervisor(foo, bar, baz)
+		require.NoError(t, err)
+
+		err = supervisor.Run()
+		require.Error(t, err)
+		assert.Contains(t, err.Error(), startErr.Error())
+		assert.Equal(t, []string{"foo started", "bar started", "foo stopped"}, log.hooks)
+		reason, ok := supervisor.ShutdownReason()
+		require.True(t, ok)
+		assert.Equal(t, fxapp.ShutdownFatalError, reason.Code)
+		select {
+		case <-baz.Starting():
+			t.Error("*** baz should not have been started")
+		default:
+		}
+	})
+}
+
+func TestNewSupervisor_Invalid(t *testing.T) {
+	t.Parallel()
+
+	_, err := fxapp.NewSupervisor()
+	assert.Equal(t, fxapp.ErrSupervisorNoApps, err)
+
+	foo := newSupervisedApp(t, "foo", &lifecycleLog{}, nil)
+	_, err = fxapp.NewSupervisor(foo, nil, foo)
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), fxapp.ErrSupervisorNilApp.Error())
+	assert.Contains(t, err.Error(), fxapp.ErrSupervisorAppAlreadyAdded.Error())
+}
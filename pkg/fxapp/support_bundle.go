@@ -0,0 +1,258 @@
+/*
+ * Copyright (c) 2019 OysterPack, Inc.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ * http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package fxapp
+
+import (
+	"archive/tar"
+	"bytes"
+	"compress/gzip"
+	"encoding/json"
+	"fmt"
+	"github.com/oklog/ulid"
+	"github.com/oysterpack/andiamo/pkg/appdesc"
+	"github.com/oysterpack/andiamo/pkg/clock"
+	"github.com/oysterpack/andiamo/pkg/eventlog"
+	"github.com/oysterpack/andiamo/pkg/fx/health"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/common/expfmt"
+	"github.com/rs/zerolog"
+	"go.uber.org/fx"
+	"io"
+	"net/http"
+	"runtime"
+	"runtime/pprof"
+	"strings"
+	"time"
+)
+
+// SupportBundleEndpoint is used to construct the HTTP endpoint that returns the app support bundle, which is designed to
+// be attached to incident tickets - see `App.SupportBundle()`. The endpoint is admin only.
+const SupportBundleEndpoint = "01DJ5KRJKZ6Q3SYEMQY2EKMW39"
+
+// SupportBundleEvent is logged when a support bundle is generated
+//
+//	type Data struct {
+//		Files  []string `json:"files"`
+//		// the sources that failed to be collected - the errors are reported in the bundle's errors.txt file
+//		Errors []string `json:"errors,omitempty"`
+//	}
+const SupportBundleEvent = "01DJ5KRJR8X4FYD0B6HJ1SZQJK"
+
+// GzipMediaType is the gzip media type
+const GzipMediaType = "application/gzip"
+
+// support bundle files
+const (
+	// app descriptor, instance ID, and runtime info
+	SupportBundleAppFile = "app.json"
+	// effective config, with secrets redacted - the same config that is logged with the `InitializedEvent`
+	SupportBundleConfigFile = "config.json"
+	// the app dependency graph, in DOT format
+	SupportBundleDependenciesFile = "dependencies.dot"
+	// the current health check results
+	SupportBundleHealthFile = "health.json"
+	// the current metrics, in the Prometheus text format
+	SupportBundleMetricsFile = "metrics.txt"
+	// the recent log events as newline delimited JSON, oldest first - only if the replay buffer is enabled, see
+	// `Builder.EnableReplayBuffer()`
+	SupportBundleEventsFile = "events.ndjson"
+	// goroutine stacks
+	SupportBundleGoroutinesFile = "goroutines.txt"
+	// the sources that failed to be collected - only if any failed
+	SupportBundleErrorsFile = "errors.txt"
+)
+
+type supportBundleParams struct {
+	fx.In
+
+	Desc         appdesc.Desc
+	InstanceID   InstanceID
+	DotGraph     fx.DotGraph
+	CheckResults health.CheckResults
+	Gatherer     prometheus.Gatherer
+	Clock        clock.Clock
+	Logger       *zerolog.Logger
+	Replay       ReplayBuffer `optional:"true"`
+}
+
+// supportBundle collects the app state into a tar.gz archive. Collection is best effort, i.e., if a source fails to be
+// collected, then the error is reported in the bundle, and the remaining sources are still collected.
+type supportBundle struct {
+	params   supportBundleParams
+	logEvent eventlog.Logger
+	// the effective config is resolved after the app is built
+	config effectiveConfig
+}
+
+func newSupportBundle(params supportBundleParams) *supportBundle {
+	return &supportBundle{
+		params:   params,
+		logEvent: eventlog.NewLogger(SupportBundleEvent, params.Logger, zerolog.InfoLevel),
+	}
+}
+
+type supportBundleAppInfo struct {
+	ID         string    `json:"id"`
+	ReleaseID  string    `json:"release_id"`
+	InstanceID string    `json:"instance_id"`
+	Name       string    `json:"name,omitempty"`
+	Version    string    `json:"version"`
+	Time       time.Time `json:"time"`
+	GoVersion  string    `json:"go_version"`
+	Goroutines int       `json:"goroutines"`
+}
+
+type supportBundleFile struct {
+	name string
+	data []byte
+}
+
+type supportBundleGenerated struct {
+	files  []string
+	errors []string
+}
+
+func (e supportBundleGenerated) MarshalZerologObject(event *zerolog.Event) {
+	event.Strs("files", e.files)
+	if len(e.errors) > 0 {
+		event.Strs("errors", e.errors)
+	}
+}
+
+func (b *supportBundle) filename() string {
+	return fmt.Sprintf("support-bundle-%s-%d.tar.gz", ulid.ULID(b.params.InstanceID), b.params.Clock.Now().Unix())
+}
+
+func (b *supportBundle) collect() ([]supportBundleFile, []string) {
+	var files []supportBundleFile
+	var errs []string
+	add := func(name string, data []byte, err error) {
+		if err != nil {
+			errs = append(errs, fmt.Sprintf("%s : %s", name, err))
+			return
+		}
+		files = append(files, supportBundleFile{name, data})
+	}
+
+	appInfo, err := json.MarshalIndent(supportBundleAppInfo{
+		ID:         ulid.ULID(b.params.Desc.ID).String(),
+		ReleaseID:  ulid.ULID(b.params.Desc.ReleaseID).String(),
+		InstanceID: ulid.ULID(b.params.InstanceID).String(),
+		Name:       b.params.Desc.Name,
+		Version:    b.params.Desc.Version.String(),
+		Time:       b.params.Clock.Now().UTC(),
+		GoVersion:  runtime.Version(),
+		Goroutines: runtime.NumGoroutine(),
+	}, "", "  ")
+	add(SupportBundleAppFile, appInfo, err)
+
+	config := new(bytes.Buffer)
+	configLogger := zerolog.New(config)
+	configLogger.Log().EmbedObject(b.config).Msg("")
+	add(SupportBundleConfigFile, config.Bytes(), nil)
+
+	add(SupportBundleDependenciesFile, []byte(b.params.DotGraph), nil)
+
+	healthCheckResults, err := healthCheckResultsJSON(<-b.params.CheckResults(nil, health.Query{}))
+	add(SupportBundleHealthFile, healthCheckResults, err)
+
+	metrics := new(bytes.Buffer)
+	mfs, err := b.params.Gatherer.Gather()
+	// the gathered metrics are still collected on error, i.e., the error may be partial
+	for _, mf := range mfs {
+		if _, e := expfmt.MetricFamilyToText(metrics, mf); e != nil && err == nil {
+			err = e
+		}
+	}
+	if err != nil {
+		errs = append(errs, fmt.Sprintf("%s : %s", SupportBundleMetricsFile, err))
+	}
+	add(SupportBundleMetricsFile, metrics.Bytes(), nil)
+
+	if b.params.Replay != nil {
+		events := new(bytes.Buffer)
+		for _, event := range b.params.Replay.Events() {
+			events.Write(event)
+			events.WriteByte('\n')
+		}
+		add(SupportBundleEventsFile, events.Bytes(), nil)
+	}
+
+	goroutines := new(bytes.Buffer)
+	err = pprof.Lookup("goroutine").WriteTo(goroutines, 2)
+	add(SupportBundleGoroutinesFile, goroutines.Bytes(), err)
+
+	if len(errs) > 0 {
+		add(SupportBundleErrorsFile, []byte(strings.Join(errs, "\n")+"\n"), nil)
+	}
+	return files, errs
+}
+
+// writeTo writes the bundle as a tar.gz archive
+func (b *supportBundle) writeTo(w io.Writer) error {
+	files, errs := b.collect()
+	modTime := b.params.Clock.Now()
+	gz := gzip.NewWriter(w)
+	archive := tar.NewWriter(gz)
+	generated := supportBundleGenerated{errors: errs}
+	for _, file := range files {
+		header := &tar.Header{
+			Name:    file.name,
+			Mode:    0644,
+			Size:    int64(len(file.data)),
+			ModTime: modTime,
+		}
+		if err := archive.WriteHeader(header); err != nil {
+			return err
+		}
+		if _, err := archive.Write(file.data); err != nil {
+			return err
+		}
+		generated.files = append(generated.files, file.name)
+	}
+	if err := archive.Close(); err != nil {
+		return err
+	}
+	if err := gz.Close(); err != nil {
+		return err
+	}
+	b.logEvent(generated, "support bundle generated")
+	return nil
+}
+
+func supportBundleHTTPHandler(bundle *supportBundle) HTTPHandler {
+	return NewHTTPRoute(http.MethodGet, fmt.Sprintf("/%s", SupportBundleEndpoint), func(writer http.ResponseWriter, request *http.Request) {
+		// the bundle is buffered in order to report failures via the response status
+		body := new(bytes.Buffer)
+		if err := bundle.writeTo(body); err != nil {
+			http.Error(writer, err.Error(), http.StatusInternalServerError)
+			return
+		}
+		writer.Header().Set("Content-Type", GzipMediaType)
+		writer.Header().Set("Content-Disposition", fmt.Sprintf(`attachment; filename="%s"`, bundle.filename()))
+		writer.Write(body.Bytes())
+	}).WithDoc(OpenAPIOperation{
+		Summary:     "support bundle",
+		Description: "tar.gz archive of the app info, effective config, dependency graph, health check results, metrics, recent events, and goroutine stacks",
+		Tags:        []string{BuiltinOpenAPITag},
+		Responses:   []OpenAPIResponse{{Status: http.StatusOK, MediaTypes: []string{GzipMediaType}}},
+	}).AdminOnly()
+}
+
+func (a *app) SupportBundle(w io.Writer) error {
+	return a.bundle.writeTo(w)
+}
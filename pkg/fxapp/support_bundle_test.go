@@ -0,0 +1,118 @@
+/*
+ * Copyright (c) 2019 OysterPack, Inc.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ * http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package fxapp_test
+
+import (
+	"archive/tar"
+	"bytes"
+	"compress/gzip"
+	"encoding/json"
+	"github.com/oklog/ulid"
+	"github.com/oysterpack/andiamo/pkg/fxapp"
+	"github.com/oysterpack/andiamo/pkg/fxapptest"
+	"github.com/oysterpack/andiamo/pkg/ulids"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"os"
+	"testing"
+)
+
+// readSupportBundle returns the bundle files keyed by name
+func readSupportBundle(t *testing.T, r io.Reader) map[string]string {
+	gz, err := gzip.NewReader(r)
+	require.NoError(t, err)
+	archive := tar.NewReader(gz)
+	files := make(map[string]string)
+	for {
+		header, err := archive.Next()
+		if err == io.EOF {
+			return files
+		}
+		require.NoError(t, err)
+		data, err := ioutil.ReadAll(archive)
+		require.NoError(t, err)
+		files[header.Name] = string(data)
+	}
+}
+
+func TestApp_SupportBundle(t *testing.T) {
+	t.Parallel()
+
+	logs := fxapptest.NewLogCapture()
+	builder := fxapp.NewBuilder(fxapp.ID(ulids.MustNew()), fxapp.ReleaseID(ulids.MustNew())).
+		Invoke(func() {}).
+		EnableReplayBuffer(fxapp.ReplayBufferOpts{Size: 100, Dir: os.TempDir()}).
+		LogWriter(logs)
+
+	fxapptest.RunApp(t, builder, func(app fxapp.App, client *fxapptest.HTTPClient) {
+		assertSupportBundle := func(t *testing.T, files map[string]string) {
+			for _, name := range []string{
+				fxapp.SupportBundleAppFile,
+				fxapp.SupportBundleConfigFile,
+				fxapp.SupportBundleDependenciesFile,
+				fxapp.SupportBundleHealthFile,
+				fxapp.SupportBundleMetricsFile,
+				fxapp.SupportBundleEventsFile,
+				fxapp.SupportBundleGoroutinesFile,
+			} {
+				assert.Contains(t, files, name)
+			}
+			assert.NotContains(t, files, fxapp.SupportBundleErrorsFile)
+
+			var appInfo struct {
+				ID         string `json:"id"`
+				InstanceID string `json:"instance_id"`
+			}
+			require.NoError(t, json.Unmarshal([]byte(files[fxapp.SupportBundleAppFile]), &appInfo))
+			assert.Equal(t, ulid.ULID(app.ID()).String(), appInfo.ID)
+			assert.Equal(t, ulid.ULID(app.InstanceID()).String(), appInfo.InstanceID)
+
+			var config struct {
+				Modules []string `json:"modules"`
+			}
+			require.NoError(t, json.Unmarshal([]byte(files[fxapp.SupportBundleConfigFile]), &config))
+			assert.Contains(t, config.Modules, "replay_buffer")
+
+			assert.Contains(t, files[fxapp.SupportBundleDependenciesFile], "digraph")
+			var healthCheckResults []interface{}
+			assert.NoError(t, json.Unmarshal([]byte(files[fxapp.SupportBundleHealthFile]), &healthCheckResults))
+			assert.Contains(t, files[fxapp.SupportBundleMetricsFile], "go_goroutines")
+			assert.Contains(t, files[fxapp.SupportBundleEventsFile], fxapp.InitializedEvent)
+			assert.Contains(t, files[fxapp.SupportBundleGoroutinesFile], "goroutine")
+		}
+
+		t.Run("App.SupportBundle", func(t *testing.T) {
+			buf := new(bytes.Buffer)
+			require.NoError(t, app.SupportBundle(buf))
+			assertSupportBundle(t, readSupportBundle(t, buf))
+			fxapptest.AssertEventLogged(t, logs, fxapp.SupportBundleEvent, fxapptest.FieldExists("d.files"))
+		})
+
+		t.Run("HTTP endpoint", func(t *testing.T) {
+			response, err := client.Get(fxapp.SupportBundleEndpoint)
+			require.NoError(t, err)
+			defer response.Body.Close()
+			require.Equal(t, http.StatusOK, response.StatusCode)
+			assert.Equal(t, fxapp.GzipMediaType, response.Header.Get("Content-Type"))
+			assert.Contains(t, response.Header.Get("Content-Disposition"), ulid.ULID(app.InstanceID()).String())
+			assertSupportBundle(t, readSupportBundle(t, response.Body))
+		})
+	})
+}
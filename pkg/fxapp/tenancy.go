@@ -0,0 +1,285 @@
+/*
+ * Copyright (c) 2019 OysterPack, Inc.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ * http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package fxapp
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"github.com/oysterpack/andiamo/pkg/fx/health"
+	"github.com/oysterpack/andiamo/pkg/reqctx"
+	"github.com/prometheus/client_golang/prometheus"
+	"go.uber.org/fx"
+	"net/http"
+	"strings"
+	"sync"
+)
+
+// tenancy IDs
+const (
+	// TenantRequestsMetricID is the counter metric ID for the app HTTP server requests per tenant - see `TenantLabel`
+	TenantRequestsMetricID = "U01DJ1R5G3ZFEYQ2F1VQW6GFZ94"
+
+	// TenantHealthCheckTag is used to tag the health checks that are registered per tenant - see `TenantHealth`
+	TenantHealthCheckTag = "01DJ1R5G882QGDFHF3SZ3FR464"
+
+	// TenantHealthEndpoint is used to construct the HTTP endpoint that reports the tenant health check roll-ups as JSON,
+	// i.e., the tenant is mapped to its status. The endpoint is only registered if tenancy is enabled - see
+	// `Builder.EnableTenancy()`.
+	//
+	//	type Response map[string]string
+	TenantHealthEndpoint = "01DJ1R5GCH6J6JMM3HQZAW2EER"
+)
+
+// tenant metric label
+const (
+	TenantLabel = "tenant"
+
+	// NoTenantLabelValue is used when the tenant is not known
+	NoTenantLabelValue = "_none"
+	// OtherTenantLabelValue is used for tenants that exceed the tenant label cardinality limit
+	OtherTenantLabelValue = "_other"
+)
+
+// DefaultMaxTenantLabelValues is the default max number of distinct tenant metric label values
+const DefaultMaxTenantLabelValues = 100
+
+// tenancy related errors
+var (
+	ErrInvalidTenancyOpts = errors.New("tenancy `MaxTenantLabelValues` must not be negative")
+	ErrBlankTenant        = errors.New("tenant must not be blank")
+)
+
+// TenancyOpts is used to configure tenant-awareness - see `Builder.EnableTenancy()`
+type TenancyOpts struct {
+	// MaxTenantLabelValues is the cardinality guard for the tenant metric label, i.e., once the limit is reached, new
+	// tenants are labelled as `OtherTenantLabelValue`. If zero, then DefaultMaxTenantLabelValues is used.
+	MaxTenantLabelValues int
+}
+
+func (opts TenancyOpts) validate() error {
+	if opts.MaxTenantLabelValues < 0 {
+		return fmt.Errorf("%s : %d", ErrInvalidTenancyOpts, opts.MaxTenantLabelValues)
+	}
+	return nil
+}
+
+func (opts TenancyOpts) withDefaults() TenancyOpts {
+	if opts.MaxTenantLabelValues == 0 {
+		opts.MaxTenantLabelValues = DefaultMaxTenantLabelValues
+	}
+	return opts
+}
+
+// TenantResolver is used to resolve the tenant for app HTTP server requests, e.g., from the request host or a verified
+// token claim. Blank means the tenant is not known.
+//
+// The TenantResolver is optional, and is provided via dependency injection. If not provided, then the tenant carried by
+// the request context is used - see `Builder.EnableRequestContext()`.
+type TenantResolver interface {
+	ResolveTenant(request *http.Request) string
+}
+
+// TenantResolverFunc is a func that implements the TenantResolver interface
+type TenantResolverFunc func(request *http.Request) string
+
+// ResolveTenant implements the TenantResolver interface
+func (f TenantResolverFunc) ResolveTenant(request *http.Request) string {
+	return f(request)
+}
+
+// TenantLabels is used to add the tenant label to metrics, while guarding against unbounded label cardinality
+type TenantLabels interface {
+	// LabelValue returns the metric label value for the tenant
+	LabelValue(tenant string) string
+	// ContextLabelValue returns the metric label value for the tenant that is carried by the request context
+	ContextLabelValue(ctx context.Context) string
+}
+
+type tenantLabels struct {
+	max int
+
+	mutex   sync.RWMutex
+	tenants map[string]bool
+}
+
+func newTenantLabels(max int) *tenantLabels {
+	return &tenantLabels{
+		max:     max,
+		tenants: make(map[string]bool),
+	}
+}
+
+func (labels *tenantLabels) LabelValue(tenant string) string {
+	if tenant = strings.TrimSpace(tenant); tenant == "" {
+		return NoTenantLabelValue
+	}
+	labels.mutex.RLock()
+	known := labels.tenants[tenant]
+	labels.mutex.RUnlock()
+	if known {
+		return tenant
+	}
+
+	labels.mutex.Lock()
+	defer labels.mutex.Unlock()
+	if labels.tenants[tenant] {
+		return tenant
+	}
+	if len(labels.tenants) >= labels.max {
+		return OtherTenantLabelValue
+	}
+	labels.tenants[tenant] = true
+	return tenant
+}
+
+func (labels *tenantLabels) ContextLabelValue(ctx context.Context) string {
+	return labels.LabelValue(reqctx.Tenant(ctx))
+}
+
+// TenantHealth is used to register health checks per tenant, and to roll up the tenant health check results, i.e., the
+// tenant status is the worst status of its health checks.
+type TenantHealth interface {
+	// Register registers the health check for the tenant. The health check is tagged with the TenantHealthCheckTag.
+	Register(tenant string, check health.Check, opts health.CheckerOpts, checker func(ctx context.Context) (health.Status, error)) error
+	// Status returns the tenant roll-up status. False is returned if the tenant has no health check results. Health
+	// checks that have not yet run are not rolled up.
+	Status(tenant string) (health.Status, bool)
+	// Statuses returns the roll-up status for each tenant that has health check results
+	Statuses() map[string]health.Status
+}
+
+type tenantHealth struct {
+	register     health.Register
+	checkResults health.CheckResults
+
+	mutex sync.RWMutex
+	// health check ID -> tenant
+	checks map[string]string
+}
+
+func (h *tenantHealth) Register(tenant string, check health.Check, opts health.CheckerOpts, checker func(ctx context.Context) (health.Status, error)) error {
+	if tenant = strings.TrimSpace(tenant); tenant == "" {
+		return fmt.Errorf("%s : %s", ErrBlankTenant, check.ID)
+	}
+	check.Tags = append(append([]string(nil), check.Tags...), TenantHealthCheckTag)
+	if err := h.register(check, opts, checker); err != nil {
+		return err
+	}
+	h.mutex.Lock()
+	defer h.mutex.Unlock()
+	h.checks[strings.TrimSpace(check.ID)] = tenant
+	return nil
+}
+
+func (h *tenantHealth) Status(tenant string) (health.Status, bool) {
+	status, ok := h.Statuses()[tenant]
+	return status, ok
+}
+
+func (h *tenantHealth) Statuses() map[string]health.Status {
+	h.mutex.RLock()
+	checks := make(map[string]string, len(h.checks))
+	for id, tenant := range h.checks {
+		checks[id] = tenant
+	}
+	h.mutex.RUnlock()
+
+	statuses := make(map[string]health.Status)
+	results := <-h.checkResults(func(result health.Result) bool {
+		_, ok := checks[result.ID]
+		return ok
+	}, health.Query{})
+	for _, result := range results {
+		tenant := checks[result.ID]
+		if status, ok := statuses[tenant]; !ok || result.Status > status {
+			statuses[tenant] = result.Status
+		}
+	}
+	return statuses
+}
+
+// tenancy is provided when tenancy is enabled
+type tenancy struct {
+	labels   *tenantLabels
+	resolver TenantResolver
+	requests *prometheus.CounterVec
+}
+
+// resolves the request tenant, which is carried by the request context, and counts the request per tenant
+func (t *tenancy) middleware(handler http.Handler) http.Handler {
+	return http.HandlerFunc(func(writer http.ResponseWriter, request *http.Request) {
+		if t.resolver != nil {
+			if tenant := strings.TrimSpace(t.resolver.ResolveTenant(request)); tenant != "" {
+				rc, _ := reqctx.FromContext(request.Context())
+				rc.Tenant = tenant
+				request = request.WithContext(reqctx.NewContext(request.Context(), rc))
+			}
+		}
+		t.requests.WithLabelValues(t.labels.ContextLabelValue(request.Context())).Inc()
+		handler.ServeHTTP(writer, request)
+	})
+}
+
+type tenancyParams struct {
+	fx.In
+
+	Resolver     TenantResolver `optional:"true"`
+	Registerer   prometheus.Registerer
+	Register     health.Register
+	CheckResults health.CheckResults
+}
+
+func provideTenancy(opts TenancyOpts) func(params tenancyParams) (*tenancy, TenantLabels, TenantHealth, error) {
+	opts = opts.withDefaults()
+	return func(params tenancyParams) (*tenancy, TenantLabels, TenantHealth, error) {
+		t := &tenancy{
+			labels:   newTenantLabels(opts.MaxTenantLabelValues),
+			resolver: params.Resolver,
+			requests: prometheus.NewCounterVec(prometheus.CounterOpts{
+				Name: TenantRequestsMetricID,
+				Help: "HTTP requests per tenant",
+			}, []string{TenantLabel}),
+		}
+		if err := params.Registerer.Register(t.requests); err != nil {
+			return nil, nil, nil, err
+		}
+		h := &tenantHealth{
+			register:     params.Register,
+			checkResults: params.CheckResults,
+			checks:       make(map[string]string),
+		}
+		return t, t.labels, h, nil
+	}
+}
+
+func tenantHealthHTTPHandler(tenantHealth TenantHealth) HTTPHandler {
+	return NewHTTPRoute(http.MethodGet, fmt.Sprintf("/%s", TenantHealthEndpoint), func(writer http.ResponseWriter, request *http.Request) {
+		statuses := tenantHealth.Statuses()
+		response := make(map[string]string, len(statuses))
+		for tenant, status := range statuses {
+			response[tenant] = status.String()
+		}
+		writer.Header().Set("Content-Type", JSONMediaType)
+		json.NewEncoder(writer).Encode(response)
+	}).WithDoc(OpenAPIOperation{
+		Summary:   "tenant health check roll-ups",
+		Tags:      []string{BuiltinOpenAPITag},
+		Responses: []OpenAPIResponse{{Status: http.StatusOK, MediaTypes: []string{JSONMediaType}}},
+	}).AdminOnly()
+}
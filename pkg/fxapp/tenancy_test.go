@@ -0,0 +1,150 @@
+/*
+ * Copyright (c) 2019 OysterPack, Inc.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ * http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package fxapp_test
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"github.com/oysterpack/andiamo/pkg/fx/health"
+	"github.com/oysterpack/andiamo/pkg/fxapp"
+	"github.com/oysterpack/andiamo/pkg/fxapptest"
+	"github.com/oysterpack/andiamo/pkg/reqctx"
+	"github.com/oysterpack/andiamo/pkg/ulids"
+	"github.com/prometheus/client_golang/prometheus"
+	dto "github.com/prometheus/client_model/go"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"io/ioutil"
+	"net/http"
+	"testing"
+)
+
+func TestBuilder_EnableTenancy(t *testing.T) {
+	t.Parallel()
+
+	tenants := make(chan string, 1)
+	var tenantHealth fxapp.TenantHealth
+	var tenantLabels fxapp.TenantLabels
+	var runCheckNow health.RunCheckNow
+	var gatherer prometheus.Gatherer
+	builder := fxapp.NewBuilder(fxapp.ID(ulids.MustNew()), fxapp.ReleaseID(ulids.MustNew())).
+		Provide(
+			func() fxapp.HTTPHandler {
+				return fxapp.NewHTTPRoute(http.MethodGet, "/foo", func(writer http.ResponseWriter, request *http.Request) {
+					tenants <- reqctx.Tenant(request.Context())
+				})
+			},
+			func() fxapp.TenantResolver {
+				return fxapp.TenantResolverFunc(func(request *http.Request) string {
+					return request.Header.Get("X-Org")
+				})
+			},
+		).
+		Invoke(func() {}).
+		EnableTenancy(fxapp.TenancyOpts{MaxTenantLabelValues: 1}).
+		Populate(&tenantHealth, &tenantLabels, &runCheckNow, &gatherer).
+		LogWriter(ioutil.Discard)
+
+	fxapptest.RunApp(t, builder, func(app fxapp.App, client *fxapptest.HTTPClient) {
+		t.Run("tenant is resolved", func(t *testing.T) {
+			for _, tenant := range []string{"acme", "globex", ""} {
+				request, err := http.NewRequest(http.MethodGet, client.URL("foo"), nil)
+				require.NoError(t, err)
+				request.Header.Set("X-Org", tenant)
+				response, err := client.Do(request)
+				require.NoError(t, err)
+				response.Body.Close()
+				require.Equal(t, http.StatusOK, response.StatusCode)
+				assert.Equal(t, tenant, <-tenants)
+			}
+
+			mfs, err := gatherer.Gather()
+			require.NoError(t, err)
+			mf := fxapp.FindMetricFamily(mfs, func(mf *dto.MetricFamily) bool {
+				return mf.GetName() == fxapp.TenantRequestsMetricID
+			})
+			require.NotNil(t, mf)
+			requests := make(map[string]float64)
+			for _, m := range mf.GetMetric() {
+				for _, label := range m.GetLabel() {
+					if label.GetName() == fxapp.TenantLabel {
+						requests[label.GetValue()] += m.GetCounter().GetValue()
+					}
+				}
+			}
+			// the tenant label cardinality is capped at 1
+			assert.Equal(t, map[string]float64{
+				"acme":                      1,
+				fxapp.OtherTenantLabelValue: 1,
+				fxapp.NoTenantLabelValue:    1,
+			}, requests)
+			assert.Equal(t, "acme", tenantLabels.LabelValue("acme"))
+			assert.Equal(t, fxapp.OtherTenantLabelValue, tenantLabels.LabelValue("initech"))
+		})
+
+		t.Run("tenant health checks", func(t *testing.T) {
+			green := func(ctx context.Context) (health.Status, error) { return health.Green, nil }
+			yellow := func(ctx context.Context) (health.Status, error) { return health.Yellow, errors.New("degraded") }
+			checks := []struct {
+				tenant  string
+				checker func(ctx context.Context) (health.Status, error)
+			}{
+				{"acme", green},
+				{"acme", yellow},
+				{"globex", green},
+			}
+			for _, check := range checks {
+				id := ulids.MustNew().String()
+				require.NoError(t, tenantHealth.Register(check.tenant, health.Check{
+					ID:          id,
+					Description: "tenant health check",
+					RedImpact:   "tenant is down",
+				}, health.CheckerOpts{}, check.checker))
+				_, err := runCheckNow(id)
+				require.NoError(t, err)
+			}
+			assert.Error(t, tenantHealth.Register(" ", health.Check{ID: ulids.MustNew().String()}, health.CheckerOpts{}, green))
+
+			status, ok := tenantHealth.Status("acme")
+			assert.True(t, ok)
+			assert.Equal(t, health.Yellow, status)
+			_, ok = tenantHealth.Status("initech")
+			assert.False(t, ok)
+
+			response, err := client.Get(fxapp.TenantHealthEndpoint)
+			require.NoError(t, err)
+			defer response.Body.Close()
+			require.Equal(t, http.StatusOK, response.StatusCode)
+			var statuses map[string]string
+			require.NoError(t, json.NewDecoder(response.Body).Decode(&statuses))
+			assert.Equal(t, map[string]string{"acme": "Yellow", "globex": "Green"}, statuses)
+		})
+	})
+}
+
+func TestTenancyOpts_Validation(t *testing.T) {
+	t.Parallel()
+
+	_, err := fxapp.NewBuilder(fxapp.ID(ulids.MustNew()), fxapp.ReleaseID(ulids.MustNew())).
+		Invoke(func() {}).
+		EnableTenancy(fxapp.TenancyOpts{MaxTenantLabelValues: -1}).
+		LogWriter(ioutil.Discard).
+		Build()
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), fxapp.ErrInvalidTenancyOpts.Error())
+}
@@ -0,0 +1,156 @@
+/*
+ * Copyright (c) 2019 OysterPack, Inc.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ * http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package fxapp
+
+import (
+	"errors"
+	"fmt"
+	"reflect"
+)
+
+// ErrTypedConstructorFailed indicates a typed constructor, i.e., registered via `Provide0()` ... `Provide3()`, failed.
+// The error message includes the type that failed to be constructed.
+var ErrTypedConstructorFailed = errors.New("typed constructor failed")
+
+// ErrTypedFuncFailed indicates a typed function, i.e., registered via `Invoke1()` ... `Invoke3()`, failed. The error
+// message includes the function signature.
+var ErrTypedFuncFailed = errors.New("typed function failed")
+
+// Provide0 registers a constructor that has no dependencies.
+//
+// The typed helpers are alternatives to the interface{} based `Builder.Provide()` and `Builder.Invoke()`, which are only
+// checked when the app is built. The typed helpers are type checked at compile time, and constructor and function errors
+// are reported along with the types involved. They compile down to the same fx options, e.g.,
+//
+//	builder.Apply(
+//		fxapp.Supply[Config](config),
+//		fxapp.Provide1(NewRepo),       // func(Config) (*Repo, error)
+//		fxapp.Invoke2(RegisterRoutes), // func(*Repo, *zerolog.Logger) error
+//	)
+//
+// A nil constructor or function is registered as is, i.e., the app fails to build.
+func Provide0[T any](constructor func() (T, error)) BuilderOption {
+	if constructor == nil {
+		return provideNil
+	}
+	return provide(func() (T, error) {
+		return constructed(constructor())
+	})
+}
+
+// Provide1 registers a constructor that has 1 dependency.
+func Provide1[A, T any](constructor func(A) (T, error)) BuilderOption {
+	if constructor == nil {
+		return provideNil
+	}
+	return provide(func(a A) (T, error) {
+		return constructed(constructor(a))
+	})
+}
+
+// Provide2 registers a constructor that has 2 dependencies.
+func Provide2[A, B, T any](constructor func(A, B) (T, error)) BuilderOption {
+	if constructor == nil {
+		return provideNil
+	}
+	return provide(func(a A, b B) (T, error) {
+		return constructed(constructor(a, b))
+	})
+}
+
+// Provide3 registers a constructor that has 3 dependencies.
+func Provide3[A, B, C, T any](constructor func(A, B, C) (T, error)) BuilderOption {
+	if constructor == nil {
+		return provideNil
+	}
+	return provide(func(a A, b B, c C) (T, error) {
+		return constructed(constructor(a, b, c))
+	})
+}
+
+// Supply provides the value as type T. Unlike `fx.Supply`, which provides the value's dynamic type, interface types are
+// supported, e.g.,
+//
+//	fxapp.Supply[clock.Clock](clock.New())
+func Supply[T any](value T) BuilderOption {
+	return provide(func() T { return value })
+}
+
+// Invoke1 registers a function that has 1 dependency.
+func Invoke1[A any](f func(A) error) BuilderOption {
+	if f == nil {
+		return invokeNil
+	}
+	return invoke(func(a A) error {
+		return invoked(f, f(a))
+	})
+}
+
+// Invoke2 registers a function that has 2 dependencies.
+func Invoke2[A, B any](f func(A, B) error) BuilderOption {
+	if f == nil {
+		return invokeNil
+	}
+	return invoke(func(a A, b B) error {
+		return invoked(f, f(a, b))
+	})
+}
+
+// Invoke3 registers a function that has 3 dependencies.
+func Invoke3[A, B, C any](f func(A, B, C) error) BuilderOption {
+	if f == nil {
+		return invokeNil
+	}
+	return invoke(func(a A, b B, c C) error {
+		return invoked(f, f(a, b, c))
+	})
+}
+
+func provide(constructor interface{}) BuilderOption {
+	return func(b Builder) Builder {
+		return b.Provide(constructor)
+	}
+}
+
+func invoke(f interface{}) BuilderOption {
+	return func(b Builder) Builder {
+		return b.Invoke(f)
+	}
+}
+
+func provideNil(b Builder) Builder { return b.Provide(nil) }
+
+func invokeNil(b Builder) Builder { return b.Invoke(nil) }
+
+func constructed[T any](value T, err error) (T, error) {
+	if err != nil {
+		return value, fmt.Errorf("%s : %s : %s", ErrTypedConstructorFailed, typeOf[T](), err)
+	}
+	return value, nil
+}
+
+func invoked(f interface{}, err error) error {
+	if err != nil {
+		return fmt.Errorf("%s : %s : %s", ErrTypedFuncFailed, reflect.TypeOf(f), err)
+	}
+	return nil
+}
+
+// typeOf returns the static type, i.e., interface types are not resolved to the dynamic type
+func typeOf[T any]() reflect.Type {
+	return reflect.TypeOf((*T)(nil)).Elem()
+}
@@ -0,0 +1,123 @@
+/*
+ * Copyright (c) 2019 OysterPack, Inc.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ * http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package fxapp_test
+
+import (
+	"errors"
+	"fmt"
+	"github.com/oysterpack/andiamo/pkg/clock"
+	"github.com/oysterpack/andiamo/pkg/fxapp"
+	"github.com/oysterpack/andiamo/pkg/ulids"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"testing"
+	"time"
+)
+
+type typedConfig struct {
+	DSN string
+}
+
+type typedName string
+
+type typedRepo struct {
+	dsn  string
+	name fmt.Stringer
+}
+
+type typedService struct {
+	repo *typedRepo
+}
+
+func TestTypedHelpers(t *testing.T) {
+	t.Parallel()
+
+	var service *typedService
+	var name typedName
+	_, err := fxapp.NewBuilder(fxapp.ID(ulids.MustNew()), fxapp.ReleaseID(ulids.MustNew())).
+		Apply(
+			fxapp.Supply[typedConfig](typedConfig{DSN: "db://orders"}),
+			// interface types are supplied as is
+			fxapp.Supply[fmt.Stringer](time.Second),
+			fxapp.Provide2(func(config typedConfig, name fmt.Stringer) (*typedRepo, error) {
+				return &typedRepo{config.DSN, name}, nil
+			}),
+			fxapp.Provide1(func(repo *typedRepo) (*typedService, error) {
+				return &typedService{repo}, nil
+			}),
+			fxapp.Provide0(func() (typedName, error) {
+				return "orders", nil
+			}),
+			fxapp.Invoke2(func(s *typedService, n typedName) error {
+				service = s
+				name = n
+				return nil
+			}),
+			nil,
+		).
+		DisableHTTPServer().
+		Build()
+	require.NoError(t, err)
+	require.NotNil(t, service)
+	assert.Equal(t, "db://orders", service.repo.dsn)
+	assert.Equal(t, "1s", service.repo.name.String())
+	assert.Equal(t, typedName("orders"), name)
+}
+
+func TestTypedHelpers_Errors(t *testing.T) {
+	t.Parallel()
+
+	build := func(options ...fxapp.BuilderOption) error {
+		_, err := fxapp.NewBuilder(fxapp.ID(ulids.MustNew()), fxapp.ReleaseID(ulids.MustNew())).
+			Apply(options...).
+			DisableHTTPServer().
+			Build()
+		return err
+	}
+
+	t.Run("constructor failed", func(t *testing.T) {
+		err := build(
+			fxapp.Provide0(func() (*typedRepo, error) { return nil, errors.New("connection refused") }),
+			fxapp.Invoke1(func(*typedRepo) error { return nil }),
+		)
+		require.Error(t, err)
+		assert.Contains(t, err.Error(), fxapp.ErrTypedConstructorFailed.Error())
+		assert.Contains(t, err.Error(), "*fxapp_test.typedRepo")
+		assert.Contains(t, err.Error(), "connection refused")
+	})
+
+	t.Run("func failed", func(t *testing.T) {
+		err := build(
+			fxapp.Supply[typedConfig](typedConfig{}),
+			fxapp.Invoke1(func(config typedConfig) error {
+				if config.DSN == "" {
+					return errors.New("DSN is required")
+				}
+				return nil
+			}),
+		)
+		require.Error(t, err)
+		assert.Contains(t, err.Error(), fxapp.ErrTypedFuncFailed.Error())
+		assert.Contains(t, err.Error(), "func(fxapp_test.typedConfig) error")
+		assert.Contains(t, err.Error(), "DSN is required")
+	})
+
+	t.Run("nil", func(t *testing.T) {
+		assert.Error(t, build(fxapp.Provide1[typedConfig, *typedRepo](nil), fxapp.Invoke1(func(*typedRepo) error { return nil })))
+		assert.Error(t, build(fxapp.Invoke3[typedConfig, *typedRepo, clock.Clock](nil)))
+	})
+}
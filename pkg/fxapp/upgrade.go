@@ -0,0 +1,91 @@
+/*
+ * Copyright (c) 2019 OysterPack, Inc.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ * http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package fxapp
+
+import (
+	"context"
+	"fmt"
+	"github.com/oysterpack/andiamo/pkg/eventlog"
+	"github.com/oysterpack/andiamo/pkg/fx/upgrade"
+	"github.com/rs/zerolog"
+	"go.uber.org/fx"
+	"net/http"
+)
+
+// UpgradeEndpoint is used to trigger a zero-downtime binary upgrade, i.e., the app binary is replaced on disk, and then
+// the upgrade is triggered via:
+//
+//	POST /01DHZE0F0VMBAH8BBVM5H9W2WM
+//
+// The request blocks until the new process is ready or the upgrade fails. The endpoint is only registered if upgrades
+// are enabled - see `Builder.EnableUpgrades()`.
+const UpgradeEndpoint = "01DHZE0F0VMBAH8BBVM5H9W2WM"
+
+func upgradeHTTPHandler(trigger upgrade.Trigger) HTTPHandler {
+	return NewHTTPRoute(http.MethodPost, fmt.Sprintf("/%s", UpgradeEndpoint), func(writer http.ResponseWriter, request *http.Request) {
+		switch err := trigger(); err {
+		case nil:
+			writer.WriteHeader(http.StatusOK)
+		case upgrade.ErrUpgradeInProgress, upgrade.ErrDraining:
+			http.Error(writer, err.Error(), http.StatusConflict)
+		default:
+			http.Error(writer, err.Error(), http.StatusInternalServerError)
+		}
+	}).WithDoc(OpenAPIOperation{
+		Summary: "zero-downtime binary upgrade",
+		Tags:    []string{BuiltinOpenAPITag},
+		Responses: []OpenAPIResponse{
+			{Status: http.StatusOK, Description: "new process is ready, i.e., this process is draining"},
+			{Status: http.StatusConflict, Description: "upgrade is already in progress, or the app has already been upgraded"},
+			{Status: http.StatusInternalServerError, Description: "upgrade failed"},
+		},
+	}).AdminOnly()
+}
+
+// when the app is ready, the old process is notified, i.e., if the app was started by an upgrade. If the app is stopped
+// before it becomes ready, then the old process is not notified.
+func notifyUpgradeReady(lc fx.Lifecycle, readiness ReadinessWaitGroup, notifyReady upgrade.NotifyReady, logger *zerolog.Logger) {
+	logErr := eventlog.NewLogger(upgrade.UpgradeFailedEvent, logger, zerolog.ErrorLevel)
+	stop := make(chan struct{})
+	lc.Append(fx.Hook{
+		OnStart: func(context.Context) error {
+			go func() {
+				select {
+				case <-readiness.Ready():
+				case <-stop:
+					return
+				}
+				if err := notifyReady(); err != nil {
+					logErr(upgradeNotifyReadyError{err}, "failed to notify the old process that the app is ready")
+				}
+			}()
+			return nil
+		},
+		OnStop: func(context.Context) error {
+			close(stop)
+			return nil
+		},
+	})
+}
+
+type upgradeNotifyReadyError struct {
+	error
+}
+
+func (err upgradeNotifyReadyError) MarshalZerologObject(e *zerolog.Event) {
+	e.Err(err)
+}
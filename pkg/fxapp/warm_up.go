@@ -0,0 +1,219 @@
+/*
+ * Copyright (c) 2019 OysterPack, Inc.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ * http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package fxapp
+
+import (
+	"context"
+	"fmt"
+	"github.com/oysterpack/andiamo/pkg/eventlog"
+	"github.com/rs/zerolog"
+	"go.uber.org/fx"
+	"time"
+)
+
+// WarmUpEvent is logged as each warm-up task completes, i.e., it reports the warm-up progress. Failed tasks are logged
+// at warn level.
+//
+//	type Data struct {
+//		Name     string `json:"name"`
+//		// one of: ok, error, timeout
+//		Outcome  string `json:"outcome"`
+//		Duration uint   `json:"duration"`
+//		// the number of tasks that have completed
+//		Completed int   `json:"completed"`
+//		Total     int   `json:"total"`
+//		Err       string `json:"e"`
+//	}
+const WarmUpEvent = "01DJ31BVWH7Y34TB13Y9SW1R6K"
+
+// WarmUpCompletedEvent is logged when the warm-up phase is completed, after which the app readiness opens
+//
+//	type Data struct {
+//		// one of: ok, error, timeout, skipped
+//		Outcome  string `json:"outcome"`
+//		Duration uint   `json:"duration"`
+//		// the number of tasks that failed, including tasks that timed out
+//		Failed   int    `json:"failed"`
+//		Total    int    `json:"total"`
+//	}
+const WarmUpCompletedEvent = "01DJ31BW0TBG8J42QDHH118DQ7"
+
+// DefaultWarmUpTimeout is the default warm-up phase timeout
+const DefaultWarmUpTimeout = time.Minute
+
+// WarmUpSkipEnvVar is used to skip the warm-up phase, e.g., to restore readiness quickly when warm-up is stuck
+const WarmUpSkipEnvVar = EnvconfigPrefix + "_" + warmUpSkipEnvName
+
+// warm-up outcomes
+const (
+	warmUpOK      = "ok"
+	warmUpError   = "error"
+	warmUpTimeout = "timeout"
+	warmUpSkipped = "skipped"
+)
+
+// WarmUpTask is run during the app warm-up phase, e.g., to prime caches, compile routes, or pre-establish connections.
+// The task context is canceled when the warm-up times out or the app is stopped.
+type WarmUpTask struct {
+	Name string
+	Run  func(ctx context.Context) error
+}
+
+// WarmUp is used to provide warm-up tasks via dependency injection. Warm-up tasks are run concurrently after the app
+// has started, and the app readiness only opens after all of the warm-up tasks are completed, or the warm-up is skipped.
+//
+// Warm-up is best effort, i.e., task failures and timeouts are logged, but do not fail the app.
+type WarmUp struct {
+	fx.Out
+
+	WarmUpTask `group:"WarmUp"`
+}
+
+// NewWarmUp constructs a new WarmUp
+func NewWarmUp(name string, run func(ctx context.Context) error) WarmUp {
+	return WarmUp{WarmUpTask: WarmUpTask{Name: name, Run: run}}
+}
+
+// warmUpTasks is used to collect the warm-up tasks that are provided via dependency injection
+type warmUpTasks struct {
+	fx.In
+
+	Tasks []WarmUpTask `group:"WarmUp"`
+}
+
+type warmUpTaskResult struct {
+	name      string
+	outcome   string
+	duration  time.Duration
+	completed int
+	total     int
+	err       error
+}
+
+func (r warmUpTaskResult) MarshalZerologObject(e *zerolog.Event) {
+	e.
+		Str("name", r.name).
+		Str("outcome", r.outcome).
+		Dur("duration", r.duration).
+		Int("completed", r.completed).
+		Int("total", r.total)
+	if r.err != nil {
+		e.Err(r.err)
+	}
+}
+
+type warmUpCompleted struct {
+	outcome  string
+	duration time.Duration
+	failed   int
+	total    int
+}
+
+func (r warmUpCompleted) MarshalZerologObject(e *zerolog.Event) {
+	e.
+		Str("outcome", r.outcome).
+		Dur("duration", r.duration).
+		Int("failed", r.failed).
+		Int("total", r.total)
+}
+
+// warmUp runs the warm-up tasks in the background, and holds the app readiness until the tasks are completed. The
+// returned function is used to cancel the warm-up, e.g., when the app is stopped.
+func (a *app) warmUp() (cancel func()) {
+	tasks := a.warmUpTasks
+	if len(tasks) == 0 {
+		return func() {}
+	}
+	logCompleted := eventlog.NewLogger(WarmUpCompletedEvent, a.logger, zerolog.InfoLevel)
+	if a.skipWarmUp {
+		logCompleted(warmUpCompleted{outcome: warmUpSkipped, total: len(tasks)}, "warm-up skipped")
+		return func() {}
+	}
+
+	logTask := eventlog.NewLogger(WarmUpEvent, a.logger, zerolog.InfoLevel)
+	logTaskFailed := eventlog.NewLogger(WarmUpEvent, a.logger, zerolog.WarnLevel)
+	logCompletedWithFailures := eventlog.NewLogger(WarmUpCompletedEvent, a.logger, zerolog.WarnLevel)
+
+	a.readiness.Inc()
+	ctx, cancel := a.clock.WithTimeout(context.Background(), a.warmUpTimeout)
+	go func() {
+		defer a.readiness.Done()
+		defer cancel()
+
+		start := a.clock.Now()
+		results := make(chan warmUpTaskResult, len(tasks))
+		for _, task := range tasks {
+			go func(task WarmUpTask) {
+				taskStart := a.clock.Now()
+				err := runWarmUpTask(ctx, task)
+				result := warmUpTaskResult{name: task.Name, outcome: warmUpOK, duration: a.clock.Since(taskStart), err: err}
+				if err != nil {
+					result.outcome = warmUpError
+					if ctx.Err() == context.DeadlineExceeded {
+						result.outcome = warmUpTimeout
+					}
+				}
+				results <- result
+			}(task)
+		}
+
+		completed := warmUpCompleted{outcome: warmUpOK, total: len(tasks)}
+		for i := range tasks {
+			var result warmUpTaskResult
+			select {
+			case result = <-results:
+			case <-ctx.Done():
+				// tasks that do not honor the context cancellation are abandoned
+				completed.failed += len(tasks) - i
+				completed.outcome = warmUpTimeout
+				if ctx.Err() == context.Canceled {
+					// the app is stopping
+					return
+				}
+				completed.duration = a.clock.Since(start)
+				logCompletedWithFailures(completed, "warm-up timed out")
+				return
+			}
+			result.completed, result.total = i+1, len(tasks)
+			if result.err != nil {
+				completed.failed++
+				if completed.outcome == warmUpOK {
+					completed.outcome = result.outcome
+				}
+				logTaskFailed(result, "warm-up task failed")
+				continue
+			}
+			logTask(result, "warm-up task completed")
+		}
+		completed.duration = a.clock.Since(start)
+		if completed.failed > 0 {
+			logCompletedWithFailures(completed, "warm-up completed with failures")
+			return
+		}
+		logCompleted(completed, "warm-up completed")
+	}()
+	return cancel
+}
+
+func runWarmUpTask(ctx context.Context, task WarmUpTask) (err error) {
+	defer func() {
+		if p := recover(); p != nil {
+			err = fmt.Errorf("warm-up task panicked : %v", p)
+		}
+	}()
+	return task.Run(ctx)
+}
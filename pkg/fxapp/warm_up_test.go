@@ -0,0 +1,180 @@
+/*
+ * Copyright (c) 2019 OysterPack, Inc.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ * http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package fxapp_test
+
+import (
+	"context"
+	"errors"
+	"github.com/oysterpack/andiamo/pkg/fxapp"
+	"github.com/oysterpack/andiamo/pkg/fxapptest"
+	"github.com/oysterpack/andiamo/pkg/ulids"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestWarmUp_GatesReadiness(t *testing.T) {
+	t.Parallel()
+
+	logs := fxapptest.NewLogCapture()
+	release := make(chan struct{})
+	app, err := fxapp.NewBuilder(fxapp.ID(ulids.MustNew()), fxapp.ReleaseID(ulids.MustNew())).
+		Provide(
+			func() fxapp.WarmUp {
+				return fxapp.NewWarmUp("prime-cache", func(ctx context.Context) error {
+					select {
+					case <-release:
+						return nil
+					case <-ctx.Done():
+						return ctx.Err()
+					}
+				})
+			},
+		).
+		Invoke(func() {}).
+		DisableHTTPServer().
+		LogWriter(logs).
+		Build()
+	require.NoError(t, err)
+
+	go app.Run()
+	defer func() {
+		require.NoError(t, app.Shutdown())
+	}()
+	<-app.Started()
+	select {
+	case <-app.Ready():
+		t.Fatal("*** the app should not be ready until the warm-up is completed")
+	case <-time.After(50 * time.Millisecond):
+	}
+
+	close(release)
+	select {
+	case <-app.Ready():
+	case <-time.After(5 * time.Second):
+		t.Fatal("*** the app should be ready after the warm-up is completed")
+	}
+	fxapptest.AssertEventLogged(t, logs, fxapp.WarmUpEvent,
+		fxapptest.Field("d.name", "prime-cache"),
+		fxapptest.Field("d.outcome", "ok"),
+		fxapptest.Field("d.completed", float64(1)),
+		fxapptest.Field("d.total", float64(1)),
+	)
+	fxapptest.AssertEventLogged(t, logs, fxapp.WarmUpCompletedEvent, fxapptest.Field("d.outcome", "ok"))
+}
+
+func TestWarmUp_FailuresAreBestEffort(t *testing.T) {
+	t.Parallel()
+
+	logs := fxapptest.NewLogCapture()
+	builder := fxapp.NewBuilder(fxapp.ID(ulids.MustNew()), fxapp.ReleaseID(ulids.MustNew())).
+		Provide(
+			func() fxapp.WarmUp {
+				return fxapp.NewWarmUp("failure", func(ctx context.Context) error {
+					return errors.New("BOOM")
+				})
+			},
+			func() fxapp.WarmUp {
+				return fxapp.NewWarmUp("panic", func(ctx context.Context) error {
+					panic("BOOM")
+				})
+			},
+			func() fxapp.WarmUp {
+				return fxapp.NewWarmUp("timeout", func(ctx context.Context) error {
+					<-ctx.Done()
+					return ctx.Err()
+				})
+			},
+		).
+		Invoke(func() {}).
+		SetWarmUpTimeout(100 * time.Millisecond).
+		LogWriter(logs)
+
+	fxapptest.RunApp(t, builder, func(app fxapp.App, client *fxapptest.HTTPClient) {
+		fxapptest.AssertEventLogged(t, logs, fxapp.WarmUpEvent,
+			fxapptest.Field("d.name", "failure"),
+			fxapptest.Field("d.outcome", "error"),
+			fxapptest.Field("l", "warn"),
+		)
+		fxapptest.AssertEventLogged(t, logs, fxapp.WarmUpEvent,
+			fxapptest.Field("d.name", "panic"),
+			fxapptest.Field("d.outcome", "error"),
+		)
+		fxapptest.AssertEventLogged(t, logs, fxapp.WarmUpCompletedEvent,
+			fxapptest.Field("d.outcome", "timeout"),
+			fxapptest.Field("d.failed", float64(3)),
+			fxapptest.Field("d.total", float64(3)),
+		)
+	})
+}
+
+func TestBuilder_SkipWarmUp(t *testing.T) {
+	t.Parallel()
+
+	var runs int32
+	logs := fxapptest.NewLogCapture()
+	builder := fxapp.NewBuilder(fxapp.ID(ulids.MustNew()), fxapp.ReleaseID(ulids.MustNew())).
+		Provide(func() fxapp.WarmUp {
+			return fxapp.NewWarmUp("prime-cache", func(ctx context.Context) error {
+				atomic.AddInt32(&runs, 1)
+				return nil
+			})
+		}).
+		Invoke(func() {}).
+		SkipWarmUp().
+		LogWriter(logs)
+
+	fxapptest.RunApp(t, builder, func(app fxapp.App, client *fxapptest.HTTPClient) {
+		fxapptest.AssertEventLogged(t, logs, fxapp.WarmUpCompletedEvent,
+			fxapptest.Field("d.outcome", "skipped"),
+			fxapptest.Field("d.total", float64(1)),
+		)
+		assert.Zero(t, atomic.LoadInt32(&runs))
+	})
+}
+
+func TestWarmUp_SkippedViaEnv(t *testing.T) {
+	t.Setenv(fxapp.WarmUpSkipEnvVar, "true")
+
+	logs := fxapptest.NewLogCapture()
+	builder := fxapp.NewBuilder(fxapp.ID(ulids.MustNew()), fxapp.ReleaseID(ulids.MustNew())).
+		Provide(func() fxapp.WarmUp {
+			return fxapp.NewWarmUp("prime-cache", func(ctx context.Context) error {
+				return nil
+			})
+		}).
+		Invoke(func() {}).
+		LogWriter(logs)
+
+	fxapptest.RunApp(t, builder, func(app fxapp.App, client *fxapptest.HTTPClient) {
+		fxapptest.AssertEventLogged(t, logs, fxapp.WarmUpCompletedEvent, fxapptest.Field("d.outcome", "skipped"))
+	})
+}
+
+func TestWarmUp_InvalidTimeout(t *testing.T) {
+	t.Parallel()
+
+	_, err := fxapp.NewBuilder(fxapp.ID(ulids.MustNew()), fxapp.ReleaseID(ulids.MustNew())).
+		Invoke(func() {}).
+		SetWarmUpTimeout(0).
+		DisableHTTPServer().
+		Build()
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), "warm-up timeout")
+}
@@ -0,0 +1,334 @@
+/*
+ * Copyright (c) 2019 OysterPack, Inc.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ * http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package fxapp
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"github.com/oysterpack/andiamo/pkg/clock"
+	"github.com/oysterpack/andiamo/pkg/eventlog"
+	"github.com/oysterpack/andiamo/pkg/fx/retry"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/rs/zerolog"
+	"go.uber.org/fx"
+	"go.uber.org/multierr"
+	"strings"
+	"sync"
+	"time"
+)
+
+// WorkerFailedEvent is logged when a worker fails, i.e., its Run func returns an error or panics. If the worker is
+// supervised, then the worker is restarted after the backoff and the event is logged at warn level. Otherwise, or if the
+// worker exceeded its max restarts, then the failure is escalated, i.e., the event is logged at error level and the app
+// is shutdown using the `ShutdownFatalError` reason.
+//
+//	type Data struct {
+//		Name     string `json:"name"`
+//		// the number of consecutive failures
+//		Failures int    `json:"failures"`
+//		// one of: restart, escalate
+//		Outcome  string `json:"outcome"`
+//		// msec - only logged if the worker is restarted
+//		Backoff  uint   `json:"backoff"`
+//		Err      string `json:"e"`
+//	}
+const WorkerFailedEvent = "01DJSE7ACJABEXBVSNN90ZDE2F"
+
+// WorkerRestartsMetricID is the counter metric ID for worker restarts, which is labeled with the worker name ("worker")
+const WorkerRestartsMetricID = "U01DJSE7ACJXYSJ2NA9RJNDVTPR"
+
+// NoRestarts is used as the `RestartPolicy.MaxRestarts` to escalate the first failure, i.e., the worker is not restarted
+const NoRestarts = -1
+
+// restart policy defaults
+const (
+	DefaultWorkerMaxRestarts     = 5
+	DefaultWorkerInitialBackoff  = time.Second
+	DefaultWorkerMaxBackoff      = 30 * time.Second
+	DefaultWorkerRestartResetAge = time.Minute
+)
+
+// worker failure outcomes
+const (
+	workerRestart  = "restart"
+	workerEscalate = "escalate"
+)
+
+// Worker related errors
+var (
+	ErrInvalidWorker        = errors.New("worker is invalid")
+	ErrWorkerPanic          = errors.New("worker panicked")
+	ErrInvalidRestartPolicy = errors.New("worker restart policy is invalid")
+)
+
+// RestartPolicy is used to supervise a worker, i.e., the worker is restarted with exponential backoff when it fails
+// instead of taking the whole app down. After MaxRestarts consecutive failures, the failure is escalated to an app
+// shutdown.
+//
+// The zero value restarts the worker using the defaults.
+type RestartPolicy struct {
+	// MaxRestarts is the max number of consecutive failures that are restarted. If zero, then `DefaultWorkerMaxRestarts`
+	// is used. Use `NoRestarts` to escalate the first failure.
+	MaxRestarts int
+	// InitialBackoff is the backoff before the first restart, which is doubled after each consecutive failure - defaults
+	// to `DefaultWorkerInitialBackoff`
+	InitialBackoff time.Duration
+	// MaxBackoff caps the backoff - defaults to `DefaultWorkerMaxBackoff`
+	MaxBackoff time.Duration
+	// ResetAge is how long the worker must run for its consecutive failures to be reset, i.e., a worker that fails
+	// after running for a long time is considered to have recovered - defaults to `DefaultWorkerRestartResetAge`
+	ResetAge time.Duration
+}
+
+func (p RestartPolicy) validate() error {
+	if p.MaxRestarts < NoRestarts || p.InitialBackoff < 0 || p.MaxBackoff < 0 || p.ResetAge < 0 {
+		return WrapErr(ErrInvalidRestartPolicy, "fields must not be negative")
+	}
+	if p.MaxBackoff > 0 && p.InitialBackoff > p.MaxBackoff {
+		return WrapErr(ErrInvalidRestartPolicy, "`InitialBackoff` must not be greater than `MaxBackoff`")
+	}
+	return nil
+}
+
+func (p RestartPolicy) withDefaults() RestartPolicy {
+	switch p.MaxRestarts {
+	case 0:
+		p.MaxRestarts = DefaultWorkerMaxRestarts
+	case NoRestarts:
+		p.MaxRestarts = 0
+	}
+	if p.InitialBackoff == 0 {
+		p.InitialBackoff = DefaultWorkerInitialBackoff
+	}
+	if p.MaxBackoff == 0 {
+		p.MaxBackoff = DefaultWorkerMaxBackoff
+		if p.InitialBackoff > p.MaxBackoff {
+			p.MaxBackoff = p.InitialBackoff
+		}
+	}
+	if p.ResetAge == 0 {
+		p.ResetAge = DefaultWorkerRestartResetAge
+	}
+	return p
+}
+
+// backoff returns the backoff for the specified number of consecutive failures
+func (p RestartPolicy) backoff(failures int) time.Duration {
+	return retry.Opts{InitialBackoff: p.InitialBackoff, MaxBackoff: p.MaxBackoff, Multiplier: 2}.Backoff(failures)
+}
+
+// WorkerTask is a long-running service, e.g., a queue consumer or a background sync, which is run in the background
+// after the app is started. The worker context is canceled when the app is stopped, and the app waits for the worker to
+// return within the app stop timeout.
+//
+// If the Run func returns an error or panics, then the worker has failed. Unsupervised worker failures shutdown the app,
+// i.e., fail fast. Run returning nil means the worker has completed, i.e., it is not restarted.
+type WorkerTask struct {
+	Name string
+	Run  func(ctx context.Context) error
+	// Restart is used to supervise the worker - nil means the worker is not supervised
+	Restart *RestartPolicy
+}
+
+func (w WorkerTask) validate() error {
+	if strings.TrimSpace(w.Name) == "" {
+		return fmt.Errorf("%s : `Name` must not be blank", ErrInvalidWorker)
+	}
+	if w.Run == nil {
+		return fmt.Errorf("%s : %s : `Run` must not be nil", ErrInvalidWorker, w.Name)
+	}
+	if w.Restart != nil {
+		if err := w.Restart.validate(); err != nil {
+			return fmt.Errorf("%s : %s : %s", ErrInvalidWorker, w.Name, err)
+		}
+	}
+	return nil
+}
+
+// Worker is used to provide workers via dependency injection. Workers are run after the app is started, and are
+// stopped when the app is stopped.
+type Worker struct {
+	fx.Out
+
+	WorkerTask `group:"Worker"`
+}
+
+// NewWorker constructs a new unsupervised Worker - see `Worker.WithRestartPolicy()`
+func NewWorker(name string, run func(ctx context.Context) error) Worker {
+	return Worker{WorkerTask: WorkerTask{Name: name, Run: run}}
+}
+
+// WithRestartPolicy supervises the worker, i.e., the worker is restarted with backoff when it fails
+func (w Worker) WithRestartPolicy(policy RestartPolicy) Worker {
+	w.Restart = &policy
+	return w
+}
+
+type workerFailure struct {
+	name     string
+	failures int
+	outcome  string
+	backoff  time.Duration
+	err      error
+}
+
+func (f workerFailure) MarshalZerologObject(e *zerolog.Event) {
+	e.Str("name", f.name).Int("failures", f.failures).Str("outcome", f.outcome)
+	if f.outcome == workerRestart {
+		e.Dur("backoff", f.backoff)
+	}
+	e.Err(f.err)
+}
+
+type workersParams struct {
+	fx.In
+
+	Lifecycle       fx.Lifecycle
+	Workers         []WorkerTask `group:"Worker"`
+	Clock           clock.Clock
+	RequestShutdown RequestShutdown
+	Shutdown        *shutdownState
+	Registerer      prometheus.Registerer
+	Logger          *zerolog.Logger
+}
+
+type workers struct {
+	params        workersParams
+	restarts      *prometheus.CounterVec
+	logRestart    eventlog.Logger
+	logEscalation eventlog.Logger
+}
+
+// runWorkers runs the workers in the background while the app is running
+func runWorkers(params workersParams) error {
+	if len(params.Workers) == 0 {
+		return nil
+	}
+	var err error
+	names := make(map[string]bool, len(params.Workers))
+	for _, worker := range params.Workers {
+		if e := worker.validate(); e != nil {
+			err = multierr.Append(err, e)
+			continue
+		}
+		if names[worker.Name] {
+			err = multierr.Append(err, fmt.Errorf("%s : worker name must be unique : %s", ErrInvalidWorker, worker.Name))
+		}
+		names[worker.Name] = true
+	}
+	if err != nil {
+		return err
+	}
+
+	w := &workers{
+		params: params,
+		restarts: prometheus.NewCounterVec(
+			prometheus.CounterOpts{Name: WorkerRestartsMetricID, Help: "worker restarts"},
+			[]string{"worker"},
+		),
+		logRestart:    eventlog.NewLogger(WorkerFailedEvent, params.Logger, zerolog.WarnLevel),
+		logEscalation: eventlog.NewLogger(WorkerFailedEvent, params.Logger, zerolog.ErrorLevel),
+	}
+	if err := params.Registerer.Register(w.restarts); err != nil {
+		return err
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+	var wg sync.WaitGroup
+	params.Lifecycle.Append(fx.Hook{
+		OnStart: func(context.Context) error {
+			for _, worker := range params.Workers {
+				wg.Add(1)
+				go func(worker WorkerTask) {
+					defer wg.Done()
+					// workers are run after the app has started, i.e., worker failures can shutdown the app
+					select {
+					case <-params.Shutdown.started:
+					case <-ctx.Done():
+						return
+					}
+					w.supervise(ctx, worker)
+				}(worker)
+			}
+			return nil
+		},
+		OnStop: func(stopCtx context.Context) error {
+			cancel()
+			done := make(chan struct{})
+			go func() {
+				wg.Wait()
+				close(done)
+			}()
+			select {
+			case <-done:
+				return nil
+			case <-stopCtx.Done():
+				return stopCtx.Err()
+			}
+		},
+	})
+	return nil
+}
+
+// supervise runs the worker until it completes, the app is stopped, or the worker failure is escalated
+func (w *workers) supervise(ctx context.Context, worker WorkerTask) {
+	var policy RestartPolicy
+	if worker.Restart != nil {
+		policy = worker.Restart.withDefaults()
+	}
+	failures := 0
+	for {
+		start := w.params.Clock.Now()
+		err := runWorker(ctx, worker)
+		if ctx.Err() != nil || err == nil {
+			return
+		}
+		if worker.Restart != nil && w.params.Clock.Since(start) >= policy.ResetAge {
+			failures = 0
+		}
+		failures++
+		failure := workerFailure{name: worker.Name, failures: failures, outcome: workerEscalate, err: err}
+		if worker.Restart == nil || failures > policy.MaxRestarts {
+			w.logEscalation(failure, "worker failed")
+			w.params.RequestShutdown(ShutdownReason{
+				Code: ShutdownFatalError,
+				Msg:  fmt.Sprintf("worker [%s] failed %d consecutive times : %v", worker.Name, failures, err),
+			})
+			return
+		}
+		failure.outcome, failure.backoff = workerRestart, policy.backoff(failures)
+		w.logRestart(failure, "worker failed - restarting")
+		timer := w.params.Clock.NewTimer(failure.backoff)
+		select {
+		case <-ctx.Done():
+			timer.Stop()
+			return
+		case <-timer.C():
+		}
+		w.restarts.WithLabelValues(worker.Name).Inc()
+	}
+}
+
+// runWorker recovers worker panics as errors
+func runWorker(ctx context.Context, worker WorkerTask) (err error) {
+	defer func() {
+		if p := recover(); p != nil {
+			err = fmt.Errorf("%s : %v", ErrWorkerPanic, p)
+		}
+	}()
+	return worker.Run(ctx)
+}
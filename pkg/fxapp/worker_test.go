@@ -0,0 +1,202 @@
+/*
+ * Copyright (c) 2019 OysterPack, Inc.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ * http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package fxapp_test
+
+import (
+	"context"
+	"errors"
+	"github.com/oysterpack/andiamo/pkg/fxapp"
+	"github.com/oysterpack/andiamo/pkg/fxapptest"
+	"github.com/oysterpack/andiamo/pkg/ulids"
+	"github.com/prometheus/client_golang/prometheus"
+	dto "github.com/prometheus/client_model/go"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestWorker(t *testing.T) {
+	t.Parallel()
+
+	t.Run("worker is stopped when the app is stopped", func(t *testing.T) {
+		stopped := make(chan struct{})
+		app, err := fxapp.NewBuilder(fxapp.ID(ulids.MustNew()), fxapp.ReleaseID(ulids.MustNew())).
+			Provide(func() fxapp.Worker {
+				return fxapp.NewWorker("foo", func(ctx context.Context) error {
+					<-ctx.Done()
+					close(stopped)
+					return ctx.Err()
+				})
+			}).
+			Invoke(func() {}).
+			DisableHTTPServer().
+			LogWriter(fxapptest.NewLogCapture()).
+			Build()
+		require.NoError(t, err)
+
+		go app.Run()
+		<-app.Ready()
+		require.NoError(t, app.Shutdown())
+		<-app.Done()
+		<-stopped
+		reason, _ := app.ShutdownReason()
+		assert.Equal(t, fxapp.ShutdownRequested, reason.Code)
+	})
+
+	t.Run("unsupervised worker failure shuts down the app", func(t *testing.T) {
+		logs := fxapptest.NewLogCapture()
+		app, err := fxapp.NewBuilder(fxapp.ID(ulids.MustNew()), fxapp.ReleaseID(ulids.MustNew())).
+			Provide(func() fxapp.Worker {
+				return fxapp.NewWorker("foo", func(ctx context.Context) error {
+					return errors.New("BOOM")
+				})
+			}).
+			Invoke(func() {}).
+			DisableHTTPServer().
+			LogWriter(logs).
+			Build()
+		require.NoError(t, err)
+
+		go app.Run()
+		<-app.Done()
+		reason, _ := app.ShutdownReason()
+		assert.Equal(t, fxapp.ShutdownFatalError, reason.Code)
+		assert.Contains(t, reason.Msg, "BOOM")
+		fxapptest.AssertEventLogged(t, logs, fxapp.WorkerFailedEvent,
+			fxapptest.Field("l", "error"),
+			fxapptest.Field("d.name", "foo"),
+			fxapptest.Field("d.outcome", "escalate"),
+		)
+	})
+
+	t.Run("supervised worker is restarted", func(t *testing.T) {
+		logs := fxapptest.NewLogCapture()
+		var runs int32
+		var gatherer prometheus.Gatherer
+		app, err := fxapp.NewBuilder(fxapp.ID(ulids.MustNew()), fxapp.ReleaseID(ulids.MustNew())).
+			Provide(func() fxapp.Worker {
+				return fxapp.NewWorker("foo", func(ctx context.Context) error {
+					if atomic.AddInt32(&runs, 1) < 3 {
+						panic("BOOM")
+					}
+					<-ctx.Done()
+					return nil
+				}).WithRestartPolicy(fxapp.RestartPolicy{InitialBackoff: time.Millisecond})
+			}).
+			Invoke(func() {}).
+			Populate(&gatherer).
+			DisableHTTPServer().
+			LogWriter(logs).
+			Build()
+		require.NoError(t, err)
+
+		go app.Run()
+		<-app.Ready()
+		for atomic.LoadInt32(&runs) < 3 {
+			time.Sleep(time.Millisecond)
+		}
+		require.NoError(t, app.Shutdown())
+		<-app.Done()
+		reason, _ := app.ShutdownReason()
+		assert.Equal(t, fxapp.ShutdownRequested, reason.Code)
+		fxapptest.AssertEventLogged(t, logs, fxapp.WorkerFailedEvent,
+			fxapptest.Field("l", "warn"),
+			fxapptest.Field("d.outcome", "restart"),
+			fxapptest.Field("d.failures", 2),
+		)
+
+		mfs, err := gatherer.Gather()
+		require.NoError(t, err)
+		mf := fxapp.FindMetricFamily(mfs, func(mf *dto.MetricFamily) bool { return mf.GetName() == fxapp.WorkerRestartsMetricID })
+		require.NotNil(t, mf)
+		assert.Equal(t, float64(2), mf.Metric[0].GetCounter().GetValue())
+	})
+
+	t.Run("supervised worker failure is escalated after max restarts", func(t *testing.T) {
+		logs := fxapptest.NewLogCapture()
+		var runs int32
+		app, err := fxapp.NewBuilder(fxapp.ID(ulids.MustNew()), fxapp.ReleaseID(ulids.MustNew())).
+			Provide(func() fxapp.Worker {
+				return fxapp.NewWorker("foo", func(ctx context.Context) error {
+					atomic.AddInt32(&runs, 1)
+					return errors.New("BOOM")
+				}).WithRestartPolicy(fxapp.RestartPolicy{MaxRestarts: 2, InitialBackoff: time.Millisecond})
+			}).
+			Invoke(func() {}).
+			DisableHTTPServer().
+			LogWriter(logs).
+			Build()
+		require.NoError(t, err)
+
+		go app.Run()
+		<-app.Done()
+		reason, _ := app.ShutdownReason()
+		assert.Equal(t, fxapp.ShutdownFatalError, reason.Code)
+		assert.Equal(t, int32(3), atomic.LoadInt32(&runs))
+		fxapptest.AssertEventLogged(t, logs, fxapp.WorkerFailedEvent,
+			fxapptest.Field("d.outcome", "escalate"),
+			fxapptest.Field("d.failures", 3),
+		)
+	})
+
+	t.Run("supervised worker failure is escalated without restarts", func(t *testing.T) {
+		logs := fxapptest.NewLogCapture()
+		var runs int32
+		app, err := fxapp.NewBuilder(fxapp.ID(ulids.MustNew()), fxapp.ReleaseID(ulids.MustNew())).
+			Provide(func() fxapp.Worker {
+				return fxapp.NewWorker("foo", func(ctx context.Context) error {
+					atomic.AddInt32(&runs, 1)
+					return errors.New("BOOM")
+				}).WithRestartPolicy(fxapp.RestartPolicy{MaxRestarts: fxapp.NoRestarts})
+			}).
+			Invoke(func() {}).
+			DisableHTTPServer().
+			LogWriter(logs).
+			Build()
+		require.NoError(t, err)
+
+		go app.Run()
+		<-app.Done()
+		reason, _ := app.ShutdownReason()
+		assert.Equal(t, fxapp.ShutdownFatalError, reason.Code)
+		assert.Equal(t, int32(1), atomic.LoadInt32(&runs))
+		fxapptest.AssertEventLogged(t, logs, fxapp.WorkerFailedEvent,
+			fxapptest.Field("d.outcome", "escalate"),
+			fxapptest.Field("d.failures", 1),
+		)
+	})
+}
+
+func TestWorker_Invalid(t *testing.T) {
+	t.Parallel()
+
+	_, err := fxapp.NewBuilder(fxapp.ID(ulids.MustNew()), fxapp.ReleaseID(ulids.MustNew())).
+		Provide(
+			func() fxapp.Worker { return fxapp.NewWorker(" ", func(ctx context.Context) error { return nil }) },
+			func() fxapp.Worker {
+				return fxapp.NewWorker("foo", nil).WithRestartPolicy(fxapp.RestartPolicy{MaxRestarts: -2})
+			},
+		).
+		Invoke(func() {}).
+		DisableHTTPServer().
+		LogWriter(fxapptest.NewLogCapture()).
+		Build()
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), fxapp.ErrInvalidWorker.Error())
+}
@@ -0,0 +1,161 @@
+/*
+ * Copyright (c) 2019 OysterPack, Inc.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ * http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package fxapp
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"github.com/oysterpack/andiamo/pkg/ulids"
+	"go.uber.org/multierr"
+	"net/http"
+	"net/url"
+	"strings"
+)
+
+// XRef cross-references related app descriptors, i.e., events, errors, metrics, and health checks, and links them to a
+// runbook. For example, the `HealthCheckResultEvent` is related to the health check gauge (`HealthCheckMetricID`) and
+// the health check IDs. Because the IDs are present in the logs and metrics, XRefs can be used to power auto-generated
+// runbooks, i.e., to go from a log event or an alert to the related descriptors and the runbook.
+//
+// XRefs are registered via the app builder - see `Builder.RegisterXRefs()`.
+type XRef struct {
+	// ID format is ULID
+	ID          string
+	Description string
+
+	// Events are the IDs of the related events
+	Events []string
+	// Errors are the related errors
+	Errors []error
+	// Metrics are the names of the related metrics
+	Metrics []string
+	// HealthChecks are the IDs of the related health checks
+	HealthChecks []string
+
+	// RunbookURL is optional, but if specified, then it must be an absolute URL
+	RunbookURL string
+}
+
+// xref registration validation errors
+var (
+	ErrXRefIDNotULID         = errors.New("xref `ID` must be a ULID")
+	ErrXRefNoRefs            = errors.New("xref must reference at least 1 event, error, metric, or health check")
+	ErrXRefInvalidRunbookURL = errors.New("xref `RunbookURL` must be an absolute URL")
+	ErrXRefAlreadyRegistered = errors.New("xref is already registered")
+)
+
+func (x *XRef) validate() error {
+	var err error
+	if _, e := ulids.Parse(x.ID); e != nil {
+		err = multierr.Append(err, ErrXRefIDNotULID)
+	}
+	if len(x.Events)+len(x.Errors)+len(x.Metrics)+len(x.HealthChecks) == 0 {
+		err = multierr.Append(err, ErrXRefNoRefs)
+	}
+	if x.RunbookURL != "" {
+		if u, e := url.Parse(x.RunbookURL); e != nil || !u.IsAbs() {
+			err = multierr.Append(err, ErrXRefInvalidRunbookURL)
+		}
+	}
+	if err != nil {
+		return multierr.Append(fmt.Errorf("invalid xref: %s", x.ID), err)
+	}
+	return nil
+}
+
+// refs returns true if the xref ID matches the key, or if the xref references the key, i.e., an event ID, error message,
+// metric name, or health check ID
+func (x *XRef) refs(key string) bool {
+	if x.ID == key {
+		return true
+	}
+	for _, refs := range [][]string{x.Events, errorMessages(x.Errors), x.Metrics, x.HealthChecks} {
+		for _, ref := range refs {
+			if ref == key {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// MarshalJSON implements json.Marshaler interface
+func (x *XRef) MarshalJSON() ([]byte, error) {
+	return json.Marshal(struct {
+		ID           string   `json:"id"`
+		Description  string   `json:"description,omitempty"`
+		Events       []string `json:"events,omitempty"`
+		Errors       []string `json:"errors,omitempty"`
+		Metrics      []string `json:"metrics,omitempty"`
+		HealthChecks []string `json:"health_checks,omitempty"`
+		RunbookURL   string   `json:"runbook_url,omitempty"`
+	}{
+		ID:           x.ID,
+		Description:  x.Description,
+		Events:       x.Events,
+		Errors:       errorMessages(x.Errors),
+		Metrics:      x.Metrics,
+		HealthChecks: x.HealthChecks,
+		RunbookURL:   x.RunbookURL,
+	})
+}
+
+// RegisteredXRefs returns the xrefs that are registered with the app
+type RegisteredXRefs func() []XRef
+
+// XRefsEndpoint is used to construct the xrefs HTTP endpoint, which returns the registered xrefs as JSON.
+//
+// The xrefs can be looked up by the "id" query param, which matches on the xref ID and the referenced IDs, i.e., event
+// IDs, metric names, and health check IDs, e.g.,
+//
+//	GET /01DHXMAR3ZX9ZXWK64NMQ6A5SW?id=01DF3X60Z7XFYVVXGE9TFFQ7Z1
+//
+// If no xrefs match, then HTTP status code 404 is returned.
+const XRefsEndpoint = "01DHXMAR3ZX9ZXWK64NMQ6A5SW"
+
+func xrefsHTTPHandler(xrefs RegisteredXRefs) HTTPHandler {
+	return NewHTTPHandler(fmt.Sprintf("/%s", XRefsEndpoint), func(writer http.ResponseWriter, request *http.Request) {
+		key := strings.TrimSpace(request.URL.Query().Get("id"))
+		refs := xrefs()
+		jsonRefs := make([]*XRef, 0, len(refs))
+		for i := range refs {
+			if key == "" || refs[i].refs(key) {
+				jsonRefs = append(jsonRefs, &refs[i])
+			}
+		}
+		if key != "" && len(jsonRefs) == 0 {
+			http.Error(writer, fmt.Sprintf("no xrefs found for: %s", key), http.StatusNotFound)
+			return
+		}
+		data, err := json.Marshal(jsonRefs)
+		if err != nil {
+			http.Error(writer, err.Error(), http.StatusInternalServerError)
+			return
+		}
+		writer.Header().Set("Content-Type", JSONMediaType)
+		writer.Write(data)
+	}).WithDoc(OpenAPIOperation{
+		Summary: "registered xrefs",
+		Tags:    []string{BuiltinOpenAPITag},
+		Params:  []OpenAPIParam{{Name: "id", Description: "looks up the xrefs that reference the ID"}},
+		Responses: []OpenAPIResponse{
+			{Status: http.StatusOK, MediaTypes: []string{JSONMediaType}},
+			{Status: http.StatusNotFound, Description: "no xrefs reference the ID"},
+		},
+	}).AdminOnly()
+}
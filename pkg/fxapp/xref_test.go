@@ -0,0 +1,143 @@
+/*
+ * Copyright (c) 2019 OysterPack, Inc.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ * http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package fxapp_test
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"github.com/oysterpack/andiamo/pkg/fxapp"
+	"github.com/oysterpack/andiamo/pkg/ulids"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"net/http"
+	"testing"
+)
+
+var HealthCheckXRef = fxapp.XRef{
+	ID:           "01DHXN4Q0C1F6G5V8XWZ3TPM2K",
+	Description:  "health check results",
+	Events:       []string{fxapp.HealthCheckResultEvent},
+	Errors:       []error{errors.New("BOOM")},
+	Metrics:      []string{fxapp.HealthCheckMetricID},
+	HealthChecks: []string{"01DHXN5B8R2M7TYQ9VJ4K6W3EC"},
+	RunbookURL:   "https://runbooks.example.com/health",
+}
+
+func TestBuilder_RegisterXRefs(t *testing.T) {
+	t.Parallel()
+
+	t.Run("valid xref", func(t *testing.T) {
+		var xrefs fxapp.RegisteredXRefs
+		_, err := fxapp.NewBuilder(fxapp.ID(ulids.MustNew()), fxapp.ReleaseID(ulids.MustNew())).
+			RegisterXRefs(HealthCheckXRef).
+			Invoke(func() {}).
+			Populate(&xrefs).
+			DisableHTTPServer().
+			Build()
+		require.NoError(t, err)
+		require.Len(t, xrefs(), 1)
+		assert.Equal(t, HealthCheckXRef.ID, xrefs()[0].ID)
+	})
+
+	t.Run("invalid xref", func(t *testing.T) {
+		_, err := fxapp.NewBuilder(fxapp.ID(ulids.MustNew()), fxapp.ReleaseID(ulids.MustNew())).
+			RegisterXRefs(fxapp.XRef{ID: "invalid", RunbookURL: "runbooks/health"}).
+			Invoke(func() {}).
+			DisableHTTPServer().
+			Build()
+		require.Error(t, err)
+		t.Log(err)
+		assert.Contains(t, err.Error(), fxapp.ErrXRefIDNotULID.Error())
+		assert.Contains(t, err.Error(), fxapp.ErrXRefNoRefs.Error())
+		assert.Contains(t, err.Error(), fxapp.ErrXRefInvalidRunbookURL.Error())
+	})
+
+	t.Run("xref is registered twice", func(t *testing.T) {
+		_, err := fxapp.NewBuilder(fxapp.ID(ulids.MustNew()), fxapp.ReleaseID(ulids.MustNew())).
+			RegisterXRefs(HealthCheckXRef, HealthCheckXRef).
+			Invoke(func() {}).
+			DisableHTTPServer().
+			Build()
+		require.Error(t, err)
+		t.Log(err)
+		assert.Contains(t, err.Error(), fxapp.ErrXRefAlreadyRegistered.Error())
+	})
+}
+
+func TestXRefsHTTPEndpoint(t *testing.T) {
+	OtherXRef := fxapp.XRef{
+		ID:     "01DHXN6J2D9P4QW8ZRB7CX5HVA",
+		Events: []string{fxapp.ReadyEvent},
+	}
+	app, err := fxapp.NewBuilder(fxapp.ID(ulids.MustNew()), fxapp.ReleaseID(ulids.MustNew())).
+		RegisterXRefs(HealthCheckXRef, OtherXRef).
+		Invoke(func() {}).
+		AllowUnauthenticatedAdmin().
+		Build()
+	require.NoError(t, err)
+
+	go app.Run()
+	<-app.Ready()
+	defer func() {
+		app.Shutdown()
+		<-app.Done()
+	}()
+
+	type xref struct {
+		ID           string   `json:"id"`
+		Events       []string `json:"events"`
+		Errors       []string `json:"errors"`
+		Metrics      []string `json:"metrics"`
+		HealthChecks []string `json:"health_checks"`
+		RunbookURL   string   `json:"runbook_url"`
+	}
+
+	get := func(key string) []xref {
+		var xrefs []xref
+		checkHTTPGetResponse(t, fmt.Sprintf("http://:8008/%s?id=%s", fxapp.XRefsEndpoint, key), func(response *http.Response) {
+			defer response.Body.Close()
+			require.Equal(t, http.StatusOK, response.StatusCode)
+			require.NoError(t, json.NewDecoder(response.Body).Decode(&xrefs))
+		})
+		return xrefs
+	}
+
+	t.Run("all xrefs", func(t *testing.T) {
+		xrefs := get("")
+		require.Len(t, xrefs, 2)
+		assert.Equal(t, HealthCheckXRef.ID, xrefs[0].ID)
+		assert.Equal(t, HealthCheckXRef.Events, xrefs[0].Events)
+		assert.Equal(t, []string{"BOOM"}, xrefs[0].Errors)
+		assert.Equal(t, HealthCheckXRef.Metrics, xrefs[0].Metrics)
+		assert.Equal(t, HealthCheckXRef.HealthChecks, xrefs[0].HealthChecks)
+		assert.Equal(t, HealthCheckXRef.RunbookURL, xrefs[0].RunbookURL)
+		assert.Equal(t, OtherXRef.ID, xrefs[1].ID)
+	})
+
+	t.Run("lookup by referenced ID", func(t *testing.T) {
+		for _, key := range []string{HealthCheckXRef.ID, fxapp.HealthCheckResultEvent, fxapp.HealthCheckMetricID, HealthCheckXRef.HealthChecks[0]} {
+			xrefs := get(key)
+			require.Len(t, xrefs, 1)
+			assert.Equal(t, HealthCheckXRef.ID, xrefs[0].ID)
+		}
+	})
+
+	t.Run("xref not found", func(t *testing.T) {
+		checkHTTPGetResponseStatus(t, fmt.Sprintf("http://:8008/%s?id=%s", fxapp.XRefsEndpoint, ulids.MustNew()), http.StatusNotFound)
+	})
+}
@@ -0,0 +1,167 @@
+/*
+ * Copyright (c) 2019 OysterPack, Inc.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ * http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package fxapptest
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"strings"
+	"sync"
+	"time"
+)
+
+// ErrEventNotLogged is returned when waiting for an event times out
+var ErrEventNotLogged = errors.New("event was not logged")
+
+// LogCapture is used to capture log events in memory, e.g., it is used as the app log writer in unit tests. Log events
+// are decoded as they are written, i.e., as each line is written.
+//
+// It is safe for concurrent use.
+type LogCapture struct {
+	m sync.Mutex
+	// buffers partial lines
+	partial bytes.Buffer
+	events  []LogEvent
+	// lines that failed to be decoded as JSON log events
+	invalidLines []string
+	// closed when an event is captured, i.e., used to notify waiters
+	captured chan struct{}
+}
+
+// NewLogCapture is the LogCapture constructor
+func NewLogCapture() *LogCapture {
+	return &LogCapture{captured: make(chan struct{})}
+}
+
+func (c *LogCapture) Write(data []byte) (int, error) {
+	c.m.Lock()
+	defer c.m.Unlock()
+	c.partial.Write(data)
+	var captured bool
+	for {
+		i := bytes.IndexByte(c.partial.Bytes(), '\n')
+		if i < 0 {
+			break
+		}
+		line := strings.TrimSpace(string(c.partial.Next(i + 1)))
+		if line == "" {
+			continue
+		}
+		e, err := ParseLogEvent(line)
+		if err != nil {
+			c.invalidLines = append(c.invalidLines, line)
+			continue
+		}
+		c.events = append(c.events, e)
+		captured = true
+	}
+	if captured {
+		close(c.captured)
+		c.captured = make(chan struct{})
+	}
+	return len(data), nil
+}
+
+// Events returns the captured log events in the order they were logged
+func (c *LogCapture) Events() []LogEvent {
+	c.m.Lock()
+	defer c.m.Unlock()
+	return append([]LogEvent(nil), c.events...)
+}
+
+// InvalidLines returns the lines that could not be decoded as JSON log events
+func (c *LogCapture) InvalidLines() []string {
+	c.m.Lock()
+	defer c.m.Unlock()
+	return append([]string(nil), c.invalidLines...)
+}
+
+// FindEvents returns the captured log events with the specified name that match all of the field matchers
+func (c *LogCapture) FindEvents(name string, matchers ...FieldMatcher) []LogEvent {
+	events, _ := c.findEvents(name, matchers)
+	return events
+}
+
+func (c *LogCapture) findEvents(name string, matchers []FieldMatcher) ([]LogEvent, <-chan struct{}) {
+	c.m.Lock()
+	defer c.m.Unlock()
+	var events []LogEvent
+	for _, e := range c.events {
+		if e.Name == name && matchesAll(e, matchers) {
+			events = append(events, e)
+		}
+	}
+	return events, c.captured
+}
+
+// WaitForEvent waits for an event with the specified name that matches all of the field matchers to be logged. The
+// first matching event is returned. If the event is not logged within the timeout, then ErrEventNotLogged is returned.
+func (c *LogCapture) WaitForEvent(name string, timeout time.Duration, matchers ...FieldMatcher) (LogEvent, error) {
+	timer := time.NewTimer(timeout)
+	defer timer.Stop()
+	for {
+		events, captured := c.findEvents(name, matchers)
+		if len(events) > 0 {
+			return events[0], nil
+		}
+		select {
+		case <-captured:
+		case <-timer.C:
+			return LogEvent{}, fmt.Errorf("%s : %s %v", ErrEventNotLogged, name, matchers)
+		}
+	}
+}
+
+// String returns the captured log events, one per line
+func (c *LogCapture) String() string {
+	c.m.Lock()
+	defer c.m.Unlock()
+	lines := make([]string, 0, len(c.events))
+	for _, e := range c.events {
+		lines = append(lines, e.Raw)
+	}
+	return strings.Join(lines, "\n")
+}
+
+// TestingT is the subset of testing.TB that is required by the assertions
+type TestingT interface {
+	Helper()
+	Errorf(format string, args ...interface{})
+}
+
+// AssertEventLogged asserts that an event with the specified name that matches all of the field matchers was logged.
+// The first matching event is returned. If no matching event is found, then the test is failed and the captured log
+// events are reported.
+func AssertEventLogged(t TestingT, c *LogCapture, name string, matchers ...FieldMatcher) (LogEvent, bool) {
+	t.Helper()
+	if events := c.FindEvents(name, matchers...); len(events) > 0 {
+		return events[0], true
+	}
+	t.Errorf("*** %s : %s %v\n%s", ErrEventNotLogged, name, matchers, c)
+	return LogEvent{}, false
+}
+
+// AssertEventNotLogged asserts that no event with the specified name that matches all of the field matchers was logged
+func AssertEventNotLogged(t TestingT, c *LogCapture, name string, matchers ...FieldMatcher) bool {
+	t.Helper()
+	if events := c.FindEvents(name, matchers...); len(events) > 0 {
+		t.Errorf("*** event should not have been logged : %s %v\n%s", name, matchers, events[0])
+		return false
+	}
+	return true
+}
@@ -0,0 +1,117 @@
+/*
+ * Copyright (c) 2019 OysterPack, Inc.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ * http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package fxapptest_test
+
+import (
+	"fmt"
+	"github.com/oklog/ulid"
+	"github.com/oysterpack/andiamo/pkg/fxapp"
+	"github.com/oysterpack/andiamo/pkg/fxapptest"
+	"github.com/oysterpack/andiamo/pkg/ulids"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"testing"
+	"time"
+)
+
+func TestLogCapture(t *testing.T) {
+	t.Parallel()
+
+	appID := ulids.MustNew()
+	logs := fxapptest.NewLogCapture()
+	app, err := fxapp.NewBuilder(fxapp.ID(appID), fxapp.ReleaseID(ulids.MustNew())).
+		LogWriter(logs).
+		Invoke(func() {}).
+		DisableHTTPServer().
+		Build()
+	require.NoError(t, err)
+
+	e, ok := fxapptest.AssertEventLogged(t, logs, fxapp.InitializedEvent,
+		fxapptest.Field(fxapp.AppIDLabel, ulid.ULID(appID).String()),
+		fxapptest.FieldExists("d.dot_graph"),
+	)
+	require.True(t, ok)
+	assert.Equal(t, "app initialized", e.Message)
+	assert.Equal(t, ulid.ULID(appID).String(), e.AppID)
+	assert.NotEmpty(t, e.XID)
+	assert.False(t, e.Time().IsZero())
+	var data struct {
+		DotGraph string `json:"dot_graph"`
+	}
+	require.NoError(t, e.DecodeData(&data))
+	assert.NotEmpty(t, data.DotGraph)
+
+	go app.Run()
+	defer func() {
+		app.Shutdown()
+		<-app.Done()
+	}()
+	_, err = logs.WaitForEvent(fxapp.ReadyEvent, 5*time.Second)
+	require.NoError(t, err)
+	assert.Empty(t, logs.InvalidLines())
+
+	t.Run("event not logged", func(t *testing.T) {
+		_, err := logs.WaitForEvent(fxapp.ReadyEvent, time.Millisecond, fxapptest.Field(fxapp.AppIDLabel, "foo"))
+		require.Error(t, err)
+		assert.Contains(t, err.Error(), fxapptest.ErrEventNotLogged.Error())
+
+		mockT := new(mockTestingT)
+		_, ok := fxapptest.AssertEventLogged(mockT, logs, fxapp.ReadyEvent, fxapptest.Field(fxapp.AppIDLabel, "foo"))
+		assert.False(t, ok)
+		assert.True(t, mockT.failed)
+
+		assert.True(t, fxapptest.AssertEventNotLogged(t, logs, fxapp.ReadyEvent, fxapptest.Field(fxapp.AppIDLabel, "foo")))
+	})
+}
+
+func TestLogCapture_Write(t *testing.T) {
+	t.Parallel()
+
+	logs := fxapptest.NewLogCapture()
+	const event = "01DHXQ7T3J0F6XK2N8B5WZR4CV"
+
+	done := make(chan error)
+	go func() {
+		_, err := logs.WaitForEvent(event, 5*time.Second, fxapptest.FieldMatches("d.count", func(v interface{}) bool {
+			return v.(float64) > 1
+		}))
+		done <- err
+	}()
+
+	// log events may be written in chunks, i.e., partial lines are buffered
+	fmt.Fprintf(logs, `{"n":%q,"d":{"count":1}}`+"\n"+`{"n":%q,"d":{"co`, event, event)
+	assert.Len(t, logs.Events(), 1)
+	fmt.Fprint(logs, `unt":2},"m":"foo"}`+"\nnot json\n")
+	require.NoError(t, <-done)
+
+	events := logs.FindEvents(event)
+	require.Len(t, events, 2)
+	assert.Equal(t, "foo", events[1].Message)
+	assert.Equal(t, []string{"not json"}, logs.InvalidLines())
+	_, ok := fxapptest.AssertEventLogged(t, logs, event, fxapptest.Field("d.count", 2), fxapptest.Field("m", "foo"))
+	assert.True(t, ok)
+}
+
+type mockTestingT struct {
+	failed bool
+}
+
+func (t *mockTestingT) Helper() {}
+
+func (t *mockTestingT) Errorf(format string, args ...interface{}) {
+	t.failed = true
+}
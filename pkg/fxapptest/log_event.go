@@ -0,0 +1,167 @@
+/*
+ * Copyright (c) 2019 OysterPack, Inc.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ * http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package fxapptest
+
+import (
+	"encoding/json"
+	"fmt"
+	"strings"
+	"time"
+)
+
+// LogEvent is a decoded log event, which covers the standard log event fields - see the `eventlog` and `fxapp` packages
+type LogEvent struct {
+	Timestamp int64  `json:"t"` // Unix time
+	Level     string `json:"l"` // blank if logged with no level
+	Message   string `json:"m"`
+	Error     string `json:"e"`
+
+	Name string          `json:"n"` // event ID
+	XID  string          `json:"x"` // event instance XID
+	Data json.RawMessage `json:"d"`
+	Tags []string        `json:"g"`
+
+	AppID      string `json:"a"`
+	AppName    string `json:"an"`
+	AppVersion string `json:"av"`
+	ReleaseID  string `json:"r"`
+	InstanceID string `json:"i"`
+
+	ComponentID      string `json:"c"`
+	ComponentName    string `json:"cn"`
+	ComponentVersion string `json:"cv"`
+
+	// Fields contains all of the log event fields, including non-standard fields, as decoded by encoding/json, i.e., JSON
+	// objects are decoded as map[string]interface{} and numbers are decoded as float64
+	Fields map[string]interface{} `json:"-"`
+
+	// Raw is the JSON log event
+	Raw string `json:"-"`
+}
+
+// ParseLogEvent decodes the JSON log event
+func ParseLogEvent(line string) (LogEvent, error) {
+	var e LogEvent
+	if err := json.Unmarshal([]byte(line), &e); err != nil {
+		return e, err
+	}
+	if err := json.Unmarshal([]byte(line), &e.Fields); err != nil {
+		return e, err
+	}
+	e.Raw = line
+	return e, nil
+}
+
+// Time returns the log event timestamp
+func (e LogEvent) Time() time.Time {
+	return time.Unix(e.Timestamp, 0)
+}
+
+// DecodeData decodes the event data into v
+func (e LogEvent) DecodeData(v interface{}) error {
+	if len(e.Data) == 0 {
+		return fmt.Errorf("event has no data : %s", e.Name)
+	}
+	return json.Unmarshal(e.Data, v)
+}
+
+// Field returns the field value for the specified path, where nested fields are separated by '.', e.g., "d.id" refers
+// to the event data "id" field.
+func (e LogEvent) Field(path string) (interface{}, bool) {
+	var value interface{} = e.Fields
+	for _, name := range strings.Split(path, ".") {
+		fields, ok := value.(map[string]interface{})
+		if !ok {
+			return nil, false
+		}
+		if value, ok = fields[name]; !ok {
+			return nil, false
+		}
+	}
+	return value, true
+}
+
+func (e LogEvent) String() string {
+	return e.Raw
+}
+
+// FieldMatcher is used to match log events
+type FieldMatcher interface {
+	Match(e LogEvent) bool
+	fmt.Stringer
+}
+
+type fieldMatcher struct {
+	description string
+	match       func(e LogEvent) bool
+}
+
+func (m fieldMatcher) Match(e LogEvent) bool { return m.match(e) }
+
+func (m fieldMatcher) String() string { return m.description }
+
+// Field matches the field value for the specified path - see `LogEvent.Field()`.
+//
+// Values are compared using their JSON encoding, i.e., `Field("d.count", 1)` matches `{"d":{"count":1}}`.
+func Field(path string, value interface{}) FieldMatcher {
+	expected, err := json.Marshal(value)
+	return fieldMatcher{
+		description: fmt.Sprintf("%s == %s", path, expected),
+		match: func(e LogEvent) bool {
+			if err != nil {
+				return false
+			}
+			v, ok := e.Field(path)
+			if !ok {
+				return false
+			}
+			actual, err := json.Marshal(v)
+			return err == nil && string(actual) == string(expected)
+		},
+	}
+}
+
+// FieldExists matches if the field exists for the specified path - see `LogEvent.Field()`
+func FieldExists(path string) FieldMatcher {
+	return fieldMatcher{
+		description: fmt.Sprintf("%s exists", path),
+		match: func(e LogEvent) bool {
+			_, ok := e.Field(path)
+			return ok
+		},
+	}
+}
+
+// FieldMatches matches if the field exists for the specified path and the field value satisfies the predicate
+func FieldMatches(path string, predicate func(value interface{}) bool) FieldMatcher {
+	return fieldMatcher{
+		description: fmt.Sprintf("%s matches predicate", path),
+		match: func(e LogEvent) bool {
+			v, ok := e.Field(path)
+			return ok && predicate(v)
+		},
+	}
+}
+
+func matchesAll(e LogEvent, matchers []FieldMatcher) bool {
+	for _, m := range matchers {
+		if !m.Match(e) {
+			return false
+		}
+	}
+	return true
+}
@@ -0,0 +1,106 @@
+/*
+ * Copyright (c) 2019 OysterPack, Inc.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ * http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package fxapptest
+
+import (
+	"fmt"
+	"github.com/oysterpack/andiamo/pkg/fxapp"
+	"net/http"
+	"strings"
+	"testing"
+	"time"
+)
+
+// RunAppTimeout is the max amount of time RunApp waits for the app to be ready, and for the app to shutdown
+const RunAppTimeout = 10 * time.Second
+
+// HTTPClient is used to send requests to the app's HTTP server
+type HTTPClient struct {
+	*http.Client
+	// BaseURL is the app's HTTP server URL, e.g., http://127.0.0.1:34567
+	BaseURL string
+}
+
+// URL returns the URL for the specified path, e.g., client.URL(fxapp.ReadyEvent) -> http://127.0.0.1:34567/01DEJ5RA8XRZVECJDJFAA2PWJF
+func (c *HTTPClient) URL(path string) string {
+	return fmt.Sprintf("%s/%s", c.BaseURL, strings.TrimPrefix(path, "/"))
+}
+
+// Get issues a GET request for the specified path - see `URL()`
+func (c *HTTPClient) Get(path string) (*http.Response, error) {
+	return c.Client.Get(c.URL(path))
+}
+
+// RunApp builds and runs the app, waits for the app to be ready, and then runs the test function. When the test function
+// returns, then the app is shutdown - even if the test function panics or calls t.FailNow.
+//
+// The app HTTP server is run on a random free port on the loopback interface, which enables tests that run the app's
+// HTTP server to run in parallel. The HTTP client that is passed to the test function is pointed at the app's HTTP server.
+//
+// Unauthenticated admin access is allowed, i.e., the test can access the admin endpoints, unless the test configures an
+// admin authenticator - see `fxapp.Builder.AllowUnauthenticatedAdmin()`.
+//
+// NOTE: the HTTP server address is set via the builder, i.e., the HTTP server must not be disabled.
+func RunApp(t testing.TB, builder fxapp.Builder, test func(app fxapp.App, client *HTTPClient)) {
+	t.Helper()
+
+	var httpServerAddr fxapp.HTTPServerAddr
+	app, err := builder.
+		SetHTTPServerAddr("127.0.0.1:0").
+		AllowUnauthenticatedAdmin().
+		Populate(&httpServerAddr).
+		Build()
+	if err != nil {
+		t.Fatalf("*** app build failed: %v", err)
+	}
+
+	runErr := make(chan error, 1)
+	go func() {
+		runErr <- app.Run()
+	}()
+	defer func() {
+		app.Shutdown()
+		select {
+		case err := <-runErr:
+			if err != nil {
+				t.Errorf("*** app run failed: %v", err)
+			}
+		case <-time.After(RunAppTimeout):
+			t.Errorf("*** timed out waiting for the app to shutdown")
+		}
+	}()
+
+	select {
+	case <-app.Ready():
+	case err := <-runErr:
+		// put the error back for the deferred shutdown check
+		runErr <- err
+		t.Fatalf("*** app failed to start: %v", err)
+	case <-time.After(RunAppTimeout):
+		t.Fatal("*** timed out waiting for the app to be ready")
+	}
+	// the HTTP server is listening before the app is ready
+	addr := httpServerAddr()
+	if addr == nil {
+		t.Fatal("*** HTTP server is not listening")
+	}
+
+	test(app, &HTTPClient{
+		Client:  &http.Client{Timeout: RunAppTimeout},
+		BaseURL: "http://" + addr.String(),
+	})
+}
@@ -0,0 +1,61 @@
+/*
+ * Copyright (c) 2019 OysterPack, Inc.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ * http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package fxapptest_test
+
+import (
+	"github.com/oysterpack/andiamo/pkg/fxapp"
+	"github.com/oysterpack/andiamo/pkg/fxapptest"
+	"github.com/oysterpack/andiamo/pkg/ulids"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"net/http"
+	"testing"
+	"time"
+)
+
+func TestRunApp(t *testing.T) {
+	t.Parallel()
+
+	// apps are run on random ports, i.e., apps can be run in parallel
+	for i := 0; i < 2; i++ {
+		t.Run("run app", func(t *testing.T) {
+			t.Parallel()
+
+			logs := fxapptest.NewLogCapture()
+			builder := fxapp.NewBuilder(fxapp.ID(ulids.MustNew()), fxapp.ReleaseID(ulids.MustNew())).
+				LogWriter(logs).
+				Invoke(func() {})
+
+			var runningApp fxapp.App
+			fxapptest.RunApp(t, builder, func(app fxapp.App, client *fxapptest.HTTPClient) {
+				runningApp = app
+				response, err := client.Get(fxapp.ReadyEvent)
+				require.NoError(t, err)
+				response.Body.Close()
+				assert.Equal(t, http.StatusOK, response.StatusCode)
+			})
+
+			// the app is shutdown when the test function returns
+			select {
+			case <-runningApp.Done():
+			case <-time.After(time.Second):
+				t.Error("*** app should have been shutdown")
+			}
+			fxapptest.AssertEventLogged(t, logs, fxapp.StoppedEvent)
+		})
+	}
+}
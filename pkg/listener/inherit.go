@@ -0,0 +1,159 @@
+/*
+ * Copyright (c) 2019 OysterPack, Inc.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ * http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package listener
+
+import (
+	"errors"
+	"fmt"
+	"net"
+	"os"
+	"strings"
+	"sync"
+)
+
+// InheritedListenersEnvVar is used to pass listeners to a child process, e.g., for zero-downtime binary upgrades. The
+// value is the comma separated list of the listener addresses. The listener file descriptors are passed in the same
+// order, starting at file descriptor 3 - see `Export()`.
+const InheritedListenersEnvVar = "APP12X_INHERITED_LISTENERS"
+
+// ErrListenerNotExportable indicates the listener does not support exporting its file descriptor
+var ErrListenerNotExportable = errors.New("listener file descriptor cannot be exported")
+
+// the active listeners that were created via Listen(), in the order they were created. The same address may be listened
+// on more than once, e.g., ":0" to listen on random free ports.
+var active = &activeListeners{}
+
+type activeListeners struct {
+	mutex     sync.Mutex
+	listeners []*activeListener
+}
+
+// activeListener unregisters itself when it is closed
+type activeListener struct {
+	net.Listener
+	addr string
+	once sync.Once
+}
+
+func (l *activeListener) Close() error {
+	l.once.Do(func() {
+		active.mutex.Lock()
+		defer active.mutex.Unlock()
+		for i, listener := range active.listeners {
+			if listener == l {
+				active.listeners = append(active.listeners[:i], active.listeners[i+1:]...)
+				break
+			}
+		}
+	})
+	return l.Listener.Close()
+}
+
+func (a *activeListeners) add(addr string, l net.Listener) net.Listener {
+	a.mutex.Lock()
+	defer a.mutex.Unlock()
+	listener := &activeListener{Listener: l, addr: addr}
+	a.listeners = append(a.listeners, listener)
+	return listener
+}
+
+// Export returns duplicates of the active listener file descriptors, i.e., the listeners that were created via Listen()
+// and are not closed, along with the env var that is used by the child process to inherit the listeners. The files must
+// be passed to the child process in order, starting at file descriptor 3, e.g., via exec.Cmd.ExtraFiles.
+//
+// The caller is responsible for closing the files after the child process is started.
+//
+// NOTE: Unix socket files are not removed when the exported listeners are closed, i.e., the child process owns the
+// socket file.
+func Export() ([]*os.File, string, error) {
+	active.mutex.Lock()
+	defer active.mutex.Unlock()
+	files := make([]*os.File, 0, len(active.listeners))
+	addrs := make([]string, 0, len(active.listeners))
+	closeFiles := func() {
+		for _, f := range files {
+			f.Close()
+		}
+	}
+	for _, l := range active.listeners {
+		addr := l.addr
+		if unixListener, ok := l.Listener.(*net.UnixListener); ok {
+			unixListener.SetUnlinkOnClose(false)
+		}
+		filer, ok := l.Listener.(interface{ File() (*os.File, error) })
+		if !ok {
+			closeFiles()
+			return nil, "", fmt.Errorf("%s : %s", ErrListenerNotExportable, addr)
+		}
+		f, err := filer.File()
+		if err != nil {
+			closeFiles()
+			return nil, "", err
+		}
+		files = append(files, f)
+		addrs = append(addrs, addr)
+	}
+	return files, fmt.Sprintf("%s=%s", InheritedListenersEnvVar, strings.Join(addrs, ",")), nil
+}
+
+// inheritedListeners are the listeners that were passed by the parent process, keyed by address. If the same address was
+// listened on more than once, then the listeners are taken in the order they were exported. Each inherited listener can
+// only be taken once.
+type inheritedListeners struct {
+	once  sync.Once
+	mutex sync.Mutex
+	fds   map[string][]uintptr
+
+	getenv  func(string) string
+	start   int
+	newFile func(fd uintptr, name string) *os.File
+}
+
+var parent = &inheritedListeners{getenv: os.Getenv, start: listenFDsStart, newFile: os.NewFile}
+
+func (i *inheritedListeners) load() {
+	i.fds = make(map[string][]uintptr)
+	value := i.getenv(InheritedListenersEnvVar)
+	if value == "" {
+		return
+	}
+	for n, addr := range strings.Split(value, ",") {
+		i.fds[addr] = append(i.fds[addr], uintptr(i.start+n))
+	}
+}
+
+// listen returns false if a listener was not inherited for the address
+func (i *inheritedListeners) listen(addr string) (net.Listener, bool, error) {
+	i.once.Do(i.load)
+	i.mutex.Lock()
+	defer i.mutex.Unlock()
+	fds := i.fds[addr]
+	if len(fds) == 0 {
+		return nil, false, nil
+	}
+	fd := fds[0]
+	if len(fds) == 1 {
+		delete(i.fds, addr)
+	} else {
+		i.fds[addr] = fds[1:]
+	}
+	f := i.newFile(fd, addr)
+	// the file descriptor is dup'ed by the listener
+	defer f.Close()
+	l, err := net.FileListener(f)
+	return l, true, err
+}
@@ -0,0 +1,104 @@
+/*
+ * Copyright (c) 2019 OysterPack, Inc.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ * http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package listener
+
+import (
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"io/ioutil"
+	"net"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// the test is not run in parallel because Export() exports all of the active listeners
+func TestExport(t *testing.T) {
+	dir, err := ioutil.TempDir("", "listener")
+	require.NoError(t, err)
+	defer os.RemoveAll(dir)
+	unixAddr := UnixPrefix + filepath.Join(dir, "app.sock")
+
+	tcp, err := Listen("127.0.0.1:0")
+	require.NoError(t, err)
+	defer tcp.Close()
+	// the same address can be listened on more than once, i.e., each random free port is exported
+	tcp2, err := Listen("127.0.0.1:0")
+	require.NoError(t, err)
+	defer tcp2.Close()
+	unix, err := Listen(unixAddr)
+	require.NoError(t, err)
+	defer unix.Close()
+	closed, err := Listen(UnixPrefix + filepath.Join(dir, "closed.sock"))
+	require.NoError(t, err)
+	closed.Close()
+
+	files, env, err := Export()
+	require.NoError(t, err)
+	require.Len(t, files, 3)
+	require.True(t, strings.HasPrefix(env, InheritedListenersEnvVar+"="))
+
+	// simulate the child process
+	fds := make(map[uintptr]*os.File)
+	for i, f := range files {
+		fds[uintptr(listenFDsStart+i)] = f
+	}
+	child := &inheritedListeners{
+		getenv: func(key string) string {
+			if key == InheritedListenersEnvVar {
+				return strings.TrimPrefix(env, InheritedListenersEnvVar+"=")
+			}
+			return ""
+		},
+		start:   listenFDsStart,
+		newFile: func(fd uintptr, name string) *os.File { return fds[fd] },
+	}
+
+	inheritedTCP, ok, err := child.listen("127.0.0.1:0")
+	require.True(t, ok)
+	require.NoError(t, err)
+	defer inheritedTCP.Close()
+	assert.Equal(t, tcp.Addr().String(), inheritedTCP.Addr().String())
+
+	inheritedTCP2, ok, err := child.listen("127.0.0.1:0")
+	require.True(t, ok)
+	require.NoError(t, err)
+	defer inheritedTCP2.Close()
+	assert.Equal(t, tcp2.Addr().String(), inheritedTCP2.Addr().String())
+
+	_, ok, _ = child.listen("127.0.0.1:0")
+	assert.False(t, ok, "inherited listeners can only be taken once")
+
+	inheritedUnix, ok, err := child.listen(unixAddr)
+	require.True(t, ok)
+	require.NoError(t, err)
+	defer inheritedUnix.Close()
+
+	_, ok, _ = child.listen(unixAddr)
+	assert.False(t, ok, "inherited listeners can only be taken once")
+
+	t.Run("the inherited listener accepts connections after the parent listener is closed", func(t *testing.T) {
+		require.NoError(t, unix.Close())
+		conn, err := net.Dial("unix", strings.TrimPrefix(unixAddr, UnixPrefix))
+		require.NoError(t, err, "unix socket file should not be removed")
+		defer conn.Close()
+		accepted, err := inheritedUnix.Accept()
+		require.NoError(t, err)
+		accepted.Close()
+	})
+}
@@ -0,0 +1,114 @@
+/*
+ * Copyright (c) 2019 OysterPack, Inc.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ * http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+// Package listener creates the network listeners that app servers listen on, i.e., TCP, Unix domain sockets, and
+// listeners that are inherited via systemd socket activation.
+//
+// Addresses are specified as:
+//   - "host:port" - TCP, e.g., ":8008", "127.0.0.1:0"
+//   - "unix:<path>" - Unix domain socket, e.g., "unix:/var/run/app.sock"
+//   - "systemd" - the first listener that is inherited via systemd socket activation
+//   - "systemd:<name>" - the inherited listener with the specified name, i.e., the systemd socket unit FileDescriptorName
+//
+// The active listeners can be exported to a child process, e.g., for zero-downtime binary upgrades - see `Export()`.
+package listener
+
+import (
+	"errors"
+	"fmt"
+	"net"
+	"os"
+	"strings"
+)
+
+// address prefixes
+const (
+	UnixPrefix    = "unix:"
+	SystemdPrefix = "systemd"
+)
+
+// Listener related errors
+var (
+	ErrInvalidAddr         = errors.New(`address must be a TCP address, i.e., "host:port", a Unix socket, i.e., "unix:<path>", or a systemd socket, i.e., "systemd[:<name>]"`)
+	ErrNoInheritedListener = errors.New("inherited systemd listener was not found")
+)
+
+// Validate checks that the address is valid, i.e., it does not check that the address can be listened on
+func Validate(addr string) error {
+	switch {
+	case strings.HasPrefix(addr, UnixPrefix):
+		if strings.TrimSpace(strings.TrimPrefix(addr, UnixPrefix)) == "" {
+			return fmt.Errorf("%s : %s : unix socket path is blank", ErrInvalidAddr, addr)
+		}
+	case addr == SystemdPrefix:
+	case strings.HasPrefix(addr, SystemdPrefix+":"):
+		if strings.TrimSpace(strings.TrimPrefix(addr, SystemdPrefix+":")) == "" {
+			return fmt.Errorf("%s : %s : systemd socket name is blank", ErrInvalidAddr, addr)
+		}
+	default:
+		if _, port, err := net.SplitHostPort(addr); err != nil {
+			return fmt.Errorf("%s : %s : %s", ErrInvalidAddr, addr, err)
+		} else if _, err := net.LookupPort("tcp", port); err != nil {
+			return fmt.Errorf("%s : %s : %s", ErrInvalidAddr, addr, err)
+		}
+	}
+	return nil
+}
+
+// Listen creates a listener for the address - see the package docs for the supported address formats.
+//
+// If a listener for the address was inherited from the parent process, then the inherited listener is used - see
+// `Export()`.
+//
+// Unix sockets: if a stale socket file exists, i.e., nothing is listening on it, then it is removed. The socket file is
+// removed when the listener is closed.
+func Listen(addr string) (net.Listener, error) {
+	if err := Validate(addr); err != nil {
+		return nil, err
+	}
+	l, err := listen(addr)
+	if err != nil {
+		return nil, err
+	}
+	return active.add(addr, l), nil
+}
+
+func listen(addr string) (net.Listener, error) {
+	if l, ok, err := parent.listen(addr); ok {
+		return l, err
+	}
+	switch {
+	case strings.HasPrefix(addr, UnixPrefix):
+		return listenUnix(strings.TrimPrefix(addr, UnixPrefix))
+	case addr == SystemdPrefix:
+		return inherited("")
+	case strings.HasPrefix(addr, SystemdPrefix+":"):
+		return inherited(strings.TrimPrefix(addr, SystemdPrefix+":"))
+	default:
+		return net.Listen("tcp", addr)
+	}
+}
+
+func listenUnix(path string) (net.Listener, error) {
+	if info, err := os.Stat(path); err == nil && info.Mode()&os.ModeSocket != 0 {
+		if conn, err := net.Dial("unix", path); err == nil {
+			conn.Close()
+		} else if err := os.Remove(path); err != nil {
+			return nil, err
+		}
+	}
+	return net.Listen("unix", path)
+}
@@ -0,0 +1,95 @@
+/*
+ * Copyright (c) 2019 OysterPack, Inc.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ * http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package listener_test
+
+import (
+	"github.com/oysterpack/andiamo/pkg/listener"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"io/ioutil"
+	"net"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestValidate(t *testing.T) {
+	t.Parallel()
+
+	for _, addr := range []string{":8008", "127.0.0.1:0", "unix:/tmp/app.sock", "systemd", "systemd:http"} {
+		assert.NoError(t, listener.Validate(addr), addr)
+	}
+	for _, addr := range []string{"", "8008", ":http-alt-invalid", "unix:", "unix: ", "systemd:"} {
+		err := listener.Validate(addr)
+		if assert.Error(t, err, addr) {
+			assert.Contains(t, err.Error(), listener.ErrInvalidAddr.Error())
+		}
+	}
+}
+
+func TestListen_TCP(t *testing.T) {
+	t.Parallel()
+
+	l, err := listener.Listen("127.0.0.1:0")
+	require.NoError(t, err)
+	defer l.Close()
+	assert.Equal(t, "tcp", l.Addr().Network())
+}
+
+func TestListen_Unix(t *testing.T) {
+	t.Parallel()
+
+	dir, err := ioutil.TempDir("", "listener")
+	require.NoError(t, err)
+	defer os.RemoveAll(dir)
+	path := filepath.Join(dir, "app.sock")
+
+	l, err := listener.Listen(listener.UnixPrefix + path)
+	require.NoError(t, err)
+	assert.Equal(t, "unix", l.Addr().Network())
+	assert.Equal(t, path, l.Addr().String())
+
+	t.Run("address is in use", func(t *testing.T) {
+		_, err := listener.Listen(listener.UnixPrefix + path)
+		assert.Error(t, err)
+	})
+
+	require.NoError(t, l.Close())
+	_, err = os.Stat(path)
+	assert.True(t, os.IsNotExist(err), "socket file should be removed when the listener is closed")
+
+	t.Run("stale socket file is removed", func(t *testing.T) {
+		// simulate a process that exited without removing its socket file
+		stale, err := net.ListenUnix("unix", &net.UnixAddr{Name: path, Net: "unix"})
+		require.NoError(t, err)
+		stale.SetUnlinkOnClose(false)
+		require.NoError(t, stale.Close())
+		_, err = os.Stat(path)
+		require.NoError(t, err)
+
+		l, err := listener.Listen(listener.UnixPrefix + path)
+		require.NoError(t, err)
+		l.Close()
+	})
+}
+
+func TestListen_Systemd_NotActivated(t *testing.T) {
+	t.Parallel()
+
+	_, err := listener.Listen(listener.SystemdPrefix)
+	assert.Equal(t, listener.ErrNoInheritedListener, err)
+}
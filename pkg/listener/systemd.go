@@ -0,0 +1,106 @@
+/*
+ * Copyright (c) 2019 OysterPack, Inc.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ * http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package listener
+
+import (
+	"fmt"
+	"net"
+	"os"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+// systemd socket activation env vars - see sd_listen_fds(3)
+const (
+	ListenPIDEnvVar     = "LISTEN_PID"
+	ListenFDsEnvVar     = "LISTEN_FDS"
+	ListenFDNamesEnvVar = "LISTEN_FDNAMES"
+)
+
+// the first inherited file descriptor - see SD_LISTEN_FDS_START
+const listenFDsStart = 3
+
+// inheritedFile is a file descriptor that was passed to the process via systemd socket activation
+type inheritedFile struct {
+	fd   uintptr
+	name string
+}
+
+// systemdFiles are the inherited file descriptors that have not been taken yet, i.e., each inherited file descriptor can
+// only be listened on once. The env vars are parsed once, which enables multiple servers to take their listeners by name.
+type systemdFiles struct {
+	once  sync.Once
+	mutex sync.Mutex
+	files []inheritedFile
+	err   error
+
+	getenv  func(string) string
+	pid     int
+	start   int
+	newFile func(fd uintptr, name string) *os.File
+}
+
+var systemd = &systemdFiles{getenv: os.Getenv, pid: os.Getpid(), start: listenFDsStart, newFile: os.NewFile}
+
+func inherited(name string) (net.Listener, error) {
+	return systemd.listen(name)
+}
+
+func (s *systemdFiles) load() {
+	if pid, err := strconv.Atoi(s.getenv(ListenPIDEnvVar)); err != nil || pid != s.pid {
+		return
+	}
+	count, err := strconv.Atoi(s.getenv(ListenFDsEnvVar))
+	if err != nil || count < 0 {
+		s.err = fmt.Errorf("%s is invalid : %q", ListenFDsEnvVar, s.getenv(ListenFDsEnvVar))
+		return
+	}
+	names := strings.Split(s.getenv(ListenFDNamesEnvVar), ":")
+	for i := 0; i < count; i++ {
+		file := inheritedFile{fd: uintptr(s.start + i)}
+		if i < len(names) {
+			file.name = names[i]
+		}
+		s.files = append(s.files, file)
+	}
+}
+
+// listen takes the first inherited file descriptor with the specified name. If the name is blank, then the first
+// inherited file descriptor is taken.
+func (s *systemdFiles) listen(name string) (net.Listener, error) {
+	s.once.Do(s.load)
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	if s.err != nil {
+		return nil, s.err
+	}
+	for i, file := range s.files {
+		if name != "" && file.name != name {
+			continue
+		}
+		s.files = append(s.files[:i], s.files[i+1:]...)
+		f := s.newFile(file.fd, file.name)
+		// the file descriptor is dup'ed by the listener
+		defer f.Close()
+		return net.FileListener(f)
+	}
+	if name == "" {
+		return nil, ErrNoInheritedListener
+	}
+	return nil, fmt.Errorf("%s : %s", ErrNoInheritedListener, name)
+}
@@ -0,0 +1,81 @@
+/*
+ * Copyright (c) 2019 OysterPack, Inc.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ * http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package listener
+
+import (
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"net"
+	"os"
+	"testing"
+)
+
+func TestSystemdFiles(t *testing.T) {
+	t.Parallel()
+
+	// the listener files simulate the inherited file descriptors
+	files := make(map[uintptr]*os.File)
+	for fd := uintptr(listenFDsStart); fd < listenFDsStart+2; fd++ {
+		l, err := net.Listen("tcp", "127.0.0.1:0")
+		require.NoError(t, err)
+		f, err := l.(*net.TCPListener).File()
+		require.NoError(t, err)
+		l.Close()
+		files[fd] = f
+	}
+
+	env := map[string]string{
+		ListenPIDEnvVar:     "100",
+		ListenFDsEnvVar:     "2",
+		ListenFDNamesEnvVar: "http:grpc",
+	}
+	s := &systemdFiles{
+		getenv: func(key string) string { return env[key] },
+		pid:    100,
+		start:  listenFDsStart,
+		newFile: func(fd uintptr, name string) *os.File {
+			return files[fd]
+		},
+	}
+
+	grpc, err := s.listen("grpc")
+	require.NoError(t, err)
+	defer grpc.Close()
+	_, err = s.listen("grpc")
+	assert.Error(t, err, "inherited listeners can only be taken once")
+
+	http, err := s.listen("")
+	require.NoError(t, err)
+	defer http.Close()
+	assert.Equal(t, "tcp", http.Addr().Network())
+
+	_, err = s.listen("")
+	assert.Equal(t, ErrNoInheritedListener, err)
+}
+
+func TestSystemdFiles_OtherProcess(t *testing.T) {
+	t.Parallel()
+
+	env := map[string]string{ListenPIDEnvVar: "100", ListenFDsEnvVar: "1"}
+	s := &systemdFiles{
+		getenv: func(key string) string { return env[key] },
+		pid:    200,
+		start:  listenFDsStart,
+	}
+	_, err := s.listen("")
+	assert.Equal(t, ErrNoInheritedListener, err)
+}
@@ -0,0 +1,26 @@
+/*
+ * Copyright (c) 2019 OysterPack, Inc.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ * http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+// Package reqctx defines the standard request context carrier, i.e., the request scoped metadata that is propagated via
+// `context.Context`:
+//   - correlation ID - used to correlate the log events and outbound calls that are related to the request
+//   - principal - the authenticated caller
+//   - tenant
+//   - deadline
+//
+// The RequestContext is extracted from inbound requests by middleware, e.g., see `fxapp.Builder.EnableRequestContext()`,
+// and log events are enriched with the RequestContext fields via `eventlog.NewContextLogger()`.
+package reqctx
@@ -0,0 +1,110 @@
+/*
+ * Copyright (c) 2019 OysterPack, Inc.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ * http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package reqctx
+
+import (
+	"context"
+	"github.com/rs/zerolog"
+	"net/http"
+	"time"
+)
+
+// standard request context headers
+const (
+	CorrelationIDHeader = "X-Correlation-ID"
+	TenantHeader        = "X-Tenant-ID"
+)
+
+// RequestContext carries the request scoped metadata. Blank fields mean the metadata is not known, e.g., the request is
+// not authenticated.
+type RequestContext struct {
+	CorrelationID string
+	Principal     string
+	Tenant        string
+	// Deadline is zero if the request has no deadline
+	Deadline time.Time
+}
+
+// MarshalZerologObject implements the zerolog.LogObjectMarshaler interface. Blank fields are omitted.
+//
+//	type Data struct {
+//		CorrelationID string `json:"cid"`
+//		Principal     string `json:"p"`
+//		Tenant        string `json:"t"`
+//		// unix time
+//		Deadline      uint   `json:"dl"`
+//	}
+func (rc RequestContext) MarshalZerologObject(e *zerolog.Event) {
+	if rc.CorrelationID != "" {
+		e.Str("cid", rc.CorrelationID)
+	}
+	if rc.Principal != "" {
+		e.Str("p", rc.Principal)
+	}
+	if rc.Tenant != "" {
+		e.Str("t", rc.Tenant)
+	}
+	if !rc.Deadline.IsZero() {
+		e.Time("dl", rc.Deadline)
+	}
+}
+
+type contextKey struct{}
+
+// NewContext returns a new context that carries the RequestContext
+func NewContext(ctx context.Context, rc RequestContext) context.Context {
+	return context.WithValue(ctx, contextKey{}, rc)
+}
+
+// FromContext returns the RequestContext that is carried by the context, if present
+func FromContext(ctx context.Context) (RequestContext, bool) {
+	rc, ok := ctx.Value(contextKey{}).(RequestContext)
+	return rc, ok
+}
+
+// CorrelationID returns the correlation ID that is carried by the context. Blank is returned if not present.
+func CorrelationID(ctx context.Context) string {
+	rc, _ := FromContext(ctx)
+	return rc.CorrelationID
+}
+
+// Principal returns the principal that is carried by the context. Blank is returned if not present.
+func Principal(ctx context.Context) string {
+	rc, _ := FromContext(ctx)
+	return rc.Principal
+}
+
+// Tenant returns the tenant that is carried by the context. Blank is returned if not present.
+func Tenant(ctx context.Context) string {
+	rc, _ := FromContext(ctx)
+	return rc.Tenant
+}
+
+// SetHeaders propagates the correlation ID and tenant via the outbound request headers - see `CorrelationIDHeader` and
+// `TenantHeader`. Blank fields are not propagated.
+func SetHeaders(ctx context.Context, header http.Header) {
+	rc, ok := FromContext(ctx)
+	if !ok {
+		return
+	}
+	if rc.CorrelationID != "" {
+		header.Set(CorrelationIDHeader, rc.CorrelationID)
+	}
+	if rc.Tenant != "" {
+		header.Set(TenantHeader, rc.Tenant)
+	}
+}
@@ -0,0 +1,64 @@
+/*
+ * Copyright (c) 2019 OysterPack, Inc.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ * http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package reqctx_test
+
+import (
+	"context"
+	"github.com/oysterpack/andiamo/pkg/reqctx"
+	"github.com/stretchr/testify/assert"
+	"net/http"
+	"testing"
+)
+
+func TestRequestContext(t *testing.T) {
+	t.Parallel()
+
+	_, ok := reqctx.FromContext(context.Background())
+	assert.False(t, ok)
+	assert.Empty(t, reqctx.CorrelationID(context.Background()))
+
+	rc := reqctx.RequestContext{
+		CorrelationID: "01DJ1PS0X5DP31TRPNCRS5QCP5",
+		Principal:     "alice",
+		Tenant:        "acme",
+	}
+	ctx := reqctx.NewContext(context.Background(), rc)
+	actual, ok := reqctx.FromContext(ctx)
+	assert.True(t, ok)
+	assert.Equal(t, rc, actual)
+	assert.Equal(t, rc.CorrelationID, reqctx.CorrelationID(ctx))
+	assert.Equal(t, rc.Principal, reqctx.Principal(ctx))
+	assert.Equal(t, rc.Tenant, reqctx.Tenant(ctx))
+}
+
+func TestSetHeaders(t *testing.T) {
+	t.Parallel()
+
+	header := make(http.Header)
+	reqctx.SetHeaders(context.Background(), header)
+	assert.Empty(t, header)
+
+	reqctx.SetHeaders(reqctx.NewContext(context.Background(), reqctx.RequestContext{
+		CorrelationID: "01DJ1PS0X5DP31TRPNCRS5QCP5",
+		Principal:     "alice",
+		Tenant:        "acme",
+	}), header)
+	assert.Equal(t, "01DJ1PS0X5DP31TRPNCRS5QCP5", header.Get(reqctx.CorrelationIDHeader))
+	assert.Equal(t, "acme", header.Get(reqctx.TenantHeader))
+	// the principal is not propagated, i.e., downstream services must authenticate the caller
+	assert.Len(t, header, 2)
+}
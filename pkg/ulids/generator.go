@@ -0,0 +1,216 @@
+/*
+ * Copyright (c) 2019 OysterPack, Inc.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ * http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package ulids
+
+import (
+	"bufio"
+	crand "crypto/rand"
+	"encoding/binary"
+	"github.com/oklog/ulid"
+	"io"
+	"math/rand"
+	"sync"
+	"time"
+)
+
+// Generator generates ULIDs
+//   - is safe for concurrent use.
+//   - panics if a ULID fails to be generated
+type Generator func() ulid.ULID
+
+// BatchGenerator generates n ULIDs at a time, which is designed for high throughput callers, i.e., the entropy reader
+// is acquired once per batch instead of once per ULID. All ULIDs within the batch share the same timestamp.
+//   - is safe for concurrent use.
+//   - panics if a ULID fails to be generated
+type BatchGenerator func(n int) []ulid.ULID
+
+// EntropySource is used to construct the entropy reader that is used to generate the ULID random component.
+//
+// The returned reader does not need to be safe for concurrent use, i.e., the generator guarantees that a reader is used
+// by a single goroutine at a time.
+type EntropySource func() io.Reader
+
+// CryptoEntropy is the cryptographically secure entropy source, i.e., crypto/rand.
+//
+// The reader is buffered, which amortizes the cost of reading from crypto/rand over multiple ULIDs.
+func CryptoEntropy() io.Reader {
+	return bufio.NewReader(crand.Reader)
+}
+
+// MathEntropy is the math/rand based entropy source, which is seeded via crypto/rand.
+//
+// NOTE: it is faster than CryptoEntropy, but is not cryptographically secure, i.e., the ULIDs are predictable. Thus,
+// it must not be used when the ULIDs are used as secrets, e.g., session IDs.
+func MathEntropy() io.Reader {
+	var seed [8]byte
+	if _, err := io.ReadFull(crand.Reader, seed[:]); err != nil {
+		panic(err)
+	}
+	return rand.New(rand.NewSource(int64(binary.LittleEndian.Uint64(seed[:]))))
+}
+
+// SeededEntropy returns a math/rand based entropy source using the specified seed, i.e., it is deterministic, which is
+// useful for tests.
+//
+// NOTE: each reader that is constructed uses the same seed. Thus, in order to generate deterministic ULIDs, the generator
+// entropy readers must not be pooled and the generator clock must be fixed - see `GeneratorOpts`.
+func SeededEntropy(seed int64) EntropySource {
+	return func() io.Reader {
+		return rand.New(rand.NewSource(seed))
+	}
+}
+
+// GeneratorOpts is used to configure the ULID Generator
+type GeneratorOpts struct {
+	// Entropy defaults to CryptoEntropy
+	Entropy EntropySource
+	// Monotonic is used to generate ULIDs in increasing order within the same millisecond.
+	//
+	// NOTE: if the entropy readers are pooled, then ULIDs are monotonic per entropy reader, i.e., ULIDs that are
+	// generated concurrently within the same millisecond are not strictly ordered.
+	Monotonic bool
+	// Pooled entropy readers are used, i.e., readers are drawn from a sync.Pool. Pooling avoids lock contention on a
+	// shared entropy reader when ULIDs are generated concurrently. If false, then a single entropy reader is shared,
+	// which is synchronized via a mutex.
+	Pooled bool
+	// Clock is used to get the ULID timestamp, which defaults to time.Now.
+	Clock func() time.Time
+}
+
+// DefaultGeneratorOpts returns the default generator options, which are used by `MustNew()` and `NewBatch()`:
+//   - Entropy = CryptoEntropy
+//   - Pooled = true
+func DefaultGeneratorOpts() GeneratorOpts {
+	return GeneratorOpts{
+		Entropy: CryptoEntropy,
+		Pooled:  true,
+	}
+}
+
+type monotonicReader interface {
+	MonotonicRead(ms uint64, entropy []byte) error
+}
+
+// entropyReader provides the buffer that the ULID entropy is read into, which avoids allocating per generated ULID.
+type entropyReader struct {
+	io.Reader
+	buf [10]byte
+}
+
+func (r *entropyReader) newULID(ms uint64) ulid.ULID {
+	var err error
+	if m, ok := r.Reader.(monotonicReader); ok {
+		err = m.MonotonicRead(ms, r.buf[:])
+	} else {
+		_, err = io.ReadFull(r.Reader, r.buf[:])
+	}
+	if err != nil {
+		panic(err)
+	}
+	var id ulid.ULID
+	if err = id.SetTime(ms); err != nil {
+		panic(err)
+	}
+	id.SetEntropy(r.buf[:])
+	return id
+}
+
+// generator manages the entropy readers, which are either pooled or shared
+type generator struct {
+	clock func() time.Time
+
+	pool *sync.Pool
+
+	m      sync.Mutex
+	reader *entropyReader
+}
+
+func newGenerator(opts GeneratorOpts) *generator {
+	if opts.Entropy == nil {
+		opts.Entropy = CryptoEntropy
+	}
+	if opts.Clock == nil {
+		opts.Clock = time.Now
+	}
+	newEntropyReader := func() *entropyReader {
+		reader := opts.Entropy()
+		if opts.Monotonic {
+			reader = ulid.Monotonic(reader, 0)
+		}
+		return &entropyReader{Reader: reader}
+	}
+
+	g := &generator{clock: opts.Clock}
+	if opts.Pooled {
+		g.pool = &sync.Pool{
+			New: func() interface{} {
+				return newEntropyReader()
+			},
+		}
+	} else {
+		g.reader = newEntropyReader()
+	}
+	return g
+}
+
+func (g *generator) acquire() *entropyReader {
+	if g.pool != nil {
+		return g.pool.Get().(*entropyReader)
+	}
+	g.m.Lock()
+	return g.reader
+}
+
+func (g *generator) release(reader *entropyReader) {
+	if g.pool != nil {
+		g.pool.Put(reader)
+		return
+	}
+	g.m.Unlock()
+}
+
+// the clock is read after the entropy reader is acquired, i.e., when the entropy reader is shared, then ULIDs are
+// generated in timestamp order
+func (g *generator) newULID() ulid.ULID {
+	reader := g.acquire()
+	defer g.release(reader)
+	return reader.newULID(ulid.Timestamp(g.clock()))
+}
+
+func (g *generator) newBatch(n int) []ulid.ULID {
+	if n <= 0 {
+		return nil
+	}
+	ids := make([]ulid.ULID, n)
+	reader := g.acquire()
+	defer g.release(reader)
+	ms := ulid.Timestamp(g.clock())
+	for i := range ids {
+		ids[i] = reader.newULID(ms)
+	}
+	return ids
+}
+
+// NewGenerator constructs a new ULID Generator
+func NewGenerator(opts GeneratorOpts) Generator {
+	return newGenerator(opts).newULID
+}
+
+// NewBatchGenerator constructs a new ULID BatchGenerator
+func NewBatchGenerator(opts GeneratorOpts) BatchGenerator {
+	return newGenerator(opts).newBatch
+}
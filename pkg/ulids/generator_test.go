@@ -0,0 +1,279 @@
+/*
+ * Copyright (c) 2019 OysterPack, Inc.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ * http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package ulids_test
+
+import (
+	"encoding/binary"
+	"fmt"
+	"github.com/oklog/ulid"
+	"github.com/oysterpack/andiamo/pkg/ulids"
+	"io"
+	"runtime"
+	"sort"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+var generatorOpts = map[string]ulids.GeneratorOpts{
+	"crypto":                  {Entropy: ulids.CryptoEntropy},
+	"crypto monotonic":        {Entropy: ulids.CryptoEntropy, Monotonic: true},
+	"crypto pooled":           {Entropy: ulids.CryptoEntropy, Pooled: true},
+	"crypto monotonic pooled": {Entropy: ulids.CryptoEntropy, Monotonic: true, Pooled: true},
+	"math":                    {Entropy: ulids.MathEntropy},
+	"math monotonic":          {Entropy: ulids.MathEntropy, Monotonic: true},
+	"math pooled":             {Entropy: ulids.MathEntropy, Pooled: true},
+	"math monotonic pooled":   {Entropy: ulids.MathEntropy, Monotonic: true, Pooled: true},
+	"defaults":                ulids.DefaultGeneratorOpts(),
+	"zero value":              {},
+}
+
+func TestNewGenerator(t *testing.T) {
+	t.Parallel()
+
+	for name, opts := range generatorOpts {
+		name, opts := name, opts
+		t.Run(name, func(t *testing.T) {
+			t.Parallel()
+			newULID := ulids.NewGenerator(opts)
+
+			const goroutines, count = 4, 1000
+			generated := make(chan ulid.ULID, goroutines*count)
+			var wg sync.WaitGroup
+			wg.Add(goroutines)
+			for i := 0; i < goroutines; i++ {
+				go func() {
+					defer wg.Done()
+					for j := 0; j < count; j++ {
+						generated <- newULID()
+					}
+				}()
+			}
+			wg.Wait()
+			close(generated)
+
+			ulidsMap := make(map[ulid.ULID]bool, goroutines*count)
+			for uid := range generated {
+				if ulids.IsZero(uid) {
+					t.Fatal("zero ULID was generated")
+				}
+				if ulidsMap[uid] {
+					t.Fatal("duplicate ULID found")
+				}
+				ulidsMap[uid] = true
+			}
+		})
+	}
+
+	t.Run("monotonic", func(t *testing.T) {
+		t.Parallel()
+		for _, entropy := range []ulids.EntropySource{ulids.CryptoEntropy, ulids.MathEntropy} {
+			newULID := ulids.NewGenerator(ulids.GeneratorOpts{Entropy: entropy, Monotonic: true})
+			prev := newULID()
+			for i := 0; i < 1000; i++ {
+				uid := newULID()
+				if uid.Compare(prev) <= 0 {
+					t.Fatalf("ULIDs are not monotonic: %s <= %s", uid, prev)
+				}
+				prev = uid
+			}
+		}
+	})
+
+}
+
+// sequenceEntropy writes the read sequence number into the entropy, i.e., the entropy records the generation order
+type sequenceEntropy struct {
+	seq uint64
+}
+
+func (r *sequenceEntropy) Read(p []byte) (int, error) {
+	r.seq++
+	for i := range p {
+		p[i] = 0
+	}
+	binary.BigEndian.PutUint64(p[len(p)-8:], r.seq)
+	return len(p), nil
+}
+
+// ULIDs that are generated concurrently using a shared entropy reader must be generated in timestamp order
+func TestNewGenerator_ConcurrentMonotonicity(t *testing.T) {
+	t.Parallel()
+
+	var ms int64
+	newULID := ulids.NewGenerator(ulids.GeneratorOpts{
+		Entropy: func() io.Reader { return &sequenceEntropy{} },
+		// each clock read advances the time by 1 msec
+		Clock: func() time.Time {
+			now := time.Unix(0, atomic.AddInt64(&ms, 1)*int64(time.Millisecond))
+			// yield, which makes it likely that another goroutine generates a ULID in between, if the clock is not read
+			// under the generator lock
+			runtime.Gosched()
+			return now
+		},
+	})
+
+	const goroutines, count = 8, 1000
+	generated := make(chan ulid.ULID, goroutines*count)
+	var wg sync.WaitGroup
+	wg.Add(goroutines)
+	for i := 0; i < goroutines; i++ {
+		go func() {
+			defer wg.Done()
+			for j := 0; j < count; j++ {
+				generated <- newULID()
+			}
+		}()
+	}
+	wg.Wait()
+	close(generated)
+
+	// sort the ULIDs by generation order
+	ids := make([]ulid.ULID, 0, goroutines*count)
+	for uid := range generated {
+		ids = append(ids, uid)
+	}
+	sequence := func(uid ulid.ULID) uint64 {
+		entropy := uid.Entropy()
+		return binary.BigEndian.Uint64(entropy[len(entropy)-8:])
+	}
+	sort.Slice(ids, func(i, j int) bool { return sequence(ids[i]) < sequence(ids[j]) })
+	for i := 1; i < len(ids); i++ {
+		if ids[i].Compare(ids[i-1]) <= 0 {
+			t.Fatalf("*** non-monotonic: %s generated after %s", ids[i], ids[i-1])
+		}
+	}
+}
+
+func TestNewGenerator_Deterministic(t *testing.T) {
+	t.Parallel()
+
+	now := time.Date(2019, time.August, 1, 0, 0, 0, 0, time.UTC)
+	opts := ulids.GeneratorOpts{
+		Entropy: ulids.SeededEntropy(1),
+		Clock:   func() time.Time { return now },
+	}
+	newULID1, newULID2 := ulids.NewGenerator(opts), ulids.NewGenerator(opts)
+	for i := 0; i < 100; i++ {
+		uid := newULID1()
+		if uid != newULID2() {
+			t.Fatal("*** ULIDs should be deterministic")
+		}
+		if uid.Time() != ulid.Timestamp(now) {
+			t.Fatalf("*** ULID timestamp should be based on the clock: %v", ulid.Time(uid.Time()))
+		}
+	}
+}
+
+func TestNewBatch(t *testing.T) {
+	t.Parallel()
+
+	t.Run("default generator", func(t *testing.T) {
+		t.Parallel()
+		batch := ulids.NewBatch(100)
+		if len(batch) != 100 {
+			t.Fatalf("*** batch size should be 100: %d", len(batch))
+		}
+		ulidsMap := make(map[ulid.ULID]bool, len(batch))
+		for _, uid := range batch {
+			if ulidsMap[uid] {
+				t.Fatal("duplicate ULID found")
+			}
+			ulidsMap[uid] = true
+			if uid.Time() != batch[0].Time() {
+				t.Fatal("*** ULIDs within a batch should share the same timestamp")
+			}
+		}
+	})
+
+	t.Run("invalid batch size", func(t *testing.T) {
+		t.Parallel()
+		for _, n := range []int{0, -1} {
+			if batch := ulids.NewBatch(n); batch != nil {
+				t.Errorf("*** no ULIDs should be generated for batch size %d: %v", n, batch)
+			}
+		}
+	})
+
+	t.Run("monotonic", func(t *testing.T) {
+		t.Parallel()
+		newBatch := ulids.NewBatchGenerator(ulids.GeneratorOpts{Monotonic: true, Pooled: true})
+		batch := newBatch(1000)
+		if !sort.SliceIsSorted(batch, func(i, j int) bool { return batch[i].Compare(batch[j]) < 0 }) {
+			t.Fatal("*** ULIDs are not monotonic")
+		}
+	})
+
+	t.Run("deterministic", func(t *testing.T) {
+		t.Parallel()
+		now := time.Now()
+		opts := ulids.GeneratorOpts{
+			Entropy:   ulids.SeededEntropy(1),
+			Monotonic: true,
+			Clock:     func() time.Time { return now },
+		}
+		batch1, batch2 := ulids.NewBatchGenerator(opts)(10), ulids.NewBatchGenerator(opts)(10)
+		for i := range batch1 {
+			if batch1[i] != batch2[i] {
+				t.Fatal("*** ULIDs should be deterministic")
+			}
+		}
+	})
+}
+
+// MustNew is called for each event and app instance, thus the default generator should not allocate
+func TestNewGenerator_DefaultOptsDoNotAllocate(t *testing.T) {
+	newULID := ulids.NewGenerator(ulids.DefaultGeneratorOpts())
+	if allocs := testing.AllocsPerRun(1000, func() { newULID() }); allocs > 0 {
+		t.Errorf("*** expected no allocations, but was: %v", allocs)
+	}
+}
+
+func BenchmarkNewGenerator(b *testing.B) {
+	for name, opts := range generatorOpts {
+		newULID := ulids.NewGenerator(opts)
+		b.Run(name, func(b *testing.B) {
+			b.ReportAllocs()
+			for i := 0; i < b.N; i++ {
+				newULID()
+			}
+		})
+		b.Run(name+" parallel", func(b *testing.B) {
+			b.ReportAllocs()
+			b.RunParallel(func(pb *testing.PB) {
+				for pb.Next() {
+					newULID()
+				}
+			})
+		})
+	}
+}
+
+func BenchmarkNewBatch(b *testing.B) {
+	for _, n := range []int{10, 100} {
+		n := n
+		b.Run(fmt.Sprintf("batch size %d", n), func(b *testing.B) {
+			b.ReportAllocs()
+			b.RunParallel(func(pb *testing.PB) {
+				for pb.Next() {
+					ulids.NewBatch(n)
+				}
+			})
+		})
+	}
+}
@@ -18,29 +18,21 @@
 package ulids
 
 import (
-	"crypto/rand"
 	"errors"
 	"github.com/oklog/ulid"
-	"sync"
 )
 
 // MonotonicULIDGenerator returns a function that generates ULID(s) in strictly increasing order.
 //   - is safe for concurrent use.
 //   - panics if a ULID fails to be generated
 func MonotonicULIDGenerator() func() ulid.ULID {
-	var m sync.Mutex
-	entropy := ulid.Monotonic(rand.Reader, 0)
-
-	return func() (uid ulid.ULID) {
-		m.Lock()
-		uid = ulid.MustNew(ulid.Now(), entropy)
-		m.Unlock()
-		return
-	}
+	return NewGenerator(GeneratorOpts{
+		Entropy:   CryptoEntropy,
+		Monotonic: true,
+	})
 }
 
 // RandomULIDGenerator returns a function that generates a cryptographically random ULID
-//   - this is ~5x slower than MonotonicULIDGenerator functions
 //   - panics if a ULID fails to be generated
 func RandomULIDGenerator() func() ulid.ULID {
 	return func() ulid.ULID {
@@ -48,10 +40,19 @@ func RandomULIDGenerator() func() ulid.ULID {
 	}
 }
 
+var defaultGenerator = newGenerator(DefaultGeneratorOpts())
+
 // MustNew generates a new crypto/rand based ULID.
 //   - panics if a ULID fails to be generated
+//   - uses a pooled generator, i.e., is safe for concurrent use without lock contention - see `DefaultGeneratorOpts()`
 func MustNew() ulid.ULID {
-	return ulid.MustNew(ulid.Now(), rand.Reader)
+	return defaultGenerator.newULID()
+}
+
+// NewBatch generates n crypto/rand based ULIDs, which share the same timestamp - see `BatchGenerator`.
+//   - panics if a ULID fails to be generated
+func NewBatch(n int) []ulid.ULID {
+	return defaultGenerator.newBatch(n)
 }
 
 // Parse tries to parse the id into a ULID.